@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/database"
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/zerodha/logf"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// ADMIN COMMANDS
+// ============================================================================
+
+// adminSetup loads the config and connects to the database for an admin command
+func adminSetup(name, configPath string) (*config.Config, *gorm.DB, logf.Logger) {
+	lo := logf.New(logf.Opts{
+		Level:           logf.InfoLevel,
+		TimestampFormat: "2006-01-02 15:04:05",
+		DefaultFields:   []any{"app", "whatomate-" + name},
+	})
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		logConfigErrors(lo, err)
+		lo.Fatal("Failed to load config", "error", err)
+	}
+	setupEncryption(cfg, lo)
+
+	db, err := database.NewPostgres(&cfg.Database, false)
+	if err != nil {
+		lo.Fatal("Failed to connect to database", "error", err)
+	}
+	return cfg, db, lo
+}
+
+// findOrganization finds the organization of an -org flag, exiting if there's none
+func findOrganization(db *gorm.DB, lo logf.Logger, ref string) *models.Organization {
+	if ref == "" {
+		fmt.Println("-org is required")
+		os.Exit(1)
+	}
+	org, err := database.FindOrganization(db, ref)
+	if err != nil {
+		lo.Fatal("Failed to find organization", "error", err, "org", ref)
+	}
+	return org
+}
+
+// randomPassword returns a password for admins created without one
+func randomPassword() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func runCreateOrg(args []string) {
+	createFlags := flag.NewFlagSet("create-org", flag.ExitOnError)
+	configPath := createFlags.String("config", "config.toml", "Path to config file")
+	name := createFlags.String("name", "", "Organization name")
+	slug := createFlags.String("slug", "", "Organization slug (derived from the name when empty)")
+	email := createFlags.String("admin-email", "", "Email of the organization's admin")
+	password := createFlags.String("admin-password", "", "Password of the admin (generated when empty)")
+	fullName := createFlags.String("admin-name", "", "Full name of the admin")
+	superAdmin := createFlags.Bool("super-admin", false, "Make the admin a super admin")
+	_ = createFlags.Parse(args)
+
+	if *name == "" || *email == "" {
+		fmt.Println("-name and -admin-email are required")
+		os.Exit(1)
+	}
+	generated := *password == ""
+	if generated {
+		*password = randomPassword()
+	}
+
+	_, db, lo := adminSetup("create-org", *configPath)
+	org, user, err := database.CreateOrganization(db, *name, *slug, database.NewAdmin{
+		Email:      *email,
+		Password:   *password,
+		FullName:   *fullName,
+		SuperAdmin: *superAdmin,
+	})
+	if err != nil {
+		lo.Fatal("Failed to create organization", "error", err)
+	}
+
+	fmt.Printf("Organization created\n\n  Organization:  %s (%s)\n  ID:            %s\n  Admin:         %s\n", org.Name, org.Slug, org.ID, user.Email)
+	if generated {
+		fmt.Printf("  Password:      %s\n", *password)
+	}
+}
+
+func runCreateAdmin(args []string) {
+	createFlags := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	configPath := createFlags.String("config", "config.toml", "Path to config file")
+	orgRef := createFlags.String("org", "", "Organization ID or slug")
+	email := createFlags.String("email", "", "Email of the admin")
+	password := createFlags.String("password", "", "Password of the admin (generated when empty)")
+	fullName := createFlags.String("name", "", "Full name of the admin")
+	superAdmin := createFlags.Bool("super-admin", false, "Make the admin a super admin")
+	_ = createFlags.Parse(args)
+
+	if *email == "" {
+		fmt.Println("-email is required")
+		os.Exit(1)
+	}
+	generated := *password == ""
+	if generated {
+		*password = randomPassword()
+	}
+
+	_, db, lo := adminSetup("create-admin", *configPath)
+	org := findOrganization(db, lo, *orgRef)
+	user, err := database.CreateAdmin(db, org.ID, database.NewAdmin{
+		Email:      *email,
+		Password:   *password,
+		FullName:   *fullName,
+		SuperAdmin: *superAdmin,
+	})
+	if err != nil {
+		lo.Fatal("Failed to create admin", "error", err)
+	}
+
+	fmt.Printf("Admin %s created in %s\n", user.Email, org.Name)
+	if generated {
+		fmt.Printf("Password: %s\n", *password)
+	}
+}
+
+func runRotateJWTSecret(args []string) {
+	rotateFlags := flag.NewFlagSet("rotate-jwt-secret", flag.ExitOnError)
+	configPath := rotateFlags.String("config", "config.toml", "Path to config file")
+	write := rotateFlags.Bool("write", false, "Write the new secret to the config file")
+	reload := rotateFlags.Bool("reload", false, "With -write, tell the running servers to reload their configuration")
+	_ = rotateFlags.Parse(args)
+
+	secret, err := config.GenerateJWTSecret()
+	if err != nil {
+		fmt.Printf("Failed to generate secret: %v\n", err)
+		os.Exit(1)
+	}
+	if !*write {
+		fmt.Println(secret)
+		return
+	}
+
+	lo := logf.New(logf.Opts{
+		Level:           logf.InfoLevel,
+		TimestampFormat: "2006-01-02 15:04:05",
+		DefaultFields:   []any{"app", "whatomate-rotate-jwt-secret"},
+	})
+
+	// Write to the layer the secret is loaded from, so it's the one servers use
+	path, err := config.JWTSecretFile(*configPath)
+	if err != nil {
+		fmt.Printf("Can't write the JWT secret: %v\n", err)
+		fmt.Println("Run rotate-jwt-secret without -write to print a new secret")
+		os.Exit(1)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		lo.Fatal("Failed to read config", "error", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		lo.Fatal("Failed to read config", "error", err)
+	}
+	if err := os.WriteFile(path, config.SetJWTSecret(content, secret), info.Mode().Perm()); err != nil {
+		lo.Fatal("Failed to write config", "error", err)
+	}
+	fmt.Printf("JWT secret written to %s\n", path)
+
+	if !*reload {
+		fmt.Println("Reload the servers' configuration to sign everyone out and start using it")
+		return
+	}
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		logConfigErrors(lo, err)
+		lo.Fatal("Failed to load config", "error", err)
+	}
+	rdb, err := database.NewRedis(&cfg.Redis)
+	if err != nil {
+		lo.Fatal("Failed to connect to Redis", "error", err)
+	}
+	if err := queue.NewPublisher(rdb, lo).PublishConfigReload(context.Background()); err != nil {
+		lo.Fatal("Failed to tell the servers to reload", "error", err)
+	}
+	fmt.Println("Servers told to reload their configuration, everyone is signed out")
+}
+
+func runDeadLetters(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		os.Exit(1)
+	}
+	action := args[0]
+
+	deadLetterFlags := flag.NewFlagSet("dead-letters", flag.ExitOnError)
+	configPath := deadLetterFlags.String("config", "config.toml", "Path to config file")
+	orgRef := deadLetterFlags.String("org", "", "Organization ID or slug (all organizations when empty)")
+	kind := deadLetterFlags.String("kind", "", "Kind of dead letters: campaign_message, scheduled_message or webhook")
+	limit := deadLetterFlags.Int("limit", 500, "With retry, most dead letters to retry")
+	_ = deadLetterFlags.Parse(args[1:])
+
+	cfg, db, lo := adminSetup("dead-letters", *configPath)
+	var orgID uuid.UUID
+	if *orgRef != "" {
+		orgID = findOrganization(db, lo, *orgRef).ID
+	}
+
+	switch action {
+	case "list":
+		var counts []struct {
+			Slug  string
+			Kind  string
+			Count int64
+		}
+		query := db.Table("dead_letters").
+			Select("organizations.slug AS slug, dead_letters.kind AS kind, COUNT(*) AS count").
+			Joins("JOIN organizations ON organizations.id = dead_letters.organization_id").
+			Where("dead_letters.status = ? AND dead_letters.deleted_at IS NULL", models.DeadLetterStatusPending)
+		if orgID != uuid.Nil {
+			query = query.Where("dead_letters.organization_id = ?", orgID)
+		}
+		if *kind != "" {
+			query = query.Where("dead_letters.kind = ?", *kind)
+		}
+		if err := query.Group("organizations.slug, dead_letters.kind").Order("organizations.slug, dead_letters.kind").Scan(&counts).Error; err != nil {
+			lo.Fatal("Failed to count dead letters", "error", err)
+		}
+		if len(counts) == 0 {
+			fmt.Println("No pending dead letters")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ORGANIZATION\tKIND\tPENDING")
+		for _, c := range counts {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", c.Slug, c.Kind, c.Count)
+		}
+		_ = w.Flush()
+
+	case "retry":
+		rdb, err := database.NewRedis(&cfg.Redis)
+		if err != nil {
+			lo.Fatal("Failed to connect to Redis", "error", err)
+		}
+		app := &handlers.App{
+			Config: cfg,
+			DB:     db,
+			Redis:  rdb,
+			Log:    lo,
+			Queue:  queue.NewRedisQueue(rdb, lo),
+		}
+		// Webhook payloads can only be handed to the servers' webhook workers
+		if cfg.WhatsApp.WebhookWorkers > 0 {
+			app.Webhooks = queue.NewWebhookQueue(rdb)
+		} else if *kind == string(models.DeadLetterKindWebhook) {
+			fmt.Println("Webhook dead letters can't be retried from the CLI without webhook workers, retry them in the app")
+			os.Exit(1)
+		}
+
+		retried, failed, err := app.RetryPendingDeadLetters(context.Background(), orgID, models.DeadLetterKind(*kind), *limit)
+		if err != nil {
+			lo.Fatal("Failed to retry dead letters", "error", err)
+		}
+		for _, f := range failed {
+			fmt.Printf("%s: %s\n", f.ID, f.Error)
+		}
+		fmt.Printf("%d retried, %d failed\n", retried, len(failed))
+
+	default:
+		fmt.Printf("Unknown dead-letters action: %s\n\n", action)
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+func runOrgSettings(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		os.Exit(1)
+	}
+	action := args[0]
+
+	settingsFlags := flag.NewFlagSet("org-settings", flag.ExitOnError)
+	configPath := settingsFlags.String("config", "config.toml", "Path to config file")
+	orgRef := settingsFlags.String("org", "", "Organization ID or slug")
+	file := settingsFlags.String("file", "", "Settings file (standard output or input when empty)")
+	dryRun := settingsFlags.Bool("dry-run", false, "With import, report what would change without importing")
+	_ = settingsFlags.Parse(args[1:])
+
+	cfg, db, lo := adminSetup("org-settings", *configPath)
+	org := findOrganization(db, lo, *orgRef)
+
+	switch action {
+	case "export":
+		settings, err := database.ExportOrgSettings(db, org.ID)
+		if err != nil {
+			lo.Fatal("Failed to export settings", "error", err)
+		}
+		out, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			lo.Fatal("Failed to export settings", "error", err)
+		}
+		out = append(out, '\n')
+		if *file == "" {
+			_, _ = os.Stdout.Write(out)
+			return
+		}
+		// The file has the organization's integration credentials
+		if err := os.WriteFile(*file, out, 0o600); err != nil {
+			lo.Fatal("Failed to write settings", "error", err)
+		}
+		fmt.Printf("Settings of %s exported to %s\n", org.Name, *file)
+
+	case "import":
+		in := os.Stdin
+		if *file != "" {
+			f, err := os.Open(*file)
+			if err != nil {
+				lo.Fatal("Failed to read settings", "error", err)
+			}
+			defer f.Close()
+			in = f
+		}
+		var settings database.OrgSettings
+		if err := json.NewDecoder(in).Decode(&settings); err != nil {
+			lo.Fatal("Failed to read settings", "error", err)
+		}
+
+		// Servers cache chatbot settings, flows and rules in Redis, which the import clears
+		rdb, err := database.NewRedis(&cfg.Redis)
+		if err != nil {
+			lo.Fatal("Failed to connect to Redis", "error", err)
+		}
+		app := &handlers.App{Config: cfg, DB: db, Redis: rdb, Log: lo}
+		result, err := app.ApplyOrgSettingsBundle(org.ID, &settings, database.OrgSettingsImport{DryRun: *dryRun})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		for _, kind := range []string{"chatbot_settings", "templates", "flows", "keyword_rules", "canned_responses"} {
+			fmt.Printf("%s: %d created, %d updated\n", kind, result.Created[kind], result.Updated[kind])
+		}
+		for _, warning := range result.Warnings {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+		if *dryRun {
+			fmt.Printf("Dry run, nothing was imported into %s\n", org.Name)
+		} else {
+			fmt.Printf("Settings imported into %s\n", org.Name)
+		}
+
+	default:
+		fmt.Printf("Unknown org-settings action: %s\n\n", action)
+		printUsage()
+		os.Exit(1)
+	}
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/shridarpatil/whatomate/internal/config"
@@ -14,9 +19,21 @@ import (
 	"github.com/shridarpatil/whatomate/internal/frontend"
 	"github.com/shridarpatil/whatomate/internal/handlers"
 	"github.com/shridarpatil/whatomate/internal/middleware"
+	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/shridarpatil/whatomate/internal/storage"
+	"github.com/shridarpatil/whatomate/internal/tracing"
 	"github.com/shridarpatil/whatomate/internal/websocket"
 	"github.com/shridarpatil/whatomate/internal/worker"
+	"github.com/shridarpatil/whatomate/pkg/crm"
+	"github.com/shridarpatil/whatomate/pkg/gcalendar"
+	"github.com/shridarpatil/whatomate/pkg/helpdesk"
+	"github.com/shridarpatil/whatomate/pkg/messenger"
+	"github.com/shridarpatil/whatomate/pkg/payments"
+	"github.com/shridarpatil/whatomate/pkg/shopify"
+	"github.com/shridarpatil/whatomate/pkg/telegram"
+	"github.com/shridarpatil/whatomate/pkg/translate"
+	"github.com/shridarpatil/whatomate/pkg/twilio"
 	"github.com/shridarpatil/whatomate/pkg/whatsapp"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
@@ -39,6 +56,22 @@ func main() {
 		runServer(os.Args[2:])
 	case "worker":
 		runWorker(os.Args[2:])
+	case "migrate":
+		runMigrate(os.Args[2:])
+	case "seed":
+		runSeed(os.Args[2:])
+	case "rotate-keys":
+		runRotateKeys(os.Args[2:])
+	case "create-org":
+		runCreateOrg(os.Args[2:])
+	case "create-admin":
+		runCreateAdmin(os.Args[2:])
+	case "rotate-jwt-secret":
+		runRotateJWTSecret(os.Args[2:])
+	case "dead-letters":
+		runDeadLetters(os.Args[2:])
+	case "org-settings":
+		runOrgSettings(os.Args[2:])
 	case "version":
 		fmt.Printf("Whatomate %s (built %s)\n", Version, BuildTime)
 	case "help", "-h", "--help":
@@ -59,6 +92,15 @@ Usage:
 Commands:
   server    Start the API server (with optional embedded workers)
   worker    Start background workers only (no API server)
+  migrate   Apply, roll back or list database migrations
+  seed      Load sample data into the database
+  rotate-keys  Re-encrypt stored credentials with the current encryption key
+  create-org   Create an organization and its admin
+  create-admin Add an admin to an organization
+  rotate-jwt-secret  Generate a new JWT secret, signing everyone out once it's used
+  dead-letters Count or retry pending dead letters
+  org-settings Export or import an organization's settings, flows, templates,
+               keyword rules and canned responses
   version   Show version information
   help      Show this help message
 
@@ -71,12 +113,81 @@ Worker Options:
   -config string    Path to config file (default "config.toml")
   -workers int      Number of workers to run (default 1)
 
+Migrate Commands:
+  migrate up        Apply pending migrations
+  migrate down      Roll back the last migration
+  migrate status    List migrations and whether they are applied
+
+Migrate Options:
+  -config string    Path to config file (default "config.toml")
+  -dry-run          With up, print the pending schema changes without applying them
+  -steps int        With down, number of migrations to roll back (default 1)
+
+Seed Options:
+  -config string    Path to config file (default "config.toml")
+  -demo             Create a demo organization with a channel, contacts,
+                    conversations, a template and a chatbot flow
+
+Rotate-keys Options:
+  -config string    Path to config file (default "config.toml")
+  -dry-run          Count the values to re-encrypt without rewriting them
+
+Create-org Options:
+  -config string          Path to config file (default "config.toml")
+  -name string            Organization name
+  -slug string            Organization slug (derived from the name when empty)
+  -admin-email string     Email of the organization's admin
+  -admin-password string  Password of the admin (generated when empty)
+  -admin-name string      Full name of the admin
+  -super-admin            Make the admin a super admin
+
+Create-admin Options:
+  -config string    Path to config file (default "config.toml")
+  -org string       Organization ID or slug
+  -email string     Email of the admin
+  -password string  Password of the admin (generated when empty)
+  -name string      Full name of the admin
+  -super-admin      Make the admin a super admin
+
+Rotate-jwt-secret Options:
+  -config string    Path to config file (default "config.toml")
+  -write            Write the new secret to the config file instead of printing it
+  -reload           With -write, tell the running servers to reload their configuration
+
+Dead-letters Commands:
+  dead-letters list   Count pending dead letters by organization and kind
+  dead-letters retry  Retry pending dead letters, oldest first
+
+Dead-letters Options:
+  -config string    Path to config file (default "config.toml")
+  -org string       Organization ID or slug (all organizations when empty)
+  -kind string      campaign_message, scheduled_message or webhook
+  -limit int        With retry, most dead letters to retry (default 500)
+
+Org-settings Commands:
+  org-settings export  Write an organization's settings bundle as JSON
+  org-settings import  Apply exported settings to an organization
+
+Org-settings Options:
+  -config string    Path to config file (default "config.toml")
+  -org string       Organization ID or slug
+  -file string      Settings file (standard output or input when empty)
+  -dry-run          With import, report what would change without importing
+
 Examples:
   whatomate server                     # API + 1 embedded worker
   whatomate server -workers 0          # API only (no workers)
   whatomate server -workers 4          # API + 4 embedded workers
   whatomate server -migrate            # Run migrations and start server
   whatomate worker -workers 4          # 4 workers only (no API)
+  whatomate migrate up -dry-run        # Show pending schema changes
+  whatomate migrate up                 # Apply pending migrations
+  whatomate seed -demo                 # Migrate and load demo data
+  whatomate rotate-keys                # Encrypt credentials with encryption.key
+  whatomate create-org -name Acme -admin-email admin@acme.com
+  whatomate rotate-jwt-secret -write -reload
+  whatomate dead-letters retry -org acme -kind campaign_message
+  whatomate org-settings export -org acme -file acme.json
 
 Deployment Scenarios:
   All-in-one:    whatomate server
@@ -84,6 +195,30 @@ Deployment Scenarios:
                  whatomate worker -workers 4  (on worker server)`)
 }
 
+// setupEncryption sets the master keys stored credentials are encrypted with
+func setupEncryption(cfg *config.Config, lo logf.Logger) {
+	current, previous, err := cfg.Encryption.MasterKeys()
+	if err == nil {
+		err = models.SetEncryptionKeys(current, previous...)
+	}
+	if err != nil {
+		lo.Fatal("Failed to set encryption keys", "error", err)
+	}
+	if current == nil && cfg.App.Environment == "production" {
+		lo.Warn("encryption.key is not set, credentials are stored in plaintext")
+	}
+}
+
+// logConfigErrors logs each invalid field of a configuration validation error
+func logConfigErrors(lo logf.Logger, err error) {
+	var verr *config.ValidationError
+	if errors.As(err, &verr) {
+		for _, e := range verr.Errors {
+			lo.Error("Invalid configuration", "error", e)
+		}
+	}
+}
+
 // ============================================================================
 // SERVER COMMAND
 // ============================================================================
@@ -109,6 +244,7 @@ func runServer(args []string) {
 	// Load configuration
 	cfg, err := config.Load(*configPath)
 	if err != nil {
+		logConfigErrors(lo, err)
 		lo.Fatal("Failed to load config", "error", err)
 	}
 
@@ -121,6 +257,17 @@ func runServer(args []string) {
 		})
 	}
 
+	setupEncryption(cfg, lo)
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(cfg.Tracing, Version)
+	if err != nil {
+		lo.Fatal("Failed to initialize tracing", "error", err)
+	}
+	if cfg.Tracing.Enabled {
+		lo.Info("Tracing enabled", "endpoint", cfg.Tracing.Endpoint)
+	}
+
 	// Connect to PostgreSQL
 	db, err := database.NewPostgres(&cfg.Database, cfg.App.Debug)
 	if err != nil {
@@ -148,9 +295,37 @@ func runServer(args []string) {
 
 	// Initialize Fastglue
 	g := fastglue.NewGlue()
+	g.Router.SaveMatchedRoutePath = true // Names request spans after their route
+
+	// Initialize outbound HTTP transports (proxy, CA bundle, TLS verification)
+	transports, err := cfg.Outbound.Transports()
+	if err != nil {
+		lo.Fatal("Failed to configure outbound HTTP", "error", err)
+	}
+	// AI providers get their own pool, so slow bots don't starve other outbound calls
+	transports[config.OutboundAI] = cfg.AI.Transport(transports[config.OutboundAI])
 
 	// Initialize WhatsApp client
 	waClient := whatsapp.New(lo)
+	waClient.HTTPClient.Transport = tracing.Transport(transports[config.OutboundMeta])
+	messengerClient := messenger.New(lo)
+	messengerClient.HTTPClient.Transport = tracing.Transport(transports[config.OutboundMeta])
+	tgClient := telegram.New(lo)
+	tgClient.HTTPClient.Transport = tracing.Transport(transports[config.OutboundTelegram])
+	twilioClient := twilio.New(lo)
+	twilioClient.HTTPClient.Transport = tracing.Transport(transports[config.OutboundTwilio])
+	paymentsClient := payments.New(lo)
+	paymentsClient.HTTPClient.Transport = tracing.Transport(transports[config.OutboundPayments])
+	calendarClient := gcalendar.New(lo)
+	calendarClient.HTTPClient.Transport = tracing.Transport(transports[config.OutboundCalendar])
+	shopifyClient := shopify.New(lo)
+	shopifyClient.HTTPClient.Transport = tracing.Transport(transports[config.OutboundShopify])
+	crmClient := crm.New(lo)
+	crmClient.HTTPClient.Transport = tracing.Transport(transports[config.OutboundCRM])
+	helpdeskClient := helpdesk.New(lo)
+	helpdeskClient.HTTPClient.Transport = tracing.Transport(transports[config.OutboundHelpdesk])
+	translateClient := translate.New(lo)
+	translateClient.HTTPClient.Transport = tracing.Transport(transports[config.OutboundTranslation])
 
 	// Initialize WebSocket hub
 	wsHub := websocket.NewHub(lo)
@@ -159,13 +334,48 @@ func runServer(args []string) {
 
 	// Initialize app with dependencies
 	app := &handlers.App{
-		Config:   cfg,
-		DB:       db,
-		Redis:    rdb,
-		Log:      lo,
-		WhatsApp: waClient,
-		WSHub:    wsHub,
-		Queue:    jobQueue,
+		Config:     cfg,
+		DB:         db,
+		Redis:      rdb,
+		Log:        lo,
+		WhatsApp:   waClient,
+		Telegram:   tgClient,
+		Messenger:  messengerClient,
+		Twilio:     twilioClient,
+		Payments:   paymentsClient,
+		Calendar:   calendarClient,
+		Shopify:    shopifyClient,
+		CRM:        crmClient,
+		Helpdesk:   helpdeskClient,
+		Translator: translateClient,
+		WSHub:      wsHub,
+		Queue:      jobQueue,
+
+		HTTPTransports: transports,
+		Media:          storage.New(cfg.Storage, nil),
+		ConfigPath:     *configPath,
+	}
+	if cfg.Archive.Type != "" {
+		app.Archive = storage.New(cfg.Archive, nil)
+	}
+
+	// Start webhook workers, which process webhook payloads queued by the webhook handler
+	webhookCtx, webhookCancel := context.WithCancel(context.Background())
+	if cfg.WhatsApp.WebhookWorkers > 0 {
+		app.Webhooks = queue.NewWebhookQueue(rdb)
+		for i := 0; i < cfg.WhatsApp.WebhookWorkers; i++ {
+			consumer, err := queue.NewWebhookConsumer(rdb, lo, i+1)
+			if err != nil {
+				lo.Fatal("Failed to create webhook worker", "error", err)
+			}
+			consumer.OnDrop = app.DeadLetterWebhook
+			go func() {
+				if err := consumer.Consume(webhookCtx, app.ProcessWebhook); err != nil && err != context.Canceled {
+					lo.Error("Webhook worker error", "error", err)
+				}
+			}()
+		}
+		lo.Info("Webhook workers started", "count", cfg.WhatsApp.WebhookWorkers)
 	}
 
 	// Start campaign stats subscriber for real-time WebSocket updates from worker
@@ -173,7 +383,25 @@ func runServer(args []string) {
 		lo.Error("Failed to start campaign stats subscriber", "error", err)
 	}
 
-	// Setup middleware (CORS is handled by corsWrapper at fasthttp level)
+	// Reload the configuration on SIGHUP, and when any server is asked to reload it
+	// for all servers
+	reloadCtx, reloadCancel := context.WithCancel(context.Background())
+	defer reloadCancel()
+	if err := app.StartConfigReloadSubscriber(reloadCtx); err != nil {
+		lo.Error("Failed to start config reload subscriber", "error", err)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			_, _ = app.ReloadConfig()
+		}
+	}()
+
+	// Setup middleware (CORS is handled by corsWrapper at fasthttp level). Client IPs
+	// are resolved first, for IP allowlists, login lockouts and audit logs.
+	trustedProxies, _ := config.ParseIPRanges(cfg.Security.TrustedProxies)
+	g.Before(middleware.ClientIP(trustedProxies))
 	g.Before(middleware.RequestLogger(lo))
 	g.Before(middleware.Recovery(lo))
 
@@ -182,17 +410,36 @@ func runServer(args []string) {
 
 	// Create server with CORS wrapper
 	server := &fasthttp.Server{
-		Handler:      corsWrapper(g.Handler()),
+		Handler:      middleware.RequestID(lo, tracing.Handler(corsWrapper(g.Handler()))),
 		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
 		Name:         "Whatomate",
 	}
 
-	// Start server in goroutine
+	// Listen, terminating TLS if configured
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		lo.Fatal("Failed to listen", "address", addr, "error", err)
+	}
+	if cfg.Server.TLSEnabled() {
+		tlsConfig, err := cfg.Server.TLSConfig(func(err error) {
+			if err != nil {
+				lo.Error("Failed to reload TLS certificate, serving the previous one", "error", err)
+				return
+			}
+			lo.Info("TLS certificate reloaded")
+		})
+		if err != nil {
+			lo.Fatal("Failed to configure TLS", "error", err)
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	// Start server in goroutine
 	go func() {
-		lo.Info("Server listening", "address", addr)
-		if err := server.ListenAndServe(addr); err != nil {
+		lo.Info("Server listening", "address", addr, "tls", cfg.Server.TLSEnabled(), "client_ca", cfg.Server.TLSClientCA != "")
+		if err := server.Serve(ln); err != nil {
 			lo.Fatal("Server failed", "error", err)
 		}
 	}()
@@ -203,6 +450,117 @@ func runServer(args []string) {
 	go slaProcessor.Start(slaCtx)
 	lo.Info("SLA processor started")
 
+	// Start campaign scheduler (runs every minute)
+	campaignScheduler := handlers.NewCampaignScheduler(app, time.Minute)
+	schedulerCtx, schedulerCancel := context.WithCancel(context.Background())
+	go campaignScheduler.Start(schedulerCtx)
+	lo.Info("Campaign scheduler started")
+
+	// Start scheduled message processor (runs every minute)
+	scheduledMessageProcessor := handlers.NewScheduledMessageProcessor(app, time.Minute)
+	scheduledMessageCtx, scheduledMessageCancel := context.WithCancel(context.Background())
+	go scheduledMessageProcessor.Start(scheduledMessageCtx)
+	lo.Info("Scheduled message processor started")
+
+	// Start follow-up processor (runs every minute)
+	followUpProcessor := handlers.NewFollowUpProcessor(app, time.Minute)
+	followUpCtx, followUpCancel := context.WithCancel(context.Background())
+	go followUpProcessor.Start(followUpCtx)
+	lo.Info("Follow-up processor started")
+
+	// Start sequence processor (runs every minute)
+	sequenceProcessor := handlers.NewSequenceProcessor(app, time.Minute)
+	sequenceCtx, sequenceCancel := context.WithCancel(context.Background())
+	go sequenceProcessor.Start(sequenceCtx)
+	lo.Info("Sequence processor started")
+
+	// Start abandoned cart processor (runs every minute)
+	abandonedCartProcessor := handlers.NewAbandonedCartProcessor(app, time.Minute)
+	abandonedCartCtx, abandonedCartCancel := context.WithCancel(context.Background())
+	go abandonedCartProcessor.Start(abandonedCartCtx)
+	lo.Info("Abandoned cart processor started")
+
+	// Start CRM sync processor (runs every minute)
+	crmSyncProcessor := handlers.NewCRMSyncProcessor(app, time.Minute)
+	crmSyncCtx, crmSyncCancel := context.WithCancel(context.Background())
+	go crmSyncProcessor.Start(crmSyncCtx)
+	lo.Info("CRM sync processor started")
+
+	// Start appointment reminder processor (runs every minute)
+	appointmentReminderProcessor := handlers.NewAppointmentReminderProcessor(app, time.Minute)
+	appointmentReminderCtx, appointmentReminderCancel := context.WithCancel(context.Background())
+	go appointmentReminderProcessor.Start(appointmentReminderCtx)
+	lo.Info("Appointment reminder processor started")
+
+	// Start session summary processor (runs every minute)
+	sessionSummaryProcessor := handlers.NewSessionSummaryProcessor(app, time.Minute)
+	sessionSummaryCtx, sessionSummaryCancel := context.WithCancel(context.Background())
+	go sessionSummaryProcessor.Start(sessionSummaryCtx)
+	lo.Info("Session summary processor started")
+
+	// Start usage alert processor (runs every minute)
+	usageAlertProcessor := handlers.NewUsageAlertProcessor(app, time.Minute)
+	usageAlertCtx, usageAlertCancel := context.WithCancel(context.Background())
+	go usageAlertProcessor.Start(usageAlertCtx)
+	lo.Info("Usage alert processor started")
+
+	// Start failover processor (runs every minute)
+	failoverProcessor := handlers.NewFailoverProcessor(app, time.Minute)
+	failoverCtx, failoverCancel := context.WithCancel(context.Background())
+	go failoverProcessor.Start(failoverCtx)
+	lo.Info("Failover processor started")
+
+	// Start SMS fallback processor (runs every 5 minutes)
+	smsFallbackProcessor := handlers.NewSMSFallbackProcessor(app, 5*time.Minute)
+	smsFallbackCtx, smsFallbackCancel := context.WithCancel(context.Background())
+	go smsFallbackProcessor.Start(smsFallbackCtx)
+	lo.Info("SMS fallback processor started")
+
+	// Start number health processor (runs every hour)
+	numberHealthProcessor := handlers.NewNumberHealthProcessor(app, time.Hour)
+	numberHealthCtx, numberHealthCancel := context.WithCancel(context.Background())
+	go numberHealthProcessor.Start(numberHealthCtx)
+	lo.Info("Number health processor started")
+
+	// Start catalog sync processor (runs every hour)
+	catalogSyncProcessor := handlers.NewCatalogSyncProcessor(app, time.Hour)
+	catalogSyncCtx, catalogSyncCancel := context.WithCancel(context.Background())
+	go catalogSyncProcessor.Start(catalogSyncCtx)
+	lo.Info("Catalog sync processor started")
+
+	// Start statement processor (runs every hour)
+	statementProcessor := handlers.NewStatementProcessor(app, time.Hour)
+	statementCtx, statementCancel := context.WithCancel(context.Background())
+	go statementProcessor.Start(statementCtx)
+	lo.Info("Statement processor started")
+
+	// Start trial processor (runs every hour)
+	trialProcessor := handlers.NewTrialProcessor(app, time.Hour)
+	trialCtx, trialCancel := context.WithCancel(context.Background())
+	go trialProcessor.Start(trialCtx)
+	lo.Info("Trial processor started")
+
+	// Start analytics processor (runs every hour)
+	analyticsProcessor := handlers.NewAnalyticsProcessor(app, time.Hour)
+	analyticsCtx, analyticsCancel := context.WithCancel(context.Background())
+	go analyticsProcessor.Start(analyticsCtx)
+	lo.Info("Analytics processor started")
+
+	// Start archive processor (runs every hour)
+	archiveProcessor := handlers.NewArchiveProcessor(app, time.Hour)
+	archiveCtx, archiveCancel := context.WithCancel(context.Background())
+	go archiveProcessor.Start(archiveCtx)
+	lo.Info("Archive processor started")
+
+	// Start secret refresh processor when config values reference secrets
+	var secretRefreshProcessor *handlers.SecretRefreshProcessor
+	secretRefreshCtx, secretRefreshCancel := context.WithCancel(context.Background())
+	if cfg.HasSecretReferences() && cfg.Secrets.RefreshIntervalMins > 0 {
+		secretRefreshProcessor = handlers.NewSecretRefreshProcessor(app, time.Duration(cfg.Secrets.RefreshIntervalMins)*time.Minute)
+		go secretRefreshProcessor.Start(secretRefreshCtx)
+		lo.Info("Secret refresh processor started")
+	}
+
 	// Start embedded workers
 	var workers []*worker.Worker
 	var workerCancel context.CancelFunc
@@ -242,12 +600,110 @@ func runServer(args []string) {
 	app.StopCampaignStatsSubscriber()
 	lo.Info("Campaign stats subscriber stopped")
 
+	// Stop webhook workers, payloads they haven't finished are picked up after restart
+	lo.Info("Stopping webhook workers...")
+	webhookCancel()
+
 	// Stop SLA processor
 	lo.Info("Stopping SLA processor...")
 	slaCancel()
 	slaProcessor.Stop()
 	lo.Info("SLA processor stopped")
 
+	// Stop campaign scheduler
+	lo.Info("Stopping campaign scheduler...")
+	schedulerCancel()
+	campaignScheduler.Stop()
+	lo.Info("Campaign scheduler stopped")
+
+	// Stop scheduled message processor
+	lo.Info("Stopping scheduled message processor...")
+	scheduledMessageCancel()
+	scheduledMessageProcessor.Stop()
+	lo.Info("Scheduled message processor stopped")
+
+	lo.Info("Stopping follow-up processor...")
+	followUpCancel()
+	followUpProcessor.Stop()
+	lo.Info("Follow-up processor stopped")
+
+	lo.Info("Stopping sequence processor...")
+	sequenceCancel()
+	sequenceProcessor.Stop()
+	lo.Info("Sequence processor stopped")
+
+	lo.Info("Stopping abandoned cart processor...")
+	abandonedCartCancel()
+	abandonedCartProcessor.Stop()
+	lo.Info("Abandoned cart processor stopped")
+
+	lo.Info("Stopping CRM sync processor...")
+	crmSyncCancel()
+	crmSyncProcessor.Stop()
+	lo.Info("CRM sync processor stopped")
+
+	lo.Info("Stopping appointment reminder processor...")
+	appointmentReminderCancel()
+	appointmentReminderProcessor.Stop()
+	lo.Info("Appointment reminder processor stopped")
+
+	lo.Info("Stopping session summary processor...")
+	sessionSummaryCancel()
+	sessionSummaryProcessor.Stop()
+	lo.Info("Session summary processor stopped")
+
+	lo.Info("Stopping usage alert processor...")
+	usageAlertCancel()
+	usageAlertProcessor.Stop()
+	lo.Info("Usage alert processor stopped")
+
+	lo.Info("Stopping failover processor...")
+	failoverCancel()
+	failoverProcessor.Stop()
+	lo.Info("Failover processor stopped")
+
+	lo.Info("Stopping SMS fallback processor...")
+	smsFallbackCancel()
+	smsFallbackProcessor.Stop()
+	lo.Info("SMS fallback processor stopped")
+
+	lo.Info("Stopping number health processor...")
+	numberHealthCancel()
+	numberHealthProcessor.Stop()
+	lo.Info("Number health processor stopped")
+
+	lo.Info("Stopping catalog sync processor...")
+	catalogSyncCancel()
+	catalogSyncProcessor.Stop()
+	lo.Info("Catalog sync processor stopped")
+
+	lo.Info("Stopping statement processor...")
+	statementCancel()
+	statementProcessor.Stop()
+	lo.Info("Statement processor stopped")
+
+	lo.Info("Stopping trial processor...")
+	trialCancel()
+	trialProcessor.Stop()
+	lo.Info("Trial processor stopped")
+
+	lo.Info("Stopping analytics processor...")
+	analyticsCancel()
+	analyticsProcessor.Stop()
+	lo.Info("Analytics processor stopped")
+
+	lo.Info("Stopping archive processor...")
+	archiveCancel()
+	archiveProcessor.Stop()
+	lo.Info("Archive processor stopped")
+
+	secretRefreshCancel()
+	if secretRefreshProcessor != nil {
+		lo.Info("Stopping secret refresh processor...")
+		secretRefreshProcessor.Stop()
+		lo.Info("Secret refresh processor stopped")
+	}
+
 	// Stop workers first
 	if workerCancel != nil {
 		lo.Info("Stopping workers...", "count", len(workers))
@@ -264,6 +720,9 @@ func runServer(args []string) {
 		lo.Error("Server shutdown error", "error", err)
 	}
 	lo.Info("Server stopped")
+
+	// Export the spans still buffered
+	flushTracing(lo, shutdownTracing)
 }
 
 // ============================================================================
@@ -290,6 +749,7 @@ func runWorker(args []string) {
 	// Load configuration
 	cfg, err := config.Load(*configPath)
 	if err != nil {
+		logConfigErrors(lo, err)
 		lo.Fatal("Failed to load config", "error", err)
 	}
 
@@ -302,6 +762,14 @@ func runWorker(args []string) {
 		})
 	}
 
+	setupEncryption(cfg, lo)
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(cfg.Tracing, Version)
+	if err != nil {
+		lo.Fatal("Failed to initialize tracing", "error", err)
+	}
+
 	// Connect to PostgreSQL
 	db, err := database.NewPostgres(&cfg.Database, cfg.App.Debug)
 	if err != nil {
@@ -320,6 +788,29 @@ func runWorker(args []string) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Re-resolve config values that reference secrets, so rotated database and
+	// Redis passwords are picked up
+	if cfg.HasSecretReferences() && cfg.Secrets.RefreshIntervalMins > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.Secrets.RefreshIntervalMins) * time.Minute)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					changed, err := cfg.RefreshSecrets(ctx)
+					if err != nil {
+						lo.Error("Failed to refresh secrets", "error", err)
+					}
+					if len(changed) > 0 {
+						lo.Info("Rotated secrets picked up", "fields", changed)
+					}
+				}
+			}
+		}()
+	}
+
 	// Handle shutdown signals
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -365,6 +856,211 @@ func runWorker(args []string) {
 		}
 	}
 	lo.Info("Workers stopped")
+
+	flushTracing(lo, shutdownTracing)
+}
+
+// flushTracing exports buffered spans, giving up after a few seconds if the
+// collector can't be reached
+func flushTracing(lo logf.Logger, shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		lo.Error("Failed to flush traces", "error", err)
+	}
+}
+
+// ============================================================================
+// MIGRATE COMMAND
+// ============================================================================
+
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		os.Exit(1)
+	}
+	action := args[0]
+
+	migrateFlags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configPath := migrateFlags.String("config", "config.toml", "Path to config file")
+	dryRun := migrateFlags.Bool("dry-run", false, "Print the pending schema changes without applying them")
+	steps := migrateFlags.Int("steps", 1, "Number of migrations to roll back")
+	_ = migrateFlags.Parse(args[1:])
+
+	lo := logf.New(logf.Opts{
+		Level:           logf.InfoLevel,
+		TimestampFormat: "2006-01-02 15:04:05",
+		DefaultFields:   []any{"app", "whatomate-migrate"},
+	})
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		logConfigErrors(lo, err)
+		lo.Fatal("Failed to load config", "error", err)
+	}
+
+	db, err := database.NewPostgres(&cfg.Database, false)
+	if err != nil {
+		lo.Fatal("Failed to connect to database", "error", err)
+	}
+
+	switch action {
+	case "up":
+		if *dryRun {
+			plan, err := database.PlanMigrations(db)
+			if err != nil {
+				lo.Fatal("Dry run failed", "error", err)
+			}
+			if len(plan) == 0 {
+				fmt.Println("No pending migrations")
+				return
+			}
+			for _, m := range plan {
+				fmt.Printf("-- %04d_%s\n", m.Version, m.Name)
+				if len(m.Statements) == 0 {
+					fmt.Println("-- (no schema changes)")
+				}
+				for _, stmt := range m.Statements {
+					fmt.Printf("%s;\n", stmt)
+				}
+				fmt.Println()
+			}
+			return
+		}
+
+		if err := database.RunMigrationWithProgress(db); err != nil {
+			lo.Fatal("Migration failed", "error", err)
+		}
+
+	case "down":
+		rolledBack, err := database.MigrateDown(db, *steps)
+		for _, m := range rolledBack {
+			fmt.Printf("Rolled back %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			lo.Fatal("Rollback failed", "error", err)
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("No migrations to roll back")
+		}
+
+	case "status":
+		states, err := database.MigrationStatus(db)
+		if err != nil {
+			lo.Fatal("Failed to read migration status", "error", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, st := range states {
+			status, appliedAt := "pending", ""
+			if st.AppliedAt != nil {
+				status, appliedAt = "applied", st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", st.Version, st.Name, status, appliedAt)
+		}
+		_ = w.Flush()
+
+	default:
+		fmt.Printf("Unknown migrate action: %s\n\n", action)
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+// ============================================================================
+// ROTATE KEYS COMMAND
+// ============================================================================
+
+func runRotateKeys(args []string) {
+	rotateFlags := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	configPath := rotateFlags.String("config", "config.toml", "Path to config file")
+	dryRun := rotateFlags.Bool("dry-run", false, "Count the values to re-encrypt without rewriting them")
+	_ = rotateFlags.Parse(args)
+
+	lo := logf.New(logf.Opts{
+		Level:           logf.InfoLevel,
+		TimestampFormat: "2006-01-02 15:04:05",
+		DefaultFields:   []any{"app", "whatomate-rotate-keys"},
+	})
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		logConfigErrors(lo, err)
+		lo.Fatal("Failed to load config", "error", err)
+	}
+	setupEncryption(cfg, lo)
+
+	db, err := database.NewPostgres(&cfg.Database, false)
+	if err != nil {
+		lo.Fatal("Failed to connect to database", "error", err)
+	}
+
+	rotated, err := database.RotateEncryptionKeys(db, *dryRun)
+	for _, col := range append(database.EncryptedColumns, database.EncryptedSettingsColumns...) {
+		name := col.Table + "." + col.Column
+		if *dryRun {
+			fmt.Printf("%s: %d to re-encrypt\n", name, rotated[name])
+		} else {
+			fmt.Printf("%s: %d re-encrypted\n", name, rotated[name])
+		}
+	}
+	if err != nil {
+		lo.Fatal("Key rotation failed", "error", err)
+	}
+}
+
+// ============================================================================
+// SEED COMMAND
+// ============================================================================
+
+func runSeed(args []string) {
+	seedFlags := flag.NewFlagSet("seed", flag.ExitOnError)
+	configPath := seedFlags.String("config", "config.toml", "Path to config file")
+	demo := seedFlags.Bool("demo", false, "Create a demo organization with sample data")
+	_ = seedFlags.Parse(args)
+
+	if !*demo {
+		fmt.Println("Nothing to seed: pass -demo to load the demo data")
+		os.Exit(1)
+	}
+
+	lo := logf.New(logf.Opts{
+		Level:           logf.InfoLevel,
+		TimestampFormat: "2006-01-02 15:04:05",
+		DefaultFields:   []any{"app", "whatomate-seed"},
+	})
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		logConfigErrors(lo, err)
+		lo.Fatal("Failed to load config", "error", err)
+	}
+
+	setupEncryption(cfg, lo)
+
+	db, err := database.NewPostgres(&cfg.Database, false)
+	if err != nil {
+		lo.Fatal("Failed to connect to database", "error", err)
+	}
+
+	if err := database.RunMigrationWithProgress(db); err != nil {
+		lo.Fatal("Migration failed", "error", err)
+	}
+
+	if err := database.SeedDemo(db); err != nil {
+		if errors.Is(err, database.ErrDemoExists) {
+			fmt.Println("Demo data already loaded")
+			return
+		}
+		lo.Fatal("Failed to seed demo data", "error", err)
+	}
+
+	fmt.Printf(`Demo data loaded
+
+  Organization:  Demo Organization
+  Channel:       %s (placeholder credentials, sends fail until real ones are set)
+  Login:         %s / %s
+`, database.DemoAccountName, database.DemoUserEmail, database.DemoUserPassword)
 }
 
 // ============================================================================
@@ -375,11 +1071,18 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 	// Health check
 	g.GET("/health", app.HealthCheck)
 	g.GET("/ready", app.ReadyCheck)
+	// Kubernetes probes: liveness, and readiness with per-dependency status
+	g.GET("/healthz", app.Healthz)
+	g.GET("/readyz", app.Readyz)
 
 	// Auth routes (public)
 	g.POST("/api/auth/login", app.Login)
 	g.POST("/api/auth/register", app.Register)
 	g.POST("/api/auth/refresh", app.RefreshToken)
+	g.POST("/api/auth/2fa/setup", app.SetupTwoFactorLogin)
+	g.POST("/api/auth/2fa/verify", app.VerifyTwoFactorLogin)
+	g.GET("/api/auth/invitation", app.GetInvitation)
+	g.POST("/api/auth/invitation/accept", app.AcceptInvitation)
 
 	// SSO routes (public)
 	g.GET("/api/auth/sso/providers", app.GetPublicSSOProviders)
@@ -389,10 +1092,32 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 	// Webhook routes (public - for Meta)
 	g.GET("/api/webhook", app.WebhookVerify)
 	g.POST("/api/webhook", app.WebhookHandler)
+	g.POST("/api/webhook/flows", app.FlowDataEndpoint)
+	g.POST("/api/webhook/telegram/{id}", app.TelegramWebhook)
+	g.POST("/api/webhook/on-premise/{id}", app.OnPremiseWebhook)
+
+	// Store webhooks (public - verified by signature)
+	g.POST("/api/integrations/shopify/{org_id}/webhook", app.ShopifyWebhook)
+
+	// Payment provider webhooks (public - verified by signature)
+	g.POST("/api/integrations/payments/{org_id}/webhook", app.PaymentWebhook)
+
+	// Tracking link redirects (public - opened by customers)
+	g.GET("/api/l/{code}", app.FollowTrackingLink)
+
+	// Web chat widgets (public - scoped by widget token and visitor session token)
+	g.POST("/api/webchat/{token}/sessions", app.CreateWebChatSession)
+	g.GET("/api/webchat/{token}/messages", app.ListWebChatMessages)
+	g.POST("/api/webchat/{token}/messages", app.SendWebChatMessage)
+	g.GET("/api/webchat/{token}/ws", app.WebChatSocket)
 
 	// WebSocket route (auth handled in handler via query param)
 	g.GET("/ws", app.WebSocketHandler)
 
+	// The API is only accepted from security.allowed_ips, if set
+	allowedIPs, _ := config.ParseIPRanges(app.Config.Security.AllowedIPs)
+	g.Before(middleware.IPAllowlist(allowedIPs, ipAllowlistExempt))
+
 	// For protected routes, we'll use a path-based middleware approach
 	// Apply auth middleware globally but check path in the middleware
 	g.Before(func(r *fastglue.Request) *fastglue.Request {
@@ -402,44 +1127,75 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 		}
 		path := string(r.RequestCtx.Path())
 		// Skip auth for public routes
-		if path == "/health" || path == "/ready" ||
+		if path == "/health" || path == "/ready" || path == "/healthz" || path == "/readyz" ||
 			path == "/api/auth/login" || path == "/api/auth/register" || path == "/api/auth/refresh" ||
-			path == "/api/webhook" || path == "/ws" {
+			path == "/api/auth/2fa/setup" || path == "/api/auth/2fa/verify" ||
+			path == "/api/auth/invitation" || path == "/api/auth/invitation/accept" ||
+			path == "/api/webhook" || path == "/api/webhook/flows" || path == "/ws" {
 			return r
 		}
 		// Skip auth for SSO routes (they handle their own auth via state tokens)
 		if len(path) >= 13 && path[:13] == "/api/auth/sso" {
 			return r
 		}
+		// Skip auth for Telegram bot webhooks (verified by secret token)
+		if strings.HasPrefix(path, "/api/webhook/telegram/") {
+			return r
+		}
+		// Skip auth for On-Premise API webhooks (verified by the account's token)
+		if strings.HasPrefix(path, "/api/webhook/on-premise/") {
+			return r
+		}
+		// Skip auth for web chat widgets (scoped by widget and session tokens)
+		if strings.HasPrefix(path, "/api/webchat/") {
+			return r
+		}
+		// Skip auth for store webhooks (verified by signature)
+		if len(path) >= 26 && path[:26] == "/api/integrations/shopify/" {
+			return r
+		}
+		// Skip auth for payment provider webhooks (verified by signature)
+		if strings.HasPrefix(path, "/api/integrations/payments/") {
+			return r
+		}
+		// Skip auth for tracking link redirects
+		if len(path) >= 7 && path[:7] == "/api/l/" {
+			return r
+		}
 		// Skip auth for custom action redirects (uses one-time token)
 		if len(path) >= 28 && path[:28] == "/api/custom-actions/redirect" {
 			return r
 		}
 		// Apply auth for all other /api routes (supports both JWT and API key)
 		if len(path) > 4 && path[:4] == "/api" {
-			return middleware.AuthWithDB(app.Config.JWT.Secret, app.DB)(r)
+			return middleware.AuthWithDB(app.CurrentConfig().JWT.Secret, app.DB)(r)
 		}
 		return r
 	})
 
-	// Role-based access control middleware
-	g.Before(func(r *fastglue.Request) *fastglue.Request {
-		method := string(r.RequestCtx.Method())
+	// Organizations can restrict their members and API keys to the IPs they allow
+	g.Before(middleware.OrganizationIPAllowlist(app.OrgAllowedIPRanges))
 
-		// Skip OPTIONS preflight requests
-		if method == "OPTIONS" {
-			return r
-		}
+	// API keys stop working when the plan no longer includes them, and are limited
+	// to their scopes and rate limit
+	g.Before(middleware.APIKeysAllowed(app.APIKeysEnabled))
+	g.Before(middleware.APIKeyAccess(app.Redis))
 
-		// Route-level permission checks are now handled at the handler level
-		// using the granular permission system (HasPermission checks)
-		return r
-	})
+	// Organizations whose trial has ended are read-only until a plan is selected
+	g.Before(middleware.TrialExpired(app.IsTrialExpired))
+
+	// Role-based access control for routes in the permission matrix. Other routes
+	// check permissions in their handlers.
+	g.Before(middleware.RBAC(app.HasPermission))
 
 	// Current User (all authenticated users)
 	g.GET("/api/me", app.GetCurrentUser)
 	g.PUT("/api/me/settings", app.UpdateCurrentUserSettings)
 	g.PUT("/api/me/password", app.ChangePassword)
+	g.POST("/api/me/2fa/setup", app.SetupTwoFactor)
+	g.POST("/api/me/2fa/enable", app.EnableTwoFactor)
+	g.POST("/api/me/2fa/disable", app.DisableTwoFactor)
+	g.POST("/api/me/2fa/backup-codes", app.RegenerateBackupCodes)
 	g.PUT("/api/me/availability", app.UpdateAvailability)
 
 	// User Management (admin only - enforced by middleware)
@@ -448,6 +1204,13 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 	g.GET("/api/users/{id}", app.GetUser)
 	g.PUT("/api/users/{id}", app.UpdateUser)
 	g.DELETE("/api/users/{id}", app.DeleteUser)
+	g.PUT("/api/users/{id}/role", app.AssignUserRole)
+
+	// Invitations
+	g.GET("/api/invitations", app.ListInvitations)
+	g.POST("/api/invitations", app.CreateInvitation)
+	g.POST("/api/invitations/{id}/resend", app.ResendInvitation)
+	g.DELETE("/api/invitations/{id}", app.RevokeInvitation)
 
 	// Roles & Permissions (admin only - enforced by middleware)
 	g.GET("/api/roles", app.ListRoles)
@@ -461,33 +1224,129 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 	g.GET("/api/api-keys", app.ListAPIKeys)
 	g.POST("/api/api-keys", app.CreateAPIKey)
 	g.DELETE("/api/api-keys/{id}", app.DeleteAPIKey)
+	g.POST("/api/api-keys/{id}/rotate", app.RotateAPIKey)
+	g.POST("/api/api-keys/{id}/revoke", app.RevokeAPIKey)
 
 	// Accounts
 	g.GET("/api/accounts", app.ListAccounts)
 	g.POST("/api/accounts", app.CreateAccount)
+	g.POST("/api/accounts/telegram", app.CreateTelegramAccount)
+	g.POST("/api/accounts/instagram", app.CreateInstagramAccount)
+	g.POST("/api/accounts/messenger", app.CreateMessengerAccount)
+	g.POST("/api/accounts/webchat", app.CreateWebChatAccount)
+	g.GET("/api/accounts/health", app.GetNumberHealth)
+	g.GET("/api/accounts/embedded-signup", app.GetEmbeddedSignupConfig)
+	g.POST("/api/accounts/embedded-signup", app.CompleteEmbeddedSignup)
 	g.GET("/api/accounts/{id}", app.GetAccount)
 	g.PUT("/api/accounts/{id}", app.UpdateAccount)
 	g.DELETE("/api/accounts/{id}", app.DeleteAccount)
 	g.POST("/api/accounts/{id}/test", app.TestAccountConnection)
+	g.GET("/api/accounts/{id}/profile", app.GetBusinessProfile)
+	g.PUT("/api/accounts/{id}/profile", app.UpdateBusinessProfile)
+	g.POST("/api/accounts/{id}/profile/photo", app.UploadBusinessProfilePhoto)
+	g.POST("/api/accounts/{id}/flow-encryption", app.RegisterFlowEncryptionKey)
+	g.GET("/api/accounts/{id}/persistent-menu", app.GetPersistentMenu)
+	g.PUT("/api/accounts/{id}/persistent-menu", app.UpdatePersistentMenu)
 
 	// Contacts
 	g.GET("/api/contacts", app.ListContacts)
 	g.POST("/api/contacts", app.CreateContact)
+	g.GET("/api/contacts/tags", app.ListContactTags)
+	g.POST("/api/contacts/tags", app.BulkTagContacts)
+	g.POST("/api/contacts/import", app.ImportContacts)
+	g.GET("/api/contacts/imports", app.ListContactImports)
+	g.GET("/api/contacts/imports/{id}", app.GetContactImport)
+	g.GET("/api/contacts/export", app.ExportContacts)
+	g.GET("/api/contacts/blocked", app.ListBlockedContacts)
 	g.GET("/api/contacts/{id}", app.GetContact)
 	g.PUT("/api/contacts/{id}", app.UpdateContact)
 	g.DELETE("/api/contacts/{id}", app.DeleteContact)
 	g.PUT("/api/contacts/{id}/assign", app.AssignContact)
+	g.PUT("/api/contacts/{id}/timezone", app.SetContactTimezone)
+	g.PUT("/api/contacts/{id}/ai", app.SetContactAI)
+	g.POST("/api/contacts/{id}/block", app.BlockContact)
+	g.DELETE("/api/contacts/{id}/block", app.UnblockContact)
 	g.GET("/api/contacts/{id}/session-data", app.GetContactSessionData)
+	g.GET("/api/contacts/{id}/consent", app.GetContactConsentHistory)
+	g.GET("/api/contacts/{id}/notes", app.ListContactNotes)
+	g.POST("/api/contacts/{id}/notes", app.CreateContactNote)
+	g.PUT("/api/contacts/{id}/notes/{note_id}", app.UpdateContactNote)
+	g.DELETE("/api/contacts/{id}/notes/{note_id}", app.DeleteContactNote)
+	g.GET("/api/contacts/{id}/notes/{note_id}/revisions", app.ListContactNoteRevisions)
 
 	// Messages
 	g.GET("/api/contacts/{id}/messages", app.GetMessages)
 	g.POST("/api/contacts/{id}/messages", app.SendMessage)
 	g.POST("/api/contacts/{id}/messages/{message_id}/reaction", app.SendReaction)
+	g.POST("/api/contacts/{id}/messages/{message_id}/translate", app.TranslateMessage)
+	g.GET("/api/contacts/{id}/messages/pdf", app.ExportConversationPDF)
+	g.GET("/api/contacts/{id}/messages/export", app.ExportConversation)
+	g.GET("/api/contacts/{id}/messages/archived", app.GetArchivedMessages)
+	g.GET("/api/contacts/{id}/archives", app.ListContactArchives)
+	g.GET("/api/message-archives/{id}/media/{message_id}", app.ServeArchivedMedia)
+	g.POST("/api/contacts/{id}/typing", app.SendTypingIndicator)
 	g.POST("/api/messages", app.SendMessage) // Legacy route
 	g.POST("/api/messages/template", app.SendTemplateMessage)
 	g.POST("/api/messages/media", app.SendMediaMessage)
+	g.GET("/api/messages/export", app.ExportConversations)
+	g.GET("/api/messages/search", app.SearchMessages)
 	g.PUT("/api/messages/{id}/read", app.MarkMessageRead)
 
+	// Conversations
+	g.POST("/api/conversations/{id}/messages", app.SendConversationMessage)
+	g.GET("/api/conversations/{id}/scheduled-messages", app.ListScheduledMessages)
+	g.POST("/api/scheduled-messages", app.CreateScheduledMessage)
+	g.PUT("/api/scheduled-messages/{id}", app.RescheduleScheduledMessage)
+	g.DELETE("/api/scheduled-messages/{id}", app.CancelScheduledMessage)
+	g.POST("/api/conversations/{id}/follow-ups", app.CreateFollowUp)
+	g.GET("/api/conversations/{id}/follow-ups", app.ListFollowUps)
+	g.DELETE("/api/follow-ups/{id}", app.CancelFollowUp)
+	g.GET("/api/conversations/{id}/pending", app.ListPendingMessages)
+	g.PUT("/api/conversations/{id}/pending/{kind}/{item_id}", app.UpdatePendingMessage)
+	g.DELETE("/api/conversations/{id}/pending/{kind}/{item_id}", app.CancelPendingMessage)
+
+	// Groups
+	g.GET("/api/groups", app.ListGroups)
+	g.POST("/api/groups", app.CreateGroup)
+	g.GET("/api/groups/{id}", app.GetGroup)
+	g.PUT("/api/groups/{id}", app.UpdateGroup)
+	g.GET("/api/groups/{id}/messages", app.ListGroupMessages)
+	g.POST("/api/groups/{id}/messages", app.SendGroupMessage)
+
+	// Tracking Links
+	g.GET("/api/tracking-links", app.ListTrackingLinks)
+	g.POST("/api/tracking-links", app.CreateTrackingLink)
+	g.PUT("/api/tracking-links/{id}", app.UpdateTrackingLink)
+	g.DELETE("/api/tracking-links/{id}", app.DeleteTrackingLink)
+	g.GET("/api/tracking-links/{id}/contacts", app.ListTrackingLinkContacts)
+	g.GET("/api/tracking-links/{id}/qr", app.GetTrackingLinkQR)
+
+	// Sequences
+	g.GET("/api/sequences", app.ListSequences)
+	g.POST("/api/sequences", app.CreateSequence)
+	g.GET("/api/sequences/{id}", app.GetSequence)
+	g.PUT("/api/sequences/{id}", app.UpdateSequence)
+	g.DELETE("/api/sequences/{id}", app.DeleteSequence)
+	g.GET("/api/sequences/{id}/enrollments", app.ListSequenceEnrollments)
+	g.POST("/api/sequences/{id}/enrollments", app.EnrollSequenceContacts)
+	g.DELETE("/api/sequence-enrollments/{id}", app.CancelSequenceEnrollment)
+
+	// Segments
+	g.GET("/api/segments", app.ListSegments)
+	g.POST("/api/segments", app.CreateSegment)
+	g.POST("/api/segments/preview", app.PreviewSegment)
+	g.GET("/api/segments/{id}", app.GetSegment)
+	g.PUT("/api/segments/{id}", app.UpdateSegment)
+	g.DELETE("/api/segments/{id}", app.DeleteSegment)
+	g.GET("/api/segments/{id}/contacts", app.ListSegmentContacts)
+
+	// Appointments
+	g.GET("/api/appointments", app.ListAppointments)
+	g.POST("/api/appointments", app.CreateAppointment)
+	g.GET("/api/appointments/{id}", app.GetAppointment)
+	g.PUT("/api/appointments/{id}", app.UpdateAppointment)
+	g.POST("/api/appointments/{id}/cancel", app.CancelAppointment)
+
 	// Media (serves media files for messages, auth-protected)
 	g.GET("/api/media/{message_id}", app.ServeMedia)
 
@@ -520,19 +1379,27 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 	g.PUT("/api/campaigns/{id}", app.UpdateCampaign)
 	g.DELETE("/api/campaigns/{id}", app.DeleteCampaign)
 	g.POST("/api/campaigns/{id}/start", app.StartCampaign)
+	g.POST("/api/campaigns/{id}/dry-run", app.DryRunCampaign)
 	g.POST("/api/campaigns/{id}/pause", app.PauseCampaign)
 	g.POST("/api/campaigns/{id}/cancel", app.CancelCampaign)
 	g.POST("/api/campaigns/{id}/retry-failed", app.RetryFailed)
 	g.GET("/api/campaigns/{id}/progress", app.GetCampaign)
+	g.GET("/api/campaigns/{id}/variants", app.GetCampaignVariants)
 	g.POST("/api/campaigns/{id}/recipients/import", app.ImportRecipients)
 	g.GET("/api/campaigns/{id}/recipients", app.GetCampaignRecipients)
 	g.DELETE("/api/campaigns/{id}/recipients/{recipientId}", app.DeleteCampaignRecipient)
 	g.POST("/api/campaigns/{id}/media", app.UploadCampaignMedia)
 	g.GET("/api/campaigns/{id}/media", app.ServeCampaignMedia)
 
+	// Bulk sends
+	g.POST("/api/bulk-sends", app.CreateBulkSend)
+	g.GET("/api/bulk-sends/{id}", app.GetBulkSend)
+	g.POST("/api/bulk-sends/{id}/cancel", app.CancelCampaign)
+
 	// Chatbot Settings
 	g.GET("/api/chatbot/settings", app.GetChatbotSettings)
 	g.PUT("/api/chatbot/settings", app.UpdateChatbotSettings)
+	g.POST("/api/chatbot/simulate", app.SimulateChatbot)
 
 	// Keyword Rules
 	g.GET("/api/chatbot/keywords", app.ListKeywordRules)
@@ -554,6 +1421,16 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 	g.GET("/api/chatbot/ai-contexts/{id}", app.GetAIContext)
 	g.PUT("/api/chatbot/ai-contexts/{id}", app.UpdateAIContext)
 	g.DELETE("/api/chatbot/ai-contexts/{id}", app.DeleteAIContext)
+	g.GET("/api/chatbot/ai-usage", app.GetAIUsage)
+	g.GET("/api/chatbot/ai-moderation-logs", app.ListAIModerationLogs)
+	g.GET("/api/chatbot/ai-experiments/results", app.GetAIExperimentResults)
+	g.GET("/api/chatbot/knowledge", app.ListKnowledgeDocuments)
+	g.POST("/api/chatbot/knowledge", app.CreateKnowledgeDocument)
+	g.POST("/api/chatbot/knowledge/reindex", app.ReindexKnowledgeBase)
+	g.POST("/api/chatbot/knowledge/search", app.SearchKnowledgeBase)
+	g.GET("/api/chatbot/knowledge/{id}", app.GetKnowledgeDocument)
+	g.PUT("/api/chatbot/knowledge/{id}", app.UpdateKnowledgeDocument)
+	g.DELETE("/api/chatbot/knowledge/{id}", app.DeleteKnowledgeDocument)
 
 	// Agent Transfers
 	g.GET("/api/chatbot/transfers", app.ListAgentTransfers)
@@ -561,6 +1438,7 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 	g.POST("/api/chatbot/transfers/pick", app.PickNextTransfer)
 	g.PUT("/api/chatbot/transfers/{id}/resume", app.ResumeFromTransfer)
 	g.PUT("/api/chatbot/transfers/{id}/assign", app.AssignAgentTransfer)
+	g.PUT("/api/chatbot/transfers/{id}/priority", app.SetTransferPriority)
 
 	// Teams (admin/manager - access control in handler)
 	g.GET("/api/teams", app.ListTeams)
@@ -570,36 +1448,142 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 	g.DELETE("/api/teams/{id}", app.DeleteTeam)
 	g.GET("/api/teams/{id}/members", app.ListTeamMembers)
 	g.POST("/api/teams/{id}/members", app.AddTeamMember)
+	g.PUT("/api/teams/{id}/members/{member_id}", app.UpdateTeamMember)
 	g.DELETE("/api/teams/{id}/members/{user_id}", app.RemoveTeamMember)
 
 	// Canned Responses
 	g.GET("/api/canned-responses", app.ListCannedResponses)
 	g.POST("/api/canned-responses", app.CreateCannedResponse)
+	g.GET("/api/canned-responses/stats", app.GetCannedResponseStats)
 	g.GET("/api/canned-responses/{id}", app.GetCannedResponse)
 	g.PUT("/api/canned-responses/{id}", app.UpdateCannedResponse)
 	g.DELETE("/api/canned-responses/{id}", app.DeleteCannedResponse)
 	g.POST("/api/canned-responses/{id}/use", app.IncrementCannedResponseUsage)
+	g.POST("/api/canned-responses/{id}/favorite", app.FavoriteCannedResponse)
+	g.DELETE("/api/canned-responses/{id}/favorite", app.UnfavoriteCannedResponse)
+
+	// Shortcodes
+	g.GET("/api/shortcodes", app.ListShortcodes)
+	g.POST("/api/shortcodes", app.CreateShortcode)
+	g.GET("/api/shortcodes/{id}", app.GetShortcode)
+	g.PUT("/api/shortcodes/{id}", app.UpdateShortcode)
+	g.DELETE("/api/shortcodes/{id}", app.DeleteShortcode)
+
+	// Holidays
+	g.GET("/api/holidays", app.ListHolidays)
+	g.POST("/api/holidays", app.CreateHoliday)
+	g.POST("/api/holidays/import", app.ImportHolidaysICal)
+	g.PUT("/api/holidays/{id}", app.UpdateHoliday)
+	g.DELETE("/api/holidays/{id}", app.DeleteHoliday)
+
+	// SLA Policies
+	g.GET("/api/sla-policies", app.ListSLAPolicies)
+	g.POST("/api/sla-policies", app.CreateSLAPolicy)
+	g.PUT("/api/sla-policies/{id}", app.UpdateSLAPolicy)
+	g.DELETE("/api/sla-policies/{id}", app.DeleteSLAPolicy)
 
 	// Sessions (admin/debug)
 	g.GET("/api/chatbot/sessions", app.ListChatbotSessions)
 	g.GET("/api/chatbot/sessions/{id}", app.GetChatbotSession)
+	g.POST("/api/chatbot/sessions/{id}/claim", app.ClaimChatbotSession)
+	g.GET("/api/chatbot/sessions/{id}/notes", app.ListSessionNotes)
+	g.POST("/api/chatbot/sessions/{id}/notes", app.CreateSessionNote)
+	g.DELETE("/api/chatbot/sessions/{id}/notes/{note_id}", app.DeleteSessionNote)
+	g.GET("/api/mentions", app.ListMentions)
+	g.PUT("/api/mentions/{id}/read", app.MarkMentionRead)
 
 	// Analytics
 	g.GET("/api/analytics/dashboard", app.GetDashboardStats)
+	g.GET("/api/analytics/overview", app.GetAnalyticsOverview)
 	g.GET("/api/analytics/messages", app.GetMessageAnalytics)
 	g.GET("/api/analytics/chatbot", app.GetChatbotAnalytics)
+	g.GET("/api/analytics/ads", app.GetAdAnalytics)
+	g.GET("/api/analytics/conversations", app.GetConversationCosts)
+	g.GET("/api/analytics/abandoned-carts", app.GetAbandonedCartReport)
+	g.GET("/api/analytics/satisfaction", app.GetSatisfactionReport)
 	g.GET("/api/analytics/agents", app.GetAgentAnalytics)
 	g.GET("/api/analytics/agents/{id}", app.GetAgentDetails)
 	g.GET("/api/analytics/agents/comparison", app.GetAgentComparison)
+	g.GET("/api/analytics/agents/export", app.ExportAgentAnalytics)
 
 	// Organization Settings
 	g.GET("/api/org/settings", app.GetOrganizationSettings)
 	g.PUT("/api/org/settings", app.UpdateOrganizationSettings)
+	g.GET("/api/org/settings/export", app.ExportOrgSettingsBundle)
+	g.POST("/api/org/settings/import", app.ImportOrgSettingsBundle)
+	g.GET("/api/org/settings/abandoned-carts", app.GetAbandonedCartSettings)
+	g.PUT("/api/org/settings/abandoned-carts", app.UpdateAbandonedCartSettings)
+	g.GET("/api/org/settings/notifications", app.GetNotificationSettings)
+	g.PUT("/api/org/settings/notifications", app.UpdateNotificationSettings)
+	g.POST("/api/org/settings/notifications/test", app.TestNotificationSettings)
+	g.GET("/api/org/settings/sms-fallback", app.GetSMSFallbackSettings)
+	g.PUT("/api/org/settings/sms-fallback", app.UpdateSMSFallbackSettings)
+	g.GET("/api/org/settings/payments", app.GetPaymentSettings)
+	g.PUT("/api/org/settings/payments", app.UpdatePaymentSettings)
+	g.GET("/api/org/settings/google-calendar", app.GetGoogleCalendarSettings)
+	g.PUT("/api/org/settings/google-calendar", app.UpdateGoogleCalendarSettings)
+	g.GET("/api/org/settings/shopify", app.GetShopifySettings)
+	g.PUT("/api/org/settings/shopify", app.UpdateShopifySettings)
+	g.GET("/api/org/settings/crm", app.GetCRMSettings)
+	g.PUT("/api/org/settings/crm", app.UpdateCRMSettings)
+	g.GET("/api/org/settings/helpdesk", app.GetHelpdeskSettings)
+	g.PUT("/api/org/settings/helpdesk", app.UpdateHelpdeskSettings)
+	g.GET("/api/org/settings/translation", app.GetTranslationSettings)
+	g.PUT("/api/org/settings/translation", app.UpdateTranslationSettings)
+	g.GET("/api/org/settings/archive", app.GetArchiveSettings)
+	g.PUT("/api/org/settings/archive", app.UpdateArchiveSettings)
 
 	// Organizations (super admin only)
 	g.GET("/api/organizations", app.ListOrganizations)
 	g.GET("/api/organizations/current", app.GetCurrentOrganization)
 
+	g.PUT("/api/organizations/{id}/plan", app.SetOrganizationPlan)
+	g.PUT("/api/organizations/{id}/trial", app.SetOrganizationTrial)
+	g.PUT("/api/organizations/{id}/quotas", app.SetOrganizationQuotas)
+	g.POST("/api/organizations/{id}/wallet/credits", app.AddWalletCredits)
+
+	// Cross-organization search (super admin only, audit logged)
+	g.GET("/api/admin/search", app.AdminSearch)
+	g.GET("/api/admin/audit-logs", app.ListAdminAuditLogs)
+
+	// Configuration reload of all servers (super admin only)
+	g.POST("/api/admin/config/reload", app.ReloadAllConfig)
+
+	// Audit log of settings and administrative changes
+	g.GET("/api/audit-logs", app.ListAuditLogs)
+
+	// Dead letters: sends and jobs that failed after their retries
+	g.GET("/api/dead-letters", app.ListDeadLetters)
+	g.POST("/api/dead-letters/retry", app.RetryDeadLetters)
+	g.POST("/api/dead-letters/{id}/retry", app.RetryDeadLetter)
+	g.DELETE("/api/dead-letters/{id}", app.DiscardDeadLetter)
+
+	// Data subject requests: export or erase everything stored about a phone number
+	g.POST("/api/data-subjects/export", app.ExportDataSubject)
+	g.POST("/api/data-subjects/erase", app.EraseDataSubject)
+
+	// Plans (write: super admin only)
+	g.GET("/api/plans", app.ListPlans)
+	g.POST("/api/plans", app.CreatePlan)
+	g.PUT("/api/plans/{id}", app.UpdatePlan)
+	g.DELETE("/api/plans/{id}", app.DeletePlan)
+
+	// Usage
+	g.GET("/api/usage", app.GetUsage)
+	g.GET("/api/usage/report", app.GetUsageReport)
+	g.GET("/api/usage/report/csv", app.ExportUsageReport)
+	g.GET("/api/admin/usage/export", app.ExportAllUsage)
+
+	// Statements
+	g.GET("/api/statements", app.ListStatements)
+	g.GET("/api/statements/{period}", app.GetStatement)
+	g.GET("/api/statements/{period}/pdf", app.GetStatementPDF)
+
+	// Prepaid wallet
+	g.GET("/api/wallet", app.GetWallet)
+	g.PUT("/api/wallet", app.UpdateWallet)
+	g.GET("/api/wallet/transactions", app.ListWalletTransactions)
+
 	// SSO Settings (admin only - enforced by middleware)
 	g.GET("/api/settings/sso", app.GetSSOSettings)
 	g.PUT("/api/settings/sso/{provider}", app.UpdateSSOProvider)
@@ -612,6 +1596,22 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 	g.PUT("/api/webhooks/{id}", app.UpdateWebhook)
 	g.DELETE("/api/webhooks/{id}", app.DeleteWebhook)
 	g.POST("/api/webhooks/{id}/test", app.TestWebhook)
+	g.GET("/api/webhooks/{id}/deliveries", app.ListWebhookDeliveries)
+
+	// Message hooks
+	g.GET("/api/message-hooks", app.ListMessageHooks)
+	g.POST("/api/message-hooks", app.CreateMessageHook)
+	g.GET("/api/message-hooks/{id}", app.GetMessageHook)
+	g.PUT("/api/message-hooks/{id}", app.UpdateMessageHook)
+	g.DELETE("/api/message-hooks/{id}", app.DeleteMessageHook)
+
+	// Automations
+	g.GET("/api/automations", app.ListAutomations)
+	g.POST("/api/automations", app.CreateAutomation)
+	g.GET("/api/automations/{id}", app.GetAutomation)
+	g.PUT("/api/automations/{id}", app.UpdateAutomation)
+	g.DELETE("/api/automations/{id}", app.DeleteAutomation)
+	g.GET("/api/automations/{id}/logs", app.ListAutomationLogs)
 
 	// Custom Actions
 	g.GET("/api/custom-actions", app.ListCustomActions)
@@ -630,12 +1630,18 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 	g.POST("/api/catalogs/sync", app.SyncCatalogs)
 
 	// Catalog Products
+	g.POST("/api/catalogs/{id}/sync", app.SyncCatalogProducts)
 	g.GET("/api/catalogs/{id}/products", app.ListCatalogProducts)
 	g.POST("/api/catalogs/{id}/products", app.CreateCatalogProduct)
 	g.GET("/api/products/{id}", app.GetCatalogProduct)
 	g.PUT("/api/products/{id}", app.UpdateCatalogProduct)
 	g.DELETE("/api/products/{id}", app.DeleteCatalogProduct)
 
+	// Orders
+	g.GET("/api/orders", app.ListOrders)
+	g.GET("/api/orders/{id}", app.GetOrder)
+	g.PUT("/api/orders/{id}", app.UpdateOrder)
+
 	// Serve embedded frontend (SPA)
 	if frontend.IsEmbedded() {
 		lo.Info("Serving embedded frontend", "base_path", basePath)
@@ -654,6 +1660,23 @@ func setupRoutes(g *fastglue.Fastglue, app *handlers.App, lo logf.Logger, basePa
 	}
 }
 
+// ipAllowlistExempt reports whether a path isn't restricted by security.allowed_ips:
+// anything but the API, and the API routes Meta, stores, customers and website
+// visitors call
+func ipAllowlistExempt(path string) bool {
+	if path != "/ws" && !strings.HasPrefix(path, "/api/") {
+		return true
+	}
+	return path == "/api/webhook" || path == "/api/webhook/flows" ||
+		strings.HasPrefix(path, "/api/webhook/telegram/") ||
+		strings.HasPrefix(path, "/api/webhook/on-premise/") ||
+		strings.HasPrefix(path, "/api/webchat/") ||
+		strings.HasPrefix(path, "/api/integrations/shopify/") ||
+		strings.HasPrefix(path, "/api/integrations/payments/") ||
+		strings.HasPrefix(path, "/api/l/") ||
+		strings.HasPrefix(path, "/api/custom-actions/redirect")
+}
+
 // corsWrapper wraps a handler with CORS support at the fasthttp level
 // This ensures CORS headers are set even for auto-handled OPTIONS requests
 func corsWrapper(next fasthttp.RequestHandler) fasthttp.RequestHandler {
@@ -665,7 +1688,8 @@ func corsWrapper(next fasthttp.RequestHandler) fasthttp.RequestHandler {
 
 		ctx.Response.Header.Set("Access-Control-Allow-Origin", origin)
 		ctx.Response.Header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-		ctx.Response.Header.Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Requested-With, X-Organization-ID")
+		ctx.Response.Header.Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Requested-With, X-Organization-ID, X-Request-ID")
+		ctx.Response.Header.Set("Access-Control-Expose-Headers", "X-Request-ID")
 		ctx.Response.Header.Set("Access-Control-Allow-Credentials", "true")
 		ctx.Response.Header.Set("Access-Control-Max-Age", "86400")
 
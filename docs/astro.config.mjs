@@ -43,15 +43,44 @@ export default defineConfig({
             { label: 'Roles', slug: 'api-reference/roles' },
             { label: 'Accounts', slug: 'api-reference/accounts' },
             { label: 'Contacts', slug: 'api-reference/contacts' },
+            { label: 'Segments', slug: 'api-reference/segments' },
             { label: 'Messages', slug: 'api-reference/messages' },
+            { label: 'Groups', slug: 'api-reference/groups' },
             { label: 'Templates', slug: 'api-reference/templates' },
             { label: 'Flows', slug: 'api-reference/flows' },
+            { label: 'Catalogs', slug: 'api-reference/catalogs' },
             { label: 'Campaigns', slug: 'api-reference/campaigns' },
+            { label: 'Tracking Links', slug: 'api-reference/tracking-links' },
+            { label: 'Sequences', slug: 'api-reference/sequences' },
             { label: 'Chatbot', slug: 'api-reference/chatbot' },
             { label: 'Canned Responses', slug: 'api-reference/canned-responses' },
+            { label: 'Shortcodes', slug: 'api-reference/shortcodes' },
+            { label: 'Holidays', slug: 'api-reference/holidays' },
+            { label: 'SLA Policies', slug: 'api-reference/sla-policies' },
+            { label: 'Appointments', slug: 'api-reference/appointments' },
             { label: 'Custom Actions', slug: 'api-reference/custom-actions' },
             { label: 'Webhooks', slug: 'api-reference/webhooks' },
+            { label: 'Message Hooks', slug: 'api-reference/message-hooks' },
+            { label: 'Notifications', slug: 'api-reference/notifications' },
+            { label: 'SMS Fallback', slug: 'api-reference/sms-fallback' },
+            { label: 'Payment Links', slug: 'api-reference/payment-links' },
+            { label: 'Automations', slug: 'api-reference/automations' },
+            { label: 'Abandoned Carts', slug: 'api-reference/abandoned-carts' },
+            { label: 'Shopify', slug: 'api-reference/shopify' },
+            { label: 'CRM Sync', slug: 'api-reference/crm' },
+            { label: 'Helpdesk Tickets', slug: 'api-reference/helpdesk' },
+            { label: 'Translation', slug: 'api-reference/translation' },
             { label: 'Analytics', slug: 'api-reference/analytics' },
+            { label: 'Plans', slug: 'api-reference/plans' },
+            { label: 'Usage', slug: 'api-reference/usage' },
+            { label: 'Statements', slug: 'api-reference/statements' },
+            { label: 'Wallet', slug: 'api-reference/wallet' },
+            { label: 'Settings Export', slug: 'api-reference/org-settings' },
+            { label: 'Audit Log', slug: 'api-reference/audit-logs' },
+            { label: 'Dead Letters', slug: 'api-reference/dead-letters' },
+            { label: 'Data Subjects', slug: 'api-reference/data-subjects' },
+            { label: 'Message Archive', slug: 'api-reference/message-archive' },
+            { label: 'Admin Search', slug: 'api-reference/admin-search' },
           ],
         },
       ],
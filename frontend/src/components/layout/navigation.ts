@@ -8,6 +8,7 @@ import {
   Users,
   Workflow,
   Sparkles,
+  BookOpen,
   Key,
   UserX,
   MessageSquareText,
@@ -15,7 +16,13 @@ import {
   BarChart3,
   ShieldCheck,
   Zap,
-  Shield
+  Shield,
+  Slash,
+  CalendarOff,
+  UsersRound,
+  QrCode,
+  ListOrdered,
+  Filter
 } from 'lucide-vue-next'
 import type { Component } from 'vue'
 
@@ -41,6 +48,12 @@ export const navigationItems: NavItem[] = [
     icon: MessageSquare,
     permission: 'chat'
   },
+  {
+    name: 'Groups',
+    path: '/groups',
+    icon: UsersRound,
+    permission: 'chat'
+  },
   {
     name: 'Chatbot',
     path: '/chatbot',
@@ -51,7 +64,8 @@ export const navigationItems: NavItem[] = [
       { name: 'Overview', path: '/chatbot', icon: Bot, permission: 'settings.chatbot' },
       { name: 'Keywords', path: '/chatbot/keywords', icon: Key, permission: 'chatbot.keywords' },
       { name: 'Flows', path: '/chatbot/flows', icon: Workflow, permission: 'flows.chatbot' },
-      { name: 'AI Contexts', path: '/chatbot/ai', icon: Sparkles, permission: 'chatbot.ai' }
+      { name: 'AI Contexts', path: '/chatbot/ai', icon: Sparkles, permission: 'chatbot.ai' },
+      { name: 'Knowledge Base', path: '/chatbot/knowledge', icon: BookOpen, permission: 'chatbot.ai' }
     ]
   },
   {
@@ -84,6 +98,24 @@ export const navigationItems: NavItem[] = [
     icon: Megaphone,
     permission: 'campaigns'
   },
+  {
+    name: 'Tracking Links',
+    path: '/tracking-links',
+    icon: QrCode,
+    permission: 'campaigns'
+  },
+  {
+    name: 'Sequences',
+    path: '/sequences',
+    icon: ListOrdered,
+    permission: 'campaigns'
+  },
+  {
+    name: 'Segments',
+    path: '/segments',
+    icon: Filter,
+    permission: 'contacts'
+  },
   {
     name: 'Settings',
     path: '/settings',
@@ -93,13 +125,16 @@ export const navigationItems: NavItem[] = [
     children: [
       { name: 'General', path: '/settings', icon: Settings, permission: 'settings.general' },
       { name: 'Chatbot', path: '/settings/chatbot', icon: Bot, permission: 'settings.chatbot' },
+      { name: 'Holidays', path: '/settings/holidays', icon: CalendarOff, permission: 'settings.chatbot' },
       { name: 'Accounts', path: '/settings/accounts', icon: Users, permission: 'accounts' },
       { name: 'Canned Responses', path: '/settings/canned-responses', icon: MessageSquareText, permission: 'canned_responses' },
+      { name: 'Shortcodes', path: '/settings/shortcodes', icon: Slash, permission: 'canned_responses' },
       { name: 'Teams', path: '/settings/teams', icon: Users, permission: 'teams' },
       { name: 'Users', path: '/settings/users', icon: Users, permission: 'users' },
       { name: 'Roles', path: '/settings/roles', icon: Shield, permission: 'roles' },
       { name: 'API Keys', path: '/settings/api-keys', icon: Key, permission: 'api_keys' },
       { name: 'Webhooks', path: '/settings/webhooks', icon: Webhook, permission: 'webhooks' },
+      { name: 'Automations', path: '/settings/automations', icon: Workflow, permission: 'webhooks' },
       { name: 'Custom Actions', path: '/settings/custom-actions', icon: Zap, permission: 'custom_actions' },
       { name: 'SSO', path: '/settings/sso', icon: ShieldCheck, permission: 'settings.sso' }
     ]
@@ -22,6 +22,21 @@ function delay(ms: number): Promise<void> {
   return new Promise(resolve => setTimeout(resolve, ms))
 }
 
+// Buttons and list steps wait for the contact to pick an option
+function isChoiceStep(step: FlowStep): boolean {
+  return step.message_type === 'buttons' || step.message_type === 'list'
+}
+
+// The options of a choice step. List rows are shown as buttons.
+function choiceButtons(step: FlowStep): ButtonConfig[] | undefined {
+  if (step.message_type === 'list') {
+    return (step.input_config?.sections || []).flatMap((section: any) =>
+      (section.rows || []).map((row: any) => ({ id: row.id, title: row.title, type: 'reply' as const }))
+    )
+  }
+  return step.message_type === 'buttons' ? step.buttons : undefined
+}
+
 export function useFlowSimulation(
   steps: Ref<FlowStep[]>,
   flowData: Ref<Partial<FlowData>>
@@ -59,7 +74,7 @@ export function useFlowSimulation(
 
   const expectedInputType = computed(() => {
     if (!currentStep.value) return null
-    if (currentStep.value.message_type === 'buttons') return 'button'
+    if (isChoiceStep(currentStep.value)) return 'button'
     if (currentStep.value.input_type !== 'none') return currentStep.value.input_type
     return null
   })
@@ -183,7 +198,7 @@ export function useFlowSimulation(
     // Add bot message
     addMessage('bot', messageContent || 'No message configured', {
       stepName: step.step_name,
-      buttons: step.message_type === 'buttons' ? step.buttons : undefined,
+      buttons: choiceButtons(step),
       inputType: step.input_type !== 'none' ? step.input_type : undefined,
       inputConfig: step.input_config,
       isApiMessage: step.message_type === 'api_fetch'
@@ -202,7 +217,7 @@ export function useFlowSimulation(
     }
 
     // Determine if we need user input
-    const needsInput = step.input_type !== 'none' || step.message_type === 'buttons' || step.message_type === 'whatsapp_flow'
+    const needsInput = step.input_type !== 'none' || isChoiceStep(step) || step.message_type === 'whatsapp_flow'
 
     if (needsInput) {
       state.status = 'waiting_input'
@@ -394,7 +409,7 @@ export function useFlowSimulation(
     if (state.status === 'paused') {
       if (currentStep.value) {
         const needsInput = currentStep.value.input_type !== 'none' ||
-          currentStep.value.message_type === 'buttons' ||
+          isChoiceStep(currentStep.value) ||
           currentStep.value.message_type === 'whatsapp_flow'
 
         state.status = needsInput ? 'waiting_input' : 'running'
@@ -430,7 +445,7 @@ export function useFlowSimulation(
     const step = steps.value[snapshot.stepIndex]
     if (step) {
       const needsInput = step.input_type !== 'none' ||
-        step.message_type === 'buttons' ||
+        isChoiceStep(step) ||
         step.message_type === 'whatsapp_flow'
 
       state.status = needsInput ? 'waiting_input' : 'running'
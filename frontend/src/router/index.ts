@@ -34,6 +34,12 @@ const router = createRouter({
       component: () => import('@/views/auth/SSOCallbackView.vue'),
       meta: { requiresAuth: false }
     },
+    {
+      path: '/invite',
+      name: 'accept-invite',
+      component: () => import('@/views/auth/AcceptInviteView.vue'),
+      meta: { requiresAuth: false }
+    },
     {
       path: '/',
       component: () => import('@/components/layout/AppLayout.vue'),
@@ -58,6 +64,12 @@ const router = createRouter({
           props: true,
           meta: { permission: 'chat' }
         },
+        {
+          path: 'groups',
+          name: 'groups',
+          component: () => import('@/views/groups/GroupsView.vue'),
+          meta: { permission: 'chat' }
+        },
         {
           path: 'profile',
           name: 'profile',
@@ -82,6 +94,24 @@ const router = createRouter({
           component: () => import('@/views/settings/CampaignsView.vue'),
           meta: { permission: 'campaigns' }
         },
+        {
+          path: 'tracking-links',
+          name: 'tracking-links',
+          component: () => import('@/views/settings/TrackingLinksView.vue'),
+          meta: { permission: 'campaigns' }
+        },
+        {
+          path: 'sequences',
+          name: 'sequences',
+          component: () => import('@/views/settings/SequencesView.vue'),
+          meta: { permission: 'campaigns' }
+        },
+        {
+          path: 'segments',
+          name: 'segments',
+          component: () => import('@/views/settings/SegmentsView.vue'),
+          meta: { permission: 'contacts' }
+        },
         {
           path: 'chatbot',
           name: 'chatbot',
@@ -122,6 +152,12 @@ const router = createRouter({
           component: () => import('@/views/chatbot/AIContextsView.vue'),
           meta: { permission: 'chatbot.ai' }
         },
+        {
+          path: 'chatbot/knowledge',
+          name: 'chatbot-knowledge',
+          component: () => import('@/views/chatbot/KnowledgeBaseView.vue'),
+          meta: { permission: 'chatbot.ai' }
+        },
         {
           path: 'chatbot/transfers',
           name: 'chatbot-transfers',
@@ -158,6 +194,18 @@ const router = createRouter({
           component: () => import('@/views/settings/CannedResponsesView.vue'),
           meta: { permission: 'canned_responses' }
         },
+        {
+          path: 'settings/shortcodes',
+          name: 'shortcodes',
+          component: () => import('@/views/settings/ShortcodesView.vue'),
+          meta: { permission: 'canned_responses' }
+        },
+        {
+          path: 'settings/holidays',
+          name: 'holidays',
+          component: () => import('@/views/settings/HolidaysView.vue'),
+          meta: { permission: 'settings.chatbot' }
+        },
         {
           path: 'settings/users',
           name: 'users',
@@ -188,6 +236,12 @@ const router = createRouter({
           component: () => import('@/views/settings/WebhooksView.vue'),
           meta: { permission: 'webhooks' }
         },
+        {
+          path: 'settings/automations',
+          name: 'automations',
+          component: () => import('@/views/settings/AutomationsView.vue'),
+          meta: { permission: 'webhooks' }
+        },
         {
           path: 'settings/sso',
           name: 'sso-settings',
@@ -215,27 +269,35 @@ const router = createRouter({
 const navigationOrder = [
   { path: '/', permission: 'analytics' },
   { path: '/chat', permission: 'chat' },
+  { path: '/groups', permission: 'chat' },
   { path: '/chatbot', permission: 'settings.chatbot', childPaths: [
     { path: '/chatbot', permission: 'settings.chatbot' },
     { path: '/chatbot/keywords', permission: 'chatbot.keywords' },
     { path: '/chatbot/flows', permission: 'flows.chatbot' },
-    { path: '/chatbot/ai', permission: 'chatbot.ai' }
+    { path: '/chatbot/ai', permission: 'chatbot.ai' },
+    { path: '/chatbot/knowledge', permission: 'chatbot.ai' }
   ]},
   { path: '/chatbot/transfers', permission: 'transfers' },
   { path: '/analytics/agents', permission: 'analytics.agents' },
   { path: '/templates', permission: 'templates' },
   { path: '/flows', permission: 'flows.whatsapp' },
   { path: '/campaigns', permission: 'campaigns' },
+  { path: '/tracking-links', permission: 'campaigns' },
+  { path: '/sequences', permission: 'campaigns' },
+  { path: '/segments', permission: 'contacts' },
   { path: '/settings', permission: 'settings.general', childPaths: [
     { path: '/settings', permission: 'settings.general' },
     { path: '/settings/chatbot', permission: 'settings.chatbot' },
+    { path: '/settings/holidays', permission: 'settings.chatbot' },
     { path: '/settings/accounts', permission: 'accounts' },
     { path: '/settings/canned-responses', permission: 'canned_responses' },
+    { path: '/settings/shortcodes', permission: 'canned_responses' },
     { path: '/settings/teams', permission: 'teams' },
     { path: '/settings/users', permission: 'users' },
     { path: '/settings/roles', permission: 'roles' },
     { path: '/settings/api-keys', permission: 'api_keys' },
     { path: '/settings/webhooks', permission: 'webhooks' },
+    { path: '/settings/automations', permission: 'webhooks' },
     { path: '/settings/custom-actions', permission: 'custom_actions' },
     { path: '/settings/sso', permission: 'settings.sso' }
   ]}
@@ -97,19 +97,37 @@ export const usersService = {
   update: (id: string, data: { email?: string; password?: string; full_name?: string; role_id?: string; is_active?: boolean }) =>
     api.put(`/users/${id}`, data),
   delete: (id: string) => api.delete(`/users/${id}`),
+  assignRole: (id: string, data: { role_id?: string; role?: string }) =>
+    api.put(`/users/${id}/role`, data),
   me: () => api.get('/me'),
-  updateSettings: (data: { email_notifications: boolean; new_message_alerts: boolean; campaign_updates: boolean }) =>
+  updateSettings: (data: { email_notifications: boolean; new_message_alerts: boolean; campaign_updates: boolean; language?: string }) =>
     api.put('/me/settings', data),
   changePassword: (data: { current_password: string; new_password: string }) =>
     api.put('/me/password', data),
+  setupTwoFactor: () => api.post<{ secret: string; otpauth_url: string }>('/me/2fa/setup'),
+  enableTwoFactor: (code: string) => api.post('/me/2fa/enable', { code }),
+  disableTwoFactor: (data: { password: string; code: string }) => api.post('/me/2fa/disable', data),
+  regenerateBackupCodes: (code: string) => api.post('/me/2fa/backup-codes', { code }),
   updateAvailability: (isAvailable: boolean) =>
     api.put('/me/availability', { is_available: isAvailable })
 }
 
+export const invitationsService = {
+  list: (params?: { status?: string }) => api.get('/invitations', { params }),
+  create: (data: { email: string; role_id?: string }) => api.post('/invitations', data),
+  resend: (id: string) => api.post(`/invitations/${id}/resend`),
+  revoke: (id: string) => api.delete(`/invitations/${id}`),
+  get: (token: string) => api.get('/auth/invitation', { params: { token } }),
+  accept: (data: { token: string; full_name: string; password?: string }) =>
+    api.post('/auth/invitation/accept', data)
+}
+
 export const apiKeysService = {
   list: () => api.get('/api-keys'),
-  create: (data: { name: string; expires_at?: string }) =>
+  create: (data: { name: string; expires_at?: string; scopes?: string[]; rate_limit?: number }) =>
     api.post('/api-keys', data),
+  rotate: (id: string) => api.post(`/api-keys/${id}/rotate`),
+  revoke: (id: string) => api.post(`/api-keys/${id}/revoke`),
   delete: (id: string) => api.delete(`/api-keys/${id}`)
 }
 
@@ -118,37 +136,395 @@ export const accountsService = {
   get: (id: string) => api.get(`/accounts/${id}`),
   create: (data: any) => api.post('/accounts', data),
   update: (id: string, data: any) => api.put(`/accounts/${id}`, data),
-  delete: (id: string) => api.delete(`/accounts/${id}`)
+  delete: (id: string) => api.delete(`/accounts/${id}`),
+  getHealth: () => api.get('/accounts/health'),
+  getEmbeddedSignupConfig: () => api.get('/accounts/embedded-signup'),
+  completeEmbeddedSignup: (data: EmbeddedSignupRequest) => api.post('/accounts/embedded-signup', data),
+  createTelegram: (data: TelegramAccountRequest) => api.post('/accounts/telegram', data),
+  createInstagram: (data: InstagramAccountRequest) => api.post('/accounts/instagram', data),
+  createMessenger: (data: MessengerAccountRequest) => api.post('/accounts/messenger', data),
+  createWebChat: (data: WebChatAccountRequest) => api.post('/accounts/webchat', data),
+  getPersistentMenu: (id: string) => api.get(`/accounts/${id}/persistent-menu`),
+  updatePersistentMenu: (id: string, items: PersistentMenuItem[]) =>
+    api.put(`/accounts/${id}/persistent-menu`, { items }),
+  getProfile: (id: string) => api.get(`/accounts/${id}/profile`),
+  updateProfile: (id: string, data: Partial<Omit<BusinessProfile, 'profile_picture_url'>>) =>
+    api.put(`/accounts/${id}/profile`, data),
+  uploadProfilePhoto: (id: string, file: File) => {
+    const formData = new FormData()
+    formData.append('file', file)
+    return api.post(`/accounts/${id}/profile/photo`, formData, {
+      headers: { 'Content-Type': 'multipart/form-data' }
+    })
+  }
+}
+
+export interface EmbeddedSignupConfig {
+  enabled: boolean
+  app_id?: string
+  config_id?: string
+  api_version?: string
+}
+
+export interface EmbeddedSignupRequest {
+  code: string
+  waba_id: string
+  phone_number_id: string
+  pin: string
+  name?: string
+}
+
+export type AccountChannel = 'whatsapp' | 'telegram' | 'instagram' | 'messenger' | 'webchat'
+
+export interface TelegramAccountRequest {
+  name: string
+  bot_token: string
+  is_default_incoming?: boolean
+  is_default_outgoing?: boolean
+}
+
+export interface InstagramAccountRequest {
+  name: string
+  instagram_account_id: string
+  page_id: string
+  access_token: string
+  app_secret?: string
+  webhook_verify_token?: string
+  api_version?: string
+  is_default_incoming?: boolean
+  is_default_outgoing?: boolean
+}
+
+export interface MessengerAccountRequest {
+  name: string
+  page_id: string
+  access_token: string
+  app_secret?: string
+  webhook_verify_token?: string
+  api_version?: string
+  is_default_incoming?: boolean
+  is_default_outgoing?: boolean
+}
+
+export interface WebChatAccountRequest {
+  name: string
+  is_default_incoming?: boolean
+  is_default_outgoing?: boolean
+}
+
+export interface PersistentMenuItem {
+  type: 'postback' | 'web_url'
+  title: string
+  payload?: string
+  url?: string
+}
+
+export interface BusinessProfile {
+  about: string
+  address: string
+  description: string
+  email: string
+  profile_picture_url: string
+  websites: string[]
+  vertical: string
 }
 
 export const contactsService = {
-  list: (params?: { search?: string; page?: number; limit?: number }) =>
+  list: (params?: { search?: string; tag?: string; opt_in_status?: string; page?: number; limit?: number }) =>
     api.get('/contacts', { params }),
   get: (id: string) => api.get(`/contacts/${id}`),
   create: (data: any) => api.post('/contacts', data),
   update: (id: string, data: any) => api.put(`/contacts/${id}`, data),
   delete: (id: string) => api.delete(`/contacts/${id}`),
+  tags: () => api.get('/contacts/tags'),
+  bulkTag: (data: { contact_ids: string[]; add?: string[]; remove?: string[] }) =>
+    api.post('/contacts/tags', data),
   assign: (id: string, userId: string | null) =>
     api.put(`/contacts/${id}/assign`, { user_id: userId }),
+  setTimezone: (id: string, timezone: string) =>
+    api.put(`/contacts/${id}/timezone`, { timezone }),
+  setAI: (id: string, enabled: boolean) =>
+    api.put(`/contacts/${id}/ai`, { enabled }),
+  block: (id: string, data?: { reason?: string; duration_minutes?: number }) =>
+    api.post(`/contacts/${id}/block`, data || {}),
+  unblock: (id: string) => api.delete(`/contacts/${id}/block`),
+  blocked: (params?: { page?: number; limit?: number; paused?: boolean }) =>
+    api.get('/contacts/blocked', { params }),
   getSessionData: (id: string) => api.get(`/contacts/${id}/session-data`),
-  import: (file: File) => {
+  consentHistory: (id: string) => api.get(`/contacts/${id}/consent`),
+  import: (file: File, options?: { mapping?: Record<string, string>; update_existing?: boolean }) => {
     const formData = new FormData()
     formData.append('file', file)
+    if (options?.mapping) {
+      formData.append('mapping', JSON.stringify(options.mapping))
+    }
+    if (options?.update_existing === false) {
+      formData.append('update_existing', 'false')
+    }
     return api.post('/contacts/import', formData, {
       headers: { 'Content-Type': 'multipart/form-data' }
     })
-  }
+  },
+  imports: () => api.get('/contacts/imports'),
+  getImport: (id: string) => api.get(`/contacts/imports/${id}`),
+  export: (params?: { segment_id?: string; attributes?: string }) =>
+    api.get('/contacts/export', { params, responseType: 'blob' })
+}
+
+export interface ContactImport {
+  id: string
+  file_name: string
+  status: 'pending' | 'processing' | 'completed'
+  column_mapping: Record<string, string>
+  update_existing: boolean
+  total_rows: number
+  created_count: number
+  updated_count: number
+  skipped_count: number
+  failed_count: number
+  errors?: { row: number; phone_number: string; error: string }[]
+  finished_at?: string
+  created_at: string
+}
+
+export interface ContactConsentEvent {
+  id: string
+  from_status: 'unknown' | 'opted_in' | 'opted_out'
+  to_status: 'unknown' | 'opted_in' | 'opted_out'
+  source: 'keyword' | 'user' | 'import'
+  keyword?: string
+  user_id?: string
+  user_name?: string
+  created_at: string
 }
 
 export const messagesService = {
   list: (contactId: string, params?: { page?: number; limit?: number; before_id?: string }) =>
     api.get(`/contacts/${contactId}/messages`, { params }),
-  send: (contactId: string, data: { type: string; content: any; reply_to_message_id?: string }) =>
+  send: (contactId: string, data: { type: string; content?: any; reply_to_message_id?: string; contacts?: any[]; translate?: boolean }) =>
     api.post(`/contacts/${contactId}/messages`, data),
   sendTemplate: (contactId: string, data: { template_name: string; components?: any[] }) =>
     api.post(`/contacts/${contactId}/messages/template`, data),
   sendReaction: (contactId: string, messageId: string, emoji: string) =>
-    api.post(`/contacts/${contactId}/messages/${messageId}/reaction`, { emoji })
+    api.post(`/contacts/${contactId}/messages/${messageId}/reaction`, { emoji }),
+  translate: (contactId: string, messageId: string, language?: string) =>
+    api.post(`/contacts/${contactId}/messages/${messageId}/translate`, { language }),
+  exportPdf: (contactId: string, params?: { from?: string; to?: string; include_notes?: boolean; include_media?: boolean }) =>
+    api.get(`/contacts/${contactId}/messages/pdf`, { params, responseType: 'blob' }),
+  exportTranscript: (contactId: string, params: { format: 'csv' | 'json'; from?: string; to?: string }) =>
+    api.get(`/contacts/${contactId}/messages/export`, { params, responseType: 'blob' }),
+  exportAll: (params: { from: string; to: string; format?: 'csv' | 'json'; whatsapp_account?: string }) =>
+    api.get('/messages/export', { params, responseType: 'blob' }),
+  search: (params: { q: string; phone?: string; from?: string; to?: string; channel?: string; agent_id?: string; whatsapp_account?: string; sort?: 'relevance' | 'recent'; page?: number; limit?: number }) =>
+    api.get('/messages/search', { params }),
+  listArchives: (contactId: string, params?: { page?: number; limit?: number }) =>
+    api.get(`/contacts/${contactId}/archives`, { params }),
+  listArchived: (contactId: string, params?: { from?: string; to?: string }) =>
+    api.get(`/contacts/${contactId}/messages/archived`, { params }),
+  typing: (contactId: string) => api.post(`/contacts/${contactId}/typing`),
+  schedule: (contactId: string, data: { type: string; content: any; send_at: string; fallback_template_id?: string; fallback_template_params?: Record<string, string> }) =>
+    api.post(`/conversations/${contactId}/messages`, data),
+  listScheduled: (contactId: string, params?: { status?: string }) =>
+    api.get(`/conversations/${contactId}/scheduled-messages`, { params }),
+  reschedule: (id: string, data: { send_at?: string; local_send_at?: string; timezone?: string; content?: string }) =>
+    api.put(`/scheduled-messages/${id}`, data),
+  cancelScheduled: (id: string) => api.delete(`/scheduled-messages/${id}`)
+}
+
+export interface ScheduledMessage {
+  id: string
+  contact_id: string
+  whatsapp_account: string
+  message_type: 'text' | 'template'
+  content: string
+  template_id?: string
+  template_name?: string
+  send_at: string
+  timezone?: string
+  status: 'scheduled' | 'sending' | 'sent' | 'failed' | 'cancelled'
+  fallback_template_id?: string
+  fallback_template_name?: string
+  sent_as_template: boolean
+  message_id?: string
+  sent_at?: string
+  error_message?: string
+  window_expires_at?: string
+  will_send_as_template: boolean
+  created_at: string
+}
+
+export const followUpsService = {
+  list: (contactId: string, params?: { status?: string }) =>
+    api.get(`/conversations/${contactId}/follow-ups`, { params }),
+  create: (contactId: string, data: { due_at?: string; delay_minutes?: number; action: 'reopen' | 'template'; template_id?: string; template_params?: Record<string, string>; note?: string }) =>
+    api.post(`/conversations/${contactId}/follow-ups`, data),
+  cancel: (id: string) => api.delete(`/follow-ups/${id}`)
+}
+
+export interface FollowUp {
+  id: string
+  contact_id: string
+  whatsapp_account: string
+  due_at: string
+  action: 'reopen' | 'template'
+  template_id?: string
+  template_name?: string
+  template_params?: Record<string, string>
+  note: string
+  source: 'agent' | 'flow'
+  status: 'pending' | 'triggered' | 'resolved' | 'cancelled' | 'failed'
+  assigned_user_id?: string
+  created_by_id?: string
+  triggered_at?: string
+  resolved_at?: string
+  message_id?: string
+  error_message?: string
+  created_at: string
+}
+
+export const pendingMessagesService = {
+  list: (contactId: string) => api.get(`/conversations/${contactId}/pending`),
+  update: (contactId: string, kind: PendingMessageKind, id: string, data: { send_at?: string; content?: string }) =>
+    api.put(`/conversations/${contactId}/pending/${kind}/${id}`, data),
+  cancel: (contactId: string, kind: PendingMessageKind, id: string) =>
+    api.delete(`/conversations/${contactId}/pending/${kind}/${id}`)
+}
+
+export type PendingMessageKind = 'scheduled_message' | 'follow_up' | 'appointment_reminder'
+
+export interface PendingMessage {
+  id: string
+  kind: PendingMessageKind
+  send_at: string
+  content?: string
+  template_name?: string
+  will_send_as_template: boolean
+  source: 'agent' | 'flow' | 'api'
+  description?: string
+  created_by_id?: string
+  content_editable: boolean
+}
+
+export const contactNotesService = {
+  list: (contactId: string) => api.get(`/contacts/${contactId}/notes`),
+  create: (contactId: string, data: { content: string; is_pinned?: boolean }) =>
+    api.post(`/contacts/${contactId}/notes`, data),
+  update: (contactId: string, noteId: string, data: { content?: string; is_pinned?: boolean }) =>
+    api.put(`/contacts/${contactId}/notes/${noteId}`, data),
+  delete: (contactId: string, noteId: string) => api.delete(`/contacts/${contactId}/notes/${noteId}`),
+  revisions: (contactId: string, noteId: string) => api.get(`/contacts/${contactId}/notes/${noteId}/revisions`)
+}
+
+export interface ContactNote {
+  id: string
+  contact_id: string
+  content: string
+  is_pinned: boolean
+  created_by_id: string
+  created_by_name?: string
+  updated_by_id?: string
+  updated_by_name?: string
+  edited_at?: string
+  revision_count: number
+  created_at: string
+  updated_at: string
+}
+
+export interface ContactNoteRevision {
+  id: string
+  content: string
+  edited_by_id: string
+  edited_by_name?: string
+  edited_at: string
+}
+
+export const appointmentsService = {
+  list: (params?: { contact_id?: string; status?: string; from?: string; to?: string; page?: number; limit?: number }) =>
+    api.get('/appointments', { params }),
+  get: (id: string) => api.get(`/appointments/${id}`),
+  create: (data: { contact_id: string; title: string; starts_at: string; duration_minutes?: number; notes?: string; whatsapp_account?: string; reminder_template_id?: string; reminder_template_params?: Record<string, string>; reminder_offsets?: number[] }) =>
+    api.post('/appointments', data),
+  update: (id: string, data: { title?: string; starts_at?: string; duration_minutes?: number; notes?: string; status?: 'scheduled' | 'completed'; reminder_template_id?: string; reminder_template_params?: Record<string, string>; reminder_offsets?: number[] }) =>
+    api.put(`/appointments/${id}`, data),
+  cancel: (id: string) => api.post(`/appointments/${id}/cancel`)
+}
+
+export interface AppointmentReminder {
+  id: string
+  offset_minutes: number
+  send_at: string
+  status: 'pending' | 'sent' | 'failed' | 'cancelled'
+  message_id?: string
+  sent_at?: string
+  error_message?: string
+}
+
+export interface Appointment {
+  id: string
+  contact_id: string
+  contact_name?: string
+  whatsapp_account: string
+  title: string
+  starts_at: string
+  duration_minutes: number
+  notes: string
+  status: 'scheduled' | 'reschedule_requested' | 'cancelled' | 'completed'
+  source: 'api' | 'flow'
+  reminder_template_id?: string
+  reminder_template_name?: string
+  reminder_template_params?: Record<string, string>
+  reminder_offsets: number[]
+  reminders: AppointmentReminder[]
+  created_by_id?: string
+  cancelled_at?: string
+  created_at: string
+  updated_at: string
+}
+
+export const groupsService = {
+  list: (params?: { whatsapp_account?: string }) => api.get('/groups', { params }),
+  get: (id: string) => api.get(`/groups/${id}`),
+  create: (data: { subject: string; description?: string; whatsapp_account?: string }) =>
+    api.post('/groups', data),
+  update: (id: string, data: { chatbot_enabled?: boolean }) => api.put(`/groups/${id}`, data),
+  messages: (id: string, params?: { page?: number; limit?: number }) =>
+    api.get(`/groups/${id}/messages`, { params }),
+  send: (id: string, body: string) => api.post(`/groups/${id}/messages`, { content: { body } })
+}
+
+export interface WhatsAppGroup {
+  id: string
+  whatsapp_account: string
+  meta_group_id: string
+  subject: string
+  description: string
+  invite_link: string
+  chatbot_enabled: boolean
+  last_message_at?: string
+  participants?: GroupParticipant[]
+}
+
+export interface GroupParticipant {
+  id: string
+  phone_number: string
+  profile_name: string
+  contact_id?: string
+  joined_at: string
+  left_at?: string
+}
+
+export interface GroupMessage {
+  id: string
+  group_id: string
+  direction: 'incoming' | 'outgoing'
+  sender_phone: string
+  sender_name: string
+  message_type: string
+  content: string
+  mentions: string[]
+  status: string
+  error_message: string
+  created_at: string
 }
 
 export const templatesService = {
@@ -191,14 +567,18 @@ export const campaignsService = {
   update: (id: string, data: any) => api.put(`/campaigns/${id}`, data),
   delete: (id: string) => api.delete(`/campaigns/${id}`),
   start: (id: string) => api.post(`/campaigns/${id}/start`),
+  dryRun: (id: string) => api.post(`/campaigns/${id}/dry-run`),
   pause: (id: string) => api.post(`/campaigns/${id}/pause`),
   cancel: (id: string) => api.post(`/campaigns/${id}/cancel`),
   retryFailed: (id: string) => api.post(`/campaigns/${id}/retry-failed`),
+  variants: (id: string) => api.get(`/campaigns/${id}/variants`),
   stats: (id: string) => api.get(`/campaigns/${id}/stats`),
   // Recipients
   getRecipients: (id: string) => api.get(`/campaigns/${id}/recipients`),
   addRecipients: (id: string, recipients: Array<{ phone_number: string; recipient_name?: string; template_params?: Record<string, any> }>) =>
     api.post(`/campaigns/${id}/recipients/import`, { recipients }),
+  addSegmentRecipients: (id: string, segmentId: string) =>
+    api.post(`/campaigns/${id}/recipients/import`, { segment_id: segmentId }),
   deleteRecipient: (campaignId: string, recipientId: string) =>
     api.delete(`/campaigns/${campaignId}/recipients/${recipientId}`),
   // Media
@@ -215,11 +595,33 @@ export const campaignsService = {
     api.get(`/campaigns/${campaignId}/media`, { responseType: 'arraybuffer' })
 }
 
+export const bulkSendsService = {
+  create: (data: {
+    name?: string
+    whatsapp_account: string
+    template_id: string
+    header_media_id?: string
+    batch_size?: number
+    recipients: Array<{ phone_number: string; recipient_name?: string; template_params?: Record<string, any> }>
+  }) => api.post('/bulk-sends', data),
+  get: (id: string) => api.get(`/bulk-sends/${id}`),
+  cancel: (id: string) => api.post(`/bulk-sends/${id}/cancel`)
+}
+
 export const chatbotService = {
   // Settings
   getSettings: () => api.get('/chatbot/settings'),
   updateSettings: (data: any) => api.put('/chatbot/settings', data),
 
+  // Simulator
+  simulate: (data: {
+    phone_number: string
+    message: string
+    button_id?: string
+    whatsapp_account?: string
+    history?: { message: string; button_id?: string }[]
+  }) => api.post('/chatbot/simulate', data),
+
   // Keywords
   listKeywords: () => api.get('/chatbot/keywords'),
   getKeyword: (id: string) => api.get(`/chatbot/keywords/${id}`),
@@ -241,16 +643,56 @@ export const chatbotService = {
   updateAIContext: (id: string, data: any) => api.put(`/chatbot/ai-contexts/${id}`, data),
   deleteAIContext: (id: string) => api.delete(`/chatbot/ai-contexts/${id}`),
 
+  // AI Usage
+  getAIUsage: (params?: { from?: string; to?: string }) =>
+    api.get('/chatbot/ai-usage', { params }),
+
+  // AI Experiments
+  getAIExperimentResults: (params?: { from?: string; to?: string; whatsapp_account?: string }) =>
+    api.get('/chatbot/ai-experiments/results', { params }),
+
+  // AI Moderation
+  listAIModerationLogs: (params?: { page?: number; limit?: number }) =>
+    api.get('/chatbot/ai-moderation-logs', { params }),
+
+  // Knowledge Base
+  listKnowledge: (params?: { source?: string; search?: string }) =>
+    api.get('/chatbot/knowledge', { params }),
+  createKnowledge: (data: { source: string; title?: string; content?: string; question?: string; answer?: string }) =>
+    api.post('/chatbot/knowledge', data),
+  uploadKnowledge: (file: File, title?: string) => {
+    const formData = new FormData()
+    formData.append('file', file)
+    if (title) formData.append('title', title)
+    return api.post('/chatbot/knowledge', formData, {
+      headers: { 'Content-Type': 'multipart/form-data' }
+    })
+  },
+  updateKnowledge: (id: string, data: { title?: string; content?: string; question?: string; answer?: string }) =>
+    api.put(`/chatbot/knowledge/${id}`, data),
+  deleteKnowledge: (id: string) => api.delete(`/chatbot/knowledge/${id}`),
+  reindexKnowledge: () => api.post('/chatbot/knowledge/reindex'),
+  searchKnowledge: (query: string) => api.post('/chatbot/knowledge/search', { query }),
+
   // Sessions
-  listSessions: (params?: { status?: string; contact_id?: string }) =>
+  listSessions: (params?: { status?: string; contact_id?: string; mode?: string }) =>
     api.get('/chatbot/sessions', { params }),
   getSession: (id: string) => api.get(`/chatbot/sessions/${id}`),
+  claimSession: (id: string) => api.post(`/chatbot/sessions/${id}/claim`),
+  listSessionNotes: (id: string) => api.get(`/chatbot/sessions/${id}/notes`),
+  createSessionNote: (id: string, data: { content: string; mentions?: string[] }) =>
+    api.post(`/chatbot/sessions/${id}/notes`, data),
+  deleteSessionNote: (id: string, noteId: string) => api.delete(`/chatbot/sessions/${id}/notes/${noteId}`),
+  listMentions: (params?: { unread_only?: string }) => api.get('/mentions', { params }),
+  markMentionRead: (id: string) => api.put(`/mentions/${id}/read`),
 
   // Agent Transfers
   listTransfers: (params?: {
     status?: string
     agent_id?: string
     team_id?: string
+    priority?: TransferPriority
+    sla_status?: string
     limit?: number
     offset?: number
     include?: string // 'all' | 'contact,agent,team' etc.
@@ -261,11 +703,14 @@ export const chatbotService = {
     agent_id?: string
     notes?: string
     source?: string
+    priority?: TransferPriority
   }) => api.post('/chatbot/transfers', data),
   pickNextTransfer: () => api.post('/chatbot/transfers/pick'),
   resumeTransfer: (id: string) => api.put(`/chatbot/transfers/${id}/resume`),
-  assignTransfer: (id: string, agentId: string | null, teamId?: string | null) =>
-    api.put(`/chatbot/transfers/${id}/assign`, { agent_id: agentId, team_id: teamId })
+  assignTransfer: (id: string, agentId: string | null, teamId?: string | null, autoAssign?: boolean) =>
+    api.put(`/chatbot/transfers/${id}/assign`, { agent_id: agentId, team_id: teamId, auto_assign: autoAssign }),
+  setTransferPriority: (id: string, priority: TransferPriority) =>
+    api.put(`/chatbot/transfers/${id}/priority`, { priority })
 }
 
 export interface CannedResponse {
@@ -276,12 +721,14 @@ export interface CannedResponse {
   category: string
   is_active: boolean
   usage_count: number
+  last_used_at?: string
+  is_favorite: boolean
   created_at: string
   updated_at: string
 }
 
 export const cannedResponsesService = {
-  list: (params?: { category?: string; search?: string; active_only?: string }) =>
+  list: (params?: { category?: string; search?: string; active_only?: string; favorites_only?: string }) =>
     api.get('/canned-responses', { params }),
   get: (id: string) => api.get(`/canned-responses/${id}`),
   create: (data: { name: string; shortcut?: string; content: string; category?: string }) =>
@@ -289,18 +736,234 @@ export const cannedResponsesService = {
   update: (id: string, data: { name?: string; shortcut?: string; content?: string; category?: string; is_active?: boolean }) =>
     api.put(`/canned-responses/${id}`, data),
   delete: (id: string) => api.delete(`/canned-responses/${id}`),
-  use: (id: string) => api.post(`/canned-responses/${id}/use`)
+  use: (id: string, data?: { contact_id?: string; variables?: Record<string, string> }) =>
+    api.post(`/canned-responses/${id}/use`, data),
+  favorite: (id: string) => api.post(`/canned-responses/${id}/favorite`),
+  unfavorite: (id: string) => api.delete(`/canned-responses/${id}/favorite`),
+  stats: (params?: { from?: string; to?: string }) => api.get('/canned-responses/stats', { params })
+}
+
+export interface Shortcode {
+  id: string
+  code: string
+  content: string
+  description: string
+  is_active: boolean
+  created_at: string
+  updated_at: string
+}
+
+export const shortcodesService = {
+  list: (params?: { search?: string; active_only?: string }) =>
+    api.get('/shortcodes', { params }),
+  get: (id: string) => api.get(`/shortcodes/${id}`),
+  create: (data: { code: string; content: string; description?: string; is_active?: boolean }) =>
+    api.post('/shortcodes', data),
+  update: (id: string, data: { code?: string; content?: string; description?: string; is_active?: boolean }) =>
+    api.put(`/shortcodes/${id}`, data),
+  delete: (id: string) => api.delete(`/shortcodes/${id}`)
+}
+
+export interface Holiday {
+  id: string
+  name: string
+  date: string
+  recurring: boolean
+  calendar: string
+  whatsapp_account: string
+  source: string
+  created_at: string
+  updated_at: string
+}
+
+export const holidaysService = {
+  list: (params?: { calendar?: string; whatsapp_account?: string }) =>
+    api.get('/holidays', { params }),
+  create: (data: { name: string; date: string; recurring?: boolean; calendar?: string; whatsapp_account?: string }) =>
+    api.post('/holidays', data),
+  update: (id: string, data: { name?: string; date?: string; recurring?: boolean; calendar?: string; whatsapp_account?: string }) =>
+    api.put(`/holidays/${id}`, data),
+  delete: (id: string) => api.delete(`/holidays/${id}`),
+  importICal: (data: { calendar: string; whatsapp_account?: string; ics: string }) =>
+    api.post('/holidays/import', data)
+}
+
+export type TransferPriority = 'low' | 'normal' | 'high' | 'urgent'
+
+export interface SLAPolicy {
+  id: string
+  name: string
+  priority: TransferPriority | ''
+  tags: string[]
+  first_response_minutes: number
+  resolution_minutes: number
+  at_risk_percent: number
+  position: number
+  is_active: boolean
+  created_at: string
+  updated_at: string
+}
+
+type SLAPolicyInput = Partial<Omit<SLAPolicy, 'id' | 'created_at' | 'updated_at'>>
+
+export const slaPoliciesService = {
+  list: () => api.get('/sla-policies'),
+  create: (data: SLAPolicyInput & { name: string; first_response_minutes: number }) =>
+    api.post('/sla-policies', data),
+  update: (id: string, data: SLAPolicyInput) => api.put(`/sla-policies/${id}`, data),
+  delete: (id: string) => api.delete(`/sla-policies/${id}`)
+}
+
+export const trackingLinksService = {
+  list: (params?: { source?: string }) => api.get('/tracking-links', { params }),
+  create: (data: { name: string; phone_number: string; message?: string; source?: string; source_ref?: string }) =>
+    api.post('/tracking-links', data),
+  update: (id: string, data: { name?: string; phone_number?: string; message?: string; source?: string; source_ref?: string; is_active?: boolean }) =>
+    api.put(`/tracking-links/${id}`, data),
+  delete: (id: string) => api.delete(`/tracking-links/${id}`),
+  contacts: (id: string, params?: { limit?: number }) =>
+    api.get(`/tracking-links/${id}/contacts`, { params }),
+  qr: (id: string, params?: { scale?: number; direct?: boolean }) =>
+    api.get(`/tracking-links/${id}/qr`, { params, responseType: 'blob' })
+}
+
+export interface TrackingLink {
+  id: string
+  name: string
+  code: string
+  phone_number: string
+  message: string
+  source: 'campaign' | 'poster' | 'website' | 'other'
+  source_ref: string
+  is_active: boolean
+  clicks: number
+  wa_me_url: string
+  short_url: string
+  conversations: number
+  new_contacts: number
+  created_at: string
+}
+
+export interface TrackingLinkAttribution {
+  id: string
+  link_id: string
+  contact_id: string
+  is_new_contact: boolean
+  created_at: string
+  contact?: { id: string; phone_number: string; profile_name: string }
+}
+
+export const sequencesService = {
+  list: () => api.get('/sequences'),
+  get: (id: string) => api.get(`/sequences/${id}`),
+  create: (data: SequenceInput) => api.post('/sequences', data),
+  update: (id: string, data: Partial<SequenceInput>) => api.put(`/sequences/${id}`, data),
+  delete: (id: string) => api.delete(`/sequences/${id}`),
+  enrollments: (id: string, params?: { status?: string }) =>
+    api.get(`/sequences/${id}/enrollments`, { params }),
+  enroll: (id: string, contactIds: string[]) =>
+    api.post(`/sequences/${id}/enrollments`, { contact_ids: contactIds }),
+  enrollSegment: (id: string, segmentId: string) =>
+    api.post(`/sequences/${id}/enrollments`, { segment_id: segmentId }),
+  cancelEnrollment: (enrollmentId: string) =>
+    api.delete(`/sequence-enrollments/${enrollmentId}`)
+}
+
+export interface SequenceStep {
+  delay_minutes: number
+  message_type: 'text' | 'template'
+  message: string
+  template_id?: string
+  template_params?: Record<string, string>
+}
+
+export interface SequenceInput {
+  name: string
+  description?: string
+  whatsapp_account?: string
+  is_active?: boolean
+  exit_on_reply?: boolean
+  exit_keywords?: string[]
+  exit_tag?: string
+  steps: SequenceStep[]
+}
+
+export interface Sequence extends SequenceInput {
+  id: string
+  description: string
+  whatsapp_account: string
+  is_active: boolean
+  exit_on_reply: boolean
+  exit_keywords: string[]
+  exit_tag: string
+  enrollments?: Partial<Record<'active' | 'completed' | 'exited' | 'failed', number>>
+  created_at: string
+}
+
+export interface SequenceEnrollment {
+  id: string
+  sequence_id: string
+  contact_id: string
+  status: 'active' | 'completed' | 'exited' | 'failed'
+  next_step: number
+  next_run_at?: string
+  last_sent_at?: string
+  finished_at?: string
+  exit_reason?: 'replied' | 'opted_out' | 'tag_removed' | 'cancelled' | 'ordered'
+  variables?: Record<string, unknown>
+  error_message?: string
+  created_at: string
+  contact?: { id: string; phone_number: string; profile_name: string }
+}
+
+export const segmentsService = {
+  list: () => api.get('/segments'),
+  get: (id: string) => api.get(`/segments/${id}`),
+  create: (data: SegmentInput) => api.post('/segments', data),
+  update: (id: string, data: Partial<SegmentInput>) => api.put(`/segments/${id}`, data),
+  delete: (id: string) => api.delete(`/segments/${id}`),
+  preview: (conditions: SegmentCondition[]) => api.post('/segments/preview', { conditions }),
+  contacts: (id: string, params?: { page?: number; limit?: number }) =>
+    api.get(`/segments/${id}/contacts`, { params })
+}
+
+export interface SegmentCondition {
+  field: string
+  operator: 'equals' | 'not_equals' | 'contains' | 'not_contains' | 'is_empty' | 'is_not_empty' | 'greater_than' | 'less_than'
+  value: string
+}
+
+export interface SegmentInput {
+  name: string
+  description?: string
+  conditions: SegmentCondition[]
+}
+
+export interface Segment extends SegmentInput {
+  id: string
+  description: string
+  contact_count: number
+  created_at: string
+  updated_at: string
 }
 
 export const analyticsService = {
   dashboard: (params?: { from?: string; to?: string }) =>
     api.get('/analytics/dashboard', { params }),
-  messages: (params?: { from?: string; to?: string; group_by?: string }) =>
+  messages: (params?: { from?: string; to?: string; group_by?: string; timezone?: string }) =>
     api.get('/analytics/messages', { params }),
   campaigns: (params?: { from?: string; to?: string }) =>
     api.get('/analytics/campaigns', { params }),
   chatbot: (params?: { from?: string; to?: string }) =>
-    api.get('/analytics/chatbot', { params })
+    api.get('/analytics/chatbot', { params }),
+  ads: (params?: { from?: string; to?: string; account?: string }) =>
+    api.get('/analytics/ads', { params }),
+  conversations: (params?: { from?: string; to?: string; account?: string }) =>
+    api.get('/analytics/conversations', { params }),
+  satisfaction: (params?: { from?: string; to?: string; account?: string }) =>
+    api.get('/analytics/satisfaction', { params }),
+  overview: (params?: { from?: string; to?: string; group_by?: 'day' | 'week'; agent_id?: string }) =>
+    api.get('/analytics/overview', { params })
 }
 
 export const agentAnalyticsService = {
@@ -309,7 +972,14 @@ export const agentAnalyticsService = {
   getAgentDetails: (id: string, params?: { from?: string; to?: string }) =>
     api.get(`/analytics/agents/${id}`, { params }),
   getComparison: (params?: { from?: string; to?: string }) =>
-    api.get('/analytics/agents/comparison', { params })
+    api.get('/analytics/agents/comparison', { params }),
+  export: (params?: { from?: string; to?: string }) =>
+    api.get('/analytics/agents/export', { params, responseType: 'blob' })
+}
+
+export const twoFactorLoginService = {
+  setup: (twoFactorToken: string) =>
+    api.post<{ secret: string; otpauth_url: string }>('/auth/2fa/setup', { two_factor_token: twoFactorToken })
 }
 
 export const organizationService = {
@@ -319,7 +989,98 @@ export const organizationService = {
     timezone?: string
     date_format?: string
     name?: string
-  }) => api.put('/org/settings', data)
+    service_window_fallback_template_id?: string
+    service_window_fallback_template_params?: Record<string, string>
+    opt_out_keywords?: Record<string, string[]>
+    opt_in_keywords?: Record<string, string[]>
+    enforce_sso?: boolean
+    require_2fa?: boolean
+    allowed_ips?: string[]
+  }) => api.put('/org/settings', data),
+  exportSettingsBundle: () => api.get('/org/settings/export'),
+  importSettingsBundle: (bundle: Record<string, unknown>, dryRun = false) =>
+    api.post('/org/settings/import', bundle, { params: { dry_run: dryRun } }),
+  getNotificationSettings: () => api.get('/org/settings/notifications'),
+  updateNotificationSettings: (data: {
+    slack_webhook_url?: string
+    email_recipients?: string[]
+    events?: Partial<Record<NotificationEvent, NotificationChannels>>
+  }) => api.put('/org/settings/notifications', data),
+  testNotifications: () => api.post('/org/settings/notifications/test'),
+  getSMSFallbackSettings: () => api.get('/org/settings/sms-fallback'),
+  updateSMSFallbackSettings: (data: {
+    enabled?: boolean
+    account_sid?: string
+    auth_token?: string
+    from_number?: string
+    messaging_service_sid?: string
+    on_undeliverable?: boolean
+    delivery_timeout_hours?: number
+  }) => api.put('/org/settings/sms-fallback', data),
+  getPaymentSettings: () => api.get('/org/settings/payments'),
+  updatePaymentSettings: (data: {
+    provider?: '' | 'stripe' | 'razorpay'
+    key_id?: string
+    secret_key?: string
+    webhook_secret?: string
+    currency?: string
+    success_url?: string
+    paid_message?: string
+  }) => api.put('/org/settings/payments', data),
+  getGoogleCalendarSettings: () => api.get('/org/settings/google-calendar'),
+  updateGoogleCalendarSettings: (data: {
+    calendar_id?: string
+    service_account_key?: string
+  }) => api.put('/org/settings/google-calendar', data),
+  getShopifySettings: () => api.get('/org/settings/shopify'),
+  updateShopifySettings: (data: {
+    shop_domain?: string
+    access_token?: string
+    abandoned_cart_sequence_id?: string
+    shipping_sequence_id?: string
+  }) => api.put('/org/settings/shopify', data),
+  getCRMSettings: () => api.get('/org/settings/crm'),
+  updateCRMSettings: (data: {
+    provider?: 'hubspot' | 'salesforce' | ''
+    access_token?: string
+    instance_url?: string
+    client_id?: string
+    client_secret?: string
+    sync_contacts?: boolean
+    sync_summaries?: boolean
+    field_mappings?: CRMFieldMapping[]
+  }) => api.put('/org/settings/crm', data),
+  getHelpdeskSettings: () => api.get('/org/settings/helpdesk'),
+  updateHelpdeskSettings: (data: {
+    provider?: 'zendesk' | 'freshdesk' | ''
+    domain?: string
+    email?: string
+    api_key?: string
+    create_tickets?: boolean
+  }) => api.put('/org/settings/helpdesk', data),
+  getTranslationSettings: () => api.get('/org/settings/translation'),
+  updateTranslationSettings: (data: {
+    provider?: 'deepl' | 'google' | ''
+    api_key?: string
+    translate_incoming?: boolean
+    translate_replies?: boolean
+  }) => api.put('/org/settings/translation', data),
+  getArchiveSettings: () => api.get('/org/settings/archive'),
+  updateArchiveSettings: (data: { enabled?: boolean; retention_days?: number }) =>
+    api.put('/org/settings/archive', data)
+}
+
+export interface CRMFieldMapping {
+  field: string
+  crm_field: string
+  direction: 'push' | 'pull' | 'both'
+}
+
+export type NotificationEvent = 'handoff_requested' | 'sla_breached' | 'campaign_finished' | 'ai_provider_down'
+
+export interface NotificationChannels {
+  slack: boolean
+  email: boolean
 }
 
 // Organizations (super admin only)
@@ -347,6 +1108,21 @@ export interface Webhook {
   updated_at: string
 }
 
+export interface WebhookDelivery {
+  id: string
+  webhook_id: string
+  event: string
+  payload: Record<string, any>
+  status: 'pending' | 'delivered' | 'failed'
+  attempts: number
+  response_status?: number
+  response_body?: string
+  error_message?: string
+  duration_ms: number
+  delivered_at?: string
+  created_at: string
+}
+
 export interface WebhookEvent {
   value: string
   label: string
@@ -357,7 +1133,7 @@ export interface Team {
   id: string
   name: string
   description: string
-  assignment_strategy: 'round_robin' | 'load_balanced' | 'manual'
+  assignment_strategy: 'round_robin' | 'load_balanced' | 'skill_based' | 'manual'
   is_active: boolean
   member_count: number
   created_at: string
@@ -369,6 +1145,7 @@ export interface TeamMember {
   team_id: string
   user_id: string
   role: 'manager' | 'agent'
+  skills: string[]
   last_assigned_at: string | null
   user: {
     id: string
@@ -384,23 +1161,84 @@ export const teamsService = {
   create: (data: {
     name: string
     description?: string
-    assignment_strategy?: 'round_robin' | 'load_balanced' | 'manual'
+    assignment_strategy?: 'round_robin' | 'load_balanced' | 'skill_based' | 'manual'
   }) => api.post<{ team: Team }>('/teams', data),
   update: (id: string, data: {
     name?: string
     description?: string
-    assignment_strategy?: 'round_robin' | 'load_balanced' | 'manual'
+    assignment_strategy?: 'round_robin' | 'load_balanced' | 'skill_based' | 'manual'
     is_active?: boolean
   }) => api.put<{ team: Team }>(`/teams/${id}`, data),
   delete: (id: string) => api.delete(`/teams/${id}`),
   // Members
   listMembers: (teamId: string) => api.get<{ members: TeamMember[] }>(`/teams/${teamId}/members`),
-  addMember: (teamId: string, data: { user_id: string; role?: 'manager' | 'agent' }) =>
+  addMember: (teamId: string, data: { user_id: string; role?: 'manager' | 'agent'; skills?: string[] }) =>
     api.post<{ member: TeamMember }>(`/teams/${teamId}/members`, data),
+  updateMember: (teamId: string, userId: string, data: { role?: 'manager' | 'agent'; skills?: string[] }) =>
+    api.put<{ member: TeamMember }>(`/teams/${teamId}/members/${userId}`, data),
   removeMember: (teamId: string, userId: string) =>
     api.delete(`/teams/${teamId}/members/${userId}`)
 }
 
+export interface AuditLogEntry {
+  id: string
+  organization_id: string
+  user_id?: string
+  user_email: string
+  action: string
+  resource_type: string
+  resource_id?: string
+  resource_name: string
+  changes: Record<string, { from?: any; to?: any }>
+  ip_address: string
+  user_agent: string
+  created_at: string
+}
+
+export const auditLogsService = {
+  list: (params?: {
+    resource_type?: string
+    resource_id?: string
+    action?: string
+    user_id?: string
+    from?: string
+    to?: string
+    page?: number
+    limit?: number
+  }) => api.get<{ entries: AuditLogEntry[]; total: number; page: number; limit: number }>('/audit-logs', { params })
+}
+
+export interface DeadLetter {
+  id: string
+  kind: 'campaign_message' | 'scheduled_message' | 'webhook'
+  reference_id?: string
+  payload: Record<string, any>
+  error: string
+  error_code?: number
+  attempts: number
+  status: 'pending' | 'retried' | 'discarded'
+  retry_count: number
+  retried_at?: string
+  resolved_by_id?: string
+  created_at: string
+}
+
+export const deadLettersService = {
+  list: (params?: { kind?: string; status?: string; page?: number; limit?: number }) =>
+    api.get<{ dead_letters: DeadLetter[]; total: number; page: number; limit: number }>('/dead-letters', { params }),
+  retry: (id: string) => api.post<DeadLetter>(`/dead-letters/${id}/retry`),
+  retryMany: (data: { ids?: string[]; kind?: string; all?: boolean }) =>
+    api.post<{ retried: number; failed: { id: string; error: string }[] }>('/dead-letters/retry', data),
+  discard: (id: string) => api.delete<DeadLetter>(`/dead-letters/${id}`)
+}
+
+export const dataSubjectsService = {
+  export: (phoneNumber: string) =>
+    api.post('/data-subjects/export', { phone_number: phoneNumber }, { responseType: 'blob' }),
+  erase: (phoneNumber: string) =>
+    api.post<{ message: string; erased: Record<string, number> }>('/data-subjects/erase', { phone_number: phoneNumber })
+}
+
 export const webhooksService = {
   list: () => api.get<{ webhooks: Webhook[]; available_events: WebhookEvent[] }>('/webhooks'),
   get: (id: string) => api.get<Webhook>(`/webhooks/${id}`),
@@ -420,7 +1258,92 @@ export const webhooksService = {
     is_active?: boolean
   }) => api.put<Webhook>(`/webhooks/${id}`, data),
   delete: (id: string) => api.delete(`/webhooks/${id}`),
-  test: (id: string) => api.post(`/webhooks/${id}/test`)
+  test: (id: string) => api.post(`/webhooks/${id}/test`),
+  deliveries: (id: string, params?: { status?: string; event?: string; page?: number; limit?: number }) =>
+    api.get<{ deliveries: WebhookDelivery[]; total: number; page: number; limit: number }>(`/webhooks/${id}/deliveries`, { params })
+}
+
+export interface MessageHook {
+  id: string
+  name: string
+  stage: 'inbound' | 'outbound'
+  url: string
+  headers: Record<string, string>
+  has_secret: boolean
+  timeout_secs: number
+  position: number
+  stop_on_error: boolean
+  is_active: boolean
+  created_at: string
+  updated_at: string
+}
+
+export interface MessageHookRequest {
+  name?: string
+  stage?: 'inbound' | 'outbound'
+  url?: string
+  headers?: Record<string, string>
+  secret?: string
+  timeout_secs?: number
+  position?: number
+  stop_on_error?: boolean
+  is_active?: boolean
+}
+
+export const messageHooksService = {
+  list: () => api.get<{ message_hooks: MessageHook[] }>('/message-hooks'),
+  get: (id: string) => api.get<MessageHook>(`/message-hooks/${id}`),
+  create: (data: MessageHookRequest) => api.post<MessageHook>('/message-hooks', data),
+  update: (id: string, data: MessageHookRequest) => api.put<MessageHook>(`/message-hooks/${id}`, data),
+  delete: (id: string) => api.delete(`/message-hooks/${id}`)
+}
+
+export interface AutomationCondition {
+  field: string
+  operator: 'equals' | 'not_equals' | 'contains' | 'not_contains' | 'is_empty' | 'is_not_empty'
+  value: string
+}
+
+export interface AutomationAction {
+  type: 'send_template' | 'send_text' | 'add_tag' | 'remove_tag' | 'webhook' | 'slack_notify'
+  config: Record<string, any>
+}
+
+export interface Automation {
+  id: string
+  name: string
+  description: string
+  event: string
+  conditions: AutomationCondition[]
+  actions: AutomationAction[]
+  is_active: boolean
+  trigger_count: number
+  last_triggered_at?: string
+  created_at: string
+  updated_at: string
+}
+
+export interface AutomationLog {
+  id: string
+  automation_id: string
+  event: string
+  contact_id?: string
+  status: 'success' | 'failed'
+  event_data: Record<string, any>
+  action_results: { type: string; status: string; error?: string }[]
+  error_message?: string
+  duration_ms: number
+  created_at: string
+}
+
+export const automationsService = {
+  list: () => api.get<{ automations: Automation[]; available_events: WebhookEvent[]; available_actions: WebhookEvent[] }>('/automations'),
+  get: (id: string) => api.get<Automation>(`/automations/${id}`),
+  create: (data: Partial<Automation>) => api.post<Automation>('/automations', data),
+  update: (id: string, data: Partial<Automation>) => api.put<Automation>(`/automations/${id}`, data),
+  delete: (id: string) => api.delete(`/automations/${id}`),
+  logs: (id: string, params?: { status?: string; page?: number; limit?: number }) =>
+    api.get<{ logs: AutomationLog[]; total: number; page: number; limit: number }>(`/automations/${id}/logs`, { params })
 }
 
 export interface CustomAction {
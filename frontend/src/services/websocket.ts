@@ -41,6 +41,7 @@ function showNotification(title: string, body: string, contactId: string) {
 // WebSocket message types
 const WS_TYPE_NEW_MESSAGE = 'new_message'
 const WS_TYPE_STATUS_UPDATE = 'status_update'
+const WS_TYPE_MESSAGE_UPDATE = 'message_update'
 const WS_TYPE_SET_CONTACT = 'set_contact'
 const WS_TYPE_PING = 'ping'
 const WS_TYPE_PONG = 'pong'
@@ -54,9 +55,22 @@ const WS_TYPE_AGENT_TRANSFER_RESUME = 'agent_transfer_resume'
 const WS_TYPE_AGENT_TRANSFER_ASSIGN = 'agent_transfer_assign'
 const WS_TYPE_TRANSFER_ESCALATION = 'transfer_escalation'
 
+// Chatbot session types
+const WS_TYPE_SESSION_UPDATE = 'session_update'
+const WS_TYPE_SENTIMENT_ALERT = 'sentiment_alert'
+
+// Follow-up types
+const WS_TYPE_FOLLOW_UP_DUE = 'follow_up_due'
+
+// Appointment types
+const WS_TYPE_APPOINTMENT_UPDATE = 'appointment_update'
+
 // Campaign types
 const WS_TYPE_CAMPAIGN_STATS_UPDATE = 'campaign_stats_update'
 
+// Group types
+const WS_TYPE_GROUP_MESSAGE = 'group_message'
+
 // Permission types
 const WS_TYPE_PERMISSIONS_UPDATED = 'permissions_updated'
 
@@ -74,6 +88,8 @@ class WebSocketService {
   private isConnected = false
   private hasConnectedBefore = false
   private campaignStatsCallbacks: ((payload: any) => void)[] = []
+  private groupMessageCallbacks: ((payload: any) => void)[] = []
+  private sessionUpdateCallbacks: ((payload: any) => void)[] = []
 
   connect(token: string) {
     if (this.ws?.readyState === WebSocket.OPEN) {
@@ -141,6 +157,9 @@ class WebSocketService {
         case WS_TYPE_STATUS_UPDATE:
           this.handleStatusUpdate(store, message.payload)
           break
+        case WS_TYPE_MESSAGE_UPDATE:
+          this.handleMessageUpdate(store, message.payload)
+          break
         case WS_TYPE_AGENT_TRANSFER:
           this.handleAgentTransfer(message.payload)
           break
@@ -153,6 +172,18 @@ class WebSocketService {
         case WS_TYPE_TRANSFER_ESCALATION:
           this.handleTransferEscalation(message.payload)
           break
+        case WS_TYPE_SESSION_UPDATE:
+          this.sessionUpdateCallbacks.forEach(callback => callback(message.payload))
+          break
+        case WS_TYPE_SENTIMENT_ALERT:
+          this.handleSentimentAlert(message.payload)
+          break
+        case WS_TYPE_FOLLOW_UP_DUE:
+          this.handleFollowUpDue(message.payload)
+          break
+        case WS_TYPE_APPOINTMENT_UPDATE:
+          this.handleAppointmentUpdate(message.payload)
+          break
         case WS_TYPE_REACTION_UPDATE:
           this.handleReactionUpdate(store, message.payload)
           break
@@ -162,6 +193,9 @@ class WebSocketService {
         case WS_TYPE_CAMPAIGN_STATS_UPDATE:
           this.handleCampaignStatsUpdate(message.payload)
           break
+        case WS_TYPE_GROUP_MESSAGE:
+          this.groupMessageCallbacks.forEach(callback => callback(message.payload))
+          break
         case WS_TYPE_PERMISSIONS_UPDATED:
           this.handlePermissionsUpdated()
           break
@@ -238,7 +272,15 @@ class WebSocketService {
   }
 
   private handleStatusUpdate(store: ReturnType<typeof useContactsStore>, payload: any) {
-    store.updateMessageStatus(payload.message_id, payload.status)
+    store.updateMessageStatus(payload.message_id, payload.status, payload)
+  }
+
+  private handleMessageUpdate(store: ReturnType<typeof useContactsStore>, payload: any) {
+    // The contact edited or deleted a message
+    const currentContact = store.currentContact
+    if (currentContact && payload.contact_id === currentContact.id) {
+      store.updateMessageContent(payload.message_id, payload.content, payload.edited_at || undefined, payload.revoked_at || undefined)
+    }
   }
 
   private handleReactionUpdate(store: ReturnType<typeof useContactsStore>, payload: any) {
@@ -365,6 +407,56 @@ class WebSocketService {
     }
   }
 
+  private handleSentimentAlert(payload: any) {
+    const contactName = payload.contact_name || payload.phone_number
+
+    playNotificationSound()
+
+    toast.warning('Unhappy customer', {
+      description: `${contactName}'s recent messages are negative`,
+      duration: 10000,
+      action: {
+        label: 'Open',
+        onClick: () => router.push(`/chat/${payload.contact_id}`)
+      }
+    })
+  }
+
+  private handleFollowUpDue(payload: any) {
+    const contactName = payload.contact_name || payload.phone_number
+
+    playNotificationSound()
+
+    toast.info('Follow-up due', {
+      description: payload.note
+        ? `${contactName} hasn't replied: ${payload.note}`
+        : `${contactName} hasn't replied yet`,
+      duration: 10000,
+      action: {
+        label: 'Open',
+        onClick: () => router.push(`/chat/${payload.contact_id}`)
+      }
+    })
+  }
+
+  private handleAppointmentUpdate(payload: any) {
+    const contactName = payload.contact_name || payload.phone_number
+    const description = payload.status === 'cancelled'
+      ? `${contactName} cancelled "${payload.title}"`
+      : `${contactName} wants to reschedule "${payload.title}"`
+
+    playNotificationSound()
+
+    toast.info(payload.status === 'cancelled' ? 'Appointment cancelled' : 'Reschedule requested', {
+      description,
+      duration: 10000,
+      action: {
+        label: 'Open',
+        onClick: () => router.push(`/chat/${payload.contact_id}`)
+      }
+    })
+  }
+
   private handleCampaignStatsUpdate(payload: any) {
     // Notify all registered callbacks
     this.campaignStatsCallbacks.forEach(callback => callback(payload))
@@ -400,6 +492,28 @@ class WebSocketService {
     }
   }
 
+  onGroupMessage(callback: (payload: any) => void) {
+    this.groupMessageCallbacks.push(callback)
+    // Return unsubscribe function
+    return () => {
+      const index = this.groupMessageCallbacks.indexOf(callback)
+      if (index > -1) {
+        this.groupMessageCallbacks.splice(index, 1)
+      }
+    }
+  }
+
+  onSessionUpdate(callback: (payload: any) => void) {
+    this.sessionUpdateCallbacks.push(callback)
+    // Return unsubscribe function
+    return () => {
+      const index = this.sessionUpdateCallbacks.indexOf(callback)
+      if (index > -1) {
+        this.sessionUpdateCallbacks.splice(index, 1)
+      }
+    }
+  }
+
   private handleReconnect(token: string) {
     if (this.reconnectAttempts >= this.maxReconnectAttempts) {
       return
@@ -34,6 +34,14 @@ export interface User {
   settings?: UserSettings
   is_available?: boolean
   is_super_admin?: boolean
+  two_factor_enabled?: boolean
+}
+
+// Returned by login in place of tokens when a second factor is needed
+export interface TwoFactorChallenge {
+  two_factor_required: true
+  setup_required: boolean
+  two_factor_token: string
 }
 
 export interface AuthState {
@@ -112,10 +120,25 @@ export const useAuthStore = defineStore('auth', () => {
     }
   }
 
-  async function login(email: string, password: string): Promise<void> {
+  // Returns a challenge when the user still has to enter a two-factor code
+  async function login(email: string, password: string): Promise<TwoFactorChallenge | null> {
     const response = await api.post('/auth/login', { email, password })
     // fastglue wraps response in { status: "success", data: {...} }
-    setAuth(response.data.data)
+    const data = response.data.data
+    if (data.two_factor_required) {
+      return data as TwoFactorChallenge
+    }
+    setAuth(data)
+    return null
+  }
+
+  // Completes a login with a TOTP or backup code. Returns backup codes when the user
+  // enrolled during login.
+  async function verifyTwoFactor(twoFactorToken: string, code: string): Promise<string[]> {
+    const response = await api.post('/auth/2fa/verify', { two_factor_token: twoFactorToken, code })
+    const data = response.data.data
+    setAuth(data)
+    return data.backup_codes || []
   }
 
   async function register(data: {
@@ -225,6 +248,7 @@ export const useAuthStore = defineStore('auth', () => {
     restoreBreakTime,
     refreshUserData,
     login,
+    verifyTwoFactor,
     register,
     logout,
     refreshAccessToken,
@@ -11,13 +11,34 @@ export interface Contact {
   status: string
   tags: string[]
   custom_fields: Record<string, any>
+  whatsapp_account?: string
+  opt_in_status?: 'unknown' | 'opted_in' | 'opted_out'
+  opt_in_updated_at?: string
+  last_seen_at?: string
   last_message_at?: string
   unread_count: number
   assigned_user_id?: string
+  timezone?: string
+  language?: string
+  ai_disabled?: boolean
+  blocked_at?: string
+  blocked_until?: string
+  block_reason?: string
+  bot_paused_until?: string
+  service_window?: ServiceWindow
   created_at: string
   updated_at: string
 }
 
+// 24-hour customer service window, opened by each message from the customer
+export interface ServiceWindow {
+  open: boolean
+  expires_at?: string
+  remaining_seconds: number
+}
+
+const SERVICE_WINDOW_MS = 24 * 60 * 60 * 1000
+
 export interface ReplyPreview {
   id: string
   content: any
@@ -25,10 +46,21 @@ export interface ReplyPreview {
   direction: 'incoming' | 'outgoing'
 }
 
+export interface AdReferral {
+  source_id: string
+  source_type: string
+  source_url?: string
+  headline?: string
+  body?: string
+  media_type?: string
+  thumbnail_url?: string
+}
+
 export interface Reaction {
   emoji: string
   from_phone?: string
   from_user?: string
+  from_chatbot?: boolean
 }
 
 export interface Message {
@@ -53,14 +85,33 @@ export interface Message {
       id?: string
       title?: string
     }>
+    // Order messages
+    order_id?: string
+    note?: string
+    items?: Array<{
+      product_retailer_id: string
+      name?: string
+      quantity: number
+      item_price: number
+      currency: string
+    }>
+    total?: number
+    currency?: string
   }
   status: string
   wamid?: string
   error_message?: string
+  error_code?: number
+  delivered_at?: string
+  read_at?: string
   is_reply?: boolean
   reply_to_message_id?: string
   reply_to_message?: ReplyPreview
   reactions?: Reaction[]
+  referral?: AdReferral
+  service_window_fallback?: boolean
+  edited_at?: string
+  revoked_at?: string
   created_at: string
   updated_at: string
 }
@@ -170,6 +221,9 @@ export const useContactsStore = defineStore('contacts', () => {
       const data = response.data.data || response.data
       messages.value = data.messages || []
       hasMoreMessages.value = data.has_more === true
+      if (data.service_window && currentContact.value?.id === contactId) {
+        currentContact.value.service_window = data.service_window
+      }
     } catch (error) {
       console.error('Failed to fetch messages:', error)
     } finally {
@@ -255,13 +309,26 @@ export const useContactsStore = defineStore('contacts', () => {
           contact.unread_count++
         }
       }
+
+      // A customer message reopens the service window
+      if (message.direction === 'incoming' && currentContact.value?.id === message.contact_id) {
+        currentContact.value.service_window = {
+          open: true,
+          expires_at: new Date(new Date(message.created_at).getTime() + SERVICE_WINDOW_MS).toISOString(),
+          remaining_seconds: SERVICE_WINDOW_MS / 1000
+        }
+      }
     }
   }
 
-  function updateMessageStatus(messageId: string, status: string) {
+  function updateMessageStatus(messageId: string, status: string, error?: { error_code?: number; error_message?: string }) {
     const message = messages.value.find(m => m.id === messageId)
     if (message) {
       message.status = status
+      if (error?.error_message) {
+        message.error_message = error.error_message
+        message.error_code = error.error_code
+      }
     }
   }
 
@@ -285,6 +352,15 @@ export const useContactsStore = defineStore('contacts', () => {
     }
   }
 
+  function updateMessageContent(messageId: string, content: any, editedAt?: string, revokedAt?: string) {
+    const message = messages.value.find(m => m.id === messageId)
+    if (message) {
+      message.content = content
+      message.edited_at = editedAt
+      message.revoked_at = revokedAt
+    }
+  }
+
   return {
     contacts,
     currentContact,
@@ -315,6 +391,7 @@ export const useContactsStore = defineStore('contacts', () => {
     clearMessages,
     setReplyingTo,
     clearReplyingTo,
-    updateMessageReactions
+    updateMessageReactions,
+    updateMessageContent
   }
 })
@@ -26,7 +26,7 @@ export interface FlowStep {
   step_name: string
   step_order: number
   message: string
-  message_type: 'text' | 'buttons' | 'api_fetch' | 'whatsapp_flow' | 'transfer'
+  message_type: 'text' | 'buttons' | 'list' | 'api_fetch' | 'whatsapp_flow' | 'transfer' | 'follow_up' | 'appointment' | 'calendar_slots' | 'payment_link' | 'order_status' | 'product' | 'product_list'
   input_type: 'none' | 'text' | 'number' | 'email' | 'phone' | 'date' | 'select'
   input_config: Record<string, any>
   api_config: ApiConfig
@@ -1,6 +1,14 @@
 package config
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 
 	"github.com/knadh/koanf/v2"
@@ -19,11 +27,24 @@ type Config struct {
 	WhatsApp WhatsAppConfig `koanf:"whatsapp"`
 	AI       AIConfig       `koanf:"ai"`
 	Storage  StorageConfig  `koanf:"storage"`
+	Archive  StorageConfig  `koanf:"archive"` // Where archived messages go, media storage when type is empty
+	SMTP     SMTPConfig     `koanf:"smtp"`
+	Billing  BillingConfig  `koanf:"billing"`
+	Quotas   QuotasConfig   `koanf:"quotas"`
+	Secrets  SecretsConfig  `koanf:"secrets"`
+	Outbound OutboundConfig `koanf:"outbound"`
+	Tracing  TracingConfig  `koanf:"tracing"`
+	Health   HealthConfig   `koanf:"health"`
+
+	Encryption EncryptionConfig `koanf:"encryption"`
+	Security   SecurityConfig   `koanf:"security"`
+
+	secrets *secretState // Values resolved from secret references, see RefreshSecrets
 }
 
 type AppConfig struct {
 	Name        string `koanf:"name"`
-	Environment string `koanf:"environment"` // development, staging, production
+	Environment string `koanf:"environment"` // development, test, staging, production
 	Debug       bool   `koanf:"debug"`
 }
 
@@ -33,6 +54,12 @@ type ServerConfig struct {
 	ReadTimeout  int    `koanf:"read_timeout"`
 	WriteTimeout int    `koanf:"write_timeout"`
 	BasePath     string `koanf:"base_path"` // Base path for frontend (e.g., "/whatomate" for proxy pass)
+
+	// Native TLS, for deployments without a TLS-terminating proxy
+	TLSCert       string `koanf:"tls_cert"`        // PEM certificate chain, reloaded when it changes
+	TLSKey        string `koanf:"tls_key"`         // PEM private key
+	TLSClientCA   string `koanf:"tls_client_ca"`   // PEM CAs that client certificates must be signed by, enables mTLS
+	TLSClientAuth string `koanf:"tls_client_auth"` // require (default) or optional
 }
 
 type DatabaseConfig struct {
@@ -45,6 +72,13 @@ type DatabaseConfig struct {
 	MaxOpenConns    int    `koanf:"max_open_conns"`
 	MaxIdleConns    int    `koanf:"max_idle_conns"`
 	ConnMaxLifetime int    `koanf:"conn_max_lifetime"`
+	ConnMaxIdleTime int    `koanf:"conn_max_idle_time"` // Seconds an idle connection is kept, 0 keeps it until its lifetime ends
+
+	// ReplicaDSN connects a read replica, which serves analytics, search, export and
+	// list queries. Everything else, and every write, goes to the primary.
+	ReplicaDSN          string `koanf:"replica_dsn"`
+	ReplicaMaxOpenConns int    `koanf:"replica_max_open_conns"` // Defaults to max_open_conns
+	ReplicaMaxIdleConns int    `koanf:"replica_max_idle_conns"` // Defaults to max_idle_conns
 }
 
 type RedisConfig struct {
@@ -64,12 +98,46 @@ type WhatsAppConfig struct {
 	WebhookVerifyToken string `koanf:"webhook_verify_token"`
 	APIVersion         string `koanf:"api_version"`
 	BaseURL            string `koanf:"base_url"` // Meta Graph API base URL
+
+	// Embedded signup, for connecting numbers through Meta instead of entering credentials
+	AppID                  string `koanf:"app_id"`                    // Meta app the signup runs in
+	AppSecret              string `koanf:"app_secret"`                // Exchanges signup codes for access tokens, verifies webhook signatures
+	EmbeddedSignupConfigID string `koanf:"embedded_signup_config_id"` // Facebook Login for Business configuration
+
+	// WhatsApp Flows that exchange data with Whatomate encrypt their requests for this key
+	FlowPrivateKey string `koanf:"flow_private_key"` // PEM encoded RSA private key
+
+	// Webhook payloads are queued in Redis and processed by this many workers per server
+	WebhookWorkers int `koanf:"webhook_workers"` // Default 4, -1 processes them inline
 }
 
 type AIConfig struct {
 	OpenAIKey    string `koanf:"openai_key"`
 	AnthropicKey string `koanf:"anthropic_key"`
 	GoogleKey    string `koanf:"google_key"`
+
+	// Retries of failed AI provider calls, and circuit breaking of providers that keep failing
+	MaxAttempts         int `koanf:"max_attempts"`          // Calls to a provider before falling back; 1 turns retries off
+	RetryBackoffMs      int `koanf:"retry_backoff_ms"`      // Delay before the first retry, doubled for each one after, with jitter
+	RetryMaxBackoffMs   int `koanf:"retry_max_backoff_ms"`  // Longest delay between retries
+	BreakerThreshold    int `koanf:"breaker_threshold"`     // Failed calls in a row that open a provider's circuit
+	BreakerCooldownSecs int `koanf:"breaker_cooldown_secs"` // How long an open circuit skips the provider
+
+	// Connection pool shared by AI provider calls
+	ConnectTimeoutSecs  int `koanf:"connect_timeout_secs"`    // Limit on connecting to a provider, including the TLS handshake
+	MaxIdleConns        int `koanf:"max_idle_conns"`          // Idle connections kept open across all providers
+	MaxIdleConnsPerHost int `koanf:"max_idle_conns_per_host"` // Idle connections kept open to each provider host
+
+	Timeouts AITimeoutsConfig `koanf:"timeouts"`
+}
+
+// AITimeoutsConfig is how long to wait for each provider's answer, in seconds
+type AITimeoutsConfig struct {
+	OpenAI    int `koanf:"openai"`
+	Anthropic int `koanf:"anthropic"`
+	Google    int `koanf:"google"`
+	Ollama    int `koanf:"ollama"`  // Self-hosted models are often slower
+	Webhook   int `koanf:"webhook"` // Rasa and other HTTP bots
 }
 
 type StorageConfig struct {
@@ -79,9 +147,183 @@ type StorageConfig struct {
 	S3Region  string `koanf:"s3_region"`
 	S3Key     string `koanf:"s3_key"`
 	S3Secret  string `koanf:"s3_secret"`
+	// S3Endpoint is the URL of an S3 compatible service such as MinIO, empty for AWS
+	S3Endpoint string `koanf:"s3_endpoint"`
+}
+
+type SMTPConfig struct {
+	Host     string `koanf:"host"`
+	Port     int    `koanf:"port"`
+	Username string `koanf:"username"`
+	Password string `koanf:"password"`
+	From     string `koanf:"from"`
+}
+
+type BillingConfig struct {
+	SoftLimitPercent int    `koanf:"soft_limit_percent"` // Warn when usage reaches this percentage of a plan limit
+	ProviderURL      string `koanf:"provider_url"`       // Monthly statements are POSTed here when set
+	ProviderAPIKey   string `koanf:"provider_api_key"`   // Sent as a bearer token to the billing provider
+
+	TrialDays         int   `koanf:"trial_days"`          // Trial length for new organizations, 0 = no trial
+	TrialReminderDays []int `koanf:"trial_reminder_days"` // Email reminders this many days before the trial ends
+}
+
+// QuotasConfig sets the default fair-use quotas of organizations, which super admins
+// can override per organization. Messages count every outbound message, campaigns
+// included. 0 = unlimited.
+type QuotasConfig struct {
+	DailyMessages   int64 `koanf:"daily_messages"`
+	MonthlyMessages int64 `koanf:"monthly_messages"`
+	DailyAICalls    int64 `koanf:"daily_ai_calls"`
+	MonthlyAICalls  int64 `koanf:"monthly_ai_calls"`
+}
+
+// SecretsConfig configures the backends that configuration values can reference
+// secrets in, e.g. jwt.secret = "vault:secret/data/whatomate#jwt_secret". Unset
+// credentials fall back to the backends' standard environment variables.
+type SecretsConfig struct {
+	RefreshIntervalMins int `koanf:"refresh_interval_mins"` // Re-resolve references this often to pick up rotated secrets, 0 = only at startup
+
+	VaultAddress   string `koanf:"vault_address"` // VAULT_ADDR
+	VaultToken     string `koanf:"vault_token"`   // VAULT_TOKEN
+	VaultNamespace string `koanf:"vault_namespace"`
+
+	AWSRegion          string `koanf:"aws_region"`            // AWS_REGION
+	AWSAccessKeyID     string `koanf:"aws_access_key_id"`     // AWS_ACCESS_KEY_ID
+	AWSSecretAccessKey string `koanf:"aws_secret_access_key"` // AWS_SECRET_ACCESS_KEY
+	AWSSessionToken    string `koanf:"aws_session_token"`     // AWS_SESSION_TOKEN
+
+	GCPAccessToken string `koanf:"gcp_access_token"` // Defaults to the instance's service account on GCP
+
+	// Provider credentials saved through the API (WhatsApp access tokens, AI API keys)
+	// can reference secrets under these prefixes, e.g. "vault:secret/data/tenants/{organization_id}/".
+	// {organization_id} is replaced by the organization's ID. Empty allows no references.
+	CredentialReferences []string `koanf:"credential_references"`
+	CredentialCacheSecs  int      `koanf:"credential_cache_secs"` // How long secrets referenced by credentials are cached, default 300
 }
 
-// Load loads configuration from file and environment variables
+// OutboundConfig configures the proxy and TLS settings of outbound HTTP calls: Meta
+// API, AI providers, webhooks, integrations, SSO and secrets backends
+type OutboundConfig struct {
+	ProxyURL           string   `koanf:"proxy_url"`            // Overrides HTTPS_PROXY and HTTP_PROXY
+	NoProxy            string   `koanf:"no_proxy"`             // Overrides NO_PROXY, used with proxy_url
+	CABundle           string   `koanf:"ca_bundle"`            // PEM file of CAs trusted in addition to the system ones
+	InsecureSkipVerify []string `koanf:"insecure_skip_verify"` // Providers whose TLS certificates aren't verified
+}
+
+// TracingConfig configures OpenTelemetry tracing. Spans are exported over OTLP/HTTP
+// to a collector or a backend that accepts OTLP directly, e.g. Jaeger or Tempo.
+type TracingConfig struct {
+	Enabled     bool              `koanf:"enabled"`
+	Endpoint    string            `koanf:"endpoint"`     // OTLP/HTTP endpoint, default http://localhost:4318
+	ServiceName string            `koanf:"service_name"` // Default whatomate
+	SampleRatio float64           `koanf:"sample_ratio"` // Share of traces recorded, from 0 to 1; default 1
+	Headers     map[string]string `koanf:"headers"`      // Sent with every export, e.g. a backend API key
+}
+
+// HealthConfig configures the readiness probe. The database and Redis are always
+// checked; external APIs only when enabled, since an outage at Meta or an AI provider
+// takes every replica out of service at once.
+type HealthConfig struct {
+	CheckWhatsApp bool `koanf:"check_whatsapp"` // Check the Meta Graph API is reachable
+	CheckAI       bool `koanf:"check_ai"`       // Check the AI providers with keys in [ai] are reachable
+	TimeoutMs     int  `koanf:"timeout_ms"`     // Limit on each check, default 2000
+}
+
+// EncryptionConfig configures encryption at rest of stored credentials: WhatsApp
+// access tokens and AI provider API keys. Each value is encrypted with its own data
+// key, sealed by the master key. Keys are base64 encoded 32 byte AES keys, and can
+// reference a secret, e.g. key = "aws-sm:whatomate/production#encryption_key".
+type EncryptionConfig struct {
+	Key          string `koanf:"key"`           // Master key new values are encrypted with; unset stores them in plaintext
+	PreviousKeys string `koanf:"previous_keys"` // Comma separated master keys that still decrypt values, until whatomate rotate-keys has run
+}
+
+// MasterKeys decodes the current and previous master keys. The current key is nil
+// when encryption is off.
+func (e EncryptionConfig) MasterKeys() ([]byte, [][]byte, error) {
+	var current []byte
+	if e.Key != "" {
+		key, err := decodeMasterKey(e.Key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("encryption.key: %w", err)
+		}
+		current = key
+	}
+	var previous [][]byte
+	for _, encoded := range e.previousKeys() {
+		key, err := decodeMasterKey(encoded)
+		if err != nil {
+			return nil, nil, fmt.Errorf("encryption.previous_keys: %w", err)
+		}
+		previous = append(previous, key)
+	}
+	return current, previous, nil
+}
+
+func (e EncryptionConfig) previousKeys() []string {
+	var keys []string
+	for _, encoded := range strings.Split(e.PreviousKeys, ",") {
+		if encoded = strings.TrimSpace(encoded); encoded != "" {
+			keys = append(keys, encoded)
+		}
+	}
+	return keys
+}
+
+func decodeMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("must be base64 encoded")
+	}
+	if len(key) != masterKeySize {
+		return nil, fmt.Errorf("must be %d bytes, got %d", masterKeySize, len(key))
+	}
+	return key, nil
+}
+
+// SecurityConfig restricts where the API can be used from and slows down password
+// guessing. Organizations can narrow the allowed IPs further in their settings.
+type SecurityConfig struct {
+	AllowedIPs     []string `koanf:"allowed_ips"`     // IPs or CIDRs the API and sign in are accepted from, empty accepts any
+	TrustedProxies []string `koanf:"trusted_proxies"` // IPs or CIDRs of proxies whose X-Forwarded-For gives the client IP
+
+	// Failed logins are counted per account and per client IP, and once they reach the
+	// limit, logins are refused until login_lockout_mins after the last failure
+	LoginMaxAttempts      int `koanf:"login_max_attempts"`        // Per account, default 5, -1 disables lockouts
+	LoginMaxAttemptsPerIP int `koanf:"login_max_attempts_per_ip"` // Per client IP, default 20, -1 disables them
+	LoginLockoutMins      int `koanf:"login_lockout_mins"`        // Default 15
+}
+
+// ParseIPRanges parses IP addresses and CIDR ranges, e.g. 203.0.113.7 or
+// 10.0.0.0/8. A single address is a range of its own.
+func ParseIPRanges(values []string) ([]netip.Prefix, error) {
+	ranges := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q", value)
+			}
+			ranges = append(ranges, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q", value)
+		}
+		addr = addr.Unmap()
+		ranges = append(ranges, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return ranges, nil
+}
+
+// Load loads configuration in layers, each overriding the previous one: the config
+// file, an environment-specific file next to it (e.g. config.production.toml for
+// config.toml), and environment variables. Values that reference secrets are then
+// resolved from the secrets backends. The result is validated, and a
+// *ValidationError lists every invalid field.
 func Load(configPath string) (*Config, error) {
 	k := koanf.New(".")
 
@@ -90,13 +332,18 @@ func Load(configPath string) (*Config, error) {
 		if err := k.Load(file.Provider(configPath), toml.Parser()); err != nil {
 			return nil, err
 		}
+
+		// Load the environment-specific file if there is one
+		if envPath := environmentConfigFile(configPath, k); envPath != "" {
+			if err := k.Load(file.Provider(envPath), toml.Parser()); err != nil {
+				return nil, fmt.Errorf("%s: %w", envPath, err)
+			}
+		}
 	}
 
 	// Load from environment variables (WHATOMATE_ prefix)
-	// e.g., WHATOMATE_DATABASE_HOST -> database.host
-	if err := k.Load(env.Provider("WHATOMATE_", ".", func(s string) string {
-		return strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(s, "WHATOMATE_")), "_", ".")
-	}), nil); err != nil {
+	// e.g., WHATOMATE_DATABASE_SSL_MODE -> database.ssl_mode, WHATOMATE_AI_TIMEOUTS_OPENAI -> ai.timeouts.openai
+	if err := k.Load(env.Provider("WHATOMATE_", ".", envKey), nil); err != nil {
 		return nil, err
 	}
 
@@ -108,9 +355,100 @@ func Load(configPath string) (*Config, error) {
 	// Set defaults
 	setDefaults(&cfg)
 
+	// Resolve secret references, reporting failures along with any invalid fields
+	var problems []string
+	var verr *ValidationError
+	if err := resolveSecrets(context.Background(), &cfg); errors.As(err, &verr) {
+		problems = append(problems, verr.Errors...)
+	}
+	if err := cfg.Validate(); errors.As(err, &verr) {
+		problems = append(problems, verr.Errors...)
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Errors: problems}
+	}
+
 	return &cfg, nil
 }
 
+// envKeys maps environment variable names, without the WHATOMATE_ prefix and in
+// lowercase, to the config keys they set, e.g. ai_timeouts_openai to
+// ai.timeouts.openai. envMapKeys does the same for map fields such as
+// tracing.headers, whose keys follow the field's name.
+var envKeys, envMapKeys = configEnvKeys(reflect.TypeOf(Config{}))
+
+// configEnvKeys lists the environment variable names of the keys of a config struct
+func configEnvKeys(t reflect.Type) (keys, mapKeys map[string]string) {
+	keys, mapKeys = map[string]string{}, map[string]string{}
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("koanf")
+			if tag == "" || tag == "-" {
+				continue
+			}
+			key := tag
+			if prefix != "" {
+				key = prefix + "." + tag
+			}
+			name := strings.ReplaceAll(key, ".", "_")
+			switch field.Type.Kind() {
+			case reflect.Struct:
+				walk(field.Type, key)
+			case reflect.Map:
+				mapKeys[name] = key
+			default:
+				keys[name] = key
+			}
+		}
+	}
+	walk(t, "")
+	return keys, mapKeys
+}
+
+// envKey returns the config key an environment variable sets. Variables that don't
+// name a config key map their first _ to a dot, as Unmarshal ignores them anyway.
+func envKey(variable string) string {
+	name := strings.ToLower(strings.TrimPrefix(variable, "WHATOMATE_"))
+	if key, ok := envKeys[name]; ok {
+		return key
+	}
+	for prefix, key := range envMapKeys {
+		if entry, ok := strings.CutPrefix(name, prefix+"_"); ok && entry != "" {
+			return key + "." + entry
+		}
+	}
+	return strings.Replace(name, "_", ".", 1)
+}
+
+// environmentConfigFile returns the environment-specific file to load over a config
+// file loaded in k, or "" when there isn't one
+func environmentConfigFile(configPath string, k *koanf.Koanf) string {
+	environment := os.Getenv("WHATOMATE_APP_ENVIRONMENT")
+	if environment == "" {
+		environment = k.String("app.environment")
+	}
+	envPath := environmentConfigPath(configPath, environment)
+	if envPath == "" {
+		return ""
+	}
+	if _, err := os.Stat(envPath); err != nil {
+		return ""
+	}
+	return envPath
+}
+
+// environmentConfigPath returns the path of the environment-specific file for a
+// config file, e.g. config.production.toml for config.toml
+func environmentConfigPath(configPath, environment string) string {
+	if environment == "" {
+		return ""
+	}
+	ext := filepath.Ext(configPath)
+	return strings.TrimSuffix(configPath, ext) + "." + environment + ext
+}
+
 func setDefaults(cfg *Config) {
 	if cfg.App.Name == "" {
 		cfg.App.Name = "Whatomate"
@@ -130,6 +468,9 @@ func setDefaults(cfg *Config) {
 	if cfg.Server.WriteTimeout == 0 {
 		cfg.Server.WriteTimeout = 30
 	}
+	if cfg.Server.TLSClientAuth == "" {
+		cfg.Server.TLSClientAuth = ClientAuthRequire
+	}
 	if cfg.Database.Port == 0 {
 		cfg.Database.Port = 5432
 	}
@@ -145,6 +486,12 @@ func setDefaults(cfg *Config) {
 	if cfg.Database.ConnMaxLifetime == 0 {
 		cfg.Database.ConnMaxLifetime = 300
 	}
+	if cfg.Database.ReplicaMaxOpenConns == 0 {
+		cfg.Database.ReplicaMaxOpenConns = cfg.Database.MaxOpenConns
+	}
+	if cfg.Database.ReplicaMaxIdleConns == 0 {
+		cfg.Database.ReplicaMaxIdleConns = cfg.Database.MaxIdleConns
+	}
 	if cfg.Redis.Port == 0 {
 		cfg.Redis.Port = 6379
 	}
@@ -157,6 +504,9 @@ func setDefaults(cfg *Config) {
 	if cfg.WhatsApp.APIVersion == "" {
 		cfg.WhatsApp.APIVersion = "v18.0"
 	}
+	if cfg.WhatsApp.WebhookWorkers == 0 {
+		cfg.WhatsApp.WebhookWorkers = 4
+	}
 	if cfg.WhatsApp.BaseURL == "" {
 		cfg.WhatsApp.BaseURL = "https://graph.facebook.com"
 	}
@@ -166,4 +516,79 @@ func setDefaults(cfg *Config) {
 	if cfg.Storage.LocalPath == "" {
 		cfg.Storage.LocalPath = "./uploads"
 	}
+	if cfg.Archive.Type == "local" && cfg.Archive.LocalPath == "" {
+		cfg.Archive.LocalPath = "./archive"
+	}
+	if cfg.SMTP.Port == 0 {
+		cfg.SMTP.Port = 587
+	}
+	if cfg.AI.MaxAttempts == 0 {
+		cfg.AI.MaxAttempts = 3
+	}
+	if cfg.AI.RetryBackoffMs == 0 {
+		cfg.AI.RetryBackoffMs = 500
+	}
+	if cfg.AI.RetryMaxBackoffMs == 0 {
+		cfg.AI.RetryMaxBackoffMs = 4000
+	}
+	if cfg.AI.BreakerThreshold == 0 {
+		cfg.AI.BreakerThreshold = 5
+	}
+	if cfg.AI.BreakerCooldownSecs == 0 {
+		cfg.AI.BreakerCooldownSecs = 60
+	}
+	if cfg.AI.ConnectTimeoutSecs == 0 {
+		cfg.AI.ConnectTimeoutSecs = 10
+	}
+	if cfg.AI.MaxIdleConns == 0 {
+		cfg.AI.MaxIdleConns = 100
+	}
+	if cfg.AI.MaxIdleConnsPerHost == 0 {
+		cfg.AI.MaxIdleConnsPerHost = 20
+	}
+	if cfg.AI.Timeouts.OpenAI == 0 {
+		cfg.AI.Timeouts.OpenAI = 60
+	}
+	if cfg.AI.Timeouts.Anthropic == 0 {
+		cfg.AI.Timeouts.Anthropic = 60
+	}
+	if cfg.AI.Timeouts.Google == 0 {
+		cfg.AI.Timeouts.Google = 60
+	}
+	if cfg.AI.Timeouts.Ollama == 0 {
+		cfg.AI.Timeouts.Ollama = 120
+	}
+	if cfg.AI.Timeouts.Webhook == 0 {
+		cfg.AI.Timeouts.Webhook = 30
+	}
+	if cfg.Billing.SoftLimitPercent == 0 {
+		cfg.Billing.SoftLimitPercent = 80
+	}
+	if cfg.Billing.TrialReminderDays == nil {
+		cfg.Billing.TrialReminderDays = []int{7, 3, 1}
+	}
+	if cfg.Tracing.Endpoint == "" {
+		cfg.Tracing.Endpoint = "http://localhost:4318"
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "whatomate"
+	}
+	if cfg.Tracing.SampleRatio == 0 {
+		cfg.Tracing.SampleRatio = 1
+	}
+	if cfg.Health.TimeoutMs == 0 {
+		cfg.Health.TimeoutMs = 2000
+	}
+	if cfg.Secrets.CredentialCacheSecs == 0 {
+		cfg.Secrets.CredentialCacheSecs = 300
+	}
+	if cfg.Security.LoginMaxAttempts == 0 {
+		cfg.Security.LoginMaxAttempts = 5
+	}
+	if cfg.Security.LoginMaxAttemptsPerIP == 0 {
+		cfg.Security.LoginMaxAttemptsPerIP = 20
+	}
+	if cfg.Security.LoginLockoutMins == 0 {
+		cfg.Security.LoginLockoutMins = 15
+	}
 }
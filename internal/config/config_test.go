@@ -0,0 +1,209 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+[app]
+environment = "staging"
+
+[database]
+host = "localhost"
+user = "whatomate"
+name = "whatomate"
+
+[redis]
+host = "localhost"
+
+[jwt]
+secret = "test-secret-key-must-be-at-least-32-chars"
+`
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Layers(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.toml", testConfig)
+	writeConfig(t, dir, "config.staging.toml", "[database]\nhost = \"staging-db\"\nname = \"staging\"\n")
+	writeConfig(t, dir, "config.production.toml", "[database]\nhost = \"production-db\"\n")
+	t.Setenv("WHATOMATE_DATABASE_NAME", "from_env")
+	t.Setenv("WHATOMATE_DATABASE_SSL_MODE", "require")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "staging-db", cfg.Database.Host, "environment file overrides the base file")
+	assert.Equal(t, "from_env", cfg.Database.Name, "environment variables override files")
+	assert.Equal(t, "require", cfg.Database.SSLMode)
+	assert.Equal(t, "whatomate", cfg.Database.User)
+	assert.Equal(t, 8080, cfg.Server.Port, "defaults fill in unset values")
+}
+
+func TestLoad_NestedKeysFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.toml", testConfig)
+	t.Setenv("WHATOMATE_AI_TIMEOUTS_OPENAI", "15")
+	t.Setenv("WHATOMATE_SECRETS_VAULT_ADDRESS", "https://vault.example.com")
+	t.Setenv("WHATOMATE_SECRETS_REFRESH_INTERVAL_MINS", "5")
+	t.Setenv("WHATOMATE_TRACING_HEADERS_AUTHORIZATION", "Bearer token")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 15, cfg.AI.Timeouts.OpenAI)
+	assert.Equal(t, "https://vault.example.com", cfg.Secrets.VaultAddress)
+	assert.Equal(t, 5, cfg.Secrets.RefreshIntervalMins)
+	assert.Equal(t, "Bearer token", cfg.Tracing.Headers["authorization"])
+}
+
+func TestEnvKey(t *testing.T) {
+	assert.Equal(t, "database.ssl_mode", envKey("WHATOMATE_DATABASE_SSL_MODE"))
+	assert.Equal(t, "ai.timeouts.anthropic", envKey("WHATOMATE_AI_TIMEOUTS_ANTHROPIC"))
+	assert.Equal(t, "tracing.headers.x_api_key", envKey("WHATOMATE_TRACING_HEADERS_X_API_KEY"))
+	assert.Equal(t, "app.unknown_key", envKey("WHATOMATE_APP_UNKNOWN_KEY"))
+
+	// Every config key can be set, and no two keys share a variable
+	for name, key := range envKeys {
+		assert.Equal(t, key, envKey("WHATOMATE_"+strings.ToUpper(name)))
+	}
+	var leaves int
+	var count func(t reflect.Type)
+	count = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Tag.Get("koanf") == "" {
+				continue
+			}
+			if field.Type.Kind() == reflect.Struct {
+				count(field.Type)
+			} else if field.Type.Kind() != reflect.Map {
+				leaves++
+			}
+		}
+	}
+	count(reflect.TypeOf(Config{}))
+	assert.Len(t, envKeys, leaves)
+}
+
+func TestLoad_EnvironmentFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.toml", testConfig)
+	writeConfig(t, dir, "config.production.toml", "[database]\nhost = \"production-db\"\n")
+	t.Setenv("WHATOMATE_APP_ENVIRONMENT", "production")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "production", cfg.App.Environment)
+	assert.Equal(t, "production-db", cfg.Database.Host)
+}
+
+func TestLoad_ReportsAllErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.toml", `
+[app]
+environment = "prod"
+
+[database]
+host = "postgres://localhost:5432/whatomate"
+ssl_mode = "on"
+
+[jwt]
+secret = "short"
+`)
+
+	_, err := Load(path)
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	assert.ElementsMatch(t, []string{
+		`app.environment: must be one of development, test, staging, production, got "prod"`,
+		`database.host: must be a host name or address, got "postgres://localhost:5432/whatomate"`,
+		"database.user: is required",
+		"database.name: is required",
+		`database.ssl_mode: must be one of disable, allow, prefer, require, verify-ca, verify-full, got "on"`,
+		"redis.host: is required",
+		"jwt.secret: must be at least 32 characters",
+	}, verr.Errors)
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		cfg := &Config{
+			Database: DatabaseConfig{Host: "db", User: "whatomate", Name: "whatomate"},
+			Redis:    RedisConfig{Host: "redis"},
+			JWT:      JWTConfig{Secret: "test-secret-key-must-be-at-least-32-chars"},
+		}
+		setDefaults(cfg)
+		return cfg
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{name: "valid", modify: func(*Config) {}},
+		{name: "host with port", modify: func(c *Config) { c.Redis.Host = "redis:6379" }, want: `redis.host: must not include a port, got "redis:6379"`},
+		{name: "ipv6 host", modify: func(c *Config) { c.Database.Host = "::1" }},
+		{name: "unix socket host", modify: func(c *Config) { c.Database.Host = "/var/run/postgresql" }},
+		{name: "port out of range", modify: func(c *Config) { c.Server.Port = 70000 }, want: "server.port: must be between 1 and 65535"},
+		{name: "idle above open", modify: func(c *Config) { c.Database.MaxIdleConns = 50 }, want: "database.max_idle_conns: must not exceed database.max_open_conns"},
+		{name: "replica idle above open", modify: func(c *Config) { c.Database.ReplicaDSN = "host=replica"; c.Database.ReplicaMaxIdleConns = 50 }, want: "database.replica_max_idle_conns: must not exceed database.replica_max_open_conns"},
+		{name: "s3 without bucket", modify: func(c *Config) { c.Storage.Type = "s3"; c.Storage.S3Region = "us-east-1" }, want: "storage.s3_bucket: is required"},
+		{name: "smtp without from", modify: func(c *Config) { c.SMTP.Host = "smtp.example.com" }, want: "smtp.from: is required"},
+		{name: "invalid provider url", modify: func(c *Config) { c.Billing.ProviderURL = "billing.example.com" }, want: `billing.provider_url: must be an http or https URL, got "billing.example.com"`},
+		{name: "ai idle per host above total", modify: func(c *Config) { c.AI.MaxIdleConnsPerHost = 500 }, want: "ai.max_idle_conns_per_host: must not exceed ai.max_idle_conns"},
+		{name: "ai negative timeout", modify: func(c *Config) { c.AI.Timeouts.Webhook = -1 }, want: "ai.timeouts.webhook: must be positive"},
+		{name: "ai backoff above max", modify: func(c *Config) { c.AI.RetryBackoffMs = 5000 }, want: "ai.retry_max_backoff_ms: must not be less than ai.retry_backoff_ms"},
+		{name: "encryption key", modify: func(c *Config) { c.Encryption.Key = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=" }},
+		{name: "short encryption key", modify: func(c *Config) { c.Encryption.Key = "c2hvcnQ=" }, want: "encryption.key: must be 32 bytes, got 5"},
+		{name: "previous keys without key", modify: func(c *Config) { c.Encryption.PreviousKeys = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=" }, want: "encryption.key: is required with encryption.previous_keys"},
+		{name: "credential references", modify: func(c *Config) {
+			c.Secrets.CredentialReferences = []string{"vault:secret/data/tenants/{organization_id}/"}
+		}},
+		{name: "credential references allowing a whole backend", modify: func(c *Config) { c.Secrets.CredentialReferences = []string{"vault:"} }, want: `secrets.credential_references: must be secret reference prefixes such as vault:secret/data/tenants/, got "vault:"`},
+		{name: "allowed ips", modify: func(c *Config) { c.Security.AllowedIPs = []string{"203.0.113.7", "10.0.0.0/8", "2001:db8::/32"} }},
+		{name: "invalid allowed ip", modify: func(c *Config) { c.Security.AllowedIPs = []string{"10.0.0.0/33"} }, want: `security.allowed_ips: invalid CIDR "10.0.0.0/33"`},
+		{name: "invalid trusted proxy", modify: func(c *Config) { c.Security.TrustedProxies = []string{"proxy.internal"} }, want: `security.trusted_proxies: invalid IP address "proxy.internal"`},
+		{name: "login lockouts disabled", modify: func(c *Config) { c.Security.LoginMaxAttempts = -1; c.Security.LoginMaxAttemptsPerIP = -1 }},
+		{name: "negative lockout", modify: func(c *Config) { c.Security.LoginLockoutMins = -5 }, want: "security.login_lockout_mins: must be positive"},
+		{name: "base path with trailing slash", modify: func(c *Config) { c.Server.BasePath = "/whatomate/" }, want: "server.base_path: must start with / and not end with /, e.g. /whatomate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var verr *ValidationError
+			require.True(t, errors.As(err, &verr))
+			assert.Equal(t, []string{tt.want}, verr.Errors)
+		})
+	}
+}
+
+func TestParseIPRanges(t *testing.T) {
+	ranges, err := ParseIPRanges([]string{"203.0.113.7", " 10.1.2.3/8", "::ffff:198.51.100.1", "2001:db8::/32"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"203.0.113.7/32", "10.0.0.0/8", "198.51.100.1/32", "2001:db8::/32"}, []string{
+		ranges[0].String(), ranges[1].String(), ranges[2].String(), ranges[3].String(),
+	})
+
+	_, err = ParseIPRanges([]string{"10.0.0.0/8", "not-an-ip"})
+	assert.EqualError(t, err, `invalid IP address "not-an-ip"`)
+}
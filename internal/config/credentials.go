@@ -0,0 +1,96 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// organizationPlaceholder in an allowed credential reference prefix is replaced by
+// the ID of the organization the credential belongs to
+const organizationPlaceholder = "{organization_id}"
+
+// ErrCredentialReferenceNotAllowed is returned for a stored credential that
+// references a secret outside secrets.credential_references
+var ErrCredentialReferenceNotAllowed = errors.New("secret reference is not allowed for credentials")
+
+// CredentialSecrets resolves secret references in provider credentials that are
+// stored in the database, e.g. an AI API key saved as
+// "vault:secret/data/tenants/<org>/openai#api_key" instead of the key itself. Secrets
+// are fetched when used and cached for secrets.credential_cache_secs.
+type CredentialSecrets struct {
+	cfg *Config
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]credentialEntry
+}
+
+type credentialEntry struct {
+	value     string
+	fetchedAt time.Time
+}
+
+// NewCredentialSecrets returns a resolver of credential secret references
+func NewCredentialSecrets(cfg *Config) *CredentialSecrets {
+	return &CredentialSecrets{
+		cfg:     cfg,
+		ttl:     time.Duration(cfg.Secrets.CredentialCacheSecs) * time.Second,
+		now:     time.Now,
+		entries: make(map[string]credentialEntry),
+	}
+}
+
+// Check returns an error if a credential of an organization references a secret
+// it may not use. Values that aren't references are always allowed.
+func (c *CredentialSecrets) Check(orgID, value string) error {
+	if !IsSecretReference(value) {
+		return nil
+	}
+	// Paths can't climb out of an allowed prefix
+	if strings.Contains(value, "..") {
+		return ErrCredentialReferenceNotAllowed
+	}
+	for _, prefix := range c.cfg.Secrets.CredentialReferences {
+		if strings.HasPrefix(value, strings.ReplaceAll(prefix, organizationPlaceholder, orgID)) {
+			return nil
+		}
+	}
+	return ErrCredentialReferenceNotAllowed
+}
+
+// Resolve returns the value of a credential of an organization: the secret it
+// references, or the value itself if it isn't a reference. A secret that can't be
+// fetched keeps its last value until the backend is reachable again.
+func (c *CredentialSecrets) Resolve(ctx context.Context, orgID, value string) (string, error) {
+	if !IsSecretReference(value) {
+		return value, nil
+	}
+	if err := c.Check(orgID, value); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	entry, cached := c.entries[value]
+	c.mu.Unlock()
+	if cached && c.now().Sub(entry.fetchedAt) < c.ttl {
+		return entry.value, nil
+	}
+
+	secret, err := newSecretResolver(&c.cfg.Secrets, c.cfg.secretsTransport()).resolve(ctx, value)
+	if err != nil {
+		if cached {
+			return entry.value, nil
+		}
+		return "", fmt.Errorf("failed to resolve secret reference: %w", err)
+	}
+
+	c.mu.Lock()
+	c.entries[value] = credentialEntry{value: secret, fetchedAt: c.now()}
+	c.mu.Unlock()
+	return secret, nil
+}
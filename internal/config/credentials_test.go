@@ -0,0 +1,74 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialSecrets_Check(t *testing.T) {
+	c := NewCredentialSecrets(&Config{Secrets: SecretsConfig{
+		CredentialReferences: []string{"vault:secret/data/tenants/{organization_id}/", "aws-sm:whatomate/shared#"},
+	}})
+
+	assert.NoError(t, c.Check("org1", "sk-plain-key"))
+	assert.NoError(t, c.Check("org1", "vault:secret/data/tenants/org1/openai#api_key"))
+	assert.NoError(t, c.Check("org1", "aws-sm:whatomate/shared#openai"))
+	assert.ErrorIs(t, c.Check("org2", "vault:secret/data/tenants/org1/openai#api_key"), ErrCredentialReferenceNotAllowed)
+	assert.ErrorIs(t, c.Check("org1", "vault:secret/data/tenants/org1/../../whatomate#jwt_secret"), ErrCredentialReferenceNotAllowed)
+	assert.ErrorIs(t, c.Check("org1", "vault:secret/data/whatomate#jwt_secret"), ErrCredentialReferenceNotAllowed)
+
+	none := NewCredentialSecrets(&Config{})
+	assert.ErrorIs(t, none.Check("org1", "vault:secret/data/tenants/org1/openai#api_key"), ErrCredentialReferenceNotAllowed)
+}
+
+func TestCredentialSecrets_Resolve(t *testing.T) {
+	secrets := map[string]map[string]string{
+		"secret/data/tenants/org1/openai": {"api_key": "sk-from-vault"},
+	}
+	requests := 0
+	srv := vaultServer(t, secrets, &requests)
+
+	c := NewCredentialSecrets(&Config{Secrets: SecretsConfig{
+		VaultAddress:         srv.URL,
+		VaultToken:           "test-token",
+		CredentialReferences: []string{"vault:secret/data/tenants/{organization_id}/"},
+		CredentialCacheSecs:  60,
+	}})
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+	ref := "vault:secret/data/tenants/org1/openai#api_key"
+
+	value, err := c.Resolve(ctx, "org1", "sk-plain-key")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-plain-key", value)
+
+	value, err = c.Resolve(ctx, "org1", ref)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-from-vault", value)
+	_, _ = c.Resolve(ctx, "org1", ref)
+	assert.Equal(t, 1, requests, "secrets are cached")
+
+	// Rotated secrets are fetched again once the cache expires
+	secrets["secret/data/tenants/org1/openai"]["api_key"] = "sk-rotated"
+	now = now.Add(2 * time.Minute)
+	value, err = c.Resolve(ctx, "org1", ref)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-rotated", value)
+
+	// An unreachable secret keeps its last value
+	delete(secrets, "secret/data/tenants/org1/openai")
+	now = now.Add(2 * time.Minute)
+	value, err = c.Resolve(ctx, "org1", ref)
+	require.NoError(t, err)
+	assert.Equal(t, "sk-rotated", value)
+
+	_, err = c.Resolve(ctx, "org1", "vault:secret/data/tenants/org1/missing#api_key")
+	assert.Error(t, err)
+	_, err = c.Resolve(ctx, "org2", ref)
+	assert.ErrorIs(t, err, ErrCredentialReferenceNotAllowed)
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+)
+
+// jwtSecretEnv is the environment variable that sets jwt.secret
+const jwtSecretEnv = "WHATOMATE_JWT_SECRET"
+
+// GenerateJWTSecret returns a random JWT secret, well over the shortest one accepted
+func GenerateJWTSecret() (string, error) {
+	b := make([]byte, 48)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SetJWTSecret returns a TOML config file with jwt.secret set to secret. Other lines
+// are kept as they are; the [jwt] section is added if the file doesn't have one.
+func SetJWTSecret(content []byte, secret string) []byte {
+	line := "secret = " + strconv.Quote(secret)
+	lines := strings.Split(string(content), "\n")
+
+	section := -1
+	for i, l := range lines {
+		trimmed := strings.TrimSpace(l)
+		if strings.HasPrefix(trimmed, "[") {
+			if section >= 0 {
+				break
+			}
+			if trimmed == "[jwt]" {
+				section = i
+			}
+			continue
+		}
+		if section < 0 {
+			continue
+		}
+		key, _, found := strings.Cut(trimmed, "=")
+		if found && strings.TrimSpace(key) == "secret" {
+			indent := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+			lines[i] = indent + line
+			return []byte(strings.Join(lines, "\n"))
+		}
+	}
+
+	if section < 0 {
+		out := strings.TrimRight(string(content), "\n")
+		if out != "" {
+			out += "\n\n"
+		}
+		return []byte(out + "[jwt]\n" + line + "\n")
+	}
+	lines = append(lines[:section+1], append([]string{line}, lines[section+1:]...)...)
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// JWTSecretFile returns the file a new jwt.secret is written to for a config file.
+// It follows the layers of Load: the environment-specific file when it sets the
+// secret, the config file otherwise. The secret can't be written when an environment
+// variable sets it or it references a secret, and the error says where to change it.
+func JWTSecretFile(configPath string) (string, error) {
+	if os.Getenv(jwtSecretEnv) != "" {
+		return "", fmt.Errorf("jwt.secret is set by %s, set the new secret there", jwtSecretEnv)
+	}
+
+	k := koanf.New(".")
+	if err := k.Load(file.Provider(configPath), toml.Parser()); err != nil {
+		return "", err
+	}
+	path, secret := configPath, k.String("jwt.secret")
+	if envPath := environmentConfigFile(configPath, k); envPath != "" {
+		overlay := koanf.New(".")
+		if err := overlay.Load(file.Provider(envPath), toml.Parser()); err != nil {
+			return "", fmt.Errorf("%s: %w", envPath, err)
+		}
+		if overlay.Exists("jwt.secret") {
+			path, secret = envPath, overlay.String("jwt.secret")
+		}
+	}
+
+	if IsSecretReference(secret) {
+		return "", fmt.Errorf("jwt.secret in %s references %s, store the new secret there", path, secret)
+	}
+	return path, nil
+}
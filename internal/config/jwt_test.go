@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateJWTSecret(t *testing.T) {
+	secret, err := GenerateJWTSecret()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, len(secret), minJWTSecretLength)
+
+	other, err := GenerateJWTSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+}
+
+func TestSetJWTSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "replaces the secret",
+			content: "[app]\nsecret = \"app\"\n\n[jwt]\n  secret = \"old\"  # At least 32 characters\naccess_expiry_mins = 15\n\n[redis]\nhost = \"localhost\"\n",
+			want:    "[app]\nsecret = \"app\"\n\n[jwt]\n  secret = \"new\"\naccess_expiry_mins = 15\n\n[redis]\nhost = \"localhost\"\n",
+		},
+		{
+			name:    "adds the secret to the section",
+			content: "[jwt]\naccess_expiry_mins = 15\n\n[redis]\nsecret = \"redis\"\n",
+			want:    "[jwt]\nsecret = \"new\"\naccess_expiry_mins = 15\n\n[redis]\nsecret = \"redis\"\n",
+		},
+		{
+			name:    "adds the section",
+			content: "[redis]\nhost = \"localhost\"\n",
+			want:    "[redis]\nhost = \"localhost\"\n\n[jwt]\nsecret = \"new\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(SetJWTSecret([]byte(tt.content), "new")))
+		})
+	}
+}
+
+func TestJWTSecretFile(t *testing.T) {
+	t.Setenv("WHATOMATE_APP_ENVIRONMENT", "")
+	t.Setenv("WHATOMATE_JWT_SECRET", "")
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, "config.toml")
+	overlay := filepath.Join(dir, "config.production.toml")
+	write := func(path, content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	write(base, "[app]\nenvironment = \"production\"\n\n[jwt]\nsecret = \"base-secret\"\n")
+	path, err := JWTSecretFile(base)
+	require.NoError(t, err)
+	assert.Equal(t, base, path, "without an environment-specific file")
+
+	write(overlay, "[redis]\nhost = \"redis\"\n")
+	path, err = JWTSecretFile(base)
+	require.NoError(t, err)
+	assert.Equal(t, base, path, "the environment-specific file doesn't set the secret")
+
+	write(overlay, "[jwt]\nsecret = \"production-secret\"\n")
+	path, err = JWTSecretFile(base)
+	require.NoError(t, err)
+	assert.Equal(t, overlay, path, "the environment-specific file sets the secret")
+
+	write(overlay, "[jwt]\nsecret = \"vault:secret/data/whatomate#jwt_secret\"\n")
+	_, err = JWTSecretFile(base)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), overlay)
+	assert.Contains(t, err.Error(), "vault:secret/data/whatomate#jwt_secret")
+
+	t.Setenv("WHATOMATE_JWT_SECRET", "env-secret")
+	_, err = JWTSecretFile(base)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "WHATOMATE_JWT_SECRET")
+}
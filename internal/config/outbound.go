@@ -0,0 +1,138 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Outbound providers, each with its own transport so TLS verification can be
+// skipped for one without affecting the others
+const (
+	OutboundMeta         = "meta"
+	OutboundAI           = "ai"
+	OutboundWebhooks     = "webhooks"
+	OutboundIntegrations = "integrations"
+	OutboundSSO          = "sso"
+	OutboundSecrets      = "secrets"
+	OutboundTelegram     = "telegram"
+	OutboundTwilio       = "twilio"
+	OutboundPayments     = "payments"
+	OutboundCalendar     = "calendar"
+	OutboundShopify      = "shopify"
+	OutboundCRM          = "crm"
+	OutboundHelpdesk     = "helpdesk"
+	OutboundTranslation  = "translation"
+)
+
+// OutboundProviders lists the providers outbound.insecure_skip_verify accepts
+var OutboundProviders = []string{
+	OutboundMeta, OutboundAI, OutboundWebhooks, OutboundIntegrations, OutboundSSO, OutboundSecrets, OutboundTelegram, OutboundTwilio, OutboundPayments, OutboundCalendar, OutboundShopify, OutboundCRM, OutboundHelpdesk, OutboundTranslation,
+}
+
+// Transports returns an HTTP transport for each outbound provider. Providers share
+// a transport, and its connection pool, unless TLS verification is skipped for them.
+func (c *OutboundConfig) Transports() (map[string]*http.Transport, error) {
+	roots, err := c.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+
+	shared := c.newTransport(roots, false)
+	transports := make(map[string]*http.Transport, len(OutboundProviders))
+	for _, provider := range OutboundProviders {
+		if c.skipsVerify(provider) {
+			transports[provider] = c.newTransport(roots, true)
+		} else {
+			transports[provider] = shared
+		}
+	}
+	return transports, nil
+}
+
+// Transport returns an HTTP transport for calls to a single provider
+func (c *OutboundConfig) Transport(provider string) (*http.Transport, error) {
+	roots, err := c.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+	return c.newTransport(roots, c.skipsVerify(provider)), nil
+}
+
+// Transport returns the transport for AI provider calls: base, with its own
+// connection pool sized by the ai section and a limit on connecting
+func (c *AIConfig) Transport(base *http.Transport) *http.Transport {
+	connectTimeout := time.Duration(c.ConnectTimeoutSecs) * time.Second
+	t := base.Clone()
+	t.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	t.TLSHandshakeTimeout = connectTimeout
+	t.MaxIdleConns = c.MaxIdleConns
+	t.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	return t
+}
+
+func (c *OutboundConfig) newTransport(roots *x509.CertPool, skipVerify bool) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = c.proxyFunc()
+	t.TLSClientConfig = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		RootCAs:            roots,
+		InsecureSkipVerify: skipVerify, // Opted into per provider, e.g. for self-signed on-prem services
+	}
+	return t
+}
+
+// proxyFunc returns the proxy for a request: proxy_url and no_proxy when set,
+// otherwise HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+func (c *OutboundConfig) proxyFunc() func(*http.Request) (*url.URL, error) {
+	if c.ProxyURL == "" {
+		return http.ProxyFromEnvironment
+	}
+	proxy := (&httpproxy.Config{
+		HTTPProxy:  c.ProxyURL,
+		HTTPSProxy: c.ProxyURL,
+		NoProxy:    c.NoProxy,
+	}).ProxyFunc()
+	return func(r *http.Request) (*url.URL, error) {
+		return proxy(r.URL)
+	}
+}
+
+// rootCAs returns the system CAs plus those in ca_bundle, or nil to use the system
+// CAs when no bundle is configured
+func (c *OutboundConfig) rootCAs() (*x509.CertPool, error) {
+	if c.CABundle == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(c.CABundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", c.CABundle)
+	}
+	return roots, nil
+}
+
+func (c *OutboundConfig) skipsVerify(provider string) bool {
+	for _, p := range c.InsecureSkipVerify {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
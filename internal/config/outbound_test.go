@@ -0,0 +1,112 @@
+package config
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeServerCA writes the TLS test server's certificate as a PEM bundle
+func writeServerCA(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestOutboundTransports_CABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// Without the bundle, the test server's self-signed certificate is rejected
+	transports, err := (&OutboundConfig{}).Transports()
+	require.NoError(t, err)
+	_, err = (&http.Client{Transport: transports[OutboundIntegrations]}).Get(srv.URL)
+	assert.Error(t, err)
+
+	cfg := &OutboundConfig{CABundle: writeServerCA(t, srv)}
+	transports, err = cfg.Transports()
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: transports[OutboundIntegrations]}).Get(srv.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+}
+
+func TestOutboundTransports_InsecureSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	cfg := &OutboundConfig{InsecureSkipVerify: []string{OutboundIntegrations}}
+	transports, err := cfg.Transports()
+	require.NoError(t, err)
+
+	resp, err := (&http.Client{Transport: transports[OutboundIntegrations]}).Get(srv.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	_, err = (&http.Client{Transport: transports[OutboundAI]}).Get(srv.URL)
+	assert.Error(t, err, "other providers still verify certificates")
+	assert.Same(t, transports[OutboundAI], transports[OutboundMeta], "providers that verify share a transport")
+	assert.NotSame(t, transports[OutboundAI], transports[OutboundIntegrations])
+}
+
+func TestOutboundProxy(t *testing.T) {
+	cfg := &OutboundConfig{ProxyURL: "http://proxy.internal:3128", NoProxy: "rasa.internal,.corp"}
+	proxy := cfg.proxyFunc()
+
+	req := httptest.NewRequest(http.MethodGet, "https://graph.facebook.com/v21.0/me", nil)
+	u, err := proxy(req)
+	require.NoError(t, err)
+	require.NotNil(t, u)
+	assert.Equal(t, "proxy.internal:3128", u.Host)
+
+	for _, target := range []string{"https://rasa.internal/webhooks", "https://bot.corp/api"} {
+		req = httptest.NewRequest(http.MethodGet, target, nil)
+		u, err = proxy(req)
+		require.NoError(t, err)
+		assert.Nil(t, u, "%s bypasses the proxy", target)
+	}
+}
+
+func TestValidate_Outbound(t *testing.T) {
+	dir := t.TempDir()
+	badBundle := filepath.Join(dir, "bad.pem")
+	require.NoError(t, os.WriteFile(badBundle, []byte("not a certificate"), 0o600))
+
+	path := writeConfig(t, dir, "config.toml", testConfig+`
+[outbound]
+proxy_url = "proxy.internal:3128"
+ca_bundle = "`+badBundle+`"
+insecure_skip_verify = ["integrations", "rasa"]
+`)
+
+	_, err := Load(path)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Errors, 3)
+	assert.Contains(t, verr.Errors[0], "outbound.proxy_url")
+	assert.Contains(t, verr.Errors[1], "outbound.ca_bundle: no certificates found")
+	assert.Contains(t, verr.Errors[2], `outbound.insecure_skip_verify: must be one of`)
+}
+
+func TestAITransport(t *testing.T) {
+	transports, err := (&OutboundConfig{}).Transports()
+	require.NoError(t, err)
+
+	ai := &AIConfig{ConnectTimeoutSecs: 5, MaxIdleConns: 50, MaxIdleConnsPerHost: 10}
+	transport := ai.Transport(transports[OutboundAI])
+	assert.NotSame(t, transports[OutboundAI], transport, "AI calls get their own pool")
+	assert.Equal(t, 50, transport.MaxIdleConns)
+	assert.Equal(t, 10, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 5*time.Second, transport.TLSHandshakeTimeout)
+	assert.NotNil(t, transport.Proxy, "the outbound proxy settings are kept")
+	assert.NotEqual(t, 10, transports[OutboundMeta].MaxIdleConnsPerHost, "the shared transport isn't changed")
+}
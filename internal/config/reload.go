@@ -0,0 +1,121 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// reloadableSections are the sections read when they're used, which Reload applies.
+// The others set up connections, listeners, storage and transports at startup.
+var reloadableSections = map[string]bool{
+	"jwt":      true,
+	"whatsapp": true,
+	"ai":       true,
+	"smtp":     true,
+	"billing":  true,
+	"quotas":   true,
+	"health":   true,
+	"security": true,
+}
+
+// Reload loads the configuration again and returns a new configuration with the
+// reloadable sections of it, and the others of c, along with the sections that
+// changed. c isn't modified, so it can be read while it's reloaded. Settings of
+// reloadable sections that are used at startup are kept: whatsapp.webhook_workers,
+// the AI connection pool and the security IP ranges. An invalid configuration
+// isn't applied.
+func (c *Config) Reload(configPath string) (*Config, []string, error) {
+	loaded, err := Load(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	next := c.Clone()
+	loaded.WhatsApp.WebhookWorkers = next.WhatsApp.WebhookWorkers
+	loaded.AI.ConnectTimeoutSecs = next.AI.ConnectTimeoutSecs
+	loaded.AI.MaxIdleConns = next.AI.MaxIdleConns
+	loaded.AI.MaxIdleConnsPerHost = next.AI.MaxIdleConnsPerHost
+	loaded.Security.AllowedIPs = next.Security.AllowedIPs
+	loaded.Security.TrustedProxies = next.Security.TrustedProxies
+
+	var changed []string
+	current, updated := reflect.ValueOf(next).Elem(), reflect.ValueOf(loaded).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		name := current.Type().Field(i).Tag.Get("koanf")
+		if !reloadableSections[name] || reflect.DeepEqual(current.Field(i).Interface(), updated.Field(i).Interface()) {
+			continue
+		}
+		current.Field(i).Set(updated.Field(i))
+		changed = append(changed, name)
+	}
+
+	// Secret references in the reloaded sections are now the loaded configuration's
+	var refs []secretRef
+	if next.secrets != nil {
+		for _, ref := range next.secrets.refs {
+			if !reloadableSections[secretSection(ref.field)] {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	if loaded.secrets != nil {
+		for _, ref := range loaded.secrets.refs {
+			if !reloadableSections[secretSection(ref.field)] {
+				continue
+			}
+			if ref.value = next.stringField(ref.field); ref.value != nil {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	next.secrets = nil
+	if len(refs) > 0 {
+		next.secrets = &secretState{refs: refs}
+	}
+
+	return next, changed, nil
+}
+
+// Clone returns a copy of the configuration that can be changed, e.g. by
+// RefreshSecrets, without affecting c. Its sections are copied; lists in them are
+// shared, and must be replaced rather than changed.
+func (c *Config) Clone() *Config {
+	if c.secrets != nil {
+		c.secrets.mu.Lock()
+		defer c.secrets.mu.Unlock()
+	}
+	next := *c
+	if c.secrets != nil {
+		refs := make([]secretRef, 0, len(c.secrets.refs))
+		for _, ref := range c.secrets.refs {
+			ref.value = next.stringField(ref.field)
+			refs = append(refs, ref)
+		}
+		next.secrets = &secretState{refs: refs}
+	}
+	return &next
+}
+
+// secretSection returns the section of a secret reference's field, e.g. smtp for
+// smtp.password
+func secretSection(field string) string {
+	section, _, _ := strings.Cut(field, ".")
+	return section
+}
+
+// stringField returns the string setting at a section.key path
+func (c *Config) stringField(path string) *string {
+	sectionName, key, _ := strings.Cut(path, ".")
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		if sections.Type().Field(i).Tag.Get("koanf") != sectionName {
+			continue
+		}
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			if section.Type().Field(j).Tag.Get("koanf") == key {
+				return section.Field(j).Addr().Interface().(*string)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.toml", testConfig+"\n[health]\ntimeout_ms = 1000\n\n[whatsapp]\nwebhook_workers = 2\n")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+
+	writeConfig(t, dir, "config.toml", `
+[app]
+environment = "staging"
+
+[database]
+host = "other-db"
+user = "whatomate"
+name = "whatomate"
+
+[redis]
+host = "localhost"
+
+[jwt]
+secret = "test-secret-key-must-be-at-least-32-chars"
+
+[health]
+timeout_ms = 500
+
+[whatsapp]
+webhook_workers = 8
+app_id = "123"
+`)
+	// The current configuration is read while it's reloaded
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			_ = cfg.Health.TimeoutMs + len(cfg.WhatsApp.AppID)
+		}
+	}()
+	next, changed, err := cfg.Reload(path)
+	<-done
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"health", "whatsapp"}, changed)
+	assert.Equal(t, 1000, cfg.Health.TimeoutMs, "the current configuration isn't changed")
+	assert.Equal(t, 500, next.Health.TimeoutMs)
+	assert.Equal(t, "123", next.WhatsApp.AppID)
+	assert.Equal(t, 2, next.WhatsApp.WebhookWorkers, "workers started at startup are kept")
+	assert.Equal(t, "localhost", next.Database.Host, "connections aren't reloaded")
+
+	_, changed, err = next.Reload(path)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	// An invalid configuration isn't applied
+	writeConfig(t, dir, "config.toml", "[jwt]\nsecret = \"short\"\n\n[health]\ntimeout_ms = 100\n")
+	_, _, err = next.Reload(path)
+	assert.Error(t, err)
+}
+
+func TestClone(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := Load(writeConfig(t, dir, "config.toml", testConfig))
+	require.NoError(t, err)
+	cfg.secrets = &secretState{refs: []secretRef{{field: "jwt.secret", ref: "vault:secret/data/whatomate#jwt", value: &cfg.JWT.Secret}}}
+
+	next := cfg.Clone()
+	*next.secrets.refs[0].value = "rotated-secret-at-least-32-characters"
+	assert.Equal(t, "rotated-secret-at-least-32-characters", next.JWT.Secret, "secret references point into the copy")
+	assert.Equal(t, "test-secret-key-must-be-at-least-32-chars", cfg.JWT.Secret)
+}
@@ -0,0 +1,428 @@
+package config
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefixes of configuration values that reference a secret in a secrets backend
+const (
+	secretPrefixVault = "vault:"  // vault:<kv path>#<key>, e.g. vault:secret/data/whatomate#jwt_secret
+	secretPrefixAWS   = "aws-sm:" // aws-sm:<secret id>[#<key>], e.g. aws-sm:whatomate/production#db_password
+	secretPrefixGCP   = "gcp-sm:" // gcp-sm:projects/<project>/secrets/<secret>[/versions/<version>][#<key>]
+)
+
+// Secret backend endpoints, overridden in tests
+var (
+	awsSecretsManagerURL = "https://secretsmanager.%s.amazonaws.com/"
+	gcpSecretManagerURL  = "https://secretmanager.googleapis.com/v1/"
+	gcpMetadataTokenURL  = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// secretRef is a configuration value that references a secret
+type secretRef struct {
+	field string  // e.g. "database.password"
+	ref   string  // The reference, e.g. "vault:secret/data/whatomate#db_password"
+	value *string // The resolved value in the config
+}
+
+// secretState tracks a config's secret references so they can be re-resolved
+type secretState struct {
+	mu   sync.Mutex
+	refs []secretRef
+}
+
+// IsSecretReference reports whether a configuration value references a secret
+func IsSecretReference(value string) bool {
+	return strings.HasPrefix(value, secretPrefixVault) ||
+		strings.HasPrefix(value, secretPrefixAWS) ||
+		strings.HasPrefix(value, secretPrefixGCP)
+}
+
+// resolveSecrets replaces every configuration value that references a secret with the
+// secret's value, and remembers the references for RefreshSecrets
+func resolveSecrets(ctx context.Context, cfg *Config) error {
+	var refs []secretRef
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		sectionName := sections.Type().Field(i).Tag.Get("koanf")
+		// The secrets section configures the backends, so it can't reference them
+		if section.Kind() != reflect.Struct || sectionName == "" || sectionName == "secrets" {
+			continue
+		}
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Field(j)
+			if field.Kind() != reflect.String || !IsSecretReference(field.String()) {
+				continue
+			}
+			refs = append(refs, secretRef{
+				field: sectionName + "." + section.Type().Field(j).Tag.Get("koanf"),
+				ref:   field.String(),
+				value: field.Addr().Interface().(*string),
+			})
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	values, errs := newSecretResolver(&cfg.Secrets, cfg.secretsTransport()).resolveAll(ctx, refs)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	for i, ref := range refs {
+		*ref.value = values[i]
+	}
+	cfg.secrets = &secretState{refs: refs}
+	return nil
+}
+
+// RefreshSecrets re-resolves the configuration values that reference secrets, so
+// rotated secrets are picked up. Values are updated in place and the fields that
+// changed are returned. Secrets that fail to resolve keep their current value.
+func (c *Config) RefreshSecrets(ctx context.Context) ([]string, error) {
+	if c.secrets == nil {
+		return nil, nil
+	}
+	c.secrets.mu.Lock()
+	defer c.secrets.mu.Unlock()
+
+	values, errs := newSecretResolver(&c.Secrets, c.secretsTransport()).resolveAll(ctx, c.secrets.refs)
+	var changed []string
+	for i, ref := range c.secrets.refs {
+		if values[i] != "" && values[i] != *ref.value {
+			*ref.value = values[i]
+			changed = append(changed, ref.field)
+		}
+	}
+	if len(errs) > 0 {
+		return changed, &ValidationError{Errors: errs}
+	}
+	return changed, nil
+}
+
+// HasSecretReferences reports whether any configuration value was resolved from a secret
+func (c *Config) HasSecretReferences() bool {
+	return c.secrets != nil && len(c.secrets.refs) > 0
+}
+
+// secretResolver fetches secrets from the configured backends. Each secret is fetched
+// once per resolver, so several keys of the same secret cost one request.
+type secretResolver struct {
+	cfg    *SecretsConfig
+	client *http.Client
+	cache  map[string]string
+	gcpTok string
+}
+
+func newSecretResolver(cfg *SecretsConfig, transport http.RoundTripper) *secretResolver {
+	return &secretResolver{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		cache:  make(map[string]string),
+	}
+}
+
+// secretsTransport returns the transport for calls to the secrets backends, or nil
+// for the default one if the outbound configuration is invalid, which Validate
+// reports
+func (c *Config) secretsTransport() http.RoundTripper {
+	t, err := c.Outbound.Transport(OutboundSecrets)
+	if err != nil {
+		return nil
+	}
+	return t
+}
+
+// resolveAll resolves each reference, returning the values and an error per failed one
+func (s *secretResolver) resolveAll(ctx context.Context, refs []secretRef) ([]string, []string) {
+	values := make([]string, len(refs))
+	var errs []string
+	for i, ref := range refs {
+		value, err := s.resolve(ctx, ref.ref)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", ref.field, err))
+			continue
+		}
+		values[i] = value
+	}
+	return values, errs
+}
+
+// resolve returns the value of a secret reference
+func (s *secretResolver) resolve(ctx context.Context, ref string) (string, error) {
+	ref, key, _ := strings.Cut(ref, "#")
+
+	raw, ok := s.cache[ref]
+	if !ok {
+		var err error
+		switch {
+		case strings.HasPrefix(ref, secretPrefixVault):
+			if key == "" {
+				return "", errors.New("vault references need a key, e.g. vault:secret/data/whatomate#jwt_secret")
+			}
+			raw, err = s.fetchVault(ctx, strings.TrimPrefix(ref, secretPrefixVault))
+		case strings.HasPrefix(ref, secretPrefixAWS):
+			raw, err = s.fetchAWS(ctx, strings.TrimPrefix(ref, secretPrefixAWS))
+		case strings.HasPrefix(ref, secretPrefixGCP):
+			raw, err = s.fetchGCP(ctx, strings.TrimPrefix(ref, secretPrefixGCP))
+		default:
+			err = fmt.Errorf("unknown secret reference %q", ref)
+		}
+		if err != nil {
+			return "", err
+		}
+		s.cache[ref] = raw
+	}
+
+	if key == "" {
+		return raw, nil
+	}
+	return secretField(raw, key)
+}
+
+// secretField returns a field of a secret stored as a JSON object
+func secretField(raw, key string) (string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, can't read key %q", key)
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no key %q", key)
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// fetchVault reads a Vault KV secret, returning its data as a JSON object. Both KV
+// version 1 and version 2 (paths with /data/) are supported.
+func (s *secretResolver) fetchVault(ctx context.Context, path string) (string, error) {
+	addr := firstNonEmpty(s.cfg.VaultAddress, os.Getenv("VAULT_ADDR"))
+	token := firstNonEmpty(s.cfg.VaultToken, os.Getenv("VAULT_TOKEN"))
+	if addr == "" || token == "" {
+		return "", errors.New("secrets.vault_address and secrets.vault_token are required for vault references")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if s.cfg.VaultNamespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.cfg.VaultNamespace)
+	}
+
+	var resp struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := s.do(req, "vault", &resp); err != nil {
+		return "", err
+	}
+
+	// KV version 2 nests the secret under data.data, next to data.metadata
+	if nested, ok := resp.Data["data"]; ok {
+		if _, ok := resp.Data["metadata"]; ok {
+			return string(nested), nil
+		}
+	}
+	data, err := json.Marshal(resp.Data)
+	return string(data), err
+}
+
+// fetchAWS reads a secret's string value from AWS Secrets Manager
+func (s *secretResolver) fetchAWS(ctx context.Context, secretID string) (string, error) {
+	region := firstNonEmpty(s.cfg.AWSRegion, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"))
+	accessKey := firstNonEmpty(s.cfg.AWSAccessKeyID, os.Getenv("AWS_ACCESS_KEY_ID"))
+	secretKey := firstNonEmpty(s.cfg.AWSSecretAccessKey, os.Getenv("AWS_SECRET_ACCESS_KEY"))
+	sessionToken := firstNonEmpty(s.cfg.AWSSessionToken, os.Getenv("AWS_SESSION_TOKEN"))
+	if region == "" || accessKey == "" || secretKey == "" {
+		return "", errors.New("secrets.aws_region, secrets.aws_access_key_id and secrets.aws_secret_access_key are required for aws-sm references")
+	}
+
+	body, err := json.Marshal(map[string]string{"SecretId": secretID})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf(awsSecretsManagerURL, region), strings.NewReader(string(body)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+	signAWSRequest(req, body, accessKey, secretKey, region, "secretsmanager", time.Now())
+
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := s.do(req, "aws secrets manager", &resp); err != nil {
+		return "", err
+	}
+	return resp.SecretString, nil
+}
+
+// fetchGCP reads a secret version from GCP Secret Manager, the latest version if
+// the reference doesn't name one
+func (s *secretResolver) fetchGCP(ctx context.Context, name string) (string, error) {
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	token, err := s.gcpToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpSecretManagerURL+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := s.do(req, "gcp secret manager", &resp); err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("gcp secret manager: invalid payload: %w", err)
+	}
+	return string(data), nil
+}
+
+// gcpToken returns the configured access token, or gets one for the instance's
+// service account from the metadata server
+func (s *secretResolver) gcpToken(ctx context.Context) (string, error) {
+	if s.cfg.GCPAccessToken != "" {
+		return s.cfg.GCPAccessToken, nil
+	}
+	if s.gcpTok != "" {
+		return s.gcpTok, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := s.do(req, "gcp metadata server", &resp); err != nil {
+		return "", fmt.Errorf("%w (set secrets.gcp_access_token when not running on GCP)", err)
+	}
+	s.gcpTok = resp.AccessToken
+	return s.gcpTok, nil
+}
+
+// do sends a backend request and decodes its JSON response into out
+func (s *secretResolver) do(req *http.Request, backend string, out interface{}) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", backend, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("%s: %w", backend, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d: %s", backend, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", backend, err)
+	}
+	return nil
+}
+
+// signAWSRequest signs a request with AWS Signature Version 4
+func signAWSRequest(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	dateStamp := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := dateStamp + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	signature := hex.EncodeToString(hmacSHA256(awsSigningKey(secretKey, dateStamp, region, service), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// awsSigningKey derives the Signature Version 4 signing key for a day, region and service
+func awsSigningKey(secretKey, dateStamp, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretKey), dateStamp)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
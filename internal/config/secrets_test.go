@@ -0,0 +1,188 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSecretReference(t *testing.T) {
+	assert.True(t, IsSecretReference("vault:secret/data/whatomate#jwt_secret"))
+	assert.True(t, IsSecretReference("aws-sm:whatomate/production"))
+	assert.True(t, IsSecretReference("gcp-sm:projects/p/secrets/s"))
+	assert.False(t, IsSecretReference("plain-password"))
+	assert.False(t, IsSecretReference(""))
+}
+
+func TestSecretField(t *testing.T) {
+	value, err := secretField(`{"password":"s3cret","port":5432}`, "password")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", value)
+
+	value, err = secretField(`{"password":"s3cret","port":5432}`, "port")
+	require.NoError(t, err)
+	assert.Equal(t, "5432", value)
+
+	_, err = secretField(`{"password":"s3cret"}`, "user")
+	assert.Error(t, err)
+	_, err = secretField("not json", "password")
+	assert.Error(t, err)
+}
+
+// vaultServer serves KV version 2 secrets, counting requests
+func vaultServer(t *testing.T, secrets map[string]map[string]string, requests *int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		data, ok := secrets[strings.TrimPrefix(r.URL.Path, "/v1/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"data": data, "metadata": map[string]int{"version": 1}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLoad_ResolvesSecrets(t *testing.T) {
+	secrets := map[string]map[string]string{
+		"secret/data/whatomate": {
+			"jwt_secret":  "jwt-secret-from-vault-at-least-32-chars",
+			"db_password": "db-password-from-vault",
+		},
+	}
+	requests := 0
+	srv := vaultServer(t, secrets, &requests)
+
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.toml", testConfig+`
+[secrets]
+vault_address = "`+srv.URL+`"
+vault_token = "test-token"
+`)
+	t.Setenv("WHATOMATE_JWT_SECRET", "vault:secret/data/whatomate#jwt_secret")
+	t.Setenv("WHATOMATE_DATABASE_PASSWORD", "vault:secret/data/whatomate#db_password")
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "jwt-secret-from-vault-at-least-32-chars", cfg.JWT.Secret)
+	assert.Equal(t, "db-password-from-vault", cfg.Database.Password)
+	assert.Equal(t, 1, requests, "a secret is fetched once for all its keys")
+	assert.True(t, cfg.HasSecretReferences())
+
+	// Rotated secrets are picked up on refresh
+	secrets["secret/data/whatomate"]["db_password"] = "rotated-password"
+	changed, err := cfg.RefreshSecrets(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"database.password"}, changed)
+	assert.Equal(t, "rotated-password", cfg.Database.Password)
+
+	// Secrets that fail to resolve keep their value
+	delete(secrets, "secret/data/whatomate")
+	changed, err = cfg.RefreshSecrets(context.Background())
+	assert.Error(t, err)
+	assert.Empty(t, changed)
+	assert.Equal(t, "rotated-password", cfg.Database.Password)
+}
+
+func TestLoad_ReportsSecretErrors(t *testing.T) {
+	requests := 0
+	srv := vaultServer(t, map[string]map[string]string{}, &requests)
+
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.toml", testConfig+`
+[secrets]
+vault_address = "`+srv.URL+`"
+vault_token = "test-token"
+`)
+	t.Setenv("WHATOMATE_DATABASE_PASSWORD", "vault:secret/data/missing#db_password")
+	t.Setenv("WHATOMATE_REDIS_PASSWORD", "vault:secret/data/whatomate")
+
+	_, err := Load(path)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Errors, 2)
+	assert.Contains(t, verr.Errors[0], "database.password: vault: status 404")
+	assert.Contains(t, verr.Errors[1], "redis.password: vault references need a key")
+}
+
+func TestResolveGCPSecret(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gcp-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v1/projects/p/secrets/jwt/versions/latest:access" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"payload":{"data":%q}}`, base64.StdEncoding.EncodeToString([]byte("from-gcp")))
+	}))
+	defer srv.Close()
+
+	orig := gcpSecretManagerURL
+	gcpSecretManagerURL = srv.URL + "/v1/"
+	defer func() { gcpSecretManagerURL = orig }()
+
+	s := newSecretResolver(&SecretsConfig{GCPAccessToken: "gcp-token"}, nil)
+	value, err := s.resolve(context.Background(), "gcp-sm:projects/p/secrets/jwt")
+	require.NoError(t, err)
+	assert.Equal(t, "from-gcp", value)
+}
+
+func TestResolveAWSSecret(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"SecretString":"{\"db_password\":\"from-aws\"}"}`))
+	}))
+	defer srv.Close()
+
+	orig := awsSecretsManagerURL
+	awsSecretsManagerURL = srv.URL + "/?region=%s"
+	defer func() { awsSecretsManagerURL = orig }()
+
+	s := newSecretResolver(&SecretsConfig{AWSRegion: "us-east-1", AWSAccessKeyID: "AKID", AWSSecretAccessKey: "secret"}, nil)
+	value, err := s.resolve(context.Background(), "aws-sm:whatomate/production#db_password")
+	require.NoError(t, err)
+	assert.Equal(t, "from-aws", value)
+}
+
+func TestAWSSigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation
+	key := awsSigningKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	assert.Equal(t, "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d", hex.EncodeToString(key))
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", nil)
+	req.Header = http.Header{}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	signAWSRequest(req, []byte("{}"), "AKID", "secret", "us-east-1", "secretsmanager",
+		time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	assert.Equal(t, "20250102T030405Z", req.Header.Get("X-Amz-Date"))
+	auth := req.Header.Get("Authorization")
+	assert.True(t, strings.HasPrefix(auth,
+		"AWS4-HMAC-SHA256 Credential=AKID/20250102/us-east-1/secretsmanager/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature="), auth)
+}
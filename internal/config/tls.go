@@ -0,0 +1,133 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client certificate modes for server.tls_client_auth
+const (
+	ClientAuthRequire  = "require"  // Reject connections without a certificate signed by tls_client_ca
+	ClientAuthOptional = "optional" // Verify certificates that are presented, allow connections without one
+)
+
+// TLSEnabled reports whether the server terminates TLS itself
+func (c *ServerConfig) TLSEnabled() bool {
+	return c.TLSCert != "" || c.TLSKey != ""
+}
+
+// TLSConfig returns the server's TLS configuration. The certificate is reloaded
+// when its files change, so rotated certificates are served without a restart;
+// onReload, if not nil, is called after each reload attempt.
+func (c *ServerConfig) TLSConfig(onReload func(err error)) (*tls.Config, error) {
+	certs, err := NewCertReloader(c.TLSCert, c.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	certs.OnReload = onReload
+
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	if c.TLSClientCA != "" {
+		pem, err := os.ReadFile(c.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", c.TLSClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		if c.TLSClientAuth == ClientAuthOptional {
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return cfg, nil
+}
+
+// certCheckInterval is how often the certificate files are checked for changes
+const certCheckInterval = 10 * time.Second
+
+// CertReloader serves a certificate from files, reloading it when they change
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	// OnReload, if not nil, is called after each reload attempt. A failed reload
+	// keeps the previous certificate.
+	OnReload func(err error)
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certMod   time.Time
+	keyMod    time.Time
+	checkedAt time.Time
+}
+
+// NewCertReloader loads a certificate and its key
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(certMod, keyMod); err != nil {
+		return nil, err
+	}
+	r.checkedAt = time.Now()
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= certCheckInterval {
+		r.checkedAt = time.Now()
+		r.reloadIfChanged()
+	}
+	return r.cert, nil
+}
+
+// reloadIfChanged reloads the certificate if either file's modification time changed
+func (r *CertReloader) reloadIfChanged() {
+	certMod, keyMod, err := r.modTimes()
+	if err == nil && certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod) {
+		return
+	}
+	if err == nil {
+		err = r.load(certMod, keyMod)
+	}
+	if r.OnReload != nil {
+		r.OnReload(err)
+	}
+}
+
+func (r *CertReloader) load(certMod, keyMod time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	r.cert, r.certMod, r.keyMod = &cert, certMod, keyMod
+	return nil
+}
+
+func (r *CertReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to read TLS key: %w", err)
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
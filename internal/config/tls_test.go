@@ -0,0 +1,131 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate and its key, returning their paths
+func writeCert(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certPath, keyPath
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeCert(t, dir, "first")
+
+	r, err := NewCertReloader(certPath, keyPath)
+	require.NoError(t, err)
+	reloads := 0
+	r.OnReload = func(err error) {
+		assert.NoError(t, err)
+		reloads++
+	}
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, cert))
+
+	// Rotate the certificate; it's picked up at the next check
+	writeCert(t, dir, "second")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certPath, later, later))
+	require.NoError(t, os.Chtimes(keyPath, later, later))
+
+	cert, _ = r.GetCertificate(nil)
+	assert.Equal(t, "first", commonName(t, cert), "files are checked at most every certCheckInterval")
+
+	r.checkedAt = time.Time{}
+	cert, _ = r.GetCertificate(nil)
+	assert.Equal(t, "second", commonName(t, cert))
+	assert.Equal(t, 1, reloads)
+
+	// A broken certificate keeps the previous one
+	require.NoError(t, os.WriteFile(certPath, []byte("not a certificate"), 0o600))
+	evenLater := later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certPath, evenLater, evenLater))
+	r.OnReload = func(err error) { assert.Error(t, err) }
+	r.checkedAt = time.Time{}
+	cert, _ = r.GetCertificate(nil)
+	assert.Equal(t, "second", commonName(t, cert))
+}
+
+func TestServerTLSConfig_ClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeCert(t, dir, "server")
+	caPath, _ := writeCert(t, t.TempDir(), "clients")
+
+	cfg := &ServerConfig{TLSCert: certPath, TLSKey: keyPath}
+	tlsConfig, err := cfg.TLSConfig(nil)
+	require.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, tlsConfig.ClientAuth)
+
+	cfg.TLSClientCA = caPath
+	cfg.TLSClientAuth = ClientAuthRequire
+	tlsConfig, err = cfg.TLSConfig(nil)
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+	assert.NotNil(t, tlsConfig.ClientCAs)
+
+	cfg.TLSClientAuth = ClientAuthOptional
+	tlsConfig, err = cfg.TLSConfig(nil)
+	require.NoError(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+}
+
+func TestValidate_ServerTLS(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "config.toml", testConfig+`
+[server]
+tls_cert = "/etc/whatomate/tls.crt"
+tls_client_auth = "sometimes"
+`)
+
+	_, err := Load(path)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Errors, 2)
+	assert.Contains(t, verr.Errors[0], "server.tls_key: is required")
+	assert.Contains(t, verr.Errors[1], "server.tls_client_auth: must be one of require, optional")
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// minJWTSecretLength is the shortest JWT secret accepted, 256 bits for HS256
+const minJWTSecretLength = 32
+
+// masterKeySize is the size of encryption master keys, for AES-256
+const masterKeySize = 32
+
+// ValidationError lists every invalid configuration field
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Errors, "; ")
+}
+
+// Validate checks the configuration and returns a *ValidationError listing every
+// invalid field, so they can all be fixed at once
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.oneOf("app.environment", c.App.Environment, "development", "test", "staging", "production")
+
+	v.port("server.port", c.Server.Port)
+	v.positive("server.read_timeout", c.Server.ReadTimeout)
+	v.positive("server.write_timeout", c.Server.WriteTimeout)
+	if c.Server.BasePath != "" && (!strings.HasPrefix(c.Server.BasePath, "/") || strings.HasSuffix(c.Server.BasePath, "/")) {
+		v.add("server.base_path", "must start with / and not end with /, e.g. /whatomate")
+	}
+	if c.Server.TLSEnabled() {
+		v.required("server.tls_cert", c.Server.TLSCert)
+		v.required("server.tls_key", c.Server.TLSKey)
+	}
+	if c.Server.TLSClientCA != "" && !c.Server.TLSEnabled() {
+		v.add("server.tls_client_ca", "requires server.tls_cert and server.tls_key")
+	}
+	v.oneOf("server.tls_client_auth", c.Server.TLSClientAuth, ClientAuthRequire, ClientAuthOptional)
+
+	v.host("database.host", c.Database.Host)
+	v.port("database.port", c.Database.Port)
+	v.required("database.user", c.Database.User)
+	v.required("database.name", c.Database.Name)
+	v.oneOf("database.ssl_mode", c.Database.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+	v.positive("database.max_open_conns", c.Database.MaxOpenConns)
+	if c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		v.add("database.max_idle_conns", "must not exceed database.max_open_conns")
+	}
+	if c.Database.ConnMaxIdleTime < 0 {
+		v.add("database.conn_max_idle_time", "must not be negative")
+	}
+	if c.Database.ReplicaDSN != "" {
+		v.positive("database.replica_max_open_conns", c.Database.ReplicaMaxOpenConns)
+		if c.Database.ReplicaMaxIdleConns > c.Database.ReplicaMaxOpenConns {
+			v.add("database.replica_max_idle_conns", "must not exceed database.replica_max_open_conns")
+		}
+	}
+
+	v.host("redis.host", c.Redis.Host)
+	v.port("redis.port", c.Redis.Port)
+	if c.Redis.DB < 0 {
+		v.add("redis.db", "must not be negative")
+	}
+
+	if len(c.JWT.Secret) < minJWTSecretLength {
+		v.add("jwt.secret", fmt.Sprintf("must be at least %d characters", minJWTSecretLength))
+	}
+	v.positive("jwt.access_expiry_mins", c.JWT.AccessExpiryMins)
+	v.positive("jwt.refresh_expiry_days", c.JWT.RefreshExpiryDays)
+
+	v.url("whatsapp.base_url", c.WhatsApp.BaseURL)
+
+	v.oneOf("storage.type", c.Storage.Type, "local", "s3")
+	if c.Storage.Type == "s3" {
+		v.required("storage.s3_bucket", c.Storage.S3Bucket)
+		v.required("storage.s3_region", c.Storage.S3Region)
+	}
+	if c.Archive.Type != "" {
+		v.oneOf("archive.type", c.Archive.Type, "local", "s3")
+	}
+	if c.Archive.Type == "s3" {
+		v.required("archive.s3_bucket", c.Archive.S3Bucket)
+		v.required("archive.s3_region", c.Archive.S3Region)
+	}
+
+	if c.SMTP.Host != "" {
+		v.port("smtp.port", c.SMTP.Port)
+		v.required("smtp.from", c.SMTP.From)
+	}
+
+	v.positive("ai.max_attempts", c.AI.MaxAttempts)
+	v.positive("ai.retry_backoff_ms", c.AI.RetryBackoffMs)
+	if c.AI.RetryMaxBackoffMs < c.AI.RetryBackoffMs {
+		v.add("ai.retry_max_backoff_ms", "must not be less than ai.retry_backoff_ms")
+	}
+	v.positive("ai.breaker_threshold", c.AI.BreakerThreshold)
+	v.positive("ai.breaker_cooldown_secs", c.AI.BreakerCooldownSecs)
+	v.positive("ai.connect_timeout_secs", c.AI.ConnectTimeoutSecs)
+	v.positive("ai.max_idle_conns", c.AI.MaxIdleConns)
+	v.positive("ai.max_idle_conns_per_host", c.AI.MaxIdleConnsPerHost)
+	if c.AI.MaxIdleConnsPerHost > c.AI.MaxIdleConns {
+		v.add("ai.max_idle_conns_per_host", "must not exceed ai.max_idle_conns")
+	}
+	v.positive("ai.timeouts.openai", c.AI.Timeouts.OpenAI)
+	v.positive("ai.timeouts.anthropic", c.AI.Timeouts.Anthropic)
+	v.positive("ai.timeouts.google", c.AI.Timeouts.Google)
+	v.positive("ai.timeouts.ollama", c.AI.Timeouts.Ollama)
+	v.positive("ai.timeouts.webhook", c.AI.Timeouts.Webhook)
+
+	if c.Billing.SoftLimitPercent < 1 || c.Billing.SoftLimitPercent > 100 {
+		v.add("billing.soft_limit_percent", "must be between 1 and 100")
+	}
+	if c.Billing.ProviderURL != "" {
+		v.url("billing.provider_url", c.Billing.ProviderURL)
+	}
+	if c.Billing.TrialDays < 0 {
+		v.add("billing.trial_days", "must not be negative")
+	}
+	for _, days := range c.Billing.TrialReminderDays {
+		if days <= 0 {
+			v.add("billing.trial_reminder_days", "must be positive numbers of days")
+			break
+		}
+	}
+
+	if c.Quotas.DailyMessages < 0 {
+		v.add("quotas.daily_messages", "must not be negative")
+	}
+	if c.Quotas.MonthlyMessages < 0 {
+		v.add("quotas.monthly_messages", "must not be negative")
+	}
+	if c.Quotas.DailyAICalls < 0 {
+		v.add("quotas.daily_ai_calls", "must not be negative")
+	}
+	if c.Quotas.MonthlyAICalls < 0 {
+		v.add("quotas.monthly_ai_calls", "must not be negative")
+	}
+
+	if c.Secrets.RefreshIntervalMins < 0 {
+		v.add("secrets.refresh_interval_mins", "must not be negative")
+	}
+	if c.Secrets.VaultAddress != "" {
+		v.url("secrets.vault_address", c.Secrets.VaultAddress)
+	}
+	if c.Secrets.CredentialCacheSecs < 0 {
+		v.add("secrets.credential_cache_secs", "must not be negative")
+	}
+	for _, prefix := range c.Secrets.CredentialReferences {
+		if !IsSecretReference(prefix) || strings.HasSuffix(prefix, ":") {
+			v.add("secrets.credential_references", fmt.Sprintf("must be secret reference prefixes such as vault:secret/data/tenants/, got %q", prefix))
+			break
+		}
+	}
+
+	if c.Outbound.ProxyURL != "" {
+		v.url("outbound.proxy_url", c.Outbound.ProxyURL)
+	}
+	if _, err := c.Outbound.rootCAs(); err != nil {
+		v.add("outbound.ca_bundle", err.Error())
+	}
+	for _, provider := range c.Outbound.InsecureSkipVerify {
+		v.oneOf("outbound.insecure_skip_verify", provider, OutboundProviders...)
+	}
+
+	if c.Tracing.Enabled {
+		v.url("tracing.endpoint", c.Tracing.Endpoint)
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			v.add("tracing.sample_ratio", "must be between 0 and 1")
+		}
+	}
+
+	if c.Health.TimeoutMs < 0 {
+		v.add("health.timeout_ms", "must not be negative")
+	}
+
+	if c.Encryption.Key != "" {
+		if _, err := decodeMasterKey(c.Encryption.Key); err != nil {
+			v.add("encryption.key", err.Error())
+		}
+	} else if len(c.Encryption.previousKeys()) > 0 {
+		v.add("encryption.key", "is required with encryption.previous_keys")
+	}
+	for _, encoded := range c.Encryption.previousKeys() {
+		if _, err := decodeMasterKey(encoded); err != nil {
+			v.add("encryption.previous_keys", err.Error())
+			break
+		}
+	}
+
+	if _, err := ParseIPRanges(c.Security.AllowedIPs); err != nil {
+		v.add("security.allowed_ips", err.Error())
+	}
+	if _, err := ParseIPRanges(c.Security.TrustedProxies); err != nil {
+		v.add("security.trusted_proxies", err.Error())
+	}
+	if c.Security.LoginMaxAttempts < -1 {
+		v.add("security.login_max_attempts", "must be positive, or -1 to disable lockouts")
+	}
+	if c.Security.LoginMaxAttemptsPerIP < -1 {
+		v.add("security.login_max_attempts_per_ip", "must be positive, or -1 to disable lockouts")
+	}
+	v.positive("security.login_lockout_mins", c.Security.LoginLockoutMins)
+
+	if len(v.errors) > 0 {
+		return &ValidationError{Errors: v.errors}
+	}
+	return nil
+}
+
+// validator collects configuration errors as "field: problem"
+type validator struct {
+	errors []string
+}
+
+func (v *validator) add(field, problem string) {
+	v.errors = append(v.errors, field+": "+problem)
+}
+
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "is required")
+	}
+}
+
+func (v *validator) positive(field string, value int) {
+	if value <= 0 {
+		v.add(field, "must be positive")
+	}
+}
+
+func (v *validator) port(field string, value int) {
+	if value < 1 || value > 65535 {
+		v.add(field, "must be between 1 and 65535")
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.add(field, fmt.Sprintf("must be one of %s, got %q", strings.Join(allowed, ", "), value))
+}
+
+// host checks for a bare host name or address, catching URLs and host:port values.
+// Absolute paths are accepted as Unix socket directories.
+func (v *validator) host(field, value string) {
+	switch {
+	case strings.TrimSpace(value) == "":
+		v.add(field, "is required")
+	case strings.HasPrefix(value, "/"):
+	case strings.Contains(value, "://"), strings.ContainsAny(value, "/ @"):
+		v.add(field, fmt.Sprintf("must be a host name or address, got %q", value))
+	case strings.Count(value, ":") == 1:
+		v.add(field, fmt.Sprintf("must not include a port, got %q", value))
+	}
+}
+
+func (v *validator) url(field, value string) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(field, fmt.Sprintf("must be an http or https URL, got %q", value))
+	}
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOrganizationNotFound is returned by FindOrganization when no organization has
+	// the ID or slug
+	ErrOrganizationNotFound = errors.New("organization not found")
+	// ErrEmailTaken is returned by CreateAdmin when a user already has the email
+	ErrEmailTaken = errors.New("email already registered")
+	// ErrSlugTaken is returned by CreateOrganization when an organization already has
+	// the slug
+	ErrSlugTaken = errors.New("slug already taken")
+)
+
+// NewAdmin is an admin user created by CreateAdmin
+type NewAdmin struct {
+	Email      string
+	Password   string
+	FullName   string
+	SuperAdmin bool
+}
+
+// FindOrganization finds an organization by ID or slug
+func FindOrganization(db *gorm.DB, ref string) (*models.Organization, error) {
+	query := db.Where("slug = ?", ref)
+	if id, err := uuid.Parse(ref); err == nil {
+		query = db.Where("id = ?", id)
+	}
+	var org models.Organization
+	if err := query.First(&org).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, fmt.Errorf("failed to find organization: %w", err)
+	}
+	return &org, nil
+}
+
+// CreateOrganization creates an organization with its system roles, default chatbot
+// settings and first admin. The slug is derived from the name when empty.
+// Organizations created this way don't start a trial.
+func CreateOrganization(db *gorm.DB, name, slug string, admin NewAdmin) (*models.Organization, *models.User, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, nil, errors.New("organization name is required")
+	}
+	if slug == "" {
+		slug = OrganizationSlug(name)
+	}
+	var count int64
+	if err := db.Model(&models.Organization{}).Where("slug = ?", slug).Count(&count).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to check slug: %w", err)
+	}
+	if count > 0 {
+		return nil, nil, ErrSlugTaken
+	}
+
+	if err := SeedPermissionsAndRoles(db); err != nil {
+		return nil, nil, fmt.Errorf("failed to seed permissions: %w", err)
+	}
+
+	org := models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      name,
+		Slug:      slug,
+		Settings:  models.JSONB{},
+	}
+	var user *models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return fmt.Errorf("failed to create organization: %w", err)
+		}
+		if err := SeedSystemRolesForOrg(tx, org.ID); err != nil {
+			return fmt.Errorf("failed to seed system roles: %w", err)
+		}
+		chatbotSettings := models.ChatbotSettings{
+			OrganizationID:     org.ID,
+			SessionTimeoutMins: 30,
+		}
+		if err := tx.Create(&chatbotSettings).Error; err != nil {
+			return fmt.Errorf("failed to create chatbot settings: %w", err)
+		}
+
+		var err error
+		user, err = CreateAdmin(tx, org.ID, admin)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &org, user, nil
+}
+
+// CreateAdmin creates a user with the admin role of an organization
+func CreateAdmin(db *gorm.DB, orgID uuid.UUID, admin NewAdmin) (*models.User, error) {
+	email := strings.ToLower(strings.TrimSpace(admin.Email))
+	if email == "" {
+		return nil, errors.New("admin email is required")
+	}
+	if len(admin.Password) < 6 {
+		return nil, errors.New("admin password must be at least 6 characters")
+	}
+
+	var count int64
+	if err := db.Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check email: %w", err)
+	}
+	if count > 0 {
+		return nil, ErrEmailTaken
+	}
+
+	var adminRole models.CustomRole
+	if err := db.Where("organization_id = ? AND name = ? AND is_system = ?", orgID, "admin", true).First(&adminRole).Error; err != nil {
+		return nil, fmt.Errorf("failed to find admin role: %w", err)
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(admin.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	fullName := admin.FullName
+	if fullName == "" {
+		fullName = "Admin"
+	}
+	user := models.User{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: orgID,
+		Email:          email,
+		PasswordHash:   string(passwordHash),
+		FullName:       fullName,
+		RoleID:         &adminRole.ID,
+		IsActive:       true,
+		IsAvailable:    true,
+		IsSuperAdmin:   admin.SuperAdmin,
+		Settings:       models.JSONB{},
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create admin user: %w", err)
+	}
+	return &user, nil
+}
+
+// OrganizationSlug derives an organization slug from its name, with a random suffix
+// so organizations can share names
+func OrganizationSlug(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		switch {
+		case (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9'):
+			b.WriteRune(c)
+		case c == ' ' || c == '-':
+			b.WriteRune('-')
+		}
+	}
+	return b.String() + "-" + uuid.New().String()[:8]
+}
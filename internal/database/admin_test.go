@@ -0,0 +1,13 @@
+package database
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrganizationSlug(t *testing.T) {
+	assert.Regexp(t, regexp.MustCompile(`^acme-corp-2-[0-9a-f]{8}$`), OrganizationSlug("Acme Corp 2!"))
+	assert.NotEqual(t, OrganizationSlug("Acme"), OrganizationSlug("Acme"), "organizations can share names")
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"gorm.io/gorm"
+)
+
+// EncryptedColumns are the columns of fields tagged serializer:encrypted
+var EncryptedColumns = []EncryptedColumn{
+	{Table: "whatsapp_accounts", Column: "access_token"},
+	{Table: "whatsapp_accounts", Column: "app_secret"},
+	{Table: "whatsapp_accounts", Column: "api_token"},
+	{Table: "chatbot_settings", Column: "ai_api_key"},
+	{Table: "chatbot_settings", Column: "ai_embedding_api_key"},
+	{Table: "chatbot_settings", Column: "ai_moderation_api_key"},
+	{Table: "chatbot_settings", Column: "transcription_api_key"},
+	{Table: "users", Column: "totp_secret"},
+}
+
+// EncryptedSettingsColumns are the JSON columns that keep encrypted credentials:
+// the ones of models.OrgSettingsSecrets in organization settings, and the API keys
+// of AI fallback providers and experiments
+var EncryptedSettingsColumns = []EncryptedColumn{
+	{Table: "organizations", Column: "settings"},
+	{Table: "chatbot_settings", Column: "ai_fallback_providers"},
+	{Table: "chatbot_settings", Column: "ai_experiments"},
+}
+
+// EncryptedColumn is a column whose values are encrypted at rest
+type EncryptedColumn struct {
+	Table  string
+	Column string
+}
+
+// RotateEncryptionKeys re-encrypts every stored value that is in plaintext or
+// encrypted with a previous master key, with the current master key, including the
+// credentials in EncryptedSettingsColumns. Each column is rewritten in a
+// transaction. It returns how many values were rewritten by "table.column"; with
+// dryRun they are counted but not rewritten.
+func RotateEncryptionKeys(db *gorm.DB, dryRun bool) (map[string]int, error) {
+	if !models.EncryptionEnabled() {
+		return nil, errors.New("no encryption key is configured")
+	}
+
+	rotated := map[string]int{}
+	for _, col := range EncryptedColumns {
+		name := col.Table + "." + col.Column
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var rows []struct {
+				ID    uuid.UUID
+				Value string
+			}
+			if err := tx.Raw(fmt.Sprintf(`SELECT id, %[1]s AS value FROM %[2]s WHERE %[1]s <> '' FOR UPDATE`, col.Column, col.Table)).
+				Scan(&rows).Error; err != nil {
+				return err
+			}
+
+			for _, row := range rows {
+				if !models.NeedsReencryption(row.Value) {
+					continue
+				}
+				plaintext, err := models.DecryptSecret(row.Value)
+				if err != nil {
+					return fmt.Errorf("row %s: %w", row.ID, err)
+				}
+				encrypted, err := models.EncryptSecret(plaintext)
+				if err != nil {
+					return fmt.Errorf("row %s: %w", row.ID, err)
+				}
+				if !dryRun {
+					if err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE id = ?`, col.Table, col.Column), encrypted, row.ID).Error; err != nil {
+						return fmt.Errorf("row %s: %w", row.ID, err)
+					}
+				}
+				rotated[name]++
+			}
+			return nil
+		})
+		if err != nil {
+			return rotated, fmt.Errorf("failed to rotate %s: %w", name, err)
+		}
+	}
+
+	for _, col := range EncryptedSettingsColumns {
+		name := col.Table + "." + col.Column
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var rows []struct {
+				ID    uuid.UUID
+				Value []byte
+			}
+			if err := tx.Raw(fmt.Sprintf(`SELECT id, %[1]s AS value FROM %[2]s WHERE %[1]s IS NOT NULL FOR UPDATE`, col.Column, col.Table)).
+				Scan(&rows).Error; err != nil {
+				return err
+			}
+
+			for _, row := range rows {
+				value, count, err := rotateSettingsColumn(col, row.Value)
+				if err != nil {
+					return fmt.Errorf("row %s: %w", row.ID, err)
+				}
+				if count == 0 {
+					continue
+				}
+				if !dryRun {
+					if err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ?::jsonb WHERE id = ?`, col.Table, col.Column), string(value), row.ID).Error; err != nil {
+						return fmt.Errorf("row %s: %w", row.ID, err)
+					}
+				}
+				rotated[name] += count
+			}
+			return nil
+		})
+		if err != nil {
+			return rotated, fmt.Errorf("failed to rotate %s: %w", name, err)
+		}
+	}
+	return rotated, nil
+}
+
+// rotateSettingsColumn re-encrypts the credentials in a value of one of the
+// EncryptedSettingsColumns, returning the rewritten value and how many credentials
+// were re-encrypted
+func rotateSettingsColumn(col EncryptedColumn, value []byte) ([]byte, int, error) {
+	if col.Table == "organizations" {
+		var settings map[string]interface{}
+		if err := json.Unmarshal(value, &settings); err != nil {
+			return nil, 0, err
+		}
+		count, err := rotateSettingSecrets(settings)
+		if err != nil || count == 0 {
+			return value, count, err
+		}
+		value, err = json.Marshal(settings)
+		return value, count, err
+	}
+
+	var items []interface{}
+	if err := json.Unmarshal(value, &items); err != nil {
+		return nil, 0, err
+	}
+	count, err := rotateAIProviderKeys(items)
+	if err != nil || count == 0 {
+		return value, count, err
+	}
+	value, err = json.Marshal(items)
+	return value, count, err
+}
+
+// rotateAIProviderKeys re-encrypts the API keys of AI fallback providers or
+// experiments that need it
+func rotateAIProviderKeys(items []interface{}) (int, error) {
+	count := 0
+	for i, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		value, changed, err := reencryptSecret(m[models.AIProviderSecretKey])
+		if err != nil {
+			return count, fmt.Errorf("item %d: %w", i, err)
+		}
+		if changed {
+			m[models.AIProviderSecretKey] = value
+			count++
+		}
+	}
+	return count, nil
+}
+
+// rotateSettingSecrets re-encrypts the credentials in organization settings that
+// need it
+func rotateSettingSecrets(settings map[string]interface{}) (int, error) {
+	count := 0
+	for _, secret := range models.OrgSettingsSecrets {
+		section, ok := settings[secret.Section].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		value, changed, err := reencryptSecret(section[secret.Key])
+		if err != nil {
+			return count, fmt.Errorf("%s.%s: %w", secret.Section, secret.Key, err)
+		}
+		if changed {
+			section[secret.Key] = value
+			count++
+		}
+	}
+	return count, nil
+}
+
+// reencryptSecret re-encrypts a stored credential with the current master key if
+// it's in plaintext or encrypted with a previous one
+func reencryptSecret(stored interface{}) (string, bool, error) {
+	value, _ := stored.(string)
+	if value == "" || !models.NeedsReencryption(value) {
+		return value, false, nil
+	}
+	plaintext, err := models.DecryptSecret(value)
+	if err != nil {
+		return "", false, err
+	}
+	encrypted, err := models.EncryptSecret(plaintext)
+	if err != nil {
+		return "", false, err
+	}
+	return encrypted, true, nil
+}
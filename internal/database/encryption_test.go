@@ -0,0 +1,87 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm/schema"
+)
+
+func TestEncryptedColumns(t *testing.T) {
+	// Every field stored encrypted is re-encrypted by RotateEncryptionKeys
+	listed := map[EncryptedColumn]bool{}
+	for _, col := range EncryptedColumns {
+		listed[col] = true
+	}
+	cache := &sync.Map{}
+	for _, m := range GetMigrationModels() {
+		s, err := schema.Parse(m.Model, cache, schema.NamingStrategy{})
+		require.NoError(t, err, m.Name)
+		for _, field := range s.Fields {
+			if field.TagSettings["SERIALIZER"] == "encrypted" {
+				assert.True(t, listed[EncryptedColumn{Table: s.Table, Column: field.DBName}], "%s.%s isn't in EncryptedColumns", s.Table, field.DBName)
+			}
+		}
+	}
+}
+
+func TestRotateSettingsColumn(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, models.EncryptionKeySize)
+	newKey := bytes.Repeat([]byte{2}, models.EncryptionKeySize)
+	t.Cleanup(func() { _ = models.SetEncryptionKeys(nil) })
+
+	require.NoError(t, models.SetEncryptionKeys(oldKey))
+	oldSecret, err := models.EncryptSecret("sk_live_123")
+	require.NoError(t, err)
+	require.NoError(t, models.SetEncryptionKeys(newKey, oldKey))
+	current, err := models.EncryptSecret("AC-token")
+	require.NoError(t, err)
+
+	value, err := json.Marshal(map[string]interface{}{
+		"payments":     map[string]interface{}{"provider": "stripe", "secret_key": oldSecret, "webhook_secret": "whsec_plain"},
+		"sms_fallback": map[string]interface{}{"auth_token": current},
+		"timezone":     "UTC",
+	})
+	require.NoError(t, err)
+
+	col := EncryptedSettingsColumns[0]
+	rotated, count, err := rotateSettingsColumn(col, value)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count, "values under a previous key and in plaintext are rewritten")
+
+	var settings map[string]interface{}
+	require.NoError(t, json.Unmarshal(rotated, &settings))
+	payments := settings["payments"].(map[string]interface{})
+	assert.Equal(t, "stripe", payments["provider"])
+	assert.False(t, models.NeedsReencryption(payments["secret_key"].(string)))
+	assert.Equal(t, "sk_live_123", models.SettingSecret(payments, "secret_key"))
+	assert.Equal(t, "whsec_plain", models.SettingSecret(payments, "webhook_secret"))
+	assert.Equal(t, current, settings["sms_fallback"].(map[string]interface{})["auth_token"], "values under the current key are kept")
+	assert.Equal(t, "UTC", settings["timezone"])
+
+	// Nothing to rotate leaves the value as it is
+	again, count, err := rotateSettingsColumn(col, rotated)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	assert.Equal(t, rotated, again)
+
+	// AI fallback providers and experiments keep a key per item
+	value, err = json.Marshal([]interface{}{
+		map[string]interface{}{"provider": "anthropic", "api_key": oldSecret},
+		map[string]interface{}{"provider": "ollama"},
+	})
+	require.NoError(t, err)
+	rotated, count, err = rotateSettingsColumn(EncryptedColumn{Table: "chatbot_settings", Column: "ai_fallback_providers"}, value)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	var items []map[string]interface{}
+	require.NoError(t, json.Unmarshal(rotated, &items))
+	assert.Equal(t, "sk_live_123", models.SettingSecret(items[0], "api_key"))
+	assert.False(t, models.NeedsReencryption(items[0]["api_key"].(string)))
+	assert.NotContains(t, items[1], "api_key")
+}
@@ -0,0 +1,1512 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// adminAuditLogIndex serves listing the audit log newest first, by admin
+const adminAuditLogIndex = `CREATE INDEX IF NOT EXISTS idx_admin_audit_logs_user_created ON admin_audit_logs(user_id, created_at DESC)`
+
+// sequenceEnrollmentDueIndex serves finding the enrollments whose next step is due
+const sequenceEnrollmentDueIndex = `CREATE INDEX IF NOT EXISTS idx_sequence_enrollments_due ON sequence_enrollments(status, next_run_at)`
+
+// webhookDeliveryIndex serves listing a webhook's deliveries newest first
+const webhookDeliveryIndex = `CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_created ON webhook_deliveries(webhook_id, created_at DESC)`
+
+// auditLogIndex serves listing an organization's audit log newest first
+const auditLogIndex = `CREATE INDEX IF NOT EXISTS idx_audit_logs_org_created ON audit_logs(organization_id, created_at DESC)`
+
+// deadLetterIndex serves listing an organization's dead letters newest first
+const deadLetterIndex = `CREATE INDEX IF NOT EXISTS idx_dead_letters_org_status_created ON dead_letters(organization_id, status, created_at DESC)`
+
+// messageSearchIndex serves full-text searches of message content. The simple
+// configuration doesn't stem words, so it works for messages in any language.
+const messageSearchIndex = `CREATE INDEX IF NOT EXISTS idx_messages_content_search ON messages USING GIN (to_tsvector('simple', content))`
+
+// backfillUsageMeters meters the billable conversations and AI tokens recorded before
+// usage was metered. Seats can't be known for past months and start with the next sample.
+var backfillUsageMeters = []string{
+	`INSERT INTO usage_meters (id, organization_id, period, unit, quantity, created_at, updated_at)
+	SELECT gen_random_uuid(), organization_id, period,
+		CASE WHEN pricing_model = 'PMP' THEN 'message.' ELSE 'conversation.' END || COALESCE(NULLIF(category, ''), 'unknown'),
+		COUNT(*), NOW(), NOW()
+	FROM conversation_charges
+	WHERE billable AND deleted_at IS NULL
+	GROUP BY 1, 2, 3, 4
+	ON CONFLICT DO NOTHING`,
+	`INSERT INTO usage_meters (id, organization_id, period, unit, quantity, created_at, updated_at)
+	SELECT gen_random_uuid(), organization_id, period, 'ai_prompt_tokens', SUM(prompt_tokens), NOW(), NOW()
+	FROM ai_usage WHERE deleted_at IS NULL
+	GROUP BY organization_id, period
+	ON CONFLICT DO NOTHING`,
+	`INSERT INTO usage_meters (id, organization_id, period, unit, quantity, created_at, updated_at)
+	SELECT gen_random_uuid(), organization_id, period, 'ai_completion_tokens', SUM(completion_tokens), NOW(), NOW()
+	FROM ai_usage WHERE deleted_at IS NULL
+	GROUP BY organization_id, period
+	ON CONFLICT DO NOTHING`,
+}
+
+// backfillPlanChanges records the current plan of organizations that came off a trial
+// before plan changes were recorded. Other organizations are billed from their creation.
+const backfillPlanChanges = `INSERT INTO plan_changes (id, organization_id, plan_id, started_at, created_at, updated_at)
+	SELECT gen_random_uuid(), o.id,
+		COALESCE(
+			(SELECT id FROM plans WHERE name = o.plan AND o.plan <> '' AND deleted_at IS NULL LIMIT 1),
+			(SELECT id FROM plans WHERE is_default AND deleted_at IS NULL LIMIT 1)),
+		NOW(), NOW(), NOW()
+	FROM organizations o
+	WHERE o.trial_started_at IS NOT NULL AND o.trial_ends_at IS NULL AND o.deleted_at IS NULL`
+
+// backfillContactTimezones infers the timezone of contacts created before contacts
+// had one, from their phone numbers
+func backfillContactTimezones(tx *gorm.DB) error {
+	var contacts []models.Contact
+	return tx.Model(&models.Contact{}).Unscoped().Select("id", "phone_number").
+		Where("timezone IS NULL OR timezone = ''").
+		FindInBatches(&contacts, 1000, func(batch *gorm.DB, _ int) error {
+			byTimezone := map[string][]uuid.UUID{}
+			for _, c := range contacts {
+				if tz := models.TimezoneForPhoneNumber(c.PhoneNumber); tz != "" {
+					byTimezone[tz] = append(byTimezone[tz], c.ID)
+				}
+			}
+			for tz, ids := range byTimezone {
+				if err := tx.Model(&models.Contact{}).Unscoped().Where("id IN ?", ids).Update("timezone", tz).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// auditLogAppendOnly makes the database reject updates and deletes of audit log entries
+var auditLogAppendOnly = []string{
+	`CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit_logs is append-only';
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS audit_logs_append_only ON audit_logs`,
+	`CREATE TRIGGER audit_logs_append_only BEFORE UPDATE OR DELETE ON audit_logs
+	FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only()`,
+}
+
+// addAuditLogPermission adds the audit log permission to databases whose permissions
+// were seeded before it existed. Fresh databases get it when permissions are seeded.
+const addAuditLogPermission = `INSERT INTO permissions (id, resource, action, description, created_at, updated_at)
+	SELECT gen_random_uuid(), ?, ?, 'View the audit log', NOW(), NOW()
+	WHERE EXISTS (SELECT 1 FROM permissions)
+	ON CONFLICT DO NOTHING`
+
+// addPermission adds a permission to databases whose permissions were seeded before
+// it existed. Fresh databases get it when permissions are seeded.
+const addPermission = `INSERT INTO permissions (id, resource, action, description, created_at, updated_at)
+	SELECT gen_random_uuid(), ?, ?, ?, NOW(), NOW()
+	WHERE EXISTS (SELECT 1 FROM permissions)
+	ON CONFLICT DO NOTHING`
+
+// revokeSystemRolePermission removes a permission from the system role with the given name
+const revokeSystemRolePermission = `DELETE FROM role_permissions rp
+	USING custom_roles r, permissions p
+	WHERE rp.custom_role_id = r.id AND rp.permission_id = p.id
+	AND r.is_system = true AND r.name = ? AND p.resource = ? AND p.action = ?`
+
+// grantSystemRolePermission adds a permission to the system role with the given name
+const grantSystemRolePermission = `INSERT INTO role_permissions (custom_role_id, permission_id)
+	SELECT r.id, p.id FROM custom_roles r, permissions p
+	WHERE r.is_system = true AND r.name = ? AND p.resource = ? AND p.action = ?
+	ON CONFLICT DO NOTHING`
+
+// migrationLockID is the advisory lock held while applying or rolling back a
+// migration, so concurrent runs apply each migration once
+const migrationLockID = 7301455862
+
+// errDryRun rolls back a dry run's transaction
+var errDryRun = errors.New("dry run")
+
+// Migration is a versioned schema change. Migrations run in version order, each in
+// its own transaction.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // nil if the migration can't be rolled back
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// TableName returns the table name for SchemaMigration
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationState is a migration and when it was applied, nil if pending
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// PlannedMigration is a pending migration and the statements it would run
+type PlannedMigration struct {
+	Migration
+	Statements []string
+}
+
+// Migrations returns all migrations in version order.
+//
+// Schema changes need a new migration at the end of this list; applied migrations
+// must never be edited. Migrations should be safe to run against a schema that
+// already has their changes (e.g. AutoMigrate, IF NOT EXISTS), since the baseline
+// creates new databases from the current models.
+func Migrations() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "baseline",
+			Up:      migrateBaseline,
+		},
+		{
+			Version: 2,
+			Name:    "admin_audit_logs",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&models.AdminAuditLog{}); err != nil {
+					return err
+				}
+				return tx.Exec(adminAuditLogIndex).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.AdminAuditLog{})
+			},
+		},
+		{
+			Version: 3,
+			Name:    "chatbot_ai_quick_replies",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.ChatbotSettings{}, "ai_quick_replies")
+			},
+		},
+		{
+			Version: 4,
+			Name:    "chatbot_languages",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Contact{}, &models.ChatbotSession{}, &models.ChatbotFlow{}, &models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"language_detection_enabled", "default_language", "supported_languages", "message_translations"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				for _, model := range []interface{}{&models.ChatbotFlow{}, &models.ChatbotSession{}, &models.Contact{}} {
+					if err := m.DropColumn(model, "language"); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 5,
+			Name:    "contact_notes",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ContactNote{}, &models.ContactNoteRevision{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.ContactNoteRevision{}, &models.ContactNote{})
+			},
+		},
+		{
+			Version: 6,
+			Name:    "whatsapp_account_presence",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.WhatsAppAccount{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"typing_indicator", "presence_privacy"} {
+					if err := m.DropColumn(&models.WhatsAppAccount{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 7,
+			Name:    "message_edits",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Message{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"edited_at", "revoked_at"} {
+					if err := m.DropColumn(&models.Message{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 8,
+			Name:    "whatsapp_groups",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.WhatsAppGroup{}, &models.WhatsAppGroupParticipant{}, &models.GroupMessage{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.GroupMessage{}, &models.WhatsAppGroupParticipant{}, &models.WhatsAppGroup{})
+			},
+		},
+		{
+			Version: 9,
+			Name:    "tracking_links",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.TrackingLink{}, &models.TrackingLinkAttribution{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.TrackingLinkAttribution{}, &models.TrackingLink{})
+			},
+		},
+		{
+			Version: 10,
+			Name:    "ad_referrals",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.AdReferral{}, &models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropColumn(&models.ChatbotSettings{}, "ads_flow_id"); err != nil {
+					return err
+				}
+				return tx.Migrator().DropTable(&models.AdReferral{})
+			},
+		},
+		{
+			Version: 11,
+			Name:    "whatsapp_account_failover",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.WhatsAppAccount{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"failover_account", "failover_templates", "failover_active_at", "failover_reason"} {
+					if err := m.DropColumn(&models.WhatsAppAccount{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 12,
+			Name:    "number_health",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.WhatsAppAccount{}, &models.NumberHealthEvent{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"quality_rating", "messaging_limit_tier", "health_checked_at"} {
+					if err := m.DropColumn(&models.WhatsAppAccount{}, column); err != nil {
+						return err
+					}
+				}
+				return m.DropTable(&models.NumberHealthEvent{})
+			},
+		},
+		{
+			Version: 13,
+			Name:    "conversation_charges",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ConversationCharge{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.ConversationCharge{})
+			},
+		},
+		{
+			Version: 14,
+			Name:    "catalog_product_sync",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Catalog{}, &models.CatalogProduct{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"last_synced_at", "sync_error"} {
+					if err := m.DropColumn(&models.Catalog{}, column); err != nil {
+						return err
+					}
+				}
+				return m.DropColumn(&models.CatalogProduct{}, "availability")
+			},
+		},
+		{
+			Version: 15,
+			Name:    "checkouts",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Checkout{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.Checkout{})
+			},
+		},
+		{
+			Version: 16,
+			Name:    "contact_ai_override",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Contact{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.Contact{}, "ai_disabled")
+			},
+		},
+		{
+			Version: 17,
+			Name:    "chatbot_ai_base_url",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.ChatbotSettings{}, "ai_base_url")
+			},
+		},
+		{
+			Version: 18,
+			Name:    "chatbot_ai_webhook",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"ai_webhook_headers", "ai_webhook_body", "ai_webhook_response_path"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 19,
+			Name:    "chatbot_ai_fallback_providers",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{}, &models.ChatbotSessionMessage{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				if err := m.DropColumn(&models.ChatbotSessionMessage{}, "ai_provider"); err != nil {
+					return err
+				}
+				return m.DropColumn(&models.ChatbotSettings{}, "ai_fallback_providers")
+			},
+		},
+		{
+			Version: 20,
+			Name:    "chatbot_ai_history_ttl",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.ChatbotSettings{}, "ai_history_ttl_minutes")
+			},
+		},
+		{
+			Version: 21,
+			Name:    "chatbot_ai_personas",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"ai_personas", "ai_persona_id"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 22,
+			Name:    "ai_usage",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.AIUsage{}, &models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"ai_monthly_token_limit", "ai_quota_message"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				return m.DropTable(&models.AIUsage{})
+			},
+		},
+		{
+			Version: 23,
+			Name:    "chatbot_ai_tools",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.ChatbotSettings{}, "ai_tools")
+			},
+		},
+		{
+			Version: 24,
+			Name:    "knowledge_base",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.KnowledgeDocument{}, &models.KnowledgeChunk{}, &models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"ai_embedding_provider", "ai_embedding_model", "ai_embedding_base_url", "ai_embedding_api_key", "ai_knowledge_top_k"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				return m.DropTable(&models.KnowledgeChunk{}, &models.KnowledgeDocument{})
+			},
+		},
+		{
+			Version: 25,
+			Name:    "ai_moderation",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.AIModerationLog{}, &models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"ai_moderation_enabled", "ai_moderation_blocklist", "ai_moderation_provider", "ai_moderation_api_key", "ai_moderation_message"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				return m.DropTable(&models.AIModerationLog{})
+			},
+		},
+		{
+			Version: 26,
+			Name:    "ai_experiments",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{}, &models.ChatbotSession{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				if err := m.DropColumn(&models.ChatbotSession{}, "ai_variant"); err != nil {
+					return err
+				}
+				return m.DropColumn(&models.ChatbotSettings{}, "ai_experiments")
+			},
+		},
+		{
+			Version: 27,
+			Name:    "ai_response_cache",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.ChatbotSettings{}, "ai_cache_ttl_minutes")
+			},
+		},
+		{
+			Version: 28,
+			Name:    "session_handoff",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{}, &models.ChatbotSession{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				if err := m.DropColumn(&models.ChatbotSession{}, "mode"); err != nil {
+					return err
+				}
+				for _, column := range []string{"handoff_on_ai_intent", "handoff_after_fallbacks"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 29,
+			Name:    "queue_outside_hours",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.ChatbotSettings{}, "queue_outside_hours")
+			},
+		},
+		{
+			Version: 30,
+			Name:    "session_closed_message",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.ChatbotSettings{}, "session_closed_message")
+			},
+		},
+		{
+			Version: 31,
+			Name:    "sentiment",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{}, &models.ChatbotSession{}, &models.ChatbotSessionMessage{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"sentiment_enabled", "sentiment_provider", "sentiment_threshold", "sentiment_window", "sentiment_action"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				for _, model := range []interface{}{&models.ChatbotSessionMessage{}, &models.ChatbotSession{}} {
+					if err := m.DropColumn(model, "sentiment"); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 32,
+			Name:    "transcription",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"transcription_enabled", "transcription_provider", "transcription_url", "transcription_api_key", "transcription_model"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 33,
+			Name:    "message_location",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Message{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"latitude", "longitude"} {
+					if err := m.DropColumn(&models.Message{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 34,
+			Name:    "orders",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Order{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.Order{})
+			},
+		},
+		{
+			Version: 35,
+			Name:    "sequences",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&models.Sequence{}, &models.SequenceStep{}, &models.SequenceEnrollment{}); err != nil {
+					return err
+				}
+				return tx.Exec(sequenceEnrollmentDueIndex).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.SequenceEnrollment{}, &models.SequenceStep{}, &models.Sequence{})
+			},
+		},
+		{
+			Version: 36,
+			Name:    "scheduled_message_templates",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ScheduledMessage{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"message_type", "template_id", "template_params", "timezone"} {
+					if err := m.DropColumn(&models.ScheduledMessage{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 37,
+			Name:    "contact_opt_in",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Contact{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"opt_in_status", "opt_in_updated_at"} {
+					if err := m.DropColumn(&models.Contact{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 38,
+			Name:    "segments",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Segment{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.Segment{})
+			},
+		},
+		{
+			Version: 39,
+			Name:    "contact_imports",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ContactImport{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.ContactImport{})
+			},
+		},
+		{
+			Version: 40,
+			Name:    "contact_consent_events",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ContactConsentEvent{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.ContactConsentEvent{})
+			},
+		},
+		{
+			Version: 41,
+			Name:    "message_delivery_status",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Message{}, &models.BulkMessageRecipient{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"error_code", "delivered_at", "read_at"} {
+					if err := m.DropColumn(&models.Message{}, column); err != nil {
+						return err
+					}
+				}
+				return m.DropColumn(&models.BulkMessageRecipient{}, "error_code")
+			},
+		},
+		{
+			Version: 42,
+			Name:    "webhook_deliveries",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&models.WebhookDelivery{}); err != nil {
+					return err
+				}
+				return tx.Exec(webhookDeliveryIndex).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.WebhookDelivery{})
+			},
+		},
+		{
+			Version: 43,
+			Name:    "api_key_scopes",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&models.APIKey{}); err != nil {
+					return err
+				}
+				// Keys issued before scopes keep the full access they had
+				return tx.Model(&models.APIKey{}).
+					Where("scopes IS NULL OR scopes = '[]'::jsonb").
+					Update("scopes", models.StringArray{string(models.APIKeyScopeAdmin)}).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"scopes", "rate_limit", "rotated_at", "revoked_at"} {
+					if err := m.DropColumn(&models.APIKey{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 44,
+			Name:    "system_role_permissions",
+			Up: func(tx *gorm.DB) error {
+				// Agents only see conversations assigned to them and chatbot settings are
+				// admin only. Viewer roles are created when defaults are seeded.
+				if err := tx.Exec(revokeSystemRolePermission, "agent", models.ResourceContacts, models.ActionRead).Error; err != nil {
+					return err
+				}
+				return tx.Exec(revokeSystemRolePermission, "manager", models.ResourceSettingsChatbot, models.ActionWrite).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Exec(grantSystemRolePermission, "agent", models.ResourceContacts, models.ActionRead).Error; err != nil {
+					return err
+				}
+				return tx.Exec(grantSystemRolePermission, "manager", models.ResourceSettingsChatbot, models.ActionWrite).Error
+			},
+		},
+		{
+			Version: 45,
+			Name:    "audit_logs",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&models.AuditLog{}); err != nil {
+					return err
+				}
+				if err := tx.Exec(auditLogIndex).Error; err != nil {
+					return err
+				}
+				for _, stmt := range auditLogAppendOnly {
+					if err := tx.Exec(stmt).Error; err != nil {
+						return err
+					}
+				}
+				if err := tx.Exec(addAuditLogPermission, models.ResourceAuditLogs, models.ActionRead).Error; err != nil {
+					return err
+				}
+				return tx.Exec(grantSystemRolePermission, "admin", models.ResourceAuditLogs, models.ActionRead).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropTable(&models.AuditLog{}); err != nil {
+					return err
+				}
+				if err := tx.Exec(`DROP FUNCTION IF EXISTS audit_logs_append_only()`).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec(`DELETE FROM role_permissions WHERE permission_id IN (SELECT id FROM permissions WHERE resource = ?)`, models.ResourceAuditLogs).Error; err != nil {
+					return err
+				}
+				return tx.Unscoped().Where("resource = ?", models.ResourceAuditLogs).Delete(&models.Permission{}).Error
+			},
+		},
+		{
+			Version: 46,
+			Name:    "sso_oidc_providers",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.SSOProvider{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"issuer", "tenant_id", "groups_claim", "role_mapping"} {
+					if err := m.DropColumn(&models.SSOProvider{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 47,
+			Name:    "two_factor_auth",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.User{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"two_factor_enabled", "totp_secret", "totp_last_step", "two_factor_backup_codes"} {
+					if err := m.DropColumn(&models.User{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 48,
+			Name:    "invitations",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Invitation{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.Invitation{})
+			},
+		},
+		{
+			Version: 49,
+			Name:    "account_send_rate",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.WhatsAppAccount{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.WhatsAppAccount{}, "messages_per_second")
+			},
+		},
+		{
+			Version: 50,
+			Name:    "dead_letters",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&models.DeadLetter{}); err != nil {
+					return err
+				}
+				if err := tx.Exec(deadLetterIndex).Error; err != nil {
+					return err
+				}
+				for _, p := range models.DefaultPermissions() {
+					if p.Resource != models.ResourceDeadLetters {
+						continue
+					}
+					if err := tx.Exec(addPermission, p.Resource, p.Action, p.Description).Error; err != nil {
+						return err
+					}
+					if err := tx.Exec(grantSystemRolePermission, "admin", p.Resource, p.Action).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropTable(&models.DeadLetter{}); err != nil {
+					return err
+				}
+				if err := tx.Exec(`DELETE FROM role_permissions WHERE permission_id IN (SELECT id FROM permissions WHERE resource = ?)`, models.ResourceDeadLetters).Error; err != nil {
+					return err
+				}
+				return tx.Unscoped().Where("resource = ?", models.ResourceDeadLetters).Delete(&models.Permission{}).Error
+			},
+		},
+		{
+			Version: 51,
+			Name:    "analytics_daily",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.AnalyticsDaily{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.AnalyticsDaily{})
+			},
+		},
+		{
+			Version: 52,
+			Name:    "usage_meters",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&models.UsageMeter{}); err != nil {
+					return err
+				}
+				for _, stmt := range backfillUsageMeters {
+					if err := tx.Exec(stmt).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.UsageMeter{})
+			},
+		},
+		{
+			Version: 53,
+			Name:    "data_subject_permissions",
+			Up: func(tx *gorm.DB) error {
+				for _, p := range models.DefaultPermissions() {
+					if p.Resource != models.ResourceDataSubjects {
+						continue
+					}
+					if err := tx.Exec(addPermission, p.Resource, p.Action, p.Description).Error; err != nil {
+						return err
+					}
+					if err := tx.Exec(grantSystemRolePermission, "admin", p.Resource, p.Action).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Exec(`DELETE FROM role_permissions WHERE permission_id IN (SELECT id FROM permissions WHERE resource = ?)`, models.ResourceDataSubjects).Error; err != nil {
+					return err
+				}
+				return tx.Unscoped().Where("resource = ?", models.ResourceDataSubjects).Delete(&models.Permission{}).Error
+			},
+		},
+		{
+			Version: 54,
+			Name:    "account_app_secret",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.WhatsAppAccount{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.WhatsAppAccount{}, "app_secret")
+			},
+		},
+		{
+			Version: 55,
+			Name:    "canned_response_favorites_and_uses",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.CannedResponse{}, &models.CannedResponseFavorite{}, &models.CannedResponseUse{})
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropTable(&models.CannedResponseUse{}, &models.CannedResponseFavorite{}); err != nil {
+					return err
+				}
+				return tx.Migrator().DropColumn(&models.CannedResponse{}, "last_used_at")
+			},
+		},
+		{
+			Version: 56,
+			Name:    "session_notes",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.SessionNote{}, &models.SessionNoteMention{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.SessionNoteMention{}, &models.SessionNote{})
+			},
+		},
+		{
+			Version: 57,
+			Name:    "skill_based_routing",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.TeamMember{}, &models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropColumn(&models.TeamMember{}, "skills"); err != nil {
+					return err
+				}
+				return tx.Migrator().DropColumn(&models.ChatbotSettings{}, "handoff_team_id")
+			},
+		},
+		{
+			Version: 58,
+			Name:    "sla_policies",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.SLAPolicy{}, &models.AgentTransfer{})
+			},
+			Down: func(tx *gorm.DB) error {
+				for _, column := range []string{"priority", "sla_policy_id", "sla_status"} {
+					if err := tx.Migrator().DropColumn(&models.AgentTransfer{}, column); err != nil {
+						return err
+					}
+				}
+				return tx.Migrator().DropTable(&models.SLAPolicy{})
+			},
+		},
+		{
+			Version: 59,
+			Name:    "account_channel",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.WhatsAppAccount{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.WhatsAppAccount{}, "channel")
+			},
+		},
+		{
+			Version: 60,
+			Name:    "message_channel",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Message{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.Message{}, "channel")
+			},
+		},
+		{
+			Version: 61,
+			Name:    "payment_links",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.PaymentLink{}, &models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropColumn(&models.ChatbotSettings{}, "ai_payment_links"); err != nil {
+					return err
+				}
+				return tx.Migrator().DropTable(&models.PaymentLink{})
+			},
+		},
+		{
+			Version: 62,
+			Name:    "appointment_calendar_event",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Appointment{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.Appointment{}, "calendar_event_id")
+			},
+		},
+		{
+			Version: 63,
+			Name:    "shopify_orders",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.SequenceEnrollment{}, &models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropColumn(&models.ChatbotSettings{}, "ai_order_lookup"); err != nil {
+					return err
+				}
+				return tx.Migrator().DropColumn(&models.SequenceEnrollment{}, "variables")
+			},
+		},
+		{
+			Version: 64,
+			Name:    "crm_sync",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.CRMContact{}, &models.ChatbotSession{})
+			},
+			Down: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropColumn(&models.ChatbotSession{}, "crm_synced_at"); err != nil {
+					return err
+				}
+				return tx.Migrator().DropTable(&models.CRMContact{})
+			},
+		},
+		{
+			Version: 65,
+			Name:    "helpdesk_tickets",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.HelpdeskTicket{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.HelpdeskTicket{})
+			},
+		},
+		{
+			Version: 66,
+			Name:    "csat_surveys",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.CSATResponse{}, &models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"csat_enabled", "csat_bot_sessions", "csat_question", "csat_follow_up", "csat_thank_you"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				return m.DropTable(&models.CSATResponse{})
+			},
+		},
+		{
+			Version: 67,
+			Name:    "campaign_variants",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.CampaignVariant{}, &models.BulkMessageCampaign{}, &models.BulkMessageRecipient{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"auto_promote", "test_percent", "test_duration_hours", "winner_metric", "test_ends_at", "winner_variant_id"} {
+					if err := m.DropColumn(&models.BulkMessageCampaign{}, column); err != nil {
+						return err
+					}
+				}
+				for _, column := range []string{"replied_at", "variant_id"} {
+					if err := m.DropColumn(&models.BulkMessageRecipient{}, column); err != nil {
+						return err
+					}
+				}
+				return m.DropTable(&models.CampaignVariant{})
+			},
+		},
+		{
+			Version: 68,
+			Name:    "contact_abuse",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Contact{}, &models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"blocked_at", "blocked_until", "block_reason", "bot_paused_until"} {
+					if err := m.DropColumn(&models.Contact{}, column); err != nil {
+						return err
+					}
+				}
+				for _, column := range []string{"abuse_enabled", "abuse_max_messages", "abuse_window_secs", "abuse_blocklist", "abuse_action", "abuse_cooldown_mins"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 69,
+			Name:    "message_search",
+			Up: func(tx *gorm.DB) error {
+				return tx.Exec(messageSearchIndex).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Exec(`DROP INDEX IF EXISTS idx_messages_content_search`).Error
+			},
+		},
+		{
+			Version: 70,
+			Name:    "message_archives",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.MessageArchive{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.MessageArchive{})
+			},
+		},
+		{
+			Version: 71,
+			Name:    "bulk_send_batches",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.BulkMessageRecipient{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.BulkMessageRecipient{}, "batch")
+			},
+		},
+		{
+			Version: 72,
+			Name:    "whatsapp_on_premise_api",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.WhatsAppAccount{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"api_type", "api_url", "api_token", "api_auth_header"} {
+					if err := m.DropColumn(&models.WhatsAppAccount{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 73,
+			Name:    "message_hooks",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.MessageHook{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.MessageHook{})
+			},
+		},
+		{
+			Version: 74,
+			Name:    "ai_streaming",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"ai_streaming", "ai_stream_split", "ai_stream_interval_ms"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 75,
+			Name:    "fair_use_quotas",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.Organization{}, &models.UsageCounter{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"quota_daily_messages", "quota_monthly_messages", "quota_daily_ai_calls", "quota_monthly_ai_calls"} {
+					if err := m.DropColumn(&models.Organization{}, column); err != nil {
+						return err
+					}
+				}
+				for _, column := range []string{"quota_warned_at", "quota_reached_at"} {
+					if err := m.DropColumn(&models.UsageCounter{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 76,
+			Name:    "ai_history_summaries",
+			Up: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&models.ChatbotSettings{}, &models.ChatbotSession{})
+			},
+			Down: func(tx *gorm.DB) error {
+				m := tx.Migrator()
+				for _, column := range []string{"ai_summarize_history", "ai_history_token_budget"} {
+					if err := m.DropColumn(&models.ChatbotSettings{}, column); err != nil {
+						return err
+					}
+				}
+				for _, column := range []string{"history_summary", "summarized_until"} {
+					if err := m.DropColumn(&models.ChatbotSession{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 77,
+			Name:    "encrypted_totp_secrets",
+			Up: func(tx *gorm.DB) error {
+				// Encrypted secrets don't fit in the previous varchar(64)
+				return tx.Migrator().AlterColumn(&models.User{}, "totp_secret")
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Exec(`ALTER TABLE users ALTER COLUMN totp_secret TYPE varchar(64)`).Error
+			},
+		},
+		{
+			Version: 78,
+			Name:    "plan_changes",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&models.PlanChange{}); err != nil {
+					return err
+				}
+				// Organizations that came off a trial start billing now, since when isn't known
+				return tx.Exec(backfillPlanChanges).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&models.PlanChange{})
+			},
+		},
+		{
+			Version: 79,
+			Name:    "contact_timezones",
+			Up: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&models.Contact{}); err != nil {
+					return err
+				}
+				return backfillContactTimezones(tx)
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&models.Contact{}, "timezone")
+			},
+		},
+	}
+}
+
+// migrateBaseline creates the schema from the models and the indexes GORM tags don't
+// cover. On databases created before versioned migrations, it brings the existing
+// schema up to date.
+func migrateBaseline(tx *gorm.DB) error {
+	for _, m := range GetMigrationModels() {
+		if err := tx.AutoMigrate(m.Model); err != nil {
+			return fmt.Errorf("failed to migrate %s: %w", m.Name, err)
+		}
+	}
+	return CreateIndexes(tx)
+}
+
+// MigrationStatus returns every migration and when it was applied
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := Migrations()
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i] = MigrationState{Migration: m}
+		if record, ok := applied[m.Version]; ok {
+			appliedAt := record.AppliedAt
+			states[i].AppliedAt = &appliedAt
+		}
+	}
+	return states, nil
+}
+
+// PendingMigrations returns the migrations that haven't been applied, in order
+func PendingMigrations(db *gorm.DB) ([]Migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range Migrations() {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateUp applies the pending migrations in order, calling progress before each,
+// and returns the migrations applied
+func MigrateUp(db *gorm.DB, progress func(m Migration)) ([]Migration, error) {
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range pending {
+		if progress != nil {
+			progress(m)
+		}
+		ran, err := applyMigration(db, m)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		if ran {
+			applied = append(applied, m)
+		}
+	}
+	return applied, nil
+}
+
+// applyMigration runs a migration and records it. It reports false if another run
+// applied the migration first.
+func applyMigration(db *gorm.DB, m Migration) (bool, error) {
+	ran := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&SchemaMigration{}).Where("version = ?", m.Version).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		if err := m.Up(tx); err != nil {
+			return err
+		}
+		ran = true
+		return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+	})
+	return ran, err
+}
+
+// MigrateDown rolls back the most recently applied migrations, up to steps of them,
+// and returns the migrations rolled back
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := Migrations()
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version > migrations[j].Version })
+
+	var rolledBack []Migration
+	for _, m := range migrations {
+		if len(rolledBack) == steps {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return rolledBack, fmt.Errorf("migration %d (%s) can't be rolled back", m.Version, m.Name)
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+				return err
+			}
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Where("version = ?", m.Version).Delete(&SchemaMigration{}).Error
+		})
+		if err != nil {
+			return rolledBack, fmt.Errorf("rolling back migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		rolledBack = append(rolledBack, m)
+	}
+	return rolledBack, nil
+}
+
+// PlanMigrations runs the pending migrations in a transaction that is rolled back,
+// returning the schema and data changing statements each would run
+func PlanMigrations(db *gorm.DB) ([]PlannedMigration, error) {
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []PlannedMigration
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, m := range pending {
+			recorder := &statementRecorder{}
+			if err := m.Up(tx.Session(&gorm.Session{Logger: recorder})); err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+			}
+			plan = append(plan, PlannedMigration{Migration: m, Statements: recorder.statements})
+		}
+		return errDryRun
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// appliedMigrations returns the applied migrations by version, creating the
+// migrations table if needed
+func appliedMigrations(db *gorm.DB) (map[int]SchemaMigration, error) {
+	silentDB := db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	if err := silentDB.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var records []SchemaMigration
+	if err := silentDB.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	applied := make(map[int]SchemaMigration, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// statementRecorder is a GORM logger that records statements that change the schema
+// or data, skipping the queries GORM makes to inspect the schema
+type statementRecorder struct {
+	statements []string
+}
+
+func (r *statementRecorder) LogMode(logger.LogLevel) logger.Interface { return r }
+
+func (r *statementRecorder) Info(context.Context, string, ...interface{}) {}
+
+func (r *statementRecorder) Warn(context.Context, string, ...interface{}) {}
+
+func (r *statementRecorder) Error(context.Context, string, ...interface{}) {}
+
+func (r *statementRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), err error) {
+	if err != nil {
+		return
+	}
+	sql, _ := fc()
+	if isChangeStatement(sql) {
+		r.statements = append(r.statements, sql)
+	}
+}
+
+// isChangeStatement reports whether a SQL statement changes the schema or data
+func isChangeStatement(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "CREATE", "ALTER", "DROP", "COMMENT", "INSERT", "UPDATE", "DELETE", "TRUNCATE":
+		return true
+	}
+	return false
+}
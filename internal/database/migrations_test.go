@@ -0,0 +1,29 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	migrations := Migrations()
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "migration versions must be sequential")
+		assert.NotEmpty(t, m.Name)
+		assert.NotNil(t, m.Up, "migration %d has no Up", m.Version)
+	}
+}
+
+func TestIsChangeStatement(t *testing.T) {
+	assert.True(t, isChangeStatement(`CREATE TABLE "plans" ("id" uuid)`))
+	assert.True(t, isChangeStatement(`ALTER TABLE "messages" ADD "pricing_category" varchar(20)`))
+	assert.True(t, isChangeStatement("  create index if not exists idx ON t(c)"))
+	assert.True(t, isChangeStatement(`INSERT INTO "permissions" ("id") VALUES ('x')`))
+	assert.False(t, isChangeStatement(`SELECT count(*) FROM information_schema.tables`))
+	assert.False(t, isChangeStatement("SELECT pg_advisory_xact_lock(1)"))
+	assert.False(t, isChangeStatement(""))
+}
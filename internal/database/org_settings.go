@@ -0,0 +1,605 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"gorm.io/gorm"
+)
+
+// OrgSettingsVersion is the version of the org settings bundles written by
+// ExportOrgSettings
+const OrgSettingsVersion = 1
+
+// settingsTemplateRefs are the organization settings that reference templates, by
+// their path in the settings
+var settingsTemplateRefs = [][]string{
+	{"service_window_fallback_template_id"},
+	{"abandoned_cart", "template_id"},
+}
+
+// OrgSettings is an organization's configuration, as exported and imported to copy
+// it to another organization or environment. Credentials aren't included: neither
+// those of chatbot settings, their AI fallback providers and experiments, nor those of
+// integration settings (models.OrgSettingsSecrets). Records keep their IDs, so
+// references between them can be matched up on import.
+type OrgSettings struct {
+	Version         int                      `json:"version"`
+	Organization    string                   `json:"organization"` // Name of the organization they were exported from
+	Settings        models.JSONB             `json:"settings"`
+	ChatbotSettings []models.ChatbotSettings `json:"chatbot_settings"`
+	Templates       []models.Template        `json:"templates,omitempty"`
+	Flows           []models.ChatbotFlow     `json:"flows,omitempty"`
+	KeywordRules    []models.KeywordRule     `json:"keyword_rules,omitempty"`
+	CannedResponses []models.CannedResponse  `json:"canned_responses,omitempty"`
+}
+
+// OrgSettingsImport configures ImportOrgSettings
+type OrgSettingsImport struct {
+	DryRun bool      // Work out what the import does without applying it
+	UserID uuid.UUID // Creator of imported canned responses, uuid.Nil from the CLI
+}
+
+// OrgSettingsImportResult is what an import did, or would do for a dry run. Counts
+// are by kind: chatbot_settings, templates, flows, keyword_rules and canned_responses.
+type OrgSettingsImportResult struct {
+	DryRun   bool           `json:"dry_run"`
+	Created  map[string]int `json:"created"`
+	Updated  map[string]int `json:"updated"`
+	Warnings []string       `json:"warnings"`
+}
+
+func (r *OrgSettingsImportResult) warn(format string, args ...any) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// ExportOrgSettings returns an organization's settings, chatbot settings, templates,
+// chatbot flows, keyword rules and canned responses
+func ExportOrgSettings(db *gorm.DB, orgID uuid.UUID) (*OrgSettings, error) {
+	var org models.Organization
+	if err := db.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return nil, fmt.Errorf("failed to load organization: %w", err)
+	}
+	s := &OrgSettings{
+		Version:      OrgSettingsVersion,
+		Organization: org.Name,
+		Settings:     redactSettingsSecrets(org.Settings),
+	}
+
+	if err := db.Where("organization_id = ?", orgID).Order("whatsapp_account ASC").Find(&s.ChatbotSettings).Error; err != nil {
+		return nil, fmt.Errorf("failed to load chatbot settings: %w", err)
+	}
+	for i := range s.ChatbotSettings {
+		s.ChatbotSettings[i].BaseModel = models.BaseModel{}
+		s.ChatbotSettings[i].OrganizationID = uuid.Nil
+		s.ChatbotSettings[i].AI.FallbackProviders = keepAIProviderKeys(s.ChatbotSettings[i].AI.FallbackProviders, nil, nil)
+		s.ChatbotSettings[i].AI.Experiments = keepAIProviderKeys(s.ChatbotSettings[i].AI.Experiments, nil, nil)
+	}
+
+	if err := db.Where("organization_id = ?", orgID).Order("whatsapp_account, name, language").Find(&s.Templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to load templates: %w", err)
+	}
+	for i := range s.Templates {
+		s.Templates[i].BaseModel = models.BaseModel{ID: s.Templates[i].ID}
+		s.Templates[i].OrganizationID = uuid.Nil
+	}
+
+	if err := db.Where("organization_id = ?", orgID).
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("step_order ASC") }).
+		Order("name").Find(&s.Flows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load chatbot flows: %w", err)
+	}
+	for i := range s.Flows {
+		s.Flows[i].BaseModel = models.BaseModel{ID: s.Flows[i].ID}
+		s.Flows[i].OrganizationID = uuid.Nil
+		for j := range s.Flows[i].Steps {
+			s.Flows[i].Steps[j].BaseModel = models.BaseModel{}
+			s.Flows[i].Steps[j].FlowID = uuid.Nil
+		}
+	}
+
+	if err := db.Where("organization_id = ?", orgID).Order("whatsapp_account, priority DESC, name").Find(&s.KeywordRules).Error; err != nil {
+		return nil, fmt.Errorf("failed to load keyword rules: %w", err)
+	}
+	for i := range s.KeywordRules {
+		s.KeywordRules[i].BaseModel = models.BaseModel{}
+		s.KeywordRules[i].OrganizationID = uuid.Nil
+	}
+
+	if err := db.Where("organization_id = ?", orgID).Order("name").Find(&s.CannedResponses).Error; err != nil {
+		return nil, fmt.Errorf("failed to load canned responses: %w", err)
+	}
+	for i := range s.CannedResponses {
+		s.CannedResponses[i].BaseModel = models.BaseModel{}
+		s.CannedResponses[i].OrganizationID = uuid.Nil
+		s.CannedResponses[i].CreatedByID = uuid.Nil
+		s.CannedResponses[i].UsageCount = 0
+		s.CannedResponses[i].LastUsedAt = nil
+	}
+	return s, nil
+}
+
+// ImportOrgSettings applies exported settings to an organization:
+//   - Settings in the bundle replace the organization's settings of the same name,
+//     and others are kept. The organization keeps its integration credentials.
+//   - Chatbot settings replace those of the same WhatsApp account, keeping their
+//     credentials and those of their AI fallback providers and experiments.
+//   - Templates the organization doesn't have, by number, name and language, are
+//     created as drafts to submit to Meta. Ones it has are left as they are.
+//   - Chatbot flows and keyword rules replace those with the same number and name,
+//     and canned responses those with the same name.
+//
+// References to templates and flows are matched up with the organization's. A
+// reference to one that's neither in the bundle nor the organization fails the
+// import, except the flow of ad conversations, which is cleared.
+func ImportOrgSettings(db *gorm.DB, orgID uuid.UUID, s *OrgSettings, opts OrgSettingsImport) (*OrgSettingsImportResult, error) {
+	if s.Version != OrgSettingsVersion {
+		return nil, fmt.Errorf("unsupported org settings version %d", s.Version)
+	}
+
+	result := &OrgSettingsImportResult{
+		DryRun:   opts.DryRun,
+		Created:  map[string]int{},
+		Updated:  map[string]int{},
+		Warnings: []string{},
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		im := &orgSettingsImporter{
+			tx:        tx,
+			orgID:     orgID,
+			result:    result,
+			templates: map[uuid.UUID]uuid.UUID{},
+			flows:     map[uuid.UUID]uuid.UUID{},
+			accounts:  map[string]bool{},
+			opts:      opts,
+		}
+		var accounts []string
+		if err := tx.Model(&models.WhatsAppAccount{}).Where("organization_id = ?", orgID).Pluck("name", &accounts).Error; err != nil {
+			return fmt.Errorf("failed to load accounts: %w", err)
+		}
+		for _, name := range accounts {
+			im.accounts[name] = true
+		}
+
+		steps := []func(*OrgSettings) error{
+			im.importTemplates,
+			im.importSettings,
+			im.importFlows,
+			im.importChatbotSettings,
+			im.importKeywordRules,
+			im.importCannedResponses,
+		}
+		for _, step := range steps {
+			if err := step(s); err != nil {
+				return err
+			}
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// orgSettingsImporter imports a bundle in a transaction, mapping the IDs of the
+// bundle's templates and flows to the organization's
+type orgSettingsImporter struct {
+	tx        *gorm.DB
+	orgID     uuid.UUID
+	result    *OrgSettingsImportResult
+	templates map[uuid.UUID]uuid.UUID
+	flows     map[uuid.UUID]uuid.UUID
+	accounts  map[string]bool
+	opts      OrgSettingsImport
+}
+
+// checkAccount warns about records of a number the organization doesn't have
+func (im *orgSettingsImporter) checkAccount(what, account string) {
+	if account != "" && !im.accounts[account] {
+		im.result.warn("%s: the organization has no number %q", what, account)
+	}
+}
+
+// mapID returns the organization's ID for a template or flow of the bundle. IDs
+// that aren't in the bundle are kept if the organization has them.
+func (im *orgSettingsImporter) mapID(ids map[uuid.UUID]uuid.UUID, model interface{}, id uuid.UUID) (uuid.UUID, bool) {
+	if mapped, ok := ids[id]; ok {
+		return mapped, true
+	}
+	var count int64
+	im.tx.Model(model).Where("id = ? AND organization_id = ?", id, im.orgID).Count(&count)
+	return id, count > 0
+}
+
+func (im *orgSettingsImporter) importSettings(s *OrgSettings) error {
+	var org models.Organization
+	if err := im.tx.Where("id = ?", im.orgID).First(&org).Error; err != nil {
+		return fmt.Errorf("failed to load organization: %w", err)
+	}
+	if org.Settings == nil {
+		org.Settings = models.JSONB{}
+	}
+	existing := copyJSONB(org.Settings)
+	for key, value := range s.Settings {
+		org.Settings[key] = value
+	}
+	im.keepSettingsSecrets(org.Settings, existing, s.Settings)
+	for _, path := range settingsTemplateRefs {
+		im.mapSettingsTemplate(org.Settings, path)
+	}
+	if err := im.tx.Model(&org).Update("settings", org.Settings).Error; err != nil {
+		return fmt.Errorf("failed to update settings: %w", err)
+	}
+	return nil
+}
+
+// keepSettingsSecrets keeps the organization's credentials in the sections of
+// settings imported from a bundle, rather than ones a bundle might hold
+func (im *orgSettingsImporter) keepSettingsSecrets(settings, existing, imported models.JSONB) {
+	for _, secret := range models.OrgSettingsSecrets {
+		if _, ok := imported[secret.Section].(map[string]interface{}); !ok {
+			continue
+		}
+		section, _ := settings[secret.Section].(map[string]interface{})
+		section = copyJSONB(section)
+		prev, _ := existing[secret.Section].(map[string]interface{})
+		if value, ok := prev[secret.Key]; ok && value != "" {
+			section[secret.Key] = value
+		} else {
+			delete(section, secret.Key)
+			im.result.warn("The %s.%s setting is empty, as credentials aren't imported", secret.Section, secret.Key)
+		}
+		settings[secret.Section] = section
+	}
+}
+
+// mapSettingsTemplate matches up the template a setting sends, clearing it when it's
+// not in the bundle
+func (im *orgSettingsImporter) mapSettingsTemplate(settings models.JSONB, path []string) {
+	parent := settings
+	for _, key := range path[:len(path)-1] {
+		child, ok := parent[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		child = copyJSONB(child)
+		parent[key] = child
+		parent = child
+	}
+	key := path[len(path)-1]
+	ref, _ := parent[key].(string)
+	if ref == "" {
+		return
+	}
+	if bundleID, err := uuid.Parse(ref); err == nil {
+		if id, ok := im.mapID(im.templates, &models.Template{}, bundleID); ok {
+			parent[key] = id.String()
+			return
+		}
+	}
+	parent[key] = ""
+	im.result.warn("The %s setting was cleared, as its template isn't in the bundle", strings.Join(path, "."))
+}
+
+func (im *orgSettingsImporter) importTemplates(s *OrgSettings) error {
+	for _, imported := range s.Templates {
+		var existing models.Template
+		err := im.tx.Where("organization_id = ? AND whatsapp_account = ? AND name = ? AND language = ?",
+			im.orgID, imported.WhatsAppAccount, imported.Name, imported.Language).First(&existing).Error
+		if err == nil {
+			im.templates[imported.ID] = existing.ID
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to load templates: %w", err)
+		}
+
+		bundleID := imported.ID
+		imported.BaseModel = models.BaseModel{ID: uuid.New()}
+		imported.OrganizationID = im.orgID
+		imported.Organization = nil
+		imported.MetaTemplateID = ""
+		imported.Status = "DRAFT"
+		imported.QualityScore = ""
+		imported.QualityUpdatedAt = nil
+		imported.StatusReason = ""
+		if err := im.tx.Create(&imported).Error; err != nil {
+			return fmt.Errorf("failed to create template %q: %w", imported.Name, err)
+		}
+		im.templates[bundleID] = imported.ID
+		im.result.Created["templates"]++
+		im.checkAccount(fmt.Sprintf("Template %q", imported.Name), imported.WhatsAppAccount)
+	}
+	return nil
+}
+
+func (im *orgSettingsImporter) importFlows(s *OrgSettings) error {
+	// Flows are saved before their steps, as steps can jump to any of them
+	for _, imported := range s.Flows {
+		bundleID := imported.ID
+		imported.OrganizationID = im.orgID
+		imported.Organization = nil
+		imported.InitialTemplate = nil
+		imported.Steps = nil
+		if imported.InitialTemplateID != nil {
+			id, ok := im.mapID(im.templates, &models.Template{}, *imported.InitialTemplateID)
+			if !ok {
+				return fmt.Errorf("flow %q starts with a template that isn't in the bundle", imported.Name)
+			}
+			imported.InitialTemplateID = &id
+		}
+
+		var existing models.ChatbotFlow
+		err := im.tx.Where("organization_id = ? AND whatsapp_account = ? AND name = ?", im.orgID, imported.WhatsAppAccount, imported.Name).First(&existing).Error
+		switch {
+		case err == nil:
+			imported.BaseModel = existing.BaseModel
+			if err := im.tx.Save(&imported).Error; err != nil {
+				return fmt.Errorf("failed to update flow %q: %w", imported.Name, err)
+			}
+			if err := im.tx.Where("flow_id = ?", existing.ID).Delete(&models.ChatbotFlowStep{}).Error; err != nil {
+				return fmt.Errorf("failed to replace steps of flow %q: %w", imported.Name, err)
+			}
+			im.result.Updated["flows"]++
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			imported.BaseModel = models.BaseModel{ID: uuid.New()}
+			if err := im.tx.Create(&imported).Error; err != nil {
+				return fmt.Errorf("failed to create flow %q: %w", imported.Name, err)
+			}
+			im.result.Created["flows"]++
+		default:
+			return fmt.Errorf("failed to load flows: %w", err)
+		}
+		im.flows[bundleID] = imported.ID
+		im.checkAccount(fmt.Sprintf("Flow %q", imported.Name), imported.WhatsAppAccount)
+	}
+
+	for _, flow := range s.Flows {
+		for i, step := range flow.Steps {
+			step.BaseModel = models.BaseModel{ID: uuid.New()}
+			step.FlowID = im.flows[flow.ID]
+			step.Flow = nil
+			step.Template = nil
+			if step.StepOrder == 0 {
+				step.StepOrder = i + 1
+			}
+			if step.TemplateID != nil {
+				id, ok := im.mapID(im.templates, &models.Template{}, *step.TemplateID)
+				if !ok {
+					return fmt.Errorf("step %q of flow %q sends a template that isn't in the bundle", step.StepName, flow.Name)
+				}
+				step.TemplateID = &id
+			}
+			if step.MessageType == models.FlowStepTypeJump {
+				target, err := uuid.Parse(fmt.Sprint(step.InputConfig["flow_id"]))
+				if err != nil {
+					return fmt.Errorf("step %q of flow %q doesn't say which flow to jump to", step.StepName, flow.Name)
+				}
+				id, ok := im.mapID(im.flows, &models.ChatbotFlow{}, target)
+				if !ok {
+					return fmt.Errorf("step %q of flow %q jumps to a flow that isn't in the bundle", step.StepName, flow.Name)
+				}
+				step.InputConfig = copyJSONB(step.InputConfig)
+				step.InputConfig["flow_id"] = id.String()
+			}
+			if teamID, _ := step.TransferConfig["team_id"].(string); teamID != "" && teamID != "_general" {
+				var count int64
+				if id, err := uuid.Parse(teamID); err == nil {
+					im.tx.Model(&models.Team{}).Where("id = ? AND organization_id = ?", id, im.orgID).Count(&count)
+				}
+				if count == 0 {
+					step.TransferConfig = copyJSONB(step.TransferConfig)
+					step.TransferConfig["team_id"] = "_general"
+					im.result.warn("Step %q of flow %q transfers to the general queue, as its team isn't in the organization", step.StepName, flow.Name)
+				}
+			}
+			if err := im.tx.Create(&step).Error; err != nil {
+				return fmt.Errorf("failed to create step %q of flow %q: %w", step.StepName, flow.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (im *orgSettingsImporter) importChatbotSettings(s *OrgSettings) error {
+	for _, imported := range s.ChatbotSettings {
+		imported.OrganizationID = im.orgID
+		imported.Organization = nil
+		if imported.AdsFlowID != nil {
+			id, ok := im.mapID(im.flows, &models.ChatbotFlow{}, *imported.AdsFlowID)
+			if ok {
+				imported.AdsFlowID = &id
+			} else {
+				imported.AdsFlowID = nil
+				im.result.warn("The flow for ad conversations of %s was cleared, as it isn't in the bundle", chatbotSettingsName(imported.WhatsAppAccount))
+			}
+		}
+
+		var existing models.ChatbotSettings
+		err := im.tx.Where("organization_id = ? AND whatsapp_account = ?", im.orgID, imported.WhatsAppAccount).First(&existing).Error
+		switch {
+		case err == nil:
+			imported.BaseModel = existing.BaseModel
+			imported.AI.APIKey = existing.AI.APIKey
+			imported.AI.EmbeddingAPIKey = existing.AI.EmbeddingAPIKey
+			imported.AI.ModerationAPIKey = existing.AI.ModerationAPIKey
+			imported.Transcription.APIKey = existing.Transcription.APIKey
+			imported.AI.FallbackProviders = keepAIProviderKeys(imported.AI.FallbackProviders, existing.AI.FallbackProviders, aiFallbackProviderKey)
+			imported.AI.Experiments = keepAIProviderKeys(imported.AI.Experiments, existing.AI.Experiments, aiExperimentKey)
+			if err := im.tx.Save(&imported).Error; err != nil {
+				return fmt.Errorf("failed to update chatbot settings of %s: %w", chatbotSettingsName(imported.WhatsAppAccount), err)
+			}
+			im.result.Updated["chatbot_settings"]++
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			imported.BaseModel = models.BaseModel{ID: uuid.New()}
+			imported.AI.FallbackProviders = keepAIProviderKeys(imported.AI.FallbackProviders, nil, nil)
+			imported.AI.Experiments = keepAIProviderKeys(imported.AI.Experiments, nil, nil)
+			if len(imported.AI.FallbackProviders) > 0 || len(imported.AI.Experiments) > 0 {
+				im.result.warn("The AI fallback providers and experiments of %s have no API keys, as credentials aren't imported", chatbotSettingsName(imported.WhatsAppAccount))
+			}
+			if err := im.tx.Create(&imported).Error; err != nil {
+				return fmt.Errorf("failed to create chatbot settings of %s: %w", chatbotSettingsName(imported.WhatsAppAccount), err)
+			}
+			im.result.Created["chatbot_settings"]++
+		default:
+			return fmt.Errorf("failed to load chatbot settings: %w", err)
+		}
+		im.checkAccount("Chatbot settings", imported.WhatsAppAccount)
+	}
+	return nil
+}
+
+func (im *orgSettingsImporter) importKeywordRules(s *OrgSettings) error {
+	for _, imported := range s.KeywordRules {
+		imported.OrganizationID = im.orgID
+		imported.Organization = nil
+		if imported.ResponseType == models.ResponseTypeTemplate {
+			bundleID, err := uuid.Parse(fmt.Sprint(imported.ResponseContent["template_id"]))
+			if err != nil {
+				return fmt.Errorf("keyword rule %q doesn't say which template to send", imported.Name)
+			}
+			id, ok := im.mapID(im.templates, &models.Template{}, bundleID)
+			if !ok {
+				return fmt.Errorf("keyword rule %q sends a template that isn't in the bundle", imported.Name)
+			}
+			imported.ResponseContent = copyJSONB(imported.ResponseContent)
+			imported.ResponseContent["template_id"] = id.String()
+		}
+
+		var existing models.KeywordRule
+		err := im.tx.Where("organization_id = ? AND whatsapp_account = ? AND name = ?", im.orgID, imported.WhatsAppAccount, imported.Name).First(&existing).Error
+		switch {
+		case err == nil:
+			imported.BaseModel = existing.BaseModel
+			if err := im.tx.Save(&imported).Error; err != nil {
+				return fmt.Errorf("failed to update keyword rule %q: %w", imported.Name, err)
+			}
+			im.result.Updated["keyword_rules"]++
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			imported.BaseModel = models.BaseModel{ID: uuid.New()}
+			if err := im.tx.Create(&imported).Error; err != nil {
+				return fmt.Errorf("failed to create keyword rule %q: %w", imported.Name, err)
+			}
+			im.result.Created["keyword_rules"]++
+		default:
+			return fmt.Errorf("failed to load keyword rules: %w", err)
+		}
+		im.checkAccount(fmt.Sprintf("Keyword rule %q", imported.Name), imported.WhatsAppAccount)
+	}
+	return nil
+}
+
+func (im *orgSettingsImporter) importCannedResponses(s *OrgSettings) error {
+	for _, imported := range s.CannedResponses {
+		imported.OrganizationID = im.orgID
+		imported.Organization = nil
+		imported.CreatedBy = nil
+
+		var existing models.CannedResponse
+		err := im.tx.Where("organization_id = ? AND name = ?", im.orgID, imported.Name).First(&existing).Error
+		switch {
+		case err == nil:
+			imported.BaseModel = existing.BaseModel
+			imported.CreatedByID = existing.CreatedByID
+			imported.UsageCount = existing.UsageCount
+			imported.LastUsedAt = existing.LastUsedAt
+			if err := im.tx.Save(&imported).Error; err != nil {
+				return fmt.Errorf("failed to update canned response %q: %w", imported.Name, err)
+			}
+			im.result.Updated["canned_responses"]++
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			imported.BaseModel = models.BaseModel{ID: uuid.New()}
+			imported.CreatedByID = im.opts.UserID
+			imported.UsageCount = 0
+			imported.LastUsedAt = nil
+			if err := im.tx.Create(&imported).Error; err != nil {
+				return fmt.Errorf("failed to create canned response %q: %w", imported.Name, err)
+			}
+			im.result.Created["canned_responses"]++
+		default:
+			return fmt.Errorf("failed to load canned responses: %w", err)
+		}
+	}
+	return nil
+}
+
+// chatbotSettingsName names the chatbot settings of a number, or the organization's
+// defaults
+func chatbotSettingsName(account string) string {
+	if account == "" {
+		return "the organization's defaults"
+	}
+	return fmt.Sprintf("%q", account)
+}
+
+// keepAIProviderKeys returns AI fallback providers or experiments without their API
+// keys, except the keys of the existing ones they match by key
+func keepAIProviderKeys(items, existing models.JSONBArray, key func(i int, item map[string]interface{}) string) models.JSONBArray {
+	apiKeys := map[string]interface{}{}
+	for i, item := range existing {
+		if m, ok := item.(map[string]interface{}); ok && m[models.AIProviderSecretKey] != nil {
+			apiKeys[key(i, m)] = m[models.AIProviderSecretKey]
+		}
+	}
+
+	out := make(models.JSONBArray, len(items))
+	for i, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			out[i] = item
+			continue
+		}
+		m = copyJSONB(m)
+		delete(m, models.AIProviderSecretKey)
+		if key != nil {
+			if apiKey, ok := apiKeys[key(i, m)]; ok {
+				m[models.AIProviderSecretKey] = apiKey
+			}
+		}
+		out[i] = m
+	}
+	return out
+}
+
+// aiFallbackProviderKey matches up fallback providers, by position and provider
+func aiFallbackProviderKey(i int, item map[string]interface{}) string {
+	return fmt.Sprintf("%d:%v", i, item["provider"])
+}
+
+// aiExperimentKey matches up experiments, by ID and provider
+func aiExperimentKey(_ int, item map[string]interface{}) string {
+	return fmt.Sprintf("%v:%v", item["id"], item["provider"])
+}
+
+// redactSettingsSecrets returns a copy of organization settings without their
+// credentials
+func redactSettingsSecrets(settings models.JSONB) models.JSONB {
+	out := copyJSONB(settings)
+	for _, secret := range models.OrgSettingsSecrets {
+		section, ok := out[secret.Section].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		section = copyJSONB(section)
+		delete(section, secret.Key)
+		out[secret.Section] = section
+	}
+	return out
+}
+
+// copyJSONB returns a copy of a JSONB map, so a record's map can be changed without
+// changing the bundle's
+func copyJSONB(m models.JSONB) models.JSONB {
+	out := make(models.JSONB, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
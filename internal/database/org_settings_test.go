@@ -0,0 +1,114 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportOrgSettings_Version(t *testing.T) {
+	_, err := ImportOrgSettings(nil, uuid.New(), &OrgSettings{Version: OrgSettingsVersion + 1}, OrgSettingsImport{})
+	assert.ErrorContains(t, err, "unsupported org settings version")
+}
+
+func TestCopyJSONB(t *testing.T) {
+	original := models.JSONB{"flow_id": "old"}
+	copied := copyJSONB(original)
+	copied["flow_id"] = "new"
+	assert.Equal(t, "old", original["flow_id"], "the bundle's map isn't changed")
+
+	empty := copyJSONB(nil)
+	empty["team_id"] = "_general"
+	assert.Equal(t, "_general", empty["team_id"])
+}
+
+func TestMapSettingsTemplate(t *testing.T) {
+	bundleID, orgID := uuid.New(), uuid.New()
+	im := &orgSettingsImporter{
+		result:    &OrgSettingsImportResult{},
+		templates: map[uuid.UUID]uuid.UUID{bundleID: orgID},
+	}
+
+	cart := map[string]interface{}{"enabled": true, "template_id": bundleID.String()}
+	settings := models.JSONB{
+		"service_window_fallback_template_id": "not-a-template",
+		"abandoned_cart":                      cart,
+	}
+	for _, path := range settingsTemplateRefs {
+		im.mapSettingsTemplate(settings, path)
+	}
+
+	assert.Equal(t, "", settings["service_window_fallback_template_id"])
+	assert.Equal(t, orgID.String(), settings["abandoned_cart"].(map[string]interface{})["template_id"])
+	assert.Equal(t, bundleID.String(), cart["template_id"], "the bundle's settings aren't changed")
+	assert.Equal(t, []string{"The service_window_fallback_template_id setting was cleared, as its template isn't in the bundle"}, im.result.Warnings)
+}
+
+func TestRedactSettingsSecrets(t *testing.T) {
+	payments := map[string]interface{}{"provider": "stripe", "secret_key": "sk_live", "webhook_secret": "whsec", "currency": "USD"}
+	settings := models.JSONB{
+		"payments":      payments,
+		"notifications": map[string]interface{}{"slack_webhook_url": "https://hooks.slack.com/x", "events": []interface{}{"handoff_requested"}},
+		"timezone":      "UTC",
+	}
+
+	redacted := redactSettingsSecrets(settings)
+	assert.Equal(t, map[string]interface{}{"provider": "stripe", "currency": "USD"}, redacted["payments"])
+	assert.Equal(t, map[string]interface{}{"events": []interface{}{"handoff_requested"}}, redacted["notifications"])
+	assert.Equal(t, "UTC", redacted["timezone"])
+	assert.Equal(t, "sk_live", payments["secret_key"], "the organization's settings aren't changed")
+
+	assert.NotNil(t, redactSettingsSecrets(nil))
+}
+
+func TestKeepSettingsSecrets(t *testing.T) {
+	im := &orgSettingsImporter{result: &OrgSettingsImportResult{}}
+	existing := models.JSONB{
+		"payments": map[string]interface{}{"provider": "stripe", "secret_key": "sk_target", "webhook_secret": "whsec_target"},
+		"crm":      map[string]interface{}{"provider": "hubspot", "access_token": "target-token"},
+	}
+	imported := models.JSONB{
+		// A bundle from another organization with its production credentials
+		"payments":    map[string]interface{}{"provider": "razorpay", "secret_key": "sk_source", "webhook_secret": "whsec_source"},
+		"translation": map[string]interface{}{"provider": "deepl", "api_key": "source-key"},
+	}
+	settings := copyJSONB(existing)
+	for key, value := range imported {
+		settings[key] = value
+	}
+
+	im.keepSettingsSecrets(settings, existing, imported)
+	assert.Equal(t, map[string]interface{}{"provider": "razorpay", "secret_key": "sk_target", "webhook_secret": "whsec_target"}, settings["payments"])
+	assert.Equal(t, map[string]interface{}{"provider": "deepl"}, settings["translation"])
+	assert.Equal(t, existing["crm"], settings["crm"], "sections not in the bundle are kept")
+	assert.Equal(t, "sk_source", imported["payments"].(map[string]interface{})["secret_key"], "the bundle isn't changed")
+	assert.Equal(t, []string{"The translation.api_key setting is empty, as credentials aren't imported"}, im.result.Warnings)
+}
+
+func TestKeepAIProviderKeys(t *testing.T) {
+	existing := models.JSONBArray{
+		map[string]interface{}{"provider": "anthropic", "model": "claude", "api_key": "sk-ant"},
+		map[string]interface{}{"provider": "google", "model": "gemini", "api_key": "google-key"},
+	}
+	imported := models.JSONBArray{
+		map[string]interface{}{"provider": "anthropic", "model": "claude-new", "api_key": "sk-source"},
+		map[string]interface{}{"provider": "openai", "model": "gpt", "api_key": "sk-openai"},
+	}
+
+	kept := keepAIProviderKeys(imported, existing, aiFallbackProviderKey)
+	assert.Equal(t, "sk-ant", kept[0].(map[string]interface{})["api_key"])
+	assert.NotContains(t, kept[1].(map[string]interface{}), "api_key", "a different provider at the position has no key")
+	assert.Equal(t, "sk-source", imported[0].(map[string]interface{})["api_key"], "the bundle isn't changed")
+
+	experiments := keepAIProviderKeys(models.JSONBArray{
+		map[string]interface{}{"id": "haiku", "provider": "anthropic"},
+	}, models.JSONBArray{
+		map[string]interface{}{"id": "other", "provider": "anthropic", "api_key": "sk-other"},
+		map[string]interface{}{"id": "haiku", "provider": "anthropic", "api_key": "sk-haiku"},
+	}, aiExperimentKey)
+	assert.Equal(t, "sk-haiku", experiments[0].(map[string]interface{})["api_key"])
+
+	assert.NotContains(t, keepAIProviderKeys(imported, nil, nil)[0].(map[string]interface{}), "api_key")
+}
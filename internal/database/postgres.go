@@ -1,19 +1,35 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/shridarpatil/whatomate/internal/config"
 	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/tracing"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
+// replicaResolver names the resolver that routes reads to the read replica
+const replicaResolver = "replica"
+
+// Replica routes a query's reads to the read replica when one is configured, and
+// to the primary otherwise. It's meant for reporting and list queries that can
+// tolerate replication lag; writes always go to the primary.
+func Replica(db *gorm.DB) *gorm.DB {
+	// Read also routes raw queries that don't start with SELECT, such as CTEs
+	return db.Clauses(dbresolver.Use(replicaResolver), dbresolver.Read)
+}
+
 
 // NewPostgres creates a new PostgreSQL connection
 func NewPostgres(cfg *config.DatabaseConfig, debug bool) (*gorm.DB, error) {
@@ -27,26 +43,73 @@ func NewPostgres(cfg *config.DatabaseConfig, debug bool) (*gorm.DB, error) {
 		logLevel = logger.Info
 	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
+
+	// New connections read the password from the config, so a rotated password is
+	// picked up as the pool's connections are replaced
+	sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(ctx context.Context, cc *pgx.ConnConfig) error {
+		cc.Password = cfg.Password
+		return nil
+	}))
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
 		Logger: logger.Default.LogMode(logLevel),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	sqlDB, err := db.DB()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get database instance: %w", err)
+	// Trace queries run with a traced context
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, fmt.Errorf("failed to set up query tracing: %w", err)
 	}
 
 	// Configure connection pool
 	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
 	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
 	sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+	sqlDB.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime) * time.Second)
+
+	if cfg.ReplicaDSN != "" {
+		if err := useReplica(db, cfg); err != nil {
+			return nil, err
+		}
+	}
 
 	return db, nil
 }
 
+// useReplica registers the read replica, which queries scoped with Replica read from
+func useReplica(db *gorm.DB, cfg *config.DatabaseConfig) error {
+	connConfig, err := pgx.ParseConfig(cfg.ReplicaDSN)
+	if err != nil {
+		return fmt.Errorf("invalid database replica_dsn: %w", err)
+	}
+
+	// Like the primary, new connections pick up a rotated password
+	replicaDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(ctx context.Context, cc *pgx.ConnConfig) error {
+		if current, err := pgx.ParseConfig(cfg.ReplicaDSN); err == nil {
+			cc.Password = current.Password
+		}
+		return nil
+	}))
+	replicaDB.SetMaxOpenConns(cfg.ReplicaMaxOpenConns)
+	replicaDB.SetMaxIdleConns(cfg.ReplicaMaxIdleConns)
+	replicaDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
+	replicaDB.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime) * time.Second)
+
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{postgres.New(postgres.Config{Conn: replicaDB})},
+	}, replicaResolver)
+	if err := db.Use(resolver); err != nil {
+		return fmt.Errorf("failed to set up the read replica: %w", err)
+	}
+	return nil
+}
+
 // MigrationModel holds model info for migration progress
 type MigrationModel struct {
 	Name  string
@@ -65,18 +128,61 @@ func GetMigrationModels() []MigrationModel {
 		{"TeamMember", &models.TeamMember{}},
 		{"APIKey", &models.APIKey{}},
 		{"SSOProvider", &models.SSOProvider{}},
+		{"Invitation", &models.Invitation{}},
 		{"Webhook", &models.Webhook{}},
+		{"WebhookDelivery", &models.WebhookDelivery{}},
+		{"MessageHook", &models.MessageHook{}},
+		{"AuditLog", &models.AuditLog{}},
+		{"DeadLetter", &models.DeadLetter{}},
 		{"CustomAction", &models.CustomAction{}},
+		{"Automation", &models.Automation{}},
+		{"AutomationLog", &models.AutomationLog{}},
+		{"UsageCounter", &models.UsageCounter{}},
+		{"Plan", &models.Plan{}},
+		{"PlanChange", &models.PlanChange{}},
+		{"Statement", &models.Statement{}},
+		{"Wallet", &models.Wallet{}},
+		{"WalletTransaction", &models.WalletTransaction{}},
+		{"ConversationCharge", &models.ConversationCharge{}},
+		{"Checkout", &models.Checkout{}},
+		{"AIUsage", &models.AIUsage{}},
+		{"AnalyticsDaily", &models.AnalyticsDaily{}},
+		{"UsageMeter", &models.UsageMeter{}},
+		{"KnowledgeDocument", &models.KnowledgeDocument{}},
+		{"KnowledgeChunk", &models.KnowledgeChunk{}},
+		{"AIModerationLog", &models.AIModerationLog{}},
+		{"AdminAuditLog", &models.AdminAuditLog{}},
 		{"WhatsAppAccount", &models.WhatsAppAccount{}},
+		{"NumberHealthEvent", &models.NumberHealthEvent{}},
 		{"Contact", &models.Contact{}},
+		{"ContactNote", &models.ContactNote{}},
+		{"ContactNoteRevision", &models.ContactNoteRevision{}},
+		{"AdReferral", &models.AdReferral{}},
 		{"Message", &models.Message{}},
+		{"MessageArchive", &models.MessageArchive{}},
+		{"WhatsAppGroup", &models.WhatsAppGroup{}},
+		{"WhatsAppGroupParticipant", &models.WhatsAppGroupParticipant{}},
+		{"GroupMessage", &models.GroupMessage{}},
+		{"ScheduledMessage", &models.ScheduledMessage{}},
+		{"FollowUp", &models.FollowUp{}},
+		{"Sequence", &models.Sequence{}},
+		{"SequenceStep", &models.SequenceStep{}},
+		{"SequenceEnrollment", &models.SequenceEnrollment{}},
+		{"Segment", &models.Segment{}},
+		{"ContactImport", &models.ContactImport{}},
+		{"ContactConsentEvent", &models.ContactConsentEvent{}},
+		{"Appointment", &models.Appointment{}},
+		{"AppointmentReminder", &models.AppointmentReminder{}},
 		{"Template", &models.Template{}},
 		{"WhatsAppFlow", &models.WhatsAppFlow{}},
 
 		// Bulk & Notifications
 		{"BulkMessageCampaign", &models.BulkMessageCampaign{}},
 		{"BulkMessageRecipient", &models.BulkMessageRecipient{}},
+		{"CampaignVariant", &models.CampaignVariant{}},
 		{"NotificationRule", &models.NotificationRule{}},
+		{"TrackingLink", &models.TrackingLink{}},
+		{"TrackingLinkAttribution", &models.TrackingLinkAttribution{}},
 
 		// Chatbot models
 		{"ChatbotSettings", &models.ChatbotSettings{}},
@@ -87,40 +193,69 @@ func GetMigrationModels() []MigrationModel {
 		{"ChatbotSessionMessage", &models.ChatbotSessionMessage{}},
 		{"AIContext", &models.AIContext{}},
 		{"AgentTransfer", &models.AgentTransfer{}},
+		{"SessionNote", &models.SessionNote{}},
+		{"SessionNoteMention", &models.SessionNoteMention{}},
+		{"PaymentLink", &models.PaymentLink{}},
+		{"CRMContact", &models.CRMContact{}},
+		{"HelpdeskTicket", &models.HelpdeskTicket{}},
+		{"CSATResponse", &models.CSATResponse{}},
 
 		// User tracking
 		{"UserAvailabilityLog", &models.UserAvailabilityLog{}},
 
 		// Canned responses
 		{"CannedResponse", &models.CannedResponse{}},
+		{"CannedResponseFavorite", &models.CannedResponseFavorite{}},
+		{"CannedResponseUse", &models.CannedResponseUse{}},
+		{"Shortcode", &models.Shortcode{}},
+
+		// Holidays
+		{"Holiday", &models.Holiday{}},
+		{"SLAPolicy", &models.SLAPolicy{}},
 
 		// Catalogs
 		{"Catalog", &models.Catalog{}},
 		{"CatalogProduct", &models.CatalogProduct{}},
+		{"Order", &models.Order{}},
 	}
 }
 
-// AutoMigrate runs auto migration for all models (silent mode)
+// AutoMigrate applies pending migrations (silent mode)
 func AutoMigrate(db *gorm.DB) error {
-	migrationModels := GetMigrationModels()
-	for _, m := range migrationModels {
-		if err := db.AutoMigrate(m.Model); err != nil {
-			return err
-		}
+	_, err := MigrateUp(db, nil)
+	return err
+}
+
+// SeedDefaults seeds permissions and system roles, and creates the default admin if
+// there are no users. It is safe to run after every migration.
+func SeedDefaults(db *gorm.DB) error {
+	// Seed permissions (always run, will skip if already seeded)
+	if err := SeedPermissionsAndRoles(db); err != nil {
+		return err
 	}
-	return nil
+
+	// Fix existing organizations - link permissions to system roles if missing
+	if err := SeedSystemRolesForAllOrgs(db); err != nil {
+		return err
+	}
+
+	// Create default admin (only runs if no users exist)
+	return CreateDefaultAdmin(db)
 }
 
-// RunMigrationWithProgress runs migrations with a progress bar display
+// RunMigrationWithProgress applies pending migrations and seeds default data with a
+// progress bar display
 func RunMigrationWithProgress(db *gorm.DB) error {
 	// Silence GORM logging during migration
 	silentDB := db.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
 
-	migrationModels := GetMigrationModels()
-	indexes := getIndexes()
+	pending, err := PendingMigrations(silentDB)
+	if err != nil {
+		return err
+	}
 
-	// Total steps: models + indexes + default admin check
-	totalSteps := len(migrationModels) + len(indexes) + 1
+	// Total steps: migrations + seeding defaults
+	totalSteps := len(pending) + 1
 	currentStep := 0
 	barWidth := 40
 
@@ -136,42 +271,19 @@ func RunMigrationWithProgress(db *gorm.DB) error {
 
 	fmt.Println()
 
-	// Migrate models
-	for _, m := range migrationModels {
+	// Apply migrations
+	_, err = MigrateUp(silentDB, func(Migration) {
 		printProgress(currentStep, totalSteps)
-		if err := silentDB.AutoMigrate(m.Model); err != nil {
-			fmt.Printf("\n  \033[31m✗ Migration failed: %s\033[0m\n\n", m.Name)
-			return fmt.Errorf("failed to migrate %s: %w", m.Name, err)
-		}
 		currentStep++
-	}
-
-	// Create indexes
-	for _, idx := range indexes {
-		printProgress(currentStep, totalSteps)
-		if err := silentDB.Exec(idx).Error; err != nil {
-			fmt.Printf("\n  \033[31m✗ Index creation failed\033[0m\n\n")
-			return fmt.Errorf("failed to create index: %w", err)
-		}
-		currentStep++
-	}
-
-	// Seed permissions (always run, will skip if already seeded)
-	printProgress(currentStep, totalSteps)
-	if err := SeedPermissionsAndRoles(silentDB); err != nil {
-		fmt.Printf("\n  \033[31m✗ Failed to seed permissions\033[0m\n\n")
-		return err
-	}
-
-	// Fix existing organizations - link permissions to system roles if missing
-	if err := SeedSystemRolesForAllOrgs(silentDB); err != nil {
-		fmt.Printf("\n  \033[31m✗ Failed to fix existing role permissions\033[0m\n\n")
+	})
+	if err != nil {
+		fmt.Printf("\n  \033[31m✗ %s\033[0m\n\n", err)
 		return err
 	}
 
-	// Create default admin (only runs if no users exist)
+	// Seed permissions, roles and the default admin
 	printProgress(currentStep, totalSteps)
-	if err := CreateDefaultAdmin(silentDB); err != nil {
+	if err := SeedDefaults(silentDB); err != nil {
 		fmt.Printf("\n  \033[31m✗ Setup failed\033[0m\n\n")
 		return err
 	}
@@ -192,47 +304,29 @@ func repeatChar(char string, n int) string {
 	return result
 }
 
-// getIndexes returns all index creation SQL statements
+// getIndexes returns all index creation SQL statements.
+// Used by both RunMigrationWithProgress and CreateIndexes so the list lives in one place.
 func getIndexes() []string {
 	return []string{
-		`CREATE INDEX IF NOT EXISTS idx_messages_contact_created ON messages(contact_id, created_at DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id)`,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_contacts_org_phone ON contacts(organization_id, phone_number)`,
-		`CREATE INDEX IF NOT EXISTS idx_contacts_assigned_read ON contacts(assigned_user_id, is_read)`,
-		`CREATE INDEX IF NOT EXISTS idx_sessions_phone_status ON chatbot_sessions(organization_id, phone_number, status)`,
-		`CREATE INDEX IF NOT EXISTS idx_keyword_rules_priority ON keyword_rules(organization_id, is_enabled, priority DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_agent_transfers_active ON agent_transfers(organization_id, phone_number, status)`,
-		`CREATE INDEX IF NOT EXISTS idx_agent_transfers_org_contact ON agent_transfers(organization_id, contact_id, status)`,
-		`CREATE INDEX IF NOT EXISTS idx_agent_transfers_agent_active ON agent_transfers(agent_id, status) WHERE status = 'active'`,
-		`CREATE INDEX IF NOT EXISTS idx_agent_transfers_team ON agent_transfers(team_id, status) WHERE team_id IS NOT NULL`,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_whatsapp_accounts_org_phone ON whatsapp_accounts(organization_id, phone_id)`,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_templates_account_name_lang ON templates(whats_app_account, name, language)`,
-		`CREATE INDEX IF NOT EXISTS idx_keyword_rules_account ON keyword_rules(whats_app_account, is_enabled, priority DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_chatbot_flows_account ON chatbot_flows(whats_app_account, is_enabled)`,
-		`CREATE INDEX IF NOT EXISTS idx_ai_contexts_account ON ai_contexts(whats_app_account, is_enabled, priority DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_bulk_campaigns_account ON bulk_message_campaigns(whats_app_account, status)`,
-		`CREATE INDEX IF NOT EXISTS idx_notification_rules_account ON notification_rules(whats_app_account, is_enabled)`,
-		`CREATE INDEX IF NOT EXISTS idx_messages_account ON messages(whats_app_account, created_at DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_contacts_account ON contacts(whats_app_account)`,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_canned_responses_org_name ON canned_responses(organization_id, name)`,
-		`CREATE INDEX IF NOT EXISTS idx_canned_responses_active ON canned_responses(organization_id, is_active, usage_count DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_webhooks_org_active ON webhooks(organization_id, is_active)`,
-		`CREATE INDEX IF NOT EXISTS idx_availability_logs_user_time ON user_availability_logs(user_id, started_at DESC)`,
-		`CREATE INDEX IF NOT EXISTS idx_availability_logs_org_time ON user_availability_logs(organization_id, started_at DESC)`,
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_sso_providers_org_provider ON sso_providers(organization_id, provider)`,
-		// Custom roles indexes
-		`CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_roles_org_name ON custom_roles(organization_id, name)`,
-		`CREATE INDEX IF NOT EXISTS idx_custom_roles_org_system ON custom_roles(organization_id, is_system)`,
-		`CREATE INDEX IF NOT EXISTS idx_custom_roles_org_default ON custom_roles(organization_id, is_default) WHERE is_default = true`,
-	}
-}
-
-// CreateIndexes creates additional indexes not handled by GORM tags
-func CreateIndexes(db *gorm.DB) error {
-	indexes := []string{
 		// Messages indexes
 		`CREATE INDEX IF NOT EXISTS idx_messages_contact_created ON messages(contact_id, created_at DESC)`,
 		`CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_org_outgoing_created ON messages(organization_id, created_at) WHERE direction = 'outgoing'`,
+		messageSearchIndex,
+
+		// Scheduled messages indexes
+		`CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages(status, send_at)`,
+
+		// Follow-ups indexes
+		`CREATE INDEX IF NOT EXISTS idx_follow_ups_due ON follow_ups(status, due_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_follow_ups_contact_status ON follow_ups(contact_id, status)`,
+
+		// Sequence enrollments indexes
+		sequenceEnrollmentDueIndex,
+
+		// Appointments indexes
+		`CREATE INDEX IF NOT EXISTS idx_appointments_org_starts ON appointments(organization_id, starts_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_appointment_reminders_due ON appointment_reminders(status, send_at)`,
 
 		// Contacts indexes
 		`CREATE UNIQUE INDEX IF NOT EXISTS idx_contacts_org_phone ON contacts(organization_id, phone_number)`,
@@ -278,9 +372,40 @@ func CreateIndexes(db *gorm.DB) error {
 		`CREATE UNIQUE INDEX IF NOT EXISTS idx_canned_responses_org_name ON canned_responses(organization_id, name)`,
 		`CREATE INDEX IF NOT EXISTS idx_canned_responses_active ON canned_responses(organization_id, is_active, usage_count DESC)`,
 
+		// Shortcodes indexes
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_shortcodes_org_code ON shortcodes(organization_id, code) WHERE deleted_at IS NULL`,
+
+		// Holidays indexes
+		`CREATE INDEX IF NOT EXISTS idx_holidays_org_date ON holidays(organization_id, date)`,
+
 		// Webhooks indexes
 		`CREATE INDEX IF NOT EXISTS idx_webhooks_org_active ON webhooks(organization_id, is_active)`,
 
+		// Automations indexes
+		`CREATE INDEX IF NOT EXISTS idx_automations_org_event ON automations(organization_id, event, is_active)`,
+		`CREATE INDEX IF NOT EXISTS idx_automation_logs_automation_created ON automation_logs(automation_id, created_at DESC)`,
+		webhookDeliveryIndex,
+
+		// Usage counters indexes
+		`CREATE INDEX IF NOT EXISTS idx_usage_counters_period ON usage_counters(period, metric)`,
+
+		// Plans indexes
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_plans_name ON plans(name) WHERE deleted_at IS NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_organizations_plan ON organizations(plan)`,
+
+		// Statements indexes
+		`CREATE INDEX IF NOT EXISTS idx_statements_unpushed ON statements(created_at) WHERE pushed_at IS NULL`,
+
+		// Wallet transactions indexes
+		`CREATE INDEX IF NOT EXISTS idx_wallet_transactions_org_created ON wallet_transactions(organization_id, created_at DESC)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_wallet_transactions_org_reference ON wallet_transactions(organization_id, reference) WHERE reference <> ''`,
+
+		// Admin audit log
+		adminAuditLogIndex,
+
+		// Dead letters
+		deadLetterIndex,
+
 		// User availability logs indexes
 		`CREATE INDEX IF NOT EXISTS idx_availability_logs_user_time ON user_availability_logs(user_id, started_at DESC)`,
 		`CREATE INDEX IF NOT EXISTS idx_availability_logs_org_time ON user_availability_logs(organization_id, started_at DESC)`,
@@ -293,8 +418,11 @@ func CreateIndexes(db *gorm.DB) error {
 		`CREATE INDEX IF NOT EXISTS idx_custom_roles_org_system ON custom_roles(organization_id, is_system)`,
 		`CREATE INDEX IF NOT EXISTS idx_custom_roles_org_default ON custom_roles(organization_id, is_default) WHERE is_default = true`,
 	}
+}
 
-	for _, idx := range indexes {
+// CreateIndexes creates additional indexes not handled by GORM tags
+func CreateIndexes(db *gorm.DB) error {
+	for _, idx := range getIndexes() {
 		if err := db.Exec(idx).Error; err != nil {
 			return fmt.Errorf("failed to create index: %w", err)
 		}
@@ -559,16 +687,16 @@ func MigrateExistingUserRoles(db *gorm.DB) error {
 	return nil
 }
 
-// SeedSystemRolesForOrg creates system roles for an organization
+// SeedSystemRolesForOrg creates the system roles an organization doesn't have yet.
+// A system role is skipped if the organization already has a role with its name.
 func SeedSystemRolesForOrg(db *gorm.DB, orgID uuid.UUID) error {
-	// Check if system roles exist for this org
-	var roleCount int64
-	if err := db.Model(&models.CustomRole{}).Where("organization_id = ? AND is_system = ?", orgID, true).Count(&roleCount).Error; err != nil {
-		return fmt.Errorf("failed to count roles: %w", err)
+	var existing []string
+	if err := db.Model(&models.CustomRole{}).Where("organization_id = ?", orgID).Pluck("name", &existing).Error; err != nil {
+		return fmt.Errorf("failed to fetch roles: %w", err)
 	}
-
-	if roleCount > 0 {
-		return nil // Already seeded
+	existingRoles := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		existingRoles[name] = true
 	}
 
 	// Get all permissions from database
@@ -595,9 +723,14 @@ func SeedSystemRolesForOrg(db *gorm.DB, orgID uuid.UUID) error {
 		{"admin", "Full system access", false},
 		{"manager", "Manage chatbot, campaigns, and team operations", false},
 		{"agent", "Handle customer conversations", true},
+		{"viewer", "Read-only access to conversations, contacts and reports", false},
 	}
 
 	for _, sr := range systemRoles {
+		if existingRoles[sr.Name] {
+			continue
+		}
+
 		role := models.CustomRole{
 			BaseModel:      models.BaseModel{ID: uuid.New()},
 			OrganizationID: orgID,
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestReplicaRouting(t *testing.T) {
+	// Dry runs build statements without connecting, showing which pool they'd use
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=primary user=whatomate dbname=whatomate"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	require.NoError(t, err)
+	primary := db.Config.ConnPool
+
+	// Without a replica, everything goes to the primary
+	var contacts []models.Contact
+	assert.Equal(t, primary, Replica(db).Find(&contacts).Statement.ConnPool)
+
+	require.NoError(t, useReplica(db, &config.DatabaseConfig{
+		ReplicaDSN:          "host=replica user=whatomate dbname=whatomate",
+		ReplicaMaxOpenConns: 5,
+		ReplicaMaxIdleConns: 2,
+	}))
+
+	assert.Equal(t, primary, db.Find(&contacts).Statement.ConnPool, "reads go to the primary unless scoped")
+	replica := Replica(db).Find(&contacts).Statement.ConnPool
+	assert.NotEqual(t, primary, replica)
+
+	var count int64
+	assert.Equal(t, replica, Replica(db).Model(&models.Contact{}).Count(&count).Statement.ConnPool)
+	assert.Equal(t, replica, Replica(db).Raw("WITH c AS (SELECT 1) SELECT * FROM c").Scan(&count).Statement.ConnPool)
+	assert.Equal(t, primary, Replica(db).Create(&models.Contact{}).Statement.ConnPool, "writes always go to the primary")
+}
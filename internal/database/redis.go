@@ -6,15 +6,20 @@ import (
 
 	"github.com/redis/go-redis/v9"
 	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/tracing"
 )
 
 // NewRedis creates a new Redis client
 func NewRedis(cfg *config.RedisConfig) (*redis.Client, error) {
 	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Password: cfg.Password,
-		DB:       cfg.DB,
+		Addr: fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		DB:   cfg.DB,
+		// Read the password per connection so a rotated password is picked up
+		CredentialsProvider: func() (string, string) {
+			return "", cfg.Password
+		},
 	})
+	client.AddHook(tracing.RedisHook{})
 
 	// Test connection
 	ctx := context.Background()
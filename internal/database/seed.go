@@ -0,0 +1,347 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Demo organization, login and channel created by SeedDemo
+const (
+	DemoOrgSlug      = "demo"
+	DemoUserEmail    = "demo@whatomate.local"
+	DemoUserPassword = "demo"
+	DemoAccountName  = "Demo Channel"
+)
+
+// ErrDemoExists is returned by SeedDemo when the demo organization already exists
+var ErrDemoExists = errors.New("demo organization already exists")
+
+// demoConversation is a sample contact and the messages exchanged with it, oldest first
+type demoConversation struct {
+	phone    string
+	name     string
+	tags     []string
+	messages []demoMessage
+}
+
+type demoMessage struct {
+	direction models.Direction
+	content   string
+}
+
+var demoConversations = []demoConversation{
+	{
+		phone: "15550100001",
+		name:  "Alice Johnson",
+		tags:  []string{"customer"},
+		messages: []demoMessage{
+			{models.DirectionIncoming, "Hi! Is my order #1042 on its way?"},
+			{models.DirectionOutgoing, "Hi Alice, it shipped this morning and should arrive tomorrow."},
+			{models.DirectionIncoming, "Great, thanks!"},
+		},
+	},
+	{
+		phone: "15550100002",
+		name:  "Bob Smith",
+		tags:  []string{"lead"},
+		messages: []demoMessage{
+			{models.DirectionIncoming, "Hello, what are your opening hours?"},
+			{models.DirectionOutgoing, "We're open Monday to Friday, 9am to 6pm."},
+		},
+	},
+	{
+		phone: "15550100003",
+		name:  "Carla Gomez",
+		tags:  []string{"customer", "vip"},
+		messages: []demoMessage{
+			{models.DirectionIncoming, "I'd like to book an appointment for next week."},
+		},
+	},
+	{
+		phone: "15550100004",
+		name:  "David Lee",
+		messages: []demoMessage{
+			{models.DirectionOutgoing, "Hi David, your refund has been processed."},
+			{models.DirectionIncoming, "Received it, thank you."},
+		},
+	},
+}
+
+// SeedDemo creates a demo organization with an admin user, a WhatsApp channel with
+// placeholder credentials, contacts and conversations, a template, a chatbot flow,
+// keyword rules and canned responses. It returns ErrDemoExists if the demo
+// organization has already been created.
+func SeedDemo(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&models.Organization{}).Where("slug = ?", DemoOrgSlug).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check for demo organization: %w", err)
+	}
+	if count > 0 {
+		return ErrDemoExists
+	}
+
+	if err := SeedPermissionsAndRoles(db); err != nil {
+		return fmt.Errorf("failed to seed permissions: %w", err)
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(DemoUserPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		org := models.Organization{
+			BaseModel: models.BaseModel{ID: uuid.New()},
+			Name:      "Demo Organization",
+			Slug:      DemoOrgSlug,
+			Settings:  models.JSONB{},
+		}
+		if err := tx.Create(&org).Error; err != nil {
+			return fmt.Errorf("failed to create demo organization: %w", err)
+		}
+
+		if err := SeedSystemRolesForOrg(tx, org.ID); err != nil {
+			return fmt.Errorf("failed to seed system roles: %w", err)
+		}
+		var adminRole models.CustomRole
+		if err := tx.Where("organization_id = ? AND name = ? AND is_system = ?", org.ID, "admin", true).First(&adminRole).Error; err != nil {
+			return fmt.Errorf("failed to find admin role: %w", err)
+		}
+
+		user := models.User{
+			BaseModel:      models.BaseModel{ID: uuid.New()},
+			OrganizationID: org.ID,
+			Email:          DemoUserEmail,
+			PasswordHash:   string(passwordHash),
+			FullName:       "Demo Admin",
+			RoleID:         &adminRole.ID,
+			IsActive:       true,
+			IsAvailable:    true,
+			Settings:       models.JSONB{},
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return fmt.Errorf("failed to create demo user: %w", err)
+		}
+
+		// Placeholder credentials: the channel shows up everywhere in the UI, but
+		// messages sent through it fail until real credentials are configured
+		account := models.WhatsAppAccount{
+			BaseModel:          models.BaseModel{ID: uuid.New()},
+			OrganizationID:     org.ID,
+			Name:               DemoAccountName,
+			PhoneID:            "demo-phone-id",
+			BusinessID:         "demo-business-id",
+			AccessToken:        "demo-access-token",
+			WebhookVerifyToken: "demo-verify-token",
+			APIVersion:         "v21.0",
+			IsDefaultIncoming:  true,
+			IsDefaultOutgoing:  true,
+			Status:             "active",
+		}
+		if err := tx.Create(&account).Error; err != nil {
+			return fmt.Errorf("failed to create demo channel: %w", err)
+		}
+
+		if err := seedDemoConversations(tx, org.ID, user.ID); err != nil {
+			return err
+		}
+		return seedDemoContent(tx, org.ID, user.ID)
+	})
+}
+
+// seedDemoConversations creates the demo contacts and their messages, spread over
+// the last few hours
+func seedDemoConversations(tx *gorm.DB, orgID, userID uuid.UUID) error {
+	now := time.Now()
+	for i, conv := range demoConversations {
+		start := now.Add(-time.Duration(len(demoConversations)-i) * time.Hour)
+		last := conv.messages[len(conv.messages)-1]
+		lastAt := start.Add(time.Duration(len(conv.messages)-1) * 5 * time.Minute)
+
+		tags := models.JSONBArray{}
+		for _, tag := range conv.tags {
+			tags = append(tags, tag)
+		}
+		contact := models.Contact{
+			BaseModel:          models.BaseModel{ID: uuid.New()},
+			OrganizationID:     orgID,
+			PhoneNumber:        conv.phone,
+			ProfileName:        conv.name,
+			WhatsAppAccount:    DemoAccountName,
+			LastMessageAt:      &lastAt,
+			LastMessagePreview: last.content,
+			IsRead:             last.direction == models.DirectionOutgoing,
+			Tags:               tags,
+			Metadata:           models.JSONB{},
+		}
+		for j := len(conv.messages) - 1; j >= 0; j-- {
+			if conv.messages[j].direction == models.DirectionIncoming {
+				inboundAt := start.Add(time.Duration(j) * 5 * time.Minute)
+				contact.LastInboundAt = &inboundAt
+				break
+			}
+		}
+		if err := tx.Create(&contact).Error; err != nil {
+			return fmt.Errorf("failed to create demo contact: %w", err)
+		}
+
+		for j, m := range conv.messages {
+			sentAt := start.Add(time.Duration(j) * 5 * time.Minute)
+			msg := models.Message{
+				BaseModel:         models.BaseModel{ID: uuid.New(), CreatedAt: sentAt, UpdatedAt: sentAt},
+				OrganizationID:    orgID,
+				WhatsAppAccount:   DemoAccountName,
+				ContactID:         contact.ID,
+				WhatsAppMessageID: "demo." + uuid.NewString(),
+				Direction:         m.direction,
+				MessageType:       models.MessageTypeText,
+				Content:           m.content,
+				Status:            models.MessageStatusRead,
+				Metadata:          models.JSONB{},
+			}
+			if m.direction == models.DirectionOutgoing {
+				msg.SentByUserID = &userID
+			}
+			if err := tx.Create(&msg).Error; err != nil {
+				return fmt.Errorf("failed to create demo message: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// seedDemoContent creates the demo template, chatbot flow, keyword rules and canned
+// responses
+func seedDemoContent(tx *gorm.DB, orgID, userID uuid.UUID) error {
+	template := models.Template{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  orgID,
+		WhatsAppAccount: DemoAccountName,
+		Name:            "order_update",
+		DisplayName:     "Order Update",
+		Language:        "en",
+		Category:        "UTILITY",
+		Status:          "APPROVED",
+		BodyContent:     "Hi {{1}}, your order {{2}} has shipped and will arrive on {{3}}.",
+		FooterContent:   "Reply STOP to unsubscribe",
+		Buttons:         models.JSONBArray{},
+		SampleValues:    models.JSONBArray{"Alice", "#1042", "Friday"},
+	}
+	if err := tx.Create(&template).Error; err != nil {
+		return fmt.Errorf("failed to create demo template: %w", err)
+	}
+
+	flow := models.ChatbotFlow{
+		BaseModel:         models.BaseModel{ID: uuid.New()},
+		OrganizationID:    orgID,
+		WhatsAppAccount:   DemoAccountName,
+		Name:              "Book an appointment",
+		IsEnabled:         true,
+		Description:       "Collects a name and preferred day for an appointment",
+		TriggerKeywords:   models.StringArray{"book", "appointment"},
+		InitialMessage:    "Let's get you booked in.",
+		CompletionMessage: "Thanks {{name}}, we'll confirm your appointment for {{day}} shortly.",
+		CancelKeywords:    models.StringArray{"cancel", "stop"},
+		CompletionConfig:  models.JSONB{},
+		PanelConfig:       models.JSONB{},
+	}
+	if err := tx.Create(&flow).Error; err != nil {
+		return fmt.Errorf("failed to create demo flow: %w", err)
+	}
+
+	steps := []models.ChatbotFlowStep{
+		{
+			StepName:  "ask_name",
+			StepOrder: 1,
+			Message:   "What's your name?",
+			InputType: models.InputTypeText,
+			StoreAs:   "name",
+			NextStep:  "ask_day",
+		},
+		{
+			StepName:    "ask_day",
+			StepOrder:   2,
+			Message:     "Which day works best for you?",
+			MessageType: models.FlowStepTypeButtons,
+			Buttons: models.JSONBArray{
+				map[string]interface{}{"id": "monday", "title": "Monday"},
+				map[string]interface{}{"id": "wednesday", "title": "Wednesday"},
+				map[string]interface{}{"id": "friday", "title": "Friday"},
+			},
+			InputType: models.InputTypeButton,
+			StoreAs:   "day",
+		},
+	}
+	for i := range steps {
+		steps[i].ID = uuid.New()
+		steps[i].FlowID = flow.ID
+		if steps[i].MessageType == "" {
+			steps[i].MessageType = models.FlowStepTypeText
+		}
+		if err := tx.Create(&steps[i]).Error; err != nil {
+			return fmt.Errorf("failed to create demo flow step: %w", err)
+		}
+	}
+
+	rules := []models.KeywordRule{
+		{
+			Name:            "Opening hours",
+			Keywords:        models.StringArray{"hours", "open"},
+			MatchType:       models.MatchTypeContains,
+			ResponseType:    models.ResponseTypeText,
+			ResponseContent: models.JSONB{"body": "We're open Monday to Friday, 9am to 6pm."},
+		},
+		{
+			Name:            "Talk to a human",
+			Keywords:        models.StringArray{"agent", "human"},
+			MatchType:       models.MatchTypeContains,
+			ResponseType:    models.ResponseTypeTransfer,
+			ResponseContent: models.JSONB{"body": "Connecting you with an agent..."},
+		},
+	}
+	for i := range rules {
+		rules[i].ID = uuid.New()
+		rules[i].OrganizationID = orgID
+		rules[i].WhatsAppAccount = DemoAccountName
+		rules[i].IsEnabled = true
+		rules[i].Priority = 10
+		if err := tx.Create(&rules[i]).Error; err != nil {
+			return fmt.Errorf("failed to create demo keyword rule: %w", err)
+		}
+	}
+
+	responses := []models.CannedResponse{
+		{Name: "Greeting", Shortcut: "hi", Content: "Hi {{contact_name}}, thanks for reaching out! How can we help?", Category: "general"},
+		{Name: "Order shipped", Shortcut: "shipped", Content: "Your order has shipped and should arrive within 2 business days.", Category: "orders"},
+		{Name: "Closing", Shortcut: "bye", Content: "Glad we could help. Have a great day!", Category: "general"},
+	}
+	for i := range responses {
+		responses[i].ID = uuid.New()
+		responses[i].OrganizationID = orgID
+		responses[i].IsActive = true
+		responses[i].CreatedByID = userID
+		if err := tx.Create(&responses[i]).Error; err != nil {
+			return fmt.Errorf("failed to create demo canned response: %w", err)
+		}
+	}
+
+	settings := models.ChatbotSettings{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  orgID,
+		IsEnabled:       true,
+		DefaultResponse: "Thanks for your message! Type \"book\" to book an appointment or \"agent\" to talk to a person.",
+		GreetingButtons: models.JSONBArray{},
+		FallbackButtons: models.JSONBArray{},
+		ExcludedNumbers: models.JSONBArray{},
+	}
+	if err := tx.Create(&settings).Error; err != nil {
+		return fmt.Errorf("failed to create demo chatbot settings: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,690 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/shopify"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// defaultCartRecoveryDelay is how long a checkout goes without an order before it
+// counts as abandoned, when the organization hasn't set a delay
+const defaultCartRecoveryDelay = 60
+
+// AbandonedCartSettings configure the recovery template sent for abandoned checkouts
+type AbandonedCartSettings struct {
+	Enabled              bool              `json:"enabled"`
+	DelayMinutes         int               `json:"delay_minutes"`
+	WhatsAppAccount      string            `json:"whatsapp_account"`
+	TemplateID           string            `json:"template_id"`
+	TemplateParams       map[string]string `json:"template_params"` // Supports {{name}}, {{items}}, {{total}} and {{checkout_url}}
+	ShopifyWebhookSecret string            `json:"-"`
+}
+
+// AbandonedCartSettingsRequest updates abandoned cart settings. Omitted fields keep
+// their current value.
+type AbandonedCartSettingsRequest struct {
+	Enabled              *bool             `json:"enabled"`
+	DelayMinutes         *int              `json:"delay_minutes"`
+	WhatsAppAccount      *string           `json:"whatsapp_account"`
+	TemplateID           *string           `json:"template_id"`
+	TemplateParams       map[string]string `json:"template_params"`
+	ShopifyWebhookSecret *string           `json:"shopify_webhook_secret"`
+}
+
+// AbandonedCartReport summarizes cart recovery over a date range
+type AbandonedCartReport struct {
+	Checkouts        int64            `json:"checkouts"`
+	RecoverySent     int64            `json:"recovery_sent"`
+	Recovered        int64            `json:"recovered"`
+	RecoveryRate     float64          `json:"recovery_rate"`     // Recovered / recovery sent, in percent
+	RecoveredRevenue map[string]int64 `json:"recovered_revenue"` // By currency, in the smallest unit
+}
+
+// shopifyCheckout is the part of a Shopify checkout webhook payload used for recovery
+type shopifyCheckout struct {
+	Token                string    `json:"token"`
+	AbandonedCheckoutURL string    `json:"abandoned_checkout_url"`
+	Phone                string    `json:"phone"`
+	Currency             string    `json:"currency"`
+	TotalPrice           string    `json:"total_price"`
+	CompletedAt          *string   `json:"completed_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+	Customer             *struct {
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Phone     string `json:"phone"`
+	} `json:"customer"`
+	ShippingAddress *shopifyAddress `json:"shipping_address"`
+	BillingAddress  *shopifyAddress `json:"billing_address"`
+	LineItems       []struct {
+		Title    string `json:"title"`
+		Quantity int    `json:"quantity"`
+		Price    string `json:"price"`
+	} `json:"line_items"`
+}
+
+type shopifyAddress struct {
+	FirstName string `json:"first_name"`
+	Phone     string `json:"phone"`
+}
+
+// shopifyOrder is the part of a Shopify order webhook payload used for recovery
+type shopifyOrder struct {
+	ID            int64  `json:"id"`
+	CheckoutToken string `json:"checkout_token"`
+	TotalPrice    string `json:"total_price"`
+	Currency      string `json:"currency"`
+}
+
+// abandonedCartSettings reads the abandoned cart settings from organization settings
+func abandonedCartSettings(settings models.JSONB) AbandonedCartSettings {
+	cart := AbandonedCartSettings{DelayMinutes: defaultCartRecoveryDelay}
+	raw, ok := settings["abandoned_cart"].(map[string]interface{})
+	if !ok {
+		return cart
+	}
+	cart.Enabled, _ = raw["enabled"].(bool)
+	if delay := jsonbInt64(raw["delay_minutes"]); delay > 0 {
+		cart.DelayMinutes = int(delay)
+	}
+	cart.WhatsAppAccount, _ = raw["whatsapp_account"].(string)
+	cart.TemplateID, _ = raw["template_id"].(string)
+	if params, ok := raw["template_params"].(map[string]interface{}); ok {
+		cart.TemplateParams = jsonbToStringMap(params)
+	}
+	cart.ShopifyWebhookSecret, _ = raw["shopify_webhook_secret"].(string)
+	return cart
+}
+
+// loadAbandonedCartSettings loads an organization's abandoned cart settings
+func (a *App) loadAbandonedCartSettings(orgID uuid.UUID) (AbandonedCartSettings, error) {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return AbandonedCartSettings{}, err
+	}
+	return abandonedCartSettings(org.Settings), nil
+}
+
+// abandonedCartSettingsResponse is the settings as returned by the API. The webhook
+// secret is never returned, only whether it's set.
+func (a *App) abandonedCartSettingsResponse(r *fastglue.Request, orgID uuid.UUID, cart AbandonedCartSettings) map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":                    cart.Enabled,
+		"delay_minutes":              cart.DelayMinutes,
+		"whatsapp_account":           cart.WhatsAppAccount,
+		"template_id":                cart.TemplateID,
+		"template_params":            cart.TemplateParams,
+		"shopify_webhook_secret_set": cart.ShopifyWebhookSecret != "",
+		"shopify_webhook_url":        fmt.Sprintf("%s/api/integrations/shopify/%s/webhook", a.publicBaseURL(r), orgID),
+	}
+}
+
+// GetAbandonedCartSettings returns the organization's abandoned cart settings
+func (a *App) GetAbandonedCartSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	cart, err := a.loadAbandonedCartSettings(orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	return r.SendEnvelope(a.abandonedCartSettingsResponse(r, orgID, cart))
+}
+
+// UpdateAbandonedCartSettings updates the organization's abandoned cart settings
+func (a *App) UpdateAbandonedCartSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req AbandonedCartSettingsRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	before := orgSettingsAuditSnapshot(&org)
+	cart := abandonedCartSettings(org.Settings)
+
+	if req.Enabled != nil {
+		cart.Enabled = *req.Enabled
+	}
+	if req.DelayMinutes != nil {
+		if *req.DelayMinutes < 1 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "delay_minutes must be at least 1", nil, "")
+		}
+		cart.DelayMinutes = *req.DelayMinutes
+	}
+	if req.WhatsAppAccount != nil {
+		cart.WhatsAppAccount = *req.WhatsAppAccount
+	}
+	if req.TemplateID != nil {
+		cart.TemplateID = *req.TemplateID
+	}
+	if req.TemplateParams != nil {
+		cart.TemplateParams = req.TemplateParams
+	}
+	if req.ShopifyWebhookSecret != nil {
+		cart.ShopifyWebhookSecret = strings.TrimSpace(*req.ShopifyWebhookSecret)
+	}
+
+	if cart.WhatsAppAccount != "" {
+		var count int64
+		a.DB.Model(&models.WhatsAppAccount{}).Where("organization_id = ? AND name = ?", orgID, cart.WhatsAppAccount).Count(&count)
+		if count == 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "WhatsApp account not found", nil, "")
+		}
+	}
+	if cart.TemplateID != "" {
+		templateID, err := uuid.Parse(cart.TemplateID)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid template_id", nil, "")
+		}
+		var template models.Template
+		if err := a.DB.Where("id = ? AND organization_id = ?", templateID, orgID).First(&template).Error; err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Recovery template not found", nil, "")
+		}
+		if template.Status != string(models.TemplateStatusApproved) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Recovery template is not approved (status: %s)", template.Status), nil, "")
+		}
+		if missingParams, paramNames := missingTemplateParams(&template, cart.TemplateParams); len(missingParams) > 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+				fmt.Sprintf("Missing recovery template parameters: %s. Expected parameters: %v", strings.Join(missingParams, ", "), paramNames),
+				nil, "")
+		}
+	}
+	if cart.Enabled && (cart.TemplateID == "" || cart.ShopifyWebhookSecret == "") {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "A recovery template and the Shopify webhook secret are required to turn on cart recovery", nil, "")
+	}
+
+	if org.Settings == nil {
+		org.Settings = models.JSONB{}
+	}
+	org.Settings["abandoned_cart"] = map[string]interface{}{
+		"enabled":                cart.Enabled,
+		"delay_minutes":          cart.DelayMinutes,
+		"whatsapp_account":       cart.WhatsAppAccount,
+		"template_id":            cart.TemplateID,
+		"template_params":        stringMapToJSONB(cart.TemplateParams),
+		"shopify_webhook_secret": cart.ShopifyWebhookSecret,
+	}
+	if err := a.DB.Save(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	a.recordOrgSettingsAudit(r, &org, before)
+
+	return r.SendEnvelope(a.abandonedCartSettingsResponse(r, orgID, cart))
+}
+
+// verifyShopifySignature checks the HMAC Shopify signs webhook bodies with
+func verifyShopifySignature(body []byte, signature, secret string) bool {
+	if signature == "" || secret == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// ShopifyWebhook receives checkout, order and fulfillment webhooks from a Shopify store
+func (a *App) ShopifyWebhook(r *fastglue.Request) error {
+	orgIDStr, _ := r.RequestCtx.UserValue("org_id").(string)
+	orgID, err := uuid.Parse(orgIDStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Not found", nil, "")
+	}
+
+	cart, err := a.loadAbandonedCartSettings(orgID)
+	if err != nil || cart.ShopifyWebhookSecret == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Not found", nil, "")
+	}
+
+	body := r.RequestCtx.PostBody()
+	signature := string(r.RequestCtx.Request.Header.Peek("X-Shopify-Hmac-Sha256"))
+	if !verifyShopifySignature(body, signature, cart.ShopifyWebhookSecret) {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Invalid signature", nil, "")
+	}
+
+	topic := string(r.RequestCtx.Request.Header.Peek("X-Shopify-Topic"))
+	switch topic {
+	case "checkouts/create", "checkouts/update":
+		var checkout shopifyCheckout
+		if err := json.Unmarshal(body, &checkout); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid checkout", nil, "")
+		}
+		if err := a.upsertShopifyCheckout(orgID, cart, &checkout); err != nil {
+			a.Log.Error("Failed to store checkout", "error", err, "org_id", orgID, "token", checkout.Token)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to store checkout", nil, "")
+		}
+	case "orders/create":
+		var order shopifyOrder
+		if err := json.Unmarshal(body, &order); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid order", nil, "")
+		}
+		a.recordCheckoutOrder(orgID, &order)
+	case "fulfillments/create":
+		var fulfillment shopify.Fulfillment
+		if err := json.Unmarshal(body, &fulfillment); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid fulfillment", nil, "")
+		}
+		a.enrollShippingSequence(r.RequestCtx, orgID, &fulfillment)
+	default:
+		a.Log.Debug("Ignoring Shopify webhook", "topic", topic, "org_id", orgID)
+	}
+
+	return r.SendEnvelope(map[string]string{"status": "ok"})
+}
+
+// upsertShopifyCheckout stores a checkout. Each update of an open checkout pushes its
+// recovery back, since the customer is still shopping.
+func (a *App) upsertShopifyCheckout(orgID uuid.UUID, cart AbandonedCartSettings, sc *shopifyCheckout) error {
+	if sc.Token == "" {
+		return fmt.Errorf("checkout has no token")
+	}
+
+	phone := sc.Phone
+	name := ""
+	if sc.Customer != nil {
+		if phone == "" {
+			phone = sc.Customer.Phone
+		}
+		name = strings.TrimSpace(sc.Customer.FirstName + " " + sc.Customer.LastName)
+	}
+	for _, addr := range []*shopifyAddress{sc.ShippingAddress, sc.BillingAddress} {
+		if addr == nil {
+			continue
+		}
+		if phone == "" {
+			phone = addr.Phone
+		}
+		if name == "" {
+			name = addr.FirstName
+		}
+	}
+
+	items := make(models.JSONBArray, 0, len(sc.LineItems))
+	for _, item := range sc.LineItems {
+		price, _ := parsePrice(item.Price)
+		items = append(items, map[string]interface{}{
+			"title":    item.Title,
+			"quantity": item.Quantity,
+			"price":    price,
+		})
+	}
+	total, _ := parsePrice(sc.TotalPrice)
+
+	updatedAt := sc.UpdatedAt
+	if updatedAt.IsZero() {
+		updatedAt = time.Now()
+	}
+
+	checkout := models.Checkout{
+		OrganizationID: orgID,
+		Source:         models.CheckoutSourceShopify,
+		ExternalID:     sc.Token,
+		PhoneNumber:    searchPhoneDigits(phone),
+		CustomerName:   name,
+		Items:          items,
+		Total:          total,
+		Currency:       strings.ToUpper(sc.Currency),
+		CheckoutURL:    sc.AbandonedCheckoutURL,
+		Status:         models.CheckoutStatusOpen,
+		RecoverAt:      updatedAt.Add(time.Duration(cart.DelayMinutes) * time.Minute),
+	}
+
+	var existing models.Checkout
+	err := a.DB.Where("organization_id = ? AND source = ? AND external_id = ?", orgID, checkout.Source, checkout.ExternalID).
+		First(&existing).Error
+	if err != nil {
+		if sc.CompletedAt != nil {
+			// Completed before it was ever seen, nothing to recover
+			return nil
+		}
+		return a.DB.Create(&checkout).Error
+	}
+
+	if existing.Status != models.CheckoutStatusOpen {
+		return nil
+	}
+	if sc.CompletedAt != nil {
+		return a.DB.Model(&existing).Where("status = ?", models.CheckoutStatusOpen).
+			Update("status", models.CheckoutStatusCompleted).Error
+	}
+	return a.DB.Model(&existing).Where("status = ?", models.CheckoutStatusOpen).Updates(map[string]interface{}{
+		"phone_number":  checkout.PhoneNumber,
+		"customer_name": checkout.CustomerName,
+		"items":         checkout.Items,
+		"total":         checkout.Total,
+		"currency":      checkout.Currency,
+		"checkout_url":  checkout.CheckoutURL,
+		"recover_at":    checkout.RecoverAt,
+	}).Error
+}
+
+// recordCheckoutOrder marks the checkout an order was placed from as recovered if
+// its recovery message was sent, or as completed otherwise
+func (a *App) recordCheckoutOrder(orgID uuid.UUID, order *shopifyOrder) {
+	if order.CheckoutToken == "" {
+		return
+	}
+
+	var checkout models.Checkout
+	if err := a.DB.Where("organization_id = ? AND source = ? AND external_id = ?", orgID, models.CheckoutSourceShopify, order.CheckoutToken).
+		First(&checkout).Error; err != nil {
+		return
+	}
+	a.exitAbandonedCartSequence(&checkout)
+
+	total, _ := parsePrice(order.TotalPrice)
+	now := time.Now()
+	updates := map[string]interface{}{
+		"order_id":    strconv.FormatInt(order.ID, 10),
+		"order_total": total,
+		"ordered_at":  now,
+	}
+
+	updates["status"] = models.CheckoutStatusRecovered
+	result := a.DB.Model(&checkout).Where("status = ?", models.CheckoutStatusSent).Updates(updates)
+	if result.Error == nil && result.RowsAffected > 0 {
+		a.Log.Info("Abandoned cart recovered", "checkout_id", checkout.ID, "order_id", order.ID, "total", total)
+		return
+	}
+
+	updates["status"] = models.CheckoutStatusCompleted
+	a.DB.Model(&checkout).
+		Where("status IN ?", []models.CheckoutStatus{models.CheckoutStatusOpen, models.CheckoutStatusSending, models.CheckoutStatusSkipped, models.CheckoutStatusFailed}).
+		Updates(updates)
+}
+
+// checkoutVariables are the values recovery template parameters can use
+func checkoutVariables(c *models.Checkout) map[string]interface{} {
+	items := make([]string, 0, len(c.Items))
+	for _, raw := range c.Items {
+		item, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		title, _ := item["title"].(string)
+		quantity := jsonbInt64(item["quantity"])
+		if quantity > 1 {
+			items = append(items, fmt.Sprintf("%dx %s", quantity, title))
+		} else {
+			items = append(items, title)
+		}
+	}
+
+	name := c.CustomerName
+	if name == "" {
+		name = "there"
+	}
+
+	// Template parameters can't contain new lines, so items are joined on one line
+	return map[string]interface{}{
+		"name":         name,
+		"items":        strings.Join(items, ", "),
+		"total":        formatAmount(c.Total, c.Currency),
+		"checkout_url": c.CheckoutURL,
+	}
+}
+
+// sendCartRecovery sends the recovery template for a claimed checkout
+func (a *App) sendCartRecovery(ctx context.Context, c *models.Checkout) {
+	cart, err := a.loadAbandonedCartSettings(c.OrganizationID)
+	if err != nil {
+		a.finishCartRecovery(c, models.CheckoutStatusFailed, "organization not found")
+		return
+	}
+	if !cart.Enabled {
+		a.finishCartRecovery(c, models.CheckoutStatusSkipped, "cart recovery is turned off")
+		return
+	}
+	if c.PhoneNumber == "" {
+		a.finishCartRecovery(c, models.CheckoutStatusSkipped, "checkout has no phone number")
+		return
+	}
+
+	templateID, _ := uuid.Parse(cart.TemplateID)
+	var template models.Template
+	if err := a.DB.Where("id = ? AND organization_id = ?", templateID, c.OrganizationID).First(&template).Error; err != nil {
+		a.finishCartRecovery(c, models.CheckoutStatusFailed, "recovery template not found")
+		return
+	}
+	if template.Status != string(models.TemplateStatusApproved) {
+		a.finishCartRecovery(c, models.CheckoutStatusFailed, fmt.Sprintf("recovery template is not approved (status: %s)", template.Status))
+		return
+	}
+
+	account, err := a.resolveWhatsAppAccount(c.OrganizationID, cart.WhatsAppAccount)
+	if err != nil {
+		a.finishCartRecovery(c, models.CheckoutStatusFailed, err.Error())
+		return
+	}
+	contact, _ := a.getOrCreateContact(c.OrganizationID, c.PhoneNumber, c.CustomerName)
+	if contact != nil && contact.OptInStatus == models.ContactOptInStatusOptedOut {
+		a.finishCartRecovery(c, models.CheckoutStatusSkipped, "contact has opted out")
+		return
+	}
+
+	vars := checkoutVariables(c)
+	params := make(map[string]string, len(cart.TemplateParams))
+	for k, v := range cart.TemplateParams {
+		params[k] = processTemplate(v, vars)
+	}
+
+	opts := APISendOptions()
+	opts.Async = false
+	message, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account:    account,
+		Contact:    contact,
+		Type:       models.MessageTypeTemplate,
+		Template:   &template,
+		BodyParams: params,
+	}, opts)
+	if err != nil {
+		a.finishCartRecovery(c, models.CheckoutStatusFailed, err.Error())
+		return
+	}
+
+	var sent models.Message
+	if err := a.DB.Select("status", "error_message").Where("id = ?", message.ID).First(&sent).Error; err == nil &&
+		sent.Status == models.MessageStatusFailed {
+		a.finishCartRecovery(c, models.CheckoutStatusFailed, sent.ErrorMessage)
+		return
+	}
+
+	now := time.Now()
+	a.DB.Model(c).Where("status = ?", models.CheckoutStatusSending).Updates(map[string]interface{}{
+		"status":           models.CheckoutStatusSent,
+		"recovery_sent_at": now,
+		"message_id":       message.ID,
+		"contact_id":       contact.ID,
+	})
+
+	a.log(ctx).Info("Abandoned cart recovery sent", "checkout_id", c.ID, "contact_id", contact.ID, "message_id", message.ID)
+}
+
+// finishCartRecovery records why a claimed checkout's recovery wasn't sent
+func (a *App) finishCartRecovery(c *models.Checkout, status models.CheckoutStatus, reason string) {
+	if status == models.CheckoutStatusFailed {
+		a.Log.Error("Failed to send abandoned cart recovery", "error", reason, "checkout_id", c.ID)
+	}
+	a.DB.Model(c).Where("status = ?", models.CheckoutStatusSending).Updates(map[string]interface{}{
+		"status":        status,
+		"error_message": reason,
+	})
+}
+
+// GetAbandonedCartReport returns how many abandoned carts were recovered, and the
+// revenue of their orders
+func (a *App) GetAbandonedCartReport(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceAnalytics, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if v := string(args.Peek("from")); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'from' date format. Use YYYY-MM-DD", nil, "")
+		}
+	}
+	if v := string(args.Peek("to")); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'to' date format. Use YYYY-MM-DD", nil, "")
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	report, err := a.abandonedCartReport(orgID, from, to)
+	if err != nil {
+		a.Log.Error("Failed to load abandoned cart report", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load abandoned cart report", nil, "")
+	}
+
+	return r.SendEnvelope(report)
+}
+
+// abandonedCartReport summarizes the checkouts started in [from, to)
+func (a *App) abandonedCartReport(orgID uuid.UUID, from, to time.Time) (*AbandonedCartReport, error) {
+	var counts struct {
+		Checkouts    int64
+		RecoverySent int64
+		Recovered    int64
+	}
+	if err := a.DB.Model(&models.Checkout{}).
+		Where("organization_id = ? AND created_at >= ? AND created_at < ?", orgID, from, to).
+		Select("COUNT(*) AS checkouts, COUNT(recovery_sent_at) AS recovery_sent, COUNT(*) FILTER (WHERE status = ?) AS recovered", models.CheckoutStatusRecovered).
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+
+	var revenue []struct {
+		Currency string
+		Total    int64
+	}
+	if err := a.DB.Model(&models.Checkout{}).
+		Where("organization_id = ? AND created_at >= ? AND created_at < ? AND status = ?", orgID, from, to, models.CheckoutStatusRecovered).
+		Select("currency, COALESCE(SUM(order_total), 0) AS total").
+		Group("currency").
+		Scan(&revenue).Error; err != nil {
+		return nil, err
+	}
+
+	report := &AbandonedCartReport{
+		Checkouts:        counts.Checkouts,
+		RecoverySent:     counts.RecoverySent,
+		Recovered:        counts.Recovered,
+		RecoveredRevenue: make(map[string]int64, len(revenue)),
+	}
+	if counts.RecoverySent > 0 {
+		report.RecoveryRate = float64(counts.Recovered) * 100 / float64(counts.RecoverySent)
+	}
+	for _, row := range revenue {
+		report.RecoveredRevenue[row.Currency] = row.Total
+	}
+	return report, nil
+}
+
+// AbandonedCartProcessor sends recovery templates for checkouts that weren't ordered
+// within the organization's recovery delay
+type AbandonedCartProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewAbandonedCartProcessor creates a new abandoned cart processor
+func NewAbandonedCartProcessor(app *App, interval time.Duration) *AbandonedCartProcessor {
+	return &AbandonedCartProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the abandoned cart processing loop
+func (p *AbandonedCartProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Abandoned cart processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Abandoned cart processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Abandoned cart processor stopped")
+			return
+		case <-ticker.C:
+			p.processAbandonedCarts(ctx)
+		}
+	}
+}
+
+// Stop stops the abandoned cart processor
+func (p *AbandonedCartProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// processAbandonedCarts sends recovery for open checkouts whose recovery is due
+func (p *AbandonedCartProcessor) processAbandonedCarts(ctx context.Context) {
+	var due []models.Checkout
+	if err := p.app.DB.Where("status = ? AND recover_at <= ?", models.CheckoutStatusOpen, time.Now()).
+		Order("recover_at ASC").
+		Limit(100).
+		Find(&due).Error; err != nil {
+		p.app.Log.Error("Failed to find abandoned checkouts", "error", err)
+		return
+	}
+
+	for i := range due {
+		c := &due[i]
+
+		// Claim the checkout so an order or a concurrent processor can't race it
+		result := p.app.DB.Model(c).
+			Where("status = ?", models.CheckoutStatusOpen).
+			Update("status", models.CheckoutStatusSending)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		p.app.enrollAbandonedCartSequence(c)
+		p.app.sendCartRecovery(ctx, c)
+	}
+}
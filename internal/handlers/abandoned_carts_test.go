@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyShopifySignature(t *testing.T) {
+	body := []byte(`{"token":"abc"}`)
+	mac := hmac.New(sha256.New, []byte("shpss_secret"))
+	mac.Write(body)
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	assert.True(t, verifyShopifySignature(body, signature, "shpss_secret"))
+	assert.False(t, verifyShopifySignature(body, signature, "other"))
+	assert.False(t, verifyShopifySignature([]byte(`{"token":"xyz"}`), signature, "shpss_secret"))
+	assert.False(t, verifyShopifySignature(body, "", "shpss_secret"))
+	assert.False(t, verifyShopifySignature(body, signature, ""))
+}
+
+func TestAbandonedCartSettings(t *testing.T) {
+	cart := abandonedCartSettings(models.JSONB{})
+	assert.False(t, cart.Enabled)
+	assert.Equal(t, defaultCartRecoveryDelay, cart.DelayMinutes)
+
+	cart = abandonedCartSettings(models.JSONB{
+		"abandoned_cart": map[string]interface{}{
+			"enabled":                true,
+			"delay_minutes":          float64(30),
+			"template_id":            "tpl",
+			"template_params":        map[string]interface{}{"1": "{{name}}"},
+			"shopify_webhook_secret": "secret",
+		},
+	})
+	assert.True(t, cart.Enabled)
+	assert.Equal(t, 30, cart.DelayMinutes)
+	assert.Equal(t, "{{name}}", cart.TemplateParams["1"])
+	assert.Equal(t, "secret", cart.ShopifyWebhookSecret)
+}
+
+func TestCheckoutVariables(t *testing.T) {
+	vars := checkoutVariables(&models.Checkout{
+		Items: models.JSONBArray{
+			map[string]interface{}{"title": "Sourdough", "quantity": float64(2)},
+			map[string]interface{}{"title": "Baguette", "quantity": float64(1)},
+		},
+		Total:       1550,
+		Currency:    "USD",
+		CheckoutURL: "https://shop.example.com/checkouts/abc/recover",
+	})
+	assert.Equal(t, "there", vars["name"])
+	assert.Equal(t, "2x Sourdough, Baguette", vars["items"])
+	assert.Equal(t, "USD 15.50", vars["total"])
+	assert.Equal(t, "https://shop.example.com/checkouts/abc/recover", vars["checkout_url"])
+}
+
+func TestShopifyCheckoutRecovery(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Cart Org " + suffix,
+		Slug:      "cart-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	cart := AbandonedCartSettings{DelayMinutes: 60}
+
+	updated := time.Now().Add(-2 * time.Hour)
+	checkout := &shopifyCheckout{
+		Token:                "tok-" + suffix,
+		AbandonedCheckoutURL: "https://shop.example.com/recover",
+		TotalPrice:           "15.50",
+		Currency:             "usd",
+		UpdatedAt:            updated,
+		ShippingAddress:      &shopifyAddress{FirstName: "Ana", Phone: "+1 (555) 010-0001"},
+	}
+	require.NoError(t, app.upsertShopifyCheckout(org.ID, cart, checkout))
+
+	var stored models.Checkout
+	require.NoError(t, app.DB.Where("organization_id = ? AND external_id = ?", org.ID, checkout.Token).First(&stored).Error)
+	assert.Equal(t, models.CheckoutStatusOpen, stored.Status)
+	assert.Equal(t, "15550100001", stored.PhoneNumber)
+	assert.Equal(t, "Ana", stored.CustomerName)
+	assert.Equal(t, int64(1550), stored.Total)
+	assert.Equal(t, "USD", stored.Currency)
+	assert.WithinDuration(t, updated.Add(time.Hour), stored.RecoverAt, time.Second)
+
+	// An order after the recovery message counts as recovered
+	require.NoError(t, app.DB.Model(&stored).Updates(map[string]interface{}{
+		"status":           models.CheckoutStatusSent,
+		"recovery_sent_at": time.Now(),
+	}).Error)
+	app.recordCheckoutOrder(org.ID, &shopifyOrder{ID: 42, CheckoutToken: checkout.Token, TotalPrice: "15.50", Currency: "USD"})
+
+	require.NoError(t, app.DB.First(&stored, "id = ?", stored.ID).Error)
+	assert.Equal(t, models.CheckoutStatusRecovered, stored.Status)
+	assert.Equal(t, "42", stored.OrderID)
+	assert.Equal(t, int64(1550), stored.OrderTotal)
+
+	// An order before recovery is due completes the checkout
+	other := &shopifyCheckout{Token: "tok2-" + suffix, TotalPrice: "3.00", Currency: "USD", Phone: "15550100002"}
+	require.NoError(t, app.upsertShopifyCheckout(org.ID, cart, other))
+	app.recordCheckoutOrder(org.ID, &shopifyOrder{ID: 43, CheckoutToken: other.Token, TotalPrice: "3.00"})
+
+	var completed models.Checkout
+	require.NoError(t, app.DB.Where("organization_id = ? AND external_id = ?", org.ID, other.Token).First(&completed).Error)
+	assert.Equal(t, models.CheckoutStatusCompleted, completed.Status)
+
+	report, err := app.abandonedCartReport(org.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), report.Checkouts)
+	assert.Equal(t, int64(1), report.RecoverySent)
+	assert.Equal(t, int64(1), report.Recovered)
+	assert.Equal(t, float64(100), report.RecoveryRate)
+	assert.Equal(t, int64(1550), report.RecoveredRevenue["USD"])
+}
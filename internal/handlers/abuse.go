@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+const (
+	// maxAbuseWindowSecs is the longest window inbound messages are counted over
+	maxAbuseWindowSecs = 3600
+	// maxAbuseCooldownMins is the longest automatic pause or block, 30 days
+	maxAbuseCooldownMins = 30 * 24 * 60
+	// maxBlockReasonLength is the longest reason kept for a block
+	maxBlockReasonLength = 255
+)
+
+// abusiveContent returns the blocklist entry a message matches, or ""
+func abusiveContent(blocklist []string, text string) string {
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	for _, entry := range blocklist {
+		pattern, err := moderationPattern(entry)
+		if err != nil {
+			continue
+		}
+		if pattern.MatchString(text) {
+			return entry
+		}
+	}
+	return ""
+}
+
+// detectContactAbuse returns why a contact's latest message counts as abuse: more
+// inbound messages within the window than allowed, or text matching the blocklist.
+// It returns "" for messages that don't.
+func (a *App) detectContactAbuse(cfg models.AbuseConfig, contact *models.Contact, text string, now time.Time) string {
+	if cfg.MaxMessages > 0 && cfg.WindowSecs > 0 {
+		var count int64
+		since := now.Add(-time.Duration(cfg.WindowSecs) * time.Second)
+		if err := a.DB.Model(&models.Message{}).
+			Where("contact_id = ? AND direction = ? AND created_at >= ?", contact.ID, models.DirectionIncoming, since).
+			Count(&count).Error; err != nil {
+			a.Log.Error("Failed to count inbound messages", "error", err, "contact_id", contact.ID)
+		} else if count > int64(cfg.MaxMessages) {
+			return fmt.Sprintf("flooding: %d messages in %d seconds", count, cfg.WindowSecs)
+		}
+	}
+	if entry := abusiveContent(cfg.Blocklist, text); entry != "" {
+		return fmt.Sprintf("abusive content: %q", entry)
+	}
+	return ""
+}
+
+// applyAbuseAction pauses the chatbot for the contact, or blocks the contact, for
+// the cool-down
+func (a *App) applyAbuseAction(cfg models.AbuseConfig, contact *models.Contact, reason string, now time.Time) error {
+	cooldown := cfg.CooldownMins
+	if cooldown <= 0 {
+		cooldown = 60
+	}
+	until := now.Add(time.Duration(cooldown) * time.Minute)
+
+	var updates map[string]interface{}
+	if cfg.Action == models.AbuseActionBlock {
+		updates = map[string]interface{}{"blocked_at": now, "blocked_until": until, "block_reason": truncateString(reason, maxBlockReasonLength)}
+	} else {
+		updates = map[string]interface{}{"bot_paused_until": until}
+	}
+	if err := a.DB.Model(&models.Contact{}).Where("id = ?", contact.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	if cfg.Action == models.AbuseActionBlock {
+		contact.BlockedAt, contact.BlockedUntil, contact.BlockReason = &now, &until, truncateString(reason, maxBlockReasonLength)
+	} else {
+		contact.BotPausedUntil = &until
+	}
+	return nil
+}
+
+// checkContactAbuse looks for flooding and abusive content in a contact's message,
+// pausing the chatbot or blocking the contact when the account's settings say so.
+// It reports whether the message should be left unanswered.
+func (a *App) checkContactAbuse(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, text string) bool {
+	now := time.Now()
+	if !contact.IsBlocked(now) && !contact.IsBotPaused(now) {
+		settings, err := a.getChatbotSettingsCached(account.OrganizationID, account.Name)
+		if err == nil && settings.Abuse.Enabled {
+			if reason := a.detectContactAbuse(settings.Abuse, contact, text, now); reason != "" {
+				if err := a.applyAbuseAction(settings.Abuse, contact, reason, now); err != nil {
+					a.log(ctx).Error("Failed to apply abuse action", "error", err, "contact_id", contact.ID)
+				} else {
+					a.log(ctx).Warn("Contact abuse detected", "contact_id", contact.ID, "reason", reason, "action", settings.Abuse.Action)
+				}
+			}
+		}
+	}
+
+	if contact.IsBlocked(now) || contact.IsBotPaused(now) {
+		a.log(ctx).Info("Chatbot paused for contact, skipping chatbot processing", "contact_id", contact.ID)
+		return true
+	}
+	return false
+}
+
+// BlockContactRequest blocks a contact, for a number of minutes or until unblocked
+type BlockContactRequest struct {
+	Reason          string `json:"reason"`
+	DurationMinutes int    `json:"duration_minutes"` // 0 blocks until the contact is unblocked
+}
+
+// BlockContact blocks a contact. Messages from blocked contacts are dropped: they
+// aren't stored, answered by the chatbot or queued for agents.
+func (a *App) BlockContact(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	contactID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact ID", nil, "")
+	}
+
+	var req BlockContactRequest
+	if len(r.RequestCtx.PostBody()) > 0 {
+		if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+		}
+	}
+	if req.DurationMinutes < 0 || req.DurationMinutes > maxAbuseCooldownMins {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("duration_minutes must be between 0 and %d", maxAbuseCooldownMins), nil, "")
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxBlockReasonLength {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("reason must be at most %d characters", maxBlockReasonLength), nil, "")
+	}
+
+	var contact models.Contact
+	if err := a.DB.Where("id = ? AND organization_id = ?", contactID, orgID).First(&contact).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
+	}
+
+	now := time.Now()
+	var until *time.Time
+	if req.DurationMinutes > 0 {
+		t := now.Add(time.Duration(req.DurationMinutes) * time.Minute)
+		until = &t
+	}
+	if err := a.DB.Model(&contact).Updates(map[string]interface{}{
+		"blocked_at":    now,
+		"blocked_until": until,
+		"block_reason":  req.Reason,
+	}).Error; err != nil {
+		a.Log.Error("Failed to block contact", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to block contact", nil, "")
+	}
+	contact.BlockedAt, contact.BlockedUntil, contact.BlockReason = &now, until, req.Reason
+
+	a.Log.Info("Contact blocked", "contact_id", contact.ID, "until", until, "user_id", userID)
+	return r.SendEnvelope(a.contactToResponse(&contact, a.ShouldMaskPhoneNumbers(orgID), now))
+}
+
+// UnblockContact lifts a contact's block and any pause of the chatbot
+func (a *App) UnblockContact(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	contactID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact ID", nil, "")
+	}
+
+	var contact models.Contact
+	if err := a.DB.Where("id = ? AND organization_id = ?", contactID, orgID).First(&contact).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
+	}
+
+	if err := a.DB.Model(&contact).Updates(map[string]interface{}{
+		"blocked_at":       nil,
+		"blocked_until":    nil,
+		"block_reason":     "",
+		"bot_paused_until": nil,
+	}).Error; err != nil {
+		a.Log.Error("Failed to unblock contact", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to unblock contact", nil, "")
+	}
+	contact.BlockedAt, contact.BlockedUntil, contact.BlockReason, contact.BotPausedUntil = nil, nil, "", nil
+
+	a.Log.Info("Contact unblocked", "contact_id", contact.ID, "user_id", userID)
+	return r.SendEnvelope(a.contactToResponse(&contact, a.ShouldMaskPhoneNumbers(orgID), time.Now()))
+}
+
+// ListBlockedContacts returns the organization's blocked contacts, most recently
+// blocked first. With paused=true it also returns contacts the chatbot is paused for.
+func (a *App) ListBlockedContacts(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	page, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("page")))
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	now := time.Now()
+	condition := "(blocked_at IS NOT NULL AND (blocked_until IS NULL OR blocked_until > ?))"
+	args := []interface{}{now}
+	if string(r.RequestCtx.QueryArgs().Peek("paused")) == "true" {
+		condition += " OR bot_paused_until > ?"
+		args = append(args, now)
+	}
+	query := a.DB.Model(&models.Contact{}).Where("organization_id = ?", orgID).Where(condition, args...)
+
+	var total int64
+	query.Count(&total)
+
+	var contacts []models.Contact
+	if err := query.Order("blocked_at DESC NULLS LAST, bot_paused_until DESC").
+		Offset((page - 1) * limit).Limit(limit).Find(&contacts).Error; err != nil {
+		a.Log.Error("Failed to list blocked contacts", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list blocked contacts", nil, "")
+	}
+
+	shouldMask := a.ShouldMaskPhoneNumbers(orgID)
+	response := make([]ContactResponse, len(contacts))
+	for i := range contacts {
+		response[i] = a.contactToResponse(&contacts[i], shouldMask, now)
+	}
+	return r.SendEnvelope(map[string]any{
+		"contacts": response,
+		"total":    total,
+		"page":     page,
+		"limit":    limit,
+	})
+}
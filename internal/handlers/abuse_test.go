@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAbusiveContent(t *testing.T) {
+	blocklist := []string{"scam", "/fr+ee money/"}
+	assert.Equal(t, "scam", abusiveContent(blocklist, "This is a SCAM!"))
+	assert.Equal(t, "/fr+ee money/", abusiveContent(blocklist, "get frrree money now"))
+	assert.Empty(t, abusiveContent(blocklist, "scampi for dinner"))
+	assert.Empty(t, abusiveContent(blocklist, ""))
+	assert.Empty(t, abusiveContent(nil, "scam"))
+}
+
+func TestContactBlockState(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	assert.False(t, (&models.Contact{}).IsBlocked(now))
+	assert.True(t, (&models.Contact{BlockedAt: &past}).IsBlocked(now))
+	assert.True(t, (&models.Contact{BlockedAt: &past, BlockedUntil: &future}).IsBlocked(now))
+	assert.False(t, (&models.Contact{BlockedAt: &past, BlockedUntil: &past}).IsBlocked(now))
+
+	assert.False(t, (&models.Contact{}).IsBotPaused(now))
+	assert.True(t, (&models.Contact{BotPausedUntil: &future}).IsBotPaused(now))
+	assert.False(t, (&models.Contact{BotPausedUntil: &past}).IsBotPaused(now))
+}
+
+func TestDetectContactAbuse(t *testing.T) {
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger()}
+	_, contact, _ := sequenceTestContact(t, app, nil)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, app.DB.Create(&models.Message{
+			BaseModel:       models.BaseModel{ID: uuid.New()},
+			OrganizationID:  contact.OrganizationID,
+			WhatsAppAccount: contact.WhatsAppAccount,
+			ContactID:       contact.ID,
+			Direction:       models.DirectionIncoming,
+			MessageType:     models.MessageTypeText,
+			Content:         "hi",
+		}).Error)
+	}
+
+	cfg := models.AbuseConfig{Enabled: true, MaxMessages: 3, WindowSecs: 60, Blocklist: models.StringArray{"scam"}, CooldownMins: 30}
+	assert.Empty(t, app.detectContactAbuse(cfg, contact, "hi", now))
+	assert.Equal(t, `abusive content: "scam"`, app.detectContactAbuse(cfg, contact, "total scam", now))
+
+	cfg.MaxMessages = 2
+	reason := app.detectContactAbuse(cfg, contact, "hi", now)
+	assert.Equal(t, "flooding: 3 messages in 60 seconds", reason)
+
+	// The chatbot is paused for the cool-down
+	require.NoError(t, app.applyAbuseAction(cfg, contact, reason, now))
+	assert.True(t, contact.IsBotPaused(now))
+	assert.False(t, contact.IsBlocked(now))
+
+	// Or the contact is blocked
+	cfg.Action = models.AbuseActionBlock
+	require.NoError(t, app.applyAbuseAction(cfg, contact, reason, now))
+	var stored models.Contact
+	require.NoError(t, app.DB.Where("id = ?", contact.ID).First(&stored).Error)
+	assert.True(t, stored.IsBlocked(now))
+	assert.False(t, stored.IsBlocked(now.Add(31*time.Minute)))
+	assert.Equal(t, reason, stored.BlockReason)
+}
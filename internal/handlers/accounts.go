@@ -4,48 +4,89 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
 	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
 )
 
+// defaultAccountAPIVersion is the Graph API version of accounts that don't set one
+const defaultAccountAPIVersion = "v21.0"
+
+// maxMessagesPerSecond is the highest throughput the Cloud API offers a number
+const maxMessagesPerSecond = 1000
+
 // AccountRequest represents the request body for creating/updating an account
 type AccountRequest struct {
-	Name               string `json:"name" validate:"required"`
-	AppID              string `json:"app_id"`
-	PhoneID            string `json:"phone_id" validate:"required"`
-	BusinessID         string `json:"business_id" validate:"required"`
-	AccessToken        string `json:"access_token" validate:"required"`
-	WebhookVerifyToken string `json:"webhook_verify_token"`
-	APIVersion         string `json:"api_version"`
-	IsDefaultIncoming  bool   `json:"is_default_incoming"`
-	IsDefaultOutgoing  bool   `json:"is_default_outgoing"`
-	AutoReadReceipt    bool   `json:"auto_read_receipt"`
+	Name               string            `json:"name" validate:"required"`
+	AppID              string            `json:"app_id"`
+	PhoneID            string            `json:"phone_id" validate:"required"`
+	BusinessID         string            `json:"business_id" validate:"required"`
+	AccessToken        string            `json:"access_token" validate:"required"`
+	AppSecret          string            `json:"app_secret"` // Verifies webhook signatures when the app isn't whatsapp.app_secret's
+	WebhookVerifyToken string            `json:"webhook_verify_token"`
+	APIVersion         string            `json:"api_version"`
+	IsDefaultIncoming  bool              `json:"is_default_incoming"`
+	IsDefaultOutgoing  bool              `json:"is_default_outgoing"`
+	AutoReadReceipt    bool              `json:"auto_read_receipt"`
+	TypingIndicator    bool              `json:"typing_indicator"`
+	PresencePrivacy    bool              `json:"presence_privacy"`
+	FailoverAccount    string            `json:"failover_account"`    // Backup number for template sends
+	FailoverTemplates  map[string]string `json:"failover_templates"`  // Template name -> template name on the backup
+	MessagesPerSecond  int               `json:"messages_per_second"` // Send throughput, 0 uses the default
+
+	// The API the number sends through: cloud, or on_premise with its server and token
+	APIType       string `json:"api_type"`
+	APIURL        string `json:"api_url"`
+	APIToken      string `json:"api_token"`
+	APIAuthHeader string `json:"api_auth_header"` // Header the token goes in, for BSPs that don't take a bearer token
 }
 
 // AccountResponse represents the response for an account (without sensitive data)
 type AccountResponse struct {
-	ID                 uuid.UUID `json:"id"`
-	Name               string    `json:"name"`
-	AppID              string    `json:"app_id"`
-	PhoneID            string    `json:"phone_id"`
-	BusinessID         string    `json:"business_id"`
-	WebhookVerifyToken string    `json:"webhook_verify_token"`
-	APIVersion         string    `json:"api_version"`
-	IsDefaultIncoming  bool      `json:"is_default_incoming"`
-	IsDefaultOutgoing  bool      `json:"is_default_outgoing"`
-	AutoReadReceipt    bool      `json:"auto_read_receipt"`
-	Status             string    `json:"status"`
-	HasAccessToken     bool      `json:"has_access_token"`
-	PhoneNumber        string    `json:"phone_number,omitempty"`
-	DisplayName        string    `json:"display_name,omitempty"`
-	CreatedAt          string    `json:"created_at"`
-	UpdatedAt          string    `json:"updated_at"`
+	ID                 uuid.UUID    `json:"id"`
+	Name               string       `json:"name"`
+	Channel            string       `json:"channel"`
+	AppID              string       `json:"app_id"`
+	PhoneID            string       `json:"phone_id"`
+	BusinessID         string       `json:"business_id"`
+	WebhookVerifyToken string       `json:"webhook_verify_token"`
+	APIVersion         string       `json:"api_version"`
+	IsDefaultIncoming  bool         `json:"is_default_incoming"`
+	IsDefaultOutgoing  bool         `json:"is_default_outgoing"`
+	AutoReadReceipt    bool         `json:"auto_read_receipt"`
+	TypingIndicator    bool         `json:"typing_indicator"`
+	PresencePrivacy    bool         `json:"presence_privacy"`
+	FailoverAccount    string       `json:"failover_account"`
+	FailoverTemplates  models.JSONB `json:"failover_templates"`
+	FailoverActiveAt   *time.Time   `json:"failover_active_at,omitempty"`
+	FailoverReason     string       `json:"failover_reason,omitempty"`
+	QualityRating      string       `json:"quality_rating,omitempty"`
+	MessagingLimitTier string       `json:"messaging_limit_tier,omitempty"`
+	HealthCheckedAt    *time.Time   `json:"health_checked_at,omitempty"`
+	MessagesPerSecond  int          `json:"messages_per_second"`
+	ConversationLimit  int          `json:"conversation_limit"` // Business-initiated conversations per 24 hours, 0 when not limited
+	Status             string       `json:"status"`
+	HasAccessToken     bool         `json:"has_access_token"`
+	HasAppSecret       bool         `json:"has_app_secret"`
+	APIType            string       `json:"api_type"`
+	APIURL             string       `json:"api_url,omitempty"`
+	APIAuthHeader      string       `json:"api_auth_header,omitempty"`
+	HasAPIToken        bool         `json:"has_api_token"`
+	PhoneNumber        string       `json:"phone_number,omitempty"`
+	DisplayName        string       `json:"display_name,omitempty"`
+	CreatedAt          string       `json:"created_at"`
+	UpdatedAt          string       `json:"updated_at"`
 }
 
 // ListAccounts returns all WhatsApp accounts for the organization
@@ -79,6 +120,10 @@ func (a *App) CreateAccount(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
 	}
 
+	if a.accountLimitReached(orgID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureMultipleAccounts), nil, "")
+	}
+
 	var req AccountRequest
 	if err := r.Decode(&req, "json"); err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
@@ -89,6 +134,25 @@ func (a *App) CreateAccount(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Name, phone_id, business_id, and access_token are required", nil, "")
 	}
 
+	if err := a.validateFailoverAccount(orgID, req.Name, req.FailoverAccount); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	if req.MessagesPerSecond < 0 || req.MessagesPerSecond > maxMessagesPerSecond {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("messages_per_second must be between 0 and %d", maxMessagesPerSecond), nil, "")
+	}
+	if err := a.checkCredential(r.RequestCtx, orgID, req.AccessToken); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "access_token: "+err.Error(), nil, "")
+	}
+	if err := a.checkCredential(r.RequestCtx, orgID, req.AppSecret); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "app_secret: "+err.Error(), nil, "")
+	}
+	if err := validateAccountAPI(req.APIType, req.APIURL, req.APIToken); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	if err := a.checkCredential(r.RequestCtx, orgID, req.APIToken); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "api_token: "+err.Error(), nil, "")
+	}
+
 	// Generate webhook verify token if not provided
 	webhookVerifyToken := req.WebhookVerifyToken
 	if webhookVerifyToken == "" {
@@ -98,7 +162,7 @@ func (a *App) CreateAccount(r *fastglue.Request) error {
 	// Set default API version
 	apiVersion := req.APIVersion
 	if apiVersion == "" {
-		apiVersion = "v21.0"
+		apiVersion = defaultAccountAPIVersion
 	}
 
 	account := models.WhatsAppAccount{
@@ -107,12 +171,22 @@ func (a *App) CreateAccount(r *fastglue.Request) error {
 		AppID:              req.AppID,
 		PhoneID:            req.PhoneID,
 		BusinessID:         req.BusinessID,
-		AccessToken:        req.AccessToken, // TODO: encrypt before storing
+		AccessToken:        req.AccessToken,
+		AppSecret:          req.AppSecret,
 		WebhookVerifyToken: webhookVerifyToken,
 		APIVersion:         apiVersion,
 		IsDefaultIncoming:  req.IsDefaultIncoming,
 		IsDefaultOutgoing:  req.IsDefaultOutgoing,
 		AutoReadReceipt:    req.AutoReadReceipt,
+		TypingIndicator:    req.TypingIndicator,
+		PresencePrivacy:    req.PresencePrivacy,
+		FailoverAccount:    req.FailoverAccount,
+		FailoverTemplates:  failoverTemplatesJSONB(req.FailoverTemplates),
+		MessagesPerSecond:  req.MessagesPerSecond,
+		APIType:            accountAPIType(req.APIType),
+		APIURL:             req.APIURL,
+		APIToken:           req.APIToken,
+		APIAuthHeader:      req.APIAuthHeader,
 		Status:             "active",
 	}
 
@@ -197,7 +271,16 @@ func (a *App) UpdateAccount(r *fastglue.Request) error {
 		account.BusinessID = req.BusinessID
 	}
 	if req.AccessToken != "" {
-		account.AccessToken = req.AccessToken // TODO: encrypt
+		if err := a.checkCredential(r.RequestCtx, orgID, req.AccessToken); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "access_token: "+err.Error(), nil, "")
+		}
+		account.AccessToken = req.AccessToken
+	}
+	if req.AppSecret != "" {
+		if err := a.checkCredential(r.RequestCtx, orgID, req.AppSecret); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "app_secret: "+err.Error(), nil, "")
+		}
+		account.AppSecret = req.AppSecret
 	}
 	if req.WebhookVerifyToken != "" {
 		account.WebhookVerifyToken = req.WebhookVerifyToken
@@ -206,6 +289,40 @@ func (a *App) UpdateAccount(r *fastglue.Request) error {
 		account.APIVersion = req.APIVersion
 	}
 	account.AutoReadReceipt = req.AutoReadReceipt
+	account.TypingIndicator = req.TypingIndicator
+	account.PresencePrivacy = req.PresencePrivacy
+	if req.MessagesPerSecond < 0 || req.MessagesPerSecond > maxMessagesPerSecond {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("messages_per_second must be between 0 and %d", maxMessagesPerSecond), nil, "")
+	}
+	account.MessagesPerSecond = req.MessagesPerSecond
+
+	// The API is changed when api_type is given. The token is kept unless a new one is.
+	if req.APIType != "" {
+		apiToken := account.APIToken
+		if req.APIToken != "" {
+			if err := a.checkCredential(r.RequestCtx, orgID, req.APIToken); err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "api_token: "+err.Error(), nil, "")
+			}
+			apiToken = req.APIToken
+		}
+		if err := validateAccountAPI(req.APIType, req.APIURL, apiToken); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		account.APIType = req.APIType
+		account.APIURL = req.APIURL
+		account.APIToken = apiToken
+		account.APIAuthHeader = req.APIAuthHeader
+	}
+
+	if err := a.validateFailoverAccount(orgID, account.Name, req.FailoverAccount); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	account.FailoverAccount = req.FailoverAccount
+	account.FailoverTemplates = failoverTemplatesJSONB(req.FailoverTemplates)
+	if account.FailoverAccount == "" {
+		account.FailoverActiveAt = nil
+		account.FailoverReason = ""
+	}
 
 	// Handle default flags
 	if req.IsDefaultIncoming && !account.IsDefaultIncoming {
@@ -256,6 +373,10 @@ func (a *App) DeleteAccount(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete account", nil, "")
 	}
 
+	if account.IsTelegram() {
+		a.deleteTelegramWebhook(r.RequestCtx, &account)
+	}
+
 	// Invalidate cache
 	a.InvalidateWhatsAppAccountCache(account.PhoneID)
 
@@ -280,14 +401,24 @@ func (a *App) TestAccountConnection(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Account not found", nil, "")
 	}
 
+	switch account.AccountChannel() {
+	case models.ChannelTelegram:
+		return a.testTelegramConnection(r, &account)
+	case models.ChannelInstagram, models.ChannelMessenger:
+		return a.testMessengerConnection(r, &account)
+	case models.ChannelWebChat:
+		// Widgets don't connect to any API
+		return r.SendEnvelope(map[string]interface{}{"success": true, "widget_token": account.PhoneID})
+	}
+
 	// Test the connection by fetching phone number details from Meta API
 	url := fmt.Sprintf("%s/%s/%s?fields=display_phone_number,verified_name,quality_rating,messaging_limit_tier",
-		a.Config.WhatsApp.BaseURL, account.APIVersion, account.PhoneID)
+		a.CurrentConfig().WhatsApp.BaseURL, account.APIVersion, account.PhoneID)
 
 	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+account.AccessToken)
+	req.Header.Set("Authorization", "Bearer "+a.toWhatsAppAccount(&account).AccessToken)
 
-	client := &http.Client{}
+	client := a.httpClient(config.OutboundMeta, 0)
 	resp, err := client.Do(req)
 	if err != nil {
 		return r.SendEnvelope(map[string]interface{}{
@@ -323,10 +454,59 @@ func (a *App) TestAccountConnection(r *fastglue.Request) error {
 
 // Helper functions
 
+// accountLimitReached reports whether the organization can't add another account.
+// Plans without multiple accounts are limited to one.
+func (a *App) accountLimitReached(orgID uuid.UUID) bool {
+	if a.HasFeature(orgID, models.PlanFeatureMultipleAccounts) {
+		return false
+	}
+	var count int64
+	a.DB.Model(&models.WhatsAppAccount{}).Where("organization_id = ?", orgID).Count(&count)
+	return count > 0
+}
+
+// accountExists reports whether the named WhatsApp account belongs to the organization
+func (a *App) accountExists(orgID uuid.UUID, name string) bool {
+	var count int64
+	a.DB.Model(&models.WhatsAppAccount{}).
+		Where("organization_id = ? AND name = ?", orgID, name).
+		Count(&count)
+	return count > 0
+}
+
+// accountAPIType returns the API type an account is stored with, the Cloud API's
+// when none was given
+func accountAPIType(apiType string) string {
+	if apiType == "" {
+		return whatsapp.APITypeCloud
+	}
+	return apiType
+}
+
+// validateAccountAPI checks the API a number is connected through. Numbers on the
+// On-Premise API need its server's URL and a token.
+func validateAccountAPI(apiType, apiURL, apiToken string) error {
+	if !whatsapp.ValidAPIType(apiType) {
+		return fmt.Errorf("api_type must be %s or %s", whatsapp.APITypeCloud, whatsapp.APITypeOnPremise)
+	}
+	if apiType != whatsapp.APITypeOnPremise {
+		return nil
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("api_url must be the On-Premise API server's http or https URL")
+	}
+	if apiToken == "" {
+		return errors.New("api_token is required for the On-Premise API")
+	}
+	return nil
+}
+
 func accountToResponse(acc models.WhatsAppAccount) AccountResponse {
 	return AccountResponse{
 		ID:                 acc.ID,
 		Name:               acc.Name,
+		Channel:            acc.Channel,
 		AppID:              acc.AppID,
 		PhoneID:            acc.PhoneID,
 		BusinessID:         acc.BusinessID,
@@ -335,8 +515,24 @@ func accountToResponse(acc models.WhatsAppAccount) AccountResponse {
 		IsDefaultIncoming:  acc.IsDefaultIncoming,
 		IsDefaultOutgoing:  acc.IsDefaultOutgoing,
 		AutoReadReceipt:    acc.AutoReadReceipt,
+		TypingIndicator:    acc.TypingIndicator,
+		PresencePrivacy:    acc.PresencePrivacy,
+		FailoverAccount:    acc.FailoverAccount,
+		FailoverTemplates:  acc.FailoverTemplates,
+		FailoverActiveAt:   acc.FailoverActiveAt,
+		FailoverReason:     acc.FailoverReason,
+		QualityRating:      acc.QualityRating,
+		MessagingLimitTier: acc.MessagingLimitTier,
+		HealthCheckedAt:    acc.HealthCheckedAt,
+		MessagesPerSecond:  acc.MessagesPerSecond,
+		ConversationLimit:  queue.ConversationLimit(acc.MessagingLimitTier),
 		Status:             acc.Status,
 		HasAccessToken:     acc.AccessToken != "",
+		HasAppSecret:       acc.AppSecret != "",
+		APIType:            acc.APIType,
+		APIURL:             acc.APIURL,
+		APIAuthHeader:      acc.APIAuthHeader,
+		HasAPIToken:        acc.APIToken != "",
 		CreatedAt:          acc.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		UpdatedAt:          acc.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 	}
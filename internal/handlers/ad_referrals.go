@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// IncomingReferral is the ad or post a click-to-WhatsApp message came from
+type IncomingReferral struct {
+	SourceURL    string `json:"source_url"`
+	SourceID     string `json:"source_id"`
+	SourceType   string `json:"source_type"` // ad, post
+	Headline     string `json:"headline,omitempty"`
+	Body         string `json:"body,omitempty"`
+	MediaType    string `json:"media_type,omitempty"` // image, video
+	ImageURL     string `json:"image_url,omitempty"`
+	VideoURL     string `json:"video_url,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	CtwaClid     string `json:"ctwa_clid,omitempty"`
+}
+
+// AdReferralPreview is the ad shown above the message that came from it
+type AdReferralPreview struct {
+	SourceID     string `json:"source_id"`
+	SourceType   string `json:"source_type"`
+	SourceURL    string `json:"source_url,omitempty"`
+	Headline     string `json:"headline,omitempty"`
+	Body         string `json:"body,omitempty"`
+	MediaType    string `json:"media_type,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// AdPerformance is how many conversations an ad started in a period
+type AdPerformance struct {
+	SourceID      string    `json:"source_id"`
+	SourceType    string    `json:"source_type"`
+	SourceURL     string    `json:"source_url"`
+	Headline      string    `json:"headline"`
+	Conversations int64     `json:"conversations"` // Contacts who messaged from the ad
+	NewContacts   int64     `json:"new_contacts"`  // Of those, contacts who first wrote through the ad
+	Referrals     int64     `json:"referrals"`     // Messages sent from the ad, repeat clicks included
+	FirstAt       time.Time `json:"first_at"`
+	LastAt        time.Time `json:"last_at"`
+}
+
+// GetAdAnalytics returns conversations started from click-to-WhatsApp ads, per ad
+func (a *App) GetAdAnalytics(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceAnalytics, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	fromStr := string(args.Peek("from"))
+	toStr := string(args.Peek("to"))
+
+	var periodStart, periodEnd time.Time
+	if fromStr != "" && toStr != "" {
+		periodStart, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'from' date format. Use YYYY-MM-DD", nil, "")
+		}
+		periodEnd, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'to' date format. Use YYYY-MM-DD", nil, "")
+		}
+		periodEnd = periodEnd.Add(24*time.Hour - time.Nanosecond)
+	} else {
+		// Default to the last 30 days
+		periodEnd = time.Now()
+		periodStart = periodEnd.AddDate(0, 0, -30)
+	}
+
+	query := a.DB.Model(&models.AdReferral{}).
+		Where("organization_id = ? AND created_at >= ? AND created_at <= ?", orgID, periodStart, periodEnd)
+	if account := string(args.Peek("account")); account != "" {
+		query = query.Where("whats_app_account = ?", account)
+	}
+
+	var ads []AdPerformance
+	if err := query.
+		Select(`source_id, MAX(source_type) AS source_type, MAX(source_url) AS source_url, MAX(headline) AS headline,
+			COUNT(DISTINCT contact_id) AS conversations,
+			COUNT(DISTINCT contact_id) FILTER (WHERE is_new_contact) AS new_contacts,
+			COUNT(*) AS referrals, MIN(created_at) AS first_at, MAX(created_at) AS last_at`).
+		Group("source_id").
+		Order("conversations DESC").
+		Scan(&ads).Error; err != nil {
+		a.Log.Error("Failed to load ad analytics", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load ad analytics", nil, "")
+	}
+
+	var totalConversations, totalNewContacts int64
+	for _, ad := range ads {
+		totalConversations += ad.Conversations
+		totalNewContacts += ad.NewContacts
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"ads": ads,
+		"summary": map[string]int64{
+			"conversations": totalConversations,
+			"new_contacts":  totalNewContacts,
+		},
+	})
+}
+
+// recordAdReferral stores the ad a message came from, on the message for agents to
+// see and as a referral for ad analytics
+func (a *App) recordAdReferral(account *models.WhatsAppAccount, contact *models.Contact, isNewContact bool, whatsappMsgID string, ref *IncomingReferral) {
+	mediaURL := ref.ImageURL
+	if ref.MediaType == "video" {
+		mediaURL = ref.VideoURL
+	}
+
+	referral := models.AdReferral{
+		OrganizationID:    account.OrganizationID,
+		WhatsAppAccount:   account.Name,
+		ContactID:         contact.ID,
+		WhatsAppMessageID: whatsappMsgID,
+		SourceID:          ref.SourceID,
+		SourceType:        ref.SourceType,
+		SourceURL:         ref.SourceURL,
+		Headline:          ref.Headline,
+		Body:              ref.Body,
+		MediaType:         ref.MediaType,
+		MediaURL:          mediaURL,
+		ThumbnailURL:      ref.ThumbnailURL,
+		CtwaClid:          ref.CtwaClid,
+		IsNewContact:      isNewContact,
+	}
+	if err := a.DB.Create(&referral).Error; err != nil {
+		a.Log.Error("Failed to save ad referral", "error", err, "source_id", ref.SourceID)
+		return
+	}
+
+	var message models.Message
+	if err := a.DB.Where("whats_app_message_id = ? AND organization_id = ?", whatsappMsgID, account.OrganizationID).
+		First(&message).Error; err != nil {
+		a.Log.Error("Failed to find message for ad referral", "error", err, "message_id", whatsappMsgID)
+		return
+	}
+	metadata := message.Metadata
+	if metadata == nil {
+		metadata = models.JSONB{}
+	}
+	metadata["referral"] = AdReferralPreview{
+		SourceID:     ref.SourceID,
+		SourceType:   ref.SourceType,
+		SourceURL:    ref.SourceURL,
+		Headline:     ref.Headline,
+		Body:         ref.Body,
+		MediaType:    ref.MediaType,
+		ThumbnailURL: ref.ThumbnailURL,
+	}
+	if err := a.DB.Model(&message).Update("metadata", metadata).Error; err != nil {
+		a.Log.Error("Failed to store ad referral on message", "error", err, "message_id", whatsappMsgID)
+	}
+
+	a.Log.Info("Conversation started from ad", "contact_id", contact.ID, "source_id", ref.SourceID, "source_type", ref.SourceType)
+}
+
+// startAdsFlow starts the configured ads flow for a conversation from an ad,
+// reporting whether it did
+func (a *App) startAdsFlow(ctx context.Context, account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, settings *models.ChatbotSettings) bool {
+	if settings.AdsFlowID == nil {
+		return false
+	}
+	flow := a.findChatbotFlow(account.OrganizationID, *settings.AdsFlowID)
+	if flow == nil {
+		a.log(ctx).Warn("Ads flow not found", "flow_id", settings.AdsFlowID, "org_id", account.OrganizationID)
+		return false
+	}
+	a.startFlow(ctx, account, session, contact, flow)
+	return true
+}
+
+// adReferralPreview returns the ad stored on a message, if it came from one
+func adReferralPreview(metadata models.JSONB) *AdReferralPreview {
+	raw, ok := metadata["referral"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	field := func(key string) string {
+		s, _ := raw[key].(string)
+		return s
+	}
+	return &AdReferralPreview{
+		SourceID:     field("source_id"),
+		SourceType:   field("source_type"),
+		SourceURL:    field("source_url"),
+		Headline:     field("headline"),
+		Body:         field("body"),
+		MediaType:    field("media_type"),
+		ThumbnailURL: field("thumbnail_url"),
+	}
+}
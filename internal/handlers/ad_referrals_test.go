@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdReferralPreview(t *testing.T) {
+	assert.Nil(t, adReferralPreview(models.JSONB{"reactions": []interface{}{}}))
+
+	preview := adReferralPreview(models.JSONB{
+		"referral": map[string]interface{}{
+			"source_id":   "120210000000",
+			"source_type": "ad",
+			"headline":    "Spring sale",
+		},
+	})
+	require.NotNil(t, preview)
+	assert.Equal(t, "120210000000", preview.SourceID)
+	assert.Equal(t, "ad", preview.SourceType)
+	assert.Equal(t, "Spring sale", preview.Headline)
+	assert.Empty(t, preview.SourceURL)
+}
+
+func TestRecordAdReferral(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Ads Org " + uuid.New().String()[:8],
+		Slug:      "ads-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{OrganizationID: org.ID, Name: "ads-account"}
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1555" + uuid.New().String()[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+
+	wamid := "wamid." + uuid.New().String()
+	app.saveIncomingMessage(account, contact, wamid, "text", "Hi, is this still available?", nil, "")
+
+	app.recordAdReferral(account, contact, true, wamid, &IncomingReferral{
+		SourceURL:  "https://fb.me/abc",
+		SourceID:   "120210000000",
+		SourceType: "ad",
+		Headline:   "Spring sale",
+		MediaType:  "video",
+		ImageURL:   "https://example.com/image.jpg",
+		VideoURL:   "https://example.com/video.mp4",
+		CtwaClid:   "ARAkLkA8rmlFeiCktEJQ",
+	})
+
+	var referral models.AdReferral
+	require.NoError(t, app.DB.Where("contact_id = ?", contact.ID).First(&referral).Error)
+	assert.Equal(t, "120210000000", referral.SourceID)
+	assert.Equal(t, "https://example.com/video.mp4", referral.MediaURL)
+	assert.Equal(t, "ARAkLkA8rmlFeiCktEJQ", referral.CtwaClid)
+	assert.True(t, referral.IsNewContact)
+
+	// The message shows the ad it came from
+	var message models.Message
+	require.NoError(t, app.DB.Where("whats_app_message_id = ?", wamid).First(&message).Error)
+	preview := adReferralPreview(message.Metadata)
+	require.NotNil(t, preview)
+	assert.Equal(t, "Spring sale", preview.Headline)
+}
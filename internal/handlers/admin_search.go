@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/middleware"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+const (
+	// adminSearchLimit caps the results of a cross-organization search
+	adminSearchLimit = 50
+	// minSearchPhoneDigits rejects partial numbers, which would match too broadly
+	minSearchPhoneDigits = 7
+)
+
+// AdminSearchContact is a contact found by a cross-organization search
+type AdminSearchContact struct {
+	ID              uuid.UUID  `json:"id"`
+	PhoneNumber     string     `json:"phone_number"`
+	ProfileName     string     `json:"profile_name"`
+	WhatsAppAccount string     `json:"whatsapp_account"`
+	LastMessageAt   *time.Time `json:"last_message_at,omitempty"`
+	LastInboundAt   *time.Time `json:"last_inbound_at,omitempty"`
+}
+
+// AdminSearchMessage is a message found by a cross-organization search. Its content
+// is left out, since delivery problems can be diagnosed without it.
+type AdminSearchMessage struct {
+	ID                uuid.UUID            `json:"id"`
+	WhatsAppMessageID string               `json:"whatsapp_message_id"`
+	Direction         models.Direction     `json:"direction"`
+	MessageType       models.MessageType   `json:"message_type"`
+	Status            models.MessageStatus `json:"status"`
+	ErrorMessage      string               `json:"error_message,omitempty"`
+	CreatedAt         time.Time            `json:"created_at"`
+}
+
+// AdminSearchResult is a contact, and the message searched for if any, in an organization
+type AdminSearchResult struct {
+	OrganizationID   uuid.UUID           `json:"organization_id"`
+	OrganizationName string              `json:"organization_name"`
+	Contact          AdminSearchContact  `json:"contact"`
+	Message          *AdminSearchMessage `json:"message,omitempty"`
+}
+
+// AdminSearch finds contacts by phone number, or a message by its ID or WhatsApp
+// message ID, across all organizations (super admin only). A reason is required,
+// and the search is audit logged before it runs; if the audit entry can't be
+// written, the search is refused.
+func (a *App) AdminSearch(r *fastglue.Request) error {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.IsSuperAdmin(userID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only super admins can search across organizations", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	phone := searchPhoneDigits(string(args.Peek("phone")))
+	messageID := strings.TrimSpace(string(args.Peek("message_id")))
+	reason := strings.TrimSpace(string(args.Peek("reason")))
+
+	if phone == "" && messageID == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "phone or message_id is required", nil, "")
+	}
+	if phone != "" && len(phone) < minSearchPhoneDigits {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "phone must be a full phone number", nil, "")
+	}
+	if reason == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "reason is required", nil, "")
+	}
+
+	var user models.User
+	a.DB.Select("email").Where("id = ?", userID).First(&user)
+
+	entry := models.AdminAuditLog{
+		UserID:          userID,
+		UserEmail:       user.Email,
+		Action:          models.AuditActionSearch,
+		Reason:          reason,
+		Query:           models.JSONB{"phone": phone, "message_id": messageID},
+		OrganizationIDs: models.StringArray{},
+		IPAddress:       middleware.GetClientIP(r).String(),
+		UserAgent:       string(r.RequestCtx.UserAgent()),
+	}
+	if err := a.DB.Create(&entry).Error; err != nil {
+		a.Log.Error("Failed to write admin audit log, refusing search", "error", err, "user_id", userID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to write audit log", nil, "")
+	}
+
+	results, err := a.adminSearch(phone, messageID)
+	if err != nil {
+		a.Log.Error("Admin search failed", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Search failed", nil, "")
+	}
+
+	orgIDs := models.StringArray{}
+	seen := make(map[uuid.UUID]bool)
+	for _, res := range results {
+		if !seen[res.OrganizationID] {
+			seen[res.OrganizationID] = true
+			orgIDs = append(orgIDs, res.OrganizationID.String())
+		}
+	}
+	if err := a.DB.Model(&entry).Updates(map[string]interface{}{
+		"result_count":     len(results),
+		"organization_ids": orgIDs,
+	}).Error; err != nil {
+		a.Log.Error("Failed to record admin search results in audit log", "error", err, "audit_id", entry.ID)
+	}
+
+	a.Log.Info("Admin cross-organization search", "user_id", userID, "audit_id", entry.ID,
+		"phone", phone, "message_id", messageID, "results", len(results))
+
+	return r.SendEnvelope(map[string]interface{}{
+		"results":  results,
+		"audit_id": entry.ID,
+	})
+}
+
+// adminSearch finds the contacts with a phone number and the message with an ID,
+// across organizations
+func (a *App) adminSearch(phone, messageID string) ([]AdminSearchResult, error) {
+	var results []AdminSearchResult
+
+	if messageID != "" {
+		query := a.DB.Where("whats_app_message_id = ?", messageID)
+		if id, err := uuid.Parse(messageID); err == nil {
+			query = a.DB.Where("id = ?", id)
+		}
+		var messages []models.Message
+		if err := query.Preload("Contact").Limit(adminSearchLimit).Find(&messages).Error; err != nil {
+			return nil, err
+		}
+		for _, m := range messages {
+			if m.Contact == nil || (phone != "" && m.Contact.PhoneNumber != phone) {
+				continue
+			}
+			results = append(results, AdminSearchResult{
+				OrganizationID: m.OrganizationID,
+				Contact:        adminSearchContact(m.Contact),
+				Message: &AdminSearchMessage{
+					ID:                m.ID,
+					WhatsAppMessageID: m.WhatsAppMessageID,
+					Direction:         m.Direction,
+					MessageType:       m.MessageType,
+					Status:            m.Status,
+					ErrorMessage:      m.ErrorMessage,
+					CreatedAt:         m.CreatedAt,
+				},
+			})
+		}
+	} else {
+		var contacts []models.Contact
+		if err := a.DB.Where("phone_number = ?", phone).
+			Order("last_message_at DESC NULLS LAST").
+			Limit(adminSearchLimit).Find(&contacts).Error; err != nil {
+			return nil, err
+		}
+		for i := range contacts {
+			results = append(results, AdminSearchResult{
+				OrganizationID: contacts[i].OrganizationID,
+				Contact:        adminSearchContact(&contacts[i]),
+			})
+		}
+	}
+
+	if len(results) == 0 {
+		return []AdminSearchResult{}, nil
+	}
+
+	orgIDs := make([]uuid.UUID, 0, len(results))
+	for _, res := range results {
+		orgIDs = append(orgIDs, res.OrganizationID)
+	}
+	var orgs []models.Organization
+	if err := a.DB.Select("id", "name").Where("id IN ?", orgIDs).Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	orgNames := make(map[uuid.UUID]string, len(orgs))
+	for _, org := range orgs {
+		orgNames[org.ID] = org.Name
+	}
+	for i := range results {
+		results[i].OrganizationName = orgNames[results[i].OrganizationID]
+	}
+	return results, nil
+}
+
+func adminSearchContact(c *models.Contact) AdminSearchContact {
+	return AdminSearchContact{
+		ID:              c.ID,
+		PhoneNumber:     c.PhoneNumber,
+		ProfileName:     c.ProfileName,
+		WhatsAppAccount: c.WhatsAppAccount,
+		LastMessageAt:   c.LastMessageAt,
+		LastInboundAt:   c.LastInboundAt,
+	}
+}
+
+// searchPhoneDigits strips formatting from a phone number, since contacts are
+// stored as digits only, e.g. "+1 (555) 010-0001" becomes "15550100001"
+func searchPhoneDigits(phone string) string {
+	var b strings.Builder
+	for _, c := range phone {
+		if c >= '0' && c <= '9' {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// ListAdminAuditLogs lists the super admin audit log, newest first (super admin only)
+func (a *App) ListAdminAuditLogs(r *fastglue.Request) error {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.IsSuperAdmin(userID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only super admins can view the audit log", nil, "")
+	}
+
+	page, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("page")))
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := a.DB.Model(&models.AdminAuditLog{})
+	if filterUser := string(r.RequestCtx.QueryArgs().Peek("user_id")); filterUser != "" {
+		id, err := uuid.Parse(filterUser)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid user_id", nil, "")
+		}
+		query = query.Where("user_id = ?", id)
+	}
+	if action := string(r.RequestCtx.QueryArgs().Peek("action")); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var entries []models.AdminAuditLog
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&entries).Error; err != nil {
+		a.Log.Error("Failed to list admin audit logs", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list audit logs", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"entries": entries,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
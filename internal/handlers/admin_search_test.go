@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchPhoneDigits(t *testing.T) {
+	assert.Equal(t, "15550100001", searchPhoneDigits("+1 (555) 010-0001"))
+	assert.Equal(t, "919876543210", searchPhoneDigits("91 98765 43210"))
+	assert.Equal(t, "", searchPhoneDigits("wamid.abc"))
+	assert.Equal(t, "", searchPhoneDigits(""))
+}
+
+func TestSearchSnippet(t *testing.T) {
+	assert.Equal(t, "where is my <mark>order</mark>?", searchSnippet("where is my \x02order\x03?"))
+	assert.Equal(t, "&lt;b&gt;<mark>refund</mark>&lt;/b&gt; &amp; more", searchSnippet("<b>\x02refund\x03</b> & more"))
+}
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,10 +31,14 @@ type AgentPerformanceStats struct {
 	AvgFirstResponseMins float64  `json:"avg_first_response_mins"`
 	AvgResolutionMins    float64  `json:"avg_resolution_mins"`
 	TransfersHandled     int64    `json:"transfers_handled"`
+	ConversationsHandled int64    `json:"conversations_handled"` // Contacts the agent replied to
 	ActiveTransfers      int64    `json:"active_transfers"`
 	MessagesSent         int64    `json:"messages_sent"`
+	OnlineHours          float64  `json:"online_hours"` // Time marked available, from availability logs
 	TotalBreakTimeMins   float64  `json:"total_break_time_mins"`
 	BreakCount           int64    `json:"break_count"`
+	Ratings              int64    `json:"ratings"`    // Satisfaction surveys rated
+	AvgRating            float64  `json:"avg_rating"` // Average satisfaction rating, from 1 to 5
 	IsAvailable          bool     `json:"is_available"`
 	CurrentBreakStart    *string  `json:"current_break_start,omitempty"`
 }
@@ -171,7 +178,7 @@ func (a *App) GetAgentDetails(r *fastglue.Request) error {
 
 	// Verify agent exists
 	var agent models.User
-	if err := a.DB.Where("id = ? AND organization_id = ?", agentID, orgID).First(&agent).Error; err != nil {
+	if err := a.replicaDB().Where("id = ? AND organization_id = ?", agentID, orgID).First(&agent).Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Agent not found", nil, "")
 	}
 
@@ -219,17 +226,99 @@ func (a *App) GetAgentComparison(r *fastglue.Request) error {
 	})
 }
 
+// ExportAgentAnalytics returns each agent's performance over a date range as CSV
+func (a *App) ExportAgentAnalytics(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceAnalytics, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Access denied", nil, "")
+	}
+
+	periodStart, periodEnd, err := agentAnalyticsPeriod(
+		string(r.RequestCtx.QueryArgs().Peek("from")),
+		string(r.RequestCtx.QueryArgs().Peek("to")),
+		time.Now(),
+	)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid date range. Use YYYY-MM-DD, with 'to' on or after 'from'", nil, "")
+	}
+
+	agentStats := a.calculateAllAgentStats(orgID, periodStart, periodEnd)
+	sort.SliceStable(agentStats, func(i, j int) bool {
+		return agentStats[i].AgentName < agentStats[j].AgentName
+	})
+
+	fileName := fmt.Sprintf("agent-performance-%s-%s.csv", periodStart.Format("2006-01-02"), periodEnd.Format("2006-01-02"))
+	sendCSV(r, fileName, agentStatsCSV(agentStats))
+	return nil
+}
+
+// agentAnalyticsPeriod parses a from/to date range (YYYY-MM-DD, both inclusive).
+// Without one it defaults to the current month.
+func agentAnalyticsPeriod(fromStr, toStr string, now time.Time) (time.Time, time.Time, error) {
+	if fromStr == "" && toStr == "" {
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), now, nil
+	}
+
+	periodStart, err := time.Parse("2006-01-02", fromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from date %q", fromStr)
+	}
+	periodEnd, err := time.Parse("2006-01-02", toStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to date %q", toStr)
+	}
+	if periodEnd.Before(periodStart) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to date %s is before from date %s", toStr, fromStr)
+	}
+	return periodStart, periodEnd.Add(24*time.Hour - time.Nanosecond), nil
+}
+
+// agentStatsCSV returns agents' performance stats as CSV rows, with a header row
+func agentStatsCSV(agentStats []AgentPerformanceStats) [][]string {
+	formatFloat := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+
+	rows := [][]string{{
+		"agent_id", "agent_name", "conversations_handled", "transfers_handled", "active_transfers", "messages_sent",
+		"avg_first_response_mins", "avg_resolution_mins", "ratings", "avg_rating", "online_hours", "break_time_mins", "break_count",
+	}}
+	for _, s := range agentStats {
+		rows = append(rows, []string{
+			s.AgentID,
+			s.AgentName,
+			strconv.FormatInt(s.ConversationsHandled, 10),
+			strconv.FormatInt(s.TransfersHandled, 10),
+			strconv.FormatInt(s.ActiveTransfers, 10),
+			strconv.FormatInt(s.MessagesSent, 10),
+			formatFloat(s.AvgFirstResponseMins),
+			formatFloat(s.AvgResolutionMins),
+			strconv.FormatInt(s.Ratings, 10),
+			formatFloat(s.AvgRating),
+			formatFloat(s.OnlineHours),
+			formatFloat(s.TotalBreakTimeMins),
+			strconv.FormatInt(s.BreakCount, 10),
+		})
+	}
+	return rows
+}
+
 // Helper functions
 
 func (a *App) calculateSummaryStats(orgID uuid.UUID, start, end time.Time, summary *AgentAnalyticsSummary) {
 	// Total transfers handled (resumed)
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Where("organization_id = ? AND status = ? AND transferred_at >= ? AND transferred_at <= ?",
 			orgID, models.TransferStatusResumed, start, end).
 		Count(&summary.TotalTransfersHandled)
 
 	// Active transfers
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Where("organization_id = ? AND status = ?", orgID, models.TransferStatusActive).
 		Count(&summary.ActiveTransfers)
 
@@ -238,16 +327,25 @@ func (a *App) calculateSummaryStats(orgID uuid.UUID, start, end time.Time, summa
 		Avg float64
 	}
 	var queueTimeResult AvgResult
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Select("AVG(EXTRACT(EPOCH FROM (updated_at - transferred_at))/60) as avg").
 		Where("organization_id = ? AND agent_id IS NOT NULL AND transferred_at >= ? AND transferred_at <= ?",
 			orgID, start, end).
 		Scan(&queueTimeResult)
 	summary.AvgQueueTimeMins = queueTimeResult.Avg
 
+	// Average first response time (time from transfer to the first agent reply)
+	var firstResponseResult AvgResult
+	a.replicaDB().Model(&models.AgentTransfer{}).
+		Select("COALESCE(AVG(EXTRACT(EPOCH FROM (first_response_at - transferred_at))/60), 0) as avg").
+		Where("organization_id = ? AND first_response_at IS NOT NULL AND transferred_at >= ? AND transferred_at <= ?",
+			orgID, start, end).
+		Scan(&firstResponseResult)
+	summary.AvgFirstResponseMins = firstResponseResult.Avg
+
 	// Average resolution time (time from transfer to resume)
 	var resolutionTimeResult AvgResult
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Select("AVG(EXTRACT(EPOCH FROM (resumed_at - transferred_at))/60) as avg").
 		Where("organization_id = ? AND status = ? AND resumed_at IS NOT NULL AND transferred_at >= ? AND transferred_at <= ?",
 			orgID, models.TransferStatusResumed, start, end).
@@ -260,7 +358,7 @@ func (a *App) calculateSummaryStats(orgID uuid.UUID, start, end time.Time, summa
 		Count  int64
 	}
 	var sourceCounts []SourceCount
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Select("source, COUNT(*) as count").
 		Where("organization_id = ? AND transferred_at >= ? AND transferred_at <= ?", orgID, start, end).
 		Group("source").
@@ -273,22 +371,25 @@ func (a *App) calculateSummaryStats(orgID uuid.UUID, start, end time.Time, summa
 
 func (a *App) calculateAgentSummaryStats(orgID, agentID uuid.UUID, start, end time.Time, summary *AgentAnalyticsSummary) {
 	// Total transfers handled by this agent (resumed)
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Where("organization_id = ? AND agent_id = ? AND status = ? AND transferred_at >= ? AND transferred_at <= ?",
 			orgID, agentID, models.TransferStatusResumed, start, end).
 		Count(&summary.TotalTransfersHandled)
 
 	// Active transfers for this agent
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Where("organization_id = ? AND agent_id = ? AND status = ?", orgID, agentID, models.TransferStatusActive).
 		Count(&summary.ActiveTransfers)
 
+	// Average first response time for this agent
+	summary.AvgFirstResponseMins = a.calculateFirstResponseTime(orgID, agentID, start, end)
+
 	// Average resolution time for this agent
 	type AvgResult struct {
 		Avg float64
 	}
 	var resolutionTimeResult AvgResult
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Select("AVG(EXTRACT(EPOCH FROM (resumed_at - transferred_at))/60) as avg").
 		Where("organization_id = ? AND agent_id = ? AND status = ? AND resumed_at IS NOT NULL AND transferred_at >= ? AND transferred_at <= ?",
 			orgID, agentID, models.TransferStatusResumed, start, end).
@@ -301,7 +402,7 @@ func (a *App) calculateAgentSummaryStats(orgID, agentID uuid.UUID, start, end ti
 		Count  int64
 	}
 	var sourceCounts []SourceCount
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Select("source, COUNT(*) as count").
 		Where("organization_id = ? AND agent_id = ? AND transferred_at >= ? AND transferred_at <= ?", orgID, agentID, start, end).
 		Group("source").
@@ -322,48 +423,71 @@ func (a *App) calculateAgentStats(orgID, agentID uuid.UUID, start, end time.Time
 
 	// Get agent name and availability
 	var agent models.User
-	if a.DB.Where("id = ?", agentID).First(&agent).Error == nil {
+	if a.replicaDB().Where("id = ?", agentID).First(&agent).Error == nil {
 		stats.AgentName = agent.FullName
 		stats.IsAvailable = agent.IsAvailable
 	}
 
 	// Transfers handled (resumed)
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Where("organization_id = ? AND agent_id = ? AND status = ? AND transferred_at >= ? AND transferred_at <= ?",
 			orgID, agentID, models.TransferStatusResumed, start, end).
 		Count(&stats.TransfersHandled)
 
 	// Active transfers
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Where("organization_id = ? AND agent_id = ? AND status = ?", orgID, agentID, models.TransferStatusActive).
 		Count(&stats.ActiveTransfers)
 
 	// Messages sent - count outgoing messages to contacts during agent's active transfers
 	// This captures all messages sent while the agent was handling the conversation
-	a.DB.Model(&models.Message{}).
+	a.replicaDB().Model(&models.Message{}).
 		Where("organization_id = ? AND direction = ? AND created_at >= ? AND created_at <= ?", orgID, models.DirectionOutgoing, start, end).
 		Where("contact_id IN (SELECT contact_id FROM agent_transfers WHERE agent_id = ? AND organization_id = ?)", agentID, orgID).
 		Count(&stats.MessagesSent)
 
+	// Conversations handled - contacts the agent replied to themselves
+	a.replicaDB().Model(&models.Message{}).
+		Where("organization_id = ? AND sent_by_user_id = ? AND direction = ? AND created_at >= ? AND created_at <= ?",
+			orgID, agentID, models.DirectionOutgoing, start, end).
+		Distinct("contact_id").
+		Count(&stats.ConversationsHandled)
+
+	// Average first response time
+	stats.AvgFirstResponseMins = a.calculateFirstResponseTime(orgID, agentID, start, end)
+
 	// Average resolution time
 	type AvgResult struct {
 		Avg float64
 	}
 	var resolutionTimeResult AvgResult
-	a.DB.Model(&models.AgentTransfer{}).
+	a.replicaDB().Model(&models.AgentTransfer{}).
 		Select("AVG(EXTRACT(EPOCH FROM (resumed_at - transferred_at))/60) as avg").
 		Where("organization_id = ? AND agent_id = ? AND status = ? AND resumed_at IS NOT NULL AND transferred_at >= ? AND transferred_at <= ?",
 			orgID, agentID, models.TransferStatusResumed, start, end).
 		Scan(&resolutionTimeResult)
 	stats.AvgResolutionMins = resolutionTimeResult.Avg
 
+	// Satisfaction with the conversations they handled
+	var ratingResult struct {
+		Count int64
+		Avg   float64
+	}
+	a.replicaDB().Model(&models.CSATResponse{}).
+		Select("COUNT(*) AS count, COALESCE(AVG(rating), 0) AS avg").
+		Where("organization_id = ? AND agent_id = ? AND rating IS NOT NULL AND sent_at >= ? AND sent_at <= ?", orgID, agentID, start, end).
+		Scan(&ratingResult)
+	stats.Ratings = ratingResult.Count
+	stats.AvgRating = ratingResult.Avg
+
 	// Calculate break time from availability logs
 	stats.TotalBreakTimeMins, stats.BreakCount = a.calculateBreakTime(agentID, start, end)
+	stats.OnlineHours = a.calculateOnlineHours(agentID, start, end)
 
 	// Check if currently on break and get break start time
 	if !stats.IsAvailable {
 		var currentBreak models.UserAvailabilityLog
-		if a.DB.Where("user_id = ? AND is_available = false AND ended_at IS NULL", agentID).
+		if a.replicaDB().Where("user_id = ? AND is_available = false AND ended_at IS NULL", agentID).
 			Order("started_at DESC").First(&currentBreak).Error == nil {
 			breakStart := currentBreak.StartedAt.Format(time.RFC3339)
 			stats.CurrentBreakStart = &breakStart
@@ -376,7 +500,7 @@ func (a *App) calculateAgentStats(orgID, agentID uuid.UUID, start, end time.Time
 func (a *App) calculateAllAgentStats(orgID uuid.UUID, start, end time.Time) []AgentPerformanceStats {
 	// Get all agents in the organization through team membership
 	var agents []models.User
-	if err := a.DB.
+	if err := a.replicaDB().
 		Joins("JOIN team_members ON team_members.user_id = users.id").
 		Joins("JOIN teams ON teams.id = team_members.team_id").
 		Where("users.organization_id = ? AND team_members.role = ?", orgID, models.TeamRoleAgent).
@@ -395,17 +519,48 @@ func (a *App) calculateAllAgentStats(orgID uuid.UUID, start, end time.Time) []Ag
 	return stats
 }
 
+// calculateFirstResponseTime calculates an agent's average minutes from transfer to their first reply
+func (a *App) calculateFirstResponseTime(orgID, agentID uuid.UUID, start, end time.Time) float64 {
+	var result struct {
+		Avg float64
+	}
+	a.replicaDB().Model(&models.AgentTransfer{}).
+		Select("COALESCE(AVG(EXTRACT(EPOCH FROM (first_response_at - transferred_at))/60), 0) as avg").
+		Where("organization_id = ? AND agent_id = ? AND first_response_at IS NOT NULL AND transferred_at >= ? AND transferred_at <= ?",
+			orgID, agentID, start, end).
+		Scan(&result)
+	return result.Avg
+}
+
 // calculateBreakTime calculates total break time and count for an agent within a time period
 func (a *App) calculateBreakTime(agentID uuid.UUID, start, end time.Time) (totalMins float64, count int64) {
-	// Get all "away" periods that overlap with the time range
+	return a.calculateAvailabilityTime(agentID, false, start, end)
+}
+
+// calculateOnlineHours calculates the hours an agent was marked available within a time period
+func (a *App) calculateOnlineHours(agentID uuid.UUID, start, end time.Time) float64 {
+	totalMins, _ := a.calculateAvailabilityTime(agentID, true, start, end)
+	return totalMins / 60
+}
+
+// calculateAvailabilityTime calculates the time an agent spent available (or away) within
+// a time period, and the number of such periods
+func (a *App) calculateAvailabilityTime(agentID uuid.UUID, available bool, start, end time.Time) (totalMins float64, count int64) {
+	// Get all periods of that availability that overlap with the time range
 	var logs []models.UserAvailabilityLog
-	if err := a.DB.Where("user_id = ? AND is_available = false AND started_at <= ? AND (ended_at >= ? OR ended_at IS NULL)",
-		agentID, end, start).
+	if err := a.replicaDB().Where("user_id = ? AND is_available = ? AND started_at <= ? AND (ended_at >= ? OR ended_at IS NULL)",
+		agentID, available, end, start).
 		Find(&logs).Error; err != nil {
-		a.Log.Error("Failed to fetch availability logs for break time calculation", "error", err, "agent_id", agentID)
+		a.Log.Error("Failed to fetch availability logs for availability time calculation", "error", err, "agent_id", agentID)
 		return 0, 0
 	}
 
+	return availabilityOverlap(logs, start, end, time.Now())
+}
+
+// availabilityOverlap sums the minutes of availability logs that fall within a time
+// period and counts the logs that overlap it. Logs still open run until now.
+func availabilityOverlap(logs []models.UserAvailabilityLog, start, end, now time.Time) (totalMins float64, count int64) {
 	for _, log := range logs {
 		// Calculate the overlap with our time range
 		logStart := log.StartedAt
@@ -413,12 +568,9 @@ func (a *App) calculateBreakTime(agentID uuid.UUID, start, end time.Time) (total
 			logStart = start
 		}
 
-		var logEnd time.Time
+		logEnd := now
 		if log.EndedAt != nil {
 			logEnd = *log.EndedAt
-		} else {
-			// Still on break, use current time but cap at end of period
-			logEnd = time.Now()
 		}
 		if logEnd.After(end) {
 			logEnd = end
@@ -426,8 +578,7 @@ func (a *App) calculateBreakTime(agentID uuid.UUID, start, end time.Time) (total
 
 		// Add duration in minutes
 		if logEnd.After(logStart) {
-			duration := logEnd.Sub(logStart).Minutes()
-			totalMins += duration
+			totalMins += logEnd.Sub(logStart).Minutes()
 			count++
 		}
 	}
@@ -453,7 +604,7 @@ func (a *App) calculateTrendData(orgID uuid.UUID, start, end time.Time, groupBy
 		Count int64
 	}
 
-	query := a.DB.Model(&models.AgentTransfer{}).
+	query := a.replicaDB().Model(&models.AgentTransfer{}).
 		Select("DATE_TRUNC('" + dateTrunc + "', transferred_at) as date, COUNT(*) as count").
 		Where("organization_id = ? AND status = ? AND transferred_at >= ? AND transferred_at <= ?",
 			orgID, models.TransferStatusResumed, start, end)
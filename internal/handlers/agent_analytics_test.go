@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAvailabilityOverlap(t *testing.T) {
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) *time.Time {
+		ts := start.Add(time.Duration(hour) * time.Hour)
+		return &ts
+	}
+
+	logs := []models.UserAvailabilityLog{
+		// Started before the period, only the part inside counts
+		{StartedAt: *at(-2), EndedAt: at(3)},
+		{StartedAt: *at(9), EndedAt: at(17)},
+		// Still open, runs until now
+		{StartedAt: *at(20)},
+		// Before the period
+		{StartedAt: *at(-5), EndedAt: at(-3)},
+	}
+
+	totalMins, count := availabilityOverlap(logs, start, end, *at(22))
+	assert.Equal(t, float64((3+8+2)*60), totalMins)
+	assert.Equal(t, int64(3), count)
+
+	// Open logs are capped at the end of the period
+	totalMins, _ = availabilityOverlap(logs[2:3], start, end, *at(30))
+	assert.Equal(t, float64(4*60), totalMins)
+}
+
+func TestAgentAnalyticsPeriod(t *testing.T) {
+	now := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)
+
+	start, end, err := agentAnalyticsPeriod("", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, now, end)
+
+	start, end, err = agentAnalyticsPeriod("2025-02-01", "2025-02-28", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond), end)
+
+	_, _, err = agentAnalyticsPeriod("2025-02-01", "", now)
+	assert.Error(t, err)
+	_, _, err = agentAnalyticsPeriod("2025-02-30", "2025-03-01", now)
+	assert.Error(t, err)
+	_, _, err = agentAnalyticsPeriod("2025-03-01", "2025-02-01", now)
+	assert.Error(t, err)
+}
+
+func TestAgentStatsCSV(t *testing.T) {
+	rows := agentStatsCSV([]AgentPerformanceStats{{
+		AgentID:              "agent-1",
+		AgentName:            "Ana",
+		ConversationsHandled: 42,
+		TransfersHandled:     30,
+		MessagesSent:         310,
+		AvgFirstResponseMins: 3.456,
+		Ratings:              12,
+		AvgRating:            4.5,
+		OnlineHours:          38.25,
+		TotalBreakTimeMins:   95,
+		BreakCount:           4,
+	}})
+
+	require.Len(t, rows, 2)
+	assert.Equal(t, "conversations_handled", rows[0][2])
+	assert.Equal(t, []string{"agent-1", "Ana", "42", "30", "0", "310", "3.46", "0.00", "12", "4.50", "38.25", "95.00", "4"}, rows[1])
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"strconv"
 	"strings"
@@ -39,6 +40,10 @@ type agentTransferRow struct {
 	EscalatedAt           *time.Time `gorm:"column:escalated_at"`
 	PickedUpAt            *time.Time `gorm:"column:picked_up_at"`
 	ExpiresAt             *time.Time `gorm:"column:expires_at"`
+	FirstResponseAt       *time.Time `gorm:"column:first_response_at"`
+	Priority              models.TransferPriority `gorm:"column:priority"`
+	SLAPolicyID           *uuid.UUID       `gorm:"column:sla_policy_id"`
+	SLAStatus             models.SLAStatus `gorm:"column:sla_status"`
 
 	// Joined fields
 	ContactName       *string `gorm:"column:contact_name"`
@@ -56,12 +61,15 @@ type CreateAgentTransferRequest struct {
 	TeamID          *string              `json:"team_id"` // Optional team queue
 	Notes           string               `json:"notes"`
 	Source          models.TransferSource `json:"source"` // manual, flow, keyword
+	Priority        models.TransferPriority `json:"priority"` // low, normal (default), high, urgent
 }
 
 // AssignTransferRequest represents the request to assign a transfer to an agent
 type AssignTransferRequest struct {
 	AgentID *string `json:"agent_id"` // null or empty string = unassign, UUID = assign to agent
 	TeamID  *string `json:"team_id"`  // optional: move to different team queue
+	// AutoAssign picks the agent with the team's assignment strategy instead of agent_id
+	AutoAssign bool `json:"auto_assign"`
 }
 
 // AgentTransferResponse represents an agent transfer in API responses
@@ -94,6 +102,12 @@ type AgentTransferResponse struct {
 	EscalatedAt           *string `json:"escalated_at,omitempty"`
 	PickedUpAt            *string `json:"picked_up_at,omitempty"`
 	ExpiresAt             *string `json:"expires_at,omitempty"`
+	FirstResponseAt       *string `json:"first_response_at,omitempty"`
+
+	// SLA policy fields
+	Priority    models.TransferPriority `json:"priority"`
+	SLAPolicyID *string                 `json:"sla_policy_id,omitempty"`
+	SLAStatus   models.SLAStatus        `json:"sla_status,omitempty"` // on_track, at_risk, breached, met
 }
 
 // ListAgentTransfers lists agent transfers for the organization
@@ -112,6 +126,8 @@ func (a *App) ListAgentTransfers(r *fastglue.Request) error {
 	// Query params
 	status := string(r.RequestCtx.QueryArgs().Peek("status"))
 	teamIDStr := string(r.RequestCtx.QueryArgs().Peek("team_id"))
+	slaStatus := string(r.RequestCtx.QueryArgs().Peek("sla_status"))
+	priority := string(r.RequestCtx.QueryArgs().Peek("priority"))
 
 	// Pagination params
 	limit := 100 // Default limit
@@ -184,6 +200,14 @@ func (a *App) ListAgentTransfers(r *fastglue.Request) error {
 		query = query.Where("agent_transfers.status = ?", status)
 	}
 
+	// Filter by SLA status and priority if provided
+	if slaStatus != "" {
+		query = query.Where("agent_transfers.sla_status = ?", slaStatus)
+	}
+	if priority != "" {
+		query = query.Where("agent_transfers.priority = ?", priority)
+	}
+
 	// Filter by team if provided
 	if teamIDStr != "" {
 		if teamIDStr == "general" {
@@ -372,6 +396,18 @@ func (a *App) ListAgentTransfers(r *fastglue.Request) error {
 			expiresAt := t.ExpiresAt.Format(time.RFC3339)
 			resp.ExpiresAt = &expiresAt
 		}
+		if t.FirstResponseAt != nil {
+			firstResponseAt := t.FirstResponseAt.Format(time.RFC3339)
+			resp.FirstResponseAt = &firstResponseAt
+		}
+
+		// SLA policy fields
+		resp.Priority = t.Priority
+		if t.SLAPolicyID != nil {
+			policyID := t.SLAPolicyID.String()
+			resp.SLAPolicyID = &policyID
+			resp.SLAStatus = transferSLAStatus(t.Status, models.SLATracking{PolicyID: t.SLAPolicyID, Status: t.SLAStatus})
+		}
 
 		response[i] = resp
 	}
@@ -463,7 +499,7 @@ func (a *App) CreateAgentTransfer(r *fastglue.Request) error {
 		agentID = &parsedAgentID
 	} else if teamID != nil {
 		// Apply team's assignment strategy
-		agentID = a.assignToTeam(*teamID, orgID)
+		agentID = a.assignToTeam(*teamID, orgID, &contact)
 	} else if settings != nil && settings.AgentAssignment.AssignToSameAgent && contact.AssignedUserID != nil {
 		// Auto-assign to contact's existing assigned agent (if setting enabled and agent is available)
 		var assignedAgent models.User
@@ -480,6 +516,14 @@ func (a *App) CreateAgentTransfer(r *fastglue.Request) error {
 		source = models.TransferSourceManual
 	}
 
+	priority := req.Priority
+	if priority == "" {
+		priority = models.TransferPriorityNormal
+	}
+	if !isTransferPriority(priority) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid priority. Must be 'low', 'normal', 'high' or 'urgent'", nil, "")
+	}
+
 	// Create transfer
 	transfer := models.AgentTransfer{
 		BaseModel:           models.BaseModel{ID: uuid.New()},
@@ -494,6 +538,7 @@ func (a *App) CreateAgentTransfer(r *fastglue.Request) error {
 		TransferredByUserID: &userID,
 		Notes:               req.Notes,
 		TransferredAt:       time.Now(),
+		Priority:            priority,
 	}
 
 	// Set SLA deadlines if SLA is enabled
@@ -516,13 +561,7 @@ func (a *App) CreateAgentTransfer(r *fastglue.Request) error {
 		a.DB.Model(&contact).Update("assigned_user_id", agentID)
 	}
 
-	// End any active chatbot session
-	a.DB.Model(&models.ChatbotSession{}).
-		Where("organization_id = ? AND contact_id = ? AND status = ?", orgID, contactID, models.SessionStatusActive).
-		Updates(map[string]any{
-			"status":       models.SessionStatusCancelled,
-			"completed_at": time.Now(),
-		})
+	a.handOffSessions(&transfer)
 
 	// Broadcast WebSocket notification
 	a.broadcastTransferCreated(&transfer, &contact)
@@ -613,6 +652,12 @@ func (a *App) CreateAgentTransfer(r *fastglue.Request) error {
 		expiresAt := transfer.SLA.ExpiresAt.Format(time.RFC3339)
 		resp.ExpiresAt = &expiresAt
 	}
+	resp.Priority = transfer.Priority
+	if transfer.SLA.PolicyID != nil {
+		policyID := transfer.SLA.PolicyID.String()
+		resp.SLAPolicyID = &policyID
+		resp.SLAStatus = transferSLAStatus(transfer.Status, transfer.SLA)
+	}
 
 	return r.SendEnvelope(map[string]any{
 		"transfer": resp,
@@ -653,6 +698,7 @@ func (a *App) ResumeFromTransfer(r *fastglue.Request) error {
 	if err := a.DB.Save(&transfer).Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to resume transfer", nil, "")
 	}
+	a.syncSessionMode(&transfer)
 
 	// Clear chatbot tracking so client inactivity SLA doesn't trigger after transfer is closed
 	a.ClearContactChatbotTracking(transfer.ContactID)
@@ -670,6 +716,9 @@ func (a *App) ResumeFromTransfer(r *fastglue.Request) error {
 	// Broadcast WebSocket notification
 	a.broadcastTransferResumed(&transfer)
 
+	// The agent ended the conversation, so the contact can rate it
+	a.surveyTransfer(&transfer)
+
 	// Get contact for webhook data
 	var contact models.Contact
 	a.DB.Where("id = ?", transfer.ContactID).First(&contact)
@@ -774,6 +823,17 @@ func (a *App) AssignAgentTransfer(r *fastglue.Request) error {
 		}
 	}
 
+	// Let the team's strategy pick the agent (requires write permission)
+	if req.AutoAssign && (req.AgentID == nil || *req.AgentID == "") {
+		if !hasWriteAccess {
+			return r.SendErrorEnvelope(fasthttp.StatusForbidden, "You don't have permission to assign transfers to others", nil, "")
+		}
+		if transfer.TeamID == nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Transfer has no team to auto-assign from", nil, "")
+		}
+		targetAgentID = a.assignToTeam(*transfer.TeamID, orgID, transfer.Contact)
+	}
+
 	// Update transfer
 	transfer.AgentID = targetAgentID
 
@@ -785,6 +845,7 @@ func (a *App) AssignAgentTransfer(r *fastglue.Request) error {
 	if err := a.DB.Save(&transfer).Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to assign transfer", nil, "")
 	}
+	a.syncSessionMode(&transfer)
 
 	// Update contact assignment
 	if targetAgentID != nil && transfer.Contact != nil {
@@ -955,6 +1016,7 @@ func (a *App) PickNextTransfer(r *fastglue.Request) error {
 	if err := tx.Commit().Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to complete pickup", nil, "")
 	}
+	a.syncSessionMode(&transfer)
 
 	// Load related data for response (outside transaction)
 	a.DB.Where("id = ?", transfer.ContactID).First(&transfer.Contact)
@@ -1037,6 +1099,12 @@ func (a *App) PickNextTransfer(r *fastglue.Request) error {
 		expiresAt := transfer.SLA.ExpiresAt.Format(time.RFC3339)
 		resp.ExpiresAt = &expiresAt
 	}
+	resp.Priority = transfer.Priority
+	if transfer.SLA.PolicyID != nil {
+		policyID := transfer.SLA.PolicyID.String()
+		resp.SLAPolicyID = &policyID
+		resp.SLAStatus = transferSLAStatus(transfer.Status, transfer.SLA)
+	}
 
 	return r.SendEnvelope(map[string]any{
 		"message":  "Transfer picked successfully",
@@ -1152,40 +1220,67 @@ func (a *App) createTransferToQueue(account *models.WhatsAppAccount, contact *mo
 		return
 	}
 
-	// Get chatbot settings for SLA (use cache)
+	// Get chatbot settings for SLA and handoff routing (use cache)
 	settings, _ := a.getChatbotSettingsCached(account.OrganizationID, account.Name)
 
-	// Create unassigned transfer (goes to queue)
+	// Outside business hours the transfer waits in the queue and is assigned
+	// once hours reopen
+	var teamID, agentID *uuid.UUID
+	deferred := settings != nil && a.isOutsideBusinessHours(settings)
+	if deferred {
+		teamID = settings.AgentAssignment.HandoffTeamID
+	} else {
+		teamID, agentID = a.routeHandoff(settings, contact)
+	}
+
+	// Create transfer, unassigned ones go to the queue
 	transfer := models.AgentTransfer{
-		BaseModel:       models.BaseModel{ID: uuid.New()},
-		OrganizationID:  account.OrganizationID,
-		ContactID:       contact.ID,
-		WhatsAppAccount: account.Name,
-		PhoneNumber:     contact.PhoneNumber,
-		Status:          models.TransferStatusActive,
-		Source:          source,
-		AgentID:         nil, // Unassigned - goes to queue
-		TransferredAt:   time.Now(),
+		BaseModel:          models.BaseModel{ID: uuid.New()},
+		OrganizationID:     account.OrganizationID,
+		ContactID:          contact.ID,
+		WhatsAppAccount:    account.Name,
+		PhoneNumber:        contact.PhoneNumber,
+		Status:             models.TransferStatusActive,
+		Source:             source,
+		AgentID:            agentID,
+		TeamID:             teamID,
+		TransferredAt:      time.Now(),
+		AssignmentDeferred: deferred,
 	}
 
 	// Set SLA deadlines
 	if settings != nil {
 		a.SetSLADeadlines(&transfer, settings)
 	}
+	if agentID != nil {
+		a.UpdateSLAOnPickup(&transfer)
+	}
 
 	if err := a.DB.Create(&transfer).Error; err != nil {
 		a.Log.Error("Failed to create transfer to queue", "error", err, "contact_id", contact.ID, "source", string(source))
 		return
 	}
+	if agentID != nil {
+		a.DB.Model(contact).Update("assigned_user_id", agentID)
+	}
 
 	a.Log.Info("Transfer created to agent queue", "transfer_id", transfer.ID, "contact_id", contact.ID, "source", source)
+	a.syncSessionMode(&transfer)
 
 	// Broadcast to WebSocket
 	a.broadcastTransferCreated(&transfer, contact)
+	a.notifyHandoffRequested(&transfer, contact)
+	a.openHelpdeskTicket(&transfer, contact)
 }
 
 // createTransferFromKeyword creates an agent transfer triggered by a keyword rule
-func (a *App) createTransferFromKeyword(account *models.WhatsAppAccount, contact *models.Contact) {
+func (a *App) createTransferFromKeyword(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact) {
+	a.createTransferFromBot(ctx, account, contact, models.TransferSourceKeyword)
+}
+
+// createTransferFromBot creates an agent transfer the bot decided on: a keyword
+// rule, the AI, or too many fallback messages
+func (a *App) createTransferFromBot(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, source models.TransferSource) {
 	// Check for existing active transfer
 	var existingCount int64
 	a.DB.Model(&models.AgentTransfer{}).
@@ -1193,7 +1288,7 @@ func (a *App) createTransferFromKeyword(account *models.WhatsAppAccount, contact
 		Count(&existingCount)
 
 	if existingCount > 0 {
-		a.Log.Info("Contact already has active transfer, skipping keyword transfer", "contact_id", contact.ID)
+		a.log(ctx).Info("Contact already has active transfer, skipping bot transfer", "contact_id", contact.ID, "source", source)
 		return
 	}
 
@@ -1201,14 +1296,11 @@ func (a *App) createTransferFromKeyword(account *models.WhatsAppAccount, contact
 	settings, _ := a.getChatbotSettingsCached(account.OrganizationID, account.Name)
 
 	// Check business hours - if outside hours, send out of hours message instead of transfer
-	if settings != nil && settings.BusinessHours.Enabled && len(settings.BusinessHours.Hours) > 0 {
-		if !a.isWithinBusinessHours(settings.BusinessHours.Hours) {
-			a.Log.Info("Outside business hours, sending out of hours message instead of transfer", "contact_id", contact.ID)
-			if settings.BusinessHours.OutOfHoursMessage != "" {
-				_ = a.sendAndSaveTextMessage(account, contact, settings.BusinessHours.OutOfHoursMessage)
-			}
-			return
-		}
+	if settings != nil && a.isOutsideBusinessHours(settings) {
+		a.log(ctx).Info("Outside business hours, sending out of hours message instead of transfer", "contact_id", contact.ID)
+		a.sendOutOfHoursMessage(ctx, account, contact, settings)
+		a.queueForBusinessHours(account, contact, settings)
+		return
 	}
 
 	// Determine agent assignment
@@ -1219,7 +1311,13 @@ func (a *App) createTransferFromKeyword(account *models.WhatsAppAccount, contact
 		if a.DB.Where("id = ?", contact.AssignedUserID).First(&assignedAgent).Error == nil && assignedAgent.IsAvailable {
 			agentID = contact.AssignedUserID
 		}
-		// If agent is not available, falls through to queue (agentID remains nil)
+		// If agent is not available, falls through to the handoff team or queue
+	}
+
+	// Route to the handoff team, if one is set
+	var teamID *uuid.UUID
+	if agentID == nil {
+		teamID, agentID = a.routeHandoff(settings, contact)
 	}
 
 	// Create transfer
@@ -1230,8 +1328,9 @@ func (a *App) createTransferFromKeyword(account *models.WhatsAppAccount, contact
 		WhatsAppAccount: account.Name,
 		PhoneNumber:     contact.PhoneNumber,
 		Status:          models.TransferStatusActive,
-		Source:          models.TransferSourceKeyword,
+		Source:          source,
 		AgentID:         agentID,
+		TeamID:          teamID,
 		TransferredAt:   time.Now(),
 	}
 
@@ -1246,7 +1345,7 @@ func (a *App) createTransferFromKeyword(account *models.WhatsAppAccount, contact
 	}
 
 	if err := a.DB.Create(&transfer).Error; err != nil {
-		a.Log.Error("Failed to create keyword-triggered transfer", "error", err, "contact_id", contact.ID)
+		a.log(ctx).Error("Failed to create bot transfer", "error", err, "contact_id", contact.ID, "source", source)
 		return
 	}
 
@@ -1255,31 +1354,48 @@ func (a *App) createTransferFromKeyword(account *models.WhatsAppAccount, contact
 		a.DB.Model(&contact).Update("assigned_user_id", agentID)
 	}
 
-	// End any active chatbot session
-	a.DB.Model(&models.ChatbotSession{}).
-		Where("organization_id = ? AND contact_id = ? AND status = ?", account.OrganizationID, contact.ID, models.SessionStatusActive).
-		Updates(map[string]any{
-			"status":       models.SessionStatusCancelled,
-			"completed_at": time.Now(),
-		})
+	a.handOffSessions(&transfer)
 
 	var agentIDStr string
 	if agentID != nil {
 		agentIDStr = agentID.String()
 	}
-	a.Log.Info("Agent transfer created from keyword rule",
+	a.log(ctx).Info("Agent transfer created by the bot",
 		"transfer_id", transfer.ID,
 		"contact_id", contact.ID,
 		"agent_id", agentIDStr,
+		"source", source,
 	)
 
 	// Broadcast to WebSocket
 	a.broadcastTransferCreated(&transfer, contact)
+	a.notifyHandoffRequested(&transfer, contact)
+	a.openHelpdeskTicket(&transfer, contact)
+}
+
+// routeHandoff returns the team a bot handoff goes to and the agent its
+// assignment strategy picked. Both are nil when no active handoff team is set.
+func (a *App) routeHandoff(settings *models.ChatbotSettings, contact *models.Contact) (*uuid.UUID, *uuid.UUID) {
+	if settings == nil || settings.AgentAssignment.HandoffTeamID == nil {
+		return nil, nil
+	}
+	teamID := *settings.AgentAssignment.HandoffTeamID
+
+	var count int64
+	a.DB.Model(&models.Team{}).
+		Where("id = ? AND organization_id = ? AND is_active = ?", teamID, settings.OrganizationID, true).
+		Count(&count)
+	if count == 0 {
+		a.Log.Warn("Handoff team not found or inactive, using the general queue", "team_id", teamID)
+		return nil, nil
+	}
+	return &teamID, a.assignToTeam(teamID, settings.OrganizationID, contact)
 }
 
-// assignToTeam applies the team's assignment strategy to select an agent
+// assignToTeam applies the team's assignment strategy to select an agent.
+// The contact, if given, is matched against member skills by the skill-based strategy.
 // Returns nil if manual strategy or no available agents
-func (a *App) assignToTeam(teamID uuid.UUID, orgID uuid.UUID) *uuid.UUID {
+func (a *App) assignToTeam(teamID uuid.UUID, orgID uuid.UUID, contact *models.Contact) *uuid.UUID {
 	// Get team and its assignment strategy
 	var team models.Team
 	if err := a.DB.Where("id = ? AND organization_id = ? AND is_active = ?", teamID, orgID, true).First(&team).Error; err != nil {
@@ -1292,6 +1408,8 @@ func (a *App) assignToTeam(teamID uuid.UUID, orgID uuid.UUID) *uuid.UUID {
 		return a.assignToTeamRoundRobin(teamID, orgID)
 	case models.AssignmentStrategyLoadBalanced:
 		return a.assignToTeamLoadBalanced(teamID, orgID)
+	case models.AssignmentStrategySkillBased:
+		return a.assignToTeamSkillBased(teamID, orgID, contact)
 	case models.AssignmentStrategyManual:
 		// Manual means no auto-assignment
 		return nil
@@ -1387,6 +1505,94 @@ func (a *App) assignToTeamLoadBalanced(teamID uuid.UUID, orgID uuid.UUID) *uuid.
 	return lowestUserID
 }
 
+// contactTagSet returns the contact's tags, lowercased
+func contactTagSet(contact *models.Contact) map[string]bool {
+	tags := make(map[string]bool)
+	if contact == nil {
+		return tags
+	}
+	for _, t := range contact.Tags {
+		if tag, ok := t.(string); ok && tag != "" {
+			tags[strings.ToLower(tag)] = true
+		}
+	}
+	return tags
+}
+
+// assignToTeamSkillBased selects the agent whose skills match most of the contact's
+// tags, the least busy one on a tie. Without any match it falls back to load-balanced.
+func (a *App) assignToTeamSkillBased(teamID uuid.UUID, orgID uuid.UUID, contact *models.Contact) *uuid.UUID {
+	tags := contactTagSet(contact)
+	if len(tags) == 0 {
+		return a.assignToTeamLoadBalanced(teamID, orgID)
+	}
+
+	var members []models.TeamMember
+	err := a.DB.
+		Joins("JOIN users ON users.id = team_members.user_id").
+		Where("team_members.team_id = ? AND team_members.role = ? AND users.is_available = ? AND users.is_active = ?",
+			teamID, models.TeamRoleAgent, true, true).
+		Find(&members).Error
+	if err != nil || len(members) == 0 {
+		a.Log.Debug("No available agents in team for skill-based", "team_id", teamID)
+		return nil
+	}
+
+	// Keep the members with the most matching skills
+	var best []models.TeamMember
+	bestScore := 0
+	for _, m := range members {
+		score := 0
+		for _, skill := range m.Skills {
+			if tags[strings.ToLower(skill)] {
+				score++
+			}
+		}
+		if score == 0 || score < bestScore {
+			continue
+		}
+		if score > bestScore {
+			best, bestScore = nil, score
+		}
+		best = append(best, m)
+	}
+	if len(best) == 0 {
+		a.Log.Debug("No agent skills match the contact's tags, using load-balanced", "team_id", teamID)
+		return a.assignToTeamLoadBalanced(teamID, orgID)
+	}
+
+	bestIDs := make([]uuid.UUID, len(best))
+	for i, m := range best {
+		bestIDs[i] = m.UserID
+	}
+	type AgentLoad struct {
+		AgentID uuid.UUID `gorm:"column:agent_id"`
+		Count   int64     `gorm:"column:count"`
+	}
+	var loads []AgentLoad
+	a.DB.Model(&models.AgentTransfer{}).
+		Select("agent_id, COUNT(*) as count").
+		Where("organization_id = ? AND agent_id IN ? AND status = ?", orgID, bestIDs, models.TransferStatusActive).
+		Group("agent_id").
+		Scan(&loads)
+	loadMap := make(map[uuid.UUID]int64)
+	for _, l := range loads {
+		loadMap[l.AgentID] = l.Count
+	}
+
+	selected := best[0]
+	for _, m := range best[1:] {
+		if loadMap[m.UserID] < loadMap[selected.UserID] {
+			selected = m
+		}
+	}
+
+	a.DB.Model(&selected).Update("last_assigned_at", time.Now())
+
+	a.Log.Debug("Skill-based assigned to agent", "team_id", teamID, "user_id", selected.UserID, "matched_skills", bestScore)
+	return &selected.UserID
+}
+
 // createTransferToTeam creates an agent transfer to a specific team with appropriate assignment
 func (a *App) createTransferToTeam(account *models.WhatsAppAccount, contact *models.Contact, teamID uuid.UUID, notes string, source models.TransferSource) {
 	// Check for existing active transfer
@@ -1403,22 +1609,28 @@ func (a *App) createTransferToTeam(account *models.WhatsAppAccount, contact *mod
 	// Get chatbot settings for SLA (use cache)
 	settings, _ := a.getChatbotSettingsCached(account.OrganizationID, account.Name)
 
-	// Apply team's assignment strategy
-	agentID := a.assignToTeam(teamID, account.OrganizationID)
+	// Apply team's assignment strategy; outside business hours the transfer waits
+	// in the team queue and is assigned once hours reopen
+	var agentID *uuid.UUID
+	deferred := settings != nil && a.isOutsideBusinessHours(settings)
+	if !deferred {
+		agentID = a.assignToTeam(teamID, account.OrganizationID, contact)
+	}
 
 	// Create transfer
 	transfer := models.AgentTransfer{
-		BaseModel:       models.BaseModel{ID: uuid.New()},
-		OrganizationID:  account.OrganizationID,
-		ContactID:       contact.ID,
-		WhatsAppAccount: account.Name,
-		PhoneNumber:     contact.PhoneNumber,
-		Status:          models.TransferStatusActive,
-		Source:          source,
-		AgentID:         agentID,
-		TeamID:          &teamID,
-		Notes:           notes,
-		TransferredAt:   time.Now(),
+		BaseModel:          models.BaseModel{ID: uuid.New()},
+		OrganizationID:     account.OrganizationID,
+		ContactID:          contact.ID,
+		WhatsAppAccount:    account.Name,
+		PhoneNumber:        contact.PhoneNumber,
+		Status:             models.TransferStatusActive,
+		Source:             source,
+		AgentID:            agentID,
+		TeamID:             &teamID,
+		Notes:              notes,
+		TransferredAt:      time.Now(),
+		AssignmentDeferred: deferred,
 	}
 
 	// Set SLA deadlines
@@ -1441,13 +1653,7 @@ func (a *App) createTransferToTeam(account *models.WhatsAppAccount, contact *mod
 		a.DB.Model(&contact).Update("assigned_user_id", agentID)
 	}
 
-	// End any active chatbot session
-	a.DB.Model(&models.ChatbotSession{}).
-		Where("organization_id = ? AND contact_id = ? AND status = ?", account.OrganizationID, contact.ID, models.SessionStatusActive).
-		Updates(map[string]any{
-			"status":       models.SessionStatusCancelled,
-			"completed_at": time.Now(),
-		})
+	a.handOffSessions(&transfer)
 
 	var agentIDStrLog string
 	if agentID != nil {
@@ -1463,6 +1669,8 @@ func (a *App) createTransferToTeam(account *models.WhatsAppAccount, contact *mod
 
 	// Broadcast to WebSocket
 	a.broadcastTransferCreated(&transfer, contact)
+	a.notifyHandoffRequested(&transfer, contact)
+	a.openHelpdeskTicket(&transfer, contact)
 }
 
 
@@ -1490,6 +1698,8 @@ func (a *App) ReturnAgentTransfersToQueue(userID, orgID uuid.UUID) int {
 			continue
 		}
 
+		a.syncSessionMode(transfer)
+
 		// Clear contact assignment
 		if transfer.ContactID != uuid.Nil {
 			a.DB.Model(&models.Contact{}).Where("id = ?", transfer.ContactID).Update("assigned_user_id", nil)
@@ -1047,3 +1047,124 @@ func TestApp_ReturnAgentTransfersToQueue(t *testing.T) {
 	assert.Nil(t, updatedTransfer1.AgentID)
 	assert.Nil(t, updatedTransfer2.AgentID)
 }
+
+func TestApp_AssignAgentTransfer_SkillBasedAutoAssign(t *testing.T) {
+	app := agentTransfersTestApp(t)
+	org := createTransferTestOrg(t, app)
+	user := createTransferTestUser(t, app, org.ID, nil)
+	account := createTransferTestAccount(t, app, org.ID)
+
+	billing := createTestAgent(t, app, org.ID)
+	refunds := createTestAgent(t, app, org.ID)
+	team := createTestTeam(t, app, org.ID, billing.ID, refunds.ID)
+	require.NoError(t, app.DB.Model(team).Update("assignment_strategy", models.AssignmentStrategySkillBased).Error)
+	require.NoError(t, app.DB.Model(&models.TeamMember{}).Where("team_id = ? AND user_id = ?", team.ID, billing.ID).
+		Update("skills", models.StringArray{"billing"}).Error)
+	require.NoError(t, app.DB.Model(&models.TeamMember{}).Where("team_id = ? AND user_id = ?", team.ID, refunds.ID).
+		Update("skills", models.StringArray{"Refunds", "billing"}).Error)
+
+	autoAssign := func(tags models.JSONBArray) uuid.UUID {
+		t.Helper()
+		contact := createTestContact(t, app, org.ID)
+		require.NoError(t, app.DB.Model(contact).Update("tags", tags).Error)
+		transfer := createTestTransfer(t, app, org.ID, contact.ID, account.Name, models.TransferStatusActive, nil)
+
+		req := testutil.NewJSONRequest(t, map[string]any{
+			"team_id":     team.ID.String(),
+			"auto_assign": true,
+		})
+		setTransferAuthContext(req, org.ID, user.ID)
+		testutil.SetPathParam(req, "id", transfer.ID.String())
+		require.NoError(t, app.AssignAgentTransfer(req))
+		require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+		var updated models.AgentTransfer
+		require.NoError(t, app.DB.First(&updated, transfer.ID).Error)
+		require.NotNil(t, updated.AgentID)
+		require.NotNil(t, updated.TeamID)
+		assert.Equal(t, team.ID, *updated.TeamID)
+		return *updated.AgentID
+	}
+
+	// Both agents know billing, only one also handles refunds
+	assert.Equal(t, refunds.ID, autoAssign(models.JSONBArray{"refunds", "billing"}))
+	// No skill matches, so the least busy agent is picked
+	assert.Equal(t, billing.ID, autoAssign(models.JSONBArray{"shipping"}))
+
+	// A transfer outside a team can't be auto-assigned
+	contact := createTestContact(t, app, org.ID)
+	transfer := createTestTransfer(t, app, org.ID, contact.ID, account.Name, models.TransferStatusActive, nil)
+	req := testutil.NewJSONRequest(t, map[string]any{"auto_assign": true})
+	setTransferAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", transfer.ID.String())
+	require.NoError(t, app.AssignAgentTransfer(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "no team to auto-assign from")
+}
+
+func TestApp_CreateAgentTransfer_SLAPolicy(t *testing.T) {
+	app := agentTransfersTestApp(t)
+	org := createTransferTestOrg(t, app)
+	user := createTransferTestUser(t, app, org.ID, nil)
+	account := createTransferTestAccount(t, app, org.ID)
+	require.NoError(t, app.DB.Create(&models.ChatbotSettings{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		IsEnabled:      true,
+	}).Error)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"name":                   "Urgent VIPs",
+		"priority":               models.TransferPriorityUrgent,
+		"tags":                   []string{"vip"},
+		"first_response_minutes": 5,
+		"resolution_minutes":     30,
+	})
+	setTransferAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.CreateSLAPolicy(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	var policy handlers.SLAPolicyResponse
+	testutil.ParseEnvelopeResponse(t, req, &policy)
+	assert.Equal(t, 80, policy.AtRiskPercent)
+
+	contact := createTestContact(t, app, org.ID)
+	require.NoError(t, app.DB.Model(contact).Update("tags", models.JSONBArray{"VIP"}).Error)
+
+	req = testutil.NewJSONRequest(t, map[string]any{
+		"contact_id":       contact.ID.String(),
+		"whatsapp_account": account.Name,
+		"priority":         models.TransferPriorityUrgent,
+	})
+	setTransferAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.CreateAgentTransfer(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var result struct {
+		Transfer handlers.AgentTransferResponse `json:"transfer"`
+	}
+	testutil.ParseEnvelopeResponse(t, req, &result)
+	require.NotNil(t, result.Transfer.SLAPolicyID)
+	assert.Equal(t, policy.ID.String(), *result.Transfer.SLAPolicyID)
+	assert.Equal(t, models.SLAStatusOnTrack, result.Transfer.SLAStatus)
+	assert.Equal(t, models.TransferPriorityUrgent, result.Transfer.Priority)
+
+	var transfer models.AgentTransfer
+	require.NoError(t, app.DB.First(&transfer, "id = ?", result.Transfer.ID).Error)
+	require.NotNil(t, transfer.SLA.ResponseDeadline)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), *transfer.SLA.ResponseDeadline, time.Minute)
+
+	// Lowering the priority leaves the policy
+	req = testutil.NewJSONRequest(t, map[string]any{"priority": models.TransferPriorityNormal})
+	setTransferAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", transfer.ID.String())
+	require.NoError(t, app.SetTransferPriority(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	require.NoError(t, app.DB.First(&transfer, "id = ?", transfer.ID).Error)
+	assert.Nil(t, transfer.SLA.PolicyID)
+	assert.Equal(t, models.TransferPriorityNormal, transfer.Priority)
+
+	req = testutil.NewJSONRequest(t, map[string]any{"priority": "critical"})
+	setTransferAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", transfer.ID.String())
+	require.NoError(t, app.SetTransferPriority(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "Invalid priority")
+}
@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+)
+
+const (
+	// aiBotButtonPrefix marks the button IDs of bot buttons, so a tap sends the
+	// button's payload back to the bot instead of its title
+	aiBotButtonPrefix = "ai_bot:"
+	// aiBotButtonsBody is the body of a bot message with buttons but no text, as
+	// WhatsApp requires one
+	aiBotButtonsBody = "Please choose an option:"
+	// maxAIBotButtonID is WhatsApp's limit on button IDs
+	maxAIBotButtonID = 256
+	// maxAIBotReplyButtons is WhatsApp's limit on reply buttons; bots with more
+	// options get a list message
+	maxAIBotReplyButtons = 3
+	// maxAIBotMediaSize limits media downloaded from the bot; WhatsApp takes up to 16MB of video
+	maxAIBotMediaSize = 16 * 1024 * 1024
+)
+
+// Actions a bot can run with a custom payload such as {"action": "handoff_to_agent"}
+const (
+	aiBotActionHandoff      = "handoff_to_agent" // Hand the conversation to an agent
+	aiBotActionCloseSession = "close_session"    // End the chatbot session
+	aiBotActionSendTemplate = "send_template"    // Send an approved template, e.g. "send_template:welcome"
+)
+
+// aiBotMessage is a message of a bot that answers in the Rasa REST channel
+// format, a list such as [{"text": "...", "buttons": [...]}, {"image": "https://..."}]
+type aiBotMessage struct {
+	Text       string          `json:"text"`
+	Buttons    []aiBotButton   `json:"buttons"`
+	Image      string          `json:"image"`
+	Attachment json.RawMessage `json:"attachment"` // A URL, or {"type": "video", "payload": {"src": "https://..."}}
+	Custom     *aiBotAction    `json:"custom"`
+}
+
+// aiBotAction is a custom payload of a bot message that runs a platform action.
+// The template of send_template can be given after a colon or in its own field.
+type aiBotAction struct {
+	Action   string                 `json:"action"`
+	Template string                 `json:"template"`
+	Language string                 `json:"language"`
+	Params   map[string]interface{} `json:"params"`
+}
+
+// UnmarshalJSON reads a custom payload given as an object or as the action
+// alone, e.g. "close_session". Other custom payloads aren't actions.
+func (c *aiBotAction) UnmarshalJSON(data []byte) error {
+	var action string
+	if err := json.Unmarshal(data, &action); err == nil {
+		c.Action = action
+		return nil
+	}
+	type plain aiBotAction
+	var obj plain
+	if err := json.Unmarshal(data, &obj); err == nil {
+		*c = aiBotAction(obj)
+	}
+	return nil
+}
+
+// name returns the action without its argument, and the template to send
+func (c aiBotAction) name() (string, string) {
+	action, arg, _ := strings.Cut(strings.TrimSpace(c.Action), ":")
+	if c.Template != "" {
+		arg = c.Template
+	}
+	return action, strings.TrimSpace(arg)
+}
+
+// aiBotButton is a button of a bot message. Its payload, e.g. "/affirm", is
+// sent back to the bot when the button is tapped.
+type aiBotButton struct {
+	Title   string `json:"title"`
+	Payload string `json:"payload"`
+}
+
+// media returns the URL and the message type of the message's image or attachment
+func (m aiBotMessage) media() (string, models.MessageType) {
+	if m.Image != "" {
+		return m.Image, models.MessageTypeImage
+	}
+	if len(m.Attachment) == 0 {
+		return "", ""
+	}
+
+	var link string
+	if err := json.Unmarshal(m.Attachment, &link); err == nil {
+		return link, ""
+	}
+	var attachment struct {
+		Type    string `json:"type"`
+		Payload struct {
+			Src string `json:"src"`
+			URL string `json:"url"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(m.Attachment, &attachment); err != nil {
+		return "", ""
+	}
+	link = attachment.Payload.Src
+	if link == "" {
+		link = attachment.Payload.URL
+	}
+	switch attachment.Type {
+	case "image":
+		return link, models.MessageTypeImage
+	case "video":
+		return link, models.MessageTypeVideo
+	case "audio":
+		return link, models.MessageTypeAudio
+	case "file", "document":
+		return link, models.MessageTypeDocument
+	}
+	return link, ""
+}
+
+// parseAIBotMessages reads a webhook response in the Rasa format. It reports
+// false for other responses, which are read with the reply path instead.
+func parseAIBotMessages(body []byte, replyPath string) ([]aiBotMessage, bool) {
+	// A custom path into an object response is for another kind of bot
+	replyPath = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(replyPath), "$"), ".")
+	if replyPath != "" && !strings.HasPrefix(replyPath, "[") {
+		return nil, false
+	}
+
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil || len(items) == 0 {
+		return nil, false
+	}
+	rich := false
+	for _, item := range items {
+		for _, key := range []string{"text", "buttons", "image", "attachment", "custom"} {
+			if _, ok := item[key]; ok {
+				rich = true
+			}
+		}
+	}
+	if !rich {
+		return nil, false
+	}
+
+	var messages []aiBotMessage
+	if err := json.Unmarshal(body, &messages); err != nil {
+		return nil, false
+	}
+	return messages, true
+}
+
+// aiBotMessagesText is the text of bot messages, kept in the session history.
+// Media is noted by its file name and custom payloads by their action.
+func aiBotMessagesText(messages []aiBotMessage) string {
+	parts := make([]string, 0, len(messages))
+	for _, m := range messages {
+		if link, _ := m.media(); link != "" {
+			parts = append(parts, "["+path.Base(link)+"]")
+		}
+		if text := strings.TrimSpace(m.Text); text != "" {
+			parts = append(parts, text)
+		}
+		if m.Custom != nil && m.Custom.Action != "" {
+			parts = append(parts, "["+strings.TrimSpace(m.Custom.Action)+"]")
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// aiBotButtonsToMaps converts bot buttons to interactive buttons. Titles are
+// cut to WhatsApp's limit; payloads are kept in the button IDs, so buttons with
+// payloads too long for an ID are left out.
+func aiBotButtonsToMaps(buttons []aiBotButton) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(buttons))
+	for _, btn := range buttons {
+		title := strings.TrimSpace(btn.Title)
+		if title == "" {
+			continue
+		}
+		payload := btn.Payload
+		if payload == "" {
+			payload = title
+		}
+		if len(aiBotButtonPrefix)+len(payload) > maxAIBotButtonID {
+			continue
+		}
+		if runes := []rune(title); len(runes) > maxQuickReplyTitle {
+			title = string(runes[:maxQuickReplyTitle])
+		}
+		result = append(result, map[string]interface{}{
+			"id":    aiBotButtonPrefix + payload,
+			"title": title,
+		})
+	}
+	return result
+}
+
+// aiBotList converts the buttons of a bot message with more options than reply
+// buttons allow to a list message. Titles too long for a row are cut and kept
+// whole in the row description; buttons whose payload is too long for a row ID,
+// repeated payloads and rows past WhatsApp's limit are left out.
+func aiBotList(buttons []aiBotButton) *whatsapp.ListMessage {
+	var rows []whatsapp.ListRow
+	seen := make(map[string]bool)
+	for _, btn := range buttons {
+		title := strings.TrimSpace(btn.Title)
+		if title == "" {
+			continue
+		}
+		payload := btn.Payload
+		if payload == "" {
+			payload = title
+		}
+		id := aiBotButtonPrefix + payload
+		if len(id) > whatsapp.MaxListRowID || seen[id] {
+			continue
+		}
+		if len(rows) == whatsapp.MaxListRows {
+			break
+		}
+		seen[id] = true
+
+		row := whatsapp.ListRow{ID: id, Title: title}
+		if runes := []rune(title); len(runes) > whatsapp.MaxListRowTitle {
+			row.Title = strings.TrimSpace(string(runes[:whatsapp.MaxListRowTitle]))
+			if len(runes) > whatsapp.MaxListRowDescription {
+				runes = runes[:whatsapp.MaxListRowDescription]
+			}
+			row.Description = string(runes)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return &whatsapp.ListMessage{
+		ButtonText: whatsapp.DefaultListButtonText,
+		Sections:   []whatsapp.ListSection{{Rows: rows}},
+	}
+}
+
+// sendAIBotMessages sends the messages of a bot in order: media with the text as
+// caption, buttons as interactive messages, or a list past three buttons, and text. Quick replies are added to
+// a final text message. Custom payloads run their action after the message.
+func (a *App) sendAIBotMessages(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, session *models.ChatbotSession, settings *models.ChatbotSettings, messages []aiBotMessage) error {
+	var firstErr error
+	for i, m := range messages {
+		text := strings.TrimSpace(m.Text)
+		var buttons []map[string]interface{}
+		var list *whatsapp.ListMessage
+		if len(m.Buttons) > maxAIBotReplyButtons {
+			list = aiBotList(m.Buttons)
+		} else {
+			buttons = aiBotButtonsToMaps(m.Buttons)
+		}
+
+		var err error
+		if link, mediaType := m.media(); link != "" {
+			caption := ""
+			if len(buttons) == 0 && list == nil && mediaType != models.MessageTypeAudio {
+				caption, text = text, ""
+			}
+			if err = a.sendAIBotMedia(ctx, account, contact, link, mediaType, caption); err != nil {
+				a.log(ctx).Error("Failed to send bot media", "error", err, "url", link, "contact", contact.PhoneNumber)
+				// Still send the caption so the answer isn't lost
+				text = caption + text
+			}
+		}
+
+		switch {
+		case list != nil:
+			if utf8.RuneCountInString(text) > whatsapp.MaxListBody {
+				// Too long for the body, so the text goes first
+				if err = a.sendAndSaveTextMessage(ctx, account, contact, text); err != nil && firstErr == nil {
+					firstErr = err
+				}
+				text = ""
+			}
+			if text == "" {
+				text = aiBotButtonsBody
+			}
+			list.Body = text
+			err = a.sendAndSaveListMessage(ctx, account, contact, *list)
+		case len(buttons) > 0:
+			if utf8.RuneCountInString(text) > maxInteractiveBody {
+				// Too long for the body, so the text goes first
+				if err = a.sendAndSaveTextMessage(ctx, account, contact, text); err != nil && firstErr == nil {
+					firstErr = err
+				}
+				text = ""
+			}
+			if text == "" {
+				text = aiBotButtonsBody
+			}
+			err = a.sendAndSaveInteractiveButtons(ctx, account, contact, text, buttons)
+		case text != "" && i == len(messages)-1:
+			err = a.sendAIResponse(ctx, account, contact, settings, text)
+		case text != "":
+			err = a.sendAndSaveTextMessage(ctx, account, contact, text)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		if m.Custom != nil && m.Custom.Action != "" {
+			if err := a.runAIBotAction(ctx, account, contact, session, *m.Custom); err != nil {
+				a.log(ctx).Error("Failed to run bot action", "error", err, "action", m.Custom.Action, "contact", contact.PhoneNumber)
+			}
+		}
+	}
+	return firstErr
+}
+
+// runAIBotAction runs the platform action of a bot's custom payload
+func (a *App) runAIBotAction(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, session *models.ChatbotSession, custom aiBotAction) error {
+	action, template := custom.name()
+	a.log(ctx).Info("Running bot action", "action", action, "contact", contact.PhoneNumber)
+
+	switch action {
+	case aiBotActionHandoff:
+		a.createTransferFromBot(ctx, account, contact, models.TransferSourceAI)
+		return nil
+
+	case aiBotActionCloseSession:
+		a.closeSession(session)
+		return nil
+
+	case aiBotActionSendTemplate:
+		if template == "" {
+			return fmt.Errorf("no template given")
+		}
+		query := a.DB.Where("organization_id = ? AND whats_app_account = ? AND name = ? AND status = ?",
+			account.OrganizationID, account.Name, template, models.TemplateStatusApproved)
+		if custom.Language != "" {
+			query = query.Where("language = ?", custom.Language)
+		}
+		params := make(map[string]string, len(custom.Params))
+		for k, v := range custom.Params {
+			params[k] = fmt.Sprint(v)
+		}
+		var tmpl models.Template
+		if err := query.Order("created_at").First(&tmpl).Error; err != nil {
+			return fmt.Errorf("approved template %q not found", template)
+		}
+		_, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+			Account:    account,
+			Contact:    contact,
+			Type:       models.MessageTypeTemplate,
+			Template:   &tmpl,
+			BodyParams: params,
+		}, ChatbotSendOptions())
+		return err
+	}
+	return fmt.Errorf("unknown action %q", action)
+}
+
+// sendAIBotMedia downloads media sent by the bot and sends it to the contact.
+// Without a type from the bot, it's taken from the content type.
+func (a *App) sendAIBotMedia(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, link string, mediaType models.MessageType, caption string) error {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("media URL must be an http or https URL")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download media: %w", err)
+	}
+	resp, err := a.httpClient(config.OutboundAI, 30*time.Second).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download media: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("media download returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAIBotMediaSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read media: %w", err)
+	}
+	if len(data) > maxAIBotMediaSize {
+		return fmt.Errorf("media is larger than %d MB", maxAIBotMediaSize/1024/1024)
+	}
+
+	mimeType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = strings.Split(http.DetectContentType(data), ";")[0]
+	}
+	if mediaType == "" {
+		switch {
+		case strings.HasPrefix(mimeType, "image/"):
+			mediaType = models.MessageTypeImage
+		case strings.HasPrefix(mimeType, "video/"):
+			mediaType = models.MessageTypeVideo
+		case strings.HasPrefix(mimeType, "audio/"):
+			mediaType = models.MessageTypeAudio
+		default:
+			mediaType = models.MessageTypeDocument
+		}
+	}
+
+	filename := path.Base(u.Path)
+	if filename == "/" || filename == "." {
+		filename = "attachment"
+	}
+	localPath, err := a.saveMedia(account.OrganizationID, data, mimeType, filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account:       account,
+		Contact:       contact,
+		Type:          mediaType,
+		MediaData:     data,
+		MediaURL:      localPath,
+		MediaMimeType: mimeType,
+		MediaFilename: filename,
+		Caption:       caption,
+	}, ChatbotSendOptions())
+	return err
+}
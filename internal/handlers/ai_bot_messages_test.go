@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAIBotMessages(t *testing.T) {
+	body := []byte(`[
+		{"recipient_id": "1", "text": "Did that help?", "buttons": [{"title": "Yes", "payload": "/affirm"}, {"title": "No", "payload": "/deny"}]},
+		{"recipient_id": "1", "image": "https://bot.example.com/img/map.png"},
+		{"recipient_id": "1", "attachment": {"type": "video", "payload": {"src": "https://bot.example.com/tour.mp4"}}}
+	]`)
+
+	messages, ok := parseAIBotMessages(body, "")
+	require.True(t, ok)
+	require.Len(t, messages, 3)
+	assert.Equal(t, []aiBotButton{{Title: "Yes", Payload: "/affirm"}, {Title: "No", Payload: "/deny"}}, messages[0].Buttons)
+
+	link, mediaType := messages[1].media()
+	assert.Equal(t, "https://bot.example.com/img/map.png", link)
+	assert.Equal(t, models.MessageTypeImage, mediaType)
+	link, mediaType = messages[2].media()
+	assert.Equal(t, "https://bot.example.com/tour.mp4", link)
+	assert.Equal(t, models.MessageTypeVideo, mediaType)
+
+	assert.Equal(t, "Did that help?\n\n[map.png]\n\n[tour.mp4]", aiBotMessagesText(messages))
+
+	// A path into the list still reads Rasa messages; other paths and bodies don't
+	_, ok = parseAIBotMessages(body, "$[0].text")
+	assert.True(t, ok)
+	_, ok = parseAIBotMessages([]byte(`{"reply": "Hi"}`), "reply")
+	assert.False(t, ok)
+	_, ok = parseAIBotMessages([]byte(`[{"reply": "Hi"}]`), "$[0].reply")
+	assert.False(t, ok)
+	_, ok = parseAIBotMessages([]byte(`plain text`), "")
+	assert.False(t, ok)
+}
+
+func TestAIBotButtonsToMaps(t *testing.T) {
+	buttons := aiBotButtonsToMaps([]aiBotButton{
+		{Title: "Check my order status", Payload: `/order_status{"source": "menu"}`},
+		{Title: "Talk to us"},
+		{Title: " ", Payload: "/empty"},
+		{Title: "Too long", Payload: "/" + strings.Repeat("x", maxAIBotButtonID)},
+	})
+	assert.Equal(t, []map[string]interface{}{
+		{"id": aiBotButtonPrefix + `/order_status{"source": "menu"}`, "title": "Check my order statu"},
+		{"id": aiBotButtonPrefix + "Talk to us", "title": "Talk to us"},
+	}, buttons)
+}
+
+func TestAIBotList(t *testing.T) {
+	list := aiBotList([]aiBotButton{
+		{Title: "Track an order", Payload: "/track"},
+		{Title: "Return an item I bought last week", Payload: "/return"},
+		{Title: "Track an order again", Payload: "/track"},
+		{Title: "Too long", Payload: "/" + strings.Repeat("x", whatsapp.MaxListRowID)},
+		{Title: "Billing"},
+		{Title: "Shipping"},
+	})
+	require.NotNil(t, list)
+	require.Len(t, list.Sections, 1)
+	assert.Equal(t, []whatsapp.ListRow{
+		{ID: aiBotButtonPrefix + "/track", Title: "Track an order"},
+		{ID: aiBotButtonPrefix + "/return", Title: "Return an item I bought", Description: "Return an item I bought last week"},
+		{ID: aiBotButtonPrefix + "Billing", Title: "Billing"},
+		{ID: aiBotButtonPrefix + "Shipping", Title: "Shipping"},
+	}, list.Sections[0].Rows)
+
+	list.Body = aiBotButtonsBody
+	assert.NoError(t, list.Validate())
+
+	assert.Nil(t, aiBotList([]aiBotButton{{Title: " "}}))
+}
+
+func TestParseAIBotMessagesCustom(t *testing.T) {
+	body := []byte(`[
+		{"recipient_id": "1", "text": "Connecting you to our team."},
+		{"recipient_id": "1", "custom": {"action": "handoff_to_agent"}},
+		{"recipient_id": "1", "custom": "send_template:welcome"},
+		{"recipient_id": "1", "custom": {"action": "send_template", "template": "order_update", "params": {"1": "Alice", "2": 42}}},
+		{"recipient_id": "1", "custom": {"blocks": [1, 2]}}
+	]`)
+
+	messages, ok := parseAIBotMessages(body, "")
+	require.True(t, ok)
+	require.Len(t, messages, 5)
+
+	action, template := messages[1].Custom.name()
+	assert.Equal(t, aiBotActionHandoff, action)
+	assert.Empty(t, template)
+	action, template = messages[2].Custom.name()
+	assert.Equal(t, aiBotActionSendTemplate, action)
+	assert.Equal(t, "welcome", template)
+	action, template = messages[3].Custom.name()
+	assert.Equal(t, aiBotActionSendTemplate, action)
+	assert.Equal(t, "order_update", template)
+	assert.Equal(t, map[string]interface{}{"1": "Alice", "2": float64(42)}, messages[3].Custom.Params)
+	assert.Empty(t, messages[4].Custom.Action, "other custom payloads aren't actions")
+
+	assert.Equal(t, "Connecting you to our team.\n\n[handoff_to_agent]\n\n[send_template:welcome]\n\n[send_template]", aiBotMessagesText(messages))
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+const (
+	// aiCachePrefix prefixes the Redis keys of cached AI responses, followed by the organization
+	aiCachePrefix = "ai_cache:"
+
+	// maxAICachedQuestion limits the length of questions answered from the cache;
+	// longer messages are rarely asked twice
+	maxAICachedQuestion = 300
+
+	// maxAICacheTTLMinutes limits how long responses are cached, a week
+	maxAICacheTTLMinutes = 7 * 24 * 60
+)
+
+// cachedAIResponse is an AI response stored in Redis
+type cachedAIResponse struct {
+	Text     string            `json:"text"`
+	Provider models.AIProvider `json:"provider"`
+	Model    string            `json:"model"`
+}
+
+// normalizeAIQuestion reduces a message to lowercase words, so questions that only
+// differ in case, punctuation or spacing share a cached response
+func normalizeAIQuestion(message string) string {
+	words := strings.FieldsFunc(strings.ToLower(message), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// aiResponseCacheKey returns the cache key of the response to a message, or ""
+// when the response can't be shared with other contacts. Keys are per chatbot
+// settings, language and experiment variant, and saving the settings starts
+// a new cache.
+func (a *App) aiResponseCacheKey(settings *models.ChatbotSettings, session *models.ChatbotSession, message string) string {
+	if settings.AI.CacheTTLMinutes <= 0 || a.Redis == nil {
+		return ""
+	}
+	question := normalizeAIQuestion(message)
+	if question == "" || utf8.RuneCountInString(question) > maxAICachedQuestion {
+		return ""
+	}
+	if !a.aiResponseShareable(settings, session, message) {
+		return ""
+	}
+
+	lang := conversationLanguage(settings, session, nil)
+	variant := ""
+	if session != nil {
+		variant = session.AIVariant
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		settings.ID.String(),
+		strconv.FormatInt(settings.UpdatedAt.UnixMicro(), 10),
+		lang,
+		variant,
+		question,
+	}, "\x00")))
+	return aiCachePrefix + settings.OrganizationID.String() + ":" + hex.EncodeToString(sum[:])
+}
+
+// aiResponseShareable reports whether the response to a message depends only on
+// the question: not on the contact, nor on what was said before
+func (a *App) aiResponseShareable(settings *models.ChatbotSettings, session *models.ChatbotSession, message string) bool {
+	// Bots keep their own state per sender, and tools look up the contact's data
+	if aiVariantSettings(settings, session).AI.Provider == models.AIProviderWebhook || len(settings.AI.Tools) > 0 {
+		return false
+	}
+
+	prompt := localizedMessage(settings, conversationLanguage(settings, session, nil), translationSystemPrompt, settings.AI.SystemPrompt)
+	if persona, ok := activeAIPersona(settings); ok {
+		prompt = persona.Prompt
+	}
+	if strings.Contains(prompt, "{{contact_name}}") || strings.Contains(prompt, "{{phone_number}}") {
+		return false
+	}
+
+	// API contexts can fetch data about the contact
+	whatsAppAccount := ""
+	if session != nil {
+		whatsAppAccount = session.WhatsAppAccount
+	}
+	contexts, _ := a.getAIContextsCached(settings.OrganizationID, whatsAppAccount)
+	for _, c := range contexts {
+		if c.ContextType == models.ContextTypeAPI {
+			return false
+		}
+	}
+
+	// Follow-up questions are answered in the context of the conversation
+	if aiHistorySummary(settings, session) != "" {
+		return false
+	}
+	for _, m := range a.aiConversationHistory(settings, session, message) {
+		if m.Direction == models.DirectionIncoming {
+			return false
+		}
+	}
+	return true
+}
+
+// cachedAICompletion returns the cached response for a key, if any
+func (a *App) cachedAICompletion(key string) *aiCompletion {
+	if key == "" {
+		return nil
+	}
+	data, err := a.Redis.Get(context.Background(), key).Bytes()
+	if err != nil {
+		return nil
+	}
+	var cached cachedAIResponse
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Text == "" {
+		return nil
+	}
+	return &aiCompletion{Text: cached.Text, Provider: cached.Provider, Model: cached.Model, Cached: true, CacheKey: key}
+}
+
+// cacheAIResponse stores a response that was sent, for the settings' cache TTL.
+// Rich bot messages aren't cached.
+func (a *App) cacheAIResponse(settings *models.ChatbotSettings, completion *aiCompletion) {
+	if completion.CacheKey == "" || completion.Cached || completion.Text == "" || len(completion.Messages) > 0 {
+		return
+	}
+	data, err := json.Marshal(cachedAIResponse{Text: completion.Text, Provider: completion.Provider, Model: completion.Model})
+	if err != nil {
+		return
+	}
+	ttl := time.Duration(settings.AI.CacheTTLMinutes) * time.Minute
+	if err := a.Redis.Set(context.Background(), completion.CacheKey, data, ttl).Err(); err != nil {
+		a.Log.Error("Failed to cache AI response", "error", err)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeAIQuestion(t *testing.T) {
+	assert.Equal(t, "what are your hours", normalizeAIQuestion("  What are your HOURS?? "))
+	assert.Equal(t, "qué horario tienen", normalizeAIQuestion("¿Qué horario tienen?"))
+	assert.Equal(t, "open on dec 24", normalizeAIQuestion("Open on Dec-24!"))
+	assert.Empty(t, normalizeAIQuestion("👍 ?!"))
+}
+
+func TestAIResponseCache(t *testing.T) {
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: uuid.New(),
+		AI:             models.AIConfig{Provider: models.AIProviderOpenAI, CacheTTLMinutes: 60},
+	}
+	assert.Empty(t, app.aiResponseCacheKey(settings, nil, "What are your hours?"), "caching needs Redis")
+
+	redis := testutil.SetupTestRedis(t)
+	if redis == nil {
+		t.Skip("TEST_REDIS_URL not set")
+	}
+	app.Redis = redis
+
+	// No AI contexts are configured
+	contextsKey := fmt.Sprintf("%s%s:", aiContextsCachePrefix, settings.OrganizationID)
+	require.NoError(t, redis.Set(context.Background(), contextsKey, "[]", 0).Err())
+
+	key := app.aiResponseCacheKey(settings, nil, "What are your hours?")
+	require.NotEmpty(t, key)
+	t.Cleanup(func() { redis.Del(context.Background(), key, contextsKey) })
+	assert.Equal(t, key, app.aiResponseCacheKey(settings, nil, "what are your  hours"))
+	assert.NotEqual(t, key, app.aiResponseCacheKey(settings, nil, "Where are you?"))
+	assert.Empty(t, app.aiResponseCacheKey(settings, nil, "?"))
+
+	// Responses that depend on the contact aren't cached
+	personalized := *settings
+	personalized.AI.SystemPrompt = "Greet {{contact_name}} by name."
+	assert.Empty(t, app.aiResponseCacheKey(&personalized, nil, "What are your hours?"))
+	withTools := *settings
+	withTools.AI.Tools = models.JSONBArray{map[string]interface{}{"name": "order_status"}}
+	assert.Empty(t, app.aiResponseCacheKey(&withTools, nil, "What are your hours?"))
+	webhook := *settings
+	webhook.AI.Provider = models.AIProviderWebhook
+	assert.Empty(t, app.aiResponseCacheKey(&webhook, nil, "What are your hours?"))
+
+	assert.Nil(t, app.cachedAICompletion(key))
+	app.cacheAIResponse(settings, &aiCompletion{Text: "We're open 9-5.", Provider: models.AIProviderOpenAI, Model: "gpt-4o-mini", CacheKey: key})
+	cached := app.cachedAICompletion(key)
+	require.NotNil(t, cached)
+	assert.True(t, cached.Cached)
+	assert.Equal(t, "We're open 9-5.", cached.Text)
+	assert.Equal(t, "gpt-4o-mini", cached.Model)
+}
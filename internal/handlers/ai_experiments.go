@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+const (
+	// maxAIExperiments limits the variants tried against the primary provider
+	maxAIExperiments = 3
+	// aiControlVariant tags sessions answered by the primary provider while experiments run
+	aiControlVariant = "control"
+)
+
+// AIExperiment routes a share of new sessions to another provider or model. It
+// shares the primary provider's prompt, token, temperature and webhook settings.
+type AIExperiment struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Provider  models.AIProvider `json:"provider"`
+	Model     string            `json:"model"`
+	BaseURL   string            `json:"base_url,omitempty"`
+	APIKey    string            `json:"api_key,omitempty"` // Write-only; empty keeps the stored key
+	HasAPIKey bool              `json:"has_api_key"`
+	Percent   int               `json:"percent"` // Share of new sessions, 1-100
+}
+
+// aiExperiments returns the experiments configured on the chatbot settings,
+// including their API keys
+func aiExperiments(settings *models.ChatbotSettings) []AIExperiment {
+	experiments := make([]AIExperiment, 0, len(settings.AI.Experiments))
+	for _, item := range settings.AI.Experiments {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		experiment := AIExperiment{
+			ID:       getStringFromMap(m, "id"),
+			Name:     getStringFromMap(m, "name"),
+			Provider: models.AIProvider(getStringFromMap(m, "provider")),
+			Model:    getStringFromMap(m, "model"),
+			BaseURL:  getStringFromMap(m, "base_url"),
+			APIKey:   models.SettingSecret(m, models.AIProviderSecretKey),
+		}
+		if percent, ok := m["percent"].(float64); ok {
+			experiment.Percent = int(percent)
+		}
+		if experiment.ID == "" || experiment.Provider == "" {
+			continue
+		}
+		experiment.HasAPIKey = experiment.APIKey != ""
+		experiments = append(experiments, experiment)
+	}
+	return experiments
+}
+
+// aiExperimentsResponse returns the experiments without their API keys
+func aiExperimentsResponse(settings *models.ChatbotSettings) []AIExperiment {
+	experiments := aiExperiments(settings)
+	for i := range experiments {
+		experiments[i].APIKey = ""
+	}
+	return experiments
+}
+
+// validateAIExperiments checks and normalizes experiments before they are saved.
+// Experiments without an ID get one; one sent without an API key keeps the key
+// stored for the same ID and provider.
+func validateAIExperiments(experiments []AIExperiment, existing []AIExperiment) ([]interface{}, error) {
+	if len(experiments) > maxAIExperiments {
+		return nil, fmt.Errorf("at most %d experiments are allowed", maxAIExperiments)
+	}
+	stored := make(map[string]AIExperiment, len(existing))
+	for _, experiment := range existing {
+		stored[experiment.ID] = experiment
+	}
+
+	items := make([]interface{}, len(experiments))
+	seen := make(map[string]bool, len(experiments))
+	total := 0
+	for i, experiment := range experiments {
+		id := strings.TrimSpace(experiment.ID)
+		if id == "" {
+			id = uuid.New().String()[:8]
+		}
+		if id == aiControlVariant || len(id) > 50 {
+			return nil, fmt.Errorf("invalid experiment id %q", id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("duplicate experiment id %q", id)
+		}
+		seen[id] = true
+
+		name := strings.TrimSpace(experiment.Name)
+		if name == "" {
+			return nil, fmt.Errorf("experiments need a name")
+		}
+		if !isAIProvider(experiment.Provider) {
+			return nil, fmt.Errorf("unsupported provider %q", experiment.Provider)
+		}
+		if experiment.Percent < 1 || experiment.Percent > 100 {
+			return nil, fmt.Errorf("experiment %q must get between 1 and 100 percent of sessions", name)
+		}
+		total += experiment.Percent
+		baseURL, err := normalizeAIBaseURL(experiment.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		apiKey := experiment.APIKey
+		if prev, ok := stored[id]; apiKey == "" && ok && prev.Provider == experiment.Provider {
+			apiKey = prev.APIKey
+		}
+
+		item := map[string]interface{}{
+			"id":       id,
+			"name":     name,
+			"provider": string(experiment.Provider),
+			"model":    experiment.Model,
+			"percent":  experiment.Percent,
+		}
+		if baseURL != "" {
+			item["base_url"] = baseURL
+		}
+		if apiKey != "" {
+			item["api_key"] = apiKey
+		}
+		items[i] = item
+	}
+	if total > 100 {
+		return nil, fmt.Errorf("experiments can get at most 100 percent of sessions, got %d", total)
+	}
+	return items, nil
+}
+
+// pickAIVariant picks the variant of a new session for a roll in [0, 100).
+// Rolls past the experiments' shares go to the control group.
+func pickAIVariant(experiments []AIExperiment, roll int) string {
+	for _, experiment := range experiments {
+		if roll < experiment.Percent {
+			return experiment.ID
+		}
+		roll -= experiment.Percent
+	}
+	return aiControlVariant
+}
+
+// assignAIVariant routes a new session to an experiment or the control group,
+// while experiments run
+func (a *App) assignAIVariant(settings *models.ChatbotSettings, session *models.ChatbotSession) {
+	experiments := aiExperiments(settings)
+	if len(experiments) == 0 || !settings.AI.Enabled {
+		return
+	}
+	session.AIVariant = pickAIVariant(experiments, rand.IntN(100))
+	if err := a.DB.Model(session).Update("ai_variant", session.AIVariant).Error; err != nil {
+		a.Log.Error("Failed to save AI variant", "error", err, "session_id", session.ID)
+	}
+}
+
+// aiVariantSettings returns the settings answering a session: the experiment it
+// was routed to, or the settings as they are. Sessions of a removed experiment
+// go back to the primary provider.
+func aiVariantSettings(settings *models.ChatbotSettings, session *models.ChatbotSession) *models.ChatbotSettings {
+	if session == nil || session.AIVariant == "" || session.AIVariant == aiControlVariant {
+		return settings
+	}
+	for _, experiment := range aiExperiments(settings) {
+		if experiment.ID != session.AIVariant {
+			continue
+		}
+		variant := *settings
+		variant.AI.Provider = experiment.Provider
+		variant.AI.Model = experiment.Model
+		variant.AI.BaseURL = experiment.BaseURL
+		variant.AI.APIKey = experiment.APIKey
+		if !aiConfigured(variant.AI) {
+			return settings
+		}
+		return &variant
+	}
+	return settings
+}
+
+// AIExperimentResult is the outcome of the sessions of one variant
+type AIExperimentResult struct {
+	Variant        string            `json:"variant"`
+	Name           string            `json:"name"`
+	Provider       models.AIProvider `json:"provider,omitempty"`
+	Model          string            `json:"model,omitempty"`
+	Percent        int               `json:"percent"` // Current share of new sessions
+	Sessions       int64             `json:"sessions"`
+	Ended          int64             `json:"ended"`
+	Handoffs       int64             `json:"handoffs"`
+	Resolved       int64             `json:"resolved"`
+	AIResponses    int64             `json:"ai_responses"`
+	TotalTokens    int64             `json:"total_tokens"`
+	HandoffRate    float64           `json:"handoff_rate"`    // Share of sessions handed to an agent
+	ResolutionRate float64           `json:"resolution_rate"` // Share of ended sessions that weren't handed to an agent
+}
+
+// aiSessionHandedOff matches sessions followed by an agent transfer before the
+// contact's next session started
+const aiSessionHandedOff = `EXISTS (SELECT 1 FROM agent_transfers t
+	WHERE t.organization_id = s.organization_id AND t.contact_id = s.contact_id
+	AND t.whats_app_account = s.whats_app_account AND t.transferred_at >= s.started_at
+	AND NOT EXISTS (SELECT 1 FROM chatbot_sessions n
+		WHERE n.contact_id = s.contact_id AND n.whats_app_account = s.whats_app_account
+		AND n.started_at > s.started_at AND n.started_at <= t.transferred_at))`
+
+// GetAIExperimentResults compares the outcome of the sessions of each AI
+// experiment variant started over a date range
+func (a *App) GetAIExperimentResults(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceAnalytics, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if v := string(args.Peek("from")); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'from' date format. Use YYYY-MM-DD", nil, "")
+		}
+	}
+	if v := string(args.Peek("to")); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'to' date format. Use YYYY-MM-DD", nil, "")
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	results, err := a.aiExperimentResults(orgID, string(args.Peek("whatsapp_account")), from, to)
+	if err != nil {
+		a.Log.Error("Failed to load AI experiment results", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load AI experiment results", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"from":     from.Format("2006-01-02"),
+		"to":       to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"variants": results,
+	})
+}
+
+// aiExperimentResults counts the outcomes of the sessions started in [from, to)
+// per variant, named after the experiments configured on the account. A session
+// has ended once it's closed or idle for longer than the session timeout.
+func (a *App) aiExperimentResults(orgID uuid.UUID, accountName string, from, to time.Time) ([]AIExperimentResult, error) {
+	var settings models.ChatbotSettings
+	if err := a.DB.Where("organization_id = ? AND whats_app_account = ?", orgID, accountName).First(&settings).Error; err != nil {
+		settings.SessionTimeoutMins = 30
+	}
+	idleSince := time.Now().Add(-time.Duration(settings.SessionTimeoutMins) * time.Minute)
+	ended := "(s.status <> 'active' OR s.last_activity_at < ?)"
+
+	query := a.DB.Table("chatbot_sessions s").
+		Where("s.organization_id = ? AND s.ai_variant <> '' AND s.started_at >= ? AND s.started_at < ?", orgID, from, to)
+	if accountName != "" {
+		query = query.Where("s.whats_app_account = ?", accountName)
+	}
+
+	results := []AIExperimentResult{}
+	if err := query.Select(`s.ai_variant AS variant, COUNT(*) AS sessions,
+		COUNT(*) FILTER (WHERE `+ended+`) AS ended,
+		COUNT(*) FILTER (WHERE `+aiSessionHandedOff+`) AS handoffs,
+		COUNT(*) FILTER (WHERE `+ended+` AND NOT `+aiSessionHandedOff+`) AS resolved,
+		COALESCE(SUM((SELECT COUNT(*) FROM chatbot_session_messages m WHERE m.session_id = s.id AND m.step_name = 'ai_response')), 0) AS ai_responses,
+		COALESCE(SUM((SELECT SUM(u.prompt_tokens + u.completion_tokens) FROM ai_usage u WHERE u.session_id = s.id)), 0) AS total_tokens`,
+		idleSince, idleSince).
+		Group("s.ai_variant").
+		Order("s.ai_variant").
+		Scan(&results).Error; err != nil {
+		return nil, err
+	}
+
+	experiments := aiExperiments(&settings)
+	controlPercent := 100
+	for _, experiment := range experiments {
+		controlPercent -= experiment.Percent
+	}
+	for i := range results {
+		result := &results[i]
+		result.Name = result.Variant
+		if result.Variant == aiControlVariant {
+			result.Name = "Control"
+			result.Provider = settings.AI.Provider
+			result.Model = settings.AI.Model
+			result.Percent = controlPercent
+		}
+		for _, experiment := range experiments {
+			if experiment.ID == result.Variant {
+				result.Name = experiment.Name
+				result.Provider = experiment.Provider
+				result.Model = experiment.Model
+				result.Percent = experiment.Percent
+			}
+		}
+		if result.Sessions > 0 {
+			result.HandoffRate = float64(result.Handoffs) / float64(result.Sessions)
+		}
+		if result.Ended > 0 {
+			result.ResolutionRate = float64(result.Resolved) / float64(result.Ended)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAIExperiments(t *testing.T) {
+	existing := []AIExperiment{{ID: "haiku", Provider: models.AIProviderAnthropic, APIKey: "sk-ant"}}
+
+	items, err := validateAIExperiments([]AIExperiment{
+		{ID: "haiku", Name: " Haiku ", Provider: models.AIProviderAnthropic, Model: "claude-3-5-haiku-latest", Percent: 20},
+		{Name: "Local", Provider: models.AIProviderOllama, Model: "llama3.1", BaseURL: "http://ollama:11434/", Percent: 10},
+	}, existing)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	haiku := items[0].(map[string]interface{})
+	assert.Equal(t, "Haiku", haiku["name"])
+	assert.Equal(t, "sk-ant", haiku["api_key"], "empty key keeps the stored one")
+	local := items[1].(map[string]interface{})
+	assert.NotEmpty(t, local["id"], "experiments without an id get one")
+	assert.Equal(t, "http://ollama:11434", local["base_url"])
+
+	tests := []struct {
+		name        string
+		experiments []AIExperiment
+		err         string
+	}{
+		{"no name", []AIExperiment{{Provider: models.AIProviderOpenAI, Percent: 10}}, "need a name"},
+		{"bad provider", []AIExperiment{{Name: "X", Provider: "acme", Percent: 10}}, "unsupported provider"},
+		{"no share", []AIExperiment{{Name: "X", Provider: models.AIProviderOpenAI}}, "between 1 and 100"},
+		{"control id", []AIExperiment{{ID: aiControlVariant, Name: "X", Provider: models.AIProviderOpenAI, Percent: 10}}, "invalid experiment id"},
+		{"over 100", []AIExperiment{
+			{ID: "a", Name: "A", Provider: models.AIProviderOpenAI, Percent: 60},
+			{ID: "b", Name: "B", Provider: models.AIProviderGoogle, Percent: 50},
+		}, "at most 100 percent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateAIExperiments(tt.experiments, nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestAIExperiments_Encrypted(t *testing.T) {
+	testutil.EnableEncryption(t)
+
+	items, err := validateAIExperiments([]AIExperiment{{ID: "haiku", Name: "Haiku", Provider: models.AIProviderAnthropic, APIKey: "sk-ant", Percent: 20}}, nil)
+	require.NoError(t, err)
+	require.NoError(t, models.EncryptAIProviderKeys(items))
+	assert.NotEqual(t, "sk-ant", items[0].(map[string]interface{})["api_key"])
+
+	experiments := aiExperiments(&models.ChatbotSettings{AI: models.AIConfig{Experiments: items}})
+	require.Len(t, experiments, 1)
+	assert.Equal(t, "sk-ant", experiments[0].APIKey)
+}
+
+func TestPickAIVariant(t *testing.T) {
+	experiments := []AIExperiment{{ID: "a", Percent: 20}, {ID: "b", Percent: 30}}
+	assert.Equal(t, "a", pickAIVariant(experiments, 0))
+	assert.Equal(t, "a", pickAIVariant(experiments, 19))
+	assert.Equal(t, "b", pickAIVariant(experiments, 20))
+	assert.Equal(t, "b", pickAIVariant(experiments, 49))
+	assert.Equal(t, aiControlVariant, pickAIVariant(experiments, 50))
+	assert.Equal(t, aiControlVariant, pickAIVariant(nil, 0))
+}
+
+func TestAIVariantSettings(t *testing.T) {
+	settings := &models.ChatbotSettings{AI: models.AIConfig{
+		Provider: models.AIProviderOpenAI,
+		APIKey:   "sk-openai",
+		Model:    "gpt-4o-mini",
+		Experiments: models.JSONBArray{
+			map[string]interface{}{"id": "haiku", "name": "Haiku", "provider": "anthropic", "model": "claude-3-5-haiku-latest", "api_key": "sk-ant", "percent": float64(50)},
+			map[string]interface{}{"id": "nokey", "name": "No key", "provider": "google", "percent": float64(10)},
+		},
+	}}
+
+	variant := aiVariantSettings(settings, &models.ChatbotSession{AIVariant: "haiku"})
+	assert.Equal(t, models.AIProviderAnthropic, variant.AI.Provider)
+	assert.Equal(t, "claude-3-5-haiku-latest", variant.AI.Model)
+	assert.Equal(t, "sk-ant", variant.AI.APIKey)
+	assert.Equal(t, models.AIProviderOpenAI, settings.AI.Provider, "the settings aren't changed")
+
+	// Control, removed and unusable experiments keep the primary provider
+	for _, name := range []string{"", aiControlVariant, "removed", "nokey"} {
+		assert.Same(t, settings, aiVariantSettings(settings, &models.ChatbotSession{AIVariant: name}), name)
+	}
+	assert.Same(t, settings, aiVariantSettings(settings, nil))
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// maxAIFallbackProviders limits how many providers are tried after the primary one
+const maxAIFallbackProviders = 3
+
+// AIFallbackProvider is a provider tried, in order, when the ones before it fail.
+// It shares the primary provider's prompt, token, temperature and webhook settings.
+type AIFallbackProvider struct {
+	Provider  models.AIProvider `json:"provider"`
+	Model     string            `json:"model"`
+	BaseURL   string            `json:"base_url,omitempty"`
+	APIKey    string            `json:"api_key,omitempty"` // Write-only; empty keeps the stored key
+	HasAPIKey bool              `json:"has_api_key"`
+}
+
+// aiFallbackProviders returns the fallback providers configured on the chatbot
+// settings, including their API keys
+func aiFallbackProviders(settings *models.ChatbotSettings) []AIFallbackProvider {
+	providers := make([]AIFallbackProvider, 0, len(settings.AI.FallbackProviders))
+	for _, item := range settings.AI.FallbackProviders {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		provider := AIFallbackProvider{
+			Provider: models.AIProvider(getStringFromMap(m, "provider")),
+			Model:    getStringFromMap(m, "model"),
+			BaseURL:  getStringFromMap(m, "base_url"),
+			APIKey:   models.SettingSecret(m, models.AIProviderSecretKey),
+		}
+		if provider.Provider == "" {
+			continue
+		}
+		provider.HasAPIKey = provider.APIKey != ""
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// aiFallbackProvidersResponse returns the fallback providers without their API keys
+func aiFallbackProvidersResponse(settings *models.ChatbotSettings) []AIFallbackProvider {
+	providers := aiFallbackProviders(settings)
+	for i := range providers {
+		providers[i].APIKey = ""
+	}
+	return providers
+}
+
+// validateAIFallbackProviders checks and normalizes fallback providers before
+// they are saved. A provider sent without an API key keeps the key stored at
+// the same position for the same provider.
+func validateAIFallbackProviders(providers []AIFallbackProvider, existing []AIFallbackProvider) ([]interface{}, error) {
+	if len(providers) > maxAIFallbackProviders {
+		return nil, fmt.Errorf("at most %d fallback providers are allowed", maxAIFallbackProviders)
+	}
+	items := make([]interface{}, len(providers))
+	for i, provider := range providers {
+		if !isAIProvider(provider.Provider) {
+			return nil, fmt.Errorf("unsupported provider %q", provider.Provider)
+		}
+		baseURL, err := normalizeAIBaseURL(provider.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		apiKey := provider.APIKey
+		if apiKey == "" && i < len(existing) && existing[i].Provider == provider.Provider {
+			apiKey = existing[i].APIKey
+		}
+		item := map[string]interface{}{
+			"provider": string(provider.Provider),
+			"model":    provider.Model,
+		}
+		if baseURL != "" {
+			item["base_url"] = baseURL
+		}
+		if apiKey != "" {
+			item["api_key"] = apiKey
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+// aiProviderChain returns the AI settings to try in order: the primary provider,
+// then each fallback provider that is configured
+func aiProviderChain(settings *models.ChatbotSettings) []models.AIConfig {
+	chain := make([]models.AIConfig, 0, 1+len(settings.AI.FallbackProviders))
+	if aiConfigured(settings.AI) {
+		chain = append(chain, settings.AI)
+	}
+	for _, fallback := range aiFallbackProviders(settings) {
+		ai := settings.AI
+		ai.Provider = fallback.Provider
+		ai.Model = fallback.Model
+		ai.BaseURL = fallback.BaseURL
+		ai.APIKey = fallback.APIKey
+		if aiConfigured(ai) {
+			chain = append(chain, ai)
+		}
+	}
+	return chain
+}
+
+// generateWithFallback asks each provider of the chain in turn and returns the
+// first answer, with the provider and model that gave it. A stream interrupted
+// after parts of the answer were sent isn't passed to the next provider.
+func (a *App) generateWithFallback(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) (*aiCompletion, error) {
+	chain := aiProviderChain(settings)
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no AI provider configured")
+	}
+
+	var errs []error
+	for i, ai := range chain {
+		attempt := *settings
+		attempt.AI = ai
+		completion, err := a.callAIProvider(ctx, &attempt, session, userMessage, contextData)
+		if err == nil {
+			if i > 0 {
+				a.log(ctx).Info("AI fallback provider answered", "provider", ai.Provider, "model", ai.Model, "attempt", i+1)
+			}
+			completion.Provider = ai.Provider
+			completion.Model = ai.Model
+			return completion, nil
+		}
+		if errors.Is(err, errAIStreamInterrupted) {
+			return nil, err
+		}
+		a.log(ctx).Warn("AI provider failed", "error", err, "provider", ai.Provider, "model", ai.Model, "attempt", i+1, "providers", len(chain))
+		errs = append(errs, fmt.Errorf("%s: %w", ai.Provider, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// logAIResponse logs an AI answer in the session with the provider that gave it
+func (a *App) logAIResponse(sessionID uuid.UUID, response string, provider models.AIProvider) {
+	msg := models.ChatbotSessionMessage{
+		BaseModel:  models.BaseModel{ID: uuid.New()},
+		SessionID:  sessionID,
+		Direction:  models.DirectionOutgoing,
+		Message:    response,
+		StepName:   "ai_response",
+		AIProvider: provider,
+	}
+	if err := a.DB.Create(&msg).Error; err != nil {
+		a.Log.Error("Failed to log session message", "error", err)
+	}
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+const (
+	// defaultAIHistoryTokenBudget is the token budget of settings saved without one
+	defaultAIHistoryTokenBudget = 2000
+	// minAIHistoryTokenBudget and maxAIHistoryTokenBudget bound the history token budget
+	minAIHistoryTokenBudget = 200
+	maxAIHistoryTokenBudget = 32000
+
+	// sessionSummaryBatch caps the sessions summarized per run
+	sessionSummaryBatch = 50
+	// sessionSummaryWindow is how recently a session must have been active to be summarized
+	sessionSummaryWindow = 24 * time.Hour
+)
+
+// aiSummaryPrompt is the system prompt of requests summarizing a session's older turns
+const aiSummaryPrompt = "You summarize customer conversations for an assistant that will continue them. " +
+	"Write a concise summary of the conversation below, merging in the earlier summary if there is one. " +
+	"Keep what the customer wants, the details they gave, what was answered or promised and what is still open. " +
+	"Write plain text in the language of the conversation, without a preamble."
+
+// aiSummaryContextHeader introduces a session's summary in the context sent with AI requests
+const aiSummaryContextHeader = "Summary of the earlier conversation:\n"
+
+// estimateTokens estimates the tokens of a text, at about four characters a token
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// aiHistoryTokenBudget returns the estimated tokens of summary and history sent with
+// each AI request
+func aiHistoryTokenBudget(settings *models.ChatbotSettings) int {
+	if settings.AI.HistoryTokenBudget <= 0 {
+		return defaultAIHistoryTokenBudget
+	}
+	return settings.AI.HistoryTokenBudget
+}
+
+// aiHistorySummary returns the session's summary of its earlier turns to send with an
+// AI request. Summaries of turns older than the history TTL aren't sent.
+func aiHistorySummary(settings *models.ChatbotSettings, session *models.ChatbotSession) string {
+	if !settings.AI.IncludeHistory || !settings.AI.SummarizeHistory || session == nil ||
+		session.HistorySummary == "" || session.SummarizedUntil == nil {
+		return ""
+	}
+	if ttl := settings.AI.HistoryTTLMinutes; ttl > 0 && session.SummarizedUntil.Before(time.Now().Add(-time.Duration(ttl)*time.Minute)) {
+		return ""
+	}
+	return session.HistorySummary
+}
+
+// summarizedConversationHistory returns the session's turns after its summary, the
+// most recent ones that fit in the token budget with the summary
+func (a *App) summarizedConversationHistory(settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, since time.Time) []models.ChatbotSessionMessage {
+	summary := aiHistorySummary(settings, session)
+	if summary != "" {
+		since = *session.SummarizedUntil
+	}
+	history := a.getSessionHistory(session.ID, maxAIHistoryLimit+1, since)
+	history = trimAIHistory(history, userMessage, maxAIHistoryLimit)
+	return trimAIHistoryTokens(history, aiHistoryTokenBudget(settings)-estimateTokens(summary))
+}
+
+// trimAIHistoryTokens keeps the most recent messages of the history that fit in a token budget
+func trimAIHistoryTokens(history []models.ChatbotSessionMessage, budget int) []models.ChatbotSessionMessage {
+	used := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		used += estimateTokens(history[i].Message)
+		if used > budget {
+			return history[i+1:]
+		}
+	}
+	return history
+}
+
+// aiSummaryTranscript returns the turns to summarize as a transcript, after the
+// session's earlier summary
+func aiSummaryTranscript(summary string, messages []models.ChatbotSessionMessage) string {
+	var b strings.Builder
+	if summary != "" {
+		b.WriteString("Earlier summary:\n")
+		b.WriteString(summary)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("Conversation:\n")
+	for _, m := range messages {
+		speaker := "Customer"
+		if m.Direction == models.DirectionOutgoing {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", speaker, m.Message)
+	}
+	return b.String()
+}
+
+// summarizeSessionHistory compresses the session's older turns into its summary once
+// the summary and the turns after it outgrow the token budget. The last messages of
+// the history length are kept word for word.
+func (a *App) summarizeSessionHistory(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession) error {
+	// Webhook bots keep their own conversation state
+	if settings.AI.Provider == models.AIProviderWebhook {
+		return nil
+	}
+
+	query := a.DB.Where("session_id = ?", session.ID)
+	if session.SummarizedUntil != nil {
+		query = query.Where("created_at > ?", *session.SummarizedUntil)
+	}
+	var messages []models.ChatbotSessionMessage
+	if err := query.Order("created_at ASC").Find(&messages).Error; err != nil {
+		return fmt.Errorf("failed to load session history: %w", err)
+	}
+
+	budget := aiHistoryTokenBudget(settings)
+	tokens := estimateTokens(session.HistorySummary)
+	for _, m := range messages {
+		tokens += estimateTokens(m.Message)
+	}
+	keep := max(settings.AI.HistoryLimit, 0)
+	if tokens <= budget || len(messages) <= keep {
+		return nil
+	}
+	if err := a.checkAITokenQuota(settings); err != nil {
+		return err
+	}
+
+	older := messages[:len(messages)-keep]
+	summarizer := *settings
+	summarizer.AI.SystemPrompt = aiSummaryPrompt
+	summarizer.AI.Tools = nil
+	summarizer.AI.PaymentLinks, summarizer.AI.OrderLookup = false, false
+	summarizer.AI.MaxTokens = budget / 2
+
+	completion, err := a.callAIProvider(ctx, &summarizer, nil, aiSummaryTranscript(session.HistorySummary, older), "")
+	if err != nil {
+		return fmt.Errorf("failed to summarize session history: %w", err)
+	}
+	a.recordAIUsage(settings, session, completion)
+
+	summary := strings.TrimSpace(completion.Text)
+	if summary == "" {
+		return nil
+	}
+	until := older[len(older)-1].CreatedAt
+
+	// Another instance may have summarized the session meanwhile
+	update := a.DB.Model(&models.ChatbotSession{}).Where("id = ?", session.ID)
+	if session.SummarizedUntil != nil {
+		update = update.Where("summarized_until = ?", *session.SummarizedUntil)
+	} else {
+		update = update.Where("summarized_until IS NULL")
+	}
+	if err := update.Updates(map[string]interface{}{
+		"history_summary":  summary,
+		"summarized_until": until,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to save session summary: %w", err)
+	}
+	session.HistorySummary, session.SummarizedUntil = summary, &until
+
+	a.Log.Info("Session history summarized", "session_id", session.ID, "messages", len(older),
+		"estimated_tokens", tokens, "summary_tokens", estimateTokens(summary))
+	return nil
+}
+
+// SessionSummaryProcessor summarizes the older turns of active chatbot sessions whose
+// history outgrew the token budget of their AI settings. Summarizing ahead of the next
+// message keeps it off the reply path.
+type SessionSummaryProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewSessionSummaryProcessor creates a new session summary processor
+func NewSessionSummaryProcessor(app *App, interval time.Duration) *SessionSummaryProcessor {
+	return &SessionSummaryProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the session summary loop
+func (p *SessionSummaryProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Session summary processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Session summary processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Session summary processor stopped")
+			return
+		case <-ticker.C:
+			p.processSessionSummaries(ctx)
+		}
+	}
+}
+
+// Stop stops the session summary processor
+func (p *SessionSummaryProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// processSessionSummaries summarizes the sessions returned by sessionsToSummarize
+func (p *SessionSummaryProcessor) processSessionSummaries(ctx context.Context) {
+	sessions, err := p.app.sessionsToSummarize()
+	if err != nil {
+		p.app.Log.Error("Failed to find sessions to summarize", "error", err)
+		return
+	}
+
+	for i := range sessions {
+		if ctx.Err() != nil {
+			return
+		}
+		session := &sessions[i]
+		settings, err := p.app.getChatbotSettingsCached(session.OrganizationID, session.WhatsAppAccount)
+		if err != nil || !settings.AI.Enabled || !settings.AI.IncludeHistory || !settings.AI.SummarizeHistory {
+			continue
+		}
+		if err := p.app.summarizeSessionHistory(ctx, settings, session); err != nil {
+			p.app.Log.Warn("Failed to summarize session history", "error", err, "session_id", session.ID)
+		}
+	}
+}
+
+// sessionsToSummarize returns the recently active sessions whose turns after their
+// summary are estimated to be over the token budget. Like summarizeSessionHistory, it
+// skips sessions with no more turns than the history length, which are kept word for
+// word, so they aren't picked again on every run.
+func (a *App) sessionsToSummarize() ([]models.ChatbotSession, error) {
+	var sessions []models.ChatbotSession
+	err := a.DB.
+		Select("chatbot_sessions.*").
+		Joins(`CROSS JOIN LATERAL (SELECT s.ai_enabled AND s.ai_include_history AND s.ai_summarize_history AND s.ai_provider <> ? AS summarize,
+			COALESCE(NULLIF(s.ai_history_token_budget, 0), ?) AS budget, GREATEST(s.ai_history_limit, 0) AS keep
+			FROM chatbot_settings s
+			WHERE s.organization_id = chatbot_sessions.organization_id AND s.whats_app_account IN (chatbot_sessions.whats_app_account, '')
+			ORDER BY CASE WHEN s.whats_app_account = '' THEN 1 ELSE 0 END LIMIT 1) settings`,
+			models.AIProviderWebhook, defaultAIHistoryTokenBudget).
+		Joins(`CROSS JOIN LATERAL (SELECT COUNT(*) AS messages, COALESCE(SUM(LENGTH(m.message)), 0) AS length
+			FROM chatbot_session_messages m
+			WHERE m.session_id = chatbot_sessions.id AND m.created_at > COALESCE(chatbot_sessions.summarized_until, '-infinity')) history`).
+		Where("chatbot_sessions.status = ? AND chatbot_sessions.last_activity_at > ?", models.SessionStatusActive, time.Now().Add(-sessionSummaryWindow)).
+		Where("settings.summarize AND history.length > 4 * settings.budget AND history.messages > settings.keep").
+		Order("chatbot_sessions.last_activity_at DESC").
+		Limit(sessionSummaryBatch).
+		Find(&sessions).Error
+	return sessions, err
+}
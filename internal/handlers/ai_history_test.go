@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrimAIHistory(t *testing.T) {
+	history := []models.ChatbotSessionMessage{
+		{Direction: models.DirectionIncoming, Message: "Hi"},
+		{Direction: models.DirectionOutgoing, Message: "Hello! How can I help?"},
+		{Direction: models.DirectionIncoming, Message: "Do you deliver?"},
+	}
+
+	// The message being answered is sent separately
+	trimmed := trimAIHistory(history, "Do you deliver?", 4)
+	require.Len(t, trimmed, 2)
+	assert.Equal(t, "Hello! How can I help?", trimmed[1].Message)
+
+	// Without it, only the limit applies
+	trimmed = trimAIHistory(history, "Something else", 2)
+	require.Len(t, trimmed, 2)
+	assert.Equal(t, "Hello! How can I help?", trimmed[0].Message)
+	assert.Equal(t, "Do you deliver?", trimmed[1].Message)
+
+	assert.Empty(t, trimAIHistory(nil, "Hi", 4))
+}
+
+func TestAIConversationHistory(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "History Org " + suffix,
+		Slug:      "history-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1555" + suffix[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	session := &models.ChatbotSession{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: "history-account",
+		PhoneNumber:     contact.PhoneNumber,
+	}
+	require.NoError(t, app.DB.Create(session).Error)
+
+	log := func(direction models.Direction, message string, age time.Duration) {
+		created := time.Now().Add(-age)
+		require.NoError(t, app.DB.Create(&models.ChatbotSessionMessage{
+			BaseModel: models.BaseModel{ID: uuid.New(), CreatedAt: created, UpdatedAt: created},
+			SessionID: session.ID,
+			Direction: direction,
+			Message:   message,
+		}).Error)
+	}
+	log(models.DirectionIncoming, "I need a cake for Saturday", 3*time.Hour)
+	log(models.DirectionOutgoing, "Which flavour would you like?", 3*time.Hour-time.Minute)
+	log(models.DirectionIncoming, "Chocolate", 10*time.Minute)
+	log(models.DirectionOutgoing, "Great, chocolate it is. For how many people?", 9*time.Minute)
+	log(models.DirectionIncoming, "Twelve", time.Minute)
+
+	settings := &models.ChatbotSettings{AI: models.AIConfig{IncludeHistory: true, HistoryLimit: 10}}
+	history := app.aiConversationHistory(settings, session, "Twelve")
+	require.Len(t, history, 4)
+	assert.Equal(t, "I need a cake for Saturday", history[0].Message)
+
+	settings.AI.HistoryTTLMinutes = 60
+	history = app.aiConversationHistory(settings, session, "Twelve")
+	require.Len(t, history, 2)
+	assert.Equal(t, "Chocolate", history[0].Message)
+
+	settings.AI.HistoryLimit = 1
+	history = app.aiConversationHistory(settings, session, "Twelve")
+	require.Len(t, history, 1)
+	assert.Equal(t, models.DirectionOutgoing, history[0].Direction)
+
+	settings.AI.IncludeHistory = false
+	assert.Empty(t, app.aiConversationHistory(settings, session, "Twelve"))
+}
+
+func TestTrimAIHistoryTokens(t *testing.T) {
+	history := []models.ChatbotSessionMessage{
+		{Message: strings.Repeat("a", 400)},
+		{Message: strings.Repeat("b", 40)},
+		{Message: strings.Repeat("c", 40)},
+	}
+	assert.Len(t, trimAIHistoryTokens(history, 1000), 3)
+	trimmed := trimAIHistoryTokens(history, 50)
+	require.Len(t, trimmed, 2)
+	assert.Equal(t, history[1].Message, trimmed[0].Message)
+	assert.Empty(t, trimAIHistoryTokens(history, 5))
+}
+
+func TestAIHistorySummary(t *testing.T) {
+	until := time.Now().Add(-2 * time.Hour)
+	session := &models.ChatbotSession{HistorySummary: "Wants a chocolate cake for Saturday", SummarizedUntil: &until}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{IncludeHistory: true, SummarizeHistory: true}}
+	assert.Equal(t, session.HistorySummary, aiHistorySummary(settings, session))
+
+	// Summaries of turns older than the TTL are left out like the turns
+	settings.AI.HistoryTTLMinutes = 60
+	assert.Empty(t, aiHistorySummary(settings, session))
+
+	settings.AI.HistoryTTLMinutes = 0
+	settings.AI.SummarizeHistory = false
+	assert.Empty(t, aiHistorySummary(settings, session))
+	assert.Empty(t, aiHistorySummary(&models.ChatbotSettings{AI: models.AIConfig{IncludeHistory: true, SummarizeHistory: true}}, nil))
+}
+
+func TestAISummaryTranscript(t *testing.T) {
+	transcript := aiSummaryTranscript("Asked about delivery", []models.ChatbotSessionMessage{
+		{Direction: models.DirectionIncoming, Message: "Is it free?"},
+		{Direction: models.DirectionOutgoing, Message: "Yes, over $50."},
+	})
+	assert.Equal(t, "Earlier summary:\nAsked about delivery\n\nConversation:\nCustomer: Is it free?\nAssistant: Yes, over $50.\n", transcript)
+}
+
+func TestSummarizeSessionHistory(t *testing.T) {
+	var prompt string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []map[string]string `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Messages[len(req.Messages)-1]["content"]
+		_, _ = fmt.Fprint(w, `{"choices": [{"message": {"content": "Wants a chocolate cake for Saturday."}}], "usage": {"prompt_tokens": 120, "completion_tokens": 10}}`)
+	}))
+	defer server.Close()
+	orig := openAIChatURL
+	openAIChatURL = server.URL
+	defer func() { openAIChatURL = orig }()
+
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Summary Org " + suffix,
+		Slug:      "summary-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1556" + suffix[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	session := &models.ChatbotSession{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: "summary-account",
+		PhoneNumber:     contact.PhoneNumber,
+	}
+	require.NoError(t, app.DB.Create(session).Error)
+
+	turns := []string{"I need a cake for Saturday", "Which flavour would you like?", "Chocolate", "For how many people?", "Twelve"}
+	for i, turn := range turns {
+		direction := models.DirectionIncoming
+		if i%2 == 1 {
+			direction = models.DirectionOutgoing
+		}
+		created := time.Now().Add(time.Duration(i-len(turns)) * time.Minute)
+		require.NoError(t, app.DB.Create(&models.ChatbotSessionMessage{
+			BaseModel: models.BaseModel{ID: uuid.New(), CreatedAt: created, UpdatedAt: created},
+			SessionID: session.ID,
+			Direction: direction,
+			Message:   turn,
+		}).Error)
+	}
+
+	settings := &models.ChatbotSettings{
+		OrganizationID: org.ID,
+		AI: models.AIConfig{
+			Provider: models.AIProviderOpenAI, APIKey: "key", Model: "model",
+			IncludeHistory: true, HistoryLimit: 2, SummarizeHistory: true, HistoryTokenBudget: 1000,
+		},
+	}
+
+	// Within the budget nothing is summarized
+	require.NoError(t, app.summarizeSessionHistory(context.Background(), settings, session))
+	assert.Empty(t, session.HistorySummary)
+
+	settings.AI.HistoryTokenBudget = 10
+	require.NoError(t, app.summarizeSessionHistory(context.Background(), settings, session))
+	assert.Equal(t, "Wants a chocolate cake for Saturday.", session.HistorySummary)
+	assert.Contains(t, prompt, "Customer: Chocolate")
+	assert.NotContains(t, prompt, "Twelve", "the last messages are kept word for word")
+
+	var saved models.ChatbotSession
+	require.NoError(t, app.DB.First(&saved, "id = ?", session.ID).Error)
+	assert.Equal(t, session.HistorySummary, saved.HistorySummary)
+	require.NotNil(t, saved.SummarizedUntil)
+
+	// Prompts get the summary and the turns after it
+	settings.AI.HistoryTokenBudget = 1000
+	history := app.aiConversationHistory(settings, &saved, "Twelve")
+	require.Len(t, history, 1)
+	assert.Equal(t, "For how many people?", history[0].Message)
+}
+
+func TestSessionsToSummarize(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Summary Select Org " + suffix,
+		Slug:      "summary-select-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1557" + suffix[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	settings := &models.ChatbotSettings{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		AI: models.AIConfig{
+			Enabled: true, Provider: models.AIProviderOpenAI, APIKey: "key", Model: "model",
+			IncludeHistory: true, HistoryLimit: 2, SummarizeHistory: true, HistoryTokenBudget: 10,
+		},
+	}
+	require.NoError(t, app.DB.Create(settings).Error)
+	session := &models.ChatbotSession{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		ContactID:      contact.ID,
+		PhoneNumber:    contact.PhoneNumber,
+		Status:         models.SessionStatusActive,
+		LastActivityAt: time.Now(),
+	}
+	require.NoError(t, app.DB.Create(session).Error)
+
+	var created []time.Time
+	addMessage := func() {
+		at := time.Now().Add(time.Duration(len(created)-10) * time.Minute)
+		created = append(created, at)
+		require.NoError(t, app.DB.Create(&models.ChatbotSessionMessage{
+			BaseModel: models.BaseModel{ID: uuid.New(), CreatedAt: at, UpdatedAt: at},
+			SessionID: session.ID,
+			Direction: models.DirectionIncoming,
+			Message:   strings.Repeat("long message ", 10),
+		}).Error)
+	}
+	selected := func() bool {
+		sessions, err := app.sessionsToSummarize()
+		require.NoError(t, err)
+		for _, s := range sessions {
+			if s.ID == session.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Over the budget, but the last messages of the history length are kept anyway
+	addMessage()
+	addMessage()
+	assert.False(t, selected())
+
+	addMessage()
+	assert.True(t, selected())
+
+	// Once the older turns are summarized, only the kept ones are left
+	require.NoError(t, app.DB.Model(session).Update("summarized_until", created[0]).Error)
+	assert.False(t, selected())
+
+	// Webhook bots aren't summarized
+	addMessage()
+	assert.True(t, selected())
+	require.NoError(t, app.DB.Model(settings).Update("ai_provider", models.AIProviderWebhook).Error)
+	assert.False(t, selected())
+}
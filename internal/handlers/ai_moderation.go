@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+const (
+	// maxModerationBlocklist limits the blocklist entries of an organization
+	maxModerationBlocklist = 200
+	// maxModerationEntryLength limits the length of a blocklist entry
+	maxModerationEntryLength = 200
+)
+
+// openAIModerationsURL is the OpenAI moderation endpoint, overridden in tests
+var openAIModerationsURL = "https://api.openai.com/v1/moderations"
+
+// moderationPattern compiles a blocklist entry. Entries wrapped in slashes are
+// regular expressions; other entries match as whole words. Both ignore case.
+func moderationPattern(entry string) (*regexp.Regexp, error) {
+	if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+		return regexp.Compile("(?i)" + entry[1:len(entry)-1])
+	}
+	return regexp.Compile(`(?i)(^|[^\p{L}\p{N}_])` + regexp.QuoteMeta(entry) + `($|[^\p{L}\p{N}_])`)
+}
+
+// validateModerationBlocklist checks and normalizes blocklist entries before they are saved
+func validateModerationBlocklist(entries []string) (models.StringArray, error) {
+	blocklist := models.StringArray{}
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || seen[strings.ToLower(entry)] {
+			continue
+		}
+		if len(entry) > maxModerationEntryLength {
+			return nil, fmt.Errorf("entry %q must be %d characters or fewer", entry, maxModerationEntryLength)
+		}
+		if _, err := moderationPattern(entry); err != nil {
+			return nil, fmt.Errorf("entry %q is not a valid regular expression", entry)
+		}
+		seen[strings.ToLower(entry)] = true
+		blocklist = append(blocklist, entry)
+	}
+	if len(blocklist) > maxModerationBlocklist {
+		return nil, fmt.Errorf("at most %d entries are allowed", maxModerationBlocklist)
+	}
+	return blocklist, nil
+}
+
+// moderateAIResponse checks an AI response against the blocklist, then the
+// moderation provider. It returns why the response is blocked, or "" if it can
+// be sent. Provider failures are logged and don't block the response.
+func (a *App) moderateAIResponse(ctx context.Context, settings *models.ChatbotSettings, response string) string {
+	if !settings.AI.ModerationEnabled || strings.TrimSpace(response) == "" {
+		return ""
+	}
+
+	for _, entry := range settings.AI.ModerationBlocklist {
+		pattern, err := moderationPattern(entry)
+		if err != nil {
+			continue
+		}
+		if pattern.MatchString(response) {
+			return fmt.Sprintf("blocklist %q", entry)
+		}
+	}
+
+	if settings.AI.ModerationProvider == models.AIProviderOpenAI {
+		apiKey := settings.AI.ModerationAPIKey
+		if apiKey == "" && settings.AI.Provider == models.AIProviderOpenAI {
+			apiKey = settings.AI.APIKey
+		}
+		if apiKey == "" {
+			a.log(ctx).Warn("AI moderation skipped, no OpenAI API key", "organization_id", settings.OrganizationID)
+			return ""
+		}
+		apiKey, err := a.resolveCredential(ctx, settings.OrganizationID, apiKey)
+		if err != nil {
+			a.log(ctx).Error("AI moderation skipped, API key not resolved", "error", err, "organization_id", settings.OrganizationID)
+			return ""
+		}
+		categories, err := a.moderateWithOpenAI(ctx, apiKey, response)
+		if err != nil {
+			a.log(ctx).Error("AI moderation failed", "error", err, "organization_id", settings.OrganizationID)
+			return ""
+		}
+		if len(categories) > 0 {
+			return "openai: " + strings.Join(categories, ", ")
+		}
+	}
+	return ""
+}
+
+// moderateWithOpenAI returns the categories the OpenAI moderation API flags the text for
+func (a *App) moderateWithOpenAI(ctx context.Context, apiKey, text string) ([]string, error) {
+	payload := map[string]interface{}{
+		"model": "omni-moderation-latest",
+		"input": text,
+	}
+	status, body, err := a.postAIRequest(ctx, a.httpClient(config.OutboundAI, 15*time.Second), openAIModerationsURL, map[string]string{"Authorization": "Bearer " + apiKey}, payload)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		var errResp struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(body, &errResp)
+		return nil, fmt.Errorf("OpenAI API error: %s", errResp.Error.Message)
+	}
+
+	var result struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	var categories []string
+	for _, item := range result.Results {
+		if !item.Flagged {
+			continue
+		}
+		for category, flagged := range item.Categories {
+			if flagged {
+				categories = append(categories, category)
+			}
+		}
+		if len(categories) == 0 {
+			categories = append(categories, "flagged")
+		}
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
+
+// logModeratedResponse records a blocked AI response for review
+func (a *App) logModeratedResponse(settings *models.ChatbotSettings, session *models.ChatbotSession, contact *models.Contact, userMessage string, completion *aiCompletion, reason string) {
+	entry := models.AIModerationLog{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  settings.OrganizationID,
+		WhatsAppAccount: settings.WhatsAppAccount,
+		Provider:        completion.Provider,
+		Model:           completion.Model,
+		UserMessage:     userMessage,
+		Response:        completion.Text,
+		Reason:          reason,
+	}
+	if session != nil {
+		entry.SessionID = &session.ID
+	}
+	if contact != nil {
+		entry.ContactID = &contact.ID
+		entry.PhoneNumber = contact.PhoneNumber
+	}
+	if err := a.DB.Create(&entry).Error; err != nil {
+		a.Log.Error("Failed to log moderated AI response", "error", err, "organization_id", settings.OrganizationID)
+	}
+}
+
+// ListAIModerationLogs returns the AI responses blocked by moderation, newest first
+func (a *App) ListAIModerationLogs(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChatbotAI, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	page, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("page")))
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := a.DB.Model(&models.AIModerationLog{}).Where("organization_id = ?", orgID)
+	if account := string(r.RequestCtx.QueryArgs().Peek("whatsapp_account")); account != "" {
+		query = query.Where("whats_app_account = ?", account)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var logs []models.AIModerationLog
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&logs).Error; err != nil {
+		a.Log.Error("Failed to list AI moderation logs", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list AI moderation logs", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"logs":  logs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
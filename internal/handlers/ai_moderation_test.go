@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateModerationBlocklist(t *testing.T) {
+	blocklist, err := validateModerationBlocklist([]string{" guaranteed refund ", "", "Guaranteed Refund", `/\bfree\s+money\b/`})
+	require.NoError(t, err)
+	assert.Equal(t, models.StringArray{"guaranteed refund", `/\bfree\s+money\b/`}, blocklist)
+
+	_, err = validateModerationBlocklist([]string{"/([a-z/"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a valid regular expression")
+}
+
+func TestModerateAIResponseBlocklist(t *testing.T) {
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{
+		ModerationEnabled:   true,
+		ModerationBlocklist: models.StringArray{"refund", `/\d{4}-\d{4}-\d{4}-\d{4}/`},
+	}}
+
+	tests := []struct {
+		response string
+		reason   string
+	}{
+		{"You'll get a full Refund tomorrow.", `blocklist "refund"`},
+		{"Refunds take 5 days.", ""}, // Keywords match whole words
+		{"Your card 4111-1111-1111-1111 was charged.", `blocklist "/\\d{4}-\\d{4}-\\d{4}-\\d{4}/"`},
+		{"Your order has shipped.", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.reason, app.moderateAIResponse(context.Background(), settings, tt.response), tt.response)
+	}
+
+	settings.AI.ModerationEnabled = false
+	assert.Empty(t, app.moderateAIResponse(context.Background(), settings, "You'll get a full refund."))
+}
+
+func TestModerateAIResponseOpenAI(t *testing.T) {
+	var flagged bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "omni-moderation-latest", req["model"])
+		if !flagged {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"results": [{"flagged": true, "categories": {"violence": true, "harassment": true, "sexual": false}}]}`))
+	}))
+	defer server.Close()
+	orig := openAIModerationsURL
+	openAIModerationsURL = server.URL
+	defer func() { openAIModerationsURL = orig }()
+
+	// The AI provider's key is used when it's OpenAI
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{
+		Provider:           models.AIProviderOpenAI,
+		APIKey:             "key",
+		ModerationEnabled:  true,
+		ModerationProvider: models.AIProviderOpenAI,
+	}}
+
+	// Provider failures don't block the response
+	assert.Empty(t, app.moderateAIResponse(context.Background(), settings, "Hello"))
+
+	flagged = true
+	assert.Equal(t, "openai: harassment, violence", app.moderateAIResponse(context.Background(), settings, "Hello"))
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// maxAIPersonas limits the named system prompts an organization can keep
+const maxAIPersonas = 10
+
+// AIPersona is a named system prompt the AI can answer with
+type AIPersona struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Prompt string `json:"prompt"`
+}
+
+// aiPersonas returns the personas configured on the chatbot settings
+func aiPersonas(settings *models.ChatbotSettings) []AIPersona {
+	personas := make([]AIPersona, 0, len(settings.AI.Personas))
+	for _, item := range settings.AI.Personas {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		persona := AIPersona{
+			ID:     getStringFromMap(m, "id"),
+			Name:   getStringFromMap(m, "name"),
+			Prompt: getStringFromMap(m, "prompt"),
+		}
+		if persona.ID == "" || persona.Name == "" {
+			continue
+		}
+		personas = append(personas, persona)
+	}
+	return personas
+}
+
+// validateAIPersonas checks personas before they are saved
+func validateAIPersonas(personas []AIPersona) error {
+	if len(personas) > maxAIPersonas {
+		return fmt.Errorf("at most %d personas are allowed", maxAIPersonas)
+	}
+	seen := make(map[string]bool, len(personas))
+	for _, persona := range personas {
+		if persona.ID == "" || strings.TrimSpace(persona.Name) == "" {
+			return fmt.Errorf("personas need an id and a name")
+		}
+		if seen[persona.ID] {
+			return fmt.Errorf("duplicate persona id %q", persona.ID)
+		}
+		seen[persona.ID] = true
+		if strings.TrimSpace(persona.Prompt) == "" {
+			return fmt.Errorf("persona %q needs a prompt", persona.Name)
+		}
+	}
+	return nil
+}
+
+// activeAIPersona returns the persona selected on the chatbot settings, if any
+func activeAIPersona(settings *models.ChatbotSettings) (AIPersona, bool) {
+	if settings.AI.PersonaID == "" {
+		return AIPersona{}, false
+	}
+	for _, persona := range aiPersonas(settings) {
+		if persona.ID == settings.AI.PersonaID {
+			return persona, true
+		}
+	}
+	return AIPersona{}, false
+}
+
+// formatBusinessHours describes business hours for a prompt, e.g.
+// "Monday 09:00-17:00, ..., Sunday closed". Disabled hours are described as empty.
+func formatBusinessHours(config models.BusinessHoursConfig) string {
+	if !config.Enabled || len(config.Hours) == 0 {
+		return ""
+	}
+	days := make([]string, 0, 7)
+	// List Monday first, as customers expect
+	for i := 1; i <= 7; i++ {
+		day := time.Weekday(i % 7)
+		hours := "closed"
+		for _, bh := range config.Hours {
+			bhMap, ok := bh.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if d, ok := bhMap["day"].(float64); !ok || int(d) != int(day) {
+				continue
+			}
+			if enabled, _ := bhMap["enabled"].(bool); enabled {
+				hours = getStringFromMap(bhMap, "start_time") + "-" + getStringFromMap(bhMap, "end_time")
+			}
+			break
+		}
+		days = append(days, day.String()+" "+hours)
+	}
+	return strings.Join(days, ", ")
+}
+
+// renderSystemPrompt fills the variables of a system prompt for a conversation:
+// {{org_name}}, {{business_hours}}, {{contact_name}}, {{phone_number}} and {{today}}
+func (a *App) renderSystemPrompt(settings *models.ChatbotSettings, contact *models.Contact, prompt string) string {
+	if !strings.Contains(prompt, "{{") {
+		return prompt
+	}
+
+	vars := models.JSONB{
+		"business_hours": formatBusinessHours(settings.BusinessHours),
+		"today":          time.Now().In(a.businessHoursLocation(settings)).Format("Monday, January 2, 2006"),
+	}
+	if contact != nil {
+		vars["contact_name"] = contact.ProfileName
+		vars["phone_number"] = contact.PhoneNumber
+	}
+	if strings.Contains(prompt, "{{org_name}}") {
+		var org models.Organization
+		if err := a.DB.Select("id", "name").Where("id = ?", settings.OrganizationID).First(&org).Error; err == nil {
+			vars["org_name"] = org.Name
+		}
+	}
+	return a.replaceVariables(prompt, vars)
+}
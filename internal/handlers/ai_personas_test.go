@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAIPersonas(t *testing.T) {
+	assert.NoError(t, validateAIPersonas([]AIPersona{
+		{ID: "sales", Name: "Sales", Prompt: "You sell cakes."},
+		{ID: "support", Name: "Support", Prompt: "You help with orders."},
+	}))
+	assert.Error(t, validateAIPersonas([]AIPersona{{ID: "sales", Name: " ", Prompt: "x"}}))
+	assert.Error(t, validateAIPersonas([]AIPersona{{ID: "sales", Name: "Sales"}}))
+	assert.Error(t, validateAIPersonas([]AIPersona{
+		{ID: "sales", Name: "Sales", Prompt: "x"},
+		{ID: "sales", Name: "Sales 2", Prompt: "y"},
+	}))
+	assert.Error(t, validateAIPersonas(make([]AIPersona, maxAIPersonas+1)))
+}
+
+func TestActiveAIPersona(t *testing.T) {
+	settings := &models.ChatbotSettings{AI: models.AIConfig{
+		SystemPrompt: "You are a helpful assistant.",
+		Personas: models.JSONBArray{
+			map[string]interface{}{"id": "sales", "name": "Sales", "prompt": "You sell cakes."},
+		},
+	}}
+	_, ok := activeAIPersona(settings)
+	assert.False(t, ok)
+
+	settings.AI.PersonaID = "sales"
+	persona, ok := activeAIPersona(settings)
+	assert.True(t, ok)
+	assert.Equal(t, "You sell cakes.", persona.Prompt)
+
+	settings.AI.PersonaID = "deleted"
+	_, ok = activeAIPersona(settings)
+	assert.False(t, ok)
+}
+
+func TestFormatBusinessHours(t *testing.T) {
+	config := models.BusinessHoursConfig{
+		Enabled: true,
+		Hours: models.JSONBArray{
+			map[string]interface{}{"day": float64(1), "enabled": true, "start_time": "09:00", "end_time": "17:00"},
+			map[string]interface{}{"day": float64(6), "enabled": true, "start_time": "10:00", "end_time": "14:00"},
+			map[string]interface{}{"day": float64(0), "enabled": false, "start_time": "10:00", "end_time": "14:00"},
+		},
+	}
+	formatted := formatBusinessHours(config)
+	assert.True(t, strings.HasPrefix(formatted, "Monday 09:00-17:00, Tuesday closed"))
+	assert.True(t, strings.HasSuffix(formatted, "Saturday 10:00-14:00, Sunday closed"))
+
+	config.Enabled = false
+	assert.Empty(t, formatBusinessHours(config))
+}
+
+func TestRenderSystemPrompt(t *testing.T) {
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{BusinessHours: models.BusinessHoursConfig{
+		Enabled:  true,
+		Timezone: "UTC",
+		Hours: models.JSONBArray{
+			map[string]interface{}{"day": float64(1), "enabled": true, "start_time": "09:00", "end_time": "17:00"},
+		},
+	}}
+	contact := &models.Contact{ProfileName: "Ana", PhoneNumber: "15550100001"}
+
+	prompt := app.renderSystemPrompt(settings, contact, "Greet {{contact_name}} ({{phone_number}}). Hours: {{business_hours}}. Keep {{unknown}}.")
+	assert.Contains(t, prompt, "Greet Ana (15550100001).")
+	assert.Contains(t, prompt, "Hours: Monday 09:00-17:00, Tuesday closed")
+	assert.Contains(t, prompt, "Keep {{unknown}}.")
+
+	assert.Equal(t, "No variables here.", app.renderSystemPrompt(settings, nil, "No variables here."))
+}
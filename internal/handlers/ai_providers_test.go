@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAIConfigured(t *testing.T) {
+	assert.True(t, aiConfigured(models.AIConfig{Provider: models.AIProviderOpenAI, APIKey: "sk-test"}))
+	assert.False(t, aiConfigured(models.AIConfig{Provider: models.AIProviderOpenAI}))
+	assert.True(t, aiConfigured(models.AIConfig{Provider: models.AIProviderOllama}))
+	assert.True(t, aiConfigured(models.AIConfig{Provider: models.AIProviderWebhook, BaseURL: "https://bot.example.com/webhook"}))
+	assert.False(t, aiConfigured(models.AIConfig{Provider: models.AIProviderWebhook, APIKey: "key"}))
+	assert.False(t, aiConfigured(models.AIConfig{Provider: "rasa", APIKey: "key"}))
+	assert.False(t, aiConfigured(models.AIConfig{}))
+}
+
+func TestGenerateOllamaResponse(t *testing.T) {
+	var got struct {
+		Model    string              `json:"model"`
+		Messages []map[string]string `json:"messages"`
+		Stream   bool                `json:"stream"`
+		Options  map[string]float64  `json:"options"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/chat", r.URL.Path)
+		assert.Empty(t, r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		_, _ = w.Write([]byte(`{"model":"llama3.1","message":{"role":"assistant","content":" We open at 9am. "},"done":true,"prompt_eval_count":42,"eval_count":7}`))
+	}))
+	defer server.Close()
+
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{
+		Provider:     models.AIProviderOllama,
+		BaseURL:      server.URL + "/",
+		Model:        "llama3.1",
+		MaxTokens:    200,
+		Temperature:  0.2,
+		SystemPrompt: "You are a bakery assistant.",
+	}}
+
+	completion, err := app.generateOllamaResponse(context.Background(), settings, nil, "When do you open?", "Hours: 9am-5pm")
+	require.NoError(t, err)
+	assert.Equal(t, "We open at 9am.", completion.Text)
+	assert.Equal(t, 42, completion.PromptTokens)
+	assert.Equal(t, 7, completion.CompletionTokens)
+
+	assert.Equal(t, "llama3.1", got.Model)
+	assert.False(t, got.Stream)
+	assert.Equal(t, float64(200), got.Options["num_predict"])
+	assert.Equal(t, 0.2, got.Options["temperature"])
+	require.Len(t, got.Messages, 2)
+	assert.Equal(t, "system", got.Messages[0]["role"])
+	assert.Equal(t, "You are a bakery assistant.\n\nHours: 9am-5pm", got.Messages[0]["content"])
+	assert.Equal(t, map[string]string{"role": "user", "content": "When do you open?"}, got.Messages[1])
+}
+
+func TestGenerateOllamaResponse_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"model \"llama9\" not found, try pulling it first"}`))
+	}))
+	defer server.Close()
+
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{Provider: models.AIProviderOllama, BaseURL: server.URL, Model: "llama9"}}
+
+	_, err := app.generateOllamaResponse(context.Background(), settings, nil, "Hi", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+}
+
+func TestRenderAIWebhookBody(t *testing.T) {
+	body := renderAIWebhookBody(`{"sender": "{{sender}}", "text": "{{message}}"}`, map[string]string{
+		"sender":  "15550100001",
+		"message": "Say \"hi\"\nthen bye",
+	})
+	assert.JSONEq(t, `{"sender": "15550100001", "text": "Say \"hi\"\nthen bye"}`, body)
+
+	assert.NoError(t, validateAIWebhookBody(defaultAIWebhookBody))
+	assert.NoError(t, validateAIWebhookBody(`{"queryInput": {"text": {"text": "{{message}}", "languageCode": "en"}}}`))
+	assert.Error(t, validateAIWebhookBody(`{"message": {{message}}}`))
+	assert.Error(t, validateAIWebhookBody(`message={{message}}`))
+}
+
+func TestExtractAIWebhookReply(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		path string
+		want string
+	}{
+		{"object", `{"reply": "Hello"}`, "reply", "Hello"},
+		{"jsonpath prefix", `{"queryResult": {"fulfillmentText": "Hi there"}}`, "$.queryResult.fulfillmentText", "Hi there"},
+		{"nested array", `{"responses": [{"text": "First"}, {"text": "Second"}]}`, "$.responses[1].text", "Second"},
+		{"top-level array", `[{"recipient_id": "1", "text": "From Rasa"}]`, "$[0].text", "From Rasa"},
+		{"no path", "  plain text reply\n", "", "plain text reply"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractAIWebhookReply([]byte(tt.body), tt.path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := extractAIWebhookReply([]byte(`{"reply": ""}`), "reply")
+	assert.Error(t, err)
+	_, err = extractAIWebhookReply([]byte(`not json`), "reply")
+	assert.Error(t, err)
+}
+
+func TestGenerateWebhookResponse(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bots/support", r.URL.Path)
+		assert.Equal(t, "secret-token", r.Header.Get("X-Bot-Token"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		_, _ = w.Write([]byte(`[{"recipient_id": "15550100001", "text": "Your order ships today."}]`))
+	}))
+	defer server.Close()
+
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{
+		Provider:            models.AIProviderWebhook,
+		BaseURL:             server.URL + "/bots/support",
+		WebhookHeaders:      models.JSONB{"X-Bot-Token": "secret-token"},
+		WebhookBody:         `{"sender": "{{sender}}", "message": "{{message}}", "metadata": {"session": "{{session_id}}"}}`,
+		WebhookResponsePath: "$[0].text",
+	}}
+	session := &models.ChatbotSession{BaseModel: models.BaseModel{ID: uuid.New()}, PhoneNumber: "15550100001"}
+
+	completion, err := app.generateWebhookResponse(context.Background(), settings, session, "Where is my order?", "")
+	require.NoError(t, err)
+	assert.Equal(t, "Your order ships today.", completion.Text)
+	assert.Equal(t, []aiBotMessage{{Text: "Your order ships today."}}, completion.Messages)
+
+	assert.Equal(t, "15550100001", got["sender"])
+	assert.Equal(t, "Where is my order?", got["message"])
+	assert.Equal(t, map[string]interface{}{"session": session.ID.String()}, got["metadata"])
+}
+
+func TestGenerateWebhookResponse_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{Provider: models.AIProviderWebhook, BaseURL: server.URL}}
+
+	_, err := app.generateWebhookResponse(context.Background(), settings, nil, "Hi", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 502")
+}
+
+func TestGenerateWebhookResponse_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	app := &App{
+		Config: &config.Config{AI: config.AIConfig{Timeouts: config.AITimeoutsConfig{Webhook: 1}}},
+		Log:    testutil.NopLogger(),
+	}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{Provider: models.AIProviderWebhook, BaseURL: server.URL}}
+
+	start := time.Now()
+	_, err := app.generateWebhookResponse(context.Background(), settings, nil, "Hi", "")
+	require.Error(t, err)
+	assert.True(t, retryableAIError(err), "timeouts are retried")
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	assert.Same(t, app.aiClient(models.AIProviderWebhook), app.aiClient(models.AIProviderWebhook), "clients are reused")
+	assert.Equal(t, 60*time.Second, app.aiClient(models.AIProviderOpenAI).Timeout, "unset timeouts fall back to a minute")
+}
+
+func TestValidateAIFallbackProviders(t *testing.T) {
+	existing := []AIFallbackProvider{{Provider: models.AIProviderAnthropic, APIKey: "sk-ant"}}
+
+	items, err := validateAIFallbackProviders([]AIFallbackProvider{
+		{Provider: models.AIProviderAnthropic, Model: "claude-3-5-haiku-latest"},
+		{Provider: models.AIProviderOllama, Model: "llama3.1", BaseURL: "http://ollama:11434/"},
+	}, existing)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "sk-ant", items[0].(map[string]interface{})["api_key"], "empty key keeps the stored one")
+	assert.Equal(t, "http://ollama:11434", items[1].(map[string]interface{})["base_url"])
+
+	_, err = validateAIFallbackProviders([]AIFallbackProvider{{Provider: "rasa"}}, nil)
+	assert.Error(t, err)
+	_, err = validateAIFallbackProviders([]AIFallbackProvider{{Provider: models.AIProviderOllama, BaseURL: "ftp://ollama"}}, nil)
+	assert.Error(t, err)
+	_, err = validateAIFallbackProviders(make([]AIFallbackProvider, maxAIFallbackProviders+1), nil)
+	assert.Error(t, err)
+}
+
+func TestAIFallbackProviders_Encrypted(t *testing.T) {
+	testutil.EnableEncryption(t)
+
+	items, err := validateAIFallbackProviders([]AIFallbackProvider{{Provider: models.AIProviderAnthropic, APIKey: "sk-ant"}}, nil)
+	require.NoError(t, err)
+	require.NoError(t, models.EncryptAIProviderKeys(items))
+	assert.NotEqual(t, "sk-ant", items[0].(map[string]interface{})["api_key"])
+
+	providers := aiFallbackProviders(&models.ChatbotSettings{AI: models.AIConfig{FallbackProviders: items}})
+	require.Len(t, providers, 1)
+	assert.Equal(t, "sk-ant", providers[0].APIKey)
+}
+
+func TestAIProviderChain(t *testing.T) {
+	settings := &models.ChatbotSettings{AI: models.AIConfig{
+		Provider:     models.AIProviderOpenAI,
+		APIKey:       "sk-openai",
+		Model:        "gpt-4o-mini",
+		SystemPrompt: "Be brief.",
+		FallbackProviders: models.JSONBArray{
+			map[string]interface{}{"provider": "anthropic", "model": "claude-3-5-haiku-latest"}, // no key, skipped
+			map[string]interface{}{"provider": "ollama", "model": "llama3.1", "base_url": "http://ollama:11434"},
+		},
+	}}
+
+	chain := aiProviderChain(settings)
+	require.Len(t, chain, 2)
+	assert.Equal(t, models.AIProviderOpenAI, chain[0].Provider)
+	assert.Equal(t, models.AIProviderOllama, chain[1].Provider)
+	assert.Equal(t, "llama3.1", chain[1].Model)
+	assert.Equal(t, "http://ollama:11434", chain[1].BaseURL)
+	assert.Empty(t, chain[1].APIKey)
+	assert.Equal(t, "Be brief.", chain[1].SystemPrompt, "fallbacks share the primary prompt")
+
+	assert.Empty(t, aiFallbackProvidersResponse(&models.ChatbotSettings{AI: models.AIConfig{
+		FallbackProviders: models.JSONBArray{map[string]interface{}{"provider": "openai", "api_key": "sk"}},
+	}})[0].APIKey)
+}
+
+func TestGenerateWithFallback(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"message": {"role": "assistant", "content": "Answer from the backup model"}}`))
+	}))
+	defer fallback.Close()
+
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{
+		Provider:            models.AIProviderWebhook,
+		BaseURL:             primary.URL,
+		WebhookResponsePath: "reply",
+		FallbackProviders: models.JSONBArray{
+			map[string]interface{}{"provider": "ollama", "model": "llama3.1", "base_url": fallback.URL},
+		},
+	}}
+
+	completion, err := app.generateWithFallback(context.Background(), settings, nil, "Hi", "")
+	require.NoError(t, err)
+	assert.Equal(t, "Answer from the backup model", completion.Text)
+	assert.Equal(t, models.AIProviderOllama, completion.Provider)
+	assert.Equal(t, "llama3.1", completion.Model)
+
+	// Every provider failing reports each error
+	settings.AI.FallbackProviders = models.JSONBArray{
+		map[string]interface{}{"provider": "ollama", "base_url": primary.URL},
+	}
+	_, err = app.generateWithFallback(context.Background(), settings, nil, "Hi", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "webhook: webhook returned status 503")
+	assert.Contains(t, err.Error(), "ollama: Ollama API error (status 503)")
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+const (
+	// aiQuickReplyPrefix marks the button IDs of quick replies on AI answers, so
+	// their taps are told apart from greeting and flow buttons
+	aiQuickReplyPrefix = "ai_quick_reply:"
+	// maxAIQuickReplies keeps quick replies as reply buttons; WhatsApp shows more as a list
+	maxAIQuickReplies = 3
+	// maxQuickReplyTitle is WhatsApp's limit on reply button titles
+	maxQuickReplyTitle = 20
+	// maxInteractiveBody is WhatsApp's limit on the body of an interactive message
+	maxInteractiveBody = 1024
+)
+
+// AIQuickReply is a button appended to AI answers
+type AIQuickReply struct {
+	ID     string                    `json:"id"`
+	Title  string                    `json:"title"`
+	Action models.AIQuickReplyAction `json:"action"`
+	FlowID string                    `json:"flow_id,omitempty"` // Flow started by the flow action
+}
+
+// aiQuickReplies returns the quick replies configured on the chatbot settings
+func aiQuickReplies(settings *models.ChatbotSettings) []AIQuickReply {
+	replies := make([]AIQuickReply, 0, len(settings.AI.QuickReplies))
+	for _, item := range settings.AI.QuickReplies {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		reply := AIQuickReply{
+			ID:     getStringFromMap(m, "id"),
+			Title:  getStringFromMap(m, "title"),
+			Action: models.AIQuickReplyAction(getStringFromMap(m, "action")),
+			FlowID: getStringFromMap(m, "flow_id"),
+		}
+		if reply.ID == "" || reply.Title == "" {
+			continue
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+// validateAIQuickReplies checks quick replies before they are saved
+func validateAIQuickReplies(replies []AIQuickReply) error {
+	if len(replies) > maxAIQuickReplies {
+		return fmt.Errorf("at most %d quick replies are allowed", maxAIQuickReplies)
+	}
+	seen := make(map[string]bool, len(replies))
+	for _, reply := range replies {
+		if reply.ID == "" || strings.TrimSpace(reply.Title) == "" {
+			return fmt.Errorf("quick replies need an id and a title")
+		}
+		if seen[reply.ID] {
+			return fmt.Errorf("duplicate quick reply id %q", reply.ID)
+		}
+		seen[reply.ID] = true
+		if utf8.RuneCountInString(reply.Title) > maxQuickReplyTitle {
+			return fmt.Errorf("quick reply title %q is longer than %d characters", reply.Title, maxQuickReplyTitle)
+		}
+		switch reply.Action {
+		case models.AIQuickReplyActionTransfer, models.AIQuickReplyActionMainMenu:
+		case models.AIQuickReplyActionFlow:
+			if _, err := uuid.Parse(reply.FlowID); err != nil {
+				return fmt.Errorf("quick reply %q needs a flow", reply.Title)
+			}
+		default:
+			return fmt.Errorf("invalid quick reply action %q", reply.Action)
+		}
+	}
+	return nil
+}
+
+// aiQuickReplyButtons converts quick replies to interactive buttons
+func aiQuickReplyButtons(replies []AIQuickReply) []map[string]interface{} {
+	buttons := make([]map[string]interface{}, 0, len(replies))
+	for i, reply := range replies {
+		if i >= maxAIQuickReplies {
+			break
+		}
+		buttons = append(buttons, map[string]interface{}{
+			"id":    aiQuickReplyPrefix + reply.ID,
+			"title": reply.Title,
+		})
+	}
+	return buttons
+}
+
+// findAIQuickReply returns the quick reply a tapped button ID belongs to
+func findAIQuickReply(replies []AIQuickReply, buttonID string) (AIQuickReply, bool) {
+	id, ok := strings.CutPrefix(buttonID, aiQuickReplyPrefix)
+	if !ok {
+		return AIQuickReply{}, false
+	}
+	for _, reply := range replies {
+		if reply.ID == id {
+			return reply, true
+		}
+	}
+	return AIQuickReply{}, false
+}
+
+// sendAIResponse sends an AI answer with the configured quick replies. Answers
+// too long for an interactive message are sent as plain text.
+func (a *App) sendAIResponse(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, settings *models.ChatbotSettings, response string) error {
+	buttons := aiQuickReplyButtons(aiQuickReplies(settings))
+	if len(buttons) == 0 {
+		return a.sendAndSaveTextMessage(ctx, account, contact, response)
+	}
+	if utf8.RuneCountInString(response) > maxInteractiveBody {
+		a.log(ctx).Debug("AI response too long for quick replies, sending as text", "length", len(response))
+		return a.sendAndSaveTextMessage(ctx, account, contact, response)
+	}
+	return a.sendAndSaveInteractiveButtons(ctx, account, contact, response, buttons)
+}
+
+// handleAIQuickReply runs the action of a tapped quick reply. It returns false if
+// the button isn't a configured quick reply, so the tap is processed as text.
+func (a *App) handleAIQuickReply(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, session *models.ChatbotSession, settings *models.ChatbotSettings, buttonID string) bool {
+	reply, ok := findAIQuickReply(aiQuickReplies(settings), buttonID)
+	if !ok {
+		return false
+	}
+
+	a.log(ctx).Info("AI quick reply tapped", "action", reply.Action, "id", reply.ID, "contact", contact.PhoneNumber)
+
+	switch reply.Action {
+	case models.AIQuickReplyActionTransfer:
+		a.createTransferFromKeyword(ctx, account, contact)
+
+	case models.AIQuickReplyActionMainMenu:
+		if settings.DefaultResponse == "" {
+			a.log(ctx).Warn("Main menu quick reply tapped but no greeting is configured", "settings_id", settings.ID)
+			return true
+		}
+		// Going back to the menu leaves any flow the customer has since entered
+		if session.CurrentFlowID != nil {
+			a.DB.Model(session).Updates(map[string]interface{}{
+				"current_flow_id": nil,
+				"current_step":    "",
+				"step_retries":    0,
+			})
+			session.CurrentFlowID = nil
+		}
+		a.sendGreeting(ctx, account, contact, session, settings)
+
+	case models.AIQuickReplyActionFlow:
+		flowID, err := uuid.Parse(reply.FlowID)
+		if err != nil {
+			return true
+		}
+		flow, err := a.getChatbotFlowByIDCached(account.OrganizationID, flowID)
+		if err != nil {
+			a.log(ctx).Error("Quick reply flow not found", "error", err, "flow_id", flowID)
+			return true
+		}
+		a.startFlow(ctx, account, session, contact, flow)
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAIQuickReplies_ButtonsAndTaps(t *testing.T) {
+	settings := &models.ChatbotSettings{
+		AI: models.AIConfig{
+			QuickReplies: models.JSONBArray{
+				map[string]interface{}{"id": "agent", "title": "Talk to agent", "action": "transfer"},
+				map[string]interface{}{"id": "menu", "title": "Main menu", "action": "main_menu"},
+				map[string]interface{}{"id": "", "title": "Broken"},
+			},
+		},
+	}
+
+	replies := aiQuickReplies(settings)
+	require.Len(t, replies, 2)
+
+	buttons := aiQuickReplyButtons(replies)
+	require.Len(t, buttons, 2)
+	assert.Equal(t, "ai_quick_reply:agent", buttons[0]["id"])
+	assert.Equal(t, "Talk to agent", buttons[0]["title"])
+
+	reply, ok := findAIQuickReply(replies, "ai_quick_reply:menu")
+	require.True(t, ok)
+	assert.Equal(t, models.AIQuickReplyActionMainMenu, reply.Action)
+
+	// Greeting and flow buttons aren't quick replies, even with a matching ID
+	_, ok = findAIQuickReply(replies, "menu")
+	assert.False(t, ok)
+	_, ok = findAIQuickReply(replies, "ai_quick_reply:removed")
+	assert.False(t, ok)
+}
+
+func TestValidateAIQuickReplies(t *testing.T) {
+	valid := []AIQuickReply{
+		{ID: "agent", Title: "Talk to agent", Action: models.AIQuickReplyActionTransfer},
+		{ID: "book", Title: "Book a visit", Action: models.AIQuickReplyActionFlow, FlowID: uuid.NewString()},
+	}
+	assert.NoError(t, validateAIQuickReplies(valid))
+
+	tests := []struct {
+		name    string
+		replies []AIQuickReply
+	}{
+		{"too many", []AIQuickReply{
+			{ID: "a", Title: "A", Action: models.AIQuickReplyActionTransfer},
+			{ID: "b", Title: "B", Action: models.AIQuickReplyActionTransfer},
+			{ID: "c", Title: "C", Action: models.AIQuickReplyActionTransfer},
+			{ID: "d", Title: "D", Action: models.AIQuickReplyActionTransfer},
+		}},
+		{"duplicate id", []AIQuickReply{
+			{ID: "a", Title: "A", Action: models.AIQuickReplyActionTransfer},
+			{ID: "a", Title: "B", Action: models.AIQuickReplyActionMainMenu},
+		}},
+		{"long title", []AIQuickReply{{ID: "a", Title: "Talk to a human agent now", Action: models.AIQuickReplyActionTransfer}}},
+		{"flow without flow_id", []AIQuickReply{{ID: "a", Title: "Book", Action: models.AIQuickReplyActionFlow}}},
+		{"unknown action", []AIQuickReply{{ID: "a", Title: "A", Action: "call"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, validateAIQuickReplies(tt.replies))
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// aiBreakerPrefix prefixes the Redis keys of AI provider circuit breakers
+const aiBreakerPrefix = "ai_breaker:"
+
+// errAICircuitOpen is returned for providers skipped after failing repeatedly
+var errAICircuitOpen = errors.New("skipped after repeated failures, circuit open")
+
+// aiHTTPError is an error response of an AI provider, kept with its HTTP status
+// so transient failures can be told apart
+type aiHTTPError struct {
+	Status int
+	Err    error
+}
+
+func (e *aiHTTPError) Error() string { return e.Err.Error() }
+func (e *aiHTTPError) Unwrap() error { return e.Err }
+
+// aiStatusError records the HTTP status of a provider's error response
+func aiStatusError(status int, err error) error {
+	return &aiHTTPError{Status: status, Err: err}
+}
+
+// retryableAIError reports whether a failed provider call may succeed if made
+// again: timeouts and connection errors, rate limits and server errors. Streams
+// interrupted after parts of the answer were sent aren't.
+func retryableAIError(err error) bool {
+	if errors.Is(err, errAIStreamInterrupted) {
+		return false
+	}
+	var httpErr *aiHTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Status == 408 || httpErr.Status == 429 || httpErr.Status >= 500
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// aiRetryConfig returns the retry and circuit breaker settings. Without a
+// configuration, calls aren't retried.
+func (a *App) aiRetryConfig() config.AIConfig {
+	cfg := a.CurrentConfig()
+	if cfg == nil {
+		return config.AIConfig{MaxAttempts: 1}
+	}
+	return cfg.AI
+}
+
+// aiRetryBackoff returns the delay before a retry: the base delay doubled for
+// each attempt made, capped, with the upper half jittered so retries spread out
+func aiRetryBackoff(cfg config.AIConfig, attempt int) time.Duration {
+	delay := time.Duration(cfg.RetryBackoffMs) * time.Millisecond
+	maxDelay := time.Duration(cfg.RetryMaxBackoffMs) * time.Millisecond
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// aiBreakerKey identifies the circuit of a provider. Self-hosted providers and
+// webhooks get one per server, so one organization's dead bot doesn't trip others.
+func aiBreakerKey(ai models.AIConfig) string {
+	key := aiBreakerPrefix + string(ai.Provider)
+	if ai.BaseURL != "" {
+		sum := sha256.Sum256([]byte(ai.BaseURL))
+		key += ":" + hex.EncodeToString(sum[:8])
+	}
+	return key
+}
+
+// aiCircuitOpen reports whether a provider is skipped after failing repeatedly
+func (a *App) aiCircuitOpen(key string) bool {
+	if a.Redis == nil {
+		return false
+	}
+	n, err := a.Redis.Exists(context.Background(), key+":open").Result()
+	return err == nil && n > 0
+}
+
+// recordAIFailure counts a transient failure of a provider and opens its circuit
+// once the failures in a row reach the threshold. After the cooldown the next
+// call goes through, and a single failure opens the circuit again. It reports
+// whether the circuit was opened.
+func (a *App) recordAIFailure(key string, cfg config.AIConfig) bool {
+	if a.Redis == nil || cfg.BreakerThreshold <= 0 {
+		return false
+	}
+	ctx := context.Background()
+	cooldown := time.Duration(cfg.BreakerCooldownSecs) * time.Second
+	failures, err := a.Redis.Incr(ctx, key+":failures").Result()
+	if err != nil {
+		a.Log.Error("Failed to record AI provider failure", "error", err, "key", key)
+		return false
+	}
+	a.Redis.Expire(ctx, key+":failures", 2*cooldown)
+	if failures < int64(cfg.BreakerThreshold) {
+		return false
+	}
+
+	pipe := a.Redis.TxPipeline()
+	pipe.Set(ctx, key+":open", "1", cooldown)
+	pipe.Set(ctx, key+":failures", cfg.BreakerThreshold-1, 2*cooldown)
+	if _, err := pipe.Exec(ctx); err != nil {
+		a.Log.Error("Failed to open AI provider circuit", "error", err, "key", key)
+		return false
+	}
+	a.Log.Warn("AI provider circuit opened", "key", key, "failures", failures, "cooldown", cooldown)
+	return true
+}
+
+// recordAISuccess resets the failures of a provider that answered
+func (a *App) recordAISuccess(key string) {
+	if a.Redis == nil {
+		return
+	}
+	a.Redis.Del(context.Background(), key+":failures")
+}
+
+// callAIProvider asks one provider for an answer, retrying transient failures
+// with backoff. Providers whose circuit is open are skipped, so a dead provider
+// fails fast and the next one in the chain answers.
+func (a *App) callAIProvider(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) (*aiCompletion, error) {
+	if config.IsSecretReference(settings.AI.APIKey) {
+		apiKey, err := a.resolveCredential(ctx, settings.OrganizationID, settings.AI.APIKey)
+		if err != nil {
+			return nil, fmt.Errorf("AI API key: %w", err)
+		}
+		resolved := *settings
+		resolved.AI.APIKey = apiKey
+		settings = &resolved
+	}
+
+	cfg := a.aiRetryConfig()
+	key := aiBreakerKey(settings.AI)
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if a.aiCircuitOpen(key) {
+			if err != nil {
+				return nil, err
+			}
+			return nil, errAICircuitOpen
+		}
+
+		callCtx, span := tracing.Start(ctx, "ai.call",
+			attribute.String("ai.provider", string(settings.AI.Provider)),
+			attribute.String("ai.model", settings.AI.Model),
+			attribute.Int("ai.attempt", attempt),
+		)
+		var completion *aiCompletion
+		completion, err = a.generateProviderResponse(callCtx, settings, session, userMessage, contextData)
+		if err == nil {
+			span.SetAttributes(
+				attribute.Int("ai.prompt_tokens", completion.PromptTokens),
+				attribute.Int("ai.completion_tokens", completion.CompletionTokens),
+			)
+		}
+		tracing.End(span, err)
+		if err == nil {
+			a.recordAISuccess(key)
+			return completion, nil
+		}
+		if !retryableAIError(err) {
+			return nil, err
+		}
+		if a.recordAIFailure(key, cfg) {
+			a.notify(settings.OrganizationID, models.NotificationEventAIProviderDown,
+				fmt.Sprintf("AI provider %s is down", settings.AI.Provider),
+				fmt.Sprintf("Calls to %s (%s) failed %d times in a row with: %v\n\n"+
+					"It's skipped for %d seconds, and fallback providers, if any, answer meanwhile.\n",
+					settings.AI.Provider, settings.AI.Model, cfg.BreakerThreshold, err, cfg.BreakerCooldownSecs))
+		}
+		if attempt >= cfg.MaxAttempts {
+			return nil, err
+		}
+
+		delay := aiRetryBackoff(cfg, attempt)
+		a.log(ctx).Warn("AI provider call failed, retrying", "error", err, "provider", settings.AI.Provider, "attempt", attempt, "delay", delay)
+		time.Sleep(delay)
+	}
+}
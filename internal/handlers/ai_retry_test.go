@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryableAIError(t *testing.T) {
+	assert.True(t, retryableAIError(aiStatusError(503, errors.New("unavailable"))))
+	assert.True(t, retryableAIError(aiStatusError(429, errors.New("rate limited"))))
+	assert.True(t, retryableAIError(fmt.Errorf("request failed: %w", &url.Error{Op: "Post", URL: "http://bot", Err: errors.New("timeout")})))
+	assert.False(t, retryableAIError(aiStatusError(401, errors.New("invalid key"))))
+	assert.False(t, retryableAIError(errors.New("failed to parse response")))
+}
+
+func TestAIRetryBackoff(t *testing.T) {
+	cfg := config.AIConfig{RetryBackoffMs: 100, RetryMaxBackoffMs: 300}
+	for i := 0; i < 20; i++ {
+		first := aiRetryBackoff(cfg, 1)
+		assert.GreaterOrEqual(t, first, 50*time.Millisecond)
+		assert.LessOrEqual(t, first, 100*time.Millisecond)
+		capped := aiRetryBackoff(cfg, 5)
+		assert.GreaterOrEqual(t, capped, 150*time.Millisecond)
+		assert.LessOrEqual(t, capped, 300*time.Millisecond)
+	}
+	assert.NotEqual(t, aiBreakerKey(models.AIConfig{Provider: models.AIProviderWebhook, BaseURL: "https://a.example.com"}),
+		aiBreakerKey(models.AIConfig{Provider: models.AIProviderWebhook, BaseURL: "https://b.example.com"}))
+}
+
+func TestCallAIProviderRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(`{"reply": "Back online"}`))
+		case "/denied":
+			calls.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	app := &App{
+		Config: &config.Config{AI: config.AIConfig{MaxAttempts: 3, RetryBackoffMs: 1, RetryMaxBackoffMs: 2}},
+		Log:    testutil.NopLogger(),
+	}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{
+		Provider:            models.AIProviderWebhook,
+		BaseURL:             server.URL + "/flaky",
+		WebhookResponsePath: "reply",
+	}}
+
+	completion, err := app.callAIProvider(context.Background(), settings, nil, "Hi", "")
+	require.NoError(t, err)
+	assert.Equal(t, "Back online", completion.Text)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// Errors that won't go away aren't retried
+	calls.Store(0)
+	settings.AI.BaseURL = server.URL + "/denied"
+	_, err = app.callAIProvider(context.Background(), settings, nil, "Hi", "")
+	require.Error(t, err)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCallAIProviderCircuitBreaker(t *testing.T) {
+	redis := testutil.SetupTestRedis(t)
+	if redis == nil {
+		t.Skip("TEST_REDIS_URL not set")
+	}
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	app := &App{
+		Config: &config.Config{AI: config.AIConfig{MaxAttempts: 2, RetryBackoffMs: 1, RetryMaxBackoffMs: 1, BreakerThreshold: 3, BreakerCooldownSecs: 60}},
+		Log:    testutil.NopLogger(),
+		Redis:  redis,
+	}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{Provider: models.AIProviderWebhook, BaseURL: server.URL}}
+	t.Cleanup(func() {
+		key := aiBreakerKey(settings.AI)
+		redis.Del(context.Background(), key+":open", key+":failures")
+	})
+
+	// Two calls of two attempts reach the threshold of three failures
+	_, err := app.callAIProvider(context.Background(), settings, nil, "Hi", "")
+	require.Error(t, err)
+	_, err = app.callAIProvider(context.Background(), settings, nil, "Hi", "")
+	require.Error(t, err)
+	assert.Equal(t, int32(3), calls.Load(), "the open circuit stops the retry")
+
+	_, err = app.callAIProvider(context.Background(), settings, nil, "Hi", "")
+	assert.ErrorIs(t, err, errAICircuitOpen)
+	assert.Equal(t, int32(3), calls.Load())
+}
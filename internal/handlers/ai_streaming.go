@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// maxAIStreamIntervalMs limits the minimum time between the parts of a streamed
+// answer
+const maxAIStreamIntervalMs = 30000
+
+// errAIStreamInterrupted is returned when a streamed answer fails after parts of
+// it were sent. It isn't retried or passed to fallback providers, as the customer
+// would get the start of the answer twice.
+var errAIStreamInterrupted = errors.New("AI response stream interrupted")
+
+// aiStreamContextKey is the context key of the stream AI answers are sent to
+type aiStreamContextKey struct{}
+
+// aiStream sends an AI answer to the customer in parts as it's generated. Text is
+// held until a paragraph or sentence is complete, and parts are sent at most once
+// per interval; text generated meanwhile goes in the next part.
+type aiStream struct {
+	split    models.AIStreamSplit
+	interval time.Duration
+	// send sends a part of the answer, the last one with the answer's quick replies
+	send func(ctx context.Context, text string, last bool) error
+
+	pending  strings.Builder
+	sent     int
+	lastSent time.Time
+}
+
+// newAIStream returns the stream to send an AI answer to the contact, or nil when
+// answers of the chatbot settings aren't streamed. Answers checked or acted on as
+// a whole aren't: those that are moderated, can hand off or can call tools.
+func (a *App) newAIStream(account *models.WhatsAppAccount, contact *models.Contact, settings *models.ChatbotSettings) *aiStream {
+	if !settings.AI.Streaming || settings.AI.ModerationEnabled || settings.AgentAssignment.HandoffOnAIIntent ||
+		len(availableAITools(settings)) > 0 {
+		return nil
+	}
+	return &aiStream{
+		split:    settings.AI.StreamSplit,
+		interval: time.Duration(settings.AI.StreamIntervalMs) * time.Millisecond,
+		send: func(ctx context.Context, text string, last bool) error {
+			if last {
+				return a.sendAIResponse(ctx, account, contact, settings, text)
+			}
+			return a.sendAndSaveTextMessage(ctx, account, contact, text)
+		},
+	}
+}
+
+// withAIStream returns a context whose AI answers are streamed to the stream
+func withAIStream(ctx context.Context, stream *aiStream) context.Context {
+	return context.WithValue(ctx, aiStreamContextKey{}, stream)
+}
+
+// aiStreamFromContext returns the stream of a context, nil if answers aren't streamed
+func aiStreamFromContext(ctx context.Context) *aiStream {
+	stream, _ := ctx.Value(aiStreamContextKey{}).(*aiStream)
+	return stream
+}
+
+// write adds generated text to the answer, and sends what's complete of it once
+// the interval since the last part has passed
+func (s *aiStream) write(ctx context.Context, delta string) error {
+	s.pending.WriteString(delta)
+	if s.sent > 0 && time.Since(s.lastSent) < s.interval {
+		return nil
+	}
+	text := s.pending.String()
+	cut := aiStreamCut(text, s.split)
+	if cut <= 0 {
+		return nil
+	}
+	part := strings.TrimSpace(text[:cut])
+	s.pending.Reset()
+	s.pending.WriteString(text[cut:])
+	if part == "" {
+		return nil
+	}
+	return s.sendPart(ctx, part, false)
+}
+
+// finish sends the rest of the answer, once the interval since the last part has
+// passed
+func (s *aiStream) finish(ctx context.Context) error {
+	part := strings.TrimSpace(s.pending.String())
+	s.pending.Reset()
+	if part == "" {
+		return nil
+	}
+	if wait := s.interval - time.Since(s.lastSent); s.sent > 0 && wait > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return s.sendPart(ctx, part, true)
+}
+
+func (s *aiStream) sendPart(ctx context.Context, text string, last bool) error {
+	if err := s.send(ctx, text, last); err != nil {
+		return fmt.Errorf("failed to send part of the answer: %w", err)
+	}
+	s.sent++
+	s.lastSent = time.Now()
+	return nil
+}
+
+// result returns the outcome of streaming an answer. Failed streams that sent
+// nothing can be retried, so their text is dropped; those that sent parts are
+// interrupted.
+func (s *aiStream) result(completion *aiCompletion, err error) (*aiCompletion, error) {
+	if err == nil {
+		completion.Text = strings.TrimSpace(completion.Text)
+		if completion.Text == "" {
+			return nil, errors.New("empty streamed response")
+		}
+		completion.Streamed = true
+		return completion, nil
+	}
+	if s.sent == 0 {
+		s.pending.Reset()
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: %w", errAIStreamInterrupted, err)
+}
+
+// aiStreamCut returns where the complete part of streamed text ends: after its last
+// paragraph, or its last sentence or line. It's 0 while nothing is complete.
+func aiStreamCut(text string, split models.AIStreamSplit) int {
+	if split != models.AIStreamSplitSentence {
+		if i := strings.LastIndex(text, "\n\n"); i >= 0 {
+			return i + 2
+		}
+		return 0
+	}
+
+	cut := 0
+	var prev, cur rune
+	for i, r := range text {
+		switch {
+		case r == '\n':
+			cut = i + 1
+		case unicode.IsSpace(r) && isSentenceEnd(cur) && !unicode.IsDigit(prev):
+			// "1. " starts an item of a numbered list, it doesn't end a sentence
+			cut = i
+		}
+		prev, cur = cur, r
+	}
+	return cut
+}
+
+// isSentenceEnd reports whether a character ends a sentence
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?' || r == '。' || r == '！' || r == '？'
+}
+
+// postAIStreamRequest posts a payload to a streaming AI API. The body of a
+// successful response is returned open for reading; error responses are read
+// whole and returned with their status.
+func (a *App) postAIStreamRequest(ctx context.Context, client *http.Client, url string, headers map[string]string, payload interface{}) (io.ReadCloser, int, []byte, error) {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, resp.StatusCode, body, nil
+	}
+	return resp.Body, resp.StatusCode, nil, nil
+}
+
+// readAIStreamLines calls fn with each line of a streamed response: the data of
+// server-sent events, or the lines of newline-delimited JSON
+func readAIStreamLines(r io.Reader, fn func(line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if data, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			line = bytes.TrimSpace(data)
+		} else if bytes.HasPrefix(line, []byte("event:")) || bytes.HasPrefix(line, []byte(":")) {
+			continue
+		}
+		if len(line) == 0 || string(line) == "[DONE]" {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil
+}
+
+// streamOpenAIResponse streams a chat completion of OpenAI to the stream
+func (a *App) streamOpenAIResponse(ctx context.Context, stream *aiStream, headers map[string]string, payload map[string]interface{}) (*aiCompletion, error) {
+	payload["stream"] = true
+	payload["stream_options"] = map[string]interface{}{"include_usage": true}
+	body, status, errBody, err := a.postAIStreamRequest(ctx, a.aiClient(models.AIProviderOpenAI), openAIChatURL, headers, payload)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		var errResp struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(errBody, &errResp)
+		return nil, aiStatusError(status, fmt.Errorf("OpenAI API error: %s", errResp.Error.Message))
+	}
+	defer func() { _ = body.Close() }()
+
+	completion := &aiCompletion{}
+	var text strings.Builder
+	err = readAIStreamLines(body, func(line []byte) error {
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		if chunk.Usage != nil {
+			completion.PromptTokens = chunk.Usage.PromptTokens
+			completion.CompletionTokens = chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			return nil
+		}
+		text.WriteString(chunk.Choices[0].Delta.Content)
+		return stream.write(ctx, chunk.Choices[0].Delta.Content)
+	})
+	completion.Text = text.String()
+	return stream.result(completion, err)
+}
+
+// streamAnthropicResponse streams a message of Anthropic to the stream
+func (a *App) streamAnthropicResponse(ctx context.Context, stream *aiStream, headers map[string]string, payload map[string]interface{}) (*aiCompletion, error) {
+	payload["stream"] = true
+	body, status, errBody, err := a.postAIStreamRequest(ctx, a.aiClient(models.AIProviderAnthropic), anthropicMessagesURL, headers, payload)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		var errResp struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(errBody, &errResp)
+		return nil, aiStatusError(status, fmt.Errorf("anthropic API error: %s", errResp.Error.Message))
+	}
+	defer func() { _ = body.Close() }()
+
+	completion := &aiCompletion{}
+	var text strings.Builder
+	err = readAIStreamLines(body, func(line []byte) error {
+		var event struct {
+			Type    string `json:"type"`
+			Message struct {
+				Usage struct {
+					InputTokens int `json:"input_tokens"`
+				} `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+			Usage struct {
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(line, &event); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		switch event.Type {
+		case "message_start":
+			completion.PromptTokens = event.Message.Usage.InputTokens
+		case "message_delta":
+			completion.CompletionTokens = event.Usage.OutputTokens
+		case "error":
+			return fmt.Errorf("anthropic API error: %s", event.Error.Message)
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				text.WriteString(event.Delta.Text)
+				return stream.write(ctx, event.Delta.Text)
+			}
+		}
+		return nil
+	})
+	completion.Text = text.String()
+	return stream.result(completion, err)
+}
+
+// streamGoogleResponse streams generated content of Google Gemini to the stream
+func (a *App) streamGoogleResponse(ctx context.Context, stream *aiStream, settings *models.ChatbotSettings, payload map[string]interface{}) (*aiCompletion, error) {
+	url := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse&key=%s", googleAIBaseURL, settings.AI.Model, settings.AI.APIKey)
+	body, status, errBody, err := a.postAIStreamRequest(ctx, a.aiClient(models.AIProviderGoogle), url, nil, payload)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		var errResp struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(errBody, &errResp)
+		return nil, aiStatusError(status, fmt.Errorf("google AI API error: %s", errResp.Error.Message))
+	}
+	defer func() { _ = body.Close() }()
+
+	completion := &aiCompletion{}
+	var text strings.Builder
+	err = readAIStreamLines(body, func(line []byte) error {
+		var chunk struct {
+			Candidates []struct {
+				Content struct {
+					Parts []struct {
+						Text string `json:"text"`
+					} `json:"parts"`
+				} `json:"content"`
+			} `json:"candidates"`
+			UsageMetadata struct {
+				PromptTokenCount     int `json:"promptTokenCount"`
+				CandidatesTokenCount int `json:"candidatesTokenCount"`
+			} `json:"usageMetadata"`
+		}
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		// Each chunk has the usage so far
+		if chunk.UsageMetadata.PromptTokenCount > 0 {
+			completion.PromptTokens = chunk.UsageMetadata.PromptTokenCount
+			completion.CompletionTokens = chunk.UsageMetadata.CandidatesTokenCount
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			text.WriteString(part.Text)
+			if err := stream.write(ctx, part.Text); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	completion.Text = text.String()
+	return stream.result(completion, err)
+}
+
+// streamOllamaResponse streams a chat response of an Ollama-compatible server to
+// the stream
+func (a *App) streamOllamaResponse(ctx context.Context, stream *aiStream, url string, headers map[string]string, payload map[string]interface{}) (*aiCompletion, error) {
+	payload["stream"] = true
+	body, status, errBody, err := a.postAIStreamRequest(ctx, a.aiClient(models.AIProviderOllama), url, headers, payload)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(errBody, &errResp)
+		return nil, aiStatusError(status, fmt.Errorf("Ollama API error (status %d): %s", status, errResp.Error))
+	}
+	defer func() { _ = body.Close() }()
+
+	completion := &aiCompletion{}
+	var text strings.Builder
+	err = readAIStreamLines(body, func(line []byte) error {
+		var chunk struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			Done            bool   `json:"done"`
+			PromptEvalCount int    `json:"prompt_eval_count"`
+			EvalCount       int    `json:"eval_count"`
+			Error           string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		if chunk.Error != "" {
+			return fmt.Errorf("Ollama API error: %s", chunk.Error)
+		}
+		if chunk.Done {
+			completion.PromptTokens = chunk.PromptEvalCount
+			completion.CompletionTokens = chunk.EvalCount
+		}
+		if chunk.Message.Content == "" {
+			return nil
+		}
+		text.WriteString(chunk.Message.Content)
+		return stream.write(ctx, chunk.Message.Content)
+	})
+	completion.Text = text.String()
+	return stream.result(completion, err)
+}
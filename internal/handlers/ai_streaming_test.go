@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamPart is a part of an answer sent by a test stream
+type streamPart struct {
+	Text string
+	Last bool
+}
+
+// testAIStream returns a stream that records the parts it sends
+func testAIStream(split models.AIStreamSplit) (*aiStream, *[]streamPart) {
+	parts := &[]streamPart{}
+	return &aiStream{
+		split: split,
+		send: func(_ context.Context, text string, last bool) error {
+			*parts = append(*parts, streamPart{Text: text, Last: last})
+			return nil
+		},
+	}, parts
+}
+
+func TestAIStreamCut(t *testing.T) {
+	tests := []struct {
+		text  string
+		split models.AIStreamSplit
+		want  string
+	}{
+		{"First paragraph.\n\nSecond", models.AIStreamSplitParagraph, "First paragraph.\n\n"},
+		{"One sentence. Another", models.AIStreamSplitParagraph, ""},
+		{"One sentence. Another", models.AIStreamSplitSentence, "One sentence."},
+		{"Really? Yes! And", models.AIStreamSplitSentence, "Really? Yes!"},
+		{"Steps:\n1. Open", models.AIStreamSplitSentence, "Steps:\n"},
+		{"It costs 3.50 dollars", models.AIStreamSplitSentence, ""},
+		{"Done.", models.AIStreamSplitSentence, ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.text[:aiStreamCut(tt.text, tt.split)], tt.text)
+	}
+}
+
+func TestAIStream(t *testing.T) {
+	stream, parts := testAIStream(models.AIStreamSplitParagraph)
+	ctx := context.Background()
+	for _, delta := range []string{"Our hours", " are 9 to 5.\n", "\nWe're closed", " on Sundays.\n\nAnything", " else?"} {
+		require.NoError(t, stream.write(ctx, delta))
+	}
+	require.NoError(t, stream.finish(ctx))
+	assert.Equal(t, []streamPart{
+		{Text: "Our hours are 9 to 5."},
+		{Text: "We're closed on Sundays."},
+		{Text: "Anything else?", Last: true},
+	}, *parts)
+
+	// Text generated before the interval passes goes in the next part
+	stream, parts = testAIStream(models.AIStreamSplitSentence)
+	stream.interval = time.Hour
+	require.NoError(t, stream.write(ctx, "One. Two. "))
+	require.NoError(t, stream.write(ctx, "Three. Four"))
+	assert.Equal(t, []streamPart{{Text: "One. Two."}}, *parts)
+
+	// Streams that failed before sending anything can be retried
+	stream, _ = testAIStream(models.AIStreamSplitParagraph)
+	require.NoError(t, stream.write(ctx, "Partial"))
+	_, err := stream.result(&aiCompletion{}, errors.New("connection reset"))
+	assert.False(t, errors.Is(err, errAIStreamInterrupted))
+	assert.Empty(t, stream.pending.String())
+
+	stream, _ = testAIStream(models.AIStreamSplitParagraph)
+	require.NoError(t, stream.write(ctx, "Sent.\n\nPartial"))
+	_, err = stream.result(&aiCompletion{}, errors.New("connection reset"))
+	assert.ErrorIs(t, err, errAIStreamInterrupted)
+	assert.False(t, retryableAIError(err))
+}
+
+func TestNewAIStream(t *testing.T) {
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{Streaming: true, StreamIntervalMs: 500}}
+	require.NotNil(t, app.newAIStream(nil, nil, settings))
+
+	moderated := *settings
+	moderated.AI.ModerationEnabled = true
+	assert.Nil(t, app.newAIStream(nil, nil, &moderated))
+
+	withTools := *settings
+	withTools.AI.OrderLookup = true
+	assert.Nil(t, app.newAIStream(nil, nil, &withTools))
+
+	assert.Nil(t, app.newAIStream(nil, nil, &models.ChatbotSettings{}))
+}
+
+func TestGenerateOpenAIResponseStreamed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{"We open", " at 9.\\n\\nWe close", " at 5."} {
+			_, _ = fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": \"%s\"}}]}\n\n", delta)
+		}
+		_, _ = fmt.Fprint(w, "data: {\"choices\": [], \"usage\": {\"prompt_tokens\": 20, \"completion_tokens\": 9}}\n\n")
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+	orig := openAIChatURL
+	openAIChatURL = server.URL
+	defer func() { openAIChatURL = orig }()
+
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{Provider: models.AIProviderOpenAI, APIKey: "key", Model: "model", MaxTokens: 200}}
+	stream, parts := testAIStream(models.AIStreamSplitParagraph)
+
+	completion, err := app.generateOpenAIResponse(withAIStream(context.Background(), stream), settings, nil, "When do you open?", "")
+	require.NoError(t, err)
+	assert.True(t, completion.Streamed)
+	assert.Equal(t, "We open at 9.\n\nWe close at 5.", completion.Text)
+	assert.Equal(t, 20, completion.PromptTokens)
+	assert.Equal(t, 9, completion.CompletionTokens)
+
+	// The last part is left for the caller to send
+	assert.Equal(t, []streamPart{{Text: "We open at 9."}}, *parts)
+	require.NoError(t, stream.finish(context.Background()))
+	assert.Equal(t, streamPart{Text: "We close at 5.", Last: true}, (*parts)[1])
+}
+
+func TestGenerateAnthropicResponseStreamed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "event: message_start\ndata: {\"type\": \"message_start\", \"message\": {\"usage\": {\"input_tokens\": 15}}}\n\n")
+		_, _ = fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"delta\": {\"type\": \"text_delta\", \"text\": \"Sure. It ships\"}}\n\n")
+		_, _ = fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\": \"content_block_delta\", \"delta\": {\"type\": \"text_delta\", \"text\": \" today.\"}}\n\n")
+		_, _ = fmt.Fprint(w, "event: message_delta\ndata: {\"type\": \"message_delta\", \"usage\": {\"output_tokens\": 6}}\n\n")
+	}))
+	defer server.Close()
+	orig := anthropicMessagesURL
+	anthropicMessagesURL = server.URL
+	defer func() { anthropicMessagesURL = orig }()
+
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{AI: models.AIConfig{Provider: models.AIProviderAnthropic, APIKey: "key", Model: "model", MaxTokens: 200}}
+	stream, parts := testAIStream(models.AIStreamSplitSentence)
+
+	completion, err := app.generateAnthropicResponse(withAIStream(context.Background(), stream), settings, nil, "Is it shipped?", "")
+	require.NoError(t, err)
+	assert.Equal(t, "Sure. It ships today.", completion.Text)
+	assert.Equal(t, 15, completion.PromptTokens)
+	assert.Equal(t, 6, completion.CompletionTokens)
+	assert.Equal(t, []streamPart{{Text: "Sure."}}, *parts)
+}
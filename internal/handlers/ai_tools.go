@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// maxAITools limits the tools an organization can register
+const maxAITools = 10
+
+// maxAIToolRounds limits how many times the AI can call tools before it answers
+const maxAIToolRounds = 5
+
+// maxAIToolResultSize limits the callback response fed back to the AI
+const maxAIToolResultSize = 8 * 1024
+
+// aiToolNamePattern is the tool name format all providers accept
+var aiToolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// AITool is an HTTP callback the AI can call while answering, e.g. to look up an
+// order. Parameters is the JSON schema of the arguments the AI sends.
+type AITool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	URL         string                 `json:"url"`
+	Headers     map[string]string      `json:"headers,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// aiToolCall is a tool call requested by the AI
+type aiToolCall struct {
+	ID        string // The provider's call ID, if it uses one
+	Name      string
+	Arguments json.RawMessage
+}
+
+// aiTools returns the tools configured on the chatbot settings
+func aiTools(settings *models.ChatbotSettings) []AITool {
+	tools := make([]AITool, 0, len(settings.AI.Tools))
+	for _, item := range settings.AI.Tools {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		tool := AITool{
+			Name:        getStringFromMap(m, "name"),
+			Description: getStringFromMap(m, "description"),
+			URL:         getStringFromMap(m, "url"),
+		}
+		if tool.Name == "" || tool.URL == "" {
+			continue
+		}
+		if headers, ok := m["headers"].(map[string]interface{}); ok {
+			tool.Headers = make(map[string]string, len(headers))
+			for key, value := range headers {
+				if strVal, ok := value.(string); ok {
+					tool.Headers[key] = strVal
+				}
+			}
+		}
+		tool.Parameters, _ = m["parameters"].(map[string]interface{})
+		if tool.Parameters == nil {
+			tool.Parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+// availableAITools returns the tools the AI can call: the configured tools and the
+// enabled built-in ones
+func availableAITools(settings *models.ChatbotSettings) []AITool {
+	tools := aiTools(settings)
+	if settings.AI.PaymentLinks {
+		tools = append(tools, paymentLinkTool)
+	}
+	if settings.AI.OrderLookup {
+		tools = append(tools, orderLookupTool)
+	}
+	return tools
+}
+
+// validateAITools checks and normalizes tools before they are saved
+func validateAITools(tools []AITool) ([]interface{}, error) {
+	if len(tools) > maxAITools {
+		return nil, fmt.Errorf("at most %d tools are allowed", maxAITools)
+	}
+	seen := make(map[string]bool, len(tools))
+	items := make([]interface{}, len(tools))
+	for i, tool := range tools {
+		if !aiToolNamePattern.MatchString(tool.Name) {
+			return nil, fmt.Errorf("tool name %q must be 1-64 letters, digits, underscores or hyphens", tool.Name)
+		}
+		if seen[tool.Name] {
+			return nil, fmt.Errorf("duplicate tool name %q", tool.Name)
+		}
+		if tool.Name == paymentLinkToolName || tool.Name == orderLookupToolName {
+			return nil, fmt.Errorf("tool name %q is reserved", tool.Name)
+		}
+		seen[tool.Name] = true
+		if strings.TrimSpace(tool.Description) == "" {
+			return nil, fmt.Errorf("tool %q needs a description so the AI knows when to call it", tool.Name)
+		}
+		if u, err := url.Parse(strings.TrimSpace(tool.URL)); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("tool %q URL must be an http or https URL", tool.Name)
+		}
+		parameters := tool.Parameters
+		if parameters == nil {
+			parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		} else if parameters["type"] != "object" {
+			return nil, fmt.Errorf("tool %q parameters must be a JSON schema of type object", tool.Name)
+		}
+		headers := make(map[string]interface{}, len(tool.Headers))
+		for key, value := range tool.Headers {
+			if key = strings.TrimSpace(key); key != "" {
+				headers[key] = value
+			}
+		}
+		items[i] = map[string]interface{}{
+			"name":        tool.Name,
+			"description": strings.TrimSpace(tool.Description),
+			"url":         strings.TrimSpace(tool.URL),
+			"headers":     headers,
+			"parameters":  parameters,
+		}
+	}
+	return items, nil
+}
+
+// openAIToolDefinitions describes tools in the format of OpenAI and Ollama
+func openAIToolDefinitions(tools []AITool) []map[string]interface{} {
+	definitions := make([]map[string]interface{}, len(tools))
+	for i, tool := range tools {
+		definitions[i] = map[string]interface{}{
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":        tool.Name,
+				"description": tool.Description,
+				"parameters":  tool.Parameters,
+			},
+		}
+	}
+	return definitions
+}
+
+// anthropicToolDefinitions describes tools in the format of Anthropic
+func anthropicToolDefinitions(tools []AITool) []map[string]interface{} {
+	definitions := make([]map[string]interface{}, len(tools))
+	for i, tool := range tools {
+		definitions[i] = map[string]interface{}{
+			"name":         tool.Name,
+			"description":  tool.Description,
+			"input_schema": tool.Parameters,
+		}
+	}
+	return definitions
+}
+
+// googleToolDefinitions describes tools in the format of Google Gemini
+func googleToolDefinitions(tools []AITool) []map[string]interface{} {
+	declarations := make([]map[string]interface{}, len(tools))
+	for i, tool := range tools {
+		declarations[i] = map[string]interface{}{
+			"name":        tool.Name,
+			"description": tool.Description,
+			"parameters":  tool.Parameters,
+		}
+	}
+	return []map[string]interface{}{{"functionDeclarations": declarations}}
+}
+
+// errAIToolRounds is returned when the AI keeps calling tools instead of answering
+var errAIToolRounds = fmt.Errorf("AI was still calling tools after %d rounds", maxAIToolRounds)
+
+// runAITool executes a tool call and returns the result to feed back to the AI.
+// Failures are returned as a JSON error so the AI can tell the customer.
+func (a *App) runAITool(ctx context.Context, tools []AITool, session *models.ChatbotSession, call aiToolCall) string {
+	var tool *AITool
+	for i := range tools {
+		if tools[i].Name == call.Name {
+			tool = &tools[i]
+			break
+		}
+	}
+
+	var result string
+	var err error
+	switch {
+	case tool == nil:
+		err = fmt.Errorf("unknown tool %q", call.Name)
+	case len(call.Arguments) > 0 && !json.Valid(call.Arguments):
+		err = errors.New("arguments are not valid JSON")
+	case tool.URL == "" && tool.Name == paymentLinkToolName:
+		result, err = a.runPaymentLinkTool(ctx, session, call.Arguments)
+	case tool.URL == "" && tool.Name == orderLookupToolName:
+		result, err = a.runOrderLookupTool(ctx, session, call.Arguments)
+	default:
+		result, err = a.callAITool(ctx, tool, session, call.Arguments)
+	}
+
+	if err != nil {
+		a.log(ctx).Warn("AI tool call failed", "error", err, "tool", call.Name)
+		errJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return string(errJSON)
+	}
+	a.log(ctx).Info("AI tool called", "tool", call.Name, "result_length", len(result))
+	return result
+}
+
+// callAITool posts the arguments of a tool call to the tool's URL and returns the response
+func (a *App) callAITool(ctx context.Context, tool *AITool, session *models.ChatbotSession, arguments json.RawMessage) (string, error) {
+	if len(arguments) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	payload := map[string]interface{}{
+		"tool":      tool.Name,
+		"arguments": arguments,
+	}
+	if session != nil {
+		payload["session_id"] = session.ID.String()
+		payload["contact_id"] = session.ContactID.String()
+		payload["phone_number"] = session.PhoneNumber
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", tool.URL, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for key, value := range tool.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := a.httpClient(config.OutboundIntegrations, 15*time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAIToolResultSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("tool returned status %d", resp.StatusCode)
+	}
+
+	result := strings.TrimSpace(string(body))
+	if result == "" {
+		result = `{"status": "ok"}`
+	}
+	return result, nil
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAITools(t *testing.T) {
+	valid := AITool{
+		Name:        "lookup_order",
+		Description: "Look up an order by its number",
+		URL:         " https://shop.example.com/tools/orders ",
+		Headers:     map[string]string{"X-Token": "secret", " ": "dropped"},
+	}
+
+	items, err := validateAITools([]AITool{valid})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	item := items[0].(map[string]interface{})
+	assert.Equal(t, "https://shop.example.com/tools/orders", item["url"])
+	assert.Equal(t, map[string]interface{}{"X-Token": "secret"}, item["headers"])
+	assert.Equal(t, "object", item["parameters"].(map[string]interface{})["type"], "missing parameters default to an empty object")
+
+	tests := []struct {
+		name string
+		tool func(t *AITool)
+		err  string
+	}{
+		{"name", func(t *AITool) { t.Name = "lookup order" }, "must be 1-64 letters"},
+		{"description", func(t *AITool) { t.Description = " " }, "needs a description"},
+		{"url", func(t *AITool) { t.URL = "ftp://shop.example.com" }, "must be an http or https URL"},
+		{"parameters", func(t *AITool) { t.Parameters = map[string]interface{}{"type": "string"} }, "JSON schema of type object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := valid
+			tt.tool(&tool)
+			_, err := validateAITools([]AITool{tool})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	_, err = validateAITools([]AITool{valid, valid})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicate tool name")
+}
+
+// orderTool returns AI settings with a lookup_order tool served by a test server
+func orderTool(t *testing.T, provider models.AIProvider) (*models.ChatbotSettings, *map[string]interface{}) {
+	got := &map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(got))
+		_, _ = w.Write([]byte(`{"order": "1042", "status": "shipped"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return &models.ChatbotSettings{AI: models.AIConfig{
+		Provider:  provider,
+		APIKey:    "key",
+		Model:     "model",
+		MaxTokens: 200,
+		Tools: models.JSONBArray{map[string]interface{}{
+			"name":        "lookup_order",
+			"description": "Look up an order",
+			"url":         server.URL,
+			"headers":     map[string]interface{}{"X-Token": "secret"},
+			"parameters": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"order": map[string]interface{}{"type": "string"}},
+			},
+		}},
+	}}, got
+}
+
+func TestGenerateOpenAIResponseWithTools(t *testing.T) {
+	settings, toolCall := orderTool(t, models.AIProviderOpenAI)
+
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": null, "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "lookup_order", "arguments": "{\"order\": \"1042\"}"}}
+			]}}], "usage": {"prompt_tokens": 50, "completion_tokens": 10}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "Order 1042 has shipped."}}],
+			"usage": {"prompt_tokens": 80, "completion_tokens": 8}}`))
+	}))
+	defer server.Close()
+	orig := openAIChatURL
+	openAIChatURL = server.URL
+	defer func() { openAIChatURL = orig }()
+
+	app := &App{Log: testutil.NopLogger()}
+	session := &models.ChatbotSession{
+		BaseModel:   models.BaseModel{ID: uuid.New()},
+		ContactID:   uuid.New(),
+		PhoneNumber: "15551234567",
+	}
+	completion, err := app.generateOpenAIResponse(context.Background(), settings, session, "Where is order 1042?", "")
+	require.NoError(t, err)
+	assert.Equal(t, "Order 1042 has shipped.", completion.Text)
+	assert.Equal(t, 130, completion.PromptTokens)
+	assert.Equal(t, 18, completion.CompletionTokens)
+
+	// The callback gets the arguments and the conversation
+	assert.Equal(t, "lookup_order", (*toolCall)["tool"])
+	assert.Equal(t, map[string]interface{}{"order": "1042"}, (*toolCall)["arguments"])
+	assert.Equal(t, "15551234567", (*toolCall)["phone_number"])
+
+	// The result is sent back with the tool call
+	require.Len(t, requests, 2)
+	tools := requests[0]["tools"].([]interface{})
+	require.Len(t, tools, 1)
+	assert.Equal(t, "lookup_order", tools[0].(map[string]interface{})["function"].(map[string]interface{})["name"])
+	messages := requests[1]["messages"].([]interface{})
+	result := messages[len(messages)-1].(map[string]interface{})
+	assert.Equal(t, "tool", result["role"])
+	assert.Equal(t, "call_1", result["tool_call_id"])
+	assert.JSONEq(t, `{"order": "1042", "status": "shipped"}`, result["content"].(string))
+	assert.NotNil(t, messages[len(messages)-2].(map[string]interface{})["tool_calls"])
+}
+
+func TestGenerateOpenAIResponseToolRounds(t *testing.T) {
+	settings, _ := orderTool(t, models.AIProviderOpenAI)
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "tool_calls": [
+			{"id": "call", "type": "function", "function": {"name": "unknown_tool", "arguments": "{}"}}
+		]}}]}`))
+	}))
+	defer server.Close()
+	orig := openAIChatURL
+	openAIChatURL = server.URL
+	defer func() { openAIChatURL = orig }()
+
+	app := &App{Log: testutil.NopLogger()}
+	_, err := app.generateOpenAIResponse(context.Background(), settings, nil, "Hi", "")
+	assert.ErrorIs(t, err, errAIToolRounds)
+	assert.Equal(t, maxAIToolRounds+1, calls)
+}
+
+func TestGenerateAnthropicResponseWithTools(t *testing.T) {
+	settings, toolCall := orderTool(t, models.AIProviderAnthropic)
+
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			_, _ = w.Write([]byte(`{"stop_reason": "tool_use", "content": [
+				{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "toolu_1", "name": "lookup_order", "input": {"order": "1042"}}
+			], "usage": {"input_tokens": 40, "output_tokens": 12}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"content": [{"type": "text", "text": "It has shipped."}], "usage": {"input_tokens": 70, "output_tokens": 5}}`))
+	}))
+	defer server.Close()
+	orig := anthropicMessagesURL
+	anthropicMessagesURL = server.URL
+	defer func() { anthropicMessagesURL = orig }()
+
+	app := &App{Log: testutil.NopLogger()}
+	completion, err := app.generateAnthropicResponse(context.Background(), settings, nil, "Where is order 1042?", "")
+	require.NoError(t, err)
+	assert.Equal(t, "It has shipped.", completion.Text)
+	assert.Equal(t, 110, completion.PromptTokens)
+	assert.Equal(t, 17, completion.CompletionTokens)
+	assert.Equal(t, map[string]interface{}{"order": "1042"}, (*toolCall)["arguments"])
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, "Look up an order", requests[0]["tools"].([]interface{})[0].(map[string]interface{})["description"])
+	messages := requests[1]["messages"].([]interface{})
+	require.Len(t, messages, 3)
+	assert.Equal(t, "assistant", messages[1].(map[string]interface{})["role"])
+	results := messages[2].(map[string]interface{})["content"].([]interface{})
+	require.Len(t, results, 1)
+	assert.Equal(t, "toolu_1", results[0].(map[string]interface{})["tool_use_id"])
+}
+
+func TestRunAIToolErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	app := &App{Log: testutil.NopLogger()}
+	tools := []AITool{{Name: "lookup_order", URL: server.URL}}
+
+	assert.JSONEq(t, `{"error": "unknown tool \"cancel_order\""}`, app.runAITool(context.Background(), tools, nil, aiToolCall{Name: "cancel_order"}))
+	assert.JSONEq(t, `{"error": "arguments are not valid JSON"}`, app.runAITool(context.Background(), tools, nil, aiToolCall{Name: "lookup_order", Arguments: json.RawMessage("{")}))
+	assert.JSONEq(t, `{"error": "tool returned status 500"}`, app.runAITool(context.Background(), tools, nil, aiToolCall{Name: "lookup_order"}))
+}
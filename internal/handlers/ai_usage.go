@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// errAITokenQuotaExceeded is returned when the chatbot's monthly token limit is reached
+var errAITokenQuotaExceeded = errors.New("monthly AI token limit reached")
+
+// aiCompletion is an answer from an AI provider with the tokens it used.
+// Providers that don't report usage leave the token counts at zero.
+type aiCompletion struct {
+	Text             string
+	Provider         models.AIProvider
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	// Messages holds a bot's rich messages, sent instead of Text when set
+	Messages []aiBotMessage
+	// CacheKey is where the response is cached once sent, empty when it can't be.
+	// Cached is set for responses read from the cache.
+	CacheKey string
+	Cached   bool
+	// Handoff is set when the AI handed the conversation off to an agent
+	Handoff bool
+	// Streamed is set when the answer was streamed, and only its last part is
+	// left to send
+	Streamed bool
+}
+
+// AIUsageTotals sums the tokens of a set of AI calls
+type AIUsageTotals struct {
+	Calls            int64 `json:"calls"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// AIUsageByModel is the usage of one provider and model
+type AIUsageByModel struct {
+	Provider models.AIProvider `json:"provider"`
+	Model    string            `json:"model"`
+	AIUsageTotals
+}
+
+// AIUsageByDay is the usage of one day
+type AIUsageByDay struct {
+	Date string `json:"date"` // YYYY-MM-DD, UTC
+	AIUsageTotals
+}
+
+// AIUsageSummary is the AI token usage of an organization over a date range,
+// with its usage of the monthly token limit
+type AIUsageSummary struct {
+	From              string           `json:"from"`
+	To                string           `json:"to"`
+	Totals            AIUsageTotals    `json:"totals"`
+	ByModel           []AIUsageByModel `json:"by_model"`
+	ByDay             []AIUsageByDay   `json:"by_day"`
+	Period            string           `json:"period"`
+	PeriodTokens      int64            `json:"period_tokens"`
+	MonthlyTokenLimit int64            `json:"monthly_token_limit"` // 0 is unlimited
+}
+
+// aiTokensUsed returns the prompt and completion tokens the organization used in a period
+func (a *App) aiTokensUsed(orgID uuid.UUID, period string) int64 {
+	var used int64
+	a.DB.Model(&models.AIUsage{}).
+		Where("organization_id = ? AND period = ?", orgID, period).
+		Select("COALESCE(SUM(prompt_tokens + completion_tokens), 0)").
+		Scan(&used)
+	return used
+}
+
+// checkAITokenQuota returns errAITokenQuotaExceeded once the organization has
+// used the chatbot's monthly token limit
+func (a *App) checkAITokenQuota(settings *models.ChatbotSettings) error {
+	if settings.AI.MonthlyTokenLimit <= 0 {
+		return nil
+	}
+	if a.aiTokensUsed(settings.OrganizationID, usagePeriod(models.UsageMetricAICalls, time.Now())) >= settings.AI.MonthlyTokenLimit {
+		return errAITokenQuotaExceeded
+	}
+	return nil
+}
+
+// recordAIUsage stores the tokens used by an AI call
+func (a *App) recordAIUsage(settings *models.ChatbotSettings, session *models.ChatbotSession, completion *aiCompletion) {
+	usage := models.AIUsage{
+		BaseModel:        models.BaseModel{ID: uuid.New()},
+		OrganizationID:   settings.OrganizationID,
+		Period:           usagePeriod(models.UsageMetricAICalls, time.Now()),
+		WhatsAppAccount:  settings.WhatsAppAccount,
+		Provider:         completion.Provider,
+		Model:            completion.Model,
+		PromptTokens:     completion.PromptTokens,
+		CompletionTokens: completion.CompletionTokens,
+	}
+	if session != nil {
+		usage.SessionID = &session.ID
+	}
+	if err := a.DB.Create(&usage).Error; err != nil {
+		a.Log.Error("Failed to record AI usage", "error", err, "organization_id", settings.OrganizationID)
+		return
+	}
+	a.meterUsage(settings.OrganizationID, models.MeterUnitAIPromptTokens, int64(usage.PromptTokens))
+	a.meterUsage(settings.OrganizationID, models.MeterUnitAICompletionTokens, int64(usage.CompletionTokens))
+}
+
+// GetAIUsage returns the AI token usage of the organization over a date range
+func (a *App) GetAIUsage(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceAnalytics, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if v := string(args.Peek("from")); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'from' date format. Use YYYY-MM-DD", nil, "")
+		}
+	}
+	if v := string(args.Peek("to")); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'to' date format. Use YYYY-MM-DD", nil, "")
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	summary, err := a.aiUsageSummary(orgID, from, to)
+	if err != nil {
+		a.Log.Error("Failed to load AI usage", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load AI usage", nil, "")
+	}
+
+	return r.SendEnvelope(summary)
+}
+
+// aiUsageSummary summarizes the AI calls made in [from, to)
+func (a *App) aiUsageSummary(orgID uuid.UUID, from, to time.Time) (*AIUsageSummary, error) {
+	const totals = "COUNT(*) AS calls, COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, " +
+		"COALESCE(SUM(completion_tokens), 0) AS completion_tokens, " +
+		"COALESCE(SUM(prompt_tokens + completion_tokens), 0) AS total_tokens"
+
+	summary := &AIUsageSummary{
+		From:    from.Format("2006-01-02"),
+		To:      to.AddDate(0, 0, -1).Format("2006-01-02"),
+		ByModel: []AIUsageByModel{},
+		ByDay:   []AIUsageByDay{},
+	}
+
+	if err := a.DB.Model(&models.AIUsage{}).
+		Where("organization_id = ? AND created_at >= ? AND created_at < ?", orgID, from, to).
+		Select(totals).
+		Scan(&summary.Totals).Error; err != nil {
+		return nil, err
+	}
+	if err := a.DB.Model(&models.AIUsage{}).
+		Where("organization_id = ? AND created_at >= ? AND created_at < ?", orgID, from, to).
+		Select("provider, model, " + totals).
+		Group("provider, model").
+		Order("total_tokens DESC").
+		Scan(&summary.ByModel).Error; err != nil {
+		return nil, err
+	}
+	if err := a.DB.Model(&models.AIUsage{}).
+		Where("organization_id = ? AND created_at >= ? AND created_at < ?", orgID, from, to).
+		Select("TO_CHAR(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS date, " + totals).
+		Group("date").
+		Order("date").
+		Scan(&summary.ByDay).Error; err != nil {
+		return nil, err
+	}
+
+	summary.Period = usagePeriod(models.UsageMetricAICalls, time.Now())
+	summary.PeriodTokens = a.aiTokensUsed(orgID, summary.Period)
+
+	// The limit of the organization-level settings
+	var settings models.ChatbotSettings
+	if err := a.DB.Where("organization_id = ? AND whats_app_account = ?", orgID, "").First(&settings).Error; err == nil {
+		summary.MonthlyTokenLimit = settings.AI.MonthlyTokenLimit
+	}
+
+	return summary, nil
+}
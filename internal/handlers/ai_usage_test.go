@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAITokenQuota(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "AI Usage Org " + suffix,
+		Slug:      "ai-usage-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+
+	settings := &models.ChatbotSettings{
+		OrganizationID:  org.ID,
+		WhatsAppAccount: "usage-account",
+		AI:              models.AIConfig{MonthlyTokenLimit: 1000},
+	}
+	require.NoError(t, app.checkAITokenQuota(settings))
+
+	app.recordAIUsage(settings, nil, &aiCompletion{Provider: models.AIProviderOpenAI, Model: "gpt-4o-mini", PromptTokens: 600, CompletionTokens: 150})
+	require.NoError(t, app.checkAITokenQuota(settings))
+
+	app.recordAIUsage(settings, nil, &aiCompletion{Provider: models.AIProviderAnthropic, Model: "claude-3-5-haiku-latest", PromptTokens: 200, CompletionTokens: 50})
+	assert.ErrorIs(t, app.checkAITokenQuota(settings), errAITokenQuotaExceeded)
+
+	// Usage from previous months doesn't count
+	require.NoError(t, app.DB.Model(&models.AIUsage{}).Where("organization_id = ?", org.ID).
+		Update("period", time.Now().UTC().AddDate(0, -1, 0).Format("2006-01")).Error)
+	require.NoError(t, app.checkAITokenQuota(settings))
+
+	// No limit
+	settings.AI.MonthlyTokenLimit = 0
+	require.NoError(t, app.checkAITokenQuota(settings))
+
+	summary, err := app.aiUsageSummary(org.ID, time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), summary.Totals.Calls)
+	assert.Equal(t, int64(800), summary.Totals.PromptTokens)
+	assert.Equal(t, int64(200), summary.Totals.CompletionTokens)
+	assert.Equal(t, int64(1000), summary.Totals.TotalTokens)
+	require.Len(t, summary.ByModel, 2)
+	assert.Equal(t, "gpt-4o-mini", summary.ByModel[0].Model)
+	assert.Equal(t, int64(750), summary.ByModel[0].TotalTokens)
+	require.Len(t, summary.ByDay, 1)
+	assert.Equal(t, int64(0), summary.PeriodTokens)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// defaultAIWebhookBody is sent when the webhook provider has no body template
+const defaultAIWebhookBody = `{"sender": "{{sender}}", "message": "{{message}}", "session_id": "{{session_id}}"}`
+
+// aiWebhookPlaceholders lists the variables available in webhook body templates
+var aiWebhookPlaceholders = []string{"sender", "message", "session_id", "contact_id", "context", "system_prompt"}
+
+// renderAIWebhookBody fills the {{placeholders}} of a body template. Values are
+// JSON-escaped, so placeholders belong inside quoted strings.
+func renderAIWebhookBody(template string, vars map[string]string) string {
+	pairs := make([]string, 0, len(vars)*2)
+	for key, value := range vars {
+		escaped, _ := json.Marshal(value)
+		pairs = append(pairs, "{{"+key+"}}", string(escaped[1:len(escaped)-1]))
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// validateAIWebhookBody checks that a body template is valid JSON once filled in
+func validateAIWebhookBody(template string) error {
+	vars := make(map[string]string, len(aiWebhookPlaceholders))
+	for _, key := range aiWebhookPlaceholders {
+		vars[key] = "sample \"value\""
+	}
+	if !json.Valid([]byte(renderAIWebhookBody(template, vars))) {
+		return errors.New("body must be JSON, with placeholders inside quoted strings")
+	}
+	return nil
+}
+
+// extractAIWebhookReply reads the reply from a webhook response. The path uses
+// dot notation with an optional "$." prefix, e.g. "$.responses[0].text"; an
+// empty path takes the whole body as the reply.
+func extractAIWebhookReply(body []byte, path string) (string, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(path), "$"), ".")
+	if path == "" {
+		return strings.TrimSpace(string(body)), nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return "", fmt.Errorf("response is not JSON: %w", err)
+	}
+
+	root, ok := data.(map[string]interface{})
+	if !ok {
+		// Bots such as Rasa answer with a top-level array
+		root = map[string]interface{}{"response": data}
+		if strings.HasPrefix(path, "[") {
+			path = "response" + path
+		} else {
+			path = "response." + path
+		}
+	}
+
+	reply := strings.TrimSpace(formatValue(getNestedValue(root, path)))
+	if reply == "" {
+		return "", fmt.Errorf("no reply found at %q", path)
+	}
+	return reply, nil
+}
+
+// generateWebhookResponse posts the message to the organization's own bot and
+// reads the reply from its response
+func (a *App) generateWebhookResponse(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) (*aiCompletion, error) {
+	if settings.AI.BaseURL == "" {
+		return nil, errors.New("webhook URL is not configured")
+	}
+
+	vars := map[string]string{
+		"message":       userMessage,
+		"context":       contextData,
+		"system_prompt": settings.AI.SystemPrompt,
+	}
+	if session != nil {
+		vars["sender"] = session.PhoneNumber
+		vars["session_id"] = session.ID.String()
+		vars["contact_id"] = session.ContactID.String()
+	}
+
+	template := settings.AI.WebhookBody
+	if strings.TrimSpace(template) == "" {
+		template = defaultAIWebhookBody
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, settings.AI.BaseURL, strings.NewReader(renderAIWebhookBody(template, vars)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if settings.AI.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+settings.AI.APIKey)
+	}
+	for key, value := range settings.AI.WebhookHeaders {
+		if strVal, ok := value.(string); ok {
+			req.Header.Set(key, strVal)
+		}
+	}
+
+	resp, err := a.aiClient(models.AIProviderWebhook).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Limit to 1MB like other integration responses
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, aiStatusError(resp.StatusCode, fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, string(body)))
+	}
+
+	// Rasa answers with a list of messages that can have buttons and media
+	if messages, ok := parseAIBotMessages(body, settings.AI.WebhookResponsePath); ok {
+		return &aiCompletion{Text: aiBotMessagesText(messages), Messages: messages}, nil
+	}
+
+	reply, err := extractAIWebhookReply(body, settings.AI.WebhookResponsePath)
+	if err != nil {
+		return nil, err
+	}
+	// Webhooks don't report token usage
+	return &aiCompletion{Text: reply}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
 )
 
 // DashboardStats represents dashboard statistics
@@ -30,6 +31,26 @@ type RecentMessageResponse struct {
 	Status      models.MessageStatus `json:"status"`
 }
 
+// MessageAnalyticsSummary represents message totals for a period
+type MessageAnalyticsSummary struct {
+	TotalSent      int64   `json:"total_sent"`
+	TotalReceived  int64   `json:"total_received"`
+	TotalDelivered int64   `json:"total_delivered"`
+	TotalRead      int64   `json:"total_read"`
+	TotalFailed    int64   `json:"total_failed"`
+	DeliveryRate   float64 `json:"delivery_rate"`
+	ReadRate       float64 `json:"read_rate"`
+}
+
+// MessageTimelinePoint represents message counts for one time bucket
+type MessageTimelinePoint struct {
+	Date      string `json:"date"`
+	Sent      int64  `json:"sent"`
+	Received  int64  `json:"received"`
+	Delivered int64  `json:"delivered"`
+	Read      int64  `json:"read"`
+}
+
 // GetDashboardStats returns dashboard statistics for the organization
 func (a *App) GetDashboardStats(r *fastglue.Request) error {
 	orgID, err := a.getOrgIDFromContext(r)
@@ -69,11 +90,11 @@ func (a *App) GetDashboardStats(r *fastglue.Request) error {
 
 	// Get message counts for the selected period
 	var previousPeriodMessages, currentPeriodMessages int64
-	a.DB.Model(&models.Message{}).
+	a.replicaDB().Model(&models.Message{}).
 		Where("organization_id = ? AND created_at >= ? AND created_at <= ?", orgID, previousPeriodStart, previousPeriodEnd).
 		Count(&previousPeriodMessages)
 
-	a.DB.Model(&models.Message{}).
+	a.replicaDB().Model(&models.Message{}).
 		Where("organization_id = ? AND created_at >= ? AND created_at <= ?", orgID, periodStart, periodEnd).
 		Count(&currentPeriodMessages)
 
@@ -81,11 +102,11 @@ func (a *App) GetDashboardStats(r *fastglue.Request) error {
 
 	// Get contact counts for the selected period
 	var previousPeriodContacts, currentPeriodContacts int64
-	a.DB.Model(&models.Contact{}).
+	a.replicaDB().Model(&models.Contact{}).
 		Where("organization_id = ? AND created_at >= ? AND created_at <= ?", orgID, previousPeriodStart, previousPeriodEnd).
 		Count(&previousPeriodContacts)
 
-	a.DB.Model(&models.Contact{}).
+	a.replicaDB().Model(&models.Contact{}).
 		Where("organization_id = ? AND created_at >= ? AND created_at <= ?", orgID, periodStart, periodEnd).
 		Count(&currentPeriodContacts)
 
@@ -93,11 +114,11 @@ func (a *App) GetDashboardStats(r *fastglue.Request) error {
 
 	// Get chatbot session counts for the selected period
 	var previousPeriodSessions, currentPeriodSessions int64
-	a.DB.Model(&models.ChatbotSession{}).
+	a.replicaDB().Model(&models.ChatbotSession{}).
 		Where("organization_id = ? AND created_at >= ? AND created_at <= ?", orgID, previousPeriodStart, previousPeriodEnd).
 		Count(&previousPeriodSessions)
 
-	a.DB.Model(&models.ChatbotSession{}).
+	a.replicaDB().Model(&models.ChatbotSession{}).
 		Where("organization_id = ? AND created_at >= ? AND created_at <= ?", orgID, periodStart, periodEnd).
 		Count(&currentPeriodSessions)
 
@@ -105,11 +126,11 @@ func (a *App) GetDashboardStats(r *fastglue.Request) error {
 
 	// Get campaign counts for the selected period
 	var previousPeriodCampaigns, currentPeriodCampaigns int64
-	a.DB.Model(&models.BulkMessageCampaign{}).
+	a.replicaDB().Model(&models.BulkMessageCampaign{}).
 		Where("organization_id = ? AND status IN ('completed', 'processing') AND created_at >= ? AND created_at <= ?", orgID, previousPeriodStart, previousPeriodEnd).
 		Count(&previousPeriodCampaigns)
 
-	a.DB.Model(&models.BulkMessageCampaign{}).
+	a.replicaDB().Model(&models.BulkMessageCampaign{}).
 		Where("organization_id = ? AND status IN ('completed', 'processing') AND created_at >= ? AND created_at <= ?", orgID, periodStart, periodEnd).
 		Count(&currentPeriodCampaigns)
 
@@ -128,7 +149,7 @@ func (a *App) GetDashboardStats(r *fastglue.Request) error {
 
 	// Get recent messages
 	var messages []models.Message
-	a.DB.Where("organization_id = ?", orgID).
+	a.replicaDB().Where("organization_id = ?", orgID).
 		Preload("Contact").
 		Order("created_at DESC").
 		Limit(5).
@@ -166,6 +187,211 @@ func (a *App) GetDashboardStats(r *fastglue.Request) error {
 	})
 }
 
+// GetMessageAnalytics returns message totals, counts by type and a timeline for the organization.
+// Timeline buckets and the received-by-hour breakdown use each contact's local time by default
+// (timezone=contact), or the organization's timezone (timezone=organization) or any IANA name.
+func (a *App) GetMessageAnalytics(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	fromStr := string(args.Peek("from"))
+	toStr := string(args.Peek("to"))
+	account := string(args.Peek("account"))
+
+	groupBy := string(args.Peek("group_by"))
+	if groupBy == "" {
+		groupBy = "day"
+	}
+	dateTrunc, dateFormat, ok := messageAnalyticsBucket(groupBy)
+	if !ok {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid group_by. Use hour, day, week or month", nil, "")
+	}
+
+	now := time.Now()
+	var periodStart, periodEnd time.Time
+	if fromStr != "" && toStr != "" {
+		periodStart, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'from' date format. Use YYYY-MM-DD", nil, "")
+		}
+		periodEnd, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'to' date format. Use YYYY-MM-DD", nil, "")
+		}
+		periodEnd = periodEnd.Add(24*time.Hour - time.Nanosecond)
+	} else {
+		// Default to the last 30 days
+		periodStart = now.AddDate(0, 0, -30)
+		periodEnd = now
+	}
+
+	// Local time expression the timeline is bucketed in
+	orgTimezone := "UTC"
+	if loc := a.getOrgLocation(orgID); loc != nil {
+		orgTimezone = loc.String()
+	}
+	var tzExpr string
+	var tzArg string
+	switch timezone := string(args.Peek("timezone")); timezone {
+	case "", "contact":
+		tzExpr = "COALESCE(NULLIF(contacts.timezone, ''), ?)"
+		tzArg = orgTimezone
+	case "organization":
+		tzExpr = "?"
+		tzArg = orgTimezone
+	default:
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid timezone", nil, "")
+		}
+		tzExpr = "?"
+		tzArg = timezone
+	}
+	localTime := "messages.created_at AT TIME ZONE " + tzExpr
+
+	base := func() *gorm.DB {
+		query := a.replicaDB().Model(&models.Message{}).
+			Joins("JOIN contacts ON contacts.id = messages.contact_id").
+			Where("messages.organization_id = ? AND messages.created_at >= ? AND messages.created_at <= ?", orgID, periodStart, periodEnd)
+		if account != "" {
+			query = query.Where("messages.whats_app_account = ?", account)
+		}
+		return query
+	}
+
+	// Summary
+	type statusCount struct {
+		Direction models.Direction
+		Status    models.MessageStatus
+		Count     int64
+	}
+	var statusCounts []statusCount
+	if err := base().Select("messages.direction, messages.status, COUNT(*) as count").
+		Group("messages.direction, messages.status").
+		Scan(&statusCounts).Error; err != nil {
+		a.Log.Error("Failed to load message analytics", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load message analytics", nil, "")
+	}
+	var summary MessageAnalyticsSummary
+	for _, sc := range statusCounts {
+		if sc.Direction == models.DirectionIncoming {
+			summary.TotalReceived += sc.Count
+			continue
+		}
+		summary.TotalSent += sc.Count
+		switch sc.Status {
+		case models.MessageStatusDelivered:
+			summary.TotalDelivered += sc.Count
+		case models.MessageStatusRead:
+			// Read messages were delivered too
+			summary.TotalDelivered += sc.Count
+			summary.TotalRead += sc.Count
+		case models.MessageStatusFailed:
+			summary.TotalFailed += sc.Count
+		}
+	}
+	if summary.TotalSent > 0 {
+		summary.DeliveryRate = float64(summary.TotalDelivered) / float64(summary.TotalSent) * 100.0
+		summary.ReadRate = float64(summary.TotalRead) / float64(summary.TotalSent) * 100.0
+	}
+
+	// By message type
+	type typeCount struct {
+		MessageType string
+		Count       int64
+	}
+	var typeCounts []typeCount
+	if err := base().Select("messages.message_type, COUNT(*) as count").
+		Group("messages.message_type").
+		Scan(&typeCounts).Error; err != nil {
+		a.Log.Error("Failed to load message analytics", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load message analytics", nil, "")
+	}
+	byType := make(map[string]int64, len(typeCounts))
+	for _, tc := range typeCounts {
+		byType[tc.MessageType] = tc.Count
+	}
+
+	// Timeline, bucketed in local time
+	type timelineRow struct {
+		Bucket    time.Time
+		Sent      int64
+		Received  int64
+		Delivered int64
+		ReadCount int64
+	}
+	var rows []timelineRow
+	if err := base().Select("DATE_TRUNC('"+dateTrunc+"', "+localTime+") as bucket, "+
+		"SUM(CASE WHEN messages.direction = ? THEN 1 ELSE 0 END) as sent, "+
+		"SUM(CASE WHEN messages.direction = ? THEN 1 ELSE 0 END) as received, "+
+		"SUM(CASE WHEN messages.direction = ? AND messages.status IN ? THEN 1 ELSE 0 END) as delivered, "+
+		"SUM(CASE WHEN messages.direction = ? AND messages.status = ? THEN 1 ELSE 0 END) as read_count",
+		tzArg,
+		models.DirectionOutgoing, models.DirectionIncoming,
+		models.DirectionOutgoing, []models.MessageStatus{models.MessageStatusDelivered, models.MessageStatusRead},
+		models.DirectionOutgoing, models.MessageStatusRead).
+		Group("1").
+		Order("1 ASC").
+		Scan(&rows).Error; err != nil {
+		a.Log.Error("Failed to load message analytics", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load message analytics", nil, "")
+	}
+	timeline := make([]MessageTimelinePoint, len(rows))
+	for i, row := range rows {
+		timeline[i] = MessageTimelinePoint{
+			Date:      row.Bucket.Format(dateFormat),
+			Sent:      row.Sent,
+			Received:  row.Received,
+			Delivered: row.Delivered,
+			Read:      row.ReadCount,
+		}
+	}
+
+	// Received messages by local hour of day
+	type hourCount struct {
+		Hour  int
+		Count int64
+	}
+	var hourCounts []hourCount
+	if err := base().Select("EXTRACT(HOUR FROM "+localTime+")::int as hour, COUNT(*) as count", tzArg).
+		Where("messages.direction = ?", models.DirectionIncoming).
+		Group("1").
+		Scan(&hourCounts).Error; err != nil {
+		a.Log.Error("Failed to load message analytics", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load message analytics", nil, "")
+	}
+	byLocalHour := make([]int64, 24)
+	for _, hc := range hourCounts {
+		if hc.Hour >= 0 && hc.Hour < 24 {
+			byLocalHour[hc.Hour] = hc.Count
+		}
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"summary":       summary,
+		"by_type":       byType,
+		"timeline":      timeline,
+		"by_local_hour": byLocalHour,
+	})
+}
+
+// messageAnalyticsBucket returns the DATE_TRUNC unit and the date format of a group_by value
+func messageAnalyticsBucket(groupBy string) (string, string, bool) {
+	switch groupBy {
+	case "hour":
+		return "hour", "2006-01-02T15:00", true
+	case "day":
+		return "day", "2006-01-02", true
+	case "week":
+		return "week", "2006-01-02", true
+	case "month":
+		return "month", "2006-01", true
+	}
+	return "", "", false
+}
+
 // calculatePercentageChange calculates the percentage change between two values
 func calculatePercentageChange(previous, current int64) float64 {
 	if previous == 0 {
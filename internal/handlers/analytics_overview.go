@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// AnalyticsOverviewPoint is an organization's or an agent's activity over a day, a
+// week or the whole period
+type AnalyticsOverviewPoint struct {
+	Date string `json:"date,omitempty"`
+
+	MessagesReceived  int64 `json:"messages_received"`
+	MessagesSent      int64 `json:"messages_sent"`
+	BotMessagesSent   int64 `json:"bot_messages_sent"`
+	AgentMessagesSent int64 `json:"agent_messages_sent"`
+	NewContacts       int64 `json:"new_contacts"`
+	ReturningContacts int64 `json:"returning_contacts"`
+
+	BotReplies              int64   `json:"bot_replies"`
+	BotResponseMedianSecs   float64 `json:"bot_response_median_secs"`
+	AgentReplies            int64   `json:"agent_replies"`
+	AgentResponseMedianSecs float64 `json:"agent_response_median_secs"`
+
+	ChatbotSessions   int64   `json:"chatbot_sessions"`
+	AIResponses       int64   `json:"ai_responses"`
+	FallbackResponses int64   `json:"fallback_responses"`
+	AIFallbackRate    float64 `json:"ai_fallback_rate"` // Share of the bot's answers that were the fallback message
+	Handoffs          int64   `json:"handoffs"`
+	HandoffRate       float64 `json:"handoff_rate"` // Handoffs per chatbot session
+
+	CampaignSent         int64   `json:"campaign_sent"`
+	CampaignDelivered    int64   `json:"campaign_delivered"`
+	CampaignRead         int64   `json:"campaign_read"`
+	CampaignFailed       int64   `json:"campaign_failed"`
+	CampaignDeliveryRate float64 `json:"campaign_delivery_rate"`
+	CampaignReadRate     float64 `json:"campaign_read_rate"`
+}
+
+// AgentOverview is an agent's activity over the period
+type AgentOverview struct {
+	AgentID            string  `json:"agent_id"`
+	AgentName          string  `json:"agent_name"`
+	MessagesSent       int64   `json:"messages_sent"`
+	Replies            int64   `json:"replies"`
+	ResponseMedianSecs float64 `json:"response_median_secs"`
+	TransfersAssigned  int64   `json:"transfers_assigned"`
+}
+
+// GetAnalyticsOverview returns message volume, contacts, bot and agent response
+// times, AI fallback and handoff rates, and campaign performance, by day or week,
+// from the daily rollups. Users without analytics permission see their own activity.
+func (a *App) GetAnalyticsOverview(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	args := r.RequestCtx.QueryArgs()
+	groupBy := string(args.Peek("group_by"))
+	if groupBy == "" {
+		groupBy = "day"
+	}
+	if groupBy != "day" && groupBy != "week" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid group_by. Use day or week", nil, "")
+	}
+
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	from := to.AddDate(0, 0, -29)
+	if v := string(args.Peek("from")); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'from' date format. Use YYYY-MM-DD", nil, "")
+		}
+	}
+	if v := string(args.Peek("to")); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'to' date format. Use YYYY-MM-DD", nil, "")
+		}
+	}
+	if to.Before(from) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "'to' must not be before 'from'", nil, "")
+	}
+
+	// The organization's totals, or one agent's activity
+	subject := uuid.Nil
+	canViewAll := a.HasPermission(userID, models.ResourceAnalytics, models.ActionRead)
+	if !canViewAll {
+		subject = userID
+	} else if v := string(args.Peek("agent_id")); v != "" {
+		if subject, err = uuid.Parse(v); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid agent_id", nil, "")
+		}
+	}
+
+	var rows []models.AnalyticsDaily
+	if err := a.replicaDB().Where("organization_id = ? AND user_id = ? AND day >= ? AND day <= ?", orgID, subject, from, to).
+		Order("day ASC").
+		Find(&rows).Error; err != nil {
+		a.Log.Error("Failed to load analytics overview", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load analytics", nil, "")
+	}
+
+	response := map[string]interface{}{
+		"from":     from.Format("2006-01-02"),
+		"to":       to.Format("2006-01-02"),
+		"group_by": groupBy,
+		"summary":  summarizeAnalytics("", rows),
+		"timeline": analyticsTimeline(rows, groupBy),
+	}
+	if canViewAll && subject == uuid.Nil {
+		agents, err := a.analyticsAgentOverviews(orgID, from, to)
+		if err != nil {
+			a.Log.Error("Failed to load agent analytics overview", "error", err)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load analytics", nil, "")
+		}
+		response["agents"] = agents
+	}
+	return r.SendEnvelope(response)
+}
+
+// analyticsTimeline sums daily rollups, sorted by day, into day or week buckets.
+// Weeks start on Monday.
+func analyticsTimeline(rows []models.AnalyticsDaily, groupBy string) []AnalyticsOverviewPoint {
+	timeline := []AnalyticsOverviewPoint{}
+	var bucket []models.AnalyticsDaily
+	var bucketStart time.Time
+	for _, row := range rows {
+		start := row.Day.UTC()
+		if groupBy == "week" {
+			start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+		}
+		if len(bucket) > 0 && !start.Equal(bucketStart) {
+			timeline = append(timeline, summarizeAnalytics(bucketStart.Format("2006-01-02"), bucket))
+			bucket = nil
+		}
+		bucketStart = start
+		bucket = append(bucket, row)
+	}
+	if len(bucket) > 0 {
+		timeline = append(timeline, summarizeAnalytics(bucketStart.Format("2006-01-02"), bucket))
+	}
+	return timeline
+}
+
+// summarizeAnalytics sums daily rollups and computes their rates. Medians over
+// several days are the average of the daily medians, weighted by replies.
+func summarizeAnalytics(date string, rows []models.AnalyticsDaily) AnalyticsOverviewPoint {
+	point := AnalyticsOverviewPoint{Date: date}
+	var botSecs, agentSecs float64
+	for _, row := range rows {
+		point.MessagesReceived += row.MessagesReceived
+		point.MessagesSent += row.MessagesSent
+		point.BotMessagesSent += row.BotMessagesSent
+		point.AgentMessagesSent += row.AgentMessagesSent
+		point.NewContacts += row.NewContacts
+		point.ReturningContacts += row.ReturningContacts
+		point.BotReplies += row.BotReplies
+		botSecs += row.BotResponseMedianSecs * float64(row.BotReplies)
+		point.AgentReplies += row.AgentReplies
+		agentSecs += row.AgentResponseMedianSecs * float64(row.AgentReplies)
+		point.ChatbotSessions += row.ChatbotSessions
+		point.AIResponses += row.AIResponses
+		point.FallbackResponses += row.FallbackResponses
+		point.Handoffs += row.Handoffs
+		point.CampaignSent += row.CampaignSent
+		point.CampaignDelivered += row.CampaignDelivered
+		point.CampaignRead += row.CampaignRead
+		point.CampaignFailed += row.CampaignFailed
+	}
+
+	if point.BotReplies > 0 {
+		point.BotResponseMedianSecs = botSecs / float64(point.BotReplies)
+	}
+	if point.AgentReplies > 0 {
+		point.AgentResponseMedianSecs = agentSecs / float64(point.AgentReplies)
+	}
+	if answers := point.AIResponses + point.FallbackResponses; answers > 0 {
+		point.AIFallbackRate = float64(point.FallbackResponses) / float64(answers)
+	}
+	if point.ChatbotSessions > 0 {
+		point.HandoffRate = float64(point.Handoffs) / float64(point.ChatbotSessions)
+	}
+	if point.CampaignSent > 0 {
+		point.CampaignDeliveryRate = float64(point.CampaignDelivered) / float64(point.CampaignSent)
+		point.CampaignReadRate = float64(point.CampaignRead) / float64(point.CampaignSent)
+	}
+	return point
+}
+
+// analyticsAgentOverviews returns each agent's activity over [from, to], busiest first
+func (a *App) analyticsAgentOverviews(orgID uuid.UUID, from, to time.Time) ([]AgentOverview, error) {
+	var rows []models.AnalyticsDaily
+	if err := a.replicaDB().Where("organization_id = ? AND user_id <> ? AND day >= ? AND day <= ?", orgID, uuid.Nil, from, to).
+		Order("day ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	byAgent := map[uuid.UUID][]models.AnalyticsDaily{}
+	var agentIDs []uuid.UUID
+	for _, row := range rows {
+		if _, ok := byAgent[row.UserID]; !ok {
+			agentIDs = append(agentIDs, row.UserID)
+		}
+		byAgent[row.UserID] = append(byAgent[row.UserID], row)
+	}
+
+	names := map[uuid.UUID]string{}
+	if len(agentIDs) > 0 {
+		var users []models.User
+		if err := a.replicaDB().Unscoped().Select("id", "full_name").Where("id IN ?", agentIDs).Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			names[u.ID] = u.FullName
+		}
+	}
+
+	agents := make([]AgentOverview, 0, len(agentIDs))
+	for _, id := range agentIDs {
+		point := summarizeAnalytics("", byAgent[id])
+		agents = append(agents, AgentOverview{
+			AgentID:            id.String(),
+			AgentName:          names[id],
+			MessagesSent:       point.MessagesSent,
+			Replies:            point.AgentReplies,
+			ResponseMedianSecs: point.AgentResponseMedianSecs,
+			TransfersAssigned:  point.Handoffs,
+		})
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].MessagesSent > agents[j].MessagesSent
+	})
+	return agents, nil
+}
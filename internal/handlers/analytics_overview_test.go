@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMedian(t *testing.T) {
+	assert.Zero(t, median(nil))
+	assert.Equal(t, 5.0, median([]float64{9, 5, 1}))
+	assert.Equal(t, 4.0, median([]float64{6, 2, 1, 9}))
+}
+
+func TestSummarizeAnalytics(t *testing.T) {
+	rows := []models.AnalyticsDaily{
+		{MessagesReceived: 10, BotReplies: 3, BotResponseMedianSecs: 2, AgentReplies: 1, AgentResponseMedianSecs: 600,
+			ChatbotSessions: 4, AIResponses: 6, FallbackResponses: 2, Handoffs: 1,
+			CampaignSent: 100, CampaignDelivered: 90, CampaignRead: 45},
+		{MessagesReceived: 5, BotReplies: 1, BotResponseMedianSecs: 6, AgentReplies: 3, AgentResponseMedianSecs: 200,
+			ChatbotSessions: 6, AIResponses: 2, Handoffs: 1},
+	}
+
+	point := summarizeAnalytics("", rows)
+	assert.Equal(t, int64(15), point.MessagesReceived)
+	assert.Equal(t, int64(4), point.BotReplies)
+	assert.Equal(t, 3.0, point.BotResponseMedianSecs, "daily medians are weighted by replies")
+	assert.Equal(t, 300.0, point.AgentResponseMedianSecs)
+	assert.Equal(t, 0.2, point.AIFallbackRate)
+	assert.Equal(t, 0.2, point.HandoffRate)
+	assert.Equal(t, 0.9, point.CampaignDeliveryRate)
+	assert.Equal(t, 0.45, point.CampaignReadRate)
+
+	empty := summarizeAnalytics("", nil)
+	assert.Zero(t, empty.HandoffRate)
+	assert.Zero(t, empty.BotResponseMedianSecs)
+}
+
+func TestAnalyticsTimeline(t *testing.T) {
+	day := func(date string, received int64) models.AnalyticsDaily {
+		d, _ := time.Parse("2006-01-02", date)
+		return models.AnalyticsDaily{Day: d, MessagesReceived: received}
+	}
+	// Monday, Sunday of the same week, and the next Monday
+	rows := []models.AnalyticsDaily{day("2026-10-05", 1), day("2026-10-11", 2), day("2026-10-12", 4)}
+
+	daily := analyticsTimeline(rows, "day")
+	require.Len(t, daily, 3)
+	assert.Equal(t, "2026-10-11", daily[1].Date)
+
+	weekly := analyticsTimeline(rows, "week")
+	require.Len(t, weekly, 2)
+	assert.Equal(t, "2026-10-05", weekly[0].Date)
+	assert.Equal(t, int64(3), weekly[0].MessagesReceived)
+	assert.Equal(t, "2026-10-12", weekly[1].Date)
+	assert.Equal(t, int64(4), weekly[1].MessagesReceived)
+
+	assert.Empty(t, analyticsTimeline(nil, "day"))
+}
+
+func TestRollUpAnalyticsDay(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Analytics Org " + uuid.New().String()[:8],
+		Slug:      "analytics-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	agent := &models.User{
+		OrganizationID: org.ID,
+		Email:          "agent-" + uuid.New().String()[:8] + "@example.com",
+		FullName:       "Sam Agent",
+	}
+	require.NoError(t, app.DB.Create(agent).Error)
+	newContact := &models.Contact{BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: org.ID, PhoneNumber: "1555" + uuid.New().String()[:7]}
+	returning := &models.Contact{BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: org.ID, PhoneNumber: "1555" + uuid.New().String()[:7]}
+	require.NoError(t, app.DB.Create(newContact).Error)
+	require.NoError(t, app.DB.Create(returning).Error)
+
+	day := time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC)
+	message := func(contact *models.Contact, direction models.Direction, at time.Time, sentBy *uuid.UUID) {
+		require.NoError(t, app.DB.Create(&models.Message{
+			BaseModel:       models.BaseModel{ID: uuid.New(), CreatedAt: at},
+			OrganizationID:  org.ID,
+			WhatsAppAccount: "support",
+			ContactID:       contact.ID,
+			Direction:       direction,
+			MessageType:     models.MessageTypeText,
+			SentByUserID:    sentBy,
+		}).Error)
+	}
+	// The returning contact wrote the day before
+	message(returning, models.DirectionIncoming, day.Add(-2*time.Hour), nil)
+	// The bot answers the new contact in 30s, and the agent answers two messages after 5 minutes
+	message(newContact, models.DirectionIncoming, day.Add(10*time.Hour), nil)
+	message(newContact, models.DirectionOutgoing, day.Add(10*time.Hour+30*time.Second), nil)
+	message(newContact, models.DirectionIncoming, day.Add(11*time.Hour), nil)
+	message(newContact, models.DirectionIncoming, day.Add(11*time.Hour+time.Minute), nil)
+	message(newContact, models.DirectionOutgoing, day.Add(11*time.Hour+5*time.Minute), &agent.ID)
+	// The agent answers the returning contact's message of the day before, after 3 hours
+	message(returning, models.DirectionIncoming, day.Add(9*time.Hour), nil)
+	message(returning, models.DirectionOutgoing, day.Add(time.Hour), &agent.ID)
+
+	require.NoError(t, app.rollUpAnalyticsDay(org.ID, day))
+	// Rolling up again replaces the day's rows
+	require.NoError(t, app.rollUpAnalyticsDay(org.ID, day.Add(12*time.Hour)))
+
+	var rows []models.AnalyticsDaily
+	require.NoError(t, app.DB.Where("organization_id = ?", org.ID).Order("user_id").Find(&rows).Error)
+	require.Len(t, rows, 2)
+	totals, agentRow := rows[0], rows[1]
+	assert.Equal(t, uuid.Nil, totals.UserID)
+	assert.Equal(t, int64(4), totals.MessagesReceived)
+	assert.Equal(t, int64(3), totals.MessagesSent)
+	assert.Equal(t, int64(1), totals.BotMessagesSent)
+	assert.Equal(t, int64(2), totals.AgentMessagesSent)
+	assert.Equal(t, int64(1), totals.NewContacts)
+	assert.Equal(t, int64(1), totals.ReturningContacts)
+	assert.Equal(t, int64(1), totals.BotReplies)
+	assert.Equal(t, 30.0, totals.BotResponseMedianSecs)
+	assert.Equal(t, int64(2), totals.AgentReplies)
+	assert.Equal(t, (5*60.0+3*3600.0)/2, totals.AgentResponseMedianSecs)
+
+	assert.Equal(t, agent.ID, agentRow.UserID)
+	assert.Equal(t, int64(2), agentRow.MessagesSent)
+	assert.Equal(t, int64(2), agentRow.AgentReplies)
+}
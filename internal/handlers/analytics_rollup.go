@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// analyticsBackfillDays is how far back an organization without rollups is rolled up
+	analyticsBackfillDays = 90
+	// analyticsSettleDays is how long a day keeps being rolled up after it ends, so
+	// late replies and delivery and read receipts are counted
+	analyticsSettleDays = 3
+	// analyticsReplyLookback is how far back the unanswered messages of a reply are found
+	analyticsReplyLookback = 7 * 24 * time.Hour
+)
+
+// analyticsResponseTimes returns how long each reply sent over a period took, from
+// the contact's first message since the previous reply. Campaign and template
+// messages aren't replies, though they end the wait.
+const analyticsResponseTimes = `WITH thread AS (
+	SELECT contact_id, direction, created_at, sent_by_user_id, message_type, metadata,
+		COUNT(*) FILTER (WHERE direction = 'outgoing') OVER (PARTITION BY contact_id ORDER BY created_at
+			ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING) AS replies_before
+	FROM messages
+	WHERE organization_id = ? AND created_at >= ? AND created_at < ? AND deleted_at IS NULL
+), waiting AS (
+	SELECT contact_id, replies_before, MIN(created_at) AS since
+	FROM thread
+	WHERE direction = 'incoming'
+	GROUP BY contact_id, replies_before
+)
+SELECT t.sent_by_user_id AS user_id, EXTRACT(EPOCH FROM t.created_at - w.since) AS secs
+FROM thread t
+JOIN waiting w ON w.contact_id = t.contact_id AND w.replies_before = t.replies_before
+WHERE t.direction = 'outgoing' AND t.created_at >= ?
+	AND t.message_type <> 'template' AND t.metadata->>'campaign_id' IS NULL`
+
+// AnalyticsProcessor rolls up each organization's recent days into analytics_daily
+type AnalyticsProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewAnalyticsProcessor creates a new analytics processor
+func NewAnalyticsProcessor(app *App, interval time.Duration) *AnalyticsProcessor {
+	return &AnalyticsProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the analytics rollup loop
+func (p *AnalyticsProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Analytics processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	// Catch up on days missed while the server was down
+	p.rollUp(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Analytics processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Analytics processor stopped")
+			return
+		case <-ticker.C:
+			p.rollUp(ctx)
+		}
+	}
+}
+
+// Stop stops the analytics processor
+func (p *AnalyticsProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// rollUp rolls up the days of each organization that may have changed since the
+// last run: today, the days still settling, and any missed
+func (p *AnalyticsProcessor) rollUp(ctx context.Context) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	var orgs []models.Organization
+	if err := p.app.DB.Select("id", "created_at").Find(&orgs).Error; err != nil {
+		p.app.Log.Error("Failed to load organizations for analytics", "error", err)
+		return
+	}
+
+	for _, org := range orgs {
+		for day := p.app.analyticsRollupStart(org, today); !day.After(today); day = day.AddDate(0, 0, 1) {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := p.app.rollUpAnalyticsDay(org.ID, day); err != nil {
+				p.app.Log.Error("Failed to roll up analytics", "error", err, "org_id", org.ID, "day", day.Format("2006-01-02"))
+				break
+			}
+		}
+	}
+}
+
+// analyticsRollupStart returns the first day of an organization to roll up: the
+// oldest day still settling, or the backfill period when it has no rollups yet
+func (a *App) analyticsRollupStart(org models.Organization, today time.Time) time.Time {
+	var last sql.NullTime
+	_ = a.DB.Model(&models.AnalyticsDaily{}).
+		Where("organization_id = ?", org.ID).
+		Select("MAX(day)").
+		Row().Scan(&last)
+	if last.Valid {
+		start := last.Time.UTC().Truncate(24*time.Hour).AddDate(0, 0, -analyticsSettleDays)
+		if start.After(today) {
+			return today
+		}
+		return start
+	}
+
+	start := today.AddDate(0, 0, -analyticsBackfillDays)
+	if created := org.CreatedAt.UTC().Truncate(24 * time.Hour); created.After(start) {
+		start = created
+	}
+	return start
+}
+
+// rollUpAnalyticsDay computes an organization's analytics for a UTC day and replaces
+// its rows in analytics_daily
+func (a *App) rollUpAnalyticsDay(orgID uuid.UUID, day time.Time) error {
+	start := day.UTC().Truncate(24 * time.Hour)
+	end := start.AddDate(0, 0, 1)
+
+	rows := map[uuid.UUID]*models.AnalyticsDaily{}
+	row := func(userID uuid.UUID) *models.AnalyticsDaily {
+		if r, ok := rows[userID]; ok {
+			return r
+		}
+		r := &models.AnalyticsDaily{
+			BaseModel:      models.BaseModel{ID: uuid.New()},
+			OrganizationID: orgID,
+			Day:            start,
+			UserID:         userID,
+		}
+		rows[userID] = r
+		return r
+	}
+	org := row(uuid.Nil)
+
+	// Message volume, by sender
+	var volumes []struct {
+		UserID    *uuid.UUID
+		Direction models.Direction
+		Campaign  bool
+		Count     int64
+	}
+	if err := a.DB.Model(&models.Message{}).
+		Select("sent_by_user_id AS user_id, direction, metadata->>'campaign_id' IS NOT NULL AS campaign, COUNT(*) AS count").
+		Where("organization_id = ? AND created_at >= ? AND created_at < ?", orgID, start, end).
+		Group("1, 2, 3").
+		Scan(&volumes).Error; err != nil {
+		return err
+	}
+	for _, v := range volumes {
+		if v.Direction == models.DirectionIncoming {
+			org.MessagesReceived += v.Count
+			continue
+		}
+		org.MessagesSent += v.Count
+		switch {
+		case v.UserID != nil:
+			org.AgentMessagesSent += v.Count
+			agent := row(*v.UserID)
+			agent.MessagesSent += v.Count
+			agent.AgentMessagesSent += v.Count
+		case !v.Campaign:
+			org.BotMessagesSent += v.Count
+		}
+	}
+
+	// New and returning contacts
+	if err := a.DB.Raw(`SELECT COUNT(*) FILTER (WHERE first_at >= ?) AS new_contacts,
+		COUNT(*) FILTER (WHERE first_at < ?) AS returning_contacts
+		FROM (SELECT m.contact_id, (SELECT MIN(p.created_at) FROM messages p
+				WHERE p.contact_id = m.contact_id AND p.direction = 'incoming' AND p.deleted_at IS NULL) AS first_at
+			FROM messages m
+			WHERE m.organization_id = ? AND m.direction = 'incoming' AND m.created_at >= ? AND m.created_at < ?
+				AND m.deleted_at IS NULL
+			GROUP BY m.contact_id) c`,
+		start, start, orgID, start, end).
+		Row().Scan(&org.NewContacts, &org.ReturningContacts); err != nil {
+		return err
+	}
+
+	// Response times of the bot and of each agent
+	var samples []struct {
+		UserID *uuid.UUID
+		Secs   float64
+	}
+	if err := a.DB.Raw(analyticsResponseTimes, orgID, start.Add(-analyticsReplyLookback), end, start).
+		Scan(&samples).Error; err != nil {
+		return err
+	}
+	var botTimes, agentTimes []float64
+	agentTimesByUser := map[uuid.UUID][]float64{}
+	for _, s := range samples {
+		if s.UserID == nil {
+			botTimes = append(botTimes, s.Secs)
+			continue
+		}
+		agentTimes = append(agentTimes, s.Secs)
+		agentTimesByUser[*s.UserID] = append(agentTimesByUser[*s.UserID], s.Secs)
+	}
+	org.BotReplies, org.BotResponseMedianSecs = int64(len(botTimes)), median(botTimes)
+	org.AgentReplies, org.AgentResponseMedianSecs = int64(len(agentTimes)), median(agentTimes)
+	for userID, times := range agentTimesByUser {
+		agent := row(userID)
+		agent.AgentReplies, agent.AgentResponseMedianSecs = int64(len(times)), median(times)
+	}
+
+	// Chatbot sessions, and how the bot answered
+	if err := a.DB.Model(&models.ChatbotSession{}).
+		Where("organization_id = ? AND started_at >= ? AND started_at < ?", orgID, start, end).
+		Count(&org.ChatbotSessions).Error; err != nil {
+		return err
+	}
+	if err := a.DB.Model(&models.ChatbotSessionMessage{}).
+		Joins("JOIN chatbot_sessions ON chatbot_sessions.id = chatbot_session_messages.session_id").
+		Select("COUNT(*) FILTER (WHERE chatbot_session_messages.step_name = 'ai_response'), "+
+			"COUNT(*) FILTER (WHERE chatbot_session_messages.step_name = 'fallback_response')").
+		Where("chatbot_sessions.organization_id = ? AND chatbot_session_messages.created_at >= ? AND chatbot_session_messages.created_at < ?", orgID, start, end).
+		Row().Scan(&org.AIResponses, &org.FallbackResponses); err != nil {
+		return err
+	}
+
+	// Handoffs to agents, and the transfers each agent was assigned
+	var transfers []struct {
+		AgentID  *uuid.UUID
+		Handoffs int64
+		Total    int64
+	}
+	if err := a.DB.Model(&models.AgentTransfer{}).
+		Select("agent_id, COUNT(*) FILTER (WHERE transferred_by_user_id IS NULL) AS handoffs, COUNT(*) AS total").
+		Where("organization_id = ? AND transferred_at >= ? AND transferred_at < ?", orgID, start, end).
+		Group("agent_id").
+		Scan(&transfers).Error; err != nil {
+		return err
+	}
+	for _, t := range transfers {
+		org.Handoffs += t.Handoffs
+		if t.AgentID != nil {
+			row(*t.AgentID).Handoffs += t.Total
+		}
+	}
+
+	// Campaign messages sent that day and how they did, and sends that failed that day
+	sentThatDay := "bulk_message_recipients.sent_at >= ? AND bulk_message_recipients.sent_at < ?"
+	updatedThatDay := "bulk_message_recipients.updated_at >= ? AND bulk_message_recipients.updated_at < ?"
+	if err := a.DB.Model(&models.BulkMessageRecipient{}).
+		Joins("JOIN bulk_message_campaigns ON bulk_message_campaigns.id = bulk_message_recipients.campaign_id").
+		Select("COUNT(*) FILTER (WHERE "+sentThatDay+"), "+
+			"COUNT(*) FILTER (WHERE "+sentThatDay+" AND (bulk_message_recipients.delivered_at IS NOT NULL OR bulk_message_recipients.read_at IS NOT NULL)), "+
+			"COUNT(*) FILTER (WHERE "+sentThatDay+" AND bulk_message_recipients.read_at IS NOT NULL), "+
+			"COUNT(*) FILTER (WHERE bulk_message_recipients.status = ? AND "+updatedThatDay+")",
+			start, end, start, end, start, end, models.MessageStatusFailed, start, end).
+		Where("bulk_message_campaigns.organization_id = ?", orgID).
+		Where("("+sentThatDay+") OR ("+updatedThatDay+")", start, end, start, end).
+		Row().Scan(&org.CampaignSent, &org.CampaignDelivered, &org.CampaignRead, &org.CampaignFailed); err != nil {
+		return err
+	}
+
+	records := make([]models.AnalyticsDaily, 0, len(rows))
+	for _, r := range rows {
+		records = append(records, *r)
+	}
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("organization_id = ? AND day = ?", orgID, start).
+			Delete(&models.AnalyticsDaily{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+}
+
+// median returns the median of values, 0 when there are none
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
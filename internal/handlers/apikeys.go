@@ -3,6 +3,7 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,8 +15,10 @@ import (
 
 // APIKeyRequest represents the request body for creating an API key
 type APIKeyRequest struct {
-	Name      string  `json:"name"`
-	ExpiresAt *string `json:"expires_at,omitempty"`
+	Name      string   `json:"name"`
+	ExpiresAt *string  `json:"expires_at,omitempty"`
+	Scopes    []string `json:"scopes"`
+	RateLimit int      `json:"rate_limit"` // Requests per minute, 0 uses the default
 }
 
 // APIKeyResponse represents an API key in list responses
@@ -25,6 +28,10 @@ type APIKeyResponse struct {
 	KeyPrefix  string     `json:"key_prefix"`
 	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
 	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	RateLimit  int        `json:"rate_limit"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
 	IsActive   bool       `json:"is_active"`
 	CreatedAt  string     `json:"created_at"`
 }
@@ -36,6 +43,8 @@ type APIKeyCreateResponse struct {
 	Key       string     `json:"key"` // Full key, only returned on create
 	KeyPrefix string     `json:"key_prefix"`
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	RateLimit int        `json:"rate_limit"`
 	CreatedAt string     `json:"created_at"`
 }
 
@@ -48,6 +57,73 @@ func generateAPIKey() (string, error) {
 	return "whm_" + hex.EncodeToString(bytes), nil
 }
 
+// hashAPIKey generates a new key and returns it with its stored prefix and bcrypt hash
+func hashAPIKey() (key, prefix, hash string, err error) {
+	key, err = generateAPIKey()
+	if err != nil {
+		return "", "", "", err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(key), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", "", err
+	}
+	// Prefix is the first 8 chars after "whm_"
+	return key, key[4:12], string(hashed), nil
+}
+
+// validateAPIKeyScopes checks requested scopes, defaulting to admin when none are given
+func validateAPIKeyScopes(scopes []string) (models.StringArray, error) {
+	if len(scopes) == 0 {
+		return models.StringArray{string(models.APIKeyScopeAdmin)}, nil
+	}
+	result := make(models.StringArray, 0, len(scopes))
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		switch models.APIKeyScope(scope) {
+		case models.APIKeyScopeSend, models.APIKeyScopeRead, models.APIKeyScopeContacts, models.APIKeyScopeAdmin:
+		default:
+			return nil, fmt.Errorf("invalid scope: %s", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+// apiKeyAuditEntry returns an audit log entry for a change to an API key
+func apiKeyAuditEntry(action string, key models.APIKey) models.AuditLog {
+	return models.AuditLog{
+		OrganizationID: key.OrganizationID,
+		Action:         action,
+		ResourceType:   models.AuditResourceAPIKey,
+		ResourceID:     &key.ID,
+		ResourceName:   key.Name,
+	}
+}
+
+// toAPIKeyResponse converts an API key to its list response
+func toAPIKeyResponse(key models.APIKey) APIKeyResponse {
+	scopes := []string(key.Scopes)
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		KeyPrefix:  key.KeyPrefix,
+		LastUsedAt: key.LastUsedAt,
+		ExpiresAt:  key.ExpiresAt,
+		Scopes:     scopes,
+		RateLimit:  key.RateLimit,
+		RotatedAt:  key.RotatedAt,
+		RevokedAt:  key.RevokedAt,
+		IsActive:   key.IsActive,
+		CreatedAt:  key.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
 // ListAPIKeys returns all API keys for the organization
 func (a *App) ListAPIKeys(r *fastglue.Request) error {
 	orgID, err := getOrganizationID(r)
@@ -69,15 +145,7 @@ func (a *App) ListAPIKeys(r *fastglue.Request) error {
 	// Convert to response format
 	response := make([]APIKeyResponse, len(apiKeys))
 	for i, key := range apiKeys {
-		response[i] = APIKeyResponse{
-			ID:         key.ID,
-			Name:       key.Name,
-			KeyPrefix:  key.KeyPrefix,
-			LastUsedAt: key.LastUsedAt,
-			ExpiresAt:  key.ExpiresAt,
-			IsActive:   key.IsActive,
-			CreatedAt:  key.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		}
+		response[i] = toAPIKeyResponse(key)
 	}
 
 	return r.SendEnvelope(response)
@@ -90,6 +158,10 @@ func (a *App) CreateAPIKey(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
 	}
 
+	if !a.HasFeature(orgID, models.PlanFeatureAPIKeys) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureAPIKeys), nil, "")
+	}
+
 	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
 	if !a.HasPermission(userID, models.ResourceAPIKeys, models.ActionWrite) {
 		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
@@ -115,29 +187,34 @@ func (a *App) CreateAPIKey(r *fastglue.Request) error {
 		expiresAt = &t
 	}
 
-	// Generate the API key
-	fullKey, err := generateAPIKey()
+	scopes, err := validateAPIKeyScopes(req.Scopes)
 	if err != nil {
-		a.Log.Error("Failed to generate API key", "error", err)
-		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to generate API key", nil, "")
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
 	}
 
-	// Hash the key for storage
-	hashedKey, err := bcrypt.GenerateFromPassword([]byte(fullKey), bcrypt.DefaultCost)
-	if err != nil {
-		a.Log.Error("Failed to hash API key", "error", err)
-		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create API key", nil, "")
+	rateLimit := req.RateLimit
+	if rateLimit == 0 {
+		rateLimit = models.DefaultAPIKeyRateLimit
+	}
+	if rateLimit < 0 || rateLimit > models.MaxAPIKeyRateLimit {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("rate_limit must be between 1 and %d", models.MaxAPIKeyRateLimit), nil, "")
 	}
 
-	// Extract prefix (first 8 chars after "whm_")
-	keyPrefix := fullKey[4:12]
+	// Generate the API key and hash it for storage
+	fullKey, keyPrefix, hashedKey, err := hashAPIKey()
+	if err != nil {
+		a.Log.Error("Failed to generate API key", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to generate API key", nil, "")
+	}
 
 	apiKey := models.APIKey{
 		OrganizationID: orgID,
 		UserID:         userID,
 		Name:           req.Name,
 		KeyPrefix:      keyPrefix,
-		KeyHash:        string(hashedKey),
+		KeyHash:        hashedKey,
+		Scopes:         scopes,
+		RateLimit:      rateLimit,
 		ExpiresAt:      expiresAt,
 		IsActive:       true,
 	}
@@ -146,6 +223,7 @@ func (a *App) CreateAPIKey(r *fastglue.Request) error {
 		a.Log.Error("Failed to create API key", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create API key", nil, "")
 	}
+	a.recordAudit(r, apiKeyAuditEntry(models.AuditActionCreate, apiKey), nil, auditSnapshot(toAPIKeyResponse(apiKey)))
 
 	// Return full key only on creation
 	return r.SendEnvelope(APIKeyCreateResponse{
@@ -154,11 +232,13 @@ func (a *App) CreateAPIKey(r *fastglue.Request) error {
 		Key:       fullKey, // This is the only time the full key is returned
 		KeyPrefix: apiKey.KeyPrefix,
 		ExpiresAt: apiKey.ExpiresAt,
+		Scopes:    apiKey.Scopes,
+		RateLimit: apiKey.RateLimit,
 		CreatedAt: apiKey.CreatedAt.Format("2006-01-02T15:04:05Z"),
 	})
 }
 
-// DeleteAPIKey revokes an API key
+// DeleteAPIKey deletes an API key
 func (a *App) DeleteAPIKey(r *fastglue.Request) error {
 	orgID, err := getOrganizationID(r)
 	if err != nil {
@@ -176,14 +256,104 @@ func (a *App) DeleteAPIKey(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid API key ID", nil, "")
 	}
 
-	result := a.DB.Where("id = ? AND organization_id = ?", id, orgID).Delete(&models.APIKey{})
-	if result.Error != nil {
-		a.Log.Error("Failed to delete API key", "error", result.Error)
+	var apiKey models.APIKey
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&apiKey).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "API key not found", nil, "")
+	}
+
+	if err := a.DB.Delete(&apiKey).Error; err != nil {
+		a.Log.Error("Failed to delete API key", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete API key", nil, "")
 	}
-	if result.RowsAffected == 0 {
+	a.recordAudit(r, apiKeyAuditEntry(models.AuditActionDelete, apiKey), auditSnapshot(toAPIKeyResponse(apiKey)), nil)
+
+	return r.SendEnvelope(map[string]string{"message": "API key deleted successfully"})
+}
+
+// RotateAPIKey replaces an API key's secret, keeping its name, scopes and rate limit.
+// The old key stops working immediately.
+func (a *App) RotateAPIKey(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceAPIKeys, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid API key ID", nil, "")
+	}
+
+	var apiKey models.APIKey
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&apiKey).Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "API key not found", nil, "")
 	}
+	if apiKey.RevokedAt != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Revoked API keys cannot be rotated", nil, "")
+	}
 
-	return r.SendEnvelope(map[string]string{"message": "API key deleted successfully"})
+	fullKey, keyPrefix, hashedKey, err := hashAPIKey()
+	if err != nil {
+		a.Log.Error("Failed to generate API key", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to generate API key", nil, "")
+	}
+
+	before := auditSnapshot(toAPIKeyResponse(apiKey))
+	now := time.Now()
+	if err := a.DB.Model(&apiKey).Updates(map[string]interface{}{
+		"key_prefix": keyPrefix,
+		"key_hash":   hashedKey,
+		"rotated_at": now,
+	}).Error; err != nil {
+		a.Log.Error("Failed to rotate API key", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to rotate API key", nil, "")
+	}
+	a.recordAudit(r, apiKeyAuditEntry(models.AuditActionRotate, apiKey), before, auditSnapshot(toAPIKeyResponse(apiKey)))
+
+	return r.SendEnvelope(APIKeyCreateResponse{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Key:       fullKey,
+		KeyPrefix: keyPrefix,
+		ExpiresAt: apiKey.ExpiresAt,
+		Scopes:    apiKey.Scopes,
+		RateLimit: apiKey.RateLimit,
+		CreatedAt: apiKey.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// RevokeAPIKey deactivates an API key while keeping it listed for reference
+func (a *App) RevokeAPIKey(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceAPIKeys, models.ActionDelete) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid API key ID", nil, "")
+	}
+
+	var apiKey models.APIKey
+	if err := a.DB.Where("id = ? AND organization_id = ? AND revoked_at IS NULL", id, orgID).First(&apiKey).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "API key not found", nil, "")
+	}
+
+	before := auditSnapshot(toAPIKeyResponse(apiKey))
+	if err := a.DB.Model(&apiKey).Updates(map[string]interface{}{"is_active": false, "revoked_at": time.Now()}).Error; err != nil {
+		a.Log.Error("Failed to revoke API key", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to revoke API key", nil, "")
+	}
+	a.recordAudit(r, apiKeyAuditEntry(models.AuditActionRevoke, apiKey), before, auditSnapshot(toAPIKeyResponse(apiKey)))
+
+	return r.SendEnvelope(map[string]string{"message": "API key revoked successfully"})
 }
@@ -3,13 +3,29 @@ package handlers
 import (
 	"context"
 	"errors"
+	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/database"
+	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/shridarpatil/whatomate/internal/storage"
+	"github.com/shridarpatil/whatomate/internal/tracing"
 	"github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/shridarpatil/whatomate/pkg/crm"
+	"github.com/shridarpatil/whatomate/pkg/gcalendar"
+	"github.com/shridarpatil/whatomate/pkg/helpdesk"
+	"github.com/shridarpatil/whatomate/pkg/messenger"
+	"github.com/shridarpatil/whatomate/pkg/payments"
+	"github.com/shridarpatil/whatomate/pkg/shopify"
+	"github.com/shridarpatil/whatomate/pkg/telegram"
+	"github.com/shridarpatil/whatomate/pkg/translate"
+	"github.com/shridarpatil/whatomate/pkg/twilio"
 	"github.com/shridarpatil/whatomate/pkg/whatsapp"
 	"github.com/zerodha/fastglue"
 	"github.com/zerodha/logf"
@@ -18,24 +34,154 @@ import (
 
 // App holds all dependencies for handlers
 type App struct {
+	// Config is the configuration the app starts with. Read the current one, which
+	// ReloadConfig replaces, with CurrentConfig.
 	Config            *config.Config
+	ConfigPath        string // The config file, reloaded by ReloadConfig
 	DB                *gorm.DB
 	Redis             *redis.Client
 	Log               logf.Logger
 	WhatsApp          *whatsapp.Client
+	Telegram          *telegram.Client
+	Messenger         *messenger.Client
+	Twilio            *twilio.Client
+	Payments          *payments.Client
+	Calendar          *gcalendar.Client
+	Shopify           *shopify.Client
+	CRM               *crm.Client
+	Helpdesk          *helpdesk.Client
+	Translator        *translate.Client
 	WSHub             *websocket.Hub
 	Queue             queue.Queue
 	CampaignSubCancel context.CancelFunc
+	// Webhooks holds inbound webhook payloads for the webhook workers, processed inline when nil
+	Webhooks *queue.WebhookQueue
+	// HTTPTransports carry the proxy and TLS settings for outbound calls, by provider
+	HTTPTransports map[string]*http.Transport
+	// Media is where media files are stored, local storage when nil
+	Media storage.Store
+	// Archive is where archived messages are stored, media storage when nil
+	Archive storage.Store
+	// MessageHooks see every organization's messages as they're processed, before
+	// the organization's own message hooks
+	MessageHooks []MessageHook
+	// liveConfig is the configuration applied by the last reload or secret refresh
+	liveConfig atomic.Pointer[config.Config]
+	// configMu serializes config reloads and secret refreshes
+	configMu sync.Mutex
+	// aiClients are the clients of AI provider calls, by provider
+	aiClients sync.Map
+	// credentials resolves secret references in stored provider credentials
+	credentials     *config.CredentialSecrets
+	credentialsOnce sync.Once
+	// simulation records the replies of a chatbot simulation, on the App it runs on
+	simulation *simulationTransport
 	// wg tracks background goroutines for graceful shutdown
 	wg sync.WaitGroup
 }
 
+// CurrentConfig returns the current configuration. It isn't changed once returned,
+// a reload replaces it, so it's read without locking.
+func (a *App) CurrentConfig() *config.Config {
+	if cfg := a.liveConfig.Load(); cfg != nil {
+		return cfg
+	}
+	return a.Config
+}
+
 // WaitForBackgroundTasks blocks until all background goroutines complete.
 // Call this during graceful shutdown to ensure all async work finishes.
 func (a *App) WaitForBackgroundTasks() {
 	a.wg.Wait()
 }
 
+// log returns the logger for work done in ctx, which adds the correlation ID of the
+// request or webhook the work is for to every line
+func (a *App) log(ctx context.Context) logf.Logger {
+	id := tracing.RequestID(tracing.FromContext(ctx))
+	if id == "" {
+		return a.Log
+	}
+	l := a.Log
+	l.DefaultFields = append(l.DefaultFields[:len(l.DefaultFields):len(l.DefaultFields)], "request_id", id)
+	return l
+}
+
+// replicaDB returns the database for reporting, search, export and list queries,
+// which read from the read replica when one is configured. Data written moments ago
+// may not be there yet, so reads that follow a write use a.DB.
+func (a *App) replicaDB() *gorm.DB {
+	return database.Replica(a.DB)
+}
+
+// httpClient returns a client for outbound calls to a provider (config.OutboundAI,
+// etc.), using its transport if configured. Calls are traced.
+func (a *App) httpClient(provider string, timeout time.Duration) *http.Client {
+	var base http.RoundTripper
+	if t, ok := a.HTTPTransports[provider]; ok {
+		base = t
+	}
+	return &http.Client{Timeout: timeout, Transport: tracing.Transport(base)}
+}
+
+// aiClient returns the client for calls to an AI provider, with the provider's
+// timeout. Clients are reused and share the AI transport's connection pool.
+func (a *App) aiClient(provider models.AIProvider) *http.Client {
+	if client, ok := a.aiClients.Load(provider); ok {
+		return client.(*http.Client)
+	}
+	client, _ := a.aiClients.LoadOrStore(provider, a.httpClient(config.OutboundAI, a.aiTimeout(provider)))
+	return client.(*http.Client)
+}
+
+// resolveCredential returns a provider credential of an organization, fetching the
+// secret it references if it is a secret reference
+func (a *App) resolveCredential(ctx context.Context, orgID uuid.UUID, value string) (string, error) {
+	if !config.IsSecretReference(value) {
+		return value, nil
+	}
+	return a.credentialSecrets().Resolve(ctx, orgID.String(), value)
+}
+
+// checkCredential returns an error if a provider credential saved by an organization
+// references a secret it may not use, or that can't be fetched
+func (a *App) checkCredential(ctx context.Context, orgID uuid.UUID, value string) error {
+	_, err := a.resolveCredential(ctx, orgID, value)
+	return err
+}
+
+func (a *App) credentialSecrets() *config.CredentialSecrets {
+	a.credentialsOnce.Do(func() {
+		a.credentials = config.NewCredentialSecrets(a.CurrentConfig())
+	})
+	return a.credentials
+}
+
+// aiTimeout returns how long to wait for an AI provider's answer
+func (a *App) aiTimeout(provider models.AIProvider) time.Duration {
+	var timeouts config.AITimeoutsConfig
+	if cfg := a.CurrentConfig(); cfg != nil {
+		timeouts = cfg.AI.Timeouts
+	}
+	secs := 0
+	switch provider {
+	case models.AIProviderOpenAI:
+		secs = timeouts.OpenAI
+	case models.AIProviderAnthropic:
+		secs = timeouts.Anthropic
+	case models.AIProviderGoogle:
+		secs = timeouts.Google
+	case models.AIProviderOllama:
+		secs = timeouts.Ollama
+	case models.AIProviderWebhook:
+		secs = timeouts.Webhook
+	}
+	if secs <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(secs) * time.Second
+}
+
 // getOrgIDFromContext extracts organization ID from request context (set by auth middleware)
 // Super admins can override the org by passing X-Organization-ID header
 // Super admins MUST select an organization - no "all organizations" view
@@ -121,6 +267,13 @@ func (a *App) StartCampaignStatsSubscriber() error {
 			"sent", update.SentCount,
 		)
 
+		// The worker publishes the completed status once, when the last recipient is processed
+		if update.Status == models.CampaignStatusCompleted {
+			if campaignID, err := uuid.Parse(update.CampaignID); err == nil {
+				a.dispatchCampaignCompletedWebhook(campaignID)
+			}
+		}
+
 		// Broadcast to organization via WebSocket
 		a.WSHub.BroadcastToOrg(update.OrganizationID, websocket.WSMessage{
 			Type: websocket.TypeCampaignStatsUpdate,
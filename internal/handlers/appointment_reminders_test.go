@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppointmentReminderSchedule(t *testing.T) {
+	now := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	startsAt := now.Add(2 * time.Hour)
+
+	reminders := appointmentReminderSchedule(uuid.New(), startsAt, []int{1440, 60}, now)
+	require.Len(t, reminders, 1, "the 24h reminder is already past")
+	assert.Equal(t, 60, reminders[0].OffsetMinutes)
+	assert.Equal(t, startsAt.Add(-time.Hour), reminders[0].SendAt)
+	assert.Equal(t, models.AppointmentReminderStatusPending, reminders[0].Status)
+}
+
+func TestNormalizeReminderOffsets(t *testing.T) {
+	offsets, err := normalizeReminderOffsets([]int{60, 1440, 60, 15})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1440, 60, 15}, offsets)
+
+	_, err = normalizeReminderOffsets([]int{60, 0})
+	assert.Error(t, err)
+}
+
+func TestAppointmentReplyStatus(t *testing.T) {
+	tests := []struct {
+		payload string
+		text    string
+		want    models.AppointmentStatus
+	}{
+		{"CANCEL_APPOINTMENT", "Cancel", models.AppointmentStatusCancelled},
+		{"", "Reschedule", models.AppointmentStatusRescheduleRequested},
+		{"reschedule", "Change time", models.AppointmentStatusRescheduleRequested},
+		{"confirm", "See you then", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, appointmentReplyStatus(tt.payload, tt.text), "payload=%q text=%q", tt.payload, tt.text)
+	}
+}
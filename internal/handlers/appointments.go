@@ -0,0 +1,995 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// defaultAppointmentReminderOffsets sends reminders 24 hours and 1 hour before the appointment
+var defaultAppointmentReminderOffsets = []int{1440, 60}
+
+// AppointmentRequest books an appointment with a contact. Reminders are only
+// scheduled when a reminder template is set; reminder_offsets defaults to
+// 24 hours and 1 hour before starts_at.
+type AppointmentRequest struct {
+	ContactID              string            `json:"contact_id"`
+	WhatsAppAccount        string            `json:"whatsapp_account"`
+	Title                  string            `json:"title"`
+	StartsAt               *time.Time        `json:"starts_at"`
+	DurationMinutes        int               `json:"duration_minutes"`
+	Notes                  string            `json:"notes"`
+	ReminderTemplateID     string            `json:"reminder_template_id"`
+	ReminderTemplateParams map[string]string `json:"reminder_template_params"`
+	ReminderOffsets        []int             `json:"reminder_offsets"`
+}
+
+// UpdateAppointmentRequest updates an appointment. Changing starts_at reschedules
+// it and rebuilds its pending reminders.
+type UpdateAppointmentRequest struct {
+	Title                  *string                   `json:"title"`
+	StartsAt               *time.Time                `json:"starts_at"`
+	DurationMinutes        *int                      `json:"duration_minutes"`
+	Notes                  *string                   `json:"notes"`
+	Status                 *models.AppointmentStatus `json:"status"`
+	ReminderTemplateID     *string                   `json:"reminder_template_id"`
+	ReminderTemplateParams map[string]string         `json:"reminder_template_params"`
+	ReminderOffsets        []int                     `json:"reminder_offsets"`
+}
+
+// AppointmentReminderResponse represents an appointment reminder in API responses
+type AppointmentReminderResponse struct {
+	ID            uuid.UUID                        `json:"id"`
+	OffsetMinutes int                              `json:"offset_minutes"`
+	SendAt        time.Time                        `json:"send_at"`
+	Status        models.AppointmentReminderStatus `json:"status"`
+	MessageID     *uuid.UUID                       `json:"message_id,omitempty"`
+	SentAt        *time.Time                       `json:"sent_at,omitempty"`
+	ErrorMessage  string                           `json:"error_message,omitempty"`
+}
+
+// AppointmentResponse represents an appointment in API responses
+type AppointmentResponse struct {
+	ID                     uuid.UUID                     `json:"id"`
+	ContactID              uuid.UUID                     `json:"contact_id"`
+	ContactName            string                        `json:"contact_name,omitempty"`
+	WhatsAppAccount        string                        `json:"whatsapp_account"`
+	Title                  string                        `json:"title"`
+	StartsAt               time.Time                     `json:"starts_at"`
+	DurationMinutes        int                           `json:"duration_minutes"`
+	Notes                  string                        `json:"notes"`
+	Status                 models.AppointmentStatus      `json:"status"`
+	Source                 models.AppointmentSource      `json:"source"`
+	ReminderTemplateID     *uuid.UUID                    `json:"reminder_template_id,omitempty"`
+	ReminderTemplateName   string                        `json:"reminder_template_name,omitempty"`
+	ReminderTemplateParams models.JSONB                  `json:"reminder_template_params,omitempty"`
+	ReminderOffsets        []int                         `json:"reminder_offsets"`
+	Reminders              []AppointmentReminderResponse `json:"reminders"`
+	CreatedByID            *uuid.UUID                    `json:"created_by_id,omitempty"`
+	CancelledAt            *time.Time                    `json:"cancelled_at,omitempty"`
+	CalendarEventID        string                        `json:"calendar_event_id,omitempty"`
+	CreatedAt              time.Time                     `json:"created_at"`
+	UpdatedAt              time.Time                     `json:"updated_at"`
+}
+
+// ListAppointments returns the organization's appointments, optionally filtered by
+// contact, status and a starts_at range (from/to, RFC 3339)
+func (a *App) ListAppointments(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	page, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("page")))
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := a.DB.Model(&models.Appointment{}).Where("organization_id = ?", orgID)
+
+	// Users without contacts:read permission only see appointments of contacts assigned to them
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("contact_id IN (?)", a.DB.Model(&models.Contact{}).Select("id").Where("assigned_user_id = ?", userID))
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	if contactID := string(args.Peek("contact_id")); contactID != "" {
+		id, err := uuid.Parse(contactID)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact_id", nil, "")
+		}
+		query = query.Where("contact_id = ?", id)
+	}
+	if status := string(args.Peek("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if from := string(args.Peek("from")); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid from, expected RFC 3339", nil, "")
+		}
+		query = query.Where("starts_at >= ?", t)
+	}
+	if to := string(args.Peek("to")); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid to, expected RFC 3339", nil, "")
+		}
+		query = query.Where("starts_at < ?", t)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var appointments []models.Appointment
+	if err := query.Preload("Contact").Preload("ReminderTemplate").
+		Preload("Reminders", func(db *gorm.DB) *gorm.DB { return db.Order("send_at ASC") }).
+		Order("starts_at ASC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&appointments).Error; err != nil {
+		a.Log.Error("Failed to list appointments", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list appointments", nil, "")
+	}
+
+	shouldMask := a.ShouldMaskPhoneNumbers(orgID)
+	result := make([]AppointmentResponse, len(appointments))
+	for i, appt := range appointments {
+		result[i] = appointmentToResponse(appt, shouldMask)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"appointments": result,
+		"total":        total,
+		"page":         page,
+		"limit":        limit,
+	})
+}
+
+// CreateAppointment books an appointment and schedules its reminders
+func (a *App) CreateAppointment(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	var req AppointmentRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	contactID, err := uuid.Parse(req.ContactID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact_id", nil, "")
+	}
+
+	// Users without full read permission can only book appointments for their assigned contacts
+	var contact models.Contact
+	query := a.DB.Where("id = ? AND organization_id = ?", contactID, orgID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("assigned_user_id = ?", userID)
+	}
+	if err := query.First(&contact).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
+	}
+
+	appointment, err := a.buildAppointment(&contact, req, time.Now())
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	appointment.Source = models.AppointmentSourceAPI
+	appointment.CreatedByID = &userID
+
+	if err := a.saveAppointment(appointment); err != nil {
+		a.Log.Error("Failed to create appointment", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create appointment", nil, "")
+	}
+
+	a.Log.Info("Appointment booked", "appointment_id", appointment.ID, "contact_id", contact.ID, "starts_at", appointment.StartsAt)
+	a.queueCalendarSync(appointment)
+
+	appointment.Contact = &contact
+	return r.SendEnvelope(appointmentToResponse(*appointment, a.ShouldMaskPhoneNumbers(orgID)))
+}
+
+// GetAppointment returns a single appointment with its reminders
+func (a *App) GetAppointment(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	appointment, err := a.findAppointment(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Appointment not found", nil, "")
+	}
+
+	return r.SendEnvelope(appointmentToResponse(*appointment, a.ShouldMaskPhoneNumbers(orgID)))
+}
+
+// UpdateAppointment updates an appointment. A new starts_at reschedules it.
+func (a *App) UpdateAppointment(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	appointment, err := a.findAppointment(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Appointment not found", nil, "")
+	}
+	if appointment.Status == models.AppointmentStatusCancelled {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Appointment is cancelled", nil, "")
+	}
+
+	var req UpdateAppointmentRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	now := time.Now()
+	if req.Title != nil {
+		if strings.TrimSpace(*req.Title) == "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "title cannot be empty", nil, "")
+		}
+		appointment.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.Notes != nil {
+		appointment.Notes = strings.TrimSpace(*req.Notes)
+	}
+	if req.DurationMinutes != nil {
+		if *req.DurationMinutes <= 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "duration_minutes must be positive", nil, "")
+		}
+		appointment.DurationMinutes = *req.DurationMinutes
+	}
+
+	rebuildReminders := false
+	if req.StartsAt != nil && !req.StartsAt.Equal(appointment.StartsAt) {
+		if !req.StartsAt.After(now) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "starts_at must be in the future", nil, "")
+		}
+		appointment.StartsAt = *req.StartsAt
+		// Rescheduling confirms the appointment again
+		appointment.Status = models.AppointmentStatusScheduled
+		rebuildReminders = true
+	}
+	if req.ReminderTemplateID != nil {
+		if *req.ReminderTemplateID == "" {
+			appointment.ReminderTemplateID = nil
+			appointment.ReminderTemplate = nil
+			appointment.ReminderTemplateParams = models.JSONB{}
+		} else {
+			params := req.ReminderTemplateParams
+			if params == nil {
+				params = jsonbToStringMap(appointment.ReminderTemplateParams)
+			}
+			template, err := a.validateReminderTemplate(orgID, *req.ReminderTemplateID, params)
+			if err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+			}
+			appointment.ReminderTemplateID = &template.ID
+			appointment.ReminderTemplate = template
+			appointment.ReminderTemplateParams = stringMapToJSONB(params)
+		}
+		rebuildReminders = true
+	} else if req.ReminderTemplateParams != nil && appointment.ReminderTemplate != nil {
+		if missingParams, paramNames := missingTemplateParams(appointment.ReminderTemplate, req.ReminderTemplateParams); len(missingParams) > 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("missing template parameters: %s. Expected parameters: %v", strings.Join(missingParams, ", "), paramNames), nil, "")
+		}
+		appointment.ReminderTemplateParams = stringMapToJSONB(req.ReminderTemplateParams)
+	}
+	if req.ReminderOffsets != nil {
+		offsets, err := normalizeReminderOffsets(req.ReminderOffsets)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		appointment.ReminderOffsets = reminderOffsetsToJSONB(offsets)
+		rebuildReminders = true
+	}
+	if req.Status != nil && *req.Status != appointment.Status {
+		switch *req.Status {
+		case models.AppointmentStatusCompleted, models.AppointmentStatusScheduled:
+			appointment.Status = *req.Status
+			rebuildReminders = true
+		default:
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "status can only be set to scheduled or completed", nil, "")
+		}
+	}
+
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(appointment).Updates(map[string]interface{}{
+			"title":                    appointment.Title,
+			"notes":                    appointment.Notes,
+			"duration_minutes":         appointment.DurationMinutes,
+			"starts_at":                appointment.StartsAt,
+			"status":                   appointment.Status,
+			"reminder_template_id":     appointment.ReminderTemplateID,
+			"reminder_template_params": appointment.ReminderTemplateParams,
+			"reminder_offsets":         appointment.ReminderOffsets,
+		}).Error; err != nil {
+			return err
+		}
+		if !rebuildReminders {
+			return nil
+		}
+		return scheduleAppointmentReminders(tx, appointment, now)
+	})
+	if err != nil {
+		a.Log.Error("Failed to update appointment", "error", err, "appointment_id", appointment.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update appointment", nil, "")
+	}
+
+	a.Log.Info("Appointment updated", "appointment_id", appointment.ID, "starts_at", appointment.StartsAt, "status", appointment.Status)
+	a.queueCalendarSync(appointment)
+
+	updated, err := a.findAppointment(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Appointment not found", nil, "")
+	}
+	return r.SendEnvelope(appointmentToResponse(*updated, a.ShouldMaskPhoneNumbers(orgID)))
+}
+
+// CancelAppointment cancels an appointment and its pending reminders
+func (a *App) CancelAppointment(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	appointment, err := a.findAppointment(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Appointment not found", nil, "")
+	}
+
+	cancelled, err := a.cancelAppointment(appointment)
+	if err != nil {
+		a.Log.Error("Failed to cancel appointment", "error", err, "appointment_id", appointment.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to cancel appointment", nil, "")
+	}
+	if !cancelled {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Appointment is already cancelled", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Appointment cancelled",
+		"status":  models.AppointmentStatusCancelled,
+	})
+}
+
+// findAppointment loads the appointment in the {id} path parameter. Users without
+// contacts:read permission can only access appointments of their assigned contacts.
+func (a *App) findAppointment(r *fastglue.Request, orgID uuid.UUID) (*models.Appointment, error) {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	query := a.DB.Where("id = ? AND organization_id = ?", id, orgID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("contact_id IN (?)", a.DB.Model(&models.Contact{}).Select("id").Where("assigned_user_id = ?", userID))
+	}
+
+	var appointment models.Appointment
+	if err := query.Preload("Contact").Preload("ReminderTemplate").
+		Preload("Reminders", func(db *gorm.DB) *gorm.DB { return db.Order("send_at ASC") }).
+		First(&appointment).Error; err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+// buildAppointment validates an appointment request for a contact and returns the appointment to create
+func (a *App) buildAppointment(contact *models.Contact, req AppointmentRequest, now time.Time) (*models.Appointment, error) {
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		return nil, errors.New("title is required")
+	}
+	if req.StartsAt == nil {
+		return nil, errors.New("starts_at is required")
+	}
+	if !req.StartsAt.After(now) {
+		return nil, errors.New("starts_at must be in the future")
+	}
+	if req.DurationMinutes < 0 {
+		return nil, errors.New("duration_minutes must be positive")
+	}
+
+	offsets := defaultAppointmentReminderOffsets
+	if req.ReminderOffsets != nil {
+		var err error
+		if offsets, err = normalizeReminderOffsets(req.ReminderOffsets); err != nil {
+			return nil, err
+		}
+	}
+
+	account := req.WhatsAppAccount
+	if account == "" {
+		account = contact.WhatsAppAccount
+	}
+
+	appointment := &models.Appointment{
+		BaseModel:              models.BaseModel{ID: uuid.New()},
+		OrganizationID:         contact.OrganizationID,
+		ContactID:              contact.ID,
+		WhatsAppAccount:        account,
+		Title:                  title,
+		StartsAt:               *req.StartsAt,
+		DurationMinutes:        req.DurationMinutes,
+		Notes:                  strings.TrimSpace(req.Notes),
+		Status:                 models.AppointmentStatusScheduled,
+		ReminderTemplateParams: models.JSONB{},
+		ReminderOffsets:        reminderOffsetsToJSONB(offsets),
+	}
+	if appointment.DurationMinutes == 0 {
+		appointment.DurationMinutes = 30
+	}
+
+	if req.ReminderTemplateID != "" {
+		template, err := a.validateReminderTemplate(contact.OrganizationID, req.ReminderTemplateID, req.ReminderTemplateParams)
+		if err != nil {
+			return nil, err
+		}
+		appointment.ReminderTemplateID = &template.ID
+		appointment.ReminderTemplate = template
+		appointment.ReminderTemplateParams = stringMapToJSONB(req.ReminderTemplateParams)
+	}
+
+	return appointment, nil
+}
+
+// validateReminderTemplate checks that a reminder template exists, is approved and
+// that all of its parameters are given
+func (a *App) validateReminderTemplate(orgID uuid.UUID, templateIDStr string, params map[string]string) (*models.Template, error) {
+	templateID, err := uuid.Parse(templateIDStr)
+	if err != nil {
+		return nil, errors.New("invalid reminder_template_id")
+	}
+	var template models.Template
+	if err := a.DB.Where("id = ? AND organization_id = ?", templateID, orgID).First(&template).Error; err != nil {
+		return nil, errors.New("reminder template not found")
+	}
+	if template.Status != string(models.TemplateStatusApproved) {
+		return nil, fmt.Errorf("reminder template is not approved (status: %s)", template.Status)
+	}
+	if missingParams, paramNames := missingTemplateParams(&template, params); len(missingParams) > 0 {
+		return nil, fmt.Errorf("missing template parameters: %s. Expected parameters: %v", strings.Join(missingParams, ", "), paramNames)
+	}
+	return &template, nil
+}
+
+// saveAppointment creates an appointment along with its reminders
+func (a *App) saveAppointment(appointment *models.Appointment) error {
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(appointment).Error; err != nil {
+			return err
+		}
+		return scheduleAppointmentReminders(tx, appointment, time.Now())
+	})
+}
+
+// scheduleAppointmentReminders replaces the pending reminders of an appointment with
+// a fresh schedule. Nothing is scheduled without a reminder template or once the
+// appointment is no longer scheduled.
+func scheduleAppointmentReminders(tx *gorm.DB, appointment *models.Appointment, now time.Time) error {
+	if err := tx.Model(&models.AppointmentReminder{}).
+		Where("appointment_id = ? AND status = ?", appointment.ID, models.AppointmentReminderStatusPending).
+		Update("status", models.AppointmentReminderStatusCancelled).Error; err != nil {
+		return err
+	}
+
+	if appointment.ReminderTemplateID == nil || appointment.Status != models.AppointmentStatusScheduled {
+		return nil
+	}
+
+	reminders := appointmentReminderSchedule(appointment.ID, appointment.StartsAt, jsonbToReminderOffsets(appointment.ReminderOffsets), now)
+	if len(reminders) == 0 {
+		return nil
+	}
+	if err := tx.Create(&reminders).Error; err != nil {
+		return err
+	}
+	appointment.Reminders = reminders
+	return nil
+}
+
+// appointmentReminderSchedule returns the reminders to send for an appointment starting
+// at startsAt. Offsets whose send time has already passed are skipped.
+func appointmentReminderSchedule(appointmentID uuid.UUID, startsAt time.Time, offsets []int, now time.Time) []models.AppointmentReminder {
+	reminders := make([]models.AppointmentReminder, 0, len(offsets))
+	for _, offset := range offsets {
+		sendAt := startsAt.Add(-time.Duration(offset) * time.Minute)
+		if !sendAt.After(now) {
+			continue
+		}
+		reminders = append(reminders, models.AppointmentReminder{
+			AppointmentID: appointmentID,
+			OffsetMinutes: offset,
+			SendAt:        sendAt,
+			Status:        models.AppointmentReminderStatusPending,
+		})
+	}
+	return reminders
+}
+
+// normalizeReminderOffsets validates reminder offsets and returns them deduplicated,
+// largest (earliest reminder) first
+func normalizeReminderOffsets(offsets []int) ([]int, error) {
+	seen := make(map[int]bool, len(offsets))
+	result := make([]int, 0, len(offsets))
+	for _, offset := range offsets {
+		if offset <= 0 {
+			return nil, errors.New("reminder_offsets must be positive minutes before the appointment")
+		}
+		if seen[offset] {
+			continue
+		}
+		seen[offset] = true
+		result = append(result, offset)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(result)))
+	return result, nil
+}
+
+func reminderOffsetsToJSONB(offsets []int) models.JSONBArray {
+	result := make(models.JSONBArray, len(offsets))
+	for i, offset := range offsets {
+		result[i] = offset
+	}
+	return result
+}
+
+func jsonbToReminderOffsets(offsets models.JSONBArray) []int {
+	result := make([]int, 0, len(offsets))
+	for _, v := range offsets {
+		switch n := v.(type) {
+		case float64:
+			result = append(result, int(n))
+		case int:
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// cancelAppointment cancels an appointment and its pending reminders. Returns false
+// if it was already cancelled.
+func (a *App) cancelAppointment(appointment *models.Appointment) (bool, error) {
+	cancelled := false
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(appointment).
+			Where("status <> ?", models.AppointmentStatusCancelled).
+			Updates(map[string]interface{}{
+				"status":       models.AppointmentStatusCancelled,
+				"cancelled_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		cancelled = true
+		appointment.Status = models.AppointmentStatusCancelled
+		appointment.CancelledAt = &now
+		return scheduleAppointmentReminders(tx, appointment, now)
+	})
+	if cancelled && err == nil {
+		a.queueCalendarSync(appointment)
+	}
+	return cancelled, err
+}
+
+// createFlowAppointment books an appointment from an appointment flow step. The step's
+// input_config holds title, starts_at, duration_minutes, notes, reminder_template_id,
+// reminder_template_params and reminder_offsets; string values may use session variables.
+// It returns errCalendarSlotTaken when the time is busy on the connected calendar.
+func (a *App) createFlowAppointment(ctx context.Context, contact *models.Contact, config models.JSONB, sessionData models.JSONB) error {
+	req := AppointmentRequest{}
+	if config != nil {
+		if title, ok := config["title"].(string); ok {
+			req.Title = processTemplate(title, sessionData)
+		}
+		if startsAt, ok := config["starts_at"].(string); ok {
+			// Times without a zone are in the contact's local time
+			t, err := parseLocalTime(processTemplate(startsAt, sessionData), a.contactLocation(contact))
+			if err != nil {
+				a.Log.Error("Invalid appointment start time from flow", "error", err, "contact_id", contact.ID)
+				return err
+			}
+			req.StartsAt = &t
+		}
+		switch v := config["duration_minutes"].(type) {
+		case float64:
+			req.DurationMinutes = int(v)
+		case string:
+			_, _ = fmt.Sscan(v, &req.DurationMinutes)
+		}
+		if notes, ok := config["notes"].(string); ok {
+			req.Notes = processTemplate(notes, sessionData)
+		}
+		req.ReminderTemplateID, _ = config["reminder_template_id"].(string)
+		if params, ok := config["reminder_template_params"].(map[string]interface{}); ok {
+			// Appointment variables are resolved when each reminder is sent
+			req.ReminderTemplateParams = make(map[string]string, len(params))
+			for k, v := range params {
+				req.ReminderTemplateParams[k] = processTemplate(fmt.Sprint(v), deferAppointmentVars(sessionData))
+			}
+		}
+		if offsets, ok := config["reminder_offsets"].([]interface{}); ok {
+			req.ReminderOffsets = jsonbToReminderOffsets(offsets)
+		}
+	}
+
+	appointment, err := a.buildAppointment(contact, req, time.Now())
+	if err != nil {
+		a.Log.Error("Invalid appointment step configuration", "error", err, "contact_id", contact.ID)
+		return err
+	}
+	appointment.Source = models.AppointmentSourceFlow
+
+	// The slot may have been booked since the flow offered it. When the calendar can't
+	// be checked, the appointment is booked anyway.
+	if err := a.checkCalendarSlot(ctx, appointment); errors.Is(err, errCalendarSlotTaken) {
+		a.Log.Warn("Appointment slot taken on calendar", "contact_id", contact.ID, "starts_at", appointment.StartsAt)
+		return err
+	} else if err != nil {
+		a.Log.Error("Failed to check appointment slot on calendar", "error", err, "contact_id", contact.ID)
+	}
+
+	if err := a.saveAppointment(appointment); err != nil {
+		a.Log.Error("Failed to create appointment from flow", "error", err, "contact_id", contact.ID)
+		return err
+	}
+
+	a.Log.Info("Appointment booked by flow", "appointment_id", appointment.ID, "contact_id", contact.ID, "starts_at", appointment.StartsAt)
+	a.queueCalendarSync(appointment)
+	return nil
+}
+
+// deferAppointmentVars returns session data that leaves appointment variable placeholders
+// the session doesn't define untouched, so they can be filled in at reminder time
+func deferAppointmentVars(sessionData models.JSONB) models.JSONB {
+	data := models.JSONB{}
+	for k, v := range sessionData {
+		data[k] = v
+	}
+	for _, name := range []string{"appointment_title", "appointment_date", "appointment_time", "contact_name", "phone_number"} {
+		if _, ok := data[name]; !ok {
+			data[name] = "{{" + name + "}}"
+		}
+	}
+	return data
+}
+
+// appointmentTemplateVars returns the variables available to reminder template parameters
+func appointmentTemplateVars(appointment *models.Appointment, contact *models.Contact, loc *time.Location) map[string]interface{} {
+	if loc == nil {
+		loc = time.UTC
+	}
+	startsAt := appointment.StartsAt.In(loc)
+	vars := map[string]interface{}{
+		"appointment_title": appointment.Title,
+		"appointment_date":  startsAt.Format("Mon, Jan 2"),
+		"appointment_time":  startsAt.Format("3:04 PM"),
+	}
+	if contact != nil {
+		vars["contact_name"] = contact.ProfileName
+		vars["phone_number"] = contact.PhoneNumber
+	}
+	return vars
+}
+
+// AppointmentReminderProcessor sends appointment reminders when they are due
+type AppointmentReminderProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewAppointmentReminderProcessor creates a new appointment reminder processor
+func NewAppointmentReminderProcessor(app *App, interval time.Duration) *AppointmentReminderProcessor {
+	return &AppointmentReminderProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the appointment reminder processing loop
+func (p *AppointmentReminderProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Appointment reminder processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Appointment reminder processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Appointment reminder processor stopped")
+			return
+		case <-ticker.C:
+			p.processDueReminders(ctx)
+		}
+	}
+}
+
+// Stop stops the appointment reminder processor
+func (p *AppointmentReminderProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// processDueReminders sends pending reminders whose send time has passed
+func (p *AppointmentReminderProcessor) processDueReminders(ctx context.Context) {
+	var due []models.AppointmentReminder
+	if err := p.app.DB.Where("status = ? AND send_at <= ?", models.AppointmentReminderStatusPending, time.Now()).
+		Order("send_at ASC").
+		Limit(100).
+		Find(&due).Error; err != nil {
+		p.app.Log.Error("Failed to find due appointment reminders", "error", err)
+		return
+	}
+
+	for i := range due {
+		reminder := &due[i]
+
+		// Claim the reminder so a reschedule or a concurrent processor can't race it
+		now := time.Now()
+		result := p.app.DB.Model(reminder).
+			Where("status = ?", models.AppointmentReminderStatusPending).
+			Updates(map[string]interface{}{
+				"status":  models.AppointmentReminderStatusSent,
+				"sent_at": now,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		p.app.sendAppointmentReminder(ctx, reminder)
+	}
+}
+
+// sendAppointmentReminder sends the reminder template of a claimed reminder
+func (a *App) sendAppointmentReminder(ctx context.Context, reminder *models.AppointmentReminder) {
+	var appointment models.Appointment
+	if err := a.DB.Preload("Contact").Where("id = ?", reminder.AppointmentID).First(&appointment).Error; err != nil {
+		a.failAppointmentReminder(reminder, fmt.Errorf("appointment not found"))
+		return
+	}
+	if appointment.Status != models.AppointmentStatusScheduled {
+		a.DB.Model(reminder).Update("status", models.AppointmentReminderStatusCancelled)
+		return
+	}
+	if appointment.Contact == nil {
+		a.failAppointmentReminder(reminder, fmt.Errorf("contact not found"))
+		return
+	}
+	if appointment.ReminderTemplateID == nil {
+		a.failAppointmentReminder(reminder, fmt.Errorf("reminder template is not set"))
+		return
+	}
+
+	var template models.Template
+	if err := a.DB.Where("id = ? AND organization_id = ?", *appointment.ReminderTemplateID, appointment.OrganizationID).First(&template).Error; err != nil {
+		a.failAppointmentReminder(reminder, fmt.Errorf("reminder template not found"))
+		return
+	}
+	if template.Status != string(models.TemplateStatusApproved) {
+		a.failAppointmentReminder(reminder, fmt.Errorf("reminder template is not approved (status: %s)", template.Status))
+		return
+	}
+
+	account, err := a.resolveWhatsAppAccount(appointment.OrganizationID, appointment.WhatsAppAccount)
+	if err != nil {
+		a.failAppointmentReminder(reminder, err)
+		return
+	}
+
+	vars := appointmentTemplateVars(&appointment, appointment.Contact, a.contactLocation(appointment.Contact))
+	params := jsonbToStringMap(appointment.ReminderTemplateParams)
+	for k, v := range params {
+		params[k] = processTemplate(v, vars)
+	}
+
+	opts := DefaultSendOptions()
+	opts.SentByUserID = appointment.CreatedByID
+	opts.Async = false
+
+	message, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account:    account,
+		Contact:    appointment.Contact,
+		Type:       models.MessageTypeTemplate,
+		Template:   &template,
+		BodyParams: params,
+	}, opts)
+	if err != nil {
+		a.failAppointmentReminder(reminder, err)
+		return
+	}
+
+	updates := map[string]interface{}{"message_id": message.ID}
+	var sent models.Message
+	if err := a.DB.Select("status", "error_message").Where("id = ?", message.ID).First(&sent).Error; err == nil &&
+		sent.Status == models.MessageStatusFailed {
+		updates["status"] = models.AppointmentReminderStatusFailed
+		updates["error_message"] = sent.ErrorMessage
+	}
+	a.DB.Model(reminder).Updates(updates)
+
+	a.log(ctx).Info("Appointment reminder sent", "appointment_id", appointment.ID, "reminder_id", reminder.ID, "message_id", message.ID)
+}
+
+// failAppointmentReminder marks a reminder as failed
+func (a *App) failAppointmentReminder(reminder *models.AppointmentReminder, err error) {
+	a.Log.Error("Failed to send appointment reminder", "error", err, "reminder_id", reminder.ID)
+	a.DB.Model(reminder).Updates(map[string]interface{}{
+		"status":        models.AppointmentReminderStatusFailed,
+		"error_message": err.Error(),
+	})
+}
+
+// appointmentReplyStatus maps a reminder quick reply button to the appointment status it
+// requests. Returns an empty status for buttons that aren't cancel or reschedule.
+func appointmentReplyStatus(payload, text string) models.AppointmentStatus {
+	for _, value := range []string{payload, text} {
+		value = strings.ToLower(value)
+		switch {
+		case strings.Contains(value, "reschedule"):
+			return models.AppointmentStatusRescheduleRequested
+		case strings.Contains(value, "cancel"):
+			return models.AppointmentStatusCancelled
+		}
+	}
+	return ""
+}
+
+// handleAppointmentReply handles a cancel or reschedule button pressed on an appointment
+// reminder. Returns true if the reply belonged to a reminder and was handled.
+func (a *App) handleAppointmentReply(account *models.WhatsAppAccount, contact *models.Contact, replyToWAMID, payload, text string) bool {
+	status := appointmentReplyStatus(payload, text)
+	if status == "" {
+		return false
+	}
+
+	var reminderMsg models.Message
+	if err := a.DB.Select("id").Where("whats_app_message_id = ? AND contact_id = ?", replyToWAMID, contact.ID).
+		First(&reminderMsg).Error; err != nil {
+		return false
+	}
+	var reminder models.AppointmentReminder
+	if err := a.DB.Where("message_id = ?", reminderMsg.ID).First(&reminder).Error; err != nil {
+		return false
+	}
+	var appointment models.Appointment
+	if err := a.DB.Where("id = ? AND contact_id = ?", reminder.AppointmentID, contact.ID).First(&appointment).Error; err != nil {
+		return false
+	}
+
+	switch status {
+	case models.AppointmentStatusCancelled:
+		cancelled, err := a.cancelAppointment(&appointment)
+		if err != nil {
+			a.Log.Error("Failed to cancel appointment from reminder", "error", err, "appointment_id", appointment.ID)
+			return true
+		}
+		if !cancelled {
+			return true
+		}
+	case models.AppointmentStatusRescheduleRequested:
+		if appointment.Status != models.AppointmentStatusScheduled {
+			return true
+		}
+		err := a.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&appointment).Update("status", status).Error; err != nil {
+				return err
+			}
+			appointment.Status = status
+			return scheduleAppointmentReminders(tx, &appointment, time.Now())
+		})
+		if err != nil {
+			a.Log.Error("Failed to request appointment reschedule", "error", err, "appointment_id", appointment.ID)
+			return true
+		}
+	}
+
+	a.Log.Info("Appointment updated from reminder reply", "appointment_id", appointment.ID, "status", status)
+	a.notifyAppointmentUpdate(account, contact, &appointment)
+	return true
+}
+
+// notifyAppointmentUpdate lets the agent know the customer cancelled or asked to
+// reschedule. Reschedule requests without an agent are put in the transfer queue.
+func (a *App) notifyAppointmentUpdate(account *models.WhatsAppAccount, contact *models.Contact, appointment *models.Appointment) {
+	agentID := contact.AssignedUserID
+	if agentID == nil {
+		agentID = appointment.CreatedByID
+	}
+	if agentID == nil {
+		if appointment.Status == models.AppointmentStatusRescheduleRequested {
+			a.createTransferToQueue(account, contact, models.TransferSourceFlow)
+		}
+		return
+	}
+
+	if a.WSHub != nil {
+		a.WSHub.BroadcastToUser(appointment.OrganizationID, *agentID, websocket.WSMessage{
+			Type: websocket.TypeAppointmentUpdate,
+			Payload: map[string]any{
+				"id":           appointment.ID.String(),
+				"contact_id":   contact.ID.String(),
+				"contact_name": contact.ProfileName,
+				"phone_number": contact.PhoneNumber,
+				"title":        appointment.Title,
+				"starts_at":    appointment.StartsAt,
+				"status":       appointment.Status,
+			},
+		})
+	}
+}
+
+func appointmentToResponse(appt models.Appointment, maskPhone bool) AppointmentResponse {
+	resp := AppointmentResponse{
+		ID:                     appt.ID,
+		ContactID:              appt.ContactID,
+		WhatsAppAccount:        appt.WhatsAppAccount,
+		Title:                  appt.Title,
+		StartsAt:               appt.StartsAt,
+		DurationMinutes:        appt.DurationMinutes,
+		Notes:                  appt.Notes,
+		Status:                 appt.Status,
+		Source:                 appt.Source,
+		ReminderTemplateID:     appt.ReminderTemplateID,
+		ReminderTemplateParams: appt.ReminderTemplateParams,
+		ReminderOffsets:        jsonbToReminderOffsets(appt.ReminderOffsets),
+		Reminders:              make([]AppointmentReminderResponse, len(appt.Reminders)),
+		CreatedByID:            appt.CreatedByID,
+		CancelledAt:            appt.CancelledAt,
+		CalendarEventID:        appt.CalendarEventID,
+		CreatedAt:              appt.CreatedAt,
+		UpdatedAt:              appt.UpdatedAt,
+	}
+	if appt.Contact != nil {
+		resp.ContactName = appt.Contact.ProfileName
+		if maskPhone {
+			resp.ContactName = MaskIfPhoneNumber(resp.ContactName)
+		}
+	}
+	if appt.ReminderTemplate != nil {
+		resp.ReminderTemplateName = appt.ReminderTemplate.Name
+	}
+	for i, reminder := range appt.Reminders {
+		resp.Reminders[i] = AppointmentReminderResponse{
+			ID:            reminder.ID,
+			OffsetMinutes: reminder.OffsetMinutes,
+			SendAt:        reminder.SendAt,
+			Status:        reminder.Status,
+			MessageID:     reminder.MessageID,
+			SentAt:        reminder.SentAt,
+			ErrorMessage:  reminder.ErrorMessage,
+		}
+	}
+	return resp
+}
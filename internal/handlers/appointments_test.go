@@ -0,0 +1,180 @@
+package handlers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_CreateAppointment_SchedulesReminders(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	startsAt := time.Now().Add(72 * time.Hour).Truncate(time.Second)
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"contact_id":               contact.ID.String(),
+		"title":                    "Dental check-up",
+		"starts_at":                startsAt,
+		"reminder_template_id":     template.ID.String(),
+		"reminder_template_params": map[string]string{"1": "{{contact_name}}"},
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateAppointment(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp handlers.AppointmentResponse
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	assert.Equal(t, models.AppointmentStatusScheduled, resp.Status)
+	assert.Equal(t, models.AppointmentSourceAPI, resp.Source)
+	assert.Equal(t, []int{1440, 60}, resp.ReminderOffsets)
+	require.Len(t, resp.Reminders, 2)
+	assert.WithinDuration(t, startsAt.Add(-24*time.Hour), resp.Reminders[0].SendAt, time.Second)
+	assert.WithinDuration(t, startsAt.Add(-time.Hour), resp.Reminders[1].SendAt, time.Second)
+	assert.Equal(t, models.AppointmentReminderStatusPending, resp.Reminders[0].Status)
+}
+
+func TestApp_CreateAppointment_SkipsPastReminders(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	// Booked 3 hours ahead, so the 24h reminder is already past
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"contact_id":               contact.ID.String(),
+		"title":                    "Call back",
+		"starts_at":                time.Now().Add(3 * time.Hour),
+		"reminder_template_id":     template.ID.String(),
+		"reminder_template_params": map[string]string{"1": "there"},
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateAppointment(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp handlers.AppointmentResponse
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	require.Len(t, resp.Reminders, 1)
+	assert.Equal(t, 60, resp.Reminders[0].OffsetMinutes)
+}
+
+func TestApp_CreateAppointment_RequiresTitle(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"contact_id": contact.ID.String(),
+		"starts_at":  time.Now().Add(24 * time.Hour),
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateAppointment(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "title is required")
+}
+
+func TestApp_UpdateAppointment_RescheduleRebuildsReminders(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"contact_id":               contact.ID.String(),
+		"title":                    "Consultation",
+		"starts_at":                time.Now().Add(48 * time.Hour),
+		"reminder_template_id":     template.ID.String(),
+		"reminder_template_params": map[string]string{"1": "there"},
+	})
+	setAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.CreateAppointment(req))
+	var created handlers.AppointmentResponse
+	testutil.ParseEnvelopeResponse(t, req, &created)
+
+	// The customer asked for a new time
+	require.NoError(t, app.DB.Model(&models.Appointment{}).Where("id = ?", created.ID).
+		Update("status", models.AppointmentStatusRescheduleRequested).Error)
+
+	newStart := time.Now().Add(96 * time.Hour).Truncate(time.Second)
+	req = testutil.NewJSONRequest(t, map[string]any{"starts_at": newStart})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", created.ID.String())
+
+	require.NoError(t, app.UpdateAppointment(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var updated handlers.AppointmentResponse
+	testutil.ParseEnvelopeResponse(t, req, &updated)
+	assert.Equal(t, models.AppointmentStatusScheduled, updated.Status)
+
+	var pending []models.AppointmentReminder
+	require.NoError(t, app.DB.Where("appointment_id = ? AND status = ?", created.ID, models.AppointmentReminderStatusPending).
+		Order("send_at ASC").Find(&pending).Error)
+	require.Len(t, pending, 2)
+	assert.WithinDuration(t, newStart.Add(-24*time.Hour), pending[0].SendAt, time.Second)
+
+	var cancelled int64
+	app.DB.Model(&models.AppointmentReminder{}).
+		Where("appointment_id = ? AND status = ?", created.ID, models.AppointmentReminderStatusCancelled).
+		Count(&cancelled)
+	assert.Equal(t, int64(2), cancelled)
+}
+
+func TestApp_CancelAppointment(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"contact_id":               contact.ID.String(),
+		"title":                    "Consultation",
+		"starts_at":                time.Now().Add(48 * time.Hour),
+		"reminder_template_id":     template.ID.String(),
+		"reminder_template_params": map[string]string{"1": "there"},
+	})
+	setAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.CreateAppointment(req))
+	var created handlers.AppointmentResponse
+	testutil.ParseEnvelopeResponse(t, req, &created)
+
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", created.ID.String())
+
+	require.NoError(t, app.CancelAppointment(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var appointment models.Appointment
+	require.NoError(t, app.DB.First(&appointment, created.ID).Error)
+	assert.Equal(t, models.AppointmentStatusCancelled, appointment.Status)
+	assert.NotNil(t, appointment.CancelledAt)
+
+	var pending int64
+	app.DB.Model(&models.AppointmentReminder{}).
+		Where("appointment_id = ? AND status = ?", created.ID, models.AppointmentReminderStatusPending).
+		Count(&pending)
+	assert.Zero(t, pending)
+
+	// Cancelling again fails
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", created.ID.String())
+
+	require.NoError(t, app.CancelAppointment(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "already cancelled")
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/middleware"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// auditIgnoredFields change on every save and aren't useful in a diff
+var auditIgnoredFields = map[string]bool{
+	"id":         true,
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+}
+
+// auditRedactedFields hold secrets. Changes to them are recorded without the values.
+var auditRedactedFields = map[string]bool{
+	"api_key":             true,
+	"key_hash":            true,
+	"password_hash":       true,
+	"secret":              true,
+	"access_token":        true,
+	"client_secret":       true,
+	"secret_key":          true,
+	"webhook_secret":      true,
+	"auth_token":          true,
+	"service_account_key": true,
+	"slack_webhook_url":   true,
+}
+
+const auditRedacted = "[redacted]"
+
+// auditSnapshot captures the JSON fields of v, to diff against a later snapshot.
+// Take it before changing v, since maps in v may be modified in place.
+func auditSnapshot(v interface{}) map[string]interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var snapshot map[string]interface{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil
+	}
+	return snapshot
+}
+
+// auditDiff returns the fields that differ between two snapshots as
+// {"field": {"from": old, "to": new}}. A nil snapshot is a created or deleted resource.
+func auditDiff(before, after map[string]interface{}) models.JSONB {
+	changes := models.JSONB{}
+	for field, to := range after {
+		if auditIgnoredFields[field] {
+			continue
+		}
+		from, existed := before[field]
+		if existed && reflect.DeepEqual(from, to) {
+			continue
+		}
+		change := map[string]interface{}{"to": redactAuditValue(field, to)}
+		if existed {
+			change["from"] = redactAuditValue(field, from)
+		}
+		changes[field] = change
+	}
+	for field, from := range before {
+		if _, ok := after[field]; ok || auditIgnoredFields[field] {
+			continue
+		}
+		changes[field] = map[string]interface{}{"from": redactAuditValue(field, from)}
+	}
+	return changes
+}
+
+// redactAuditValue hides secret fields, including ones nested in objects and lists
+func redactAuditValue(field string, value interface{}) interface{} {
+	if auditRedactedFields[field] {
+		if value == nil || value == "" {
+			return value
+		}
+		return auditRedacted
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			redacted[k] = redactAuditValue(k, item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactAuditValue("", item)
+		}
+		return redacted
+	}
+	return value
+}
+
+// recordAudit appends an audit log entry for a change made by the request's user.
+// Changes to an existing resource that change nothing aren't recorded. Failures are logged and don't fail
+// the request, since the change has already been made.
+func (a *App) recordAudit(r *fastglue.Request, entry models.AuditLog, before, after map[string]interface{}) {
+	entry.Changes = auditDiff(before, after)
+	if before != nil && after != nil && len(entry.Changes) == 0 {
+		return
+	}
+
+	if userID, ok := r.RequestCtx.UserValue("user_id").(uuid.UUID); ok {
+		entry.UserID = &userID
+	}
+	entry.UserEmail, _ = r.RequestCtx.UserValue("email").(string)
+	entry.IPAddress = middleware.GetClientIP(r).String()
+	entry.UserAgent = string(r.RequestCtx.UserAgent())
+
+	if err := a.DB.Create(&entry).Error; err != nil {
+		a.Log.Error("Failed to write audit log", "error", err, "action", entry.Action, "resource_type", entry.ResourceType)
+	}
+}
+
+// ListAuditLogs lists the organization's audit log, newest first
+func (a *App) ListAuditLogs(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceAuditLogs, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	page, _ := strconv.Atoi(string(args.Peek("page")))
+	limit, _ := strconv.Atoi(string(args.Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := a.DB.Model(&models.AuditLog{}).Where("organization_id = ?", orgID)
+	for _, filter := range []string{"user_id", "resource_id"} {
+		if value := string(args.Peek(filter)); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid "+filter, nil, "")
+			}
+			query = query.Where(filter+" = ?", id)
+		}
+	}
+	for _, filter := range []string{"action", "resource_type"} {
+		if value := string(args.Peek(filter)); value != "" {
+			query = query.Where(filter+" = ?", value)
+		}
+	}
+	if from := string(args.Peek("from")); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid from date. Use RFC3339 format", nil, "")
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := string(args.Peek("to")); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid to date. Use RFC3339 format", nil, "")
+		}
+		query = query.Where("created_at < ?", t)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var entries []models.AuditLog
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&entries).Error; err != nil {
+		a.Log.Error("Failed to list audit logs", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list audit logs", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"entries": entries,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+func TestAuditDiff(t *testing.T) {
+	before := auditSnapshot(map[string]interface{}{
+		"name":       "Support",
+		"enabled":    true,
+		"updated_at": "2025-01-01T00:00:00Z",
+		"providers":  []map[string]interface{}{{"provider": "openai", "api_key": "sk-old"}},
+	})
+	after := auditSnapshot(map[string]interface{}{
+		"name":       "Support",
+		"enabled":    false,
+		"updated_at": "2025-01-02T00:00:00Z",
+		"providers":  []map[string]interface{}{{"provider": "openai", "api_key": "sk-new"}},
+	})
+
+	changes := auditDiff(before, after)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, map[string]interface{}{"from": true, "to": false}, changes["enabled"])
+
+	providers := changes["providers"].(map[string]interface{})
+	to := providers["to"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, auditRedacted, to["api_key"])
+	assert.Equal(t, "openai", to["provider"])
+
+	created := auditDiff(nil, map[string]interface{}{"name": "Support"})
+	assert.Equal(t, map[string]interface{}{"to": "Support"}, created["name"])
+
+	deleted := auditDiff(map[string]interface{}{"name": "Support"}, nil)
+	assert.Equal(t, map[string]interface{}{"from": "Support"}, deleted["name"])
+
+	assert.Empty(t, auditDiff(before, before))
+}
+
+func TestListAuditLogs_RecordsTemplateChanges(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	_, template, campaign := qualityTestFixture(t, app)
+	orgID := campaign.OrganizationID
+
+	user := &models.User{
+		OrganizationID: orgID,
+		Email:          "audit-" + uuid.New().String()[:8] + "@example.com",
+		FullName:       "Auditor",
+		IsSuperAdmin:   true,
+	}
+	require.NoError(t, app.DB.Create(user).Error)
+
+	newRequest := func() *fastglue.Request {
+		req := &fastglue.Request{RequestCtx: &fasthttp.RequestCtx{}}
+		req.RequestCtx.SetUserValue("user_id", user.ID)
+		req.RequestCtx.SetUserValue("organization_id", orgID)
+		req.RequestCtx.SetUserValue("email", user.Email)
+		return req
+	}
+
+	before := auditSnapshot(*template)
+	template.BodyContent = "Hi {{1}}"
+	app.recordAudit(newRequest(), models.AuditLog{
+		OrganizationID: orgID,
+		Action:         models.AuditActionUpdate,
+		ResourceType:   models.AuditResourceTemplate,
+		ResourceID:     &template.ID,
+		ResourceName:   template.Name,
+	}, before, auditSnapshot(*template))
+
+	// Saving without changes isn't recorded
+	app.recordAudit(newRequest(), models.AuditLog{
+		OrganizationID: orgID,
+		Action:         models.AuditActionUpdate,
+		ResourceType:   models.AuditResourceTemplate,
+		ResourceID:     &template.ID,
+	}, auditSnapshot(*template), auditSnapshot(*template))
+
+	req := newRequest()
+	req.RequestCtx.QueryArgs().Set("resource_type", models.AuditResourceTemplate)
+	require.NoError(t, app.ListAuditLogs(req))
+	require.Equal(t, fasthttp.StatusOK, req.RequestCtx.Response.StatusCode())
+
+	var resp struct {
+		Data struct {
+			Entries []models.AuditLog `json:"entries"`
+			Total   int64             `json:"total"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(req.RequestCtx.Response.Body(), &resp))
+	require.Equal(t, int64(1), resp.Data.Total)
+
+	entry := resp.Data.Entries[0]
+	assert.Equal(t, user.Email, entry.UserEmail)
+	assert.Equal(t, template.Name, entry.ResourceName)
+	assert.Equal(t, map[string]interface{}{"from": "Hello {{1}}", "to": "Hi {{1}}"}, entry.Changes["body_content"])
+}
+
+func TestOrganizationSettings_RecordsAudit(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	testutil.EnableEncryption(t)
+
+	org := &models.Organization{Name: "Audit Org", Slug: "audit-" + uuid.New().String()[:8]}
+	require.NoError(t, app.DB.Create(org).Error)
+	user := &models.User{
+		OrganizationID: org.ID,
+		Email:          "audit-" + uuid.New().String()[:8] + "@example.com",
+		FullName:       "Auditor",
+		IsSuperAdmin:   true,
+	}
+	require.NoError(t, app.DB.Create(user).Error)
+
+	newRequest := func(body any) *fastglue.Request {
+		req := testutil.NewJSONRequest(t, body)
+		req.RequestCtx.SetUserValue("user_id", user.ID)
+		req.RequestCtx.SetUserValue("organization_id", org.ID)
+		req.RequestCtx.SetUserValue("email", user.Email)
+		return req
+	}
+
+	req := newRequest(map[string]any{"require_2fa": true})
+	require.NoError(t, app.UpdateOrganizationSettings(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	payments := map[string]any{
+		"provider":       "stripe",
+		"secret_key":     "sk_live_123",
+		"webhook_secret": "whsec_123",
+		"success_url":    "https://example.com/paid",
+	}
+	for i := 0; i < 2; i++ {
+		// Saving the same credentials again isn't a change
+		req = newRequest(payments)
+		require.NoError(t, app.UpdatePaymentSettings(req))
+		require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	}
+
+	var entries []models.AuditLog
+	require.NoError(t, app.DB.Where("organization_id = ? AND resource_type = ?", org.ID, models.AuditResourceOrganizationSettings).
+		Order("created_at").Find(&entries).Error)
+	require.Len(t, entries, 2)
+	assert.Equal(t, user.Email, entries[0].UserEmail)
+	assert.Equal(t, map[string]interface{}{"to": true}, entries[0].Changes["require_2fa"])
+
+	section := entries[1].Changes["payments"].(map[string]interface{})["to"].(map[string]interface{})
+	assert.Equal(t, "stripe", section["provider"])
+	assert.Equal(t, auditRedacted, section["secret_key"])
+	assert.Equal(t, auditRedacted, section["webhook_secret"])
+}
@@ -47,31 +47,19 @@ func (a *App) Login(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
 	}
 
+	clientIP := middleware.GetClientIP(r)
+	if lockedFor := a.loginLockedFor(r.RequestCtx, req.Email, clientIP.String()); lockedFor > 0 {
+		return sendLoginLocked(r, lockedFor)
+	}
+
 	// Find user by email with role preloaded
 	var user models.User
 	if err := a.DB.Preload("Role").Where("email = ?", req.Email).First(&user).Error; err != nil {
+		a.recordLoginFailure(r.RequestCtx, req.Email, clientIP.String())
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Invalid credentials", nil, "")
 	}
 
-	// Load permissions from cache
-	if user.Role != nil && user.RoleID != nil {
-		cachedPerms, err := a.GetRolePermissionsCached(*user.RoleID)
-		if err == nil {
-			permissions := make([]models.Permission, 0, len(cachedPerms))
-			for _, p := range cachedPerms {
-				for i := len(p) - 1; i >= 0; i-- {
-					if p[i] == ':' {
-						permissions = append(permissions, models.Permission{
-							Resource: p[:i],
-							Action:   p[i+1:],
-						})
-						break
-					}
-				}
-			}
-			user.Role.Permissions = permissions
-		}
-	}
+	a.loadUserPermissions(&user)
 
 	// Check if user is active
 	if !user.IsActive {
@@ -80,26 +68,42 @@ func (a *App) Login(r *fastglue.Request) error {
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		a.recordLoginFailure(r.RequestCtx, req.Email, clientIP.String())
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Invalid credentials", nil, "")
 	}
 
-	// Generate tokens
-	accessToken, err := a.generateAccessToken(&user)
-	if err != nil {
-		a.Log.Error("Failed to generate access token", "error", err)
-		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to generate token", nil, "")
+	var org models.Organization
+	orgErr := a.DB.Select("id", "settings").Where("id = ?", user.OrganizationID).First(&org).Error
+
+	if !user.IsSuperAdmin && orgErr == nil && !middleware.IPAllowed(clientIP, a.OrgAllowedIPRanges(org.ID)) {
+		return middleware.SendIPNotAllowed(r, clientIP)
+	}
+
+	// Organizations enforcing SSO only allow password logins for super admins, so
+	// they can recover from a misconfigured provider
+	if !user.IsSuperAdmin && orgErr == nil && ssoEnforced(&org) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Your organization requires signing in with SSO", nil, "")
+	}
+
+	// Tokens are only issued once the second factor is verified
+	if user.TwoFactorEnabled {
+		return a.sendTwoFactorChallenge(r, &user, false)
+	}
+	if orgErr == nil && twoFactorRequired(&org) {
+		return a.sendTwoFactorChallenge(r, &user, true)
 	}
 
-	refreshToken, err := a.generateRefreshToken(&user)
+	accessToken, refreshToken, err := a.generateTokenPair(&user)
 	if err != nil {
-		a.Log.Error("Failed to generate refresh token", "error", err)
+		a.Log.Error("Failed to generate tokens", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to generate token", nil, "")
 	}
+	a.clearLoginFailures(r.RequestCtx, req.Email)
 
 	return r.SendEnvelope(AuthResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		ExpiresIn:    a.Config.JWT.AccessExpiryMins * 60,
+		ExpiresIn:    a.CurrentConfig().JWT.AccessExpiryMins * 60,
 		User:         user,
 	})
 }
@@ -129,6 +133,7 @@ func (a *App) Register(r *fastglue.Request) error {
 		Name: req.OrganizationName,
 		Slug: generateSlug(req.OrganizationName),
 	}
+	a.startTrial(&org, time.Now())
 
 	// Start transaction
 	tx := a.DB.Begin()
@@ -208,7 +213,7 @@ func (a *App) Register(r *fastglue.Request) error {
 	return r.SendEnvelope(AuthResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		ExpiresIn:    a.Config.JWT.AccessExpiryMins * 60,
+		ExpiresIn:    a.CurrentConfig().JWT.AccessExpiryMins * 60,
 		User:         user,
 	})
 }
@@ -222,7 +227,7 @@ func (a *App) RefreshToken(r *fastglue.Request) error {
 
 	// Parse and validate refresh token
 	token, err := jwt.ParseWithClaims(req.RefreshToken, &middleware.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(a.Config.JWT.Secret), nil
+		return []byte(a.CurrentConfig().JWT.Secret), nil
 	})
 
 	if err != nil || !token.Valid {
@@ -251,11 +256,48 @@ func (a *App) RefreshToken(r *fastglue.Request) error {
 	return r.SendEnvelope(AuthResponse{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
-		ExpiresIn:    a.Config.JWT.AccessExpiryMins * 60,
+		ExpiresIn:    a.CurrentConfig().JWT.AccessExpiryMins * 60,
 		User:         user,
 	})
 }
 
+// loadUserPermissions fills in the permissions of the user's role from the cache
+func (a *App) loadUserPermissions(user *models.User) {
+	if user.Role == nil || user.RoleID == nil {
+		return
+	}
+	cachedPerms, err := a.GetRolePermissionsCached(*user.RoleID)
+	if err != nil {
+		return
+	}
+	permissions := make([]models.Permission, 0, len(cachedPerms))
+	for _, p := range cachedPerms {
+		for i := len(p) - 1; i >= 0; i-- {
+			if p[i] == ':' {
+				permissions = append(permissions, models.Permission{
+					Resource: p[:i],
+					Action:   p[i+1:],
+				})
+				break
+			}
+		}
+	}
+	user.Role.Permissions = permissions
+}
+
+// generateTokenPair returns a new access token and refresh token for the user
+func (a *App) generateTokenPair(user *models.User) (string, string, error) {
+	accessToken, err := a.generateAccessToken(user)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := a.generateRefreshToken(user)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
 func (a *App) generateAccessToken(user *models.User) (string, error) {
 	claims := middleware.JWTClaims{
 		UserID:         user.ID,
@@ -264,14 +306,14 @@ func (a *App) generateAccessToken(user *models.User) (string, error) {
 		RoleID:         user.RoleID,
 		IsSuperAdmin:   user.IsSuperAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(a.Config.JWT.AccessExpiryMins) * time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(a.CurrentConfig().JWT.AccessExpiryMins) * time.Minute)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "whatomate",
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(a.Config.JWT.Secret))
+	return token.SignedString([]byte(a.CurrentConfig().JWT.Secret))
 }
 
 func (a *App) generateRefreshToken(user *models.User) (string, error) {
@@ -282,14 +324,14 @@ func (a *App) generateRefreshToken(user *models.User) (string, error) {
 		RoleID:         user.RoleID,
 		IsSuperAdmin:   user.IsSuperAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(a.Config.JWT.RefreshExpiryDays) * 24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(a.CurrentConfig().JWT.RefreshExpiryDays) * 24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "whatomate",
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(a.Config.JWT.Secret))
+	return token.SignedString([]byte(a.CurrentConfig().JWT.Secret))
 }
 
 func generateSlug(name string) string {
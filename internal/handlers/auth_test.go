@@ -1,7 +1,12 @@
 package handlers_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
 	"testing"
 	"time"
 
@@ -205,6 +210,197 @@ func TestApp_Login_InactiveUser(t *testing.T) {
 	assertErrorResponse(t, req, fasthttp.StatusUnauthorized, "Account is disabled")
 }
 
+func TestApp_Login_EnforcedSSO(t *testing.T) {
+	app := testApp(t)
+	org := createTestOrganization(t, app)
+	require.NoError(t, app.DB.Model(org).Update("settings", models.JSONB{"enforce_sso": true}).Error)
+
+	email := uniqueEmail("enforced-sso")
+	createTestUser(t, app, org.ID, email, "validpassword123", nil, true)
+
+	req := testutil.NewJSONRequest(t, map[string]string{
+		"email":    email,
+		"password": "validpassword123",
+	})
+	require.NoError(t, app.Login(req))
+	assertErrorResponse(t, req, fasthttp.StatusForbidden, "requires signing in with SSO")
+
+	// Super admins can still use their password
+	adminEmail := uniqueEmail("enforced-sso-admin")
+	admin := createTestUser(t, app, org.ID, adminEmail, "validpassword123", nil, true)
+	require.NoError(t, app.DB.Model(admin).Update("is_super_admin", true).Error)
+
+	req = testutil.NewJSONRequest(t, map[string]string{
+		"email":    adminEmail,
+		"password": "validpassword123",
+	})
+	require.NoError(t, app.Login(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+}
+
+func TestApp_Login_TwoFactor(t *testing.T) {
+	app := testApp(t)
+	if app.Redis == nil {
+		t.Skip("TEST_REDIS_URL not set, skipping two-factor test")
+	}
+	org := createTestOrganization(t, app)
+	email := uniqueEmail("two-factor")
+	user := createTestUser(t, app, org.ID, email, "validpassword123", nil, true)
+
+	backupCode := "abcd-efgh"
+	backupHash := sha256.Sum256([]byte("abcdefgh"))
+	require.NoError(t, app.DB.Model(user).Updates(map[string]interface{}{
+		"two_factor_enabled":      true,
+		"totp_secret":             "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"two_factor_backup_codes": models.StringArray{hex.EncodeToString(backupHash[:])},
+	}).Error)
+
+	login := func() string {
+		req := testutil.NewJSONRequest(t, map[string]string{"email": email, "password": "validpassword123"})
+		require.NoError(t, app.Login(req))
+		require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+		var resp struct {
+			Data struct {
+				AccessToken       string `json:"access_token"`
+				TwoFactorRequired bool   `json:"two_factor_required"`
+				TwoFactorToken    string `json:"two_factor_token"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &resp))
+		assert.True(t, resp.Data.TwoFactorRequired)
+		assert.Empty(t, resp.Data.AccessToken, "no tokens before the second factor")
+		return resp.Data.TwoFactorToken
+	}
+
+	token := login()
+	req := testutil.NewJSONRequest(t, map[string]string{"two_factor_token": token, "code": "000000"})
+	require.NoError(t, app.VerifyTwoFactorLogin(req))
+	assertErrorResponse(t, req, fasthttp.StatusUnauthorized, "Invalid code")
+
+	req = testutil.NewJSONRequest(t, map[string]string{"two_factor_token": token, "code": backupCode})
+	require.NoError(t, app.VerifyTwoFactorLogin(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	assert.Contains(t, string(testutil.GetResponseBody(req)), "access_token")
+
+	// Backup codes only work once
+	req = testutil.NewJSONRequest(t, map[string]string{"two_factor_token": login(), "code": backupCode})
+	require.NoError(t, app.VerifyTwoFactorLogin(req))
+	assertErrorResponse(t, req, fasthttp.StatusUnauthorized, "Invalid code")
+}
+
+func TestApp_Login_Required2FASetup(t *testing.T) {
+	app := testApp(t)
+	if app.Redis == nil {
+		t.Skip("TEST_REDIS_URL not set, skipping two-factor test")
+	}
+	org := createTestOrganization(t, app)
+	require.NoError(t, app.DB.Model(org).Update("settings", models.JSONB{"require_2fa": true}).Error)
+	email := uniqueEmail("require-2fa")
+	createTestUser(t, app, org.ID, email, "validpassword123", nil, true)
+
+	req := testutil.NewJSONRequest(t, map[string]string{"email": email, "password": "validpassword123"})
+	require.NoError(t, app.Login(req))
+
+	var resp struct {
+		Data struct {
+			SetupRequired  bool   `json:"setup_required"`
+			TwoFactorToken string `json:"two_factor_token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &resp))
+	assert.True(t, resp.Data.SetupRequired)
+
+	req = testutil.NewJSONRequest(t, map[string]string{"two_factor_token": resp.Data.TwoFactorToken})
+	require.NoError(t, app.SetupTwoFactorLogin(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	assert.Contains(t, string(testutil.GetResponseBody(req)), "otpauth://totp/")
+}
+
+// loginFrom logs in from a client IP address.
+func loginFrom(t *testing.T, app *handlers.App, email, password, ip string) *fastglue.Request {
+	t.Helper()
+
+	req := testutil.NewJSONRequest(t, map[string]string{"email": email, "password": password})
+	req.RequestCtx.SetRemoteAddr(&net.TCPAddr{IP: net.ParseIP(ip), Port: 40000})
+	require.NotNil(t, middleware.ClientIP(nil)(req))
+	require.NoError(t, app.Login(req))
+	return req
+}
+
+// randomIP returns a random address in 198.18.0.0/15, so tests don't share failure counts.
+func randomIP() string {
+	id := uuid.New()
+	return fmt.Sprintf("198.%d.%d.%d", 18+id[0]%2, id[1], id[2])
+}
+
+func TestApp_Login_AccountLockout(t *testing.T) {
+	app := testApp(t)
+	if app.Redis == nil {
+		t.Skip("TEST_REDIS_URL not set, skipping lockout test")
+	}
+	app.Config.Security = config.SecurityConfig{LoginMaxAttempts: 3, LoginLockoutMins: 15}
+	org := createTestOrganization(t, app)
+	email := uniqueEmail("lockout")
+	createTestUser(t, app, org.ID, email, "validpassword123", nil, true)
+
+	for i := 0; i < 3; i++ {
+		req := loginFrom(t, app, email, "wrongpassword", randomIP())
+		assertErrorResponse(t, req, fasthttp.StatusUnauthorized, "Invalid credentials")
+	}
+
+	// Locked, even with the right password and from another IP
+	req := loginFrom(t, app, email, "validpassword123", randomIP())
+	assertErrorResponse(t, req, fasthttp.StatusTooManyRequests, "Too many failed login attempts")
+	retryAfter, err := strconv.Atoi(string(req.RequestCtx.Response.Header.Peek("Retry-After")))
+	require.NoError(t, err)
+	assert.InDelta(t, 15*60, retryAfter, 5)
+
+	var resp struct {
+		Data struct {
+			Reason     string `json:"reason"`
+			RetryAfter int    `json:"retry_after"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &resp))
+	assert.Equal(t, "login_locked", resp.Data.Reason)
+	assert.Equal(t, retryAfter, resp.Data.RetryAfter)
+}
+
+func TestApp_Login_IPLockout(t *testing.T) {
+	app := testApp(t)
+	if app.Redis == nil {
+		t.Skip("TEST_REDIS_URL not set, skipping lockout test")
+	}
+	app.Config.Security = config.SecurityConfig{LoginMaxAttempts: 5, LoginMaxAttemptsPerIP: 2, LoginLockoutMins: 15}
+	org := createTestOrganization(t, app)
+	email := uniqueEmail("ip-lockout")
+	createTestUser(t, app, org.ID, email, "validpassword123", nil, true)
+	ip := randomIP()
+
+	// A successful login only forgets the account's failures
+	assertErrorResponse(t, loginFrom(t, app, uniqueEmail("guess"), "password1", ip), fasthttp.StatusUnauthorized, "Invalid credentials")
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(loginFrom(t, app, email, "validpassword123", ip)))
+	assertErrorResponse(t, loginFrom(t, app, uniqueEmail("guess"), "password2", ip), fasthttp.StatusUnauthorized, "Invalid credentials")
+
+	assertErrorResponse(t, loginFrom(t, app, email, "validpassword123", ip), fasthttp.StatusTooManyRequests, "Too many failed login attempts")
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(loginFrom(t, app, email, "validpassword123", randomIP())))
+}
+
+func TestApp_Login_OrganizationAllowedIPs(t *testing.T) {
+	app := testApp(t)
+	org := createTestOrganization(t, app)
+	require.NoError(t, app.DB.Model(org).Update("settings", models.JSONB{"allowed_ips": []string{"203.0.113.0/24"}}).Error)
+	email := uniqueEmail("allowed-ips")
+	createTestUser(t, app, org.ID, email, "validpassword123", nil, true)
+
+	req := loginFrom(t, app, email, "validpassword123", "198.51.100.1")
+	assertErrorResponse(t, req, fasthttp.StatusForbidden, "ip_not_allowed")
+
+	req = loginFrom(t, app, email, "validpassword123", "203.0.113.9")
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+}
+
 func TestApp_Login_InvalidRequestBody(t *testing.T) {
 	app := testApp(t)
 
@@ -0,0 +1,795 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// AutomationCondition is a single check of an automation rule. Field is a dotted path
+// into the event data, e.g. "source" or "contact.tags".
+type AutomationCondition struct {
+	Field    string                    `json:"field"`
+	Operator models.AutomationOperator `json:"operator"`
+	Value    string                    `json:"value"`
+}
+
+// AutomationAction is a single step run when an automation rule matches
+type AutomationAction struct {
+	Type   models.AutomationActionType `json:"type"`
+	Config map[string]interface{}      `json:"config"`
+}
+
+// AutomationRequest represents the request body for creating/updating an automation
+type AutomationRequest struct {
+	Name        string                `json:"name"`
+	Description *string               `json:"description"`
+	Event       string                `json:"event"`
+	Conditions  []AutomationCondition `json:"conditions"`
+	Actions     []AutomationAction    `json:"actions"`
+	IsActive    *bool                 `json:"is_active"`
+}
+
+// AutomationResponse represents an automation in API responses
+type AutomationResponse struct {
+	ID              uuid.UUID             `json:"id"`
+	Name            string                `json:"name"`
+	Description     string                `json:"description"`
+	Event           models.WebhookEvent   `json:"event"`
+	Conditions      []AutomationCondition `json:"conditions"`
+	Actions         []AutomationAction    `json:"actions"`
+	IsActive        bool                  `json:"is_active"`
+	TriggerCount    int                   `json:"trigger_count"`
+	LastTriggeredAt *time.Time            `json:"last_triggered_at,omitempty"`
+	CreatedAt       time.Time             `json:"created_at"`
+	UpdatedAt       time.Time             `json:"updated_at"`
+}
+
+// AvailableAutomationActions lists the actions an automation can run
+var AvailableAutomationActions = []map[string]string{
+	{"value": string(models.AutomationActionSendTemplate), "label": "Send Template", "description": "Send an approved template to the contact"},
+	{"value": string(models.AutomationActionSendText), "label": "Send Message", "description": "Send a text message to the contact while the 24-hour window is open"},
+	{"value": string(models.AutomationActionAddTag), "label": "Add Tag", "description": "Add a tag to the contact"},
+	{"value": string(models.AutomationActionRemoveTag), "label": "Remove Tag", "description": "Remove a tag from the contact"},
+	{"value": string(models.AutomationActionWebhook), "label": "Call Webhook", "description": "POST the event to a URL"},
+	{"value": string(models.AutomationActionSlack), "label": "Notify Slack", "description": "Post a message to a Slack incoming webhook"},
+}
+
+// ListAutomations returns all automations for the organization
+func (a *App) ListAutomations(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceWebhooks, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	query := a.DB.Where("organization_id = ?", orgID)
+	if event := string(r.RequestCtx.QueryArgs().Peek("event")); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	var automations []models.Automation
+	if err := query.Order("created_at DESC").Find(&automations).Error; err != nil {
+		a.Log.Error("Failed to list automations", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list automations", nil, "")
+	}
+
+	result := make([]AutomationResponse, len(automations))
+	for i, automation := range automations {
+		result[i] = automationToResponse(automation)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"automations":       result,
+		"available_events":  AvailableWebhookEvents,
+		"available_actions": AvailableAutomationActions,
+	})
+}
+
+// GetAutomation returns a single automation by ID
+func (a *App) GetAutomation(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceWebhooks, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	automation, err := a.findAutomation(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Automation not found", nil, "")
+	}
+
+	return r.SendEnvelope(automationToResponse(*automation))
+}
+
+// CreateAutomation creates a new automation
+func (a *App) CreateAutomation(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceWebhooks, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	if !a.HasFeature(orgID, models.PlanFeatureAutomations) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureAutomations), nil, "")
+	}
+
+	var req AutomationRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	automation := models.Automation{
+		OrganizationID: orgID,
+		Name:           strings.TrimSpace(req.Name),
+		Event:          models.WebhookEvent(req.Event),
+		IsActive:       true,
+	}
+	if userID != uuid.Nil {
+		automation.CreatedByID = &userID
+	}
+	if req.Description != nil {
+		automation.Description = *req.Description
+	}
+	if req.IsActive != nil {
+		automation.IsActive = *req.IsActive
+	}
+
+	if err := validateAutomation(automation.Name, automation.Event, req.Conditions, req.Actions); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	if err := a.validateAutomationTemplates(orgID, req.Actions); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	automation.Conditions = automationConditionsToJSONB(req.Conditions)
+	automation.Actions = automationActionsToJSONB(req.Actions)
+
+	if err := a.DB.Create(&automation).Error; err != nil {
+		a.Log.Error("Failed to create automation", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create automation", nil, "")
+	}
+
+	a.InvalidateAutomationsCache(orgID)
+
+	return r.SendEnvelope(automationToResponse(automation))
+}
+
+// UpdateAutomation updates an existing automation. Omitted fields are left unchanged.
+func (a *App) UpdateAutomation(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceWebhooks, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	automation, err := a.findAutomation(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Automation not found", nil, "")
+	}
+
+	var req AutomationRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	if req.Name != "" {
+		automation.Name = strings.TrimSpace(req.Name)
+	}
+	if req.Description != nil {
+		automation.Description = *req.Description
+	}
+	if req.Event != "" {
+		automation.Event = models.WebhookEvent(req.Event)
+	}
+	conditions := decodeAutomationConditions(automation.Conditions)
+	if req.Conditions != nil {
+		conditions = req.Conditions
+	}
+	actions := decodeAutomationActions(automation.Actions)
+	if req.Actions != nil {
+		actions = req.Actions
+	}
+	if req.IsActive != nil {
+		automation.IsActive = *req.IsActive
+	}
+
+	if err := validateAutomation(automation.Name, automation.Event, conditions, actions); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	if err := a.validateAutomationTemplates(orgID, actions); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	automation.Conditions = automationConditionsToJSONB(conditions)
+	automation.Actions = automationActionsToJSONB(actions)
+
+	if err := a.DB.Save(automation).Error; err != nil {
+		a.Log.Error("Failed to update automation", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update automation", nil, "")
+	}
+
+	a.InvalidateAutomationsCache(orgID)
+
+	return r.SendEnvelope(automationToResponse(*automation))
+}
+
+// DeleteAutomation deletes an automation and its execution logs
+func (a *App) DeleteAutomation(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceWebhooks, models.ActionDelete) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	automationID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid automation ID", nil, "")
+	}
+
+	var deleted int64
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND organization_id = ?", automationID, orgID).Delete(&models.Automation{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Where("automation_id = ?", automationID).Delete(&models.AutomationLog{}).Error
+	})
+	if err != nil {
+		a.Log.Error("Failed to delete automation", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete automation", nil, "")
+	}
+	if deleted == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Automation not found", nil, "")
+	}
+
+	a.InvalidateAutomationsCache(orgID)
+
+	return r.SendEnvelope(map[string]string{"message": "Automation deleted successfully"})
+}
+
+// ListAutomationLogs returns the execution logs of an automation, newest first
+func (a *App) ListAutomationLogs(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceWebhooks, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	automation, err := a.findAutomation(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Automation not found", nil, "")
+	}
+
+	page, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("page")))
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := a.DB.Model(&models.AutomationLog{}).Where("automation_id = ?", automation.ID)
+	if status := string(r.RequestCtx.QueryArgs().Peek("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var logs []models.AutomationLog
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&logs).Error; err != nil {
+		a.Log.Error("Failed to list automation logs", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list automation logs", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"logs":  logs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// findAutomation loads the automation in the {id} path parameter
+func (a *App) findAutomation(r *fastglue.Request, orgID uuid.UUID) (*models.Automation, error) {
+	automationID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	var automation models.Automation
+	if err := a.DB.Where("id = ? AND organization_id = ?", automationID, orgID).First(&automation).Error; err != nil {
+		return nil, err
+	}
+	return &automation, nil
+}
+
+// validateAutomation checks that a rule has a known event, well-formed conditions
+// and at least one action with the configuration it needs
+func validateAutomation(name string, event models.WebhookEvent, conditions []AutomationCondition, actions []AutomationAction) error {
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if !isAutomationEvent(event) {
+		return fmt.Errorf("unknown event: %s", event)
+	}
+
+	for i, cond := range conditions {
+		if strings.TrimSpace(cond.Field) == "" {
+			return fmt.Errorf("condition %d: field is required", i+1)
+		}
+		switch cond.Operator {
+		case models.AutomationOperatorEquals, models.AutomationOperatorNotEquals,
+			models.AutomationOperatorContains, models.AutomationOperatorNotContains,
+			models.AutomationOperatorIsEmpty, models.AutomationOperatorIsNotEmpty:
+		default:
+			return fmt.Errorf("condition %d: unknown operator: %s", i+1, cond.Operator)
+		}
+	}
+
+	if len(actions) == 0 {
+		return errors.New("at least one action is required")
+	}
+	for i, action := range actions {
+		var required []string
+		switch action.Type {
+		case models.AutomationActionSendTemplate:
+			required = []string{"template_id"}
+		case models.AutomationActionSendText:
+			required = []string{"body"}
+		case models.AutomationActionAddTag, models.AutomationActionRemoveTag:
+			required = []string{"tag"}
+		case models.AutomationActionWebhook:
+			required = []string{"url"}
+		case models.AutomationActionSlack:
+			required = []string{"webhook_url", "text"}
+		default:
+			return fmt.Errorf("action %d: unknown action type: %s", i+1, action.Type)
+		}
+		for _, key := range required {
+			if strings.TrimSpace(getStringFromMap(action.Config, key)) == "" {
+				return fmt.Errorf("action %d: %s is required for %s", i+1, key, action.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// validateAutomationTemplates checks that the templates of send_template actions belong to the organization
+func (a *App) validateAutomationTemplates(orgID uuid.UUID, actions []AutomationAction) error {
+	for i, action := range actions {
+		if action.Type != models.AutomationActionSendTemplate {
+			continue
+		}
+		templateID, err := uuid.Parse(getStringFromMap(action.Config, "template_id"))
+		if err != nil {
+			return fmt.Errorf("action %d: invalid template_id", i+1)
+		}
+		var count int64
+		a.DB.Model(&models.Template{}).Where("id = ? AND organization_id = ?", templateID, orgID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("action %d: template not found", i+1)
+		}
+	}
+	return nil
+}
+
+// isAutomationEvent reports whether automations can subscribe to the event
+func isAutomationEvent(event models.WebhookEvent) bool {
+	for _, e := range AvailableWebhookEvents {
+		if e["value"] == string(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// runAutomations evaluates the organization's active automations for an event and
+// runs the actions of every rule whose conditions match
+func (a *App) runAutomations(ctx context.Context, orgID uuid.UUID, eventType models.WebhookEvent, data interface{}) {
+	if !a.HasFeature(orgID, models.PlanFeatureAutomations) {
+		return
+	}
+
+	automations, err := a.getAutomationsCached(orgID)
+	if err != nil {
+		a.log(ctx).Error("Failed to fetch automations", "error", err)
+		return
+	}
+
+	var fields map[string]interface{}
+	var contact *models.Contact
+	for i := range automations {
+		automation := &automations[i]
+		if automation.Event != eventType {
+			continue
+		}
+		if ctx.Err() != nil {
+			a.log(ctx).Warn("Automation run cancelled", "reason", ctx.Err())
+			return
+		}
+
+		// Only build the event fields once a rule subscribes to the event
+		if fields == nil {
+			fields, contact = a.automationEventFields(orgID, data)
+		}
+		if !matchAutomationConditions(decodeAutomationConditions(automation.Conditions), fields) {
+			continue
+		}
+		// Earlier rules may take a while; don't act on a message the contact has since
+		// edited or deleted
+		if (eventType == models.WebhookEventMessageIncoming || eventType == models.WebhookEventButtonReply) &&
+			a.messageRetracted("id = ?", getStringFromMap(fields, "message_id")) {
+			a.log(ctx).Info("Skipping automations for a retracted message", "message_id", fields["message_id"])
+			return
+		}
+		a.executeAutomation(ctx, automation, eventType, fields, contact)
+	}
+}
+
+// automationEventFields flattens event data into the fields conditions and templates can
+// reference. When the event has a contact_id the contact is loaded and exposed as "contact".
+func (a *App) automationEventFields(orgID uuid.UUID, data interface{}) (map[string]interface{}, *models.Contact) {
+	fields := map[string]interface{}{}
+	if raw, err := json.Marshal(data); err == nil {
+		_ = json.Unmarshal(raw, &fields)
+	}
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+
+	contactID, err := uuid.Parse(getStringFromMap(fields, "contact_id"))
+	if err != nil {
+		return fields, nil
+	}
+	var contact models.Contact
+	if err := a.DB.Where("id = ? AND organization_id = ?", contactID, orgID).First(&contact).Error; err != nil {
+		return fields, nil
+	}
+
+	contactFields := map[string]interface{}{}
+	if raw, err := json.Marshal(map[string]interface{}{
+		"id":               contact.ID,
+		"name":             contact.ProfileName,
+		"phone_number":     contact.PhoneNumber,
+		"whatsapp_account": contact.WhatsAppAccount,
+		"assigned_user_id": contact.AssignedUserID,
+		"timezone":         contact.Timezone,
+		"tags":             contact.Tags,
+		"metadata":         contact.Metadata,
+	}); err == nil {
+		_ = json.Unmarshal(raw, &contactFields)
+	}
+	fields["contact"] = contactFields
+	return fields, &contact
+}
+
+// matchAutomationConditions reports whether all conditions match the event fields
+func matchAutomationConditions(conditions []AutomationCondition, fields map[string]interface{}) bool {
+	for _, cond := range conditions {
+		if !matchAutomationCondition(cond, getNestedValue(fields, cond.Field)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAutomationCondition compares a field value case-insensitively. For list fields
+// such as contact.tags, equals and contains match when any element does.
+func matchAutomationCondition(cond AutomationCondition, value interface{}) bool {
+	if list, ok := value.([]interface{}); ok {
+		switch cond.Operator {
+		case models.AutomationOperatorIsEmpty:
+			return len(list) == 0
+		case models.AutomationOperatorIsNotEmpty:
+			return len(list) > 0
+		}
+		found := false
+		for _, item := range list {
+			if strings.EqualFold(formatValue(item), cond.Value) {
+				found = true
+				break
+			}
+		}
+		if cond.Operator == models.AutomationOperatorNotEquals || cond.Operator == models.AutomationOperatorNotContains {
+			return !found
+		}
+		return found
+	}
+
+	actual := ""
+	if value != nil {
+		actual = formatValue(value)
+	}
+	switch cond.Operator {
+	case models.AutomationOperatorEquals:
+		return strings.EqualFold(actual, cond.Value)
+	case models.AutomationOperatorNotEquals:
+		return !strings.EqualFold(actual, cond.Value)
+	case models.AutomationOperatorContains:
+		return strings.Contains(strings.ToLower(actual), strings.ToLower(cond.Value))
+	case models.AutomationOperatorNotContains:
+		return !strings.Contains(strings.ToLower(actual), strings.ToLower(cond.Value))
+	case models.AutomationOperatorIsEmpty:
+		return actual == ""
+	case models.AutomationOperatorIsNotEmpty:
+		return actual != ""
+	}
+	return false
+}
+
+// executeAutomation runs every action of a matched automation and records the execution.
+// A failed action does not stop the ones after it.
+func (a *App) executeAutomation(ctx context.Context, automation *models.Automation, eventType models.WebhookEvent, fields map[string]interface{}, contact *models.Contact) {
+	start := time.Now()
+	status := models.AutomationLogStatusSuccess
+	var failures []string
+
+	actions := decodeAutomationActions(automation.Actions)
+	results := make(models.JSONBArray, 0, len(actions))
+	for i, action := range actions {
+		result := map[string]interface{}{"type": action.Type, "status": models.AutomationLogStatusSuccess}
+		if err := a.runAutomationAction(ctx, automation, eventType, action, fields, contact); err != nil {
+			result["status"] = models.AutomationLogStatusFailed
+			result["error"] = err.Error()
+			status = models.AutomationLogStatusFailed
+			failures = append(failures, fmt.Sprintf("action %d (%s): %v", i+1, action.Type, err))
+		}
+		results = append(results, result)
+	}
+
+	log := models.AutomationLog{
+		AutomationID:   automation.ID,
+		OrganizationID: automation.OrganizationID,
+		Event:          eventType,
+		Status:         status,
+		EventData:      models.JSONB(fields),
+		ActionResults:  results,
+		ErrorMessage:   strings.Join(failures, "; "),
+		DurationMs:     time.Since(start).Milliseconds(),
+	}
+	if contact != nil {
+		log.ContactID = &contact.ID
+	}
+	if err := a.DB.Create(&log).Error; err != nil {
+		a.log(ctx).Error("Failed to save automation log", "error", err, "automation_id", automation.ID)
+	}
+
+	a.DB.Model(&models.Automation{}).Where("id = ?", automation.ID).Updates(map[string]interface{}{
+		"trigger_count":     gorm.Expr("trigger_count + 1"),
+		"last_triggered_at": start,
+	})
+
+	a.log(ctx).Info("Automation executed", "automation_id", automation.ID, "event", eventType, "status", status)
+}
+
+// errAutomationNoContact is returned by contact actions on events without a contact
+var errAutomationNoContact = errors.New("event has no contact")
+
+// runAutomationAction runs a single automation action. Config strings may reference
+// event fields with {{placeholders}}, e.g. {{contact.name}}.
+func (a *App) runAutomationAction(ctx context.Context, automation *models.Automation, eventType models.WebhookEvent, action AutomationAction, fields map[string]interface{}, contact *models.Contact) error {
+	switch action.Type {
+	case models.AutomationActionSendTemplate:
+		if contact == nil {
+			return errAutomationNoContact
+		}
+		var template models.Template
+		if err := a.DB.Where("id = ? AND organization_id = ?", getStringFromMap(action.Config, "template_id"), automation.OrganizationID).
+			First(&template).Error; err != nil {
+			return fmt.Errorf("template not found")
+		}
+		if template.Status != string(models.TemplateStatusApproved) {
+			return fmt.Errorf("template is not approved (status: %s)", template.Status)
+		}
+		params := map[string]string{}
+		if stored, ok := action.Config["params"].(map[string]interface{}); ok {
+			for k, v := range stored {
+				params[k] = processTemplate(fmt.Sprint(v), fields)
+			}
+		}
+		return a.sendAutomationMessage(ctx, contact, OutgoingMessageRequest{
+			Type:       models.MessageTypeTemplate,
+			Template:   &template,
+			BodyParams: params,
+		})
+
+	case models.AutomationActionSendText:
+		if contact == nil {
+			return errAutomationNoContact
+		}
+		if !isServiceWindowOpen(a.serviceWindowExpiresAt(contact), time.Now()) {
+			return errors.New(serviceWindowClosedMessage)
+		}
+		return a.sendAutomationMessage(ctx, contact, OutgoingMessageRequest{
+			Type:    models.MessageTypeText,
+			Content: processTemplate(getStringFromMap(action.Config, "body"), fields),
+		})
+
+	case models.AutomationActionAddTag, models.AutomationActionRemoveTag:
+		if contact == nil {
+			return errAutomationNoContact
+		}
+		tag := strings.TrimSpace(processTemplate(getStringFromMap(action.Config, "tag"), fields))
+		tags := updateContactTags(contact.Tags, tag, action.Type == models.AutomationActionAddTag)
+		if err := a.DB.Model(contact).Update("tags", tags).Error; err != nil {
+			return err
+		}
+		contact.Tags = tags
+		return nil
+
+	case models.AutomationActionWebhook:
+		payload, err := json.Marshal(OutboundWebhookPayload{
+			Event:     string(eventType),
+			Timestamp: time.Now().UTC(),
+			Data:      fields,
+		})
+		if err != nil {
+			return err
+		}
+		webhook := models.Webhook{URL: getStringFromMap(action.Config, "url")}
+		if headers, ok := action.Config["headers"].(map[string]interface{}); ok {
+			webhook.Headers = models.JSONB(headers)
+		}
+		_, err = a.sendWebhookRequest(ctx, webhook, string(eventType), uuid.Nil, payload)
+		return err
+
+	case models.AutomationActionSlack:
+		payload, err := json.Marshal(map[string]string{
+			"text": processTemplate(getStringFromMap(action.Config, "text"), fields),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = a.sendWebhookRequest(ctx, models.Webhook{URL: getStringFromMap(action.Config, "webhook_url")}, string(eventType), uuid.Nil, payload)
+		return err
+	}
+
+	return fmt.Errorf("unknown action type: %s", action.Type)
+}
+
+// sendAutomationMessage sends a message to the contact on their WhatsApp account.
+// Webhooks are not dispatched for it so automations cannot trigger each other in a loop.
+func (a *App) sendAutomationMessage(ctx context.Context, contact *models.Contact, req OutgoingMessageRequest) error {
+	account, err := a.resolveWhatsAppAccount(contact.OrganizationID, contact.WhatsAppAccount)
+	if err != nil {
+		return err
+	}
+	req.Account = account
+	req.Contact = contact
+
+	opts := DefaultSendOptions()
+	opts.DispatchWebhook = false
+	opts.Async = false
+
+	message, err := a.SendOutgoingMessage(ctx, req, opts)
+	if err != nil {
+		return err
+	}
+
+	var sent models.Message
+	if err := a.DB.Select("status", "error_message").Where("id = ?", message.ID).First(&sent).Error; err == nil &&
+		sent.Status == models.MessageStatusFailed {
+		return fmt.Errorf("message failed: %s", sent.ErrorMessage)
+	}
+	return nil
+}
+
+// updateContactTags adds or removes a tag, ignoring case
+func updateContactTags(tags models.JSONBArray, tag string, add bool) models.JSONBArray {
+	result := models.JSONBArray{}
+	found := false
+	for _, t := range tags {
+		if strings.EqualFold(fmt.Sprint(t), tag) {
+			found = true
+			if !add {
+				continue
+			}
+		}
+		result = append(result, t)
+	}
+	if add && !found && tag != "" {
+		result = append(result, tag)
+	}
+	return result
+}
+
+// automationConditionsToJSONB converts conditions for storage
+func automationConditionsToJSONB(conditions []AutomationCondition) models.JSONBArray {
+	result := models.JSONBArray{}
+	for _, cond := range conditions {
+		result = append(result, map[string]interface{}{
+			"field":    strings.TrimSpace(cond.Field),
+			"operator": cond.Operator,
+			"value":    cond.Value,
+		})
+	}
+	return result
+}
+
+// decodeAutomationConditions converts stored conditions back for evaluation
+func decodeAutomationConditions(stored models.JSONBArray) []AutomationCondition {
+	conditions := []AutomationCondition{}
+	if raw, err := json.Marshal(stored); err == nil {
+		_ = json.Unmarshal(raw, &conditions)
+	}
+	return conditions
+}
+
+// automationActionsToJSONB converts actions for storage
+func automationActionsToJSONB(actions []AutomationAction) models.JSONBArray {
+	result := models.JSONBArray{}
+	for _, action := range actions {
+		config := action.Config
+		if config == nil {
+			config = map[string]interface{}{}
+		}
+		result = append(result, map[string]interface{}{
+			"type":   action.Type,
+			"config": config,
+		})
+	}
+	return result
+}
+
+// decodeAutomationActions converts stored actions back for execution
+func decodeAutomationActions(stored models.JSONBArray) []AutomationAction {
+	actions := []AutomationAction{}
+	if raw, err := json.Marshal(stored); err == nil {
+		_ = json.Unmarshal(raw, &actions)
+	}
+	return actions
+}
+
+func automationToResponse(automation models.Automation) AutomationResponse {
+	return AutomationResponse{
+		ID:              automation.ID,
+		Name:            automation.Name,
+		Description:     automation.Description,
+		Event:           automation.Event,
+		Conditions:      decodeAutomationConditions(automation.Conditions),
+		Actions:         decodeAutomationActions(automation.Actions),
+		IsActive:        automation.IsActive,
+		TriggerCount:    automation.TriggerCount,
+		LastTriggeredAt: automation.LastTriggeredAt,
+		CreatedAt:       automation.CreatedAt,
+		UpdatedAt:       automation.UpdatedAt,
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+func TestMatchAutomationConditions(t *testing.T) {
+	fields := map[string]interface{}{
+		"source": "manual",
+		"contact": map[string]interface{}{
+			"name": "Jane Doe",
+			"tags": []interface{}{"VIP", "complaint"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		conditions []AutomationCondition
+		want       bool
+	}{
+		{"no conditions", nil, true},
+		{"tag equals", []AutomationCondition{{Field: "contact.tags", Operator: models.AutomationOperatorEquals, Value: "complaint"}}, true},
+		{"tag equals ignores case", []AutomationCondition{{Field: "contact.tags", Operator: models.AutomationOperatorEquals, Value: "vip"}}, true},
+		{"tag missing", []AutomationCondition{{Field: "contact.tags", Operator: models.AutomationOperatorEquals, Value: "refund"}}, false},
+		{"tag not contains", []AutomationCondition{{Field: "contact.tags", Operator: models.AutomationOperatorNotContains, Value: "refund"}}, true},
+		{"field contains", []AutomationCondition{{Field: "contact.name", Operator: models.AutomationOperatorContains, Value: "jane"}}, true},
+		{"field not equals", []AutomationCondition{{Field: "source", Operator: models.AutomationOperatorNotEquals, Value: "manual"}}, false},
+		{"unknown field is empty", []AutomationCondition{{Field: "reason", Operator: models.AutomationOperatorIsEmpty}}, true},
+		{"all must match", []AutomationCondition{
+			{Field: "source", Operator: models.AutomationOperatorEquals, Value: "manual"},
+			{Field: "contact.tags", Operator: models.AutomationOperatorEquals, Value: "refund"},
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchAutomationConditions(tt.conditions, fields))
+		})
+	}
+}
+
+func TestValidateAutomation(t *testing.T) {
+	csat := AutomationAction{
+		Type:   models.AutomationActionSendTemplate,
+		Config: map[string]interface{}{"template_id": "6f1c1b8e-2c4e-4b8e-9a7e-3f1d2c4b5a6e"},
+	}
+
+	assert.NoError(t, validateAutomation("CSAT", models.WebhookEventTransferResumed, nil, []AutomationAction{csat}))
+	assert.Error(t, validateAutomation("", models.WebhookEventTransferResumed, nil, []AutomationAction{csat}))
+	assert.Error(t, validateAutomation("CSAT", "conversation.unknown", nil, []AutomationAction{csat}))
+	assert.Error(t, validateAutomation("CSAT", models.WebhookEventTransferResumed, nil, nil))
+	assert.Error(t, validateAutomation("CSAT", models.WebhookEventTransferResumed,
+		[]AutomationCondition{{Field: "contact.tags", Operator: "matches"}}, []AutomationAction{csat}))
+	assert.Error(t, validateAutomation("Slack", models.WebhookEventTransferResumed, nil,
+		[]AutomationAction{{Type: models.AutomationActionSlack, Config: map[string]interface{}{"text": "Closed"}}}))
+}
+
+func TestUpdateContactTags(t *testing.T) {
+	tags := models.JSONBArray{"vip"}
+
+	tags = updateContactTags(tags, "complaint", true)
+	assert.Equal(t, models.JSONBArray{"vip", "complaint"}, tags)
+
+	tags = updateContactTags(tags, "Complaint", true)
+	assert.Equal(t, models.JSONBArray{"vip", "complaint"}, tags)
+
+	tags = updateContactTags(tags, "VIP", false)
+	assert.Equal(t, models.JSONBArray{"complaint"}, tags)
+}
+
+func TestAutomationEventFields_Reaction(t *testing.T) {
+	app := &App{}
+	fields, contact := app.automationEventFields(uuid.New(), ReactionEventData{
+		Emoji: "👍",
+		Message: ReferencedMessageData{
+			MessageType:  models.MessageTypeTemplate,
+			Content:      "Your order #1042 was delivered",
+			TemplateName: "order_delivered",
+			Direction:    models.DirectionOutgoing,
+		},
+	})
+	assert.Nil(t, contact)
+
+	assert.True(t, matchAutomationConditions([]AutomationCondition{
+		{Field: "emoji", Operator: models.AutomationOperatorEquals, Value: "👍"},
+		{Field: "message.template_name", Operator: models.AutomationOperatorEquals, Value: "order_delivered"},
+	}, fields))
+	assert.False(t, matchAutomationConditions([]AutomationCondition{
+		{Field: "emoji", Operator: models.AutomationOperatorEquals, Value: "👎"},
+	}, fields))
+	assert.Equal(t, "Order: Your order #1042 was delivered", processTemplate("Order: {{message.content}}", fields))
+}
+
+func TestAutomations_AgentIsRefused(t *testing.T) {
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger()}
+
+	org := models.Organization{Name: "Automations", Slug: "automations-" + uuid.New().String()[:8]}
+	require.NoError(t, app.DB.Create(&org).Error)
+	role := models.CustomRole{OrganizationID: org.ID, Name: "agent-" + uuid.New().String()[:8]}
+	require.NoError(t, app.DB.Create(&role).Error)
+	agent := models.User{
+		OrganizationID: org.ID,
+		Email:          "agent-" + uuid.New().String()[:8] + "@example.com",
+		FullName:       "Agent",
+		RoleID:         &role.ID,
+		IsActive:       true,
+	}
+	require.NoError(t, app.DB.Create(&agent).Error)
+
+	newRequest := func(body interface{}) *fastglue.Request {
+		req := &fastglue.Request{RequestCtx: &fasthttp.RequestCtx{}}
+		req.RequestCtx.SetUserValue("user_id", agent.ID)
+		req.RequestCtx.SetUserValue("organization_id", org.ID)
+		req.RequestCtx.SetUserValue("id", uuid.New().String())
+		if body != nil {
+			data, _ := json.Marshal(body)
+			req.RequestCtx.Request.SetBody(data)
+		}
+		return req
+	}
+
+	req := newRequest(map[string]interface{}{
+		"name":  "Exfiltrate",
+		"event": string(models.WebhookEventMessageIncoming),
+		"actions": []map[string]interface{}{{
+			"type":   string(models.AutomationActionWebhook),
+			"config": map[string]interface{}{"url": "https://attacker.example.com"},
+		}},
+	})
+	require.NoError(t, app.CreateAutomation(req))
+	assert.Equal(t, fasthttp.StatusForbidden, req.RequestCtx.Response.StatusCode())
+
+	var count int64
+	app.DB.Model(&models.Automation{}).Where("organization_id = ?", org.ID).Count(&count)
+	assert.Zero(t, count)
+
+	for name, handler := range map[string]func(*fastglue.Request) error{
+		"list":   app.ListAutomations,
+		"get":    app.GetAutomation,
+		"update": app.UpdateAutomation,
+		"delete": app.DeleteAutomation,
+		"logs":   app.ListAutomationLogs,
+	} {
+		req := newRequest(nil)
+		require.NoError(t, handler(req))
+		assert.Equal(t, fasthttp.StatusForbidden, req.RequestCtx.Response.StatusCode(), name)
+	}
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxBulkSendRecipients is the most recipients one bulk send takes
+	maxBulkSendRecipients = 50000
+	// defaultBulkSendBatchSize is how many recipients a batch has unless requested
+	defaultBulkSendBatchSize = 1000
+	// maxBulkSendBatchSize is the largest batch a bulk send can be split into
+	maxBulkSendBatchSize = 10000
+	// bulkSendFailureLimit is how many failed recipients the status lists
+	bulkSendFailureLimit = 100
+)
+
+// BulkSendRequest represents a request to send a template to many recipients at once
+type BulkSendRequest struct {
+	Name            string             `json:"name"`
+	WhatsAppAccount string             `json:"whatsapp_account" validate:"required"`
+	TemplateID      string             `json:"template_id" validate:"required"`
+	HeaderMediaID   string             `json:"header_media_id"`
+	BatchSize       int                `json:"batch_size"`
+	Recipients      []RecipientRequest `json:"recipients" validate:"required"`
+}
+
+// BulkSendBatch is the progress of one batch of a bulk send
+type BulkSendBatch struct {
+	Batch   int    `json:"batch"`
+	Status  string `json:"status"` // pending, processing or completed
+	Total   int    `json:"total"`
+	Pending int    `json:"pending"`
+	Sent    int    `json:"sent"`
+	Failed  int    `json:"failed"`
+}
+
+// BulkSendFailure is a recipient a bulk send failed to send to
+type BulkSendFailure struct {
+	RecipientID   uuid.UUID `json:"recipient_id"`
+	Batch         int       `json:"batch"`
+	PhoneNumber   string    `json:"phone_number"`
+	RecipientName string    `json:"recipient_name,omitempty"`
+	ErrorMessage  string    `json:"error_message"`
+	ErrorCode     int       `json:"error_code,omitempty"`
+}
+
+// BulkSendStatus is the progress of a bulk send
+type BulkSendStatus struct {
+	ID              uuid.UUID             `json:"id"`
+	Name            string                `json:"name"`
+	Status          models.CampaignStatus `json:"status"`
+	TotalRecipients int                   `json:"total_recipients"`
+	Pending         int                   `json:"pending"`
+	Sent            int                   `json:"sent"`
+	Failed          int                   `json:"failed"`
+	Progress        float64               `json:"progress"` // Percentage of recipients processed
+	Batches         []BulkSendBatch       `json:"batches"`
+	Failures        []BulkSendFailure     `json:"failures"`
+	StartedAt       *time.Time            `json:"started_at,omitempty"`
+	CompletedAt     *time.Time            `json:"completed_at,omitempty"`
+	CreatedAt       time.Time             `json:"created_at"`
+}
+
+// bulkSendRecipients validates the requested recipients of a bulk send, dropping
+// repeated phone numbers, and returns them with the number dropped
+func bulkSendRecipients(requested []RecipientRequest) ([]RecipientRequest, int, error) {
+	if len(requested) == 0 {
+		return nil, 0, errors.New("recipients is required")
+	}
+	if len(requested) > maxBulkSendRecipients {
+		return nil, 0, fmt.Errorf("a bulk send takes at most %d recipients", maxBulkSendRecipients)
+	}
+
+	seen := make(map[string]bool, len(requested))
+	recipients := make([]RecipientRequest, 0, len(requested))
+	for i, rec := range requested {
+		rec.PhoneNumber = strings.TrimSpace(rec.PhoneNumber)
+		if rec.PhoneNumber == "" {
+			return nil, 0, fmt.Errorf("recipient %d has no phone number", i+1)
+		}
+		if seen[rec.PhoneNumber] {
+			continue
+		}
+		seen[rec.PhoneNumber] = true
+		recipients = append(recipients, rec)
+	}
+	return recipients, len(requested) - len(recipients), nil
+}
+
+// bulkSendBatchSize returns the batch size of a bulk send, defaulting an unset one
+func bulkSendBatchSize(requested int) (int, error) {
+	if requested == 0 {
+		return defaultBulkSendBatchSize, nil
+	}
+	if requested < 1 || requested > maxBulkSendBatchSize {
+		return 0, fmt.Errorf("batch_size must be between 1 and %d", maxBulkSendBatchSize)
+	}
+	return requested, nil
+}
+
+// CreateBulkSend sends a template to up to tens of thousands of recipients. The send
+// is a campaign that starts right away, with its recipients split into batches whose
+// progress GetBulkSend reports. Messages go out at the account's send rate limit.
+func (a *App) CreateBulkSend(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, err := a.getUserIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	if !a.HasFeature(orgID, models.PlanFeatureCampaigns) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureCampaigns), nil, "")
+	}
+	// Creating a bulk send also starts it
+	if !a.HasPermission(userID, models.ResourceCampaigns, models.ActionExecute) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req BulkSendRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	requested, duplicates, err := bulkSendRecipients(req.Recipients)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	batchSize, err := bulkSendBatchSize(req.BatchSize)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	templateID, err := uuid.Parse(req.TemplateID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid template ID", nil, "")
+	}
+	var template models.Template
+	if err := a.DB.Where("id = ? AND organization_id = ?", templateID, orgID).First(&template).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Template not found", nil, "")
+	}
+	if template.QualityScore == models.TemplateQualityRed || isTemplateStatusUnsafe(template.Status) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Template quality is low or paused by Meta; it cannot be sent", nil, "")
+	}
+
+	var account models.WhatsAppAccount
+	if err := a.DB.Where("name = ? AND organization_id = ?", req.WhatsAppAccount, orgID).First(&account).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "WhatsApp account not found", nil, "")
+	}
+
+	// Checked before anything is created, so a send the organization can't afford
+	// doesn't leave a campaign behind
+	if err := a.checkCampaignSendable(orgID, len(requested)); err != nil {
+		return sendCampaignLaunchError(r, err)
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = fmt.Sprintf("Bulk send %s", time.Now().UTC().Format("2006-01-02 15:04"))
+	}
+	campaign := models.BulkMessageCampaign{
+		OrganizationID:  orgID,
+		WhatsAppAccount: account.Name,
+		Name:            name,
+		TemplateID:      templateID,
+		HeaderMediaID:   req.HeaderMediaID,
+		Status:          models.CampaignStatusDraft,
+		TotalRecipients: len(requested),
+		CreatedBy:       userID,
+	}
+	campaign.ID = uuid.New()
+
+	recipients := a.campaignRecipients(orgID, campaign.ID, requested)
+	for i := range recipients {
+		recipients[i].ID = uuid.New()
+		recipients[i].Batch = i/batchSize + 1
+	}
+
+	if err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&campaign).Error; err != nil {
+			return err
+		}
+		return tx.CreateInBatches(&recipients, recipientLookupChunk).Error
+	}); err != nil {
+		a.Log.Error("Failed to create bulk send", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create bulk send", nil, "")
+	}
+
+	// A send that fails to launch stays a draft campaign, which can be started again
+	if err := a.launchCampaign(r.RequestCtx, &campaign, recipients); err != nil {
+		a.Log.Error("Failed to launch bulk send", "error", err, "campaign_id", campaign.ID)
+		return sendCampaignLaunchError(r, err)
+	}
+
+	a.Log.Info("Bulk send started", "campaign_id", campaign.ID, "recipients", len(recipients), "batch_size", batchSize)
+
+	status, err := a.bulkSendStatus(&campaign)
+	if err != nil {
+		a.Log.Error("Failed to load bulk send progress", "error", err, "campaign_id", campaign.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load bulk send progress", nil, "")
+	}
+	return r.SendEnvelope(map[string]interface{}{
+		"bulk_send":          status,
+		"duplicates_skipped": duplicates,
+	})
+}
+
+// GetBulkSend returns the progress of a bulk send, by batch, and its failures.
+// Campaigns not created as bulk sends report their recipients as one batch.
+func (a *App) GetBulkSend(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid bulk send ID", nil, "")
+	}
+
+	var campaign models.BulkMessageCampaign
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&campaign).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Bulk send not found", nil, "")
+	}
+
+	status, err := a.bulkSendStatus(&campaign)
+	if err != nil {
+		a.Log.Error("Failed to load bulk send progress", "error", err, "campaign_id", id)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load bulk send progress", nil, "")
+	}
+	return r.SendEnvelope(status)
+}
+
+// bulkSendStatus counts a bulk send's recipients by batch and status, and lists its
+// first failures. Counts are read from the primary, as replica lag would make
+// progress go back and forth.
+func (a *App) bulkSendStatus(campaign *models.BulkMessageCampaign) (*BulkSendStatus, error) {
+	var counts []struct {
+		Batch  int
+		Status models.MessageStatus
+		Count  int
+	}
+	if err := a.DB.Model(&models.BulkMessageRecipient{}).
+		Select("batch, status, COUNT(*) AS count").
+		Where("campaign_id = ?", campaign.ID).
+		Group("batch, status").
+		Order("batch").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+
+	status := &BulkSendStatus{
+		ID:          campaign.ID,
+		Name:        campaign.Name,
+		Status:      campaign.Status,
+		StartedAt:   campaign.StartedAt,
+		CompletedAt: campaign.CompletedAt,
+		CreatedAt:   campaign.CreatedAt,
+		Batches:     []BulkSendBatch{},
+		Failures:    []BulkSendFailure{},
+	}
+	for _, c := range counts {
+		if n := len(status.Batches); n == 0 || status.Batches[n-1].Batch != c.Batch {
+			status.Batches = append(status.Batches, BulkSendBatch{Batch: c.Batch})
+		}
+		batch := &status.Batches[len(status.Batches)-1]
+		batch.Total += c.Count
+		switch c.Status {
+		case models.MessageStatusPending:
+			batch.Pending += c.Count
+		case models.MessageStatusFailed:
+			batch.Failed += c.Count
+		default:
+			batch.Sent += c.Count
+		}
+	}
+	for i := range status.Batches {
+		batch := &status.Batches[i]
+		switch {
+		case batch.Pending == 0:
+			batch.Status = "completed"
+		case batch.Pending < batch.Total:
+			batch.Status = "processing"
+		default:
+			batch.Status = "pending"
+		}
+		status.TotalRecipients += batch.Total
+		status.Pending += batch.Pending
+		status.Sent += batch.Sent
+		status.Failed += batch.Failed
+	}
+	if status.TotalRecipients > 0 {
+		status.Progress = float64(status.Sent+status.Failed) * 100 / float64(status.TotalRecipients)
+	}
+
+	if status.Failed > 0 {
+		var failed []models.BulkMessageRecipient
+		if err := a.DB.Select("id, batch, phone_number, recipient_name, error_message, error_code").
+			Where("campaign_id = ? AND status = ?", campaign.ID, models.MessageStatusFailed).
+			Order("batch, phone_number").
+			Limit(bulkSendFailureLimit).
+			Find(&failed).Error; err != nil {
+			return nil, err
+		}
+		for _, rec := range failed {
+			status.Failures = append(status.Failures, BulkSendFailure{
+				RecipientID:   rec.ID,
+				Batch:         rec.Batch,
+				PhoneNumber:   rec.PhoneNumber,
+				RecipientName: rec.RecipientName,
+				ErrorMessage:  rec.ErrorMessage,
+				ErrorCode:     rec.ErrorCode,
+			})
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkSendRecipients(t *testing.T) {
+	recipients, duplicates, err := bulkSendRecipients([]RecipientRequest{
+		{PhoneNumber: "15550001111"}, {PhoneNumber: " 15550002222 "}, {PhoneNumber: "15550001111"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, duplicates)
+	require.Len(t, recipients, 2)
+	assert.Equal(t, "15550002222", recipients[1].PhoneNumber)
+
+	_, _, err = bulkSendRecipients(nil)
+	assert.Error(t, err)
+	_, _, err = bulkSendRecipients([]RecipientRequest{{PhoneNumber: "15550001111"}, {PhoneNumber: " "}})
+	assert.EqualError(t, err, "recipient 2 has no phone number")
+	_, _, err = bulkSendRecipients(make([]RecipientRequest, maxBulkSendRecipients+1))
+	assert.Error(t, err)
+}
+
+func TestBulkSendBatchSize(t *testing.T) {
+	size, err := bulkSendBatchSize(0)
+	require.NoError(t, err)
+	assert.Equal(t, defaultBulkSendBatchSize, size)
+
+	size, err = bulkSendBatchSize(250)
+	require.NoError(t, err)
+	assert.Equal(t, 250, size)
+
+	_, err = bulkSendBatchSize(-1)
+	assert.Error(t, err)
+	_, err = bulkSendBatchSize(maxBulkSendBatchSize + 1)
+	assert.Error(t, err)
+}
+
+func TestBulkSendStatus(t *testing.T) {
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger()}
+	seq, contact, _ := sequenceTestContact(t, app, nil)
+
+	template := models.Template{OrganizationID: seq.OrganizationID, WhatsAppAccount: contact.WhatsAppAccount,
+		Name: "bulk-" + uuid.New().String()[:8], Language: "en", Status: string(models.TemplateStatusApproved)}
+	require.NoError(t, app.DB.Create(&template).Error)
+	campaign := models.BulkMessageCampaign{OrganizationID: seq.OrganizationID, WhatsAppAccount: contact.WhatsAppAccount,
+		Name: "Bulk", TemplateID: template.ID, Status: models.CampaignStatusProcessing, CreatedBy: uuid.New()}
+	require.NoError(t, app.DB.Create(&campaign).Error)
+
+	// Batch 1 is done, with one failure, and batch 2 hasn't started
+	statuses := []models.MessageStatus{models.MessageStatusDelivered, models.MessageStatusFailed, models.MessageStatusPending, models.MessageStatusPending}
+	for i, s := range statuses {
+		recipient := models.BulkMessageRecipient{CampaignID: campaign.ID, PhoneNumber: fmt.Sprintf("1555000000%d", i),
+			Status: s, Batch: i/2 + 1}
+		if s == models.MessageStatusFailed {
+			recipient.ErrorMessage, recipient.ErrorCode = "Recipient not on WhatsApp", 131026
+		}
+		require.NoError(t, app.DB.Create(&recipient).Error)
+	}
+
+	status, err := app.bulkSendStatus(&campaign)
+	require.NoError(t, err)
+	assert.Equal(t, 4, status.TotalRecipients)
+	assert.Equal(t, 1, status.Sent)
+	assert.Equal(t, 1, status.Failed)
+	assert.Equal(t, 2, status.Pending)
+	assert.InDelta(t, 50.0, status.Progress, 0.01)
+	assert.Equal(t, []BulkSendBatch{
+		{Batch: 1, Status: "completed", Total: 2, Sent: 1, Failed: 1},
+		{Batch: 2, Status: "pending", Total: 2, Pending: 2},
+	}, status.Batches)
+	require.Len(t, status.Failures, 1)
+	assert.Equal(t, 131026, status.Failures[0].ErrorCode)
+	assert.Equal(t, 1, status.Failures[0].Batch)
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// isOutsideBusinessHours reports whether business hours are enabled in settings
+// and the current time falls outside them or on a holiday
+func (a *App) isOutsideBusinessHours(settings *models.ChatbotSettings) bool {
+	if settings == nil || !settings.BusinessHours.Enabled || len(settings.BusinessHours.Hours) == 0 {
+		return false
+	}
+	now := time.Now().In(a.businessHoursLocation(settings))
+	if a.isHoliday(settings.OrganizationID, settings.WhatsAppAccount, now) {
+		return true
+	}
+	return !isWithinBusinessHours(settings.BusinessHours.Hours, now)
+}
+
+// businessHoursLocation returns the timezone business hours are evaluated in.
+// Uses the settings timezone, then the organization timezone, then server local time.
+func (a *App) businessHoursLocation(settings *models.ChatbotSettings) *time.Location {
+	if settings.BusinessHours.Timezone != "" {
+		if loc, err := time.LoadLocation(settings.BusinessHours.Timezone); err == nil {
+			return loc
+		}
+		a.Log.Warn("Invalid business hours timezone", "timezone", settings.BusinessHours.Timezone, "org_id", settings.OrganizationID)
+	}
+	if loc := a.getOrgLocation(settings.OrganizationID); loc != nil {
+		return loc
+	}
+	return time.Local
+}
+
+// outOfHoursOpensAtVar is the out of hours message variable for when business hours reopen
+const outOfHoursOpensAtVar = "{{opens_at}}"
+
+// businessHoursOpensAt returns when business hours next open in the contact's local
+// time, e.g. "Monday 09:00", or an empty string if they don't open in the next year
+func (a *App) businessHoursOpensAt(settings *models.ChatbotSettings, contact *models.Contact) string {
+	holidays, err := a.getHolidaysCached(settings.OrganizationID)
+	if err != nil {
+		a.Log.Error("Failed to load holidays", "error", err, "org_id", settings.OrganizationID)
+	}
+	now := time.Now().In(a.businessHoursLocation(settings))
+	opensAt, ok := nextBusinessHoursOpening(settings.BusinessHours.Hours, holidays, settings.WhatsAppAccount, now)
+	if !ok {
+		return ""
+	}
+	return opensAt.In(a.contactLocation(contact)).Format("Monday 15:04")
+}
+
+// nextBusinessHoursOpening returns the next start of business hours after now, skipping
+// holidays. now must already be in the business hours timezone.
+func nextBusinessHoursOpening(businessHours models.JSONBArray, holidays []models.Holiday, whatsAppAccount string, now time.Time) (time.Time, bool) {
+	year, month, day := now.Date()
+	for i := 0; i < maxHolidayLookahead; i++ {
+		date := time.Date(year, month, day+i, 0, 0, 0, 0, now.Location())
+		if findHoliday(holidays, whatsAppAccount, date) != nil {
+			continue
+		}
+		for _, bh := range businessHours {
+			bhMap, ok := bh.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if d, ok := bhMap["day"].(float64); !ok || int(d) != int(date.Weekday()) {
+				continue
+			}
+			if enabled, _ := bhMap["enabled"].(bool); !enabled {
+				break
+			}
+			start, err := time.Parse("15:04", getStringFromMap(bhMap, "start_time"))
+			if err != nil {
+				break
+			}
+			opensAt := time.Date(date.Year(), date.Month(), date.Day(), start.Hour(), start.Minute(), 0, 0, now.Location())
+			if opensAt.After(now) {
+				return opensAt, true
+			}
+			break
+		}
+	}
+	return time.Time{}, false
+}
+
+// handleOutOfHours responds to an inbound message received outside business hours.
+// Starts (or continues) the configured away flow, otherwise sends the out of hours
+// message and queues the conversation when the settings ask for it.
+func (a *App) handleOutOfHours(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, settings *models.ChatbotSettings, messageText, buttonID string, flowResponseData map[string]interface{}) {
+	flowID := settings.BusinessHours.OutOfHoursFlowID
+	if flowID == nil {
+		a.sendOutOfHoursMessage(ctx, account, contact, settings)
+		a.queueForBusinessHours(account, contact, settings)
+		return
+	}
+
+	session, _ := a.getOrCreateSession(account.OrganizationID, contact.ID, account.Name, contact.PhoneNumber, settings.SessionTimeoutMins)
+
+	// Contact is already inside the away flow, keep it going
+	if session.CurrentFlowID != nil && *session.CurrentFlowID == *flowID {
+		if messageText != "" {
+			a.logSessionMessage(session.ID, models.DirectionIncoming, messageText, "out_of_hours")
+			a.processFlowResponse(ctx, account, session, contact, messageText, buttonID, flowResponseData)
+		}
+		return
+	}
+
+	flow := a.findChatbotFlow(account.OrganizationID, *flowID)
+	if flow == nil {
+		a.log(ctx).Warn("Out of hours flow not found, falling back to message", "flow_id", flowID, "org_id", account.OrganizationID)
+		a.sendOutOfHoursMessage(ctx, account, contact, settings)
+		a.queueForBusinessHours(account, contact, settings)
+		return
+	}
+
+	a.startFlow(ctx, account, session, contact, flow)
+}
+
+// sendOutOfHoursMessage sends the configured out of hours message, if any.
+// {{opens_at}} in it is replaced with when business hours reopen, in the contact's local time.
+func (a *App) sendOutOfHoursMessage(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, settings *models.ChatbotSettings) {
+	if settings.BusinessHours.OutOfHoursMessage == "" {
+		return
+	}
+	message := localizedMessage(settings, conversationLanguage(settings, nil, contact), translationOutOfHours, settings.BusinessHours.OutOfHoursMessage)
+	if strings.Contains(message, outOfHoursOpensAtVar) {
+		message = strings.ReplaceAll(message, outOfHoursOpensAtVar, a.businessHoursOpensAt(settings, contact))
+	}
+	if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+		a.log(ctx).Error("Failed to send out of hours message", "error", err, "contact", contact.PhoneNumber)
+	}
+}
+
+// queueForBusinessHours puts a conversation received outside business hours in the
+// agent queue, when the settings ask for it, so agents pick it up once hours reopen.
+// Nobody is assigned and SLA timers don't start until then.
+func (a *App) queueForBusinessHours(account *models.WhatsAppAccount, contact *models.Contact, settings *models.ChatbotSettings) {
+	if !settings.BusinessHours.QueueOutsideHours || a.hasActiveAgentTransfer(account.OrganizationID, contact.ID) {
+		return
+	}
+
+	transfer := models.AgentTransfer{
+		BaseModel:          models.BaseModel{ID: uuid.New()},
+		OrganizationID:     account.OrganizationID,
+		ContactID:          contact.ID,
+		WhatsAppAccount:    account.Name,
+		PhoneNumber:        contact.PhoneNumber,
+		Status:             models.TransferStatusActive,
+		Source:             models.TransferSourceOutOfHours,
+		TeamID:             settings.AgentAssignment.HandoffTeamID,
+		TransferredAt:      time.Now(),
+		AssignmentDeferred: true,
+	}
+	if err := a.DB.Create(&transfer).Error; err != nil {
+		a.Log.Error("Failed to queue conversation outside business hours", "error", err, "contact_id", contact.ID)
+		return
+	}
+
+	a.handOffSessions(&transfer)
+
+	a.Log.Info("Conversation queued until business hours reopen", "transfer_id", transfer.ID, "contact_id", contact.ID)
+	a.broadcastTransferCreated(&transfer, contact)
+	a.notifyHandoffRequested(&transfer, contact)
+	a.openHelpdeskTicket(&transfer, contact)
+}
+
+// findChatbotFlow returns an enabled flow (with steps) by ID from the flows cache
+func (a *App) findChatbotFlow(orgID, flowID uuid.UUID) *models.ChatbotFlow {
+	flows, err := a.getChatbotFlowsCached(orgID)
+	if err != nil {
+		a.Log.Error("Failed to fetch chatbot flows", "error", err)
+		return nil
+	}
+	for i := range flows {
+		if flows[i].ID == flowID {
+			return &flows[i]
+		}
+	}
+	return nil
+}
+
+// assignDeferredTransfers assigns team transfers that were queued outside business
+// hours once the hours of their account reopen
+func (p *SLAProcessor) assignDeferredTransfers() {
+	var transfers []models.AgentTransfer
+	if err := p.app.DB.Where("status = ? AND assignment_deferred = ? AND agent_id IS NULL",
+		models.TransferStatusActive, true).
+		Preload("Contact").
+		Find(&transfers).Error; err != nil {
+		p.app.Log.Error("Failed to find deferred transfers", "error", err)
+		return
+	}
+
+	for i := range transfers {
+		transfer := &transfers[i]
+		settings, err := p.app.getChatbotSettingsCached(transfer.OrganizationID, transfer.WhatsAppAccount)
+		if err == nil && p.app.isOutsideBusinessHours(settings) {
+			continue
+		}
+
+		var agentID *uuid.UUID
+		if transfer.TeamID != nil {
+			agentID = p.app.assignToTeam(*transfer.TeamID, transfer.OrganizationID, transfer.Contact)
+		}
+
+		updates := map[string]interface{}{"assignment_deferred": false}
+
+		// Conversations queued outside business hours start their SLA timers now
+		if transfer.Source == models.TransferSourceOutOfHours && settings != nil {
+			p.app.SetSLADeadlines(transfer, settings)
+			updates["sla_response_deadline"] = transfer.SLA.ResponseDeadline
+			updates["sla_resolution_deadline"] = transfer.SLA.ResolutionDeadline
+			updates["sla_escalation_at"] = transfer.SLA.EscalationAt
+			updates["expires_at"] = transfer.SLA.ExpiresAt
+			updates["sla_policy_id"] = transfer.SLA.PolicyID
+			updates["sla_status"] = transfer.SLA.Status
+		}
+		if agentID != nil {
+			transfer.AgentID = agentID
+			p.app.UpdateSLAOnPickup(transfer)
+			updates["agent_id"] = agentID
+			updates["picked_up_at"] = transfer.SLA.PickedUpAt
+			updates["sla_breached"] = transfer.SLA.Breached
+			updates["sla_breached_at"] = transfer.SLA.BreachedAt
+		}
+		if err := p.app.DB.Model(transfer).Updates(updates).Error; err != nil {
+			p.app.Log.Error("Failed to assign deferred transfer", "error", err, "transfer_id", transfer.ID)
+			continue
+		}
+
+		if agentID == nil {
+			continue
+		}
+
+		p.app.DB.Model(&models.Contact{}).Where("id = ?", transfer.ContactID).Update("assigned_user_id", agentID)
+		p.app.syncSessionMode(transfer)
+
+		p.app.Log.Info("Deferred transfer assigned after business hours reopened",
+			"transfer_id", transfer.ID,
+			"agent_id", agentID,
+		)
+		p.app.broadcastTransferAssigned(transfer)
+	}
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// weekdayHours returns business hours open 09:00-17:00 Monday to Friday.
+func weekdayHours() models.JSONBArray {
+	hours := models.JSONBArray{}
+	for day := 0; day < 7; day++ {
+		hours = append(hours, map[string]interface{}{
+			"day":        float64(day),
+			"enabled":    day >= 1 && day <= 5,
+			"start_time": "09:00",
+			"end_time":   "17:00",
+		})
+	}
+	return hours
+}
+
+func TestIsWithinBusinessHours(t *testing.T) {
+	hours := weekdayHours()
+
+	// 2025-01-06 is a Monday
+	assert.True(t, isWithinBusinessHours(hours, time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC)))
+	assert.False(t, isWithinBusinessHours(hours, time.Date(2025, 1, 6, 8, 59, 0, 0, time.UTC)))
+	assert.False(t, isWithinBusinessHours(hours, time.Date(2025, 1, 6, 17, 1, 0, 0, time.UTC)))
+	// Sunday is disabled
+	assert.False(t, isWithinBusinessHours(hours, time.Date(2025, 1, 5, 10, 0, 0, 0, time.UTC)))
+}
+
+func TestIsWithinBusinessHours_Timezone(t *testing.T) {
+	hours := weekdayHours()
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("timezone database not available")
+	}
+
+	// Monday 01:00 UTC is Monday 10:00 in Tokyo
+	now := time.Date(2025, 1, 6, 1, 0, 0, 0, time.UTC)
+	assert.False(t, isWithinBusinessHours(hours, now))
+	assert.True(t, isWithinBusinessHours(hours, now.In(tokyo)))
+}
+
+func TestNextBusinessHoursOpening(t *testing.T) {
+	hours := weekdayHours()
+
+	// Before opening on a Monday opens that morning
+	opensAt, ok := nextBusinessHoursOpening(hours, nil, "", time.Date(2025, 1, 6, 8, 0, 0, 0, time.UTC))
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2025, 1, 6, 9, 0, 0, 0, time.UTC), opensAt)
+
+	// Friday evening opens on Monday
+	opensAt, ok = nextBusinessHoursOpening(hours, nil, "", time.Date(2025, 1, 10, 18, 0, 0, 0, time.UTC))
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2025, 1, 13, 9, 0, 0, 0, time.UTC), opensAt)
+
+	// Holidays are skipped
+	holidays := []models.Holiday{{Name: "Closed", Date: time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)}}
+	opensAt, ok = nextBusinessHoursOpening(hours, holidays, "", time.Date(2025, 1, 10, 18, 0, 0, 0, time.UTC))
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2025, 1, 14, 9, 0, 0, 0, time.UTC), opensAt)
+
+	_, ok = nextBusinessHoursOpening(models.JSONBArray{}, nil, "", time.Now())
+	assert.False(t, ok, "hours that never open")
+}
+
+func TestIsOutsideBusinessHours_Disabled(t *testing.T) {
+	app := &App{Config: &config.Config{}, Log: testutil.NopLogger()}
+
+	assert.False(t, app.isOutsideBusinessHours(nil))
+	assert.False(t, app.isOutsideBusinessHours(&models.ChatbotSettings{
+		BusinessHours: models.BusinessHoursConfig{Enabled: false, Hours: weekdayHours()},
+	}))
+	assert.False(t, app.isOutsideBusinessHours(&models.ChatbotSettings{
+		BusinessHours: models.BusinessHoursConfig{Enabled: true},
+	}))
+}
+
+func TestQueueForBusinessHours(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Away Org " + suffix,
+		Slug:      "away-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1666" + suffix[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	account := &models.WhatsAppAccount{OrganizationID: org.ID, Name: "away-account"}
+	settings := &models.ChatbotSettings{
+		OrganizationID: org.ID,
+		SLA:            models.SLAConfig{Enabled: true, ResponseMinutes: 15, AutoCloseHours: 24},
+	}
+
+	countTransfers := func() int64 {
+		var count int64
+		app.DB.Model(&models.AgentTransfer{}).Where("contact_id = ?", contact.ID).Count(&count)
+		return count
+	}
+
+	app.queueForBusinessHours(account, contact, settings)
+	assert.Zero(t, countTransfers(), "queueing is off")
+
+	settings.BusinessHours.QueueOutsideHours = true
+	app.queueForBusinessHours(account, contact, settings)
+	app.queueForBusinessHours(account, contact, settings)
+	require.Equal(t, int64(1), countTransfers())
+
+	var transfer models.AgentTransfer
+	require.NoError(t, app.DB.Where("contact_id = ?", contact.ID).First(&transfer).Error)
+	assert.Equal(t, models.TransferSourceOutOfHours, transfer.Source)
+	assert.True(t, transfer.AssignmentDeferred)
+	assert.Nil(t, transfer.AgentID)
+	// SLA timers start when hours reopen
+	assert.Nil(t, transfer.SLA.ResponseDeadline)
+	assert.Nil(t, transfer.SLA.ExpiresAt)
+}
+
+func TestCreateTransferToQueue_OutsideBusinessHours(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Redis:  testutil.SetupTestRedis(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Closed Org " + suffix,
+		Slug:      "closed-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	agent := &models.User{
+		OrganizationID: org.ID,
+		Email:          "closed-" + suffix + "@example.com",
+		FullName:       "Closed Agent",
+		IsActive:       true,
+		IsAvailable:    true,
+	}
+	require.NoError(t, app.DB.Create(agent).Error)
+	team := &models.Team{OrganizationID: org.ID, Name: "Support", AssignmentStrategy: models.AssignmentStrategyRoundRobin, IsActive: true}
+	require.NoError(t, app.DB.Create(team).Error)
+	require.NoError(t, app.DB.Create(&models.TeamMember{TeamID: team.ID, UserID: agent.ID}).Error)
+
+	// Every day is closed, so it's always outside business hours
+	hours := models.JSONBArray{}
+	for day := 0; day < 7; day++ {
+		hours = append(hours, map[string]interface{}{"day": float64(day), "enabled": false})
+	}
+	require.NoError(t, app.DB.Create(&models.ChatbotSettings{
+		OrganizationID:  org.ID,
+		BusinessHours:   models.BusinessHoursConfig{Enabled: true, Hours: hours},
+		AgentAssignment: models.AgentAssignmentConfig{HandoffTeamID: &team.ID},
+	}).Error)
+
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1667" + suffix[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	account := &models.WhatsAppAccount{OrganizationID: org.ID, Name: "closed-account"}
+
+	app.createTransferToQueue(account, contact, models.TransferSourceChatbotDisabled)
+
+	var transfer models.AgentTransfer
+	require.NoError(t, app.DB.Where("contact_id = ?", contact.ID).First(&transfer).Error)
+	assert.True(t, transfer.AssignmentDeferred)
+	assert.Nil(t, transfer.AgentID)
+	require.NotNil(t, transfer.TeamID)
+	assert.Equal(t, team.ID, *transfer.TeamID)
+
+	require.NoError(t, app.DB.First(contact, contact.ID).Error)
+	assert.Nil(t, contact.AssignedUserID)
+}
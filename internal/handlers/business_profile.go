@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// Business profile limits enforced by the Cloud API
+const (
+	maxProfileAboutLength       = 139
+	maxProfileAddressLength     = 256
+	maxProfileDescriptionLength = 512
+	maxProfileEmailLength       = 128
+	maxProfileWebsiteLength     = 256
+	maxProfileWebsites          = 2
+	maxProfilePhotoSize         = 5 << 20
+)
+
+// BusinessProfileRequest updates a number's business profile. Omitted fields keep
+// their current value; an empty websites list removes all websites.
+type BusinessProfileRequest struct {
+	About       *string   `json:"about"`
+	Address     *string   `json:"address"`
+	Description *string   `json:"description"`
+	Email       *string   `json:"email"`
+	Websites    *[]string `json:"websites"`
+	Vertical    *string   `json:"vertical"`
+}
+
+// GetBusinessProfile returns the business profile customers see for a number
+func (a *App) GetBusinessProfile(r *fastglue.Request) error {
+	account, errMsg, status := a.profileAccount(r, models.ActionRead)
+	if account == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	profile, err := a.WhatsApp.GetBusinessProfile(ctx, a.toWhatsAppAccount(account))
+	if err != nil {
+		a.Log.Error("Failed to get business profile", "error", err, "account", account.Name)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, err.Error(), nil, "")
+	}
+
+	return r.SendEnvelope(profile)
+}
+
+// UpdateBusinessProfile updates a number's business profile and returns it as
+// WhatsApp now shows it
+func (a *App) UpdateBusinessProfile(r *fastglue.Request) error {
+	account, errMsg, status := a.profileAccount(r, models.ActionWrite)
+	if account == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var req BusinessProfileRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if err := validateBusinessProfile(&req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	update := whatsapp.BusinessProfileUpdate{
+		About:       req.About,
+		Address:     req.Address,
+		Description: req.Description,
+		Email:       req.Email,
+		Vertical:    req.Vertical,
+	}
+	if req.Websites != nil {
+		update.Websites = *req.Websites
+	}
+
+	return a.applyBusinessProfileUpdate(r, account, update)
+}
+
+// UploadBusinessProfilePhoto replaces a number's profile photo with an uploaded
+// JPEG or PNG image
+func (a *App) UploadBusinessProfilePhoto(r *fastglue.Request) error {
+	account, errMsg, status := a.profileAccount(r, models.ActionWrite)
+	if account == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	// Profile photos are uploaded through the app's resumable upload API
+	if account.AppID == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "WhatsApp account does not have app_id configured. Please update the account settings.", nil, "")
+	}
+
+	fileHeader, err := r.RequestCtx.FormFile("file")
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "No file provided", nil, "")
+	}
+	if fileHeader.Size > maxProfilePhotoSize {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Profile photo must be 5 MB or smaller", nil, "")
+	}
+
+	mimeType := fileHeader.Header.Get("Content-Type")
+	if mimeType != "image/jpeg" && mimeType != "image/png" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Profile photo must be a JPEG or PNG image", nil, "")
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to open uploaded file", nil, "")
+	}
+	defer func() { _ = file.Close() }()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to read file data", nil, "")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	handle, err := a.WhatsApp.ResumableUpload(ctx, a.toWhatsAppAccount(account), data, mimeType, fileHeader.Filename)
+	if err != nil {
+		a.Log.Error("Failed to upload profile photo", "error", err, "account", account.Name)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to upload profile photo: "+err.Error(), nil, "")
+	}
+
+	return a.applyBusinessProfileUpdate(r, account, whatsapp.BusinessProfileUpdate{ProfilePictureHandle: handle})
+}
+
+// applyBusinessProfileUpdate sends a profile update to WhatsApp and responds with the
+// updated profile
+func (a *App) applyBusinessProfileUpdate(r *fastglue.Request, account *models.WhatsAppAccount, update whatsapp.BusinessProfileUpdate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	waAccount := a.toWhatsAppAccount(account)
+	if err := a.WhatsApp.UpdateBusinessProfile(ctx, waAccount, update); err != nil {
+		a.Log.Error("Failed to update business profile", "error", err, "account", account.Name)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, err.Error(), nil, "")
+	}
+	a.Log.Info("Business profile updated", "account", account.Name)
+
+	profile, err := a.WhatsApp.GetBusinessProfile(ctx, waAccount)
+	if err != nil {
+		// The update went through; the caller can fetch the profile again
+		a.Log.Warn("Failed to reload business profile", "error", err, "account", account.Name)
+		return r.SendEnvelope(map[string]string{"message": "Business profile updated"})
+	}
+	return r.SendEnvelope(profile)
+}
+
+// profileAccount returns the organization's account named by the id path parameter,
+// if the user may access accounts for the action, or an error message and status
+func (a *App) profileAccount(r *fastglue.Request, action string) (*models.WhatsAppAccount, string, int) {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return nil, "Unauthorized", fasthttp.StatusUnauthorized
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceAccounts, action) {
+		return nil, "Insufficient permissions", fasthttp.StatusForbidden
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, "Invalid account ID", fasthttp.StatusBadRequest
+	}
+
+	var account models.WhatsAppAccount
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&account).Error; err != nil {
+		return nil, "Account not found", fasthttp.StatusNotFound
+	}
+	return &account, "", fasthttp.StatusOK
+}
+
+// validateBusinessProfile checks a profile update against the Cloud API's limits,
+// trimming whitespace from the fields set
+func validateBusinessProfile(req *BusinessProfileRequest) error {
+	for _, field := range []struct {
+		name  string
+		value *string
+		max   int
+	}{
+		{"about", req.About, maxProfileAboutLength},
+		{"address", req.Address, maxProfileAddressLength},
+		{"description", req.Description, maxProfileDescriptionLength},
+		{"email", req.Email, maxProfileEmailLength},
+	} {
+		if field.value == nil {
+			continue
+		}
+		*field.value = strings.TrimSpace(*field.value)
+		if len([]rune(*field.value)) > field.max {
+			return fmt.Errorf("%s must be at most %d characters", field.name, field.max)
+		}
+	}
+
+	if req.About != nil && *req.About == "" {
+		return fmt.Errorf("about can't be empty")
+	}
+	if req.Email != nil && *req.Email != "" {
+		if _, err := mail.ParseAddress(*req.Email); err != nil {
+			return fmt.Errorf("invalid email address")
+		}
+	}
+
+	if req.Websites != nil {
+		websites := *req.Websites
+		if len(websites) > maxProfileWebsites {
+			return fmt.Errorf("at most %d websites are allowed", maxProfileWebsites)
+		}
+		for i, website := range websites {
+			website = strings.TrimSpace(website)
+			if !strings.HasPrefix(website, "http://") && !strings.HasPrefix(website, "https://") {
+				return fmt.Errorf("websites must start with http:// or https://")
+			}
+			if len(website) > maxProfileWebsiteLength {
+				return fmt.Errorf("websites must be at most %d characters", maxProfileWebsiteLength)
+			}
+			websites[i] = website
+		}
+	}
+
+	if req.Vertical != nil && !slices.Contains(whatsapp.BusinessVerticals, *req.Vertical) {
+		return fmt.Errorf("invalid vertical")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBusinessProfile(t *testing.T) {
+	str := func(s string) *string { return &s }
+	sites := func(s ...string) *[]string { return &s }
+
+	tests := []struct {
+		name    string
+		req     BusinessProfileRequest
+		wantErr string
+	}{
+		{name: "empty update", req: BusinessProfileRequest{}},
+		{
+			name: "full profile",
+			req: BusinessProfileRequest{
+				About:       str("Fresh bread daily"),
+				Address:     str("12 Baker Street"),
+				Description: str("Family bakery since 1982"),
+				Email:       str("hello@example.com"),
+				Websites:    sites("https://example.com", "http://example.org/menu"),
+				Vertical:    str("GROCERY"),
+			},
+		},
+		{name: "clearing email and websites", req: BusinessProfileRequest{Email: str(""), Websites: sites()}},
+		{name: "about too long", req: BusinessProfileRequest{About: str(strings.Repeat("a", 140))}, wantErr: "about must be at most 139 characters"},
+		{name: "about empty", req: BusinessProfileRequest{About: str("  ")}, wantErr: "about can't be empty"},
+		{name: "invalid email", req: BusinessProfileRequest{Email: str("not an email")}, wantErr: "invalid email address"},
+		{name: "too many websites", req: BusinessProfileRequest{Websites: sites("https://a.com", "https://b.com", "https://c.com")}, wantErr: "at most 2 websites are allowed"},
+		{name: "website without scheme", req: BusinessProfileRequest{Websites: sites("example.com")}, wantErr: "websites must start with http:// or https://"},
+		{name: "unknown vertical", req: BusinessProfileRequest{Vertical: str("BAKERY")}, wantErr: "invalid vertical"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBusinessProfile(&tt.req)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateBusinessProfile_TrimsFields(t *testing.T) {
+	about := "  Fresh bread daily \n"
+	websites := []string{" https://example.com "}
+	req := BusinessProfileRequest{About: &about, Websites: &websites}
+
+	require.NoError(t, validateBusinessProfile(&req))
+	assert.Equal(t, "Fresh bread daily", *req.About)
+	assert.Equal(t, []string{"https://example.com"}, *req.Websites)
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -23,6 +24,14 @@ const (
 	aiContextsCacheTTL      = 6 * time.Hour
 	userPermissionsCacheTTL = 6 * time.Hour
 	rolePermissionsCacheTTL = 6 * time.Hour
+	shortcodesCacheTTL      = 6 * time.Hour
+	holidaysCacheTTL        = 6 * time.Hour
+	automationsCacheTTL     = 6 * time.Hour
+	orgPlanCacheTTL         = 6 * time.Hour
+	orgTrialCacheTTL        = time.Hour
+	orgQuotasCacheTTL       = 6 * time.Hour
+	orgAllowedIPsCacheTTL   = 6 * time.Hour
+	segmentCountCacheTTL    = 5 * time.Minute // Counts follow contact changes, so they are only cached briefly
 
 	// Cache key prefixes
 	settingsCachePrefix        = "chatbot:settings:"
@@ -34,12 +43,42 @@ const (
 	aiContextsCachePrefix      = "chatbot:ai_contexts:"
 	userPermissionsCachePrefix = "permissions:user:"
 	rolePermissionsCachePrefix = "permissions:role:"
+	shortcodesCachePrefix      = "shortcodes:"
+	holidaysCachePrefix        = "holidays:"
+	automationsCachePrefix     = "automations:"
+	orgPlanCachePrefix         = "plan:org:"
+	orgTrialCachePrefix        = "trial:org:"
+	orgQuotasCachePrefix       = "quotas:org:"
+	orgAllowedIPsCachePrefix   = "allowed_ips:org:"
+	segmentCountCachePrefix    = "segments:count:"
 )
 
-// chatbotSettingsCache is used for caching since AI.APIKey has json:"-" tag
+// chatbotSettingsCache is used for caching since the AI API keys have json:"-" tags.
+// The keys are cached encrypted, like they are stored.
 type chatbotSettingsCache struct {
 	models.ChatbotSettings
-	AIAPIKey string `json:"ai_api_key_cache"`
+	AIAPIKey            string `json:"ai_api_key_cache"`
+	AIModerationAPIKey  string `json:"ai_moderation_api_key_cache"`
+	TranscriptionAPIKey string `json:"transcription_api_key_cache"`
+}
+
+// restoreAPIKeys decrypts the cached API keys into the settings
+func (c *chatbotSettingsCache) restoreAPIKeys() error {
+	for _, key := range []struct {
+		cached string
+		field  *string
+	}{
+		{c.AIAPIKey, &c.AI.APIKey},
+		{c.AIModerationAPIKey, &c.AI.ModerationAPIKey},
+		{c.TranscriptionAPIKey, &c.Transcription.APIKey},
+	} {
+		plaintext, err := models.DecryptSecret(key.cached)
+		if err != nil {
+			return err
+		}
+		*key.field = plaintext
+	}
+	return nil
 }
 
 // getChatbotSettingsCached retrieves chatbot settings from cache or database
@@ -51,9 +90,7 @@ func (a *App) getChatbotSettingsCached(orgID uuid.UUID, whatsAppAccount string)
 	cached, err := a.Redis.Get(ctx, cacheKey).Result()
 	if err == nil && cached != "" {
 		var cacheData chatbotSettingsCache
-		if err := json.Unmarshal([]byte(cached), &cacheData); err == nil {
-			// Restore the API key from the cache wrapper
-			cacheData.AI.APIKey = cacheData.AIAPIKey
+		if err := json.Unmarshal([]byte(cached), &cacheData); err == nil && cacheData.restoreAPIKeys() == nil {
 			return &cacheData.ChatbotSettings, nil
 		}
 	}
@@ -69,12 +106,22 @@ func (a *App) getChatbotSettingsCached(orgID uuid.UUID, whatsAppAccount string)
 		return nil, result.Error
 	}
 
-	// Cache the result (include AI APIKey explicitly since it has json:"-" tag)
-	cacheData := chatbotSettingsCache{
-		ChatbotSettings: settings,
-		AIAPIKey:        settings.AI.APIKey,
+	// Cache the result (include the API keys explicitly since they have json:"-" tags)
+	cacheData := chatbotSettingsCache{ChatbotSettings: settings}
+	var encErr error
+	for _, key := range []struct {
+		plaintext string
+		cached    *string
+	}{
+		{settings.AI.APIKey, &cacheData.AIAPIKey},
+		{settings.AI.ModerationAPIKey, &cacheData.AIModerationAPIKey},
+		{settings.Transcription.APIKey, &cacheData.TranscriptionAPIKey},
+	} {
+		if *key.cached, encErr = models.EncryptSecret(key.plaintext); encErr != nil {
+			break
+		}
 	}
-	if data, err := json.Marshal(cacheData); err == nil {
+	if data, err := json.Marshal(cacheData); err == nil && encErr == nil {
 		a.Redis.Set(ctx, cacheKey, data, settingsCacheTTL)
 	}
 
@@ -204,10 +251,12 @@ func (a *App) deleteKeysByPattern(ctx context.Context, pattern string) {
 	}
 }
 
-// whatsAppAccountCache is used for caching since AccessToken has json:"-" tag
+// whatsAppAccountCache is used for caching since AccessToken and APIToken have
+// json:"-" tags. The tokens are cached encrypted, like they are stored.
 type whatsAppAccountCache struct {
 	models.WhatsAppAccount
 	AccessToken string `json:"access_token"`
+	APIToken    string `json:"api_token,omitempty"`
 }
 
 // getWhatsAppAccountCached retrieves WhatsApp account by phone_id from cache or database
@@ -220,8 +269,13 @@ func (a *App) getWhatsAppAccountCached(phoneID string) (*models.WhatsAppAccount,
 	if err == nil && cached != "" {
 		var cacheData whatsAppAccountCache
 		if err := json.Unmarshal([]byte(cached), &cacheData); err == nil {
-			cacheData.WhatsAppAccount.AccessToken = cacheData.AccessToken
-			return &cacheData.WhatsAppAccount, nil
+			token, err := models.DecryptSecret(cacheData.AccessToken)
+			apiToken, apiErr := models.DecryptSecret(cacheData.APIToken)
+			if err == nil && apiErr == nil {
+				cacheData.WhatsAppAccount.AccessToken = token
+				cacheData.WhatsAppAccount.APIToken = apiToken
+				return &cacheData.WhatsAppAccount, nil
+			}
 		}
 	}
 
@@ -231,10 +285,19 @@ func (a *App) getWhatsAppAccountCached(phoneID string) (*models.WhatsAppAccount,
 		return nil, err
 	}
 
-	// Cache the result (include AccessToken explicitly)
+	// Cache the result (include the tokens explicitly)
+	token, err := models.EncryptSecret(account.AccessToken)
+	if err != nil {
+		return &account, nil
+	}
+	apiToken, err := models.EncryptSecret(account.APIToken)
+	if err != nil {
+		return &account, nil
+	}
 	cacheData := whatsAppAccountCache{
 		WhatsAppAccount: account,
-		AccessToken:     account.AccessToken,
+		AccessToken:     token,
+		APIToken:        apiToken,
 	}
 	if data, err := json.Marshal(cacheData); err == nil {
 		a.Redis.Set(ctx, cacheKey, data, whatsappAccountCacheTTL)
@@ -245,6 +308,9 @@ func (a *App) getWhatsAppAccountCached(phoneID string) (*models.WhatsAppAccount,
 
 // InvalidateWhatsAppAccountCache invalidates the WhatsApp account cache
 func (a *App) InvalidateWhatsAppAccountCache(phoneID string) {
+	if a.Redis == nil {
+		return
+	}
 	ctx := context.Background()
 	cacheKey := fmt.Sprintf("%s%s", whatsappAccountCachePrefix, phoneID)
 	a.Redis.Del(ctx, cacheKey)
@@ -285,6 +351,382 @@ func (a *App) InvalidateWebhooksCache(orgID uuid.UUID) {
 	a.Redis.Del(ctx, cacheKey)
 }
 
+// getShortcodesCached retrieves active shortcodes for an organization as a code -> content map
+func (a *App) getShortcodesCached(orgID uuid.UUID) (map[string]string, error) {
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", shortcodesCachePrefix, orgID.String())
+
+	// Try cache first
+	if a.Redis != nil {
+		cached, err := a.Redis.Get(ctx, cacheKey).Result()
+		if err == nil && cached != "" {
+			var codes map[string]string
+			if err := json.Unmarshal([]byte(cached), &codes); err == nil {
+				return codes, nil
+			}
+		}
+	}
+
+	// Cache miss - fetch from database
+	var shortcodes []models.Shortcode
+	if err := a.DB.Where("organization_id = ? AND is_active = ?", orgID, true).Find(&shortcodes).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make(map[string]string, len(shortcodes))
+	for _, sc := range shortcodes {
+		codes[sc.Code] = sc.Content
+	}
+
+	// Cache the result
+	if a.Redis != nil {
+		if data, err := json.Marshal(codes); err == nil {
+			a.Redis.Set(ctx, cacheKey, data, shortcodesCacheTTL)
+		}
+	}
+
+	return codes, nil
+}
+
+// InvalidateShortcodesCache invalidates the shortcodes cache for an organization
+func (a *App) InvalidateShortcodesCache(orgID uuid.UUID) {
+	if a.Redis == nil {
+		return
+	}
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", shortcodesCachePrefix, orgID.String())
+	a.Redis.Del(ctx, cacheKey)
+}
+
+// getHolidaysCached retrieves all holidays for an organization from cache or database
+func (a *App) getHolidaysCached(orgID uuid.UUID) ([]models.Holiday, error) {
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", holidaysCachePrefix, orgID.String())
+
+	// Try cache first
+	if a.Redis != nil {
+		cached, err := a.Redis.Get(ctx, cacheKey).Result()
+		if err == nil && cached != "" {
+			var holidays []models.Holiday
+			if err := json.Unmarshal([]byte(cached), &holidays); err == nil {
+				return holidays, nil
+			}
+		}
+	}
+
+	// Cache miss - fetch from database
+	var holidays []models.Holiday
+	if err := a.DB.Where("organization_id = ?", orgID).Order("date ASC").Find(&holidays).Error; err != nil {
+		return nil, err
+	}
+
+	// Cache the result
+	if a.Redis != nil {
+		if data, err := json.Marshal(holidays); err == nil {
+			a.Redis.Set(ctx, cacheKey, data, holidaysCacheTTL)
+		}
+	}
+
+	return holidays, nil
+}
+
+// InvalidateHolidaysCache invalidates the holidays cache for an organization
+func (a *App) InvalidateHolidaysCache(orgID uuid.UUID) {
+	if a.Redis == nil {
+		return
+	}
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", holidaysCachePrefix, orgID.String())
+	a.Redis.Del(ctx, cacheKey)
+}
+
+// getAutomationsCached retrieves active automations for an organization from cache or database
+func (a *App) getAutomationsCached(orgID uuid.UUID) ([]models.Automation, error) {
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", automationsCachePrefix, orgID.String())
+
+	// Try cache first
+	if a.Redis != nil {
+		cached, err := a.Redis.Get(ctx, cacheKey).Result()
+		if err == nil && cached != "" {
+			var automations []models.Automation
+			if err := json.Unmarshal([]byte(cached), &automations); err == nil {
+				return automations, nil
+			}
+		}
+	}
+
+	// Cache miss - fetch from database
+	var automations []models.Automation
+	if err := a.DB.Where("organization_id = ? AND is_active = ?", orgID, true).Order("created_at ASC").Find(&automations).Error; err != nil {
+		return nil, err
+	}
+
+	// Cache the result
+	if a.Redis != nil {
+		if data, err := json.Marshal(automations); err == nil {
+			a.Redis.Set(ctx, cacheKey, data, automationsCacheTTL)
+		}
+	}
+
+	return automations, nil
+}
+
+// InvalidateAutomationsCache invalidates the automations cache for an organization
+func (a *App) InvalidateAutomationsCache(orgID uuid.UUID) {
+	if a.Redis == nil {
+		return
+	}
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", automationsCachePrefix, orgID.String())
+	a.Redis.Del(ctx, cacheKey)
+}
+
+// orgPlanCache wraps the cached plan so organizations without a plan are cached too
+type orgPlanCache struct {
+	Plan *models.Plan `json:"plan"`
+}
+
+// getOrgPlanCached retrieves the plan of an organization from cache or database.
+// Organizations without a plan, or whose plan no longer exists, get the default plan.
+// Returns nil when no plan applies.
+func (a *App) getOrgPlanCached(orgID uuid.UUID) (*models.Plan, error) {
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", orgPlanCachePrefix, orgID.String())
+
+	// Try cache first
+	if a.Redis != nil {
+		cached, err := a.Redis.Get(ctx, cacheKey).Result()
+		if err == nil && cached != "" {
+			var entry orgPlanCache
+			if err := json.Unmarshal([]byte(cached), &entry); err == nil {
+				return entry.Plan, nil
+			}
+		}
+	}
+
+	// Cache miss - fetch from database
+	var org models.Organization
+	if err := a.DB.Select("plan").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return nil, err
+	}
+
+	var entry orgPlanCache
+	var plan models.Plan
+	if org.Plan != "" && a.DB.Where("name = ?", org.Plan).First(&plan).Error == nil {
+		entry.Plan = &plan
+	} else if err := a.DB.Where("is_default = ?", true).First(&plan).Error; err == nil {
+		entry.Plan = &plan
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Cache the result
+	if a.Redis != nil {
+		if data, err := json.Marshal(entry); err == nil {
+			a.Redis.Set(ctx, cacheKey, data, orgPlanCacheTTL)
+		}
+	}
+
+	return entry.Plan, nil
+}
+
+// InvalidateOrgPlanCache invalidates the plan cache for an organization
+func (a *App) InvalidateOrgPlanCache(orgID uuid.UUID) {
+	if a.Redis == nil {
+		return
+	}
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", orgPlanCachePrefix, orgID.String())
+	a.Redis.Del(ctx, cacheKey)
+}
+
+// InvalidateAllOrgPlansCache invalidates the plan cache of every organization, after a plan changes
+func (a *App) InvalidateAllOrgPlansCache() {
+	if a.Redis == nil {
+		return
+	}
+	a.deleteKeysByPattern(context.Background(), orgPlanCachePrefix+"*")
+}
+
+// orgTrialCache wraps the cached trial end so organizations without a trial are cached too
+type orgTrialCache struct {
+	EndsAt *time.Time `json:"ends_at"`
+}
+
+// getOrgTrialEndsCached retrieves when an organization's trial ends from cache or database.
+// Returns nil when the organization is not on a trial.
+func (a *App) getOrgTrialEndsCached(orgID uuid.UUID) (*time.Time, error) {
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", orgTrialCachePrefix, orgID.String())
+
+	// Try cache first
+	if a.Redis != nil {
+		cached, err := a.Redis.Get(ctx, cacheKey).Result()
+		if err == nil && cached != "" {
+			var entry orgTrialCache
+			if err := json.Unmarshal([]byte(cached), &entry); err == nil {
+				return entry.EndsAt, nil
+			}
+		}
+	}
+
+	// Cache miss - fetch from database
+	var org models.Organization
+	if err := a.DB.Select("trial_ends_at").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return nil, err
+	}
+	entry := orgTrialCache{EndsAt: org.TrialEndsAt}
+
+	// Cache the result
+	if a.Redis != nil {
+		if data, err := json.Marshal(entry); err == nil {
+			a.Redis.Set(ctx, cacheKey, data, orgTrialCacheTTL)
+		}
+	}
+
+	return entry.EndsAt, nil
+}
+
+// InvalidateOrgTrialCache invalidates the trial cache for an organization
+func (a *App) InvalidateOrgTrialCache(orgID uuid.UUID) {
+	if a.Redis == nil {
+		return
+	}
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", orgTrialCachePrefix, orgID.String())
+	a.Redis.Del(ctx, cacheKey)
+}
+
+// getOrgQuotasCached retrieves the fair-use quotas set on an organization from cache
+// or database, before deployment defaults are applied
+func (a *App) getOrgQuotasCached(orgID uuid.UUID) (models.FairUseQuotas, error) {
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", orgQuotasCachePrefix, orgID.String())
+
+	// Try cache first
+	if a.Redis != nil {
+		cached, err := a.Redis.Get(ctx, cacheKey).Result()
+		if err == nil && cached != "" {
+			var quotas models.FairUseQuotas
+			if err := json.Unmarshal([]byte(cached), &quotas); err == nil {
+				return quotas, nil
+			}
+		}
+	}
+
+	// Cache miss - fetch from database
+	var org models.Organization
+	if err := a.DB.Select("quota_daily_messages", "quota_monthly_messages", "quota_daily_ai_calls", "quota_monthly_ai_calls").
+		Where("id = ?", orgID).First(&org).Error; err != nil {
+		return models.FairUseQuotas{}, err
+	}
+
+	// Cache the result
+	if a.Redis != nil {
+		if data, err := json.Marshal(org.Quotas); err == nil {
+			a.Redis.Set(ctx, cacheKey, data, orgQuotasCacheTTL)
+		}
+	}
+
+	return org.Quotas, nil
+}
+
+// InvalidateOrgQuotasCache invalidates the fair-use quotas cache for an organization
+func (a *App) InvalidateOrgQuotasCache(orgID uuid.UUID) {
+	if a.Redis == nil {
+		return
+	}
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", orgQuotasCachePrefix, orgID.String())
+	a.Redis.Del(ctx, cacheKey)
+}
+
+// getOrgAllowedIPsCached retrieves the IPs an organization allows its members to
+// use the API from, from cache or database. Empty when any IP is allowed.
+func (a *App) getOrgAllowedIPsCached(orgID uuid.UUID) ([]string, error) {
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", orgAllowedIPsCachePrefix, orgID.String())
+
+	// Try cache first
+	if a.Redis != nil {
+		cached, err := a.Redis.Get(ctx, cacheKey).Result()
+		if err == nil && cached != "" {
+			var allowed []string
+			if err := json.Unmarshal([]byte(cached), &allowed); err == nil {
+				return allowed, nil
+			}
+		}
+	}
+
+	// Cache miss - fetch from database
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return nil, err
+	}
+	allowed := orgAllowedIPs(&org)
+
+	// Cache the result
+	if a.Redis != nil {
+		if data, err := json.Marshal(allowed); err == nil {
+			a.Redis.Set(ctx, cacheKey, data, orgAllowedIPsCacheTTL)
+		}
+	}
+
+	return allowed, nil
+}
+
+// InvalidateOrgAllowedIPsCache invalidates the allowed IPs cache for an organization
+func (a *App) InvalidateOrgAllowedIPsCache(orgID uuid.UUID) {
+	if a.Redis == nil {
+		return
+	}
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", orgAllowedIPsCachePrefix, orgID.String())
+	a.Redis.Del(ctx, cacheKey)
+}
+
+// getSegmentCountCached retrieves how many contacts a segment matches from cache or database
+func (a *App) getSegmentCountCached(segment *models.Segment) (int64, error) {
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", segmentCountCachePrefix, segment.ID.String())
+
+	// Try cache first
+	if a.Redis != nil {
+		cached, err := a.Redis.Get(ctx, cacheKey).Int64()
+		if err == nil {
+			return cached, nil
+		}
+	}
+
+	// Cache miss - count in the database
+	query, err := a.segmentContactsQuery(segment.OrganizationID, decodeSegmentConditions(segment.Conditions))
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	// Cache the result
+	if a.Redis != nil {
+		a.Redis.Set(ctx, cacheKey, count, segmentCountCacheTTL)
+	}
+
+	return count, nil
+}
+
+// InvalidateSegmentCountCache invalidates the contact count cache for a segment
+func (a *App) InvalidateSegmentCountCache(segmentID uuid.UUID) {
+	if a.Redis == nil {
+		return
+	}
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("%s%s", segmentCountCachePrefix, segmentID.String())
+	a.Redis.Del(ctx, cacheKey)
+}
+
 // getSLAEnabledSettingsCached retrieves all SLA-enabled chatbot settings from cache or database
 func (a *App) getSLAEnabledSettingsCached() ([]models.ChatbotSettings, error) {
 	ctx := context.Background()
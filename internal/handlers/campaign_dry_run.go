@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+const (
+	// maxCampaignPreviews is how many rendered messages a dry run returns
+	maxCampaignPreviews = 5
+	// maxCampaignDryRunErrors caps the recipient errors a dry run returns
+	maxCampaignDryRunErrors = 1000
+	// maxTemplateBodyLength is the longest template body WhatsApp sends, parameters included
+	maxTemplateBodyLength = 1024
+)
+
+// CampaignDryRunResponse is what starting a campaign would send, worked out without sending it
+type CampaignDryRunResponse struct {
+	TotalRecipients   int                      `json:"total_recipients"`
+	ValidRecipients   int                      `json:"valid_recipients"`
+	InvalidRecipients int                      `json:"invalid_recipients"`
+	Issues            []string                 `json:"issues"`   // Problems that stop the campaign from starting
+	Warnings          []string                 `json:"warnings"` // Problems that don't, like sends held back by limits
+	Preview           []CampaignMessagePreview `json:"preview"`
+	Errors            []CampaignRecipientError `json:"errors"` // Recipients whose message would fail
+	EstimatedCost     CampaignCostEstimate     `json:"estimated_cost"`
+}
+
+// CampaignMessagePreview is the message a recipient would get
+type CampaignMessagePreview struct {
+	RecipientID   uuid.UUID `json:"recipient_id"`
+	PhoneNumber   string    `json:"phone_number"`
+	RecipientName string    `json:"recipient_name"`
+	Header        string    `json:"header,omitempty"`
+	Body          string    `json:"body"`
+	Footer        string    `json:"footer,omitempty"`
+}
+
+// CampaignRecipientError is why a recipient's message would fail
+type CampaignRecipientError struct {
+	RecipientID uuid.UUID `json:"recipient_id"`
+	PhoneNumber string    `json:"phone_number"`
+	Errors      []string  `json:"errors"`
+}
+
+// CampaignCostEstimate is what Meta would bill for the valid recipients at the
+// organization's conversation rates, and what a prepaid wallet would be debited
+type CampaignCostEstimate struct {
+	Category      string `json:"category"`
+	Messages      int    `json:"messages"`
+	Rate          int64  `json:"rate"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	WalletAmount  *int64 `json:"wallet_amount,omitempty"`
+	WalletBalance *int64 `json:"wallet_balance,omitempty"`
+}
+
+// DryRunCampaign renders a campaign's template for each pending recipient and checks
+// the messages against WhatsApp's constraints, returning a preview, the recipients
+// whose message would fail and the estimated cost. Nothing is sent or changed.
+func (a *App) DryRunCampaign(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	if !a.HasFeature(orgID, models.PlanFeatureCampaigns) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureCampaigns), nil, "")
+	}
+
+	campaignID := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(campaignID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid campaign ID", nil, "")
+	}
+
+	var campaign models.BulkMessageCampaign
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&campaign).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Campaign not found", nil, "")
+	}
+
+	var recipients []models.BulkMessageRecipient
+	if err := a.DB.Where("campaign_id = ? AND status = ?", id, models.MessageStatusPending).
+		Order("created_at ASC").Find(&recipients).Error; err != nil {
+		a.Log.Error("Failed to load recipients", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load recipients", nil, "")
+	}
+
+	return r.SendEnvelope(a.dryRunCampaign(&campaign, recipients))
+}
+
+// dryRunCampaign checks a campaign and the messages its recipients would get
+func (a *App) dryRunCampaign(campaign *models.BulkMessageCampaign, recipients []models.BulkMessageRecipient) *CampaignDryRunResponse {
+	result := &CampaignDryRunResponse{
+		TotalRecipients: len(recipients),
+		Issues:          []string{},
+		Warnings:        []string{},
+		Preview:         []CampaignMessagePreview{},
+		Errors:          []CampaignRecipientError{},
+	}
+
+	if campaign.Status != models.CampaignStatusDraft && campaign.Status != models.CampaignStatusScheduled && campaign.Status != models.CampaignStatusPaused {
+		result.Issues = append(result.Issues, "Campaign cannot be started in its current state")
+	}
+	if len(recipients) == 0 {
+		result.Issues = append(result.Issues, "Campaign has no pending recipients")
+	}
+
+	var account models.WhatsAppAccount
+	hasAccount := a.DB.Where("name = ? AND organization_id = ?", campaign.WhatsAppAccount, campaign.OrganizationID).First(&account).Error == nil
+	if !hasAccount {
+		result.Issues = append(result.Issues, "WhatsApp account not found")
+	}
+
+	var template models.Template
+	if err := a.DB.Where("id = ? AND organization_id = ?", campaign.TemplateID, campaign.OrganizationID).First(&template).Error; err != nil {
+		result.Issues = append(result.Issues, "Template not found")
+		result.InvalidRecipients = len(recipients)
+		return result
+	}
+	result.Issues = append(result.Issues, templateSendIssues(campaign, &template)...)
+
+	optedOut := a.optedOutPhones(campaign.OrganizationID, recipients)
+	seen := make(map[string]bool, len(recipients))
+	for i := range recipients {
+		recipient := &recipients[i]
+		phone := strings.TrimPrefix(recipient.PhoneNumber, "+")
+		params := templateParamStrings(recipient.TemplateParams)
+		body := replaceTemplateParams(template.BodyContent, params)
+
+		var errs []string
+		if !validRecipientPhone(recipient.PhoneNumber) {
+			errs = append(errs, "Invalid phone number")
+		} else if digits := searchPhoneDigits(phone); seen[digits] {
+			errs = append(errs, "Duplicate of another recipient")
+		} else {
+			seen[digits] = true
+		}
+		if optedOut[phone] {
+			errs = append(errs, "Contact has opted out")
+		}
+		errs = append(errs, templateParamErrors(&template, params)...)
+		if utf8.RuneCountInString(body) > maxTemplateBodyLength {
+			errs = append(errs, fmt.Sprintf("Message body is longer than %d characters", maxTemplateBodyLength))
+		}
+
+		if len(errs) > 0 {
+			result.InvalidRecipients++
+			if len(result.Errors) < maxCampaignDryRunErrors {
+				result.Errors = append(result.Errors, CampaignRecipientError{
+					RecipientID: recipient.ID,
+					PhoneNumber: recipient.PhoneNumber,
+					Errors:      errs,
+				})
+			}
+			continue
+		}
+
+		result.ValidRecipients++
+		if len(result.Preview) < maxCampaignPreviews {
+			preview := CampaignMessagePreview{
+				RecipientID:   recipient.ID,
+				PhoneNumber:   recipient.PhoneNumber,
+				RecipientName: recipient.RecipientName,
+				Body:          body,
+				Footer:        template.FooterContent,
+			}
+			if template.HeaderType == "TEXT" {
+				preview.Header = template.HeaderContent
+			}
+			result.Preview = append(result.Preview, preview)
+		}
+	}
+
+	// The checks StartCampaign makes for the organization
+	if err := a.checkTrialActive(campaign.OrganizationID); err != nil {
+		result.Issues = append(result.Issues, err.Error())
+	}
+	if err := a.checkCampaignQuota(campaign.OrganizationID, result.ValidRecipients); err != nil {
+		result.Issues = append(result.Issues, err.Error())
+	}
+	if err := a.checkWalletBalance(campaign.OrganizationID); err != nil {
+		result.Issues = append(result.Issues, err.Error())
+	}
+
+	if hasAccount {
+		if limit := queue.ConversationLimit(account.MessagingLimitTier); limit > 0 && result.ValidRecipients > limit {
+			result.Warnings = append(result.Warnings, fmt.Sprintf(
+				"The number's messaging limit is %d conversations per 24 hours, so sending to %d recipients takes more than a day",
+				limit, result.ValidRecipients))
+		}
+	}
+
+	result.EstimatedCost = a.estimateCampaignCost(campaign.OrganizationID, &template, result.ValidRecipients)
+	return result
+}
+
+// templateSendIssues returns why a campaign's template can't be sent
+func templateSendIssues(campaign *models.BulkMessageCampaign, template *models.Template) []string {
+	var issues []string
+	if template.QualityScore == models.TemplateQualityRed || isTemplateStatusUnsafe(template.Status) {
+		issues = append(issues, "Template quality is low or paused by Meta")
+	} else if template.Status != string(models.TemplateStatusApproved) {
+		issues = append(issues, fmt.Sprintf("Template is not approved (status %s)", template.Status))
+	}
+	switch template.HeaderType {
+	case "IMAGE", "VIDEO", "DOCUMENT":
+		if campaign.HeaderMediaID == "" && template.HeaderContent == "" {
+			issues = append(issues, fmt.Sprintf("Template needs a header %s but the campaign has none", strings.ToLower(template.HeaderType)))
+		}
+	}
+	return issues
+}
+
+// templateParamErrors returns the problems of a recipient's template parameters:
+// missing values, and values WhatsApp rejects
+func templateParamErrors(template *models.Template, params map[string]string) []string {
+	var errs []string
+	missing, names := missingTemplateParams(template, params)
+	if len(missing) > 0 {
+		errs = append(errs, "Missing template parameters: "+strings.Join(missing, ", "))
+	}
+	for i, value := range ResolveParams(names, params) {
+		if strings.ContainsAny(value, "\n\t") || strings.Contains(value, "     ") {
+			errs = append(errs, fmt.Sprintf("Parameter %q can't contain new lines, tabs or more than 4 consecutive spaces", names[i]))
+		}
+	}
+	return errs
+}
+
+// templateParamStrings converts a recipient's template parameters to strings
+func templateParamStrings(params models.JSONB) map[string]string {
+	values := make(map[string]string, len(params))
+	for k, v := range params {
+		if v != nil {
+			values[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return values
+}
+
+// validRecipientPhone reports whether a phone number is one WhatsApp can send to:
+// an international number of 7 to 15 digits, with optional formatting
+func validRecipientPhone(phone string) bool {
+	for _, c := range phone {
+		if (c < '0' || c > '9') && !strings.ContainsRune("+ -()", c) {
+			return false
+		}
+	}
+	digits := searchPhoneDigits(phone)
+	return len(digits) >= 7 && len(digits) <= 15
+}
+
+// optedOutPhones returns the phone numbers of recipients whose contact opted out,
+// without a "+" prefix
+func (a *App) optedOutPhones(orgID uuid.UUID, recipients []models.BulkMessageRecipient) map[string]bool {
+	phones := make([]string, 0, 2*len(recipients))
+	for _, recipient := range recipients {
+		phone := strings.TrimPrefix(recipient.PhoneNumber, "+")
+		phones = append(phones, phone, "+"+phone)
+	}
+
+	optedOut := map[string]bool{}
+	for start := 0; start < len(phones); start += 1000 {
+		var matches []string
+		if err := a.DB.Model(&models.Contact{}).
+			Where("organization_id = ? AND opt_in_status = ? AND phone_number IN ?", orgID, models.ContactOptInStatusOptedOut, phones[start:min(start+1000, len(phones))]).
+			Pluck("phone_number", &matches).Error; err != nil {
+			a.Log.Error("Failed to load opted out contacts", "error", err, "org_id", orgID)
+			return optedOut
+		}
+		for _, phone := range matches {
+			optedOut[strings.TrimPrefix(phone, "+")] = true
+		}
+	}
+	return optedOut
+}
+
+// estimateCampaignCost estimates what sending a template to n recipients costs
+func (a *App) estimateCampaignCost(orgID uuid.UUID, template *models.Template, n int) CampaignCostEstimate {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		a.Log.Error("Failed to load organization for cost estimate", "error", err, "org_id", orgID)
+	}
+	costs := conversationCostSettings(org.Settings)
+
+	category := strings.ToLower(template.Category)
+	rate := costs.ConversationRates.rate(category)
+	estimate := CampaignCostEstimate{
+		Category: category,
+		Messages: n,
+		Rate:     rate,
+		Amount:   rate * int64(n),
+		Currency: costs.ConversationCurrency,
+	}
+
+	if wallet, err := a.orgWallet(orgID); err == nil && wallet != nil {
+		var walletAmount int64
+		if plan := a.orgPlan(orgID); plan != nil {
+			walletAmount = walletConversationRate(plan.WalletRates, category) * int64(n)
+		}
+		estimate.WalletAmount = &walletAmount
+		estimate.WalletBalance = &wallet.Balance
+	}
+	return estimate
+}
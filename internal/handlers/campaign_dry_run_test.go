@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidRecipientPhone(t *testing.T) {
+	assert.True(t, validRecipientPhone("+1 (555) 010-0001"))
+	assert.True(t, validRecipientPhone("919876543210"))
+	assert.False(t, validRecipientPhone("12345"))
+	assert.False(t, validRecipientPhone("1234567890123456"))
+	assert.False(t, validRecipientPhone("+1 555 CALL NOW"))
+}
+
+func TestTemplateParamErrors(t *testing.T) {
+	template := &models.Template{BodyContent: "Hi {{name}}, your order {{order_id}} has shipped."}
+
+	assert.Empty(t, templateParamErrors(template, map[string]string{"name": "Ana", "order_id": "1042"}))
+	assert.Empty(t, templateParamErrors(template, map[string]string{"1": "Ana", "2": "1042"}), "positional values work too")
+	assert.Equal(t, []string{"Missing template parameters: order_id"},
+		templateParamErrors(template, map[string]string{"name": "Ana"}))
+	assert.Equal(t, []string{`Parameter "name" can't contain new lines, tabs or more than 4 consecutive spaces`},
+		templateParamErrors(template, map[string]string{"name": "Ana\nMaria", "order_id": "1042"}))
+}
+
+func TestTemplateSendIssues(t *testing.T) {
+	campaign := &models.BulkMessageCampaign{}
+	approved := &models.Template{Status: string(models.TemplateStatusApproved), HeaderType: "TEXT"}
+	assert.Empty(t, templateSendIssues(campaign, approved))
+
+	assert.Equal(t, []string{"Template is not approved (status PENDING)"},
+		templateSendIssues(campaign, &models.Template{Status: "PENDING"}))
+	assert.Equal(t, []string{"Template quality is low or paused by Meta"},
+		templateSendIssues(campaign, &models.Template{Status: "PAUSED"}))
+
+	image := &models.Template{Status: string(models.TemplateStatusApproved), HeaderType: "IMAGE"}
+	assert.Equal(t, []string{"Template needs a header image but the campaign has none"}, templateSendIssues(campaign, image))
+	assert.Empty(t, templateSendIssues(&models.BulkMessageCampaign{HeaderMediaID: "media-1"}, image))
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// CampaignScheduler launches scheduled campaigns once their send time is reached, and
+// promotes the winning variant of A/B tests once they end
+type CampaignScheduler struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewCampaignScheduler creates a new campaign scheduler
+func NewCampaignScheduler(app *App, interval time.Duration) *CampaignScheduler {
+	return &CampaignScheduler{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the campaign scheduling loop
+func (s *CampaignScheduler) Start(ctx context.Context) {
+	s.app.Log.Info("Campaign scheduler started", "interval", s.interval)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.app.Log.Info("Campaign scheduler stopped by context")
+			return
+		case <-s.stopCh:
+			s.app.Log.Info("Campaign scheduler stopped")
+			return
+		case <-ticker.C:
+			s.launchDueCampaigns(ctx)
+			s.promoteCampaignWinners(ctx)
+		}
+	}
+}
+
+// Stop stops the campaign scheduler
+func (s *CampaignScheduler) Stop() {
+	close(s.stopCh)
+}
+
+// launchDueCampaigns starts scheduled campaigns whose send time has passed.
+// Campaigns due on a holiday are held until the next working day.
+func (s *CampaignScheduler) launchDueCampaigns(ctx context.Context) {
+	now := time.Now()
+
+	var campaigns []models.BulkMessageCampaign
+	if err := s.app.DB.Where("status = ? AND scheduled_at IS NOT NULL AND scheduled_at <= ?",
+		models.CampaignStatusScheduled, now).
+		Find(&campaigns).Error; err != nil {
+		s.app.Log.Error("Failed to find scheduled campaigns", "error", err)
+		return
+	}
+
+	for i := range campaigns {
+		campaign := &campaigns[i]
+
+		loc := s.app.getOrgLocation(campaign.OrganizationID)
+		if loc == nil {
+			loc = time.Local
+		}
+		if s.app.isHoliday(campaign.OrganizationID, campaign.WhatsAppAccount, now.In(loc)) {
+			continue
+		}
+
+		// The plan may have been downgraded since the campaign was scheduled
+		if !s.app.HasFeature(campaign.OrganizationID, models.PlanFeatureCampaigns) {
+			s.app.Log.Warn("Scheduled campaign paused, campaigns are not on the plan", "campaign_id", campaign.ID)
+			if err := s.app.autoPauseCampaign(campaign, featureUnavailableMessage(models.PlanFeatureCampaigns)); err != nil {
+				s.app.Log.Error("Failed to pause campaign", "error", err, "campaign_id", campaign.ID)
+			}
+			continue
+		}
+
+		var recipients []models.BulkMessageRecipient
+		if err := s.app.DB.Where("campaign_id = ? AND status = ?", campaign.ID, models.MessageStatusPending).
+			Find(&recipients).Error; err != nil {
+			s.app.Log.Error("Failed to load recipients", "error", err, "campaign_id", campaign.ID)
+			continue
+		}
+
+		if len(recipients) == 0 {
+			s.app.Log.Warn("Scheduled campaign has no pending recipients", "campaign_id", campaign.ID)
+			s.app.DB.Model(campaign).Updates(map[string]interface{}{
+				"status":       models.CampaignStatusCompleted,
+				"completed_at": now,
+			})
+			s.app.dispatchCampaignCompletedWebhook(campaign.ID)
+			continue
+		}
+
+		err := s.app.launchCampaign(ctx, campaign, recipients)
+		var quotaErr *QuotaExceededError
+		switch {
+		case err == nil, errors.Is(err, errCampaignNotLaunchable):
+		case errors.As(err, &quotaErr):
+			// Waiting won't help until the quota resets, so pause for the user to decide
+			s.app.Log.Warn("Scheduled campaign exceeds plan quota", "campaign_id", campaign.ID, "error", err)
+			if err := s.app.autoPauseCampaign(campaign, quotaErr.Error()); err != nil {
+				s.app.Log.Error("Failed to pause campaign", "error", err, "campaign_id", campaign.ID)
+			}
+		case errors.Is(err, errWalletDepleted), errors.Is(err, errTrialExpired):
+			s.app.Log.Warn("Scheduled campaign paused", "campaign_id", campaign.ID, "reason", err)
+			if err := s.app.autoPauseCampaign(campaign, err.Error()); err != nil {
+				s.app.Log.Error("Failed to pause campaign", "error", err, "campaign_id", campaign.ID)
+			}
+		default:
+			s.app.Log.Error("Failed to launch scheduled campaign", "error", err, "campaign_id", campaign.ID)
+		}
+	}
+}
+
+// promoteCampaignWinners sends the winning variant of running campaigns whose test
+// ended to the rest of their audience
+func (s *CampaignScheduler) promoteCampaignWinners(ctx context.Context) {
+	var campaigns []models.BulkMessageCampaign
+	if err := s.app.DB.Where("status = ? AND auto_promote = ? AND winner_variant_id IS NULL AND test_ends_at <= ?",
+		models.CampaignStatusProcessing, true, time.Now()).
+		Find(&campaigns).Error; err != nil {
+		s.app.Log.Error("Failed to find campaigns to promote", "error", err)
+		return
+	}
+
+	for i := range campaigns {
+		if err := s.app.promoteCampaignWinner(ctx, &campaigns[i]); err != nil {
+			s.app.Log.Error("Failed to promote campaign winner", "error", err, "campaign_id", campaigns[i].ID)
+		}
+	}
+}
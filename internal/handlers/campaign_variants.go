@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxCampaignVariants limits the templates an A/B tested campaign sends
+	maxCampaignVariants = 5
+	// maxCampaignTestHours is the longest a campaign's test can run before the
+	// winner is picked
+	maxCampaignTestHours = 7 * 24
+	// campaignReplyWindow is how long after a campaign message the contact's next
+	// message counts as a reply to it
+	campaignReplyWindow = 72 * time.Hour
+	// campaignVariantBatchSize is how many recipients get their variant per update
+	campaignVariantBatchSize = 1000
+)
+
+// CampaignVariantRequest is a variant of a campaign in create and update requests
+type CampaignVariantRequest struct {
+	Name          string `json:"name"` // Defaults to A, B, ... by position
+	TemplateID    string `json:"template_id"`
+	HeaderMediaID string `json:"header_media_id"`
+	Percent       int    `json:"percent"` // Share of the recipients, 1-100
+}
+
+// CampaignVariantResponse is a variant of a campaign in API responses
+type CampaignVariantResponse struct {
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	TemplateID    uuid.UUID `json:"template_id"`
+	TemplateName  string    `json:"template_name,omitempty"`
+	HeaderMediaID string    `json:"header_media_id,omitempty"`
+	Percent       int       `json:"percent"`
+}
+
+// CampaignVariantResult is how the recipients of a campaign variant responded
+type CampaignVariantResult struct {
+	CampaignVariantResponse
+	Recipients   int64   `json:"recipients"` // Recipients assigned the variant so far
+	Sent         int64   `json:"sent"`
+	Delivered    int64   `json:"delivered"`
+	Read         int64   `json:"read"`
+	Replied      int64   `json:"replied"`
+	Failed       int64   `json:"failed"`
+	DeliveryRate float64 `json:"delivery_rate"` // Share of sent messages that were delivered
+	ReadRate     float64 `json:"read_rate"`     // Share of delivered messages that were read
+	ReplyRate    float64 `json:"reply_rate"`    // Share of delivered messages that got a reply
+	Winner       bool    `json:"winner"`
+}
+
+// campaignVariantResponses converts a campaign's variants for API responses
+func campaignVariantResponses(variants []models.CampaignVariant) []CampaignVariantResponse {
+	if len(variants) == 0 {
+		return nil
+	}
+	response := make([]CampaignVariantResponse, len(variants))
+	for i, v := range variants {
+		response[i] = CampaignVariantResponse{
+			ID:            v.ID,
+			Name:          v.Name,
+			TemplateID:    v.TemplateID,
+			HeaderMediaID: v.HeaderMediaID,
+			Percent:       v.Percent,
+		}
+		if v.Template != nil {
+			response[i].TemplateName = v.Template.Name
+		}
+	}
+	return response
+}
+
+// sortedCampaignVariants orders a campaign's variants by name, as the API lists them
+func sortedCampaignVariants(variants []models.CampaignVariant) []models.CampaignVariant {
+	sort.SliceStable(variants, func(i, j int) bool { return variants[i].Name < variants[j].Name })
+	return variants
+}
+
+// validateCampaignVariants checks the variants of a campaign request, and returns
+// them ready to be saved. No variants means the campaign isn't A/B tested.
+func (a *App) validateCampaignVariants(orgID uuid.UUID, variants []CampaignVariantRequest) ([]models.CampaignVariant, error) {
+	if len(variants) == 0 {
+		return nil, nil
+	}
+	if len(variants) == 1 {
+		return nil, fmt.Errorf("A/B tests need at least 2 variants")
+	}
+	if len(variants) > maxCampaignVariants {
+		return nil, fmt.Errorf("at most %d variants are allowed", maxCampaignVariants)
+	}
+
+	result := make([]models.CampaignVariant, len(variants))
+	seen := make(map[string]bool, len(variants))
+	total := 0
+	for i, v := range variants {
+		name := strings.TrimSpace(v.Name)
+		if name == "" {
+			name = string(rune('A' + i))
+		}
+		if len(name) > 50 {
+			return nil, fmt.Errorf("variant name %q is too long", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate variant name %q", name)
+		}
+		seen[name] = true
+
+		templateID, err := uuid.Parse(v.TemplateID)
+		if err != nil {
+			return nil, fmt.Errorf("variant %s has an invalid template ID", name)
+		}
+		var template models.Template
+		if err := a.DB.Where("id = ? AND organization_id = ?", templateID, orgID).First(&template).Error; err != nil {
+			return nil, fmt.Errorf("template of variant %s not found", name)
+		}
+		if v.Percent < 1 || v.Percent > 100 {
+			return nil, fmt.Errorf("variant %s must get between 1 and 100 percent of recipients", name)
+		}
+		total += v.Percent
+
+		result[i] = models.CampaignVariant{
+			Name:          name,
+			TemplateID:    templateID,
+			HeaderMediaID: strings.TrimSpace(v.HeaderMediaID),
+			Percent:       v.Percent,
+			Template:      &template,
+		}
+	}
+	if total != 100 {
+		return nil, fmt.Errorf("variants must add up to 100 percent of recipients, got %d", total)
+	}
+	return result, nil
+}
+
+// validateCampaignTest checks and normalizes the test settings of a campaign
+// request. Without auto-promotion, every recipient gets a variant and the test
+// settings are cleared.
+func validateCampaignTest(req *CampaignRequest, variants int) error {
+	if !req.AutoPromote {
+		req.TestPercent, req.TestDurationHours, req.WinnerMetric = 0, 0, ""
+		return nil
+	}
+	if variants == 0 {
+		return fmt.Errorf("auto-promoting a winner needs variants")
+	}
+	if req.TestPercent < 1 || req.TestPercent > 99 {
+		return fmt.Errorf("test_percent must be between 1 and 99")
+	}
+	if req.TestDurationHours < 1 || req.TestDurationHours > maxCampaignTestHours {
+		return fmt.Errorf("test_duration_hours must be between 1 and %d", maxCampaignTestHours)
+	}
+	switch models.CampaignWinnerMetric(req.WinnerMetric) {
+	case "":
+		req.WinnerMetric = string(models.CampaignWinnerMetricReadRate)
+	case models.CampaignWinnerMetricDeliveryRate, models.CampaignWinnerMetricReadRate, models.CampaignWinnerMetricReplyRate:
+	default:
+		return fmt.Errorf("unsupported winner_metric %q", req.WinnerMetric)
+	}
+	return nil
+}
+
+// replaceCampaignVariants replaces the variants of a draft campaign
+func replaceCampaignVariants(tx *gorm.DB, campaignID uuid.UUID, variants []models.CampaignVariant) error {
+	if err := tx.Where("campaign_id = ?", campaignID).Delete(&models.CampaignVariant{}).Error; err != nil {
+		return err
+	}
+	for i := range variants {
+		variants[i].CampaignID = campaignID
+		if err := tx.Omit("Template", "Campaign").Create(&variants[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitByPercent divides n recipients among variants by their percentages. Those
+// left over by rounding go to the variants with the largest remainders.
+func splitByPercent(variants []models.CampaignVariant, n int) []int {
+	counts := make([]int, len(variants))
+	remainders := make([]int, len(variants))
+	total, assigned := 0, 0
+	for _, v := range variants {
+		total += v.Percent
+	}
+	if total == 0 {
+		return counts
+	}
+	for i, v := range variants {
+		counts[i] = n * v.Percent / total
+		remainders[i] = n * v.Percent % total
+		assigned += counts[i]
+	}
+	order := make([]int, len(variants))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return remainders[order[i]] > remainders[order[j]] })
+	for k := 0; assigned < n; k++ {
+		counts[order[k%len(order)]]++
+		assigned++
+	}
+	return counts
+}
+
+// assignCampaignVariants gives the recipients variants at random, in the variants'
+// proportions
+func assignCampaignVariants(variants []models.CampaignVariant, recipients []models.BulkMessageRecipient) {
+	rand.Shuffle(len(recipients), func(i, j int) { recipients[i], recipients[j] = recipients[j], recipients[i] })
+	next := 0
+	for i, count := range splitByPercent(variants, len(recipients)) {
+		for j := next; j < next+count; j++ {
+			recipients[j].VariantID = &variants[i].ID
+		}
+		next += count
+	}
+}
+
+// planCampaignVariants picks the pending recipients a launch of an A/B tested
+// campaign sends to, and assigns variants to those without one. With
+// auto-promotion, the first launch starts the test on a share of the audience and
+// returns when it ends; the rest of the audience waits for the winner.
+func (a *App) planCampaignVariants(campaign *models.BulkMessageCampaign, recipients []models.BulkMessageRecipient, now time.Time) ([]models.BulkMessageRecipient, *time.Time, error) {
+	var variants []models.CampaignVariant
+	if err := a.DB.Where("campaign_id = ?", campaign.ID).Find(&variants).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(variants) == 0 {
+		return recipients, nil, nil
+	}
+	variants = sortedCampaignVariants(variants)
+
+	var send, unassigned []models.BulkMessageRecipient
+	for _, recipient := range recipients {
+		if recipient.VariantID != nil {
+			send = append(send, recipient)
+		} else {
+			unassigned = append(unassigned, recipient)
+		}
+	}
+
+	switch {
+	case campaign.WinnerVariantID != nil:
+		// The test is over, so the rest of the audience gets the winner
+		for i := range unassigned {
+			unassigned[i].VariantID = campaign.WinnerVariantID
+		}
+		return append(send, unassigned...), nil, nil
+	case !campaign.AutoPromote:
+		assignCampaignVariants(variants, unassigned)
+		return append(send, unassigned...), nil, nil
+	case campaign.TestEndsAt == nil && len(unassigned) > 0:
+		rand.Shuffle(len(unassigned), func(i, j int) { unassigned[i], unassigned[j] = unassigned[j], unassigned[i] })
+		size := min(max(len(unassigned)*campaign.TestPercent/100, len(variants)), len(unassigned))
+		test := unassigned[:size]
+		assignCampaignVariants(variants, test)
+		endsAt := now.Add(time.Duration(campaign.TestDurationHours) * time.Hour)
+		return append(send, test...), &endsAt, nil
+	default:
+		// The test is running, so recipients held back from it keep waiting
+		return send, nil, nil
+	}
+}
+
+// saveRecipientVariants stores the variants assigned to recipients
+func (a *App) saveRecipientVariants(recipients []models.BulkMessageRecipient) error {
+	byVariant := make(map[uuid.UUID][]uuid.UUID)
+	for _, recipient := range recipients {
+		if recipient.VariantID != nil {
+			byVariant[*recipient.VariantID] = append(byVariant[*recipient.VariantID], recipient.ID)
+		}
+	}
+	for variantID, ids := range byVariant {
+		for start := 0; start < len(ids); start += campaignVariantBatchSize {
+			batch := ids[start:min(start+campaignVariantBatchSize, len(ids))]
+			if err := a.DB.Model(&models.BulkMessageRecipient{}).
+				Where("id IN ? AND variant_id IS NULL", batch).
+				Update("variant_id", variantID).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// campaignVariantResults returns how each variant of a campaign did, ordered by name
+func (a *App) campaignVariantResults(campaign *models.BulkMessageCampaign) ([]CampaignVariantResult, error) {
+	var variants []models.CampaignVariant
+	if err := a.DB.Where("campaign_id = ?", campaign.ID).Preload("Template").Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	variants = sortedCampaignVariants(variants)
+
+	var rows []struct {
+		VariantID  uuid.UUID
+		Recipients int64
+		Sent       int64
+		Delivered  int64
+		Read       int64
+		Replied    int64
+		Failed     int64
+	}
+	if err := a.DB.Model(&models.BulkMessageRecipient{}).
+		Where("campaign_id = ? AND variant_id IS NOT NULL", campaign.ID).
+		Select(`variant_id, COUNT(*) AS recipients,
+			COUNT(*) FILTER (WHERE status IN ('sent','delivered','read')) AS sent,
+			COUNT(*) FILTER (WHERE status IN ('delivered','read')) AS delivered,
+			COUNT(*) FILTER (WHERE status = 'read') AS read,
+			COUNT(*) FILTER (WHERE replied_at IS NOT NULL) AS replied,
+			COUNT(*) FILTER (WHERE status = 'failed') AS failed`).
+		Group("variant_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]CampaignVariantResult, len(variants))
+	responses := campaignVariantResponses(variants)
+	for i := range variants {
+		results[i].CampaignVariantResponse = responses[i]
+		results[i].Winner = campaign.WinnerVariantID != nil && *campaign.WinnerVariantID == variants[i].ID
+	}
+	for _, row := range rows {
+		for i := range results {
+			if results[i].ID != row.VariantID {
+				continue
+			}
+			r := &results[i]
+			r.Recipients, r.Sent, r.Delivered, r.Read, r.Replied, r.Failed = row.Recipients, row.Sent, row.Delivered, row.Read, row.Replied, row.Failed
+			if r.Sent > 0 {
+				r.DeliveryRate = float64(r.Delivered) * 100 / float64(r.Sent)
+			}
+			if r.Delivered > 0 {
+				r.ReadRate = float64(r.Read) * 100 / float64(r.Delivered)
+				r.ReplyRate = float64(r.Replied) * 100 / float64(r.Delivered)
+			}
+		}
+	}
+	return results, nil
+}
+
+// pickCampaignWinner picks the variant with the best rate of the metric. Ties go
+// to the variant that sent more messages, then to the first one.
+func pickCampaignWinner(results []CampaignVariantResult, metric models.CampaignWinnerMetric) *CampaignVariantResult {
+	rate := func(r *CampaignVariantResult) float64 {
+		switch metric {
+		case models.CampaignWinnerMetricDeliveryRate:
+			return r.DeliveryRate
+		case models.CampaignWinnerMetricReplyRate:
+			return r.ReplyRate
+		default:
+			return r.ReadRate
+		}
+	}
+	var winner *CampaignVariantResult
+	for i := range results {
+		r := &results[i]
+		if winner == nil || rate(r) > rate(winner) || (rate(r) == rate(winner) && r.Sent > winner.Sent) {
+			winner = r
+		}
+	}
+	return winner
+}
+
+// promoteCampaignWinner picks the winning variant of a campaign whose test ended,
+// and sends it to the recipients held back from the test
+func (a *App) promoteCampaignWinner(ctx context.Context, campaign *models.BulkMessageCampaign) error {
+	results, err := a.campaignVariantResults(campaign)
+	if err != nil {
+		return err
+	}
+	winner := pickCampaignWinner(results, campaign.WinnerMetric)
+	if winner == nil {
+		return nil
+	}
+
+	result := a.DB.Model(&models.BulkMessageCampaign{}).
+		Where("id = ? AND status = ? AND winner_variant_id IS NULL", campaign.ID, models.CampaignStatusProcessing).
+		Update("winner_variant_id", winner.ID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	campaign.WinnerVariantID = &winner.ID
+	a.log(ctx).Info("Campaign variant promoted", "campaign_id", campaign.ID, "variant", winner.Name, "metric", campaign.WinnerMetric)
+
+	var recipients []models.BulkMessageRecipient
+	if err := a.DB.Where("campaign_id = ? AND status = ? AND variant_id IS NULL", campaign.ID, models.MessageStatusPending).
+		Find(&recipients).Error; err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	// Recipients held back get the winner when a paused campaign is resumed
+	if err := a.checkCampaignSendable(campaign.OrganizationID, len(recipients)); err != nil {
+		return a.autoPauseCampaign(campaign, err.Error())
+	}
+	for i := range recipients {
+		recipients[i].VariantID = &winner.ID
+	}
+	if err := a.saveRecipientVariants(recipients); err != nil {
+		return err
+	}
+	if err := a.enqueueCampaignRecipients(ctx, campaign, recipients); err != nil {
+		return a.autoPauseCampaign(campaign, "Failed to queue the winning variant")
+	}
+	return nil
+}
+
+// recordCampaignReply marks the campaign messages a contact got recently as replied
+// to, for the reply rates of A/B tests
+func (a *App) recordCampaignReply(contact *models.Contact) {
+	now := time.Now()
+	since := now.Add(-campaignReplyWindow)
+	phone := strings.TrimPrefix(contact.PhoneNumber, "+")
+	campaigns := a.DB.Model(&models.BulkMessageCampaign{}).Select("id").
+		Where("organization_id = ? AND started_at IS NOT NULL AND (completed_at IS NULL OR completed_at > ?)", contact.OrganizationID, since)
+	if err := a.DB.Model(&models.BulkMessageRecipient{}).
+		Where("campaign_id IN (?) AND phone_number IN ? AND replied_at IS NULL AND sent_at > ?", campaigns, []string{phone, "+" + phone}, since).
+		Update("replied_at", now).Error; err != nil {
+		a.Log.Error("Failed to record campaign reply", "error", err, "contact_id", contact.ID)
+	}
+}
+
+// GetCampaignVariants returns how each variant of an A/B tested campaign did
+func (a *App) GetCampaignVariants(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid campaign ID", nil, "")
+	}
+
+	var campaign models.BulkMessageCampaign
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&campaign).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Campaign not found", nil, "")
+	}
+
+	results, err := a.campaignVariantResults(&campaign)
+	if err != nil {
+		a.Log.Error("Failed to load campaign variant results", "error", err, "campaign_id", id)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load campaign variants", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"variants":          results,
+		"auto_promote":      campaign.AutoPromote,
+		"winner_metric":     campaign.WinnerMetric,
+		"test_ends_at":      campaign.TestEndsAt,
+		"winner_variant_id": campaign.WinnerVariantID,
+	})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitByPercent(t *testing.T) {
+	variants := []models.CampaignVariant{{Percent: 50}, {Percent: 30}, {Percent: 20}}
+	assert.Equal(t, []int{50, 30, 20}, splitByPercent(variants, 100))
+	assert.Equal(t, []int{4, 2, 1}, splitByPercent(variants, 7))
+	assert.Equal(t, []int{1, 1, 0}, splitByPercent(variants, 2))
+	assert.Equal(t, []int{0, 0, 0}, splitByPercent(variants, 0))
+}
+
+func TestAssignCampaignVariants(t *testing.T) {
+	variants := []models.CampaignVariant{
+		{BaseModel: models.BaseModel{ID: uuid.New()}, Name: "A", Percent: 70},
+		{BaseModel: models.BaseModel{ID: uuid.New()}, Name: "B", Percent: 30},
+	}
+	recipients := make([]models.BulkMessageRecipient, 10)
+	assignCampaignVariants(variants, recipients)
+
+	counts := map[uuid.UUID]int{}
+	for _, r := range recipients {
+		require.NotNil(t, r.VariantID)
+		counts[*r.VariantID]++
+	}
+	assert.Equal(t, 7, counts[variants[0].ID])
+	assert.Equal(t, 3, counts[variants[1].ID])
+}
+
+func TestPickCampaignWinner(t *testing.T) {
+	results := []CampaignVariantResult{
+		{CampaignVariantResponse: CampaignVariantResponse{Name: "A"}, Sent: 100, ReadRate: 40, ReplyRate: 12, DeliveryRate: 98},
+		{CampaignVariantResponse: CampaignVariantResponse{Name: "B"}, Sent: 100, ReadRate: 55, ReplyRate: 8, DeliveryRate: 98},
+		{CampaignVariantResponse: CampaignVariantResponse{Name: "C"}, Sent: 120, ReadRate: 30, ReplyRate: 5, DeliveryRate: 98},
+	}
+	assert.Equal(t, "B", pickCampaignWinner(results, models.CampaignWinnerMetricReadRate).Name)
+	assert.Equal(t, "A", pickCampaignWinner(results, models.CampaignWinnerMetricReplyRate).Name)
+	// Ties go to the variant that sent more
+	assert.Equal(t, "C", pickCampaignWinner(results, models.CampaignWinnerMetricDeliveryRate).Name)
+	assert.Nil(t, pickCampaignWinner(nil, models.CampaignWinnerMetricReadRate))
+}
+
+func TestValidateCampaignTest(t *testing.T) {
+	req := CampaignRequest{AutoPromote: true, TestPercent: 20, TestDurationHours: 4}
+	require.NoError(t, validateCampaignTest(&req, 2))
+	assert.Equal(t, string(models.CampaignWinnerMetricReadRate), req.WinnerMetric)
+
+	req = CampaignRequest{TestPercent: 20, TestDurationHours: 4, WinnerMetric: "reply_rate"}
+	require.NoError(t, validateCampaignTest(&req, 2))
+	assert.Zero(t, req.TestPercent)
+	assert.Empty(t, req.WinnerMetric)
+
+	assert.Error(t, validateCampaignTest(&CampaignRequest{AutoPromote: true, TestPercent: 20, TestDurationHours: 4}, 0))
+	assert.Error(t, validateCampaignTest(&CampaignRequest{AutoPromote: true, TestPercent: 100, TestDurationHours: 4}, 2))
+	assert.Error(t, validateCampaignTest(&CampaignRequest{AutoPromote: true, TestPercent: 20, TestDurationHours: 0}, 2))
+	assert.Error(t, validateCampaignTest(&CampaignRequest{AutoPromote: true, TestPercent: 20, TestDurationHours: 4, WinnerMetric: "clicks"}, 2))
+}
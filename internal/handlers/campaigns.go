@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -11,7 +13,9 @@ import (
 	"github.com/google/uuid"
 	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/shridarpatil/whatomate/internal/storage"
 	"github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
 	"gorm.io/gorm"
@@ -24,6 +28,14 @@ type CampaignRequest struct {
 	TemplateID      string     `json:"template_id" validate:"required"`
 	HeaderMediaID   string     `json:"header_media_id"`
 	ScheduledAt     *time.Time `json:"scheduled_at"`
+
+	// A/B testing. On update, variants and the test settings are only changed when
+	// variants are given; an empty list removes them.
+	Variants          []CampaignVariantRequest `json:"variants"`
+	AutoPromote       bool                     `json:"auto_promote"`
+	TestPercent       int                      `json:"test_percent"`
+	TestDurationHours int                      `json:"test_duration_hours"`
+	WinnerMetric      string                   `json:"winner_metric"`
 }
 
 // CampaignResponse represents campaign in API responses
@@ -45,6 +57,14 @@ type CampaignResponse struct {
 	ScheduledAt     *time.Time           `json:"scheduled_at,omitempty"`
 	StartedAt       *time.Time           `json:"started_at,omitempty"`
 	CompletedAt     *time.Time           `json:"completed_at,omitempty"`
+	PausedReason    string               `json:"paused_reason,omitempty"`
+	Variants          []CampaignVariantResponse   `json:"variants,omitempty"`
+	AutoPromote       bool                        `json:"auto_promote"`
+	TestPercent       int                         `json:"test_percent,omitempty"`
+	TestDurationHours int                         `json:"test_duration_hours,omitempty"`
+	WinnerMetric      models.CampaignWinnerMetric `json:"winner_metric,omitempty"`
+	TestEndsAt        *time.Time                  `json:"test_ends_at,omitempty"`
+	WinnerVariantID   *uuid.UUID                  `json:"winner_variant_id,omitempty"`
 	CreatedAt       time.Time            `json:"created_at"`
 	UpdatedAt       time.Time            `json:"updated_at"`
 }
@@ -72,6 +92,7 @@ func (a *App) ListCampaigns(r *fastglue.Request) error {
 	var campaigns []models.BulkMessageCampaign
 	query := a.DB.Where("organization_id = ?", orgID).
 		Preload("Template").
+		Preload("Variants.Template").
 		Order("created_at DESC")
 
 	if status != "" {
@@ -118,6 +139,14 @@ func (a *App) ListCampaigns(r *fastglue.Request) error {
 			ScheduledAt:         c.ScheduledAt,
 			StartedAt:           c.StartedAt,
 			CompletedAt:         c.CompletedAt,
+			PausedReason:        c.PausedReason,
+			Variants:            campaignVariantResponses(sortedCampaignVariants(c.Variants)),
+			AutoPromote:         c.AutoPromote,
+			TestPercent:         c.TestPercent,
+			TestDurationHours:   c.TestDurationHours,
+			WinnerMetric:        c.WinnerMetric,
+			TestEndsAt:          c.TestEndsAt,
+			WinnerVariantID:     c.WinnerVariantID,
 			CreatedAt:           c.CreatedAt,
 			UpdatedAt:           c.UpdatedAt,
 		}
@@ -139,6 +168,10 @@ func (a *App) CreateCampaign(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
 	}
 
+	if !a.HasFeature(orgID, models.PlanFeatureCampaigns) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureCampaigns), nil, "")
+	}
+
 	userID, err := a.getUserIDFromContext(r)
 	if err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
@@ -149,6 +182,19 @@ func (a *App) CreateCampaign(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
 	}
 
+	variants, err := a.validateCampaignVariants(orgID, req.Variants)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	if err := validateCampaignTest(&req, len(variants)); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	// An A/B tested campaign's template is its first variant's
+	if len(variants) > 0 {
+		req.TemplateID = variants[0].TemplateID.String()
+		req.HeaderMediaID = variants[0].HeaderMediaID
+	}
+
 	// Validate template exists
 	templateID, err := uuid.Parse(req.TemplateID)
 	if err != nil {
@@ -175,9 +221,18 @@ func (a *App) CreateCampaign(r *fastglue.Request) error {
 		Status:          models.CampaignStatusDraft,
 		ScheduledAt:     req.ScheduledAt,
 		CreatedBy:       userID,
+		AutoPromote:       req.AutoPromote,
+		TestPercent:       req.TestPercent,
+		TestDurationHours: req.TestDurationHours,
+		WinnerMetric:      models.CampaignWinnerMetric(req.WinnerMetric),
 	}
 
-	if err := a.DB.Create(&campaign).Error; err != nil {
+	if err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&campaign).Error; err != nil {
+			return err
+		}
+		return replaceCampaignVariants(tx, campaign.ID, variants)
+	}); err != nil {
 		a.Log.Error("Failed to create campaign", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create campaign", nil, "")
 	}
@@ -199,6 +254,11 @@ func (a *App) CreateCampaign(r *fastglue.Request) error {
 		DeliveredCount:      campaign.DeliveredCount,
 		FailedCount:         campaign.FailedCount,
 		ScheduledAt:         campaign.ScheduledAt,
+		Variants:            campaignVariantResponses(variants),
+		AutoPromote:         campaign.AutoPromote,
+		TestPercent:         campaign.TestPercent,
+		TestDurationHours:   campaign.TestDurationHours,
+		WinnerMetric:        campaign.WinnerMetric,
 		CreatedAt:           campaign.CreatedAt,
 		UpdatedAt:           campaign.UpdatedAt,
 	})
@@ -220,6 +280,7 @@ func (a *App) GetCampaign(r *fastglue.Request) error {
 	var campaign models.BulkMessageCampaign
 	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).
 		Preload("Template").
+		Preload("Variants.Template").
 		First(&campaign).Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Campaign not found", nil, "")
 	}
@@ -240,6 +301,14 @@ func (a *App) GetCampaign(r *fastglue.Request) error {
 		ScheduledAt:         campaign.ScheduledAt,
 		StartedAt:           campaign.StartedAt,
 		CompletedAt:         campaign.CompletedAt,
+		PausedReason:        campaign.PausedReason,
+		Variants:            campaignVariantResponses(sortedCampaignVariants(campaign.Variants)),
+		AutoPromote:         campaign.AutoPromote,
+		TestPercent:         campaign.TestPercent,
+		TestDurationHours:   campaign.TestDurationHours,
+		WinnerMetric:        campaign.WinnerMetric,
+		TestEndsAt:          campaign.TestEndsAt,
+		WinnerVariantID:     campaign.WinnerVariantID,
 		CreatedAt:           campaign.CreatedAt,
 		UpdatedAt:           campaign.UpdatedAt,
 	}
@@ -293,16 +362,45 @@ func (a *App) UpdateCampaign(r *fastglue.Request) error {
 	}
 
 	if req.WhatsAppAccount != "" {
+		if !a.accountExists(orgID, req.WhatsAppAccount) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "WhatsApp account not found", nil, "")
+		}
 		updates["whats_app_account"] = req.WhatsAppAccount
 	}
 
-	if err := a.DB.Model(&campaign).Updates(updates).Error; err != nil {
+	var variants []models.CampaignVariant
+	if req.Variants != nil {
+		if variants, err = a.validateCampaignVariants(orgID, req.Variants); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		if err := validateCampaignTest(&req, len(variants)); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		if len(variants) > 0 {
+			updates["template_id"] = variants[0].TemplateID
+			updates["header_media_id"] = variants[0].HeaderMediaID
+		}
+		updates["auto_promote"] = req.AutoPromote
+		updates["test_percent"] = req.TestPercent
+		updates["test_duration_hours"] = req.TestDurationHours
+		updates["winner_metric"] = req.WinnerMetric
+	}
+
+	if err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&campaign).Updates(updates).Error; err != nil {
+			return err
+		}
+		if req.Variants == nil {
+			return nil
+		}
+		return replaceCampaignVariants(tx, campaign.ID, variants)
+	}); err != nil {
 		a.Log.Error("Failed to update campaign", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update campaign", nil, "")
 	}
 
 	// Reload campaign
-	a.DB.Where("id = ?", id).Preload("Template").First(&campaign)
+	a.DB.Where("id = ?", id).Preload("Template").Preload("Variants.Template").First(&campaign)
 
 	response := CampaignResponse{
 		ID:                  campaign.ID,
@@ -318,6 +416,11 @@ func (a *App) UpdateCampaign(r *fastglue.Request) error {
 		DeliveredCount:      campaign.DeliveredCount,
 		FailedCount:         campaign.FailedCount,
 		ScheduledAt:         campaign.ScheduledAt,
+		Variants:            campaignVariantResponses(sortedCampaignVariants(campaign.Variants)),
+		AutoPromote:         campaign.AutoPromote,
+		TestPercent:         campaign.TestPercent,
+		TestDurationHours:   campaign.TestDurationHours,
+		WinnerMetric:        campaign.WinnerMetric,
 		CreatedAt:           campaign.CreatedAt,
 		UpdatedAt:           campaign.UpdatedAt,
 	}
@@ -351,11 +454,15 @@ func (a *App) DeleteCampaign(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Cannot delete running campaign", nil, "")
 	}
 
-	// Delete recipients first
+	// Delete recipients and variants first
 	if err := a.DB.Where("campaign_id = ?", id).Delete(&models.BulkMessageRecipient{}).Error; err != nil {
 		a.Log.Error("Failed to delete campaign recipients", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete campaign", nil, "")
 	}
+	if err := a.DB.Where("campaign_id = ?", id).Delete(&models.CampaignVariant{}).Error; err != nil {
+		a.Log.Error("Failed to delete campaign variants", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete campaign", nil, "")
+	}
 
 	// Delete campaign
 	if err := a.DB.Delete(&campaign).Error; err != nil {
@@ -377,6 +484,10 @@ func (a *App) StartCampaign(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
 	}
 
+	if !a.HasFeature(orgID, models.PlanFeatureCampaigns) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureCampaigns), nil, "")
+	}
+
 	campaignID := r.RequestCtx.UserValue("id").(string)
 	id, err := uuid.Parse(campaignID)
 	if err != nil {
@@ -393,6 +504,18 @@ func (a *App) StartCampaign(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Campaign cannot be started in current state", nil, "")
 	}
 
+	// Refuse to send templates Meta has flagged as low quality or paused, including
+	// those of the campaign's variants
+	templateIDs := a.DB.Model(&models.CampaignVariant{}).Select("template_id").Where("campaign_id = ?", campaign.ID)
+	var templates []models.Template
+	if err := a.DB.Where("id = ? OR id IN (?)", campaign.TemplateID, templateIDs).Find(&templates).Error; err == nil {
+		for _, template := range templates {
+			if template.QualityScore == models.TemplateQualityRed || isTemplateStatusUnsafe(template.Status) {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Template quality is low or paused by Meta; campaign cannot be started", nil, "")
+			}
+		}
+	}
+
 	// Get all pending recipients
 	var recipients []models.BulkMessageRecipient
 	if err := a.DB.Where("campaign_id = ? AND status = ?", id, models.MessageStatusPending).Find(&recipients).Error; err != nil {
@@ -404,46 +527,165 @@ func (a *App) StartCampaign(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Campaign has no pending recipients", nil, "")
 	}
 
-	// Update status to processing
+	// Campaigns with a future send time wait for the campaign scheduler
+	if campaign.StartedAt == nil && campaign.ScheduledAt != nil && campaign.ScheduledAt.After(time.Now()) {
+		if err := a.DB.Model(&campaign).Updates(map[string]interface{}{
+			"status":        models.CampaignStatusScheduled,
+			"paused_reason": "",
+		}).Error; err != nil {
+			a.Log.Error("Failed to schedule campaign", "error", err)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to schedule campaign", nil, "")
+		}
+
+		a.Log.Info("Campaign scheduled", "campaign_id", id, "scheduled_at", campaign.ScheduledAt)
+
+		return r.SendEnvelope(map[string]interface{}{
+			"message": "Campaign scheduled",
+			"status":  models.CampaignStatusScheduled,
+		})
+	}
+
+	if err := a.launchCampaign(r.RequestCtx, &campaign, recipients); err != nil {
+		return sendCampaignLaunchError(r, err)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Campaign started",
+		"status":  models.CampaignStatusProcessing,
+	})
+}
+
+// sendCampaignLaunchError responds with the error a campaign failed to launch with
+func sendCampaignLaunchError(r *fastglue.Request, err error) error {
+	if errors.Is(err, errCampaignNotLaunchable) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Campaign cannot be started in current state", nil, "")
+	}
+	var quotaErr *QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, quotaErr.Error(), nil, "")
+	}
+	if errors.Is(err, errWalletDepleted) || errors.Is(err, errTrialExpired) {
+		return r.SendErrorEnvelope(fasthttp.StatusPaymentRequired, err.Error(), nil, "")
+	}
+	return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to queue recipients", nil, "")
+}
+
+// errCampaignNotLaunchable is returned when a campaign changed state before it could be launched
+var errCampaignNotLaunchable = errors.New("campaign is no longer in a launchable state")
+
+// launchCampaign marks the campaign as processing and enqueues its pending recipients.
+// The status change is conditional on the current status so concurrent starts launch once.
+// A/B tested campaigns send to the recipients their test plans for.
+func (a *App) launchCampaign(ctx context.Context, campaign *models.BulkMessageCampaign, recipients []models.BulkMessageRecipient) error {
 	now := time.Now()
+	recipients, testEndsAt, err := a.planCampaignVariants(campaign, recipients, now)
+	if err != nil {
+		a.log(ctx).Error("Failed to plan campaign variants", "error", err)
+		return err
+	}
+	if err := a.checkCampaignSendable(campaign.OrganizationID, len(recipients)); err != nil {
+		return err
+	}
+
 	updates := map[string]interface{}{
-		"status":     models.CampaignStatusProcessing,
-		"started_at": now,
+		"status":        models.CampaignStatusProcessing,
+		"started_at":    now,
+		"paused_reason": "",
+	}
+	if testEndsAt != nil {
+		updates["test_ends_at"] = *testEndsAt
+	}
+	result := a.DB.Model(&models.BulkMessageCampaign{}).
+		Where("id = ? AND status = ?", campaign.ID, campaign.Status).
+		Updates(updates)
+	if result.Error != nil {
+		a.log(ctx).Error("Failed to start campaign", "error", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errCampaignNotLaunchable
 	}
+	previousStatus := campaign.Status
+	campaign.Status = models.CampaignStatusProcessing
+	campaign.StartedAt = &now
 
-	if err := a.DB.Model(&campaign).Updates(updates).Error; err != nil {
-		a.Log.Error("Failed to start campaign", "error", err)
-		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to start campaign", nil, "")
+	if testEndsAt != nil {
+		campaign.TestEndsAt = testEndsAt
 	}
 
-	a.Log.Info("Campaign started", "campaign_id", id, "recipients", len(recipients))
+	a.log(ctx).Info("Campaign started", "campaign_id", campaign.ID, "recipients", len(recipients))
+
+	if err := a.saveRecipientVariants(recipients); err != nil {
+		a.log(ctx).Error("Failed to save recipient variants", "error", err)
+		a.DB.Model(campaign).Update("status", previousStatus)
+		return err
+	}
+	if err := a.enqueueCampaignRecipients(ctx, campaign, recipients); err != nil {
+		// Revert status on failure
+		a.DB.Model(campaign).Update("status", previousStatus)
+		return err
+	}
+	return nil
+}
+
+// checkCampaignSendable checks that the organization can send a campaign to n
+// recipients: its trial, plan quotas and wallet
+func (a *App) checkCampaignSendable(orgID uuid.UUID, n int) error {
+	if err := a.checkTrialActive(orgID); err != nil {
+		return err
+	}
+	if err := a.checkCampaignQuota(orgID, n); err != nil {
+		return err
+	}
+	return a.checkWalletBalance(orgID)
+}
+
+// recipientEnqueueChunk is how many recipient jobs are enqueued at once
+const recipientEnqueueChunk = 1000
+
+// enqueueCampaignRecipients enqueues recipients of a running campaign and records
+// them in the organization's usage
+func (a *App) enqueueCampaignRecipients(ctx context.Context, campaign *models.BulkMessageCampaign, recipients []models.BulkMessageRecipient) error {
+	if len(recipients) == 0 {
+		return nil
+	}
 
 	// Enqueue all recipients as individual jobs for parallel processing
 	jobs := make([]*queue.RecipientJob, len(recipients))
 	for i, recipient := range recipients {
 		jobs[i] = &queue.RecipientJob{
-			CampaignID:     id,
+			CampaignID:     campaign.ID,
 			RecipientID:    recipient.ID,
-			OrganizationID: orgID,
+			OrganizationID: campaign.OrganizationID,
 			PhoneNumber:    recipient.PhoneNumber,
 			RecipientName:  recipient.RecipientName,
 			TemplateParams: recipient.TemplateParams,
+			VariantID:      recipient.VariantID,
 		}
 	}
 
-	if err := a.Queue.EnqueueRecipients(r.RequestCtx, jobs); err != nil {
-		a.Log.Error("Failed to enqueue recipients", "error", err)
-		// Revert status on failure
-		a.DB.Model(&campaign).Update("status", models.CampaignStatusDraft)
-		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to queue recipients", nil, "")
+	// Large sends are enqueued in chunks so no single pipeline holds them all
+	for start := 0; start < len(jobs); start += recipientEnqueueChunk {
+		end := min(start+recipientEnqueueChunk, len(jobs))
+		if err := a.Queue.EnqueueRecipients(ctx, jobs[start:end]); err != nil {
+			a.log(ctx).Error("Failed to enqueue recipients", "error", err, "enqueued", start)
+			return err
+		}
 	}
 
-	a.Log.Info("Recipients enqueued for processing", "campaign_id", id, "count", len(jobs))
+	a.recordUsage(campaign.OrganizationID, models.UsageMetricCampaignRecipients, int64(len(jobs)))
 
-	return r.SendEnvelope(map[string]interface{}{
-		"message": "Campaign started",
-		"status":  models.CampaignStatusProcessing,
-	})
+	a.log(ctx).Info("Recipients enqueued for processing", "campaign_id", campaign.ID, "count", len(jobs))
+	return nil
+}
+
+// checkCampaignQuota checks that sending to n recipients stays within the plan's
+// campaign recipient and campaign message limits
+func (a *App) checkCampaignQuota(orgID uuid.UUID, n int) error {
+	if err := a.checkQuota(orgID, models.UsageMetricCampaignRecipients, int64(n)); err != nil {
+		return err
+	}
+	return a.checkCampaignMessageQuota(orgID, int64(n))
 }
 
 // PauseCampaign implements pausing a campaign
@@ -481,6 +723,134 @@ func (a *App) PauseCampaign(r *fastglue.Request) error {
 	})
 }
 
+// pauseCampaignsForTemplate pauses scheduled and running campaigns of the account that
+// use the given template. Called when Meta reports the template as low quality or paused.
+func (a *App) pauseCampaignsForTemplate(account models.WhatsAppAccount, templateName, templateLanguage, reason string) {
+	var templateIDs []uuid.UUID
+	if err := a.DB.Model(&models.Template{}).
+		Where("whats_app_account = ? AND name = ? AND language = ?", account.Name, templateName, templateLanguage).
+		Pluck("id", &templateIDs).Error; err != nil || len(templateIDs) == 0 {
+		return
+	}
+
+	activeStatuses := []models.CampaignStatus{
+		models.CampaignStatusScheduled,
+		models.CampaignStatusQueued,
+		models.CampaignStatusProcessing,
+	}
+
+	var campaigns []models.BulkMessageCampaign
+	if err := a.DB.Where("organization_id = ? AND template_id IN ? AND status IN ?", account.OrganizationID, templateIDs, activeStatuses).
+		Find(&campaigns).Error; err != nil {
+		a.Log.Error("Failed to find campaigns for template", "error", err, "template", templateName)
+		return
+	}
+
+	for _, campaign := range campaigns {
+		if err := a.DB.Model(&campaign).Updates(map[string]interface{}{
+			"status":        models.CampaignStatusPaused,
+			"paused_reason": reason,
+		}).Error; err != nil {
+			a.Log.Error("Failed to auto-pause campaign", "error", err, "campaign_id", campaign.ID)
+			continue
+		}
+
+		a.Log.Warn("Campaign paused automatically",
+			"campaign_id", campaign.ID,
+			"template", templateName,
+			"reason", reason,
+		)
+
+		a.DispatchWebhook(campaign.OrganizationID, models.WebhookEventCampaignPaused, CampaignEventData{
+			CampaignID:      campaign.ID.String(),
+			CampaignName:    campaign.Name,
+			Status:          models.CampaignStatusPaused,
+			Reason:          reason,
+			WhatsAppAccount: campaign.WhatsAppAccount,
+		})
+	}
+}
+
+// pauseRunningCampaigns pauses the organization's queued and running campaigns, e.g. when
+// message usage reaches the plan's campaign limit or the prepaid wallet runs out
+func (a *App) pauseRunningCampaigns(orgID uuid.UUID, reason string) {
+	var campaigns []models.BulkMessageCampaign
+	if err := a.DB.Where("organization_id = ? AND status IN ?", orgID,
+		[]models.CampaignStatus{models.CampaignStatusQueued, models.CampaignStatusProcessing}).
+		Find(&campaigns).Error; err != nil {
+		a.Log.Error("Failed to find campaigns to pause", "error", err, "org_id", orgID)
+		return
+	}
+
+	for i := range campaigns {
+		if err := a.autoPauseCampaign(&campaigns[i], reason); err != nil {
+			a.Log.Error("Failed to auto-pause campaign", "error", err, "campaign_id", campaigns[i].ID)
+		}
+	}
+}
+
+// autoPausableStatuses are the campaign statuses the system pauses from: campaigns
+// that are due to launch or sending
+var autoPausableStatuses = []models.CampaignStatus{
+	models.CampaignStatusScheduled,
+	models.CampaignStatusQueued,
+	models.CampaignStatusProcessing,
+}
+
+// autoPauseCampaign pauses a campaign on behalf of the system and emits campaign.paused.
+// Campaigns that were paused, cancelled or finished in the meantime are left as they are.
+func (a *App) autoPauseCampaign(campaign *models.BulkMessageCampaign, reason string) error {
+	result := a.DB.Model(campaign).
+		Where("status IN ?", autoPausableStatuses).
+		Updates(map[string]interface{}{
+			"status":        models.CampaignStatusPaused,
+			"paused_reason": reason,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	a.Log.Warn("Campaign paused automatically", "campaign_id", campaign.ID, "reason", reason)
+
+	a.DispatchWebhook(campaign.OrganizationID, models.WebhookEventCampaignPaused, CampaignEventData{
+		CampaignID:      campaign.ID.String(),
+		CampaignName:    campaign.Name,
+		Status:          models.CampaignStatusPaused,
+		Reason:          reason,
+		WhatsAppAccount: campaign.WhatsAppAccount,
+	})
+	return nil
+}
+
+// dispatchCampaignCompletedWebhook emits campaign.completed with the final counts of a
+// campaign, and sends the campaign finished notification
+func (a *App) dispatchCampaignCompletedWebhook(campaignID uuid.UUID) {
+	var campaign models.BulkMessageCampaign
+	if err := a.DB.Where("id = ?", campaignID).First(&campaign).Error; err != nil {
+		a.Log.Error("Failed to load completed campaign", "error", err, "campaign_id", campaignID)
+		return
+	}
+
+	a.DispatchWebhook(campaign.OrganizationID, models.WebhookEventCampaignDone, CampaignEventData{
+		CampaignID:      campaign.ID.String(),
+		CampaignName:    campaign.Name,
+		Status:          models.CampaignStatusCompleted,
+		SentCount:       campaign.SentCount,
+		DeliveredCount:  campaign.DeliveredCount,
+		ReadCount:       campaign.ReadCount,
+		FailedCount:     campaign.FailedCount,
+		WhatsAppAccount: campaign.WhatsAppAccount,
+	})
+
+	a.notify(campaign.OrganizationID, models.NotificationEventCampaignFinished,
+		fmt.Sprintf("Campaign %s finished", campaign.Name),
+		fmt.Sprintf("The campaign %s was sent from %s.\n\nSent: %d\nDelivered: %d\nRead: %d\nFailed: %d\n",
+			campaign.Name, campaign.WhatsAppAccount, campaign.SentCount, campaign.DeliveredCount, campaign.ReadCount, campaign.FailedCount))
+}
+
 // CancelCampaign implements cancelling a campaign
 func (a *App) CancelCampaign(r *fastglue.Request) error {
 	orgID, err := a.getOrgIDFromContext(r)
@@ -550,12 +920,21 @@ func (a *App) RetryFailed(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "No failed messages to retry", nil, "")
 	}
 
+	// Retries are new messages but not new recipients
+	if err := a.checkCampaignMessageQuota(orgID, int64(len(failedRecipients))); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, err.Error(), nil, "")
+	}
+	if err := a.checkWalletBalance(orgID); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusPaymentRequired, err.Error(), nil, "")
+	}
+
 	// Reset failed recipients to pending
 	if err := a.DB.Model(&models.BulkMessageRecipient{}).
 		Where("campaign_id = ? AND status = ?", id, models.MessageStatusFailed).
 		Updates(map[string]interface{}{
 			"status":        models.MessageStatusPending,
 			"error_message": "",
+			"error_code":    0,
 		}).Error; err != nil {
 		a.Log.Error("Failed to reset failed recipients", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to reset failed recipients", nil, "")
@@ -567,6 +946,7 @@ func (a *App) RetryFailed(r *fastglue.Request) error {
 		Updates(map[string]interface{}{
 			"status":        models.MessageStatusPending,
 			"error_message": "",
+			"error_code":    0,
 		}).Error; err != nil {
 		a.Log.Error("Failed to reset failed messages", "error", err)
 	}
@@ -592,6 +972,7 @@ func (a *App) RetryFailed(r *fastglue.Request) error {
 			PhoneNumber:    recipient.PhoneNumber,
 			RecipientName:  recipient.RecipientName,
 			TemplateParams: recipient.TemplateParams,
+			VariantID:      recipient.VariantID,
 		}
 	}
 
@@ -602,6 +983,13 @@ func (a *App) RetryFailed(r *fastglue.Request) error {
 
 	a.Log.Info("Failed recipients enqueued for retry", "campaign_id", id, "count", len(jobs))
 
+	recipientIDs := make([]uuid.UUID, len(failedRecipients))
+	for i, recipient := range failedRecipients {
+		recipientIDs[i] = recipient.ID
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	a.resolveCampaignDeadLetters(orgID, recipientIDs, userID)
+
 	return r.SendEnvelope(map[string]interface{}{
 		"message":     "Retrying failed messages",
 		"retry_count": len(failedRecipients),
@@ -632,27 +1020,54 @@ func (a *App) ImportRecipients(r *fastglue.Request) error {
 	}
 
 	var req struct {
-		Recipients []RecipientRequest `json:"recipients" validate:"required"`
+		Recipients []RecipientRequest `json:"recipients"`
+		SegmentID  string             `json:"segment_id"` // Adds the segment's contacts, except those who opted out
 	}
 	if err := r.Decode(&req, "json"); err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
 	}
+	if len(req.Recipients) == 0 && req.SegmentID == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "recipients or segment_id is required", nil, "")
+	}
 
-	// Create recipients
-	recipients := make([]models.BulkMessageRecipient, len(req.Recipients))
-	for i, rec := range req.Recipients {
-		recipients[i] = models.BulkMessageRecipient{
-			CampaignID:     id,
-			PhoneNumber:    rec.PhoneNumber,
-			RecipientName:  rec.RecipientName,
-			TemplateParams: models.JSONB(rec.TemplateParams),
-			Status:         models.MessageStatusPending,
+	recipients := a.campaignRecipients(orgID, id, req.Recipients)
+	if req.SegmentID != "" {
+		segment, err := a.findOrgSegment(orgID, req.SegmentID)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		contacts, err := a.segmentContacts(segment)
+		if err != nil {
+			a.Log.Error("Failed to load segment contacts", "error", err, "segment_id", segment.ID)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to add recipients", nil, "")
+		}
+		for _, contact := range contacts {
+			if contact.OptInStatus == models.ContactOptInStatusOptedOut {
+				continue
+			}
+			// Named template parameters are filled from the contact's custom attributes
+			params := models.JSONB{}
+			for k, v := range contact.Metadata {
+				params[k] = v
+			}
+			if _, ok := params["name"]; !ok {
+				params["name"] = contact.ProfileName
+			}
+			recipients = append(recipients, models.BulkMessageRecipient{
+				CampaignID:     id,
+				PhoneNumber:    contact.PhoneNumber,
+				RecipientName:  contact.ProfileName,
+				TemplateParams: params,
+				Status:         models.MessageStatusPending,
+			})
 		}
 	}
 
-	if err := a.DB.Create(&recipients).Error; err != nil {
-		a.Log.Error("Failed to add recipients", "error", err)
-		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to add recipients", nil, "")
+	if len(recipients) > 0 {
+		if err := a.DB.Create(&recipients).Error; err != nil {
+			a.Log.Error("Failed to add recipients", "error", err)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to add recipients", nil, "")
+		}
 	}
 
 	// Update total recipients count
@@ -660,16 +1075,69 @@ func (a *App) ImportRecipients(r *fastglue.Request) error {
 	a.DB.Model(&models.BulkMessageRecipient{}).Where("campaign_id = ?", id).Count(&totalCount)
 	a.DB.Model(&campaign).Update("total_recipients", totalCount)
 
-	a.Log.Info("Recipients added to campaign", "campaign_id", id, "count", len(req.Recipients))
+	a.Log.Info("Recipients added to campaign", "campaign_id", id, "count", len(recipients))
 
 	return r.SendEnvelope(map[string]interface{}{
 		"message":          "Recipients added successfully",
-		"added_count":      len(req.Recipients),
+		"added_count":      len(recipients),
 		"total_recipients": totalCount,
 	})
 }
 
-// GetCampaignRecipients implements listing campaign recipients
+// recipientLookupChunk is how many recipient phone numbers are looked up per query
+const recipientLookupChunk = 1000
+
+// campaignRecipients builds pending recipients of a campaign from requested ones.
+// Parameters with expressions, like {{first_name | "there"}}, are rendered for the
+// recipient's contact, or for the recipient's name when they aren't a contact yet.
+func (a *App) campaignRecipients(orgID, campaignID uuid.UUID, requested []RecipientRequest) []models.BulkMessageRecipient {
+	var phones []string
+	for _, rec := range requested {
+		if hasTemplateExpressions(rec.TemplateParams) {
+			phones = append(phones, rec.PhoneNumber)
+		}
+	}
+	knownContacts := make(map[string]*models.Contact, len(phones))
+	// Looked up in chunks, since large sends have more phones than a query takes parameters
+	for start := 0; start < len(phones); start += recipientLookupChunk {
+		end := min(start+recipientLookupChunk, len(phones))
+		var found []models.Contact
+		if err := a.DB.Where("organization_id = ? AND phone_number IN ?", orgID, phones[start:end]).Find(&found).Error; err != nil {
+			a.Log.Error("Failed to load recipient contacts", "error", err, "campaign_id", campaignID)
+		}
+		for i := range found {
+			knownContacts[found[i].PhoneNumber] = &found[i]
+		}
+	}
+
+	recipients := make([]models.BulkMessageRecipient, 0, len(requested))
+	for _, rec := range requested {
+		params := models.JSONB(rec.TemplateParams)
+		if hasTemplateExpressions(rec.TemplateParams) {
+			contact, ok := knownContacts[rec.PhoneNumber]
+			if !ok {
+				contact = &models.Contact{
+					OrganizationID: orgID,
+					PhoneNumber:    rec.PhoneNumber,
+					ProfileName:    rec.RecipientName,
+					Timezone:       models.TimezoneForPhoneNumber(rec.PhoneNumber),
+				}
+			}
+			params = a.personalizeRecipientParams(contact, rec.TemplateParams)
+		}
+		recipients = append(recipients, models.BulkMessageRecipient{
+			CampaignID:     campaignID,
+			PhoneNumber:    rec.PhoneNumber,
+			RecipientName:  rec.RecipientName,
+			TemplateParams: params,
+			Status:         models.MessageStatusPending,
+		})
+	}
+	return recipients
+}
+
+// GetCampaignRecipients implements listing campaign recipients, optionally only those
+// with a status
 func (a *App) GetCampaignRecipients(r *fastglue.Request) error {
 	orgID, err := a.getOrgIDFromContext(r)
 	if err != nil {
@@ -688,8 +1156,13 @@ func (a *App) GetCampaignRecipients(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Campaign not found", nil, "")
 	}
 
+	query := a.DB.Where("campaign_id = ?", id)
+	if status := string(r.RequestCtx.QueryArgs().Peek("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
 	var recipients []models.BulkMessageRecipient
-	if err := a.DB.Where("campaign_id = ?", id).Order("created_at ASC").Find(&recipients).Error; err != nil {
+	if err := query.Order("created_at ASC").Find(&recipients).Error; err != nil {
 		a.Log.Error("Failed to list recipients", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list recipients", nil, "")
 	}
@@ -816,6 +1289,11 @@ func (a *App) UploadCampaignMedia(r *fastglue.Request) error {
 		mimeType = "application/octet-stream"
 	}
 
+	// The file must be one WhatsApp accepts for the template's header
+	if err := whatsapp.ValidateMedia(strings.ToLower(campaign.Template.HeaderType), mimeType, int64(len(data))); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
 	// Upload to WhatsApp
 	waAccount := a.toWhatsAppAccount(&account)
 
@@ -827,7 +1305,7 @@ func (a *App) UploadCampaignMedia(r *fastglue.Request) error {
 	}
 
 	// Save file locally for preview
-	localPath, err := a.saveCampaignMedia(campaignID, data, mimeType)
+	localPath, err := a.saveCampaignMedia(orgID, campaignID, data, mimeType)
 	if err != nil {
 		a.Log.Error("Failed to save media locally", "error", err)
 		// Don't fail the request, just log the error - preview won't work
@@ -856,32 +1334,34 @@ func (a *App) UploadCampaignMedia(r *fastglue.Request) error {
 	})
 }
 
-// saveCampaignMedia saves uploaded media locally for preview
-func (a *App) saveCampaignMedia(campaignID string, data []byte, mimeType string) (string, error) {
+// saveCampaignMedia saves uploaded media to media storage for preview
+func (a *App) saveCampaignMedia(orgID uuid.UUID, campaignID string, data []byte, mimeType string) (string, error) {
 	// Determine file extension
 	ext := getExtensionFromMimeType(mimeType)
 	if ext == "" {
 		ext = ".bin"
 	}
 
-	// Create campaigns media directory
-	subdir := "campaigns"
-	if err := a.ensureMediaDir(subdir); err != nil {
-		return "", fmt.Errorf("failed to create media directory: %w", err)
-	}
-
 	// Generate filename using campaign ID
-	filename := campaignID + ext
-	filePath := filepath.Join(a.getMediaStoragePath(), subdir, filename)
+	relativePath := path.Join("campaigns", campaignID+ext)
+
+	// A new upload replaces the campaign's previous media
+	ctx := context.Background()
+	size := int64(len(data))
+	if previous, err := a.mediaStore().Size(ctx, relativePath); err == nil {
+		size -= previous
+	}
+	if err := a.checkQuota(orgID, models.UsageMetricStorage, size); err != nil {
+		return "", err
+	}
 
 	// Save file
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := a.mediaStore().Put(ctx, relativePath, data, mimeType); err != nil {
 		return "", fmt.Errorf("failed to save media file: %w", err)
 	}
+	a.recordUsage(orgID, models.UsageMetricStorage, size)
 
-	// Return relative path for storage
-	relativePath := filepath.Join(subdir, filename)
-	a.Log.Info("Campaign media saved locally", "path", relativePath, "size", len(data))
+	a.Log.Info("Campaign media saved", "path", relativePath, "size", len(data))
 
 	return relativePath, nil
 }
@@ -918,18 +1398,13 @@ func (a *App) ServeCampaignMedia(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid file path", nil, "")
 	}
 
-	// Build full path
-	fullPath := filepath.Join(a.getMediaStoragePath(), filePath)
-
-	// Check if file exists
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+	// Read file
+	data, err := a.mediaStore().Get(context.Background(), filePath)
+	if errors.Is(err, storage.ErrNotFound) {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "File not found", nil, "")
 	}
-
-	// Read file
-	data, err := os.ReadFile(fullPath)
 	if err != nil {
-		a.Log.Error("Failed to read media file", "path", fullPath, "error", err)
+		a.Log.Error("Failed to read media file", "path", filePath, "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to read file", nil, "")
 	}
 
@@ -987,22 +1462,47 @@ func (a *App) getUserIDFromContext(r *fastglue.Request) (uuid.UUID, error) {
 	return userID, nil
 }
 
-// incrementCampaignStat increments the appropriate campaign counter based on status
-func (a *App) incrementCampaignStat(campaignID string, status string) {
+// updateCampaignRecipientStatus copies a campaign message's status update to its recipient
+func (a *App) updateCampaignRecipientStatus(campaignID, whatsappMsgID string, status WebhookStatus) {
+	var recipient models.BulkMessageRecipient
+	if err := a.DB.Select("id", "status", "delivered_at").
+		Where("campaign_id = ? AND whats_app_message_id = ?", campaignID, whatsappMsgID).
+		First(&recipient).Error; err != nil {
+		return
+	}
+	if !isMessageStatusAdvance(recipient.Status, models.MessageStatus(status.Status)) {
+		return
+	}
+	if err := a.DB.Model(&recipient).Updates(messageStatusUpdates(status, recipient.DeliveredAt)).Error; err != nil {
+		a.Log.Error("Failed to update campaign recipient status", "error", err, "recipient_id", recipient.ID)
+	}
+}
+
+// updateCampaignStats updates a campaign's counters for a message moving from one
+// status to the next. Sends are counted when the message is sent; a message read
+// without a delivered status is counted as delivered too, and one that fails after
+// being sent is no longer counted as sent.
+func (a *App) updateCampaignStats(campaignID string, from, to models.MessageStatus) {
 	campaignUUID, err := uuid.Parse(campaignID)
 	if err != nil {
 		a.Log.Error("Invalid campaign ID for stats update", "campaign_id", campaignID)
 		return
 	}
 
-	var column string
-	switch models.MessageStatus(status) {
+	updates := map[string]interface{}{}
+	switch to {
 	case models.MessageStatusDelivered:
-		column = "delivered_count"
+		updates["delivered_count"] = gorm.Expr("delivered_count + 1")
 	case models.MessageStatusRead:
-		column = "read_count"
+		updates["read_count"] = gorm.Expr("read_count + 1")
+		if from != models.MessageStatusDelivered {
+			updates["delivered_count"] = gorm.Expr("delivered_count + 1")
+		}
 	case models.MessageStatusFailed:
-		column = "failed_count"
+		updates["failed_count"] = gorm.Expr("failed_count + 1")
+		if from == models.MessageStatusSent {
+			updates["sent_count"] = gorm.Expr("GREATEST(sent_count - 1, 0)")
+		}
 	default:
 		// sent is already counted during processCampaign
 		return
@@ -1010,8 +1510,8 @@ func (a *App) incrementCampaignStat(campaignID string, status string) {
 
 	if err := a.DB.Model(&models.BulkMessageCampaign{}).
 		Where("id = ?", campaignUUID).
-		Update(column, gorm.Expr(column+" + 1")).Error; err != nil {
-		a.Log.Error("Failed to increment campaign stat", "error", err, "campaign_id", campaignID, "column", column)
+		Updates(updates).Error; err != nil {
+		a.Log.Error("Failed to update campaign stats", "error", err, "campaign_id", campaignID, "status", to)
 		return
 	}
 
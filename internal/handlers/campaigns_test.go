@@ -3,6 +3,7 @@ package handlers_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
@@ -636,8 +637,172 @@ func TestApp_StartCampaign_CanResumePaused(t *testing.T) {
 	assert.Len(t, mockQueue.EnqueuedJobs, 1)
 }
 
+func TestApp_StartCampaign_ABTestHoldsBackAudience(t *testing.T) {
+	app, mockQueue := campaignTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("ab-test"), "password", nil, true)
+	account := createTestWhatsAppAccount(t, app, org.ID, "ab-test-account")
+	templateA := createTestTemplate(t, app, org.ID, account.Name)
+	templateB := createTestTemplate(t, app, org.ID, account.Name)
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"name":             "Spring sale",
+		"whatsapp_account": account.Name,
+		"variants": []map[string]interface{}{
+			{"template_id": templateA.ID.String(), "percent": 50},
+			{"template_id": templateB.ID.String(), "percent": 50},
+		},
+		"auto_promote":        true,
+		"test_percent":        20,
+		"test_duration_hours": 4,
+	})
+	setAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.CreateCampaign(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp struct {
+		Data handlers.CampaignResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &resp))
+	assert.Equal(t, templateA.ID, resp.Data.TemplateID)
+	require.Len(t, resp.Data.Variants, 2)
+	assert.Equal(t, "A", resp.Data.Variants[0].Name)
+	assert.Equal(t, models.CampaignWinnerMetricReadRate, resp.Data.WinnerMetric)
+
+	for i := 0; i < 10; i++ {
+		createTestRecipient(t, app, resp.Data.ID, fmt.Sprintf("+155500000%02d", i), models.MessageStatusPending)
+	}
+
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", resp.Data.ID.String())
+	require.NoError(t, app.StartCampaign(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	// Only the test group is sent, one recipient per variant
+	require.Len(t, mockQueue.EnqueuedJobs, 2)
+	variants := map[uuid.UUID]bool{}
+	for _, job := range mockQueue.EnqueuedJobs {
+		require.NotNil(t, job.VariantID)
+		variants[*job.VariantID] = true
+	}
+	assert.Len(t, variants, 2)
+
+	var campaign models.BulkMessageCampaign
+	require.NoError(t, app.DB.Where("id = ?", resp.Data.ID).First(&campaign).Error)
+	require.NotNil(t, campaign.TestEndsAt)
+	assert.WithinDuration(t, time.Now().Add(4*time.Hour), *campaign.TestEndsAt, time.Minute)
+
+	var heldBack int64
+	app.DB.Model(&models.BulkMessageRecipient{}).
+		Where("campaign_id = ? AND variant_id IS NULL", campaign.ID).Count(&heldBack)
+	assert.Equal(t, int64(8), heldBack)
+}
+
+func TestApp_CreateCampaign_InvalidVariants(t *testing.T) {
+	app, _ := campaignTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("ab-invalid"), "password", nil, true)
+	account := createTestWhatsAppAccount(t, app, org.ID, "ab-invalid-account")
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"name":             "Spring sale",
+		"whatsapp_account": account.Name,
+		"variants": []map[string]interface{}{
+			{"template_id": template.ID.String(), "percent": 60},
+			{"template_id": template.ID.String(), "percent": 60},
+		},
+	})
+	setAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.CreateCampaign(req))
+	assert.Equal(t, fasthttp.StatusBadRequest, testutil.GetResponseStatusCode(req))
+}
+
+func TestApp_StartCampaign_FutureScheduleWaitsForScheduler(t *testing.T) {
+	app, mockQueue := campaignTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("start-scheduled"), "password", nil, true)
+	account := createTestWhatsAppAccount(t, app, org.ID, "start-scheduled-account")
+	template := createTestTemplate(t, app, org.ID, account.Name)
+	campaign := createTestCampaign(t, app, org.ID, template.ID, user.ID, account.Name, models.CampaignStatusDraft)
+	createTestRecipient(t, app, campaign.ID, "+1234567890", models.MessageStatusPending)
+
+	scheduledAt := time.Now().Add(2 * time.Hour)
+	require.NoError(t, app.DB.Model(campaign).Update("scheduled_at", scheduledAt).Error)
+
+	req := testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", campaign.ID.String())
+
+	err := app.StartCampaign(req)
+	require.NoError(t, err)
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	assert.Empty(t, mockQueue.EnqueuedJobs)
+
+	var updated models.BulkMessageCampaign
+	app.DB.Where("id = ?", campaign.ID).First(&updated)
+	assert.Equal(t, models.CampaignStatusScheduled, updated.Status)
+	assert.Nil(t, updated.StartedAt)
+}
+
 // --- PauseCampaign Tests ---
 
+func TestApp_DryRunCampaign(t *testing.T) {
+	app, mockQueue := campaignTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("dry-run"), "password", nil, true)
+	account := createTestWhatsAppAccount(t, app, org.ID, "dry-run-account")
+	template := createTestTemplate(t, app, org.ID, account.Name)
+	campaign := createTestCampaign(t, app, org.ID, template.ID, user.ID, account.Name, models.CampaignStatusDraft)
+	require.NoError(t, app.DB.Model(org).Update("settings", models.JSONB{
+		"conversation_rates": map[string]interface{}{"marketing": 25}, "conversation_currency": "EUR",
+	}).Error)
+
+	valid := createTestRecipient(t, app, campaign.ID, "+1234567890", models.MessageStatusPending)
+	require.NoError(t, app.DB.Model(valid).Update("template_params", models.JSONB{"1": "John"}).Error)
+	missing := createTestRecipient(t, app, campaign.ID, "+1987654321", models.MessageStatusPending)
+	invalid := createTestRecipient(t, app, campaign.ID, "not a phone", models.MessageStatusPending)
+	require.NoError(t, app.DB.Model(invalid).Update("template_params", models.JSONB{"1": "Jane"}).Error)
+
+	req := testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", campaign.ID.String())
+
+	require.NoError(t, app.DryRunCampaign(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp struct {
+		Data handlers.CampaignDryRunResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &resp))
+	result := resp.Data
+	assert.Equal(t, 3, result.TotalRecipients)
+	assert.Equal(t, 1, result.ValidRecipients)
+	assert.Equal(t, 2, result.InvalidRecipients)
+	assert.Empty(t, result.Issues)
+
+	require.Len(t, result.Preview, 1)
+	assert.Equal(t, valid.ID, result.Preview[0].RecipientID)
+	assert.Equal(t, "Hello John", result.Preview[0].Body)
+
+	require.Len(t, result.Errors, 2)
+	assert.Equal(t, missing.ID, result.Errors[0].RecipientID)
+	assert.Equal(t, []string{"Missing template parameters: 1"}, result.Errors[0].Errors)
+	assert.Equal(t, invalid.ID, result.Errors[1].RecipientID)
+	assert.Equal(t, []string{"Invalid phone number"}, result.Errors[1].Errors)
+
+	assert.Equal(t, "marketing", result.EstimatedCost.Category)
+	assert.Equal(t, int64(25), result.EstimatedCost.Amount)
+	assert.Equal(t, "EUR", result.EstimatedCost.Currency)
+
+	// Nothing was sent or changed
+	assert.Empty(t, mockQueue.EnqueuedJobs)
+	var updated models.BulkMessageCampaign
+	app.DB.Where("id = ?", campaign.ID).First(&updated)
+	assert.Equal(t, models.CampaignStatusDraft, updated.Status)
+}
+
 func TestApp_PauseCampaign_Success(t *testing.T) {
 	app, _ := campaignTestApp(t)
 	org := createTestOrganization(t, app)
@@ -951,3 +1116,77 @@ func TestApp_Campaign_CrossOrgIsolation(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
 }
+
+// --- Bulk Send Tests ---
+
+func TestApp_CreateBulkSend_Success(t *testing.T) {
+	app, mockQueue := campaignTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("bulk-send"), "password", nil, true)
+	require.NoError(t, app.DB.Model(user).Update("is_super_admin", true).Error)
+	account := createTestWhatsAppAccount(t, app, org.ID, "bulk-send-account")
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	recipients := make([]map[string]interface{}, 0, 5)
+	for i := 0; i < 5; i++ {
+		recipients = append(recipients, map[string]interface{}{"phone_number": fmt.Sprintf("1555000000%d", i)})
+	}
+	recipients = append(recipients, map[string]interface{}{"phone_number": "15550000000"})
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"whatsapp_account": account.Name,
+		"template_id":      template.ID.String(),
+		"batch_size":       2,
+		"recipients":       recipients,
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateBulkSend(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp struct {
+		Data struct {
+			BulkSend          handlers.BulkSendStatus `json:"bulk_send"`
+			DuplicatesSkipped int                     `json:"duplicates_skipped"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &resp))
+	assert.Equal(t, 1, resp.Data.DuplicatesSkipped)
+	assert.Equal(t, models.CampaignStatusProcessing, resp.Data.BulkSend.Status)
+	assert.Equal(t, 5, resp.Data.BulkSend.TotalRecipients)
+	require.Len(t, resp.Data.BulkSend.Batches, 3)
+	assert.Equal(t, 1, resp.Data.BulkSend.Batches[2].Total)
+	assert.Len(t, mockQueue.EnqueuedJobs, 5)
+
+	// The status and cancel endpoints work on the send
+	req = testutil.NewGETRequest(t)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", resp.Data.BulkSend.ID.String())
+	require.NoError(t, app.GetBulkSend(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", resp.Data.BulkSend.ID.String())
+	require.NoError(t, app.CancelCampaign(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+}
+
+func TestApp_CreateBulkSend_NeedsExecutePermission(t *testing.T) {
+	app, mockQueue := campaignTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("bulk-send-denied"), "password", nil, true)
+	account := createTestWhatsAppAccount(t, app, org.ID, "bulk-send-denied-account")
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"whatsapp_account": account.Name,
+		"template_id":      template.ID.String(),
+		"recipients":       []map[string]interface{}{{"phone_number": "15550000000"}},
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateBulkSend(req))
+	assert.Equal(t, fasthttp.StatusForbidden, testutil.GetResponseStatusCode(req))
+	assert.Empty(t, mockQueue.EnqueuedJobs)
+}
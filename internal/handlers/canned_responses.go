@@ -1,6 +1,11 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/valyala/fasthttp"
@@ -19,15 +24,24 @@ type CannedResponseRequest struct {
 
 // CannedResponseResponse represents the API response for a canned response
 type CannedResponseResponse struct {
-	ID         uuid.UUID `json:"id"`
-	Name       string    `json:"name"`
-	Shortcut   string    `json:"shortcut"`
-	Content    string    `json:"content"`
-	Category   string    `json:"category"`
-	IsActive   bool      `json:"is_active"`
-	UsageCount int       `json:"usage_count"`
-	CreatedAt  string    `json:"created_at"`
-	UpdatedAt  string    `json:"updated_at"`
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Shortcut   string     `json:"shortcut"`
+	Content    string     `json:"content"`
+	Category   string     `json:"category"`
+	IsActive   bool       `json:"is_active"`
+	UsageCount int        `json:"usage_count"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	IsFavorite bool       `json:"is_favorite"` // Whether the requesting user pinned it
+	CreatedAt  string     `json:"created_at"`
+	UpdatedAt  string     `json:"updated_at"`
+}
+
+// UseCannedResponseRequest is the optional body of a canned response use. With a
+// contact, the returned content has its placeholders filled in for that contact.
+type UseCannedResponseRequest struct {
+	ContactID string            `json:"contact_id"`
+	Variables map[string]string `json:"variables"` // Values of other placeholders, like {{order_id}}
 }
 
 // ListCannedResponses returns all canned responses for the organization
@@ -37,10 +51,15 @@ func (a *App) ListCannedResponses(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
 	}
 
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
 	// Optional filters
 	category := string(r.RequestCtx.QueryArgs().Peek("category"))
 	search := string(r.RequestCtx.QueryArgs().Peek("search"))
 	activeOnly := string(r.RequestCtx.QueryArgs().Peek("active_only"))
+	favoritesOnly := string(r.RequestCtx.QueryArgs().Peek("favorites_only"))
+
+	favorites := a.favoriteCannedResponseIDs(userID)
 
 	query := a.DB.Where("organization_id = ?", orgID)
 
@@ -57,6 +76,13 @@ func (a *App) ListCannedResponses(r *fastglue.Request) error {
 		query = query.Where("name ILIKE ? OR content ILIKE ? OR shortcut ILIKE ?",
 			searchPattern, searchPattern, searchPattern)
 	}
+	if favoritesOnly == "true" {
+		ids := make([]uuid.UUID, 0, len(favorites))
+		for id := range favorites {
+			ids = append(ids, id)
+		}
+		query = query.Where("id IN ?", append(ids, uuid.Nil))
+	}
 
 	var responses []models.CannedResponse
 	if err := query.Order("usage_count DESC, name ASC").Find(&responses).Error; err != nil {
@@ -68,7 +94,12 @@ func (a *App) ListCannedResponses(r *fastglue.Request) error {
 	result := make([]CannedResponseResponse, len(responses))
 	for i, cr := range responses {
 		result[i] = cannedResponseToResponse(cr)
+		result[i].IsFavorite = favorites[cr.ID]
 	}
+	// The user's favorites come first, most used first like the rest
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].IsFavorite && !result[j].IsFavorite
+	})
 
 	return r.SendEnvelope(map[string]interface{}{
 		"canned_responses": result,
@@ -102,6 +133,12 @@ func (a *App) CreateCannedResponse(r *fastglue.Request) error {
 			"Canned response with this name already exists", nil, "")
 	}
 
+	// Shortcuts share the /xyz syntax with shortcodes
+	if req.Shortcut != "" && a.isShortcodeInUse(orgID, req.Shortcut) {
+		return r.SendErrorEnvelope(fasthttp.StatusConflict,
+			"Shortcut is already used as a shortcode", nil, "")
+	}
+
 	cannedResponse := models.CannedResponse{
 		OrganizationID: orgID,
 		Name:           req.Name,
@@ -141,7 +178,10 @@ func (a *App) GetCannedResponse(r *fastglue.Request) error {
 			"Canned response not found", nil, "")
 	}
 
-	return r.SendEnvelope(cannedResponseToResponse(cannedResponse))
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	result := cannedResponseToResponse(cannedResponse)
+	result.IsFavorite = a.favoriteCannedResponseIDs(userID)[cannedResponse.ID]
+	return r.SendEnvelope(result)
 }
 
 // UpdateCannedResponse updates an existing canned response
@@ -169,6 +209,11 @@ func (a *App) UpdateCannedResponse(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
 	}
 
+	if req.Shortcut != "" && req.Shortcut != cannedResponse.Shortcut && a.isShortcodeInUse(orgID, req.Shortcut) {
+		return r.SendErrorEnvelope(fasthttp.StatusConflict,
+			"Shortcut is already used as a shortcode", nil, "")
+	}
+
 	// Update fields
 	if req.Name != "" {
 		cannedResponse.Name = req.Name
@@ -218,27 +263,291 @@ func (a *App) DeleteCannedResponse(r *fastglue.Request) error {
 	return r.SendEnvelope(map[string]string{"message": "Canned response deleted"})
 }
 
-// IncrementCannedResponseUsage increments the usage counter
+// IncrementCannedResponseUsage records that the user used a canned response, e.g.
+// inserted it into a reply. With a contact_id, the content is returned with its
+// placeholders filled in for that contact.
 func (a *App) IncrementCannedResponseUsage(r *fastglue.Request) error {
 	orgID, err := getOrganizationID(r)
 	if err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
 	}
 
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
 	idStr, _ := r.RequestCtx.UserValue("id").(string)
 	id, err := uuid.Parse(idStr)
 	if err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
 	}
 
-	if err := a.DB.Model(&models.CannedResponse{}).
-		Where("id = ? AND organization_id = ?", id, orgID).
-		UpdateColumn("usage_count", gorm.Expr("usage_count + 1")).Error; err != nil {
+	// The body is optional
+	var req UseCannedResponseRequest
+	if body := r.RequestCtx.PostBody(); len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+		}
+	}
+
+	var cannedResponse models.CannedResponse
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).
+		First(&cannedResponse).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound,
+			"Canned response not found", nil, "")
+	}
+
+	var contact *models.Contact
+	if req.ContactID != "" {
+		contactID, err := uuid.Parse(req.ContactID)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact_id", nil, "")
+		}
+		if contact, err = a.findReplyContact(orgID, userID, contactID); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
+		}
+	}
+
+	if err := a.recordCannedResponseUse(&cannedResponse, userID, contact); err != nil {
+		a.Log.Error("Failed to record canned response use", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
 			"Failed to update usage", nil, "")
 	}
 
-	return r.SendEnvelope(map[string]string{"message": "Usage incremented"})
+	content := cannedResponse.Content
+	if contact != nil {
+		content = a.renderCannedResponse(content, contact, req.Variables)
+	}
+	return r.SendEnvelope(map[string]string{"message": "Usage incremented", "content": content})
+}
+
+// FavoriteCannedResponse pins a canned response to the top of the user's list
+func (a *App) FavoriteCannedResponse(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	idStr, _ := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
+	}
+
+	var cannedResponse models.CannedResponse
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).
+		First(&cannedResponse).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound,
+			"Canned response not found", nil, "")
+	}
+
+	favorite := models.CannedResponseFavorite{
+		OrganizationID:   orgID,
+		UserID:           userID,
+		CannedResponseID: cannedResponse.ID,
+	}
+	if err := a.DB.Where("user_id = ? AND canned_response_id = ?", userID, cannedResponse.ID).
+		FirstOrCreate(&favorite).Error; err != nil {
+		a.Log.Error("Failed to favorite canned response", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to favorite canned response", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]string{"message": "Canned response added to favorites"})
+}
+
+// UnfavoriteCannedResponse unpins a canned response from the user's list
+func (a *App) UnfavoriteCannedResponse(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	idStr, _ := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
+	}
+
+	if err := a.DB.Unscoped().
+		Where("organization_id = ? AND user_id = ? AND canned_response_id = ?", orgID, userID, id).
+		Delete(&models.CannedResponseFavorite{}).Error; err != nil {
+		a.Log.Error("Failed to unfavorite canned response", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to unfavorite canned response", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]string{"message": "Canned response removed from favorites"})
+}
+
+// CannedResponseUsageStat is how often a canned response was used in a period
+type CannedResponseUsageStat struct {
+	ID         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	Shortcut   string    `json:"shortcut"`
+	Uses       int64     `json:"uses"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// CannedResponseAgentStat is how many canned responses an agent used in a period
+type CannedResponseAgentStat struct {
+	UserID   uuid.UUID `json:"user_id"`
+	FullName string    `json:"full_name"`
+	Uses     int64     `json:"uses"`
+}
+
+// CannedResponseStatsResponse is the canned response usage in a period
+type CannedResponseStatsResponse struct {
+	TotalUses int64                     `json:"total_uses"`
+	Responses []CannedResponseUsageStat `json:"responses"`
+	Agents    []CannedResponseAgentStat `json:"agents"`
+}
+
+// GetCannedResponseStats returns how often each canned response was used, and by
+// which agents, between the optional from and to dates (YYYY-MM-DD, inclusive).
+// Users without analytics permission only see their own uses.
+func (a *App) GetCannedResponseStats(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	from, to, errMsg := parseExportDateRange(r.RequestCtx.QueryArgs(), time.UTC)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, errMsg, nil, "")
+	}
+
+	uses := func() *gorm.DB {
+		q := a.DB.Model(&models.CannedResponseUse{}).
+			Where("canned_response_uses.organization_id = ?", orgID)
+		if !a.HasPermission(userID, models.ResourceAnalytics, models.ActionRead) {
+			q = q.Where("canned_response_uses.user_id = ?", userID)
+		}
+		if from != nil {
+			q = q.Where("canned_response_uses.created_at >= ?", *from)
+		}
+		if to != nil {
+			q = q.Where("canned_response_uses.created_at < ?", to.AddDate(0, 0, 1))
+		}
+		return q
+	}
+
+	result := CannedResponseStatsResponse{
+		Responses: []CannedResponseUsageStat{},
+		Agents:    []CannedResponseAgentStat{},
+	}
+	if err := uses().
+		Select("canned_responses.id, canned_responses.name, canned_responses.shortcut, COUNT(*) AS uses, MAX(canned_response_uses.created_at) AS last_used_at").
+		Joins("JOIN canned_responses ON canned_responses.id = canned_response_uses.canned_response_id AND canned_responses.deleted_at IS NULL").
+		Group("canned_responses.id, canned_responses.name, canned_responses.shortcut").
+		Order("uses DESC, canned_responses.name ASC").
+		Scan(&result.Responses).Error; err != nil {
+		a.Log.Error("Failed to load canned response stats", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to load canned response stats", nil, "")
+	}
+	if err := uses().
+		Select("users.id AS user_id, users.full_name, COUNT(*) AS uses").
+		Joins("JOIN users ON users.id = canned_response_uses.user_id").
+		Group("users.id, users.full_name").
+		Order("uses DESC, users.full_name ASC").
+		Scan(&result.Agents).Error; err != nil {
+		a.Log.Error("Failed to load canned response stats", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to load canned response stats", nil, "")
+	}
+	for _, stat := range result.Responses {
+		result.TotalUses += stat.Uses
+	}
+
+	return r.SendEnvelope(result)
+}
+
+// favoriteCannedResponseIDs returns the canned responses a user pinned
+func (a *App) favoriteCannedResponseIDs(userID uuid.UUID) map[uuid.UUID]bool {
+	var ids []uuid.UUID
+	a.DB.Model(&models.CannedResponseFavorite{}).
+		Where("user_id = ?", userID).
+		Pluck("canned_response_id", &ids)
+
+	favorites := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		favorites[id] = true
+	}
+	return favorites
+}
+
+// recordCannedResponseUse counts a use of a canned response by a user, optionally
+// in a conversation with a contact
+func (a *App) recordCannedResponseUse(cr *models.CannedResponse, userID uuid.UUID, contact *models.Contact) error {
+	use := models.CannedResponseUse{
+		OrganizationID:   cr.OrganizationID,
+		CannedResponseID: cr.ID,
+		UserID:           userID,
+	}
+	if contact != nil {
+		use.ContactID = &contact.ID
+	}
+
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.CannedResponse{}).
+			Where("id = ?", cr.ID).
+			UpdateColumns(map[string]interface{}{
+				"usage_count":  gorm.Expr("usage_count + 1"),
+				"last_used_at": time.Now(),
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&use).Error
+	})
+}
+
+// cannedResponseVariables returns the values of the placeholders a canned response
+// can use in a conversation: {{contact_name}}, {{phone_number}}, {{order_id}} of the
+// contact's latest order, and the contact's custom fields. vars override them.
+func (a *App) cannedResponseVariables(contact *models.Contact, vars map[string]string) map[string]string {
+	values := make(map[string]string)
+	for key, value := range contact.Metadata {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case float64, bool:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+
+	values["contact_name"] = contact.ProfileName
+	if values["contact_name"] == "" {
+		values["contact_name"] = contact.PhoneNumber
+	}
+	values["phone_number"] = contact.PhoneNumber
+
+	var order models.Order
+	if err := a.DB.Where("organization_id = ? AND contact_id = ?", contact.OrganizationID, contact.ID).
+		Order("created_at DESC").First(&order).Error; err == nil {
+		values["order_id"] = order.ID.String()
+	}
+
+	for key, value := range vars {
+		values[key] = value
+	}
+	return values
+}
+
+// renderCannedResponse fills in the placeholders of canned response content for a
+// contact, with the same expressions as flow messages. Placeholders without a value
+// or fallback are left as they are.
+func (a *App) renderCannedResponse(content string, contact *models.Contact, vars map[string]string) string {
+	values := a.cannedResponseVariables(contact, vars)
+	data := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		data[k] = v
+	}
+	return processTemplateKeepMissing(content, a.personalizationData(contact, data))
 }
 
 func cannedResponseToResponse(cr models.CannedResponse) CannedResponseResponse {
@@ -250,6 +559,7 @@ func cannedResponseToResponse(cr models.CannedResponse) CannedResponseResponse {
 		Category:   cr.Category,
 		IsActive:   cr.IsActive,
 		UsageCount: cr.UsageCount,
+		LastUsedAt: cr.LastUsedAt,
 		CreatedAt:  cr.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		UpdatedAt:  cr.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 	}
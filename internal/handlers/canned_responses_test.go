@@ -0,0 +1,191 @@
+package handlers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+func createTestCannedResponse(t *testing.T, app *handlers.App, orgID uuid.UUID, name, content string) *models.CannedResponse {
+	t.Helper()
+
+	cannedResponse := &models.CannedResponse{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: orgID,
+		Name:           name,
+		Content:        content,
+		IsActive:       true,
+	}
+	require.NoError(t, app.DB.Create(cannedResponse).Error)
+	return cannedResponse
+}
+
+func TestApp_SendMessage_CannedResponse(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	require.NoError(t, app.DB.Model(contact).Update("last_inbound_at", time.Now().Add(-time.Hour)).Error)
+	canned := createTestCannedResponse(t, app, org.ID, "Shipped", "Hi {{contact_name}}, order {{order_id}} has shipped.")
+
+	send := func(body map[string]any) *fastglue.Request {
+		req := testutil.NewJSONRequest(t, body)
+		setAuthContext(req, org.ID, user.ID)
+		testutil.SetPathParam(req, "id", contact.ID.String())
+		require.NoError(t, app.SendMessage(req))
+		return req
+	}
+
+	// The contact has no orders, so order_id must be given
+	req := send(map[string]any{"canned_response_id": canned.ID.String()})
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "Missing canned response variables: order_id")
+	assert.Empty(t, mockServer.sentMessages)
+
+	req = send(map[string]any{
+		"canned_response_id": canned.ID.String(),
+		"variables":          map[string]string{"order_id": "A-1001"},
+	})
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	require.Len(t, mockServer.sentMessages, 1)
+	text, _ := mockServer.sentMessages[0]["text"].(map[string]interface{})
+	assert.Equal(t, "Hi Test Contact, order A-1001 has shipped.", text["body"])
+
+	var updated models.CannedResponse
+	require.NoError(t, app.DB.First(&updated, canned.ID).Error)
+	assert.Equal(t, 1, updated.UsageCount)
+	assert.NotNil(t, updated.LastUsedAt)
+
+	var use models.CannedResponseUse
+	require.NoError(t, app.DB.Where("canned_response_id = ?", canned.ID).First(&use).Error)
+	assert.Equal(t, user.ID, use.UserID)
+	require.NotNil(t, use.ContactID)
+	assert.Equal(t, contact.ID, *use.ContactID)
+
+	req = send(map[string]any{"type": "interactive", "canned_response_id": canned.ID.String()})
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "only be sent as text")
+}
+
+func TestApp_CannedResponseFavorites(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("canned-favorites"), "password", nil, true)
+	popular := createTestCannedResponse(t, app, org.ID, "Popular", "Hello!")
+	require.NoError(t, app.DB.Model(popular).Update("usage_count", 10).Error)
+	pinned := createTestCannedResponse(t, app, org.ID, "Pinned", "Goodbye!")
+
+	list := func(favoritesOnly bool) []handlers.CannedResponseResponse {
+		t.Helper()
+		req := testutil.NewGETRequest(t)
+		setAuthContext(req, org.ID, user.ID)
+		if favoritesOnly {
+			testutil.SetQueryParam(req, "favorites_only", "true")
+		}
+		require.NoError(t, app.ListCannedResponses(req))
+		var resp struct {
+			CannedResponses []handlers.CannedResponseResponse `json:"canned_responses"`
+		}
+		testutil.ParseEnvelopeResponse(t, req, &resp)
+		return resp.CannedResponses
+	}
+	favorite := func(unfavorite bool) {
+		t.Helper()
+		req := testutil.NewJSONRequest(t, nil)
+		setAuthContext(req, org.ID, user.ID)
+		testutil.SetPathParam(req, "id", pinned.ID.String())
+		if unfavorite {
+			require.NoError(t, app.UnfavoriteCannedResponse(req))
+		} else {
+			require.NoError(t, app.FavoriteCannedResponse(req))
+		}
+		require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	}
+
+	favorite(false)
+	favorite(false) // Favoriting twice is a no-op
+
+	responses := list(false)
+	require.Len(t, responses, 2)
+	assert.Equal(t, pinned.ID, responses[0].ID, "favorites come first")
+	assert.True(t, responses[0].IsFavorite)
+	assert.False(t, responses[1].IsFavorite)
+
+	responses = list(true)
+	require.Len(t, responses, 1)
+	assert.Equal(t, pinned.ID, responses[0].ID)
+
+	favorite(true)
+	assert.Empty(t, list(true))
+	assert.Equal(t, popular.ID, list(false)[0].ID)
+}
+
+func TestApp_GetCannedResponseStats(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("canned-stats"), "password", nil, true)
+	greeting := createTestCannedResponse(t, app, org.ID, "Greeting", "Hello {{contact_name}}!")
+	closing := createTestCannedResponse(t, app, org.ID, "Closing", "Bye!")
+
+	use := func(id uuid.UUID) {
+		t.Helper()
+		req := testutil.NewJSONRequest(t, nil)
+		setAuthContext(req, org.ID, user.ID)
+		testutil.SetPathParam(req, "id", id.String())
+		require.NoError(t, app.IncrementCannedResponseUsage(req))
+		require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	}
+	use(greeting.ID)
+	use(greeting.ID)
+	use(closing.ID)
+
+	req := testutil.NewGETRequest(t)
+	setAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.GetCannedResponseStats(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var stats handlers.CannedResponseStatsResponse
+	testutil.ParseEnvelopeResponse(t, req, &stats)
+	assert.EqualValues(t, 3, stats.TotalUses)
+	require.Len(t, stats.Responses, 2)
+	assert.Equal(t, greeting.ID, stats.Responses[0].ID)
+	assert.EqualValues(t, 2, stats.Responses[0].Uses)
+	require.Len(t, stats.Agents, 1)
+	assert.Equal(t, user.ID, stats.Agents[0].UserID)
+	assert.EqualValues(t, 3, stats.Agents[0].Uses)
+
+	req = testutil.NewGETRequest(t)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetQueryParam(req, "from", "not-a-date")
+	require.NoError(t, app.GetCannedResponseStats(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "Invalid 'from' date format")
+}
+
+func TestApp_IncrementCannedResponseUsage_RendersForContact(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("canned-render"), "password", nil, true)
+	account := createTestAccount(t, app, org.ID)
+	contact := createMsgTestContact(t, app, org.ID, account.Name)
+	require.NoError(t, app.DB.Model(contact).Update("assigned_user_id", user.ID).Error)
+	canned := createTestCannedResponse(t, app, org.ID, "Greeting", "Hello {{contact_name}} ({{phone_number}}), re {{ticket}}")
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"contact_id": contact.ID.String(),
+		"variables":  map[string]string{"ticket": "T-7"},
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", canned.ID.String())
+	require.NoError(t, app.IncrementCannedResponseUsage(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp map[string]string
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	assert.Equal(t, "Hello Test Contact (+1234567890), re T-7", resp["content"])
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/shridarpatil/whatomate/internal/models"
@@ -24,6 +25,8 @@ type CatalogResponse struct {
 	Name            string                   `json:"name"`
 	IsActive        bool                     `json:"is_active"`
 	ProductCount    int                      `json:"product_count"`
+	LastSyncedAt    *time.Time               `json:"last_synced_at,omitempty"`
+	SyncError       string                   `json:"sync_error,omitempty"`
 	Products        []CatalogProductResponse `json:"products,omitempty"`
 	CreatedAt       string                   `json:"created_at"`
 	UpdatedAt       string                   `json:"updated_at"`
@@ -51,6 +54,7 @@ type CatalogProductResponse struct {
 	URL           string    `json:"url"`
 	ImageURL      string    `json:"image_url"`
 	RetailerID    string    `json:"retailer_id"`
+	Availability  string    `json:"availability"`
 	IsActive      bool      `json:"is_active"`
 	CreatedAt     string    `json:"created_at"`
 	UpdatedAt     string    `json:"updated_at"`
@@ -561,6 +565,8 @@ func catalogToResponse(c models.Catalog, productCount int) CatalogResponse {
 		Name:            c.Name,
 		IsActive:        c.IsActive,
 		ProductCount:    productCount,
+		LastSyncedAt:    c.LastSyncedAt,
+		SyncError:       c.SyncError,
 		CreatedAt:       c.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		UpdatedAt:       c.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 	}
@@ -577,6 +583,7 @@ func productToResponse(p models.CatalogProduct) CatalogProductResponse {
 		URL:           p.URL,
 		ImageURL:      p.ImageURL,
 		RetailerID:    p.RetailerID,
+		Availability:  p.Availability,
 		IsActive:      p.IsActive,
 		CreatedAt:     p.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		UpdatedAt:     p.UpdatedAt.Format("2006-01-02T15:04:05Z"),
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// Product availability values reported by Meta that can't be ordered
+var unavailableProductStates = map[string]bool{
+	"out of stock": true,
+	"discontinued": true,
+}
+
+// errProductNotFound is returned when no active product has a SKU
+var errProductNotFound = errors.New("product not found")
+
+// parsePrice converts a formatted price, e.g. "$1,299.00" or "12,50 €",
+// to the smallest currency unit
+func parsePrice(price string) (int64, error) {
+	var b strings.Builder
+	for _, r := range price {
+		if (r >= '0' && r <= '9') || r == '.' || r == ',' {
+			b.WriteRune(r)
+		}
+	}
+	s := b.String()
+	if s == "" {
+		return 0, fmt.Errorf("invalid price %q", price)
+	}
+
+	// The last separator followed by one or two digits is the decimal separator,
+	// any other separator groups thousands
+	whole, fraction := s, ""
+	if i := strings.LastIndexAny(s, ".,"); i >= 0 && len(s)-i-1 <= 2 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	whole = strings.NewReplacer(".", "", ",", "").Replace(whole)
+	if whole == "" {
+		whole = "0"
+	}
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %q", price)
+	}
+	cents, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %q", price)
+	}
+	return units*100 + cents, nil
+}
+
+// syncCatalogProducts fetches a catalog's products from Meta and stores them. Products
+// no longer in the Meta catalog are deactivated, so they can't be sent by SKU.
+func (a *App) syncCatalogProducts(ctx context.Context, catalog *models.Catalog) (int, error) {
+	var account models.WhatsAppAccount
+	if err := a.DB.Where("organization_id = ? AND name = ?", catalog.OrganizationID, catalog.WhatsAppAccount).First(&account).Error; err != nil {
+		return 0, fmt.Errorf("whatsapp account %q not found", catalog.WhatsAppAccount)
+	}
+
+	metaProducts, err := a.WhatsApp.ListCatalogProducts(ctx, a.toWhatsAppAccount(&account), catalog.MetaCatalogID)
+	if err != nil {
+		a.DB.Model(catalog).Update("sync_error", err.Error())
+		return 0, err
+	}
+
+	seen := make([]string, 0, len(metaProducts))
+	for _, mp := range metaProducts {
+		if err := a.upsertCatalogProduct(catalog, mp); err != nil {
+			a.log(ctx).Error("Failed to sync catalog product", "error", err, "catalog", catalog.Name, "meta_id", mp.ID)
+			continue
+		}
+		seen = append(seen, mp.ID)
+	}
+
+	stale := a.DB.Model(&models.CatalogProduct{}).Where("catalog_id = ? AND is_active = ?", catalog.ID, true)
+	if len(seen) > 0 {
+		stale = stale.Where("meta_product_id NOT IN ?", seen)
+	}
+	if err := stale.Update("is_active", false).Error; err != nil {
+		a.log(ctx).Error("Failed to deactivate removed products", "error", err, "catalog", catalog.Name)
+	}
+
+	now := time.Now()
+	a.DB.Model(catalog).Updates(map[string]any{"last_synced_at": now, "sync_error": ""})
+	catalog.LastSyncedAt = &now
+	catalog.SyncError = ""
+
+	return len(seen), nil
+}
+
+// upsertCatalogProduct stores a product fetched from Meta
+func (a *App) upsertCatalogProduct(catalog *models.Catalog, mp whatsapp.ProductInfo) error {
+	price, err := parsePrice(mp.Price)
+	if err != nil {
+		return err
+	}
+	currency := mp.Currency
+	if currency == "" {
+		currency = "USD"
+	}
+
+	var product models.CatalogProduct
+	err = a.DB.Where("organization_id = ? AND meta_product_id = ?", catalog.OrganizationID, mp.ID).First(&product).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return a.DB.Create(&models.CatalogProduct{
+			OrganizationID: catalog.OrganizationID,
+			CatalogID:      catalog.ID,
+			MetaProductID:  mp.ID,
+			Name:           mp.Name,
+			Description:    mp.Description,
+			Price:          price,
+			Currency:       currency,
+			URL:            mp.URL,
+			ImageURL:       mp.ImageURL,
+			RetailerID:     mp.RetailerID,
+			Availability:   mp.Availability,
+			IsActive:       true,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	return a.DB.Model(&product).Updates(map[string]any{
+		"catalog_id":   catalog.ID,
+		"name":         mp.Name,
+		"description":  mp.Description,
+		"price":        price,
+		"currency":     currency,
+		"url":          mp.URL,
+		"image_url":    mp.ImageURL,
+		"retailer_id":  mp.RetailerID,
+		"availability": mp.Availability,
+		"is_active":    true,
+	}).Error
+}
+
+// findProductBySKU returns the active product with a SKU (retailer ID), with its catalog.
+// When account is set, only catalogs of that number are searched, since a product
+// message can only be sent from a number connected to the product's catalog.
+func (a *App) findProductBySKU(orgID uuid.UUID, account, sku string) (*models.CatalogProduct, error) {
+	if strings.TrimSpace(sku) == "" {
+		return nil, errors.New("product SKU is required")
+	}
+
+	query := a.DB.Joins("Catalog").
+		Where("catalog_products.organization_id = ? AND catalog_products.retailer_id = ? AND catalog_products.is_active = ?", orgID, sku, true)
+	if account != "" {
+		query = query.Where(`"Catalog"."whats_app_account" = ?`, account)
+	}
+
+	var product models.CatalogProduct
+	if err := query.First(&product).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: no active product with SKU %q", errProductNotFound, sku)
+		}
+		return nil, err
+	}
+	return &product, nil
+}
+
+// productAvailable reports whether a product can be ordered
+func productAvailable(p *models.CatalogProduct) bool {
+	return !unavailableProductStates[strings.ToLower(p.Availability)]
+}
+
+// validateFlowSteps checks that the products referenced by product and product
+// list steps exist, that condition and jump steps lead somewhere, and that list,
+// product list, media, location, contacts and reaction steps are messages WhatsApp accepts
+func (a *App) validateFlowSteps(orgID uuid.UUID, steps []FlowStepRequest) error {
+	stepNames := make(map[string]bool, len(steps))
+	for _, step := range steps {
+		stepNames[step.StepName] = true
+	}
+
+	for _, step := range steps {
+		var err error
+		switch step.MessageType {
+		case models.FlowStepTypeProduct:
+			sku, _ := step.InputConfig["product_sku"].(string)
+			_, err = a.findProductBySKU(orgID, "", sku)
+		case models.FlowStepTypeProductList:
+			var list *whatsapp.ProductListMessage
+			list, _, err = a.productListMessage(orgID, "", getStringFromMap(step.InputConfig, "header"), step.Message,
+				getStringFromMap(step.InputConfig, "footer"), productSectionsFromConfig(step.InputConfig), false)
+			if err == nil {
+				err = list.Validate()
+			}
+		case models.FlowStepTypeCondition:
+			err = validateConditionStep(step, stepNames)
+		case models.FlowStepTypeJump:
+			err = a.validateJumpStep(orgID, step)
+		case models.FlowStepTypeList:
+			err = listMessageFromConfig(step.Message, step.InputConfig).Validate()
+		case models.FlowStepTypeMedia:
+			err = mediaMessageFromConfig(step.Message, step.InputConfig).Validate()
+		case models.FlowStepTypeLocation:
+			_, err = locationFromConfig(step.InputConfig)
+		case models.FlowStepTypeContacts:
+			_, err = contactCardsFromConfig(step.InputConfig)
+		case models.FlowStepTypeReaction:
+			_, err = reactionEmojiFromConfig(step.InputConfig)
+		}
+		if err != nil {
+			return fmt.Errorf("step %q: %w", step.StepName, err)
+		}
+	}
+	return nil
+}
+
+// SyncCatalogProducts syncs a catalog's products from Meta
+func (a *App) SyncCatalogProducts(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	idStr, _ := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
+	}
+
+	var catalog models.Catalog
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&catalog).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Catalog not found", nil, "")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	synced, err := a.syncCatalogProducts(ctx, &catalog)
+	if err != nil {
+		a.Log.Error("Failed to sync catalog products", "error", err, "catalog", catalog.Name)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to sync products: "+err.Error(), nil, "")
+	}
+
+	var productCount int64
+	a.DB.Model(&models.CatalogProduct{}).Where("catalog_id = ?", catalog.ID).Count(&productCount)
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Products synced",
+		"synced":  synced,
+		"catalog": catalogToResponse(catalog, int(productCount)),
+	})
+}
+
+// CatalogSyncProcessor periodically syncs the products of all active catalogs
+type CatalogSyncProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewCatalogSyncProcessor creates a new catalog sync processor
+func NewCatalogSyncProcessor(app *App, interval time.Duration) *CatalogSyncProcessor {
+	return &CatalogSyncProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the catalog sync loop
+func (p *CatalogSyncProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Catalog sync processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Catalog sync processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Catalog sync processor stopped")
+			return
+		case <-ticker.C:
+			p.syncCatalogs()
+		}
+	}
+}
+
+// Stop stops the catalog sync processor
+func (p *CatalogSyncProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// syncCatalogs syncs the products of every active catalog
+func (p *CatalogSyncProcessor) syncCatalogs() {
+	var catalogs []models.Catalog
+	if err := p.app.DB.Where("is_active = ?", true).Find(&catalogs).Error; err != nil {
+		p.app.Log.Error("Failed to load catalogs", "error", err)
+		return
+	}
+
+	for i := range catalogs {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		if _, err := p.app.syncCatalogProducts(ctx, &catalogs[i]); err != nil {
+			p.app.Log.Warn("Failed to sync catalog products", "catalog", catalogs[i].Name, "error", err)
+		}
+		cancel()
+	}
+}
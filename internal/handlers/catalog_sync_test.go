@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		price string
+		want  int64
+	}{
+		{"$10.00", 1000},
+		{"$1,299.99", 129999},
+		{"12,50 €", 1250},
+		{"1.299,00 €", 129900},
+		{"₹1,299", 129900},
+		{"9.5", 950},
+		{"USD 7", 700},
+	}
+	for _, tt := range tests {
+		got, err := parsePrice(tt.price)
+		require.NoError(t, err, tt.price)
+		assert.Equal(t, tt.want, got, tt.price)
+	}
+
+	_, err := parsePrice("free")
+	assert.Error(t, err)
+}
+
+func TestProductAvailable(t *testing.T) {
+	assert.True(t, productAvailable(&models.CatalogProduct{Availability: "in stock"}))
+	assert.True(t, productAvailable(&models.CatalogProduct{}))
+	assert.False(t, productAvailable(&models.CatalogProduct{Availability: "Out of Stock"}))
+	assert.False(t, productAvailable(&models.CatalogProduct{Availability: "discontinued"}))
+}
+
+func TestSyncCatalogProducts(t *testing.T) {
+	products := `{"data":[
+		{"id":"meta-p1","name":"Sourdough","price":"$6.50","currency":"USD","retailer_id":"BREAD-1","availability":"in stock"},
+		{"id":"meta-p2","name":"Baguette","price":"$3.00","currency":"USD","retailer_id":"BREAD-2","availability":"out of stock"}
+	]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(products))
+	}))
+	defer server.Close()
+
+	app := &App{
+		Config:   &config.Config{},
+		DB:       testutil.SetupTestDB(t),
+		Log:      testutil.NopLogger(),
+		WhatsApp: whatsapp.NewWithBaseURL(testutil.NopLogger(), server.URL),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Catalog Org " + suffix,
+		Slug:      "catalog-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{
+		OrganizationID: org.ID,
+		Name:           "shop",
+		PhoneID:        "catalog-phone-" + suffix,
+		BusinessID:     "business",
+		AccessToken:    "token",
+		APIVersion:     "v21.0",
+	}
+	require.NoError(t, app.DB.Create(account).Error)
+	catalog := &models.Catalog{
+		OrganizationID:  org.ID,
+		WhatsAppAccount: "shop",
+		MetaCatalogID:   "meta-catalog-" + suffix,
+		Name:            "Bakery",
+		IsActive:        true,
+	}
+	require.NoError(t, app.DB.Create(catalog).Error)
+
+	synced, err := app.syncCatalogProducts(testutil.TestContext(t), catalog)
+	require.NoError(t, err)
+	assert.Equal(t, 2, synced)
+	assert.NotNil(t, catalog.LastSyncedAt)
+
+	product, err := app.findProductBySKU(org.ID, "shop", "BREAD-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(650), product.Price)
+	require.NotNil(t, product.Catalog)
+	assert.Equal(t, catalog.MetaCatalogID, product.Catalog.MetaCatalogID)
+
+	product, err = app.findProductBySKU(org.ID, "shop", "BREAD-2")
+	require.NoError(t, err)
+	assert.False(t, productAvailable(product))
+
+	// Products are only sent from the number their catalog belongs to
+	_, err = app.findProductBySKU(org.ID, "other", "BREAD-1")
+	assert.True(t, errors.Is(err, errProductNotFound))
+
+	// Products removed from the Meta catalog are deactivated
+	products = `{"data":[
+		{"id":"meta-p1","name":"Sourdough","price":"$7.00","currency":"USD","retailer_id":"BREAD-1","availability":"in stock"}
+	]}`
+	synced, err = app.syncCatalogProducts(testutil.TestContext(t), catalog)
+	require.NoError(t, err)
+	assert.Equal(t, 1, synced)
+
+	product, err = app.findProductBySKU(org.ID, "", "BREAD-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(700), product.Price)
+	_, err = app.findProductBySKU(org.ID, "", "BREAD-2")
+	assert.True(t, errors.Is(err, errProductNotFound))
+
+	err = app.validateFlowSteps(org.ID, []FlowStepRequest{
+		{StepName: "offer", MessageType: models.FlowStepTypeProduct, InputConfig: map[string]interface{}{"product_sku": "BREAD-2"}},
+	})
+	assert.Error(t, err)
+	assert.NoError(t, app.validateFlowSteps(org.ID, []FlowStepRequest{
+		{StepName: "offer", MessageType: models.FlowStepTypeProduct, InputConfig: map[string]interface{}{"product_sku": "BREAD-1"}},
+	}))
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import "github.com/shridarpatil/whatomate/internal/models"
+
+// sendChannel returns the channel messages of the account are sent through. Chatbot
+// simulations record the replies of every channel like those of WhatsApp numbers.
+func (a *App) sendChannel(account *models.WhatsAppAccount) models.Channel {
+	if a.simulation != nil {
+		return models.ChannelWhatsApp
+	}
+	return account.AccountChannel()
+}
+
+// contactPhoneForMessage returns the phone number of the contact a stored message
+// belongs to, or "" if the message isn't found
+func (a *App) contactPhoneForMessage(messageID string) string {
+	var contact models.Contact
+	if err := a.DB.Select("contacts.phone_number").
+		Joins("JOIN messages ON messages.contact_id = contacts.id").
+		Where("messages.whats_app_message_id = ?", messageID).
+		First(&contact).Error; err != nil {
+		return ""
+	}
+	return contact.PhoneNumber
+}
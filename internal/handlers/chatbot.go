@@ -2,6 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,18 +24,88 @@ type ChatbotSettingsResponse struct {
 	FallbackMessage       string                   `json:"fallback_message"`
 	FallbackButtons       []map[string]interface{} `json:"fallback_buttons"`
 	SessionTimeoutMinutes int                      `json:"session_timeout_minutes"`
+	SessionClosedMessage  string                   `json:"session_closed_message"`
 	BusinessHoursEnabled       bool                     `json:"business_hours_enabled"`
 	BusinessHours              []map[string]interface{} `json:"business_hours"`
 	OutOfHoursMessage          string                   `json:"out_of_hours_message"`
 	AllowAutomatedOutsideHours bool                     `json:"allow_automated_outside_hours"`
+	BusinessHoursTimezone      string                   `json:"business_hours_timezone"`
+	OutOfHoursFlowID           string                   `json:"out_of_hours_flow_id"`
+	QueueOutsideHours          bool                     `json:"queue_outside_hours"`
+	AdsFlowID                  string                   `json:"ads_flow_id"`
+	WhatsAppAccount            string                   `json:"whatsapp_account"`
 	AllowAgentQueuePickup        bool                     `json:"allow_agent_queue_pickup"`
 	AssignToSameAgent            bool                     `json:"assign_to_same_agent"`
 	AgentCurrentConversationOnly bool                     `json:"agent_current_conversation_only"`
+	HandoffOnAIIntent            bool                     `json:"handoff_on_ai_intent"`
+	HandoffAfterFallbacks        int                      `json:"handoff_after_fallbacks"`
+	HandoffTeamID                string                   `json:"handoff_team_id"`
 	AIEnabled                    bool                     `json:"ai_enabled"`
 	AIProvider            models.AIProvider        `json:"ai_provider"`
 	AIModel               string                   `json:"ai_model"`
 	AIMaxTokens           int                      `json:"ai_max_tokens"`
+	AITemperature         float64                  `json:"ai_temperature"`
+	AIBaseURL             string                   `json:"ai_base_url"`
+	AIWebhookHeaders      models.JSONB             `json:"ai_webhook_headers"`
+	AIWebhookBody         string                   `json:"ai_webhook_body"`
+	AIWebhookResponsePath string                   `json:"ai_webhook_response_path"`
+	AIFallbackProviders   []AIFallbackProvider     `json:"ai_fallback_providers"`
+	AIExperiments         []AIExperiment           `json:"ai_experiments"`
 	AISystemPrompt        string                   `json:"ai_system_prompt"`
+	AIPersonas            []AIPersona              `json:"ai_personas"`
+	AIPersonaID           string                   `json:"ai_persona_id"`
+	AIIncludeHistory      bool                     `json:"ai_include_history"`
+	AIHistoryLimit        int                      `json:"ai_history_limit"`
+	AIHistoryTTLMinutes   int                      `json:"ai_history_ttl_minutes"`
+	AISummarizeHistory    bool                     `json:"ai_summarize_history"`
+	AIHistoryTokenBudget  int                      `json:"ai_history_token_budget"`
+	AICacheTTLMinutes     int                      `json:"ai_cache_ttl_minutes"`
+	AIQuickReplies        []AIQuickReply           `json:"ai_quick_replies"`
+	AIMonthlyTokenLimit   int64                    `json:"ai_monthly_token_limit"`
+	AIQuotaMessage        string                   `json:"ai_quota_message"`
+	AITools               []AITool                 `json:"ai_tools"`
+	AIPaymentLinks        bool                     `json:"ai_payment_links"`
+	AIOrderLookup         bool                     `json:"ai_order_lookup"`
+	AIStreaming           bool                     `json:"ai_streaming"`
+	AIStreamSplit         models.AIStreamSplit     `json:"ai_stream_split"`
+	AIStreamIntervalMs    int                      `json:"ai_stream_interval_ms"`
+	AIEmbeddingProvider   models.AIProvider        `json:"ai_embedding_provider"`
+	AIEmbeddingModel      string                   `json:"ai_embedding_model"`
+	AIEmbeddingBaseURL    string                   `json:"ai_embedding_base_url"`
+	AIKnowledgeTopK       int                      `json:"ai_knowledge_top_k"`
+	AIModerationEnabled   bool                     `json:"ai_moderation_enabled"`
+	AIModerationBlocklist []string                 `json:"ai_moderation_blocklist"`
+	AIModerationProvider  models.AIProvider        `json:"ai_moderation_provider"`
+	AIModerationMessage   string                   `json:"ai_moderation_message"`
+	// Sentiment Settings
+	SentimentEnabled   bool                     `json:"sentiment_enabled"`
+	SentimentProvider  models.SentimentProvider `json:"sentiment_provider"`
+	SentimentThreshold float64                  `json:"sentiment_threshold"`
+	SentimentWindow    int                      `json:"sentiment_window"`
+	SentimentAction    models.SentimentAction   `json:"sentiment_action"`
+	// Transcription Settings
+	TranscriptionEnabled  bool                         `json:"transcription_enabled"`
+	TranscriptionProvider models.TranscriptionProvider `json:"transcription_provider"`
+	TranscriptionURL      string                       `json:"transcription_url"`
+	TranscriptionModel    string                       `json:"transcription_model"`
+	// Satisfaction Survey Settings
+	CSATEnabled     bool   `json:"csat_enabled"`
+	CSATBotSessions bool   `json:"csat_bot_sessions"`
+	CSATQuestion    string `json:"csat_question"`
+	CSATFollowUp    string `json:"csat_follow_up"`
+	CSATThankYou    string `json:"csat_thank_you"`
+	// Abuse Detection Settings
+	AbuseEnabled      bool               `json:"abuse_enabled"`
+	AbuseMaxMessages  int                `json:"abuse_max_messages"`
+	AbuseWindowSecs   int                `json:"abuse_window_secs"`
+	AbuseBlocklist    []string           `json:"abuse_blocklist"`
+	AbuseAction       models.AbuseAction `json:"abuse_action"`
+	AbuseCooldownMins int                `json:"abuse_cooldown_mins"`
+	// Language Settings
+	LanguageDetectionEnabled bool                         `json:"language_detection_enabled"`
+	DefaultLanguage          string                       `json:"default_language"`
+	SupportedLanguages       []string                     `json:"supported_languages"`
+	MessageTranslations      map[string]map[string]string `json:"message_translations"`
 	// SLA Settings
 	SLAEnabled             bool     `json:"sla_enabled"`
 	SLAResponseMinutes     int      `json:"sla_response_minutes"`
@@ -79,6 +154,8 @@ type ChatbotFlowResponse struct {
 	Name            string   `json:"name"`
 	Description     string   `json:"description"`
 	TriggerKeywords []string `json:"trigger_keywords"`
+	Language        string   `json:"language"`
+	WhatsAppAccount string   `json:"whatsapp_account"`
 	Enabled         bool     `json:"enabled"`
 	StepsCount      int      `json:"steps_count"`
 	CreatedAt       string   `json:"created_at"`
@@ -103,9 +180,14 @@ func (a *App) GetChatbotSettings(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
 	}
 
+	// Optional per-number settings, falling back to the organization defaults
+	accountName := string(r.RequestCtx.QueryArgs().Peek("whatsapp_account"))
+
 	// Get or create default settings
 	var settings models.ChatbotSettings
-	result := a.DB.Where("organization_id = ? AND whats_app_account = ?", orgID, "").First(&settings)
+	result := a.DB.Where("organization_id = ? AND (whats_app_account = ? OR whats_app_account = '')", orgID, accountName).
+		Order("CASE WHEN whats_app_account = '' THEN 1 ELSE 0 END").
+		First(&settings)
 	if result.Error != nil {
 		// Return default settings if none exist
 		settings = models.ChatbotSettings{
@@ -113,6 +195,13 @@ func (a *App) GetChatbotSettings(r *fastglue.Request) error {
 			DefaultResponse:    "Hello! How can I help you today?",
 			SessionTimeoutMins: 30,
 			AI:                 models.AIConfig{Enabled: false},
+			Sentiment: models.SentimentConfig{
+				Provider:  models.SentimentProviderLexicon,
+				Threshold: -0.4,
+				Window:    3,
+				Action:    models.SentimentActionNotify,
+			},
+			Transcription: models.TranscriptionConfig{Provider: models.TranscriptionProviderOpenAI},
 		}
 	}
 
@@ -155,21 +244,88 @@ func (a *App) GetChatbotSettings(r *fastglue.Request) error {
 		FallbackMessage:       settings.FallbackMessage,
 		FallbackButtons:       fallbackButtons,
 		SessionTimeoutMinutes: settings.SessionTimeoutMins,
+		SessionClosedMessage:  settings.SessionClosedMessage,
 		// Business Hours
 		BusinessHoursEnabled:       settings.BusinessHours.Enabled,
 		BusinessHours:              businessHours,
 		OutOfHoursMessage:          settings.BusinessHours.OutOfHoursMessage,
 		AllowAutomatedOutsideHours: settings.BusinessHours.AllowAutomatedOutside,
+		BusinessHoursTimezone:      settings.BusinessHours.Timezone,
+		QueueOutsideHours:          settings.BusinessHours.QueueOutsideHours,
+		WhatsAppAccount:            settings.WhatsAppAccount,
 		// Agent Assignment
 		AllowAgentQueuePickup:        settings.AgentAssignment.AllowQueuePickup,
 		AssignToSameAgent:            settings.AgentAssignment.AssignToSameAgent,
 		AgentCurrentConversationOnly: settings.AgentAssignment.CurrentConversationOnly,
+		HandoffOnAIIntent:            settings.AgentAssignment.HandoffOnAIIntent,
+		HandoffAfterFallbacks:        settings.AgentAssignment.HandoffAfterFallbacks,
 		// AI
-		AIEnabled:      settings.AI.Enabled,
-		AIProvider:     settings.AI.Provider,
-		AIModel:        settings.AI.Model,
-		AIMaxTokens:    settings.AI.MaxTokens,
-		AISystemPrompt: settings.AI.SystemPrompt,
+		AIEnabled:             settings.AI.Enabled,
+		AIProvider:            settings.AI.Provider,
+		AIModel:               settings.AI.Model,
+		AIMaxTokens:           settings.AI.MaxTokens,
+		AITemperature:         settings.AI.Temperature,
+		AIBaseURL:             settings.AI.BaseURL,
+		AIWebhookHeaders:      settings.AI.WebhookHeaders,
+		AIWebhookBody:         settings.AI.WebhookBody,
+		AIWebhookResponsePath: settings.AI.WebhookResponsePath,
+		AIFallbackProviders:   aiFallbackProvidersResponse(&settings),
+		AIExperiments:         aiExperimentsResponse(&settings),
+		AISystemPrompt:        settings.AI.SystemPrompt,
+		AIPersonas:            aiPersonas(&settings),
+		AIPersonaID:           settings.AI.PersonaID,
+		AIIncludeHistory:      settings.AI.IncludeHistory,
+		AIHistoryLimit:        settings.AI.HistoryLimit,
+		AIHistoryTTLMinutes:   settings.AI.HistoryTTLMinutes,
+		AISummarizeHistory:    settings.AI.SummarizeHistory,
+		AIHistoryTokenBudget:  settings.AI.HistoryTokenBudget,
+		AICacheTTLMinutes:     settings.AI.CacheTTLMinutes,
+		AIQuickReplies:        aiQuickReplies(&settings),
+		AIMonthlyTokenLimit:   settings.AI.MonthlyTokenLimit,
+		AIQuotaMessage:        settings.AI.QuotaMessage,
+		AITools:               aiTools(&settings),
+		AIPaymentLinks:        settings.AI.PaymentLinks,
+		AIOrderLookup:         settings.AI.OrderLookup,
+		AIStreaming:           settings.AI.Streaming,
+		AIStreamSplit:         settings.AI.StreamSplit,
+		AIStreamIntervalMs:    settings.AI.StreamIntervalMs,
+		AIEmbeddingProvider:   settings.AI.EmbeddingProvider,
+		AIEmbeddingModel:      settings.AI.EmbeddingModel,
+		AIEmbeddingBaseURL:    settings.AI.EmbeddingBaseURL,
+		AIKnowledgeTopK:       settings.AI.KnowledgeTopK,
+		AIModerationEnabled:   settings.AI.ModerationEnabled,
+		AIModerationBlocklist: settings.AI.ModerationBlocklist,
+		AIModerationProvider:  settings.AI.ModerationProvider,
+		AIModerationMessage:   settings.AI.ModerationMessage,
+		// Sentiment Settings
+		SentimentEnabled:   settings.Sentiment.Enabled,
+		SentimentProvider:  settings.Sentiment.Provider,
+		SentimentThreshold: settings.Sentiment.Threshold,
+		SentimentWindow:    settings.Sentiment.Window,
+		SentimentAction:    settings.Sentiment.Action,
+		// Transcription Settings
+		TranscriptionEnabled:  settings.Transcription.Enabled,
+		TranscriptionProvider: settings.Transcription.Provider,
+		TranscriptionURL:      settings.Transcription.URL,
+		TranscriptionModel:    settings.Transcription.Model,
+		// Satisfaction Survey Settings
+		CSATEnabled:     settings.CSAT.Enabled,
+		CSATBotSessions: settings.CSAT.BotSessions,
+		CSATQuestion:    settings.CSAT.Question,
+		CSATFollowUp:    settings.CSAT.FollowUp,
+		CSATThankYou:    settings.CSAT.ThankYou,
+		// Abuse Detection Settings
+		AbuseEnabled:      settings.Abuse.Enabled,
+		AbuseMaxMessages:  settings.Abuse.MaxMessages,
+		AbuseWindowSecs:   settings.Abuse.WindowSecs,
+		AbuseBlocklist:    settings.Abuse.Blocklist,
+		AbuseAction:       settings.Abuse.Action,
+		AbuseCooldownMins: settings.Abuse.CooldownMins,
+		// Language Settings
+		LanguageDetectionEnabled: settings.Language.DetectionEnabled,
+		DefaultLanguage:          settings.Language.DefaultLanguage,
+		SupportedLanguages:       settings.Language.SupportedLanguages,
+		MessageTranslations:      messageTranslations(settings.Language),
 		// SLA Settings
 		SLAEnabled:             settings.SLA.Enabled,
 		SLAResponseMinutes:     settings.SLA.ResponseMinutes,
@@ -187,6 +343,16 @@ func (a *App) GetChatbotSettings(r *fastglue.Request) error {
 		ClientAutoCloseMessage: settings.ClientInactivity.AutoCloseMessage,
 	}
 
+	if settings.BusinessHours.OutOfHoursFlowID != nil {
+		settingsResp.OutOfHoursFlowID = settings.BusinessHours.OutOfHoursFlowID.String()
+	}
+	if settings.AdsFlowID != nil {
+		settingsResp.AdsFlowID = settings.AdsFlowID.String()
+	}
+	if settings.AgentAssignment.HandoffTeamID != nil {
+		settingsResp.HandoffTeamID = settings.AgentAssignment.HandoffTeamID.String()
+	}
+
 	return r.SendEnvelope(map[string]interface{}{
 		"settings": settingsResp,
 		"stats":    stats,
@@ -207,19 +373,91 @@ func (a *App) UpdateChatbotSettings(r *fastglue.Request) error {
 		FallbackMessage            *string                    `json:"fallback_message"`
 		FallbackButtons            *[]map[string]interface{}  `json:"fallback_buttons"`
 		SessionTimeoutMinutes      *int                       `json:"session_timeout_minutes"`
+		SessionClosedMessage       *string                    `json:"session_closed_message"`
 		BusinessHoursEnabled       *bool                      `json:"business_hours_enabled"`
 		BusinessHours              *[]map[string]interface{}  `json:"business_hours"`
 		OutOfHoursMessage          *string                    `json:"out_of_hours_message"`
 		AllowAutomatedOutsideHours *bool                      `json:"allow_automated_outside_hours"`
+		BusinessHoursTimezone      *string                    `json:"business_hours_timezone"`
+		OutOfHoursFlowID           *string                    `json:"out_of_hours_flow_id"`
+		QueueOutsideHours          *bool                      `json:"queue_outside_hours"`
+		AdsFlowID                  *string                    `json:"ads_flow_id"`
 		AllowAgentQueuePickup        *bool                      `json:"allow_agent_queue_pickup"`
 		AssignToSameAgent            *bool                      `json:"assign_to_same_agent"`
 		AgentCurrentConversationOnly *bool                      `json:"agent_current_conversation_only"`
+		HandoffOnAIIntent            *bool                      `json:"handoff_on_ai_intent"`
+		HandoffAfterFallbacks        *int                       `json:"handoff_after_fallbacks"`
+		HandoffTeamID                *string                    `json:"handoff_team_id"`
 		AIEnabled                    *bool                      `json:"ai_enabled"`
 		AIProvider                 *models.AIProvider         `json:"ai_provider"`
 		AIAPIKey                   *string                    `json:"ai_api_key"`
 		AIModel                    *string                    `json:"ai_model"`
 		AIMaxTokens                *int                       `json:"ai_max_tokens"`
+		AITemperature              *float64                   `json:"ai_temperature"`
+		AIBaseURL                  *string                    `json:"ai_base_url"`
+		AIWebhookHeaders           *map[string]string         `json:"ai_webhook_headers"`
+		AIWebhookBody              *string                    `json:"ai_webhook_body"`
+		AIWebhookResponsePath      *string                    `json:"ai_webhook_response_path"`
+		AIFallbackProviders        *[]AIFallbackProvider      `json:"ai_fallback_providers"`
+		AIExperiments              *[]AIExperiment            `json:"ai_experiments"`
 		AISystemPrompt             *string                    `json:"ai_system_prompt"`
+		AIPersonas                 *[]AIPersona               `json:"ai_personas"`
+		AIPersonaID                *string                    `json:"ai_persona_id"`
+		AIIncludeHistory           *bool                      `json:"ai_include_history"`
+		AIHistoryLimit             *int                       `json:"ai_history_limit"`
+		AIHistoryTTLMinutes        *int                       `json:"ai_history_ttl_minutes"`
+		AISummarizeHistory         *bool                      `json:"ai_summarize_history"`
+		AIHistoryTokenBudget       *int                       `json:"ai_history_token_budget"`
+		AICacheTTLMinutes          *int                       `json:"ai_cache_ttl_minutes"`
+		AIQuickReplies             *[]AIQuickReply            `json:"ai_quick_replies"`
+		AIMonthlyTokenLimit        *int64                     `json:"ai_monthly_token_limit"`
+		AIQuotaMessage             *string                    `json:"ai_quota_message"`
+		AITools                    *[]AITool                  `json:"ai_tools"`
+		AIPaymentLinks             *bool                      `json:"ai_payment_links"`
+		AIOrderLookup              *bool                      `json:"ai_order_lookup"`
+		AIStreaming                *bool                      `json:"ai_streaming"`
+		AIStreamSplit              *models.AIStreamSplit      `json:"ai_stream_split"`
+		AIStreamIntervalMs         *int                       `json:"ai_stream_interval_ms"`
+		AIEmbeddingProvider        *models.AIProvider         `json:"ai_embedding_provider"`
+		AIEmbeddingModel           *string                    `json:"ai_embedding_model"`
+		AIEmbeddingBaseURL         *string                    `json:"ai_embedding_base_url"`
+		AIEmbeddingAPIKey          *string                    `json:"ai_embedding_api_key"`
+		AIKnowledgeTopK            *int                       `json:"ai_knowledge_top_k"`
+		AIModerationEnabled        *bool                      `json:"ai_moderation_enabled"`
+		AIModerationBlocklist      *[]string                  `json:"ai_moderation_blocklist"`
+		AIModerationProvider       *models.AIProvider         `json:"ai_moderation_provider"`
+		AIModerationAPIKey         *string                    `json:"ai_moderation_api_key"`
+		AIModerationMessage        *string                    `json:"ai_moderation_message"`
+		// Sentiment Settings
+		SentimentEnabled   *bool                     `json:"sentiment_enabled"`
+		SentimentProvider  *models.SentimentProvider `json:"sentiment_provider"`
+		SentimentThreshold *float64                  `json:"sentiment_threshold"`
+		SentimentWindow    *int                      `json:"sentiment_window"`
+		SentimentAction    *models.SentimentAction   `json:"sentiment_action"`
+		// Transcription Settings
+		TranscriptionEnabled  *bool                         `json:"transcription_enabled"`
+		TranscriptionProvider *models.TranscriptionProvider `json:"transcription_provider"`
+		TranscriptionURL      *string                       `json:"transcription_url"`
+		TranscriptionAPIKey   *string                       `json:"transcription_api_key"`
+		TranscriptionModel    *string                       `json:"transcription_model"`
+		// Satisfaction Survey Settings
+		CSATEnabled     *bool   `json:"csat_enabled"`
+		CSATBotSessions *bool   `json:"csat_bot_sessions"`
+		CSATQuestion    *string `json:"csat_question"`
+		CSATFollowUp    *string `json:"csat_follow_up"`
+		CSATThankYou    *string `json:"csat_thank_you"`
+		// Abuse Detection Settings
+		AbuseEnabled      *bool               `json:"abuse_enabled"`
+		AbuseMaxMessages  *int                `json:"abuse_max_messages"`
+		AbuseWindowSecs   *int                `json:"abuse_window_secs"`
+		AbuseBlocklist    *[]string           `json:"abuse_blocklist"`
+		AbuseAction       *models.AbuseAction `json:"abuse_action"`
+		AbuseCooldownMins *int                `json:"abuse_cooldown_mins"`
+		// Language Settings
+		LanguageDetectionEnabled *bool                         `json:"language_detection_enabled"`
+		DefaultLanguage          *string                       `json:"default_language"`
+		SupportedLanguages       *[]string                     `json:"supported_languages"`
+		MessageTranslations      *map[string]map[string]string `json:"message_translations"`
 		// SLA Settings
 		SLAEnabled             *bool     `json:"sla_enabled"`
 		SLAResponseMinutes     *int      `json:"sla_response_minutes"`
@@ -241,17 +479,67 @@ func (a *App) UpdateChatbotSettings(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
 	}
 
+	// API keys can reference secrets, which must be allowed and reachable
+	credentials := map[string]*string{
+		"ai_api_key":            req.AIAPIKey,
+		"ai_embedding_api_key":  req.AIEmbeddingAPIKey,
+		"ai_moderation_api_key": req.AIModerationAPIKey,
+		"transcription_api_key": req.TranscriptionAPIKey,
+	}
+	if req.AIFallbackProviders != nil {
+		for i := range *req.AIFallbackProviders {
+			credentials[fmt.Sprintf("ai_fallback_providers[%d].api_key", i)] = &(*req.AIFallbackProviders)[i].APIKey
+		}
+	}
+	if req.AIExperiments != nil {
+		for i := range *req.AIExperiments {
+			credentials[fmt.Sprintf("ai_experiments[%d].api_key", i)] = &(*req.AIExperiments)[i].APIKey
+		}
+	}
+	for field, value := range credentials {
+		if value == nil {
+			continue
+		}
+		if err := a.checkCredential(r.RequestCtx, orgID, *value); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, field+": "+err.Error(), nil, "")
+		}
+	}
+
+	// Optional per-number settings; empty updates the organization defaults
+	accountName := string(r.RequestCtx.QueryArgs().Peek("whatsapp_account"))
+	if accountName != "" {
+		var count int64
+		a.DB.Model(&models.WhatsAppAccount{}).Where("organization_id = ? AND name = ?", orgID, accountName).Count(&count)
+		if count == 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "WhatsApp account not found", nil, "")
+		}
+	}
+
 	// Get or create settings
 	var settings models.ChatbotSettings
-	result := a.DB.Where("organization_id = ? AND whats_app_account = ?", orgID, "").First(&settings)
+	result := a.DB.Where("organization_id = ? AND whats_app_account = ?", orgID, accountName).First(&settings)
 	if result.Error != nil {
-		// Create new settings
-		settings = models.ChatbotSettings{
-			BaseModel:      models.BaseModel{ID: uuid.New()},
-			OrganizationID: orgID,
+		// Per-number settings start as a copy of the organization defaults
+		if accountName != "" && a.DB.Where("organization_id = ? AND whats_app_account = ?", orgID, "").First(&settings).Error == nil {
+			settings.ID = uuid.New()
+			settings.CreatedAt = time.Time{}
+			settings.UpdatedAt = time.Time{}
+			settings.WhatsAppAccount = accountName
+		} else {
+			// Create new settings
+			settings = models.ChatbotSettings{
+				BaseModel:       models.BaseModel{ID: uuid.New()},
+				OrganizationID:  orgID,
+				WhatsAppAccount: accountName,
+			}
 		}
 	}
 
+	var before map[string]interface{}
+	if result.Error == nil {
+		before = auditSnapshot(settings)
+	}
+
 	// Update fields if provided
 	if req.Enabled != nil {
 		settings.IsEnabled = *req.Enabled
@@ -277,8 +565,14 @@ func (a *App) UpdateChatbotSettings(r *fastglue.Request) error {
 		settings.FallbackButtons = buttons
 	}
 	if req.SessionTimeoutMinutes != nil {
+		if *req.SessionTimeoutMinutes < 1 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Session timeout must be at least 1 minute", nil, "")
+		}
 		settings.SessionTimeoutMins = *req.SessionTimeoutMinutes
 	}
+	if req.SessionClosedMessage != nil {
+		settings.SessionClosedMessage = *req.SessionClosedMessage
+	}
 	// Business Hours
 	if req.BusinessHoursEnabled != nil {
 		settings.BusinessHours.Enabled = *req.BusinessHoursEnabled
@@ -296,6 +590,47 @@ func (a *App) UpdateChatbotSettings(r *fastglue.Request) error {
 	if req.AllowAutomatedOutsideHours != nil {
 		settings.BusinessHours.AllowAutomatedOutside = *req.AllowAutomatedOutsideHours
 	}
+	if req.BusinessHoursTimezone != nil {
+		if _, err := time.LoadLocation(*req.BusinessHoursTimezone); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid business hours timezone", nil, "")
+		}
+		settings.BusinessHours.Timezone = *req.BusinessHoursTimezone
+	}
+	if req.OutOfHoursFlowID != nil {
+		if *req.OutOfHoursFlowID == "" {
+			settings.BusinessHours.OutOfHoursFlowID = nil
+		} else {
+			flowID, err := uuid.Parse(*req.OutOfHoursFlowID)
+			if err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid out of hours flow ID", nil, "")
+			}
+			var count int64
+			a.DB.Model(&models.ChatbotFlow{}).Where("id = ? AND organization_id = ?", flowID, orgID).Count(&count)
+			if count == 0 {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Out of hours flow not found", nil, "")
+			}
+			settings.BusinessHours.OutOfHoursFlowID = &flowID
+		}
+	}
+	if req.QueueOutsideHours != nil {
+		settings.BusinessHours.QueueOutsideHours = *req.QueueOutsideHours
+	}
+	if req.AdsFlowID != nil {
+		if *req.AdsFlowID == "" {
+			settings.AdsFlowID = nil
+		} else {
+			flowID, err := uuid.Parse(*req.AdsFlowID)
+			if err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ads flow ID", nil, "")
+			}
+			var count int64
+			a.DB.Model(&models.ChatbotFlow{}).Where("id = ? AND organization_id = ?", flowID, orgID).Count(&count)
+			if count == 0 {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Ads flow not found", nil, "")
+			}
+			settings.AdsFlowID = &flowID
+		}
+	}
 
 	// Agent Assignment
 	if req.AllowAgentQueuePickup != nil {
@@ -307,12 +642,40 @@ func (a *App) UpdateChatbotSettings(r *fastglue.Request) error {
 	if req.AgentCurrentConversationOnly != nil {
 		settings.AgentAssignment.CurrentConversationOnly = *req.AgentCurrentConversationOnly
 	}
+	if req.HandoffOnAIIntent != nil {
+		settings.AgentAssignment.HandoffOnAIIntent = *req.HandoffOnAIIntent
+	}
+	if req.HandoffAfterFallbacks != nil {
+		if *req.HandoffAfterFallbacks < 0 || *req.HandoffAfterFallbacks > maxHandoffFallbacks {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Handoff after fallbacks must be between 0 and %d", maxHandoffFallbacks), nil, "")
+		}
+		settings.AgentAssignment.HandoffAfterFallbacks = *req.HandoffAfterFallbacks
+	}
+	if req.HandoffTeamID != nil {
+		if *req.HandoffTeamID == "" {
+			settings.AgentAssignment.HandoffTeamID = nil
+		} else {
+			teamID, err := uuid.Parse(*req.HandoffTeamID)
+			if err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid handoff team ID", nil, "")
+			}
+			var count int64
+			a.DB.Model(&models.Team{}).Where("id = ? AND organization_id = ?", teamID, orgID).Count(&count)
+			if count == 0 {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Handoff team not found", nil, "")
+			}
+			settings.AgentAssignment.HandoffTeamID = &teamID
+		}
+	}
 
 	// AI Settings
 	if req.AIEnabled != nil {
 		settings.AI.Enabled = *req.AIEnabled
 	}
 	if req.AIProvider != nil {
+		if *req.AIProvider != "" && !isAIProvider(*req.AIProvider) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Unsupported AI provider", nil, "")
+		}
 		settings.AI.Provider = *req.AIProvider
 	}
 	if req.AIAPIKey != nil && *req.AIAPIKey != "" {
@@ -322,11 +685,391 @@ func (a *App) UpdateChatbotSettings(r *fastglue.Request) error {
 		settings.AI.Model = *req.AIModel
 	}
 	if req.AIMaxTokens != nil {
+		if *req.AIMaxTokens < 1 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "AI max tokens must be at least 1", nil, "")
+		}
 		settings.AI.MaxTokens = *req.AIMaxTokens
 	}
+	if req.AITemperature != nil {
+		settings.AI.Temperature = *req.AITemperature
+	}
+	// Checked against the provider too, since changing it can make the saved temperature invalid
+	if req.AITemperature != nil || req.AIProvider != nil {
+		maxTemperature := maxAITemperature(settings.AI.Provider)
+		if settings.AI.Temperature < 0 || settings.AI.Temperature > maxTemperature {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("AI temperature must be between 0 and %g for this provider", maxTemperature), nil, "")
+		}
+	}
+	if req.AIBaseURL != nil {
+		baseURL, err := normalizeAIBaseURL(*req.AIBaseURL)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		settings.AI.BaseURL = baseURL
+	}
+	if req.AIFallbackProviders != nil {
+		providers, err := validateAIFallbackProviders(*req.AIFallbackProviders, aiFallbackProviders(&settings))
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid AI fallback providers: "+err.Error(), nil, "")
+		}
+		if err := models.EncryptAIProviderKeys(providers); err != nil {
+			a.Log.Error("Failed to encrypt AI fallback provider keys", "error", err, "org_id", orgID)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to save settings", nil, "")
+		}
+		settings.AI.FallbackProviders = providers
+	}
+	if req.AIExperiments != nil {
+		experiments, err := validateAIExperiments(*req.AIExperiments, aiExperiments(&settings))
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid AI experiments: "+err.Error(), nil, "")
+		}
+		if err := models.EncryptAIProviderKeys(experiments); err != nil {
+			a.Log.Error("Failed to encrypt AI experiment keys", "error", err, "org_id", orgID)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to save settings", nil, "")
+		}
+		settings.AI.Experiments = experiments
+	}
+	if req.AIWebhookHeaders != nil {
+		headers := models.JSONB{}
+		for key, value := range *req.AIWebhookHeaders {
+			if key = strings.TrimSpace(key); key != "" {
+				headers[key] = value
+			}
+		}
+		settings.AI.WebhookHeaders = headers
+	}
+	if req.AIWebhookBody != nil {
+		body := strings.TrimSpace(*req.AIWebhookBody)
+		if body != "" {
+			if err := validateAIWebhookBody(body); err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid AI webhook body: "+err.Error(), nil, "")
+			}
+		}
+		settings.AI.WebhookBody = body
+	}
+	if req.AIWebhookResponsePath != nil {
+		settings.AI.WebhookResponsePath = strings.TrimSpace(*req.AIWebhookResponsePath)
+	}
 	if req.AISystemPrompt != nil {
 		settings.AI.SystemPrompt = *req.AISystemPrompt
 	}
+	if req.AIPersonas != nil {
+		if err := validateAIPersonas(*req.AIPersonas); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid AI personas: "+err.Error(), nil, "")
+		}
+		personas := make([]interface{}, len(*req.AIPersonas))
+		for i, persona := range *req.AIPersonas {
+			personas[i] = map[string]interface{}{
+				"id":     persona.ID,
+				"name":   strings.TrimSpace(persona.Name),
+				"prompt": persona.Prompt,
+			}
+		}
+		settings.AI.Personas = personas
+	}
+	if req.AIPersonaID != nil {
+		settings.AI.PersonaID = *req.AIPersonaID
+		if _, ok := activeAIPersona(&settings); !ok && settings.AI.PersonaID != "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "AI persona not found", nil, "")
+		}
+	} else if _, ok := activeAIPersona(&settings); !ok {
+		// The selected persona was removed, go back to the system prompt
+		settings.AI.PersonaID = ""
+	}
+	if req.AIIncludeHistory != nil {
+		settings.AI.IncludeHistory = *req.AIIncludeHistory
+	}
+	if req.AIHistoryLimit != nil {
+		if *req.AIHistoryLimit < 1 || *req.AIHistoryLimit > maxAIHistoryLimit {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("AI history length must be between 1 and %d messages", maxAIHistoryLimit), nil, "")
+		}
+		settings.AI.HistoryLimit = *req.AIHistoryLimit
+	}
+	if req.AIHistoryTTLMinutes != nil {
+		if *req.AIHistoryTTLMinutes < 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "AI history TTL can't be negative", nil, "")
+		}
+		settings.AI.HistoryTTLMinutes = *req.AIHistoryTTLMinutes
+	}
+	if req.AISummarizeHistory != nil {
+		settings.AI.SummarizeHistory = *req.AISummarizeHistory
+	}
+	if req.AIHistoryTokenBudget != nil {
+		if *req.AIHistoryTokenBudget < minAIHistoryTokenBudget || *req.AIHistoryTokenBudget > maxAIHistoryTokenBudget {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("AI history token budget must be between %d and %d tokens", minAIHistoryTokenBudget, maxAIHistoryTokenBudget), nil, "")
+		}
+		settings.AI.HistoryTokenBudget = *req.AIHistoryTokenBudget
+	}
+	if req.AICacheTTLMinutes != nil {
+		if *req.AICacheTTLMinutes < 0 || *req.AICacheTTLMinutes > maxAICacheTTLMinutes {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("AI cache TTL must be between 0 and %d minutes", maxAICacheTTLMinutes), nil, "")
+		}
+		settings.AI.CacheTTLMinutes = *req.AICacheTTLMinutes
+	}
+	if req.AIQuickReplies != nil {
+		if err := validateAIQuickReplies(*req.AIQuickReplies); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid AI quick replies: "+err.Error(), nil, "")
+		}
+		replies := make([]interface{}, len(*req.AIQuickReplies))
+		for i, reply := range *req.AIQuickReplies {
+			if reply.Action == models.AIQuickReplyActionFlow {
+				var count int64
+				a.DB.Model(&models.ChatbotFlow{}).Where("id = ? AND organization_id = ?", reply.FlowID, orgID).Count(&count)
+				if count == 0 {
+					return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Quick reply flow not found", nil, "")
+				}
+			} else {
+				reply.FlowID = ""
+			}
+			replies[i] = map[string]interface{}{
+				"id":      reply.ID,
+				"title":   strings.TrimSpace(reply.Title),
+				"action":  string(reply.Action),
+				"flow_id": reply.FlowID,
+			}
+		}
+		settings.AI.QuickReplies = replies
+	}
+	if req.AIMonthlyTokenLimit != nil {
+		if *req.AIMonthlyTokenLimit < 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "AI monthly token limit can't be negative", nil, "")
+		}
+		settings.AI.MonthlyTokenLimit = *req.AIMonthlyTokenLimit
+	}
+	if req.AIQuotaMessage != nil {
+		settings.AI.QuotaMessage = *req.AIQuotaMessage
+	}
+	if req.AITools != nil {
+		tools, err := validateAITools(*req.AITools)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid AI tools: "+err.Error(), nil, "")
+		}
+		settings.AI.Tools = tools
+	}
+	if req.AIPaymentLinks != nil {
+		settings.AI.PaymentLinks = *req.AIPaymentLinks
+	}
+	if req.AIOrderLookup != nil {
+		settings.AI.OrderLookup = *req.AIOrderLookup
+	}
+	if req.AIStreaming != nil {
+		settings.AI.Streaming = *req.AIStreaming
+	}
+	if req.AIStreamSplit != nil {
+		if *req.AIStreamSplit != models.AIStreamSplitParagraph && *req.AIStreamSplit != models.AIStreamSplitSentence {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "AI stream split must be paragraph or sentence", nil, "")
+		}
+		settings.AI.StreamSplit = *req.AIStreamSplit
+	}
+	if req.AIStreamIntervalMs != nil {
+		if *req.AIStreamIntervalMs < 0 || *req.AIStreamIntervalMs > maxAIStreamIntervalMs {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("AI stream interval must be between 0 and %d milliseconds", maxAIStreamIntervalMs), nil, "")
+		}
+		settings.AI.StreamIntervalMs = *req.AIStreamIntervalMs
+	}
+	if req.AIEmbeddingProvider != nil {
+		if _, ok := defaultEmbeddingModels[*req.AIEmbeddingProvider]; *req.AIEmbeddingProvider != "" && !ok {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Embeddings are available with openai, google or ollama", nil, "")
+		}
+		settings.AI.EmbeddingProvider = *req.AIEmbeddingProvider
+	}
+	if req.AIEmbeddingModel != nil {
+		settings.AI.EmbeddingModel = strings.TrimSpace(*req.AIEmbeddingModel)
+	}
+	if req.AIEmbeddingBaseURL != nil {
+		baseURL, err := normalizeAIBaseURL(*req.AIEmbeddingBaseURL)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		settings.AI.EmbeddingBaseURL = baseURL
+	}
+	if req.AIEmbeddingAPIKey != nil && *req.AIEmbeddingAPIKey != "" {
+		settings.AI.EmbeddingAPIKey = *req.AIEmbeddingAPIKey
+	}
+	if req.AIKnowledgeTopK != nil {
+		if *req.AIKnowledgeTopK < 0 || *req.AIKnowledgeTopK > maxKnowledgeTopK {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("AI knowledge top-k must be between 0 and %d", maxKnowledgeTopK), nil, "")
+		}
+		settings.AI.KnowledgeTopK = *req.AIKnowledgeTopK
+	}
+	if req.AIModerationEnabled != nil {
+		settings.AI.ModerationEnabled = *req.AIModerationEnabled
+	}
+	if req.AIModerationBlocklist != nil {
+		blocklist, err := validateModerationBlocklist(*req.AIModerationBlocklist)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid AI moderation blocklist: "+err.Error(), nil, "")
+		}
+		settings.AI.ModerationBlocklist = blocklist
+	}
+	if req.AIModerationProvider != nil {
+		if *req.AIModerationProvider != "" && *req.AIModerationProvider != models.AIProviderOpenAI {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "AI moderation is available with openai", nil, "")
+		}
+		settings.AI.ModerationProvider = *req.AIModerationProvider
+	}
+	if req.AIModerationAPIKey != nil && *req.AIModerationAPIKey != "" {
+		settings.AI.ModerationAPIKey = *req.AIModerationAPIKey
+	}
+	if req.AIModerationMessage != nil {
+		settings.AI.ModerationMessage = *req.AIModerationMessage
+	}
+
+	// Sentiment Settings
+	if req.SentimentEnabled != nil {
+		settings.Sentiment.Enabled = *req.SentimentEnabled
+	}
+	if req.SentimentProvider != nil {
+		if *req.SentimentProvider != models.SentimentProviderLexicon && *req.SentimentProvider != models.SentimentProviderAI {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Sentiment provider must be lexicon or ai", nil, "")
+		}
+		settings.Sentiment.Provider = *req.SentimentProvider
+	}
+	if req.SentimentThreshold != nil {
+		if *req.SentimentThreshold < -1 || *req.SentimentThreshold > 1 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Sentiment threshold must be between -1 and 1", nil, "")
+		}
+		settings.Sentiment.Threshold = *req.SentimentThreshold
+	}
+	if req.SentimentWindow != nil {
+		if *req.SentimentWindow < 1 || *req.SentimentWindow > maxSentimentWindow {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Sentiment window must be between 1 and %d messages", maxSentimentWindow), nil, "")
+		}
+		settings.Sentiment.Window = *req.SentimentWindow
+	}
+	if req.SentimentAction != nil {
+		if *req.SentimentAction != models.SentimentActionNotify && *req.SentimentAction != models.SentimentActionHandoff {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Sentiment action must be notify or handoff", nil, "")
+		}
+		settings.Sentiment.Action = *req.SentimentAction
+	}
+
+	// Transcription Settings
+	if req.TranscriptionEnabled != nil {
+		settings.Transcription.Enabled = *req.TranscriptionEnabled
+	}
+	if req.TranscriptionProvider != nil {
+		if *req.TranscriptionProvider != models.TranscriptionProviderOpenAI && *req.TranscriptionProvider != models.TranscriptionProviderWebhook {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Transcription provider must be openai or webhook", nil, "")
+		}
+		settings.Transcription.Provider = *req.TranscriptionProvider
+	}
+	if req.TranscriptionURL != nil {
+		transcriptionURL, err := normalizeAIBaseURL(*req.TranscriptionURL)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Transcription URL must be an http or https URL", nil, "")
+		}
+		settings.Transcription.URL = transcriptionURL
+	}
+	if req.TranscriptionAPIKey != nil && *req.TranscriptionAPIKey != "" {
+		settings.Transcription.APIKey = *req.TranscriptionAPIKey
+	}
+	if req.TranscriptionModel != nil {
+		settings.Transcription.Model = strings.TrimSpace(*req.TranscriptionModel)
+	}
+	if settings.Transcription.Enabled && settings.Transcription.Provider == models.TranscriptionProviderWebhook && settings.Transcription.URL == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Transcription URL is required for the webhook provider", nil, "")
+	}
+
+	// Satisfaction Survey Settings
+	if req.CSATEnabled != nil {
+		settings.CSAT.Enabled = *req.CSATEnabled
+	}
+	if req.CSATBotSessions != nil {
+		settings.CSAT.BotSessions = *req.CSATBotSessions
+	}
+	if req.CSATQuestion != nil {
+		if len(*req.CSATQuestion) > maxCSATQuestionLength {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Survey question must be at most %d characters", maxCSATQuestionLength), nil, "")
+		}
+		settings.CSAT.Question = strings.TrimSpace(*req.CSATQuestion)
+	}
+	if req.CSATFollowUp != nil {
+		settings.CSAT.FollowUp = strings.TrimSpace(*req.CSATFollowUp)
+	}
+	if req.CSATThankYou != nil {
+		settings.CSAT.ThankYou = strings.TrimSpace(*req.CSATThankYou)
+	}
+
+	// Abuse Detection Settings
+	if req.AbuseEnabled != nil {
+		settings.Abuse.Enabled = *req.AbuseEnabled
+	}
+	if req.AbuseMaxMessages != nil {
+		if *req.AbuseMaxMessages < 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Abuse message limit can't be negative", nil, "")
+		}
+		settings.Abuse.MaxMessages = *req.AbuseMaxMessages
+	}
+	if req.AbuseWindowSecs != nil {
+		if *req.AbuseWindowSecs < 1 || *req.AbuseWindowSecs > maxAbuseWindowSecs {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Abuse window must be between 1 and %d seconds", maxAbuseWindowSecs), nil, "")
+		}
+		settings.Abuse.WindowSecs = *req.AbuseWindowSecs
+	}
+	if req.AbuseBlocklist != nil {
+		blocklist, err := validateModerationBlocklist(*req.AbuseBlocklist)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid abuse blocklist: "+err.Error(), nil, "")
+		}
+		settings.Abuse.Blocklist = blocklist
+	}
+	if req.AbuseAction != nil {
+		if *req.AbuseAction != models.AbuseActionPauseBot && *req.AbuseAction != models.AbuseActionBlock {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Abuse action must be pause_bot or block", nil, "")
+		}
+		settings.Abuse.Action = *req.AbuseAction
+	}
+	if req.AbuseCooldownMins != nil {
+		if *req.AbuseCooldownMins < 1 || *req.AbuseCooldownMins > maxAbuseCooldownMins {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Abuse cool-down must be between 1 and %d minutes", maxAbuseCooldownMins), nil, "")
+		}
+		settings.Abuse.CooldownMins = *req.AbuseCooldownMins
+	}
+
+	// Language Settings
+	if req.LanguageDetectionEnabled != nil {
+		settings.Language.DetectionEnabled = *req.LanguageDetectionEnabled
+	}
+	if req.DefaultLanguage != nil {
+		if *req.DefaultLanguage != "" && !isLanguageCode(*req.DefaultLanguage) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid default language", nil, "")
+		}
+		settings.Language.DefaultLanguage = *req.DefaultLanguage
+	}
+	if req.SupportedLanguages != nil {
+		for _, lang := range *req.SupportedLanguages {
+			if !isLanguageCode(lang) {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid supported language: "+lang, nil, "")
+			}
+		}
+		settings.Language.SupportedLanguages = *req.SupportedLanguages
+	}
+	if req.MessageTranslations != nil {
+		translations := models.JSONB{}
+		for lang, variants := range *req.MessageTranslations {
+			if !isLanguageCode(lang) {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid translation language: "+lang, nil, "")
+			}
+			messages := map[string]interface{}{}
+			for key, text := range variants {
+				if !slices.Contains(translationKeys, key) {
+					return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid translated message: "+key, nil, "")
+				}
+				if strings.TrimSpace(text) != "" {
+					messages[key] = text
+				}
+			}
+			if len(messages) > 0 {
+				translations[lang] = messages
+			}
+		}
+		settings.Language.MessageTranslations = translations
+	}
+	if lang := settings.Language.DefaultLanguage; lang != "" && len(settings.Language.SupportedLanguages) > 0 &&
+		!slices.Contains([]string(settings.Language.SupportedLanguages), lang) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Default language must be one of the supported languages", nil, "")
+	}
 
 	// SLA Settings
 	if req.SLAEnabled != nil {
@@ -374,6 +1117,17 @@ func (a *App) UpdateChatbotSettings(r *fastglue.Request) error {
 	if err := a.DB.Save(&settings).Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to save settings", nil, "")
 	}
+	action := models.AuditActionUpdate
+	if before == nil {
+		action = models.AuditActionCreate
+	}
+	a.recordAudit(r, models.AuditLog{
+		OrganizationID: orgID,
+		Action:         action,
+		ResourceType:   models.AuditResourceChatbotSettings,
+		ResourceID:     &settings.ID,
+		ResourceName:   accountName,
+	}, before, auditSnapshot(settings))
 
 	// Invalidate caches
 	a.InvalidateChatbotSettingsCache(orgID)
@@ -454,6 +1208,9 @@ func (a *App) CreateKeywordRule(r *fastglue.Request) error {
 	if req.Name == "" {
 		req.Name = req.Keywords[0]
 	}
+	if err := validateKeywordRule(req.Keywords, req.MatchType, req.ResponseType, req.ResponseContent); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
 
 	rule := models.KeywordRule{
 		BaseModel:       models.BaseModel{ID: uuid.New()},
@@ -568,6 +1325,11 @@ func (a *App) UpdateKeywordRule(r *fastglue.Request) error {
 	if req.Enabled != nil {
 		rule.IsEnabled = *req.Enabled
 	}
+	if req.Keywords != nil || req.MatchType != nil || req.ResponseType != nil || req.ResponseContent != nil {
+		if err := validateKeywordRule(rule.Keywords, rule.MatchType, rule.ResponseType, rule.ResponseContent); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+	}
 
 	if err := a.DB.Save(&rule).Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update keyword rule", nil, "")
@@ -622,8 +1384,14 @@ func (a *App) ListChatbotFlows(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
 	}
 
+	query := a.DB.Where("organization_id = ?", orgID)
+	// Flows that serve every number also serve the requested one
+	if accountName := string(r.RequestCtx.QueryArgs().Peek("whatsapp_account")); accountName != "" {
+		query = query.Where("whats_app_account = ? OR whats_app_account = ''", accountName)
+	}
+
 	var flows []models.ChatbotFlow
-	if err := a.DB.Where("organization_id = ?", orgID).
+	if err := query.
 		Preload("Steps").
 		Order("created_at DESC").
 		Find(&flows).Error; err != nil {
@@ -637,6 +1405,8 @@ func (a *App) ListChatbotFlows(r *fastglue.Request) error {
 			Name:            flow.Name,
 			Description:     flow.Description,
 			TriggerKeywords: flow.TriggerKeywords,
+			Language:        flow.Language,
+			WhatsAppAccount: flow.WhatsAppAccount,
 			Enabled:         flow.IsEnabled,
 			StepsCount:      len(flow.Steps),
 			CreatedAt:       flow.CreatedAt.Format(time.RFC3339),
@@ -685,6 +1455,8 @@ func (a *App) CreateChatbotFlow(r *fastglue.Request) error {
 		Name              string                 `json:"name"`
 		Description       string                 `json:"description"`
 		TriggerKeywords   []string               `json:"trigger_keywords"`
+		Language          string                 `json:"language"`
+		WhatsAppAccount   string                 `json:"whatsapp_account"`
 		InitialMessage    string                 `json:"initial_message"`
 		CompletionMessage string                 `json:"completion_message"`
 		OnCompleteAction  string                 `json:"on_complete_action"`
@@ -701,6 +1473,15 @@ func (a *App) CreateChatbotFlow(r *fastglue.Request) error {
 	if req.Name == "" {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Name is required", nil, "")
 	}
+	if req.Language != "" && !isLanguageCode(req.Language) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid flow language", nil, "")
+	}
+	if req.WhatsAppAccount != "" && !a.accountExists(orgID, req.WhatsAppAccount) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "WhatsApp account not found", nil, "")
+	}
+	if err := a.validateFlowSteps(orgID, req.Steps); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
 
 	// Use transaction for flow + steps
 	tx := a.DB.Begin()
@@ -712,6 +1493,8 @@ func (a *App) CreateChatbotFlow(r *fastglue.Request) error {
 		Name:              req.Name,
 		Description:       req.Description,
 		TriggerKeywords:   req.TriggerKeywords,
+		Language:          req.Language,
+		WhatsAppAccount:   req.WhatsAppAccount,
 		InitialMessage:    req.InitialMessage,
 		CompletionMessage: req.CompletionMessage,
 		OnCompleteAction:  req.OnCompleteAction,
@@ -834,6 +1617,8 @@ func (a *App) UpdateChatbotFlow(r *fastglue.Request) error {
 		Name              *string                `json:"name"`
 		Description       *string                `json:"description"`
 		TriggerKeywords   []string               `json:"trigger_keywords"`
+		Language          *string                `json:"language"`
+		WhatsAppAccount   *string                `json:"whatsapp_account"`
 		InitialMessage    *string                `json:"initial_message"`
 		CompletionMessage *string                `json:"completion_message"`
 		OnCompleteAction  *string                `json:"on_complete_action"`
@@ -847,6 +1632,16 @@ func (a *App) UpdateChatbotFlow(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
 	}
 
+	if req.Language != nil && *req.Language != "" && !isLanguageCode(*req.Language) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid flow language", nil, "")
+	}
+	if req.WhatsAppAccount != nil && *req.WhatsAppAccount != "" && !a.accountExists(orgID, *req.WhatsAppAccount) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "WhatsApp account not found", nil, "")
+	}
+	if err := a.validateFlowSteps(orgID, req.Steps); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
 	tx := a.DB.Begin()
 
 	if req.Name != nil {
@@ -858,6 +1653,12 @@ func (a *App) UpdateChatbotFlow(r *fastglue.Request) error {
 	if len(req.TriggerKeywords) > 0 {
 		flow.TriggerKeywords = req.TriggerKeywords
 	}
+	if req.Language != nil {
+		flow.Language = *req.Language
+	}
+	if req.WhatsAppAccount != nil {
+		flow.WhatsAppAccount = *req.WhatsAppAccount
+	}
 	if req.InitialMessage != nil {
 		flow.InitialMessage = *req.InitialMessage
 	}
@@ -1194,6 +1995,7 @@ func (a *App) ListChatbotSessions(r *fastglue.Request) error {
 	}
 
 	status := string(r.RequestCtx.QueryArgs().Peek("status"))
+	mode := string(r.RequestCtx.QueryArgs().Peek("mode"))
 
 	query := a.DB.Where("organization_id = ?", orgID).
 		Preload("Contact").
@@ -1202,6 +2004,9 @@ func (a *App) ListChatbotSessions(r *fastglue.Request) error {
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
+	if mode != "" {
+		query = query.Where("mode = ?", mode)
+	}
 
 	var sessions []models.ChatbotSession
 	if err := query.Limit(100).Find(&sessions).Error; err != nil {
@@ -1230,6 +2035,8 @@ func (a *App) GetChatbotSession(r *fastglue.Request) error {
 	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).
 		Preload("Contact").
 		Preload("Messages").
+		Preload("Notes", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") }).
+		Preload("Notes.Mentions").
 		First(&session).Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Session not found", nil, "")
 	}
@@ -1279,3 +2086,15 @@ func (a *App) getChatbotStats(orgID uuid.UUID) ChatbotStatsResponse {
 
 	return stats
 }
+
+// normalizeAIBaseURL trims an AI server or webhook URL and checks it is http(s)
+func normalizeAIBaseURL(raw string) (string, error) {
+	baseURL := strings.TrimRight(strings.TrimSpace(raw), "/")
+	if baseURL == "" {
+		return "", nil
+	}
+	if u, err := url.Parse(baseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("AI base URL must be an http or https URL")
+	}
+	return baseURL, nil
+}
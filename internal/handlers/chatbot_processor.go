@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,9 +13,13 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
 	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/tracing"
 	"github.com/shridarpatil/whatomate/internal/websocket"
 	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
 )
 
 // IncomingTextMessage represents a text, interactive, or media message from the webhook
@@ -43,6 +48,10 @@ type IncomingTextMessage struct {
 			Name         string `json:"name"`
 		} `json:"nfm_reply,omitempty"`
 	} `json:"interactive,omitempty"`
+	Button *struct {
+		Payload string `json:"payload"`
+		Text    string `json:"text"`
+	} `json:"button,omitempty"` // Template quick reply button
 	Image *struct {
 		ID       string `json:"id"`
 		MimeType string `json:"mime_type"`
@@ -86,39 +95,60 @@ type IncomingTextMessage struct {
 		Name      string  `json:"name,omitempty"`
 		Address   string  `json:"address,omitempty"`
 	} `json:"location,omitempty"`
-	Contacts []struct {
-		Name struct {
-			FormattedName string `json:"formatted_name"`
-			FirstName     string `json:"first_name,omitempty"`
-			LastName      string `json:"last_name,omitempty"`
-		} `json:"name"`
-		Phones []struct {
-			Phone string `json:"phone"`
-			Type  string `json:"type,omitempty"`
-		} `json:"phones,omitempty"`
-	} `json:"contacts,omitempty"`
+	Contacts []whatsapp.ContactCard `json:"contacts,omitempty"`
+	Edit     *IncomingMessageEdit   `json:"edit,omitempty"`     // The contact edited an earlier message
+	Revoke   *IncomingMessageRevoke `json:"revoke,omitempty"`   // The contact deleted an earlier message
+	GroupID  string                 `json:"group_id,omitempty"` // Set for messages sent in a group
+	Referral *IncomingReferral      `json:"referral,omitempty"` // Set for messages from click-to-WhatsApp ads
+	Order    *IncomingOrder         `json:"order,omitempty"`    // Cart sent from a catalog
 }
 
-// processIncomingMessageFull processes incoming WhatsApp messages with chatbot logic
-func (a *App) processIncomingMessageFull(phoneNumberID string, msg IncomingTextMessage, profileName string) {
-	a.Log.Info("Processing incoming message",
+// errIncomingMessageNotSaved is returned when an incoming message couldn't be stored
+var errIncomingMessageNotSaved = errors.New("failed to save incoming message")
+
+// processIncomingMessageFull processes incoming WhatsApp messages with chatbot logic.
+// It returns an error when the message couldn't be stored, before the chatbot answers
+// it, so it can be tried again.
+func (a *App) processIncomingMessageFull(ctx context.Context, phoneNumberID string, msg IncomingTextMessage, profileName string) error {
+	a.log(ctx).Info("Processing incoming message",
 		"phone_number_id", phoneNumberID,
 		"from", msg.From,
 		"type", msg.Type,
 		"profile_name", profileName,
 	)
 
+	ctx, span := tracing.Start(ctx, "chatbot.process")
+	defer span.End()
+
 	// Find the WhatsApp account by phone_number_id (use cache)
 	account, err := a.getWhatsAppAccountCached(phoneNumberID)
 	if err != nil {
-		a.Log.Error("WhatsApp account not found", "phone_id", phoneNumberID, "error", err)
-		return
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to find WhatsApp account: %w", err)
+		}
+		a.log(ctx).Error("WhatsApp account not found", "phone_id", phoneNumberID, "error", err)
+		return nil
 	}
 
+	// A contact's messages are processed one at a time, across instances, so they
+	// don't race on the contact's chatbot session
+	unlock := a.lockContact(ctx, phoneNumberID, msg.From)
+	defer unlock()
+
 	// Handle reaction messages specially - they update existing messages, not create new ones
 	if msg.Type == "reaction" && msg.Reaction != nil {
 		a.handleIncomingReaction(account, msg.From, msg.Reaction.MessageID, msg.Reaction.Emoji, profileName)
-		return
+		return nil
+	}
+
+	// Edits and deletions change a message already stored
+	if msg.Type == "edit" && msg.Edit != nil {
+		a.handleIncomingEdit(account, msg.Edit)
+		return nil
+	}
+	if msg.Type == "revoke" && msg.Revoke != nil {
+		a.handleIncomingRevoke(account, msg.Revoke)
+		return nil
 	}
 
 	// Get or create contact (always do this for all incoming messages)
@@ -134,10 +164,17 @@ func (a *App) processIncomingMessageFull(phoneNumberID string, msg IncomingTextM
 		})
 	}
 
+	// Messages from blocked contacts are dropped
+	if contact.IsBlocked(time.Now()) {
+		a.log(ctx).Info("Dropping message from blocked contact", "contact_id", contact.ID, "blocked_until", contact.BlockedUntil)
+		return nil
+	}
+
 	// Get message content - handle text, button replies, list replies, and media
 	messageText := ""
 	messageType := msg.Type
-	buttonID := "" // Track button/list ID for conditional routing
+	buttonID := ""  // Track button/list ID for conditional routing
+	replyType := "" // button, list or template_button for button replies
 	var mediaInfo *MediaInfo
 
 	// Track flow response data for WhatsApp Flow forms
@@ -151,12 +188,14 @@ func (a *App) processIncomingMessageFull(phoneNumberID string, msg IncomingTextM
 			messageText = msg.Interactive.ButtonReply.Title
 			buttonID = msg.Interactive.ButtonReply.ID
 			messageType = "button_reply"
+			replyType = "button"
 		}
 		// Handle list reply
 		if msg.Interactive.ListReply != nil {
 			messageText = msg.Interactive.ListReply.Title
 			buttonID = msg.Interactive.ListReply.ID
 			messageType = "button_reply"
+			replyType = "list"
 		}
 		// Handle WhatsApp Flow reply (nfm_reply)
 		if msg.Interactive.NFMReply != nil {
@@ -166,13 +205,19 @@ func (a *App) processIncomingMessageFull(phoneNumberID string, msg IncomingTextM
 			if msg.Interactive.NFMReply.ResponseJSON != "" {
 				var responseData map[string]interface{}
 				if err := json.Unmarshal([]byte(msg.Interactive.NFMReply.ResponseJSON), &responseData); err != nil {
-					a.Log.Error("Failed to parse flow response JSON", "error", err, "response_json", msg.Interactive.NFMReply.ResponseJSON)
+					a.log(ctx).Error("Failed to parse flow response JSON", "error", err, "response_json", msg.Interactive.NFMReply.ResponseJSON)
 				} else {
 					flowResponseData = responseData
-					a.Log.Info("Parsed WhatsApp Flow response", "data", flowResponseData)
+					a.log(ctx).Info("Parsed WhatsApp Flow response", "data", flowResponseData)
 				}
 			}
 		}
+	} else if msg.Type == "button" && msg.Button != nil {
+		// Handle template quick reply button
+		messageText = msg.Button.Text
+		buttonID = msg.Button.Payload
+		messageType = "button_reply"
+		replyType = "template_button"
 	} else if msg.Type == "image" && msg.Image != nil {
 		// Handle image message
 		messageText = msg.Image.Caption
@@ -180,9 +225,8 @@ func (a *App) processIncomingMessageFull(phoneNumberID string, msg IncomingTextM
 			MediaMimeType: msg.Image.MimeType,
 		}
 		// Download and save media locally
-		waAccount := a.toWhatsAppAccount(account)
-		if localPath, err := a.DownloadAndSaveMedia(context.Background(), msg.Image.ID, msg.Image.MimeType, waAccount); err != nil {
-			a.Log.Error("Failed to download image", "error", err, "media_id", msg.Image.ID)
+		if localPath, err := a.downloadIncomingMedia(ctx, account, msg.Image.ID, msg.Image.MimeType); err != nil {
+			a.log(ctx).Error("Failed to download image", "error", err, "media_id", msg.Image.ID)
 		} else {
 			mediaInfo.MediaURL = localPath
 		}
@@ -194,9 +238,8 @@ func (a *App) processIncomingMessageFull(phoneNumberID string, msg IncomingTextM
 			MediaFilename: msg.Document.Filename,
 		}
 		// Download and save media locally
-		waAccount := a.toWhatsAppAccount(account)
-		if localPath, err := a.DownloadAndSaveMedia(context.Background(), msg.Document.ID, msg.Document.MimeType, waAccount); err != nil {
-			a.Log.Error("Failed to download document", "error", err, "media_id", msg.Document.ID)
+		if localPath, err := a.downloadIncomingMedia(ctx, account, msg.Document.ID, msg.Document.MimeType); err != nil {
+			a.log(ctx).Error("Failed to download document", "error", err, "media_id", msg.Document.ID)
 		} else {
 			mediaInfo.MediaURL = localPath
 		}
@@ -207,9 +250,8 @@ func (a *App) processIncomingMessageFull(phoneNumberID string, msg IncomingTextM
 			MediaMimeType: msg.Video.MimeType,
 		}
 		// Download and save media locally
-		waAccount := a.toWhatsAppAccount(account)
-		if localPath, err := a.DownloadAndSaveMedia(context.Background(), msg.Video.ID, msg.Video.MimeType, waAccount); err != nil {
-			a.Log.Error("Failed to download video", "error", err, "media_id", msg.Video.ID)
+		if localPath, err := a.downloadIncomingMedia(ctx, account, msg.Video.ID, msg.Video.MimeType); err != nil {
+			a.log(ctx).Error("Failed to download video", "error", err, "media_id", msg.Video.ID)
 		} else {
 			mediaInfo.MediaURL = localPath
 		}
@@ -219,9 +261,8 @@ func (a *App) processIncomingMessageFull(phoneNumberID string, msg IncomingTextM
 			MediaMimeType: msg.Audio.MimeType,
 		}
 		// Download and save media locally
-		waAccount := a.toWhatsAppAccount(account)
-		if localPath, err := a.DownloadAndSaveMedia(context.Background(), msg.Audio.ID, msg.Audio.MimeType, waAccount); err != nil {
-			a.Log.Error("Failed to download audio", "error", err, "media_id", msg.Audio.ID)
+		if localPath, err := a.downloadIncomingMedia(ctx, account, msg.Audio.ID, msg.Audio.MimeType); err != nil {
+			a.log(ctx).Error("Failed to download audio", "error", err, "media_id", msg.Audio.ID)
 		} else {
 			mediaInfo.MediaURL = localPath
 		}
@@ -231,222 +272,376 @@ func (a *App) processIncomingMessageFull(phoneNumberID string, msg IncomingTextM
 			MediaMimeType: msg.Sticker.MimeType,
 		}
 		// Download and save media locally
-		waAccount := a.toWhatsAppAccount(account)
-		if localPath, err := a.DownloadAndSaveMedia(context.Background(), msg.Sticker.ID, msg.Sticker.MimeType, waAccount); err != nil {
-			a.Log.Error("Failed to download sticker", "error", err, "media_id", msg.Sticker.ID)
+		if localPath, err := a.downloadIncomingMedia(ctx, account, msg.Sticker.ID, msg.Sticker.MimeType); err != nil {
+			a.log(ctx).Error("Failed to download sticker", "error", err, "media_id", msg.Sticker.ID)
 		} else {
 			mediaInfo.MediaURL = localPath
 		}
 	} else if msg.Type == "location" && msg.Location != nil {
-		// Handle location message - store as JSON in content
-		locationData := map[string]any{
-			"latitude":  msg.Location.Latitude,
-			"longitude": msg.Location.Longitude,
-		}
-		if msg.Location.Name != "" {
-			locationData["name"] = msg.Location.Name
-		}
-		if msg.Location.Address != "" {
-			locationData["address"] = msg.Location.Address
-		}
-		if jsonBytes, err := json.Marshal(locationData); err == nil {
-			messageText = string(jsonBytes)
-		}
+		// Handle location message - store as JSON in content, the coordinates also go on the message
+		messageText = locationContent(whatsapp.Location{
+			Latitude:  msg.Location.Latitude,
+			Longitude: msg.Location.Longitude,
+			Name:      msg.Location.Name,
+			Address:   msg.Location.Address,
+		})
+	} else if msg.Type == "order" && msg.Order != nil {
+		// Handle order message - the cart is stored as an order once the message is saved
+		messageText = orderContent(msg.Order)
 	} else if msg.Type == "contacts" && len(msg.Contacts) > 0 {
-		// Handle contacts message - store as JSON in content
-		contactsData := make([]map[string]any, 0, len(msg.Contacts))
-		for _, c := range msg.Contacts {
-			contact := map[string]any{
-				"name": c.Name.FormattedName,
-			}
-			if len(c.Phones) > 0 {
-				phones := make([]string, 0, len(c.Phones))
-				for _, p := range c.Phones {
-					phones = append(phones, p.Phone)
-				}
-				contact["phones"] = phones
-			}
-			contactsData = append(contactsData, contact)
-		}
-		if jsonBytes, err := json.Marshal(contactsData); err == nil {
-			messageText = string(jsonBytes)
-		}
+		// Handle contacts message - the shared contacts are saved as contacts and linked from the content
+		messageText = contactCardsContent(msg.Contacts, a.saveSharedContacts(account, contact, msg.Contacts))
 	}
 
+	// Message hooks can rewrite or enrich the message, or stop the chatbot answering it
+	hooked := newHookMessage(models.MessageHookStageInbound, account, contact, messageType, messageText)
+	hooked.MessageID = msg.ID
+	stoppedByHook := a.runMessageHooks(ctx, account.OrganizationID, hooked)
+	messageText = hooked.Content
+
 	// Save incoming message to messages table (always, even if chatbot is disabled)
 	var replyToWAMID string
 	if msg.Context != nil && msg.Context.ID != "" {
 		replyToWAMID = msg.Context.ID
 	}
-	a.saveIncomingMessage(account, contact, msg.ID, messageType, messageText, mediaInfo, replyToWAMID)
+	message := a.saveIncomingMessage(account, contact, msg.ID, messageType, messageText, mediaInfo, replyToWAMID)
+	if message == nil {
+		return errIncomingMessageNotSaved
+	}
+
+	// Button taps and list selections also trigger their own event, with the message they answer
+	if messageType == "button_reply" {
+		a.dispatchButtonReply(account, contact, message, replyType, buttonID, messageText)
+	}
+
+	// Carts sent from a catalog become orders
+	if messageType == "order" && msg.Order != nil {
+		a.saveIncomingOrder(account, contact, message, msg.ID, msg.Order)
+	}
+
+	// Keep what hooks added to the message
+	if len(hooked.Metadata) > 0 {
+		metadata := message.Metadata
+		if metadata == nil {
+			metadata = models.JSONB{}
+		}
+		metadata["hooks"] = hooked.Metadata
+		message.Metadata = metadata
+		if err := a.DB.Model(message).Update("metadata", metadata).Error; err != nil {
+			a.log(ctx).Error("Failed to store hook metadata on message", "error", err, "message_id", msg.ID)
+		}
+	}
+
+	// Keep a flow's reply on its message, so replies to flows sent by campaigns aren't lost
+	if flowResponseData != nil {
+		metadata := message.Metadata
+		if metadata == nil {
+			metadata = models.JSONB{}
+		}
+		metadata["flow_response"] = flowResponseData
+		if err := a.DB.Model(message).Update("metadata", metadata).Error; err != nil {
+			a.log(ctx).Error("Failed to store flow response on message", "error", err, "message_id", msg.ID)
+		}
+	}
+
+	// Attribute the contact to the tracking link they came from, if the message says
+	if messageType == "text" {
+		a.attributeTrackingLink(account, contact, isNewContact, messageText)
+	}
+
+	// Record the click-to-WhatsApp ad the conversation came from
+	if msg.Referral != nil {
+		a.recordAdReferral(account, contact, isNewContact, msg.ID, msg.Referral)
+	}
 
 	// Clear chatbot tracking since client has replied
 	a.ClearContactChatbotTracking(contact.ID)
 
+	// Mark the message read once the chatbot has answered it, whichever way it did
+	defer a.markReadAfterChatbotReply(account, contact.ID, msg.ID)
+
+	if stoppedByHook {
+		a.log(ctx).Info("Message stopped by a message hook", "contact_id", contact.ID, "message_id", msg.ID)
+		return nil
+	}
+
+	// Cancel/reschedule buttons on appointment reminders are handled without the chatbot
+	if messageType == "button_reply" && replyToWAMID != "" &&
+		a.handleAppointmentReply(account, contact, replyToWAMID, buttonID, messageText) {
+		return nil
+	}
+
+	// Answers to satisfaction surveys are recorded without the chatbot
+	if a.handleCSATReply(ctx, account, contact, messageType, buttonID, messageText) {
+		return nil
+	}
+
+	// Contacts flooding the conversation or sending abusive messages get no answer
+	// while the chatbot is paused for them or they are blocked
+	if a.checkContactAbuse(ctx, account, contact, messageText) {
+		return nil
+	}
+
 	// Check for active agent transfer - skip chatbot processing if transferred
 	if a.hasActiveAgentTransfer(account.OrganizationID, contact.ID) {
-		a.Log.Info("Contact has active agent transfer, skipping chatbot processing",
+		a.log(ctx).Info("Contact has active agent transfer, skipping chatbot processing",
 			"contact_id", contact.ID,
 			"phone_number", contact.PhoneNumber)
-		return
+		return nil
 	}
 
 	// Check if chatbot is enabled for this account (use cache)
 	settings, err := a.getChatbotSettingsCached(account.OrganizationID, account.Name)
 	if err != nil {
-		a.Log.Error("Failed to load chatbot settings", "error", err, "account", account.Name, "org_id", account.OrganizationID)
-		return
+		a.log(ctx).Error("Failed to load chatbot settings", "error", err, "account", account.Name, "org_id", account.OrganizationID)
+		return nil
+	}
+	if messageType == "text" {
+		a.updateContactLanguage(settings, contact, messageText)
 	}
 	if !settings.IsEnabled {
-		a.Log.Debug("Chatbot not enabled for this account, creating transfer for agent queue", "account", account.Name, "settings_id", settings.ID)
+		a.log(ctx).Debug("Chatbot not enabled for this account, creating transfer for agent queue", "account", account.Name, "settings_id", settings.ID)
+		// Let the contact know nobody is around before queueing the conversation
+		if a.isOutsideBusinessHours(settings) {
+			a.sendOutOfHoursMessage(ctx, account, contact, settings)
+		}
 		// Create transfer to agent queue when chatbot is disabled
 		a.createTransferToQueue(account, contact, models.TransferSourceChatbotDisabled)
-		return
+		return nil
+	}
+	a.log(ctx).Info("Chatbot settings loaded", "settings_id", settings.ID, "is_enabled", settings.IsEnabled, "ai_enabled", settings.AI.Enabled, "ai_provider", settings.AI.Provider, "default_response", settings.DefaultResponse)
+
+	// Voice notes go through keyword rules, flows and AI as their transcript
+	if messageType == "audio" && settings.Transcription.Enabled {
+		messageText = a.transcribeVoiceNote(settings, message)
 	}
-	a.Log.Info("Chatbot settings loaded", "settings_id", settings.ID, "is_enabled", settings.IsEnabled, "ai_enabled", settings.AI.Enabled, "ai_provider", settings.AI.Provider, "default_response", settings.DefaultResponse)
 
 	// Check business hours if enabled
-	if settings.BusinessHours.Enabled && len(settings.BusinessHours.Hours) > 0 {
-		if !a.isWithinBusinessHours(settings.BusinessHours.Hours) {
-			// If automated responses are not allowed outside hours, send out-of-hours message and stop
-			if !settings.BusinessHours.AllowAutomatedOutside {
-				a.Log.Info("Outside business hours, sending out of hours message")
-				if settings.BusinessHours.OutOfHoursMessage != "" {
-					if err := a.sendAndSaveTextMessage(account, contact, settings.BusinessHours.OutOfHoursMessage); err != nil {
-						a.Log.Error("Failed to send out of hours message", "error", err, "contact", contact.PhoneNumber)
-					}
-				}
-				return
-			}
-			// AllowAutomatedOutsideHours is true, continue processing flows/keywords/AI
-			a.Log.Info("Outside business hours but automated responses allowed, continuing")
+	if a.isOutsideBusinessHours(settings) {
+		// If automated responses are not allowed outside hours, run the away flow/message and stop
+		if !settings.BusinessHours.AllowAutomatedOutside {
+			a.log(ctx).Info("Outside business hours, handling away response")
+			a.handleOutOfHours(ctx, account, contact, settings, messageText, buttonID, flowResponseData)
+			return nil
 		}
+		// AllowAutomatedOutsideHours is true, continue processing flows/keywords/AI
+		a.log(ctx).Info("Outside business hours but automated responses allowed, continuing")
 	}
 
 	// Only process text and interactive messages for chatbot
 	if messageText == "" {
-		a.Log.Debug("Skipping message with no text content for chatbot", "type", msg.Type)
-		return
+		a.log(ctx).Debug("Skipping message with no text content for chatbot", "type", msg.Type)
+		return nil
 	}
 
-	a.Log.Info("Processing message", "text", messageText, "buttonID", buttonID, "from", msg.From)
+	a.log(ctx).Info("Processing message", "text", messageText, "buttonID", buttonID, "from", msg.From)
 
 	// Get or create active session for this contact
 	session, isNewSession := a.getOrCreateSession(account.OrganizationID, contact.ID, account.Name, msg.From, settings.SessionTimeoutMins)
+	if isNewSession {
+		a.assignAIVariant(settings, session)
+	}
+	a.updateSessionLanguage(settings, session, contact)
+	lang := conversationLanguage(settings, session, contact)
+
+	// Log incoming message to session, scored when sentiment escalation is on
+	sentiment := a.messageSentiment(ctx, settings, session, messageType, messageText)
+	a.logScoredSessionMessage(session.ID, messageText, "keyword_check", sentiment)
+	if sentiment != nil && a.checkSentimentEscalation(ctx, account, contact, session, settings) {
+		return nil
+	}
 
-	// Log incoming message to session
-	a.logSessionMessage(session.ID, models.DirectionIncoming, messageText, "keyword_check")
+	// Quick replies on AI answers are triggers, not text for keywords or the AI
+	if buttonID != "" && a.handleAIQuickReply(ctx, account, contact, session, settings, buttonID) {
+		a.logSessionMessage(session.ID, models.DirectionIncoming, messageText, "ai_quick_reply")
+		return nil
+	}
 
-	// Check for transfer keyword BEFORE sending greeting (transfer takes priority)
-	keywordResponse, keywordMatched := a.matchKeywordRules(account.OrganizationID, account.Name, messageText)
+	// Check for transfer keyword BEFORE sending greeting (transfer takes priority).
+	// Button and list replies match on the option ID first, then on the title.
+	var keywordResponse *KeywordResponse
+	keywordMatched := false
+	if buttonID != "" {
+		keywordResponse, keywordMatched = a.matchReplyKeywordRule(account.OrganizationID, account.Name, buttonID)
+	}
+	if !keywordMatched {
+		keywordResponse, keywordMatched = a.matchKeywordRules(account.OrganizationID, account.Name, messageText)
+	}
+	// Tag rules only answer when they have a message, otherwise the message goes on to flows and the AI
+	if keywordMatched && keywordResponse.ResponseType == models.ResponseTypeTag {
+		a.tagContactFromKeyword(contact, keywordResponse.Tag)
+		keywordMatched = keywordResponse.Body != ""
+	}
 	if keywordMatched && keywordResponse.ResponseType == models.ResponseTypeTransfer {
-		a.Log.Info("Transfer keyword matched", "response", keywordResponse.Body)
+		a.log(ctx).Info("Transfer keyword matched", "response", keywordResponse.Body)
 		// Check business hours - if outside hours, send out of hours message instead
-		if settings.BusinessHours.Enabled && len(settings.BusinessHours.Hours) > 0 {
-			if !a.isWithinBusinessHours(settings.BusinessHours.Hours) {
-				a.Log.Info("Outside business hours, sending out of hours message instead of transfer")
-				if settings.BusinessHours.OutOfHoursMessage != "" {
-					if err := a.sendAndSaveTextMessage(account, contact, settings.BusinessHours.OutOfHoursMessage); err != nil {
-						a.Log.Error("Failed to send out of hours message", "error", err, "contact", contact.PhoneNumber)
-					}
-				}
-				return
-			}
+		if a.isOutsideBusinessHours(settings) {
+			a.log(ctx).Info("Outside business hours, sending out of hours message instead of transfer")
+			a.sendOutOfHoursMessage(ctx, account, contact, settings)
+			a.queueForBusinessHours(account, contact, settings)
+			return nil
 		}
 		// Within business hours - send transfer message and create transfer
 		if keywordResponse.Body != "" {
-			if err := a.sendAndSaveTextMessage(account, contact, keywordResponse.Body); err != nil {
-				a.Log.Error("Failed to send transfer message", "error", err, "contact", contact.PhoneNumber)
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, keywordResponse.Body); err != nil {
+				a.log(ctx).Error("Failed to send transfer message", "error", err, "contact", contact.PhoneNumber)
 			}
 		}
-		a.createTransferFromKeyword(account, contact)
-		return
+		a.createTransferFromKeyword(ctx, account, contact)
+		return nil
+	}
+
+	// Conversations from ads go to the ads flow, even when the contact was in another flow
+	if msg.Referral != nil && a.startAdsFlow(ctx, account, session, contact, settings) {
+		return nil
 	}
 
 	// Check if user is in an active flow
 	if session.CurrentFlowID != nil {
-		a.processFlowResponse(account, session, contact, messageText, buttonID, flowResponseData)
-		return
+		a.processFlowResponse(ctx, account, session, contact, messageText, buttonID, flowResponseData)
+		return nil
 	}
 
 	// Try to match flow trigger keywords first (before greeting to avoid duplicate messages)
-	if flow := a.matchFlowTrigger(account.OrganizationID, account.Name, messageText); flow != nil {
-		a.startFlow(account, session, contact, flow)
-		return
+	var flow *models.ChatbotFlow
+	if buttonID != "" {
+		flow = a.matchReplyFlowTrigger(account.OrganizationID, account.Name, buttonID, lang)
+	}
+	if flow == nil {
+		flow = a.matchFlowTrigger(account.OrganizationID, account.Name, messageText, lang)
+	}
+	if flow != nil {
+		a.startFlow(ctx, account, session, contact, flow)
+		return nil
 	}
 
 	// Send greeting message for new sessions (only if no flow was triggered)
 	if isNewSession && settings.DefaultResponse != "" {
-		a.Log.Info("New session - sending greeting message", "contact", contact.PhoneNumber)
-		if len(settings.GreetingButtons) > 0 {
-			greetingButtons := make([]map[string]interface{}, 0)
-			for _, btn := range settings.GreetingButtons {
-				if btnMap, ok := btn.(map[string]interface{}); ok {
-					greetingButtons = append(greetingButtons, btnMap)
-				}
-			}
-			if len(greetingButtons) > 0 {
-				if err := a.sendAndSaveInteractiveButtons(account, contact, settings.DefaultResponse, greetingButtons); err != nil {
-					a.Log.Error("Failed to send greeting buttons", "error", err, "contact", contact.PhoneNumber)
-				}
-			} else {
-				if err := a.sendAndSaveTextMessage(account, contact, settings.DefaultResponse); err != nil {
-					a.Log.Error("Failed to send greeting message", "error", err, "contact", contact.PhoneNumber)
-				}
-			}
-		} else {
-			if err := a.sendAndSaveTextMessage(account, contact, settings.DefaultResponse); err != nil {
-				a.Log.Error("Failed to send greeting message", "error", err, "contact", contact.PhoneNumber)
-			}
-		}
-		a.logSessionMessage(session.ID, models.DirectionOutgoing, settings.DefaultResponse, "greeting")
-		return // After greeting, don't process further for new sessions
+		a.log(ctx).Info("New session - sending greeting message", "contact", contact.PhoneNumber)
+		a.sendGreeting(ctx, account, contact, session, settings)
+		return nil // After greeting, don't process further for new sessions
 	}
 
 	// Handle non-transfer keyword matches (transfer was already handled above)
 	if keywordMatched && keywordResponse.ResponseType != models.ResponseTypeTransfer {
-		a.Log.Info("Keyword rule matched", "response_type", keywordResponse.ResponseType, "response", keywordResponse.Body)
+		a.log(ctx).Info("Keyword rule matched", "response_type", keywordResponse.ResponseType, "response", keywordResponse.Body)
+
+		if keywordResponse.ResponseType == models.ResponseTypeTemplate {
+			if err := a.sendKeywordTemplate(account, contact, keywordResponse); err != nil {
+				a.log(ctx).Error("Failed to send keyword template", "error", err, "template_id", keywordResponse.TemplateID, "contact", contact.PhoneNumber)
+				return nil
+			}
+			a.logSessionMessage(session.ID, models.DirectionOutgoing, "[template]", "keyword_response")
+			return nil
+		}
 
 		// Handle regular text response
-		if len(keywordResponse.Buttons) > 0 {
-			if err := a.sendAndSaveInteractiveButtons(account, contact, keywordResponse.Body, keywordResponse.Buttons); err != nil {
-				a.Log.Error("Failed to send interactive buttons", "error", err, "contact", contact.PhoneNumber)
+		if keywordResponse.List != nil {
+			if err := a.sendAndSaveListMessage(ctx, account, contact, *keywordResponse.List); err != nil {
+				a.log(ctx).Error("Failed to send list message", "error", err, "contact", contact.PhoneNumber)
+			}
+		} else if len(keywordResponse.Buttons) > 0 {
+			if err := a.sendAndSaveInteractiveButtons(ctx, account, contact, keywordResponse.Body, keywordResponse.Buttons); err != nil {
+				a.log(ctx).Error("Failed to send interactive buttons", "error", err, "contact", contact.PhoneNumber)
 			}
 		} else {
-			if err := a.sendAndSaveTextMessage(account, contact, keywordResponse.Body); err != nil {
-				a.Log.Error("Failed to send text message", "error", err, "contact", contact.PhoneNumber)
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, keywordResponse.Body); err != nil {
+				a.log(ctx).Error("Failed to send text message", "error", err, "contact", contact.PhoneNumber)
 			}
 		}
 		// Log outgoing message
 		a.logSessionMessage(session.ID, models.DirectionOutgoing, keywordResponse.Body, "keyword_response")
-		return
+		return nil
 	}
 
 	// If no keyword matched, try AI response if enabled
-	if settings.AI.Enabled && settings.AI.Provider != "" && settings.AI.APIKey != "" {
-		a.Log.Info("Attempting AI response", "provider", settings.AI.Provider, "model", settings.AI.Model)
-		aiResponse, err := a.generateAIResponse(settings, session, messageText)
-		if err != nil {
-			a.Log.Error("AI response failed", "error", err, "provider", settings.AI.Provider, "model", settings.AI.Model)
+	if contact.AIDisabled {
+		a.log(ctx).Info("AI disabled for this conversation", "contact_id", contact.ID)
+	} else if settings.AI.Enabled && len(aiProviderChain(settings)) > 0 {
+		a.log(ctx).Info("Attempting AI response", "provider", settings.AI.Provider, "model", settings.AI.Model)
+		stopTyping := func() {}
+		if account.TypingIndicator {
+			stopTyping = a.keepTyping(account, msg.ID)
+		}
+		// Bot buttons send their payload to the bot, not their title. Other replies
+		// tell the AI which option was chosen; webhooks get the title as {{message}}.
+		aiMessage := messageText
+		if strings.HasPrefix(buttonID, aiBotButtonPrefix) {
+			aiMessage = strings.TrimPrefix(buttonID, aiBotButtonPrefix)
+		} else if buttonID != "" && settings.AI.Provider != models.AIProviderWebhook {
+			aiMessage = interactiveReplyPrompt(replyType, buttonID, messageText)
+		}
+		// Answers of providers that stream are sent in parts as they're generated
+		aiCtx := ctx
+		stream := a.newAIStream(account, contact, settings)
+		if stream != nil {
+			aiCtx = withAIStream(ctx, stream)
+		}
+		completion, err := a.generateAIResponse(aiCtx, settings, session, contact, aiMessage)
+		stopTyping()
+		if errors.Is(err, errAITokenQuotaExceeded) && settings.AI.QuotaMessage != "" {
+			a.log(ctx).Warn("AI token quota exceeded", "organization_id", settings.OrganizationID, "limit", settings.AI.MonthlyTokenLimit)
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, settings.AI.QuotaMessage); err != nil {
+				a.log(ctx).Error("Failed to send AI quota message", "error", err, "contact", contact.PhoneNumber)
+			}
+			return nil
+		} else if errors.Is(err, errAIStreamInterrupted) {
+			// The customer has the start of the answer, a fallback message would follow it
+			a.log(ctx).Error("AI response stream failed", "error", err, "provider", settings.AI.Provider, "model", settings.AI.Model)
+			return nil
+		} else if err != nil {
+			a.log(ctx).Error("AI response failed", "error", err, "provider", settings.AI.Provider, "model", settings.AI.Model)
 			// Fall through to default response
-		} else if aiResponse != "" {
-			a.Log.Info("AI response generated successfully", "response_length", len(aiResponse))
-			if err := a.sendAndSaveTextMessage(account, contact, aiResponse); err != nil {
-				a.Log.Error("Failed to send AI response", "error", err, "contact", contact.PhoneNumber)
+		} else if a.messageRetracted("whats_app_message_id = ?", msg.ID) {
+			// The contact edited or deleted the message while the response was generated
+			a.log(ctx).Info("Discarding AI response to a retracted message", "message_id", msg.ID)
+			return nil
+		} else if reason := a.moderateAIResponse(ctx, settings, completion.Text); reason != "" {
+			a.log(ctx).Warn("AI response blocked by moderation", "reason", reason, "contact", contact.PhoneNumber)
+			a.logModeratedResponse(settings, session, contact, messageText, completion, reason)
+			if settings.AI.ModerationMessage != "" {
+				if err := a.sendAndSaveTextMessage(ctx, account, contact, settings.AI.ModerationMessage); err != nil {
+					a.log(ctx).Error("Failed to send AI moderation message", "error", err, "contact", contact.PhoneNumber)
+				}
+				a.logSessionMessage(session.ID, models.DirectionOutgoing, settings.AI.ModerationMessage, "moderated_response")
+				return nil
 			}
-			a.logSessionMessage(session.ID, models.DirectionOutgoing, aiResponse, "ai_response")
-			return
+			// Fall through to default response
+		} else if completion.Text != "" || completion.Handoff {
+			if completion.Text != "" {
+				a.log(ctx).Info("AI response generated successfully", "response_length", len(completion.Text), "provider", completion.Provider,
+					"prompt_tokens", completion.PromptTokens, "completion_tokens", completion.CompletionTokens, "cached", completion.Cached)
+				if completion.Streamed {
+					err = stream.finish(ctx)
+				} else if len(completion.Messages) > 0 {
+					err = a.sendAIBotMessages(ctx, account, contact, session, settings, completion.Messages)
+				} else {
+					err = a.sendAIResponse(ctx, account, contact, settings, completion.Text)
+				}
+				if err != nil {
+					a.log(ctx).Error("Failed to send AI response", "error", err, "contact", contact.PhoneNumber)
+				} else {
+					a.cacheAIResponse(settings, completion)
+				}
+				a.logAIResponse(session.ID, completion.Text, completion.Provider)
+			}
+			if completion.Handoff {
+				a.log(ctx).Info("AI handed off to an agent", "contact", contact.PhoneNumber)
+				a.createTransferFromBot(ctx, account, contact, models.TransferSourceAI)
+			}
+			return nil
 		} else {
-			a.Log.Warn("AI returned empty response")
+			a.log(ctx).Warn("AI returned empty response")
 		}
 	} else {
-		a.Log.Info("AI not configured", "ai_enabled", settings.AI.Enabled, "has_provider", settings.AI.Provider != "", "has_api_key", settings.AI.APIKey != "")
+		a.log(ctx).Info("AI not configured", "ai_enabled", settings.AI.Enabled, "has_provider", settings.AI.Provider != "", "has_api_key", settings.AI.APIKey != "")
 	}
 
 	// If no AI response or AI not enabled, send fallback message (for existing sessions)
 	// Greeting is already sent for new sessions above
 	if settings.FallbackMessage != "" && !isNewSession {
-		a.Log.Info("Sending fallback message", "response", settings.FallbackMessage)
+		fallbackMessage := localizedMessage(settings, lang, translationFallback, settings.FallbackMessage)
+		a.log(ctx).Info("Sending fallback message", "response", fallbackMessage)
 		if len(settings.FallbackButtons) > 0 {
 			fallbackButtons := make([]map[string]interface{}, 0)
 			for _, btn := range settings.FallbackButtons {
@@ -455,30 +650,68 @@ func (a *App) processIncomingMessageFull(phoneNumberID string, msg IncomingTextM
 				}
 			}
 			if len(fallbackButtons) > 0 {
-				if err := a.sendAndSaveInteractiveButtons(account, contact, settings.FallbackMessage, fallbackButtons); err != nil {
-					a.Log.Error("Failed to send fallback buttons", "error", err, "contact", contact.PhoneNumber)
+				if err := a.sendAndSaveInteractiveButtons(ctx, account, contact, fallbackMessage, fallbackButtons); err != nil {
+					a.log(ctx).Error("Failed to send fallback buttons", "error", err, "contact", contact.PhoneNumber)
 				}
 			} else {
-				if err := a.sendAndSaveTextMessage(account, contact, settings.FallbackMessage); err != nil {
-					a.Log.Error("Failed to send fallback message", "error", err, "contact", contact.PhoneNumber)
+				if err := a.sendAndSaveTextMessage(ctx, account, contact, fallbackMessage); err != nil {
+					a.log(ctx).Error("Failed to send fallback message", "error", err, "contact", contact.PhoneNumber)
 				}
 			}
 		} else {
-			if err := a.sendAndSaveTextMessage(account, contact, settings.FallbackMessage); err != nil {
-				a.Log.Error("Failed to send fallback message", "error", err, "contact", contact.PhoneNumber)
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, fallbackMessage); err != nil {
+				a.log(ctx).Error("Failed to send fallback message", "error", err, "contact", contact.PhoneNumber)
 			}
 		}
-		a.logSessionMessage(session.ID, models.DirectionOutgoing, settings.FallbackMessage, "fallback_response")
+		a.logSessionMessage(session.ID, models.DirectionOutgoing, fallbackMessage, "fallback_response")
+
+		// Contacts the bot keeps failing get an agent
+		if n := settings.AgentAssignment.HandoffAfterFallbacks; n > 0 && a.fallbacksInARow(session.ID, n) {
+			a.log(ctx).Info("Handing off after repeated fallbacks", "contact", contact.PhoneNumber, "fallbacks", n)
+			a.createTransferFromBot(ctx, account, contact, models.TransferSourceFallback)
+		}
 	} else if !isNewSession {
-		a.Log.Info("No fallback message configured for existing session")
+		a.log(ctx).Info("No fallback message configured for existing session")
+	}
+	return nil
+}
+
+// sendGreeting sends the greeting message, with its buttons if configured
+func (a *App) sendGreeting(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, session *models.ChatbotSession, settings *models.ChatbotSettings) {
+	greeting := localizedMessage(settings, conversationLanguage(settings, session, contact), translationGreeting, settings.DefaultResponse)
+	if len(settings.GreetingButtons) > 0 {
+		greetingButtons := make([]map[string]interface{}, 0)
+		for _, btn := range settings.GreetingButtons {
+			if btnMap, ok := btn.(map[string]interface{}); ok {
+				greetingButtons = append(greetingButtons, btnMap)
+			}
+		}
+		if len(greetingButtons) > 0 {
+			if err := a.sendAndSaveInteractiveButtons(ctx, account, contact, greeting, greetingButtons); err != nil {
+				a.log(ctx).Error("Failed to send greeting buttons", "error", err, "contact", contact.PhoneNumber)
+			}
+		} else {
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, greeting); err != nil {
+				a.log(ctx).Error("Failed to send greeting message", "error", err, "contact", contact.PhoneNumber)
+			}
+		}
+	} else {
+		if err := a.sendAndSaveTextMessage(ctx, account, contact, greeting); err != nil {
+			a.log(ctx).Error("Failed to send greeting message", "error", err, "contact", contact.PhoneNumber)
+		}
 	}
+	a.logSessionMessage(session.ID, models.DirectionOutgoing, greeting, "greeting")
 }
 
 // KeywordResponse holds the response content and optional buttons
 type KeywordResponse struct {
-	Body         string
-	Buttons      []map[string]interface{}
-	ResponseType models.ResponseType // text, transfer
+	Body           string
+	Buttons        []map[string]interface{}
+	ResponseType   models.ResponseType // text, template, tag, transfer
+	TemplateID     string
+	TemplateParams map[string]string
+	Tag            string
+	List           *whatsapp.ListMessage
 }
 
 // matchKeywordRules checks if the message matches any keyword rules
@@ -527,34 +760,7 @@ func (a *App) matchKeywordRules(orgID uuid.UUID, accountName, messageText string
 			}
 
 			if matched {
-				response := &KeywordResponse{
-					ResponseType: rule.ResponseType,
-				}
-
-				// For transfer type, use body as the transfer message
-				if rule.ResponseType == models.ResponseTypeTransfer {
-					if body, ok := rule.ResponseContent["body"].(string); ok {
-						response.Body = body
-					}
-					return response, true
-				}
-
-				// Get response body
-				if body, ok := rule.ResponseContent["body"].(string); ok {
-					response.Body = body
-				}
-
-				// Get buttons if present
-				if buttons, ok := rule.ResponseContent["buttons"].([]interface{}); ok && len(buttons) > 0 {
-					response.Buttons = make([]map[string]interface{}, 0, len(buttons))
-					for _, btn := range buttons {
-						if btnMap, ok := btn.(map[string]interface{}); ok {
-							response.Buttons = append(response.Buttons, btnMap)
-						}
-					}
-				}
-
-				if response.Body != "" {
+				if response := keywordRuleResponse(&rule); response != nil {
 					return response, true
 				}
 			}
@@ -566,8 +772,7 @@ func (a *App) matchKeywordRules(orgID uuid.UUID, accountName, messageText string
 
 // sendAndSaveTextMessage sends a text message and saves it to the database
 // Uses the unified SendOutgoingMessage for consistent behavior
-func (a *App) sendAndSaveTextMessage(account *models.WhatsAppAccount, contact *models.Contact, message string) error {
-	ctx := context.Background()
+func (a *App) sendAndSaveTextMessage(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, message string) error {
 	_, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
 		Account: account,
 		Contact: contact,
@@ -579,7 +784,7 @@ func (a *App) sendAndSaveTextMessage(account *models.WhatsAppAccount, contact *m
 
 // sendAndSaveInteractiveButtons sends an interactive button message and saves it to the database
 // Uses the unified SendOutgoingMessage for consistent behavior
-func (a *App) sendAndSaveInteractiveButtons(account *models.WhatsAppAccount, contact *models.Contact, bodyText string, buttons []map[string]interface{}) error {
+func (a *App) sendAndSaveInteractiveButtons(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, bodyText string, buttons []map[string]interface{}) error {
 	// Convert buttons to whatsapp.Button format
 	waButtons := make([]whatsapp.Button, 0, len(buttons))
 	for i, btn := range buttons {
@@ -602,7 +807,7 @@ func (a *App) sendAndSaveInteractiveButtons(account *models.WhatsAppAccount, con
 
 	// Fall back to text if no buttons
 	if len(waButtons) == 0 {
-		return a.sendAndSaveTextMessage(account, contact, bodyText)
+		return a.sendAndSaveTextMessage(ctx, account, contact, bodyText)
 	}
 
 	// Determine interactive type based on button count
@@ -611,7 +816,6 @@ func (a *App) sendAndSaveInteractiveButtons(account *models.WhatsAppAccount, con
 		interactiveType = "list"
 	}
 
-	ctx := context.Background()
 	_, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
 		Account:         account,
 		Contact:         contact,
@@ -625,8 +829,7 @@ func (a *App) sendAndSaveInteractiveButtons(account *models.WhatsAppAccount, con
 
 // sendAndSaveCTAURLButton sends a CTA URL button message and saves it to the database
 // Uses the unified SendOutgoingMessage for consistent behavior
-func (a *App) sendAndSaveCTAURLButton(account *models.WhatsAppAccount, contact *models.Contact, bodyText, buttonText, url string) error {
-	ctx := context.Background()
+func (a *App) sendAndSaveCTAURLButton(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, bodyText, buttonText, url string) error {
 	_, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
 		Account:         account,
 		Contact:         contact,
@@ -639,10 +842,23 @@ func (a *App) sendAndSaveCTAURLButton(account *models.WhatsAppAccount, contact *
 	return err
 }
 
+// sendAndSaveProductMessage sends a single product message and saves it to the database
+// Uses the unified SendOutgoingMessage for consistent behavior
+func (a *App) sendAndSaveProductMessage(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, bodyText string, product *models.CatalogProduct) error {
+	_, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account:         account,
+		Contact:         contact,
+		Type:            models.MessageTypeInteractive,
+		InteractiveType: "product",
+		BodyText:        bodyText,
+		Product:         product,
+	}, ChatbotSendOptions())
+	return err
+}
+
 // sendAndSaveFlowMessage sends a WhatsApp Flow message and saves it to the database
 // Uses the unified SendOutgoingMessage for consistent behavior
-func (a *App) sendAndSaveFlowMessage(account *models.WhatsAppAccount, contact *models.Contact, flowID, headerText, bodyText, ctaText, flowToken, firstScreen string) error {
-	ctx := context.Background()
+func (a *App) sendAndSaveFlowMessage(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, flowID, headerText, bodyText, ctaText, flowToken, firstScreen string) error {
 	_, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
 		Account:         account,
 		Contact:         contact,
@@ -670,12 +886,28 @@ func (a *App) getOrCreateContact(orgID uuid.UUID, phoneNumber, profileName strin
 		return &contact, false
 	}
 
+	// Contacts deleted by an agent come back when they message again, since the
+	// phone number is unique per organization
+	if err := a.DB.Unscoped().Where("organization_id = ? AND phone_number = ? AND deleted_at IS NOT NULL", orgID, phoneNumber).
+		First(&contact).Error; err == nil {
+		updates := map[string]interface{}{"deleted_at": nil}
+		if profileName != "" {
+			updates["profile_name"] = profileName
+		}
+		if err := a.DB.Unscoped().Model(&contact).Updates(updates).Error; err != nil {
+			a.Log.Error("Failed to restore contact", "error", err, "contact_id", contact.ID)
+		}
+		contact.DeletedAt.Valid = false
+		return &contact, true
+	}
+
 	// Create new contact
 	contact = models.Contact{
 		BaseModel:      models.BaseModel{ID: uuid.New()},
 		OrganizationID: orgID,
 		PhoneNumber:    phoneNumber,
 		ProfileName:    profileName,
+		Timezone:       models.TimezoneForPhoneNumber(phoneNumber),
 	}
 	if err := a.DB.Create(&contact).Error; err != nil {
 		a.Log.Error("Failed to create contact", "error", err)
@@ -711,12 +943,15 @@ func (a *App) getOrCreateSession(orgID, contactID uuid.UUID, accountName, phoneN
 		WhatsAppAccount: accountName,
 		PhoneNumber:     phoneNumber,
 		Status:          models.SessionStatusActive,
+		Mode:            models.SessionModeBot,
 		SessionData:     models.JSONB{},
 		StartedAt:       now,
 		LastActivityAt:  now,
 	}
 	if err := a.DB.Create(&session).Error; err != nil {
 		a.Log.Error("Failed to create session", "error", err)
+	} else {
+		a.broadcastSessionUpdate(orgID, contactID, session.ID, models.SessionModeBot)
 	}
 	return &session, true // new session
 }
@@ -736,7 +971,7 @@ func (a *App) logSessionMessage(sessionID uuid.UUID, direction models.Direction,
 }
 
 // matchFlowTrigger checks if the message triggers any flow
-func (a *App) matchFlowTrigger(orgID uuid.UUID, accountName, messageText string) *models.ChatbotFlow {
+func (a *App) matchFlowTrigger(orgID uuid.UUID, accountName, messageText, lang string) *models.ChatbotFlow {
 	// Use cached flows (includes steps)
 	flows, err := a.getChatbotFlowsCached(orgID)
 	if err != nil {
@@ -746,23 +981,62 @@ func (a *App) matchFlowTrigger(orgID uuid.UUID, accountName, messageText string)
 
 	messageLower := strings.ToLower(messageText)
 
-	for _, flow := range flows {
-		for _, keyword := range flow.TriggerKeywords {
+	var matched []*models.ChatbotFlow
+	for i := range flows {
+		for _, keyword := range flows[i].TriggerKeywords {
 			if strings.Contains(messageLower, strings.ToLower(keyword)) {
-				return &flow
+				matched = append(matched, &flows[i])
+				break
 			}
 		}
 	}
-	return nil
+	return flowForLanguage(flowsForAccount(matched, accountName), lang)
+}
+
+// flowsForAccount keeps the flows that serve a number. Flows for that number take
+// precedence over flows for every number.
+func flowsForAccount(flows []*models.ChatbotFlow, accountName string) []*models.ChatbotFlow {
+	var specific, shared []*models.ChatbotFlow
+	for _, flow := range flows {
+		switch flow.WhatsAppAccount {
+		case accountName:
+			specific = append(specific, flow)
+		case "":
+			shared = append(shared, flow)
+		}
+	}
+	if len(specific) > 0 {
+		return specific
+	}
+	return shared
+}
+
+// flowForLanguage picks the variant of a flow for the conversation language: a
+// flow in that language, then one for every language, then the first match
+func flowForLanguage(flows []*models.ChatbotFlow, lang string) *models.ChatbotFlow {
+	if len(flows) == 0 {
+		return nil
+	}
+	for _, flow := range flows {
+		if lang != "" && flow.Language == lang {
+			return flow
+		}
+	}
+	for _, flow := range flows {
+		if flow.Language == "" {
+			return flow
+		}
+	}
+	return flows[0]
 }
 
 // startFlow initiates a chatbot flow for a user
-func (a *App) startFlow(account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, flow *models.ChatbotFlow) {
-	a.Log.Info("Starting flow", "flow_id", flow.ID, "flow_name", flow.Name, "contact", contact.PhoneNumber, "num_steps", len(flow.Steps))
+func (a *App) startFlow(ctx context.Context, account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, flow *models.ChatbotFlow) {
+	a.log(ctx).Info("Starting flow", "flow_id", flow.ID, "flow_name", flow.Name, "contact", contact.PhoneNumber, "num_steps", len(flow.Steps))
 
 	// Log all steps for debugging
 	for i, step := range flow.Steps {
-		a.Log.Info("Flow step", "index", i, "step_name", step.StepName, "step_order", step.StepOrder, "message_type", step.MessageType)
+		a.log(ctx).Info("Flow step", "index", i, "step_name", step.StepName, "step_order", step.StepOrder, "message_type", step.MessageType)
 	}
 
 	// Update session with flow info
@@ -777,32 +1051,33 @@ func (a *App) startFlow(account *models.WhatsAppAccount, session *models.Chatbot
 
 	// Send initial message if configured
 	if flow.InitialMessage != "" {
-		if err := a.sendAndSaveTextMessage(account, contact, flow.InitialMessage); err != nil {
-			a.Log.Error("Failed to send flow initial message", "error", err, "contact", contact.PhoneNumber)
+		initialMessage := a.expandOrgShortcodes(contact.OrganizationID, flow.InitialMessage)
+		if err := a.sendAndSaveTextMessage(ctx, account, contact, initialMessage); err != nil {
+			a.log(ctx).Error("Failed to send flow initial message", "error", err, "contact", contact.PhoneNumber)
 		}
-		a.logSessionMessage(session.ID, models.DirectionOutgoing, flow.InitialMessage, "flow_start")
+		a.logSessionMessage(session.ID, models.DirectionOutgoing, initialMessage, "flow_start")
 	}
 
 	// Send first step message (with skip check)
 	if len(flow.Steps) > 0 {
 		firstStep := &flow.Steps[0]
-		a.Log.Info("Sending first step", "step_name", firstStep.StepName, "message_type", firstStep.MessageType, "message", firstStep.Message)
+		a.log(ctx).Info("Sending first step", "step_name", firstStep.StepName, "message_type", firstStep.MessageType, "message", firstStep.Message)
 		session.CurrentStep = firstStep.StepName
 		a.DB.Model(session).Update("current_step", firstStep.StepName)
 
-		a.sendStepWithSkipCheck(account, session, contact, firstStep, flow, nil)
+		a.sendStepWithSkipCheck(ctx, account, session, contact, firstStep, flow, nil)
 	} else {
 		// No steps, complete the flow
-		a.completeFlow(account, session, contact, flow)
+		a.completeFlow(ctx, account, session, contact, flow)
 	}
 }
 
 // processFlowResponse handles user response within a flow
-func (a *App) processFlowResponse(account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, userInput string, buttonID string, flowResponseData map[string]interface{}) {
+func (a *App) processFlowResponse(ctx context.Context, account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, userInput string, buttonID string, flowResponseData map[string]interface{}) {
 	// Load the current flow from cache
 	flow, err := a.getChatbotFlowByIDCached(account.OrganizationID, *session.CurrentFlowID)
 	if err != nil {
-		a.Log.Error("Failed to load flow", "error", err)
+		a.log(ctx).Error("Failed to load flow", "error", err)
 		a.exitFlow(session)
 		return
 	}
@@ -811,8 +1086,8 @@ func (a *App) processFlowResponse(account *models.WhatsAppAccount, session *mode
 	userInputLower := strings.ToLower(userInput)
 	for _, cancelKw := range flow.CancelKeywords {
 		if strings.Contains(userInputLower, strings.ToLower(cancelKw)) {
-			if err := a.sendAndSaveTextMessage(account, contact, "Flow cancelled."); err != nil {
-				a.Log.Error("Failed to send flow cancel message", "error", err, "contact", contact.PhoneNumber)
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, "Flow cancelled."); err != nil {
+				a.log(ctx).Error("Failed to send flow cancel message", "error", err, "contact", contact.PhoneNumber)
 			}
 			a.logSessionMessage(session.ID, models.DirectionOutgoing, "Flow cancelled.", "flow_cancel")
 			a.exitFlow(session)
@@ -832,7 +1107,7 @@ func (a *App) processFlowResponse(account *models.WhatsAppAccount, session *mode
 	}
 
 	if currentStep == nil {
-		a.Log.Error("Current step not found", "step_name", session.CurrentStep)
+		a.log(ctx).Error("Current step not found", "step_name", session.CurrentStep)
 		a.exitFlow(session)
 		return
 	}
@@ -849,28 +1124,37 @@ func (a *App) processFlowResponse(account *models.WhatsAppAccount, session *mode
 				if errorMsg == "" {
 					errorMsg = "Invalid input. Please try again."
 				}
-				if err := a.sendAndSaveTextMessage(account, contact, errorMsg); err != nil {
-					a.Log.Error("Failed to send validation error", "error", err, "contact", contact.PhoneNumber)
+				if err := a.sendAndSaveTextMessage(ctx, account, contact, errorMsg); err != nil {
+					a.log(ctx).Error("Failed to send validation error", "error", err, "contact", contact.PhoneNumber)
 				}
 				a.logSessionMessage(session.ID, models.DirectionOutgoing, errorMsg, currentStep.StepName+"_retry")
 				return
 			}
 			// Max retries exceeded, continue anyway or exit
-			a.Log.Warn("Max retries exceeded", "step", currentStep.StepName)
+			a.log(ctx).Warn("Max retries exceeded", "step", currentStep.StepName)
 		}
 	}
 
 	// Auto-validate button responses when step expects button/select input
-	// Only validate if InputType is button/select, or if buttons are configured and user clicked a button
-	shouldValidateButtons := len(currentStep.Buttons) > 0 &&
-		(currentStep.InputType == models.InputTypeButton || currentStep.InputType == models.InputTypeSelect || buttonID != "")
+	// Only validate if InputType is button/select, or if buttons are configured and user clicked a button.
+	// List steps always wait for one of their rows.
+	options := currentStep.Buttons
+	switch currentStep.MessageType {
+	case models.FlowStepTypeList:
+		options = listReplyOptions(listMessageFromConfig(currentStep.Message, currentStep.InputConfig))
+	case models.FlowStepTypeCalendarSlots:
+		options = calendarSlotReplyOptions(session.SessionData)
+	}
+	shouldValidateButtons := len(options) > 0 &&
+		(currentStep.InputType == models.InputTypeButton || currentStep.InputType == models.InputTypeSelect || buttonID != "" ||
+			currentStep.MessageType == models.FlowStepTypeList || currentStep.MessageType == models.FlowStepTypeCalendarSlots)
 
 	if shouldValidateButtons {
 		isValidButton := false
 		userInputLower := strings.ToLower(userInput)
 
 		// Check if buttonID or userInput matches any configured button
-		for i, btn := range currentStep.Buttons {
+		for i, btn := range options {
 			if btnMap, ok := btn.(map[string]interface{}); ok {
 				btnID, _ := btnMap["id"].(string)
 				btnTitle, _ := btnMap["title"].(string)
@@ -899,7 +1183,7 @@ func (a *App) processFlowResponse(account *models.WhatsAppAccount, session *mode
 		if !isValidButton {
 			// Invalid button selection
 			session.StepRetries++
-			a.Log.Debug("Invalid button selection", "buttonID", buttonID, "userInput", userInput, "step", currentStep.StepName, "retries", session.StepRetries)
+			a.log(ctx).Debug("Invalid button selection", "buttonID", buttonID, "userInput", userInput, "step", currentStep.StepName, "retries", session.StepRetries)
 			a.DB.Model(session).Update("step_retries", session.StepRetries)
 
 			maxRetries := currentStep.MaxRetries
@@ -909,9 +1193,9 @@ func (a *App) processFlowResponse(account *models.WhatsAppAccount, session *mode
 
 			if session.StepRetries >= maxRetries {
 				// Max retries exceeded - exit flow and close conversation
-				a.Log.Warn("Max button retries exceeded, closing conversation", "step", currentStep.StepName)
-				if err := a.sendAndSaveTextMessage(account, contact, "Sorry, we couldn't continue. Please try again later."); err != nil {
-					a.Log.Error("Failed to send max retries message", "error", err, "contact", contact.PhoneNumber)
+				a.log(ctx).Warn("Max button retries exceeded, closing conversation", "step", currentStep.StepName)
+				if err := a.sendAndSaveTextMessage(ctx, account, contact, "Sorry, we couldn't continue. Please try again later."); err != nil {
+					a.log(ctx).Error("Failed to send max retries message", "error", err, "contact", contact.PhoneNumber)
 				}
 				a.exitFlow(session)
 				a.closeSession(session)
@@ -919,7 +1203,7 @@ func (a *App) processFlowResponse(account *models.WhatsAppAccount, session *mode
 			}
 
 			// Resend the step message with buttons
-			a.sendStepMessage(account, session, contact, currentStep)
+			a.sendStepMessage(ctx, account, session, contact, currentStep)
 			return
 		}
 	}
@@ -950,15 +1234,18 @@ func (a *App) processFlowResponse(account *models.WhatsAppAccount, session *mode
 		// Store each field from the flow response in the session
 		for key, value := range flowResponseData {
 			sessionData[key] = value
-			a.Log.Debug("Stored flow response field", "key", key, "value", value)
+			a.log(ctx).Debug("Stored flow response field", "key", key, "value", value)
 		}
 		// Also store the raw flow response for reference
 		sessionData["_flow_response"] = flowResponseData
 		a.DB.Model(session).Update("session_data", sessionData)
 		session.SessionData = sessionData
-		a.Log.Info("Stored WhatsApp Flow response in session", "fields", len(flowResponseData))
+		a.log(ctx).Info("Stored WhatsApp Flow response in session", "fields", len(flowResponseData))
 	}
 
+	// A contact_timezone variable collected by the flow overrides the contact's timezone
+	a.applySessionContactTimezone(contact, session.SessionData)
+
 	// Determine next step
 	nextStepName := currentStep.NextStep
 	if nextStepName == "" && currentStepIndex+1 < len(flow.Steps) {
@@ -988,7 +1275,7 @@ func (a *App) processFlowResponse(account *models.WhatsAppAccount, session *mode
 
 	// Move to next step or complete flow
 	if nextStepName == "" {
-		a.completeFlow(account, session, contact, flow)
+		a.completeFlow(ctx, account, session, contact, flow)
 		return
 	}
 
@@ -1002,8 +1289,8 @@ func (a *App) processFlowResponse(account *models.WhatsAppAccount, session *mode
 	}
 
 	if nextStep == nil {
-		a.Log.Warn("Next step not found, completing flow", "next_step", nextStepName)
-		a.completeFlow(account, session, contact, flow)
+		a.log(ctx).Warn("Next step not found, completing flow", "next_step", nextStepName)
+		a.completeFlow(ctx, account, session, contact, flow)
 		return
 	}
 
@@ -1013,25 +1300,25 @@ func (a *App) processFlowResponse(account *models.WhatsAppAccount, session *mode
 		"step_retries": 0,
 	})
 
-	a.Log.Info("Moving to next step", "nextStep", nextStep.StepName, "skipCondition", nextStep.SkipCondition, "sessionData", session.SessionData)
-	a.sendStepWithSkipCheck(account, session, contact, nextStep, flow, nil)
+	a.log(ctx).Info("Moving to next step", "nextStep", nextStep.StepName, "skipCondition", nextStep.SkipCondition, "sessionData", session.SessionData)
+	a.sendStepWithSkipCheck(ctx, account, session, contact, nextStep, flow, nil)
 }
 
 // completeFlow finishes a flow and sends completion message
-func (a *App) completeFlow(account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, flow *models.ChatbotFlow) {
-	a.Log.Info("Completing flow", "flow_id", flow.ID, "session_id", session.ID)
+func (a *App) completeFlow(ctx context.Context, account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, flow *models.ChatbotFlow) {
+	a.log(ctx).Info("Completing flow", "flow_id", flow.ID, "session_id", session.ID)
 
 	// Send completion message
 	if flow.CompletionMessage != "" {
-		message := a.replaceVariables(flow.CompletionMessage, session.SessionData)
-		if err := a.sendAndSaveTextMessage(account, contact, message); err != nil {
-			a.Log.Error("Failed to send flow completion message", "error", err, "contact", contact.PhoneNumber)
+		message := processTemplate(a.expandOrgShortcodes(contact.OrganizationID, flow.CompletionMessage), a.personalizationData(contact, session.SessionData))
+		if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+			a.log(ctx).Error("Failed to send flow completion message", "error", err, "contact", contact.PhoneNumber)
 		}
 		a.logSessionMessage(session.ID, models.DirectionOutgoing, message, "flow_complete")
 	}
 
-	// Execute on-complete action
-	if flow.OnCompleteAction == "webhook" && len(flow.CompletionConfig) > 0 {
+	// Execute on-complete action, except in simulations
+	if flow.OnCompleteAction == "webhook" && len(flow.CompletionConfig) > 0 && a.simulation == nil {
 		go a.sendFlowCompletionWebhook(flow, session, contact)
 	}
 
@@ -1045,14 +1332,15 @@ func (a *App) completeFlow(account *models.WhatsAppAccount, session *models.Chat
 
 	// Clear chatbot tracking so SLA doesn't fire after flow completion
 	a.ClearContactChatbotTracking(contact.ID)
+	a.surveySession(session)
 }
 
 // sendFlowCompletionWebhook sends session data to configured webhook URL
 func (a *App) sendFlowCompletionWebhook(flow *models.ChatbotFlow, session *models.ChatbotSession, contact *models.Contact) {
-	config := flow.CompletionConfig
+	completionConfig := flow.CompletionConfig
 
 	// Get webhook URL (required)
-	webhookURL, ok := config["url"].(string)
+	webhookURL, ok := completionConfig["url"].(string)
 	if !ok || webhookURL == "" {
 		a.Log.Error("Webhook URL not configured", "flow_id", flow.ID)
 		return
@@ -1063,7 +1351,7 @@ func (a *App) sendFlowCompletionWebhook(flow *models.ChatbotFlow, session *model
 
 	// Get HTTP method (default: POST)
 	method := "POST"
-	if m, ok := config["method"].(string); ok && m != "" {
+	if m, ok := completionConfig["method"].(string); ok && m != "" {
 		method = strings.ToUpper(m)
 	}
 
@@ -1081,7 +1369,7 @@ func (a *App) sendFlowCompletionWebhook(flow *models.ChatbotFlow, session *model
 
 	// Allow custom body template if provided
 	var bodyReader io.Reader
-	if bodyTemplate, ok := config["body"].(string); ok && bodyTemplate != "" {
+	if bodyTemplate, ok := completionConfig["body"].(string); ok && bodyTemplate != "" {
 		// Replace variables in body template
 		bodyWithVars := a.replaceVariables(bodyTemplate, session.SessionData)
 		bodyReader = strings.NewReader(bodyWithVars)
@@ -1107,7 +1395,7 @@ func (a *App) sendFlowCompletionWebhook(flow *models.ChatbotFlow, session *model
 	req.Header.Set("User-Agent", "Whatomate-Webhook/1.0")
 
 	// Add custom headers if configured
-	if headers, ok := config["headers"].(map[string]interface{}); ok {
+	if headers, ok := completionConfig["headers"].(map[string]interface{}); ok {
 		for key, value := range headers {
 			if strVal, ok := value.(string); ok {
 				req.Header.Set(key, a.replaceVariables(strVal, session.SessionData))
@@ -1116,7 +1404,7 @@ func (a *App) sendFlowCompletionWebhook(flow *models.ChatbotFlow, session *model
 	}
 
 	// Make the request
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := a.httpClient(config.OutboundWebhooks, 30*time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		a.Log.Error("Webhook request failed", "error", err, "url", webhookURL)
@@ -1161,10 +1449,13 @@ func (a *App) closeSession(session *models.ChatbotSession) {
 	a.DB.Model(session).Updates(map[string]interface{}{
 		"status":       models.SessionStatusCompleted,
 		"completed_at": time.Now(),
+		"mode":         models.SessionModeClosed,
 	})
+	a.broadcastSessionUpdate(session.OrganizationID, session.ContactID, session.ID, models.SessionModeClosed)
 
 	// Clear chatbot tracking on contact
 	a.ClearContactChatbotTracking(session.ContactID)
+	a.surveySession(session)
 }
 
 // replaceVariables replaces {{variable}} placeholders with session data values
@@ -1184,14 +1475,16 @@ func (a *App) replaceVariables(message string, data models.JSONB) string {
 
 // sendStepWithSkipCheck checks if a step should be skipped and sends the appropriate step message
 // It takes the full flow to find next steps when skipping
-func (a *App) sendStepWithSkipCheck(account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, step *models.ChatbotFlowStep, flow *models.ChatbotFlow, skippedSteps map[string]bool) {
+func (a *App) sendStepWithSkipCheck(ctx context.Context, account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, step *models.ChatbotFlowStep, flow *models.ChatbotFlow, skippedSteps map[string]bool) {
 	// Prevent infinite loops
 	if skippedSteps == nil {
 		skippedSteps = make(map[string]bool)
 	}
-	if skippedSteps[step.StepName] {
-		a.Log.Warn("Skip loop detected, completing flow", "step", step.StepName)
-		a.completeFlow(account, session, contact, flow)
+	// Keyed by flow as well, since jumps can reach steps of other flows
+	visitKey := flow.ID.String() + "/" + step.StepName
+	if skippedSteps[visitKey] {
+		a.log(ctx).Warn("Skip loop detected, completing flow", "step", step.StepName)
+		a.completeFlow(ctx, account, session, contact, flow)
 		return
 	}
 
@@ -1202,8 +1495,8 @@ func (a *App) sendStepWithSkipCheck(account *models.WhatsAppAccount, session *mo
 	}
 
 	if a.shouldSkipStep(step, sessionData) {
-		a.Log.Info("Skipping step", "step", step.StepName, "condition", step.SkipCondition)
-		skippedSteps[step.StepName] = true
+		a.log(ctx).Info("Skipping step", "step", step.StepName, "condition", step.SkipCondition)
+		skippedSteps[visitKey] = true
 
 		// Find next step
 		nextStepName := step.NextStep
@@ -1219,7 +1512,7 @@ func (a *App) sendStepWithSkipCheck(account *models.WhatsAppAccount, session *mo
 
 		if nextStepName == "" {
 			// No next step, complete flow
-			a.completeFlow(account, session, contact, flow)
+			a.completeFlow(ctx, account, session, contact, flow)
 			return
 		}
 
@@ -1233,8 +1526,8 @@ func (a *App) sendStepWithSkipCheck(account *models.WhatsAppAccount, session *mo
 		}
 
 		if nextStep == nil {
-			a.Log.Warn("Next step not found after skip, completing flow", "next_step", nextStepName)
-			a.completeFlow(account, session, contact, flow)
+			a.log(ctx).Warn("Next step not found after skip, completing flow", "next_step", nextStepName)
+			a.completeFlow(ctx, account, session, contact, flow)
 			return
 		}
 
@@ -1243,12 +1536,24 @@ func (a *App) sendStepWithSkipCheck(account *models.WhatsAppAccount, session *mo
 		a.DB.Model(session).Update("current_step", nextStep.StepName)
 
 		// Recursively check next step (it may also need to be skipped)
-		a.sendStepWithSkipCheck(account, session, contact, nextStep, flow, skippedSteps)
+		a.sendStepWithSkipCheck(ctx, account, session, contact, nextStep, flow, skippedSteps)
+		return
+	}
+
+	// Condition and jump steps send nothing, they only pick where the flow goes
+	switch step.MessageType {
+	case models.FlowStepTypeCondition:
+		skippedSteps[visitKey] = true
+		a.advanceToStep(ctx, account, session, contact, flow, step, conditionNextStep(step, sessionData), skippedSteps)
+		return
+	case models.FlowStepTypeJump:
+		skippedSteps[visitKey] = true
+		a.jumpToFlow(ctx, account, session, contact, flow, step, skippedSteps)
 		return
 	}
 
 	// Not skipping - send the step message normally
-	a.sendStepMessage(account, session, contact, step)
+	a.sendStepMessage(ctx, account, session, contact, step)
 
 	// If input type is "none", automatically advance to next step without waiting for user input
 	if step.InputType == models.InputTypeNone {
@@ -1267,7 +1572,7 @@ func (a *App) sendStepWithSkipCheck(account *models.WhatsAppAccount, session *mo
 
 		if nextStepName == "" {
 			// No next step, complete flow
-			a.completeFlow(account, session, contact, flow)
+			a.completeFlow(ctx, account, session, contact, flow)
 			return
 		}
 
@@ -1281,8 +1586,8 @@ func (a *App) sendStepWithSkipCheck(account *models.WhatsAppAccount, session *mo
 		}
 
 		if nextStep == nil {
-			a.Log.Warn("Next step not found after no-input step, completing flow", "next_step", nextStepName)
-			a.completeFlow(account, session, contact, flow)
+			a.log(ctx).Warn("Next step not found after no-input step, completing flow", "next_step", nextStepName)
+			a.completeFlow(ctx, account, session, contact, flow)
 			return
 		}
 
@@ -1291,33 +1596,38 @@ func (a *App) sendStepWithSkipCheck(account *models.WhatsAppAccount, session *mo
 		a.DB.Model(session).Update("current_step", nextStep.StepName)
 
 		// Recursively process next step (it may also need to skip or have no input)
-		a.sendStepWithSkipCheck(account, session, contact, nextStep, flow, skippedSteps)
+		a.sendStepWithSkipCheck(ctx, account, session, contact, nextStep, flow, skippedSteps)
 	}
 }
 
 // sendStepMessage sends the appropriate message based on step message_type
-func (a *App) sendStepMessage(account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, step *models.ChatbotFlowStep) {
+func (a *App) sendStepMessage(ctx context.Context, account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, step *models.ChatbotFlowStep) {
 	var message string
 
-	a.Log.Debug("sendStepMessage called", "step", step.StepName, "message_type", step.MessageType, "input_config", step.InputConfig)
+	a.log(ctx).Debug("sendStepMessage called", "step", step.StepName, "message_type", step.MessageType, "input_config", step.InputConfig)
+
+	// Expand shortcodes before template processing so shortcode content may use {{variables}}
+	stepMessage := a.expandOrgShortcodes(contact.OrganizationID, step.Message)
+	// Step messages can look up the contact's attributes alongside the session variables
+	data := a.personalizationData(contact, session.SessionData)
 
 	switch step.MessageType {
 	case models.FlowStepTypeAPIFetch:
 		// Fetch response from external API (may include message + buttons)
 		// Pass the step message as template - it will be processed with API response data
-		apiResp, err := a.fetchApiResponse(step.ApiConfig, session.SessionData, step.Message)
+		apiResp, err := a.fetchApiResponse(ctx, step.ApiConfig, data, stepMessage)
 		if err != nil {
-			a.Log.Error("Failed to fetch API response", "error", err, "step", step.StepName)
+			a.log(ctx).Error("Failed to fetch API response", "error", err, "step", step.StepName)
 			// Use fallback message if configured, otherwise use the step message
 			if fallback, ok := step.ApiConfig["fallback_message"].(string); ok && fallback != "" {
-				message = processTemplate(fallback, session.SessionData)
-			} else if step.Message != "" {
-				message = processTemplate(step.Message, session.SessionData)
+				message = processTemplate(fallback, data)
+			} else if stepMessage != "" {
+				message = processTemplate(stepMessage, data)
 			} else {
 				message = "Sorry, there was an error processing your request."
 			}
-			if err := a.sendAndSaveTextMessage(account, contact, message); err != nil {
-				a.Log.Error("Failed to send API error message", "error", err, "contact", contact.PhoneNumber)
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+				a.log(ctx).Error("Failed to send API error message", "error", err, "contact", contact.PhoneNumber)
 			}
 		} else {
 			message = apiResp.Message
@@ -1332,12 +1642,12 @@ func (a *App) sendStepMessage(account *models.WhatsAppAccount, session *models.C
 
 			// Check if API returned buttons
 			if len(apiResp.Buttons) > 0 {
-				if err := a.sendAndSaveInteractiveButtons(account, contact, message, apiResp.Buttons); err != nil {
-					a.Log.Error("Failed to send API response buttons", "error", err, "contact", contact.PhoneNumber)
+				if err := a.sendAndSaveInteractiveButtons(ctx, account, contact, message, apiResp.Buttons); err != nil {
+					a.log(ctx).Error("Failed to send API response buttons", "error", err, "contact", contact.PhoneNumber)
 				}
 			} else {
-				if err := a.sendAndSaveTextMessage(account, contact, message); err != nil {
-					a.Log.Error("Failed to send API response message", "error", err, "contact", contact.PhoneNumber)
+				if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+					a.log(ctx).Error("Failed to send API response message", "error", err, "contact", contact.PhoneNumber)
 				}
 			}
 		}
@@ -1345,7 +1655,7 @@ func (a *App) sendStepMessage(account *models.WhatsAppAccount, session *models.C
 
 	case models.FlowStepTypeButtons:
 		// Send interactive buttons message
-		message = processTemplate(step.Message, session.SessionData)
+		message = processTemplate(stepMessage, data)
 		if len(step.Buttons) > 0 {
 			// Separate reply buttons from URL buttons
 			// WhatsApp doesn't allow mixing them in the same message
@@ -1366,13 +1676,13 @@ func (a *App) sendStepMessage(account *models.WhatsAppAccount, session *models.C
 
 			// Send reply buttons first (with the main message)
 			if len(replyButtons) > 0 {
-				if err := a.sendAndSaveInteractiveButtons(account, contact, message, replyButtons); err != nil {
-					a.Log.Error("Failed to send reply buttons", "error", err, "contact", contact.PhoneNumber)
+				if err := a.sendAndSaveInteractiveButtons(ctx, account, contact, message, replyButtons); err != nil {
+					a.log(ctx).Error("Failed to send reply buttons", "error", err, "contact", contact.PhoneNumber)
 				}
 			} else if len(urlButtons) == 0 {
 				// No buttons at all, fall back to text
-				if err := a.sendAndSaveTextMessage(account, contact, message); err != nil {
-					a.Log.Error("Failed to send text message", "error", err, "contact", contact.PhoneNumber)
+				if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+					a.log(ctx).Error("Failed to send text message", "error", err, "contact", contact.PhoneNumber)
 				}
 			}
 
@@ -1388,25 +1698,98 @@ func (a *App) sendStepMessage(account *models.WhatsAppAccount, session *models.C
 						bodyText = message
 						message = "" // Clear so we don't repeat it
 					}
-					if err := a.sendAndSaveCTAURLButton(account, contact, bodyText, btnTitle, btnURL); err != nil {
-						a.Log.Error("Failed to send CTA URL button", "error", err, "contact", contact.PhoneNumber)
+					if err := a.sendAndSaveCTAURLButton(ctx, account, contact, bodyText, btnTitle, btnURL); err != nil {
+						a.log(ctx).Error("Failed to send CTA URL button", "error", err, "contact", contact.PhoneNumber)
 					}
 				}
 			}
 		} else {
 			// No buttons configured, fall back to text
-			if err := a.sendAndSaveTextMessage(account, contact, message); err != nil {
-				a.Log.Error("Failed to send step message", "error", err, "contact", contact.PhoneNumber)
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+				a.log(ctx).Error("Failed to send step message", "error", err, "contact", contact.PhoneNumber)
 			}
 		}
 		a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
 
+	case models.FlowStepTypeList:
+		// Send an interactive list; rows pick the next step like buttons do
+		message = processTemplate(stepMessage, data)
+		list := listMessageFromConfig(message, step.InputConfig)
+		list.Header = processTemplate(list.Header, data)
+		list.Footer = processTemplate(list.Footer, data)
+		if err := a.sendAndSaveListMessage(ctx, account, contact, list); err != nil {
+			a.log(ctx).Error("Failed to send list message", "error", err, "contact", contact.PhoneNumber)
+		}
+		a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
+
+	case models.FlowStepTypeMedia:
+		// Send an image, video, audio or document from a public URL, with the message as caption
+		message = processTemplate(stepMessage, data)
+		media := mediaMessageFromConfig(message, step.InputConfig)
+		media.Link = processTemplate(media.Link, data)
+		if err := a.sendAndSaveMediaMessage(ctx, account, contact, media); err != nil {
+			a.log(ctx).Error("Failed to send media message", "error", err, "contact", contact.PhoneNumber, "media_url", media.Link)
+		}
+		a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
+
+	case models.FlowStepTypeLocation:
+		// Share a place, such as a store, after the optional step message
+		message = processTemplate(stepMessage, data)
+		if message != "" {
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+				a.log(ctx).Error("Failed to send location step message", "error", err, "contact", contact.PhoneNumber)
+			}
+		}
+		location, err := locationFromConfig(step.InputConfig)
+		if err != nil {
+			a.log(ctx).Error("Invalid location step", "error", err, "step", step.StepName)
+		} else {
+			location.Name = processTemplate(location.Name, data)
+			location.Address = processTemplate(location.Address, data)
+			if err := a.sendAndSaveLocationMessage(ctx, account, contact, location); err != nil {
+				a.log(ctx).Error("Failed to send location message", "error", err, "contact", contact.PhoneNumber)
+			}
+		}
+		a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
+
+	case models.FlowStepTypeContacts:
+		// Share contact cards, such as a sales rep's number, after the optional step message
+		message = processTemplate(stepMessage, data)
+		if message != "" {
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+				a.log(ctx).Error("Failed to send contacts step message", "error", err, "contact", contact.PhoneNumber)
+			}
+		}
+		cards, err := contactCardsFromConfig(step.InputConfig)
+		if err != nil {
+			a.log(ctx).Error("Invalid contacts step", "error", err, "step", step.StepName)
+		} else if err := a.sendAndSaveContactsMessage(ctx, account, contact, cards); err != nil {
+			a.log(ctx).Error("Failed to send contacts message", "error", err, "contact", contact.PhoneNumber)
+		}
+		a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
+
+	case models.FlowStepTypeReaction:
+		// React to the customer's last message, e.g. with a 👍 to acknowledge it, then send the optional step message
+		emoji, err := reactionEmojiFromConfig(step.InputConfig)
+		if err != nil {
+			a.log(ctx).Error("Invalid reaction step", "error", err, "step", step.StepName)
+		} else if err := a.reactToLastIncomingMessage(account, contact, emoji); err != nil {
+			a.log(ctx).Error("Failed to send reaction", "error", err, "contact", contact.PhoneNumber)
+		}
+		message = processTemplate(stepMessage, data)
+		if message != "" {
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+				a.log(ctx).Error("Failed to send reaction step message", "error", err, "contact", contact.PhoneNumber)
+			}
+			a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
+		}
+
 	case models.FlowStepTypeTransfer:
 		// Transfer to team/agent queue
-		message = processTemplate(step.Message, session.SessionData)
+		message = processTemplate(stepMessage, data)
 		if message != "" {
-			if err := a.sendAndSaveTextMessage(account, contact, message); err != nil {
-				a.Log.Error("Failed to send transfer message", "error", err, "contact", contact.PhoneNumber)
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+				a.log(ctx).Error("Failed to send transfer message", "error", err, "contact", contact.PhoneNumber)
 			}
 			a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
 		}
@@ -1421,7 +1804,7 @@ func (a *App) sendStepMessage(account *models.WhatsAppAccount, session *models.C
 				}
 			}
 			if n, ok := step.TransferConfig["notes"].(string); ok {
-				notes = processTemplate(n, session.SessionData)
+				notes = processTemplate(n, data)
 			}
 		}
 
@@ -1439,18 +1822,18 @@ func (a *App) sendStepMessage(account *models.WhatsAppAccount, session *models.C
 
 	case models.FlowStepTypeWhatsAppFlow:
 		// Send a WhatsApp Flow (interactive form)
-		a.Log.Debug("Processing WhatsApp Flow step", "step", step.StepName, "input_config", step.InputConfig)
-		message = processTemplate(step.Message, session.SessionData)
+		a.log(ctx).Debug("Processing WhatsApp Flow step", "step", step.StepName, "input_config", step.InputConfig)
+		message = processTemplate(stepMessage, data)
 
 		// Extract flow configuration from input_config
 		var flowID, headerText, ctaText string
 		if step.InputConfig != nil {
 			if fid, ok := step.InputConfig["whatsapp_flow_id"].(string); ok {
 				flowID = fid
-				a.Log.Debug("Found WhatsApp Flow ID", "flow_id", flowID)
+				a.log(ctx).Debug("Found WhatsApp Flow ID", "flow_id", flowID)
 			}
 			if header, ok := step.InputConfig["flow_header"].(string); ok {
-				headerText = processTemplate(header, session.SessionData)
+				headerText = processTemplate(header, data)
 			}
 			if cta, ok := step.InputConfig["flow_cta"].(string); ok {
 				ctaText = cta
@@ -1458,24 +1841,24 @@ func (a *App) sendStepMessage(account *models.WhatsAppAccount, session *models.C
 		}
 
 		if flowID == "" {
-			a.Log.Error("WhatsApp Flow step missing flow ID", "step", step.StepName)
+			a.log(ctx).Error("WhatsApp Flow step missing flow ID", "step", step.StepName)
 			// Fall back to text message
-			if err := a.sendAndSaveTextMessage(account, contact, message); err != nil {
-				a.Log.Error("Failed to send fallback message", "error", err, "contact", contact.PhoneNumber)
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+				a.log(ctx).Error("Failed to send fallback message", "error", err, "contact", contact.PhoneNumber)
 			}
 		} else {
 			// Look up the WhatsApp Flow to get the first screen name
 			var waFlow models.WhatsAppFlow
 			firstScreen := ""
 			if err := a.DB.Where("meta_flow_id = ?", flowID).First(&waFlow).Error; err != nil {
-				a.Log.Debug("Could not find WhatsApp Flow in database, using default screen", "meta_flow_id", flowID)
+				a.log(ctx).Debug("Could not find WhatsApp Flow in database, using default screen", "meta_flow_id", flowID)
 			} else {
 				// Extract first screen name from screens array
 				if len(waFlow.Screens) > 0 {
 					if screenMap, ok := waFlow.Screens[0].(map[string]interface{}); ok {
 						if screenID, ok := screenMap["id"].(string); ok {
 							firstScreen = screenID
-							a.Log.Debug("Found first screen from flow", "first_screen", firstScreen)
+							a.log(ctx).Debug("Found first screen from flow", "first_screen", firstScreen)
 						}
 					}
 				}
@@ -1485,7 +1868,7 @@ func (a *App) sendStepMessage(account *models.WhatsAppAccount, session *models.C
 						if screenMap, ok := screens[0].(map[string]interface{}); ok {
 							if screenID, ok := screenMap["id"].(string); ok {
 								firstScreen = screenID
-								a.Log.Debug("Found first screen from flow_json", "first_screen", firstScreen)
+								a.log(ctx).Debug("Found first screen from flow_json", "first_screen", firstScreen)
 							}
 						}
 					}
@@ -1494,39 +1877,149 @@ func (a *App) sendStepMessage(account *models.WhatsAppAccount, session *models.C
 
 			// Generate a unique flow token for tracking
 			flowToken := fmt.Sprintf("chatbot_%s_%s_%d", session.ID.String(), step.StepName, time.Now().UnixNano())
-			a.Log.Debug("Sending WhatsApp Flow message", "flow_id", flowID, "first_screen", firstScreen, "cta", ctaText)
+			a.log(ctx).Debug("Sending WhatsApp Flow message", "flow_id", flowID, "first_screen", firstScreen, "cta", ctaText)
 
-			if err := a.sendAndSaveFlowMessage(account, contact, flowID, headerText, message, ctaText, flowToken, firstScreen); err != nil {
-				a.Log.Error("Failed to send WhatsApp Flow message", "error", err, "contact", contact.PhoneNumber, "flow_id", flowID)
+			if err := a.sendAndSaveFlowMessage(ctx, account, contact, flowID, headerText, message, ctaText, flowToken, firstScreen); err != nil {
+				a.log(ctx).Error("Failed to send WhatsApp Flow message", "error", err, "contact", contact.PhoneNumber, "flow_id", flowID)
 			}
 		}
 		a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
 
-	default:
-		// Default: use the step message with template processing
-		a.Log.Debug("Unhandled message type, falling back to text", "message_type", step.MessageType, "step", step.StepName)
-		message = processTemplate(step.Message, session.SessionData)
-		if err := a.sendAndSaveTextMessage(account, contact, message); err != nil {
-			a.Log.Error("Failed to send step message", "error", err, "contact", contact.PhoneNumber)
+	case models.FlowStepTypeProduct:
+		// Send a product from the number's catalog by SKU
+		message = processTemplate(stepMessage, data)
+		sku, _ := step.InputConfig["product_sku"].(string)
+		sku = processTemplate(sku, data)
+
+		product, err := a.findProductBySKU(contact.OrganizationID, account.Name, sku)
+		switch {
+		case err != nil:
+			a.log(ctx).Error("Product step product not found", "error", err, "step", step.StepName)
+		case !productAvailable(product):
+			a.log(ctx).Info("Product step product unavailable", "sku", sku, "availability", product.Availability, "step", step.StepName)
+			product = nil
+		}
+
+		if product != nil {
+			if err := a.sendAndSaveProductMessage(ctx, account, contact, message, product); err != nil {
+				a.log(ctx).Error("Failed to send product message", "error", err, "contact", contact.PhoneNumber, "sku", sku)
+			}
+		} else {
+			// Fall back to the configured message when the product can't be sent
+			if fallback, ok := step.InputConfig["unavailable_message"].(string); ok && fallback != "" {
+				message = processTemplate(fallback, data)
+			}
+			if message != "" {
+				if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+					a.log(ctx).Error("Failed to send product fallback message", "error", err, "contact", contact.PhoneNumber)
+				}
+			}
 		}
 		a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
-	}
-}
 
-// ApiResponse represents a response from an external API that may include buttons
-type ApiResponse struct {
-	Message      string
-	Buttons      []map[string]interface{}
-	MappedData   map[string]interface{} // Data extracted via response_mapping
-	ResponseData map[string]interface{} // Full API response data
-}
+	case models.FlowStepTypeProductList:
+		// Send sections of products from the number's catalog, leaving out unavailable ones
+		message = processTemplate(stepMessage, data)
+		header := processTemplate(getStringFromMap(step.InputConfig, "header"), data)
+		footer := processTemplate(getStringFromMap(step.InputConfig, "footer"), data)
+
+		list, products, err := a.productListMessage(contact.OrganizationID, account.Name, header, message, footer, productSectionsFromConfig(step.InputConfig), true)
+		switch {
+		case err != nil:
+			a.log(ctx).Error("Product list step product not found", "error", err, "step", step.StepName)
+			list = nil
+		case len(products) == 0:
+			a.log(ctx).Info("Product list step has no available products", "step", step.StepName)
+			list = nil
+		}
+
+		if list != nil {
+			if err := a.sendAndSaveProductListMessage(ctx, account, contact, list, products); err != nil {
+				a.log(ctx).Error("Failed to send product list message", "error", err, "contact", contact.PhoneNumber)
+			}
+		} else {
+			// Fall back to the configured message when the products can't be sent
+			if fallback, ok := step.InputConfig["unavailable_message"].(string); ok && fallback != "" {
+				message = processTemplate(fallback, data)
+			}
+			if message != "" {
+				if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+					a.log(ctx).Error("Failed to send product list fallback message", "error", err, "contact", contact.PhoneNumber)
+				}
+			}
+		}
+		a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
 
-// fetchApiResponse fetches a response from an external API, supporting message + buttons
-// and response_mapping for storing API data in session variables
-func (a *App) fetchApiResponse(apiConfig models.JSONB, sessionData models.JSONB, messageTemplate string) (*ApiResponse, error) {
-	if apiConfig == nil {
-		return nil, fmt.Errorf("API config is empty")
-	}
+	case models.FlowStepTypeFollowUp:
+		// Set a follow-up that fires if the customer doesn't reply in time
+		message = processTemplate(stepMessage, data)
+		if message != "" {
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+				a.log(ctx).Error("Failed to send follow-up step message", "error", err, "contact", contact.PhoneNumber)
+			}
+			a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
+		}
+		a.createFlowFollowUp(contact, step.InputConfig, session.SessionData)
+
+	case models.FlowStepTypeAppointment:
+		// Book an appointment from the values collected by the flow
+		message = processTemplate(stepMessage, data)
+		if err := a.createFlowAppointment(ctx, contact, step.InputConfig, session.SessionData); errors.Is(err, errCalendarSlotTaken) {
+			message = processTemplate(getStringFromMap(step.InputConfig, "unavailable_message"), data)
+		}
+		if message != "" {
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+				a.log(ctx).Error("Failed to send appointment step message", "error", err, "contact", contact.PhoneNumber)
+			}
+			a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
+		}
+
+	case models.FlowStepTypeCalendarSlots:
+		// Offer the free slots of the connected calendar as a list
+		message = a.sendCalendarSlots(ctx, account, session, contact, step, stepMessage)
+		if message != "" {
+			a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
+		}
+
+	case models.FlowStepTypePaymentLink:
+		// Create a payment link and send it with the step message
+		message = a.sendFlowPaymentLink(ctx, account, session, contact, step, stepMessage)
+		if message != "" {
+			a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
+		}
+
+	case models.FlowStepTypeOrderStatus:
+		// Look up a Shopify order and send its status
+		message = a.sendFlowOrderStatus(ctx, account, session, contact, step, stepMessage)
+		if message != "" {
+			a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
+		}
+
+	default:
+		// Default: use the step message with template processing
+		a.log(ctx).Debug("Unhandled message type, falling back to text", "message_type", step.MessageType, "step", step.StepName)
+		message = processTemplate(stepMessage, data)
+		if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+			a.log(ctx).Error("Failed to send step message", "error", err, "contact", contact.PhoneNumber)
+		}
+		a.logSessionMessage(session.ID, models.DirectionOutgoing, message, step.StepName)
+	}
+}
+
+// ApiResponse represents a response from an external API that may include buttons
+type ApiResponse struct {
+	Message      string
+	Buttons      []map[string]interface{}
+	MappedData   map[string]interface{} // Data extracted via response_mapping
+	ResponseData map[string]interface{} // Full API response data
+}
+
+// fetchApiResponse fetches a response from an external API, supporting message + buttons
+// and response_mapping for storing API data in session variables
+func (a *App) fetchApiResponse(ctx context.Context, apiConfig models.JSONB, sessionData models.JSONB, messageTemplate string) (*ApiResponse, error) {
+	if apiConfig == nil {
+		return nil, fmt.Errorf("API config is empty")
+	}
 
 	// Get API URL (required)
 	apiURL, ok := apiConfig["url"].(string)
@@ -1551,7 +2044,7 @@ func (a *App) fetchApiResponse(apiConfig models.JSONB, sessionData models.JSONB,
 	}
 
 	// Create request
-	req, err := http.NewRequest(method, apiURL, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, bodyReader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -1571,7 +2064,7 @@ func (a *App) fetchApiResponse(apiConfig models.JSONB, sessionData models.JSONB,
 	}
 
 	// Make the request
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := a.httpClient(config.OutboundIntegrations, 30*time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("API request failed: %w", err)
@@ -1658,25 +2151,171 @@ func (a *App) fetchApiResponse(apiConfig models.JSONB, sessionData models.JSONB,
 	return result, nil
 }
 
-// generateAIResponse generates a response using the configured AI provider
-func (a *App) generateAIResponse(settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string) (string, error) {
+// defaultOllamaBaseURL is used when an Ollama provider has no base URL
+const defaultOllamaBaseURL = "http://localhost:11434"
+
+// AI provider endpoints, overridden in tests
+var (
+	openAIChatURL        = "https://api.openai.com/v1/chat/completions"
+	anthropicMessagesURL = "https://api.anthropic.com/v1/messages"
+	googleAIBaseURL      = "https://generativelanguage.googleapis.com/v1beta"
+)
+
+// maxAIHistoryLimit caps the session messages sent to AI providers as history
+const maxAIHistoryLimit = 50
+
+// isAIProvider reports whether generateAIResponse can call the provider
+func isAIProvider(provider models.AIProvider) bool {
+	switch provider {
+	case models.AIProviderOpenAI, models.AIProviderAnthropic, models.AIProviderGoogle, models.AIProviderOllama, models.AIProviderWebhook:
+		return true
+	}
+	return false
+}
+
+// maxAITemperature returns the highest temperature the provider accepts
+func maxAITemperature(provider models.AIProvider) float64 {
+	if provider == models.AIProviderAnthropic {
+		return 1
+	}
+	return 2
+}
+
+// aiConfigured reports whether the AI settings are complete enough to call the
+// provider. Self-hosted providers don't need an API key; webhooks need a URL.
+func aiConfigured(ai models.AIConfig) bool {
+	switch {
+	case !isAIProvider(ai.Provider):
+		return false
+	case ai.Provider == models.AIProviderOllama:
+		return true
+	case ai.Provider == models.AIProviderWebhook:
+		return ai.BaseURL != ""
+	}
+	return ai.APIKey != ""
+}
+
+// generateAIResponse generates a response using the configured AI provider, falling
+// back to the next provider when one fails. The completion records the provider
+// that answered and the tokens used.
+func (a *App) generateAIResponse(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession, contact *models.Contact, userMessage string) (*aiCompletion, error) {
+	ctx, span := tracing.Start(ctx, "ai.generate", attribute.String("ai.provider", string(settings.AI.Provider)))
+	defer span.End()
+
+	if !a.HasFeature(settings.OrganizationID, models.PlanFeatureAI) {
+		return nil, errors.New(featureUnavailableMessage(models.PlanFeatureAI))
+	}
+
+	// Repeated questions are answered from the cache, without calling the provider
+	cacheKey := a.aiResponseCacheKey(settings, session, userMessage)
+	if completion := a.cachedAICompletion(cacheKey); completion != nil {
+		span.SetAttributes(attribute.Bool("ai.cached", true))
+		return completion, nil
+	}
+
+	// Enforce the plan's monthly AI call limit
+	if err := a.checkSupportQuota(settings.OrganizationID, models.UsageMetricAICalls, 1); err != nil {
+		return nil, err
+	}
+
+	// And the chatbot's monthly token quota
+	if err := a.checkAITokenQuota(settings); err != nil {
+		return nil, err
+	}
+
 	// Build context from AIContext entries
-	contextData := a.buildAIContext(settings.OrganizationID, session, userMessage)
+	contextData := a.buildAIContext(ctx, settings.OrganizationID, session, userMessage)
+
+	// And the knowledge base passages closest to the message
+	if knowledge := a.buildKnowledgeContext(ctx, settings.OrganizationID, userMessage); knowledge != "" {
+		if contextData != "" {
+			contextData += "\n\n" + knowledge
+		} else {
+			contextData = knowledge
+		}
+	}
+
+	// And the summary of the conversation's earlier turns
+	if summary := aiHistorySummary(settings, session); summary != "" {
+		if contextData != "" {
+			contextData += "\n\n" + aiSummaryContextHeader + summary
+		} else {
+			contextData = aiSummaryContextHeader + summary
+		}
+	}
+
+	// Sessions routed to an AI experiment are answered by its provider
+	settings = aiVariantSettings(settings, session)
+
+	// Answer with the selected persona, or the system prompt for the conversation's language
+	prompted := *settings
+	persona, hasPersona := activeAIPersona(settings)
+	if hasPersona {
+		prompted.AI.SystemPrompt = persona.Prompt
+	}
+	lang := conversationLanguage(settings, session, nil)
+	if lang != "" && !hasPersona {
+		prompted.AI.SystemPrompt = localizedMessage(settings, lang, translationSystemPrompt, settings.AI.SystemPrompt)
+	}
+	prompted.AI.SystemPrompt = a.renderSystemPrompt(settings, contact, prompted.AI.SystemPrompt)
+	settings = &prompted
 
+	if lang != "" {
+		if instruction := aiLanguageInstruction(lang); instruction != "" {
+			if contextData != "" {
+				contextData = instruction + "\n\n" + contextData
+			} else {
+				contextData = instruction
+			}
+		}
+	}
+
+	// Bots hand off with a custom payload instead
+	handoff := settings.AgentAssignment.HandoffOnAIIntent && settings.AI.Provider != models.AIProviderWebhook
+	if handoff {
+		if contextData != "" {
+			contextData = aiHandoffInstruction + "\n\n" + contextData
+		} else {
+			contextData = aiHandoffInstruction
+		}
+	}
+
+	completion, err := a.generateWithFallback(ctx, settings, session, userMessage, contextData)
+	if err != nil {
+		return nil, err
+	}
+	completion.CacheKey = cacheKey
+	if handoff {
+		if completion.Text, completion.Handoff = splitAIHandoff(completion.Text); completion.Handoff {
+			completion.CacheKey = ""
+		}
+	}
+
+	a.recordUsage(settings.OrganizationID, models.UsageMetricAICalls, 1)
+	a.recordAIUsage(settings, session, completion)
+	a.chargeAICall(settings.OrganizationID)
+	return completion, nil
+}
+
+// generateProviderResponse asks the provider of the AI settings for a response
+func (a *App) generateProviderResponse(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) (*aiCompletion, error) {
 	switch settings.AI.Provider {
 	case models.AIProviderOpenAI:
-		return a.generateOpenAIResponse(settings, session, userMessage, contextData)
+		return a.generateOpenAIResponse(ctx, settings, session, userMessage, contextData)
 	case models.AIProviderAnthropic:
-		return a.generateAnthropicResponse(settings, session, userMessage, contextData)
+		return a.generateAnthropicResponse(ctx, settings, session, userMessage, contextData)
 	case models.AIProviderGoogle:
-		return a.generateGoogleResponse(settings, session, userMessage, contextData)
-	default:
-		return "", fmt.Errorf("unsupported AI provider: %s", settings.AI.Provider)
+		return a.generateGoogleResponse(ctx, settings, session, userMessage, contextData)
+	case models.AIProviderOllama:
+		return a.generateOllamaResponse(ctx, settings, session, userMessage, contextData)
+	case models.AIProviderWebhook:
+		return a.generateWebhookResponse(ctx, settings, session, userMessage, contextData)
 	}
+	return nil, fmt.Errorf("unsupported AI provider: %s", settings.AI.Provider)
 }
 
 // buildAIContext fetches and combines all AI context data
-func (a *App) buildAIContext(orgID uuid.UUID, session *models.ChatbotSession, userMessage string) string {
+func (a *App) buildAIContext(ctx context.Context, orgID uuid.UUID, session *models.ChatbotSession, userMessage string) string {
 	// Get WhatsApp account for cache key
 	whatsAppAccount := ""
 	if session != nil {
@@ -1691,21 +2330,21 @@ func (a *App) buildAIContext(orgID uuid.UUID, session *models.ChatbotSession, us
 
 	var contextParts []string
 
-	for _, ctx := range contexts {
+	for _, aiContext := range contexts {
 		var content string
 
-		switch ctx.ContextType {
+		switch aiContext.ContextType {
 		case models.ContextTypeStatic:
-			content = ctx.StaticContent
+			content = aiContext.StaticContent
 
 		case models.ContextTypeAPI:
 			// Start with static content/prompt if provided
-			content = ctx.StaticContent
+			content = aiContext.StaticContent
 
 			// Fetch data from external API and append
-			apiContent, err := a.fetchAPIContext(ctx.ApiConfig, session, userMessage)
+			apiContent, err := a.fetchAPIContext(ctx, aiContext.ApiConfig, session, userMessage)
 			if err != nil {
-				a.Log.Error("Failed to fetch API context", "context_name", ctx.Name, "error", err)
+				a.log(ctx).Error("Failed to fetch API context", "context_name", aiContext.Name, "error", err)
 				// Still use static content if API fails
 			} else if apiContent != "" {
 				if content != "" {
@@ -1717,7 +2356,7 @@ func (a *App) buildAIContext(orgID uuid.UUID, session *models.ChatbotSession, us
 		}
 
 		if content != "" {
-			contextParts = append(contextParts, fmt.Sprintf("### %s\n%s", ctx.Name, content))
+			contextParts = append(contextParts, fmt.Sprintf("### %s\n%s", aiContext.Name, content))
 		}
 	}
 
@@ -1729,7 +2368,7 @@ func (a *App) buildAIContext(orgID uuid.UUID, session *models.ChatbotSession, us
 }
 
 // fetchAPIContext fetches context data from an external API
-func (a *App) fetchAPIContext(apiConfig models.JSONB, session *models.ChatbotSession, userMessage string) (string, error) {
+func (a *App) fetchAPIContext(ctx context.Context, apiConfig models.JSONB, session *models.ChatbotSession, userMessage string) (string, error) {
 	if apiConfig == nil {
 		return "", fmt.Errorf("API config is empty")
 	}
@@ -1768,7 +2407,7 @@ func (a *App) fetchAPIContext(apiConfig models.JSONB, session *models.ChatbotSes
 	}
 
 	// Create request
-	req, err := http.NewRequest(method, apiURL, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, bodyReader)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -1787,7 +2426,7 @@ func (a *App) fetchAPIContext(apiConfig models.JSONB, session *models.ChatbotSes
 	}
 
 	// Make the request
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := a.httpClient(config.OutboundIntegrations, 10*time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("API request failed: %w", err)
@@ -1817,11 +2456,139 @@ func (a *App) fetchAPIContext(apiConfig models.JSONB, session *models.ChatbotSes
 	return string(respBody), nil
 }
 
-// generateOpenAIResponse generates a response using OpenAI API
-func (a *App) generateOpenAIResponse(settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) (string, error) {
-	url := "https://api.openai.com/v1/chat/completions"
+// generateOpenAIResponse generates a response using OpenAI API. Tool calls are
+// executed and their results sent back until the model answers.
+func (a *App) generateOpenAIResponse(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) (*aiCompletion, error) {
+	tools := availableAITools(settings)
+	messages := []interface{}{}
+	for _, msg := range a.buildChatMessages(settings, session, userMessage, contextData) {
+		messages = append(messages, msg)
+	}
 
-	// Build messages array
+	payload := map[string]interface{}{
+		"model":      settings.AI.Model,
+		"max_tokens": settings.AI.MaxTokens,
+	}
+
+	if settings.AI.Temperature > 0 {
+		payload["temperature"] = settings.AI.Temperature
+	}
+	if len(tools) > 0 {
+		payload["tools"] = openAIToolDefinitions(tools)
+	}
+
+	headers := map[string]string{"Authorization": "Bearer " + settings.AI.APIKey}
+	if stream := aiStreamFromContext(ctx); stream != nil && len(tools) == 0 {
+		payload["messages"] = messages
+		return a.streamOpenAIResponse(ctx, stream, headers, payload)
+	}
+
+	completion := &aiCompletion{}
+	for round := 0; ; round++ {
+		payload["messages"] = messages
+		status, body, err := a.postAIRequest(ctx, a.aiClient(models.AIProviderOpenAI), openAIChatURL, headers, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		if status != 200 {
+			var errResp struct {
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			_ = json.Unmarshal(body, &errResp)
+			return nil, aiStatusError(status, fmt.Errorf("OpenAI API error: %s", errResp.Error.Message))
+		}
+
+		var result struct {
+			Choices []struct {
+				Message json.RawMessage `json:"message"`
+			} `json:"choices"`
+			Usage struct {
+				PromptTokens     int `json:"prompt_tokens"`
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		completion.PromptTokens += result.Usage.PromptTokens
+		completion.CompletionTokens += result.Usage.CompletionTokens
+
+		if len(result.Choices) == 0 {
+			return nil, fmt.Errorf("no response from OpenAI")
+		}
+
+		var message struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		}
+		if err := json.Unmarshal(result.Choices[0].Message, &message); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		if len(message.ToolCalls) == 0 {
+			completion.Text = strings.TrimSpace(message.Content)
+			return completion, nil
+		}
+		if round == maxAIToolRounds {
+			return nil, errAIToolRounds
+		}
+
+		// Send the tool calls back with their results
+		messages = append(messages, result.Choices[0].Message)
+		for _, call := range message.ToolCalls {
+			messages = append(messages, map[string]string{
+				"role":         "tool",
+				"tool_call_id": call.ID,
+				"content": a.runAITool(ctx, tools, session, aiToolCall{
+					ID:        call.ID,
+					Name:      call.Function.Name,
+					Arguments: json.RawMessage(call.Function.Arguments),
+				}),
+			})
+		}
+	}
+}
+
+// postAIRequest posts a JSON payload to an AI API and returns the response status and body
+func (a *App) postAIRequest(ctx context.Context, client *http.Client, url string, headers map[string]string, payload interface{}) (int, []byte, error) {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, body, nil
+}
+
+// buildChatMessages builds the role/content message list of chat completion APIs:
+// the system prompt with the AI context, the session history if enabled, then the
+// customer's message
+func (a *App) buildChatMessages(settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) []map[string]string {
 	messages := []map[string]string{}
 
 	// Build system prompt with context
@@ -1843,18 +2610,15 @@ func (a *App) generateOpenAIResponse(settings *models.ChatbotSettings, session *
 	}
 
 	// Add conversation history if enabled
-	if settings.AI.IncludeHistory && session != nil {
-		history := a.getSessionHistory(session.ID, settings.AI.HistoryLimit)
-		for _, msg := range history {
-			role := "user"
-			if msg.Direction == models.DirectionOutgoing {
-				role = "assistant"
-			}
-			messages = append(messages, map[string]string{
-				"role":    role,
-				"content": msg.Message,
-			})
+	for _, msg := range a.aiConversationHistory(settings, session, userMessage) {
+		role := "user"
+		if msg.Direction == models.DirectionOutgoing {
+			role = "assistant"
 		}
+		messages = append(messages, map[string]string{
+			"role":    role,
+			"content": msg.Message,
+		})
 	}
 
 	// Add current user message
@@ -1863,86 +2627,137 @@ func (a *App) generateOpenAIResponse(settings *models.ChatbotSettings, session *
 		"content": userMessage,
 	})
 
-	payload := map[string]interface{}{
-		"model":      settings.AI.Model,
-		"messages":   messages,
-		"max_tokens": settings.AI.MaxTokens,
+	return messages
+}
+
+// generateOllamaResponse generates a response using an Ollama-compatible /api/chat
+// endpoint, e.g. a self-hosted model. The API key is optional and sent as a bearer
+// token for servers behind an authenticating proxy.
+func (a *App) generateOllamaResponse(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) (*aiCompletion, error) {
+	baseURL := strings.TrimRight(settings.AI.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+
+	tools := availableAITools(settings)
+	messages := []interface{}{}
+	for _, msg := range a.buildChatMessages(settings, session, userMessage, contextData) {
+		messages = append(messages, msg)
 	}
 
+	options := map[string]interface{}{}
+	if settings.AI.MaxTokens > 0 {
+		options["num_predict"] = settings.AI.MaxTokens
+	}
 	if settings.AI.Temperature > 0 {
-		payload["temperature"] = settings.AI.Temperature
+		options["temperature"] = settings.AI.Temperature
+	}
+	payload := map[string]interface{}{
+		"model":   settings.AI.Model,
+		"stream":  false,
+		"options": options,
+	}
+	if len(tools) > 0 {
+		payload["tools"] = openAIToolDefinitions(tools)
 	}
 
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	headers := map[string]string{}
+	if settings.AI.APIKey != "" {
+		headers["Authorization"] = "Bearer " + settings.AI.APIKey
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+	if stream := aiStreamFromContext(ctx); stream != nil && len(tools) == 0 {
+		payload["messages"] = messages
+		return a.streamOllamaResponse(ctx, stream, baseURL+"/api/chat", headers, payload)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+settings.AI.APIKey)
+	completion := &aiCompletion{}
+	for round := 0; ; round++ {
+		payload["messages"] = messages
+		// Local models can be slow to load and answer
+		status, body, err := a.postAIRequest(ctx, a.aiClient(models.AIProviderOllama), baseURL+"/api/chat", headers, payload)
+		if err != nil {
+			return nil, err
+		}
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
+		if status != 200 {
+			var errResp struct {
+				Error string `json:"error"`
+			}
+			_ = json.Unmarshal(body, &errResp)
+			return nil, aiStatusError(status, fmt.Errorf("Ollama API error (status %d): %s", status, errResp.Error))
+		}
 
-	body, _ := io.ReadAll(resp.Body)
+		var result struct {
+			Message         json.RawMessage `json:"message"`
+			PromptEvalCount int             `json:"prompt_eval_count"`
+			EvalCount       int             `json:"eval_count"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		completion.PromptTokens += result.PromptEvalCount
+		completion.CompletionTokens += result.EvalCount
 
-	if resp.StatusCode != 200 {
-		var errResp struct {
-			Error struct {
-				Message string `json:"message"`
-			} `json:"error"`
+		var message struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Function struct {
+					Name      string          `json:"name"`
+					Arguments json.RawMessage `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		}
+		if len(result.Message) > 0 {
+			if err := json.Unmarshal(result.Message, &message); err != nil {
+				return nil, fmt.Errorf("failed to parse response: %w", err)
+			}
 		}
-		_ = json.Unmarshal(body, &errResp)
-		return "", fmt.Errorf("OpenAI API error: %s", errResp.Error.Message)
-	}
 
-	var result struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
+		if len(message.ToolCalls) == 0 {
+			if content := strings.TrimSpace(message.Content); content != "" {
+				completion.Text = content
+				return completion, nil
+			}
+			return nil, fmt.Errorf("no response from Ollama")
+		}
+		if round == maxAIToolRounds {
+			return nil, errAIToolRounds
+		}
 
-	if len(result.Choices) > 0 {
-		return strings.TrimSpace(result.Choices[0].Message.Content), nil
+		// Send the tool calls back with their results
+		messages = append(messages, result.Message)
+		for _, call := range message.ToolCalls {
+			messages = append(messages, map[string]string{
+				"role":      "tool",
+				"tool_name": call.Function.Name,
+				"content": a.runAITool(ctx, tools, session, aiToolCall{
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				}),
+			})
+		}
 	}
-
-	return "", fmt.Errorf("no response from OpenAI")
 }
 
-// generateAnthropicResponse generates a response using Anthropic API
-func (a *App) generateAnthropicResponse(settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) (string, error) {
-	url := "https://api.anthropic.com/v1/messages"
+// generateAnthropicResponse generates a response using Anthropic API. Tool calls
+// are executed and their results sent back until the model answers.
+func (a *App) generateAnthropicResponse(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) (*aiCompletion, error) {
+	tools := availableAITools(settings)
 
 	// Build messages array
-	messages := []map[string]string{}
+	messages := []interface{}{}
 
 	// Add conversation history if enabled
-	if settings.AI.IncludeHistory && session != nil {
-		history := a.getSessionHistory(session.ID, settings.AI.HistoryLimit)
-		for _, msg := range history {
-			role := "user"
-			if msg.Direction == models.DirectionOutgoing {
-				role = "assistant"
-			}
-			messages = append(messages, map[string]string{
-				"role":    role,
-				"content": msg.Message,
-			})
+	for _, msg := range a.aiConversationHistory(settings, session, userMessage) {
+		role := "user"
+		if msg.Direction == models.DirectionOutgoing {
+			role = "assistant"
 		}
+		messages = append(messages, map[string]string{
+			"role":    role,
+			"content": msg.Message,
+		})
 	}
 
 	// Add current user message
@@ -1953,7 +2768,6 @@ func (a *App) generateAnthropicResponse(settings *models.ChatbotSettings, sessio
 
 	payload := map[string]interface{}{
 		"model":      settings.AI.Model,
-		"messages":   messages,
 		"max_tokens": settings.AI.MaxTokens,
 	}
 
@@ -1973,84 +2787,125 @@ func (a *App) generateAnthropicResponse(settings *models.ChatbotSettings, sessio
 	}
 
 	if settings.AI.Temperature > 0 {
-		payload["temperature"] = settings.AI.Temperature
+		// Fallback providers and experiments share the primary provider's temperature,
+		// which may be higher than Anthropic accepts
+		payload["temperature"] = min(settings.AI.Temperature, maxAITemperature(models.AIProviderAnthropic))
+	}
+	if len(tools) > 0 {
+		payload["tools"] = anthropicToolDefinitions(tools)
 	}
 
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	headers := map[string]string{
+		"x-api-key":         settings.AI.APIKey,
+		"anthropic-version": "2023-06-01",
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+	if stream := aiStreamFromContext(ctx); stream != nil && len(tools) == 0 {
+		payload["messages"] = messages
+		return a.streamAnthropicResponse(ctx, stream, headers, payload)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", settings.AI.APIKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+	completion := &aiCompletion{}
+	for round := 0; ; round++ {
+		payload["messages"] = messages
+		status, body, err := a.postAIRequest(ctx, a.aiClient(models.AIProviderAnthropic), anthropicMessagesURL, headers, payload)
+		if err != nil {
+			return nil, err
+		}
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
+		if status != 200 {
+			var errResp struct {
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			_ = json.Unmarshal(body, &errResp)
+			return nil, aiStatusError(status, fmt.Errorf("anthropic API error: %s", errResp.Error.Message))
+		}
 
-	body, _ := io.ReadAll(resp.Body)
+		var result struct {
+			Content json.RawMessage `json:"content"`
+			Usage   struct {
+				InputTokens  int `json:"input_tokens"`
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		completion.PromptTokens += result.Usage.InputTokens
+		completion.CompletionTokens += result.Usage.OutputTokens
 
-	if resp.StatusCode != 200 {
-		var errResp struct {
-			Error struct {
-				Message string `json:"message"`
-			} `json:"error"`
+		var blocks []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text"`
+			ID    string          `json:"id"`
+			Name  string          `json:"name"`
+			Input json.RawMessage `json:"input"`
+		}
+		if len(result.Content) > 0 {
+			if err := json.Unmarshal(result.Content, &blocks); err != nil {
+				return nil, fmt.Errorf("failed to parse response: %w", err)
+			}
 		}
-		_ = json.Unmarshal(body, &errResp)
-		return "", fmt.Errorf("anthropic API error: %s", errResp.Error.Message)
-	}
 
-	var result struct {
-		Content []struct {
-			Type string `json:"type"`
-			Text string `json:"text"`
-		} `json:"content"`
-	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
+		var calls []aiToolCall
+		for _, block := range blocks {
+			if block.Type == "tool_use" {
+				calls = append(calls, aiToolCall{ID: block.ID, Name: block.Name, Arguments: block.Input})
+			}
+		}
 
-	for _, content := range result.Content {
-		if content.Type == "text" {
-			return strings.TrimSpace(content.Text), nil
+		if len(calls) == 0 {
+			for _, block := range blocks {
+				if block.Type == "text" {
+					completion.Text = strings.TrimSpace(block.Text)
+					return completion, nil
+				}
+			}
+			return nil, fmt.Errorf("no text response from Anthropic")
+		}
+		if round == maxAIToolRounds {
+			return nil, errAIToolRounds
 		}
-	}
 
-	return "", fmt.Errorf("no text response from Anthropic")
+		// Send the tool calls back with their results
+		toolResults := make([]map[string]interface{}, len(calls))
+		for i, call := range calls {
+			toolResults[i] = map[string]interface{}{
+				"type":        "tool_result",
+				"tool_use_id": call.ID,
+				"content":     a.runAITool(ctx, tools, session, call),
+			}
+		}
+		messages = append(messages,
+			map[string]interface{}{"role": "assistant", "content": result.Content},
+			map[string]interface{}{"role": "user", "content": toolResults},
+		)
+	}
 }
 
-// generateGoogleResponse generates a response using Google Gemini API
-func (a *App) generateGoogleResponse(settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) (string, error) {
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s",
-		settings.AI.Model, settings.AI.APIKey)
+// generateGoogleResponse generates a response using Google Gemini API. Function
+// calls are executed and their results sent back until the model answers.
+func (a *App) generateGoogleResponse(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string, contextData string) (*aiCompletion, error) {
+	url := fmt.Sprintf("%s/models/%s:generateContent?key=%s", googleAIBaseURL, settings.AI.Model, settings.AI.APIKey)
+	tools := availableAITools(settings)
 
 	// Build contents array
-	contents := []map[string]interface{}{}
+	contents := []interface{}{}
 
 	// Add conversation history if enabled
-	if settings.AI.IncludeHistory && session != nil {
-		history := a.getSessionHistory(session.ID, settings.AI.HistoryLimit)
-		for _, msg := range history {
-			role := "user"
-			if msg.Direction == models.DirectionOutgoing {
-				role = "model"
-			}
-			contents = append(contents, map[string]interface{}{
-				"role": role,
-				"parts": []map[string]string{
-					{"text": msg.Message},
-				},
-			})
+	for _, msg := range a.aiConversationHistory(settings, session, userMessage) {
+		role := "user"
+		if msg.Direction == models.DirectionOutgoing {
+			role = "model"
 		}
+		contents = append(contents, map[string]interface{}{
+			"role": role,
+			"parts": []map[string]string{
+				{"text": msg.Message},
+			},
+		})
 	}
 
 	// Add current user message
@@ -2062,7 +2917,6 @@ func (a *App) generateGoogleResponse(settings *models.ChatbotSettings, session *
 	})
 
 	payload := map[string]interface{}{
-		"contents": contents,
 		"generationConfig": map[string]interface{}{
 			"maxOutputTokens": settings.AI.MaxTokens,
 		},
@@ -2090,63 +2944,141 @@ func (a *App) generateGoogleResponse(settings *models.ChatbotSettings, session *
 	if settings.AI.Temperature > 0 {
 		payload["generationConfig"].(map[string]interface{})["temperature"] = settings.AI.Temperature
 	}
-
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal payload: %w", err)
+	if len(tools) > 0 {
+		payload["tools"] = googleToolDefinitions(tools)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+	if stream := aiStreamFromContext(ctx); stream != nil && len(tools) == 0 {
+		payload["contents"] = contents
+		return a.streamGoogleResponse(ctx, stream, settings, payload)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	completion := &aiCompletion{}
+	for round := 0; ; round++ {
+		payload["contents"] = contents
+		status, body, err := a.postAIRequest(ctx, a.aiClient(models.AIProviderGoogle), url, nil, payload)
+		if err != nil {
+			return nil, err
+		}
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
+		if status != 200 {
+			var errResp struct {
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			_ = json.Unmarshal(body, &errResp)
+			return nil, aiStatusError(status, fmt.Errorf("google AI API error: %s", errResp.Error.Message))
+		}
 
-	body, _ := io.ReadAll(resp.Body)
+		var result struct {
+			Candidates []struct {
+				Content json.RawMessage `json:"content"`
+			} `json:"candidates"`
+			UsageMetadata struct {
+				PromptTokenCount     int `json:"promptTokenCount"`
+				CandidatesTokenCount int `json:"candidatesTokenCount"`
+			} `json:"usageMetadata"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		completion.PromptTokens += result.UsageMetadata.PromptTokenCount
+		completion.CompletionTokens += result.UsageMetadata.CandidatesTokenCount
+
+		if len(result.Candidates) == 0 || len(result.Candidates[0].Content) == 0 {
+			return nil, fmt.Errorf("no response from Google AI")
+		}
+
+		var content struct {
+			Parts []struct {
+				Text         string `json:"text"`
+				FunctionCall *struct {
+					Name string          `json:"name"`
+					Args json.RawMessage `json:"args"`
+				} `json:"functionCall"`
+			} `json:"parts"`
+		}
+		if err := json.Unmarshal(result.Candidates[0].Content, &content); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		var calls []aiToolCall
+		for _, part := range content.Parts {
+			if part.FunctionCall != nil {
+				calls = append(calls, aiToolCall{Name: part.FunctionCall.Name, Arguments: part.FunctionCall.Args})
+			}
+		}
 
-	if resp.StatusCode != 200 {
-		var errResp struct {
-			Error struct {
-				Message string `json:"message"`
-			} `json:"error"`
+		if len(calls) == 0 {
+			if len(content.Parts) == 0 {
+				return nil, fmt.Errorf("no response from Google AI")
+			}
+			completion.Text = strings.TrimSpace(content.Parts[0].Text)
+			return completion, nil
+		}
+		if round == maxAIToolRounds {
+			return nil, errAIToolRounds
+		}
+
+		// Send the function calls back with their results
+		responses := make([]map[string]interface{}, len(calls))
+		for i, call := range calls {
+			responses[i] = map[string]interface{}{
+				"functionResponse": map[string]interface{}{
+					"name":     call.Name,
+					"response": map[string]string{"result": a.runAITool(ctx, tools, session, call)},
+				},
+			}
 		}
-		_ = json.Unmarshal(body, &errResp)
-		return "", fmt.Errorf("google AI API error: %s", errResp.Error.Message)
+		contents = append(contents,
+			result.Candidates[0].Content,
+			map[string]interface{}{"role": "user", "parts": responses},
+		)
 	}
+}
 
-	var result struct {
-		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
-		} `json:"candidates"`
+// aiConversationHistory returns the session's recent messages to send with an AI
+// request, oldest first, within the configured history length and TTL. With history
+// summarization, the messages after the session's summary are sent instead, within
+// the token budget.
+func (a *App) aiConversationHistory(settings *models.ChatbotSettings, session *models.ChatbotSession, userMessage string) []models.ChatbotSessionMessage {
+	if !settings.AI.IncludeHistory || session == nil || settings.AI.HistoryLimit <= 0 {
+		return nil
 	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+	var since time.Time
+	if settings.AI.HistoryTTLMinutes > 0 {
+		since = time.Now().Add(-time.Duration(settings.AI.HistoryTTLMinutes) * time.Minute)
 	}
-
-	if len(result.Candidates) > 0 && len(result.Candidates[0].Content.Parts) > 0 {
-		return strings.TrimSpace(result.Candidates[0].Content.Parts[0].Text), nil
+	if settings.AI.SummarizeHistory {
+		return a.summarizedConversationHistory(settings, session, userMessage, since)
 	}
+	// Fetch one extra message: the message being answered is usually logged already
+	history := a.getSessionHistory(session.ID, settings.AI.HistoryLimit+1, since)
+	return trimAIHistory(history, userMessage, settings.AI.HistoryLimit)
+}
 
-	return "", fmt.Errorf("no response from Google AI")
+// trimAIHistory drops the message being answered from the end of the history,
+// since providers receive it separately, and keeps the last limit messages
+func trimAIHistory(history []models.ChatbotSessionMessage, userMessage string, limit int) []models.ChatbotSessionMessage {
+	if n := len(history); n > 0 && history[n-1].Direction == models.DirectionIncoming && history[n-1].Message == userMessage {
+		history = history[:n-1]
+	}
+	if len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	return history
 }
 
-// getSessionHistory retrieves recent messages from the session
-func (a *App) getSessionHistory(sessionID uuid.UUID, limit int) []models.ChatbotSessionMessage {
+// getSessionHistory retrieves recent messages from the session, optionally only
+// those created after since
+func (a *App) getSessionHistory(sessionID uuid.UUID, limit int, since time.Time) []models.ChatbotSessionMessage {
 	var messages []models.ChatbotSessionMessage
-	a.DB.Where("session_id = ?", sessionID).
-		Order("created_at DESC").
+	query := a.DB.Where("session_id = ?", sessionID)
+	if !since.IsZero() {
+		query = query.Where("created_at > ?", since)
+	}
+	query.Order("created_at DESC").
 		Limit(limit).
 		Find(&messages)
 
@@ -2160,9 +3092,10 @@ func (a *App) getSessionHistory(sessionID uuid.UUID, limit int) []models.Chatbot
 
 // Reaction represents a reaction on a message
 type Reaction struct {
-	Emoji     string `json:"emoji"`
-	FromPhone string `json:"from_phone,omitempty"` // Phone number if from contact
-	FromUser  string `json:"from_user,omitempty"`  // User ID if from agent
+	Emoji       string `json:"emoji"`
+	FromPhone   string `json:"from_phone,omitempty"`   // Phone number if from contact
+	FromUser    string `json:"from_user,omitempty"`    // User ID if from agent
+	FromChatbot bool   `json:"from_chatbot,omitempty"` // Set by a flow reaction step
 }
 
 // handleIncomingReaction handles incoming reaction messages from WhatsApp
@@ -2178,14 +3111,14 @@ func (a *App) handleIncomingReaction(account *models.WhatsAppAccount, fromPhone,
 	// has different WAMIDs from sender vs recipient perspective.
 	// We match on the suffix after "FQIA" + 4 chars (type indicator like "ERgS" or "EhgU")
 	var message models.Message
-	if err := a.DB.Where("whats_app_message_id = ?", messageWAMID).First(&message).Error; err != nil {
+	if err := a.DB.Where("organization_id = ? AND whats_app_message_id = ?", account.OrganizationID, messageWAMID).First(&message).Error; err != nil {
 		// Try matching on WAMID suffix (the unique message ID part)
 		if idx := strings.Index(messageWAMID, "FQIA"); idx != -1 {
 			// Extract suffix after "FQIA" + 4 char type indicator (e.g., "ERgS", "EhgU")
 			suffixStart := idx + 8
 			if suffixStart < len(messageWAMID) {
 				suffix := messageWAMID[suffixStart:]
-				if err := a.DB.Where("whats_app_message_id LIKE ?", "%"+suffix).First(&message).Error; err != nil {
+				if err := a.DB.Where("organization_id = ? AND whats_app_message_id LIKE ?", account.OrganizationID, "%"+suffix).First(&message).Error; err != nil {
 					a.Log.Warn("Message not found for reaction", "wamid", messageWAMID, "suffix", suffix)
 					return
 				}
@@ -2202,67 +3135,24 @@ func (a *App) handleIncomingReaction(account *models.WhatsAppAccount, fromPhone,
 	// Get or create contact
 	contact, _ := a.getOrCreateContact(account.OrganizationID, fromPhone, profileName)
 
-	// Parse existing reactions from Metadata
-	var metadata map[string]interface{}
-	if message.Metadata != nil {
-		metadata = message.Metadata
-	} else {
-		metadata = make(map[string]interface{})
-	}
-
-	// Get or initialize reactions array
-	var reactions []Reaction
-	if reactionsRaw, ok := metadata["reactions"]; ok {
-		if reactionsArray, ok := reactionsRaw.([]interface{}); ok {
-			for _, r := range reactionsArray {
-				if rMap, ok := r.(map[string]interface{}); ok {
-					emoji, _ := rMap["emoji"].(string)
-					reactions = append(reactions, Reaction{
-						Emoji:     emoji,
-						FromPhone: getStringFromMap(rMap, "from_phone"),
-						FromUser:  getStringFromMap(rMap, "from_user"),
-					})
-				}
-			}
-		}
-	}
-
-	// Remove existing reaction from this contact (each contact can only have one reaction)
-	var newReactions []Reaction
-	for _, r := range reactions {
-		if r.FromPhone != fromPhone {
-			newReactions = append(newReactions, r)
-		}
-	}
-
-	// Add new reaction if emoji is not empty (empty = remove reaction)
-	if emoji != "" {
-		newReactions = append(newReactions, Reaction{
-			Emoji:     emoji,
-			FromPhone: fromPhone,
-		})
-	}
-
-	// Update metadata
-	metadata["reactions"] = newReactions
-
-	// Save to database
-	if err := a.DB.Model(&message).Update("metadata", metadata).Error; err != nil {
+	// Each contact can only have one reaction, an empty emoji removes it
+	newReactions, err := a.saveReaction(account.OrganizationID, contact.ID, &message, Reaction{Emoji: emoji, FromPhone: fromPhone})
+	if err != nil {
 		a.Log.Error("Failed to update message reactions", "error", err)
 		return
 	}
 
 	a.Log.Info("Updated message reaction", "message_id", message.ID, "reactions_count", len(newReactions))
 
-	// Broadcast via WebSocket
-	if a.WSHub != nil {
-		a.WSHub.BroadcastToOrg(account.OrganizationID, websocket.WSMessage{
-			Type: "reaction_update",
-			Payload: map[string]any{
-				"message_id": message.ID.String(),
-				"contact_id": contact.ID.String(),
-				"reactions":  newReactions,
-			},
+	// Removing a reaction does not trigger the event
+	if emoji != "" {
+		a.DispatchWebhook(account.OrganizationID, models.WebhookEventMessageReaction, ReactionEventData{
+			ContactID:       contact.ID.String(),
+			ContactPhone:    contact.PhoneNumber,
+			ContactName:     contact.ProfileName,
+			Emoji:           emoji,
+			Message:         referencedMessageData(&message),
+			WhatsAppAccount: account.Name,
 		})
 	}
 }
@@ -2284,8 +3174,9 @@ type MediaInfo struct {
 	MediaFilename string
 }
 
-// saveIncomingMessage saves an incoming message to the messages table
-func (a *App) saveIncomingMessage(account *models.WhatsAppAccount, contact *models.Contact, whatsappMsgID, msgType, content string, mediaInfo *MediaInfo, replyToWAMID string) {
+// saveIncomingMessage saves an incoming message to the messages table. It returns
+// the saved message, or nil when it couldn't be saved.
+func (a *App) saveIncomingMessage(account *models.WhatsAppAccount, contact *models.Contact, whatsappMsgID, msgType, content string, mediaInfo *MediaInfo, replyToWAMID string) *models.Message {
 	now := time.Now()
 
 	message := models.Message{
@@ -2318,9 +3209,14 @@ func (a *App) saveIncomingMessage(account *models.WhatsAppAccount, contact *mode
 		message.MediaFilename = mediaInfo.MediaFilename
 	}
 
+	// Keep the coordinates of shared locations queryable
+	if msgType == string(models.MessageTypeLocation) {
+		message.Latitude, message.Longitude = locationCoordinates(content)
+	}
+
 	if err := a.DB.Create(&message).Error; err != nil {
 		a.Log.Error("Failed to save incoming message", "error", err)
-		return
+		return nil
 	}
 
 	// Update contact's last message info
@@ -2335,10 +3231,21 @@ func (a *App) saveIncomingMessage(account *models.WhatsAppAccount, contact *mode
 	a.DB.Model(contact).Updates(map[string]interface{}{
 		"last_message_at":      now,
 		"last_message_preview": preview,
+		"last_inbound_at":      now,
 		"is_read":              false,
 		"whats_app_account":    account.Name,
 	})
 
+	// The customer replied, so pending follow-ups no longer apply and they may leave
+	// their sequences. STOP and START style keywords change their opt-in status, a
+	// helpdesk ticket of their handoff gets the message, and campaign messages they
+	// got count as replied to.
+	a.resolveFollowUps(contact.ID)
+	a.handleConsentKeywords(contact, content)
+	a.exitSequencesOnReply(contact, content)
+	a.addHelpdeskComment(contact, &message)
+	a.recordCampaignReply(contact)
+
 	a.Log.Info("Saved incoming message", "message_id", message.ID, "contact_id", contact.ID, "media_url", message.MediaURL)
 
 	// Broadcast new message via WebSocket
@@ -2395,11 +3302,36 @@ func (a *App) saveIncomingMessage(account *models.WhatsAppAccount, contact *mode
 		WhatsAppAccount: account.Name,
 		Direction:       models.DirectionIncoming,
 	})
+
+	return &message
 }
 
-// isWithinBusinessHours checks if current time is within configured business hours
-func (a *App) isWithinBusinessHours(businessHours models.JSONBArray) bool {
-	now := time.Now()
+// dispatchButtonReply emits the button reply event for a saved button tap or list
+// selection, with the message it answers when the contact replied to one
+func (a *App) dispatchButtonReply(account *models.WhatsAppAccount, contact *models.Contact, message *models.Message, replyType, buttonID, buttonTitle string) {
+	data := ButtonReplyEventData{
+		MessageID:       message.ID.String(),
+		ContactID:       contact.ID.String(),
+		ContactPhone:    contact.PhoneNumber,
+		ContactName:     contact.ProfileName,
+		ReplyType:       replyType,
+		ButtonID:        buttonID,
+		ButtonTitle:     buttonTitle,
+		WhatsAppAccount: account.Name,
+	}
+	if message.ReplyToMessageID != nil {
+		var replyTo models.Message
+		if err := a.DB.Where("id = ? AND organization_id = ?", *message.ReplyToMessageID, account.OrganizationID).First(&replyTo).Error; err == nil {
+			ref := referencedMessageData(&replyTo)
+			data.ReplyTo = &ref
+		}
+	}
+	a.DispatchWebhook(account.OrganizationID, models.WebhookEventButtonReply, data)
+}
+
+// isWithinBusinessHours checks if now is within configured business hours.
+// now must already be in the business hours timezone.
+func isWithinBusinessHours(businessHours models.JSONBArray, now time.Time) bool {
 	currentDay := int(now.Weekday()) // 0 = Sunday, 1 = Monday, etc.
 	currentTime := now.Format("15:04")
 
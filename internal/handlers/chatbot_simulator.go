@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// maxSimulatedMessages caps how many messages a simulation replays
+const maxSimulatedMessages = 20
+
+// SimulatedMessage is a message a simulated contact sends the chatbot
+type SimulatedMessage struct {
+	Message  string `json:"message"`
+	ButtonID string `json:"button_id,omitempty"` // Set when the message is a tap on a reply button or list option with this ID
+}
+
+// SimulateChatbotRequest is a message to try the chatbot with
+type SimulateChatbotRequest struct {
+	PhoneNumber     string             `json:"phone_number"`
+	WhatsAppAccount string             `json:"whatsapp_account"` // The default outgoing account when empty
+	Message         string             `json:"message"`
+	ButtonID        string             `json:"button_id"`
+	History         []SimulatedMessage `json:"history"` // Earlier messages of the conversation, replayed first
+}
+
+// SimulateChatbotResponse is what the chatbot would do with a message
+type SimulateChatbotResponse struct {
+	Replies            []map[string]interface{} `json:"replies"` // WhatsApp Cloud API message payloads
+	TransferredToAgent bool                     `json:"transferred_to_agent"`
+}
+
+// SimulateChatbot runs a message through the chatbot's keyword rules, flows and AI as
+// if a contact had sent it, and returns the replies the chatbot would send. Nothing
+// is sent to WhatsApp, and the contact, session and messages of the simulated
+// conversation are rolled back afterwards.
+func (a *App) SimulateChatbot(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	var req SimulateChatbotRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	phone := searchPhoneDigits(req.PhoneNumber)
+	if len(phone) < 7 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "A valid phone_number is required", nil, "")
+	}
+	messages := append(req.History, SimulatedMessage{Message: req.Message, ButtonID: req.ButtonID})
+	if len(messages) > maxSimulatedMessages {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("At most %d messages can be simulated", maxSimulatedMessages), nil, "")
+	}
+	for _, m := range messages {
+		if strings.TrimSpace(m.Message) == "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "message is required", nil, "")
+		}
+	}
+
+	account, err := a.resolveWhatsAppAccount(orgID, req.WhatsAppAccount)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	result, err := a.simulateChatbot(r.RequestCtx, account, phone, messages)
+	if err != nil {
+		a.Log.Error("Failed to simulate chatbot", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to simulate chatbot", nil, "")
+	}
+	return r.SendEnvelope(result)
+}
+
+// simulateChatbot processes messages from a phone number on an App whose database
+// is a transaction that is rolled back, and whose WhatsApp client records messages
+// instead of sending them. The replies are those to the last message.
+func (a *App) simulateChatbot(ctx context.Context, account *models.WhatsAppAccount, phone string, messages []SimulatedMessage) (*SimulateChatbotResponse, error) {
+	tx := a.DB.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer tx.Rollback()
+
+	transport := &simulationTransport{}
+	waClient := whatsapp.New(a.Log)
+	waClient.HTTPClient.Transport = transport
+	sim := &App{
+		Config:         a.CurrentConfig(),
+		DB:             tx,
+		Redis:          a.Redis,
+		Log:            a.Log,
+		WhatsApp:       waClient,
+		HTTPTransports: a.HTTPTransports,
+		Media:          a.Media,
+		simulation:     transport,
+	}
+
+	for _, m := range messages {
+		transport.reset()
+		if err := sim.processIncomingMessageFull(ctx, account.PhoneID, simulatedIncomingMessage(phone, m), ""); err != nil {
+			return nil, err
+		}
+		// Typing indicators and other background sends use the transaction too
+		sim.wg.Wait()
+	}
+
+	result := &SimulateChatbotResponse{Replies: transport.messages()}
+	var contact models.Contact
+	if err := tx.Where("organization_id = ? AND phone_number = ?", account.OrganizationID, phone).First(&contact).Error; err == nil {
+		result.TransferredToAgent = sim.hasActiveAgentTransfer(account.OrganizationID, contact.ID)
+	}
+	return result, nil
+}
+
+// simulatedIncomingMessage is a simulated message as it would come in from the webhook
+func simulatedIncomingMessage(phone string, m SimulatedMessage) IncomingTextMessage {
+	payload := map[string]interface{}{
+		"from":      phone,
+		"id":        "wamid.simulated." + uuid.NewString(),
+		"timestamp": strconv.FormatInt(time.Now().Unix(), 10),
+		"type":      "text",
+		"text":      map[string]string{"body": m.Message},
+	}
+	if m.ButtonID != "" {
+		payload["type"] = "interactive"
+		payload["interactive"] = map[string]interface{}{
+			"type":         "button_reply",
+			"button_reply": map[string]string{"id": m.ButtonID, "title": m.Message},
+		}
+	}
+
+	var msg IncomingTextMessage
+	data, _ := json.Marshal(payload)
+	_ = json.Unmarshal(data, &msg)
+	return msg
+}
+
+// simulationTransport stands in for the WhatsApp Cloud API in a chatbot simulation.
+// Messages are recorded instead of sent, and every call succeeds.
+type simulationTransport struct {
+	mu      sync.Mutex
+	replies []map[string]interface{}
+}
+
+func (t *simulationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var payload map[string]interface{}
+	if req.Body != nil {
+		_ = json.NewDecoder(req.Body).Decode(&payload)
+		_ = req.Body.Close()
+	}
+
+	// Read receipts and typing indicators are posted to the messages endpoint too
+	if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/messages") && payload != nil && payload["status"] == nil {
+		delete(payload, "messaging_product")
+		delete(payload, "recipient_type")
+		delete(payload, "to")
+		t.mu.Lock()
+		t.replies = append(t.replies, payload)
+		t.mu.Unlock()
+	}
+
+	body := fmt.Sprintf(`{"success":true,"id":"simulated","messages":[{"id":"wamid.simulated.%s"}]}`, uuid.NewString())
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func (t *simulationTransport) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.replies = nil
+}
+
+func (t *simulationTransport) messages() []map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]map[string]interface{}{}, t.replies...)
+}
@@ -0,0 +1,83 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_SimulateChatbot(t *testing.T) {
+	app := agentTransfersTestApp(t)
+	org := createTransferTestOrg(t, app)
+	account := createTransferTestAccount(t, app, org.ID)
+
+	require.NoError(t, app.DB.Create(&models.ChatbotSettings{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		WhatsAppAccount: account.Name,
+		IsEnabled:       true,
+	}).Error)
+	for _, rule := range []models.KeywordRule{
+		{Name: "Hours", Keywords: models.StringArray{"hours"}, ResponseType: models.ResponseTypeText,
+			ResponseContent: models.JSONB{"body": "We're open 9-5."}},
+		{Name: "Agent", Keywords: models.StringArray{"agent"}, ResponseType: models.ResponseTypeTransfer,
+			ResponseContent: models.JSONB{"body": "Connecting you to an agent."}},
+	} {
+		rule.ID = uuid.New()
+		rule.OrganizationID = org.ID
+		rule.WhatsAppAccount = account.Name
+		rule.IsEnabled = true
+		rule.MatchType = models.MatchTypeContains
+		require.NoError(t, app.DB.Create(&rule).Error)
+	}
+
+	simulate := func(body map[string]interface{}) (int, handlers.SimulateChatbotResponse) {
+		t.Helper()
+		req := testutil.NewJSONRequest(t, body)
+		req.RequestCtx.SetUserValue("organization_id", org.ID)
+		require.NoError(t, app.SimulateChatbot(req))
+
+		var resp struct {
+			Data handlers.SimulateChatbotResponse `json:"data"`
+		}
+		_ = json.Unmarshal(testutil.GetResponseBody(req), &resp)
+		return testutil.GetResponseStatusCode(req), resp.Data
+	}
+
+	status, resp := simulate(map[string]interface{}{
+		"phone_number": "+1 555 010 0001", "whatsapp_account": account.Name, "message": "What are your hours?",
+	})
+	require.Equal(t, fasthttp.StatusOK, status)
+	require.Len(t, resp.Replies, 1)
+	assert.Equal(t, "text", resp.Replies[0]["type"])
+	assert.Equal(t, map[string]interface{}{"body": "We're open 9-5."}, resp.Replies[0]["text"])
+	assert.False(t, resp.TransferredToAgent)
+
+	status, resp = simulate(map[string]interface{}{
+		"phone_number": "15550100001", "whatsapp_account": account.Name, "message": "agent please",
+		"history": []map[string]string{{"message": "hours?"}},
+	})
+	require.Equal(t, fasthttp.StatusOK, status)
+	require.Len(t, resp.Replies, 1, "only the replies to the last message are returned")
+	assert.Equal(t, map[string]interface{}{"body": "Connecting you to an agent."}, resp.Replies[0]["text"])
+	assert.True(t, resp.TransferredToAgent)
+
+	// Nothing of the simulated conversations is kept
+	var count int64
+	app.DB.Model(&models.Contact{}).Where("organization_id = ? AND phone_number = ?", org.ID, "15550100001").Count(&count)
+	assert.Zero(t, count)
+	app.DB.Model(&models.AgentTransfer{}).Where("organization_id = ?", org.ID).Count(&count)
+	assert.Zero(t, count)
+
+	status, _ = simulate(map[string]interface{}{"phone_number": "123", "message": "hi"})
+	assert.Equal(t, fasthttp.StatusBadRequest, status)
+	status, _ = simulate(map[string]interface{}{"phone_number": "15550100001", "message": " "})
+	assert.Equal(t, fasthttp.StatusBadRequest, status)
+}
@@ -0,0 +1,56 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_UpdateChatbotSettings_Temperature(t *testing.T) {
+	app := agentTransfersTestApp(t)
+	if app.Redis == nil {
+		t.Skip("TEST_REDIS_URL not set, skipping test that saves chatbot settings")
+	}
+	org := createTransferTestOrg(t, app)
+
+	update := func(body map[string]any) *fasthttp.RequestCtx {
+		req := testutil.NewJSONRequest(t, body)
+		req.RequestCtx.SetUserValue("organization_id", org.ID)
+		require.NoError(t, app.UpdateChatbotSettings(req))
+		return req.RequestCtx
+	}
+
+	tests := []struct {
+		name   string
+		body   map[string]any
+		status int
+	}{
+		{"openai accepts up to 2", map[string]any{"ai_provider": "openai", "ai_temperature": 2}, fasthttp.StatusOK},
+		{"openai rejects over 2", map[string]any{"ai_provider": "openai", "ai_temperature": 2.1}, fasthttp.StatusBadRequest},
+		{"negative is rejected", map[string]any{"ai_provider": "google", "ai_temperature": -0.1}, fasthttp.StatusBadRequest},
+		{"anthropic accepts up to 1", map[string]any{"ai_provider": "anthropic", "ai_temperature": 1}, fasthttp.StatusOK},
+		{"anthropic rejects over 1", map[string]any{"ai_provider": "anthropic", "ai_temperature": 1.5}, fasthttp.StatusBadRequest},
+		{"the saved provider is used", map[string]any{"ai_temperature": 1.2}, fasthttp.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := update(tt.body)
+			assert.Equal(t, tt.status, ctx.Response.StatusCode(), string(ctx.Response.Body()))
+		})
+	}
+
+	// Switching to Anthropic is rejected while the saved temperature is too high for it
+	require.Equal(t, fasthttp.StatusOK, update(map[string]any{"ai_provider": "openai", "ai_temperature": 1.5}).Response.StatusCode())
+	ctx := update(map[string]any{"ai_provider": "anthropic"})
+	assert.Equal(t, fasthttp.StatusBadRequest, ctx.Response.StatusCode())
+	assert.Contains(t, string(ctx.Response.Body()), "between 0 and 1")
+
+	var settings models.ChatbotSettings
+	require.NoError(t, app.DB.Where("organization_id = ?", org.ID).First(&settings).Error)
+	assert.Equal(t, models.AIProviderOpenAI, settings.AI.Provider)
+	assert.Equal(t, 1.5, settings.AI.Temperature)
+}
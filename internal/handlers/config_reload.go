@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// ReloadConfig reloads this server's configuration from its config file, applying
+// the sections read when used, and returns the sections that changed. The reloaded
+// configuration replaces the current one, which requests being handled keep reading.
+func (a *App) ReloadConfig() ([]string, error) {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	next, changed, err := a.CurrentConfig().Reload(a.ConfigPath)
+	if err != nil {
+		a.Log.Error("Failed to reload configuration, keeping the current one", "error", err)
+		return nil, err
+	}
+	a.liveConfig.Store(next)
+
+	// AI clients have the timeouts they were created with
+	if slices.Contains(changed, "ai") {
+		a.aiClients.Range(func(provider, _ any) bool {
+			a.aiClients.Delete(provider)
+			return true
+		})
+	}
+
+	if len(changed) > 0 {
+		a.Log.Info("Configuration reloaded", "sections", changed)
+	} else {
+		a.Log.Info("Configuration reloaded, nothing changed")
+	}
+	return changed, nil
+}
+
+// StartConfigReloadSubscriber reloads the configuration whenever a server is asked
+// to reload it for all servers, until ctx is done
+func (a *App) StartConfigReloadSubscriber(ctx context.Context) error {
+	return queue.NewSubscriber(a.Redis, a.Log).SubscribeConfigReload(ctx, func() {
+		_, _ = a.ReloadConfig()
+	})
+}
+
+// ReloadAllConfig reloads the configuration of this server and tells the other
+// servers to reload theirs (super admin only). Each server reads its own config
+// file, so the files must have been updated on all of them.
+func (a *App) ReloadAllConfig(r *fastglue.Request) error {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.IsSuperAdmin(userID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only super admins can reload the configuration", nil, "")
+	}
+
+	changed, err := a.ReloadConfig()
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Configuration not reloaded: "+err.Error(), nil, "")
+	}
+	a.Log.Info("Configuration reload requested", "user_id", userID)
+
+	if err := queue.NewPublisher(a.Redis, a.Log).PublishConfigReload(context.Background()); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Reloaded this server, but failed to notify the others", nil, "")
+	}
+
+	if changed == nil {
+		changed = []string{}
+	}
+	return r.SendEnvelope(map[string]interface{}{
+		"changed": changed,
+	})
+}
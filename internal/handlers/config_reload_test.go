@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reloadTestConfig = `
+[database]
+host = "localhost"
+user = "whatomate"
+name = "whatomate"
+
+[redis]
+host = "localhost"
+
+[jwt]
+secret = "test-secret-key-must-be-at-least-32-chars"
+`
+
+func TestReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte(reloadTestConfig+"\n[health]\ntimeout_ms = 1000\n"), 0o600))
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	app := &App{Config: cfg, ConfigPath: path, Log: testutil.NopLogger()}
+
+	require.NoError(t, os.WriteFile(path, []byte(reloadTestConfig+"\n[health]\ntimeout_ms = 500\n"), 0o600))
+
+	// Requests keep reading the configuration while it's reloaded
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			_ = app.CurrentConfig().Health.TimeoutMs
+		}
+	}()
+	changed, err := app.ReloadConfig()
+	wg.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"health"}, changed)
+	assert.Equal(t, 500, app.CurrentConfig().Health.TimeoutMs)
+	assert.Equal(t, 1000, cfg.Health.TimeoutMs, "the configuration read before the reload isn't changed")
+
+	// An invalid configuration is reported and the current one kept
+	require.NoError(t, os.WriteFile(path, []byte("[jwt]\nsecret = \"short\"\n"), 0o600))
+	_, err = app.ReloadConfig()
+	assert.Error(t, err)
+	assert.Equal(t, 500, app.CurrentConfig().Health.TimeoutMs)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// SetContactAIRequest turns AI responses on or off for a single conversation
+type SetContactAIRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// SetContactAI disables or re-enables AI responses for a contact's conversation.
+// The chatbot's AI setting is left unchanged; keyword rules and flows still run.
+func (a *App) SetContactAI(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	contactID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact ID", nil, "")
+	}
+
+	var req SetContactAIRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if req.Enabled == nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "enabled is required", nil, "")
+	}
+
+	var contact models.Contact
+	query := a.DB.Where("id = ? AND organization_id = ?", contactID, orgID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("assigned_user_id = ?", userID)
+	}
+	if err := query.First(&contact).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
+	}
+
+	if err := a.DB.Model(&contact).Update("ai_disabled", !*req.Enabled).Error; err != nil {
+		a.Log.Error("Failed to update contact AI setting", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update AI setting", nil, "")
+	}
+
+	a.Log.Info("Contact AI responses toggled", "contact_id", contact.ID, "enabled", *req.Enabled, "user_id", userID)
+
+	message := "AI responses disabled for this conversation"
+	if *req.Enabled {
+		message = "AI responses enabled for this conversation"
+	}
+	return r.SendEnvelope(map[string]interface{}{
+		"message":     message,
+		"ai_disabled": !*req.Enabled,
+	})
+}
@@ -0,0 +1,50 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_SetContactAI(t *testing.T) {
+	app := agentTransfersTestApp(t)
+	org := createTransferTestOrg(t, app)
+	user := createTransferTestUser(t, app, org.ID, nil)
+	contact := createTestContact(t, app, org.ID)
+
+	req := testutil.NewJSONRequest(t, map[string]any{"enabled": false})
+	setTransferAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	require.NoError(t, app.SetContactAI(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var stored models.Contact
+	require.NoError(t, app.DB.First(&stored, "id = ?", contact.ID).Error)
+	assert.True(t, stored.AIDisabled)
+
+	req = testutil.NewJSONRequest(t, map[string]any{"enabled": true})
+	setTransferAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	require.NoError(t, app.SetContactAI(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	require.NoError(t, app.DB.First(&stored, "id = ?", contact.ID).Error)
+	assert.False(t, stored.AIDisabled)
+}
+
+func TestApp_SetContactAI_RequiresEnabled(t *testing.T) {
+	app := agentTransfersTestApp(t)
+	org := createTransferTestOrg(t, app)
+	user := createTransferTestUser(t, app, org.ID, nil)
+	contact := createTestContact(t, app, org.ID)
+
+	req := testutil.NewJSONRequest(t, map[string]any{})
+	setTransferAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	require.NoError(t, app.SetContactAI(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "enabled is required")
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+)
+
+// contactCardsContent returns the content stored for a contacts message, as
+// [{"name", "phones", "emails", "company", "contact_id"}]. The chat renders it as
+// contact cards. contactIDs, when set, holds the contact saved for each card.
+func contactCardsContent(cards []whatsapp.ContactCard, contactIDs []uuid.UUID) string {
+	data := make([]map[string]any, 0, len(cards))
+	for i, card := range cards {
+		item := map[string]any{
+			"name": card.Name.FormattedName,
+		}
+		if len(card.Phones) > 0 {
+			phones := make([]string, 0, len(card.Phones))
+			for _, p := range card.Phones {
+				phones = append(phones, p.Phone)
+			}
+			item["phones"] = phones
+		}
+		if len(card.Emails) > 0 {
+			emails := make([]string, 0, len(card.Emails))
+			for _, e := range card.Emails {
+				emails = append(emails, e.Email)
+			}
+			item["emails"] = emails
+		}
+		if card.Org != nil && card.Org.Company != "" {
+			item["company"] = card.Org.Company
+		}
+		if i < len(contactIDs) && contactIDs[i] != uuid.Nil {
+			item["contact_id"] = contactIDs[i].String()
+		}
+		data = append(data, item)
+	}
+	content, _ := json.Marshal(data)
+	return string(content)
+}
+
+// contactCardsFromConfig reads the contacts configured on a flow step, as
+// {"contacts": [{"name", "phone", "email", "company"}]}, and checks them
+func contactCardsFromConfig(config map[string]interface{}) ([]whatsapp.ContactCard, error) {
+	raw, _ := config["contacts"].([]interface{})
+	cards := make([]whatsapp.ContactCard, 0, len(raw))
+	for _, c := range raw {
+		contactMap, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		card := whatsapp.ContactCard{
+			Name: whatsapp.ContactCardName{FormattedName: strings.TrimSpace(getStringFromMap(contactMap, "name"))},
+		}
+		if phone := strings.TrimSpace(getStringFromMap(contactMap, "phone")); phone != "" {
+			card.Phones = []whatsapp.ContactCardPhone{{Phone: phone, Type: "WORK"}}
+		}
+		if email := strings.TrimSpace(getStringFromMap(contactMap, "email")); email != "" {
+			card.Emails = []whatsapp.ContactCardEmail{{Email: email, Type: "WORK"}}
+		}
+		if company := strings.TrimSpace(getStringFromMap(contactMap, "company")); company != "" {
+			card.Org = &whatsapp.ContactCardOrg{Company: company}
+		}
+		cards = append(cards, card)
+	}
+	return cards, whatsapp.ValidateContactCards(cards)
+}
+
+// sharedContactPhone returns the number a shared contact is stored under: its
+// WhatsApp ID when the number is on WhatsApp, otherwise the digits of its first number
+func sharedContactPhone(card whatsapp.ContactCard) string {
+	for _, p := range card.Phones {
+		if p.WaID != "" {
+			return p.WaID
+		}
+	}
+	if len(card.Phones) > 0 {
+		return searchPhoneDigits(card.Phones[0].Phone)
+	}
+	return ""
+}
+
+// saveSharedContacts saves the contacts a contact shared as contacts of the
+// organization, returning the contact saved for each card (uuid.Nil for cards
+// without a number). Existing contacts are linked, not changed.
+func (a *App) saveSharedContacts(account *models.WhatsAppAccount, sharedBy *models.Contact, cards []whatsapp.ContactCard) []uuid.UUID {
+	contactIDs := make([]uuid.UUID, len(cards))
+	for i, card := range cards {
+		phone := sharedContactPhone(card)
+		if phone == "" {
+			continue
+		}
+
+		contact, created := a.getOrCreateContact(account.OrganizationID, phone, "")
+		if contact.ID == uuid.Nil {
+			continue
+		}
+		contactIDs[i] = contact.ID
+		if !created {
+			continue
+		}
+
+		metadata := models.JSONB{"shared_by_contact_id": sharedBy.ID.String()}
+		if len(card.Emails) > 0 {
+			metadata["email"] = card.Emails[0].Email
+		}
+		if card.Org != nil && card.Org.Company != "" {
+			metadata["company"] = card.Org.Company
+		}
+		if err := a.DB.Model(contact).Updates(map[string]any{
+			"profile_name":      card.Name.FormattedName,
+			"whats_app_account": account.Name,
+			"metadata":          metadata,
+		}).Error; err != nil {
+			a.Log.Error("Failed to update shared contact", "error", err, "contact_id", contact.ID)
+		}
+		a.Log.Info("Contact saved from shared contact card", "contact_id", contact.ID, "shared_by", sharedBy.ID)
+	}
+	return contactIDs
+}
+
+// sendAndSaveContactsMessage sends contact cards and saves the message to the database
+func (a *App) sendAndSaveContactsMessage(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, cards []whatsapp.ContactCard) error {
+	_, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account:  account,
+		Contact:  contact,
+		Type:     models.MessageTypeContacts,
+		Contacts: cards,
+	}, ChatbotSendOptions())
+	return err
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContactCardsContent(t *testing.T) {
+	contactID := uuid.New()
+	cards := []whatsapp.ContactCard{
+		{
+			Name:   whatsapp.ContactCardName{FormattedName: "Ana Ruiz"},
+			Phones: []whatsapp.ContactCardPhone{{Phone: "+34 600 000 000", WaID: "34600000000"}},
+			Emails: []whatsapp.ContactCardEmail{{Email: "ana@example.com"}},
+			Org:    &whatsapp.ContactCardOrg{Company: "Acme"},
+		},
+		{Name: whatsapp.ContactCardName{FormattedName: "Front desk"}},
+	}
+
+	content := contactCardsContent(cards, []uuid.UUID{contactID, uuid.Nil})
+	assert.JSONEq(t, `[
+		{"name": "Ana Ruiz", "phones": ["+34 600 000 000"], "emails": ["ana@example.com"], "company": "Acme", "contact_id": "`+contactID.String()+`"},
+		{"name": "Front desk"}
+	]`, content)
+
+	// Sent cards aren't linked to contacts
+	assert.JSONEq(t, `[{"name": "Front desk"}]`, contactCardsContent(cards[1:], nil))
+}
+
+func TestContactCardsFromConfig(t *testing.T) {
+	cards, err := contactCardsFromConfig(map[string]interface{}{
+		"contacts": []interface{}{
+			map[string]interface{}{"name": " Sales ", "phone": "+1 555 010 0001", "email": "sales@example.com", "company": "Acme"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []whatsapp.ContactCard{{
+		Name:   whatsapp.ContactCardName{FormattedName: "Sales"},
+		Phones: []whatsapp.ContactCardPhone{{Phone: "+1 555 010 0001", Type: "WORK"}},
+		Emails: []whatsapp.ContactCardEmail{{Email: "sales@example.com", Type: "WORK"}},
+		Org:    &whatsapp.ContactCardOrg{Company: "Acme"},
+	}}, cards)
+
+	_, err = contactCardsFromConfig(map[string]interface{}{
+		"contacts": []interface{}{map[string]interface{}{"name": "Sales"}},
+	})
+	assert.ErrorContains(t, err, `contact "Sales" needs a phone number`)
+
+	_, err = contactCardsFromConfig(map[string]interface{}{})
+	assert.ErrorContains(t, err, "at least one contact is required")
+}
+
+func TestSharedContactPhone(t *testing.T) {
+	// The WhatsApp ID wins over the number as typed
+	assert.Equal(t, "34600000000", sharedContactPhone(whatsapp.ContactCard{
+		Phones: []whatsapp.ContactCardPhone{{Phone: "+34 911 000 000"}, {Phone: "+34 600 000 000", WaID: "34600000000"}},
+	}))
+	assert.Equal(t, "15550100001", sharedContactPhone(whatsapp.ContactCard{
+		Phones: []whatsapp.ContactCardPhone{{Phone: "+1 (555) 010-0001"}},
+	}))
+	assert.Empty(t, sharedContactPhone(whatsapp.ContactCard{}))
+}
+
+func TestSaveSharedContacts(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Shared Contacts Org " + suffix,
+		Slug:      "shared-contacts-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{OrganizationID: org.ID, Name: "shop"}
+
+	sharedBy := &models.Contact{OrganizationID: org.ID, PhoneNumber: "15550100001", ProfileName: "Jane"}
+	existing := &models.Contact{OrganizationID: org.ID, PhoneNumber: "15550100002", ProfileName: "Bob"}
+	require.NoError(t, app.DB.Create(sharedBy).Error)
+	require.NoError(t, app.DB.Create(existing).Error)
+
+	ids := app.saveSharedContacts(account, sharedBy, []whatsapp.ContactCard{
+		{
+			Name:   whatsapp.ContactCardName{FormattedName: "Ana Ruiz"},
+			Phones: []whatsapp.ContactCardPhone{{Phone: "+1 555 010 0003", WaID: "15550100003"}},
+			Org:    &whatsapp.ContactCardOrg{Company: "Acme"},
+		},
+		{
+			Name:   whatsapp.ContactCardName{FormattedName: "Robert"},
+			Phones: []whatsapp.ContactCardPhone{{Phone: "+1 555 010 0002"}},
+		},
+		{Name: whatsapp.ContactCardName{FormattedName: "No number"}},
+	})
+	require.Len(t, ids, 3)
+	assert.Equal(t, existing.ID, ids[1])
+	assert.Equal(t, uuid.Nil, ids[2])
+
+	var created models.Contact
+	require.NoError(t, app.DB.First(&created, "id = ?", ids[0]).Error)
+	assert.Equal(t, "15550100003", created.PhoneNumber)
+	assert.Equal(t, "Ana Ruiz", created.ProfileName)
+	assert.Equal(t, "shop", created.WhatsAppAccount)
+	assert.Equal(t, sharedBy.ID.String(), created.Metadata["shared_by_contact_id"])
+	assert.Equal(t, "Acme", created.Metadata["company"])
+
+	// Existing contacts keep their name
+	require.NoError(t, app.DB.First(existing, "id = ?", existing.ID).Error)
+	assert.Equal(t, "Bob", existing.ProfileName)
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+const (
+	// consentKeywordsDefault holds the keywords that apply whatever the contact's language
+	consentKeywordsDefault = "default"
+	// maxConsentKeywordLength is the longest message checked for consent keywords
+	maxConsentKeywordLength = 50
+)
+
+var (
+	defaultOptOutKeywords = map[string][]string{consentKeywordsDefault: {"STOP", "UNSUBSCRIBE"}}
+	defaultOptInKeywords  = map[string][]string{consentKeywordsDefault: {"START", "SUBSCRIBE"}}
+)
+
+// ConsentSettings are the keywords contacts send to opt out of or back in to
+// messages, by language. Keywords under "default" apply to every contact; the
+// others to contacts whose language matches, or to all contacts whose language
+// isn't known yet.
+type ConsentSettings struct {
+	OptOutKeywords map[string][]string `json:"opt_out_keywords"`
+	OptInKeywords  map[string][]string `json:"opt_in_keywords"`
+}
+
+// ContactConsentEventResponse represents a change to a contact's opt-in status
+type ContactConsentEventResponse struct {
+	ID         uuid.UUID                   `json:"id"`
+	FromStatus models.ContactOptInStatus   `json:"from_status"`
+	ToStatus   models.ContactOptInStatus   `json:"to_status"`
+	Source     models.ContactConsentSource `json:"source"`
+	Keyword    string                      `json:"keyword,omitempty"`
+	UserID     *uuid.UUID                  `json:"user_id,omitempty"`
+	UserName   string                      `json:"user_name,omitempty"`
+	CreatedAt  time.Time                   `json:"created_at"`
+}
+
+// consentSettings reads the consent keywords from organization settings
+func consentSettings(settings models.JSONB) ConsentSettings {
+	consent := ConsentSettings{
+		OptOutKeywords: defaultOptOutKeywords,
+		OptInKeywords:  defaultOptInKeywords,
+	}
+	if raw, ok := settings["opt_out_keywords"].(map[string]interface{}); ok {
+		consent.OptOutKeywords = jsonbToConsentKeywords(raw)
+	}
+	if raw, ok := settings["opt_in_keywords"].(map[string]interface{}); ok {
+		consent.OptInKeywords = jsonbToConsentKeywords(raw)
+	}
+	return consent
+}
+
+// jsonbToConsentKeywords converts stored consent keywords back to their lists
+func jsonbToConsentKeywords(raw map[string]interface{}) map[string][]string {
+	keywords := make(map[string][]string, len(raw))
+	for language, list := range raw {
+		items, _ := list.([]interface{})
+		words := make([]string, 0, len(items))
+		for _, item := range items {
+			if s, ok := item.(string); ok {
+				words = append(words, s)
+			}
+		}
+		keywords[language] = words
+	}
+	return keywords
+}
+
+// consentKeywordsToJSONB converts consent keywords for organization settings
+func consentKeywordsToJSONB(keywords map[string][]string) map[string]interface{} {
+	raw := make(map[string]interface{}, len(keywords))
+	for language, words := range keywords {
+		items := make([]interface{}, len(words))
+		for i, w := range words {
+			items[i] = w
+		}
+		raw[language] = items
+	}
+	return raw
+}
+
+// cleanConsentKeywords trims and upper-cases consent keywords, dropping empty and
+// repeated ones. Languages are lower-cased.
+func cleanConsentKeywords(keywords map[string][]string) (map[string][]string, error) {
+	cleaned := make(map[string][]string, len(keywords))
+	for language, words := range keywords {
+		language = strings.ToLower(strings.TrimSpace(language))
+		if language == "" || len(language) > 10 {
+			return nil, fmt.Errorf("invalid keyword language %q", language)
+		}
+		list := cleaned[language]
+		for _, w := range words {
+			w = strings.ToUpper(strings.TrimSpace(w))
+			if w == "" {
+				continue
+			}
+			if len(w) > maxConsentKeywordLength {
+				return nil, fmt.Errorf("keyword %q is longer than %d characters", w, maxConsentKeywordLength)
+			}
+			if matchConsentKeyword(list, w) == "" {
+				list = append(list, w)
+			}
+		}
+		cleaned[language] = list
+	}
+	return cleaned, nil
+}
+
+// updatedConsentKeywords returns consent keywords after a settings update: the
+// current ones when none were given, the defaults for an empty object, and
+// otherwise the given ones cleaned up
+func updatedConsentKeywords(current, requested, defaults map[string][]string) (map[string][]string, error) {
+	switch {
+	case requested == nil:
+		return current, nil
+	case len(requested) == 0:
+		return defaults, nil
+	}
+	return cleanConsentKeywords(requested)
+}
+
+// validateConsentSettings checks that no keyword both opts a contact out and in
+func validateConsentSettings(consent ConsentSettings) error {
+	for language, words := range consent.OptOutKeywords {
+		// Default keywords apply alongside every language's
+		if language == consentKeywordsDefault {
+			language = ""
+		}
+		optIn := consentKeywordsFor(consent.OptInKeywords, language)
+		for _, w := range words {
+			if matchConsentKeyword(optIn, w) != "" {
+				return fmt.Errorf("%q can't be both an opt-out and an opt-in keyword", w)
+			}
+		}
+	}
+	return nil
+}
+
+// consentKeywordsFor returns the keywords that apply to a contact language: the
+// default ones and the language's, or every language's when it isn't known
+func consentKeywordsFor(keywords map[string][]string, language string) []string {
+	language = strings.ToLower(language)
+	var words []string
+	for lang, list := range keywords {
+		if language == "" || lang == consentKeywordsDefault || lang == language {
+			words = append(words, list...)
+		}
+	}
+	return words
+}
+
+// matchConsentKeyword returns the keyword a message is, ignoring case, surrounding
+// whitespace and trailing punctuation, or "" if it isn't one of them
+func matchConsentKeyword(keywords []string, text string) string {
+	text = strings.TrimFunc(text, func(r rune) bool {
+		return r == ' ' || r == '\n' || r == '\t' || r == '.' || r == '!' || r == '?'
+	})
+	for _, k := range keywords {
+		if strings.EqualFold(text, k) {
+			return k
+		}
+	}
+	return ""
+}
+
+// handleConsentKeywords opts a contact out or back in when their message is one of
+// the organization's consent keywords. Returns true if the status changed.
+func (a *App) handleConsentKeywords(contact *models.Contact, text string) bool {
+	if len(text) > maxConsentKeywordLength || strings.TrimSpace(text) == "" {
+		return false
+	}
+
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", contact.OrganizationID).First(&org).Error; err != nil {
+		return false
+	}
+	consent := consentSettings(org.Settings)
+
+	if keyword := matchConsentKeyword(consentKeywordsFor(consent.OptOutKeywords, contact.Language), text); keyword != "" {
+		return a.setContactOptIn(contact, models.ContactOptInStatusOptedOut, models.ContactConsentSourceKeyword, keyword)
+	}
+	if keyword := matchConsentKeyword(consentKeywordsFor(consent.OptInKeywords, contact.Language), text); keyword != "" {
+		return a.setContactOptIn(contact, models.ContactOptInStatusOptedIn, models.ContactConsentSourceKeyword, keyword)
+	}
+	return false
+}
+
+// setContactOptIn changes a contact's opt-in status on their own request and
+// records the change. Returns false if the status was already set.
+func (a *App) setContactOptIn(contact *models.Contact, status models.ContactOptInStatus, source models.ContactConsentSource, keyword string) bool {
+	from := contact.OptInStatus
+	if from == status {
+		return false
+	}
+
+	now := time.Now()
+	if err := a.DB.Model(&models.Contact{}).Where("id = ?", contact.ID).Updates(map[string]interface{}{
+		"opt_in_status":     status,
+		"opt_in_updated_at": now,
+	}).Error; err != nil {
+		a.Log.Error("Failed to update contact opt-in status", "error", err, "contact_id", contact.ID)
+		return false
+	}
+	contact.OptInStatus = status
+	contact.OptInUpdatedAt = &now
+
+	a.recordConsentChange(contact, from, source, keyword, nil)
+	return true
+}
+
+// recordConsentChange records that a contact's opt-in status changed from an
+// earlier one. Contacts who opt out leave the sequences they are in.
+func (a *App) recordConsentChange(contact *models.Contact, from models.ContactOptInStatus, source models.ContactConsentSource, keyword string, userID *uuid.UUID) {
+	if from == "" {
+		from = models.ContactOptInStatusUnknown
+	}
+	if contact.OptInStatus == from {
+		return
+	}
+
+	event := models.ContactConsentEvent{
+		OrganizationID: contact.OrganizationID,
+		ContactID:      contact.ID,
+		FromStatus:     from,
+		ToStatus:       contact.OptInStatus,
+		Source:         source,
+		Keyword:        keyword,
+		UserID:         userID,
+	}
+	if err := a.DB.Create(&event).Error; err != nil {
+		a.Log.Error("Failed to record consent change", "error", err, "contact_id", contact.ID)
+	}
+	a.Log.Info("Contact opt-in status changed", "contact_id", contact.ID, "from", from, "to", contact.OptInStatus, "source", source)
+
+	if contact.OptInStatus == models.ContactOptInStatusOptedOut {
+		a.exitSequencesOnOptOut(contact.ID)
+	}
+}
+
+// GetContactConsentHistory returns the changes to a contact's opt-in status, newest first
+func (a *App) GetContactConsentHistory(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var events []models.ContactConsentEvent
+	if err := a.DB.Where("organization_id = ? AND contact_id = ?", orgID, contact.ID).
+		Preload("User").
+		Order("created_at DESC").
+		Find(&events).Error; err != nil {
+		a.Log.Error("Failed to list consent history", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list consent history", nil, "")
+	}
+
+	history := make([]ContactConsentEventResponse, len(events))
+	for i, e := range events {
+		history[i] = ContactConsentEventResponse{
+			ID:         e.ID,
+			FromStatus: e.FromStatus,
+			ToStatus:   e.ToStatus,
+			Source:     e.Source,
+			Keyword:    e.Keyword,
+			UserID:     e.UserID,
+			CreatedAt:  e.CreatedAt,
+		}
+		if e.User != nil {
+			history[i].UserName = e.User.FullName
+		}
+	}
+
+	optIn := contact.OptInStatus
+	if optIn == "" {
+		optIn = models.ContactOptInStatusUnknown
+	}
+	return r.SendEnvelope(map[string]interface{}{
+		"opt_in_status":     optIn,
+		"opt_in_updated_at": contact.OptInUpdatedAt,
+		"history":           history,
+	})
+}
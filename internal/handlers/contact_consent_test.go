@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsentSettings(t *testing.T) {
+	consent := consentSettings(nil)
+	assert.Equal(t, defaultOptOutKeywords, consent.OptOutKeywords)
+	assert.Equal(t, defaultOptInKeywords, consent.OptInKeywords)
+
+	consent = consentSettings(models.JSONB{
+		"opt_out_keywords": consentKeywordsToJSONB(map[string][]string{"default": {"STOP"}, "es": {"BAJA"}}),
+	})
+	assert.Equal(t, map[string][]string{"default": {"STOP"}, "es": {"BAJA"}}, consent.OptOutKeywords)
+	assert.Equal(t, defaultOptInKeywords, consent.OptInKeywords)
+}
+
+func TestConsentKeywordsFor(t *testing.T) {
+	keywords := map[string][]string{"default": {"STOP"}, "es": {"BAJA"}, "fr": {"ARRET"}}
+
+	words := consentKeywordsFor(keywords, "ES")
+	sort.Strings(words)
+	assert.Equal(t, []string{"BAJA", "STOP"}, words)
+
+	words = consentKeywordsFor(keywords, "")
+	sort.Strings(words)
+	assert.Equal(t, []string{"ARRET", "BAJA", "STOP"}, words, "every language applies until the contact's is known")
+
+	assert.Equal(t, "STOP", matchConsentKeyword(consentKeywordsFor(keywords, "de"), " stop! "))
+	assert.Empty(t, matchConsentKeyword(consentKeywordsFor(keywords, "de"), "baja"))
+}
+
+func TestCleanConsentKeywords(t *testing.T) {
+	cleaned, err := cleanConsentKeywords(map[string][]string{" ES ": {" baja", "", "Baja", "alto"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"es": {"BAJA", "ALTO"}}, cleaned)
+
+	_, err = cleanConsentKeywords(map[string][]string{"": {"STOP"}})
+	assert.Error(t, err)
+
+	current := map[string][]string{"default": {"HALT"}}
+	keywords, err := updatedConsentKeywords(current, nil, defaultOptOutKeywords)
+	require.NoError(t, err)
+	assert.Equal(t, current, keywords)
+	keywords, err = updatedConsentKeywords(current, map[string][]string{}, defaultOptOutKeywords)
+	require.NoError(t, err)
+	assert.Equal(t, defaultOptOutKeywords, keywords)
+}
+
+func TestValidateConsentSettings(t *testing.T) {
+	assert.NoError(t, validateConsentSettings(ConsentSettings{
+		OptOutKeywords: defaultOptOutKeywords,
+		OptInKeywords:  defaultOptInKeywords,
+	}))
+
+	err := validateConsentSettings(ConsentSettings{
+		OptOutKeywords: map[string][]string{"default": {"STOP"}},
+		OptInKeywords:  map[string][]string{"es": {"STOP"}},
+	})
+	assert.EqualError(t, err, `"STOP" can't be both an opt-out and an opt-in keyword`)
+}
+
+func TestHandleConsentKeywords(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	_, contact, enrollment := sequenceTestContact(t, app, nil)
+
+	assert.False(t, app.handleConsentKeywords(contact, "Please stop sending these"))
+	assert.True(t, app.handleConsentKeywords(contact, "Stop."))
+	assert.False(t, app.handleConsentKeywords(contact, "STOP"), "already opted out")
+
+	require.NoError(t, app.DB.First(contact, "id = ?", contact.ID).Error)
+	assert.Equal(t, models.ContactOptInStatusOptedOut, contact.OptInStatus)
+	assert.NotNil(t, contact.OptInUpdatedAt)
+
+	require.NoError(t, app.DB.First(enrollment, "id = ?", enrollment.ID).Error)
+	assert.Equal(t, models.SequenceEnrollmentStatusExited, enrollment.Status)
+	assert.Equal(t, models.SequenceExitReasonOptedOut, enrollment.ExitReason)
+
+	assert.True(t, app.handleConsentKeywords(contact, "start"))
+
+	var events []models.ContactConsentEvent
+	require.NoError(t, app.DB.Where("contact_id = ?", contact.ID).Order("created_at ASC").Find(&events).Error)
+	require.Len(t, events, 2)
+	assert.Equal(t, models.ContactOptInStatusUnknown, events[0].FromStatus)
+	assert.Equal(t, models.ContactOptInStatusOptedOut, events[0].ToStatus)
+	assert.Equal(t, models.ContactConsentSourceKeyword, events[0].Source)
+	assert.Equal(t, "STOP", events[0].Keyword)
+	assert.Equal(t, models.ContactOptInStatusOptedIn, events[1].ToStatus)
+	assert.Equal(t, "START", events[1].Keyword)
+	assert.Nil(t, events[1].UserID, "keyword changes have no user")
+}
@@ -0,0 +1,624 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxContactImportSize is the largest CSV file that can be imported
+	maxContactImportSize = 10 * 1024 * 1024
+	// maxContactImportRows caps the number of contacts in a single import
+	maxContactImportRows = 50000
+	// maxContactImportErrors caps how many row problems an import keeps for its report
+	maxContactImportErrors = 500
+	// contactImportProgressRows is how often an import saves its counts while processing
+	contactImportProgressRows = 200
+	// contactExportBatchSize is how many contacts an export loads at a time
+	contactExportBatchSize = 500
+)
+
+// contactImportFields are the contact fields a CSV column can be mapped to, besides
+// custom fields, which are mapped as "attribute.<key>"
+var contactImportFields = map[string]bool{
+	"phone_number":     true,
+	"name":             true,
+	"whatsapp_account": true,
+	"tags":             true,
+	"opt_in_status":    true,
+	"timezone":         true,
+}
+
+// contactImportAliases maps common CSV headers to contact fields when an import has no mapping
+var contactImportAliases = map[string]string{
+	"phone":        "phone_number",
+	"phone number": "phone_number",
+	"mobile":       "phone_number",
+	"number":       "phone_number",
+	"whatsapp":     "phone_number",
+	"full name":    "name",
+	"full_name":    "name",
+	"profile_name": "name",
+	"tag":          "tags",
+}
+
+// ImportContacts accepts a CSV file of contacts and imports it in the background.
+// The form takes the file, an optional JSON mapping of CSV columns to contact
+// fields, and update_existing=false to leave contacts that already exist unchanged.
+func (a *App) ImportContacts(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	fileHeader, err := r.RequestCtx.FormFile("file")
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "No file provided", nil, "")
+	}
+	if strings.ToLower(filepath.Ext(fileHeader.Filename)) != ".csv" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Only .csv files can be imported", nil, "")
+	}
+	if fileHeader.Size > maxContactImportSize {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Files must be %d MB or smaller", maxContactImportSize/(1024*1024)), nil, "")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to open uploaded file", nil, "")
+	}
+	defer func() { _ = file.Close() }()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to read file data", nil, "")
+	}
+
+	header, rows, err := parseContactCSV(data)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	var mapping map[string]string
+	if raw := strings.TrimSpace(string(r.RequestCtx.FormValue("mapping"))); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "mapping must be a JSON object of CSV column to contact field", nil, "")
+		}
+	}
+	columns, err := contactImportColumns(header, mapping)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	columnMapping := models.JSONB{}
+	for i, field := range columns {
+		columnMapping[header[i]] = field
+	}
+	imp := models.ContactImport{
+		OrganizationID: orgID,
+		FileName:       filepath.Base(fileHeader.Filename),
+		Status:         models.ContactImportStatusPending,
+		ColumnMapping:  columnMapping,
+		UpdateExisting: string(r.RequestCtx.FormValue("update_existing")) != "false",
+		TotalRows:      len(rows),
+		Errors:         models.JSONBArray{},
+		CreatedByID:    &userID,
+	}
+	if err := a.DB.Create(&imp).Error; err != nil {
+		a.Log.Error("Failed to create contact import", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to import contacts", nil, "")
+	}
+
+	// The import is processed on its own copy, as imp is sent back below
+	job := imp
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.processContactImport(&job, columns, rows)
+	}()
+
+	a.Log.Info("Contact import started", "import_id", imp.ID, "rows", len(rows), "user_id", userID)
+
+	return r.SendEnvelope(imp)
+}
+
+// ListContactImports returns the organization's recent contact imports, newest first
+func (a *App) ListContactImports(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var imports []models.ContactImport
+	if err := a.DB.Where("organization_id = ?", orgID).
+		Omit("errors").
+		Order("created_at DESC").
+		Limit(50).
+		Find(&imports).Error; err != nil {
+		a.Log.Error("Failed to list contact imports", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list imports", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"imports": imports,
+	})
+}
+
+// GetContactImport returns a contact import with its report of rows that were
+// skipped or failed
+func (a *App) GetContactImport(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid import ID", nil, "")
+	}
+
+	var imp models.ContactImport
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&imp).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Import not found", nil, "")
+	}
+
+	return r.SendEnvelope(imp)
+}
+
+// ExportContacts streams the organization's contacts as CSV, or only those a
+// segment matches when segment_id is given. attributes lists the custom fields
+// to add as columns.
+func (a *App) ExportContacts(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	fileName := "contacts"
+	query := a.DB.Model(&models.Contact{}).Where("organization_id = ?", orgID)
+	if segmentID := string(args.Peek("segment_id")); segmentID != "" {
+		segment, err := a.findOrgSegment(orgID, segmentID)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		if query, err = a.segmentContactsQuery(orgID, decodeSegmentConditions(segment.Conditions)); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		fileName = "segment-" + segment.ID.String()
+	}
+
+	var attributes []string
+	for _, attr := range strings.Split(string(args.Peek("attributes")), ",") {
+		if attr = strings.TrimSpace(attr); attr != "" {
+			attributes = append(attributes, attr)
+		}
+	}
+	shouldMask := a.ShouldMaskPhoneNumbers(orgID)
+
+	a.Log.Info("Contacts exported", "organization_id", orgID, "user_id", userID, "file", fileName)
+
+	r.RequestCtx.SetContentType("text/csv; charset=utf-8")
+	r.RequestCtx.Response.Header.Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s-%s.csv"`, fileName, time.Now().Format("2006-01-02")))
+	r.RequestCtx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		cw := csv.NewWriter(w)
+		_ = cw.Write(contactExportHeader(attributes))
+
+		var batch []models.Contact
+		err := query.FindInBatches(&batch, contactExportBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				if err := cw.Write(contactExportRow(&batch[i], attributes, shouldMask)); err != nil {
+					return err
+				}
+			}
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return w.Flush()
+		}).Error
+		if err != nil {
+			a.Log.Error("Failed to export contacts", "error", err, "organization_id", orgID)
+		}
+		cw.Flush()
+	})
+	return nil
+}
+
+// contactExportHeader returns the header row of a contact export
+func contactExportHeader(attributes []string) []string {
+	header := []string{"phone_number", "name", "whatsapp_account", "tags", "opt_in_status", "language", "timezone", "last_seen_at", "created_at"}
+	for _, attr := range attributes {
+		header = append(header, segmentAttributePrefix+attr)
+	}
+	return header
+}
+
+// contactExportRow returns a contact's row of an export. Tags are comma separated,
+// so the file can be imported back.
+func contactExportRow(c *models.Contact, attributes []string, shouldMask bool) []string {
+	phoneNumber, name := c.PhoneNumber, c.ProfileName
+	if shouldMask {
+		phoneNumber = MaskPhoneNumber(phoneNumber)
+		name = MaskIfPhoneNumber(name)
+	}
+	tags := make([]string, 0, len(c.Tags))
+	for _, t := range c.Tags {
+		tags = append(tags, fmt.Sprint(t))
+	}
+	lastSeen := ""
+	if c.LastInboundAt != nil {
+		lastSeen = c.LastInboundAt.UTC().Format(time.RFC3339)
+	}
+	optIn := c.OptInStatus
+	if optIn == "" {
+		optIn = models.ContactOptInStatusUnknown
+	}
+
+	row := []string{
+		phoneNumber,
+		name,
+		c.WhatsAppAccount,
+		strings.Join(tags, ", "),
+		string(optIn),
+		c.Language,
+		c.Timezone,
+		lastSeen,
+		c.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	for _, attr := range attributes {
+		value := ""
+		if v, ok := c.Metadata[attr]; ok && v != nil {
+			value = fmt.Sprint(v)
+		}
+		row = append(row, value)
+	}
+	return row
+}
+
+// parseContactCSV reads a contact CSV file into its header and data rows, skipping
+// blank lines
+func parseContactCSV(data []byte) ([]string, [][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("the file is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var rows [][]string
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		rows = append(rows, record)
+		if len(rows) > maxContactImportRows {
+			return nil, nil, fmt.Errorf("files can have at most %d contacts", maxContactImportRows)
+		}
+	}
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("the file has no contacts")
+	}
+	return header, rows, nil
+}
+
+// contactImportColumns returns the contact field each CSV column is imported as,
+// by column index. Without a mapping, columns named after a contact field (or a
+// common alias) are imported as it and the rest as custom fields. With a mapping,
+// only the mapped columns are imported.
+func contactImportColumns(header []string, mapping map[string]string) (map[int]string, error) {
+	columns := map[int]string{}
+	if mapping == nil {
+		for i, name := range header {
+			key := strings.ToLower(name)
+			switch {
+			case key == "":
+			case contactImportFields[key]:
+				columns[i] = key
+			case contactImportAliases[key] != "":
+				columns[i] = contactImportAliases[key]
+			case strings.HasPrefix(key, segmentAttributePrefix):
+				columns[i] = segmentAttributePrefix + strings.TrimSpace(name[len(segmentAttributePrefix):])
+			default:
+				columns[i] = segmentAttributePrefix + name
+			}
+		}
+	} else {
+		index := make(map[string]int, len(header))
+		for i, name := range header {
+			index[name] = i
+		}
+		for column, field := range mapping {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			i, ok := index[column]
+			if !ok {
+				return nil, fmt.Errorf("column %q is not in the file", column)
+			}
+			if !contactImportFields[field] && (!strings.HasPrefix(field, segmentAttributePrefix) || field == segmentAttributePrefix) {
+				return nil, fmt.Errorf("unknown contact field %q for column %q", field, column)
+			}
+			columns[i] = field
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, field := range columns {
+		if seen[field] {
+			return nil, fmt.Errorf("more than one column is imported as %s", field)
+		}
+		seen[field] = true
+	}
+	if !seen["phone_number"] {
+		return nil, fmt.Errorf("a column must be imported as phone_number")
+	}
+	return columns, nil
+}
+
+// contactImportRequest builds the contact changes of a CSV row. Empty cells are
+// left out, so they don't clear what an existing contact has.
+func contactImportRequest(columns map[int]string, record []string) *ContactRequest {
+	req := &ContactRequest{}
+	for i, field := range columns {
+		if i >= len(record) {
+			continue
+		}
+		value := strings.TrimSpace(record[i])
+		if value == "" {
+			continue
+		}
+		switch field {
+		case "phone_number":
+			req.PhoneNumber = &value
+		case "name":
+			req.Name = &value
+		case "whatsapp_account":
+			req.WhatsAppAccount = &value
+		case "tags":
+			tags := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' || r == '|' })
+			for j := range tags {
+				tags[j] = strings.TrimSpace(tags[j])
+			}
+			req.Tags = &tags
+		case "opt_in_status":
+			status := models.ContactOptInStatus(strings.ToLower(value))
+			req.OptInStatus = &status
+		case "timezone":
+			req.Timezone = &value
+		default:
+			if req.CustomFields == nil {
+				req.CustomFields = map[string]any{}
+			}
+			req.CustomFields[strings.TrimPrefix(field, segmentAttributePrefix)] = value
+		}
+	}
+	return req
+}
+
+// processContactImport imports the rows of a contact import, one contact per phone
+// number. Rows repeating an earlier row's number are skipped. Existing contacts
+// get the row's tags and custom fields added and its other values set, unless the
+// import leaves them unchanged.
+func (a *App) processContactImport(imp *models.ContactImport, columns map[int]string, rows [][]string) {
+	a.DB.Model(imp).Update("status", models.ContactImportStatusProcessing)
+
+	report := models.JSONBArray{}
+	addProblem := func(row int, phone, problem string) {
+		if len(report) < maxContactImportErrors {
+			report = append(report, map[string]interface{}{"row": row, "phone_number": phone, "error": problem})
+		}
+	}
+	saveCounts := func(extra map[string]interface{}) {
+		updates := map[string]interface{}{
+			"created_count": imp.CreatedCount,
+			"updated_count": imp.UpdatedCount,
+			"skipped_count": imp.SkippedCount,
+			"failed_count":  imp.FailedCount,
+			"errors":        report,
+		}
+		for k, v := range extra {
+			updates[k] = v
+		}
+		if err := a.DB.Model(imp).Updates(updates).Error; err != nil {
+			a.Log.Error("Failed to save contact import progress", "error", err, "import_id", imp.ID)
+		}
+	}
+
+	seen := make(map[string]int, len(rows))
+	for i, record := range rows {
+		row := i + 2 // Line number in the file, after the header
+		req := contactImportRequest(columns, record)
+		rawPhone := ""
+		if req.PhoneNumber != nil {
+			rawPhone = *req.PhoneNumber
+		}
+		phone := searchPhoneDigits(rawPhone)
+
+		if firstRow, ok := seen[phone]; ok && phone != "" {
+			imp.SkippedCount++
+			addProblem(row, rawPhone, fmt.Sprintf("same phone number as row %d", firstRow))
+		} else {
+			seen[phone] = row
+			outcome, err := a.importContactRow(imp, req)
+			switch {
+			case err != nil:
+				imp.FailedCount++
+				addProblem(row, rawPhone, err.Error())
+			case outcome == contactImportCreated:
+				imp.CreatedCount++
+			case outcome == contactImportUpdated:
+				imp.UpdatedCount++
+			default:
+				imp.SkippedCount++
+				addProblem(row, rawPhone, "contact already exists and was left unchanged")
+			}
+		}
+
+		if (i+1)%contactImportProgressRows == 0 {
+			saveCounts(nil)
+		}
+	}
+
+	now := time.Now()
+	imp.Status = models.ContactImportStatusCompleted
+	saveCounts(map[string]interface{}{
+		"status":      imp.Status,
+		"finished_at": now,
+	})
+
+	a.Log.Info("Contact import finished", "import_id", imp.ID,
+		"created", imp.CreatedCount, "updated", imp.UpdatedCount,
+		"skipped", imp.SkippedCount, "failed", imp.FailedCount)
+}
+
+// contactImportOutcome is what importing a row did to its contact
+type contactImportOutcome int
+
+const (
+	contactImportCreated contactImportOutcome = iota
+	contactImportUpdated
+	contactImportUnchanged
+)
+
+// importContactRow creates or updates the contact of an import row. Contacts
+// deleted earlier with the same number are restored.
+func (a *App) importContactRow(imp *models.ContactImport, req *ContactRequest) (contactImportOutcome, error) {
+	if req.PhoneNumber == nil {
+		return 0, fmt.Errorf("phone_number is required")
+	}
+
+	contact := models.Contact{OrganizationID: imp.OrganizationID, OptInStatus: models.ContactOptInStatusUnknown}
+	updates, err := a.contactUpdates(&contact, req)
+	if err != nil {
+		return 0, err
+	}
+
+	var existing models.Contact
+	err = a.DB.Unscoped().Where("organization_id = ? AND phone_number = ?", imp.OrganizationID, contact.PhoneNumber).
+		First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if contact.Timezone == "" {
+			contact.Timezone = models.TimezoneForPhoneNumber(contact.PhoneNumber)
+		}
+		if err := a.DB.Create(&contact).Error; err != nil {
+			a.Log.Error("Failed to create imported contact", "error", err, "import_id", imp.ID)
+			return 0, fmt.Errorf("failed to save contact")
+		}
+		a.recordConsentChange(&contact, models.ContactOptInStatusUnknown, models.ContactConsentSourceImport, "", imp.CreatedByID)
+		return contactImportCreated, nil
+	}
+	if err != nil {
+		a.Log.Error("Failed to look up imported contact", "error", err, "import_id", imp.ID)
+		return 0, fmt.Errorf("failed to save contact")
+	}
+
+	// Only the contact or an agent can opt a contact who opted out back in
+	optedOut := existing.OptInStatus == models.ContactOptInStatusOptedOut
+
+	if existing.DeletedAt.Valid {
+		from := existing.OptInStatus
+		if optedOut {
+			delete(updates, "opt_in_status")
+			delete(updates, "opt_in_updated_at")
+		}
+		updates["deleted_at"] = nil
+		if err := a.DB.Unscoped().Model(&existing).Updates(updates).Error; err != nil {
+			a.Log.Error("Failed to restore imported contact", "error", err, "contact_id", existing.ID)
+			return 0, fmt.Errorf("failed to save contact")
+		}
+		if _, ok := updates["opt_in_status"]; ok {
+			existing.OptInStatus = contact.OptInStatus
+			a.recordConsentChange(&existing, from, models.ContactConsentSourceImport, "", imp.CreatedByID)
+		}
+		return contactImportCreated, nil
+	}
+	if !imp.UpdateExisting {
+		return contactImportUnchanged, nil
+	}
+	if optedOut {
+		req.OptInStatus = nil
+	}
+
+	// Add to the contact's tags and custom fields rather than replacing them
+	req.PhoneNumber = nil
+	if req.Tags != nil {
+		tags := existing.Tags
+		for _, tag := range *req.Tags {
+			tags = updateContactTags(tags, tag, true)
+		}
+		merged := make([]string, 0, len(tags))
+		for _, t := range tags {
+			merged = append(merged, fmt.Sprint(t))
+		}
+		req.Tags = &merged
+	}
+	if req.CustomFields != nil {
+		fields := map[string]any{}
+		for k, v := range existing.Metadata {
+			fields[k] = v
+		}
+		for k, v := range req.CustomFields {
+			fields[k] = v
+		}
+		req.CustomFields = fields
+	}
+	from := existing.OptInStatus
+	updates, err = a.contactUpdates(&existing, req)
+	if err != nil {
+		return 0, err
+	}
+	if len(updates) == 0 {
+		return contactImportUnchanged, nil
+	}
+	if err := a.DB.Model(&existing).Updates(updates).Error; err != nil {
+		a.Log.Error("Failed to update imported contact", "error", err, "contact_id", existing.ID)
+		return 0, fmt.Errorf("failed to save contact")
+	}
+	a.recordConsentChange(&existing, from, models.ContactConsentSourceImport, "", imp.CreatedByID)
+	return contactImportUpdated, nil
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseContactCSV(t *testing.T) {
+	header, rows, err := parseContactCSV([]byte("\xef\xbb\xbfPhone, Name ,Plan\n+1 555 0100,Ann,pro\n\n15550101,Bob\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Phone", "Name", "Plan"}, header)
+	assert.Equal(t, [][]string{{"+1 555 0100", "Ann", "pro"}, {"15550101", "Bob"}}, rows)
+
+	_, _, err = parseContactCSV([]byte("phone,name\n"))
+	assert.EqualError(t, err, "the file has no contacts")
+
+	_, _, err = parseContactCSV(nil)
+	assert.EqualError(t, err, "the file is empty")
+}
+
+func TestContactImportColumns(t *testing.T) {
+	header := []string{"Mobile", "Name", "Tags", "Plan", ""}
+
+	columns, err := contactImportColumns(header, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{0: "phone_number", 1: "name", 2: "tags", 3: "attribute.Plan"}, columns)
+
+	columns, err = contactImportColumns(header, map[string]string{"Mobile": "phone_number", "Plan": "attribute.plan", "Tags": ""})
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{0: "phone_number", 3: "attribute.plan"}, columns)
+
+	_, err = contactImportColumns(header, map[string]string{"Name": "name"})
+	assert.EqualError(t, err, "a column must be imported as phone_number")
+
+	_, err = contactImportColumns(header, map[string]string{"Mobile": "phone_number", "Email": "attribute.email"})
+	assert.EqualError(t, err, `column "Email" is not in the file`)
+
+	_, err = contactImportColumns(header, map[string]string{"Mobile": "phone_number", "Plan": "password"})
+	assert.EqualError(t, err, `unknown contact field "password" for column "Plan"`)
+
+	_, err = contactImportColumns(header, map[string]string{"Mobile": "phone_number", "Name": "phone_number"})
+	assert.EqualError(t, err, "more than one column is imported as phone_number")
+}
+
+func TestContactImportRequest(t *testing.T) {
+	columns := map[int]string{0: "phone_number", 1: "name", 2: "tags", 3: "opt_in_status", 4: "attribute.plan"}
+
+	req := contactImportRequest(columns, []string{" 15550100 ", "Ann", "vip; trial", "Opted_In", "pro"})
+	require.NotNil(t, req.PhoneNumber)
+	assert.Equal(t, "15550100", *req.PhoneNumber)
+	assert.Equal(t, "Ann", *req.Name)
+	assert.Equal(t, []string{"vip", "trial"}, *req.Tags)
+	assert.Equal(t, models.ContactOptInStatusOptedIn, *req.OptInStatus)
+	assert.Equal(t, map[string]any{"plan": "pro"}, req.CustomFields)
+
+	// Empty and missing cells are left out
+	req = contactImportRequest(columns, []string{"15550100", ""})
+	assert.Nil(t, req.Name)
+	assert.Nil(t, req.Tags)
+	assert.Nil(t, req.CustomFields)
+}
+
+func TestContactExportRow(t *testing.T) {
+	seen := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	contact := &models.Contact{
+		BaseModel:     models.BaseModel{CreatedAt: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)},
+		PhoneNumber:   "15550100",
+		ProfileName:   "Ann",
+		Tags:          models.JSONBArray{"vip", "trial"},
+		OptInStatus:   models.ContactOptInStatusOptedIn,
+		Timezone:      "America/New_York",
+		LastInboundAt: &seen,
+		Metadata:      models.JSONB{"plan": "pro"},
+	}
+
+	assert.Equal(t, []string{"phone_number", "name", "whatsapp_account", "tags", "opt_in_status", "language", "timezone", "last_seen_at", "created_at", "attribute.plan", "attribute.city"},
+		contactExportHeader([]string{"plan", "city"}))
+	assert.Equal(t, []string{"15550100", "Ann", "", "vip, trial", "opted_in", "", "America/New_York", "2026-03-01T09:30:00Z", "2026-01-02T00:00:00Z", "pro", ""},
+		contactExportRow(contact, []string{"plan", "city"}, false))
+}
+
+func TestProcessContactImport(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Import Org " + suffix,
+		Slug:      "import-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	existing := &models.Contact{
+		OrganizationID: org.ID,
+		PhoneNumber:    "15550100",
+		ProfileName:    "Ann",
+		Tags:           models.JSONBArray{"vip"},
+		Metadata:       models.JSONB{"city": "Boston"},
+	}
+	require.NoError(t, app.DB.Create(existing).Error)
+
+	imp := &models.ContactImport{OrganizationID: org.ID, UpdateExisting: true, TotalRows: 4}
+	require.NoError(t, app.DB.Create(imp).Error)
+
+	columns := map[int]string{0: "phone_number", 1: "name", 2: "tags", 3: "attribute.plan"}
+	app.processContactImport(imp, columns, [][]string{
+		{"+1 555 0100", "", "trial", "pro"},
+		{"15550199", "Bob", "", ""},
+		{"1-555-0199", "Bobby", "", ""},
+		{"12", "Too short", "", ""},
+	})
+
+	require.NoError(t, app.DB.First(imp, "id = ?", imp.ID).Error)
+	assert.Equal(t, models.ContactImportStatusCompleted, imp.Status)
+	assert.Equal(t, 1, imp.CreatedCount)
+	assert.Equal(t, 1, imp.UpdatedCount)
+	assert.Equal(t, 1, imp.SkippedCount)
+	assert.Equal(t, 1, imp.FailedCount)
+	assert.Len(t, imp.Errors, 2)
+	assert.NotNil(t, imp.FinishedAt)
+
+	require.NoError(t, app.DB.First(existing, "id = ?", existing.ID).Error)
+	assert.Equal(t, "Ann", existing.ProfileName, "empty cells keep the contact's value")
+	assert.Equal(t, models.JSONBArray{"vip", "trial"}, existing.Tags)
+	assert.Equal(t, models.JSONB{"city": "Boston", "plan": "pro"}, existing.Metadata)
+
+	var created models.Contact
+	require.NoError(t, app.DB.Where("organization_id = ? AND phone_number = ?", org.ID, "15550199").First(&created).Error)
+	assert.Equal(t, "Bob", created.ProfileName)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// contactLockPrefix keys the locks held while a contact's message is processed
+	contactLockPrefix = "chatbot:lock:"
+	// contactLockTTL is how long a lock outlives an instance that died holding it.
+	// Held locks are extended every third of it.
+	contactLockTTL = 30 * time.Second
+	// contactLockRetry is how often a held lock is tried again
+	contactLockRetry = 50 * time.Millisecond
+)
+
+// contactLockWait is how long a message waits for the contact's previous one. It's
+// processed anyway after that, so a stuck lock doesn't drop messages.
+var contactLockWait = 2 * time.Minute
+
+// unlockContactScript releases a lock only if it's still held with the token, so a
+// lock that expired and was taken by another instance isn't released
+var unlockContactScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// extendContactScript extends a lock still held with the token
+var extendContactScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// contactLock is a contact's lock within the instance, used when Redis isn't
+// available. A channel holds it, so waiting for it can time out like the Redis lock.
+type contactLock struct {
+	held    chan struct{}
+	waiters int // Messages holding or waiting for the lock; it's removed at zero
+}
+
+var (
+	contactLocksMu sync.Mutex
+	contactLocks   = map[string]*contactLock{}
+)
+
+// lockContact waits until no other message of the contact is being processed, on
+// any instance, and returns the function that releases the lock. Concurrent messages
+// from a contact, such as several sent in quick succession and delivered to different
+// webhook workers, would otherwise race on its chatbot session. Without Redis,
+// messages are only serialized within the instance.
+func (a *App) lockContact(ctx context.Context, phoneNumberID, phone string) func() {
+	key := contactLockPrefix + phoneNumberID + ":" + phone
+	if a.Redis == nil {
+		return a.lockContactLocal(ctx, key, phone)
+	}
+
+	token := uuid.NewString()
+	deadline := time.Now().Add(contactLockWait)
+	for {
+		acquired, err := a.Redis.SetNX(ctx, key, token, contactLockTTL).Result()
+		if err != nil {
+			a.log(ctx).Warn("Failed to lock contact, processing message anyway", "error", err, "phone", phone)
+			return func() {}
+		}
+		if acquired {
+			break
+		}
+		if time.Now().After(deadline) {
+			a.log(ctx).Warn("Timed out waiting for contact lock, processing message anyway", "phone", phone)
+			return func() {}
+		}
+		select {
+		case <-ctx.Done():
+			return func() {}
+		case <-time.After(contactLockRetry):
+		}
+	}
+
+	// Keep the lock while the message is processed, however long replies take
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(contactLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := extendContactScript.Run(context.Background(), a.Redis, []string{key}, token, contactLockTTL.Milliseconds()).Err(); err != nil {
+					a.Log.Warn("Failed to extend contact lock", "error", err, "phone", phone)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		if err := unlockContactScript.Run(context.Background(), a.Redis, []string{key}, token).Err(); err != nil {
+			a.Log.Warn("Failed to release contact lock", "error", err, "phone", phone)
+		}
+	}
+}
+
+// lockContactLocal is lockContact within the instance, when Redis isn't available
+func (a *App) lockContactLocal(ctx context.Context, key, phone string) func() {
+	contactLocksMu.Lock()
+	lock, ok := contactLocks[key]
+	if !ok {
+		lock = &contactLock{held: make(chan struct{}, 1)}
+		contactLocks[key] = lock
+	}
+	lock.waiters++
+	contactLocksMu.Unlock()
+
+	done := func() {
+		contactLocksMu.Lock()
+		if lock.waiters--; lock.waiters == 0 {
+			delete(contactLocks, key)
+		}
+		contactLocksMu.Unlock()
+	}
+
+	timer := time.NewTimer(contactLockWait)
+	defer timer.Stop()
+	select {
+	case lock.held <- struct{}{}:
+		return func() {
+			<-lock.held
+			done()
+		}
+	case <-timer.C:
+		a.log(ctx).Warn("Timed out waiting for contact lock, processing message anyway", "phone", phone)
+	case <-ctx.Done():
+	}
+	done()
+	return func() {}
+}
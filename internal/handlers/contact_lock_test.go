@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertContactLockSerializes checks that a second lock of a contact waits for the first
+func assertContactLockSerializes(t *testing.T, app *App, phone string) {
+	ctx := context.Background()
+	unlock := app.lockContact(ctx, "phone-id", phone)
+
+	acquired := make(chan struct{})
+	go func() {
+		unlockSecond := app.lockContact(ctx, "phone-id", phone)
+		close(acquired)
+		unlockSecond()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("the contact was locked twice")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the lock wasn't released")
+	}
+}
+
+func TestLockContact_WithoutRedis(t *testing.T) {
+	app := &App{Config: &config.Config{}, Log: testutil.NopLogger()}
+	assertContactLockSerializes(t, app, "15550001111")
+
+	// Other contacts aren't held up
+	unlock := app.lockContact(context.Background(), "phone-id", "15550001111")
+	app.lockContact(context.Background(), "phone-id", "15550002222")()
+
+	// A message waits for the contact's previous one for a while, then goes ahead
+	orig := contactLockWait
+	contactLockWait = 100 * time.Millisecond
+	defer func() { contactLockWait = orig }()
+	start := time.Now()
+	app.lockContact(context.Background(), "phone-id", "15550001111")()
+	assert.GreaterOrEqual(t, time.Since(start), contactLockWait)
+
+	// Locks of contacts nobody waits for are removed
+	unlock()
+	contactLocksMu.Lock()
+	defer contactLocksMu.Unlock()
+	assert.Empty(t, contactLocks)
+}
+
+func TestLockContact_Redis(t *testing.T) {
+	rdb := testutil.SetupTestRedis(t)
+	if rdb == nil {
+		t.Skip("TEST_REDIS_URL not set, skipping Redis test")
+	}
+	app := &App{Config: &config.Config{}, Log: testutil.NopLogger(), Redis: rdb}
+	phone := "1555" + time.Now().Format("150405.000")
+	assertContactLockSerializes(t, app, phone)
+
+	// The lock is gone once released
+	exists, err := rdb.Exists(context.Background(), contactLockPrefix+"phone-id:"+phone).Result()
+	require.NoError(t, err)
+	assert.Zero(t, exists)
+}
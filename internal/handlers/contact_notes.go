@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// ContactNoteRequest creates or updates a contact note
+type ContactNoteRequest struct {
+	Content  *string `json:"content"`
+	IsPinned *bool   `json:"is_pinned"`
+}
+
+// ContactNoteResponse represents a contact note in API responses
+type ContactNoteResponse struct {
+	ID            uuid.UUID  `json:"id"`
+	ContactID     uuid.UUID  `json:"contact_id"`
+	Content       string     `json:"content"`
+	IsPinned      bool       `json:"is_pinned"`
+	CreatedByID   uuid.UUID  `json:"created_by_id"`
+	CreatedByName string     `json:"created_by_name,omitempty"`
+	UpdatedByID   *uuid.UUID `json:"updated_by_id,omitempty"`
+	UpdatedByName string     `json:"updated_by_name,omitempty"`
+	EditedAt      *time.Time `json:"edited_at,omitempty"`
+	RevisionCount int64      `json:"revision_count"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// ContactNoteRevisionResponse represents an earlier version of a contact note
+type ContactNoteRevisionResponse struct {
+	ID           uuid.UUID `json:"id"`
+	Content      string    `json:"content"`
+	EditedByID   uuid.UUID `json:"edited_by_id"`
+	EditedByName string    `json:"edited_by_name,omitempty"`
+	EditedAt     time.Time `json:"edited_at"`
+}
+
+// ListContactNotes returns the notes on a contact, pinned notes first
+func (a *App) ListContactNotes(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	notes, err := a.contactNotes(orgID, contact.ID)
+	if err != nil {
+		a.Log.Error("Failed to list contact notes", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list notes", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"notes": notes,
+	})
+}
+
+// CreateContactNote adds a note to a contact
+func (a *App) CreateContactNote(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var req ContactNoteRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if req.Content == nil || strings.TrimSpace(*req.Content) == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Note content is required", nil, "")
+	}
+
+	note := models.ContactNote{
+		OrganizationID: orgID,
+		ContactID:      contact.ID,
+		Content:        strings.TrimSpace(*req.Content),
+		IsPinned:       req.IsPinned != nil && *req.IsPinned,
+		CreatedByID:    userID,
+	}
+	if err := a.DB.Create(&note).Error; err != nil {
+		a.Log.Error("Failed to create contact note", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create note", nil, "")
+	}
+
+	return a.sendContactNote(r, note.ID)
+}
+
+// UpdateContactNote changes a note's content or pins it. The replaced content is
+// kept as a revision.
+func (a *App) UpdateContactNote(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	note, errMsg, status := a.accessibleContactNote(r, orgID)
+	if note == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var req ContactNoteRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	updates := map[string]interface{}{}
+	contentChanged := false
+	if req.Content != nil {
+		content := strings.TrimSpace(*req.Content)
+		if content == "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Note content is required", nil, "")
+		}
+		if content != note.Content {
+			contentChanged = true
+			updates["content"] = content
+			updates["updated_by_id"] = userID
+			updates["edited_at"] = time.Now()
+		}
+	}
+	if req.IsPinned != nil {
+		updates["is_pinned"] = *req.IsPinned
+	}
+	if len(updates) == 0 {
+		return a.sendContactNote(r, note.ID)
+	}
+
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if contentChanged {
+			revision := models.ContactNoteRevision{
+				NoteID:     note.ID,
+				Content:    note.Content,
+				EditedByID: userID,
+			}
+			if err := tx.Create(&revision).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(note).Updates(updates).Error
+	})
+	if err != nil {
+		a.Log.Error("Failed to update contact note", "error", err, "note_id", note.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update note", nil, "")
+	}
+
+	return a.sendContactNote(r, note.ID)
+}
+
+// DeleteContactNote removes a note from a contact
+func (a *App) DeleteContactNote(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	note, errMsg, status := a.accessibleContactNote(r, orgID)
+	if note == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	if err := a.DB.Delete(note).Error; err != nil {
+		a.Log.Error("Failed to delete contact note", "error", err, "note_id", note.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete note", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Note deleted",
+	})
+}
+
+// ListContactNoteRevisions returns the earlier versions of a note, newest first
+func (a *App) ListContactNoteRevisions(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	note, errMsg, status := a.accessibleContactNote(r, orgID)
+	if note == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var revisions []models.ContactNoteRevision
+	if err := a.DB.Where("note_id = ?", note.ID).
+		Preload("EditedBy").
+		Order("created_at DESC").
+		Find(&revisions).Error; err != nil {
+		a.Log.Error("Failed to list contact note revisions", "error", err, "note_id", note.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list note history", nil, "")
+	}
+
+	result := make([]ContactNoteRevisionResponse, len(revisions))
+	for i, rev := range revisions {
+		result[i] = ContactNoteRevisionResponse{
+			ID:         rev.ID,
+			Content:    rev.Content,
+			EditedByID: rev.EditedByID,
+			EditedAt:   rev.CreatedAt,
+		}
+		if rev.EditedBy != nil {
+			result[i].EditedByName = rev.EditedBy.FullName
+		}
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"revisions": result,
+	})
+}
+
+// accessibleContactNote loads a note on the contact in the request path
+func (a *App) accessibleContactNote(r *fastglue.Request, orgID uuid.UUID) (*models.ContactNote, string, int) {
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return nil, errMsg, status
+	}
+
+	noteID, err := uuid.Parse(r.RequestCtx.UserValue("note_id").(string))
+	if err != nil {
+		return nil, "Invalid note ID", fasthttp.StatusBadRequest
+	}
+
+	var note models.ContactNote
+	if err := a.DB.Where("id = ? AND contact_id = ? AND organization_id = ?", noteID, contact.ID, orgID).
+		First(&note).Error; err != nil {
+		return nil, "Note not found", fasthttp.StatusNotFound
+	}
+	return &note, "", 0
+}
+
+// contactNotes returns the notes on a contact with their authors, pinned first
+// and then newest first
+func (a *App) contactNotes(orgID, contactID uuid.UUID) ([]ContactNoteResponse, error) {
+	var notes []models.ContactNote
+	if err := a.DB.Where("organization_id = ? AND contact_id = ?", orgID, contactID).
+		Preload("CreatedBy").
+		Preload("UpdatedBy").
+		Order("is_pinned DESC, created_at DESC").
+		Find(&notes).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uuid.UUID]int64, len(notes))
+	if len(notes) > 0 {
+		ids := make([]uuid.UUID, len(notes))
+		for i, n := range notes {
+			ids[i] = n.ID
+		}
+		var rows []struct {
+			NoteID uuid.UUID
+			Count  int64
+		}
+		if err := a.DB.Model(&models.ContactNoteRevision{}).
+			Select("note_id, COUNT(*) AS count").
+			Where("note_id IN ?", ids).
+			Group("note_id").
+			Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			counts[row.NoteID] = row.Count
+		}
+	}
+
+	result := make([]ContactNoteResponse, len(notes))
+	for i, n := range notes {
+		result[i] = contactNoteToResponse(n, counts[n.ID])
+	}
+	return result, nil
+}
+
+// sendContactNote responds with a note as it is stored
+func (a *App) sendContactNote(r *fastglue.Request, noteID uuid.UUID) error {
+	var note models.ContactNote
+	if err := a.DB.Where("id = ?", noteID).
+		Preload("CreatedBy").
+		Preload("UpdatedBy").
+		First(&note).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Note not found", nil, "")
+	}
+
+	var revisions int64
+	a.DB.Model(&models.ContactNoteRevision{}).Where("note_id = ?", noteID).Count(&revisions)
+
+	return r.SendEnvelope(contactNoteToResponse(note, revisions))
+}
+
+func contactNoteToResponse(n models.ContactNote, revisions int64) ContactNoteResponse {
+	resp := ContactNoteResponse{
+		ID:            n.ID,
+		ContactID:     n.ContactID,
+		Content:       n.Content,
+		IsPinned:      n.IsPinned,
+		CreatedByID:   n.CreatedByID,
+		UpdatedByID:   n.UpdatedByID,
+		EditedAt:      n.EditedAt,
+		RevisionCount: revisions,
+		CreatedAt:     n.CreatedAt,
+		UpdatedAt:     n.UpdatedAt,
+	}
+	if n.CreatedBy != nil {
+		resp.CreatedByName = n.CreatedBy.FullName
+	}
+	if n.UpdatedBy != nil {
+		resp.UpdatedByName = n.UpdatedBy.FullName
+	}
+	return resp
+}
@@ -0,0 +1,88 @@
+package handlers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_ContactNotes(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	create := func(content string, pinned bool) handlers.ContactNoteResponse {
+		req := testutil.NewJSONRequest(t, map[string]any{"content": content, "is_pinned": pinned})
+		setAuthContext(req, org.ID, user.ID)
+		testutil.SetPathParam(req, "id", contact.ID.String())
+
+		require.NoError(t, app.CreateContactNote(req))
+		require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+		var note handlers.ContactNoteResponse
+		testutil.ParseEnvelopeResponse(t, req, &note)
+		return note
+	}
+
+	pinned := create("VIP customer, prefers calls after 5pm", true)
+	note := create("Asked about the annual plan", false)
+	assert.Equal(t, user.ID, note.CreatedByID)
+	assert.Nil(t, note.EditedAt)
+
+	// Editing the content keeps the earlier version
+	req := testutil.NewJSONRequest(t, map[string]any{"content": "Asked about the annual plan, sent pricing"})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	testutil.SetPathParam(req, "note_id", note.ID.String())
+
+	require.NoError(t, app.UpdateContactNote(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var updated handlers.ContactNoteResponse
+	testutil.ParseEnvelopeResponse(t, req, &updated)
+	assert.Equal(t, "Asked about the annual plan, sent pricing", updated.Content)
+	assert.NotNil(t, updated.EditedAt)
+	assert.Equal(t, int64(1), updated.RevisionCount)
+
+	var revisions []models.ContactNoteRevision
+	require.NoError(t, app.DB.Where("note_id = ?", note.ID).Find(&revisions).Error)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, "Asked about the annual plan", revisions[0].Content)
+
+	// Pinned notes come first
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.ListContactNotes(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp struct {
+		Notes []handlers.ContactNoteResponse `json:"notes"`
+	}
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	require.Len(t, resp.Notes, 2)
+	assert.Equal(t, pinned.ID, resp.Notes[0].ID)
+	assert.Equal(t, note.ID, resp.Notes[1].ID)
+}
+
+func TestApp_CreateContactNote_RequiresContent(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	req := testutil.NewJSONRequest(t, map[string]any{"content": "  "})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.CreateContactNote(req))
+	assert.Equal(t, fasthttp.StatusBadRequest, testutil.GetResponseStatusCode(req))
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// maxBulkTagContacts caps how many contacts a single tag request can change
+const maxBulkTagContacts = 1000
+
+// ContactTagCount is a tag in use with how many contacts have it
+type ContactTagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// BulkTagRequest adds and removes tags on contacts
+type BulkTagRequest struct {
+	ContactIDs []string `json:"contact_ids"`
+	Add        []string `json:"add"`
+	Remove     []string `json:"remove"`
+}
+
+// ListContactTags returns the tags used on the organization's contacts, most used first
+func (a *App) ListContactTags(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var tags []ContactTagCount
+	if err := a.DB.Raw(`SELECT tag, COUNT(*) AS count
+		FROM contacts, jsonb_array_elements_text(COALESCE(tags, '[]'::jsonb)) AS tag
+		WHERE organization_id = ? AND deleted_at IS NULL
+		GROUP BY tag
+		ORDER BY count DESC, tag ASC`, orgID).Scan(&tags).Error; err != nil {
+		a.Log.Error("Failed to list contact tags", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list tags", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"tags": tags,
+	})
+}
+
+// BulkTagContacts adds and removes tags on a set of contacts. Tags match
+// case-insensitively, so adding a tag a contact already has changes nothing.
+func (a *App) BulkTagContacts(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req BulkTagRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if len(req.ContactIDs) == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "contact_ids is required", nil, "")
+	}
+	if len(req.ContactIDs) > maxBulkTagContacts {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("At most %d contacts can be tagged at once", maxBulkTagContacts), nil, "")
+	}
+	add, remove := cleanTags(req.Add), cleanTags(req.Remove)
+	if len(add) == 0 && len(remove) == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "add or remove is required", nil, "")
+	}
+
+	contactIDs := make([]uuid.UUID, 0, len(req.ContactIDs))
+	for _, idStr := range req.ContactIDs {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact ID: "+idStr, nil, "")
+		}
+		contactIDs = append(contactIDs, id)
+	}
+
+	updated := 0
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		var contacts []models.Contact
+		if err := tx.Select("id", "tags").
+			Where("id IN ? AND organization_id = ?", contactIDs, orgID).
+			Find(&contacts).Error; err != nil {
+			return err
+		}
+		for _, contact := range contacts {
+			tags := applyTagChanges(contact.Tags, add, remove)
+			if sameTags(tags, contact.Tags) {
+				continue
+			}
+			if err := tx.Model(&models.Contact{}).Where("id = ?", contact.ID).Update("tags", tags).Error; err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	if err != nil {
+		a.Log.Error("Failed to tag contacts", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to tag contacts", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"updated": updated,
+	})
+}
+
+// cleanTags trims tags and drops empty ones
+func cleanTags(tags []string) []string {
+	result := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t = strings.TrimSpace(t); t != "" {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// applyTagChanges returns tags with the removed tags taken out and the added ones appended
+func applyTagChanges(tags models.JSONBArray, add, remove []string) models.JSONBArray {
+	result := append(models.JSONBArray{}, tags...)
+	for _, tag := range remove {
+		result = updateContactTags(result, tag, false)
+	}
+	for _, tag := range add {
+		result = updateContactTags(result, tag, true)
+	}
+	return result
+}
+
+// sameTags reports whether two tag lists hold the same tags in the same order
+func sameTags(a, b models.JSONBArray) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if fmt.Sprint(a[i]) != fmt.Sprint(b[i]) {
+			return false
+		}
+	}
+	return true
+}
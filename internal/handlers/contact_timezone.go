@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// contactTimezoneVar is the session variable a flow sets to override the contact's timezone
+const contactTimezoneVar = "contact_timezone"
+
+// localTimeLayouts are the accepted layouts for wall-clock times without a zone
+var localTimeLayouts = []string{"2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02 15:04:05"}
+
+// SetContactTimezoneRequest overrides a contact's timezone. An empty timezone
+// resets it to the one inferred from the phone number.
+type SetContactTimezoneRequest struct {
+	Timezone string `json:"timezone"`
+}
+
+// SetContactTimezone overrides the timezone of a contact
+func (a *App) SetContactTimezone(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	contactID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact ID", nil, "")
+	}
+
+	var req SetContactTimezoneRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var contact models.Contact
+	query := a.DB.Where("id = ? AND organization_id = ?", contactID, orgID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("assigned_user_id = ?", userID)
+	}
+	if err := query.First(&contact).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
+	}
+
+	timezone := strings.TrimSpace(req.Timezone)
+	if timezone == "" {
+		timezone = models.TimezoneForPhoneNumber(contact.PhoneNumber)
+	} else if _, err := time.LoadLocation(timezone); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid timezone", nil, "")
+	}
+
+	if err := a.DB.Model(&contact).Update("timezone", timezone).Error; err != nil {
+		a.Log.Error("Failed to update contact timezone", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update timezone", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message":  "Timezone updated",
+		"timezone": timezone,
+	})
+}
+
+// contactLocation returns the timezone to use for a contact's local time: their own
+// timezone, then the organization's, then UTC
+func (a *App) contactLocation(contact *models.Contact) *time.Location {
+	if contact != nil && contact.Timezone != "" {
+		if loc, err := time.LoadLocation(contact.Timezone); err == nil {
+			return loc
+		}
+	}
+	if contact != nil {
+		if loc := a.getOrgLocation(contact.OrganizationID); loc != nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// applySessionContactTimezone updates the contact's timezone when a flow has set
+// the contact_timezone session variable to a valid IANA name
+func (a *App) applySessionContactTimezone(contact *models.Contact, sessionData models.JSONB) {
+	timezone, ok := sessionData[contactTimezoneVar].(string)
+	timezone = strings.TrimSpace(timezone)
+	if !ok || timezone == "" || timezone == contact.Timezone {
+		return
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		a.Log.Warn("Ignoring invalid contact timezone from flow", "timezone", timezone, "contact_id", contact.ID)
+		return
+	}
+	if err := a.DB.Model(contact).Update("timezone", timezone).Error; err != nil {
+		a.Log.Error("Failed to update contact timezone", "error", err, "contact_id", contact.ID)
+		return
+	}
+	contact.Timezone = timezone
+	a.Log.Info("Contact timezone set by flow", "contact_id", contact.ID, "timezone", timezone)
+}
+
+// parseLocalTime parses a time. RFC 3339 values keep their offset, wall-clock
+// times without a zone are taken to be in loc (UTC when nil).
+func parseLocalTime(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	for _, layout := range localTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %q", value)
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLocalTime(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	require.NoError(t, err)
+
+	got, err := parseLocalTime("2025-03-10 15:30", loc)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 3, 10, 10, 0, 0, 0, time.UTC), got.UTC())
+
+	got, err = parseLocalTime("2025-03-10T15:30:00Z", loc)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 3, 10, 15, 30, 0, 0, time.UTC), got.UTC())
+
+	_, err = parseLocalTime("next tuesday", loc)
+	assert.Error(t, err)
+}
@@ -4,18 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
+	"path"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/shridarpatil/whatomate/internal/models"
-	"github.com/shridarpatil/whatomate/internal/websocket"
 	"github.com/shridarpatil/whatomate/pkg/whatsapp"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
@@ -23,42 +23,64 @@ import (
 
 // ContactResponse represents a contact with additional fields for the frontend
 type ContactResponse struct {
-	ID                 uuid.UUID  `json:"id"`
-	PhoneNumber        string     `json:"phone_number"`
-	Name               string     `json:"name"`
-	ProfileName        string     `json:"profile_name"`
-	AvatarURL          string     `json:"avatar_url"`
-	Status             string     `json:"status"`
-	Tags               []string   `json:"tags"`
-	CustomFields       any        `json:"custom_fields"`
-	LastMessageAt      *time.Time `json:"last_message_at"`
-	LastMessagePreview string     `json:"last_message_preview"`
-	UnreadCount        int        `json:"unread_count"`
-	AssignedUserID     *uuid.UUID `json:"assigned_user_id,omitempty"`
-	CreatedAt          time.Time  `json:"created_at"`
-	UpdatedAt          time.Time  `json:"updated_at"`
+	ID                 uuid.UUID     `json:"id"`
+	PhoneNumber        string        `json:"phone_number"`
+	Name               string        `json:"name"`
+	ProfileName        string        `json:"profile_name"`
+	AvatarURL          string        `json:"avatar_url"`
+	Status             string        `json:"status"`
+	Tags               []string      `json:"tags"`
+	CustomFields       any           `json:"custom_fields"`
+	WhatsAppAccount    string        `json:"whatsapp_account"`
+	OptInStatus        string        `json:"opt_in_status"`
+	OptInUpdatedAt     *time.Time    `json:"opt_in_updated_at,omitempty"`
+	LastSeenAt         *time.Time    `json:"last_seen_at"` // Last message from the contact
+	LastMessageAt      *time.Time    `json:"last_message_at"`
+	LastMessagePreview string        `json:"last_message_preview"`
+	UnreadCount        int           `json:"unread_count"`
+	AssignedUserID     *uuid.UUID    `json:"assigned_user_id,omitempty"`
+	Timezone           string        `json:"timezone"`
+	Language           string        `json:"language,omitempty"`
+	AIDisabled         bool          `json:"ai_disabled"`
+	BlockedAt          *time.Time    `json:"blocked_at,omitempty"` // Set while the contact is blocked
+	BlockedUntil       *time.Time    `json:"blocked_until,omitempty"`
+	BlockReason        string        `json:"block_reason,omitempty"`
+	BotPausedUntil     *time.Time    `json:"bot_paused_until,omitempty"`
+	ServiceWindow      ServiceWindow `json:"service_window"`
+	CreatedAt          time.Time     `json:"created_at"`
+	UpdatedAt          time.Time     `json:"updated_at"`
 }
 
 // MessageResponse represents a message for the frontend
 type MessageResponse struct {
-	ID               uuid.UUID            `json:"id"`
-	ContactID        uuid.UUID            `json:"contact_id"`
-	Direction        models.Direction     `json:"direction"`
-	MessageType      models.MessageType   `json:"message_type"`
-	Content          any                  `json:"content"`
-	MediaURL         string               `json:"media_url,omitempty"`
-	MediaMimeType    string               `json:"media_mime_type,omitempty"`
-	MediaFilename    string               `json:"media_filename,omitempty"`
-	InteractiveData  models.JSONB         `json:"interactive_data,omitempty"`
-	Status           models.MessageStatus `json:"status"`
-	WAMID            string               `json:"wamid"`
-	Error            string               `json:"error_message"`
-	IsReply          bool                 `json:"is_reply"`
-	ReplyToMessageID *string              `json:"reply_to_message_id,omitempty"`
-	ReplyToMessage   *ReplyPreview        `json:"reply_to_message,omitempty"`
-	Reactions        []ReactionInfo       `json:"reactions,omitempty"`
-	CreatedAt        time.Time            `json:"created_at"`
-	UpdatedAt        time.Time            `json:"updated_at"`
+	ID                    uuid.UUID            `json:"id"`
+	ContactID             uuid.UUID            `json:"contact_id"`
+	Direction             models.Direction     `json:"direction"`
+	MessageType           models.MessageType   `json:"message_type"`
+	Content               any                  `json:"content"`
+	MediaURL              string               `json:"media_url,omitempty"`
+	MediaMimeType         string               `json:"media_mime_type,omitempty"`
+	MediaFilename         string               `json:"media_filename,omitempty"`
+	Latitude              *float64             `json:"latitude,omitempty"`
+	Longitude             *float64             `json:"longitude,omitempty"`
+	InteractiveData       models.JSONB         `json:"interactive_data,omitempty"`
+	Status                models.MessageStatus `json:"status"`
+	WAMID                 string               `json:"wamid"`
+	Error                 string               `json:"error_message"`
+	ErrorCode             int                  `json:"error_code,omitempty"` // Meta error code of a failed message
+	DeliveredAt           *time.Time           `json:"delivered_at,omitempty"`
+	ReadAt                *time.Time           `json:"read_at,omitempty"`
+	IsReply               bool                 `json:"is_reply"`
+	ReplyToMessageID      *string              `json:"reply_to_message_id,omitempty"`
+	ReplyToMessage        *ReplyPreview        `json:"reply_to_message,omitempty"`
+	Reactions             []ReactionInfo       `json:"reactions,omitempty"`
+	Referral              *AdReferralPreview   `json:"referral,omitempty"` // Click-to-WhatsApp ad the message came from
+	ServiceWindowFallback bool                 `json:"service_window_fallback,omitempty"` // Window had closed, org fallback template sent instead
+	EditedAt              *time.Time           `json:"edited_at,omitempty"`
+	RevokedAt             *time.Time           `json:"revoked_at,omitempty"`
+	Translation           *MessageTranslation  `json:"translation,omitempty"` // Text in the agent's language
+	CreatedAt             time.Time            `json:"created_at"`
+	UpdatedAt             time.Time            `json:"updated_at"`
 }
 
 // ReplyPreview contains a preview of the replied-to message
@@ -96,7 +118,7 @@ func (a *App) ListContacts(r *fastglue.Request) error {
 	offset := (page - 1) * limit
 
 	var contacts []models.Contact
-	query := a.ScopeToOrg(a.DB, userID, orgID)
+	query := a.ScopeToOrg(a.replicaDB(), userID, orgID)
 
 	// Users without contacts:read permission can only see contacts assigned to them
 	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
@@ -107,6 +129,13 @@ func (a *App) ListContacts(r *fastglue.Request) error {
 		searchPattern := "%" + search + "%"
 		query = query.Where("phone_number LIKE ? OR profile_name LIKE ?", searchPattern, searchPattern)
 	}
+	if tag := string(r.RequestCtx.QueryArgs().Peek("tag")); tag != "" {
+		tagJSON, _ := json.Marshal([]string{tag})
+		query = query.Where("tags @> ?", string(tagJSON))
+	}
+	if optIn := string(r.RequestCtx.QueryArgs().Peek("opt_in_status")); optIn != "" {
+		query = query.Where("opt_in_status = ?", optIn)
+	}
 
 	// Order by last message time (most recent first)
 	query = query.Order("last_message_at DESC NULLS LAST, created_at DESC")
@@ -123,45 +152,10 @@ func (a *App) ListContacts(r *fastglue.Request) error {
 	shouldMask := a.ShouldMaskPhoneNumbers(orgID)
 
 	// Convert to response format
+	now := time.Now()
 	response := make([]ContactResponse, len(contacts))
-	for i, c := range contacts {
-		// Count unread messages
-		var unreadCount int64
-		a.DB.Model(&models.Message{}).
-			Where("contact_id = ? AND direction = ? AND status != ?", c.ID, models.DirectionIncoming, models.MessageStatusRead).
-			Count(&unreadCount)
-
-		tags := []string{}
-		if c.Tags != nil {
-			for _, t := range c.Tags {
-				if s, ok := t.(string); ok {
-					tags = append(tags, s)
-				}
-			}
-		}
-
-		phoneNumber := c.PhoneNumber
-		profileName := c.ProfileName
-		if shouldMask {
-			phoneNumber = MaskPhoneNumber(phoneNumber)
-			profileName = MaskIfPhoneNumber(profileName)
-		}
-
-		response[i] = ContactResponse{
-			ID:                 c.ID,
-			PhoneNumber:        phoneNumber,
-			Name:               profileName,
-			ProfileName:        profileName,
-			Status:             "active",
-			Tags:               tags,
-			CustomFields:       c.Metadata,
-			LastMessageAt:      c.LastMessageAt,
-			LastMessagePreview: c.LastMessagePreview,
-			UnreadCount:        int(unreadCount),
-			AssignedUserID:     c.AssignedUserID,
-			CreatedAt:          c.CreatedAt,
-			UpdatedAt:          c.UpdatedAt,
-		}
+	for i := range contacts {
+		response[i] = a.contactToResponse(&contacts[i], shouldMask, now)
 	}
 
 	return r.SendEnvelope(map[string]any{
@@ -196,46 +190,288 @@ func (a *App) GetContact(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
 	}
 
-	// Count unread messages
+	return r.SendEnvelope(a.contactToResponse(&contact, a.ShouldMaskPhoneNumbers(orgID), time.Now()))
+}
+
+// ContactRequest is the body of a contact create or update. On update, omitted
+// fields keep their value and custom_fields replaces the contact's custom fields.
+type ContactRequest struct {
+	PhoneNumber     *string                    `json:"phone_number"`
+	Name            *string                    `json:"name"`
+	WhatsAppAccount *string                    `json:"whatsapp_account"` // Account conversations with the contact use
+	Tags            *[]string                  `json:"tags"`
+	CustomFields    map[string]any             `json:"custom_fields"`
+	OptInStatus     *models.ContactOptInStatus `json:"opt_in_status"`
+	Timezone        *string                    `json:"timezone"`
+}
+
+// CreateContact adds a contact to the organization. A contact deleted earlier with
+// the same phone number is restored.
+func (a *App) CreateContact(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "You do not have permission to create contacts", nil, "")
+	}
+
+	var req ContactRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if req.PhoneNumber == nil || *req.PhoneNumber == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "phone_number is required", nil, "")
+	}
+
+	contact := models.Contact{OrganizationID: orgID, OptInStatus: models.ContactOptInStatusUnknown}
+	updates, err := a.contactUpdates(&contact, &req)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	var existing models.Contact
+	if err := a.DB.Unscoped().Where("organization_id = ? AND phone_number = ?", orgID, contact.PhoneNumber).
+		First(&existing).Error; err == nil {
+		if existing.DeletedAt.Valid {
+			// The phone number is unique per organization, so bring the deleted contact back
+			updates["deleted_at"] = nil
+			if err := a.DB.Unscoped().Model(&existing).Updates(updates).Error; err != nil {
+				a.Log.Error("Failed to restore contact", "error", err, "contact_id", existing.ID)
+				return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create contact", nil, "")
+			}
+			if err := a.DB.First(&contact, "id = ?", existing.ID).Error; err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create contact", nil, "")
+			}
+			a.recordConsentChange(&contact, existing.OptInStatus, models.ContactConsentSourceUser, "", &userID)
+			a.Log.Info("Contact restored", "contact_id", contact.ID, "user_id", userID)
+			return r.SendEnvelope(a.contactToResponse(&contact, a.ShouldMaskPhoneNumbers(orgID), time.Now()))
+		}
+		return r.SendErrorEnvelope(fasthttp.StatusConflict, "A contact with this phone number already exists", nil, "")
+	}
+
+	if contact.Timezone == "" {
+		contact.Timezone = models.TimezoneForPhoneNumber(contact.PhoneNumber)
+	}
+	if err := a.DB.Create(&contact).Error; err != nil {
+		a.Log.Error("Failed to create contact", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create contact", nil, "")
+	}
+	a.recordConsentChange(&contact, models.ContactOptInStatusUnknown, models.ContactConsentSourceUser, "", &userID)
+
+	a.Log.Info("Contact created", "contact_id", contact.ID, "user_id", userID)
+
+	return r.SendEnvelope(a.contactToResponse(&contact, a.ShouldMaskPhoneNumbers(orgID), time.Now()))
+}
+
+// UpdateContact updates a contact's details, tags, custom fields and opt-in status
+func (a *App) UpdateContact(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "You do not have permission to edit contacts", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var req ContactRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	oldPhone, oldOptIn := contact.PhoneNumber, contact.OptInStatus
+	updates, err := a.contactUpdates(contact, &req)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	if len(updates) == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Nothing to update", nil, "")
+	}
+
+	if contact.PhoneNumber != oldPhone {
+		var count int64
+		a.DB.Unscoped().Model(&models.Contact{}).
+			Where("organization_id = ? AND phone_number = ? AND id != ?", orgID, contact.PhoneNumber, contact.ID).
+			Count(&count)
+		if count > 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusConflict, "A contact with this phone number already exists", nil, "")
+		}
+	}
+
+	if err := a.DB.Model(contact).Updates(updates).Error; err != nil {
+		a.Log.Error("Failed to update contact", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update contact", nil, "")
+	}
+	a.recordConsentChange(contact, oldOptIn, models.ContactConsentSourceUser, "", &userID)
+
+	return r.SendEnvelope(a.contactToResponse(contact, a.ShouldMaskPhoneNumbers(orgID), time.Now()))
+}
+
+// DeleteContact deletes a contact. Its messages are kept, and a new message from
+// the same number restores it.
+func (a *App) DeleteContact(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionDelete) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "You do not have permission to delete contacts", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	if err := a.DB.Delete(contact).Error; err != nil {
+		a.Log.Error("Failed to delete contact", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete contact", nil, "")
+	}
+
+	a.Log.Info("Contact deleted", "contact_id", contact.ID, "user_id", userID)
+
+	return r.SendEnvelope(map[string]any{
+		"message": "Contact deleted",
+	})
+}
+
+// contactUpdates validates a contact request and returns the columns it changes,
+// applying them to contact too
+func (a *App) contactUpdates(contact *models.Contact, req *ContactRequest) (map[string]any, error) {
+	updates := map[string]any{}
+
+	if req.PhoneNumber != nil {
+		phone := searchPhoneDigits(*req.PhoneNumber)
+		if len(phone) < 7 || len(phone) > 15 {
+			return nil, fmt.Errorf("phone_number must have 7 to 15 digits")
+		}
+		contact.PhoneNumber = phone
+		updates["phone_number"] = phone
+	}
+	if req.Name != nil {
+		contact.ProfileName = strings.TrimSpace(*req.Name)
+		updates["profile_name"] = contact.ProfileName
+	}
+	if req.WhatsAppAccount != nil {
+		name := strings.TrimSpace(*req.WhatsAppAccount)
+		if name != "" {
+			var count int64
+			a.DB.Model(&models.WhatsAppAccount{}).Where("name = ? AND organization_id = ?", name, contact.OrganizationID).Count(&count)
+			if count == 0 {
+				return nil, fmt.Errorf("WhatsApp account not found")
+			}
+		}
+		contact.WhatsAppAccount = name
+		updates["whats_app_account"] = name
+	}
+	if req.Tags != nil {
+		tags := models.JSONBArray{}
+		for _, tag := range *req.Tags {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		contact.Tags = tags
+		updates["tags"] = tags
+	}
+	if req.CustomFields != nil {
+		contact.Metadata = models.JSONB(req.CustomFields)
+		updates["metadata"] = contact.Metadata
+	}
+	if req.OptInStatus != nil && *req.OptInStatus != contact.OptInStatus {
+		switch *req.OptInStatus {
+		case models.ContactOptInStatusUnknown, models.ContactOptInStatusOptedIn, models.ContactOptInStatusOptedOut:
+		default:
+			return nil, fmt.Errorf("opt_in_status must be unknown, opted_in or opted_out")
+		}
+		now := time.Now()
+		contact.OptInStatus = *req.OptInStatus
+		contact.OptInUpdatedAt = &now
+		updates["opt_in_status"] = contact.OptInStatus
+		updates["opt_in_updated_at"] = now
+	}
+	if req.Timezone != nil {
+		// An empty timezone resets it to the one inferred from the phone number
+		timezone := strings.TrimSpace(*req.Timezone)
+		if timezone == "" {
+			timezone = models.TimezoneForPhoneNumber(contact.PhoneNumber)
+		} else if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone")
+		}
+		contact.Timezone = timezone
+		updates["timezone"] = timezone
+	}
+
+	return updates, nil
+}
+
+// contactToResponse converts a contact for API responses, with its unread message count
+func (a *App) contactToResponse(c *models.Contact, shouldMask bool, now time.Time) ContactResponse {
 	var unreadCount int64
 	a.DB.Model(&models.Message{}).
-		Where("contact_id = ? AND direction = ? AND status != ?", contact.ID, models.DirectionIncoming, models.MessageStatusRead).
+		Where("contact_id = ? AND direction = ? AND status != ?", c.ID, models.DirectionIncoming, models.MessageStatusRead).
 		Count(&unreadCount)
 
 	tags := []string{}
-	if contact.Tags != nil {
-		for _, t := range contact.Tags {
-			if s, ok := t.(string); ok {
-				tags = append(tags, s)
-			}
+	for _, t := range c.Tags {
+		if s, ok := t.(string); ok {
+			tags = append(tags, s)
 		}
 	}
 
-	phoneNumber := contact.PhoneNumber
-	profileName := contact.ProfileName
-	shouldMask := a.ShouldMaskPhoneNumbers(orgID)
+	phoneNumber := c.PhoneNumber
+	profileName := c.ProfileName
 	if shouldMask {
 		phoneNumber = MaskPhoneNumber(phoneNumber)
 		profileName = MaskIfPhoneNumber(profileName)
 	}
 
-	response := ContactResponse{
-		ID:                 contact.ID,
+	optInStatus := c.OptInStatus
+	if optInStatus == "" {
+		optInStatus = models.ContactOptInStatusUnknown
+	}
+
+	resp := ContactResponse{
+		ID:                 c.ID,
 		PhoneNumber:        phoneNumber,
 		Name:               profileName,
 		ProfileName:        profileName,
 		Status:             "active",
 		Tags:               tags,
-		CustomFields:       contact.Metadata,
-		LastMessageAt:      contact.LastMessageAt,
-		LastMessagePreview: contact.LastMessagePreview,
+		CustomFields:       c.Metadata,
+		WhatsAppAccount:    c.WhatsAppAccount,
+		OptInStatus:        string(optInStatus),
+		OptInUpdatedAt:     c.OptInUpdatedAt,
+		LastSeenAt:         c.LastInboundAt,
+		LastMessageAt:      c.LastMessageAt,
+		LastMessagePreview: c.LastMessagePreview,
 		UnreadCount:        int(unreadCount),
-		AssignedUserID:     contact.AssignedUserID,
-		CreatedAt:          contact.CreatedAt,
-		UpdatedAt:          contact.UpdatedAt,
+		AssignedUserID:     c.AssignedUserID,
+		Timezone:           c.Timezone,
+		Language:           c.Language,
+		AIDisabled:         c.AIDisabled,
+		ServiceWindow:      newServiceWindow(a.serviceWindowExpiresAt(c), now),
+		CreatedAt:          c.CreatedAt,
+		UpdatedAt:          c.UpdatedAt,
 	}
-
-	return r.SendEnvelope(response)
+	if c.IsBlocked(now) {
+		resp.BlockedAt, resp.BlockedUntil, resp.BlockReason = c.BlockedAt, c.BlockedUntil, c.BlockReason
+	}
+	if c.IsBotPaused(now) {
+		resp.BotPausedUntil = c.BotPausedUntil
+	}
+	return resp
 }
 
 // GetMessages returns messages for a contact
@@ -316,10 +552,12 @@ func (a *App) GetMessages(r *fastglue.Request) error {
 		}
 
 		response := a.buildMessagesResponse(messages)
+		a.attachMessageTranslations(r.RequestCtx, orgID, userID, &contact, messages, response)
 		return r.SendEnvelope(map[string]any{
-			"messages": response,
-			"total":    total,
-			"has_more": len(messages) == limit,
+			"messages":       response,
+			"total":          total,
+			"has_more":       len(messages) == limit,
+			"service_window": newServiceWindow(a.serviceWindowExpiresAt(&contact), time.Now()),
 		})
 	}
 
@@ -347,12 +585,14 @@ func (a *App) GetMessages(r *fastglue.Request) error {
 	a.markMessagesAsRead(orgID, contactID, &contact)
 
 	response := a.buildMessagesResponse(messages)
+	a.attachMessageTranslations(r.RequestCtx, orgID, userID, &contact, messages, response)
 	return r.SendEnvelope(map[string]any{
-		"messages": response,
-		"total":    total,
-		"page":     page,
-		"limit":    limit,
-		"has_more": offset > 0,
+		"messages":       response,
+		"total":          total,
+		"page":           page,
+		"limit":          limit,
+		"has_more":       offset > 0,
+		"service_window": newServiceWindow(a.serviceWindowExpiresAt(&contact), time.Now()),
 	})
 }
 
@@ -376,11 +616,18 @@ func (a *App) buildMessagesResponse(messages []models.Message) []MessageResponse
 			MediaURL:        m.MediaURL,
 			MediaMimeType:   m.MediaMimeType,
 			MediaFilename:   m.MediaFilename,
+			Latitude:        m.Latitude,
+			Longitude:       m.Longitude,
 			InteractiveData: m.InteractiveData,
 			Status:          m.Status,
 			WAMID:           m.WhatsAppMessageID,
 			Error:           m.ErrorMessage,
+			ErrorCode:       m.ErrorCode,
+			DeliveredAt:     m.DeliveredAt,
+			ReadAt:          m.ReadAt,
 			IsReply:         m.IsReply,
+			EditedAt:        m.EditedAt,
+			RevokedAt:       m.RevokedAt,
 			CreatedAt:       m.CreatedAt,
 			UpdatedAt:       m.UpdatedAt,
 		}
@@ -415,6 +662,7 @@ func (a *App) buildMessagesResponse(messages []models.Message) []MessageResponse
 					}
 				}
 			}
+			msgResp.Referral = adReferralPreview(m.Metadata)
 		}
 
 		response[i] = msgResp
@@ -437,32 +685,15 @@ func (a *App) markMessagesAsRead(orgID uuid.UUID, contactID uuid.UUID, contact *
 	if len(unreadMessages) > 0 && contact.WhatsAppAccount != "" {
 		var account models.WhatsAppAccount
 		if err := a.DB.Where("organization_id = ? AND name = ?", orgID, contact.WhatsAppAccount).First(&account).Error; err == nil {
-			if account.AutoReadReceipt {
-				a.wg.Add(1)
-				go func() {
-					defer a.wg.Done()
-					// Use timeout context for external API calls
-					ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-					defer cancel()
-
-					waAccount := &whatsapp.Account{
-						PhoneID:     account.PhoneID,
-						AccessToken: account.AccessToken,
-						APIVersion:  a.Config.WhatsApp.APIVersion,
+			// With presence privacy, receipts wait until an agent replies
+			if account.AutoReadReceipt && !account.PresencePrivacy {
+				messageIDs := make([]string, 0, len(unreadMessages))
+				for _, msg := range unreadMessages {
+					if msg.WhatsAppMessageID != "" {
+						messageIDs = append(messageIDs, msg.WhatsAppMessageID)
 					}
-					for _, msg := range unreadMessages {
-						// Check if context was cancelled
-						if ctx.Err() != nil {
-							a.Log.Warn("Read receipt sending cancelled", "reason", ctx.Err())
-							return
-						}
-						if msg.WhatsAppMessageID != "" {
-							if err := a.WhatsApp.MarkMessageRead(ctx, waAccount, msg.WhatsAppMessageID); err != nil {
-								a.Log.Error("Failed to send read receipt", "error", err, "message_id", msg.WhatsAppMessageID)
-							}
-						}
-					}
-				}()
+				}
+				a.sendReadReceipts(&account, messageIDs)
 			}
 		}
 	}
@@ -478,15 +709,31 @@ type SendMessageRequest struct {
 
 	// Interactive message fields (for type="interactive")
 	Interactive *InteractiveContent `json:"interactive,omitempty"`
+
+	// Contact cards to share (for type="contacts")
+	Contacts []whatsapp.ContactCard `json:"contacts,omitempty"`
+
+	// Canned response to send as the text, with its placeholders filled in. Variables
+	// are the values of placeholders not known from the contact, like {{order_id}}.
+	CannedResponseID string            `json:"canned_response_id,omitempty"`
+	Variables        map[string]string `json:"variables,omitempty"`
+
+	// Translate overrides whether a text reply is translated into the contact's
+	// language; by default it is when the organization translates replies
+	Translate *bool `json:"translate,omitempty"`
 }
 
 // InteractiveContent holds interactive message data
 type InteractiveContent struct {
-	Type       string           `json:"type"`                  // "button", "list", "cta_url"
-	Body       string           `json:"body"`                  // Body text
-	Buttons    []ButtonContent  `json:"buttons,omitempty"`     // For button type
-	ButtonText string           `json:"button_text,omitempty"` // For cta_url type
-	URL        string           `json:"url,omitempty"`         // For cta_url type
+	Type       string                  `json:"type"`                  // "button", "list", "cta_url", "product", "product_list"
+	Body       string                  `json:"body"`                  // Body text
+	Buttons    []ButtonContent         `json:"buttons,omitempty"`     // For button type
+	ButtonText string                  `json:"button_text,omitempty"` // For cta_url type
+	URL        string                  `json:"url,omitempty"`         // For cta_url type
+	SKU        string                  `json:"sku,omitempty"`         // For product type, the product's retailer ID
+	Header     string                  `json:"header,omitempty"`      // For product_list type
+	Footer     string                  `json:"footer,omitempty"`      // For product_list type
+	Sections   []ProductSectionRequest `json:"sections,omitempty"`    // For product_list type
 }
 
 // ButtonContent represents a button in interactive messages
@@ -513,22 +760,45 @@ func (a *App) SendMessage(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
 	}
 
-	// Get contact (users without full read permission can only message their assigned contacts)
-	var contact models.Contact
-	query := a.DB.Where("id = ? AND organization_id = ?", contactID, orgID)
-	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
-		query = query.Where("assigned_user_id = ?", userID)
-	}
-	if err := query.First(&contact).Error; err != nil {
+	contact, err := a.findReplyContact(orgID, userID, contactID)
+	if err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
 	}
 
+	// Insert a canned response as the text
+	var cannedResponse *models.CannedResponse
+	if req.CannedResponseID != "" {
+		cannedResponseID, err := uuid.Parse(req.CannedResponseID)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid canned_response_id", nil, "")
+		}
+		if req.Type != "" && req.Type != models.MessageTypeText {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Canned responses can only be sent as text messages", nil, "")
+		}
+		cannedResponse = &models.CannedResponse{}
+		if err := a.DB.Where("id = ? AND organization_id = ? AND is_active = ?", cannedResponseID, orgID, true).
+			First(cannedResponse).Error; err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Canned response not found", nil, "")
+		}
+		req.Type = models.MessageTypeText
+		req.Content.Body = a.renderCannedResponse(cannedResponse.Content, contact, req.Variables)
+		if missing := ExtractParamNamesFromContent(req.Content.Body); len(missing) > 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+				"Missing canned response variables: "+strings.Join(missing, ", "), nil, "")
+		}
+	}
+
 	// Get WhatsApp account
 	account, err := a.resolveWhatsAppAccount(orgID, contact.WhatsAppAccount)
 	if err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
 	}
 
+	// Free-form messages can only be sent within the customer service window
+	if !isServiceWindowOpen(a.serviceWindowExpiresAt(contact), time.Now()) {
+		return a.sendServiceWindowFallback(r, account, contact, userID)
+	}
+
 	// Handle reply context
 	var replyToMessage *models.Message
 	if req.ReplyToMessageID != "" {
@@ -544,7 +814,7 @@ func (a *App) SendMessage(r *fastglue.Request) error {
 	// Build request and send using unified sender
 	msgReq := OutgoingMessageRequest{
 		Account:        account,
-		Contact:        &contact,
+		Contact:        contact,
 		Type:           req.Type,
 		Content:        req.Content.Body,
 		ReplyToMessage: replyToMessage,
@@ -557,6 +827,33 @@ func (a *App) SendMessage(r *fastglue.Request) error {
 		msgReq.ButtonText = req.Interactive.ButtonText
 		msgReq.URL = req.Interactive.URL
 
+		if req.Interactive.Type == "product" {
+			product, err := a.findProductBySKU(orgID, account.Name, req.Interactive.SKU)
+			if err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+			}
+			if !productAvailable(product) {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Product %q is %s", product.RetailerID, product.Availability), nil, "")
+			}
+			msgReq.Product = product
+		}
+		if req.Interactive.Type == "product_list" {
+			list, products, err := a.productListMessage(orgID, account.Name, req.Interactive.Header, req.Interactive.Body, req.Interactive.Footer, req.Interactive.Sections, false)
+			if err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+			}
+			for _, product := range products {
+				if !productAvailable(&product) {
+					return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Product %q is %s", product.RetailerID, product.Availability), nil, "")
+				}
+			}
+			if err := list.Validate(); err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+			}
+			msgReq.ProductList = list
+			msgReq.Products = products
+		}
+
 		// Convert buttons
 		if len(req.Interactive.Buttons) > 0 {
 			msgReq.Buttons = make([]whatsapp.Button, len(req.Interactive.Buttons))
@@ -569,15 +866,52 @@ func (a *App) SendMessage(r *fastglue.Request) error {
 		}
 	}
 
+	// Share contact cards, e.g. a colleague's number
+	if req.Type == models.MessageTypeContacts {
+		if err := whatsapp.ValidateContactCards(req.Contacts); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		msgReq.Contacts = req.Contacts
+	}
+
+	// Expand org shortcodes (e.g. /hours) inline in agent replies
+	switch msgReq.Type {
+	case models.MessageTypeText:
+		msgReq.Content = a.expandOrgShortcodes(orgID, msgReq.Content)
+		// Send the reply in the contact's language, keeping the agent's text
+		content, metadata, err := a.translateReply(r.RequestCtx, orgID, userID, contact, msgReq.Content, req.Translate)
+		if err != nil {
+			a.Log.Error("Failed to translate reply", "error", err, "contact_id", contact.ID)
+			return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to translate reply: "+err.Error(), nil, "")
+		}
+		msgReq.Content = content
+		msgReq.Metadata = metadata
+	case models.MessageTypeInteractive:
+		msgReq.BodyText = a.expandOrgShortcodes(orgID, msgReq.BodyText)
+		if msgReq.ProductList != nil {
+			msgReq.ProductList.Body = msgReq.BodyText
+		}
+	}
+
 	opts := DefaultSendOptions()
 	opts.SentByUserID = &userID
 
 	ctx := context.Background()
 	message, err := a.SendOutgoingMessage(ctx, msgReq, opts)
 	if err != nil {
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return r.SendErrorEnvelope(fasthttp.StatusForbidden, quotaErr.Error(), nil, "")
+		}
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to send message", nil, "")
 	}
 
+	if cannedResponse != nil {
+		if err := a.recordCannedResponseUse(cannedResponse, userID, contact); err != nil {
+			a.Log.Error("Failed to record canned response use", "error", err, "canned_response_id", cannedResponse.ID)
+		}
+	}
+
 	// Build response
 	response := MessageResponse{
 		ID:              message.ID,
@@ -591,6 +925,9 @@ func (a *App) SendMessage(r *fastglue.Request) error {
 		CreatedAt:       message.CreatedAt,
 		UpdatedAt:       message.UpdatedAt,
 	}
+	if lang, ok := message.Metadata[metadataTranslatedFrom].(string); ok {
+		response.Translation = cachedTranslation(message, lang)
+	}
 
 	// Add reply context to response
 	if message.IsReply && message.ReplyToMessageID != nil && replyToMessage != nil {
@@ -607,6 +944,20 @@ func (a *App) SendMessage(r *fastglue.Request) error {
 	return r.SendEnvelope(response)
 }
 
+// findReplyContact gets a contact a user can reply to. Users without full read
+// permission can only message their assigned contacts.
+func (a *App) findReplyContact(orgID, userID, contactID uuid.UUID) (*models.Contact, error) {
+	var contact models.Contact
+	query := a.DB.Where("id = ? AND organization_id = ?", contactID, orgID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("assigned_user_id = ?", userID)
+	}
+	if err := query.First(&contact).Error; err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
 // resolveWhatsAppAccount gets the WhatsApp account for sending messages
 func (a *App) resolveWhatsAppAccount(orgID uuid.UUID, accountName string) (*models.WhatsAppAccount, error) {
 	var account models.WhatsAppAccount
@@ -635,63 +986,90 @@ func truncateString(s string, maxLen int) string {
 	return s[:maxLen-3] + "..."
 }
 
+// SendMediaMessageRequest is the JSON body of a media message sent from a public
+// URL or a media ID already uploaded to WhatsApp. Files are uploaded as
+// multipart form data with the same fields and a "file".
+type SendMediaMessageRequest struct {
+	ContactID string `json:"contact_id"`
+	Type      string `json:"type"`      // image, video, audio or document
+	MediaURL  string `json:"media_url"` // Public URL WhatsApp downloads the media from
+	MediaID   string `json:"media_id"`  // WhatsApp media ID
+	Caption   string `json:"caption"`
+	Filename  string `json:"filename"` // Shown for documents
+}
+
 // SendMediaMessage sends a media message (image, document, video, audio) to a contact
 func (a *App) SendMediaMessage(r *fastglue.Request) error {
 	orgID := r.RequestCtx.UserValue("organization_id").(uuid.UUID)
 	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
 
-	// Parse multipart form
-	form, err := r.RequestCtx.MultipartForm()
-	if err != nil {
-		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid multipart form", nil, "")
-	}
+	var req SendMediaMessageRequest
+	var fileData []byte
+	var mimeType string
+	if bytes.HasPrefix(r.RequestCtx.Request.Header.ContentType(), []byte("multipart/form-data")) {
+		form, err := r.RequestCtx.MultipartForm()
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid multipart form", nil, "")
+		}
+		req = SendMediaMessageRequest{
+			ContactID: formValue(form.Value, "contact_id"),
+			Type:      formValue(form.Value, "type"),
+			Caption:   formValue(form.Value, "caption"),
+		}
 
-	// Get contact ID from form
-	contactIDValues := form.Value["contact_id"]
-	if len(contactIDValues) == 0 {
-		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "contact_id is required", nil, "")
-	}
-	contactID, err := uuid.Parse(contactIDValues[0])
-	if err != nil {
-		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact ID", nil, "")
-	}
+		files := form.File["file"]
+		if len(files) == 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "file is required", nil, "")
+		}
+		fileHeader := files[0]
+		req.Filename = fileHeader.Filename
 
-	// Get media type (image, document, video, audio)
-	mediaType := "image"
-	if typeValues := form.Value["type"]; len(typeValues) > 0 {
-		mediaType = typeValues[0]
-	}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Failed to read file", nil, "")
+		}
+		defer func() { _ = file.Close() }()
 
-	// Get caption (optional)
-	caption := ""
-	if captionValues := form.Value["caption"]; len(captionValues) > 0 {
-		caption = captionValues[0]
-	}
+		fileData, err = io.ReadAll(file)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to read file data", nil, "")
+		}
 
-	// Get uploaded file
-	files := form.File["file"]
-	if len(files) == 0 {
-		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "file is required", nil, "")
+		mimeType = fileHeader.Header.Get("Content-Type")
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+	} else if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
 	}
-	fileHeader := files[0]
 
-	// Open the file
-	file, err := fileHeader.Open()
-	if err != nil {
-		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Failed to read file", nil, "")
+	if req.ContactID == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "contact_id is required", nil, "")
 	}
-	defer func() { _ = file.Close() }()
-
-	// Read file data
-	fileData, err := io.ReadAll(file)
+	contactID, err := uuid.Parse(req.ContactID)
 	if err != nil {
-		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to read file data", nil, "")
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact ID", nil, "")
+	}
+	if req.Type == "" {
+		req.Type = whatsapp.MediaTypeImage
 	}
 
-	// Get MIME type
-	mimeType := fileHeader.Header.Get("Content-Type")
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
+	// Check the media against WhatsApp's limits before anything is stored or sent
+	if fileData != nil {
+		if err := whatsapp.ValidateMedia(req.Type, mimeType, int64(len(fileData))); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		if utf8.RuneCountInString(req.Caption) > whatsapp.MaxMediaCaption {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Caption must be %d characters or fewer", whatsapp.MaxMediaCaption), nil, "")
+		}
+	} else {
+		media := whatsapp.MediaMessage{Type: req.Type, ID: req.MediaID, Link: req.MediaURL, Caption: req.Caption}
+		if err := media.Validate(); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		if req.Filename == "" && req.MediaURL != "" {
+			req.Filename = mediaLinkFilename(req.MediaURL)
+		}
 	}
 
 	// Get contact (users without full read permission can only message their assigned contacts)
@@ -719,23 +1097,36 @@ func (a *App) SendMediaMessage(r *fastglue.Request) error {
 		}
 	}
 
-	// Save file locally first
-	localPath, err := a.saveMediaLocally(fileData, mimeType, fileHeader.Filename)
-	if err != nil {
-		a.Log.Error("Failed to save media locally", "error", err)
-		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to save media", nil, "")
+	// Free-form messages can only be sent within the customer service window
+	if !isServiceWindowOpen(a.serviceWindowExpiresAt(&contact), time.Now()) {
+		return a.sendServiceWindowFallback(r, &account, &contact, userID)
 	}
 
 	// Build and send via unified message sender
 	msgReq := OutgoingMessageRequest{
 		Account:       &account,
 		Contact:       &contact,
-		Type:          models.MessageType(mediaType),
-		MediaData:     fileData,
-		MediaURL:      localPath,
+		Type:          models.MessageType(req.Type),
+		MediaID:       req.MediaID,
+		MediaLink:     req.MediaURL,
 		MediaMimeType: mimeType,
-		MediaFilename: fileHeader.Filename,
-		Caption:       caption,
+		MediaFilename: req.Filename,
+		Caption:       a.expandOrgShortcodes(orgID, req.Caption),
+	}
+
+	// Uploaded files are kept in media storage for the chat
+	if fileData != nil {
+		localPath, err := a.saveMedia(orgID, fileData, mimeType, req.Filename)
+		if err != nil {
+			var quotaErr *QuotaExceededError
+			if errors.As(err, &quotaErr) {
+				return r.SendErrorEnvelope(fasthttp.StatusForbidden, quotaErr.Error(), nil, "")
+			}
+			a.Log.Error("Failed to save media locally", "error", err)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to save media", nil, "")
+		}
+		msgReq.MediaData = fileData
+		msgReq.MediaURL = localPath
 	}
 
 	opts := DefaultSendOptions()
@@ -744,6 +1135,10 @@ func (a *App) SendMediaMessage(r *fastglue.Request) error {
 	ctx := context.Background()
 	message, err := a.SendOutgoingMessage(ctx, msgReq, opts)
 	if err != nil {
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return r.SendErrorEnvelope(fasthttp.StatusForbidden, quotaErr.Error(), nil, "")
+		}
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to send message", nil, "")
 	}
 
@@ -764,8 +1159,34 @@ func (a *App) SendMediaMessage(r *fastglue.Request) error {
 	return r.SendEnvelope(response)
 }
 
-// saveMediaLocally saves media data to local storage and returns the relative path
-func (a *App) saveMediaLocally(data []byte, mimeType, filename string) (string, error) {
+// formValue returns the first value of a multipart form field
+func formValue(values map[string][]string, key string) string {
+	if v := values[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// mediaLinkFilename returns the file name at the end of a media URL's path
+func mediaLinkFilename(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// saveMedia saves media data to media storage and returns the relative path
+func (a *App) saveMedia(orgID uuid.UUID, data []byte, mimeType, filename string) (string, error) {
+	// Enforce the plan's storage limit
+	if err := a.checkQuota(orgID, models.UsageMetricStorage, int64(len(data))); err != nil {
+		return "", err
+	}
+
 	// Determine subdirectory based on MIME type
 	var subdir string
 	switch {
@@ -779,11 +1200,6 @@ func (a *App) saveMediaLocally(data []byte, mimeType, filename string) (string,
 		subdir = "documents"
 	}
 
-	// Ensure directory exists
-	if err := a.ensureMediaDir(subdir); err != nil {
-		return "", fmt.Errorf("failed to create media directory: %w", err)
-	}
-
 	// Get extension from MIME type or filename
 	ext := getExtensionFromMimeType(mimeType)
 	if ext == "" {
@@ -797,16 +1213,15 @@ func (a *App) saveMediaLocally(data []byte, mimeType, filename string) (string,
 
 	// Generate unique filename
 	newFilename := uuid.New().String() + ext
-	filePath := filepath.Join(a.getMediaStoragePath(), subdir, newFilename)
+	relativePath := path.Join(subdir, newFilename)
 
 	// Save file
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := a.mediaStore().Put(context.Background(), relativePath, data, mimeType); err != nil {
 		return "", fmt.Errorf("failed to save media file: %w", err)
 	}
+	a.recordUsage(orgID, models.UsageMetricStorage, int64(len(data)))
 
-	// Return relative path
-	relativePath := filepath.Join(subdir, newFilename)
-	a.Log.Info("Media saved locally", "path", relativePath, "size", len(data))
+	a.Log.Info("Media saved", "path", relativePath, "size", len(data))
 
 	return relativePath, nil
 }
@@ -869,58 +1284,9 @@ func (a *App) SendReaction(r *fastglue.Request) error {
 		}
 	}
 
-	// Parse existing reactions from Metadata
-	var metadata map[string]interface{}
-	if message.Metadata != nil {
-		metadata = message.Metadata
-	} else {
-		metadata = make(map[string]interface{})
-	}
-
-	// Get or initialize reactions array
-	type Reaction struct {
-		Emoji     string `json:"emoji"`
-		FromPhone string `json:"from_phone,omitempty"`
-		FromUser  string `json:"from_user,omitempty"`
-	}
-	var reactions []Reaction
-	if reactionsRaw, ok := metadata["reactions"]; ok {
-		if reactionsArray, ok := reactionsRaw.([]interface{}); ok {
-			for _, r := range reactionsArray {
-				if rMap, ok := r.(map[string]interface{}); ok {
-					emoji, _ := rMap["emoji"].(string)
-					fromPhone, _ := rMap["from_phone"].(string)
-					fromUser, _ := rMap["from_user"].(string)
-					reactions = append(reactions, Reaction{
-						Emoji:     emoji,
-						FromPhone: fromPhone,
-						FromUser:  fromUser,
-					})
-				}
-			}
-		}
-	}
-
-	// Remove existing reaction from this user (each user can only have one reaction)
-	userIDStr := userID.String()
-	var newReactions []Reaction
-	for _, r := range reactions {
-		if r.FromUser != userIDStr {
-			newReactions = append(newReactions, r)
-		}
-	}
-
-	// Add new reaction if emoji is not empty
-	if req.Emoji != "" {
-		newReactions = append(newReactions, Reaction{
-			Emoji:    req.Emoji,
-			FromUser: userIDStr,
-		})
-	}
-
-	// Update metadata
-	metadata["reactions"] = newReactions
-	if err := a.DB.Model(&message).Update("metadata", metadata).Error; err != nil {
+	// Each user can only have one reaction, an empty emoji removes it
+	reactions, err := a.saveReaction(orgID, contact.ID, &message, Reaction{Emoji: req.Emoji, FromUser: userID.String()})
+	if err != nil {
 		a.Log.Error("Failed to update message reactions", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update reaction", nil, "")
 	}
@@ -928,21 +1294,9 @@ func (a *App) SendReaction(r *fastglue.Request) error {
 	// Send reaction to WhatsApp API
 	go a.sendWhatsAppReaction(&account, &contact, &message, req.Emoji)
 
-	// Broadcast via WebSocket
-	if a.WSHub != nil {
-		a.WSHub.BroadcastToOrg(orgID, websocket.WSMessage{
-			Type: "reaction_update",
-			Payload: map[string]any{
-				"message_id": message.ID.String(),
-				"contact_id": contact.ID.String(),
-				"reactions":  newReactions,
-			},
-		})
-	}
-
 	return r.SendEnvelope(map[string]any{
 		"message_id": message.ID.String(),
-		"reactions":  newReactions,
+		"reactions":  reactions,
 	})
 }
 
@@ -953,47 +1307,14 @@ func (a *App) sendWhatsAppReaction(account *models.WhatsAppAccount, contact *mod
 		return
 	}
 
-	url := fmt.Sprintf("%s/%s/%s/messages", a.Config.WhatsApp.BaseURL, account.APIVersion, account.PhoneID)
-
-	payload := map[string]any{
-		"messaging_product": "whatsapp",
-		"recipient_type":    "individual",
-		"to":                contact.PhoneNumber,
-		"type":              "reaction",
-		"reaction": map[string]any{
-			"message_id": message.WhatsAppMessageID,
-			"emoji":      emoji, // Empty string removes the reaction
-		},
-	}
-
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		a.Log.Error("Failed to marshal reaction payload", "error", err)
-		return
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		a.Log.Error("Failed to create reaction request", "error", err)
-		return
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+account.AccessToken)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
+	// An empty emoji removes the reaction
+	if _, err := a.WhatsApp.SendReaction(ctx, a.toWhatsAppAccount(account), contact.PhoneNumber, message.WhatsAppMessageID, emoji); err != nil {
 		a.Log.Error("Failed to send reaction", "error", err)
 		return
 	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		a.Log.Error("WhatsApp API reaction error", "status", resp.StatusCode, "body", string(body))
-		return
-	}
 
 	a.Log.Info("Reaction sent successfully", "message_id", message.WhatsAppMessageID, "emoji", emoji)
 }
@@ -1156,3 +1477,23 @@ func (a *App) GetContactSessionData(r *fastglue.Request) error {
 
 	return r.SendEnvelope(response)
 }
+
+// accessibleContact loads the contact in the request path. Users without full
+// read permission can only access their assigned contacts.
+func (a *App) accessibleContact(r *fastglue.Request, orgID uuid.UUID) (*models.Contact, string, int) {
+	contactID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, "Invalid contact ID", fasthttp.StatusBadRequest
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	var contact models.Contact
+	query := a.DB.Where("id = ? AND organization_id = ?", contactID, orgID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("assigned_user_id = ?", userID)
+	}
+	if err := query.First(&contact).Error; err != nil {
+		return nil, "Contact not found", fasthttp.StatusNotFound
+	}
+	return &contact, "", 0
+}
@@ -0,0 +1,107 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_CreateContact(t *testing.T) {
+	app := agentTransfersTestApp(t)
+	org := createTransferTestOrg(t, app)
+	user := createTransferTestUser(t, app, org.ID, nil)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"phone_number":  "+1 (555) 010-0001",
+		"name":          " Alice ",
+		"tags":          []string{"vip", " "},
+		"custom_fields": map[string]any{"plan": "pro"},
+		"opt_in_status": "opted_in",
+	})
+	setTransferAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.CreateContact(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp handlers.ContactResponse
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	assert.Equal(t, "15550100001", resp.PhoneNumber)
+	assert.Equal(t, "Alice", resp.Name)
+	assert.Equal(t, []string{"vip"}, resp.Tags)
+	assert.Equal(t, "opted_in", resp.OptInStatus)
+	assert.NotNil(t, resp.OptInUpdatedAt)
+	assert.Equal(t, "America/New_York", resp.Timezone)
+
+	// The phone number is unique in the organization
+	req = testutil.NewJSONRequest(t, map[string]any{"phone_number": "15550100001"})
+	setTransferAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.CreateContact(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusConflict, "already exists")
+}
+
+func TestApp_CreateContact_RestoresDeleted(t *testing.T) {
+	app := agentTransfersTestApp(t)
+	org := createTransferTestOrg(t, app)
+	user := createTransferTestUser(t, app, org.ID, nil)
+	contact := createTestContact(t, app, org.ID)
+	require.NoError(t, app.DB.Delete(contact).Error)
+
+	req := testutil.NewJSONRequest(t, map[string]any{"phone_number": contact.PhoneNumber, "name": "Back again"})
+	setTransferAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.CreateContact(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp handlers.ContactResponse
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	assert.Equal(t, contact.ID, resp.ID)
+	assert.Equal(t, "Back again", resp.Name)
+}
+
+func TestApp_UpdateContact(t *testing.T) {
+	app := agentTransfersTestApp(t)
+	org := createTransferTestOrg(t, app)
+	user := createTransferTestUser(t, app, org.ID, nil)
+	contact := createTestContact(t, app, org.ID)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"custom_fields": map[string]any{"city": "Pune"},
+		"opt_in_status": "opted_out",
+	})
+	setTransferAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	require.NoError(t, app.UpdateContact(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var stored models.Contact
+	require.NoError(t, app.DB.First(&stored, "id = ?", contact.ID).Error)
+	assert.Equal(t, contact.ProfileName, stored.ProfileName)
+	assert.Equal(t, "Pune", stored.Metadata["city"])
+	assert.Equal(t, models.ContactOptInStatusOptedOut, stored.OptInStatus)
+
+	req = testutil.NewJSONRequest(t, map[string]any{"opt_in_status": "maybe"})
+	setTransferAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	require.NoError(t, app.UpdateContact(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "opt_in_status must be")
+}
+
+func TestApp_DeleteContact(t *testing.T) {
+	app := agentTransfersTestApp(t)
+	org := createTransferTestOrg(t, app)
+	user := createTransferTestUser(t, app, org.ID, nil)
+	contact := createTestContact(t, app, org.ID)
+
+	req := testutil.NewJSONRequest(t, nil)
+	setTransferAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	require.NoError(t, app.DeleteContact(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var count int64
+	app.DB.Model(&models.Contact{}).Where("id = ?", contact.ID).Count(&count)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConversationRates are an organization's estimated Meta rates by pricing category,
+// in the smallest unit of its conversation currency
+type ConversationRates struct {
+	Marketing      int64 `json:"marketing"`
+	Utility        int64 `json:"utility"`
+	Authentication int64 `json:"authentication"`
+	Service        int64 `json:"service"`
+}
+
+// rate returns the rate for a Meta pricing category
+func (r ConversationRates) rate(category string) int64 {
+	return walletConversationRate(models.WalletRates{
+		Marketing:      r.Marketing,
+		Utility:        r.Utility,
+		Authentication: r.Authentication,
+		Service:        r.Service,
+	}, category)
+}
+
+// ConversationCostSettings are the organization settings used to estimate what Meta
+// bills for conversations, and to alert when a month's costs run over budget
+type ConversationCostSettings struct {
+	ConversationRates    ConversationRates `json:"conversation_rates"`
+	ConversationCurrency string            `json:"conversation_currency"`
+	ConversationBudget   int64             `json:"conversation_budget"` // Per month, 0 = no budget alerts
+}
+
+// ConversationCostRow is the conversations of a category on a number in a month
+type ConversationCostRow struct {
+	Period          string `json:"period"`
+	WhatsAppAccount string `json:"whatsapp_account"`
+	Category        string `json:"category"`
+	Count           int64  `json:"count"`
+	Billable        int64  `json:"billable"`
+	Cost            int64  `json:"cost"`
+}
+
+// conversationCostSettings reads the conversation cost settings from organization settings
+func conversationCostSettings(settings models.JSONB) ConversationCostSettings {
+	costs := ConversationCostSettings{ConversationCurrency: "USD"}
+	if rates, ok := settings["conversation_rates"].(map[string]interface{}); ok {
+		costs.ConversationRates = ConversationRates{
+			Marketing:      jsonbInt64(rates["marketing"]),
+			Utility:        jsonbInt64(rates["utility"]),
+			Authentication: jsonbInt64(rates["authentication"]),
+			Service:        jsonbInt64(rates["service"]),
+		}
+	}
+	if v, ok := settings["conversation_currency"].(string); ok && v != "" {
+		costs.ConversationCurrency = v
+	}
+	costs.ConversationBudget = jsonbInt64(settings["conversation_budget"])
+	return costs
+}
+
+// jsonbInt64 returns a JSONB number as an int64
+func jsonbInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	}
+	return 0
+}
+
+// recordConversationCharge stores the conversation, or message on per-message pricing,
+// that a status update reports pricing for, and checks the organization's budget
+func (a *App) recordConversationCharge(message *models.Message, whatsappMsgID string, status WebhookStatus) {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", message.OrganizationID).First(&org).Error; err != nil {
+		a.Log.Error("Failed to load organization for conversation charge", "error", err, "org_id", message.OrganizationID)
+		return
+	}
+	costs := conversationCostSettings(org.Settings)
+
+	category := strings.ToLower(status.Pricing.Category)
+	charge := models.ConversationCharge{
+		OrganizationID:  message.OrganizationID,
+		Reference:       walletChargeReference(whatsappMsgID, status),
+		Period:          time.Now().UTC().Format("2006-01"),
+		WhatsAppAccount: message.WhatsAppAccount,
+		ContactID:       message.ContactID,
+		Category:        category,
+		PricingModel:    strings.ToUpper(status.Pricing.PricingModel),
+		Billable:        status.Pricing.Billable,
+	}
+	if status.Conversation != nil {
+		charge.ConversationID = status.Conversation.ID
+	}
+	if charge.Billable {
+		charge.Cost = costs.ConversationRates.rate(category)
+	}
+
+	// Every message of a conversation reports it; it is recorded once
+	result := a.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&charge)
+	if result.Error != nil {
+		a.Log.Error("Failed to record conversation charge", "error", result.Error, "reference", charge.Reference)
+		return
+	}
+	if result.RowsAffected > 0 && charge.Billable {
+		a.meterUsage(charge.OrganizationID, conversationMeterUnit(charge.PricingModel, category), 1)
+	}
+	if result.RowsAffected == 0 || charge.Cost == 0 || costs.ConversationBudget <= 0 {
+		return
+	}
+
+	a.checkConversationBudget(org.ID, costs, charge.Period)
+}
+
+// checkConversationBudget alerts the organization once per month when its estimated
+// conversation costs cross the soft limit percentage of its budget, and again when
+// they reach it
+func (a *App) checkConversationBudget(orgID uuid.UUID, costs ConversationCostSettings, period string) {
+	var spent int64
+	if err := a.DB.Model(&models.ConversationCharge{}).
+		Where("organization_id = ? AND period = ?", orgID, period).
+		Select("COALESCE(SUM(cost), 0)").Scan(&spent).Error; err != nil {
+		a.Log.Error("Failed to sum conversation costs", "error", err, "org_id", orgID)
+		return
+	}
+
+	budget := costs.ConversationBudget
+	softPercent := int64(a.softLimitPercent())
+	switch {
+	case spent >= budget:
+		if a.claimBudgetAlert(orgID, "conversation_budget_reached_period", period) {
+			a.sendBudgetAlert(orgID, models.WebhookEventBudgetReached, costs, period, spent)
+		}
+	case softPercent > 0 && spent*100 >= budget*softPercent:
+		if a.claimBudgetAlert(orgID, "conversation_budget_warning_period", period) {
+			a.sendBudgetAlert(orgID, models.WebhookEventBudgetWarning, costs, period, spent)
+		}
+	}
+}
+
+// claimBudgetAlert records in the organization's settings that an alert was sent for a
+// period, if it wasn't already, so concurrent status updates send it once
+func (a *App) claimBudgetAlert(orgID uuid.UUID, key, period string) bool {
+	result := a.DB.Model(&models.Organization{}).
+		Where("id = ? AND COALESCE(settings->>?, '') <> ?", orgID, key, period).
+		Update("settings", gorm.Expr("COALESCE(settings, '{}'::jsonb) || jsonb_build_object(?::text, ?::text)", key, period))
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// sendBudgetAlert emits the budget webhook event and emails the organization's admins
+func (a *App) sendBudgetAlert(orgID uuid.UUID, event models.WebhookEvent, costs ConversationCostSettings, period string, spent int64) {
+	a.Log.Info("Conversation budget alert", "org_id", orgID, "period", period, "spent", spent, "event", event)
+
+	a.DispatchWebhook(orgID, event, map[string]interface{}{
+		"period":   period,
+		"spent":    spent,
+		"budget":   costs.ConversationBudget,
+		"currency": costs.ConversationCurrency,
+	})
+
+	if !a.emailEnabled() {
+		return
+	}
+
+	subject := fmt.Sprintf("WhatsApp conversation costs for %s are nearing the budget", period)
+	if event == models.WebhookEventBudgetReached {
+		subject = fmt.Sprintf("WhatsApp conversation costs for %s reached the budget", period)
+	}
+	body := fmt.Sprintf("Estimated WhatsApp conversation costs for %s are %s of a monthly budget of %s.\n",
+		period, formatAmount(spent, costs.ConversationCurrency), formatAmount(costs.ConversationBudget, costs.ConversationCurrency))
+
+	if err := a.sendEmail(a.orgAdminEmails(orgID), subject, body); err != nil {
+		a.Log.Error("Failed to send budget alert email", "error", err, "org_id", orgID)
+	}
+}
+
+// GetConversationCosts returns conversations and their estimated costs per month,
+// number and pricing category
+func (a *App) GetConversationCosts(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceAnalytics, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	current := time.Now().UTC().Format("2006-01")
+	from := string(args.Peek("from"))
+	to := string(args.Peek("to"))
+	if to == "" {
+		to = current
+	}
+	if from == "" {
+		// Default to the last 6 months
+		from = time.Now().UTC().AddDate(0, -5, 0).Format("2006-01")
+	}
+	if _, err := time.Parse("2006-01", from); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'from' period format. Use YYYY-MM", nil, "")
+	}
+	if _, err := time.Parse("2006-01", to); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'to' period format. Use YYYY-MM", nil, "")
+	}
+
+	query := a.DB.Model(&models.ConversationCharge{}).
+		Where("organization_id = ? AND period >= ? AND period <= ?", orgID, from, to)
+	if account := string(args.Peek("account")); account != "" {
+		query = query.Where("whats_app_account = ?", account)
+	}
+
+	var rows []ConversationCostRow
+	if err := query.
+		Select("period, whats_app_account, category, COUNT(*) AS count, COUNT(*) FILTER (WHERE billable) AS billable, COALESCE(SUM(cost), 0) AS cost").
+		Group("period, whats_app_account, category").
+		Order("period DESC, whats_app_account, category").
+		Scan(&rows).Error; err != nil {
+		a.Log.Error("Failed to load conversation costs", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load conversation costs", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	costs := conversationCostSettings(org.Settings)
+
+	var spent int64
+	a.DB.Model(&models.ConversationCharge{}).
+		Where("organization_id = ? AND period = ?", orgID, current).
+		Select("COALESCE(SUM(cost), 0)").Scan(&spent)
+
+	return r.SendEnvelope(map[string]interface{}{
+		"rows": rows,
+		"current_month": map[string]interface{}{
+			"period":   current,
+			"cost":     spent,
+			"budget":   costs.ConversationBudget,
+			"currency": costs.ConversationCurrency,
+		},
+	})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversationCostSettings(t *testing.T) {
+	costs := conversationCostSettings(models.JSONB{})
+	assert.Equal(t, "USD", costs.ConversationCurrency)
+	assert.Zero(t, costs.ConversationBudget)
+
+	costs = conversationCostSettings(models.JSONB{
+		"conversation_rates":    map[string]interface{}{"marketing": float64(86), "utility": float64(14)},
+		"conversation_currency": "EUR",
+		"conversation_budget":   float64(50000),
+	})
+	assert.Equal(t, "EUR", costs.ConversationCurrency)
+	assert.Equal(t, int64(50000), costs.ConversationBudget)
+	assert.Equal(t, int64(86), costs.ConversationRates.rate("marketing_lite"))
+	assert.Equal(t, int64(14), costs.ConversationRates.rate("utility"))
+	assert.Equal(t, int64(0), costs.ConversationRates.rate("service"))
+}
+
+func TestRecordConversationCharge(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Pricing Org " + uuid.New().String()[:8],
+		Slug:      "pricing-org-" + uuid.New().String()[:8],
+		Settings: models.JSONB{
+			"conversation_rates": map[string]interface{}{"marketing": 86},
+		},
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+
+	message := &models.Message{
+		OrganizationID:  org.ID,
+		WhatsAppAccount: "sales",
+		ContactID:       uuid.New(),
+	}
+	status := WebhookStatus{}
+	status.Conversation = &struct {
+		ID string `json:"id"`
+	}{ID: "conv-" + uuid.New().String()}
+	status.Pricing = &struct {
+		Billable     bool   `json:"billable"`
+		PricingModel string `json:"pricing_model"`
+		Category     string `json:"category"`
+	}{Billable: true, PricingModel: "CBP", Category: "MARKETING"}
+
+	// Every message of the conversation reports it, but it is recorded once
+	app.recordConversationCharge(message, "wamid.1", status)
+	app.recordConversationCharge(message, "wamid.2", status)
+
+	var charges []models.ConversationCharge
+	require.NoError(t, app.DB.Where("organization_id = ?", org.ID).Find(&charges).Error)
+	require.Len(t, charges, 1)
+	assert.Equal(t, "marketing", charges[0].Category)
+	assert.Equal(t, "sales", charges[0].WhatsAppAccount)
+	assert.Equal(t, status.Conversation.ID, charges[0].ConversationID)
+	assert.Equal(t, int64(86), charges[0].Cost)
+	assert.True(t, charges[0].Billable)
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+const (
+	// maxExportMessages bounds the size of a conversation export
+	maxExportMessages = 5000
+	// exportThumbnailSize is the largest side of image thumbnails, in points
+	exportThumbnailSize = 160
+	// exportTextWidth is the width message text is wrapped to, in points
+	exportTextWidth = pdfPageWidth - 2*pdfMargin - 10
+)
+
+// conversationExport is the content of a conversation PDF
+type conversationExport struct {
+	OrgName      string
+	ContactName  string
+	ContactPhone string
+	From         *time.Time
+	To           *time.Time
+	GeneratedAt  time.Time
+	Location     *time.Location
+	Messages     []models.Message
+	Thumbnails   map[uuid.UUID]*pdfImage // Image message thumbnails, by message ID
+	Notes        []models.ContactNote    // Included only when requested
+	MediaBaseURL string                  // Media messages link to their media here when set
+}
+
+// ExportConversationPDF renders a contact's conversation as a PDF to share with
+// the customer or attach to a case. Contact notes are internal, so they are only
+// included with include_notes=true.
+func (a *App) ExportConversationPDF(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var org models.Organization
+	a.replicaDB().Select("name").Where("id = ?", orgID).First(&org)
+
+	loc := a.getOrgLocation(orgID)
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	export := conversationExport{
+		OrgName:      org.Name,
+		ContactName:  contact.ProfileName,
+		ContactPhone: contact.PhoneNumber,
+		GeneratedAt:  time.Now(),
+		Location:     loc,
+		Thumbnails:   make(map[uuid.UUID]*pdfImage),
+	}
+	if a.ShouldMaskPhoneNumbers(orgID) {
+		export.ContactName = MaskIfPhoneNumber(export.ContactName)
+		export.ContactPhone = MaskPhoneNumber(export.ContactPhone)
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	if string(args.Peek("include_media_links")) == "true" {
+		export.MediaBaseURL = a.publicBaseURL(r)
+	}
+
+	if export.From, export.To, errMsg = parseExportDateRange(args, loc); errMsg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, errMsg, nil, "")
+	}
+	query := a.replicaDB().Where("organization_id = ? AND contact_id = ?", orgID, contact.ID)
+	if export.From != nil {
+		query = query.Where("created_at >= ?", *export.From)
+	}
+	if export.To != nil {
+		query = query.Where("created_at < ?", export.To.AddDate(0, 0, 1))
+	}
+
+	if err := query.Preload("SentByUser").
+		Order("created_at ASC").
+		Limit(maxExportMessages + 1).
+		Find(&export.Messages).Error; err != nil {
+		a.Log.Error("Failed to load messages for export", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to export conversation", nil, "")
+	}
+	if len(export.Messages) > maxExportMessages {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+			fmt.Sprintf("The conversation has more than %d messages, narrow the date range", maxExportMessages), nil, "")
+	}
+
+	if string(args.Peek("include_media")) != "false" {
+		for _, m := range export.Messages {
+			if m.MessageType != models.MessageTypeImage || m.MediaURL == "" || strings.Contains(m.MediaURL, "..") {
+				continue
+			}
+			data, err := a.mediaStore().Get(context.Background(), m.MediaURL)
+			if err != nil {
+				continue
+			}
+			thumb, err := pdfThumbnail(data, exportThumbnailSize)
+			if err != nil {
+				a.Log.Debug("Skipping image in conversation export", "error", err, "message_id", m.ID)
+				continue
+			}
+			export.Thumbnails[m.ID] = thumb
+		}
+	}
+
+	if string(args.Peek("include_notes")) == "true" {
+		if err := a.replicaDB().Where("organization_id = ? AND contact_id = ?", orgID, contact.ID).
+			Preload("CreatedBy").
+			Order("is_pinned DESC, created_at ASC").
+			Find(&export.Notes).Error; err != nil {
+			a.Log.Error("Failed to load notes for export", "error", err, "contact_id", contact.ID)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to export conversation", nil, "")
+		}
+	}
+
+	a.Log.Info("Conversation exported", "contact_id", contact.ID, "messages", len(export.Messages), "notes", len(export.Notes))
+
+	r.RequestCtx.Response.Header.Set("Content-Type", "application/pdf")
+	r.RequestCtx.Response.Header.Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="conversation-%s-%s.pdf"`, contact.ID, export.GeneratedAt.In(loc).Format("2006-01-02")))
+	r.RequestCtx.SetBody(renderConversationPDF(export))
+	return nil
+}
+
+// renderConversationPDF renders a conversation export, with the organization's
+// name on every page
+func renderConversationPDF(e conversationExport) []byte {
+	contactName := e.ContactName
+	if contactName == "" {
+		contactName = e.ContactPhone
+	}
+
+	period := "All messages"
+	switch {
+	case e.From != nil && e.To != nil:
+		period = e.From.Format("2 Jan 2006") + " - " + e.To.Format("2 Jan 2006")
+	case e.From != nil:
+		period = "Since " + e.From.Format("2 Jan 2006")
+	case e.To != nil:
+		period = "Until " + e.To.Format("2 Jan 2006")
+	}
+
+	rows := []pdfRow{
+		{Cells: []pdfCell{{0, "Conversation with " + contactName}}, Size: 18, Bold: true},
+		{Cells: []pdfCell{{0, "Phone: " + e.ContactPhone}}, Size: 11},
+		{Cells: []pdfCell{{0, "Period: " + period}}, Size: 11},
+		{Cells: []pdfCell{{0, "Exported " + e.GeneratedAt.In(e.Location).Format("2 Jan 2006 15:04 MST")}}, Size: 11},
+	}
+
+	if len(e.Notes) > 0 {
+		rows = append(rows,
+			pdfRow{Size: 11},
+			pdfRow{Cells: []pdfCell{{0, "Contact notes"}}, Size: 13, Bold: true},
+		)
+		for _, n := range e.Notes {
+			author := "Unknown"
+			if n.CreatedBy != nil {
+				author = n.CreatedBy.FullName
+			}
+			heading := author + " - " + n.CreatedAt.In(e.Location).Format("2 Jan 2006 15:04")
+			if n.IsPinned {
+				heading += " (pinned)"
+			}
+			rows = append(rows, pdfRow{Cells: []pdfCell{{0, heading}}, Size: 9, Bold: true})
+			for _, line := range wrapPDFText(n.Content, 10, exportTextWidth) {
+				rows = append(rows, pdfRow{Cells: []pdfCell{{10, line}}, Size: 10})
+			}
+			rows = append(rows, pdfRow{Size: 4})
+		}
+	}
+
+	rows = append(rows,
+		pdfRow{Size: 11},
+		pdfRow{Cells: []pdfCell{{0, "Messages"}}, Size: 13, Bold: true},
+	)
+	if len(e.Messages) == 0 {
+		rows = append(rows, pdfRow{Cells: []pdfCell{{0, "No messages"}}, Size: 10})
+	}
+	for _, m := range e.Messages {
+		sender := contactName
+		switch role, name := transcriptSender(&m); role {
+		case TranscriptSenderAgent:
+			sender = name
+			if sender == "" {
+				sender = e.OrgName
+			}
+		case TranscriptSenderBot:
+			sender = e.OrgName + " (bot)"
+		case TranscriptSenderCampaign:
+			sender = e.OrgName + " (campaign)"
+		case TranscriptSenderSystem:
+			sender = e.OrgName
+		}
+		heading := sender + " - " + m.CreatedAt.In(e.Location).Format("2 Jan 2006 15:04")
+		switch {
+		case m.RevokedAt != nil:
+			heading += " (deleted by contact)"
+		case m.EditedAt != nil:
+			heading += " (edited)"
+		}
+		rows = append(rows, pdfRow{Cells: []pdfCell{{0, heading}}, Size: 9, Bold: true})
+
+		if thumb := e.Thumbnails[m.ID]; thumb != nil {
+			img := *thumb
+			img.X = 10
+			rows = append(rows, pdfRow{Image: &img})
+		}
+		if text := messageExportText(m, e.Thumbnails[m.ID] != nil); text != "" {
+			for _, line := range wrapPDFText(text, 10, exportTextWidth) {
+				rows = append(rows, pdfRow{Cells: []pdfCell{{10, line}}, Size: 10})
+			}
+		}
+		if e.MediaBaseURL != "" {
+			if link := messageMediaLink(e.MediaBaseURL, &m); link != "" {
+				rows = append(rows, pdfRow{Cells: []pdfCell{{10, "Media: " + link}}, Size: 8})
+			}
+		}
+		rows = append(rows, pdfRow{Size: 4})
+	}
+
+	return renderPDF(rows, e.OrgName)
+}
+
+// messageExportText returns the text of a message in an export. Media without a
+// thumbnail is described by its type and file name.
+func messageExportText(m models.Message, hasThumbnail bool) string {
+	switch m.MessageType {
+	case models.MessageTypeImage, models.MessageTypeVideo, models.MessageTypeAudio, models.MessageTypeDocument:
+		if hasThumbnail {
+			return m.Content
+		}
+		label := "[" + strings.ToUpper(string(m.MessageType[:1])) + string(m.MessageType[1:])
+		if m.MediaFilename != "" {
+			label += ": " + m.MediaFilename
+		}
+		label += "]"
+		if m.Content != "" {
+			label += " " + m.Content
+		}
+		return label
+	case models.MessageTypeTemplate:
+		if m.Content == "" {
+			return "[Template: " + m.TemplateName + "]"
+		}
+	case models.MessageTypeReaction:
+		return "[Reaction] " + m.Content
+	case models.MessageTypeLocation:
+		return "[Location] " + m.Content
+	case models.MessageTypeContacts:
+		return "[Contact] " + m.Content
+	}
+	return m.Content
+}
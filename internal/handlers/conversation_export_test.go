@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderConversationPDF(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	for x := 0; x < 800; x++ {
+		src.Set(x, 200, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, src))
+
+	thumb, err := pdfThumbnail(buf.Bytes(), exportThumbnailSize)
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(320, 160), thumb.Pixels)
+	assert.Equal(t, float64(exportThumbnailSize), thumb.Width)
+	assert.Equal(t, float64(exportThumbnailSize/2), thumb.Height)
+
+	photoID := uuid.New()
+	at := time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC)
+	export := conversationExport{
+		OrgName:      "Acme (Support)",
+		ContactName:  "Jane",
+		ContactPhone: "+15550001111",
+		GeneratedAt:  at,
+		Location:     time.UTC,
+		Messages: []models.Message{
+			{BaseModel: models.BaseModel{ID: uuid.New(), CreatedAt: at}, Direction: models.DirectionIncoming, MessageType: models.MessageTypeText, Content: "My parcel arrived damaged"},
+			{BaseModel: models.BaseModel{ID: photoID, CreatedAt: at}, Direction: models.DirectionIncoming, MessageType: models.MessageTypeImage, MediaURL: "images/a.png"},
+			{BaseModel: models.BaseModel{ID: uuid.New(), CreatedAt: at}, Direction: models.DirectionOutgoing, MessageType: models.MessageTypeText, Content: "Sorry to hear that", SentByUser: &models.User{FullName: "Sam Agent"}},
+		},
+		Thumbnails: map[uuid.UUID]*pdfImage{photoID: thumb},
+	}
+
+	pdf := string(renderConversationPDF(export))
+	assert.True(t, strings.HasPrefix(pdf, "%PDF-1.4"))
+	assert.Contains(t, pdf, "(Conversation with Jane)")
+	assert.Contains(t, pdf, "(Jane - 5 Mar 2024 09:30)")
+	assert.Contains(t, pdf, "(Sam Agent - 5 Mar 2024 09:30)")
+	assert.Contains(t, pdf, "(Acme \\(Support\\))")
+	assert.Contains(t, pdf, "(Page 1 of 1)")
+	assert.Contains(t, pdf, "/Subtype /Image /Width 320 /Height 160")
+	assert.Contains(t, pdf, "/XObject << /Im1 ")
+	assert.NotContains(t, pdf, "Contact notes")
+}
+
+func TestWrapPDFText(t *testing.T) {
+	// 100 points at size 10 fits 20 characters
+	lines := wrapPDFText("The quick brown fox jumps over the lazy dog", 10, 100)
+	assert.Equal(t, []string{"The quick brown fox", "jumps over the lazy", "dog"}, lines)
+
+	assert.Equal(t, []string{"first", "", "second"}, wrapPDFText("first\n\nsecond", 10, 100))
+	assert.Equal(t, []string{"aaaaaaaaaaaaaaaaaaaa", "aaaaa"}, wrapPDFText(strings.Repeat("a", 25), 10, 100))
+}
+
+func TestMessageExportText(t *testing.T) {
+	doc := models.Message{MessageType: models.MessageTypeDocument, MediaFilename: "invoice.pdf", Content: "Here it is"}
+	assert.Equal(t, "[Document: invoice.pdf] Here it is", messageExportText(doc, false))
+
+	photo := models.Message{MessageType: models.MessageTypeImage, Content: "Damage"}
+	assert.Equal(t, "Damage", messageExportText(photo, true))
+	assert.Equal(t, "[Image] Damage", messageExportText(photo, false))
+
+	template := models.Message{MessageType: models.MessageTypeTemplate, TemplateName: "order_update"}
+	assert.Equal(t, "[Template: order_update]", messageExportText(template, false))
+}
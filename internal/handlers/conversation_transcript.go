@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// transcriptBatchSize is the number of messages loaded at a time while streaming a transcript
+const transcriptBatchSize = 500
+
+// Who sent a message in a transcript
+const (
+	TranscriptSenderContact  = "contact"
+	TranscriptSenderAgent    = "agent"
+	TranscriptSenderBot      = "bot"      // Chatbot, AI and automation replies
+	TranscriptSenderCampaign = "campaign" // Sent by a bulk campaign
+	TranscriptSenderSystem   = "system"   // Templates sent without a user, e.g. through the API
+)
+
+// TranscriptMessage is a message in a conversation transcript export
+type TranscriptMessage struct {
+	MessageID         string     `json:"message_id"`
+	WhatsAppMessageID string     `json:"whatsapp_message_id,omitempty"`
+	ConversationID    string     `json:"conversation_id,omitempty"`
+	WhatsAppAccount   string     `json:"whatsapp_account"`
+	ContactID         string     `json:"contact_id"`
+	ContactName       string     `json:"contact_name"`
+	ContactPhone      string     `json:"contact_phone"`
+	SentAt            time.Time  `json:"sent_at"`
+	Direction         string     `json:"direction"`
+	SenderRole        string     `json:"sender_role"`
+	SenderName        string     `json:"sender_name,omitempty"`
+	SenderUserID      string     `json:"sender_user_id,omitempty"`
+	MessageType       string     `json:"message_type"`
+	Text              string     `json:"text"`
+	MediaURL          string     `json:"media_url,omitempty"` // Authenticated link to the media
+	MediaMimeType     string     `json:"media_mime_type,omitempty"`
+	MediaFilename     string     `json:"media_filename,omitempty"`
+	TemplateName      string     `json:"template_name,omitempty"`
+	Status            string     `json:"status"`
+	EditedAt          *time.Time `json:"edited_at,omitempty"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+}
+
+// transcriptCSVHeader lists the columns of CSV transcripts
+var transcriptCSVHeader = []string{
+	"message_id", "whatsapp_message_id", "conversation_id", "whatsapp_account",
+	"contact_id", "contact_name", "contact_phone", "sent_at", "direction",
+	"sender_role", "sender_name", "sender_user_id", "message_type", "text",
+	"media_url", "media_mime_type", "media_filename", "template_name", "status",
+	"edited_at", "revoked_at",
+}
+
+// transcriptSender returns who sent a message and their name. Messages sent without
+// a user are attributed to the bot, unless a campaign or template sent them.
+func transcriptSender(m *models.Message) (string, string) {
+	switch {
+	case m.Direction == models.DirectionIncoming:
+		return TranscriptSenderContact, ""
+	case m.SentByUser != nil:
+		return TranscriptSenderAgent, m.SentByUser.FullName
+	case m.SentByUserID != nil:
+		return TranscriptSenderAgent, ""
+	case m.Metadata["campaign_id"] != nil:
+		return TranscriptSenderCampaign, ""
+	case m.MessageType == models.MessageTypeTemplate:
+		return TranscriptSenderSystem, ""
+	}
+	return TranscriptSenderBot, ""
+}
+
+// plainTranscript returns messages, with their sender loaded, as lines of their
+// time, sender and text. The contact's messages are attributed to contactName, and
+// texts longer than maxText runes are cut, unless it's 0.
+func plainTranscript(messages []models.Message, contactName, timeLayout string, maxText int) string {
+	var b strings.Builder
+	for i := range messages {
+		m := &messages[i]
+		role, sender := transcriptSender(m)
+		switch {
+		case role == TranscriptSenderContact:
+			sender = contactName
+		case sender == "":
+			sender = role
+		}
+		text := messageExportText(*m, false)
+		if r := []rune(text); maxText > 0 && len(r) > maxText {
+			text = string(r[:maxText]) + "…"
+		}
+		fmt.Fprintf(&b, "[%s] %s: %s\n", m.CreatedAt.UTC().Format(timeLayout), sender, text)
+	}
+	return b.String()
+}
+
+// messageMediaLink returns the authenticated link to a message's media, or "" if it
+// has none
+func messageMediaLink(baseURL string, m *models.Message) string {
+	if m.MediaURL == "" {
+		return ""
+	}
+	return baseURL + "/api/media/" + m.ID.String()
+}
+
+// toTranscriptMessage converts a message, with its contact and sender loaded, to a
+// transcript entry
+func toTranscriptMessage(m *models.Message, mediaBaseURL string, mask bool) TranscriptMessage {
+	role, name := transcriptSender(m)
+	t := TranscriptMessage{
+		MessageID:         m.ID.String(),
+		WhatsAppMessageID: m.WhatsAppMessageID,
+		ConversationID:    m.ConversationID,
+		WhatsAppAccount:   m.WhatsAppAccount,
+		ContactID:         m.ContactID.String(),
+		SentAt:            m.CreatedAt.UTC(),
+		Direction:         string(m.Direction),
+		SenderRole:        role,
+		SenderName:        name,
+		MessageType:       string(m.MessageType),
+		Text:              messageExportText(*m, false),
+		MediaURL:          messageMediaLink(mediaBaseURL, m),
+		MediaMimeType:     m.MediaMimeType,
+		MediaFilename:     m.MediaFilename,
+		TemplateName:      m.TemplateName,
+		Status:            string(m.Status),
+		EditedAt:          m.EditedAt,
+		RevokedAt:         m.RevokedAt,
+	}
+	if m.SentByUserID != nil {
+		t.SenderUserID = m.SentByUserID.String()
+	}
+	if m.Contact != nil {
+		t.ContactName = m.Contact.ProfileName
+		t.ContactPhone = m.Contact.PhoneNumber
+		if mask {
+			t.ContactName = MaskIfPhoneNumber(t.ContactName)
+			t.ContactPhone = MaskPhoneNumber(t.ContactPhone)
+		}
+	}
+	if role == TranscriptSenderContact {
+		t.SenderName = t.ContactName
+	}
+	return t
+}
+
+// transcriptCSVRow returns a transcript entry's CSV columns, in transcriptCSVHeader order
+func transcriptCSVRow(t TranscriptMessage) []string {
+	formatTime := func(at *time.Time) string {
+		if at == nil {
+			return ""
+		}
+		return at.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		t.MessageID, t.WhatsAppMessageID, t.ConversationID, t.WhatsAppAccount,
+		t.ContactID, t.ContactName, t.ContactPhone, t.SentAt.Format(time.RFC3339), t.Direction,
+		t.SenderRole, t.SenderName, t.SenderUserID, t.MessageType, t.Text,
+		t.MediaURL, t.MediaMimeType, t.MediaFilename, t.TemplateName, t.Status,
+		formatTime(t.EditedAt), formatTime(t.RevokedAt),
+	}
+}
+
+// parseExportDateRange parses the optional from and to (YYYY-MM-DD) query parameters
+// in loc. to is inclusive.
+func parseExportDateRange(args *fasthttp.Args, loc *time.Location) (*time.Time, *time.Time, string) {
+	var from, to *time.Time
+	if v := string(args.Peek("from")); v != "" {
+		start, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			return nil, nil, "Invalid 'from' date format. Use YYYY-MM-DD"
+		}
+		from = &start
+	}
+	if v := string(args.Peek("to")); v != "" {
+		end, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			return nil, nil, "Invalid 'to' date format. Use YYYY-MM-DD"
+		}
+		to = &end
+	}
+	if from != nil && to != nil && to.Before(*from) {
+		return nil, nil, "'to' must not be before 'from'"
+	}
+	return from, to, ""
+}
+
+// ExportConversation exports a contact's conversation as CSV, JSON or PDF (format),
+// with media links and who sent each message, for compliance and disputes
+func (a *App) ExportConversation(r *fastglue.Request) error {
+	format := string(r.RequestCtx.QueryArgs().Peek("format"))
+	switch format {
+	case "pdf":
+		return a.ExportConversationPDF(r)
+	case "", "csv", "json":
+	default:
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid format. Use csv, json or pdf", nil, "")
+	}
+
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	loc := a.getOrgLocation(orgID)
+	if loc == nil {
+		loc = time.UTC
+	}
+	from, to, errMsg := parseExportDateRange(r.RequestCtx.QueryArgs(), loc)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, errMsg, nil, "")
+	}
+
+	query := a.replicaDB().Model(&models.Message{}).Where("organization_id = ? AND contact_id = ?", orgID, contact.ID)
+	if from != nil {
+		query = query.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	a.Log.Info("Conversation transcript exported", "contact_id", contact.ID, "format", format)
+	a.streamTranscript(r, query, format, fmt.Sprintf("conversation-%s-%s", contact.ID, time.Now().In(loc).Format("2006-01-02")))
+	return nil
+}
+
+// ExportConversations exports every conversation of the organization in a date
+// range as CSV or JSON, oldest message first
+func (a *App) ExportConversations(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	format := string(args.Peek("format"))
+	if format != "" && format != "csv" && format != "json" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid format. Use csv or json", nil, "")
+	}
+
+	loc := a.getOrgLocation(orgID)
+	if loc == nil {
+		loc = time.UTC
+	}
+	from, to, errMsg := parseExportDateRange(args, loc)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, errMsg, nil, "")
+	}
+	if from == nil || to == nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "'from' and 'to' are required", nil, "")
+	}
+
+	query := a.replicaDB().Model(&models.Message{}).
+		Where("organization_id = ? AND created_at >= ? AND created_at < ?", orgID, *from, to.AddDate(0, 0, 1))
+	if account := string(args.Peek("whatsapp_account")); account != "" {
+		query = query.Where("whats_app_account = ?", account)
+	}
+
+	a.Log.Info("Conversations exported", "organization_id", orgID, "user_id", userID, "format", format,
+		"from", from.Format("2006-01-02"), "to", to.Format("2006-01-02"))
+	a.streamTranscript(r, query, format, fmt.Sprintf("conversations-%s-%s", from.Format("2006-01-02"), to.Format("2006-01-02")))
+	return nil
+}
+
+// streamTranscript streams the messages a query matches, oldest first, as a CSV
+// (the default) or JSON attachment. Messages are loaded in batches, paging on
+// (created_at, id) to keep their order.
+func (a *App) streamTranscript(r *fastglue.Request, query *gorm.DB, format, fileName string) {
+	orgID, _ := getOrganizationID(r)
+	mask := a.ShouldMaskPhoneNumbers(orgID)
+	mediaBaseURL := a.publicBaseURL(r)
+	query = query.Session(&gorm.Session{})
+
+	if format == "json" {
+		r.RequestCtx.SetContentType("application/json; charset=utf-8")
+	} else {
+		format = "csv"
+		r.RequestCtx.SetContentType("text/csv; charset=utf-8")
+	}
+	r.RequestCtx.Response.Header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, fileName, format))
+
+	r.RequestCtx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		cw := csv.NewWriter(w)
+		if format == "csv" {
+			_ = cw.Write(transcriptCSVHeader)
+		} else {
+			_, _ = w.WriteString("[")
+		}
+
+		written := 0
+		var last *models.Message
+		for {
+			batchQuery := query
+			if last != nil {
+				batchQuery = batchQuery.Where("(created_at, id) > (?, ?)", last.CreatedAt, last.ID)
+			}
+			var batch []models.Message
+			if err := batchQuery.
+				Preload("SentByUser").
+				Preload("Contact", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+				Order("created_at ASC, id ASC").
+				Limit(transcriptBatchSize).
+				Find(&batch).Error; err != nil {
+				a.Log.Error("Failed to export transcript", "error", err, "organization_id", orgID)
+				break
+			}
+
+			for i := range batch {
+				entry := toTranscriptMessage(&batch[i], mediaBaseURL, mask)
+				if format == "csv" {
+					_ = cw.Write(transcriptCSVRow(entry))
+					continue
+				}
+				if written > 0 {
+					_, _ = w.WriteString(",")
+				}
+				data, _ := json.Marshal(entry)
+				_, _ = w.Write(data)
+				written++
+			}
+			cw.Flush()
+			if err := w.Flush(); err != nil {
+				return
+			}
+			if len(batch) < transcriptBatchSize {
+				break
+			}
+			last = &batch[len(batch)-1]
+		}
+
+		if format == "json" {
+			_, _ = w.WriteString("]")
+		}
+		cw.Flush()
+	})
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestTranscriptSender(t *testing.T) {
+	agentID := uuid.New()
+	tests := []struct {
+		name    string
+		message models.Message
+		role    string
+		sender  string
+	}{
+		{"contact", models.Message{Direction: models.DirectionIncoming}, TranscriptSenderContact, ""},
+		{"agent", models.Message{Direction: models.DirectionOutgoing, SentByUserID: &agentID, SentByUser: &models.User{FullName: "Sam Agent"}}, TranscriptSenderAgent, "Sam Agent"},
+		{"campaign", models.Message{Direction: models.DirectionOutgoing, MessageType: models.MessageTypeTemplate, Metadata: models.JSONB{"campaign_id": "c1"}}, TranscriptSenderCampaign, ""},
+		{"template", models.Message{Direction: models.DirectionOutgoing, MessageType: models.MessageTypeTemplate}, TranscriptSenderSystem, ""},
+		{"bot", models.Message{Direction: models.DirectionOutgoing, MessageType: models.MessageTypeText}, TranscriptSenderBot, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, sender := transcriptSender(&tt.message)
+			assert.Equal(t, tt.role, role)
+			assert.Equal(t, tt.sender, sender)
+		})
+	}
+}
+
+func TestToTranscriptMessage(t *testing.T) {
+	at := time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC)
+	photo := models.Message{
+		BaseModel:     models.BaseModel{ID: uuid.New(), CreatedAt: at},
+		ContactID:     uuid.New(),
+		Direction:     models.DirectionIncoming,
+		MessageType:   models.MessageTypeImage,
+		Content:       "Damage",
+		MediaURL:      "images/a.png",
+		MediaFilename: "a.png",
+		Status:        models.MessageStatusReceived,
+		Contact:       &models.Contact{ProfileName: "Jane", PhoneNumber: "15550001111"},
+	}
+
+	entry := toTranscriptMessage(&photo, "https://app.example.com", false)
+	assert.Equal(t, TranscriptSenderContact, entry.SenderRole)
+	assert.Equal(t, "Jane", entry.SenderName)
+	assert.Equal(t, "[Image: a.png] Damage", entry.Text)
+	assert.Equal(t, "https://app.example.com/api/media/"+photo.ID.String(), entry.MediaURL)
+
+	row := transcriptCSVRow(entry)
+	require.Len(t, row, len(transcriptCSVHeader))
+	assert.Equal(t, "2024-03-05T09:30:00Z", row[7])
+	assert.Empty(t, row[len(row)-1], "revoked_at")
+
+	masked := toTranscriptMessage(&photo, "", true)
+	assert.NotEqual(t, "15550001111", masked.ContactPhone)
+	assert.Empty(t, toTranscriptMessage(&models.Message{}, "https://app.example.com", false).MediaURL)
+}
+
+func TestParseExportDateRange(t *testing.T) {
+	args := &fasthttp.Args{}
+	args.Parse("from=2024-03-01&to=2024-03-31")
+	from, to, errMsg := parseExportDateRange(args, time.UTC)
+	require.Empty(t, errMsg)
+	assert.Equal(t, "2024-03-01", from.Format("2006-01-02"))
+	assert.Equal(t, "2024-03-31", to.Format("2006-01-02"))
+
+	args.Parse("to=2024-03-31")
+	from, _, errMsg = parseExportDateRange(args, time.UTC)
+	assert.Empty(t, errMsg)
+	assert.Nil(t, from)
+
+	args.Parse("from=2024-03-31&to=2024-03-01")
+	_, _, errMsg = parseExportDateRange(args, time.UTC)
+	assert.NotEmpty(t, errMsg)
+
+	args.Parse("from=03/01/2024")
+	_, _, errMsg = parseExportDateRange(args, time.UTC)
+	assert.NotEmpty(t, errMsg)
+}
@@ -0,0 +1,712 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/crm"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+const (
+	// crmPullInterval is how often a contact's mapped CRM fields are pulled
+	crmPullInterval = time.Hour
+	// crmRetryInterval is how long a contact that failed to push waits before it's
+	// pushed again, unless it changes
+	crmRetryInterval = time.Hour
+	// crmSummaryWindow is how long after a session ends its summary can be logged
+	crmSummaryWindow = 24 * time.Hour
+	// crmSyncBatch is how many contacts or sessions a sync step handles per run
+	crmSyncBatch = 100
+	// crmSummaryMessages is how many of a session's last messages its summary lists
+	crmSummaryMessages = 20
+	// maxCRMFieldMappings is how many field mappings an organization can have
+	maxCRMFieldMappings = 50
+)
+
+// CRM field mapping directions
+const (
+	CRMSyncPush = "push" // Whatomate to the CRM
+	CRMSyncPull = "pull" // The CRM to Whatomate
+	CRMSyncBoth = "both"
+)
+
+// crmContactFields are the contact fields, besides custom attributes, that can be
+// pushed to a CRM
+var crmContactFields = map[string]bool{
+	"name":          true,
+	"tags":          true,
+	"language":      true,
+	"timezone":      true,
+	"opt_in_status": true,
+}
+
+// crmFieldPattern matches HubSpot property and Salesforce field API names
+var crmFieldPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// CRMFieldMapping maps a contact field to a CRM field
+type CRMFieldMapping struct {
+	Field     string `json:"field"`     // name, tags, language, timezone, opt_in_status or attribute.<key>
+	CRMField  string `json:"crm_field"` // HubSpot property or Salesforce field API name
+	Direction string `json:"direction"` // push, pull or both. Only custom attributes can be pulled.
+}
+
+// pushes reports whether the mapping pushes the field to the CRM
+func (m CRMFieldMapping) pushes() bool {
+	return m.Direction == CRMSyncPush || m.Direction == CRMSyncBoth
+}
+
+// pulls reports whether the mapping pulls the CRM field into a custom attribute
+func (m CRMFieldMapping) pulls() bool {
+	return m.Direction == CRMSyncPull || m.Direction == CRMSyncBoth
+}
+
+// CRMSettings connect the CRM contacts and conversation summaries are synced with
+type CRMSettings struct {
+	Provider      string // hubspot or salesforce, empty when not connected
+	AccessToken   string // HubSpot private app token, may reference a secret
+	InstanceURL   string // Salesforce My Domain URL
+	ClientID      string // Salesforce connected app consumer key
+	ClientSecret  string // Salesforce connected app consumer secret, may reference a secret
+	SyncContacts  bool   // Push contacts and pull mapped fields
+	SyncSummaries bool   // Log a summary of each conversation on the CRM contact
+	FieldMappings []CRMFieldMapping
+}
+
+// CRMSettingsRequest updates CRM settings. Omitted fields keep their current value.
+type CRMSettingsRequest struct {
+	Provider      *string            `json:"provider"`
+	AccessToken   *string            `json:"access_token"`
+	InstanceURL   *string            `json:"instance_url"`
+	ClientID      *string            `json:"client_id"`
+	ClientSecret  *string            `json:"client_secret"`
+	SyncContacts  *bool              `json:"sync_contacts"`
+	SyncSummaries *bool              `json:"sync_summaries"`
+	FieldMappings *[]CRMFieldMapping `json:"field_mappings"`
+}
+
+// crmSettings reads the CRM settings from organization settings
+func crmSettings(settings models.JSONB) CRMSettings {
+	var s CRMSettings
+	raw, ok := settings["crm"].(map[string]interface{})
+	if !ok {
+		return s
+	}
+	s.Provider, _ = raw["provider"].(string)
+	s.AccessToken = models.SettingSecret(raw, "access_token")
+	s.InstanceURL, _ = raw["instance_url"].(string)
+	s.ClientID, _ = raw["client_id"].(string)
+	s.ClientSecret = models.SettingSecret(raw, "client_secret")
+	s.SyncContacts, _ = raw["sync_contacts"].(bool)
+	s.SyncSummaries, _ = raw["sync_summaries"].(bool)
+	mappings, _ := raw["field_mappings"].([]interface{})
+	for _, m := range mappings {
+		fields, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var mapping CRMFieldMapping
+		mapping.Field, _ = fields["field"].(string)
+		mapping.CRMField, _ = fields["crm_field"].(string)
+		mapping.Direction, _ = fields["direction"].(string)
+		s.FieldMappings = append(s.FieldMappings, mapping)
+	}
+	return s
+}
+
+// connected reports whether the settings have a CRM and its credentials
+func (s CRMSettings) connected() bool {
+	switch crm.Provider(s.Provider) {
+	case crm.ProviderHubSpot:
+		return s.AccessToken != ""
+	case crm.ProviderSalesforce:
+		return s.InstanceURL != "" && s.ClientID != "" && s.ClientSecret != ""
+	}
+	return false
+}
+
+// crmSettingsResponse is the settings as returned by the API. Secrets are never
+// returned, only whether they're set.
+func crmSettingsResponse(s CRMSettings) map[string]interface{} {
+	mappings := s.FieldMappings
+	if mappings == nil {
+		mappings = []CRMFieldMapping{}
+	}
+	return map[string]interface{}{
+		"provider":          s.Provider,
+		"access_token_set":  s.AccessToken != "",
+		"instance_url":      s.InstanceURL,
+		"client_id":         s.ClientID,
+		"client_secret_set": s.ClientSecret != "",
+		"connected":         s.connected(),
+		"sync_contacts":     s.SyncContacts,
+		"sync_summaries":    s.SyncSummaries,
+		"field_mappings":    mappings,
+	}
+}
+
+// validateCRMFieldMappings normalizes field mappings, defaulting their direction to
+// push
+func validateCRMFieldMappings(mappings []CRMFieldMapping) ([]CRMFieldMapping, error) {
+	if len(mappings) > maxCRMFieldMappings {
+		return nil, fmt.Errorf("at most %d field mappings are allowed", maxCRMFieldMappings)
+	}
+	seen := make(map[string]bool, len(mappings))
+	result := make([]CRMFieldMapping, 0, len(mappings))
+	for _, m := range mappings {
+		m.Field = strings.TrimSpace(m.Field)
+		m.CRMField = strings.TrimSpace(m.CRMField)
+		m.Direction = strings.TrimSpace(m.Direction)
+		if m.Direction == "" {
+			m.Direction = CRMSyncPush
+		}
+
+		key, isAttribute := strings.CutPrefix(m.Field, segmentAttributePrefix)
+		switch {
+		case isAttribute && strings.TrimSpace(key) == "":
+			return nil, fmt.Errorf("field %q has no attribute name", m.Field)
+		case !isAttribute && !crmContactFields[m.Field]:
+			return nil, fmt.Errorf("unknown field %q, use name, tags, language, timezone, opt_in_status or attribute.<name>", m.Field)
+		case !crmFieldPattern.MatchString(m.CRMField):
+			return nil, fmt.Errorf("invalid crm_field %q for %s", m.CRMField, m.Field)
+		}
+		switch m.Direction {
+		case CRMSyncPush:
+		case CRMSyncPull, CRMSyncBoth:
+			if !isAttribute {
+				return nil, fmt.Errorf("only custom attributes can be pulled, %s can only be pushed", m.Field)
+			}
+		default:
+			return nil, fmt.Errorf("invalid direction %q for %s, use push, pull or both", m.Direction, m.Field)
+		}
+		if seen[m.CRMField] {
+			return nil, fmt.Errorf("crm_field %q is mapped more than once", m.CRMField)
+		}
+		seen[m.CRMField] = true
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// GetCRMSettings returns the organization's CRM settings
+func (a *App) GetCRMSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	s := crmSettings(org.Settings)
+
+	resp := crmSettingsResponse(s)
+	var synced, failed int64
+	a.DB.Model(&models.CRMContact{}).Where("organization_id = ? AND provider = ? AND external_id <> ''", orgID, s.Provider).Count(&synced)
+	a.DB.Model(&models.CRMContact{}).Where("organization_id = ? AND provider = ? AND error_message <> ''", orgID, s.Provider).Count(&failed)
+	resp["synced_contacts"] = synced
+	resp["failed_contacts"] = failed
+	return r.SendEnvelope(resp)
+}
+
+// UpdateCRMSettings connects or disconnects the organization's CRM and sets what's
+// synced with it. A CRM is only saved once its contacts can be read with the
+// credentials.
+func (a *App) UpdateCRMSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req CRMSettingsRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	before := orgSettingsAuditSnapshot(&org)
+	s := crmSettings(org.Settings)
+
+	if req.Provider != nil {
+		s.Provider = strings.ToLower(strings.TrimSpace(*req.Provider))
+	}
+	if req.AccessToken != nil {
+		s.AccessToken = strings.TrimSpace(*req.AccessToken)
+	}
+	if req.InstanceURL != nil {
+		s.InstanceURL = strings.TrimSuffix(strings.TrimSpace(*req.InstanceURL), "/")
+	}
+	if req.ClientID != nil {
+		s.ClientID = strings.TrimSpace(*req.ClientID)
+	}
+	if req.ClientSecret != nil {
+		s.ClientSecret = strings.TrimSpace(*req.ClientSecret)
+	}
+	if req.SyncContacts != nil {
+		s.SyncContacts = *req.SyncContacts
+	}
+	if req.SyncSummaries != nil {
+		s.SyncSummaries = *req.SyncSummaries
+	}
+	if req.FieldMappings != nil {
+		if s.FieldMappings, err = validateCRMFieldMappings(*req.FieldMappings); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+	}
+
+	switch crm.Provider(s.Provider) {
+	case "":
+		s.SyncContacts, s.SyncSummaries = false, false
+	case crm.ProviderHubSpot:
+		if s.AccessToken == "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "access_token is required for HubSpot", nil, "")
+		}
+	case crm.ProviderSalesforce:
+		if s.InstanceURL == "" || s.ClientID == "" || s.ClientSecret == "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "instance_url, client_id and client_secret are required for Salesforce", nil, "")
+		}
+		if !strings.HasPrefix(s.InstanceURL, "https://") {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "instance_url must be an https URL", nil, "")
+		}
+	default:
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "provider must be hubspot or salesforce", nil, "")
+	}
+	if s.Provider != "" {
+		creds, err := a.resolveCRMCredentials(r.RequestCtx, orgID, s)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		if err := a.crmClient().Check(r.RequestCtx, crm.Provider(s.Provider), creds); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Can't connect to the CRM: "+err.Error(), nil, "")
+		}
+	}
+
+	mappings := make([]interface{}, 0, len(s.FieldMappings))
+	for _, m := range s.FieldMappings {
+		mappings = append(mappings, map[string]interface{}{"field": m.Field, "crm_field": m.CRMField, "direction": m.Direction})
+	}
+	if org.Settings == nil {
+		org.Settings = models.JSONB{}
+	}
+	section := map[string]interface{}{
+		"provider":       s.Provider,
+		"access_token":   s.AccessToken,
+		"instance_url":   s.InstanceURL,
+		"client_id":      s.ClientID,
+		"client_secret":  s.ClientSecret,
+		"sync_contacts":  s.SyncContacts,
+		"sync_summaries": s.SyncSummaries,
+		"field_mappings": mappings,
+	}
+	if err := models.EncryptSettingSecrets("crm", section); err != nil {
+		a.Log.Error("Failed to encrypt CRM credentials", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	org.Settings["crm"] = section
+	if err := a.DB.Save(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	a.recordOrgSettingsAudit(r, &org, before)
+
+	return r.SendEnvelope(crmSettingsResponse(s))
+}
+
+// crmClient returns the client for calls to CRMs
+func (a *App) crmClient() *crm.Client {
+	if a.CRM != nil {
+		return a.CRM
+	}
+	client := crm.New(a.Log)
+	client.HTTPClient = a.httpClient(config.OutboundCRM, crm.DefaultTimeout)
+	return client
+}
+
+// resolveCRMCredentials returns the credentials of the settings' CRM, with secret
+// references resolved
+func (a *App) resolveCRMCredentials(ctx context.Context, orgID uuid.UUID, s CRMSettings) (crm.Credentials, error) {
+	token, err := a.resolveCredential(ctx, orgID, s.AccessToken)
+	if err != nil {
+		return crm.Credentials{}, fmt.Errorf("access_token: %w", err)
+	}
+	secret, err := a.resolveCredential(ctx, orgID, s.ClientSecret)
+	if err != nil {
+		return crm.Credentials{}, fmt.Errorf("client_secret: %w", err)
+	}
+	return crm.Credentials{AccessToken: token, InstanceURL: s.InstanceURL, ClientID: s.ClientID, ClientSecret: secret}, nil
+}
+
+// crmPushFields returns the values a contact's mapped fields are pushed with, by
+// CRM field. Custom attributes the contact doesn't have are left out.
+func crmPushFields(contact *models.Contact, mappings []CRMFieldMapping) map[string]string {
+	fields := make(map[string]string, len(mappings))
+	for _, m := range mappings {
+		if !m.pushes() {
+			continue
+		}
+		if key, ok := strings.CutPrefix(m.Field, segmentAttributePrefix); ok {
+			if v, ok := contact.Metadata[key]; ok && v != nil {
+				fields[m.CRMField] = fmt.Sprintf("%v", v)
+			}
+			continue
+		}
+		switch m.Field {
+		case "name":
+			fields[m.CRMField] = contact.ProfileName
+		case "tags":
+			tags := make([]string, 0, len(contact.Tags))
+			for _, tag := range contact.Tags {
+				tags = append(tags, fmt.Sprintf("%v", tag))
+			}
+			fields[m.CRMField] = strings.Join(tags, ", ")
+		case "language":
+			fields[m.CRMField] = contact.Language
+		case "timezone":
+			fields[m.CRMField] = contact.Timezone
+		case "opt_in_status":
+			fields[m.CRMField] = string(contact.OptInStatus)
+		}
+	}
+	return fields
+}
+
+// crmFieldsHash hashes pushed fields, so contacts whose synced fields didn't change
+// aren't pushed again
+func crmFieldsHash(fields map[string]string) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\n", k, fields[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// pushCRMContact creates or updates a contact in the CRM, unless its synced fields
+// didn't change since it was last pushed, and returns its link
+func (a *App) pushCRMContact(ctx context.Context, s CRMSettings, creds crm.Credentials, contact *models.Contact) (*models.CRMContact, error) {
+	link := models.CRMContact{OrganizationID: contact.OrganizationID, ContactID: contact.ID}
+	if err := a.DB.Where("contact_id = ?", contact.ID).First(&link).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if link.Provider != s.Provider {
+		link.ExternalID, link.PushedHash, link.PulledAt = "", "", nil
+	}
+	link.Provider = s.Provider
+
+	fields := crmPushFields(contact, s.FieldMappings)
+	hash := crmFieldsHash(fields)
+	now := time.Now()
+	link.PushedAt = &now
+	if link.ExternalID == "" || link.PushedHash != hash {
+		id, err := a.crmClient().PushContact(ctx, crm.Provider(s.Provider), creds, link.ExternalID, crm.Contact{
+			Name:   contact.ProfileName,
+			Phone:  "+" + strings.TrimPrefix(contact.PhoneNumber, "+"),
+			Fields: fields,
+		})
+		if err != nil {
+			link.PushedHash, link.ErrorMessage = "", err.Error()
+			if err := a.DB.Save(&link).Error; err != nil {
+				a.Log.Error("Failed to save CRM contact", "error", err, "contact_id", contact.ID)
+			}
+			return nil, err
+		}
+		link.ExternalID, link.PushedHash, link.ErrorMessage = id, hash, ""
+	}
+	if err := a.DB.Save(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// pullCRMContact sets a contact's custom attributes from their mapped CRM fields.
+// Fields that are empty in the CRM remove the attribute.
+func (a *App) pullCRMContact(ctx context.Context, s CRMSettings, creds crm.Credentials, link *models.CRMContact) error {
+	var pulled []CRMFieldMapping
+	crmFields := make([]string, 0, len(s.FieldMappings))
+	for _, m := range s.FieldMappings {
+		if m.pulls() {
+			pulled = append(pulled, m)
+			crmFields = append(crmFields, m.CRMField)
+		}
+	}
+	now := time.Now()
+	if len(pulled) == 0 {
+		return a.DB.Model(link).Update("pulled_at", now).Error
+	}
+
+	values, err := a.crmClient().GetContact(ctx, crm.Provider(s.Provider), creds, link.ExternalID, crmFields)
+	if errors.Is(err, crm.ErrContactNotFound) {
+		// Deleted in the CRM, the next push finds or creates it again
+		return a.DB.Model(link).Updates(map[string]interface{}{"external_id": "", "pushed_hash": "", "pulled_at": now}).Error
+	}
+	if err != nil {
+		a.DB.Model(link).Updates(map[string]interface{}{"error_message": err.Error(), "pulled_at": now})
+		return err
+	}
+
+	var contact models.Contact
+	if err := a.DB.Where("id = ?", link.ContactID).First(&contact).Error; err != nil {
+		return err
+	}
+	metadata := models.JSONB{}
+	for k, v := range contact.Metadata {
+		metadata[k] = v
+	}
+	changed := false
+	for _, m := range pulled {
+		key := strings.TrimPrefix(m.Field, segmentAttributePrefix)
+		value, ok := values[m.CRMField]
+		current, exists := metadata[key]
+		switch {
+		case ok && (!exists || fmt.Sprintf("%v", current) != value):
+			metadata[key] = value
+			changed = true
+		case !ok && exists:
+			delete(metadata, key)
+			changed = true
+		}
+	}
+	if changed {
+		// Not a change to push back, so updated_at is left as is
+		if err := a.DB.Model(&contact).UpdateColumn("metadata", metadata).Error; err != nil {
+			return err
+		}
+	}
+	return a.DB.Model(link).Update("pulled_at", now).Error
+}
+
+// crmSessionSummary describes a chatbot session that ended: how it went, the
+// contact's tags, the agents' notes and its last messages
+func crmSessionSummary(session *models.ChatbotSession, contact *models.Contact, total int64, messages []models.Message, notes []models.SessionNote) crm.Note {
+	name := contact.ProfileName
+	if name == "" {
+		name = "+" + strings.TrimPrefix(contact.PhoneNumber, "+")
+	}
+	at := session.LastActivityAt
+	if session.CompletedAt != nil {
+		at = *session.CompletedAt
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Started: %s\n", session.StartedAt.UTC().Format("Jan 2, 2006 15:04 MST"))
+	fmt.Fprintf(&b, "Ended: %s (%s)\n", at.UTC().Format("Jan 2, 2006 15:04 MST"), session.Status)
+	fmt.Fprintf(&b, "Messages: %d\n", total)
+	if len(contact.Tags) > 0 {
+		tags := make([]string, 0, len(contact.Tags))
+		for _, tag := range contact.Tags {
+			tags = append(tags, fmt.Sprintf("%v", tag))
+		}
+		fmt.Fprintf(&b, "Tags: %s\n", strings.Join(tags, ", "))
+	}
+	if len(notes) > 0 {
+		b.WriteString("\nAgent notes:\n")
+		for _, n := range notes {
+			fmt.Fprintf(&b, "- %s\n", strings.TrimSpace(n.Content))
+		}
+	}
+	if len(messages) > 0 {
+		b.WriteString("\nLast messages:\n")
+		b.WriteString(plainTranscript(messages, name, "15:04", 300))
+	}
+
+	return crm.Note{
+		Subject: "WhatsApp conversation with " + name,
+		Body:    strings.TrimSpace(b.String()),
+		At:      at,
+	}
+}
+
+// logCRMSessionSummary logs the summary of a session that ended on its contact in
+// the CRM, pushing the contact first if it isn't there yet
+func (a *App) logCRMSessionSummary(ctx context.Context, s CRMSettings, creds crm.Credentials, session *models.ChatbotSession) error {
+	var contact models.Contact
+	if err := a.DB.Where("id = ?", session.ContactID).First(&contact).Error; err != nil {
+		return err
+	}
+	if !isPhoneNumber(contact.PhoneNumber) {
+		return a.DB.Model(session).UpdateColumn("crm_synced_at", time.Now()).Error
+	}
+	link, err := a.pushCRMContact(ctx, s, creds, &contact)
+	if err != nil {
+		return err
+	}
+
+	end := session.LastActivityAt
+	if session.CompletedAt != nil {
+		end = *session.CompletedAt
+	}
+	window := a.DB.Model(&models.Message{}).
+		Where("organization_id = ? AND contact_id = ? AND created_at BETWEEN ? AND ?", session.OrganizationID, contact.ID, session.StartedAt, end).
+		Session(&gorm.Session{})
+	var total int64
+	window.Count(&total)
+	var messages []models.Message
+	if err := window.Preload("SentByUser").Order("created_at DESC").Limit(crmSummaryMessages).Find(&messages).Error; err != nil {
+		return err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	var notes []models.SessionNote
+	a.DB.Where("session_id = ?", session.ID).Order("created_at ASC").Find(&notes)
+
+	note := crmSessionSummary(session, &contact, total, messages, notes)
+	if err := a.crmClient().AddNote(ctx, crm.Provider(s.Provider), creds, link.ExternalID, note); err != nil {
+		return err
+	}
+	return a.DB.Model(session).UpdateColumn("crm_synced_at", time.Now()).Error
+}
+
+// syncCRM pushes an organization's changed contacts, pulls their mapped fields and
+// logs the summaries of sessions that ended
+func (a *App) syncCRM(ctx context.Context, org *models.Organization) {
+	s := crmSettings(org.Settings)
+	if !s.connected() || (!s.SyncContacts && !s.SyncSummaries) {
+		return
+	}
+	creds, err := a.resolveCRMCredentials(ctx, org.ID, s)
+	if err != nil {
+		a.Log.Error("Failed to resolve CRM credentials", "error", err, "organization_id", org.ID)
+		return
+	}
+
+	if s.SyncContacts {
+		var contacts []models.Contact
+		// Contacts of other channels have no phone number to match in the CRM
+		if err := a.DB.Model(&models.Contact{}).Select("contacts.*").
+			Joins("LEFT JOIN crm_contacts ON crm_contacts.contact_id = contacts.id AND crm_contacts.deleted_at IS NULL").
+			Where("contacts.organization_id = ? AND contacts.phone_number ~ ?", org.ID, `^\+?[0-9]+$`).
+			Where("(crm_contacts.id IS NULL OR crm_contacts.provider <> ? OR crm_contacts.external_id = '' OR contacts.updated_at > crm_contacts.pushed_at OR (crm_contacts.error_message <> '' AND crm_contacts.pushed_at < ?))",
+				s.Provider, time.Now().Add(-crmRetryInterval)).
+			Order("contacts.updated_at ASC").
+			Limit(crmSyncBatch).
+			Find(&contacts).Error; err != nil {
+			a.Log.Error("Failed to find contacts to push to the CRM", "error", err, "organization_id", org.ID)
+			return
+		}
+		for i := range contacts {
+			if _, err := a.pushCRMContact(ctx, s, creds, &contacts[i]); err != nil {
+				a.Log.Warn("Failed to push contact to the CRM", "error", err, "contact_id", contacts[i].ID, "provider", s.Provider)
+			}
+		}
+
+		var links []models.CRMContact
+		if err := a.DB.Where("organization_id = ? AND provider = ? AND external_id <> '' AND (pulled_at IS NULL OR pulled_at < ?)",
+			org.ID, s.Provider, time.Now().Add(-crmPullInterval)).
+			Order("pulled_at ASC NULLS FIRST").
+			Limit(crmSyncBatch).
+			Find(&links).Error; err != nil {
+			a.Log.Error("Failed to find contacts to pull from the CRM", "error", err, "organization_id", org.ID)
+			return
+		}
+		for i := range links {
+			if err := a.pullCRMContact(ctx, s, creds, &links[i]); err != nil {
+				a.Log.Warn("Failed to pull contact from the CRM", "error", err, "contact_id", links[i].ContactID, "provider", s.Provider)
+			}
+		}
+	}
+
+	if s.SyncSummaries {
+		var sessions []models.ChatbotSession
+		if err := a.DB.Where("organization_id = ? AND status <> ? AND crm_synced_at IS NULL AND completed_at > ?",
+			org.ID, models.SessionStatusActive, time.Now().Add(-crmSummaryWindow)).
+			Order("completed_at DESC").
+			Limit(crmSyncBatch).
+			Find(&sessions).Error; err != nil {
+			a.Log.Error("Failed to find sessions to summarize in the CRM", "error", err, "organization_id", org.ID)
+			return
+		}
+		for i := range sessions {
+			if err := a.logCRMSessionSummary(ctx, s, creds, &sessions[i]); err != nil {
+				// Likely the CRM is unavailable, the rest are tried on the next run
+				a.Log.Warn("Failed to log conversation summary in the CRM", "error", err, "session_id", sessions[i].ID, "provider", s.Provider)
+				return
+			}
+		}
+	}
+}
+
+// CRMSyncProcessor syncs contacts and conversation summaries with the CRMs
+// organizations connected
+type CRMSyncProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewCRMSyncProcessor creates a new CRM sync processor
+func NewCRMSyncProcessor(app *App, interval time.Duration) *CRMSyncProcessor {
+	return &CRMSyncProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the CRM sync loop
+func (p *CRMSyncProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("CRM sync processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("CRM sync processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("CRM sync processor stopped")
+			return
+		case <-ticker.C:
+			p.processCRMSync(ctx)
+		}
+	}
+}
+
+// Stop stops the CRM sync processor
+func (p *CRMSyncProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// processCRMSync syncs each organization with a CRM connected
+func (p *CRMSyncProcessor) processCRMSync(ctx context.Context) {
+	var orgs []models.Organization
+	if err := p.app.DB.Select("id", "settings").
+		Where("COALESCE(settings->'crm'->>'provider', '') <> ''").
+		Find(&orgs).Error; err != nil {
+		p.app.Log.Error("Failed to find organizations with a CRM", "error", err)
+		return
+	}
+	for i := range orgs {
+		p.app.syncCRM(ctx, &orgs[i])
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/crm"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCRMFieldMappings(t *testing.T) {
+	mappings, err := validateCRMFieldMappings([]CRMFieldMapping{
+		{Field: " tags ", CRMField: "whatsapp_tags"},
+		{Field: "attribute.plan", CRMField: "Plan__c", Direction: "both"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []CRMFieldMapping{
+		{Field: "tags", CRMField: "whatsapp_tags", Direction: CRMSyncPush},
+		{Field: "attribute.plan", CRMField: "Plan__c", Direction: CRMSyncBoth},
+	}, mappings)
+
+	tests := []struct {
+		name    string
+		mapping CRMFieldMapping
+		wantErr string
+	}{
+		{name: "unknown field", mapping: CRMFieldMapping{Field: "email", CRMField: "email"}, wantErr: `unknown field "email"`},
+		{name: "no attribute name", mapping: CRMFieldMapping{Field: "attribute.", CRMField: "plan"}, wantErr: "has no attribute name"},
+		{name: "invalid crm field", mapping: CRMFieldMapping{Field: "tags", CRMField: "tags; DROP"}, wantErr: "invalid crm_field"},
+		{name: "pull contact field", mapping: CRMFieldMapping{Field: "name", CRMField: "firstname", Direction: "pull"}, wantErr: "only custom attributes can be pulled"},
+		{name: "invalid direction", mapping: CRMFieldMapping{Field: "tags", CRMField: "tags", Direction: "sideways"}, wantErr: "invalid direction"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateCRMFieldMappings([]CRMFieldMapping{tt.mapping})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	_, err = validateCRMFieldMappings([]CRMFieldMapping{
+		{Field: "tags", CRMField: "notes"},
+		{Field: "language", CRMField: "notes"},
+	})
+	assert.EqualError(t, err, `crm_field "notes" is mapped more than once`)
+}
+
+func TestCRMPushFields(t *testing.T) {
+	contact := &models.Contact{
+		ProfileName: "Ana",
+		Language:    "es",
+		Tags:        models.JSONBArray{"vip", "billing"},
+		Metadata:    models.JSONB{"plan": "gold", "seats": float64(5)},
+	}
+	fields := crmPushFields(contact, []CRMFieldMapping{
+		{Field: "tags", CRMField: "whatsapp_tags", Direction: CRMSyncPush},
+		{Field: "language", CRMField: "hs_language", Direction: CRMSyncPush},
+		{Field: "attribute.seats", CRMField: "seats", Direction: CRMSyncBoth},
+		{Field: "attribute.region", CRMField: "region", Direction: CRMSyncPush},
+		{Field: "attribute.plan", CRMField: "plan", Direction: CRMSyncPull},
+	})
+	assert.Equal(t, map[string]string{
+		"whatsapp_tags": "vip, billing",
+		"hs_language":   "es",
+		"seats":         "5",
+	}, fields)
+
+	assert.Equal(t, crmFieldsHash(map[string]string{"a": "1", "b": "2"}), crmFieldsHash(map[string]string{"b": "2", "a": "1"}))
+	assert.NotEqual(t, crmFieldsHash(map[string]string{"a": "1"}), crmFieldsHash(map[string]string{"a": "2"}))
+}
+
+func TestCRMSessionSummary(t *testing.T) {
+	started := time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC)
+	completed := started.Add(15 * time.Minute)
+	agentID := uuid.New()
+	session := &models.ChatbotSession{Status: models.SessionStatusCompleted, StartedAt: started, CompletedAt: &completed}
+	contact := &models.Contact{ProfileName: "Ana", PhoneNumber: "15551234567", Tags: models.JSONBArray{"vip"}}
+	messages := []models.Message{
+		{BaseModel: models.BaseModel{CreatedAt: started}, Direction: models.DirectionIncoming, MessageType: models.MessageTypeText, Content: "Where is my order?"},
+		{BaseModel: models.BaseModel{CreatedAt: started.Add(time.Minute)}, Direction: models.DirectionOutgoing, MessageType: models.MessageTypeText, Content: "It ships today",
+			SentByUserID: &agentID, SentByUser: &models.User{FullName: "Bob"}},
+	}
+	notes := []models.SessionNote{{Content: "Offered express shipping"}}
+
+	note := crmSessionSummary(session, contact, 2, messages, notes)
+	assert.Equal(t, "WhatsApp conversation with Ana", note.Subject)
+	assert.Equal(t, completed, note.At)
+	assert.Contains(t, note.Body, "Ended: Mar 4, 2025 10:15 UTC (completed)")
+	assert.Contains(t, note.Body, "Tags: vip")
+	assert.Contains(t, note.Body, "- Offered express shipping")
+	assert.Contains(t, note.Body, "[10:00] Ana: Where is my order?\n[10:01] Bob: It ships today")
+}
+
+func TestSyncCRM_PushPullAndSummaries(t *testing.T) {
+	var pushed map[string]string
+	var notes int
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /crm/v3/objects/contacts/search", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"results":[]}`))
+	})
+	mux.HandleFunc("POST /crm/v3/objects/contacts", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Properties map[string]string `json:"properties"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		pushed = body.Properties
+		_, _ = w.Write([]byte(`{"id":"101"}`))
+	})
+	mux.HandleFunc("GET /crm/v3/objects/contacts/101", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"101","properties":{"lifecyclestage":"customer"}}`))
+	})
+	mux.HandleFunc("POST /crm/v3/objects/notes", func(w http.ResponseWriter, r *http.Request) {
+		notes++
+		_, _ = w.Write([]byte(`{"id":"9"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+		CRM:    crm.NewWithBaseURL(testutil.NopLogger(), server.URL),
+	}
+	seq, contact, _ := sequenceTestContact(t, app, nil)
+	require.NoError(t, app.DB.Model(contact).Updates(map[string]interface{}{
+		"profile_name": "Ana Lopez",
+		"tags":         models.JSONBArray{"vip"},
+	}).Error)
+	var org models.Organization
+	require.NoError(t, app.DB.Where("id = ?", seq.OrganizationID).First(&org).Error)
+	org.Settings = models.JSONB{
+		"crm": map[string]interface{}{
+			"provider":       "hubspot",
+			"access_token":   "pat-test",
+			"sync_contacts":  true,
+			"sync_summaries": true,
+			"field_mappings": []interface{}{
+				map[string]interface{}{"field": "tags", "crm_field": "whatsapp_tags", "direction": "push"},
+				map[string]interface{}{"field": "attribute.stage", "crm_field": "lifecyclestage", "direction": "pull"},
+			},
+		},
+	}
+	require.NoError(t, app.DB.Save(&org).Error)
+	completed := time.Now().Add(-time.Minute)
+	session := &models.ChatbotSession{
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: contact.WhatsAppAccount,
+		PhoneNumber:     contact.PhoneNumber,
+		Status:          models.SessionStatusCompleted,
+		LastActivityAt:  completed,
+		CompletedAt:     &completed,
+	}
+	require.NoError(t, app.DB.Create(session).Error)
+
+	app.syncCRM(testutil.TestContext(t), &org)
+
+	assert.Equal(t, "Ana", pushed["firstname"])
+	assert.Equal(t, "Lopez", pushed["lastname"])
+	assert.Equal(t, "+"+contact.PhoneNumber, pushed["phone"])
+	assert.Equal(t, "vip", pushed["whatsapp_tags"])
+
+	var link models.CRMContact
+	require.NoError(t, app.DB.Where("contact_id = ?", contact.ID).First(&link).Error)
+	assert.Equal(t, "101", link.ExternalID)
+	assert.NotNil(t, link.PulledAt)
+
+	var updated models.Contact
+	require.NoError(t, app.DB.Where("id = ?", contact.ID).First(&updated).Error)
+	assert.Equal(t, "customer", updated.Metadata["stage"])
+
+	require.NoError(t, app.DB.Where("id = ?", session.ID).First(session).Error)
+	assert.NotNil(t, session.CRMSyncedAt)
+	assert.Equal(t, 1, notes)
+
+	// Unchanged contacts and logged sessions aren't synced again
+	pushed = nil
+	app.syncCRM(testutil.TestContext(t), &org)
+	assert.Nil(t, pushed)
+	assert.Equal(t, 1, notes)
+}
+
+func TestCRMSettings_Encrypted(t *testing.T) {
+	testutil.EnableEncryption(t)
+
+	section := map[string]interface{}{"access_token": "pat-na1-123", "client_secret": "sf-secret"}
+	require.NoError(t, models.EncryptSettingSecrets("crm", section))
+	assert.NotEqual(t, "pat-na1-123", section["access_token"])
+	assert.NotEqual(t, "sf-secret", section["client_secret"])
+	s := crmSettings(models.JSONB{"crm": section})
+	assert.Equal(t, "pat-na1-123", s.AccessToken)
+	assert.Equal(t, "sf-secret", s.ClientSecret)
+}
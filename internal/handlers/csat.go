@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+const (
+	// csatReplyPrefix starts the IDs of the rating options of a survey
+	csatReplyPrefix = "csat_"
+
+	// maxCSATQuestionLength is the longest question, the limit of a list message body
+	maxCSATQuestionLength = 1024
+
+	// csatDefaultQuestion is asked when the settings have no question
+	csatDefaultQuestion = "How would you rate your conversation with us?"
+
+	// csatRatingWindow is how long a survey can be rated after it's sent
+	csatRatingWindow = 24 * time.Hour
+
+	// csatCommentWindow is how long after rating the contact's next message is
+	// taken as their comment
+	csatCommentWindow = time.Hour
+
+	// csatSurveyInterval is the least time between two surveys to a contact
+	csatSurveyInterval = 24 * time.Hour
+
+	// csatRecentComments is how many comments the satisfaction report has
+	csatRecentComments = 20
+)
+
+// csatSurveyList is the survey message, rating options from 5 down to 1 stars
+func csatSurveyList(question string) whatsapp.ListMessage {
+	rows := make([]whatsapp.ListRow, 0, 5)
+	for rating := 5; rating >= 1; rating-- {
+		rows = append(rows, whatsapp.ListRow{
+			ID:    csatReplyPrefix + strconv.Itoa(rating),
+			Title: strings.Repeat("⭐", rating),
+		})
+	}
+	return whatsapp.ListMessage{
+		Body:       question,
+		ButtonText: "Rate",
+		Sections:   []whatsapp.ListSection{{Rows: rows}},
+	}
+}
+
+// csatRating returns the rating a message gives: a survey option, or a number
+// from 1 to 5 typed instead
+func csatRating(buttonID, text string) (int, bool) {
+	value := strings.TrimSpace(text)
+	if buttonID != "" {
+		if !strings.HasPrefix(buttonID, csatReplyPrefix) {
+			return 0, false
+		}
+		value = strings.TrimPrefix(buttonID, csatReplyPrefix)
+	}
+	rating, err := strconv.Atoi(value)
+	if err != nil || rating < 1 || rating > 5 {
+		return 0, false
+	}
+	return rating, true
+}
+
+// surveyTransfer sends the satisfaction survey for a handoff an agent ended,
+// about the agent and the session that was handed off
+func (a *App) surveyTransfer(transfer *models.AgentTransfer) {
+	if transfer.AgentID == nil {
+		return
+	}
+	survey := models.CSATResponse{
+		OrganizationID:  transfer.OrganizationID,
+		ContactID:       transfer.ContactID,
+		WhatsAppAccount: transfer.WhatsAppAccount,
+		TransferID:      &transfer.ID,
+		AgentID:         transfer.AgentID,
+	}
+	var session *models.ChatbotSession
+	var latest models.ChatbotSession
+	if err := a.DB.Where("organization_id = ? AND contact_id = ?", transfer.OrganizationID, transfer.ContactID).
+		Order("started_at DESC").First(&latest).Error; err == nil {
+		session = &latest
+		survey.SessionID = &latest.ID
+	}
+	a.sendCSATSurvey(survey, session)
+}
+
+// surveySession sends the satisfaction survey for a session the bot completed or
+// closed
+func (a *App) surveySession(session *models.ChatbotSession) {
+	a.sendCSATSurvey(models.CSATResponse{
+		OrganizationID:  session.OrganizationID,
+		ContactID:       session.ContactID,
+		WhatsAppAccount: session.WhatsAppAccount,
+		SessionID:       &session.ID,
+	}, session)
+}
+
+// sendCSATSurvey sends a satisfaction survey in the background, when the
+// account's settings survey the conversation
+func (a *App) sendCSATSurvey(survey models.CSATResponse, session *models.ChatbotSession) {
+	// Simulated conversations aren't surveyed
+	if a.simulation != nil {
+		return
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := a.deliverCSATSurvey(ctx, &survey, session, time.Now()); err != nil {
+			a.Log.Error("Failed to send satisfaction survey", "error", err, "contact_id", survey.ContactID)
+		}
+	}()
+}
+
+// deliverCSATSurvey sends a satisfaction survey and stores it. Contacts surveyed
+// recently, or whose service window closed, aren't surveyed.
+func (a *App) deliverCSATSurvey(ctx context.Context, survey *models.CSATResponse, session *models.ChatbotSession, now time.Time) error {
+	settings, err := a.getChatbotSettingsCached(survey.OrganizationID, survey.WhatsAppAccount)
+	if err != nil {
+		return err
+	}
+	if !settings.CSAT.Enabled || (survey.TransferID == nil && !settings.CSAT.BotSessions) {
+		return nil
+	}
+
+	var recent int64
+	a.DB.Model(&models.CSATResponse{}).
+		Where("organization_id = ? AND contact_id = ? AND sent_at > ?", survey.OrganizationID, survey.ContactID, now.Add(-csatSurveyInterval)).
+		Count(&recent)
+	if recent > 0 {
+		return nil
+	}
+
+	var contact models.Contact
+	if err := a.DB.Where("id = ?", survey.ContactID).First(&contact).Error; err != nil {
+		return err
+	}
+	if !isServiceWindowOpen(a.serviceWindowExpiresAt(&contact), now) {
+		return nil
+	}
+	var account models.WhatsAppAccount
+	if err := a.DB.Where("name = ? AND organization_id = ?", survey.WhatsAppAccount, survey.OrganizationID).First(&account).Error; err != nil {
+		return err
+	}
+
+	question := settings.CSAT.Question
+	if question == "" {
+		question = csatDefaultQuestion
+	}
+	question = localizedMessage(settings, conversationLanguage(settings, session, &contact), translationCSATQuestion, question)
+	list := csatSurveyList(a.expandOrgShortcodes(survey.OrganizationID, question))
+	if _, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account:         &account,
+		Contact:         &contact,
+		Type:            models.MessageTypeInteractive,
+		InteractiveType: "list",
+		BodyText:        list.Body,
+		List:            &list,
+	}, SLASendOptions()); err != nil {
+		return err
+	}
+
+	survey.Status = models.CSATStatusSent
+	survey.SentAt = now
+	if err := a.DB.Create(survey).Error; err != nil {
+		return err
+	}
+	a.Log.Info("Satisfaction survey sent", "survey_id", survey.ID, "contact_id", contact.ID, "agent_id", survey.AgentID)
+	return nil
+}
+
+// handleCSATReply records a contact's answer to their satisfaction survey: the
+// rating, then the comment when one was asked for. It reports whether the message
+// was an answer, so the chatbot doesn't answer it too.
+func (a *App) handleCSATReply(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, messageType, buttonID, text string) bool {
+	now := time.Now()
+	var survey models.CSATResponse
+
+	if rating, ok := csatRating(buttonID, text); ok && (buttonID != "" || messageType == "text") {
+		if err := a.DB.Where("organization_id = ? AND contact_id = ? AND status = ? AND sent_at > ?",
+			contact.OrganizationID, contact.ID, models.CSATStatusSent, now.Add(-csatRatingWindow)).
+			Order("sent_at DESC").First(&survey).Error; err != nil {
+			// Options of a survey that was already answered, or expired, are ignored
+			return buttonID != ""
+		}
+		a.rateCSATSurvey(ctx, account, contact, &survey, rating, now)
+		return true
+	}
+
+	if messageType != "text" || strings.TrimSpace(text) == "" {
+		return false
+	}
+	if err := a.DB.Where("organization_id = ? AND contact_id = ? AND status = ? AND rated_at > ?",
+		contact.OrganizationID, contact.ID, models.CSATStatusRated, now.Add(-csatCommentWindow)).
+		Order("rated_at DESC").First(&survey).Error; err != nil {
+		return false
+	}
+	result := a.DB.Model(&survey).Where("status = ?", models.CSATStatusRated).Updates(map[string]interface{}{
+		"status":  models.CSATStatusCompleted,
+		"comment": strings.TrimSpace(text),
+	})
+	if result.Error != nil {
+		a.Log.Error("Failed to save satisfaction comment", "error", result.Error, "survey_id", survey.ID)
+		return true
+	}
+	if result.RowsAffected > 0 {
+		a.sendCSATMessage(ctx, account, contact, translationCSATThankYou, func(s *models.ChatbotSettings) string { return s.CSAT.ThankYou })
+	}
+	return true
+}
+
+// rateCSATSurvey stores a survey's rating, then asks for a comment or thanks the
+// contact
+func (a *App) rateCSATSurvey(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, survey *models.CSATResponse, rating int, now time.Time) {
+	settings, err := a.getChatbotSettingsCached(account.OrganizationID, account.Name)
+	if err != nil {
+		a.Log.Error("Failed to load chatbot settings for satisfaction survey", "error", err, "survey_id", survey.ID)
+		return
+	}
+	status := models.CSATStatusCompleted
+	if settings.CSAT.FollowUp != "" {
+		status = models.CSATStatusRated
+	}
+
+	result := a.DB.Model(survey).Where("status = ?", models.CSATStatusSent).Updates(map[string]interface{}{
+		"status":   status,
+		"rating":   rating,
+		"rated_at": now,
+	})
+	if result.Error != nil {
+		a.Log.Error("Failed to save satisfaction rating", "error", result.Error, "survey_id", survey.ID)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	a.Log.Info("Satisfaction survey rated", "survey_id", survey.ID, "rating", rating, "agent_id", survey.AgentID)
+
+	if status == models.CSATStatusRated {
+		a.sendCSATMessage(ctx, account, contact, translationCSATFollowUp, func(s *models.ChatbotSettings) string { return s.CSAT.FollowUp })
+		return
+	}
+	a.sendCSATMessage(ctx, account, contact, translationCSATThankYou, func(s *models.ChatbotSettings) string { return s.CSAT.ThankYou })
+}
+
+// sendCSATMessage sends a survey message of the settings in the contact's language,
+// if it's set
+func (a *App) sendCSATMessage(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, key string, message func(*models.ChatbotSettings) string) {
+	settings, err := a.getChatbotSettingsCached(account.OrganizationID, account.Name)
+	if err != nil || message(settings) == "" {
+		return
+	}
+	text := localizedMessage(settings, conversationLanguage(settings, nil, contact), key, message(settings))
+	if _, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account: account,
+		Contact: contact,
+		Type:    models.MessageTypeText,
+		Content: a.expandOrgShortcodes(account.OrganizationID, text),
+	}, SLASendOptions()); err != nil {
+		a.Log.Error("Failed to send satisfaction survey message", "error", err, "contact", contact.PhoneNumber)
+	}
+}
+
+// SatisfactionReport summarizes the satisfaction surveys sent in a period
+type SatisfactionReport struct {
+	Surveys      int64                 `json:"surveys"`
+	Responses    int64                 `json:"responses"`     // Surveys rated
+	ResponseRate float64               `json:"response_rate"` // Percentage of surveys rated
+	AvgRating    float64               `json:"avg_rating"`
+	CSAT         float64               `json:"csat"`    // Percentage of ratings of 4 or 5
+	Ratings      map[int]int64         `json:"ratings"` // Responses by rating
+	Agents       []AgentSatisfaction   `json:"agents"`
+	Comments     []SatisfactionComment `json:"comments"` // Latest comments
+}
+
+// AgentSatisfaction is the satisfaction with the conversations an agent handled
+type AgentSatisfaction struct {
+	AgentID   string  `json:"agent_id"`
+	AgentName string  `json:"agent_name"`
+	Responses int64   `json:"responses"`
+	AvgRating float64 `json:"avg_rating"`
+	CSAT      float64 `json:"csat"`
+}
+
+// SatisfactionComment is a contact's comment on their conversation
+type SatisfactionComment struct {
+	SurveyID  string     `json:"survey_id"`
+	ContactID string     `json:"contact_id"`
+	AgentID   *string    `json:"agent_id,omitempty"`
+	Rating    int        `json:"rating"`
+	Comment   string     `json:"comment"`
+	RatedAt   *time.Time `json:"rated_at"`
+}
+
+// GetSatisfactionReport returns the satisfaction scores of the surveys sent in a
+// period, overall and per agent
+func (a *App) GetSatisfactionReport(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceAnalytics, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if v := string(args.Peek("from")); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'from' date format. Use YYYY-MM-DD", nil, "")
+		}
+	}
+	if v := string(args.Peek("to")); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid 'to' date format. Use YYYY-MM-DD", nil, "")
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	report, err := a.satisfactionReport(orgID, string(args.Peek("account")), from, to)
+	if err != nil {
+		a.Log.Error("Failed to load satisfaction report", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load satisfaction report", nil, "")
+	}
+
+	return r.SendEnvelope(report)
+}
+
+// satisfactionReport summarizes the surveys sent in [from, to), of one account or
+// all of them
+func (a *App) satisfactionReport(orgID uuid.UUID, account string, from, to time.Time) (*SatisfactionReport, error) {
+	scope := func() *gorm.DB {
+		query := a.DB.Model(&models.CSATResponse{}).
+			Where("csat_responses.organization_id = ? AND csat_responses.sent_at >= ? AND csat_responses.sent_at < ?", orgID, from, to)
+		if account != "" {
+			query = query.Where("csat_responses.whats_app_account = ?", account)
+		}
+		return query
+	}
+
+	report := &SatisfactionReport{
+		Ratings:  map[int]int64{1: 0, 2: 0, 3: 0, 4: 0, 5: 0},
+		Agents:   []AgentSatisfaction{},
+		Comments: []SatisfactionComment{},
+	}
+	if err := scope().Count(&report.Surveys).Error; err != nil {
+		return nil, err
+	}
+
+	var ratings []struct {
+		Rating int
+		Count  int64
+	}
+	if err := scope().Where("rating IS NOT NULL").
+		Select("rating, COUNT(*) AS count").Group("rating").Scan(&ratings).Error; err != nil {
+		return nil, err
+	}
+	var sum, satisfied int64
+	for _, row := range ratings {
+		report.Ratings[row.Rating] = row.Count
+		report.Responses += row.Count
+		sum += int64(row.Rating) * row.Count
+		if row.Rating >= 4 {
+			satisfied += row.Count
+		}
+	}
+	if report.Surveys > 0 {
+		report.ResponseRate = float64(report.Responses) * 100 / float64(report.Surveys)
+	}
+	if report.Responses > 0 {
+		report.AvgRating = float64(sum) / float64(report.Responses)
+		report.CSAT = float64(satisfied) * 100 / float64(report.Responses)
+	}
+
+	if err := scope().
+		Joins("JOIN users ON users.id = csat_responses.agent_id").
+		Where("csat_responses.rating IS NOT NULL").
+		Select(`csat_responses.agent_id::text AS agent_id, MAX(users.full_name) AS agent_name, COUNT(*) AS responses,
+			AVG(csat_responses.rating) AS avg_rating,
+			COUNT(*) FILTER (WHERE csat_responses.rating >= 4) * 100.0 / COUNT(*) AS csat`).
+		Group("csat_responses.agent_id").
+		Order("responses DESC").
+		Scan(&report.Agents).Error; err != nil {
+		return nil, err
+	}
+
+	var comments []models.CSATResponse
+	if err := scope().Where("comment <> ''").
+		Order("rated_at DESC").Limit(csatRecentComments).
+		Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range comments {
+		comment := SatisfactionComment{
+			SurveyID:  c.ID.String(),
+			ContactID: c.ContactID.String(),
+			Comment:   c.Comment,
+			RatedAt:   c.RatedAt,
+		}
+		if c.Rating != nil {
+			comment.Rating = *c.Rating
+		}
+		if c.AgentID != nil {
+			agentID := c.AgentID.String()
+			comment.AgentID = &agentID
+		}
+		report.Comments = append(report.Comments, comment)
+	}
+	return report, nil
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSATRating(t *testing.T) {
+	tests := []struct {
+		name     string
+		buttonID string
+		text     string
+		want     int
+		ok       bool
+	}{
+		{name: "option", buttonID: "csat_4", text: "⭐⭐⭐⭐", want: 4, ok: true},
+		{name: "typed", text: " 5 ", want: 5, ok: true},
+		{name: "other option", buttonID: "menu_1", text: "1"},
+		{name: "out of range", text: "6"},
+		{name: "zero", text: "0"},
+		{name: "text", text: "thanks"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := csatRating(tt.buttonID, tt.text)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCSATSurveyList(t *testing.T) {
+	list := csatSurveyList("How did we do?")
+	assert.Equal(t, "How did we do?", list.Body)
+	require.Len(t, list.Sections, 1)
+	rows := list.Sections[0].Rows
+	require.Len(t, rows, 5)
+	assert.Equal(t, "csat_5", rows[0].ID)
+	assert.Equal(t, "⭐⭐⭐⭐⭐", rows[0].Title)
+	assert.Equal(t, "csat_1", rows[4].ID)
+
+	for _, row := range rows {
+		rating, ok := csatRating(row.ID, row.Title)
+		require.True(t, ok)
+		assert.Len(t, []rune(row.Title), rating)
+	}
+}
+
+func TestSatisfactionReport(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	seq, contact, _ := sequenceTestContact(t, app, nil)
+
+	now := time.Now()
+	rating := func(n int) *int { return &n }
+	surveys := []models.CSATResponse{
+		{Status: models.CSATStatusCompleted, Rating: rating(5), Comment: "Quick and helpful", RatedAt: &now},
+		{Status: models.CSATStatusCompleted, Rating: rating(4), RatedAt: &now},
+		{Status: models.CSATStatusCompleted, Rating: rating(2), RatedAt: &now},
+		{Status: models.CSATStatusSent},
+	}
+	for i := range surveys {
+		surveys[i].OrganizationID = seq.OrganizationID
+		surveys[i].ContactID = contact.ID
+		surveys[i].WhatsAppAccount = contact.WhatsAppAccount
+		surveys[i].SentAt = now
+		require.NoError(t, app.DB.Create(&surveys[i]).Error)
+	}
+
+	report, err := app.satisfactionReport(seq.OrganizationID, "", now.Add(-time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), report.Surveys)
+	assert.Equal(t, int64(3), report.Responses)
+	assert.InDelta(t, 75, report.ResponseRate, 0.01)
+	assert.InDelta(t, 11.0/3, report.AvgRating, 0.01)
+	assert.InDelta(t, 200.0/3, report.CSAT, 0.01)
+	assert.Equal(t, map[int]int64{1: 0, 2: 1, 3: 0, 4: 1, 5: 1}, report.Ratings)
+	require.Len(t, report.Comments, 1)
+	assert.Equal(t, "Quick and helpful", report.Comments[0].Comment)
+
+	// Other accounts' surveys aren't counted
+	report, err = app.satisfactionReport(seq.OrganizationID, "other", now.Add(-time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, report.Surveys)
+}
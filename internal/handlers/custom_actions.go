@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
 	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
@@ -364,29 +365,29 @@ func (a *App) executeWebhookAction(action models.CustomAction, context map[strin
 	if err != nil {
 		return nil, err
 	}
-	var config struct {
+	var webhookConfig struct {
 		URL     string            `json:"url"`
 		Method  string            `json:"method"`
 		Headers map[string]string `json:"headers"`
 		Body    string            `json:"body"`
 	}
-	if err := json.Unmarshal(configBytes, &config); err != nil {
+	if err := json.Unmarshal(configBytes, &webhookConfig); err != nil {
 		return nil, err
 	}
 
 	// Replace variables in URL
-	url := replaceVariables(config.URL, context)
+	url := replaceVariables(webhookConfig.URL, context)
 
 	// Replace variables in headers
 	headers := make(map[string]string)
-	for k, v := range config.Headers {
+	for k, v := range webhookConfig.Headers {
 		headers[k] = replaceVariables(v, context)
 	}
 
 	// Replace variables in body or use default
 	var body string
-	if config.Body != "" {
-		body = replaceVariables(config.Body, context)
+	if webhookConfig.Body != "" {
+		body = replaceVariables(webhookConfig.Body, context)
 	} else {
 		// Default body with all context
 		bodyJSON, _ := json.Marshal(context)
@@ -394,12 +395,12 @@ func (a *App) executeWebhookAction(action models.CustomAction, context map[strin
 	}
 
 	// Make HTTP request
-	method := config.Method
+	method := webhookConfig.Method
 	if method == "" {
 		method = "POST"
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := a.httpClient(config.OutboundIntegrations, 10*time.Second)
 	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
 	if err != nil {
 		return nil, err
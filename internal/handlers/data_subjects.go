@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/storage"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// DataSubjectRequest identifies the person a data export or erasure is for
+type DataSubjectRequest struct {
+	PhoneNumber string `json:"phone_number"`
+}
+
+// dataSubject is the person a request is about: their phone number and the
+// organization's contacts with it
+type dataSubject struct {
+	OrganizationID uuid.UUID
+	Phone          string // Digits only
+	ContactIDs     []uuid.UUID
+}
+
+// args returns the named arguments of dataSubjectTable conditions
+func (s dataSubject) args() map[string]interface{} {
+	contactIDs := s.ContactIDs
+	if len(contactIDs) == 0 {
+		contactIDs = []uuid.UUID{uuid.Nil}
+	}
+	return map[string]interface{}{
+		"org":      s.OrganizationID,
+		"contacts": contactIDs,
+		"phone":    s.Phone,
+		// Phone numbers in webhook and job payloads, as JSON strings with or without +
+		"phone_pattern": `"\+?` + s.Phone + `"`,
+	}
+}
+
+// dataSubjectTable is a table holding data about a person and how to find their rows.
+// Erasure deletes the rows, or overwrites the Anonymize columns of rows that must
+// be kept, like billing records.
+type dataSubjectTable struct {
+	Name      string      // Key in the export and the erasure report
+	Model     interface{} // Pointer to the table's model
+	Where     string      // Matches the person's rows, with dataSubject.args
+	Anonymize map[string]interface{}
+}
+
+// dataSubjectTables lists where data about a person is stored. Erasure goes through
+// them in order: rows found through or referencing another table come before it,
+// and contacts last.
+var dataSubjectTables = []dataSubjectTable{
+	{Name: "chatbot_session_messages", Model: &models.ChatbotSessionMessage{},
+		Where: "session_id IN (SELECT id FROM chatbot_sessions WHERE organization_id = @org AND contact_id IN @contacts)"},
+	{Name: "session_note_mentions", Model: &models.SessionNoteMention{},
+		Where: "note_id IN (SELECT id FROM session_notes WHERE organization_id = @org AND contact_id IN @contacts)"},
+	{Name: "session_notes", Model: &models.SessionNote{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "chatbot_sessions", Model: &models.ChatbotSession{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "agent_transfers", Model: &models.AgentTransfer{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	// Kept for campaign totals. Anonymized before messages, which they reference.
+	{Name: "campaign_recipients", Model: &models.BulkMessageRecipient{},
+		Where: "phone_number = @phone AND campaign_id IN (SELECT id FROM bulk_message_campaigns WHERE organization_id = @org)",
+		Anonymize: map[string]interface{}{
+			"phone_number": "", "recipient_name": "", "template_params": gorm.Expr("'{}'::jsonb"), "message_id": nil,
+		}},
+	{Name: "messages", Model: &models.Message{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	// Their files, with the archived messages, are exported and erased too
+	{Name: "message_archives", Model: &models.MessageArchive{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "orders", Model: &models.Order{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "contact_note_revisions", Model: &models.ContactNoteRevision{},
+		Where: "note_id IN (SELECT id FROM contact_notes WHERE organization_id = @org AND contact_id IN @contacts)"},
+	{Name: "contact_notes", Model: &models.ContactNote{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "consent_events", Model: &models.ContactConsentEvent{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "appointment_reminders", Model: &models.AppointmentReminder{},
+		Where: "appointment_id IN (SELECT id FROM appointments WHERE organization_id = @org AND contact_id IN @contacts)"},
+	{Name: "appointments", Model: &models.Appointment{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "follow_ups", Model: &models.FollowUp{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "scheduled_messages", Model: &models.ScheduledMessage{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "sequence_enrollments", Model: &models.SequenceEnrollment{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "ad_referrals", Model: &models.AdReferral{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "tracking_link_attributions", Model: &models.TrackingLinkAttribution{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "automation_logs", Model: &models.AutomationLog{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "ai_moderation_logs", Model: &models.AIModerationLog{},
+		Where: "organization_id = @org AND (contact_id IN @contacts OR phone_number = @phone)"},
+	{Name: "payment_links", Model: &models.PaymentLink{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	// Kept for canned response usage stats
+	{Name: "canned_response_uses", Model: &models.CannedResponseUse{}, Where: "organization_id = @org AND contact_id IN @contacts",
+		Anonymize: map[string]interface{}{"contact_id": nil}},
+	{Name: "helpdesk_tickets", Model: &models.HelpdeskTicket{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "crm_contacts", Model: &models.CRMContact{}, Where: "organization_id = @org AND contact_id IN @contacts"},
+	{Name: "checkouts", Model: &models.Checkout{}, Where: "organization_id = @org AND (contact_id IN @contacts OR phone_number = @phone)"},
+	{Name: "group_participants", Model: &models.WhatsAppGroupParticipant{},
+		Where: "(phone_number = @phone OR contact_id IN @contacts) AND group_id IN (SELECT id FROM whatsapp_groups WHERE organization_id = @org)"},
+	{Name: "group_messages", Model: &models.GroupMessage{}, Where: "organization_id = @org AND sender_phone = @phone"},
+	{Name: "dead_letters", Model: &models.DeadLetter{}, Where: "organization_id = @org AND payload::text ~ @phone_pattern"},
+	{Name: "webhook_deliveries", Model: &models.WebhookDelivery{}, Where: "organization_id = @org AND payload::text ~ @phone_pattern"},
+
+	// Kept for the organization's billing totals
+	{Name: "conversation_charges", Model: &models.ConversationCharge{}, Where: "organization_id = @org AND contact_id IN @contacts",
+		Anonymize: map[string]interface{}{"contact_id": uuid.Nil}},
+	// Kept for satisfaction scores
+	{Name: "csat_responses", Model: &models.CSATResponse{}, Where: "organization_id = @org AND contact_id IN @contacts",
+		Anonymize: map[string]interface{}{"contact_id": uuid.Nil, "session_id": nil, "comment": ""}},
+
+	{Name: "contacts", Model: &models.Contact{}, Where: "organization_id = @org AND id IN @contacts"},
+}
+
+// findDataSubject decodes a data subject request and finds the organization's
+// contacts with the phone number, including deleted ones
+func (a *App) findDataSubject(r *fastglue.Request, orgID uuid.UUID) (*dataSubject, error) {
+	var req DataSubjectRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return nil, fmt.Errorf("invalid request body")
+	}
+	phone := searchPhoneDigits(req.PhoneNumber)
+	if len(phone) < 7 || len(phone) > 15 {
+		return nil, fmt.Errorf("phone_number must have 7 to 15 digits")
+	}
+
+	subject := &dataSubject{OrganizationID: orgID, Phone: phone}
+	if err := a.DB.Unscoped().Model(&models.Contact{}).
+		Where("organization_id = ? AND phone_number = ?", orgID, phone).
+		Pluck("id", &subject.ContactIDs).Error; err != nil {
+		return nil, err
+	}
+	return subject, nil
+}
+
+// exportDataSubject returns every row stored about a person, by table, and their
+// archived messages. Tables without rows are left out.
+func (a *App) exportDataSubject(ctx context.Context, subject *dataSubject) (map[string]interface{}, error) {
+	export := map[string]interface{}{}
+	for _, table := range dataSubjectTables {
+		rows := reflect.New(reflect.SliceOf(reflect.TypeOf(table.Model).Elem()))
+		if err := a.DB.Unscoped().Where(table.Where, subject.args()).Find(rows.Interface()).Error; err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", table.Name, err)
+		}
+		if rows.Elem().Len() > 0 {
+			export[table.Name] = rows.Interface()
+		}
+	}
+
+	if archives, ok := export["message_archives"].(*[]models.MessageArchive); ok {
+		var archived []models.Message
+		for i := range *archives {
+			messages, err := a.readArchive(ctx, &(*archives)[i])
+			if err != nil {
+				return nil, fmt.Errorf("failed to export archive %s: %w", (*archives)[i].ID, err)
+			}
+			archived = append(archived, messages...)
+		}
+		if len(archived) > 0 {
+			export["archived_messages"] = archived
+		}
+	}
+	return export, nil
+}
+
+// eraseDataSubject irreversibly deletes or anonymizes every row stored about a
+// person, in one transaction, and then deletes their media files and message
+// archives. It returns the number of rows erased by table.
+func (a *App) eraseDataSubject(ctx context.Context, subject *dataSubject) (map[string]int64, error) {
+	// Archived media is only found through the archives, which are read first so
+	// none of it is left behind once their rows are gone
+	var archives []models.MessageArchive
+	if err := a.DB.Where("organization_id = ? AND contact_id IN ?", subject.OrganizationID, subject.args()["contacts"]).
+		Find(&archives).Error; err != nil {
+		return nil, err
+	}
+	var archiveKeys []string
+	for i := range archives {
+		messages, err := a.readArchive(ctx, &archives[i])
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("failed to read archive %s: %w", archives[i].ID, err)
+		}
+		for _, m := range messages {
+			if m.MediaURL != "" {
+				archiveKeys = append(archiveKeys, m.MediaURL)
+			}
+		}
+		archiveKeys = append(archiveKeys, archives[i].StorageKey)
+	}
+
+	var mediaKeys []string
+	erased := map[string]int64{}
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Message{}).
+			Where("organization_id = ? AND contact_id IN ? AND media_url <> ''", subject.OrganizationID, subject.args()["contacts"]).
+			Pluck("media_url", &mediaKeys).Error; err != nil {
+			return err
+		}
+
+		for _, table := range dataSubjectTables {
+			var result *gorm.DB
+			if table.Anonymize != nil {
+				result = tx.Unscoped().Model(table.Model).Where(table.Where, subject.args()).Updates(table.Anonymize)
+			} else {
+				result = tx.Unscoped().Where(table.Where, subject.args()).Delete(table.Model)
+			}
+			if result.Error != nil {
+				return fmt.Errorf("failed to erase %s: %w", table.Name, result.Error)
+			}
+			if result.RowsAffected > 0 {
+				erased[table.Name] = result.RowsAffected
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Files can't be restored with the transaction, so they go once the rows are gone
+	for _, key := range mediaKeys {
+		if strings.Contains(key, "..") {
+			continue
+		}
+		if err := a.deleteMedia(context.Background(), subject.OrganizationID, key); err != nil {
+			a.Log.Warn("Failed to delete erased media", "error", err, "organization_id", subject.OrganizationID)
+		}
+	}
+	for _, key := range archiveKeys {
+		if strings.Contains(key, "..") {
+			continue
+		}
+		if err := a.archiveStore().Delete(context.Background(), key); err != nil {
+			a.Log.Warn("Failed to delete erased archive", "error", err, "organization_id", subject.OrganizationID)
+		}
+	}
+	return erased, nil
+}
+
+// ExportDataSubject returns everything stored about the person with a phone number,
+// to answer a data subject access request. The audit log records who exported how
+// many rows of each kind, with the phone number masked.
+func (a *App) ExportDataSubject(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	subject, err := a.findDataSubject(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	data, err := a.exportDataSubject(r.RequestCtx, subject)
+	if err != nil {
+		a.Log.Error("Failed to export data subject", "error", err, "organization_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to export data", nil, "")
+	}
+	if len(data) == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "No data found for this phone number", nil, "")
+	}
+
+	body, err := json.MarshalIndent(map[string]interface{}{
+		"phone_number": subject.Phone,
+		"exported_at":  time.Now().UTC(),
+		"data":         data,
+	}, "", "  ")
+	if err != nil {
+		a.Log.Error("Failed to encode data subject export", "error", err, "organization_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to export data", nil, "")
+	}
+
+	exported := make(map[string]interface{}, len(data))
+	for table, rows := range data {
+		exported[table] = reflect.Indirect(reflect.ValueOf(rows)).Len()
+	}
+	a.recordAudit(r, models.AuditLog{
+		OrganizationID: orgID,
+		Action:         models.AuditActionExport,
+		ResourceType:   models.AuditResourceDataSubject,
+		ResourceName:   MaskPhoneNumber(subject.Phone),
+	}, nil, exported)
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	a.Log.Info("Data subject exported", "organization_id", orgID, "user_id", userID, "tables", len(data))
+
+	r.RequestCtx.SetContentType("application/json; charset=utf-8")
+	r.RequestCtx.Response.Header.Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="data-export-%s.json"`, time.Now().Format("2006-01-02")))
+	r.RequestCtx.SetBody(body)
+	return nil
+}
+
+// EraseDataSubject irreversibly erases everything stored about the person with a
+// phone number, to answer a request for erasure. The audit log records who erased
+// how many rows of each kind, with the phone number masked.
+func (a *App) EraseDataSubject(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	subject, err := a.findDataSubject(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	erased, err := a.eraseDataSubject(r.RequestCtx, subject)
+	if err != nil {
+		a.Log.Error("Failed to erase data subject", "error", err, "organization_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to erase data", nil, "")
+	}
+	if len(erased) == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "No data found for this phone number", nil, "")
+	}
+
+	before := make(map[string]interface{}, len(erased))
+	after := make(map[string]interface{}, len(erased))
+	for table, count := range erased {
+		before[table] = count
+		after[table] = 0
+	}
+	a.recordAudit(r, models.AuditLog{
+		OrganizationID: orgID,
+		Action:         models.AuditActionErase,
+		ResourceType:   models.AuditResourceDataSubject,
+		ResourceName:   MaskPhoneNumber(subject.Phone),
+	}, before, after)
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	a.Log.Info("Data subject erased", "organization_id", orgID, "user_id", userID, "contacts", len(subject.ContactIDs))
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Data erased",
+		"erased":  erased,
+	})
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/storage"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestDataSubjectExportAndErasure(t *testing.T) {
+	archiveStore := storage.NewLocal(t.TempDir())
+	app := &App{
+		Config:  &config.Config{},
+		DB:      testutil.SetupTestDB(t),
+		Log:     testutil.NopLogger(),
+		Archive: archiveStore,
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Privacy Org " + suffix,
+		Slug:      "privacy-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+
+	phone := fmt.Sprintf("447700%06d", uuid.New().ID()%1000000)
+	subject := &models.Contact{BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: org.ID, PhoneNumber: phone, ProfileName: "Jane"}
+	other := &models.Contact{BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: org.ID, PhoneNumber: phone + "1"}
+	require.NoError(t, app.DB.Create(subject).Error)
+	require.NoError(t, app.DB.Create(other).Error)
+
+	for _, contact := range []*models.Contact{subject, other} {
+		require.NoError(t, app.DB.Create(&models.Message{
+			OrganizationID:  org.ID,
+			WhatsAppAccount: "support",
+			ContactID:       contact.ID,
+			Direction:       models.DirectionIncoming,
+			MessageType:     models.MessageTypeText,
+			Content:         "Hello",
+		}).Error)
+	}
+	// Notes on the contact's sessions reference the sessions, so go first
+	author := &models.User{OrganizationID: org.ID, Email: "author-" + suffix + "@example.com", FullName: "Sam Agent"}
+	require.NoError(t, app.DB.Create(author).Error)
+	session := &models.ChatbotSession{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       subject.ID,
+		WhatsAppAccount: "support",
+		PhoneNumber:     subject.PhoneNumber,
+	}
+	require.NoError(t, app.DB.Create(session).Error)
+	note := &models.SessionNote{OrganizationID: org.ID, SessionID: session.ID, ContactID: subject.ID, Content: "Asked for a refund", CreatedByID: author.ID}
+	require.NoError(t, app.DB.Create(note).Error)
+	require.NoError(t, app.DB.Create(&models.SessionNoteMention{OrganizationID: org.ID, NoteID: note.ID, UserID: author.ID}).Error)
+
+	// Archived messages and their media are only in archive storage
+	ctx := context.Background()
+	firstAt := time.Now().AddDate(-1, 0, 0)
+	archived := []models.Message{{BaseModel: models.BaseModel{ID: uuid.New(), CreatedAt: firstAt}, OrganizationID: org.ID, ContactID: subject.ID,
+		Direction: models.DirectionIncoming, MessageType: models.MessageTypeImage, MediaURL: archiveMediaKey(org.ID, "images/old.jpg")}}
+	require.NoError(t, archiveStore.Put(ctx, archived[0].MediaURL, []byte("jpeg"), "image/jpeg"))
+	data, err := encodeArchive(archived)
+	require.NoError(t, err)
+	archive := &models.MessageArchive{BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: org.ID, ContactID: subject.ID,
+		FirstMessageAt: firstAt, LastMessageAt: firstAt, MessageCount: 1, MediaCount: 1}
+	archive.StorageKey = archiveKey(org.ID, subject.ID, archive.ID, firstAt)
+	require.NoError(t, archiveStore.Put(ctx, archive.StorageKey, data, "application/gzip"))
+	require.NoError(t, app.DB.Create(archive).Error)
+
+	require.NoError(t, app.DB.Create(&models.ConversationCharge{
+		OrganizationID: org.ID,
+		Reference:      "conversation:" + suffix,
+		Period:         "2026-10",
+		ContactID:      subject.ID,
+		Billable:       true,
+	}).Error)
+
+	// Canned response usage is kept for stats, without the contact
+	canned := &models.CannedResponse{OrganizationID: org.ID, Name: "Refunds " + suffix, Content: "We'll refund you"}
+	require.NoError(t, app.DB.Create(canned).Error)
+	use := &models.CannedResponseUse{OrganizationID: org.ID, CannedResponseID: canned.ID, UserID: author.ID, ContactID: &subject.ID}
+	require.NoError(t, app.DB.Create(use).Error)
+
+	request := func() *DataSubjectRequest { return &DataSubjectRequest{PhoneNumber: "+" + subject.PhoneNumber} }
+
+	// Export
+	req := testutil.NewJSONRequest(t, request())
+	req.RequestCtx.SetUserValue("organization_id", org.ID)
+	require.NoError(t, app.ExportDataSubject(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	var export struct {
+		PhoneNumber string                   `json:"phone_number"`
+		Data        map[string][]interface{} `json:"data"`
+	}
+	testutil.ParseJSONResponse(t, req, &export)
+	assert.Equal(t, subject.PhoneNumber, export.PhoneNumber)
+	assert.Len(t, export.Data["contacts"], 1)
+	assert.Len(t, export.Data["messages"], 1)
+	assert.Len(t, export.Data["conversation_charges"], 1)
+	assert.Len(t, export.Data["session_notes"], 1)
+	assert.Len(t, export.Data["session_note_mentions"], 1)
+	assert.Len(t, export.Data["message_archives"], 1)
+	assert.Len(t, export.Data["archived_messages"], 1)
+	assert.Len(t, export.Data["canned_response_uses"], 1)
+
+	var audit models.AuditLog
+	require.NoError(t, app.DB.Where("organization_id = ? AND action = ?", org.ID, models.AuditActionExport).First(&audit).Error)
+	assert.Equal(t, models.AuditResourceDataSubject, audit.ResourceType)
+	assert.Equal(t, MaskPhoneNumber(subject.PhoneNumber), audit.ResourceName)
+	assert.Contains(t, audit.Changes, "messages")
+
+	// Erasure
+	req = testutil.NewJSONRequest(t, request())
+	req.RequestCtx.SetUserValue("organization_id", org.ID)
+	require.NoError(t, app.EraseDataSubject(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var count int64
+	app.DB.Unscoped().Model(&models.Contact{}).Where("id = ?", subject.ID).Count(&count)
+	assert.Zero(t, count, "the contact is deleted, not soft deleted")
+	app.DB.Unscoped().Model(&models.Message{}).Where("contact_id = ?", subject.ID).Count(&count)
+	assert.Zero(t, count)
+	app.DB.Unscoped().Model(&models.SessionNote{}).Where("contact_id = ?", subject.ID).Count(&count)
+	assert.Zero(t, count)
+	app.DB.Unscoped().Model(&models.ChatbotSession{}).Where("id = ?", session.ID).Count(&count)
+	assert.Zero(t, count)
+	app.DB.Model(&models.MessageArchive{}).Where("contact_id = ?", subject.ID).Count(&count)
+	assert.Zero(t, count)
+	_, err = archiveStore.Get(ctx, archive.StorageKey)
+	assert.ErrorIs(t, err, storage.ErrNotFound, "the archive file is deleted")
+	_, err = archiveStore.Get(ctx, archived[0].MediaURL)
+	assert.ErrorIs(t, err, storage.ErrNotFound, "archived media is deleted")
+	app.DB.Model(&models.ConversationCharge{}).Where("organization_id = ? AND contact_id = ?", org.ID, uuid.Nil).Count(&count)
+	assert.Equal(t, int64(1), count, "charges are kept without the contact")
+	require.NoError(t, app.DB.First(use, "id = ?", use.ID).Error)
+	assert.Nil(t, use.ContactID, "canned response uses are kept without the contact")
+	app.DB.Model(&models.Message{}).Where("contact_id = ?", other.ID).Count(&count)
+	assert.Equal(t, int64(1), count, "other contacts are untouched")
+
+	audit = models.AuditLog{}
+	require.NoError(t, app.DB.Where("organization_id = ? AND action = ?", org.ID, models.AuditActionErase).First(&audit).Error)
+	assert.Equal(t, MaskPhoneNumber(subject.PhoneNumber), audit.ResourceName)
+	assert.Contains(t, audit.Changes, "messages")
+
+	// Nothing is left to erase
+	req = testutil.NewJSONRequest(t, request())
+	req.RequestCtx.SetUserValue("organization_id", org.ID)
+	require.NoError(t, app.EraseDataSubject(req))
+	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
+}
+
+func TestFindDataSubject_InvalidPhone(t *testing.T) {
+	app := &App{Config: &config.Config{}, Log: testutil.NopLogger()}
+	req := testutil.NewJSONRequest(t, DataSubjectRequest{PhoneNumber: "12-34"})
+	req.RequestCtx.SetUserValue("organization_id", uuid.New())
+
+	require.NoError(t, app.EraseDataSubject(req))
+	assert.Equal(t, fasthttp.StatusBadRequest, testutil.GetResponseStatusCode(req))
+}
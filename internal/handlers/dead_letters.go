@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// maxDeadLetterBatch is the most dead letters retried by one bulk retry
+const maxDeadLetterBatch = 500
+
+// RetryDeadLettersRequest selects the dead letters to retry, by ID or all pending
+// ones of a kind
+type RetryDeadLettersRequest struct {
+	IDs  []uuid.UUID           `json:"ids"`
+	Kind models.DeadLetterKind `json:"kind"`
+	All  bool                  `json:"all"`
+}
+
+// DeadLetterRetryFailure is a dead letter a bulk retry couldn't retry
+type DeadLetterRetryFailure struct {
+	ID    uuid.UUID `json:"id"`
+	Error string    `json:"error"`
+}
+
+// recordDeadLetter keeps a send or job that failed for good, so admins can retry it
+func (a *App) recordDeadLetter(letter models.DeadLetter, cause error) {
+	letter.Error = cause.Error()
+	letter.Status = models.DeadLetterStatusPending
+	if letter.Attempts == 0 {
+		letter.Attempts = 1
+	}
+	if err := a.DB.Create(&letter).Error; err != nil {
+		a.Log.Error("Failed to record dead letter", "error", err, "kind", letter.Kind)
+	}
+}
+
+// DeadLetterWebhook keeps a webhook payload the webhook workers gave up on. It is
+// filed under the organization of the number or business account it's for.
+func (a *App) DeadLetterWebhook(body []byte, cause error) {
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		a.Log.Error("Dropping unparseable webhook payload", "error", err)
+		return
+	}
+
+	var account models.WhatsAppAccount
+	found := false
+	for _, entry := range payload.Entry {
+		for _, change := range entry.Changes {
+			if phoneID := change.Value.Metadata.PhoneNumberID; phoneID != "" &&
+				a.DB.Where("phone_id = ?", phoneID).First(&account).Error == nil {
+				found = true
+				break
+			}
+		}
+		if !found && entry.ID != "" && a.DB.Where("business_id = ?", entry.ID).First(&account).Error == nil {
+			found = true
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		a.Log.Error("Dropping webhook payload for an unknown number", "error", cause)
+		return
+	}
+
+	var stored models.JSONB
+	_ = json.Unmarshal(body, &stored)
+	a.recordDeadLetter(models.DeadLetter{
+		OrganizationID: account.OrganizationID,
+		Kind:           models.DeadLetterKindWebhook,
+		Payload:        stored,
+		Attempts:       queue.WebhookMaxDeliveries,
+	}, cause)
+}
+
+// ListDeadLetters lists the organization's failed sends and jobs, newest first
+func (a *App) ListDeadLetters(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	page, _ := strconv.Atoi(string(args.Peek("page")))
+	limit, _ := strconv.Atoi(string(args.Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := a.DB.Model(&models.DeadLetter{}).Where("organization_id = ?", orgID)
+	for _, filter := range []string{"kind", "status"} {
+		if value := string(args.Peek(filter)); value != "" {
+			query = query.Where(filter+" = ?", value)
+		}
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var letters []models.DeadLetter
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&letters).Error; err != nil {
+		a.Log.Error("Failed to list dead letters", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list dead letters", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"dead_letters": letters,
+		"total":        total,
+		"page":         page,
+		"limit":        limit,
+	})
+}
+
+// RetryDeadLetter runs a dead letter again
+func (a *App) RetryDeadLetter(r *fastglue.Request) error {
+	letter, errResp := a.loadOrgDeadLetter(r)
+	if errResp != nil {
+		return errResp()
+	}
+	if letter.Status != models.DeadLetterStatusPending {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Dead letter was already "+string(letter.Status), nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if err := a.retryDeadLetter(r.RequestCtx, letter, userID); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	return r.SendEnvelope(letter)
+}
+
+// RetryDeadLetters runs several pending dead letters again. Ones that can't be retried
+// are reported and left pending.
+func (a *App) RetryDeadLetters(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	var req RetryDeadLettersRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if len(req.IDs) == 0 && !req.All {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Select dead letters to retry, or set all", nil, "")
+	}
+	if len(req.IDs) > maxDeadLetterBatch {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("At most %d dead letters can be retried at once", maxDeadLetterBatch), nil, "")
+	}
+
+	query := a.DB.Where("organization_id = ? AND status = ?", orgID, models.DeadLetterStatusPending)
+	if len(req.IDs) > 0 {
+		query = query.Where("id IN ?", req.IDs)
+	}
+	if req.Kind != "" {
+		query = query.Where("kind = ?", req.Kind)
+	}
+
+	var letters []models.DeadLetter
+	if err := query.Order("created_at ASC").Limit(maxDeadLetterBatch).Find(&letters).Error; err != nil {
+		a.Log.Error("Failed to load dead letters", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load dead letters", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	retried, failed := a.retryDeadLetterBatch(r.RequestCtx, letters, userID)
+
+	return r.SendEnvelope(map[string]interface{}{
+		"retried": retried,
+		"failed":  failed,
+	})
+}
+
+// RetryPendingDeadLetters runs pending dead letters again outside a request, oldest
+// first, for the admin CLI. orgID and kind narrow them down when set. Webhook dead
+// letters are left pending when the app has no webhook queue, as only servers can
+// process them inline.
+func (a *App) RetryPendingDeadLetters(ctx context.Context, orgID uuid.UUID, kind models.DeadLetterKind, limit int) (int, []DeadLetterRetryFailure, error) {
+	query := a.DB.Where("status = ?", models.DeadLetterStatusPending)
+	if orgID != uuid.Nil {
+		query = query.Where("organization_id = ?", orgID)
+	}
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if a.Webhooks == nil {
+		query = query.Where("kind <> ?", models.DeadLetterKindWebhook)
+	}
+	if limit <= 0 {
+		limit = maxDeadLetterBatch
+	}
+
+	var letters []models.DeadLetter
+	if err := query.Order("created_at ASC").Limit(limit).Find(&letters).Error; err != nil {
+		return 0, nil, fmt.Errorf("failed to load dead letters: %w", err)
+	}
+	retried, failed := a.retryDeadLetterBatch(ctx, letters, uuid.Nil)
+	return retried, failed, nil
+}
+
+// retryDeadLetterBatch runs dead letters again, returning how many were retried and
+// the ones that couldn't be
+func (a *App) retryDeadLetterBatch(ctx context.Context, letters []models.DeadLetter, userID uuid.UUID) (int, []DeadLetterRetryFailure) {
+	retried := 0
+	failed := []DeadLetterRetryFailure{}
+	for i := range letters {
+		if err := a.retryDeadLetter(ctx, &letters[i], userID); err != nil {
+			failed = append(failed, DeadLetterRetryFailure{ID: letters[i].ID, Error: err.Error()})
+			continue
+		}
+		retried++
+	}
+	return retried, failed
+}
+
+// DiscardDeadLetter marks a dead letter as not needing a retry
+func (a *App) DiscardDeadLetter(r *fastglue.Request) error {
+	letter, errResp := a.loadOrgDeadLetter(r)
+	if errResp != nil {
+		return errResp()
+	}
+	if letter.Status != models.DeadLetterStatusPending {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Dead letter was already "+string(letter.Status), nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if err := a.DB.Model(letter).Updates(map[string]interface{}{
+		"status":         models.DeadLetterStatusDiscarded,
+		"resolved_by_id": userID,
+	}).Error; err != nil {
+		a.Log.Error("Failed to discard dead letter", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to discard dead letter", nil, "")
+	}
+	letter.Status = models.DeadLetterStatusDiscarded
+	letter.ResolvedByID = &userID
+	return r.SendEnvelope(letter)
+}
+
+// loadOrgDeadLetter loads the dead letter in the path
+func (a *App) loadOrgDeadLetter(r *fastglue.Request) (*models.DeadLetter, func() error) {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return nil, func() error { return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "") }
+	}
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, func() error { return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid dead letter ID", nil, "") }
+	}
+
+	var letter models.DeadLetter
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&letter).Error; err != nil {
+		return nil, func() error { return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Dead letter not found", nil, "") }
+	}
+	return &letter, nil
+}
+
+// retryDeadLetter runs a dead letter again and marks it retried. If it fails again, a
+// new dead letter is recorded. userID is uuid.Nil for retries from the CLI.
+func (a *App) retryDeadLetter(ctx context.Context, letter *models.DeadLetter, userID uuid.UUID) error {
+	var err error
+	switch letter.Kind {
+	case models.DeadLetterKindCampaignMessage:
+		err = a.retryCampaignDeadLetter(ctx, letter)
+	case models.DeadLetterKindScheduledMessage:
+		err = a.retryScheduledDeadLetter(letter)
+	case models.DeadLetterKindWebhook:
+		err = a.retryWebhookDeadLetter(ctx, letter)
+	default:
+		err = fmt.Errorf("unknown dead letter kind %q", letter.Kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	var resolvedBy *uuid.UUID
+	if userID != uuid.Nil {
+		resolvedBy = &userID
+	}
+	now := time.Now()
+	result := a.DB.Model(letter).Where("status = ?", models.DeadLetterStatusPending).Updates(map[string]interface{}{
+		"status":         models.DeadLetterStatusRetried,
+		"retry_count":    letter.RetryCount + 1,
+		"retried_at":     now,
+		"resolved_by_id": resolvedBy,
+	})
+	if result.Error != nil {
+		a.log(ctx).Error("Failed to mark dead letter retried", "error", result.Error, "dead_letter_id", letter.ID)
+	}
+	letter.Status = models.DeadLetterStatusRetried
+	letter.RetryCount++
+	letter.RetriedAt = &now
+	letter.ResolvedByID = resolvedBy
+	return nil
+}
+
+// retryCampaignDeadLetter queues a campaign recipient again, the way retrying a
+// campaign's failed messages does
+func (a *App) retryCampaignDeadLetter(ctx context.Context, letter *models.DeadLetter) error {
+	if letter.ReferenceID == nil {
+		return errors.New("recipient not set")
+	}
+
+	var recipient models.BulkMessageRecipient
+	if err := a.DB.Where("id = ?", *letter.ReferenceID).First(&recipient).Error; err != nil {
+		return errors.New("recipient not found")
+	}
+	var campaign models.BulkMessageCampaign
+	if err := a.DB.Where("id = ? AND organization_id = ?", recipient.CampaignID, letter.OrganizationID).First(&campaign).Error; err != nil {
+		return errors.New("campaign not found")
+	}
+	if campaign.Status == models.CampaignStatusCancelled {
+		return errors.New("campaign was cancelled")
+	}
+	if recipient.Status != models.MessageStatusFailed {
+		return errors.New("recipient was already retried")
+	}
+
+	if err := a.checkCampaignMessageQuota(letter.OrganizationID, 1); err != nil {
+		return err
+	}
+	if err := a.checkWalletBalance(letter.OrganizationID); err != nil {
+		return err
+	}
+
+	if err := a.DB.Model(&recipient).Updates(map[string]interface{}{
+		"status":        models.MessageStatusPending,
+		"error_message": "",
+		"error_code":    0,
+	}).Error; err != nil {
+		a.log(ctx).Error("Failed to reset recipient", "error", err, "recipient_id", recipient.ID)
+		return errors.New("failed to reset recipient")
+	}
+
+	// Reset the recipient's failed message, matching the contact the worker sent to
+	phone := strings.TrimPrefix(recipient.PhoneNumber, "+")
+	contactIDs := a.DB.Model(&models.Contact{}).Select("id").
+		Where("organization_id = ? AND phone_number IN ?", letter.OrganizationID, []string{phone, "+" + phone})
+	if err := a.DB.Model(&models.Message{}).
+		Where("metadata->>'campaign_id' = ? AND status = ? AND contact_id IN (?)", campaign.ID.String(), models.MessageStatusFailed, contactIDs).
+		Updates(map[string]interface{}{
+			"status":        models.MessageStatusPending,
+			"error_message": "",
+			"error_code":    0,
+		}).Error; err != nil {
+		a.log(ctx).Error("Failed to reset failed message", "error", err, "recipient_id", recipient.ID)
+	}
+
+	a.recalculateCampaignStats(campaign.ID)
+	if campaign.Status != models.CampaignStatusProcessing {
+		if err := a.DB.Model(&campaign).Update("status", models.CampaignStatusProcessing).Error; err != nil {
+			a.log(ctx).Error("Failed to update campaign status", "error", err, "campaign_id", campaign.ID)
+		}
+	}
+
+	job := &queue.RecipientJob{
+		CampaignID:     campaign.ID,
+		RecipientID:    recipient.ID,
+		OrganizationID: letter.OrganizationID,
+		PhoneNumber:    recipient.PhoneNumber,
+		RecipientName:  recipient.RecipientName,
+		TemplateParams: recipient.TemplateParams,
+		VariantID:      recipient.VariantID,
+	}
+	if err := a.Queue.EnqueueRecipient(ctx, job); err != nil {
+		a.log(ctx).Error("Failed to enqueue recipient", "error", err, "recipient_id", recipient.ID)
+		return errors.New("failed to queue recipient")
+	}
+	return nil
+}
+
+// retryScheduledDeadLetter schedules a failed scheduled message to be sent now
+func (a *App) retryScheduledDeadLetter(letter *models.DeadLetter) error {
+	if letter.ReferenceID == nil {
+		return errors.New("scheduled message not set")
+	}
+
+	result := a.DB.Model(&models.ScheduledMessage{}).
+		Where("id = ? AND organization_id = ? AND status = ?", *letter.ReferenceID, letter.OrganizationID, models.ScheduledMessageStatusFailed).
+		Updates(map[string]interface{}{
+			"status":        models.ScheduledMessageStatusScheduled,
+			"send_at":       time.Now(),
+			"error_message": "",
+			"sent_at":       nil,
+			"message_id":    nil,
+		})
+	if result.Error != nil {
+		a.Log.Error("Failed to reschedule message", "error", result.Error, "scheduled_message_id", *letter.ReferenceID)
+		return errors.New("failed to reschedule message")
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("scheduled message was removed or already retried")
+	}
+	return nil
+}
+
+// retryWebhookDeadLetter processes a webhook payload again
+func (a *App) retryWebhookDeadLetter(ctx context.Context, letter *models.DeadLetter) error {
+	body, err := json.Marshal(letter.Payload)
+	if err != nil {
+		return errors.New("invalid webhook payload")
+	}
+	if a.Webhooks != nil {
+		if err := a.Webhooks.Enqueue(ctx, body); err != nil {
+			a.log(ctx).Error("Failed to enqueue webhook", "error", err, "dead_letter_id", letter.ID)
+			return errors.New("failed to queue webhook")
+		}
+		return nil
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return errors.New("invalid webhook payload")
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		if err := a.processWebhookPayload(ctx, payload); err != nil {
+			a.DeadLetterWebhook(body, err)
+		}
+	}()
+	return nil
+}
+
+// resolveCampaignDeadLetters marks the dead letters of recipients that were queued
+// again some other way as retried
+func (a *App) resolveCampaignDeadLetters(orgID uuid.UUID, recipientIDs []uuid.UUID, userID uuid.UUID) {
+	if len(recipientIDs) == 0 {
+		return
+	}
+	if err := a.DB.Model(&models.DeadLetter{}).
+		Where("organization_id = ? AND kind = ? AND status = ? AND reference_id IN ?",
+			orgID, models.DeadLetterKindCampaignMessage, models.DeadLetterStatusPending, recipientIDs).
+		Updates(map[string]interface{}{
+			"status":         models.DeadLetterStatusRetried,
+			"retry_count":    gorm.Expr("retry_count + 1"),
+			"retried_at":     time.Now(),
+			"resolved_by_id": userID,
+		}).Error; err != nil {
+		a.Log.Error("Failed to resolve dead letters", "error", err)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_DeadLetter_RetryScheduledMessage(t *testing.T) {
+	app := testApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("dlq"), "password123", nil, true)
+	contact := createTestContact(t, app, org.ID)
+
+	scheduled := &models.ScheduledMessage{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		ContactID:      contact.ID,
+		Content:        "Later",
+		SendAt:         time.Now().Add(-time.Hour),
+		Status:         models.ScheduledMessageStatusFailed,
+		ErrorMessage:   "API error 131016: Service overloaded",
+		CreatedByID:    user.ID,
+	}
+	require.NoError(t, app.DB.Create(scheduled).Error)
+	letter := &models.DeadLetter{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		Kind:           models.DeadLetterKindScheduledMessage,
+		ReferenceID:    &scheduled.ID,
+		Error:          scheduled.ErrorMessage,
+		Status:         models.DeadLetterStatusPending,
+	}
+	require.NoError(t, app.DB.Create(letter).Error)
+
+	req := testutil.NewGETRequest(t)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetQueryParam(req, "status", string(models.DeadLetterStatusPending))
+	require.NoError(t, app.ListDeadLetters(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	var list struct {
+		Data struct {
+			DeadLetters []models.DeadLetter `json:"dead_letters"`
+			Total       int64               `json:"total"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &list))
+	require.Len(t, list.Data.DeadLetters, 1)
+	assert.Equal(t, letter.ID, list.Data.DeadLetters[0].ID)
+
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", letter.ID.String())
+	require.NoError(t, app.RetryDeadLetter(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var rescheduled models.ScheduledMessage
+	require.NoError(t, app.DB.Where("id = ?", scheduled.ID).First(&rescheduled).Error)
+	assert.Equal(t, models.ScheduledMessageStatusScheduled, rescheduled.Status)
+	assert.Empty(t, rescheduled.ErrorMessage)
+
+	var retried models.DeadLetter
+	require.NoError(t, app.DB.Where("id = ?", letter.ID).First(&retried).Error)
+	assert.Equal(t, models.DeadLetterStatusRetried, retried.Status)
+	assert.Equal(t, 1, retried.RetryCount)
+	assert.Equal(t, user.ID, *retried.ResolvedByID)
+
+	// A retried dead letter can't be retried or discarded again
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", letter.ID.String())
+	require.NoError(t, app.DiscardDeadLetter(req))
+	assert.Equal(t, fasthttp.StatusBadRequest, testutil.GetResponseStatusCode(req))
+}
+
+func TestApp_DeadLetter_BulkRetryReportsFailures(t *testing.T) {
+	app := testApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("dlq"), "password123", nil, true)
+
+	// The scheduled message it refers to is gone, so it can't be retried
+	missing := uuid.New()
+	letter := &models.DeadLetter{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		Kind:           models.DeadLetterKindScheduledMessage,
+		ReferenceID:    &missing,
+		Error:          "contact not found",
+		Status:         models.DeadLetterStatusPending,
+	}
+	require.NoError(t, app.DB.Create(letter).Error)
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{"all": true})
+	setAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.RetryDeadLetters(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var result struct {
+		Data struct {
+			Retried int `json:"retried"`
+			Failed  []struct {
+				ID uuid.UUID `json:"id"`
+			} `json:"failed"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &result))
+	assert.Equal(t, 0, result.Data.Retried)
+	require.Len(t, result.Data.Failed, 1)
+	assert.Equal(t, letter.ID, result.Data.Failed[0].ID)
+
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", letter.ID.String())
+	require.NoError(t, app.DiscardDeadLetter(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var discarded models.DeadLetter
+	require.NoError(t, app.DB.Where("id = ?", letter.ID).First(&discarded).Error)
+	assert.Equal(t, models.DeadLetterStatusDiscarded, discarded.Status)
+}
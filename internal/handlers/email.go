@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// emailEnabled reports whether an SMTP server is configured
+func (a *App) emailEnabled() bool {
+	cfg := a.CurrentConfig()
+	return cfg != nil && cfg.SMTP.Host != ""
+}
+
+// sendEmail sends a plain text email through the configured SMTP server
+func (a *App) sendEmail(to []string, subject, body string) error {
+	if !a.emailEnabled() {
+		return fmt.Errorf("email is not configured")
+	}
+	if len(to) == 0 {
+		return nil
+	}
+
+	cfg := a.CurrentConfig().SMTP
+	from := cfg.From
+	if from == "" {
+		from = cfg.Username
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(body)
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	return smtp.SendMail(addr, auth, emailAddress(from), to, []byte(msg.String()))
+}
+
+// emailAddress returns the address part of "Name <address>"
+func emailAddress(s string) string {
+	if start := strings.LastIndex(s, "<"); start >= 0 {
+		if end := strings.LastIndex(s, ">"); end > start {
+			return s[start+1 : end]
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// orgAdminEmails returns the emails of the organization's active admins
+func (a *App) orgAdminEmails(orgID uuid.UUID) []string {
+	var emails []string
+	a.DB.Model(&models.User{}).
+		Joins("JOIN custom_roles ON custom_roles.id = users.role_id").
+		Where("users.organization_id = ? AND users.is_active = ? AND custom_roles.name = ? AND custom_roles.is_system = ? AND custom_roles.deleted_at IS NULL", orgID, true, "admin", true).
+		Pluck("users.email", &emails)
+	return emails
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// registrationPINPattern matches a two-step verification PIN
+var registrationPINPattern = regexp.MustCompile(`^\d{6}$`)
+
+// EmbeddedSignupRequest completes Meta's embedded signup for a number
+type EmbeddedSignupRequest struct {
+	Code       string `json:"code"`            // Returned by FB.login
+	BusinessID string `json:"waba_id"`         // From the signup's session info
+	PhoneID    string `json:"phone_number_id"` // From the signup's session info
+	PIN        string `json:"pin"`             // Two-step verification PIN the number is registered with
+	Name       string `json:"name"`            // Defaults to the number's verified name
+}
+
+// embeddedSignupEnabled reports whether the Meta app for embedded signup is configured
+func (a *App) embeddedSignupEnabled() bool {
+	cfg := a.CurrentConfig().WhatsApp
+	return cfg.AppID != "" && cfg.AppSecret != "" && cfg.EmbeddedSignupConfigID != ""
+}
+
+// GetEmbeddedSignupConfig returns what the frontend needs to launch embedded signup
+func (a *App) GetEmbeddedSignupConfig(r *fastglue.Request) error {
+	if _, err := getOrganizationID(r); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	if !a.embeddedSignupEnabled() {
+		return r.SendEnvelope(map[string]interface{}{"enabled": false})
+	}
+
+	cfg := a.CurrentConfig().WhatsApp
+	return r.SendEnvelope(map[string]interface{}{
+		"enabled":     true,
+		"app_id":      cfg.AppID,
+		"config_id":   cfg.EmbeddedSignupConfigID,
+		"api_version": defaultAccountAPIVersion,
+	})
+}
+
+// CompleteEmbeddedSignup connects the number picked in embedded signup: it exchanges
+// the signup code for an access token, registers the number, creates the account and
+// subscribes this server to the business account's webhooks
+func (a *App) CompleteEmbeddedSignup(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	if !a.embeddedSignupEnabled() {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Embedded signup is not configured", nil, "")
+	}
+
+	var req EmbeddedSignupRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if req.Code == "" || req.BusinessID == "" || req.PhoneID == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "code, waba_id, and phone_number_id are required", nil, "")
+	}
+	if !registrationPINPattern.MatchString(req.PIN) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "PIN must be 6 digits", nil, "")
+	}
+
+	// Signing up with a connected number reconnects it, e.g. when its token was revoked
+	var existing models.WhatsAppAccount
+	reconnect := a.DB.Where("organization_id = ? AND phone_id = ?", orgID, req.PhoneID).First(&existing).Error == nil
+	if !reconnect && a.accountLimitReached(orgID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureMultipleAccounts), nil, "")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	cfg := a.CurrentConfig().WhatsApp
+	accessToken, err := a.WhatsApp.ExchangeCode(ctx, cfg.AppID, cfg.AppSecret, defaultAccountAPIVersion, req.Code)
+	if err != nil {
+		a.Log.Error("Failed to exchange embedded signup code", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to connect with Meta: "+err.Error(), nil, "")
+	}
+
+	if reconnect {
+		return a.reconnectEmbeddedSignup(ctx, r, &existing, req, accessToken)
+	}
+
+	account := models.WhatsAppAccount{
+		OrganizationID:     orgID,
+		AppID:              cfg.AppID,
+		PhoneID:            req.PhoneID,
+		BusinessID:         req.BusinessID,
+		AccessToken:        accessToken,
+		WebhookVerifyToken: generateVerifyToken(),
+		APIVersion:         defaultAccountAPIVersion,
+		Status:             "active",
+	}
+	waAccount := a.toWhatsAppAccount(&account)
+
+	if err := a.WhatsApp.RegisterPhoneNumber(ctx, waAccount, req.PIN); err != nil {
+		a.Log.Error("Failed to register phone number", "error", err, "phone_id", req.PhoneID)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, err.Error(), nil, "")
+	}
+
+	account.Name = strings.TrimSpace(req.Name)
+	if account.Name == "" {
+		account.Name = req.PhoneID
+		if phone, err := a.WhatsApp.GetPhoneNumber(ctx, waAccount); err == nil {
+			if phone.VerifiedName != "" {
+				account.Name = phone.VerifiedName
+			} else if phone.DisplayPhoneNumber != "" {
+				account.Name = phone.DisplayPhoneNumber
+			}
+		}
+	}
+
+	var sameName int64
+	a.DB.Model(&models.WhatsAppAccount{}).Where("organization_id = ? AND name = ?", orgID, account.Name).Count(&sameName)
+	if sameName > 0 {
+		account.Name += " (" + req.PhoneID + ")"
+	}
+
+	// The organization's first number handles all messages by default
+	var count int64
+	a.DB.Model(&models.WhatsAppAccount{}).Where("organization_id = ?", orgID).Count(&count)
+	account.IsDefaultIncoming = count == 0
+	account.IsDefaultOutgoing = count == 0
+
+	// The account is created before subscribing, since Meta verifies the callback
+	// against its verify token
+	if err := a.DB.Create(&account).Error; err != nil {
+		a.Log.Error("Failed to create account", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create account", nil, "")
+	}
+
+	if err := a.WhatsApp.SubscribeApp(ctx, waAccount, a.publicBaseURL(r)+"/api/webhook", account.WebhookVerifyToken); err != nil {
+		a.Log.Error("Failed to subscribe to webhooks", "error", err, "business_id", req.BusinessID)
+		if err := a.DB.Unscoped().Delete(&account).Error; err != nil {
+			a.Log.Error("Failed to remove account after failed signup", "error", err, "account", account.Name)
+		}
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, err.Error(), nil, "")
+	}
+
+	a.Log.Info("Number connected through embedded signup", "account", account.Name, "phone_id", account.PhoneID)
+	return r.SendEnvelope(accountToResponse(account))
+}
+
+// reconnectEmbeddedSignup gives a connected number the access token from a new
+// signup, re-registering it with the Cloud API and resubscribing to its business
+// account's webhooks. The account is only saved once Meta has accepted both, so a
+// failed reconnect leaves it as it was.
+func (a *App) reconnectEmbeddedSignup(ctx context.Context, r *fastglue.Request, account *models.WhatsAppAccount, req EmbeddedSignupRequest, accessToken string) error {
+	account.AppID = a.CurrentConfig().WhatsApp.AppID
+	account.BusinessID = req.BusinessID
+	account.AccessToken = accessToken
+	account.APIType = whatsapp.APITypeCloud
+	if account.APIVersion == "" {
+		account.APIVersion = defaultAccountAPIVersion
+	}
+	if account.WebhookVerifyToken == "" {
+		account.WebhookVerifyToken = generateVerifyToken()
+	}
+	waAccount := a.toWhatsAppAccount(account)
+
+	if err := a.WhatsApp.RegisterPhoneNumber(ctx, waAccount, req.PIN); err != nil {
+		a.Log.Error("Failed to register phone number", "error", err, "phone_id", req.PhoneID)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, err.Error(), nil, "")
+	}
+	if err := a.WhatsApp.SubscribeApp(ctx, waAccount, a.publicBaseURL(r)+"/api/webhook", account.WebhookVerifyToken); err != nil {
+		a.Log.Error("Failed to subscribe to webhooks", "error", err, "business_id", req.BusinessID)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, err.Error(), nil, "")
+	}
+
+	account.Status = "active"
+	if err := a.DB.Save(account).Error; err != nil {
+		a.Log.Error("Failed to update account", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update account", nil, "")
+	}
+	a.InvalidateWhatsAppAccountCache(account.PhoneID)
+
+	a.Log.Info("Number reconnected through embedded signup", "account", account.Name, "phone_id", account.PhoneID)
+	return r.SendEnvelope(accountToResponse(*account))
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCompleteEmbeddedSignup_ReconnectsNumber(t *testing.T) {
+	subscribeStatus := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/oauth/access_token"):
+			_, _ = w.Write([]byte(`{"access_token":"new-token"}`))
+		case strings.HasSuffix(r.URL.Path, "/subscribed_apps"):
+			w.WriteHeader(subscribeStatus)
+			if subscribeStatus != http.StatusOK {
+				_, _ = w.Write([]byte(`{"error":{"message":"Invalid verify token","code":100}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"success":true}`))
+		default:
+			_, _ = w.Write([]byte(`{"success":true}`))
+		}
+	}))
+	defer server.Close()
+
+	app := &App{
+		Config: &config.Config{WhatsApp: config.WhatsAppConfig{
+			AppID: "app", AppSecret: "secret", EmbeddedSignupConfigID: "signup-config",
+		}},
+		DB:       testutil.SetupTestDB(t),
+		Log:      testutil.NopLogger(),
+		WhatsApp: whatsapp.NewWithBaseURL(testutil.NopLogger(), server.URL),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Signup Org " + uuid.New().String()[:8],
+		Slug:      "signup-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{
+		OrganizationID:     org.ID,
+		Name:               "support",
+		PhoneID:            "phone-" + uuid.New().String()[:8],
+		BusinessID:         "old-business",
+		AccessToken:        "revoked-token",
+		WebhookVerifyToken: "verify",
+		APIVersion:         "v21.0",
+		Status:             "inactive",
+	}
+	require.NoError(t, app.DB.Create(account).Error)
+
+	signup := func() int {
+		req := testutil.NewJSONRequest(t, EmbeddedSignupRequest{
+			Code: "code", BusinessID: "new-business", PhoneID: account.PhoneID, PIN: "123456",
+		})
+		req.RequestCtx.SetUserValue("organization_id", org.ID)
+		require.NoError(t, app.CompleteEmbeddedSignup(req))
+		return testutil.GetResponseStatusCode(req)
+	}
+
+	// A failed reconnect leaves the account as it was
+	assert.Equal(t, fasthttp.StatusBadGateway, signup())
+	var saved models.WhatsAppAccount
+	require.NoError(t, app.DB.First(&saved, account.ID).Error)
+	assert.Equal(t, "revoked-token", saved.AccessToken)
+	assert.Equal(t, "old-business", saved.BusinessID)
+
+	subscribeStatus = http.StatusOK
+	assert.Equal(t, fasthttp.StatusOK, signup())
+	require.NoError(t, app.DB.First(&saved, account.ID).Error)
+	assert.Equal(t, "new-token", saved.AccessToken)
+	assert.Equal(t, "new-business", saved.BusinessID)
+	assert.Equal(t, "active", saved.Status)
+	assert.Equal(t, "verify", saved.WebhookVerifyToken)
+
+	var count int64
+	app.DB.Model(&models.WhatsAppAccount{}).Where("organization_id = ?", org.ID).Count(&count)
+	assert.Equal(t, int64(1), count, "the number isn't connected twice")
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// embeddingBatchSize limits the passages embedded per request
+const embeddingBatchSize = 64
+
+// Default embedding models of the providers that offer embeddings
+var defaultEmbeddingModels = map[models.AIProvider]string{
+	models.AIProviderOpenAI: "text-embedding-3-small",
+	models.AIProviderGoogle: "text-embedding-004",
+	models.AIProviderOllama: "nomic-embed-text",
+}
+
+// openAIEmbeddingsURL is the OpenAI embeddings endpoint, overridden in tests
+var openAIEmbeddingsURL = "https://api.openai.com/v1/embeddings"
+
+// embeddingConfig is the provider the knowledge base is embedded with
+type embeddingConfig struct {
+	OrganizationID uuid.UUID
+	Provider       models.AIProvider
+	Model          string
+	BaseURL        string
+	APIKey         string // May be a secret reference, resolved by embedTexts
+}
+
+// name identifies the embedding model, e.g. "openai/text-embedding-3-small".
+// Passages embedded with another model can't be compared and need reindexing.
+func (e embeddingConfig) name() string {
+	return string(e.Provider) + "/" + e.Model
+}
+
+// knowledgeEmbeddingConfig returns the embedding provider of the settings. The
+// AI provider's key and server are used when the embedding provider is the same.
+func knowledgeEmbeddingConfig(settings *models.ChatbotSettings) (embeddingConfig, bool) {
+	ai := settings.AI
+	cfg := embeddingConfig{
+		OrganizationID: settings.OrganizationID,
+		Provider:       ai.EmbeddingProvider,
+		Model:          ai.EmbeddingModel,
+		BaseURL:        ai.EmbeddingBaseURL,
+		APIKey:         ai.EmbeddingAPIKey,
+	}
+	if _, ok := defaultEmbeddingModels[cfg.Provider]; !ok {
+		return cfg, false
+	}
+	if cfg.Model == "" {
+		cfg.Model = defaultEmbeddingModels[cfg.Provider]
+	}
+	if cfg.Provider == ai.Provider {
+		if cfg.APIKey == "" {
+			cfg.APIKey = ai.APIKey
+		}
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = ai.BaseURL
+		}
+	}
+	if cfg.Provider != models.AIProviderOllama && cfg.APIKey == "" {
+		return cfg, false
+	}
+	return cfg, true
+}
+
+// embedTexts returns the embeddings of texts, in order, and the tokens used
+func (a *App) embedTexts(ctx context.Context, cfg embeddingConfig, texts []string) ([]models.Embedding, int, error) {
+	apiKey, err := a.resolveCredential(ctx, cfg.OrganizationID, cfg.APIKey)
+	if err != nil {
+		return nil, 0, fmt.Errorf("embedding API key: %w", err)
+	}
+	cfg.APIKey = apiKey
+
+	embeddings := make([]models.Embedding, 0, len(texts))
+	tokens := 0
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		end := min(start+embeddingBatchSize, len(texts))
+		var batch []models.Embedding
+		var used int
+		var err error
+		switch cfg.Provider {
+		case models.AIProviderOpenAI:
+			batch, used, err = a.embedOpenAI(ctx, cfg, texts[start:end])
+		case models.AIProviderGoogle:
+			batch, err = a.embedGoogle(ctx, cfg, texts[start:end])
+		case models.AIProviderOllama:
+			batch, used, err = a.embedOllama(ctx, cfg, texts[start:end])
+		default:
+			err = fmt.Errorf("%s doesn't offer embeddings", cfg.Provider)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(batch) != end-start {
+			return nil, 0, fmt.Errorf("expected %d embeddings, got %d", end-start, len(batch))
+		}
+		embeddings = append(embeddings, batch...)
+		tokens += used
+	}
+	return embeddings, tokens, nil
+}
+
+// embedOpenAI embeds texts with the OpenAI embeddings API
+func (a *App) embedOpenAI(ctx context.Context, cfg embeddingConfig, texts []string) ([]models.Embedding, int, error) {
+	payload := map[string]interface{}{
+		"model": cfg.Model,
+		"input": texts,
+	}
+	status, body, err := a.postAIRequest(ctx, a.aiClient(models.AIProviderOpenAI), openAIEmbeddingsURL, map[string]string{"Authorization": "Bearer " + cfg.APIKey}, payload)
+	if err != nil {
+		return nil, 0, err
+	}
+	if status != 200 {
+		var errResp struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(body, &errResp)
+		return nil, 0, fmt.Errorf("OpenAI API error: %s", errResp.Error.Message)
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int              `json:"index"`
+			Embedding models.Embedding `json:"embedding"`
+		} `json:"data"`
+		Usage struct {
+			PromptTokens int `json:"prompt_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	embeddings := make([]models.Embedding, len(result.Data))
+	for _, item := range result.Data {
+		if item.Index < 0 || item.Index >= len(embeddings) {
+			return nil, 0, errors.New("embedding index out of range")
+		}
+		embeddings[item.Index] = item.Embedding
+	}
+	return embeddings, result.Usage.PromptTokens, nil
+}
+
+// embedGoogle embeds texts with the Gemini batchEmbedContents API, which doesn't report tokens
+func (a *App) embedGoogle(ctx context.Context, cfg embeddingConfig, texts []string) ([]models.Embedding, error) {
+	requests := make([]map[string]interface{}, len(texts))
+	for i, text := range texts {
+		requests[i] = map[string]interface{}{
+			"model": "models/" + cfg.Model,
+			"content": map[string]interface{}{
+				"parts": []map[string]string{{"text": text}},
+			},
+		}
+	}
+	url := fmt.Sprintf("%s/models/%s:batchEmbedContents?key=%s", googleAIBaseURL, cfg.Model, cfg.APIKey)
+	status, body, err := a.postAIRequest(ctx, a.aiClient(models.AIProviderGoogle), url, nil, map[string]interface{}{"requests": requests})
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		var errResp struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(body, &errResp)
+		return nil, fmt.Errorf("google AI API error: %s", errResp.Error.Message)
+	}
+
+	var result struct {
+		Embeddings []struct {
+			Values models.Embedding `json:"values"`
+		} `json:"embeddings"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	embeddings := make([]models.Embedding, len(result.Embeddings))
+	for i, item := range result.Embeddings {
+		embeddings[i] = item.Values
+	}
+	return embeddings, nil
+}
+
+// embedOllama embeds texts with an Ollama-compatible /api/embed endpoint
+func (a *App) embedOllama(ctx context.Context, cfg embeddingConfig, texts []string) ([]models.Embedding, int, error) {
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	headers := map[string]string{}
+	if cfg.APIKey != "" {
+		headers["Authorization"] = "Bearer " + cfg.APIKey
+	}
+
+	payload := map[string]interface{}{
+		"model": cfg.Model,
+		"input": texts,
+	}
+	status, body, err := a.postAIRequest(ctx, a.aiClient(models.AIProviderOllama), baseURL+"/api/embed", headers, payload)
+	if err != nil {
+		return nil, 0, err
+	}
+	if status != 200 {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(body, &errResp)
+		return nil, 0, fmt.Errorf("Ollama API error (status %d): %s", status, errResp.Error)
+	}
+
+	var result struct {
+		Embeddings      []models.Embedding `json:"embeddings"`
+		PromptEvalCount int                `json:"prompt_eval_count"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return result.Embeddings, result.PromptEvalCount, nil
+}
+
+// cosineSimilarity returns the cosine similarity of two vectors, or 0 when they
+// can't be compared
+func cosineSimilarity(a, b models.Embedding) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+)
+
+// failoverRecoveryDelay is how long a number stays failed over before it is checked
+// for recovery, so short rate limits don't switch sends back and forth
+const failoverRecoveryDelay = 10 * time.Minute
+
+// failoverErrorCodes are Meta error codes meaning the number can't send right now,
+// as opposed to a problem with the message or the recipient
+var failoverErrorCodes = map[int]bool{
+	1:      true, // API unknown error
+	2:      true, // API service temporarily unavailable
+	4:      true, // Application request limit reached
+	368:    true, // Temporarily blocked for policy violations
+	80007:  true, // Business account rate limit reached
+	130429: true, // Cloud API throughput reached
+	131016: true, // Service overloaded
+	131031: true, // Business account locked
+	131048: true, // Spam rate limit hit
+	133010: true, // Phone number not registered
+}
+
+// isFailoverError reports whether a send error means the number is unavailable
+func isFailoverError(err error) bool {
+	var apiErr *whatsapp.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return failoverErrorCodes[apiErr.Code] || apiErr.StatusCode >= 500
+}
+
+// validateFailoverAccount checks that a backup number belongs to the organization
+// and isn't the number itself
+func (a *App) validateFailoverAccount(orgID uuid.UUID, accountName, failoverAccount string) error {
+	if failoverAccount == "" {
+		return nil
+	}
+	if failoverAccount == accountName {
+		return fmt.Errorf("a number can't fail over to itself")
+	}
+	var count int64
+	a.DB.Model(&models.WhatsAppAccount{}).Where("organization_id = ? AND name = ?", orgID, failoverAccount).Count(&count)
+	if count == 0 {
+		return fmt.Errorf("failover account not found")
+	}
+	return nil
+}
+
+// failoverTemplatesJSONB converts a template mapping to the stored form, dropping
+// empty entries
+func failoverTemplatesJSONB(templates map[string]string) models.JSONB {
+	mapping := models.JSONB{}
+	for name, backupName := range templates {
+		if name != "" && backupName != "" {
+			mapping[name] = backupName
+		}
+	}
+	return mapping
+}
+
+// sendTemplateWithFailover sends a template from the request's number. When the number
+// is unavailable and has a backup, the template is sent from the backup instead, and
+// later sends go straight to the backup until the number recovers.
+func (a *App) sendTemplateWithFailover(ctx context.Context, msg *models.Message, req OutgoingMessageRequest) (string, error) {
+	account := req.Account
+	var primaryErr error
+	if account.FailoverAccount == "" || account.FailoverActiveAt == nil {
+		wamid, err := a.WhatsApp.SendTemplateMessage(ctx, a.toWhatsAppAccount(account), req.Contact.PhoneNumber, req.Template.Name, req.Template.Language, req.BodyParams)
+		if err == nil || account.FailoverAccount == "" || !isFailoverError(err) {
+			return wamid, err
+		}
+		primaryErr = err
+		a.startFailover(account, err)
+	}
+
+	backup, template, err := a.failoverRoute(account, req.Template)
+	if err != nil {
+		if primaryErr != nil {
+			return "", fmt.Errorf("%w (failover: %v)", primaryErr, err)
+		}
+		return "", err
+	}
+	wamid, err := a.WhatsApp.SendTemplateMessage(ctx, a.toWhatsAppAccount(backup), req.Contact.PhoneNumber, template.Name, template.Language, req.BodyParams)
+	if err != nil {
+		return "", fmt.Errorf("failover to %s: %w", backup.Name, err)
+	}
+
+	metadata := msg.Metadata
+	if metadata == nil {
+		metadata = models.JSONB{}
+	}
+	metadata["failover_from"] = account.Name
+	if err := a.DB.Model(msg).Updates(map[string]any{
+		"whats_app_account": backup.Name,
+		"template_name":     template.Name,
+		"metadata":          metadata,
+	}).Error; err != nil {
+		a.log(ctx).Error("Failed to record failover on message", "error", err, "message_id", msg.ID)
+	}
+
+	return wamid, nil
+}
+
+// failoverRoute returns the backup number of a failed over number, and the template
+// mapped to the given one on the backup
+func (a *App) failoverRoute(account *models.WhatsAppAccount, template *models.Template) (*models.WhatsAppAccount, *models.Template, error) {
+	var backup models.WhatsAppAccount
+	if err := a.DB.Where("organization_id = ? AND name = ?", account.OrganizationID, account.FailoverAccount).
+		First(&backup).Error; err != nil {
+		return nil, nil, fmt.Errorf("failover account %s not found", account.FailoverAccount)
+	}
+
+	name := template.Name
+	if mapped, ok := account.FailoverTemplates[template.Name].(string); ok && mapped != "" {
+		name = mapped
+	}
+	var backupTemplate models.Template
+	if err := a.DB.Where("organization_id = ? AND whats_app_account = ? AND name = ? AND language = ? AND status = ?",
+		account.OrganizationID, backup.Name, name, template.Language, models.TemplateStatusApproved).
+		First(&backupTemplate).Error; err != nil {
+		return nil, nil, fmt.Errorf("template %s (%s) is not approved on failover account %s", name, template.Language, backup.Name)
+	}
+
+	return &backup, &backupTemplate, nil
+}
+
+// startFailover moves a number's template sends to its backup and alerts the
+// organization. Concurrent sends start the failover once.
+func (a *App) startFailover(account *models.WhatsAppAccount, cause error) {
+	result := a.DB.Model(&models.WhatsAppAccount{}).
+		Where("id = ? AND failover_active_at IS NULL", account.ID).
+		Updates(map[string]any{
+			"failover_active_at": time.Now(),
+			"failover_reason":    cause.Error(),
+		})
+	if result.Error != nil {
+		a.Log.Error("Failed to start failover", "error", result.Error, "account", account.Name)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	a.InvalidateWhatsAppAccountCache(account.PhoneID)
+
+	a.Log.Warn("Number unavailable, failing over", "account", account.Name, "failover_account", account.FailoverAccount, "error", cause)
+	a.sendFailoverAlert(account, models.WebhookEventFailoverStarted, cause.Error())
+}
+
+// endFailover moves a recovered number's template sends back to it
+func (a *App) endFailover(account *models.WhatsAppAccount) {
+	result := a.DB.Model(&models.WhatsAppAccount{}).
+		Where("id = ? AND failover_active_at IS NOT NULL", account.ID).
+		Updates(map[string]any{
+			"failover_active_at": nil,
+			"failover_reason":    "",
+		})
+	if result.Error != nil {
+		a.Log.Error("Failed to end failover", "error", result.Error, "account", account.Name)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	a.InvalidateWhatsAppAccountCache(account.PhoneID)
+
+	a.Log.Info("Number recovered, failover ended", "account", account.Name)
+	a.sendFailoverAlert(account, models.WebhookEventFailoverEnded, "")
+}
+
+// sendFailoverAlert emits the failover webhook event and emails the organization's admins
+func (a *App) sendFailoverAlert(account *models.WhatsAppAccount, event models.WebhookEvent, reason string) {
+	a.DispatchWebhook(account.OrganizationID, event, map[string]interface{}{
+		"account":          account.Name,
+		"phone_id":         account.PhoneID,
+		"failover_account": account.FailoverAccount,
+		"reason":           reason,
+	})
+
+	if !a.emailEnabled() {
+		return
+	}
+
+	var subject, body string
+	if event == models.WebhookEventFailoverStarted {
+		subject = fmt.Sprintf("WhatsApp number %s failed over to %s", account.Name, account.FailoverAccount)
+		body = fmt.Sprintf("Sending from the WhatsApp number %s failed with: %s\n\n"+
+			"Template messages are being sent from the backup number %s until %s recovers.\n",
+			account.Name, reason, account.FailoverAccount, account.Name)
+	} else {
+		subject = fmt.Sprintf("WhatsApp number %s recovered", account.Name)
+		body = fmt.Sprintf("The WhatsApp number %s is available again, and template messages are being sent from it instead of %s.\n",
+			account.Name, account.FailoverAccount)
+	}
+
+	if err := a.sendEmail(a.orgAdminEmails(account.OrganizationID), subject, body); err != nil {
+		a.Log.Error("Failed to send failover alert email", "error", err, "account", account.Name)
+	}
+}
+
+// FailoverProcessor switches failed over numbers back once they recover
+type FailoverProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewFailoverProcessor creates a new failover processor
+func NewFailoverProcessor(app *App, interval time.Duration) *FailoverProcessor {
+	return &FailoverProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the failover recovery loop
+func (p *FailoverProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Failover processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Failover processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Failover processor stopped")
+			return
+		case <-ticker.C:
+			p.processRecoveries()
+		}
+	}
+}
+
+// Stop stops the failover processor
+func (p *FailoverProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// processRecoveries checks numbers that have been failed over for a while
+func (p *FailoverProcessor) processRecoveries() {
+	var accounts []models.WhatsAppAccount
+	if err := p.app.DB.Where("failover_active_at IS NOT NULL AND failover_active_at <= ?", time.Now().Add(-failoverRecoveryDelay)).
+		Find(&accounts).Error; err != nil {
+		p.app.Log.Error("Failed to load failed over accounts", "error", err)
+		return
+	}
+
+	for i := range accounts {
+		p.checkRecovery(&accounts[i])
+	}
+}
+
+// checkRecovery ends the failover of a number Meta reports as connected
+func (p *FailoverProcessor) checkRecovery(account *models.WhatsAppAccount) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	phone, err := p.app.WhatsApp.GetPhoneNumber(ctx, p.app.toWhatsAppAccount(account))
+	if err != nil {
+		p.app.Log.Debug("Failed over number still unavailable", "account", account.Name, "error", err)
+		return
+	}
+	if phone.Status != "" && phone.Status != "CONNECTED" {
+		p.app.Log.Debug("Failed over number not connected", "account", account.Name, "status", phone.Status)
+		return
+	}
+
+	p.app.endFailover(account)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsFailoverError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "throughput reached", err: &whatsapp.APIError{StatusCode: 400, Code: 130429}, want: true},
+		{name: "number not registered", err: &whatsapp.APIError{StatusCode: 400, Code: 133010}, want: true},
+		{name: "wrapped", err: fmt.Errorf("failed to send template: %w", &whatsapp.APIError{StatusCode: 400, Code: 131048}), want: true},
+		{name: "server error without Meta code", err: &whatsapp.APIError{StatusCode: 503, Message: "Service Unavailable"}, want: true},
+		{name: "invalid parameter", err: &whatsapp.APIError{StatusCode: 400, Code: 100}},
+		{name: "recipient outside window", err: &whatsapp.APIError{StatusCode: 400, Code: 131047}},
+		{name: "not an API error", err: errors.New("template is required for template messages")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isFailoverError(tt.err))
+		})
+	}
+}
+
+func TestFailoverTemplatesJSONB(t *testing.T) {
+	mapping := failoverTemplatesJSONB(map[string]string{
+		"order_update": "order_update_backup",
+		"unmapped":     "",
+	})
+	assert.Equal(t, models.JSONB{"order_update": "order_update_backup"}, mapping)
+}
+
+func TestSendTemplateWithFailover(t *testing.T) {
+	var sentFrom []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		template, _ := body["template"].(map[string]interface{})
+		sentFrom = append(sentFrom, fmt.Sprintf("%s %v", strings.Split(r.URL.Path, "/")[2], template["name"]))
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages": []map[string]string{{"id": "wamid.failover"}},
+		})
+	}))
+	defer server.Close()
+
+	app := &App{
+		Config:   &config.Config{},
+		DB:       testutil.SetupTestDB(t),
+		Log:      testutil.NopLogger(),
+		WhatsApp: whatsapp.NewWithBaseURL(testutil.NopLogger(), server.URL),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Failover Org " + uuid.New().String()[:8],
+		Slug:      "failover-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+
+	activeAt := time.Now()
+	primary := &models.WhatsAppAccount{
+		OrganizationID:    org.ID,
+		Name:              "primary",
+		PhoneID:           "primary-phone",
+		BusinessID:        "business",
+		AccessToken:       "token",
+		APIVersion:        "v21.0",
+		FailoverAccount:   "backup",
+		FailoverTemplates: models.JSONB{"order_update": "order_update_v2"},
+		FailoverActiveAt:  &activeAt,
+	}
+	backup := &models.WhatsAppAccount{
+		OrganizationID: org.ID,
+		Name:           "backup",
+		PhoneID:        "backup-phone",
+		BusinessID:     "business",
+		AccessToken:    "token",
+		APIVersion:     "v21.0",
+	}
+	require.NoError(t, app.DB.Create(primary).Error)
+	require.NoError(t, app.DB.Create(backup).Error)
+
+	template := &models.Template{
+		OrganizationID:  org.ID,
+		WhatsAppAccount: primary.Name,
+		Name:            "order_update",
+		Language:        "en",
+		Status:          string(models.TemplateStatusApproved),
+		BodyContent:     "Your order has shipped",
+	}
+	backupTemplate := &models.Template{
+		OrganizationID:  org.ID,
+		WhatsAppAccount: backup.Name,
+		Name:            "order_update_v2",
+		Language:        "en",
+		Status:          string(models.TemplateStatusApproved),
+		BodyContent:     "Your order has shipped",
+	}
+	require.NoError(t, app.DB.Create(template).Error)
+	require.NoError(t, app.DB.Create(backupTemplate).Error)
+
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1555" + uuid.New().String()[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	msg := &models.Message{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		WhatsAppAccount: primary.Name,
+		ContactID:       contact.ID,
+		Direction:       models.DirectionOutgoing,
+		MessageType:     models.MessageTypeTemplate,
+		TemplateName:    template.Name,
+		Status:          models.MessageStatusPending,
+	}
+	require.NoError(t, app.DB.Create(msg).Error)
+
+	// While failed over, templates go straight to the backup with the mapped template
+	wamid, err := app.sendTemplateWithFailover(testutil.TestContext(t), msg, OutgoingMessageRequest{
+		Account:  primary,
+		Contact:  contact,
+		Type:     models.MessageTypeTemplate,
+		Template: template,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "wamid.failover", wamid)
+	assert.Equal(t, []string{"backup-phone order_update_v2"}, sentFrom)
+
+	var saved models.Message
+	require.NoError(t, app.DB.First(&saved, "id = ?", msg.ID).Error)
+	assert.Equal(t, backup.Name, saved.WhatsAppAccount)
+	assert.Equal(t, "order_update_v2", saved.TemplateName)
+	assert.Equal(t, primary.Name, saved.Metadata["failover_from"])
+
+	// Templates not approved on the backup can't fail over
+	backupTemplate.Status = "PAUSED"
+	require.NoError(t, app.DB.Save(backupTemplate).Error)
+	_, err = app.sendTemplateWithFailover(testutil.TestContext(t), msg, OutgoingMessageRequest{
+		Account:  primary,
+		Contact:  contact,
+		Type:     models.MessageTypeTemplate,
+		Template: template,
+	})
+	assert.EqualError(t, err, "template order_update_v2 (en) is not approved on failover account backup")
+}
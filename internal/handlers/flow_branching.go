@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// conditionBranches returns the branches of a condition step, as
+// {"condition": "age >= 18", "next_step": "adult"} maps
+func conditionBranches(config map[string]interface{}) []map[string]interface{} {
+	raw, _ := config["branches"].([]interface{})
+	branches := make([]map[string]interface{}, 0, len(raw))
+	for _, b := range raw {
+		if branch, ok := b.(map[string]interface{}); ok {
+			branches = append(branches, branch)
+		}
+	}
+	return branches
+}
+
+// conditionNextStep returns the step of the first branch whose condition holds
+// for the session data, or the step's next step when none does
+func conditionNextStep(step *models.ChatbotFlowStep, data map[string]interface{}) string {
+	for _, branch := range conditionBranches(step.InputConfig) {
+		if evaluateExpression(getStringFromMap(branch, "condition"), data) {
+			return getStringFromMap(branch, "next_step")
+		}
+	}
+	return step.NextStep
+}
+
+// validateConditionStep checks that every branch of a condition step has a
+// condition and goes to a step of the flow
+func validateConditionStep(step FlowStepRequest, stepNames map[string]bool) error {
+	branches := conditionBranches(step.InputConfig)
+	if len(branches) == 0 {
+		return errors.New("condition steps need at least one branch")
+	}
+	for _, branch := range branches {
+		if strings.TrimSpace(getStringFromMap(branch, "condition")) == "" {
+			return errors.New("every branch needs a condition")
+		}
+		if next := getStringFromMap(branch, "next_step"); !stepNames[next] {
+			return fmt.Errorf("branch goes to unknown step %q", next)
+		}
+	}
+	return nil
+}
+
+// validateJumpStep checks that a jump step goes to a flow of the organization
+func (a *App) validateJumpStep(orgID uuid.UUID, step FlowStepRequest) error {
+	flowID, err := uuid.Parse(getStringFromMap(step.InputConfig, "flow_id"))
+	if err != nil {
+		return errors.New("flow_id is required for jump steps")
+	}
+	var count int64
+	a.DB.Model(&models.ChatbotFlow{}).Where("id = ? AND organization_id = ?", flowID, orgID).Count(&count)
+	if count == 0 {
+		return errors.New("flow to jump to not found")
+	}
+	return nil
+}
+
+// advanceToStep moves the session to a step of the flow and runs it. An empty
+// step name goes to the following step; the flow completes when there is none.
+func (a *App) advanceToStep(ctx context.Context, account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, flow *models.ChatbotFlow, step *models.ChatbotFlowStep, nextStepName string, visited map[string]bool) {
+	if nextStepName == "" {
+		for i, s := range flow.Steps {
+			if s.StepName == step.StepName && i+1 < len(flow.Steps) {
+				nextStepName = flow.Steps[i+1].StepName
+				break
+			}
+		}
+	}
+	if nextStepName == "" {
+		a.completeFlow(ctx, account, session, contact, flow)
+		return
+	}
+
+	var nextStep *models.ChatbotFlowStep
+	for i := range flow.Steps {
+		if flow.Steps[i].StepName == nextStepName {
+			nextStep = &flow.Steps[i]
+			break
+		}
+	}
+	if nextStep == nil {
+		a.log(ctx).Warn("Next step not found after condition, completing flow", "next_step", nextStepName)
+		a.completeFlow(ctx, account, session, contact, flow)
+		return
+	}
+
+	session.CurrentStep = nextStep.StepName
+	a.DB.Model(session).Update("current_step", nextStep.StepName)
+
+	a.sendStepWithSkipCheck(ctx, account, session, contact, nextStep, flow, visited)
+}
+
+// jumpToFlow continues the session in another flow from its first step, keeping
+// the data collected so far
+func (a *App) jumpToFlow(ctx context.Context, account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, flow *models.ChatbotFlow, step *models.ChatbotFlowStep, visited map[string]bool) {
+	var target *models.ChatbotFlow
+	if flowID, err := uuid.Parse(getStringFromMap(step.InputConfig, "flow_id")); err == nil {
+		target = a.findChatbotFlow(contact.OrganizationID, flowID)
+	}
+	if target == nil || len(target.Steps) == 0 {
+		a.log(ctx).Warn("Flow to jump to not found, completing flow", "step", step.StepName, "flow_id", step.InputConfig["flow_id"])
+		a.completeFlow(ctx, account, session, contact, flow)
+		return
+	}
+
+	a.log(ctx).Info("Jumping to flow", "from_flow", flow.ID, "to_flow", target.ID, "session_id", session.ID)
+
+	if session.SessionData == nil {
+		session.SessionData = models.JSONB{}
+	}
+	session.SessionData["_flow_id"] = target.ID.String()
+	session.SessionData["_flow_name"] = target.Name
+	session.CurrentFlowID = &target.ID
+	session.CurrentStep = target.Steps[0].StepName
+	session.StepRetries = 0
+	a.DB.Save(session)
+
+	a.sendStepWithSkipCheck(ctx, account, session, contact, &target.Steps[0], target, visited)
+}
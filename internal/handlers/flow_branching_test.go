@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionNextStep(t *testing.T) {
+	step := &models.ChatbotFlowStep{
+		StepName:    "check_age",
+		MessageType: models.FlowStepTypeCondition,
+		NextStep:    "minor",
+		InputConfig: models.JSONB{"branches": []interface{}{
+			map[string]interface{}{"condition": "age >= 65", "next_step": "senior"},
+			map[string]interface{}{"condition": "age >= 18", "next_step": "adult"},
+		}},
+	}
+
+	assert.Equal(t, "senior", conditionNextStep(step, map[string]interface{}{"age": "70"}))
+	assert.Equal(t, "adult", conditionNextStep(step, map[string]interface{}{"age": "30"}))
+	assert.Equal(t, "minor", conditionNextStep(step, map[string]interface{}{"age": "12"}))
+	assert.Equal(t, "minor", conditionNextStep(step, map[string]interface{}{}))
+}
+
+func TestValidateConditionStep(t *testing.T) {
+	stepNames := map[string]bool{"check_age": true, "adult": true}
+	step := func(branches ...interface{}) FlowStepRequest {
+		return FlowStepRequest{
+			StepName:    "check_age",
+			MessageType: models.FlowStepTypeCondition,
+			InputConfig: map[string]interface{}{"branches": branches},
+		}
+	}
+
+	assert.NoError(t, validateConditionStep(step(
+		map[string]interface{}{"condition": "age >= 18", "next_step": "adult"},
+	), stepNames))
+	assert.Error(t, validateConditionStep(step(), stepNames))
+	assert.Error(t, validateConditionStep(step(
+		map[string]interface{}{"condition": " ", "next_step": "adult"},
+	), stepNames))
+	assert.Error(t, validateConditionStep(step(
+		map[string]interface{}{"condition": "age >= 18", "next_step": "senior"},
+	), stepNames))
+}
+
+func TestFlowsForAccount(t *testing.T) {
+	sales := &models.ChatbotFlow{Name: "Sales menu", WhatsAppAccount: "sales"}
+	support := &models.ChatbotFlow{Name: "Support menu", WhatsAppAccount: "support"}
+	shared := &models.ChatbotFlow{Name: "Menu"}
+
+	flows := []*models.ChatbotFlow{sales, support, shared}
+	assert.Equal(t, []*models.ChatbotFlow{sales}, flowsForAccount(flows, "sales"))
+	assert.Equal(t, []*models.ChatbotFlow{shared}, flowsForAccount(flows, "billing"))
+	assert.Empty(t, flowsForAccount([]*models.ChatbotFlow{sales}, "support"))
+}
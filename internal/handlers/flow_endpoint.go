@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// Status codes WhatsApp expects from a flow data endpoint
+const (
+	flowStatusDecryptionFailed = 421 // WhatsApp re-fetches the public key and retries
+	flowStatusInvalidSignature = 432
+)
+
+// flowSuccessScreen is the screen name that completes a flow from its data endpoint
+const flowSuccessScreen = "SUCCESS"
+
+// FlowDataEndpoint is the data endpoint of WhatsApp Flows that exchange data with
+// Whatomate. Each screen's data is stored in the chatbot session that sent the flow,
+// and the flow moves on to the next screen, or completes on the last one. Completing
+// sends the last screen's data back as the flow's reply, like a flow without an endpoint.
+func (a *App) FlowDataEndpoint(r *fastglue.Request) error {
+	body := r.RequestCtx.PostBody()
+	if !a.validFlowSignature(body, string(r.RequestCtx.Request.Header.Peek("X-Hub-Signature-256"))) {
+		a.Log.Warn("Flow data request with an invalid signature")
+		r.RequestCtx.SetStatusCode(flowStatusInvalidSignature)
+		return nil
+	}
+
+	key, err := whatsapp.ParseFlowPrivateKey(a.CurrentConfig().WhatsApp.FlowPrivateKey)
+	if err != nil {
+		a.Log.Error("Flow data endpoint is not configured", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Flow data endpoint is not configured", nil, "")
+	}
+
+	var req whatsapp.FlowEndpointRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	data, flowCipher, err := whatsapp.DecryptFlowRequest(key, req)
+	if err != nil {
+		a.Log.Warn("Failed to decrypt flow data request", "error", err)
+		r.RequestCtx.SetStatusCode(flowStatusDecryptionFailed)
+		return nil
+	}
+
+	response := a.flowDataResponse(data)
+	encrypted, err := flowCipher.Encrypt(response)
+	if err != nil {
+		a.Log.Error("Failed to encrypt flow data response", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to encrypt response", nil, "")
+	}
+
+	r.RequestCtx.SetStatusCode(fasthttp.StatusOK)
+	r.RequestCtx.SetContentType("text/plain")
+	r.RequestCtx.SetBodyString(encrypted)
+	return nil
+}
+
+// validFlowSignature checks a flow data request's X-Hub-Signature-256 against the
+// Meta app secret. Requests aren't checked when no app secret is configured.
+func (a *App) validFlowSignature(body []byte, signature string) bool {
+	secret := a.CurrentConfig().WhatsApp.AppSecret
+	if secret == "" {
+		return true
+	}
+	return validHubSignature(body, signature, secret)
+}
+
+// flowDataResponse answers a decrypted flow data request
+func (a *App) flowDataResponse(req *whatsapp.FlowDataRequest) map[string]interface{} {
+	if req.Action == whatsapp.FlowActionPing {
+		return map[string]interface{}{"data": map[string]interface{}{"status": "active"}}
+	}
+	// WhatsApp reports errors of earlier responses as a notification
+	if _, ok := req.Data["error"]; ok {
+		a.Log.Warn("Flow data endpoint error reported", "flow_token", req.FlowToken, "screen", req.Screen, "data", req.Data)
+		return map[string]interface{}{"data": map[string]interface{}{"acknowledged": true}}
+	}
+
+	session, flow := a.flowTokenTarget(req.FlowToken)
+	var screens []interface{}
+	var routing map[string]interface{}
+	if flow != nil {
+		screens, routing = flowScreens(flow)
+	}
+
+	switch req.Action {
+	case whatsapp.FlowActionInit:
+		return map[string]interface{}{"screen": firstFlowScreen(screens), "data": map[string]interface{}{}}
+	case whatsapp.FlowActionBack:
+		return map[string]interface{}{"screen": req.Screen, "data": map[string]interface{}{}}
+	}
+
+	// data_exchange: keep the screen's data, then show the next screen or complete
+	if session != nil && len(req.Data) > 0 {
+		sessionData := session.SessionData
+		if sessionData == nil {
+			sessionData = models.JSONB{}
+		}
+		for field, value := range req.Data {
+			sessionData[field] = value
+		}
+		if err := a.DB.Model(session).Update("session_data", sessionData).Error; err != nil {
+			a.Log.Error("Failed to store flow data in session", "error", err, "session_id", session.ID)
+		}
+	}
+
+	if next := nextFlowScreen(screens, routing, req.Screen); next != "" {
+		return map[string]interface{}{"screen": next, "data": map[string]interface{}{}}
+	}
+
+	params := map[string]interface{}{"flow_token": req.FlowToken}
+	for field, value := range req.Data {
+		params[field] = value
+	}
+	return map[string]interface{}{
+		"screen": flowSuccessScreen,
+		"data": map[string]interface{}{
+			"extension_message_response": map[string]interface{}{"params": params},
+		},
+	}
+}
+
+// flowTokenTarget finds what sent a flow from its flow token: the chatbot session
+// of a flow step (chatbot_<session id>_...), and the flow sent
+func (a *App) flowTokenTarget(flowToken string) (*models.ChatbotSession, *models.WhatsAppFlow) {
+	rest, ok := strings.CutPrefix(flowToken, "chatbot_")
+	if !ok {
+		return nil, nil
+	}
+	sessionID, err := uuid.Parse(strings.SplitN(rest, "_", 2)[0])
+	if err != nil {
+		return nil, nil
+	}
+
+	var session models.ChatbotSession
+	if err := a.DB.Where("id = ? AND status = ?", sessionID, models.SessionStatusActive).First(&session).Error; err != nil {
+		return nil, nil
+	}
+	if session.CurrentFlowID == nil {
+		return &session, nil
+	}
+
+	var step models.ChatbotFlowStep
+	if err := a.DB.Where("flow_id = ? AND step_name = ?", *session.CurrentFlowID, session.CurrentStep).First(&step).Error; err != nil {
+		return &session, nil
+	}
+	metaFlowID := getStringFromMap(step.InputConfig, "whatsapp_flow_id")
+	if metaFlowID == "" {
+		return &session, nil
+	}
+
+	var flow models.WhatsAppFlow
+	if err := a.DB.Where("organization_id = ? AND meta_flow_id = ?", session.OrganizationID, metaFlowID).First(&flow).Error; err != nil {
+		return &session, nil
+	}
+	return &session, &flow
+}
+
+// flowScreens returns a flow's screens and its routing model, which maps each
+// screen to the screens it leads to
+func flowScreens(flow *models.WhatsAppFlow) ([]interface{}, map[string]interface{}) {
+	screens, _ := flow.FlowJSON["screens"].([]interface{})
+	if len(screens) == 0 {
+		screens = flow.Screens
+	}
+	routing, _ := flow.FlowJSON["routing_model"].(map[string]interface{})
+	return screens, routing
+}
+
+// firstFlowScreen returns the ID of a flow's first screen
+func firstFlowScreen(screens []interface{}) string {
+	if len(screens) == 0 {
+		return ""
+	}
+	screen, _ := screens[0].(map[string]interface{})
+	id, _ := screen["id"].(string)
+	return id
+}
+
+// nextFlowScreen returns the screen after the current one: the first the routing
+// model leads to, or else the next in order. Empty when the current screen is the last.
+func nextFlowScreen(screens []interface{}, routing map[string]interface{}, current string) string {
+	if routing != nil {
+		if next, ok := routing[current].([]interface{}); ok {
+			if len(next) == 0 {
+				return ""
+			}
+			id, _ := next[0].(string)
+			return id
+		}
+	}
+	for i, screen := range screens {
+		screenMap, _ := screen.(map[string]interface{})
+		if id, _ := screenMap["id"].(string); id == current && i+1 < len(screens) {
+			return firstFlowScreen(screens[i+1:])
+		}
+	}
+	return ""
+}
+
+// RegisterFlowEncryptionKey registers the public key of the configured flow private
+// key for a number, so WhatsApp encrypts its flows' data requests for Whatomate
+func (a *App) RegisterFlowEncryptionKey(r *fastglue.Request) error {
+	account, errMsg, status := a.profileAccount(r, models.ActionWrite)
+	if account == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	key, err := whatsapp.ParseFlowPrivateKey(a.CurrentConfig().WhatsApp.FlowPrivateKey)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Set whatsapp.flow_private_key to use flows with a data endpoint", nil, "")
+	}
+	publicKey, err := whatsapp.FlowPublicKeyPEM(key)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, err.Error(), nil, "")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := a.WhatsApp.SetBusinessPublicKey(ctx, a.toWhatsAppAccount(account), publicKey); err != nil {
+		a.Log.Error("Failed to register flow encryption key", "error", err, "account", account.Name)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, err.Error(), nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message":    "Flow encryption key registered",
+		"public_key": publicKey,
+	})
+}
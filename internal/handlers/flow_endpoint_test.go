@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextFlowScreen(t *testing.T) {
+	screens := []interface{}{
+		map[string]interface{}{"id": "WELCOME"},
+		map[string]interface{}{"id": "DETAILS"},
+		map[string]interface{}{"id": "CONFIRM"},
+	}
+	assert.Equal(t, "WELCOME", firstFlowScreen(screens))
+	assert.Empty(t, firstFlowScreen(nil))
+
+	// Without a routing model, screens follow each other in order
+	assert.Equal(t, "DETAILS", nextFlowScreen(screens, nil, "WELCOME"))
+	assert.Equal(t, "CONFIRM", nextFlowScreen(screens, nil, "DETAILS"))
+	assert.Empty(t, nextFlowScreen(screens, nil, "CONFIRM"))
+
+	// The routing model decides when it covers the screen
+	routing := map[string]interface{}{
+		"WELCOME": []interface{}{"CONFIRM"},
+		"CONFIRM": []interface{}{},
+	}
+	assert.Equal(t, "CONFIRM", nextFlowScreen(screens, routing, "WELCOME"))
+	assert.Empty(t, nextFlowScreen(screens, routing, "CONFIRM"))
+	assert.Equal(t, "CONFIRM", nextFlowScreen(screens, routing, "DETAILS"))
+}
+
+func TestValidFlowSignature(t *testing.T) {
+	app := &App{Config: &config.Config{}, Log: testutil.NopLogger()}
+	body := []byte(`{"encrypted_flow_data":"abc"}`)
+
+	// Not checked without an app secret
+	assert.True(t, app.validFlowSignature(body, ""))
+
+	app.Config.WhatsApp.AppSecret = "secret"
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	assert.True(t, app.validFlowSignature(body, "sha256="+hex.EncodeToString(mac.Sum(nil))))
+	assert.False(t, app.validFlowSignature(body, "sha256=deadbeef"))
+	assert.False(t, app.validFlowSignature(body, ""))
+}
+
+func TestFlowDataResponse(t *testing.T) {
+	app := &App{Config: &config.Config{}, Log: testutil.NopLogger()}
+
+	response := app.flowDataResponse(&whatsapp.FlowDataRequest{Action: whatsapp.FlowActionPing})
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"status": "active"}}, response)
+
+	response = app.flowDataResponse(&whatsapp.FlowDataRequest{
+		Action: whatsapp.FlowActionDataExchange,
+		Screen: "DETAILS",
+		Data:   map[string]interface{}{"error": "invalid screen"},
+	})
+	assert.Equal(t, map[string]interface{}{"data": map[string]interface{}{"acknowledged": true}}, response)
+
+	// A flow that wasn't sent by a chatbot step completes on its first exchange
+	response = app.flowDataResponse(&whatsapp.FlowDataRequest{
+		Action:    whatsapp.FlowActionDataExchange,
+		Screen:    "DETAILS",
+		Data:      map[string]interface{}{"email": "jane@example.com"},
+		FlowToken: "campaign_123",
+	})
+	assert.Equal(t, flowSuccessScreen, response["screen"])
+	assert.Equal(t, map[string]interface{}{
+		"extension_message_response": map[string]interface{}{
+			"params": map[string]interface{}{"flow_token": "campaign_123", "email": "jane@example.com"},
+		},
+	}, response["data"])
+}
@@ -274,7 +274,7 @@ func (a *App) SaveFlowToMeta(r *fastglue.Request) error {
 	}
 
 	// Create WhatsApp API client
-	waClient := whatsapp.New(a.Log)
+	waClient := a.WhatsApp
 	waAccount := a.toWhatsAppAccount(&account)
 
 	a.Log.Info("SaveFlowToMeta: Account details",
@@ -306,20 +306,11 @@ func (a *App) SaveFlowToMeta(r *fastglue.Request) error {
 	}
 
 	// Step 2: Upload flow JSON if we have screens
-	if len(flow.Screens) > 0 {
-		// Validate flow structure before sending to Meta
-		if err := validateFlowStructure([]interface{}(flow.Screens)); err != nil {
-			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
-		}
-
-		// Sanitize screens before sending to Meta
-		sanitizedScreens := sanitizeScreensForMeta([]interface{}(flow.Screens))
-
-		flowJSON := &whatsapp.FlowJSON{
-			Version: flow.JSONVersion,
-			Screens: sanitizedScreens,
-		}
-
+	flowJSON, err := flowJSONForMeta(&flow)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	if flowJSON != nil {
 		if err := waClient.UpdateFlowJSON(ctx, waAccount, metaFlowID, flowJSON); err != nil {
 			a.Log.Error("Failed to update flow JSON in Meta", "error", err, "flow_id", id, "meta_flow_id", metaFlowID)
 			// Save the meta flow ID even if JSON update fails
@@ -328,6 +319,16 @@ func (a *App) SaveFlowToMeta(r *fastglue.Request) error {
 			})
 			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update flow JSON: "+err.Error(), nil, "")
 		}
+
+		// Flows with a data endpoint exchange data with Whatomate
+		if flowJSON.DataAPIVersion != "" {
+			if err := waClient.SetFlowEndpoint(ctx, waAccount, metaFlowID, a.publicBaseURL(r)+"/api/webhook/flows"); err != nil {
+				a.DB.Model(&flow).Updates(map[string]interface{}{
+					"meta_flow_id": metaFlowID,
+				})
+				return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to set flow endpoint: "+err.Error(), nil, "")
+			}
+		}
 	}
 
 	// Update local database with meta flow ID and set status to DRAFT
@@ -387,7 +388,7 @@ func (a *App) PublishFlow(r *fastglue.Request) error {
 	}
 
 	// Create WhatsApp API client
-	waClient := whatsapp.New(a.Log)
+	waClient := a.WhatsApp
 	waAccount := a.toWhatsAppAccount(&account)
 
 	ctx := context.Background()
@@ -456,7 +457,7 @@ func (a *App) DeprecateFlow(r *fastglue.Request) error {
 			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "WhatsApp account not found", nil, "")
 		}
 
-		waClient := whatsapp.New(a.Log)
+		waClient := a.WhatsApp
 		waAccount := a.toWhatsAppAccount(&account)
 
 		ctx := context.Background()
@@ -555,7 +556,7 @@ func (a *App) SyncFlows(r *fastglue.Request) error {
 	}
 
 	// Create WhatsApp API client
-	waClient := whatsapp.New(a.Log)
+	waClient := a.WhatsApp
 	waAccount := a.toWhatsAppAccount(&account)
 
 	ctx := context.Background()
@@ -654,6 +655,41 @@ func (a *App) SyncFlows(r *fastglue.Request) error {
 	})
 }
 
+// flowJSONForMeta returns the flow JSON to upload to Meta, nil when the flow has no
+// screens. Flows with a data endpoint are uploaded as written, with their data API
+// version and routing model; flows from the builder are validated and sanitized.
+func flowJSONForMeta(flow *models.WhatsAppFlow) (*whatsapp.FlowJSON, error) {
+	if dataAPIVersion, _ := flow.FlowJSON["data_api_version"].(string); dataAPIVersion != "" {
+		raw, err := json.Marshal(flow.FlowJSON)
+		if err != nil {
+			return nil, fmt.Errorf("invalid flow JSON: %w", err)
+		}
+		var flowJSON whatsapp.FlowJSON
+		if err := json.Unmarshal(raw, &flowJSON); err != nil {
+			return nil, fmt.Errorf("invalid flow JSON: %w", err)
+		}
+		if len(flowJSON.Screens) == 0 {
+			return nil, fmt.Errorf("flow must have at least one screen")
+		}
+		if flowJSON.Version == "" {
+			flowJSON.Version = flow.JSONVersion
+		}
+		return &flowJSON, nil
+	}
+
+	if len(flow.Screens) == 0 {
+		return nil, nil
+	}
+	// Validate flow structure before sending to Meta
+	if err := validateFlowStructure([]interface{}(flow.Screens)); err != nil {
+		return nil, err
+	}
+	return &whatsapp.FlowJSON{
+		Version: flow.JSONVersion,
+		Screens: sanitizeScreensForMeta([]interface{}(flow.Screens)),
+	}, nil
+}
+
 // validateFlowStructure validates the flow structure before sending to Meta
 // - Ensures at least one screen has a Footer with "complete" action
 // - If multiple screens, only the last screen should have "complete" action
@@ -0,0 +1,502 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// FollowUpRequest sets a follow-up on a conversation. Either due_at or
+// delay_minutes must be given.
+type FollowUpRequest struct {
+	DueAt          *time.Time            `json:"due_at"`
+	DelayMinutes   int                   `json:"delay_minutes"`
+	Action         models.FollowUpAction `json:"action"`
+	TemplateID     string                `json:"template_id"`
+	TemplateParams map[string]string     `json:"template_params"`
+	Note           string                `json:"note"`
+}
+
+// FollowUpResponse represents a follow-up in API responses
+type FollowUpResponse struct {
+	ID              uuid.UUID             `json:"id"`
+	ContactID       uuid.UUID             `json:"contact_id"`
+	WhatsAppAccount string                `json:"whatsapp_account"`
+	DueAt           time.Time             `json:"due_at"`
+	Action          models.FollowUpAction `json:"action"`
+	TemplateID      *uuid.UUID            `json:"template_id,omitempty"`
+	TemplateName    string                `json:"template_name,omitempty"`
+	TemplateParams  models.JSONB          `json:"template_params,omitempty"`
+	Note            string                `json:"note"`
+	Source          models.FollowUpSource `json:"source"`
+	Status          models.FollowUpStatus `json:"status"`
+	AssignedUserID  *uuid.UUID            `json:"assigned_user_id,omitempty"`
+	CreatedByID     *uuid.UUID            `json:"created_by_id,omitempty"`
+	TriggeredAt     *time.Time            `json:"triggered_at,omitempty"`
+	ResolvedAt      *time.Time            `json:"resolved_at,omitempty"`
+	MessageID       *uuid.UUID            `json:"message_id,omitempty"`
+	ErrorMessage    string                `json:"error_message,omitempty"`
+	CreatedAt       time.Time             `json:"created_at"`
+}
+
+// CreateFollowUp sets a follow-up on a conversation that fires if the customer has not replied by then
+func (a *App) CreateFollowUp(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	contactID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact ID", nil, "")
+	}
+
+	var req FollowUpRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	// Users without full read permission can only set follow-ups on their assigned contacts
+	var contact models.Contact
+	query := a.DB.Where("id = ? AND organization_id = ?", contactID, orgID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("assigned_user_id = ?", userID)
+	}
+	if err := query.First(&contact).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
+	}
+
+	followUp, err := a.buildFollowUp(&contact, req, time.Now())
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	followUp.Source = models.FollowUpSourceAgent
+	followUp.CreatedByID = &userID
+	followUp.AssignedUserID = &userID
+
+	if err := a.DB.Create(followUp).Error; err != nil {
+		a.Log.Error("Failed to create follow-up", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create follow-up", nil, "")
+	}
+
+	a.Log.Info("Follow-up set", "follow_up_id", followUp.ID, "contact_id", contact.ID, "due_at", followUp.DueAt, "action", followUp.Action)
+
+	return r.SendEnvelope(followUpToResponse(*followUp))
+}
+
+// ListFollowUps returns the follow-ups set on a conversation
+func (a *App) ListFollowUps(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	query := a.DB.Where("organization_id = ? AND contact_id = ?", orgID, contact.ID).
+		Preload("Template")
+	if status := string(r.RequestCtx.QueryArgs().Peek("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var followUps []models.FollowUp
+	if err := query.Order("due_at ASC").Find(&followUps).Error; err != nil {
+		a.Log.Error("Failed to list follow-ups", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list follow-ups", nil, "")
+	}
+
+	result := make([]FollowUpResponse, len(followUps))
+	for i, fu := range followUps {
+		result[i] = followUpToResponse(fu)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"follow_ups": result,
+	})
+}
+
+// CancelFollowUp cancels a follow-up that has not fired yet
+func (a *App) CancelFollowUp(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid follow-up ID", nil, "")
+	}
+
+	var followUp models.FollowUp
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&followUp).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Follow-up not found", nil, "")
+	}
+
+	// Users without full read permission can only cancel follow-ups on their assigned contacts
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		var count int64
+		a.DB.Model(&models.Contact{}).
+			Where("id = ? AND organization_id = ? AND assigned_user_id = ?", followUp.ContactID, orgID, userID).
+			Count(&count)
+		if count == 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Follow-up not found", nil, "")
+		}
+	}
+
+	// Only cancel if it has not fired or been resolved in the meantime
+	result := a.DB.Model(&followUp).
+		Where("status = ?", models.FollowUpStatusPending).
+		Update("status", models.FollowUpStatusCancelled)
+	if result.Error != nil {
+		a.Log.Error("Failed to cancel follow-up", "error", result.Error)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to cancel follow-up", nil, "")
+	}
+	if result.RowsAffected == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Follow-up is no longer pending", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Follow-up cancelled",
+		"status":  models.FollowUpStatusCancelled,
+	})
+}
+
+// buildFollowUp validates a follow-up request for a contact and returns the follow-up to create
+func (a *App) buildFollowUp(contact *models.Contact, req FollowUpRequest, now time.Time) (*models.FollowUp, error) {
+	var dueAt time.Time
+	switch {
+	case req.DueAt != nil:
+		dueAt = *req.DueAt
+	case req.DelayMinutes > 0:
+		dueAt = now.Add(time.Duration(req.DelayMinutes) * time.Minute)
+	default:
+		return nil, errors.New("due_at or delay_minutes is required")
+	}
+	if !dueAt.After(now) {
+		return nil, errors.New("due_at must be in the future")
+	}
+
+	followUp := &models.FollowUp{
+		OrganizationID:  contact.OrganizationID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: contact.WhatsAppAccount,
+		DueAt:           dueAt,
+		Action:          req.Action,
+		Note:            strings.TrimSpace(req.Note),
+		Status:          models.FollowUpStatusPending,
+	}
+	if followUp.Action == "" {
+		followUp.Action = models.FollowUpActionReopen
+	}
+
+	switch followUp.Action {
+	case models.FollowUpActionReopen:
+	case models.FollowUpActionTemplate:
+		if req.TemplateID == "" {
+			return nil, errors.New("template_id is required for the template action")
+		}
+		templateID, err := uuid.Parse(req.TemplateID)
+		if err != nil {
+			return nil, errors.New("invalid template_id")
+		}
+		var template models.Template
+		if err := a.DB.Where("id = ? AND organization_id = ?", templateID, contact.OrganizationID).First(&template).Error; err != nil {
+			return nil, errors.New("template not found")
+		}
+		if template.Status != string(models.TemplateStatusApproved) {
+			return nil, fmt.Errorf("template is not approved (status: %s)", template.Status)
+		}
+		if missingParams, paramNames := missingTemplateParams(&template, req.TemplateParams); len(missingParams) > 0 {
+			return nil, fmt.Errorf("missing template parameters: %s. Expected parameters: %v", strings.Join(missingParams, ", "), paramNames)
+		}
+		followUp.TemplateID = &template.ID
+		followUp.TemplateParams = stringMapToJSONB(req.TemplateParams)
+		followUp.Template = &template
+	default:
+		return nil, fmt.Errorf("invalid action: %s", followUp.Action)
+	}
+
+	return followUp, nil
+}
+
+// createFlowFollowUp sets a follow-up from a follow_up flow step. The step's input_config
+// holds delay_minutes, action, template_id, template_params and note; string values may use
+// session variables.
+func (a *App) createFlowFollowUp(contact *models.Contact, config models.JSONB, sessionData models.JSONB) {
+	req := FollowUpRequest{}
+	if config != nil {
+		switch v := config["delay_minutes"].(type) {
+		case float64:
+			req.DelayMinutes = int(v)
+		case string:
+			_, _ = fmt.Sscan(v, &req.DelayMinutes)
+		}
+		if action, ok := config["action"].(string); ok {
+			req.Action = models.FollowUpAction(action)
+		}
+		req.TemplateID, _ = config["template_id"].(string)
+		if note, ok := config["note"].(string); ok {
+			req.Note = processTemplate(note, sessionData)
+		}
+		if params, ok := config["template_params"].(map[string]interface{}); ok {
+			req.TemplateParams = make(map[string]string, len(params))
+			for k, v := range params {
+				req.TemplateParams[k] = processTemplate(fmt.Sprint(v), sessionData)
+			}
+		}
+	}
+
+	followUp, err := a.buildFollowUp(contact, req, time.Now())
+	if err != nil {
+		a.Log.Error("Invalid follow-up step configuration", "error", err, "contact_id", contact.ID)
+		return
+	}
+	followUp.Source = models.FollowUpSourceFlow
+
+	if err := a.DB.Create(followUp).Error; err != nil {
+		a.Log.Error("Failed to create follow-up from flow", "error", err, "contact_id", contact.ID)
+		return
+	}
+
+	a.Log.Info("Follow-up set by flow", "follow_up_id", followUp.ID, "contact_id", contact.ID, "due_at", followUp.DueAt)
+}
+
+// resolveFollowUps resolves the pending follow-ups of a contact once they reply
+func (a *App) resolveFollowUps(contactID uuid.UUID) {
+	result := a.DB.Model(&models.FollowUp{}).
+		Where("contact_id = ? AND status = ?", contactID, models.FollowUpStatusPending).
+		Updates(map[string]interface{}{
+			"status":      models.FollowUpStatusResolved,
+			"resolved_at": time.Now(),
+		})
+	if result.Error != nil {
+		a.Log.Error("Failed to resolve follow-ups", "error", result.Error, "contact_id", contactID)
+		return
+	}
+	if result.RowsAffected > 0 {
+		a.Log.Info("Follow-ups resolved by customer reply", "contact_id", contactID, "count", result.RowsAffected)
+	}
+}
+
+// FollowUpProcessor fires follow-ups whose due time has passed without a customer reply
+type FollowUpProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewFollowUpProcessor creates a new follow-up processor
+func NewFollowUpProcessor(app *App, interval time.Duration) *FollowUpProcessor {
+	return &FollowUpProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the follow-up processing loop
+func (p *FollowUpProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Follow-up processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Follow-up processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Follow-up processor stopped")
+			return
+		case <-ticker.C:
+			p.processDueFollowUps(ctx)
+		}
+	}
+}
+
+// Stop stops the follow-up processor
+func (p *FollowUpProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// processDueFollowUps fires pending follow-ups whose due time has passed
+func (p *FollowUpProcessor) processDueFollowUps(ctx context.Context) {
+	var due []models.FollowUp
+	if err := p.app.DB.Where("status = ? AND due_at <= ?", models.FollowUpStatusPending, time.Now()).
+		Order("due_at ASC").
+		Limit(100).
+		Find(&due).Error; err != nil {
+		p.app.Log.Error("Failed to find due follow-ups", "error", err)
+		return
+	}
+
+	for i := range due {
+		fu := &due[i]
+
+		// Claim the follow-up so a reply or a concurrent processor can't race it
+		now := time.Now()
+		result := p.app.DB.Model(fu).
+			Where("status = ?", models.FollowUpStatusPending).
+			Updates(map[string]interface{}{
+				"status":       models.FollowUpStatusTriggered,
+				"triggered_at": now,
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		p.app.triggerFollowUp(ctx, fu)
+	}
+}
+
+// triggerFollowUp runs the action of a claimed follow-up
+func (a *App) triggerFollowUp(ctx context.Context, fu *models.FollowUp) {
+	var contact models.Contact
+	if err := a.DB.Where("id = ? AND organization_id = ?", fu.ContactID, fu.OrganizationID).First(&contact).Error; err != nil {
+		a.failFollowUp(fu, fmt.Errorf("contact not found"))
+		return
+	}
+
+	account, err := a.resolveWhatsAppAccount(fu.OrganizationID, fu.WhatsAppAccount)
+	if err != nil {
+		a.failFollowUp(fu, err)
+		return
+	}
+
+	switch fu.Action {
+	case models.FollowUpActionTemplate:
+		a.sendFollowUpNudge(ctx, fu, account, &contact)
+	default:
+		a.reopenFollowUpConversation(fu, account, &contact)
+	}
+}
+
+// sendFollowUpNudge sends the nudge template of a follow-up
+func (a *App) sendFollowUpNudge(ctx context.Context, fu *models.FollowUp, account *models.WhatsAppAccount, contact *models.Contact) {
+	if fu.TemplateID == nil {
+		a.failFollowUp(fu, fmt.Errorf("nudge template is not set"))
+		return
+	}
+	var template models.Template
+	if err := a.DB.Where("id = ? AND organization_id = ?", *fu.TemplateID, fu.OrganizationID).First(&template).Error; err != nil {
+		a.failFollowUp(fu, fmt.Errorf("nudge template not found"))
+		return
+	}
+	if template.Status != string(models.TemplateStatusApproved) {
+		a.failFollowUp(fu, fmt.Errorf("nudge template is not approved (status: %s)", template.Status))
+		return
+	}
+
+	opts := DefaultSendOptions()
+	opts.SentByUserID = fu.CreatedByID
+	opts.Async = false
+
+	message, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account:    account,
+		Contact:    contact,
+		Type:       models.MessageTypeTemplate,
+		Template:   &template,
+		BodyParams: jsonbToStringMap(fu.TemplateParams),
+	}, opts)
+	if err != nil {
+		a.failFollowUp(fu, err)
+		return
+	}
+
+	updates := map[string]interface{}{"message_id": message.ID}
+	var sent models.Message
+	if err := a.DB.Select("status", "error_message").Where("id = ?", message.ID).First(&sent).Error; err == nil &&
+		sent.Status == models.MessageStatusFailed {
+		updates["status"] = models.FollowUpStatusFailed
+		updates["error_message"] = sent.ErrorMessage
+	}
+	a.DB.Model(fu).Updates(updates)
+
+	a.log(ctx).Info("Follow-up nudge sent", "follow_up_id", fu.ID, "contact_id", contact.ID, "message_id", message.ID)
+}
+
+// reopenFollowUpConversation marks the conversation unread and notifies the agent.
+// Conversations without an agent are put back in the transfer queue.
+func (a *App) reopenFollowUpConversation(fu *models.FollowUp, account *models.WhatsAppAccount, contact *models.Contact) {
+	a.DB.Model(contact).Update("is_read", false)
+
+	agentID := fu.AssignedUserID
+	if agentID == nil {
+		agentID = contact.AssignedUserID
+	}
+	if agentID == nil {
+		source := models.TransferSourceManual
+		if fu.Source == models.FollowUpSourceFlow {
+			source = models.TransferSourceFlow
+		}
+		a.createTransferToQueue(account, contact, source)
+		a.Log.Info("Follow-up reopened conversation in queue", "follow_up_id", fu.ID, "contact_id", contact.ID)
+		return
+	}
+
+	if a.WSHub != nil {
+		a.WSHub.BroadcastToUser(fu.OrganizationID, *agentID, websocket.WSMessage{
+			Type: websocket.TypeFollowUpDue,
+			Payload: map[string]any{
+				"id":           fu.ID.String(),
+				"contact_id":   contact.ID.String(),
+				"contact_name": contact.ProfileName,
+				"phone_number": contact.PhoneNumber,
+				"note":         fu.Note,
+				"due_at":       fu.DueAt,
+			},
+		})
+	}
+
+	a.Log.Info("Follow-up reopened conversation", "follow_up_id", fu.ID, "contact_id", contact.ID, "agent_id", *agentID)
+}
+
+// failFollowUp marks a follow-up as failed
+func (a *App) failFollowUp(fu *models.FollowUp, err error) {
+	a.Log.Error("Failed to trigger follow-up", "error", err, "follow_up_id", fu.ID)
+	a.DB.Model(fu).Updates(map[string]interface{}{
+		"status":        models.FollowUpStatusFailed,
+		"error_message": err.Error(),
+	})
+}
+
+func followUpToResponse(fu models.FollowUp) FollowUpResponse {
+	resp := FollowUpResponse{
+		ID:              fu.ID,
+		ContactID:       fu.ContactID,
+		WhatsAppAccount: fu.WhatsAppAccount,
+		DueAt:           fu.DueAt,
+		Action:          fu.Action,
+		TemplateID:      fu.TemplateID,
+		TemplateParams:  fu.TemplateParams,
+		Note:            fu.Note,
+		Source:          fu.Source,
+		Status:          fu.Status,
+		AssignedUserID:  fu.AssignedUserID,
+		CreatedByID:     fu.CreatedByID,
+		TriggeredAt:     fu.TriggeredAt,
+		ResolvedAt:      fu.ResolvedAt,
+		MessageID:       fu.MessageID,
+		ErrorMessage:    fu.ErrorMessage,
+		CreatedAt:       fu.CreatedAt,
+	}
+	if fu.Template != nil {
+		resp.TemplateName = fu.Template.Name
+	}
+	return resp
+}
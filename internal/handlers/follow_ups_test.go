@@ -0,0 +1,149 @@
+package handlers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_CreateFollowUp_Reopen(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"delay_minutes": 2 * 24 * 60,
+		"note":          "Check if the quote was accepted",
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.CreateFollowUp(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp handlers.FollowUpResponse
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	assert.Equal(t, models.FollowUpStatusPending, resp.Status)
+	assert.Equal(t, models.FollowUpActionReopen, resp.Action)
+	assert.Equal(t, models.FollowUpSourceAgent, resp.Source)
+	require.NotNil(t, resp.AssignedUserID)
+	assert.Equal(t, user.ID, *resp.AssignedUserID)
+	assert.WithinDuration(t, time.Now().Add(48*time.Hour), resp.DueAt, time.Minute)
+}
+
+func TestApp_CreateFollowUp_RequiresDueTime(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	req := testutil.NewJSONRequest(t, map[string]any{"action": "reopen"})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.CreateFollowUp(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "due_at or delay_minutes is required")
+}
+
+func TestApp_CreateFollowUp_TemplateMissingParams(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"delay_minutes": 60,
+		"action":        "template",
+		"template_id":   template.ID.String(),
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.CreateFollowUp(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "missing template parameters")
+}
+
+func TestApp_CancelFollowUp(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	followUp := &models.FollowUp{
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		DueAt:           time.Now().Add(time.Hour),
+		Action:          models.FollowUpActionReopen,
+		Source:          models.FollowUpSourceAgent,
+		Status:          models.FollowUpStatusPending,
+		CreatedByID:     &user.ID,
+		AssignedUserID:  &user.ID,
+	}
+	require.NoError(t, app.DB.Create(followUp).Error)
+
+	req := testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", followUp.ID.String())
+
+	require.NoError(t, app.CancelFollowUp(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var updated models.FollowUp
+	require.NoError(t, app.DB.First(&updated, followUp.ID).Error)
+	assert.Equal(t, models.FollowUpStatusCancelled, updated.Status)
+
+	// Cancelling again fails since it's no longer pending
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", followUp.ID.String())
+
+	require.NoError(t, app.CancelFollowUp(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "no longer pending")
+}
+
+func TestApp_FollowUps_UnassignedContact(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	// Without contacts:read, other users can only see their assigned contacts
+	other := createTestUser(t, app, org.ID, uniqueEmail("follow-up-other"), "password", nil, true)
+
+	followUp := &models.FollowUp{
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		DueAt:           time.Now().Add(time.Hour),
+		Action:          models.FollowUpActionReopen,
+		Source:          models.FollowUpSourceAgent,
+		Status:          models.FollowUpStatusPending,
+		CreatedByID:     &user.ID,
+		AssignedUserID:  &user.ID,
+	}
+	require.NoError(t, app.DB.Create(followUp).Error)
+
+	req := testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, other.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	require.NoError(t, app.ListFollowUps(req))
+	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
+
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, other.ID)
+	testutil.SetPathParam(req, "id", followUp.ID.String())
+	require.NoError(t, app.CancelFollowUp(req))
+	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
+
+	var unchanged models.FollowUp
+	require.NoError(t, app.DB.First(&unchanged, followUp.ID).Error)
+	assert.Equal(t, models.FollowUpStatusPending, unchanged.Status)
+}
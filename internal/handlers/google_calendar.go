@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/gcalendar"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+const (
+	// calendarSlotsKey is the session variable holding the slots a calendar step offered,
+	// which the customer's reply is checked against
+	calendarSlotsKey = "_calendar_slots"
+	// calendarSlotLayout is how slots are shown to customers, within a list row title
+	calendarSlotLayout = "Mon, Jan 2 3:04 PM"
+	// maxCalendarDaysAhead limits how far ahead a calendar step looks for free slots
+	maxCalendarDaysAhead = 60
+)
+
+var (
+	// errCalendarNotConnected is returned when the organization hasn't connected a
+	// Google Calendar
+	errCalendarNotConnected = errors.New("google calendar is not connected")
+	// errCalendarSlotTaken is returned when a slot was booked on the calendar after it
+	// was offered
+	errCalendarSlotTaken = errors.New("the slot is no longer available")
+)
+
+// GoogleCalendarSettings connect the Google Calendar free slots are read from and
+// appointments are booked on
+type GoogleCalendarSettings struct {
+	CalendarID          string
+	ServiceAccountKey   string // JSON key of a service account the calendar is shared with, may reference a secret
+	ServiceAccountEmail string
+}
+
+// GoogleCalendarSettingsRequest updates Google Calendar settings. Omitted fields keep
+// their current value.
+type GoogleCalendarSettingsRequest struct {
+	CalendarID        *string `json:"calendar_id"`
+	ServiceAccountKey *string `json:"service_account_key"`
+}
+
+// googleCalendarSettings reads the Google Calendar settings from organization settings
+func googleCalendarSettings(settings models.JSONB) GoogleCalendarSettings {
+	var s GoogleCalendarSettings
+	raw, ok := settings["google_calendar"].(map[string]interface{})
+	if !ok {
+		return s
+	}
+	s.CalendarID, _ = raw["calendar_id"].(string)
+	s.ServiceAccountKey = models.SettingSecret(raw, "service_account_key")
+	s.ServiceAccountEmail, _ = raw["service_account_email"].(string)
+	return s
+}
+
+// googleCalendarSettingsResponse is the settings as returned by the API. The service
+// account key is never returned, only whether it's set and its email.
+func googleCalendarSettingsResponse(s GoogleCalendarSettings) map[string]interface{} {
+	return map[string]interface{}{
+		"calendar_id":             s.CalendarID,
+		"service_account_key_set": s.ServiceAccountKey != "",
+		"service_account_email":   s.ServiceAccountEmail,
+		"connected":               s.CalendarID != "" && s.ServiceAccountKey != "",
+	}
+}
+
+// GetGoogleCalendarSettings returns the organization's Google Calendar settings
+func (a *App) GetGoogleCalendarSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	return r.SendEnvelope(googleCalendarSettingsResponse(googleCalendarSettings(org.Settings)))
+}
+
+// UpdateGoogleCalendarSettings connects or disconnects the organization's Google
+// Calendar. A calendar is only saved once it can be read with the key.
+func (a *App) UpdateGoogleCalendarSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req GoogleCalendarSettingsRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	before := orgSettingsAuditSnapshot(&org)
+	s := googleCalendarSettings(org.Settings)
+
+	if req.CalendarID != nil {
+		s.CalendarID = strings.TrimSpace(*req.CalendarID)
+	}
+	if req.ServiceAccountKey != nil {
+		s.ServiceAccountKey = strings.TrimSpace(*req.ServiceAccountKey)
+	}
+	s.ServiceAccountEmail = ""
+	if (s.CalendarID == "") != (s.ServiceAccountKey == "") {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "calendar_id and service_account_key are both required", nil, "")
+	}
+	if s.CalendarID != "" {
+		key, err := a.resolveCredential(r.RequestCtx, orgID, s.ServiceAccountKey)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "service_account_key: "+err.Error(), nil, "")
+		}
+		if s.ServiceAccountEmail, err = gcalendar.ServiceAccountEmail([]byte(key)); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		now := time.Now()
+		if _, err := a.calendarClient().FreeBusy(r.RequestCtx, []byte(key), s.CalendarID, now, now.Add(time.Hour)); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Can't read the calendar, check it's shared with %s: %s", s.ServiceAccountEmail, err), nil, "")
+		}
+	}
+
+	if org.Settings == nil {
+		org.Settings = models.JSONB{}
+	}
+	section := map[string]interface{}{
+		"calendar_id":           s.CalendarID,
+		"service_account_key":   s.ServiceAccountKey,
+		"service_account_email": s.ServiceAccountEmail,
+	}
+	if err := models.EncryptSettingSecrets("google_calendar", section); err != nil {
+		a.Log.Error("Failed to encrypt Google Calendar credentials", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	org.Settings["google_calendar"] = section
+	if err := a.DB.Save(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	a.recordOrgSettingsAudit(r, &org, before)
+
+	return r.SendEnvelope(googleCalendarSettingsResponse(s))
+}
+
+// calendarClient returns the client for calls to Google Calendar
+func (a *App) calendarClient() *gcalendar.Client {
+	if a.Calendar != nil {
+		return a.Calendar
+	}
+	client := gcalendar.New(a.Log)
+	client.HTTPClient = a.httpClient(config.OutboundCalendar, gcalendar.DefaultTimeout)
+	return client
+}
+
+// calendarCredentials returns the connected calendar of an organization and the key
+// it's accessed with
+func (a *App) calendarCredentials(ctx context.Context, orgID uuid.UUID) (string, []byte, error) {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return "", nil, err
+	}
+	s := googleCalendarSettings(org.Settings)
+	if s.CalendarID == "" || s.ServiceAccountKey == "" {
+		return "", nil, errCalendarNotConnected
+	}
+	key, err := a.resolveCredential(ctx, orgID, s.ServiceAccountKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return s.CalendarID, []byte(key), nil
+}
+
+// calendarSlotOptions are the working hours a calendar step offers slots in
+type calendarSlotOptions struct {
+	Duration  time.Duration
+	DaysAhead int
+	DayStart  time.Duration // Since midnight
+	DayEnd    time.Duration
+	Weekdays  map[time.Weekday]bool
+	MinNotice time.Duration
+	MaxSlots  int
+}
+
+// calendarSlotOptionsFromConfig reads the slot options of a calendar step's
+// input_config: duration_minutes, days_ahead, day_start, day_end (HH:MM), weekdays
+// (0 is Sunday), min_notice_minutes and max_slots
+func calendarSlotOptionsFromConfig(cfg models.JSONB) (calendarSlotOptions, error) {
+	opts := calendarSlotOptions{
+		Duration:  30 * time.Minute,
+		DaysAhead: 7,
+		DayStart:  9 * time.Hour,
+		DayEnd:    17 * time.Hour,
+		Weekdays:  map[time.Weekday]bool{time.Monday: true, time.Tuesday: true, time.Wednesday: true, time.Thursday: true, time.Friday: true},
+		MinNotice: time.Hour,
+		MaxSlots:  whatsapp.MaxListRows,
+	}
+	if v := jsonbInt64(cfg["duration_minutes"]); v > 0 {
+		opts.Duration = time.Duration(v) * time.Minute
+	}
+	if v := jsonbInt64(cfg["days_ahead"]); v > 0 {
+		opts.DaysAhead = int(min(v, maxCalendarDaysAhead))
+	}
+	if v := jsonbInt64(cfg["max_slots"]); v > 0 {
+		opts.MaxSlots = int(min(v, whatsapp.MaxListRows))
+	}
+	if _, ok := cfg["min_notice_minutes"]; ok {
+		opts.MinNotice = time.Duration(max(jsonbInt64(cfg["min_notice_minutes"]), 0)) * time.Minute
+	}
+	for key, field := range map[string]*time.Duration{"day_start": &opts.DayStart, "day_end": &opts.DayEnd} {
+		value := getStringFromMap(cfg, key)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse("15:04", value)
+		if err != nil {
+			return opts, fmt.Errorf("%s must be HH:MM", key)
+		}
+		*field = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if opts.DayEnd <= opts.DayStart {
+		return opts, errors.New("day_end must be after day_start")
+	}
+	if days, ok := cfg["weekdays"].([]interface{}); ok && len(days) > 0 {
+		opts.Weekdays = map[time.Weekday]bool{}
+		for _, d := range days {
+			if n, ok := d.(float64); ok && n >= 0 && n <= 6 {
+				opts.Weekdays[time.Weekday(n)] = true
+			}
+		}
+	}
+	return opts, nil
+}
+
+// freeCalendarSlots returns the starts of the slots in the working hours of opts,
+// in loc, that don't overlap a busy period
+func freeCalendarSlots(busy []gcalendar.Period, opts calendarSlotOptions, now time.Time, loc *time.Location) []time.Time {
+	earliest := now.Add(opts.MinNotice)
+	today := now.In(loc)
+	var slots []time.Time
+	for day := 0; day <= opts.DaysAhead && len(slots) < opts.MaxSlots; day++ {
+		midnight := time.Date(today.Year(), today.Month(), today.Day()+day, 0, 0, 0, 0, loc)
+		if !opts.Weekdays[midnight.Weekday()] {
+			continue
+		}
+		end := midnight.Add(opts.DayEnd)
+		for start := midnight.Add(opts.DayStart); !start.Add(opts.Duration).After(end) && len(slots) < opts.MaxSlots; start = start.Add(opts.Duration) {
+			if start.Before(earliest) || overlapsBusy(busy, start, start.Add(opts.Duration)) {
+				continue
+			}
+			slots = append(slots, start)
+		}
+	}
+	return slots
+}
+
+// overlapsBusy reports whether start to end overlaps any busy period
+func overlapsBusy(busy []gcalendar.Period, start, end time.Time) bool {
+	for _, p := range busy {
+		if start.Before(p.End) && p.Start.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendCalendarSlots sends the free slots of the organization's calendar as a list
+// the customer picks from, or the unavailable message when there are none. Each
+// row's ID is the slot's start time, stored in the step's store_as variable for an
+// appointment step to book. It returns the message sent.
+func (a *App) sendCalendarSlots(ctx context.Context, account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, step *models.ChatbotFlowStep, stepMessage string) string {
+	cfg := step.InputConfig
+	var slots []time.Time
+	opts, err := calendarSlotOptionsFromConfig(cfg)
+	if err == nil {
+		var calendarID string
+		var key []byte
+		if calendarID, key, err = a.calendarCredentials(ctx, contact.OrganizationID); err == nil {
+			now := time.Now()
+			var busy []gcalendar.Period
+			busy, err = a.calendarClient().FreeBusy(ctx, key, calendarID, now, now.AddDate(0, 0, opts.DaysAhead+1))
+			if err == nil {
+				// Working hours are the business's, slots are shown in the customer's time
+				loc := a.getOrgLocation(contact.OrganizationID)
+				if loc == nil {
+					loc = time.UTC
+				}
+				slots = freeCalendarSlots(busy, opts, now, loc)
+			}
+		}
+	}
+	if err != nil {
+		a.log(ctx).Error("Failed to get free calendar slots", "error", err, "step", step.StepName)
+	}
+
+	options := make([]interface{}, 0, len(slots))
+	section := whatsapp.ListSection{Title: "Available times"}
+	contactLoc := a.contactLocation(contact)
+	for _, slot := range slots {
+		slot = slot.In(contactLoc)
+		row := whatsapp.ListRow{ID: slot.Format(time.RFC3339), Title: slot.Format(calendarSlotLayout)}
+		section.Rows = append(section.Rows, row)
+		options = append(options, map[string]interface{}{"id": row.ID, "title": row.Title})
+	}
+	if session.SessionData == nil {
+		session.SessionData = models.JSONB{}
+	}
+	session.SessionData[calendarSlotsKey] = options
+	a.DB.Model(session).Update("session_data", session.SessionData)
+
+	if len(slots) == 0 {
+		message := processTemplate(getStringFromMap(cfg, "unavailable_message"), session.SessionData)
+		if message != "" {
+			if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+				a.log(ctx).Error("Failed to send calendar unavailable message", "error", err, "contact", contact.PhoneNumber)
+			}
+		}
+		return message
+	}
+
+	message := processTemplate(stepMessage, session.SessionData)
+	if message == "" {
+		message = "Pick a time that suits you"
+	}
+	list := listMessageFromConfig(message, cfg)
+	list.Header = processTemplate(list.Header, session.SessionData)
+	list.Footer = processTemplate(list.Footer, session.SessionData)
+	list.Sections = []whatsapp.ListSection{section}
+	if err := a.sendAndSaveListMessage(ctx, account, contact, list); err != nil {
+		a.log(ctx).Error("Failed to send calendar slots", "error", err, "contact", contact.PhoneNumber)
+	}
+	return message
+}
+
+// calendarSlotReplyOptions returns the slots a calendar step offered, as
+// {"id", "title"} options
+func calendarSlotReplyOptions(sessionData models.JSONB) []interface{} {
+	options, _ := sessionData[calendarSlotsKey].([]interface{})
+	return options
+}
+
+// checkCalendarSlot returns errCalendarSlotTaken if an appointment's time is busy on
+// the organization's calendar. Organizations without a calendar have no conflicts.
+func (a *App) checkCalendarSlot(ctx context.Context, appointment *models.Appointment) error {
+	calendarID, key, err := a.calendarCredentials(ctx, appointment.OrganizationID)
+	if errors.Is(err, errCalendarNotConnected) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	end := appointment.StartsAt.Add(time.Duration(appointment.DurationMinutes) * time.Minute)
+	busy, err := a.calendarClient().FreeBusy(ctx, key, calendarID, appointment.StartsAt, end)
+	if err != nil {
+		return err
+	}
+	if overlapsBusy(busy, appointment.StartsAt, end) {
+		return errCalendarSlotTaken
+	}
+	return nil
+}
+
+// queueCalendarSync mirrors an appointment on the organization's calendar in the
+// background
+func (a *App) queueCalendarSync(appointment *models.Appointment) {
+	if a.simulation != nil {
+		return
+	}
+	appt := *appointment
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), gcalendar.DefaultTimeout)
+		defer cancel()
+		if err := a.syncCalendarEvent(ctx, &appt); err != nil && !errors.Is(err, errCalendarNotConnected) {
+			a.Log.Error("Failed to sync appointment to Google Calendar", "error", err, "appointment_id", appt.ID)
+		}
+	}()
+}
+
+// syncCalendarEvent mirrors an appointment on the organization's calendar: an event
+// is created for it, updated when it changes and deleted when it's cancelled
+func (a *App) syncCalendarEvent(ctx context.Context, appointment *models.Appointment) error {
+	calendarID, key, err := a.calendarCredentials(ctx, appointment.OrganizationID)
+	if err != nil {
+		return err
+	}
+	client := a.calendarClient()
+
+	if appointment.Status == models.AppointmentStatusCancelled {
+		if appointment.CalendarEventID == "" {
+			return nil
+		}
+		if err := client.DeleteEvent(ctx, key, calendarID, appointment.CalendarEventID); err != nil {
+			return err
+		}
+		appointment.CalendarEventID = ""
+		return a.DB.Model(appointment).Update("calendar_event_id", "").Error
+	}
+
+	event := gcalendar.Event{
+		ID:      appointment.CalendarEventID,
+		Summary: appointment.Title,
+		Start:   appointment.StartsAt,
+		End:     appointment.StartsAt.Add(time.Duration(appointment.DurationMinutes) * time.Minute),
+	}
+	var contact models.Contact
+	if err := a.DB.Select("id", "profile_name", "phone_number").Where("id = ?", appointment.ContactID).First(&contact).Error; err == nil {
+		event.Description = fmt.Sprintf("%s (+%s)", contact.ProfileName, strings.TrimPrefix(contact.PhoneNumber, "+"))
+	}
+	if appointment.Notes != "" {
+		event.Description = strings.TrimSpace(event.Description + "\n\n" + appointment.Notes)
+	}
+
+	if event.ID != "" {
+		return client.UpdateEvent(ctx, key, calendarID, event)
+	}
+	id, err := client.InsertEvent(ctx, key, calendarID, event)
+	if err != nil {
+		return err
+	}
+	appointment.CalendarEventID = id
+	return a.DB.Model(appointment).Update("calendar_event_id", id).Error
+}
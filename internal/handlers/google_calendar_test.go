@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/gcalendar"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendarSlotOptionsFromConfig(t *testing.T) {
+	opts, err := calendarSlotOptionsFromConfig(models.JSONB{})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, opts.Duration)
+	assert.Equal(t, 9*time.Hour, opts.DayStart)
+	assert.Equal(t, 10, opts.MaxSlots)
+	assert.True(t, opts.Weekdays[time.Monday])
+	assert.False(t, opts.Weekdays[time.Sunday])
+
+	opts, err = calendarSlotOptionsFromConfig(models.JSONB{
+		"duration_minutes":   float64(60),
+		"day_start":          "08:30",
+		"day_end":            "12:00",
+		"weekdays":           []interface{}{float64(6)},
+		"min_notice_minutes": float64(0),
+		"max_slots":          float64(50),
+		"days_ahead":         float64(365),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, opts.Duration)
+	assert.Equal(t, 8*time.Hour+30*time.Minute, opts.DayStart)
+	assert.Equal(t, map[time.Weekday]bool{time.Saturday: true}, opts.Weekdays)
+	assert.Zero(t, opts.MinNotice)
+	assert.Equal(t, 10, opts.MaxSlots)
+	assert.Equal(t, maxCalendarDaysAhead, opts.DaysAhead)
+
+	_, err = calendarSlotOptionsFromConfig(models.JSONB{"day_start": "9am"})
+	assert.EqualError(t, err, "day_start must be HH:MM")
+	_, err = calendarSlotOptionsFromConfig(models.JSONB{"day_start": "17:00", "day_end": "09:00"})
+	assert.EqualError(t, err, "day_end must be after day_start")
+}
+
+func TestFreeCalendarSlots(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*3600)
+	// Friday 10:10 local time
+	now := time.Date(2025, 3, 7, 10, 10, 0, 0, loc)
+	opts := calendarSlotOptions{
+		Duration:  time.Hour,
+		DaysAhead: 3,
+		DayStart:  9 * time.Hour,
+		DayEnd:    13 * time.Hour,
+		Weekdays:  map[time.Weekday]bool{time.Friday: true, time.Monday: true},
+		MinNotice: 30 * time.Minute,
+		MaxSlots:  4,
+	}
+	busy := []gcalendar.Period{
+		{Start: time.Date(2025, 3, 10, 7, 30, 0, 0, time.UTC), End: time.Date(2025, 3, 10, 8, 0, 0, 0, time.UTC)}, // Monday 9:30-10:00 local
+	}
+
+	slots := freeCalendarSlots(busy, opts, now, loc)
+	var got []string
+	for _, s := range slots {
+		got = append(got, s.In(loc).Format("Mon 15:04"))
+	}
+	// Friday's slots before 10:40 are too soon, Monday 9:00 is busy and the weekend is closed
+	assert.Equal(t, []string{"Fri 11:00", "Fri 12:00", "Mon 10:00", "Mon 11:00"}, got)
+}
+
+// testServiceAccountKey returns a service account key whose tokens are issued by tokenURL
+func testServiceAccountKey(t *testing.T, tokenURL string) string {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	key, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "booking@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    tokenURL,
+	})
+	require.NoError(t, err)
+	return string(key)
+}
+
+func TestSyncCalendarEvent(t *testing.T) {
+	var deleted []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token-1","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/freeBusy", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"calendars":{"clinic@example.com":{"busy":[{"start":"2030-01-07T10:00:00Z","end":"2030-01-07T11:00:00Z"}]}}}`))
+	})
+	mux.HandleFunc("/calendars/clinic@example.com/events", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, "Consultation", body["summary"])
+		_, _ = w.Write([]byte(`{"id":"evt1"}`))
+	})
+	mux.HandleFunc("/calendars/clinic@example.com/events/evt1", func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.Method)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	app := &App{
+		Config:   &config.Config{},
+		DB:       testutil.SetupTestDB(t),
+		Log:      testutil.NopLogger(),
+		Calendar: gcalendar.NewWithBaseURL(testutil.NopLogger(), server.URL),
+	}
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Calendar Org " + uuid.New().String()[:8],
+		Slug:      "calendar-org-" + uuid.New().String()[:8],
+		Settings: models.JSONB{
+			"google_calendar": map[string]interface{}{
+				"calendar_id":         "clinic@example.com",
+				"service_account_key": testServiceAccountKey(t, server.URL+"/token"),
+			},
+		},
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1555" + uuid.New().String()[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	appointment := &models.Appointment{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		Title:           "Consultation",
+		StartsAt:        time.Date(2030, 1, 7, 10, 30, 0, 0, time.UTC),
+		DurationMinutes: 30,
+		Status:          models.AppointmentStatusScheduled,
+		Source:          models.AppointmentSourceFlow,
+	}
+	require.NoError(t, app.DB.Create(appointment).Error)
+
+	// 10:30 is inside a busy period, 11:00 is free
+	assert.ErrorIs(t, app.checkCalendarSlot(testutil.TestContext(t), appointment), errCalendarSlotTaken)
+	appointment.StartsAt = time.Date(2030, 1, 7, 11, 0, 0, 0, time.UTC)
+	assert.NoError(t, app.checkCalendarSlot(testutil.TestContext(t), appointment))
+
+	require.NoError(t, app.syncCalendarEvent(testutil.TestContext(t), appointment))
+	var saved models.Appointment
+	require.NoError(t, app.DB.First(&saved, "id = ?", appointment.ID).Error)
+	assert.Equal(t, "evt1", saved.CalendarEventID)
+
+	saved.Status = models.AppointmentStatusCancelled
+	require.NoError(t, app.syncCalendarEvent(testutil.TestContext(t), &saved))
+	assert.Equal(t, []string{http.MethodDelete}, deleted)
+	require.NoError(t, app.DB.First(&saved, "id = ?", appointment.ID).Error)
+	assert.Empty(t, saved.CalendarEventID)
+}
+
+func TestGoogleCalendarSettings_Encrypted(t *testing.T) {
+	testutil.EnableEncryption(t)
+
+	section := map[string]interface{}{"service_account_key": `{"type": "service_account"}`}
+	require.NoError(t, models.EncryptSettingSecrets("google_calendar", section))
+	assert.NotEqual(t, `{"type": "service_account"}`, section["service_account_key"])
+	s := googleCalendarSettings(models.JSONB{"google_calendar": section})
+	assert.Equal(t, `{"type": "service_account"}`, s.ServiceAccountKey)
+}
@@ -0,0 +1,638 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// mentionPattern matches @-mentions in group messages, which WhatsApp writes as the
+// mentioned member's phone number
+var mentionPattern = regexp.MustCompile(`@(\d{6,15})`)
+
+// GroupParticipantsUpdate is a group membership change reported by the webhook
+type GroupParticipantsUpdate struct {
+	GroupID           string `json:"group_id"`
+	AddedParticipants []struct {
+		WaID string `json:"wa_id"`
+	} `json:"added_participants,omitempty"`
+	RemovedParticipants []struct {
+		WaID string `json:"wa_id"`
+	} `json:"removed_participants,omitempty"`
+}
+
+// CreateGroupRequest creates a group owned by one of the organization's numbers.
+// whatsapp_account defaults to the default outgoing account.
+type CreateGroupRequest struct {
+	WhatsAppAccount string `json:"whatsapp_account"`
+	Subject         string `json:"subject"`
+	Description     string `json:"description"`
+}
+
+// UpdateGroupRequest updates a group's settings
+type UpdateGroupRequest struct {
+	ChatbotEnabled *bool `json:"chatbot_enabled"`
+}
+
+// SendGroupMessageRequest sends a text message to a group
+type SendGroupMessageRequest struct {
+	Content struct {
+		Body string `json:"body"`
+	} `json:"content"`
+}
+
+// ListGroups returns the organization's groups, most recently active first
+func (a *App) ListGroups(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChat, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	query := a.DB.Where("organization_id = ?", orgID)
+	if account := string(r.RequestCtx.QueryArgs().Peek("whatsapp_account")); account != "" {
+		query = query.Where("whats_app_account = ?", account)
+	}
+
+	var groups []models.WhatsAppGroup
+	if err := query.Order("last_message_at DESC NULLS LAST, created_at DESC").Find(&groups).Error; err != nil {
+		a.Log.Error("Failed to list groups", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list groups", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"groups": groups,
+	})
+}
+
+// CreateGroup creates a WhatsApp group and fetches its invite link, which is how
+// contacts join
+func (a *App) CreateGroup(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChat, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req CreateGroupRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	req.Subject = strings.TrimSpace(req.Subject)
+	if req.Subject == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Subject is required", nil, "")
+	}
+
+	account, err := a.resolveWhatsAppAccount(orgID, req.WhatsAppAccount)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	waAccount := a.toWhatsAppAccount(account)
+	metaGroupID, err := a.WhatsApp.CreateGroup(ctx, waAccount, req.Subject, req.Description)
+	if err != nil {
+		a.Log.Error("Failed to create group", "error", err, "account", account.Name)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to create group: "+err.Error(), nil, "")
+	}
+
+	inviteLink, err := a.WhatsApp.GetGroupInviteLink(ctx, waAccount, metaGroupID)
+	if err != nil {
+		// The group exists either way; the link can be fetched again later
+		a.Log.Warn("Failed to get group invite link", "error", err, "group_id", metaGroupID)
+	}
+
+	group := models.WhatsAppGroup{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  orgID,
+		WhatsAppAccount: account.Name,
+		MetaGroupID:     metaGroupID,
+		Subject:         req.Subject,
+		Description:     req.Description,
+		InviteLink:      inviteLink,
+	}
+	if err := a.DB.Create(&group).Error; err != nil {
+		a.Log.Error("Failed to save group", "error", err, "group_id", metaGroupID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to save group", nil, "")
+	}
+
+	return r.SendEnvelope(group)
+}
+
+// GetGroup returns a group with its participants, current members first
+func (a *App) GetGroup(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChat, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	group, errMsg, status := a.findGroup(r, orgID)
+	if group == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	if err := a.DB.Where("group_id = ?", group.ID).
+		Order("left_at IS NOT NULL, joined_at").
+		Find(&group.Participants).Error; err != nil {
+		a.Log.Error("Failed to load group participants", "error", err, "group_id", group.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load group", nil, "")
+	}
+
+	return r.SendEnvelope(group)
+}
+
+// UpdateGroup updates a group's settings
+func (a *App) UpdateGroup(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChat, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	group, errMsg, status := a.findGroup(r, orgID)
+	if group == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var req UpdateGroupRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	if req.ChatbotEnabled != nil {
+		group.ChatbotEnabled = *req.ChatbotEnabled
+		if err := a.DB.Model(group).Update("chatbot_enabled", group.ChatbotEnabled).Error; err != nil {
+			a.Log.Error("Failed to update group", "error", err, "group_id", group.ID)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update group", nil, "")
+		}
+	}
+
+	return r.SendEnvelope(group)
+}
+
+// ListGroupMessages returns a page of a group's messages, oldest first
+func (a *App) ListGroupMessages(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChat, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	group, errMsg, status := a.findGroup(r, orgID)
+	if group == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	page, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("page")))
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	var total int64
+	a.DB.Model(&models.GroupMessage{}).Where("group_id = ?", group.ID).Count(&total)
+
+	var messages []models.GroupMessage
+	if err := a.DB.Where("group_id = ?", group.ID).
+		Order("created_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&messages).Error; err != nil {
+		a.Log.Error("Failed to list group messages", "error", err, "group_id", group.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list messages", nil, "")
+	}
+
+	// Pages are taken newest first, but shown oldest first
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"messages": messages,
+		"total":    total,
+		"page":     page,
+		"limit":    limit,
+	})
+}
+
+// SendGroupMessage sends a text message to a group on behalf of an agent
+func (a *App) SendGroupMessage(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChat, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	group, errMsg, status := a.findGroup(r, orgID)
+	if group == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var req SendGroupMessageRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if strings.TrimSpace(req.Content.Body) == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Message body is required", nil, "")
+	}
+
+	account, err := a.resolveWhatsAppAccount(orgID, group.WhatsAppAccount)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	message, err := a.sendGroupTextMessage(account, group, req.Content.Body, &userID)
+	if err != nil {
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return r.SendErrorEnvelope(fasthttp.StatusForbidden, quotaErr.Error(), nil, "")
+		}
+		if errors.Is(err, errTrialExpired) {
+			return r.SendErrorEnvelope(fasthttp.StatusForbidden, err.Error(), nil, "")
+		}
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to send message", nil, "")
+	}
+
+	return r.SendEnvelope(message)
+}
+
+// findGroup returns the organization's group named by the id path parameter, or an
+// error message and status
+func (a *App) findGroup(r *fastglue.Request, orgID uuid.UUID) (*models.WhatsAppGroup, string, int) {
+	groupID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, "Invalid group ID", fasthttp.StatusBadRequest
+	}
+
+	var group models.WhatsAppGroup
+	if err := a.DB.Where("id = ? AND organization_id = ?", groupID, orgID).First(&group).Error; err != nil {
+		return nil, "Group not found", fasthttp.StatusNotFound
+	}
+	return &group, "", fasthttp.StatusOK
+}
+
+// sendGroupTextMessage sends a text message to a group and saves it. sentByUserID is
+// nil for chatbot replies.
+func (a *App) sendGroupTextMessage(account *models.WhatsAppAccount, group *models.WhatsAppGroup, text string, sentByUserID *uuid.UUID) (*models.GroupMessage, error) {
+	if err := a.checkTrialActive(account.OrganizationID); err != nil {
+		return nil, err
+	}
+	if err := a.checkSupportQuota(account.OrganizationID, models.UsageMetricMessages, 1); err != nil {
+		return nil, err
+	}
+
+	message := &models.GroupMessage{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: account.OrganizationID,
+		GroupID:        group.ID,
+		Direction:      models.DirectionOutgoing,
+		MessageType:    models.MessageTypeText,
+		Content:        text,
+		Mentions:       parseMentions(text),
+		Status:         models.MessageStatusPending,
+		SentByUserID:   sentByUserID,
+	}
+	if err := a.DB.Create(message).Error; err != nil {
+		a.Log.Error("Failed to save group message", "error", err, "group_id", group.ID)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	wamid, err := a.WhatsApp.SendGroupTextMessage(ctx, a.toWhatsAppAccount(account), group.MetaGroupID, text)
+	if err != nil {
+		message.Status = models.MessageStatusFailed
+		message.ErrorMessage = err.Error()
+		a.DB.Model(message).Updates(map[string]any{
+			"status":        message.Status,
+			"error_message": message.ErrorMessage,
+		})
+		a.Log.Error("Failed to send group message", "error", err, "group_id", group.ID)
+		return nil, err
+	}
+
+	now := time.Now()
+	message.Status = models.MessageStatusSent
+	message.WhatsAppMessageID = wamid
+	a.DB.Model(message).Updates(map[string]any{
+		"status":               message.Status,
+		"whats_app_message_id": wamid,
+	})
+	a.DB.Model(group).Update("last_message_at", now)
+	a.recordUsage(account.OrganizationID, models.UsageMetricMessages, 1)
+
+	a.broadcastGroupMessage(message)
+	return message, nil
+}
+
+// processGroupMessage stores a message received in a group and tracks its sender as a
+// participant. When the group has the chatbot on and the message mentions the
+// business number, matching keyword rules are answered in the group.
+func (a *App) processGroupMessage(phoneNumberID, displayPhone string, msg interface{}, profileName string) {
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		a.Log.Error("Failed to marshal message", "error", err)
+		return
+	}
+
+	var groupMsg IncomingTextMessage
+	if err := json.Unmarshal(msgBytes, &groupMsg); err != nil {
+		a.Log.Error("Failed to unmarshal message", "error", err)
+		return
+	}
+
+	account, err := a.getWhatsAppAccountCached(phoneNumberID)
+	if err != nil {
+		a.Log.Error("WhatsApp account not found", "phone_id", phoneNumberID, "error", err)
+		return
+	}
+
+	// Meta sometimes sends the same message multiple times
+	var count int64
+	a.DB.Model(&models.GroupMessage{}).Where("whats_app_message_id = ?", groupMsg.ID).Count(&count)
+	if count > 0 || !a.claimInboundMessage(context.Background(), groupMsg.ID) {
+		a.Log.Debug("Duplicate group message detected, skipping", "message_id", groupMsg.ID)
+		return
+	}
+	// A message that isn't stored is released, so a redelivery can store it
+	stored := false
+	defer func() { a.releaseInboundMessage(context.Background(), groupMsg.ID, stored) }()
+
+	group, err := a.getOrCreateGroup(account, groupMsg.GroupID)
+	if err != nil {
+		a.Log.Error("Failed to load group", "error", err, "group_id", groupMsg.GroupID)
+		return
+	}
+
+	now := time.Now()
+	a.trackGroupParticipant(group, groupMsg.From, profileName, now)
+
+	content := groupMessageContent(groupMsg)
+	message := &models.GroupMessage{
+		BaseModel:         models.BaseModel{ID: uuid.New()},
+		OrganizationID:    account.OrganizationID,
+		GroupID:           group.ID,
+		WhatsAppMessageID: groupMsg.ID,
+		Direction:         models.DirectionIncoming,
+		SenderPhone:       groupMsg.From,
+		SenderName:        profileName,
+		MessageType:       models.MessageType(groupMsg.Type),
+		Content:           content,
+		Mentions:          parseMentions(content),
+		Status:            models.MessageStatusReceived,
+	}
+	if err := a.DB.Create(message).Error; err != nil {
+		a.Log.Error("Failed to save group message", "error", err, "group_id", group.ID)
+		return
+	}
+	stored = true
+	a.DB.Model(group).Update("last_message_at", now)
+	a.broadcastGroupMessage(message)
+
+	if !group.ChatbotEnabled || !mentionsPhone(message.Mentions, displayPhone) {
+		return
+	}
+
+	settings, err := a.getChatbotSettingsCached(account.OrganizationID, account.Name)
+	if err != nil || !settings.IsEnabled {
+		return
+	}
+
+	// Only keyword rules answer in groups; flows and AI replies are per contact
+	query := strings.TrimSpace(mentionPattern.ReplaceAllString(content, ""))
+	response, matched := a.matchKeywordRules(account.OrganizationID, account.Name, query)
+	if !matched || response.ResponseType == models.ResponseTypeTransfer || response.Body == "" {
+		return
+	}
+	if _, err := a.sendGroupTextMessage(account, group, response.Body, nil); err != nil {
+		a.Log.Error("Failed to send group chatbot reply", "error", err, "group_id", group.ID)
+	}
+}
+
+// processGroupParticipantsUpdate records members joining and leaving a group
+func (a *App) processGroupParticipantsUpdate(phoneNumberID string, update GroupParticipantsUpdate) {
+	account, err := a.getWhatsAppAccountCached(phoneNumberID)
+	if err != nil {
+		a.Log.Error("WhatsApp account not found", "phone_id", phoneNumberID, "error", err)
+		return
+	}
+
+	group, err := a.getOrCreateGroup(account, update.GroupID)
+	if err != nil {
+		a.Log.Error("Failed to load group", "error", err, "group_id", update.GroupID)
+		return
+	}
+
+	now := time.Now()
+	for _, p := range update.AddedParticipants {
+		a.trackGroupParticipant(group, p.WaID, "", now)
+	}
+	for _, p := range update.RemovedParticipants {
+		if err := a.DB.Model(&models.WhatsAppGroupParticipant{}).
+			Where("group_id = ? AND phone_number = ? AND left_at IS NULL", group.ID, p.WaID).
+			Update("left_at", now).Error; err != nil {
+			a.Log.Error("Failed to record group participant leaving", "error", err, "group_id", group.ID)
+		}
+	}
+}
+
+// getOrCreateGroup returns the account's group with the given Meta ID, creating it
+// for groups the number was added to outside the app
+func (a *App) getOrCreateGroup(account *models.WhatsAppAccount, metaGroupID string) (*models.WhatsAppGroup, error) {
+	var group models.WhatsAppGroup
+	err := a.DB.Where("organization_id = ? AND meta_group_id = ?", account.OrganizationID, metaGroupID).First(&group).Error
+	if err == nil {
+		return &group, nil
+	}
+
+	group = models.WhatsAppGroup{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  account.OrganizationID,
+		WhatsAppAccount: account.Name,
+		MetaGroupID:     metaGroupID,
+	}
+	if err := a.DB.Create(&group).Error; err != nil {
+		// Try to fetch again in case of race condition
+		if err := a.DB.Where("organization_id = ? AND meta_group_id = ?", account.OrganizationID, metaGroupID).First(&group).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &group, nil
+}
+
+// trackGroupParticipant records a group member, linking them to an existing contact
+// with the same number. Members who left and write again are marked as rejoined.
+func (a *App) trackGroupParticipant(group *models.WhatsAppGroup, phoneNumber, profileName string, at time.Time) {
+	if phoneNumber == "" {
+		return
+	}
+
+	var participant models.WhatsAppGroupParticipant
+	if err := a.DB.Where("group_id = ? AND phone_number = ?", group.ID, phoneNumber).First(&participant).Error; err == nil {
+		updates := map[string]interface{}{}
+		if profileName != "" && participant.ProfileName != profileName {
+			updates["profile_name"] = profileName
+		}
+		if participant.LeftAt != nil {
+			updates["left_at"] = nil
+			updates["joined_at"] = at
+		}
+		if len(updates) > 0 {
+			a.DB.Model(&participant).Updates(updates)
+		}
+		return
+	}
+
+	participant = models.WhatsAppGroupParticipant{
+		BaseModel:   models.BaseModel{ID: uuid.New()},
+		GroupID:     group.ID,
+		PhoneNumber: phoneNumber,
+		ProfileName: profileName,
+		JoinedAt:    at,
+	}
+	var contact models.Contact
+	if err := a.DB.Select("id").Where("organization_id = ? AND phone_number = ?", group.OrganizationID, phoneNumber).First(&contact).Error; err == nil {
+		participant.ContactID = &contact.ID
+	}
+	if err := a.DB.Create(&participant).Error; err != nil {
+		a.Log.Error("Failed to save group participant", "error", err, "group_id", group.ID)
+	}
+}
+
+// updateGroupMessageStatus applies a status update to an outgoing group message,
+// reporting whether one matched
+func (a *App) updateGroupMessageStatus(status WebhookStatus) bool {
+	var message models.GroupMessage
+	if err := a.DB.Where("whats_app_message_id = ?", status.ID).First(&message).Error; err != nil {
+		return false
+	}
+
+	statusValue := status.Status
+	updates := map[string]interface{}{}
+	switch models.MessageStatus(statusValue) {
+	case models.MessageStatusSent, models.MessageStatusDelivered, models.MessageStatusRead:
+		updates["status"] = statusValue
+	case models.MessageStatusFailed:
+		updates["status"] = statusValue
+		if _, reason := webhookStatusError(status.Errors); reason != "" {
+			updates["error_message"] = reason
+		}
+	default:
+		return true
+	}
+	if !isMessageStatusAdvance(message.Status, models.MessageStatus(statusValue)) {
+		return true
+	}
+
+	if err := a.DB.Model(&message).Updates(updates).Error; err != nil {
+		a.Log.Error("Failed to update group message status", "error", err, "message_id", message.ID)
+		return true
+	}
+
+	if a.WSHub != nil {
+		a.WSHub.BroadcastToOrg(message.OrganizationID, websocket.WSMessage{
+			Type: websocket.TypeStatusUpdate,
+			Payload: map[string]any{
+				"message_id": message.ID.String(),
+				"group_id":   message.GroupID.String(),
+				"status":     statusValue,
+			},
+		})
+	}
+	return true
+}
+
+// broadcastGroupMessage shows a group message to agents in real time
+func (a *App) broadcastGroupMessage(message *models.GroupMessage) {
+	if a.WSHub == nil {
+		return
+	}
+	a.WSHub.BroadcastToOrg(message.OrganizationID, websocket.WSMessage{
+		Type:    websocket.TypeGroupMessage,
+		Payload: message,
+	})
+}
+
+// groupMessageContent returns the text of a group message, or the caption of media
+func groupMessageContent(msg IncomingTextMessage) string {
+	switch {
+	case msg.Text != nil:
+		return msg.Text.Body
+	case msg.Image != nil:
+		return msg.Image.Caption
+	case msg.Video != nil:
+		return msg.Video.Caption
+	case msg.Document != nil:
+		return msg.Document.Caption
+	}
+	return ""
+}
+
+// parseMentions returns the phone numbers mentioned in a message, in order and
+// without duplicates
+func parseMentions(text string) models.JSONBArray {
+	mentions := models.JSONBArray{}
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			mentions = append(mentions, match[1])
+		}
+	}
+	return mentions
+}
+
+// mentionsPhone reports whether a phone number is among the mentions. Display
+// numbers may be formatted, so only digits are compared.
+func mentionsPhone(mentions models.JSONBArray, phone string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	if digits == "" {
+		return false
+	}
+	for _, m := range mentions {
+		if m == digits {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want models.JSONBArray
+	}{
+		{name: "no mentions", text: "Is the shop open today?", want: models.JSONBArray{}},
+		{name: "single mention", text: "@15550001111 is the shop open today?", want: models.JSONBArray{"15550001111"}},
+		{name: "several mentions in order", text: "@447700900123 and @15550001111 please check", want: models.JSONBArray{"447700900123", "15550001111"}},
+		{name: "duplicates dropped", text: "@15550001111 @15550001111 hello", want: models.JSONBArray{"15550001111"}},
+		{name: "short numbers ignored", text: "Meet @1230 at the door", want: models.JSONBArray{}},
+		{name: "email addresses ignored", text: "Write to sales@example.com", want: models.JSONBArray{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseMentions(tt.text))
+		})
+	}
+}
+
+func TestMentionsPhone(t *testing.T) {
+	mentions := models.JSONBArray{"447700900123", "15550001111"}
+
+	assert.True(t, mentionsPhone(mentions, "15550001111"))
+	assert.True(t, mentionsPhone(mentions, "+1 555-000-1111"))
+	assert.False(t, mentionsPhone(mentions, "15550002222"))
+	assert.False(t, mentionsPhone(mentions, ""))
+}
+
+func TestProcessGroupMessage(t *testing.T) {
+	redis := testutil.SetupTestRedis(t)
+	if redis == nil {
+		t.Skip("TEST_REDIS_URL not set, skipping Redis test")
+	}
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Redis:  redis,
+		Log:    testutil.NopLogger(),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Group Org " + uuid.New().String()[:8],
+		Slug:      "group-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		Name:           "group-account-" + uuid.New().String()[:8],
+		PhoneID:        "phone-" + uuid.New().String()[:8],
+		BusinessID:     "waba-" + uuid.New().String()[:8],
+		AccessToken:    "test-token",
+		Status:         "active",
+	}
+	require.NoError(t, app.DB.Create(account).Error)
+	contact := &models.Contact{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		PhoneNumber:     "1555" + uuid.New().String()[:7],
+		WhatsAppAccount: account.Name,
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+
+	metaGroupID := "group-" + uuid.New().String()[:8]
+	app.processGroupMessage(account.PhoneID, "15550009999", map[string]interface{}{
+		"from":     contact.PhoneNumber,
+		"id":       "wamid.group-" + uuid.New().String()[:8],
+		"type":     "text",
+		"group_id": metaGroupID,
+		"text":     map[string]string{"body": "@15550009999 what are your opening hours?"},
+	}, "Dana")
+
+	var group models.WhatsAppGroup
+	require.NoError(t, app.DB.Where("organization_id = ? AND meta_group_id = ?", org.ID, metaGroupID).First(&group).Error)
+	assert.Equal(t, account.Name, group.WhatsAppAccount)
+	assert.NotNil(t, group.LastMessageAt)
+
+	var message models.GroupMessage
+	require.NoError(t, app.DB.Where("group_id = ?", group.ID).First(&message).Error)
+	assert.Equal(t, models.DirectionIncoming, message.Direction)
+	assert.Equal(t, "Dana", message.SenderName)
+	assert.Equal(t, models.JSONBArray{"15550009999"}, message.Mentions)
+
+	var participant models.WhatsAppGroupParticipant
+	require.NoError(t, app.DB.Where("group_id = ? AND phone_number = ?", group.ID, contact.PhoneNumber).First(&participant).Error)
+	require.NotNil(t, participant.ContactID)
+	assert.Equal(t, contact.ID, *participant.ContactID)
+
+	update := GroupParticipantsUpdate{GroupID: metaGroupID}
+	update.RemovedParticipants = append(update.RemovedParticipants, struct {
+		WaID string `json:"wa_id"`
+	}{WaID: contact.PhoneNumber})
+	app.processGroupParticipantsUpdate(account.PhoneID, update)
+
+	require.NoError(t, app.DB.Where("id = ?", participant.ID).First(&participant).Error)
+	assert.NotNil(t, participant.LeftAt)
+
+	// Writing again marks the member as rejoined
+	app.trackGroupParticipant(&group, contact.PhoneNumber, "Dana", time.Now())
+	require.NoError(t, app.DB.Where("id = ?", participant.ID).First(&participant).Error)
+	assert.Nil(t, participant.LeftAt)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// Statuses of the health probes and of each dependency they check
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+)
+
+// HealthReport is the response of the health probes
+type HealthReport struct {
+	Status string                      `json:"status"`
+	Checks map[string]DependencyStatus `json:"checks,omitempty"`
+}
+
+// DependencyStatus is the result of checking one dependency. Errors are kept short,
+// since the probes are public; the full error is logged.
+type DependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// dependencyCheck checks a dependency, returning nil if it's usable
+type dependencyCheck func(ctx context.Context) error
+
+// Healthz is the liveness probe. It only reports that the server is serving
+// requests: restarting the server doesn't fix a database or Redis outage, so those
+// are checked by Readyz instead.
+func (a *App) Healthz(r *fastglue.Request) error {
+	return r.SendEnvelope(HealthReport{Status: HealthStatusOK})
+}
+
+// Readyz is the readiness probe. It checks the database and Redis, and the Meta
+// Graph API and AI providers when enabled in the config, responding with 503 if any
+// check fails.
+func (a *App) Readyz(r *fastglue.Request) error {
+	report := a.checkReadiness(context.Background())
+	if report.Status != HealthStatusOK {
+		return r.SendErrorEnvelope(fasthttp.StatusServiceUnavailable, "Not ready", report, "")
+	}
+	return r.SendEnvelope(report)
+}
+
+// checkReadiness runs the readiness checks concurrently, each with the configured
+// timeout
+func (a *App) checkReadiness(ctx context.Context) HealthReport {
+	checks := a.readinessChecks()
+	timeout := 2 * time.Second
+	if cfg := a.CurrentConfig(); cfg != nil && cfg.Health.TimeoutMs > 0 {
+		timeout = time.Duration(cfg.Health.TimeoutMs) * time.Millisecond
+	}
+
+	report := HealthReport{Status: HealthStatusOK, Checks: make(map[string]DependencyStatus, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			status := DependencyStatus{Status: HealthStatusOK, LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				a.Log.Warn("Readiness check failed", "dependency", name, "error", err)
+				status.Status = HealthStatusFail
+				status.Error = "unavailable"
+				if errors.Is(err, context.DeadlineExceeded) {
+					status.Error = "timed out"
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = status
+			if err != nil {
+				report.Status = HealthStatusFail
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+// readinessChecks returns the checks of the readiness probe, by dependency
+func (a *App) readinessChecks() map[string]dependencyCheck {
+	checks := map[string]dependencyCheck{
+		"database": a.checkDatabase,
+		"redis":    a.checkRedis,
+	}
+	cfg := a.CurrentConfig()
+	if cfg == nil {
+		return checks
+	}
+	if cfg.Health.CheckWhatsApp {
+		checks["whatsapp"] = a.checkReachable(config.OutboundMeta, cfg.WhatsApp.BaseURL)
+	}
+	if cfg.Health.CheckAI {
+		// Only the providers the server has keys for; keys set per organization are
+		// checked when they're used
+		if cfg.AI.OpenAIKey != "" {
+			checks["ai_openai"] = a.checkReachable(config.OutboundAI, openAIChatURL)
+		}
+		if cfg.AI.AnthropicKey != "" {
+			checks["ai_anthropic"] = a.checkReachable(config.OutboundAI, anthropicMessagesURL)
+		}
+		if cfg.AI.GoogleKey != "" {
+			checks["ai_google"] = a.checkReachable(config.OutboundAI, googleAIBaseURL)
+		}
+	}
+	return checks
+}
+
+// checkDatabase pings the database
+func (a *App) checkDatabase(ctx context.Context) error {
+	if a.DB == nil {
+		return errors.New("database not configured")
+	}
+	sqlDB, err := a.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// checkRedis pings Redis
+func (a *App) checkRedis(ctx context.Context) error {
+	if a.Redis == nil {
+		return errors.New("redis not configured")
+	}
+	return a.Redis.Ping(ctx).Err()
+}
+
+// checkReachable returns a check that the host of an API answers over HTTP, through
+// the provider's outbound transport. Any answer short of a server error will do,
+// since the check isn't authenticated.
+func (a *App) checkReachable(provider, rawURL string) dependencyCheck {
+	return func(ctx context.Context) error {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid URL %q", rawURL)
+		}
+		origin := (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := a.httpClient(provider, 0).Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s returned status %d", origin, resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestHealthz(t *testing.T) {
+	app := &App{Config: &config.Config{}, Log: testutil.NopLogger()}
+	req := testutil.NewGETRequest(t)
+
+	require.NoError(t, app.Healthz(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var report HealthReport
+	testutil.ParseEnvelopeResponse(t, req, &report)
+	assert.Equal(t, HealthStatusOK, report.Status)
+	assert.Empty(t, report.Checks, "liveness doesn't check dependencies")
+}
+
+func TestCheckReadiness_ExternalAPIs(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Unauthenticated calls are rejected, which still shows the API is reachable
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	previous := openAIChatURL
+	openAIChatURL = down.URL + "/v1/chat/completions"
+	t.Cleanup(func() { openAIChatURL = previous })
+
+	app := &App{
+		Config: &config.Config{
+			WhatsApp: config.WhatsAppConfig{BaseURL: up.URL},
+			AI:       config.AIConfig{OpenAIKey: "key"},
+			Health:   config.HealthConfig{CheckWhatsApp: true, CheckAI: true, TimeoutMs: 1000},
+		},
+		Log: testutil.NopLogger(),
+	}
+
+	report := app.checkReadiness(context.Background())
+	assert.Equal(t, HealthStatusFail, report.Status)
+	require.Contains(t, report.Checks, "whatsapp")
+	assert.Equal(t, HealthStatusOK, report.Checks["whatsapp"].Status)
+	require.Contains(t, report.Checks, "ai_openai")
+	assert.Equal(t, HealthStatusFail, report.Checks["ai_openai"].Status)
+	assert.Equal(t, "unavailable", report.Checks["ai_openai"].Error)
+	assert.NotContains(t, report.Checks, "ai_anthropic", "providers without keys aren't checked")
+	assert.Equal(t, HealthStatusFail, report.Checks["database"].Status)
+}
+
+func TestReadyz(t *testing.T) {
+	redis := testutil.SetupTestRedis(t)
+	if redis == nil {
+		t.Skip("TEST_REDIS_URL not set")
+	}
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Redis:  redis,
+		Log:    testutil.NopLogger(),
+	}
+	req := testutil.NewGETRequest(t)
+
+	require.NoError(t, app.Readyz(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var report HealthReport
+	testutil.ParseEnvelopeResponse(t, req, &report)
+	assert.Equal(t, HealthStatusOK, report.Status)
+	assert.Equal(t, HealthStatusOK, report.Checks["database"].Status)
+	assert.Equal(t, HealthStatusOK, report.Checks["redis"].Status)
+	assert.NotContains(t, report.Checks, "whatsapp", "external APIs are only checked when enabled")
+
+	// Without Redis, the server isn't ready
+	app.Redis = nil
+	req = testutil.NewGETRequest(t)
+	require.NoError(t, app.Readyz(req))
+	assert.Equal(t, fasthttp.StatusServiceUnavailable, testutil.GetResponseStatusCode(req))
+}
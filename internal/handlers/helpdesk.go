@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/helpdesk"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// helpdeskTranscriptMessages is how many of the contact's last messages a ticket's
+// transcript has
+const helpdeskTranscriptMessages = 100
+
+// helpdeskDomainPattern matches the helpdesk subdomain the API is served on
+var helpdeskDomainPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*\.(zendesk|freshdesk)\.com$`)
+
+// HelpdeskSettings connect the helpdesk tickets are created in when a conversation
+// is handed off and no agent is available
+type HelpdeskSettings struct {
+	Provider      string // zendesk or freshdesk, empty when not connected
+	Domain        string // e.g. acme.zendesk.com
+	Email         string // Zendesk agent the API token belongs to
+	APIKey        string // Zendesk API token or Freshdesk API key, may reference a secret
+	CreateTickets bool
+}
+
+// HelpdeskSettingsRequest updates helpdesk settings. Omitted fields keep their
+// current value.
+type HelpdeskSettingsRequest struct {
+	Provider      *string `json:"provider"`
+	Domain        *string `json:"domain"`
+	Email         *string `json:"email"`
+	APIKey        *string `json:"api_key"`
+	CreateTickets *bool   `json:"create_tickets"`
+}
+
+// helpdeskSettings reads the helpdesk settings from organization settings
+func helpdeskSettings(settings models.JSONB) HelpdeskSettings {
+	var s HelpdeskSettings
+	raw, ok := settings["helpdesk"].(map[string]interface{})
+	if !ok {
+		return s
+	}
+	s.Provider, _ = raw["provider"].(string)
+	s.Domain, _ = raw["domain"].(string)
+	s.Email, _ = raw["email"].(string)
+	s.APIKey = models.SettingSecret(raw, "api_key")
+	s.CreateTickets, _ = raw["create_tickets"].(bool)
+	return s
+}
+
+// connected reports whether the settings have a helpdesk and its credentials
+func (s HelpdeskSettings) connected() bool {
+	switch helpdesk.Provider(s.Provider) {
+	case helpdesk.ProviderZendesk:
+		return s.Domain != "" && s.Email != "" && s.APIKey != ""
+	case helpdesk.ProviderFreshdesk:
+		return s.Domain != "" && s.APIKey != ""
+	}
+	return false
+}
+
+// helpdeskSettingsResponse is the settings as returned by the API. The API key is
+// never returned, only whether it's set.
+func helpdeskSettingsResponse(s HelpdeskSettings) map[string]interface{} {
+	return map[string]interface{}{
+		"provider":       s.Provider,
+		"domain":         s.Domain,
+		"email":          s.Email,
+		"api_key_set":    s.APIKey != "",
+		"connected":      s.connected(),
+		"create_tickets": s.CreateTickets,
+	}
+}
+
+// normalizeHelpdeskDomain turns a helpdesk URL into the provider's subdomain it's
+// served on
+func normalizeHelpdeskDomain(provider, domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "https://"), "http://")
+	domain = strings.TrimSuffix(domain, "/")
+	if domain == "" {
+		return "", nil
+	}
+	if m := helpdeskDomainPattern.FindStringSubmatch(domain); m == nil || m[1] != provider {
+		return "", fmt.Errorf("domain must be the helpdesk's %s.com subdomain, e.g. acme.%s.com", provider, provider)
+	}
+	return domain, nil
+}
+
+// GetHelpdeskSettings returns the organization's helpdesk settings
+func (a *App) GetHelpdeskSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	return r.SendEnvelope(helpdeskSettingsResponse(helpdeskSettings(org.Settings)))
+}
+
+// UpdateHelpdeskSettings connects or disconnects the organization's helpdesk. A
+// helpdesk is only saved once its tickets can be read with the credentials.
+func (a *App) UpdateHelpdeskSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req HelpdeskSettingsRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	before := orgSettingsAuditSnapshot(&org)
+	s := helpdeskSettings(org.Settings)
+
+	if req.Provider != nil {
+		s.Provider = strings.ToLower(strings.TrimSpace(*req.Provider))
+	}
+	if req.Domain != nil {
+		s.Domain = *req.Domain
+	}
+	if req.Email != nil {
+		s.Email = strings.TrimSpace(*req.Email)
+	}
+	if req.APIKey != nil {
+		s.APIKey = strings.TrimSpace(*req.APIKey)
+	}
+	if req.CreateTickets != nil {
+		s.CreateTickets = *req.CreateTickets
+	}
+
+	switch helpdesk.Provider(s.Provider) {
+	case "":
+		s.CreateTickets = false
+	case helpdesk.ProviderZendesk, helpdesk.ProviderFreshdesk:
+		if s.Domain, err = normalizeHelpdeskDomain(s.Provider, s.Domain); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		if !s.connected() {
+			required := "domain and api_key are"
+			if s.Provider == string(helpdesk.ProviderZendesk) {
+				required = "domain, email and api_key are"
+			}
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, required+" required", nil, "")
+		}
+		creds, err := a.helpdeskCredentials(r.RequestCtx, orgID, s)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "api_key: "+err.Error(), nil, "")
+		}
+		if err := a.helpdeskClient().Check(r.RequestCtx, helpdesk.Provider(s.Provider), creds); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Can't connect to the helpdesk: "+err.Error(), nil, "")
+		}
+	default:
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "provider must be zendesk or freshdesk", nil, "")
+	}
+
+	if org.Settings == nil {
+		org.Settings = models.JSONB{}
+	}
+	section := map[string]interface{}{
+		"provider":       s.Provider,
+		"domain":         s.Domain,
+		"email":          s.Email,
+		"api_key":        s.APIKey,
+		"create_tickets": s.CreateTickets,
+	}
+	if err := models.EncryptSettingSecrets("helpdesk", section); err != nil {
+		a.Log.Error("Failed to encrypt helpdesk credentials", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	org.Settings["helpdesk"] = section
+	if err := a.DB.Save(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	a.recordOrgSettingsAudit(r, &org, before)
+
+	return r.SendEnvelope(helpdeskSettingsResponse(s))
+}
+
+// helpdeskClient returns the client for calls to helpdesks
+func (a *App) helpdeskClient() *helpdesk.Client {
+	if a.Helpdesk != nil {
+		return a.Helpdesk
+	}
+	client := helpdesk.New(a.Log)
+	client.HTTPClient = a.httpClient(config.OutboundHelpdesk, helpdesk.DefaultTimeout)
+	return client
+}
+
+// helpdeskCredentials returns the credentials of the settings' helpdesk, with the
+// API key's secret reference resolved
+func (a *App) helpdeskCredentials(ctx context.Context, orgID uuid.UUID, s HelpdeskSettings) (helpdesk.Credentials, error) {
+	key, err := a.resolveCredential(ctx, orgID, s.APIKey)
+	if err != nil {
+		return helpdesk.Credentials{}, err
+	}
+	return helpdesk.Credentials{Domain: s.Domain, Email: s.Email, APIKey: key}, nil
+}
+
+// agentAvailable reports whether an agent can take a transfer: it's assigned, or an
+// agent of its team, or of the organization for the general queue, is available.
+// Transfers waiting for business hours have none.
+func (a *App) agentAvailable(transfer *models.AgentTransfer) bool {
+	if transfer.AgentID != nil {
+		return true
+	}
+	if transfer.AssignmentDeferred {
+		return false
+	}
+	var count int64
+	if transfer.TeamID != nil {
+		a.DB.Model(&models.TeamMember{}).
+			Joins("JOIN users ON users.id = team_members.user_id").
+			Where("team_members.team_id = ? AND team_members.role = ? AND users.is_available = ? AND users.is_active = ?",
+				*transfer.TeamID, models.TeamRoleAgent, true, true).
+			Count(&count)
+	} else {
+		a.DB.Model(&models.User{}).
+			Where("organization_id = ? AND is_available = ? AND is_active = ?", transfer.OrganizationID, true, true).
+			Count(&count)
+	}
+	return count > 0
+}
+
+// openHelpdeskTicket creates a ticket for a handoff in the background, when the
+// organization creates tickets and no agent is available
+func (a *App) openHelpdeskTicket(transfer *models.AgentTransfer, contact *models.Contact) {
+	// Simulated conversations don't create tickets
+	if a.simulation != nil {
+		return
+	}
+	t, c := *transfer, *contact
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		if err := a.createHelpdeskTicket(context.Background(), &t, &c); err != nil {
+			a.Log.Error("Failed to create helpdesk ticket", "error", err, "transfer_id", t.ID, "contact_id", c.ID)
+		}
+	}()
+}
+
+// createHelpdeskTicket creates a ticket for a handoff no agent is available for,
+// with the conversation's transcript attached
+func (a *App) createHelpdeskTicket(ctx context.Context, transfer *models.AgentTransfer, contact *models.Contact) error {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", transfer.OrganizationID).First(&org).Error; err != nil {
+		return err
+	}
+	s := helpdeskSettings(org.Settings)
+	if !s.CreateTickets || !s.connected() || !isPhoneNumber(contact.PhoneNumber) || a.agentAvailable(transfer) {
+		return nil
+	}
+	creds, err := a.helpdeskCredentials(ctx, org.ID, s)
+	if err != nil {
+		return err
+	}
+
+	var messages []models.Message
+	if err := a.DB.Where("organization_id = ? AND contact_id = ?", transfer.OrganizationID, contact.ID).
+		Preload("SentByUser").
+		Order("created_at DESC").
+		Limit(helpdeskTranscriptMessages).
+		Find(&messages).Error; err != nil {
+		return err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	phone := "+" + strings.TrimPrefix(contact.PhoneNumber, "+")
+	name := contact.ProfileName
+	if name == "" {
+		name = phone
+	}
+	description := fmt.Sprintf("%s (%s) on %s is waiting for an agent and none is available. Their next messages are added to this ticket.", name, phone, transfer.WhatsAppAccount)
+	if transfer.Notes != "" {
+		description += "\n\nNotes: " + transfer.Notes
+	}
+	if n := len(messages); n > 0 {
+		description += "\n\nLast message: " + messageExportText(messages[n-1], false)
+	}
+	priority := helpdesk.Priority(transfer.Priority)
+	if priority == "" {
+		priority = helpdesk.PriorityNormal
+	}
+
+	ticket, err := a.helpdeskClient().CreateTicket(ctx, helpdesk.Provider(s.Provider), creds, helpdesk.TicketRequest{
+		Subject:        "WhatsApp conversation with " + name,
+		Description:    description,
+		RequesterName:  name,
+		RequesterPhone: phone,
+		Priority:       priority,
+		Attachment: &helpdesk.Attachment{
+			Filename:    "transcript.txt",
+			ContentType: "text/plain; charset=utf-8",
+			Content:     []byte(plainTranscript(messages, name, "2006-01-02 15:04 MST", 0)),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	record := models.HelpdeskTicket{
+		OrganizationID: transfer.OrganizationID,
+		ContactID:      contact.ID,
+		TransferID:     transfer.ID,
+		Provider:       s.Provider,
+		ExternalID:     ticket.ID,
+		RequesterID:    ticket.RequesterID,
+		URL:            ticket.URL,
+	}
+	if err := a.DB.Create(&record).Error; err != nil {
+		return fmt.Errorf("failed to save helpdesk ticket: %w", err)
+	}
+	a.Log.Info("Helpdesk ticket created", "ticket_id", ticket.ID, "provider", s.Provider, "transfer_id", transfer.ID, "contact_id", contact.ID)
+	return nil
+}
+
+// activeHelpdeskTicket returns the ticket of a contact's active transfer, or nil
+// if it has none
+func (a *App) activeHelpdeskTicket(contactID uuid.UUID) *models.HelpdeskTicket {
+	var ticket models.HelpdeskTicket
+	err := a.DB.Joins("JOIN agent_transfers ON agent_transfers.id = helpdesk_tickets.transfer_id").
+		Where("helpdesk_tickets.contact_id = ? AND agent_transfers.status = ?", contactID, models.TransferStatusActive).
+		Order("helpdesk_tickets.created_at DESC").
+		First(&ticket).Error
+	if err != nil {
+		return nil
+	}
+	return &ticket
+}
+
+// addHelpdeskComment adds a customer's message to the ticket of their active
+// transfer, in the background
+func (a *App) addHelpdeskComment(contact *models.Contact, message *models.Message) {
+	if a.simulation != nil {
+		return
+	}
+	ticket := a.activeHelpdeskTicket(contact.ID)
+	if ticket == nil {
+		return
+	}
+	text := messageExportText(*message, false)
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		if err := a.postHelpdeskComment(context.Background(), ticket, text); err != nil {
+			a.Log.Error("Failed to add message to helpdesk ticket", "error", err, "ticket_id", ticket.ExternalID, "contact_id", ticket.ContactID)
+		}
+	}()
+}
+
+// postHelpdeskComment adds a comment to a ticket as its requester
+func (a *App) postHelpdeskComment(ctx context.Context, ticket *models.HelpdeskTicket, text string) error {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", ticket.OrganizationID).First(&org).Error; err != nil {
+		return err
+	}
+	s := helpdeskSettings(org.Settings)
+	// Tickets of a helpdesk that was since disconnected or replaced are left alone
+	if !s.connected() || s.Provider != ticket.Provider {
+		return nil
+	}
+	creds, err := a.helpdeskCredentials(ctx, org.ID, s)
+	if err != nil {
+		return err
+	}
+	return a.helpdeskClient().AddComment(ctx, helpdesk.Provider(s.Provider), creds, &helpdesk.Ticket{
+		ID:          ticket.ExternalID,
+		RequesterID: ticket.RequesterID,
+		URL:         ticket.URL,
+	}, text)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/helpdesk"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeHelpdeskDomain(t *testing.T) {
+	tests := []struct {
+		provider string
+		domain   string
+		want     string
+		wantErr  bool
+	}{
+		{provider: "zendesk", domain: "https://Acme.zendesk.com/", want: "acme.zendesk.com"},
+		{provider: "freshdesk", domain: " acme-support.freshdesk.com", want: "acme-support.freshdesk.com"},
+		{provider: "zendesk", domain: "", want: ""},
+		{provider: "zendesk", domain: "acme.freshdesk.com", wantErr: true},
+		{provider: "freshdesk", domain: "evil.com/acme.freshdesk.com", wantErr: true},
+		{provider: "zendesk", domain: "acme.zendesk.com.evil.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			got, err := normalizeHelpdeskDomain(tt.provider, tt.domain)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHelpdeskSettings_Connected(t *testing.T) {
+	assert.False(t, HelpdeskSettings{}.connected())
+	assert.False(t, HelpdeskSettings{Provider: "zendesk", Domain: "acme.zendesk.com", APIKey: "token"}.connected())
+	assert.True(t, HelpdeskSettings{Provider: "zendesk", Domain: "acme.zendesk.com", Email: "agent@acme.com", APIKey: "token"}.connected())
+	assert.True(t, HelpdeskSettings{Provider: "freshdesk", Domain: "acme.freshdesk.com", APIKey: "key"}.connected())
+	assert.False(t, HelpdeskSettings{Provider: "jira", Domain: "acme.atlassian.net", APIKey: "key"}.connected())
+
+	s := helpdeskSettings(models.JSONB{"helpdesk": map[string]interface{}{
+		"provider": "freshdesk", "domain": "acme.freshdesk.com", "api_key": "key", "create_tickets": true,
+	}})
+	resp := helpdeskSettingsResponse(s)
+	assert.Equal(t, true, resp["api_key_set"])
+	assert.Equal(t, true, resp["connected"])
+	assert.NotContains(t, resp, "api_key")
+}
+
+func TestCreateHelpdeskTicket_NoAgentAvailable(t *testing.T) {
+	var comments []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v2/tickets", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "4", r.FormValue("priority"))
+		assert.Len(t, r.MultipartForm.File["attachments[]"], 1)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":42,"requester_id":9001}`))
+	})
+	mux.HandleFunc("POST /api/v2/tickets/42/notes", func(w http.ResponseWriter, r *http.Request) {
+		var note struct {
+			Body string `json:"body"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&note))
+		comments = append(comments, note.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":1}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	app := &App{
+		Config:   &config.Config{},
+		DB:       testutil.SetupTestDB(t),
+		Log:      testutil.NopLogger(),
+		Helpdesk: helpdesk.NewWithBaseURL(testutil.NopLogger(), server.URL),
+	}
+	seq, contact, _ := sequenceTestContact(t, app, nil)
+	var org models.Organization
+	require.NoError(t, app.DB.Where("id = ?", seq.OrganizationID).First(&org).Error)
+	org.Settings = models.JSONB{
+		"helpdesk": map[string]interface{}{
+			"provider":       "freshdesk",
+			"domain":         "acme.freshdesk.com",
+			"api_key":        "fd-key",
+			"create_tickets": true,
+		},
+	}
+	require.NoError(t, app.DB.Save(&org).Error)
+	require.NoError(t, app.DB.Create(&models.Message{
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: contact.WhatsAppAccount,
+		Direction:       models.DirectionIncoming,
+		MessageType:     models.MessageTypeText,
+		Content:         "I need a human",
+	}).Error)
+
+	// Transfers waiting for business hours have no agent available
+	transfer := &models.AgentTransfer{
+		OrganizationID:     org.ID,
+		ContactID:          contact.ID,
+		WhatsAppAccount:    contact.WhatsAppAccount,
+		PhoneNumber:        contact.PhoneNumber,
+		Status:             models.TransferStatusActive,
+		AssignmentDeferred: true,
+		Priority:           models.TransferPriorityUrgent,
+	}
+	require.NoError(t, app.DB.Create(transfer).Error)
+
+	require.NoError(t, app.createHelpdeskTicket(testutil.TestContext(t), transfer, contact))
+
+	ticket := app.activeHelpdeskTicket(contact.ID)
+	require.NotNil(t, ticket)
+	assert.Equal(t, "42", ticket.ExternalID)
+	assert.Equal(t, "9001", ticket.RequesterID)
+	assert.Equal(t, "https://acme.freshdesk.com/a/tickets/42", ticket.URL)
+
+	require.NoError(t, app.postHelpdeskComment(testutil.TestContext(t), ticket, "Any update?"))
+	assert.Equal(t, []string{"Any update?"}, comments)
+
+	// Once the transfer is resumed its ticket gets no more comments
+	require.NoError(t, app.DB.Model(transfer).Update("status", models.TransferStatusResumed).Error)
+	assert.Nil(t, app.activeHelpdeskTicket(contact.ID))
+}
+
+func TestHelpdeskSettings_Encrypted(t *testing.T) {
+	testutil.EnableEncryption(t)
+
+	section := map[string]interface{}{"api_key": "fd-key-123"}
+	require.NoError(t, models.EncryptSettingSecrets("helpdesk", section))
+	assert.NotEqual(t, "fd-key-123", section["api_key"])
+	s := helpdeskSettings(models.JSONB{"helpdesk": section})
+	assert.Equal(t, "fd-key-123", s.APIKey)
+}
@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+const (
+	// holidayDateFormat is the date format used for holidays in requests and responses
+	holidayDateFormat = "2006-01-02"
+
+	// maxHolidayEventDays caps the expansion of multi-day iCal events
+	maxHolidayEventDays = 31
+
+	// maxHolidayLookahead caps the search for the next working day
+	maxHolidayLookahead = 366
+)
+
+// HolidayRequest represents the request body for creating/updating a holiday
+type HolidayRequest struct {
+	Name            string  `json:"name"`
+	Date            string  `json:"date"` // YYYY-MM-DD
+	Recurring       *bool   `json:"recurring"`
+	Calendar        *string `json:"calendar"`
+	WhatsAppAccount *string `json:"whatsapp_account"`
+}
+
+// ImportHolidaysRequest represents the request body for importing an iCal calendar
+type ImportHolidaysRequest struct {
+	Calendar        string `json:"calendar"`
+	WhatsAppAccount string `json:"whatsapp_account"`
+	ICS             string `json:"ics"`
+}
+
+// HolidayResponse represents the API response for a holiday
+type HolidayResponse struct {
+	ID              uuid.UUID `json:"id"`
+	Name            string    `json:"name"`
+	Date            string    `json:"date"`
+	Recurring       bool      `json:"recurring"`
+	Calendar        string    `json:"calendar"`
+	WhatsAppAccount string    `json:"whatsapp_account"`
+	Source          string    `json:"source"`
+	CreatedAt       string    `json:"created_at"`
+	UpdatedAt       string    `json:"updated_at"`
+}
+
+// ListHolidays returns all holidays for the organization
+func (a *App) ListHolidays(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	calendar := string(r.RequestCtx.QueryArgs().Peek("calendar"))
+	account := string(r.RequestCtx.QueryArgs().Peek("whatsapp_account"))
+
+	query := a.DB.Where("organization_id = ?", orgID)
+	if calendar != "" {
+		query = query.Where("calendar = ?", calendar)
+	}
+	if account != "" {
+		query = query.Where("whats_app_account = ? OR whats_app_account = ''", account)
+	}
+
+	var holidays []models.Holiday
+	if err := query.Order("date ASC").Find(&holidays).Error; err != nil {
+		a.Log.Error("Failed to list holidays", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to list holidays", nil, "")
+	}
+
+	result := make([]HolidayResponse, len(holidays))
+	for i, h := range holidays {
+		result[i] = holidayToResponse(h)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"holidays": result,
+	})
+}
+
+// CreateHoliday creates a new holiday
+func (a *App) CreateHoliday(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	var req HolidayRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.Date == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+			"name and date are required", nil, "")
+	}
+	date, err := time.Parse(holidayDateFormat, req.Date)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+			"date must be in YYYY-MM-DD format", nil, "")
+	}
+
+	holiday := models.Holiday{
+		OrganizationID: orgID,
+		Name:           req.Name,
+		Date:           date,
+		Source:         "manual",
+	}
+	if req.Recurring != nil {
+		holiday.Recurring = *req.Recurring
+	}
+	if req.Calendar != nil {
+		holiday.Calendar = strings.TrimSpace(*req.Calendar)
+	}
+	if req.WhatsAppAccount != nil && *req.WhatsAppAccount != "" {
+		if !a.accountExists(orgID, *req.WhatsAppAccount) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "WhatsApp account not found", nil, "")
+		}
+		holiday.WhatsAppAccount = *req.WhatsAppAccount
+	}
+
+	if err := a.DB.Create(&holiday).Error; err != nil {
+		a.Log.Error("Failed to create holiday", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to create holiday", nil, "")
+	}
+
+	a.InvalidateHolidaysCache(orgID)
+
+	return r.SendEnvelope(holidayToResponse(holiday))
+}
+
+// UpdateHoliday updates an existing holiday
+func (a *App) UpdateHoliday(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	idStr, _ := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
+	}
+
+	var holiday models.Holiday
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).
+		First(&holiday).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Holiday not found", nil, "")
+	}
+
+	var req HolidayRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	if name := strings.TrimSpace(req.Name); name != "" {
+		holiday.Name = name
+	}
+	if req.Date != "" {
+		date, err := time.Parse(holidayDateFormat, req.Date)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+				"date must be in YYYY-MM-DD format", nil, "")
+		}
+		holiday.Date = date
+	}
+	if req.Recurring != nil {
+		holiday.Recurring = *req.Recurring
+	}
+	if req.Calendar != nil {
+		holiday.Calendar = strings.TrimSpace(*req.Calendar)
+	}
+	if req.WhatsAppAccount != nil {
+		if *req.WhatsAppAccount != "" && !a.accountExists(orgID, *req.WhatsAppAccount) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "WhatsApp account not found", nil, "")
+		}
+		holiday.WhatsAppAccount = *req.WhatsAppAccount
+	}
+
+	if err := a.DB.Save(&holiday).Error; err != nil {
+		a.Log.Error("Failed to update holiday", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to update holiday", nil, "")
+	}
+
+	a.InvalidateHolidaysCache(orgID)
+
+	return r.SendEnvelope(holidayToResponse(holiday))
+}
+
+// DeleteHoliday deletes a holiday
+func (a *App) DeleteHoliday(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	idStr, _ := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
+	}
+
+	result := a.DB.Where("id = ? AND organization_id = ?", id, orgID).Delete(&models.Holiday{})
+	if result.Error != nil {
+		a.Log.Error("Failed to delete holiday", "error", result.Error)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to delete holiday", nil, "")
+	}
+	if result.RowsAffected == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Holiday not found", nil, "")
+	}
+
+	a.InvalidateHolidaysCache(orgID)
+
+	return r.SendEnvelope(map[string]string{"message": "Holiday deleted"})
+}
+
+// ImportHolidaysICal imports all-day events from an iCal (.ics) calendar.
+// Re-importing a calendar replaces the holidays previously imported into it.
+func (a *App) ImportHolidaysICal(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	var req ImportHolidaysRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	req.Calendar = strings.TrimSpace(req.Calendar)
+	if req.Calendar == "" || req.ICS == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+			"calendar and ics are required", nil, "")
+	}
+	if req.WhatsAppAccount != "" && !a.accountExists(orgID, req.WhatsAppAccount) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "WhatsApp account not found", nil, "")
+	}
+
+	holidays, err := parseICalHolidays(req.ICS)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid iCal file", nil, "")
+	}
+	if len(holidays) == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "No events found in calendar", nil, "")
+	}
+
+	for i := range holidays {
+		holidays[i].OrganizationID = orgID
+		holidays[i].Calendar = req.Calendar
+		holidays[i].WhatsAppAccount = req.WhatsAppAccount
+	}
+
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ? AND calendar = ? AND whats_app_account = ? AND source = ?",
+			orgID, req.Calendar, req.WhatsAppAccount, "ical").
+			Delete(&models.Holiday{}).Error; err != nil {
+			return err
+		}
+		return tx.CreateInBatches(&holidays, 100).Error
+	})
+	if err != nil {
+		a.Log.Error("Failed to import holidays", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to import holidays", nil, "")
+	}
+
+	a.InvalidateHolidaysCache(orgID)
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message":  "Holidays imported",
+		"imported": len(holidays),
+	})
+}
+
+// isHoliday reports whether t falls on a holiday for the account.
+// t should already be in the timezone the holiday dates are meant for.
+func (a *App) isHoliday(orgID uuid.UUID, whatsAppAccount string, t time.Time) bool {
+	holidays, err := a.getHolidaysCached(orgID)
+	if err != nil {
+		a.Log.Error("Failed to load holidays", "error", err, "org_id", orgID)
+		return false
+	}
+	return findHoliday(holidays, whatsAppAccount, t) != nil
+}
+
+// nextWorkingTime returns t if it is not a holiday for the account, otherwise the start
+// of the next day that is not a holiday. Used to hold SLA timers over closed days.
+func (a *App) nextWorkingTime(orgID uuid.UUID, whatsAppAccount string, t time.Time) time.Time {
+	holidays, err := a.getHolidaysCached(orgID)
+	if err != nil {
+		a.Log.Error("Failed to load holidays", "error", err, "org_id", orgID)
+		return t
+	}
+	return nextWorkingTime(holidays, whatsAppAccount, t)
+}
+
+// findHoliday returns the holiday matching the calendar date of t, if any.
+// Holidays without an account apply to every account.
+func findHoliday(holidays []models.Holiday, whatsAppAccount string, t time.Time) *models.Holiday {
+	year, month, day := t.Date()
+	for i := range holidays {
+		h := &holidays[i]
+		if h.WhatsAppAccount != "" && h.WhatsAppAccount != whatsAppAccount {
+			continue
+		}
+		// Dates are stored without a timezone, read them back as UTC
+		hYear, hMonth, hDay := h.Date.UTC().Date()
+		if hMonth != month || hDay != day {
+			continue
+		}
+		if h.Recurring || hYear == year {
+			return h
+		}
+	}
+	return nil
+}
+
+// nextWorkingTime skips over consecutive holidays starting at t
+func nextWorkingTime(holidays []models.Holiday, whatsAppAccount string, t time.Time) time.Time {
+	for i := 0; i < maxHolidayLookahead; i++ {
+		if findHoliday(holidays, whatsAppAccount, t) == nil {
+			return t
+		}
+		year, month, day := t.Date()
+		t = time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+	}
+	return t
+}
+
+// parseICalHolidays extracts all-day events from an iCalendar document.
+// Multi-day events are expanded to one holiday per day and yearly
+// recurrence rules are stored as recurring holidays.
+func parseICalHolidays(data string) ([]models.Holiday, error) {
+	// Unfold continuation lines (RFC 5545 section 3.1)
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	if !strings.Contains(data, "BEGIN:VCALENDAR") {
+		return nil, errors.New("missing BEGIN:VCALENDAR")
+	}
+
+	var (
+		holidays           []models.Holiday
+		inEvent            bool
+		uid, summary, rule string
+		start, end         time.Time
+	)
+
+	for _, line := range strings.Split(data, "\n") {
+		name, value, ok := strings.Cut(strings.TrimRight(line, "\r"), ":")
+		if !ok {
+			continue
+		}
+		// Drop property parameters, e.g. DTSTART;VALUE=DATE
+		prop, _, _ := strings.Cut(strings.ToUpper(name), ";")
+
+		switch {
+		case prop == "BEGIN" && value == "VEVENT":
+			inEvent = true
+			uid, summary, rule = "", "", ""
+			start, end = time.Time{}, time.Time{}
+		case prop == "END" && value == "VEVENT":
+			inEvent = false
+			if start.IsZero() || summary == "" {
+				continue
+			}
+			// DTEND is exclusive; single-day events may omit it
+			if !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			recurring := strings.Contains(strings.ToUpper(rule), "FREQ=YEARLY")
+			for d, n := start, 0; d.Before(end) && n < maxHolidayEventDays; d, n = d.AddDate(0, 0, 1), n+1 {
+				holidays = append(holidays, models.Holiday{
+					Name:        summary,
+					Date:        d,
+					Recurring:   recurring,
+					Source:      "ical",
+					ExternalUID: uid,
+				})
+			}
+		case !inEvent:
+			continue
+		case prop == "UID":
+			uid = value
+		case prop == "SUMMARY":
+			summary = unescapeICalText(value)
+		case prop == "DTSTART":
+			start = parseICalDate(value)
+		case prop == "DTEND":
+			end = parseICalDate(value)
+		case prop == "RRULE":
+			rule = value
+		}
+	}
+
+	return holidays, nil
+}
+
+// parseICalDate parses the date part of an iCal DATE or DATE-TIME value
+func parseICalDate(value string) time.Time {
+	if len(value) < 8 {
+		return time.Time{}
+	}
+	t, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// unescapeICalText reverses iCal TEXT escaping
+func unescapeICalText(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(strings.TrimSpace(value))
+}
+
+func holidayToResponse(h models.Holiday) HolidayResponse {
+	return HolidayResponse{
+		ID:              h.ID,
+		Name:            h.Name,
+		Date:            h.Date.UTC().Format(holidayDateFormat),
+		Recurring:       h.Recurring,
+		Calendar:        h.Calendar,
+		WhatsAppAccount: h.WhatsAppAccount,
+		Source:          h.Source,
+		CreatedAt:       h.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:       h.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
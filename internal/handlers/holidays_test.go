@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testHolidayCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:new-year@example.com\r\n" +
+	"DTSTART;VALUE=DATE:20250101\r\n" +
+	"DTEND;VALUE=DATE:20250102\r\n" +
+	"SUMMARY:New Year's Day\r\n" +
+	"RRULE:FREQ=YEARLY\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:diwali@example.com\r\n" +
+	"DTSTART;VALUE=DATE:20251020\r\n" +
+	"DTEND;VALUE=DATE:20251023\r\n" +
+	"SUMMARY:Diwali\\, Festival\r\n" +
+	"  of Lights\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART:20250704T000000Z\r\n" +
+	"SUMMARY:Independence Day\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICalHolidays(t *testing.T) {
+	holidays, err := parseICalHolidays(testHolidayCalendar)
+	require.NoError(t, err)
+	require.Len(t, holidays, 5)
+
+	assert.Equal(t, "New Year's Day", holidays[0].Name)
+	assert.True(t, holidays[0].Recurring)
+	assert.Equal(t, "new-year@example.com", holidays[0].ExternalUID)
+	assert.Equal(t, "2025-01-01", holidays[0].Date.Format(holidayDateFormat))
+
+	// Multi-day event expands to one holiday per day, DTEND is exclusive
+	for i, date := range []string{"2025-10-20", "2025-10-21", "2025-10-22"} {
+		assert.Equal(t, "Diwali, Festival of Lights", holidays[1+i].Name)
+		assert.Equal(t, date, holidays[1+i].Date.Format(holidayDateFormat))
+		assert.False(t, holidays[1+i].Recurring)
+	}
+
+	// Missing DTEND is a single day
+	assert.Equal(t, "Independence Day", holidays[4].Name)
+	assert.Equal(t, "2025-07-04", holidays[4].Date.Format(holidayDateFormat))
+	assert.Equal(t, "ical", holidays[4].Source)
+}
+
+func TestParseICalHolidays_Invalid(t *testing.T) {
+	_, err := parseICalHolidays("not a calendar")
+	assert.Error(t, err)
+}
+
+func TestFindHoliday(t *testing.T) {
+	holidays := []models.Holiday{
+		{Name: "New Year", Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Recurring: true},
+		{Name: "Company Offsite", Date: time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{Name: "Local Festival", Date: time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC), WhatsAppAccount: "india"},
+	}
+
+	// Recurring holidays match every year
+	h := findHoliday(holidays, "", time.Date(2026, 1, 1, 15, 0, 0, 0, time.UTC))
+	require.NotNil(t, h)
+	assert.Equal(t, "New Year", h.Name)
+
+	// One-off holidays only match their year
+	assert.NotNil(t, findHoliday(holidays, "", time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC)))
+	assert.Nil(t, findHoliday(holidays, "", time.Date(2026, 3, 14, 9, 0, 0, 0, time.UTC)))
+
+	// Account-specific holidays only apply to that account
+	assert.NotNil(t, findHoliday(holidays, "india", time.Date(2025, 4, 2, 9, 0, 0, 0, time.UTC)))
+	assert.Nil(t, findHoliday(holidays, "us", time.Date(2025, 4, 2, 9, 0, 0, 0, time.UTC)))
+}
+
+func TestFindHoliday_UsesLocalDate(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("timezone database not available")
+	}
+	holidays := []models.Holiday{
+		{Name: "New Year", Date: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	// 2024-12-31 20:00 UTC is already New Year's Day in Tokyo
+	now := time.Date(2024, 12, 31, 20, 0, 0, 0, time.UTC)
+	assert.Nil(t, findHoliday(holidays, "", now))
+	assert.NotNil(t, findHoliday(holidays, "", now.In(tokyo)))
+}
+
+func TestNextWorkingTime(t *testing.T) {
+	holidays := []models.Holiday{
+		{Name: "Day 1", Date: time.Date(2025, 12, 25, 0, 0, 0, 0, time.UTC)},
+		{Name: "Day 2", Date: time.Date(2025, 12, 26, 0, 0, 0, 0, time.UTC)},
+	}
+
+	workday := time.Date(2025, 12, 24, 10, 30, 0, 0, time.UTC)
+	assert.Equal(t, workday, nextWorkingTime(holidays, "", workday))
+
+	// Skips consecutive holidays to the start of the next working day
+	next := nextWorkingTime(holidays, "", time.Date(2025, 12, 25, 10, 30, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2025, 12, 27, 0, 0, 0, 0, time.UTC), next)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// Instagram accounts are accounts with the instagram channel, connected through the
+// Facebook Page they're linked to. The account's phone ID is the Instagram account
+// ID, its business ID is the Page ID and its access token is the Page access token.
+// Contacts are Instagram users: their phone number is "ig" and the ID webhooks give
+// them, which is specific to the account. Sending and webhooks are shared with
+// Messenger accounts.
+const instagramPrefix = "ig"
+
+// InstagramAccountRequest is the request body for connecting an Instagram account
+type InstagramAccountRequest struct {
+	Name               string `json:"name"`
+	InstagramAccountID string `json:"instagram_account_id"`
+	PageID             string `json:"page_id"`
+	AccessToken        string `json:"access_token"` // Page access token
+	AppSecret          string `json:"app_secret"`
+	WebhookVerifyToken string `json:"webhook_verify_token"`
+	APIVersion         string `json:"api_version"`
+	IsDefaultIncoming  bool   `json:"is_default_incoming"`
+	IsDefaultOutgoing  bool   `json:"is_default_outgoing"`
+}
+
+// CreateInstagramAccount connects an Instagram professional account through its
+// Facebook Page and subscribes the app to the Page's messaging webhooks
+func (a *App) CreateInstagramAccount(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	if a.accountLimitReached(orgID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureMultipleAccounts), nil, "")
+	}
+
+	var req InstagramAccountRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.InstagramAccountID == "" || req.PageID == "" || req.AccessToken == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Name, instagram_account_id, page_id, and access_token are required", nil, "")
+	}
+	if err := a.checkCredential(r.RequestCtx, orgID, req.AccessToken); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "access_token: "+err.Error(), nil, "")
+	}
+	if err := a.checkCredential(r.RequestCtx, orgID, req.AppSecret); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "app_secret: "+err.Error(), nil, "")
+	}
+
+	return a.connectMessengerAccount(r, &models.WhatsAppAccount{
+		OrganizationID:     orgID,
+		Name:               req.Name,
+		Channel:            string(models.ChannelInstagram),
+		PhoneID:            req.InstagramAccountID,
+		BusinessID:         req.PageID,
+		AccessToken:        req.AccessToken,
+		AppSecret:          req.AppSecret,
+		WebhookVerifyToken: req.WebhookVerifyToken,
+		APIVersion:         req.APIVersion,
+		IsDefaultIncoming:  req.IsDefaultIncoming,
+		IsDefaultOutgoing:  req.IsDefaultOutgoing,
+	})
+}
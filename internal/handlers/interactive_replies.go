@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// replyIDMatches reports whether a keyword is the ID of a tapped button or
+// picked list row. IDs are matched whole, whatever the rule's match type.
+func replyIDMatches(keywords []string, caseSensitive bool, replyID string) bool {
+	for _, keyword := range keywords {
+		if caseSensitive && keyword == replyID || !caseSensitive && strings.EqualFold(keyword, replyID) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchReplyKeywordRule finds the keyword rule for the ID of a tapped button or
+// picked list row, so menus route on IDs that don't change with the titles
+// shown to the contact
+func (a *App) matchReplyKeywordRule(orgID uuid.UUID, accountName, replyID string) (*KeywordResponse, bool) {
+	rules, err := a.getKeywordRulesCached(orgID, accountName)
+	if err != nil {
+		a.Log.Error("Failed to fetch keyword rules", "error", err)
+		return nil, false
+	}
+	for i := range rules {
+		if !replyIDMatches(rules[i].Keywords, rules[i].CaseSensitive, replyID) {
+			continue
+		}
+		if response := keywordRuleResponse(&rules[i]); response != nil {
+			return response, true
+		}
+	}
+	return nil, false
+}
+
+// matchReplyFlowTrigger finds the flow with a trigger keyword equal to the ID
+// of a tapped button or picked list row
+func (a *App) matchReplyFlowTrigger(orgID uuid.UUID, accountName, replyID, lang string) *models.ChatbotFlow {
+	flows, err := a.getChatbotFlowsCached(orgID)
+	if err != nil {
+		a.Log.Error("Failed to fetch chatbot flows", "error", err)
+		return nil
+	}
+
+	var matched []*models.ChatbotFlow
+	for i := range flows {
+		if replyIDMatches(flows[i].TriggerKeywords, false, replyID) {
+			matched = append(matched, &flows[i])
+		}
+	}
+	return flowForLanguage(flowsForAccount(matched, accountName), lang)
+}
+
+// interactiveReplyPrompt describes a button tap or list pick to the AI, with the
+// option's ID as well as its title, since titles are often short or ambiguous
+func interactiveReplyPrompt(replyType, replyID, title string) string {
+	switch replyType {
+	case "list":
+		return fmt.Sprintf("The customer picked %q (option ID: %s) from the list.", title, replyID)
+	case "template_button":
+		return fmt.Sprintf("The customer tapped the %q button of our message (payload: %s).", title, replyID)
+	}
+	return fmt.Sprintf("The customer tapped the %q button (option ID: %s).", title, replyID)
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplyIDMatches(t *testing.T) {
+	assert.True(t, replyIDMatches([]string{"menu", "billing"}, false, "billing"))
+	assert.True(t, replyIDMatches([]string{"Billing"}, false, "billing"))
+	assert.False(t, replyIDMatches([]string{"Billing"}, true, "billing"))
+	assert.False(t, replyIDMatches([]string{"bill"}, false, "billing"), "IDs are matched whole")
+	assert.False(t, replyIDMatches(nil, false, "billing"))
+}
+
+func TestInteractiveReplyPrompt(t *testing.T) {
+	assert.Equal(t, `The customer picked "Track order" (option ID: track) from the list.`,
+		interactiveReplyPrompt("list", "track", "Track order"))
+	assert.Equal(t, `The customer tapped the "Yes" button (option ID: confirm_yes).`,
+		interactiveReplyPrompt("button", "confirm_yes", "Yes"))
+	assert.Contains(t, interactiveReplyPrompt("template_button", "STOP_PROMOS", "Stop promotions"), "payload: STOP_PROMOS")
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// InvitationRequest invites someone to the organization
+type InvitationRequest struct {
+	Email  string     `json:"email"`
+	RoleID *uuid.UUID `json:"role_id"`
+}
+
+// InvitationResponse is an invitation with its current status
+type InvitationResponse struct {
+	models.Invitation
+	Status models.InvitationStatus `json:"status"`
+}
+
+// InvitationCreatedResponse includes the invite link, which is only available when the
+// invitation is created or resent
+type InvitationCreatedResponse struct {
+	Invitation InvitationResponse `json:"invitation"`
+	InviteURL  string             `json:"invite_url"`
+	EmailSent  bool               `json:"email_sent"`
+}
+
+// AcceptInvitationRequest creates the invitee's account
+type AcceptInvitationRequest struct {
+	Token    string `json:"token"`
+	FullName string `json:"full_name"`
+	Password string `json:"password"`
+}
+
+// errInvitationUnavailable is returned for invitations that were accepted, revoked or have expired
+var errInvitationUnavailable = errors.New("This invitation is no longer valid")
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func toInvitationResponse(inv models.Invitation) InvitationResponse {
+	return InvitationResponse{Invitation: inv, Status: inv.Status(time.Now())}
+}
+
+// ListInvitations lists the organization's invitations, newest first
+func (a *App) ListInvitations(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceUsers, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	query := a.DB.Where("organization_id = ?", orgID)
+	now := time.Now()
+	switch models.InvitationStatus(r.RequestCtx.QueryArgs().Peek("status")) {
+	case models.InvitationStatusPending:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+	case models.InvitationStatusAccepted:
+		query = query.Where("accepted_at IS NOT NULL")
+	case models.InvitationStatusRevoked:
+		query = query.Where("revoked_at IS NOT NULL")
+	case models.InvitationStatusExpired:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	}
+
+	var invitations []models.Invitation
+	if err := query.Preload("Role").Order("created_at DESC").Limit(500).Find(&invitations).Error; err != nil {
+		a.Log.Error("Failed to list invitations", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list invitations", nil, "")
+	}
+
+	result := make([]InvitationResponse, 0, len(invitations))
+	for _, inv := range invitations {
+		result = append(result, toInvitationResponse(inv))
+	}
+	return r.SendEnvelope(map[string]interface{}{"invitations": result})
+}
+
+// CreateInvitation invites someone by email. An earlier pending invitation for the same
+// email is replaced.
+func (a *App) CreateInvitation(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceUsers, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req InvitationRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	address, err := mail.ParseAddress(strings.TrimSpace(req.Email))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid email", nil, "")
+	}
+	email := address.Address
+
+	var existing int64
+	a.DB.Model(&models.User{}).Where("email = ?", email).Count(&existing)
+	if existing > 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusConflict, "A user with this email already exists", nil, "")
+	}
+
+	// Determine role, falling back to the default role like CreateUser
+	var role models.CustomRole
+	if req.RoleID != nil {
+		if err := a.DB.Where("id = ? AND organization_id = ?", req.RoleID, orgID).First(&role).Error; err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid role", nil, "")
+		}
+	} else if err := a.DB.Where("organization_id = ? AND is_default = ?", orgID, true).First(&role).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "role_id is required", nil, "")
+	}
+
+	// Enforce the plan's agent limit up front, so invitees don't find out when accepting
+	if err := a.checkQuota(orgID, models.UsageMetricAgents, 1); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, err.Error(), nil, "")
+	}
+
+	now := time.Now()
+	token := generateRandomString(43)
+	invitation := models.Invitation{
+		OrganizationID: orgID,
+		Email:          email,
+		RoleID:         &role.ID,
+		TokenHash:      hashInvitationToken(token),
+		InvitedByID:    &userID,
+		ExpiresAt:      now.Add(models.InvitationExpiry),
+	}
+
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Invitation{}).
+			Where("organization_id = ? AND email = ? AND accepted_at IS NULL AND revoked_at IS NULL", orgID, email).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invitation).Error
+	})
+	if err != nil {
+		a.Log.Error("Failed to create invitation", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create invitation", nil, "")
+	}
+	invitation.Role = &role
+
+	a.recordAudit(r, models.AuditLog{
+		OrganizationID: orgID,
+		Action:         models.AuditActionCreate,
+		ResourceType:   models.AuditResourceInvitation,
+		ResourceID:     &invitation.ID,
+		ResourceName:   email,
+	}, nil, map[string]interface{}{"email": email, "role": role.Name})
+
+	return r.SendEnvelope(a.sendInvitation(r, &invitation, token))
+}
+
+// ResendInvitation issues a new link for a pending or expired invitation and emails it again
+func (a *App) ResendInvitation(r *fastglue.Request) error {
+	invitation, errResp := a.loadOrgInvitation(r)
+	if errResp != nil {
+		return errResp()
+	}
+	if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Only pending or expired invitations can be resent", nil, "")
+	}
+
+	token := generateRandomString(43)
+	invitation.TokenHash = hashInvitationToken(token)
+	invitation.ExpiresAt = time.Now().Add(models.InvitationExpiry)
+	if err := a.DB.Model(invitation).Updates(map[string]interface{}{
+		"token_hash": invitation.TokenHash,
+		"expires_at": invitation.ExpiresAt,
+	}).Error; err != nil {
+		a.Log.Error("Failed to resend invitation", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to resend invitation", nil, "")
+	}
+
+	return r.SendEnvelope(a.sendInvitation(r, invitation, token))
+}
+
+// RevokeInvitation cancels a pending invitation
+func (a *App) RevokeInvitation(r *fastglue.Request) error {
+	invitation, errResp := a.loadOrgInvitation(r)
+	if errResp != nil {
+		return errResp()
+	}
+	if invitation.AcceptedAt != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invitation was already accepted", nil, "")
+	}
+	if invitation.RevokedAt != nil {
+		return r.SendEnvelope(toInvitationResponse(*invitation))
+	}
+
+	now := time.Now()
+	if err := a.DB.Model(invitation).Update("revoked_at", now).Error; err != nil {
+		a.Log.Error("Failed to revoke invitation", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to revoke invitation", nil, "")
+	}
+	invitation.RevokedAt = &now
+
+	a.recordAudit(r, models.AuditLog{
+		OrganizationID: invitation.OrganizationID,
+		Action:         models.AuditActionRevoke,
+		ResourceType:   models.AuditResourceInvitation,
+		ResourceID:     &invitation.ID,
+		ResourceName:   invitation.Email,
+	}, map[string]interface{}{"revoked_at": nil}, map[string]interface{}{"revoked_at": now})
+
+	return r.SendEnvelope(toInvitationResponse(*invitation))
+}
+
+// loadOrgInvitation loads the invitation in the path for a user allowed to manage invitations
+func (a *App) loadOrgInvitation(r *fastglue.Request) (*models.Invitation, func() error) {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return nil, func() error { return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "") }
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceUsers, models.ActionWrite) {
+		return nil, func() error {
+			return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+		}
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, func() error { return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid invitation ID", nil, "") }
+	}
+
+	var invitation models.Invitation
+	if err := a.DB.Preload("Role").Where("id = ? AND organization_id = ?", id, orgID).First(&invitation).Error; err != nil {
+		return nil, func() error { return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Invitation not found", nil, "") }
+	}
+	return &invitation, nil
+}
+
+// sendInvitation emails the invite link when SMTP is configured. The link is returned
+// either way, so admins can share it themselves.
+func (a *App) sendInvitation(r *fastglue.Request, invitation *models.Invitation, token string) InvitationCreatedResponse {
+	inviteURL := fmt.Sprintf("%s/invite?token=%s", a.requestBaseURL(r), url.QueryEscape(token))
+	resp := InvitationCreatedResponse{
+		Invitation: toInvitationResponse(*invitation),
+		InviteURL:  inviteURL,
+	}
+	if !a.emailEnabled() {
+		return resp
+	}
+
+	var org models.Organization
+	a.DB.Select("id", "name").Where("id = ?", invitation.OrganizationID).First(&org)
+	subject := fmt.Sprintf("You're invited to join %s on Whatomate", org.Name)
+	body := fmt.Sprintf("You've been invited to join %s.\n\nAccept the invitation and set up your account:\n%s\n\nThis link expires on %s.\n",
+		org.Name, inviteURL, invitation.ExpiresAt.UTC().Format("2 Jan 2006 15:04 MST"))
+	if err := a.sendEmail([]string{invitation.Email}, subject, body); err != nil {
+		a.Log.Error("Failed to send invitation email", "error", err, "invitation_id", invitation.ID)
+		return resp
+	}
+	resp.EmailSent = true
+	return resp
+}
+
+// findInvitation returns the pending invitation for a token
+func (a *App) findInvitation(token string) (*models.Invitation, error) {
+	if token == "" {
+		return nil, errInvitationUnavailable
+	}
+	var invitation models.Invitation
+	if err := a.DB.Preload("Organization").Preload("Role").
+		Where("token_hash = ?", hashInvitationToken(token)).
+		First(&invitation).Error; err != nil {
+		return nil, errInvitationUnavailable
+	}
+	if invitation.Status(time.Now()) != models.InvitationStatusPending {
+		return nil, errInvitationUnavailable
+	}
+	return &invitation, nil
+}
+
+// GetInvitation shows an invitee what they were invited to (public, authenticated by the token)
+func (a *App) GetInvitation(r *fastglue.Request) error {
+	invitation, err := a.findInvitation(string(r.RequestCtx.QueryArgs().Peek("token")))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, err.Error(), nil, "")
+	}
+
+	resp := map[string]interface{}{
+		"email":             invitation.Email,
+		"expires_at":        invitation.ExpiresAt,
+		"password_required": !ssoEnforced(invitation.Organization), // SSO-only organizations sign in through their provider
+	}
+	if invitation.Organization != nil {
+		resp["organization_name"] = invitation.Organization.Name
+	}
+	if invitation.Role != nil {
+		resp["role"] = invitation.Role.Name
+	}
+	return r.SendEnvelope(resp)
+}
+
+// AcceptInvitation creates the invitee's account in the organization (public, authenticated
+// by the token). The invitee then logs in as usual, so SSO and 2FA policies apply.
+func (a *App) AcceptInvitation(r *fastglue.Request) error {
+	var req AcceptInvitationRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	invitation, err := a.findInvitation(req.Token)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, err.Error(), nil, "")
+	}
+
+	req.FullName = strings.TrimSpace(req.FullName)
+	if req.FullName == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "full_name is required", nil, "")
+	}
+
+	// Organizations enforcing SSO sign in through their provider, so a password is optional
+	var passwordHash string
+	if req.Password != "" || !ssoEnforced(invitation.Organization) {
+		if len(req.Password) < 6 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Password must be at least 6 characters", nil, "")
+		}
+		hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			a.Log.Error("Failed to hash password", "error", err)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create account", nil, "")
+		}
+		passwordHash = string(hashed)
+	}
+
+	var existing int64
+	a.DB.Model(&models.User{}).Where("email = ?", invitation.Email).Count(&existing)
+	if existing > 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusConflict, "A user with this email already exists", nil, "")
+	}
+
+	if err := a.checkQuota(invitation.OrganizationID, models.UsageMetricAgents, 1); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, err.Error(), nil, "")
+	}
+
+	user := models.User{
+		OrganizationID: invitation.OrganizationID,
+		Email:          invitation.Email,
+		PasswordHash:   passwordHash,
+		FullName:       req.FullName,
+		RoleID:         invitation.RoleID,
+		IsActive:       true,
+		IsAvailable:    true,
+	}
+
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		// The conditions stop the same invitation being accepted twice
+		result := tx.Model(&models.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+			Updates(map[string]interface{}{"accepted_at": time.Now(), "user_id": user.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvitationUnavailable
+		}
+		return nil
+	})
+	if errors.Is(err, errInvitationUnavailable) {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, err.Error(), nil, "")
+	}
+	if err != nil {
+		a.Log.Error("Failed to accept invitation", "error", err, "invitation_id", invitation.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create account", nil, "")
+	}
+	a.syncAgentUsage(invitation.OrganizationID)
+	a.Log.Info("Invitation accepted", "invitation_id", invitation.ID, "user_id", user.ID)
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Account created. You can now sign in.",
+		"email":   user.Email,
+		"user_id": user.ID,
+	})
+}
@@ -0,0 +1,97 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_Invitation_CreateAndAccept(t *testing.T) {
+	app := testApp(t)
+	org := createTestOrganization(t, app)
+	permissions := getOrCreateTestPermissions(t, app)
+	adminRole := createTestRole(t, app, org.ID, "Admin", true, false, permissions)
+	agentRole := createTestRole(t, app, org.ID, "Agent", false, true, permissions[:1])
+	admin := createTestUser(t, app, org.ID, uniqueEmail("inviter"), "password123", &adminRole.ID, true)
+
+	email := uniqueEmail("invitee")
+	req := testutil.NewJSONRequest(t, map[string]interface{}{"email": email, "role_id": agentRole.ID})
+	req.RequestCtx.SetUserValue("user_id", admin.ID)
+	req.RequestCtx.SetUserValue("organization_id", org.ID)
+	require.NoError(t, app.CreateInvitation(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var created struct {
+		Data handlers.InvitationCreatedResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &created))
+	assert.Equal(t, models.InvitationStatusPending, created.Data.Invitation.Status)
+	inviteURL, err := url.Parse(created.Data.InviteURL)
+	require.NoError(t, err)
+	token := inviteURL.Query().Get("token")
+	require.NotEmpty(t, token)
+
+	req = testutil.NewGETRequest(t)
+	testutil.SetQueryParam(req, "token", token)
+	require.NoError(t, app.GetInvitation(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+	assert.Contains(t, string(testutil.GetResponseBody(req)), org.Name)
+
+	accept := map[string]string{"token": token, "full_name": "New Agent", "password": "secret123"}
+	req = testutil.NewJSONRequest(t, accept)
+	require.NoError(t, app.AcceptInvitation(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var user models.User
+	require.NoError(t, app.DB.Where("email = ?", email).First(&user).Error)
+	assert.Equal(t, org.ID, user.OrganizationID)
+	assert.Equal(t, agentRole.ID, *user.RoleID)
+
+	// The token can't be used twice
+	req = testutil.NewJSONRequest(t, accept)
+	require.NoError(t, app.AcceptInvitation(req))
+	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
+}
+
+func TestApp_Invitation_Revoked(t *testing.T) {
+	app := testApp(t)
+	org := createTestOrganization(t, app)
+	permissions := getOrCreateTestPermissions(t, app)
+	adminRole := createTestRole(t, app, org.ID, "Admin", true, true, permissions)
+	admin := createTestUser(t, app, org.ID, uniqueEmail("inviter"), "password123", &adminRole.ID, true)
+
+	req := testutil.NewJSONRequest(t, map[string]string{"email": uniqueEmail("invitee")})
+	req.RequestCtx.SetUserValue("user_id", admin.ID)
+	req.RequestCtx.SetUserValue("organization_id", org.ID)
+	require.NoError(t, app.CreateInvitation(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var created struct {
+		Data handlers.InvitationCreatedResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &created))
+
+	req = testutil.NewRequest(t)
+	req.RequestCtx.SetUserValue("user_id", admin.ID)
+	req.RequestCtx.SetUserValue("organization_id", org.ID)
+	req.RequestCtx.SetUserValue("id", created.Data.Invitation.ID.String())
+	require.NoError(t, app.RevokeInvitation(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	inviteURL, err := url.Parse(created.Data.InviteURL)
+	require.NoError(t, err)
+	req = testutil.NewJSONRequest(t, map[string]string{
+		"token":     inviteURL.Query().Get("token"),
+		"full_name": "Too Late",
+		"password":  "secret123",
+	})
+	require.NoError(t, app.AcceptInvitation(req))
+	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
+}
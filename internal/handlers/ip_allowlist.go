@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/netip"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// orgAllowedIPs returns the IPs and CIDR ranges an organization's members may use
+// the API from. Empty allows any IP.
+func orgAllowedIPs(org *models.Organization) []string {
+	values, _ := org.Settings["allowed_ips"].([]interface{})
+	allowed := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok && s != "" {
+			allowed = append(allowed, s)
+		}
+	}
+	return allowed
+}
+
+// OrgAllowedIPRanges returns the IP ranges an organization's members may use the
+// API from, nil when any IP is allowed. Organizations whose list can't be loaded
+// aren't restricted, like the other organization checks of API requests.
+func (a *App) OrgAllowedIPRanges(orgID uuid.UUID) []netip.Prefix {
+	allowed, err := a.getOrgAllowedIPsCached(orgID)
+	if err != nil {
+		a.Log.Error("Failed to load organization allowed IPs", "error", err, "org_id", orgID)
+		return nil
+	}
+	ranges, err := config.ParseIPRanges(allowed)
+	if err != nil {
+		a.Log.Error("Invalid organization allowed IPs", "error", err, "org_id", orgID)
+		return nil
+	}
+	return ranges
+}
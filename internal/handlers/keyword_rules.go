@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// validateKeywordRule checks a rule's regexes and that its response has what
+// its type needs, so rules don't silently never fire
+func validateKeywordRule(keywords []string, matchType models.MatchType, responseType models.ResponseType, content map[string]interface{}) error {
+	switch matchType {
+	case models.MatchTypeExact, models.MatchTypeContains, models.MatchTypeStartsWith:
+	case models.MatchTypeRegex:
+		for _, keyword := range keywords {
+			if _, err := regexp.Compile(keyword); err != nil {
+				return fmt.Errorf("invalid regex %q", keyword)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown match type: %s", matchType)
+	}
+
+	switch responseType {
+	case models.ResponseTypeText:
+		if strings.TrimSpace(getStringFromMap(content, "body")) == "" {
+			return errors.New("body is required for text responses")
+		}
+	case models.ResponseTypeTemplate:
+		if _, err := uuid.Parse(getStringFromMap(content, "template_id")); err != nil {
+			return errors.New("template_id is required for template responses")
+		}
+	case models.ResponseTypeTag:
+		if strings.TrimSpace(getStringFromMap(content, "tag")) == "" {
+			return errors.New("tag is required for tag responses")
+		}
+	case models.ResponseTypeList:
+		body := getStringFromMap(content, "body")
+		if strings.TrimSpace(body) == "" {
+			return errors.New("body is required for list responses")
+		}
+		if err := listMessageFromConfig(body, content).Validate(); err != nil {
+			return err
+		}
+	case models.ResponseTypeTransfer:
+	default:
+		return fmt.Errorf("unsupported response type: %s", responseType)
+	}
+	return nil
+}
+
+// keywordRuleResponse returns what a matched rule does, or nil when it has
+// nothing to do
+func keywordRuleResponse(rule *models.KeywordRule) *KeywordResponse {
+	response := &KeywordResponse{ResponseType: rule.ResponseType}
+	response.Body, _ = rule.ResponseContent["body"].(string)
+
+	switch rule.ResponseType {
+	case models.ResponseTypeTransfer:
+		// The body is the transfer message
+		return response
+	case models.ResponseTypeTemplate:
+		response.TemplateID, _ = rule.ResponseContent["template_id"].(string)
+		if params, ok := rule.ResponseContent["params"].(map[string]interface{}); ok {
+			response.TemplateParams = jsonbToStringMap(params)
+		}
+		if response.TemplateID == "" {
+			return nil
+		}
+		return response
+	case models.ResponseTypeTag:
+		tag, _ := rule.ResponseContent["tag"].(string)
+		response.Tag = strings.TrimSpace(tag)
+		if response.Tag == "" {
+			return nil
+		}
+		return response
+	case models.ResponseTypeList:
+		list := listMessageFromConfig(response.Body, rule.ResponseContent)
+		response.List = &list
+	}
+
+	// Get buttons if present
+	if buttons, ok := rule.ResponseContent["buttons"].([]interface{}); ok && len(buttons) > 0 {
+		response.Buttons = make([]map[string]interface{}, 0, len(buttons))
+		for _, btn := range buttons {
+			if btnMap, ok := btn.(map[string]interface{}); ok {
+				response.Buttons = append(response.Buttons, btnMap)
+			}
+		}
+	}
+
+	if response.Body == "" {
+		return nil
+	}
+	return response
+}
+
+// tagContactFromKeyword adds a keyword rule's tag to the contact
+func (a *App) tagContactFromKeyword(contact *models.Contact, tag string) {
+	tags := updateContactTags(contact.Tags, tag, true)
+	if len(tags) == len(contact.Tags) {
+		return
+	}
+	if err := a.DB.Model(contact).Update("tags", tags).Error; err != nil {
+		a.Log.Error("Failed to tag contact from keyword rule", "error", err, "contact_id", contact.ID, "tag", tag)
+		return
+	}
+	contact.Tags = tags
+}
+
+// sendKeywordTemplate sends the approved template of a keyword rule
+func (a *App) sendKeywordTemplate(account *models.WhatsAppAccount, contact *models.Contact, response *KeywordResponse) error {
+	var template models.Template
+	if err := a.DB.Where("id = ? AND organization_id = ? AND whats_app_account = ?", response.TemplateID, account.OrganizationID, account.Name).
+		First(&template).Error; err != nil {
+		return fmt.Errorf("template not found")
+	}
+	if template.Status != string(models.TemplateStatusApproved) {
+		return fmt.Errorf("template is not approved (status: %s)", template.Status)
+	}
+	_, err := a.SendOutgoingMessage(context.Background(), OutgoingMessageRequest{
+		Account:    account,
+		Contact:    contact,
+		Type:       models.MessageTypeTemplate,
+		Template:   &template,
+		BodyParams: response.TemplateParams,
+	}, ChatbotSendOptions())
+	return err
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateKeywordRule(t *testing.T) {
+	text := map[string]interface{}{"body": "We're open 9-5."}
+	assert.NoError(t, validateKeywordRule([]string{"hours"}, models.MatchTypeContains, models.ResponseTypeText, text))
+	assert.NoError(t, validateKeywordRule([]string{`^order\s+#?\d+$`}, models.MatchTypeRegex, models.ResponseTypeText, text))
+	assert.Error(t, validateKeywordRule([]string{"order ("}, models.MatchTypeRegex, models.ResponseTypeText, text))
+	assert.Error(t, validateKeywordRule([]string{"hours"}, "fuzzy", models.ResponseTypeText, text))
+	assert.Error(t, validateKeywordRule([]string{"hours"}, models.MatchTypeExact, models.ResponseTypeText, nil))
+
+	assert.NoError(t, validateKeywordRule([]string{"agent"}, models.MatchTypeExact, models.ResponseTypeTransfer, nil))
+	assert.NoError(t, validateKeywordRule([]string{"promo"}, models.MatchTypeContains, models.ResponseTypeTemplate,
+		map[string]interface{}{"template_id": uuid.New().String()}))
+	assert.Error(t, validateKeywordRule([]string{"promo"}, models.MatchTypeContains, models.ResponseTypeTemplate,
+		map[string]interface{}{"template_id": "spring_sale"}))
+	assert.NoError(t, validateKeywordRule([]string{"wholesale"}, models.MatchTypeContains, models.ResponseTypeTag,
+		map[string]interface{}{"tag": "wholesale"}))
+	assert.Error(t, validateKeywordRule([]string{"wholesale"}, models.MatchTypeContains, models.ResponseTypeTag,
+		map[string]interface{}{"tag": " "}))
+	list := map[string]interface{}{
+		"body": "What do you need help with?",
+		"sections": []interface{}{map[string]interface{}{"rows": []interface{}{
+			map[string]interface{}{"id": "billing", "title": "Billing"},
+		}}},
+	}
+	assert.NoError(t, validateKeywordRule([]string{"help"}, models.MatchTypeExact, models.ResponseTypeList, list))
+	assert.Error(t, validateKeywordRule([]string{"help"}, models.MatchTypeExact, models.ResponseTypeList, text), "lists need rows")
+	assert.Error(t, validateKeywordRule([]string{"menu"}, models.MatchTypeContains, models.ResponseTypeScript, text))
+}
+
+func TestKeywordRuleResponse(t *testing.T) {
+	templateID := uuid.New().String()
+	response := keywordRuleResponse(&models.KeywordRule{
+		ResponseType:    models.ResponseTypeTemplate,
+		ResponseContent: models.JSONB{"template_id": templateID, "params": map[string]interface{}{"1": "SPRING10"}},
+	})
+	require.NotNil(t, response)
+	assert.Equal(t, templateID, response.TemplateID)
+	assert.Equal(t, map[string]string{"1": "SPRING10"}, response.TemplateParams)
+
+	response = keywordRuleResponse(&models.KeywordRule{
+		ResponseType:    models.ResponseTypeTag,
+		ResponseContent: models.JSONB{"tag": " wholesale "},
+	})
+	require.NotNil(t, response)
+	assert.Equal(t, "wholesale", response.Tag)
+	assert.Empty(t, response.Body)
+
+	response = keywordRuleResponse(&models.KeywordRule{
+		ResponseType:    models.ResponseTypeTransfer,
+		ResponseContent: models.JSONB{},
+	})
+	require.NotNil(t, response, "transfers don't need a message")
+
+	response = keywordRuleResponse(&models.KeywordRule{
+		ResponseType: models.ResponseTypeList,
+		ResponseContent: models.JSONB{
+			"body":        "What do you need help with?",
+			"button_text": "Topics",
+			"sections": []interface{}{map[string]interface{}{"rows": []interface{}{
+				map[string]interface{}{"id": "billing", "title": "Billing"},
+			}}},
+		},
+	})
+	require.NotNil(t, response)
+	require.NotNil(t, response.List)
+	assert.Equal(t, "What do you need help with?", response.List.Body)
+	assert.Equal(t, "Topics", response.List.ButtonText)
+	assert.Equal(t, "billing", response.List.Sections[0].Rows[0].ID)
+
+	assert.Nil(t, keywordRuleResponse(&models.KeywordRule{
+		ResponseType:    models.ResponseTypeText,
+		ResponseContent: models.JSONB{"body": ""},
+	}))
+}
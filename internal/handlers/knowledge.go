@@ -0,0 +1,609 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+const (
+	// knowledgeChunkSize is the length of the passages documents are split into, in bytes
+	knowledgeChunkSize = 1200
+	// maxKnowledgeDocumentSize limits the text of a document
+	maxKnowledgeDocumentSize = 512 * 1024
+	// maxKnowledgeChunks limits the passages of an organization, as retrieval
+	// compares the message with each of them
+	maxKnowledgeChunks = 5000
+	// maxKnowledgeTopK limits the passages added to a prompt
+	maxKnowledgeTopK = 10
+)
+
+// knowledgeFileTypes are the extensions of the text documents that can be uploaded
+var knowledgeFileTypes = map[string]bool{".txt": true, ".md": true, ".markdown": true}
+
+// KnowledgeDocumentRequest creates or updates a document or FAQ entry
+type KnowledgeDocumentRequest struct {
+	Source   models.KnowledgeSource `json:"source"`
+	Title    string                 `json:"title"`
+	Content  string                 `json:"content"`
+	Question string                 `json:"question"` // FAQ entries
+	Answer   string                 `json:"answer"`   // FAQ entries
+}
+
+// KnowledgeDocumentResponse is a knowledge base entry
+type KnowledgeDocumentResponse struct {
+	ID             uuid.UUID              `json:"id"`
+	Source         models.KnowledgeSource `json:"source"`
+	Title          string                 `json:"title"`
+	Content        string                 `json:"content"`
+	FileName       string                 `json:"file_name,omitempty"`
+	Status         models.KnowledgeStatus `json:"status"`
+	Error          string                 `json:"error,omitempty"`
+	ChunkCount     int                    `json:"chunk_count"`
+	EmbeddingModel string                 `json:"embedding_model"`
+	CreatedAt      string                 `json:"created_at"`
+	UpdatedAt      string                 `json:"updated_at"`
+}
+
+// KnowledgeMatch is a passage retrieved for a message
+type KnowledgeMatch struct {
+	DocumentID uuid.UUID `json:"document_id"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content"`
+	Score      float64   `json:"score"`
+}
+
+func knowledgeDocumentToResponse(doc models.KnowledgeDocument) KnowledgeDocumentResponse {
+	return KnowledgeDocumentResponse{
+		ID:             doc.ID,
+		Source:         doc.Source,
+		Title:          doc.Title,
+		Content:        doc.Content,
+		FileName:       doc.FileName,
+		Status:         doc.Status,
+		Error:          doc.Error,
+		ChunkCount:     doc.ChunkCount,
+		EmbeddingModel: doc.EmbeddingModel,
+		CreatedAt:      doc.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:      doc.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// normalizeKnowledgeRequest checks a document or FAQ entry and returns its title and content
+func normalizeKnowledgeRequest(req KnowledgeDocumentRequest) (models.KnowledgeSource, string, string, error) {
+	source := req.Source
+	if source == "" {
+		source = models.KnowledgeSourceDocument
+	}
+	title, content := req.Title, req.Content
+	switch source {
+	case models.KnowledgeSourceFAQ:
+		title, content = req.Question, req.Answer
+		if strings.TrimSpace(title) == "" || strings.TrimSpace(content) == "" {
+			return "", "", "", errors.New("question and answer are required")
+		}
+	case models.KnowledgeSourceDocument:
+		if strings.TrimSpace(title) == "" || strings.TrimSpace(content) == "" {
+			return "", "", "", errors.New("title and content are required")
+		}
+	default:
+		return "", "", "", errors.New("source must be document or faq")
+	}
+	if len(title) > 255 {
+		return "", "", "", errors.New("title must be 255 characters or fewer")
+	}
+	if len(content) > maxKnowledgeDocumentSize {
+		return "", "", "", fmt.Errorf("content must be %d KB or smaller", maxKnowledgeDocumentSize/1024)
+	}
+	return source, strings.TrimSpace(title), strings.TrimSpace(content), nil
+}
+
+// chunkKnowledgeText splits text into passages of about knowledgeChunkSize bytes,
+// keeping paragraphs together when they fit
+func chunkKnowledgeText(text string) []string {
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if chunk := strings.TrimSpace(current.String()); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if current.Len() > 0 && current.Len()+2+len(paragraph) > knowledgeChunkSize {
+			flush()
+		}
+		if len(paragraph) <= knowledgeChunkSize {
+			if current.Len() > 0 {
+				current.WriteString("\n\n")
+			}
+			current.WriteString(paragraph)
+			continue
+		}
+
+		// Split long paragraphs between words
+		for _, word := range strings.Fields(paragraph) {
+			for len(word) > knowledgeChunkSize {
+				flush()
+				cut := knowledgeChunkSize
+				for cut > 0 && !utf8.RuneStart(word[cut]) {
+					cut--
+				}
+				chunks = append(chunks, word[:cut])
+				word = word[cut:]
+			}
+			if current.Len() > 0 && current.Len()+1+len(word) > knowledgeChunkSize {
+				flush()
+			}
+			if current.Len() > 0 {
+				current.WriteString(" ")
+			}
+			current.WriteString(word)
+		}
+		flush()
+	}
+	flush()
+	return chunks
+}
+
+// knowledgeChunks returns the passages a document is embedded as. FAQ entries
+// are a single passage with their question.
+func knowledgeChunks(doc *models.KnowledgeDocument) []string {
+	if doc.Source == models.KnowledgeSourceFAQ {
+		return []string{"Q: " + doc.Title + "\nA: " + doc.Content}
+	}
+	chunks := chunkKnowledgeText(doc.Content)
+	for i, chunk := range chunks {
+		chunks[i] = doc.Title + "\n\n" + chunk
+	}
+	return chunks
+}
+
+// orgChatbotSettings returns the organization-level chatbot settings
+func (a *App) orgChatbotSettings(orgID uuid.UUID) (*models.ChatbotSettings, error) {
+	var settings models.ChatbotSettings
+	if err := a.DB.Where("organization_id = ? AND whats_app_account = ?", orgID, "").First(&settings).Error; err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// indexKnowledgeDocument splits a document into passages and embeds them. The
+// document is marked ready, or failed with the error.
+func (a *App) indexKnowledgeDocument(docID uuid.UUID) error {
+	var doc models.KnowledgeDocument
+	if err := a.DB.Where("id = ?", docID).First(&doc).Error; err != nil {
+		return err
+	}
+
+	err := a.embedKnowledgeDocument(&doc)
+	if err != nil {
+		a.Log.Error("Failed to index knowledge document", "error", err, "document_id", doc.ID)
+		a.DB.Model(&doc).Updates(map[string]interface{}{
+			"status": models.KnowledgeStatusFailed,
+			"error":  err.Error(),
+		})
+	}
+	return err
+}
+
+func (a *App) embedKnowledgeDocument(doc *models.KnowledgeDocument) error {
+	settings, err := a.orgChatbotSettings(doc.OrganizationID)
+	if err != nil {
+		return errors.New("chatbot settings not found")
+	}
+	cfg, ok := knowledgeEmbeddingConfig(settings)
+	if !ok {
+		return errors.New("no embedding provider configured")
+	}
+
+	texts := knowledgeChunks(doc)
+	var existing int64
+	a.DB.Model(&models.KnowledgeChunk{}).
+		Where("organization_id = ? AND document_id != ?", doc.OrganizationID, doc.ID).
+		Count(&existing)
+	if existing+int64(len(texts)) > maxKnowledgeChunks {
+		return fmt.Errorf("the knowledge base is limited to %d passages", maxKnowledgeChunks)
+	}
+
+	embeddings, tokens, err := a.embedTexts(context.Background(), cfg, texts)
+	if err != nil {
+		return err
+	}
+	a.recordAIUsage(settings, nil, &aiCompletion{Provider: cfg.Provider, Model: cfg.Model, PromptTokens: tokens})
+
+	chunks := make([]models.KnowledgeChunk, len(texts))
+	for i, text := range texts {
+		chunks[i] = models.KnowledgeChunk{
+			BaseModel:      models.BaseModel{ID: uuid.New()},
+			OrganizationID: doc.OrganizationID,
+			DocumentID:     doc.ID,
+			Position:       i,
+			Content:        text,
+			Embedding:      embeddings[i],
+		}
+	}
+
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("document_id = ?", doc.ID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+			return err
+		}
+		if len(chunks) > 0 {
+			if err := tx.CreateInBatches(chunks, 100).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(doc).Updates(map[string]interface{}{
+			"status":          models.KnowledgeStatusReady,
+			"error":           "",
+			"chunk_count":     len(chunks),
+			"embedding_model": cfg.name(),
+		}).Error
+	})
+}
+
+// indexKnowledgeDocumentsAsync indexes documents in the background
+func (a *App) indexKnowledgeDocumentsAsync(docIDs ...uuid.UUID) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		for _, id := range docIDs {
+			_ = a.indexKnowledgeDocument(id)
+		}
+	}()
+}
+
+// searchKnowledge returns the passages of the organization's knowledge base
+// closest to the query. Passages embedded with another model are skipped until
+// they are reindexed.
+func (a *App) searchKnowledge(ctx context.Context, settings *models.ChatbotSettings, query string, topK int) ([]KnowledgeMatch, error) {
+	cfg, ok := knowledgeEmbeddingConfig(settings)
+	if !ok || topK <= 0 || strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+
+	var chunks []struct {
+		DocumentID uuid.UUID
+		Title      string
+		Content    string
+		Embedding  models.Embedding
+	}
+	if err := a.DB.Table("knowledge_chunks").
+		Select("knowledge_chunks.document_id, knowledge_documents.title, knowledge_chunks.content, knowledge_chunks.embedding").
+		Joins("JOIN knowledge_documents ON knowledge_documents.id = knowledge_chunks.document_id AND knowledge_documents.deleted_at IS NULL").
+		Where("knowledge_chunks.organization_id = ? AND knowledge_chunks.deleted_at IS NULL", settings.OrganizationID).
+		Where("knowledge_documents.status = ? AND knowledge_documents.embedding_model = ?", models.KnowledgeStatusReady, cfg.name()).
+		Limit(maxKnowledgeChunks).
+		Scan(&chunks).Error; err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	embeddings, tokens, err := a.embedTexts(ctx, cfg, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	a.recordAIUsage(settings, nil, &aiCompletion{Provider: cfg.Provider, Model: cfg.Model, PromptTokens: tokens})
+
+	matches := make([]KnowledgeMatch, len(chunks))
+	for i, chunk := range chunks {
+		matches[i] = KnowledgeMatch{
+			DocumentID: chunk.DocumentID,
+			Title:      chunk.Title,
+			Content:    chunk.Content,
+			Score:      cosineSimilarity(embeddings[0], chunk.Embedding),
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > topK {
+		matches = matches[:topK]
+	}
+	return matches, nil
+}
+
+// buildKnowledgeContext returns the knowledge base passages closest to the
+// message, formatted for the AI prompt
+func (a *App) buildKnowledgeContext(ctx context.Context, orgID uuid.UUID, userMessage string) string {
+	settings, err := a.orgChatbotSettings(orgID)
+	if err != nil {
+		return ""
+	}
+	matches, err := a.searchKnowledge(ctx, settings, userMessage, min(settings.AI.KnowledgeTopK, maxKnowledgeTopK))
+	if err != nil {
+		a.log(ctx).Error("Failed to search knowledge base", "error", err, "organization_id", orgID)
+		return ""
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Answer from these knowledge base excerpts when they cover the question. If they don't, say you don't know rather than guessing.")
+	for i, match := range matches {
+		fmt.Fprintf(&sb, "\n\n[%d] %s", i+1, match.Content)
+	}
+	return sb.String()
+}
+
+// ListKnowledgeDocuments returns the organization's knowledge base entries
+func (a *App) ListKnowledgeDocuments(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChatbotAI, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	query := a.DB.Where("organization_id = ?", orgID)
+	if source := string(r.RequestCtx.QueryArgs().Peek("source")); source != "" {
+		query = query.Where("source = ?", source)
+	}
+	if search := string(r.RequestCtx.QueryArgs().Peek("search")); search != "" {
+		searchPattern := "%" + search + "%"
+		query = query.Where("title ILIKE ? OR content ILIKE ?", searchPattern, searchPattern)
+	}
+
+	var docs []models.KnowledgeDocument
+	if err := query.Order("created_at DESC").Find(&docs).Error; err != nil {
+		a.Log.Error("Failed to list knowledge documents", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list knowledge documents", nil, "")
+	}
+
+	result := make([]KnowledgeDocumentResponse, len(docs))
+	for i, doc := range docs {
+		result[i] = knowledgeDocumentToResponse(doc)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"documents": result,
+	})
+}
+
+// CreateKnowledgeDocument adds a document or FAQ entry to the knowledge base and
+// indexes it in the background. Text documents can also be uploaded as a "file".
+func (a *App) CreateKnowledgeDocument(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChatbotAI, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req KnowledgeDocumentRequest
+	var fileName string
+	if bytes.HasPrefix(r.RequestCtx.Request.Header.ContentType(), []byte("multipart/form-data")) {
+		fileHeader, err := r.RequestCtx.FormFile("file")
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "No file provided", nil, "")
+		}
+		if !knowledgeFileTypes[strings.ToLower(filepath.Ext(fileHeader.Filename))] {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Only .txt and .md documents can be uploaded", nil, "")
+		}
+		if fileHeader.Size > maxKnowledgeDocumentSize {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Documents must be %d KB or smaller", maxKnowledgeDocumentSize/1024), nil, "")
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to open uploaded file", nil, "")
+		}
+		defer func() { _ = file.Close() }()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to read file data", nil, "")
+		}
+		if !utf8.Valid(data) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Documents must be UTF-8 text", nil, "")
+		}
+
+		fileName = filepath.Base(fileHeader.Filename)
+		req = KnowledgeDocumentRequest{
+			Source:  models.KnowledgeSourceDocument,
+			Title:   string(r.RequestCtx.FormValue("title")),
+			Content: string(data),
+		}
+		if req.Title == "" {
+			req.Title = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+		}
+	} else if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	source, title, content, err := normalizeKnowledgeRequest(req)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	doc := models.KnowledgeDocument{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: orgID,
+		Source:         source,
+		Title:          title,
+		Content:        content,
+		FileName:       fileName,
+		Status:         models.KnowledgeStatusPending,
+		CreatedByID:    &userID,
+	}
+	if err := a.DB.Create(&doc).Error; err != nil {
+		a.Log.Error("Failed to create knowledge document", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create knowledge document", nil, "")
+	}
+
+	a.indexKnowledgeDocumentsAsync(doc.ID)
+	return r.SendEnvelope(knowledgeDocumentToResponse(doc))
+}
+
+// GetKnowledgeDocument returns a knowledge base entry
+func (a *App) GetKnowledgeDocument(r *fastglue.Request) error {
+	doc, err := a.knowledgeDocumentFromRequest(r, models.ActionRead)
+	if err != nil {
+		return err
+	}
+	return r.SendEnvelope(knowledgeDocumentToResponse(*doc))
+}
+
+// UpdateKnowledgeDocument replaces the text of a knowledge base entry and reindexes it
+func (a *App) UpdateKnowledgeDocument(r *fastglue.Request) error {
+	doc, err := a.knowledgeDocumentFromRequest(r, models.ActionWrite)
+	if err != nil {
+		return err
+	}
+
+	var req KnowledgeDocumentRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	req.Source = doc.Source
+	_, title, content, err := normalizeKnowledgeRequest(req)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	doc.Title = title
+	doc.Content = content
+	doc.Status = models.KnowledgeStatusPending
+	doc.Error = ""
+	if err := a.DB.Save(doc).Error; err != nil {
+		a.Log.Error("Failed to update knowledge document", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update knowledge document", nil, "")
+	}
+
+	a.indexKnowledgeDocumentsAsync(doc.ID)
+	return r.SendEnvelope(knowledgeDocumentToResponse(*doc))
+}
+
+// DeleteKnowledgeDocument removes an entry and its passages from the knowledge base
+func (a *App) DeleteKnowledgeDocument(r *fastglue.Request) error {
+	doc, err := a.knowledgeDocumentFromRequest(r, models.ActionWrite)
+	if err != nil {
+		return err
+	}
+
+	if err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("document_id = ?", doc.ID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(doc).Error
+	}); err != nil {
+		a.Log.Error("Failed to delete knowledge document", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete knowledge document", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]string{"message": "Knowledge document deleted"})
+}
+
+// ReindexKnowledgeBase embeds all entries again, e.g. after the embedding model changed
+func (a *App) ReindexKnowledgeBase(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChatbotAI, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var ids []uuid.UUID
+	if err := a.DB.Model(&models.KnowledgeDocument{}).Where("organization_id = ?", orgID).Pluck("id", &ids).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load knowledge documents", nil, "")
+	}
+	if len(ids) > 0 {
+		a.DB.Model(&models.KnowledgeDocument{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"status": models.KnowledgeStatusPending, "error": ""})
+		a.indexKnowledgeDocumentsAsync(ids...)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{"documents": len(ids)})
+}
+
+// SearchKnowledgeBase returns the passages the AI would get for a message
+func (a *App) SearchKnowledgeBase(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChatbotAI, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req struct {
+		Query string `json:"query"`
+		TopK  int    `json:"top_k"`
+	}
+	if err := r.Decode(&req, "json"); err != nil || strings.TrimSpace(req.Query) == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "query is required", nil, "")
+	}
+
+	settings, err := a.orgChatbotSettings(orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Configure the chatbot settings first", nil, "")
+	}
+	if _, ok := knowledgeEmbeddingConfig(settings); !ok {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "No embedding provider configured", nil, "")
+	}
+	topK := req.TopK
+	if topK <= 0 {
+		topK = settings.AI.KnowledgeTopK
+	}
+
+	matches, err := a.searchKnowledge(r.RequestCtx, settings, req.Query, min(max(topK, 1), maxKnowledgeTopK))
+	if err != nil {
+		a.Log.Error("Failed to search knowledge base", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to search knowledge base: "+err.Error(), nil, "")
+	}
+	if matches == nil {
+		matches = []KnowledgeMatch{}
+	}
+
+	return r.SendEnvelope(map[string]interface{}{"matches": matches})
+}
+
+// knowledgeDocumentFromRequest loads the knowledge base entry of the {id} path
+// parameter after checking the permission. Errors are sent as the response.
+func (a *App) knowledgeDocumentFromRequest(r *fastglue.Request, action string) (*models.KnowledgeDocument, error) {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return nil, r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceChatbotAI, action) {
+		return nil, r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	idStr, _ := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
+	}
+
+	var doc models.KnowledgeDocument
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&doc).Error; err != nil {
+		return nil, r.SendErrorEnvelope(fasthttp.StatusNotFound, "Knowledge document not found", nil, "")
+	}
+	return &doc, nil
+}
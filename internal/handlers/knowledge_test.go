@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkKnowledgeText(t *testing.T) {
+	assert.Empty(t, chunkKnowledgeText(" \n\n "))
+	assert.Equal(t, []string{"Short paragraph.\n\nAnother one."}, chunkKnowledgeText("Short paragraph.\r\n\r\nAnother one."))
+
+	long := strings.Repeat("word ", knowledgeChunkSize/2)
+	chunks := chunkKnowledgeText("Intro.\n\n" + long + "\n\nOutro.")
+	require.Greater(t, len(chunks), 2)
+	assert.Equal(t, "Intro.", chunks[0], "a paragraph that doesn't fit starts a new passage")
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), knowledgeChunkSize)
+	}
+	assert.Equal(t, "Outro.", chunks[len(chunks)-1])
+
+	faq := knowledgeChunks(&models.KnowledgeDocument{Source: models.KnowledgeSourceFAQ, Title: "Do you ship abroad?", Content: "Yes, to the EU."})
+	assert.Equal(t, []string{"Q: Do you ship abroad?\nA: Yes, to the EU."}, faq)
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1, cosineSimilarity(models.Embedding{1, 2}, models.Embedding{2, 4}), 1e-6)
+	assert.InDelta(t, 0, cosineSimilarity(models.Embedding{1, 0}, models.Embedding{0, 1}), 1e-6)
+	assert.Zero(t, cosineSimilarity(models.Embedding{1, 0}, models.Embedding{1, 0, 0}))
+	assert.Zero(t, cosineSimilarity(models.Embedding{0, 0}, models.Embedding{1, 0}))
+}
+
+// keywordEmbeddings serves OpenAI embeddings counting the words refund, shipping and hours
+func keywordEmbeddings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		var req struct {
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		data := make([]map[string]interface{}, len(req.Input))
+		for i, text := range req.Input {
+			text = strings.ToLower(text)
+			data[i] = map[string]interface{}{
+				"index": i,
+				"embedding": []float32{
+					float32(strings.Count(text, "refund")) + 0.1,
+					float32(strings.Count(text, "shipping")) + 0.1,
+					float32(strings.Count(text, "hours")) + 0.1,
+				},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "usage": map[string]int{"prompt_tokens": 5}})
+	}))
+	t.Cleanup(server.Close)
+	orig := openAIEmbeddingsURL
+	openAIEmbeddingsURL = server.URL
+	t.Cleanup(func() { openAIEmbeddingsURL = orig })
+}
+
+func TestKnowledgeRetrieval(t *testing.T) {
+	keywordEmbeddings(t)
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Knowledge Org " + suffix,
+		Slug:      "knowledge-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+
+	// The embedding provider reuses the AI provider's key
+	settings := &models.ChatbotSettings{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		AI: models.AIConfig{
+			Provider:          models.AIProviderOpenAI,
+			APIKey:            "key",
+			EmbeddingProvider: models.AIProviderOpenAI,
+			KnowledgeTopK:     1,
+		},
+	}
+	require.NoError(t, app.DB.Create(settings).Error)
+
+	docs := []models.KnowledgeDocument{
+		{Source: models.KnowledgeSourceFAQ, Title: "How do refunds work?", Content: "A refund takes 5 days."},
+		{Source: models.KnowledgeSourceDocument, Title: "Shipping", Content: "Shipping is free over $50."},
+	}
+	for i := range docs {
+		docs[i].ID = uuid.New()
+		docs[i].OrganizationID = org.ID
+		require.NoError(t, app.DB.Create(&docs[i]).Error)
+		require.NoError(t, app.indexKnowledgeDocument(docs[i].ID))
+	}
+
+	var indexed models.KnowledgeDocument
+	require.NoError(t, app.DB.First(&indexed, "id = ?", docs[0].ID).Error)
+	assert.Equal(t, models.KnowledgeStatusReady, indexed.Status)
+	assert.Equal(t, 1, indexed.ChunkCount)
+	assert.Equal(t, "openai/text-embedding-3-small", indexed.EmbeddingModel)
+
+	matches, err := app.searchKnowledge(context.Background(), settings, "What's your refund policy?", 2)
+	require.NoError(t, err)
+	require.Len(t, matches, 2)
+	assert.Equal(t, docs[0].ID, matches[0].DocumentID)
+	assert.Greater(t, matches[0].Score, matches[1].Score)
+
+	knowledge := app.buildKnowledgeContext(context.Background(), org.ID, "Is shipping free?")
+	assert.Contains(t, knowledge, "Shipping is free over $50.")
+	assert.NotContains(t, knowledge, "refund", "only the top passage is included")
+
+	// Passages embedded with another model are skipped until reindexed
+	settings.AI.EmbeddingModel = "text-embedding-3-large"
+	require.NoError(t, app.DB.Save(settings).Error)
+	assert.Empty(t, app.buildKnowledgeContext(context.Background(), org.ID, "Is shipping free?"))
+
+	// Without an embedding provider indexing fails
+	settings.AI.EmbeddingProvider = ""
+	require.NoError(t, app.DB.Save(settings).Error)
+	require.Error(t, app.indexKnowledgeDocument(docs[1].ID))
+	require.NoError(t, app.DB.First(&indexed, "id = ?", docs[1].ID).Error)
+	assert.Equal(t, models.KnowledgeStatusFailed, indexed.Status)
+	assert.Equal(t, "no embedding provider configured", indexed.Error)
+}
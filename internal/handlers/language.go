@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// Keys of the per-language message variants in LanguageConfig.MessageTranslations
+const (
+	translationGreeting     = "greeting_message"
+	translationFallback     = "fallback_message"
+	translationOutOfHours   = "out_of_hours_message"
+	translationSystemPrompt = "ai_system_prompt"
+
+	translationSessionClosed   = "session_closed_message"
+	translationClientReminder  = "client_reminder_message"
+	translationClientAutoClose = "client_auto_close_message"
+
+	translationCSATQuestion = "csat_question"
+	translationCSATFollowUp = "csat_follow_up"
+	translationCSATThankYou = "csat_thank_you"
+)
+
+// translationKeys are the messages that can have per-language variants
+var translationKeys = []string{
+	translationGreeting, translationFallback, translationOutOfHours, translationSystemPrompt,
+	translationSessionClosed, translationClientReminder, translationClientAutoClose,
+	translationCSATQuestion, translationCSATFollowUp, translationCSATThankYou,
+}
+
+// languageCodeRegex matches ISO 639-1 codes
+var languageCodeRegex = regexp.MustCompile(`^[a-z]{2}$`)
+
+// languageNames are the languages the detector recognizes, named for the AI prompt
+var languageNames = map[string]string{
+	"ar": "Arabic",
+	"bn": "Bengali",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"gu": "Gujarati",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"id": "Indonesian",
+	"it": "Italian",
+	"ja": "Japanese",
+	"kn": "Kannada",
+	"ko": "Korean",
+	"ml": "Malayalam",
+	"nl": "Dutch",
+	"pa": "Punjabi",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"ta": "Tamil",
+	"te": "Telugu",
+	"th": "Thai",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"zh": "Chinese",
+}
+
+// scriptLanguages maps writing systems used by a single language to that language
+var scriptLanguages = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Arabic, "ar"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Bengali, "bn"},
+	{unicode.Gujarati, "gu"},
+	{unicode.Gurmukhi, "pa"},
+	{unicode.Tamil, "ta"},
+	{unicode.Telugu, "te"},
+	{unicode.Kannada, "kn"},
+	{unicode.Malayalam, "ml"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+}
+
+// latinWords are common words, greetings included, that tell Latin-script
+// languages apart. Words shared by several languages only count when one has more.
+var latinWords = map[string][]string{
+	"en": {"the", "and", "is", "are", "you", "my", "to", "of", "what", "how", "can", "have", "this", "with", "for", "hello", "hi", "thanks", "please", "want", "need", "order", "where", "when", "yes"},
+	"es": {"el", "la", "los", "las", "es", "está", "que", "de", "y", "en", "por", "para", "con", "mi", "quiero", "necesito", "hola", "gracias", "cómo", "como", "dónde", "cuándo", "pedido", "sí", "buenos", "buenas", "tengo", "puedo", "usted"},
+	"pt": {"o", "os", "as", "é", "está", "que", "de", "e", "em", "não", "com", "meu", "minha", "quero", "preciso", "olá", "oi", "obrigado", "obrigada", "como", "onde", "quando", "pedido", "sim", "bom", "tenho", "posso", "você"},
+	"fr": {"le", "la", "les", "est", "et", "je", "vous", "de", "des", "en", "pour", "avec", "mon", "ma", "veux", "besoin", "bonjour", "salut", "merci", "comment", "où", "quand", "commande", "oui", "pas", "suis", "avez"},
+	"de": {"der", "die", "das", "ist", "und", "ich", "sie", "du", "nicht", "mit", "für", "mein", "meine", "will", "brauche", "hallo", "danke", "bitte", "wie", "wo", "wann", "bestellung", "ja", "haben", "guten"},
+	"it": {"il", "lo", "gli", "è", "e", "che", "di", "non", "con", "per", "mio", "mia", "voglio", "ho", "bisogno", "ciao", "grazie", "come", "dove", "quando", "ordine", "sì", "buongiorno", "sono"},
+	"nl": {"de", "het", "een", "is", "en", "ik", "je", "niet", "met", "voor", "mijn", "wil", "hallo", "dank", "bedankt", "hoe", "waar", "wanneer", "bestelling", "ja", "graag", "heb"},
+	"id": {"yang", "dan", "di", "ini", "itu", "saya", "anda", "tidak", "dengan", "untuk", "mau", "ingin", "halo", "terima", "kasih", "bagaimana", "dimana", "kapan", "pesanan", "ya", "apa", "bisa", "tolong"},
+	"tr": {"bir", "ve", "bu", "ne", "için", "ile", "ben", "siz", "değil", "istiyorum", "merhaba", "teşekkürler", "teşekkür", "nasıl", "nerede", "zaman", "sipariş", "evet", "var", "lütfen"},
+}
+
+// latinWordIndex maps each word in latinWords to the languages using it
+var latinWordIndex = func() map[string][]string {
+	index := make(map[string][]string)
+	for lang, words := range latinWords {
+		for _, w := range words {
+			index[w] = append(index[w], lang)
+		}
+	}
+	return index
+}()
+
+// detectLanguage guesses the ISO 639-1 language of a message. It returns "" when
+// the message is too short or ambiguous to tell, e.g. "ok" or an emoji.
+func detectLanguage(text string) string {
+	var letters, latin int
+	scripts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range scriptLanguages {
+			if unicode.Is(s.table, r) {
+				scripts[s.lang]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+
+	// Non-Latin scripts identify the language, once they make up most of the text
+	if latin*2 < letters {
+		best, bestCount := "", 0
+		for lang, count := range scripts {
+			if count > bestCount || (count == bestCount && lang < best) {
+				best, bestCount = lang, count
+			}
+		}
+		// Kana mixed with Han is Japanese
+		if best == "zh" && scripts["ja"] > 0 {
+			best = "ja"
+		}
+		if best == "ru" && strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+			best = "uk"
+		}
+		return best
+	}
+
+	scores := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, w := range words {
+		for _, lang := range latinWordIndex[w] {
+			scores[lang]++
+		}
+	}
+	// Letters only one language uses count as a word
+	lower := strings.ToLower(text)
+	if strings.ContainsAny(lower, "ñ¿¡") {
+		scores["es"]++
+	}
+	if strings.ContainsAny(lower, "ãõ") {
+		scores["pt"]++
+	}
+	if strings.ContainsAny(lower, "ßäöü") && !strings.ContainsAny(lower, "ğış") {
+		scores["de"]++
+	}
+	if strings.ContainsAny(lower, "ğış") {
+		scores["tr"]++
+	}
+
+	best, bestScore, tied := "", 0, false
+	for lang, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = lang, score, false
+		case score == bestScore:
+			tied = true
+		}
+	}
+	if bestScore == 0 || tied {
+		return ""
+	}
+	return best
+}
+
+// isLanguageCode reports whether code is a two-letter ISO 639-1 code
+func isLanguageCode(code string) bool {
+	return languageCodeRegex.MatchString(code)
+}
+
+// supportedLanguage returns the language to use for a detected one: itself if
+// the settings support it, otherwise the default language
+func supportedLanguage(config models.LanguageConfig, detected string) string {
+	if len(config.SupportedLanguages) == 0 {
+		return detected
+	}
+	for _, lang := range config.SupportedLanguages {
+		if lang == detected {
+			return detected
+		}
+	}
+	return config.DefaultLanguage
+}
+
+// conversationLanguage returns the language to reply in: the session's, then the
+// contact's, then the default. It's empty when language detection is off.
+func conversationLanguage(settings *models.ChatbotSettings, session *models.ChatbotSession, contact *models.Contact) string {
+	if settings == nil || !settings.Language.DetectionEnabled {
+		return ""
+	}
+	if session != nil && session.Language != "" {
+		return session.Language
+	}
+	if contact != nil && contact.Language != "" {
+		return supportedLanguage(settings.Language, contact.Language)
+	}
+	return settings.Language.DefaultLanguage
+}
+
+// localizedMessage returns the variant of a settings message for a language,
+// then for the default language, falling back to the message itself
+func localizedMessage(settings *models.ChatbotSettings, lang, key, message string) string {
+	if lang == "" {
+		return message
+	}
+	for _, l := range []string{lang, settings.Language.DefaultLanguage} {
+		variants, ok := settings.Language.MessageTranslations[l].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if text, ok := variants[key].(string); ok && strings.TrimSpace(text) != "" {
+			return text
+		}
+	}
+	return message
+}
+
+// messageTranslations returns the per-language message variants as strings
+func messageTranslations(config models.LanguageConfig) map[string]map[string]string {
+	translations := make(map[string]map[string]string, len(config.MessageTranslations))
+	for lang, item := range config.MessageTranslations {
+		variants, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		messages := make(map[string]string, len(variants))
+		for key, text := range variants {
+			if str, ok := text.(string); ok {
+				messages[key] = str
+			}
+		}
+		translations[lang] = messages
+	}
+	return translations
+}
+
+// aiLanguageInstruction tells the AI which language to answer in
+func aiLanguageInstruction(lang string) string {
+	name, ok := languageNames[lang]
+	if !ok {
+		return ""
+	}
+	return "Always reply in " + name + ", the language the customer is writing in."
+}
+
+// updateContactLanguage detects the language of an inbound text message and
+// stores it on the contact. Messages too short to tell keep the language already known.
+func (a *App) updateContactLanguage(settings *models.ChatbotSettings, contact *models.Contact, messageText string) {
+	if !settings.Language.DetectionEnabled {
+		return
+	}
+	detected := detectLanguage(messageText)
+	if detected == "" || detected == contact.Language {
+		return
+	}
+	if err := a.DB.Model(contact).Update("language", detected).Error; err != nil {
+		a.Log.Error("Failed to update contact language", "error", err, "contact_id", contact.ID)
+		return
+	}
+	a.Log.Info("Contact language detected", "contact_id", contact.ID, "language", detected, "previous", contact.Language)
+	contact.Language = detected
+}
+
+// updateSessionLanguage sets the session's language to the contact's, or the
+// default language if the contact's isn't supported
+func (a *App) updateSessionLanguage(settings *models.ChatbotSettings, session *models.ChatbotSession, contact *models.Contact) {
+	if !settings.Language.DetectionEnabled || contact.Language == "" {
+		return
+	}
+	lang := supportedLanguage(settings.Language, contact.Language)
+	if lang == session.Language {
+		return
+	}
+	if err := a.DB.Model(session).Update("language", lang).Error; err != nil {
+		a.Log.Error("Failed to update session language", "error", err, "session_id", session.ID)
+		return
+	}
+	session.Language = lang
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"hola, quiero saber de mi pedido", "es"},
+		{"Hello, I need help with my order", "en"},
+		{"Olá, não recebi o meu pedido", "pt"},
+		{"Bonjour, je veux suivre ma commande", "fr"},
+		{"Hallo, ich brauche Hilfe mit meiner Bestellung", "de"},
+		{"مرحبا، أين طلبي؟", "ar"},
+		{"नमस्ते, मेरा ऑर्डर कहाँ है?", "hi"},
+		{"Здравствуйте, где мой заказ?", "ru"},
+		{"注文はどこですか", "ja"},
+		{"ok", ""},
+		{"👍", ""},
+		{"12345", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.want, detectLanguage(tt.text))
+		})
+	}
+}
+
+func TestSupportedLanguage(t *testing.T) {
+	config := models.LanguageConfig{DefaultLanguage: "en", SupportedLanguages: models.StringArray{"en", "es"}}
+	assert.Equal(t, "es", supportedLanguage(config, "es"))
+	assert.Equal(t, "en", supportedLanguage(config, "fr"))
+
+	// Without supported languages every detected language is used
+	assert.Equal(t, "fr", supportedLanguage(models.LanguageConfig{DefaultLanguage: "en"}, "fr"))
+}
+
+func TestLocalizedMessage(t *testing.T) {
+	settings := &models.ChatbotSettings{
+		Language: models.LanguageConfig{
+			DetectionEnabled: true,
+			DefaultLanguage:  "en",
+			MessageTranslations: models.JSONB{
+				"es": map[string]interface{}{translationGreeting: "¡Hola!", translationSessionClosed: "Cerramos la conversación."},
+				"en": map[string]interface{}{translationFallback: "Sorry, I didn't get that."},
+			},
+		},
+	}
+
+	assert.Equal(t, "¡Hola!", localizedMessage(settings, "es", translationGreeting, "Hi!"))
+	// A missing variant uses the default language's, then the message itself
+	assert.Equal(t, "Sorry, I didn't get that.", localizedMessage(settings, "es", translationFallback, "Sorry?"))
+	assert.Equal(t, "We're closed", localizedMessage(settings, "es", translationOutOfHours, "We're closed"))
+	assert.Equal(t, "Hi!", localizedMessage(settings, "", translationGreeting, "Hi!"))
+	assert.Equal(t, "Cerramos la conversación.", localizedMessage(settings, "es", translationSessionClosed, "Conversation closed."))
+}
+
+func TestConversationLanguage(t *testing.T) {
+	settings := &models.ChatbotSettings{
+		Language: models.LanguageConfig{DetectionEnabled: true, DefaultLanguage: "en", SupportedLanguages: models.StringArray{"en", "es"}},
+	}
+
+	assert.Equal(t, "es", conversationLanguage(settings, &models.ChatbotSession{Language: "es"}, &models.Contact{Language: "en"}))
+	assert.Equal(t, "es", conversationLanguage(settings, nil, &models.Contact{Language: "es"}))
+	assert.Equal(t, "en", conversationLanguage(settings, nil, &models.Contact{Language: "de"}))
+	assert.Equal(t, "en", conversationLanguage(settings, nil, &models.Contact{}))
+
+	settings.Language.DetectionEnabled = false
+	assert.Equal(t, "", conversationLanguage(settings, nil, &models.Contact{Language: "es"}))
+}
+
+func TestFlowForLanguage(t *testing.T) {
+	english := &models.ChatbotFlow{Name: "Order status", Language: "en"}
+	spanish := &models.ChatbotFlow{Name: "Estado del pedido", Language: "es"}
+	neutral := &models.ChatbotFlow{Name: "Order"}
+
+	assert.Equal(t, spanish, flowForLanguage([]*models.ChatbotFlow{english, spanish, neutral}, "es"))
+	assert.Equal(t, neutral, flowForLanguage([]*models.ChatbotFlow{english, spanish, neutral}, "pt"))
+	assert.Equal(t, english, flowForLanguage([]*models.ChatbotFlow{english, spanish}, "pt"))
+	assert.Nil(t, flowForLanguage(nil, "en"))
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+)
+
+// listMessageFromConfig reads a list message configured on a flow step or a
+// keyword rule, as {"button_text", "header", "footer", "sections": [{"title",
+// "rows": [{"id", "title", "description"}]}]}. The body is the step message or
+// the rule's body.
+func listMessageFromConfig(body string, config map[string]interface{}) whatsapp.ListMessage {
+	list := whatsapp.ListMessage{
+		Header:     strings.TrimSpace(getStringFromMap(config, "header")),
+		Body:       body,
+		Footer:     strings.TrimSpace(getStringFromMap(config, "footer")),
+		ButtonText: strings.TrimSpace(getStringFromMap(config, "button_text")),
+	}
+	if list.ButtonText == "" {
+		list.ButtonText = whatsapp.DefaultListButtonText
+	}
+
+	sections, _ := config["sections"].([]interface{})
+	for _, s := range sections {
+		sectionMap, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		section := whatsapp.ListSection{Title: strings.TrimSpace(getStringFromMap(sectionMap, "title"))}
+		rows, _ := sectionMap["rows"].([]interface{})
+		for _, r := range rows {
+			if rowMap, ok := r.(map[string]interface{}); ok {
+				section.Rows = append(section.Rows, whatsapp.ListRow{
+					ID:          strings.TrimSpace(getStringFromMap(rowMap, "id")),
+					Title:       strings.TrimSpace(getStringFromMap(rowMap, "title")),
+					Description: strings.TrimSpace(getStringFromMap(rowMap, "description")),
+				})
+			}
+		}
+		list.Sections = append(list.Sections, section)
+	}
+	return list
+}
+
+// listReplyOptions returns the rows of a list message as {"id", "title"}
+// options, the way a buttons step lists its buttons
+func listReplyOptions(list whatsapp.ListMessage) []interface{} {
+	var options []interface{}
+	for _, section := range list.Sections {
+		for _, row := range section.Rows {
+			options = append(options, map[string]interface{}{"id": row.ID, "title": row.Title})
+		}
+	}
+	return options
+}
+
+// listInteractiveData creates the InteractiveData JSONB of a list message. The
+// rows are also kept flat, as for lists sent from buttons.
+func listInteractiveData(list *whatsapp.ListMessage) models.JSONB {
+	rows := make([]interface{}, 0)
+	sections := make([]interface{}, 0, len(list.Sections))
+	for _, section := range list.Sections {
+		sectionRows := make([]interface{}, 0, len(section.Rows))
+		for _, row := range section.Rows {
+			r := map[string]string{"id": row.ID, "title": row.Title, "description": row.Description}
+			rows = append(rows, r)
+			sectionRows = append(sectionRows, r)
+		}
+		sections = append(sections, map[string]interface{}{"title": section.Title, "rows": sectionRows})
+	}
+	return models.JSONB{
+		"type":        "list",
+		"header":      list.Header,
+		"body":        list.Body,
+		"footer":      list.Footer,
+		"button_text": list.ButtonText,
+		"sections":    sections,
+		"rows":        rows,
+	}
+}
+
+// sendAndSaveListMessage sends a list message and saves it to the database
+func (a *App) sendAndSaveListMessage(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, list whatsapp.ListMessage) error {
+	_, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account:         account,
+		Contact:         contact,
+		Type:            models.MessageTypeInteractive,
+		InteractiveType: "list",
+		BodyText:        list.Body,
+		List:            &list,
+	}, ChatbotSendOptions())
+	return err
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListMessageFromConfig(t *testing.T) {
+	list := listMessageFromConfig("How can we help?", map[string]interface{}{
+		"header": " Support ",
+		"sections": []interface{}{
+			map[string]interface{}{
+				"title": "Orders",
+				"rows": []interface{}{
+					map[string]interface{}{"id": "track", "title": "Track my order", "description": "See where it is"},
+					map[string]interface{}{"id": "return", "title": "Return an item"},
+				},
+			},
+		},
+	})
+
+	assert.Equal(t, whatsapp.ListMessage{
+		Header:     "Support",
+		Body:       "How can we help?",
+		ButtonText: whatsapp.DefaultListButtonText,
+		Sections: []whatsapp.ListSection{{
+			Title: "Orders",
+			Rows: []whatsapp.ListRow{
+				{ID: "track", Title: "Track my order", Description: "See where it is"},
+				{ID: "return", Title: "Return an item"},
+			},
+		}},
+	}, list)
+	assert.NoError(t, list.Validate())
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"id": "track", "title": "Track my order"},
+		map[string]interface{}{"id": "return", "title": "Return an item"},
+	}, listReplyOptions(list))
+}
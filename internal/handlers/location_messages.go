@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+)
+
+// locationContent returns the content stored for a location message, as
+// {"latitude", "longitude", "name", "address"}. The chat renders it as a map card.
+func locationContent(location whatsapp.Location) string {
+	data := map[string]any{
+		"latitude":  location.Latitude,
+		"longitude": location.Longitude,
+	}
+	if location.Name != "" {
+		data["name"] = location.Name
+	}
+	if location.Address != "" {
+		data["address"] = location.Address
+	}
+	content, _ := json.Marshal(data)
+	return string(content)
+}
+
+// locationCoordinates reads the coordinates of a location message's content,
+// nil when it isn't a location
+func locationCoordinates(content string) (latitude, longitude *float64) {
+	var location struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+	}
+	if err := json.Unmarshal([]byte(content), &location); err != nil || location.Latitude == nil || location.Longitude == nil {
+		return nil, nil
+	}
+	return location.Latitude, location.Longitude
+}
+
+// locationFromConfig reads a location configured on a flow step, as
+// {"latitude", "longitude", "name", "address"}, and checks the coordinates
+func locationFromConfig(config map[string]interface{}) (whatsapp.Location, error) {
+	latitude, okLat := config["latitude"].(float64)
+	longitude, okLng := config["longitude"].(float64)
+	location := whatsapp.Location{
+		Latitude:  latitude,
+		Longitude: longitude,
+		Name:      strings.TrimSpace(getStringFromMap(config, "name")),
+		Address:   strings.TrimSpace(getStringFromMap(config, "address")),
+	}
+	if !okLat || !okLng {
+		return location, errors.New("latitude and longitude are required")
+	}
+	return location, location.Validate()
+}
+
+// sendAndSaveLocationMessage sends a location message and saves it to the database
+func (a *App) sendAndSaveLocationMessage(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, location whatsapp.Location) error {
+	_, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account:  account,
+		Contact:  contact,
+		Type:     models.MessageTypeLocation,
+		Location: &location,
+	}, ChatbotSendOptions())
+	return err
+}
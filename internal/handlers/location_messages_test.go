@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocationContent(t *testing.T) {
+	content := locationContent(whatsapp.Location{Latitude: 40.7128, Longitude: -74.006, Name: "Downtown Store"})
+	assert.JSONEq(t, `{"latitude": 40.7128, "longitude": -74.006, "name": "Downtown Store"}`, content)
+
+	latitude, longitude := locationCoordinates(content)
+	require.NotNil(t, latitude)
+	require.NotNil(t, longitude)
+	assert.Equal(t, 40.7128, *latitude)
+	assert.Equal(t, -74.006, *longitude)
+
+	latitude, longitude = locationCoordinates("Meet me at the store")
+	assert.Nil(t, latitude)
+	assert.Nil(t, longitude)
+}
+
+func TestLocationFromConfig(t *testing.T) {
+	location, err := locationFromConfig(map[string]interface{}{
+		"latitude":  51.5074,
+		"longitude": -0.1278,
+		"name":      " London Store ",
+		"address":   "1 High St",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, whatsapp.Location{Latitude: 51.5074, Longitude: -0.1278, Name: "London Store", Address: "1 High St"}, location)
+
+	_, err = locationFromConfig(map[string]interface{}{"latitude": 51.5074})
+	assert.ErrorContains(t, err, "latitude and longitude are required")
+
+	_, err = locationFromConfig(map[string]interface{}{"latitude": 51.5074, "longitude": 200.0})
+	assert.ErrorContains(t, err, "longitude must be between -180 and 180")
+}
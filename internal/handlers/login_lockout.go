@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+const loginFailuresPrefix = "login:failures:"
+
+// loginCounter counts the failed logins of an account or client IP in Redis
+type loginCounter struct {
+	key         string
+	maxAttempts int
+}
+
+// loginCounters returns the counters a login attempt is limited by, per
+// security.login_max_attempts and security.login_max_attempts_per_ip
+func (a *App) loginCounters(email, ip string) []loginCounter {
+	security := a.CurrentConfig().Security
+	var counters []loginCounter
+	if email != "" && security.LoginMaxAttempts > 0 {
+		counters = append(counters, loginCounter{loginFailuresPrefix + "account:" + strings.ToLower(email), security.LoginMaxAttempts})
+	}
+	if ip != "" && security.LoginMaxAttemptsPerIP > 0 {
+		counters = append(counters, loginCounter{loginFailuresPrefix + "ip:" + ip, security.LoginMaxAttemptsPerIP})
+	}
+	return counters
+}
+
+// loginLockedFor returns how long logins to an account, or from a client IP, are
+// refused for after too many failures. Zero when they aren't locked, or Redis is
+// unavailable.
+func (a *App) loginLockedFor(ctx context.Context, email, ip string) time.Duration {
+	if a.Redis == nil {
+		return 0
+	}
+	var locked time.Duration
+	for _, counter := range a.loginCounters(email, ip) {
+		failures, err := a.Redis.Get(ctx, counter.key).Int()
+		if err != nil || failures < counter.maxAttempts {
+			continue
+		}
+		if ttl, err := a.Redis.TTL(ctx, counter.key).Result(); err == nil && ttl > locked {
+			locked = ttl
+		}
+	}
+	return locked
+}
+
+// recordLoginFailure counts a failed login against the account and the client IP.
+// Failures are forgotten security.login_lockout_mins after the last one, so a
+// lockout lasts that long.
+func (a *App) recordLoginFailure(ctx context.Context, email, ip string) {
+	if a.Redis == nil {
+		return
+	}
+	window := time.Duration(a.CurrentConfig().Security.LoginLockoutMins) * time.Minute
+	for _, counter := range a.loginCounters(email, ip) {
+		failures, err := a.Redis.Incr(ctx, counter.key).Result()
+		if err != nil {
+			a.Log.Error("Failed to count failed login", "error", err)
+			continue
+		}
+		a.Redis.Expire(ctx, counter.key, window)
+		if failures == int64(counter.maxAttempts) {
+			a.Log.Warn("Logins locked after repeated failures", "key", counter.key, "failures", failures)
+		}
+	}
+}
+
+// clearLoginFailures forgets an account's failed logins once it signs in. The client
+// IP's failures are kept, so guessing the passwords of many accounts still locks it.
+func (a *App) clearLoginFailures(ctx context.Context, email string) {
+	if a.Redis == nil {
+		return
+	}
+	for _, counter := range a.loginCounters(email, "") {
+		a.Redis.Del(ctx, counter.key)
+	}
+}
+
+// sendLoginLocked refuses a login while it's locked, telling the client when to retry
+func sendLoginLocked(r *fastglue.Request, lockedFor time.Duration) error {
+	retryAfter := int(math.Ceil(lockedFor.Seconds()))
+	r.RequestCtx.Response.Header.Set("Retry-After", strconv.Itoa(retryAfter))
+	return r.SendErrorEnvelope(fasthttp.StatusTooManyRequests, "Too many failed login attempts. Try again later.",
+		map[string]interface{}{"reason": "login_locked", "retry_after": retryAfter}, "")
+}
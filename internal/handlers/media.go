@@ -2,31 +2,41 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/storage"
 	"github.com/shridarpatil/whatomate/pkg/whatsapp"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
 )
 
-// getMediaStoragePath returns the base path for media storage
-func (a *App) getMediaStoragePath() string {
-	basePath := a.Config.Storage.LocalPath
-	if basePath == "" {
-		basePath = "./media"
+// mediaStore returns the store media files are kept in, local storage when
+// none is set
+func (a *App) mediaStore() storage.Store {
+	if a.Media != nil {
+		return a.Media
 	}
-	return basePath
+	return storage.NewLocal(a.CurrentConfig().Storage.LocalPath)
 }
 
-// ensureMediaDir ensures the media directory exists
-func (a *App) ensureMediaDir(subdir string) error {
-	path := filepath.Join(a.getMediaStoragePath(), subdir)
-	return os.MkdirAll(path, 0755)
+// deleteMedia deletes an organization's media file and releases the storage it
+// used from the organization's usage
+func (a *App) deleteMedia(ctx context.Context, orgID uuid.UUID, key string) error {
+	store := a.mediaStore()
+	size, sizeErr := store.Size(ctx, key)
+	if err := store.Delete(ctx, key); err != nil {
+		return err
+	}
+	if sizeErr == nil {
+		a.releaseStorageUsage(orgID, size)
+	}
+	return nil
 }
 
 // getExtensionFromMimeType returns file extension based on mime type
@@ -75,20 +85,42 @@ func getExtensionFromMimeType(mimeType string) string {
 	}
 }
 
-// DownloadAndSaveMedia downloads media from Meta and saves it locally
-// Returns the local file path (relative to media storage) or error
-func (a *App) DownloadAndSaveMedia(ctx context.Context, mediaID string, mimeType string, account *whatsapp.Account) (string, error) {
-	// Get the media URL from Meta
-	mediaURL, err := a.WhatsApp.GetMediaURL(ctx, mediaID, account)
+// DownloadAndSaveMedia downloads media from the number's API and saves it to media
+// storage. Returns the file path (relative to media storage) or error
+func (a *App) DownloadAndSaveMedia(ctx context.Context, orgID uuid.UUID, mediaID string, mimeType string, account *whatsapp.Account) (string, error) {
+	data, err := a.WhatsApp.FetchMedia(ctx, account, mediaID)
 	if err != nil {
-		return "", fmt.Errorf("failed to get media URL: %w", err)
+		return "", fmt.Errorf("failed to download media: %w", err)
 	}
+	return a.saveDownloadedMedia(ctx, orgID, data, mimeType)
+}
 
-	// Download the media content
-	data, err := a.WhatsApp.DownloadMedia(ctx, mediaURL, account.AccessToken)
+// downloadIncomingMedia downloads media a contact sent to the account and saves it
+// locally, from the account's channel
+func (a *App) downloadIncomingMedia(ctx context.Context, account *models.WhatsAppAccount, mediaID, mimeType string) (string, error) {
+	var data []byte
+	var err error
+	switch account.AccountChannel() {
+	case models.ChannelTelegram:
+		data, err = a.telegramClient().DownloadFile(ctx, a.telegramToken(account), mediaID)
+	case models.ChannelInstagram, models.ChannelMessenger:
+		// Messenger Platform attachments come with a URL instead of an ID
+		data, err = a.messengerClient().Download(ctx, mediaID)
+	default:
+		return a.DownloadAndSaveMedia(ctx, account.OrganizationID, mediaID, mimeType, a.toWhatsAppAccount(account))
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to download media: %w", err)
 	}
+	return a.saveDownloadedMedia(ctx, account.OrganizationID, data, mimeType)
+}
+
+// saveDownloadedMedia saves downloaded media in media storage and returns its path
+func (a *App) saveDownloadedMedia(ctx context.Context, orgID uuid.UUID, data []byte, mimeType string) (string, error) {
+	// Enforce the plan's storage limit
+	if err := a.checkQuota(orgID, models.UsageMetricStorage, int64(len(data))); err != nil {
+		return "", err
+	}
 
 	// Determine file extension
 	ext := getExtensionFromMimeType(mimeType)
@@ -112,25 +144,20 @@ func (a *App) DownloadAndSaveMedia(ctx context.Context, mediaID string, mimeType
 		subdir = "documents"
 	}
 
-	// Ensure directory exists
-	if err := a.ensureMediaDir(subdir); err != nil {
-		return "", fmt.Errorf("failed to create media directory: %w", err)
-	}
-
 	// Save file
-	filePath := filepath.Join(a.getMediaStoragePath(), subdir, filename)
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	relativePath := path.Join(subdir, filename)
+	if err := a.mediaStore().Put(ctx, relativePath, data, mimeType); err != nil {
 		return "", fmt.Errorf("failed to save media file: %w", err)
 	}
 
-	// Return relative path for storage in database
-	relativePath := filepath.Join(subdir, filename)
-	a.Log.Info("Media saved", "path", relativePath, "size", len(data))
+	a.recordUsage(orgID, models.UsageMetricStorage, int64(len(data)))
+
+	a.log(ctx).Info("Media saved", "path", relativePath, "size", len(data))
 
 	return relativePath, nil
 }
 
-// ServeMedia serves media files from local storage
+// ServeMedia serves media files from media storage
 // Only authorized users who have access to the message can view the media
 func (a *App) ServeMedia(r *fastglue.Request) error {
 	// Get auth context
@@ -172,18 +199,13 @@ func (a *App) ServeMedia(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid file path", nil, "")
 	}
 
-	// Build full path
-	fullPath := filepath.Join(a.getMediaStoragePath(), filePath)
-
-	// Check if file exists
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+	// Read file
+	data, err := a.mediaStore().Get(context.Background(), filePath)
+	if errors.Is(err, storage.ErrNotFound) {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "File not found", nil, "")
 	}
-
-	// Read file
-	data, err := os.ReadFile(fullPath)
 	if err != nil {
-		a.Log.Error("Failed to read media file", "path", fullPath, "error", err)
+		a.Log.Error("Failed to read media file", "path", filePath, "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to read file", nil, "")
 	}
 
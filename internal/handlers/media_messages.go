@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+)
+
+// mediaMessageFromConfig reads a media message configured on a flow step, as
+// {"media_type", "media_url", "filename"}. The caption is the step message.
+// WhatsApp downloads the media from the URL, so it must be public.
+func mediaMessageFromConfig(caption string, config map[string]interface{}) whatsapp.MediaMessage {
+	media := whatsapp.MediaMessage{
+		Type:     strings.TrimSpace(getStringFromMap(config, "media_type")),
+		Link:     strings.TrimSpace(getStringFromMap(config, "media_url")),
+		Caption:  caption,
+		Filename: strings.TrimSpace(getStringFromMap(config, "filename")),
+	}
+	if media.Type == "" {
+		media.Type = whatsapp.MediaTypeImage
+	}
+	if media.Filename == "" && media.Type == whatsapp.MediaTypeDocument {
+		media.Filename = mediaLinkFilename(media.Link)
+	}
+	return media
+}
+
+// sendAndSaveMediaMessage sends a media message by link and saves it to the database
+func (a *App) sendAndSaveMediaMessage(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, media whatsapp.MediaMessage) error {
+	_, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account:       account,
+		Contact:       contact,
+		Type:          models.MessageType(media.Type),
+		MediaLink:     media.Link,
+		MediaFilename: media.Filename,
+		Caption:       media.Caption,
+	}, ChatbotSendOptions())
+	return err
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaMessageFromConfig(t *testing.T) {
+	media := mediaMessageFromConfig("Your invoice", map[string]interface{}{
+		"media_type": "document",
+		"media_url":  " https://example.com/invoices/INV-42.pdf ",
+	})
+	assert.Equal(t, whatsapp.MediaMessage{
+		Type:     whatsapp.MediaTypeDocument,
+		Link:     "https://example.com/invoices/INV-42.pdf",
+		Caption:  "Your invoice",
+		Filename: "INV-42.pdf",
+	}, media)
+	assert.NoError(t, media.Validate())
+
+	// Images are the default, and only documents get a file name
+	media = mediaMessageFromConfig("", map[string]interface{}{"media_url": "https://example.com/menu.jpg"})
+	assert.Equal(t, whatsapp.MediaTypeImage, media.Type)
+	assert.Empty(t, media.Filename)
+
+	assert.Error(t, mediaMessageFromConfig("", map[string]interface{}{"media_type": "video"}).Validate())
+}
+
+func TestMediaLinkFilename(t *testing.T) {
+	assert.Equal(t, "report.pdf", mediaLinkFilename("https://example.com/files/report.pdf?token=abc"))
+	assert.Equal(t, "", mediaLinkFilename("https://example.com/"))
+	assert.Equal(t, "", mediaLinkFilename("https://example.com"))
+}
@@ -0,0 +1,598 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/storage"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultArchiveRetentionDays is how long messages stay in the database when the
+	// organization hasn't set a retention period
+	defaultArchiveRetentionDays = 365
+	// minArchiveRetentionDays keeps recent conversations out of the archive
+	minArchiveRetentionDays = 30
+	// archiveContactsPerRun limits how many contacts of an organization are archived per run
+	archiveContactsPerRun = 200
+	// archiveBatchSize is the most messages put in one archive file
+	archiveBatchSize = 5000
+	// maxArchivesPerRequest limits the archive files read to answer one request
+	maxArchivesPerRequest = 24
+)
+
+// ArchiveSettings are an organization's message retention policy: messages older
+// than the retention period are moved, with their media, to archive storage
+type ArchiveSettings struct {
+	Enabled       bool `json:"enabled"`
+	RetentionDays int  `json:"retention_days"`
+}
+
+// ArchiveSettingsRequest updates archive settings. Omitted fields keep their current value.
+type ArchiveSettingsRequest struct {
+	Enabled       *bool `json:"enabled"`
+	RetentionDays *int  `json:"retention_days"`
+}
+
+// ArchivedMessageResponse is an archived message and the archive it's kept in, which
+// its media is served from
+type ArchivedMessageResponse struct {
+	MessageResponse
+	ArchiveID uuid.UUID `json:"archive_id"`
+}
+
+// archiveSettings reads the archive settings from organization settings
+func archiveSettings(settings models.JSONB) ArchiveSettings {
+	s := ArchiveSettings{RetentionDays: defaultArchiveRetentionDays}
+	raw, ok := settings["archive"].(map[string]interface{})
+	if !ok {
+		return s
+	}
+	s.Enabled, _ = raw["enabled"].(bool)
+	if days := jsonbInt64(raw["retention_days"]); days > 0 {
+		s.RetentionDays = int(days)
+	}
+	return s
+}
+
+// archiveStore returns where archived messages are stored
+func (a *App) archiveStore() storage.Store {
+	if a.Archive != nil {
+		return a.Archive
+	}
+	return a.mediaStore()
+}
+
+// archiveKey is where a batch of a contact's messages is stored
+func archiveKey(orgID, contactID, archiveID uuid.UUID, first time.Time) string {
+	return fmt.Sprintf("archive/%s/%s/%s-%s.jsonl.gz", orgID, contactID, first.UTC().Format("20060102T150405"), archiveID)
+}
+
+// archiveMediaKey is where an archived message's media file is stored
+func archiveMediaKey(orgID uuid.UUID, key string) string {
+	return fmt.Sprintf("archive/%s/media/%s", orgID, key)
+}
+
+// encodeArchive writes messages as gzipped JSON lines, one message per line
+func encodeArchive(messages []models.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for i := range messages {
+		if err := enc.Encode(&messages[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeArchive reads the messages of an archive file
+func decodeArchive(data []byte) ([]models.Message, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = zr.Close() }()
+
+	var messages []models.Message
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var m models.Message
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, scanner.Err()
+}
+
+// ArchiveProcessor moves messages older than each organization's retention period
+// to archive storage
+type ArchiveProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewArchiveProcessor creates a new archive processor
+func NewArchiveProcessor(app *App, interval time.Duration) *ArchiveProcessor {
+	return &ArchiveProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the archive loop
+func (p *ArchiveProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Archive processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.archive(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Archive processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Archive processor stopped")
+			return
+		case <-ticker.C:
+			p.archive(ctx)
+		}
+	}
+}
+
+// Stop stops the archive processor
+func (p *ArchiveProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// archive archives the old messages of each organization with archiving enabled
+func (p *ArchiveProcessor) archive(ctx context.Context) {
+	var orgs []models.Organization
+	if err := p.app.DB.Select("id", "settings").Find(&orgs).Error; err != nil {
+		p.app.Log.Error("Failed to load organizations for archiving", "error", err)
+		return
+	}
+
+	now := time.Now()
+	for _, org := range orgs {
+		s := archiveSettings(org.Settings)
+		if !s.Enabled {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		archived, err := p.app.archiveOrganization(ctx, org.ID, now.AddDate(0, 0, -s.RetentionDays))
+		if err != nil {
+			p.app.Log.Error("Failed to archive messages", "error", err, "org_id", org.ID)
+		}
+		if archived > 0 {
+			p.app.Log.Info("Archived messages", "org_id", org.ID, "messages", archived)
+		}
+	}
+}
+
+// archiveOrganization archives an organization's messages created before cutoff,
+// contact by contact, and returns how many it archived. Contacts left over are
+// archived on the next run.
+func (a *App) archiveOrganization(ctx context.Context, orgID uuid.UUID, cutoff time.Time) (int, error) {
+	var contactIDs []uuid.UUID
+	if err := a.DB.Model(&models.Message{}).
+		Where("organization_id = ? AND created_at < ?", orgID, cutoff).
+		Distinct("contact_id").
+		Limit(archiveContactsPerRun).
+		Pluck("contact_id", &contactIDs).Error; err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, contactID := range contactIDs {
+		for {
+			if ctx.Err() != nil {
+				return total, ctx.Err()
+			}
+			n, err := a.archiveContactMessages(ctx, orgID, contactID, cutoff)
+			total += n
+			if err != nil {
+				return total, fmt.Errorf("contact %s: %w", contactID, err)
+			}
+			if n < archiveBatchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// archiveContactMessages moves a batch of a contact's messages created before cutoff
+// to archive storage: their media is copied under the archive prefix, the messages
+// are written as one file and recorded, and then deleted with their original media.
+// Replies and campaign recipients referencing the messages lose the reference. It
+// returns how many messages it archived.
+func (a *App) archiveContactMessages(ctx context.Context, orgID, contactID uuid.UUID, cutoff time.Time) (int, error) {
+	var messages []models.Message
+	if err := a.DB.Where("organization_id = ? AND contact_id = ? AND created_at < ?", orgID, contactID, cutoff).
+		Order("created_at ASC").Limit(archiveBatchSize).Find(&messages).Error; err != nil {
+		return 0, err
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	store, media := a.archiveStore(), a.mediaStore()
+	var copied, mediaKeys []string
+	var mediaSizes []int64
+	// cleanUp removes what was written when the batch can't be archived
+	cleanUp := func() {
+		for _, key := range copied {
+			_ = store.Delete(context.Background(), key)
+		}
+	}
+
+	ids := make([]uuid.UUID, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+		key := messages[i].MediaURL
+		if key == "" || strings.Contains(key, "..") {
+			continue
+		}
+		data, err := media.Get(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			cleanUp()
+			return 0, fmt.Errorf("failed to read media: %w", err)
+		}
+		archivedKey := archiveMediaKey(orgID, key)
+		if err := store.Put(ctx, archivedKey, data, messages[i].MediaMimeType); err != nil {
+			cleanUp()
+			return 0, fmt.Errorf("failed to archive media: %w", err)
+		}
+		copied = append(copied, archivedKey)
+		mediaKeys = append(mediaKeys, key)
+		mediaSizes = append(mediaSizes, int64(len(data)))
+		messages[i].MediaURL = archivedKey
+	}
+
+	data, err := encodeArchive(messages)
+	if err != nil {
+		cleanUp()
+		return 0, err
+	}
+	archive := models.MessageArchive{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: orgID,
+		ContactID:      contactID,
+		FirstMessageAt: messages[0].CreatedAt,
+		LastMessageAt:  messages[len(messages)-1].CreatedAt,
+		MessageCount:   len(messages),
+		MediaCount:     len(mediaKeys),
+		SizeBytes:      int64(len(data)),
+	}
+	archive.StorageKey = archiveKey(orgID, contactID, archive.ID, archive.FirstMessageAt)
+	if err := store.Put(ctx, archive.StorageKey, data, "application/gzip"); err != nil {
+		cleanUp()
+		return 0, fmt.Errorf("failed to write archive: %w", err)
+	}
+	copied = append(copied, archive.StorageKey)
+
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&archive).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.BulkMessageRecipient{}).Where("message_id IN ?", ids).
+			Update("message_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.Message{}).Where("reply_to_message_id IN ?", ids).
+			Update("reply_to_message_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id IN ?", ids).Delete(&models.Message{}).Error
+	})
+	if err != nil {
+		cleanUp()
+		return 0, err
+	}
+
+	// The archive has the media now, so the originals go once the rows are gone,
+	// and no longer count towards the storage limit
+	for i, key := range mediaKeys {
+		if err := media.Delete(context.Background(), key); err != nil {
+			a.Log.Warn("Failed to delete archived media", "error", err, "organization_id", orgID)
+			continue
+		}
+		a.releaseStorageUsage(orgID, mediaSizes[i])
+	}
+	return len(messages), nil
+}
+
+// GetArchiveSettings returns the organization's message retention policy
+func (a *App) GetArchiveSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	return r.SendEnvelope(archiveSettings(org.Settings))
+}
+
+// UpdateArchiveSettings updates the organization's message retention policy
+func (a *App) UpdateArchiveSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req ArchiveSettingsRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	before := orgSettingsAuditSnapshot(&org)
+	s := archiveSettings(org.Settings)
+
+	if req.Enabled != nil {
+		s.Enabled = *req.Enabled
+	}
+	if req.RetentionDays != nil {
+		s.RetentionDays = *req.RetentionDays
+	}
+	if s.RetentionDays < minArchiveRetentionDays {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("retention_days must be at least %d", minArchiveRetentionDays), nil, "")
+	}
+
+	if org.Settings == nil {
+		org.Settings = models.JSONB{}
+	}
+	org.Settings["archive"] = map[string]interface{}{
+		"enabled":        s.Enabled,
+		"retention_days": s.RetentionDays,
+	}
+	if err := a.DB.Save(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	a.recordOrgSettingsAudit(r, &org, before)
+
+	return r.SendEnvelope(s)
+}
+
+// findArchivedContact loads a contact whose archives a user may read: any of the
+// organization's with contacts:read, otherwise only those assigned to them
+func (a *App) findArchivedContact(r *fastglue.Request, orgID uuid.UUID, contactID string) (*models.Contact, error) {
+	id, err := uuid.Parse(contactID)
+	if err != nil {
+		return nil, err
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	var contact models.Contact
+	query := a.DB.Where("id = ? AND organization_id = ?", id, orgID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("assigned_user_id = ?", userID)
+	}
+	if err := query.First(&contact).Error; err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
+// ListContactArchives returns the archives of a contact's messages, newest first
+func (a *App) ListContactArchives(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	contact, err := a.findArchivedContact(r, orgID, r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
+	}
+
+	page, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("page")))
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := a.DB.Model(&models.MessageArchive{}).Where("organization_id = ? AND contact_id = ?", orgID, contact.ID)
+	var total int64
+	query.Count(&total)
+
+	var archives []models.MessageArchive
+	if err := query.Order("first_message_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&archives).Error; err != nil {
+		a.Log.Error("Failed to list message archives", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list archives", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]any{
+		"archives": archives,
+		"total":    total,
+		"page":     page,
+		"limit":    limit,
+	})
+}
+
+// GetArchivedMessages returns a contact's archived messages, oldest first, read back
+// from archive storage. from and to (YYYY-MM-DD, in the organization's time zone)
+// narrow the messages; a range may span at most maxArchivesPerRequest archives.
+func (a *App) GetArchivedMessages(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	contact, err := a.findArchivedContact(r, orgID, r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
+	}
+
+	loc := a.getOrgLocation(orgID)
+	if loc == nil {
+		loc = time.UTC
+	}
+	from, to, errMsg := parseExportDateRange(r.RequestCtx.QueryArgs(), loc)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, errMsg, nil, "")
+	}
+	var end *time.Time
+	if to != nil {
+		t := to.AddDate(0, 0, 1)
+		end = &t
+	}
+
+	query := a.DB.Where("organization_id = ? AND contact_id = ?", orgID, contact.ID)
+	if from != nil {
+		query = query.Where("last_message_at >= ?", *from)
+	}
+	if end != nil {
+		query = query.Where("first_message_at < ?", *end)
+	}
+	var archives []models.MessageArchive
+	if err := query.Order("first_message_at ASC").Limit(maxArchivesPerRequest + 1).Find(&archives).Error; err != nil {
+		a.Log.Error("Failed to load message archives", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load archived messages", nil, "")
+	}
+	if len(archives) > maxArchivesPerRequest {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Too many archives in the date range, narrow it with from and to", nil, "")
+	}
+
+	response := []ArchivedMessageResponse{}
+	for _, archive := range archives {
+		messages, err := a.readArchive(r.RequestCtx, &archive)
+		if err != nil {
+			a.Log.Error("Failed to read message archive", "error", err, "archive_id", archive.ID)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load archived messages", nil, "")
+		}
+		kept := messages[:0]
+		for _, m := range messages {
+			if (from == nil || !m.CreatedAt.Before(*from)) && (end == nil || m.CreatedAt.Before(*end)) {
+				kept = append(kept, m)
+			}
+		}
+		for _, m := range a.buildMessagesResponse(kept) {
+			response = append(response, ArchivedMessageResponse{MessageResponse: m, ArchiveID: archive.ID})
+		}
+	}
+
+	return r.SendEnvelope(map[string]any{
+		"messages": response,
+		"total":    len(response),
+		"archives": len(archives),
+	})
+}
+
+// readArchive reads the messages of an archive from archive storage
+func (a *App) readArchive(ctx context.Context, archive *models.MessageArchive) ([]models.Message, error) {
+	data, err := a.archiveStore().Get(ctx, archive.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	return decodeArchive(data)
+}
+
+// ServeArchivedMedia serves the media file of an archived message
+func (a *App) ServeArchivedMedia(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	archiveID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid archive ID", nil, "")
+	}
+	messageID, err := uuid.Parse(r.RequestCtx.UserValue("message_id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid message ID", nil, "")
+	}
+
+	var archive models.MessageArchive
+	if err := a.DB.Where("id = ? AND organization_id = ?", archiveID, orgID).First(&archive).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Archive not found", nil, "")
+	}
+	if _, err := a.findArchivedContact(r, orgID, archive.ContactID.String()); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Access denied", nil, "")
+	}
+
+	messages, err := a.readArchive(r.RequestCtx, &archive)
+	if err != nil {
+		a.Log.Error("Failed to read message archive", "error", err, "archive_id", archive.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to read archive", nil, "")
+	}
+	var message *models.Message
+	for i := range messages {
+		if messages[i].ID == messageID {
+			message = &messages[i]
+			break
+		}
+	}
+	if message == nil || message.MediaURL == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "No media found", nil, "")
+	}
+	if !strings.HasPrefix(message.MediaURL, archiveMediaKey(orgID, "")) || strings.Contains(message.MediaURL, "..") {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "File not found", nil, "")
+	}
+
+	data, err := a.archiveStore().Get(r.RequestCtx, message.MediaURL)
+	if errors.Is(err, storage.ErrNotFound) {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "File not found", nil, "")
+	}
+	if err != nil {
+		a.Log.Error("Failed to read archived media", "path", message.MediaURL, "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to read file", nil, "")
+	}
+
+	contentType := message.MediaMimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	r.RequestCtx.Response.Header.Set("Content-Type", contentType)
+	r.RequestCtx.Response.Header.Set("Cache-Control", "private, max-age=3600")
+	r.RequestCtx.SetBody(data)
+	return nil
+}
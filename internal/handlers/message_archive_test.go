@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/storage"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveSettings(t *testing.T) {
+	assert.Equal(t, ArchiveSettings{RetentionDays: defaultArchiveRetentionDays}, archiveSettings(nil))
+	assert.Equal(t, ArchiveSettings{Enabled: true, RetentionDays: 90}, archiveSettings(models.JSONB{
+		"archive": map[string]interface{}{"enabled": true, "retention_days": float64(90)},
+	}))
+}
+
+func TestEncodeArchive(t *testing.T) {
+	messages := []models.Message{
+		{BaseModel: models.BaseModel{ID: uuid.New(), CreatedAt: time.Now().UTC().Truncate(time.Second)},
+			Direction: models.DirectionIncoming, MessageType: models.MessageTypeText, Content: "Hi\nthere"},
+		{BaseModel: models.BaseModel{ID: uuid.New()}, Direction: models.DirectionOutgoing,
+			MessageType: models.MessageTypeImage, MediaURL: "archive/org/media/images/a.jpg"},
+	}
+	data, err := encodeArchive(messages)
+	require.NoError(t, err)
+
+	decoded, err := decodeArchive(data)
+	require.NoError(t, err)
+	require.Len(t, decoded, 2)
+	assert.Equal(t, messages[0].ID, decoded[0].ID)
+	assert.Equal(t, "Hi\nthere", decoded[0].Content)
+	assert.True(t, messages[0].CreatedAt.Equal(decoded[0].CreatedAt))
+	assert.Equal(t, messages[1].MediaURL, decoded[1].MediaURL)
+
+	_, err = decodeArchive([]byte("not gzip"))
+	assert.Error(t, err)
+}
+
+func TestArchiveContactMessages(t *testing.T) {
+	media := storage.NewLocal(t.TempDir())
+	archive := storage.NewLocal(t.TempDir())
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger(), Media: media, Archive: archive}
+	seq, contact, _ := sequenceTestContact(t, app, nil)
+	orgID := seq.OrganizationID
+	ctx := context.Background()
+
+	now := time.Now()
+	require.NoError(t, media.Put(ctx, "images/old.jpg", []byte("jpeg"), "image/jpeg"))
+	old := []models.Message{
+		{BaseModel: models.BaseModel{ID: uuid.New(), CreatedAt: now.AddDate(0, 0, -100)}, OrganizationID: orgID, ContactID: contact.ID,
+			WhatsAppAccount: contact.WhatsAppAccount, Direction: models.DirectionIncoming, MessageType: models.MessageTypeText, Content: "old"},
+		{BaseModel: models.BaseModel{ID: uuid.New(), CreatedAt: now.AddDate(0, 0, -99)}, OrganizationID: orgID, ContactID: contact.ID,
+			WhatsAppAccount: contact.WhatsAppAccount, Direction: models.DirectionIncoming, MessageType: models.MessageTypeImage,
+			MediaURL: "images/old.jpg", MediaMimeType: "image/jpeg"},
+	}
+	require.NoError(t, app.DB.Create(&old).Error)
+	recent := models.Message{BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: orgID, ContactID: contact.ID,
+		WhatsAppAccount: contact.WhatsAppAccount, Direction: models.DirectionOutgoing, MessageType: models.MessageTypeText,
+		Content: "recent", IsReply: true, ReplyToMessageID: &old[0].ID}
+	require.NoError(t, app.DB.Create(&recent).Error)
+	app.recordUsage(orgID, models.UsageMetricStorage, 10)
+
+	archived, err := app.archiveOrganization(ctx, orgID, now.AddDate(0, 0, -90))
+	require.NoError(t, err)
+	assert.Equal(t, 2, archived)
+
+	// The old messages are gone and the recent one lost its reference
+	var remaining []models.Message
+	require.NoError(t, app.DB.Unscoped().Where("contact_id = ?", contact.ID).Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, recent.ID, remaining[0].ID)
+	assert.Nil(t, remaining[0].ReplyToMessageID)
+
+	var record models.MessageArchive
+	require.NoError(t, app.DB.Where("contact_id = ?", contact.ID).First(&record).Error)
+	assert.Equal(t, 2, record.MessageCount)
+	assert.Equal(t, 1, record.MediaCount)
+
+	// The messages and their media are in the archive
+	messages, err := app.readArchive(ctx, &record)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "old", messages[0].Content)
+	assert.Equal(t, archiveMediaKey(orgID, "images/old.jpg"), messages[1].MediaURL)
+	data, err := archive.Get(ctx, messages[1].MediaURL)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", string(data))
+	_, err = media.Get(ctx, "images/old.jpg")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Equal(t, int64(6), app.currentUsage(orgID, models.UsageMetricStorage), "archived media no longer counts")
+
+	// Nothing is left to archive
+	archived, err = app.archiveOrganization(ctx, orgID, now.AddDate(0, 0, -90))
+	require.NoError(t, err)
+	assert.Zero(t, archived)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/websocket"
+)
+
+// IncomingMessageEdit is the webhook content of a message the contact edited
+type IncomingMessageEdit struct {
+	OriginalMessageID string `json:"original_message_id"`
+	Message           struct {
+		Type string `json:"type"`
+		Text *struct {
+			Body string `json:"body"`
+		} `json:"text,omitempty"`
+		Image *struct {
+			Caption string `json:"caption,omitempty"`
+		} `json:"image,omitempty"`
+		Video *struct {
+			Caption string `json:"caption,omitempty"`
+		} `json:"video,omitempty"`
+		Document *struct {
+			Caption string `json:"caption,omitempty"`
+		} `json:"document,omitempty"`
+	} `json:"message"`
+}
+
+// IncomingMessageRevoke is the webhook content of a message the contact deleted
+type IncomingMessageRevoke struct {
+	OriginalMessageID string `json:"original_message_id"`
+}
+
+// content returns the edited text, or the caption of edited media
+func (e *IncomingMessageEdit) content() string {
+	m := e.Message
+	switch {
+	case m.Text != nil:
+		return m.Text.Body
+	case m.Image != nil:
+		return m.Image.Caption
+	case m.Video != nil:
+		return m.Video.Caption
+	case m.Document != nil:
+		return m.Document.Caption
+	}
+	return ""
+}
+
+// handleIncomingEdit replaces the content of a message the contact edited, keeping the
+// earlier versions in the message metadata
+func (a *App) handleIncomingEdit(account *models.WhatsAppAccount, edit *IncomingMessageEdit) {
+	message, contact := a.findIncomingMessage(account, edit.OriginalMessageID)
+	if message == nil {
+		a.Log.Warn("Message not found for edit", "wamid", edit.OriginalMessageID)
+		return
+	}
+
+	applyMessageEdit(message, edit.content(), time.Now())
+	if err := a.DB.Model(message).Updates(map[string]interface{}{
+		"content":   message.Content,
+		"edited_at": message.EditedAt,
+		"metadata":  message.Metadata,
+	}).Error; err != nil {
+		a.Log.Error("Failed to update edited message", "error", err, "message_id", message.ID)
+		return
+	}
+
+	a.Log.Info("Contact edited message", "message_id", message.ID, "contact_id", contact.ID)
+	a.broadcastMessageUpdate(message)
+	a.DispatchWebhook(account.OrganizationID, models.WebhookEventMessageEdited, MessageEventData{
+		MessageID:       message.ID.String(),
+		ContactID:       contact.ID.String(),
+		ContactPhone:    contact.PhoneNumber,
+		ContactName:     contact.ProfileName,
+		MessageType:     message.MessageType,
+		Content:         message.Content,
+		WhatsAppAccount: account.Name,
+		Direction:       models.DirectionIncoming,
+	})
+}
+
+// handleIncomingRevoke flags a message the contact deleted for everyone. The content
+// is kept for the conversation record, but agents see it as deleted.
+func (a *App) handleIncomingRevoke(account *models.WhatsAppAccount, revoke *IncomingMessageRevoke) {
+	message, contact := a.findIncomingMessage(account, revoke.OriginalMessageID)
+	if message == nil {
+		a.Log.Warn("Message not found for deletion", "wamid", revoke.OriginalMessageID)
+		return
+	}
+
+	now := time.Now()
+	message.RevokedAt = &now
+	if err := a.DB.Model(message).Update("revoked_at", now).Error; err != nil {
+		a.Log.Error("Failed to flag deleted message", "error", err, "message_id", message.ID)
+		return
+	}
+
+	a.Log.Info("Contact deleted message", "message_id", message.ID, "contact_id", contact.ID)
+	a.broadcastMessageUpdate(message)
+	a.DispatchWebhook(account.OrganizationID, models.WebhookEventMessageDeleted, MessageEventData{
+		MessageID:       message.ID.String(),
+		ContactID:       contact.ID.String(),
+		ContactPhone:    contact.PhoneNumber,
+		ContactName:     contact.ProfileName,
+		MessageType:     message.MessageType,
+		WhatsAppAccount: account.Name,
+		Direction:       models.DirectionIncoming,
+	})
+}
+
+// findIncomingMessage returns a message received on the account, and its contact
+func (a *App) findIncomingMessage(account *models.WhatsAppAccount, whatsappMsgID string) (*models.Message, *models.Contact) {
+	if whatsappMsgID == "" {
+		return nil, nil
+	}
+	var message models.Message
+	if err := a.DB.Where("organization_id = ? AND whats_app_message_id = ? AND direction = ?",
+		account.OrganizationID, whatsappMsgID, models.DirectionIncoming).
+		Preload("Contact").
+		First(&message).Error; err != nil || message.Contact == nil {
+		return nil, nil
+	}
+	return &message, message.Contact
+}
+
+// applyMessageEdit sets a message's new content, appending the previous content to the
+// edit history in its metadata
+func applyMessageEdit(message *models.Message, content string, at time.Time) {
+	if message.Metadata == nil {
+		message.Metadata = models.JSONB{}
+	}
+	history, _ := message.Metadata["edit_history"].([]interface{})
+	message.Metadata["edit_history"] = append(history, map[string]interface{}{
+		"content":   message.Content,
+		"edited_at": at.UTC().Format(time.RFC3339),
+	})
+	message.Content = content
+	message.EditedAt = &at
+}
+
+// messageRetracted reports whether the message matching a condition was edited or
+// deleted by the contact, so replies and automations based on it no longer apply
+func (a *App) messageRetracted(query string, value string) bool {
+	if value == "" {
+		return false
+	}
+	var count int64
+	if err := a.DB.Model(&models.Message{}).
+		Where(query, value).
+		Where("edited_at IS NOT NULL OR revoked_at IS NOT NULL").
+		Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// broadcastMessageUpdate tells agents viewing the conversation that a message changed
+func (a *App) broadcastMessageUpdate(message *models.Message) {
+	if a.WSHub == nil {
+		return
+	}
+	a.WSHub.BroadcastToOrg(message.OrganizationID, websocket.WSMessage{
+		Type: websocket.TypeMessageUpdate,
+		Payload: map[string]any{
+			"message_id": message.ID.String(),
+			"contact_id": message.ContactID.String(),
+			"content":    map[string]string{"body": message.Content},
+			"edited_at":  message.EditedAt,
+			"revoked_at": message.RevokedAt,
+		},
+	})
+}
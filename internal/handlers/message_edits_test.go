@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncomingMessageEdit_Content(t *testing.T) {
+	var msg IncomingTextMessage
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"from": "15550001111",
+		"id": "wamid.edit",
+		"type": "edit",
+		"edit": {
+			"original_message_id": "wamid.original",
+			"message": {"type": "text", "text": {"body": "Deliver on Friday instead"}}
+		}
+	}`), &msg))
+	require.NotNil(t, msg.Edit)
+	assert.Equal(t, "wamid.original", msg.Edit.OriginalMessageID)
+	assert.Equal(t, "Deliver on Friday instead", msg.Edit.content())
+
+	var caption IncomingMessageEdit
+	require.NoError(t, json.Unmarshal([]byte(`{"original_message_id": "wamid.photo", "message": {"type": "image", "image": {"caption": "Front door"}}}`), &caption))
+	assert.Equal(t, "Front door", caption.content())
+}
+
+func TestApplyMessageEdit(t *testing.T) {
+	message := &models.Message{Content: "Deliver on Thursday"}
+	first := time.Date(2024, 3, 5, 9, 30, 0, 0, time.UTC)
+	applyMessageEdit(message, "Deliver on Friday", first)
+	applyMessageEdit(message, "Deliver on Saturday", first.Add(time.Minute))
+
+	assert.Equal(t, "Deliver on Saturday", message.Content)
+	require.NotNil(t, message.EditedAt)
+	assert.Equal(t, first.Add(time.Minute), *message.EditedAt)
+
+	history, ok := message.Metadata["edit_history"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, history, 2)
+	assert.Equal(t, "Deliver on Thursday", history[0].(map[string]interface{})["content"])
+	assert.Equal(t, "2024-03-05T09:30:00Z", history[0].(map[string]interface{})["edited_at"])
+	assert.Equal(t, "Deliver on Friday", history[1].(map[string]interface{})["content"])
+}
+
+func TestHandleIncomingEditAndRevoke(t *testing.T) {
+	redis := testutil.SetupTestRedis(t)
+	if redis == nil {
+		t.Skip("TEST_REDIS_URL not set, skipping Redis test")
+	}
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Redis:  redis,
+		Log:    testutil.NopLogger(),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Edit Org " + uuid.New().String()[:8],
+		Slug:      "edit-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		Name:           "edit-account-" + uuid.New().String()[:8],
+		PhoneID:        "phone-" + uuid.New().String()[:8],
+		BusinessID:     "waba-" + uuid.New().String()[:8],
+		AccessToken:    "test-token",
+		Status:         "active",
+	}
+	require.NoError(t, app.DB.Create(account).Error)
+	contact := &models.Contact{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		PhoneNumber:     "1555" + uuid.New().String()[:7],
+		WhatsAppAccount: account.Name,
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+
+	received := func(wamid, content string) *models.Message {
+		m := &models.Message{
+			BaseModel:         models.BaseModel{ID: uuid.New()},
+			OrganizationID:    org.ID,
+			WhatsAppAccount:   account.Name,
+			ContactID:         contact.ID,
+			WhatsAppMessageID: wamid,
+			Direction:         models.DirectionIncoming,
+			MessageType:       models.MessageTypeText,
+			Content:           content,
+			Status:            models.MessageStatusReceived,
+		}
+		require.NoError(t, app.DB.Create(m).Error)
+		return m
+	}
+	edited := received("wamid.edit-"+uuid.New().String()[:8], "Cancel my order")
+	deleted := received("wamid.revoke-"+uuid.New().String()[:8], "My card number is 4111...")
+	untouched := received("wamid.keep-"+uuid.New().String()[:8], "Thanks")
+
+	edit := &IncomingMessageEdit{OriginalMessageID: edited.WhatsAppMessageID}
+	edit.Message.Text = &struct {
+		Body string `json:"body"`
+	}{Body: "Don't cancel my order"}
+	app.handleIncomingEdit(account, edit)
+	app.handleIncomingRevoke(account, &IncomingMessageRevoke{OriginalMessageID: deleted.WhatsAppMessageID})
+	app.WaitForBackgroundTasks()
+
+	var updated models.Message
+	require.NoError(t, app.DB.Where("id = ?", edited.ID).First(&updated).Error)
+	assert.Equal(t, "Don't cancel my order", updated.Content)
+	assert.NotNil(t, updated.EditedAt)
+	assert.Nil(t, updated.RevokedAt)
+
+	var flagged models.Message
+	require.NoError(t, app.DB.Where("id = ?", deleted.ID).First(&flagged).Error)
+	assert.NotNil(t, flagged.RevokedAt)
+
+	assert.True(t, app.messageRetracted("whats_app_message_id = ?", edited.WhatsAppMessageID))
+	assert.True(t, app.messageRetracted("id = ?", deleted.ID.String()))
+	assert.False(t, app.messageRetracted("id = ?", untouched.ID.String()))
+}
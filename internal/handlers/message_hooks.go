@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// Limits of message hooks, which hold up the message they're called for
+const (
+	defaultMessageHookTimeout = 5 // seconds
+	maxMessageHookTimeout     = 15
+	maxMessageHookResponse    = 64 << 10
+)
+
+// ErrMessageStoppedByHook is returned when sending a message an outbound hook stopped
+var ErrMessageStoppedByHook = errors.New("message was stopped by a message hook")
+
+// HookMessage is the message a hook is called with
+type HookMessage struct {
+	Stage           string                 `json:"stage"` // inbound or outbound
+	OrganizationID  string                 `json:"organization_id"`
+	WhatsAppAccount string                 `json:"whatsapp_account"`
+	ContactID       string                 `json:"contact_id"`
+	ContactPhone    string                 `json:"contact_phone"`
+	ContactName     string                 `json:"contact_name"`
+	MessageID       string                 `json:"message_id,omitempty"` // WhatsApp message ID, for inbound messages
+	Type            string                 `json:"type"`
+	Content         string                 `json:"content"` // Text, caption or body of the message
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// HookResult is what a hook does with a message. The zero value leaves it as is.
+type HookResult struct {
+	// Content replaces the message's text, caption or body
+	Content *string `json:"content,omitempty"`
+	// Metadata is added to the message's metadata, under "hooks"
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Stop ends the message's processing: an inbound message is saved but not
+	// answered, and an outbound message isn't sent
+	Stop bool `json:"stop,omitempty"`
+}
+
+// MessageHook sees messages as they're processed. Hooks compiled into the server
+// are added to App.MessageHooks and run for every organization, before the
+// organization's own HTTP hooks.
+type MessageHook interface {
+	HandleMessage(ctx context.Context, msg *HookMessage) (*HookResult, error)
+}
+
+// httpMessageHook calls an organization's message hook endpoint
+type httpMessageHook struct {
+	app  *App
+	hook models.MessageHook
+}
+
+// HandleMessage posts the message to the hook, signed with its secret, and reads
+// the result from the response. An empty response leaves the message as is.
+func (h httpMessageHook) HandleMessage(ctx context.Context, msg *HookMessage) (*HookResult, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(h.hook.TimeoutSecs) * time.Second
+	if h.hook.TimeoutSecs <= 0 {
+		timeout = defaultMessageHookTimeout * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Whatomate-Hook/1.0")
+	req.Header.Set("X-Hook-Stage", msg.Stage)
+	for key, value := range h.hook.Headers {
+		if strValue, ok := value.(string); ok {
+			req.Header.Set(key, strValue)
+		}
+	}
+	if h.hook.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", computeHMACSignature(body, h.hook.Secret))
+	}
+
+	resp, err := h.app.httpClient(config.OutboundWebhooks, timeout).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxMessageHookResponse))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &WebhookError{StatusCode: resp.StatusCode}
+	}
+
+	var result HookResult
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		return &result, nil
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("invalid hook response: %w", err)
+	}
+	return &result, nil
+}
+
+// messageHooks returns the hooks that run for an organization's messages at a stage,
+// in order
+func (a *App) messageHooks(orgID uuid.UUID, stage string) []MessageHook {
+	hooks := append([]MessageHook(nil), a.MessageHooks...)
+
+	var configured []models.MessageHook
+	if err := a.DB.Where("organization_id = ? AND stage = ? AND is_active = ?", orgID, stage, true).
+		Order("position ASC, created_at ASC").Find(&configured).Error; err != nil {
+		a.Log.Error("Failed to load message hooks", "error", err, "org_id", orgID)
+	}
+	for _, hook := range configured {
+		hooks = append(hooks, httpMessageHook{app: a, hook: hook})
+	}
+	return hooks
+}
+
+// runMessageHooks passes a message through the hooks of its stage, each seeing the
+// message as the ones before left it. It reports whether a hook stopped the
+// message; hooks that fail are skipped, unless they stop messages on error.
+func (a *App) runMessageHooks(ctx context.Context, orgID uuid.UUID, msg *HookMessage) bool {
+	for _, hook := range a.messageHooks(orgID, msg.Stage) {
+		result, err := hook.HandleMessage(ctx, msg)
+		if err != nil {
+			name, stopOnError := "", false
+			if h, ok := hook.(httpMessageHook); ok {
+				name, stopOnError = h.hook.Name, h.hook.StopOnError
+			}
+			a.log(ctx).Warn("Message hook failed", "error", err, "hook", name, "stage", msg.Stage, "stop", stopOnError)
+			if stopOnError {
+				return true
+			}
+			continue
+		}
+		if result == nil {
+			continue
+		}
+		if result.Content != nil {
+			msg.Content = *result.Content
+		}
+		if len(result.Metadata) > 0 {
+			if msg.Metadata == nil {
+				msg.Metadata = map[string]interface{}{}
+			}
+			for k, v := range result.Metadata {
+				msg.Metadata[k] = v
+			}
+		}
+		if result.Stop {
+			return true
+		}
+	}
+	return false
+}
+
+// newHookMessage returns the message hooks see for a contact's message
+func newHookMessage(stage string, account *models.WhatsAppAccount, contact *models.Contact, msgType, content string) *HookMessage {
+	return &HookMessage{
+		Stage:           stage,
+		OrganizationID:  account.OrganizationID.String(),
+		WhatsAppAccount: account.Name,
+		ContactID:       contact.ID.String(),
+		ContactPhone:    contact.PhoneNumber,
+		ContactName:     contact.ProfileName,
+		Type:            msgType,
+		Content:         content,
+	}
+}
+
+// hookOutgoingMessage runs the outbound hooks on a message about to be sent,
+// applying their changes to the request
+func (a *App) hookOutgoingMessage(ctx context.Context, req *OutgoingMessageRequest) error {
+	// The text hooks can change, by message type. Other messages are seen by hooks,
+	// which can stop them or add metadata.
+	var text *string
+	switch req.Type {
+	case models.MessageTypeText:
+		text = &req.Content
+	case models.MessageTypeImage, models.MessageTypeVideo, models.MessageTypeAudio, models.MessageTypeDocument:
+		text = &req.Caption
+	case models.MessageTypeInteractive, models.MessageTypeFlow:
+		text = &req.BodyText
+	}
+	content := a.getMessagePreview(*req)
+	if text != nil {
+		content = *text
+	}
+
+	msg := newHookMessage(models.MessageHookStageOutbound, req.Account, req.Contact, string(req.Type), content)
+	if a.runMessageHooks(ctx, req.Account.OrganizationID, msg) {
+		return ErrMessageStoppedByHook
+	}
+	if text != nil {
+		*text = msg.Content
+	}
+	if len(msg.Metadata) > 0 {
+		metadata := models.JSONB{}
+		for k, v := range req.Metadata {
+			metadata[k] = v
+		}
+		metadata["hooks"] = msg.Metadata
+		req.Metadata = metadata
+	}
+	return nil
+}
+
+// ============================================================================
+// Message hook management
+// ============================================================================
+
+// MessageHookRequest represents the request body for creating/updating a message hook
+type MessageHookRequest struct {
+	Name        string            `json:"name"`
+	Stage       string            `json:"stage"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`
+	Secret      string            `json:"secret"`
+	TimeoutSecs int               `json:"timeout_secs"`
+	Position    int               `json:"position"`
+	StopOnError bool              `json:"stop_on_error"`
+	IsActive    *bool             `json:"is_active"`
+}
+
+// MessageHookResponse represents the API response for a message hook
+type MessageHookResponse struct {
+	ID          uuid.UUID         `json:"id"`
+	Name        string            `json:"name"`
+	Stage       string            `json:"stage"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`
+	HasSecret   bool              `json:"has_secret"`
+	TimeoutSecs int               `json:"timeout_secs"`
+	Position    int               `json:"position"`
+	StopOnError bool              `json:"stop_on_error"`
+	IsActive    bool              `json:"is_active"`
+	CreatedAt   string            `json:"created_at"`
+	UpdatedAt   string            `json:"updated_at"`
+}
+
+// validateMessageHook checks the fields of a message hook, defaulting its timeout
+func validateMessageHook(hook *models.MessageHook) error {
+	if hook.Name == "" {
+		return errors.New("name is required")
+	}
+	if hook.Stage != models.MessageHookStageInbound && hook.Stage != models.MessageHookStageOutbound {
+		return fmt.Errorf("stage must be %s or %s", models.MessageHookStageInbound, models.MessageHookStageOutbound)
+	}
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	if hook.TimeoutSecs == 0 {
+		hook.TimeoutSecs = defaultMessageHookTimeout
+	}
+	if hook.TimeoutSecs < 1 || hook.TimeoutSecs > maxMessageHookTimeout {
+		return fmt.Errorf("timeout_secs must be between 1 and %d", maxMessageHookTimeout)
+	}
+	return nil
+}
+
+// ListMessageHooks returns the organization's message hooks, in the order they run
+func (a *App) ListMessageHooks(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	var hooks []models.MessageHook
+	if err := a.DB.Where("organization_id = ?", orgID).Order("stage ASC, position ASC, created_at ASC").Find(&hooks).Error; err != nil {
+		a.Log.Error("Failed to list message hooks", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list message hooks", nil, "")
+	}
+
+	result := make([]MessageHookResponse, len(hooks))
+	for i, hook := range hooks {
+		result[i] = messageHookToResponse(hook)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message_hooks": result,
+	})
+}
+
+// CreateMessageHook creates a message hook
+func (a *App) CreateMessageHook(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	if !a.HasFeature(orgID, models.PlanFeatureWebhooks) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureWebhooks), nil, "")
+	}
+
+	var req MessageHookRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	hook := models.MessageHook{
+		OrganizationID: orgID,
+		Name:           req.Name,
+		Stage:          req.Stage,
+		URL:            req.URL,
+		Headers:        messageHookHeaders(req.Headers),
+		Secret:         req.Secret,
+		TimeoutSecs:    req.TimeoutSecs,
+		Position:       req.Position,
+		StopOnError:    req.StopOnError,
+		IsActive:       true,
+	}
+	if req.IsActive != nil {
+		hook.IsActive = *req.IsActive
+	}
+	if err := validateMessageHook(&hook); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	if err := a.DB.Create(&hook).Error; err != nil {
+		a.Log.Error("Failed to create message hook", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create message hook", nil, "")
+	}
+
+	return r.SendEnvelope(messageHookToResponse(hook))
+}
+
+// GetMessageHook returns a single message hook
+func (a *App) GetMessageHook(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	hook, err := a.findMessageHook(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Message hook not found", nil, "")
+	}
+
+	return r.SendEnvelope(messageHookToResponse(*hook))
+}
+
+// UpdateMessageHook updates a message hook. The secret is kept unless a new one is given.
+func (a *App) UpdateMessageHook(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	hook, err := a.findMessageHook(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Message hook not found", nil, "")
+	}
+
+	var req MessageHookRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	if req.Name != "" {
+		hook.Name = req.Name
+	}
+	if req.Stage != "" {
+		hook.Stage = req.Stage
+	}
+	if req.URL != "" {
+		hook.URL = req.URL
+	}
+	if req.Headers != nil {
+		hook.Headers = messageHookHeaders(req.Headers)
+	}
+	if req.Secret != "" {
+		hook.Secret = req.Secret
+	}
+	if req.TimeoutSecs != 0 {
+		hook.TimeoutSecs = req.TimeoutSecs
+	}
+	hook.Position = req.Position
+	hook.StopOnError = req.StopOnError
+	if req.IsActive != nil {
+		hook.IsActive = *req.IsActive
+	}
+	if err := validateMessageHook(hook); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	if err := a.DB.Save(hook).Error; err != nil {
+		a.Log.Error("Failed to update message hook", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update message hook", nil, "")
+	}
+
+	return r.SendEnvelope(messageHookToResponse(*hook))
+}
+
+// DeleteMessageHook deletes a message hook
+func (a *App) DeleteMessageHook(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	hook, err := a.findMessageHook(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Message hook not found", nil, "")
+	}
+
+	if err := a.DB.Delete(hook).Error; err != nil {
+		a.Log.Error("Failed to delete message hook", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete message hook", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]string{"message": "Message hook deleted successfully"})
+}
+
+// findMessageHook loads the message hook in the {id} path parameter
+func (a *App) findMessageHook(r *fastglue.Request, orgID uuid.UUID) (*models.MessageHook, error) {
+	hookID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	var hook models.MessageHook
+	if err := a.DB.Where("id = ? AND organization_id = ?", hookID, orgID).First(&hook).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func messageHookHeaders(headers map[string]string) models.JSONB {
+	result := models.JSONB{}
+	for k, v := range headers {
+		result[k] = v
+	}
+	return result
+}
+
+func messageHookToResponse(hook models.MessageHook) MessageHookResponse {
+	headers := make(map[string]string, len(hook.Headers))
+	for k, v := range hook.Headers {
+		if s, ok := v.(string); ok {
+			headers[k] = s
+		}
+	}
+	return MessageHookResponse{
+		ID:          hook.ID,
+		Name:        hook.Name,
+		Stage:       hook.Stage,
+		URL:         hook.URL,
+		Headers:     headers,
+		HasSecret:   hook.Secret != "",
+		TimeoutSecs: hook.TimeoutSecs,
+		Position:    hook.Position,
+		StopOnError: hook.StopOnError,
+		IsActive:    hook.IsActive,
+		CreatedAt:   hook.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   hook.UpdatedAt.Format(time.RFC3339),
+	}
+}
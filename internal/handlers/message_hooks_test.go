@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hookFunc is an in-process message hook
+type hookFunc func(msg *HookMessage) (*HookResult, error)
+
+func (f hookFunc) HandleMessage(_ context.Context, msg *HookMessage) (*HookResult, error) {
+	return f(msg)
+}
+
+func TestValidateMessageHook(t *testing.T) {
+	hook := models.MessageHook{Name: "enrich", Stage: models.MessageHookStageInbound, URL: "https://hooks.example.com"}
+	require.NoError(t, validateMessageHook(&hook))
+	assert.Equal(t, defaultMessageHookTimeout, hook.TimeoutSecs)
+
+	tests := []struct {
+		name string
+		hook models.MessageHook
+	}{
+		{name: "no name", hook: models.MessageHook{Stage: models.MessageHookStageInbound, URL: "https://hooks.example.com"}},
+		{name: "unknown stage", hook: models.MessageHook{Name: "h", Stage: "before", URL: "https://hooks.example.com"}},
+		{name: "not a URL", hook: models.MessageHook{Name: "h", Stage: models.MessageHookStageOutbound, URL: "hooks.example.com"}},
+		{name: "timeout too long", hook: models.MessageHook{Name: "h", Stage: models.MessageHookStageOutbound, URL: "https://hooks.example.com", TimeoutSecs: 60}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, validateMessageHook(&tt.hook))
+		})
+	}
+}
+
+func TestHTTPMessageHook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, computeHMACSignature(body, "secret"), r.Header.Get("X-Webhook-Signature"))
+		assert.Equal(t, "inbound", r.Header.Get("X-Hook-Stage"))
+		assert.Equal(t, "value", r.Header.Get("X-Custom"))
+
+		var msg HookMessage
+		require.NoError(t, json.Unmarshal(body, &msg))
+		switch msg.Content {
+		case "empty":
+		case "fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_, _ = w.Write([]byte(`{"content":"` + msg.Content + ` (enriched)","metadata":{"tier":"gold"}}`))
+		}
+	}))
+	defer server.Close()
+
+	hook := httpMessageHook{app: &App{}, hook: models.MessageHook{
+		URL:     server.URL,
+		Secret:  "secret",
+		Headers: models.JSONB{"X-Custom": "value"},
+	}}
+	ctx := context.Background()
+
+	result, err := hook.HandleMessage(ctx, &HookMessage{Stage: "inbound", Content: "hello"})
+	require.NoError(t, err)
+	require.NotNil(t, result.Content)
+	assert.Equal(t, "hello (enriched)", *result.Content)
+	assert.Equal(t, "gold", result.Metadata["tier"])
+	assert.False(t, result.Stop)
+
+	result, err = hook.HandleMessage(ctx, &HookMessage{Stage: "inbound", Content: "empty"})
+	require.NoError(t, err)
+	assert.Equal(t, &HookResult{}, result, "an empty response leaves the message as is")
+
+	_, err = hook.HandleMessage(ctx, &HookMessage{Stage: "inbound", Content: "fail"})
+	assert.Error(t, err)
+}
+
+func TestHookOutgoingMessage(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	var seen []string
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+		MessageHooks: []MessageHook{hookFunc(func(msg *HookMessage) (*HookResult, error) {
+			seen = append(seen, msg.Stage+" "+msg.Content)
+			content := msg.Content + "!"
+			return &HookResult{Content: &content, Metadata: map[string]interface{}{"checked": true}}, nil
+		})},
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Hook Org " + uuid.New().String()[:8],
+		Slug:      "hook-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{OrganizationID: org.ID, Name: "main"}
+	contact := &models.Contact{BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: org.ID, PhoneNumber: "15550001111"}
+
+	// A failing hook is skipped
+	hook := models.MessageHook{OrganizationID: org.ID, Name: "audit", Stage: models.MessageHookStageOutbound, URL: failing.URL, IsActive: true}
+	require.NoError(t, app.DB.Create(&hook).Error)
+
+	req := OutgoingMessageRequest{Account: account, Contact: contact, Type: models.MessageTypeText, Content: "Hi", Metadata: models.JSONB{"translated_from": "Hola"}}
+	require.NoError(t, app.hookOutgoingMessage(context.Background(), &req))
+	assert.Equal(t, "Hi!", req.Content)
+	assert.Equal(t, models.JSONB{"translated_from": "Hola", "hooks": map[string]interface{}{"checked": true}}, req.Metadata)
+	assert.Equal(t, []string{"outbound Hi"}, seen)
+
+	// Unless it stops messages on error
+	require.NoError(t, app.DB.Model(&hook).Update("stop_on_error", true).Error)
+	req = OutgoingMessageRequest{Account: account, Contact: contact, Type: models.MessageTypeInteractive, BodyText: "Pick one"}
+	assert.ErrorIs(t, app.hookOutgoingMessage(context.Background(), &req), ErrMessageStoppedByHook)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxSearchQueryLength limits the length of a conversation search
+	maxSearchQueryLength = 200
+
+	// searchHighlightStart and searchHighlightStop mark the matches in snippets made by
+	// Postgres. They're control characters, so they survive escaping the snippet and
+	// are then replaced by <mark> tags.
+	searchHighlightStart = "\x02"
+	searchHighlightStop  = "\x03"
+)
+
+// searchHeadlineOptions are the ts_headline options snippets are made with: up to two
+// fragments of the message around the matches
+var searchHeadlineOptions = `StartSel="` + searchHighlightStart + `", StopSel="` + searchHighlightStop +
+	`", MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=" … "`
+
+// searchChannelSQL is the channel a message was sent on: the message's own, or its account's
+var searchChannelSQL = "COALESCE(NULLIF(m.channel, ''), NULLIF(wa.channel, ''), '" + string(models.ChannelWhatsApp) + "')"
+
+// unsearchableMessageTypes are the message types whose content isn't text people wrote
+var unsearchableMessageTypes = []models.MessageType{
+	models.MessageTypeLocation, models.MessageTypeOrder, models.MessageTypeContacts, models.MessageTypeReaction,
+}
+
+// MessageSearchResult is a message matching a conversation search, with a snippet
+// of its content in which the matches are wrapped in <mark> tags
+type MessageSearchResult struct {
+	ID              uuid.UUID          `json:"id"`
+	ContactID       uuid.UUID          `json:"contact_id"`
+	ContactName     string             `json:"contact_name"`
+	PhoneNumber     string             `json:"phone_number"`
+	WhatsAppAccount string             `json:"whatsapp_account"`
+	Channel         models.Channel     `json:"channel"`
+	Direction       models.Direction   `json:"direction"`
+	MessageType     models.MessageType `json:"message_type"`
+	SentByUserID    *uuid.UUID         `json:"sent_by_user_id,omitempty"`
+	Snippet         string             `json:"snippet"`
+	CreatedAt       time.Time          `json:"created_at"`
+}
+
+// messageSearchRow is a row of the search query
+type messageSearchRow struct {
+	ID              uuid.UUID
+	ContactID       uuid.UUID
+	ProfileName     string
+	PhoneNumber     string
+	WhatsAppAccount string
+	Channel         string
+	Direction       models.Direction
+	MessageType     models.MessageType
+	SentByUserID    *uuid.UUID
+	Snippet         string
+	CreatedAt       time.Time
+}
+
+// searchSnippet escapes a snippet made by Postgres for HTML, then wraps its matches in <mark> tags
+func searchSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, searchHighlightStart, "<mark>")
+	return strings.ReplaceAll(snippet, searchHighlightStop, "</mark>")
+}
+
+// SearchMessages finds the organization's messages whose content matches a full-text
+// search (q), using Postgres's web search syntax: words, "quoted phrases", OR and
+// -excluded words. Results can be narrowed to a contact's phone number, a date range,
+// a channel and an agent, and are sorted by relevance, or newest first with
+// sort=recent. Users without contacts:read only search the contacts assigned to them.
+func (a *App) SearchMessages(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	args := r.RequestCtx.QueryArgs()
+	q := strings.TrimSpace(string(args.Peek("q")))
+	if q == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "q is required", nil, "")
+	}
+	if len(q) > maxSearchQueryLength {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "q must be at most "+strconv.Itoa(maxSearchQueryLength)+" characters", nil, "")
+	}
+
+	page, _ := strconv.Atoi(string(args.Peek("page")))
+	limit, _ := strconv.Atoi(string(args.Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	loc := a.getOrgLocation(orgID)
+	if loc == nil {
+		loc = time.UTC
+	}
+	from, to, errMsg := parseExportDateRange(args, loc)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, errMsg, nil, "")
+	}
+
+	query := a.replicaDB().Table("messages AS m").
+		Joins("JOIN contacts c ON c.id = m.contact_id AND c.deleted_at IS NULL").
+		Joins("LEFT JOIN whatsapp_accounts wa ON wa.organization_id = m.organization_id AND wa.name = m.whats_app_account AND wa.deleted_at IS NULL").
+		Where("m.organization_id = ? AND m.deleted_at IS NULL", orgID).
+		Where("m.message_type NOT IN ?", unsearchableMessageTypes).
+		Where("to_tsvector('simple', m.content) @@ websearch_to_tsquery('simple', ?)", q)
+
+	// Users without contacts:read permission only search their assigned contacts
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("c.assigned_user_id = ?", userID)
+	}
+	if phone := string(args.Peek("phone")); phone != "" {
+		digits := searchPhoneDigits(phone)
+		if digits == "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid phone", nil, "")
+		}
+		query = query.Where("c.phone_number LIKE ?", "%"+digits+"%")
+	}
+	if from != nil {
+		query = query.Where("m.created_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("m.created_at < ?", to.AddDate(0, 0, 1))
+	}
+	if channel := models.Channel(args.Peek("channel")); channel != "" {
+		switch channel {
+		case models.ChannelWhatsApp, models.ChannelTelegram, models.ChannelInstagram, models.ChannelMessenger, models.ChannelWebChat, models.ChannelSMS:
+		default:
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid channel", nil, "")
+		}
+		query = query.Where(searchChannelSQL+" = ?", channel)
+	}
+	if agent := string(args.Peek("agent_id")); agent != "" {
+		agentID, err := uuid.Parse(agent)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid agent_id", nil, "")
+		}
+		// Messages the agent sent, and the conversations assigned to them
+		query = query.Where("(m.sent_by_user_id = ? OR c.assigned_user_id = ?)", agentID, agentID)
+	}
+	if account := string(args.Peek("whatsapp_account")); account != "" {
+		query = query.Where("m.whats_app_account = ?", account)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		a.Log.Error("Failed to count message search results", "error", err, "organization_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Search failed", nil, "")
+	}
+
+	order := clause.OrderBy{Expression: clause.Expr{
+		SQL:                "ts_rank(to_tsvector('simple', m.content), websearch_to_tsquery('simple', ?)) DESC, m.created_at DESC",
+		Vars:               []interface{}{q},
+		WithoutParentheses: true,
+	}}
+	if string(args.Peek("sort")) == "recent" {
+		order = clause.OrderBy{Columns: []clause.OrderByColumn{{Column: clause.Column{Name: "m.created_at", Raw: true}, Desc: true}}}
+	}
+	var rows []messageSearchRow
+	if err := query.
+		Select("m.id, m.contact_id, c.profile_name, c.phone_number, m.whats_app_account, "+searchChannelSQL+" AS channel, "+
+			"m.direction, m.message_type, m.sent_by_user_id, m.created_at, "+
+			"ts_headline('simple', m.content, websearch_to_tsquery('simple', ?), ?) AS snippet", q, searchHeadlineOptions).
+		Order(order).
+		Offset((page - 1) * limit).Limit(limit).
+		Scan(&rows).Error; err != nil {
+		a.Log.Error("Failed to search messages", "error", err, "organization_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Search failed", nil, "")
+	}
+
+	shouldMask := a.ShouldMaskPhoneNumbers(orgID)
+	results := make([]MessageSearchResult, len(rows))
+	for i, row := range rows {
+		phone, name := row.PhoneNumber, row.ProfileName
+		if shouldMask {
+			phone, name = MaskPhoneNumber(phone), MaskIfPhoneNumber(name)
+		}
+		results[i] = MessageSearchResult{
+			ID:              row.ID,
+			ContactID:       row.ContactID,
+			ContactName:     name,
+			PhoneNumber:     phone,
+			WhatsAppAccount: row.WhatsAppAccount,
+			Channel:         models.Channel(row.Channel),
+			Direction:       row.Direction,
+			MessageType:     row.MessageType,
+			SentByUserID:    row.SentByUserID,
+			Snippet:         searchSnippet(row.Snippet),
+			CreatedAt:       row.CreatedAt,
+		}
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"results": results,
+		"total":   total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_SearchMessages(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	for _, m := range []struct {
+		content   string
+		direction models.Direction
+		createdAt time.Time
+	}{
+		{"Where is my order? It hasn't arrived", models.DirectionIncoming, time.Now().Add(-48 * time.Hour)},
+		{"Your order shipped <today>", models.DirectionOutgoing, time.Now()},
+		{"Thanks for the refund", models.DirectionIncoming, time.Now()},
+	} {
+		require.NoError(t, app.DB.Create(&models.Message{
+			BaseModel:       models.BaseModel{ID: uuid.New(), CreatedAt: m.createdAt},
+			OrganizationID:  org.ID,
+			WhatsAppAccount: account.Name,
+			ContactID:       contact.ID,
+			Direction:       m.direction,
+			MessageType:     models.MessageTypeText,
+			Content:         m.content,
+		}).Error)
+	}
+
+	search := func(params map[string]string) ([]handlers.MessageSearchResult, int) {
+		req := testutil.NewGETRequest(t)
+		setAuthContext(req, org.ID, user.ID)
+		for k, v := range params {
+			testutil.SetQueryParam(req, k, v)
+		}
+		require.NoError(t, app.SearchMessages(req))
+		require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+		var resp struct {
+			Results []handlers.MessageSearchResult `json:"results"`
+			Total   int                            `json:"total"`
+		}
+		testutil.ParseEnvelopeResponse(t, req, &resp)
+		return resp.Results, resp.Total
+	}
+
+	results, total := search(map[string]string{"q": "order", "sort": "recent"})
+	require.Equal(t, 2, total)
+	assert.Equal(t, "Your <mark>order</mark> shipped &lt;today&gt;", results[0].Snippet)
+	assert.Equal(t, contact.ID, results[0].ContactID)
+	assert.Equal(t, models.ChannelWhatsApp, results[0].Channel)
+
+	// Filters narrow the results
+	_, total = search(map[string]string{"q": "order", "from": time.Now().Format("2006-01-02")})
+	assert.Equal(t, 1, total)
+	_, total = search(map[string]string{"q": "order", "phone": contact.PhoneNumber})
+	assert.Equal(t, 2, total)
+	_, total = search(map[string]string{"q": "order", "phone": "19999999999"})
+	assert.Equal(t, 0, total)
+	_, total = search(map[string]string{"q": "order -shipped"})
+	assert.Equal(t, 1, total)
+	_, total = search(map[string]string{"q": "refund", "channel": "instagram"})
+	assert.Equal(t, 0, total)
+
+	req := testutil.NewGETRequest(t)
+	setAuthContext(req, org.ID, user.ID)
+	require.NoError(t, app.SearchMessages(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "q is required")
+}
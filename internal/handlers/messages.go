@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -9,10 +10,13 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/shridarpatil/whatomate/internal/tracing"
 	"github.com/shridarpatil/whatomate/internal/websocket"
 	"github.com/shridarpatil/whatomate/pkg/whatsapp"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ============================================================================
@@ -34,17 +38,28 @@ type OutgoingMessageRequest struct {
 	// Media messages (image, video, audio, document)
 	MediaID       string // WhatsApp media ID (if already uploaded)
 	MediaData     []byte // Raw media data (if upload needed)
+	MediaLink     string // Public URL WhatsApp downloads the media from (instead of uploading)
 	MediaURL      string // Local media URL (for storage)
 	MediaMimeType string
 	MediaFilename string
 	Caption       string
 
 	// Interactive messages
-	InteractiveType string            // "button", "list", "cta_url"
-	BodyText        string            // Body text for interactive messages
-	Buttons         []whatsapp.Button // For button/list messages
-	ButtonText      string            // For CTA URL button
-	URL             string            // For CTA URL button
+	InteractiveType string                       // "button", "list", "cta_url", "product", "product_list"
+	BodyText        string                       // Body text for interactive messages
+	Buttons         []whatsapp.Button            // For button/list messages
+	List            *whatsapp.ListMessage        // For list messages with sections; BodyText is its body
+	ButtonText      string                       // For CTA URL button
+	URL             string                       // For CTA URL button
+	Product         *models.CatalogProduct       // For product messages, with its Catalog loaded
+	ProductList     *whatsapp.ProductListMessage // For product list messages; BodyText is its body
+	Products        []models.CatalogProduct      // For product list messages, the products it shows
+
+	// Location messages
+	Location *whatsapp.Location
+
+	// Contacts messages
+	Contacts []whatsapp.ContactCard
 
 	// Template messages
 	Template   *models.Template
@@ -59,6 +74,9 @@ type OutgoingMessageRequest struct {
 
 	// Reply context
 	ReplyToMessage *models.Message
+
+	// Metadata is added to the message's metadata, e.g. the agent's text of a translated reply
+	Metadata models.JSONB
 }
 
 // MessageSendOptions configures optional behaviors for message sending
@@ -120,20 +138,70 @@ func SLASendOptions() MessageSendOptions {
 	}
 }
 
+// sendSlotMaxWait is how long a message waits for its number's send limits before it fails
+const sendSlotMaxWait = 10 * time.Second
+
+// waitForSendSlot holds a message until its number's throughput allows it. Templates
+// can open a business-initiated conversation, so they also count against the number's
+// messaging limit tier.
+func (a *App) waitForSendSlot(ctx context.Context, req OutgoingMessageRequest) error {
+	// Simulated messages aren't sent, so they don't use up the number's limits
+	if a.simulation != nil {
+		return nil
+	}
+	recipient := ""
+	if req.Type == models.MessageTypeTemplate {
+		recipient = req.Contact.PhoneNumber
+	}
+	return queue.NewSendLimiter(a.Redis).Wait(ctx, req.Account.PhoneID, recipient, queue.AccountSendLimits(req.Account), sendSlotMaxWait)
+}
+
 // SendOutgoingMessage is the unified method for sending all types of WhatsApp messages.
 // It handles: text, media (image/video/audio/document), interactive (buttons/list/cta_url), and template messages.
 func (a *App) SendOutgoingMessage(ctx context.Context, req OutgoingMessageRequest, opts MessageSendOptions) (*models.Message, error) {
+	// Organizations whose trial has ended can't send
+	if err := a.checkTrialActive(req.Account.OrganizationID); err != nil {
+		return nil, err
+	}
+
+	// Enforce the plan's monthly message limit
+	if err := a.checkSupportQuota(req.Account.OrganizationID, models.UsageMetricMessages, 1); err != nil {
+		return nil, err
+	}
+
+	// Message hooks can rewrite or enrich the message, or stop it being sent
+	if err := a.hookOutgoingMessage(ctx, &req); err != nil {
+		return nil, err
+	}
+
 	// 1. Create message record
 	msg := a.createOutgoingMessage(req, opts)
 
 	// Save to database
 	if err := a.DB.Create(msg).Error; err != nil {
-		a.Log.Error("Failed to create message", "error", err)
+		a.log(ctx).Error("Failed to create message", "error", err)
 		return nil, fmt.Errorf("failed to create message: %w", err)
 	}
 
 	// 2. Define the send function based on message type
-	sendFn := func(sendCtx context.Context) (string, error) {
+	sendFn := func(sendCtx context.Context) (wamid string, err error) {
+		sendCtx, span := tracing.Start(sendCtx, "whatsapp.send",
+			attribute.String("whatsapp.message_type", string(req.Type)),
+			attribute.String("whatsapp.phone_number_id", req.Account.PhoneID),
+		)
+		defer func() { tracing.End(span, err) }()
+
+		switch a.sendChannel(req.Account) {
+		case models.ChannelTelegram:
+			return a.sendTelegramMessage(sendCtx, req)
+		case models.ChannelInstagram, models.ChannelMessenger:
+			return a.sendMessengerMessage(sendCtx, req)
+		case models.ChannelWebChat:
+			return a.sendWebChatMessage(sendCtx, req)
+		}
+		if err := a.waitForSendSlot(sendCtx, req); err != nil {
+			return "", err
+		}
 		waAccount := a.toWhatsAppAccount(req.Account)
 
 		switch req.Type {
@@ -150,23 +218,37 @@ func (a *App) SendOutgoingMessage(ctx context.Context, req OutgoingMessageReques
 					return "", fmt.Errorf("failed to upload media: %w", err)
 				}
 			}
-			// Send the appropriate media type
-			switch req.Type {
-			case models.MessageTypeImage:
-				return a.WhatsApp.SendImageMessage(sendCtx, waAccount, req.Contact.PhoneNumber, mediaID, req.Caption)
-			case models.MessageTypeVideo:
-				return a.WhatsApp.SendVideoMessage(sendCtx, waAccount, req.Contact.PhoneNumber, mediaID, req.Caption)
-			case models.MessageTypeAudio:
-				return a.WhatsApp.SendAudioMessage(sendCtx, waAccount, req.Contact.PhoneNumber, mediaID)
-			default: // document
-				return a.WhatsApp.SendDocumentMessage(sendCtx, waAccount, req.Contact.PhoneNumber, mediaID, req.MediaFilename, req.Caption)
+			media := whatsapp.MediaMessage{
+				Type:     string(req.Type),
+				ID:       mediaID,
+				Caption:  req.Caption,
+				Filename: req.MediaFilename,
+			}
+			if mediaID == "" {
+				media.Link = req.MediaLink
 			}
+			return a.WhatsApp.SendMediaMessage(sendCtx, waAccount, req.Contact.PhoneNumber, media)
 
 		case models.MessageTypeInteractive:
 			switch req.InteractiveType {
 			case "cta_url":
 				return a.WhatsApp.SendCTAURLButton(sendCtx, waAccount, req.Contact.PhoneNumber, req.BodyText, req.ButtonText, req.URL)
-			default: // "button" or "list"
+			case "product":
+				if req.Product == nil || req.Product.Catalog == nil {
+					return "", fmt.Errorf("product is required for product messages")
+				}
+				return a.WhatsApp.SendProductMessage(sendCtx, waAccount, req.Contact.PhoneNumber, req.Product.Catalog.MetaCatalogID, req.Product.RetailerID, req.BodyText, "")
+			case "product_list":
+				if req.ProductList == nil {
+					return "", fmt.Errorf("product list is required for product list messages")
+				}
+				return a.WhatsApp.SendProductListMessage(sendCtx, waAccount, req.Contact.PhoneNumber, *req.ProductList)
+			case "list":
+				if req.List != nil {
+					return a.WhatsApp.SendListMessage(sendCtx, waAccount, req.Contact.PhoneNumber, *req.List)
+				}
+				return a.WhatsApp.SendInteractiveButtons(sendCtx, waAccount, req.Contact.PhoneNumber, req.BodyText, req.Buttons)
+			default: // "button"
 				return a.WhatsApp.SendInteractiveButtons(sendCtx, waAccount, req.Contact.PhoneNumber, req.BodyText, req.Buttons)
 			}
 
@@ -174,7 +256,20 @@ func (a *App) SendOutgoingMessage(ctx context.Context, req OutgoingMessageReques
 			if req.Template == nil {
 				return "", fmt.Errorf("template is required for template messages")
 			}
-			return a.WhatsApp.SendTemplateMessage(sendCtx, waAccount, req.Contact.PhoneNumber, req.Template.Name, req.Template.Language, req.BodyParams)
+			wamid, err := a.sendTemplateWithFailover(sendCtx, msg, req)
+			if err != nil && isUndeliverableError(err) && a.sendSMSFallback(sendCtx, msg, req.Contact, smsFallbackUndeliverable) {
+				return "", nil
+			}
+			return wamid, err
+
+		case models.MessageTypeLocation:
+			if req.Location == nil {
+				return "", fmt.Errorf("location is required for location messages")
+			}
+			return a.WhatsApp.SendLocationMessage(sendCtx, waAccount, req.Contact.PhoneNumber, *req.Location)
+
+		case models.MessageTypeContacts:
+			return a.WhatsApp.SendContactsMessage(sendCtx, waAccount, req.Contact.PhoneNumber, req.Contacts)
 
 		case models.MessageTypeFlow:
 			if req.FlowID == "" {
@@ -192,7 +287,7 @@ func (a *App) SendOutgoingMessage(ctx context.Context, req OutgoingMessageReques
 		a.wg.Add(1)
 		go func() {
 			defer a.wg.Done()
-			asyncCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			asyncCtx, cancel := context.WithTimeout(tracing.Detach(ctx), 30*time.Second)
 			defer cancel()
 
 			wamid, sendErr := sendFn(asyncCtx)
@@ -212,6 +307,13 @@ func (a *App) SendOutgoingMessage(ctx context.Context, req OutgoingMessageReques
 		a.UpdateContactChatbotMessage(req.Contact.ID)
 	}
 
+	// An agent reply releases a read receipt held back by presence privacy, and
+	// meets the first-response target of the contact's transfer
+	if opts.SentByUserID != nil {
+		a.releaseReadReceipt(req.Account, req.Contact.ID)
+		a.recordSLAFirstResponse(req.Account.OrganizationID, req.Contact.ID)
+	}
+
 	// Update contact's last message
 	preview := a.getMessagePreview(req)
 	a.updateContactLastMessage(req.Contact, preview)
@@ -223,14 +325,28 @@ func (a *App) SendOutgoingMessage(ctx context.Context, req OutgoingMessageReques
 // Internal Helpers
 // ============================================================================
 
-// toWhatsAppAccount converts models.WhatsAppAccount to whatsapp.Account
+// toWhatsAppAccount converts models.WhatsAppAccount to whatsapp.Account. Tokens that
+// reference a secret are resolved; if that fails, calls are made without the token
+// and fail at the API.
 func (a *App) toWhatsAppAccount(account *models.WhatsAppAccount) *whatsapp.Account {
+	token, err := a.resolveCredential(context.Background(), account.OrganizationID, account.AccessToken)
+	if err != nil {
+		a.Log.Error("Failed to resolve WhatsApp access token", "error", err, "account", account.Name)
+	}
+	apiToken, err := a.resolveCredential(context.Background(), account.OrganizationID, account.APIToken)
+	if err != nil {
+		a.Log.Error("Failed to resolve WhatsApp API token", "error", err, "account", account.Name)
+	}
 	return &whatsapp.Account{
-		PhoneID:     account.PhoneID,
-		BusinessID:  account.BusinessID,
-		AppID:       account.AppID,
-		APIVersion:  account.APIVersion,
-		AccessToken: account.AccessToken,
+		PhoneID:       account.PhoneID,
+		BusinessID:    account.BusinessID,
+		AppID:         account.AppID,
+		APIVersion:    account.APIVersion,
+		AccessToken:   token,
+		APIType:       account.APIType,
+		APIURL:        account.APIURL,
+		APIToken:      apiToken,
+		APIAuthHeader: account.APIAuthHeader,
 	}
 }
 
@@ -257,11 +373,23 @@ func (a *App) createOutgoingMessage(req OutgoingMessageRequest, opts MessageSend
 		msg.MediaURL = req.MediaURL
 		msg.MediaMimeType = req.MediaMimeType
 		msg.MediaFilename = req.MediaFilename
+		if req.MediaLink != "" {
+			msg.Metadata = models.JSONB{"media_link": req.MediaLink}
+		}
 
 	case models.MessageTypeInteractive:
 		msg.Content = req.BodyText
 		msg.InteractiveData = a.buildInteractiveData(req)
 
+	case models.MessageTypeLocation:
+		if req.Location != nil {
+			msg.Content = locationContent(*req.Location)
+			msg.Latitude, msg.Longitude = locationCoordinates(msg.Content)
+		}
+
+	case models.MessageTypeContacts:
+		msg.Content = contactCardsContent(req.Contacts, nil)
+
 	case models.MessageTypeTemplate:
 		if req.Template != nil {
 			// Store actual rendered content instead of just template name
@@ -285,6 +413,15 @@ func (a *App) createOutgoingMessage(req OutgoingMessageRequest, opts MessageSend
 		msg.ReplyToMessageID = &replyID
 	}
 
+	if len(req.Metadata) > 0 {
+		if msg.Metadata == nil {
+			msg.Metadata = models.JSONB{}
+		}
+		for k, v := range req.Metadata {
+			msg.Metadata[k] = v
+		}
+	}
+
 	return msg
 }
 
@@ -298,7 +435,28 @@ func (a *App) buildInteractiveData(req OutgoingMessageRequest) models.JSONB {
 			"button_text": req.ButtonText,
 			"url":         req.URL,
 		}
+	case "product":
+		data := models.JSONB{
+			"type": "product",
+			"body": req.BodyText,
+		}
+		if req.Product != nil {
+			data["product_retailer_id"] = req.Product.RetailerID
+			data["product_name"] = req.Product.Name
+			data["price"] = req.Product.Price
+			data["currency"] = req.Product.Currency
+			data["image_url"] = req.Product.ImageURL
+		}
+		return data
+	case "product_list":
+		if req.ProductList != nil {
+			return productListInteractiveData(req.ProductList, req.Products)
+		}
+		return models.JSONB{"type": "product_list", "body": req.BodyText}
 	case "list":
+		if req.List != nil {
+			return listInteractiveData(req.List)
+		}
 		rows := make([]interface{}, len(req.Buttons))
 		for i, btn := range req.Buttons {
 			rows[i] = map[string]string{"id": btn.ID, "title": btn.Title}
@@ -321,14 +479,28 @@ func (a *App) buildInteractiveData(req OutgoingMessageRequest) models.JSONB {
 	}
 }
 
+// whatsappErrorCode returns the Meta error code of a failed send, or 0 if it didn't
+// come from the API
+func whatsappErrorCode(err error) int {
+	var apiErr *whatsapp.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
 // finalizeMessageSend updates message status and triggers post-send actions
 func (a *App) finalizeMessageSend(msg *models.Message, req OutgoingMessageRequest, opts MessageSendOptions, wamid string, err error) {
 	if err != nil {
 		a.DB.Model(msg).Updates(map[string]any{
 			"status":        models.MessageStatusFailed,
 			"error_message": err.Error(),
+			"error_code":    whatsappErrorCode(err),
 		})
 		a.Log.Error("Failed to send message", "error", err, "message_id", msg.ID, "type", msg.MessageType)
+		if opts.DispatchWebhook {
+			a.dispatchMessageFailedWebhook(req.Account.OrganizationID, req.Contact, msg, whatsappErrorCode(err), err.Error())
+		}
 		return
 	}
 
@@ -337,6 +509,7 @@ func (a *App) finalizeMessageSend(msg *models.Message, req OutgoingMessageReques
 		"whats_app_message_id": wamid,
 	})
 	a.Log.Info("Message sent", "message_id", msg.ID, "wa_message_id", wamid, "type", msg.MessageType)
+	a.recordUsage(req.Account.OrganizationID, models.UsageMetricMessages, 1)
 
 	// Dispatch webhook for successful send
 	if opts.DispatchWebhook {
@@ -424,6 +597,28 @@ func (a *App) dispatchMessageSentWebhook(account *models.WhatsAppAccount, contac
 	})
 }
 
+// dispatchMessageFailedWebhook dispatches webhook for message.failed event
+func (a *App) dispatchMessageFailedWebhook(orgID uuid.UUID, contact *models.Contact, msg *models.Message, code int, reason string) {
+	var campaignID string
+	if msg.Metadata != nil {
+		campaignID, _ = msg.Metadata["campaign_id"].(string)
+	}
+
+	a.DispatchWebhook(orgID, models.WebhookEventMessageFailed, MessageFailedEventData{
+		MessageID:       msg.ID.String(),
+		ContactID:       contact.ID.String(),
+		ContactPhone:    contact.PhoneNumber,
+		ContactName:     contact.ProfileName,
+		MessageType:     msg.MessageType,
+		Content:         msg.Content,
+		TemplateName:    msg.TemplateName,
+		CampaignID:      campaignID,
+		ErrorCode:       code,
+		ErrorMessage:    reason,
+		WhatsAppAccount: msg.WhatsAppAccount,
+	})
+}
+
 // updateContactLastMessage updates contact's last_message_at and preview
 func (a *App) updateContactLastMessage(contact *models.Contact, preview string) {
 	a.DB.Model(contact).Updates(map[string]any{
@@ -454,7 +649,20 @@ func (a *App) getMessagePreview(req OutgoingMessageRequest) string {
 			return "[Document: " + req.MediaFilename + "]"
 		}
 		return "[Document]"
+	case models.MessageTypeLocation:
+		if req.Location != nil && req.Location.Name != "" {
+			return "[Location: " + req.Location.Name + "]"
+		}
+		return "[Location]"
+	case models.MessageTypeContacts:
+		if len(req.Contacts) == 1 {
+			return "[Contact: " + req.Contacts[0].Name.FormattedName + "]"
+		}
+		return "[Contacts]"
 	case models.MessageTypeInteractive:
+		if req.InteractiveType == "product" && req.BodyText == "" && req.Product != nil {
+			return "[Product: " + req.Product.Name + "]"
+		}
 		return truncateString(req.BodyText, 100)
 	case models.MessageTypeTemplate:
 		if req.Template != nil {
@@ -476,6 +684,7 @@ type SendTemplateMessageRequest struct {
 	PhoneNumber    string            `json:"phone_number"`    // Alternative to contact_id - send to phone directly
 	TemplateName   string            `json:"template_name"`   // Template name
 	TemplateID     string            `json:"template_id"`     // Alternative: template UUID
+	Language       string            `json:"language"`        // Optional: language of template_name, e.g. en_US
 	TemplateParams map[string]string `json:"template_params"` // Named or positional params
 	AccountName    string            `json:"account_name"`    // Optional: specific WhatsApp account
 }
@@ -514,9 +723,11 @@ func (a *App) SendTemplateMessage(r *fastglue.Request) error {
 			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Template not found", nil, "")
 		}
 	} else {
-		if err := a.DB.Where("name = ? AND organization_id = ?", req.TemplateName, orgID).First(&template).Error; err != nil {
+		t, err := a.findTemplateByName(orgID, req.TemplateName, req.Language, req.AccountName)
+		if err != nil {
 			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Template not found", nil, "")
 		}
+		template = *t
 	}
 
 	// Check template is approved
@@ -550,6 +761,7 @@ func (a *App) SendTemplateMessage(r *fastglue.Request) error {
 				BaseModel:      models.BaseModel{ID: uuid.New()},
 				OrganizationID: orgID,
 				PhoneNumber:    phoneNumber,
+				Timezone:       models.TimezoneForPhoneNumber(phoneNumber),
 			}
 			if err := a.DB.Create(&c).Error; err != nil {
 				a.Log.Error("Failed to create contact", "error", err, "phone", phoneNumber)
@@ -583,23 +795,11 @@ func (a *App) SendTemplateMessage(r *fastglue.Request) error {
 		}
 	}
 
-	// Extract parameter names and resolve values
-	paramNames := ExtractParamNamesFromContent(template.BodyContent)
-	bodyParams := ResolveParams(paramNames, req.TemplateParams)
-
 	// Validate that all required parameters are provided
-	if len(paramNames) > 0 {
-		var missingParams []string
-		for i, name := range paramNames {
-			if i >= len(bodyParams) || bodyParams[i] == "" {
-				missingParams = append(missingParams, name)
-			}
-		}
-		if len(missingParams) > 0 {
-			return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
-				fmt.Sprintf("Missing template parameters: %s. Expected parameters: %v", strings.Join(missingParams, ", "), paramNames),
-				nil, "")
-		}
+	if missingParams, paramNames := missingTemplateParams(&template, req.TemplateParams); len(missingParams) > 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+			fmt.Sprintf("Missing template parameters: %s. Expected parameters: %v", strings.Join(missingParams, ", "), paramNames),
+			nil, "")
 	}
 
 	// Send using unified message sender
@@ -608,7 +808,7 @@ func (a *App) SendTemplateMessage(r *fastglue.Request) error {
 		Contact:    contact,
 		Type:       models.MessageTypeTemplate,
 		Template:   &template,
-		BodyParams: req.TemplateParams,
+		BodyParams: a.personalizeTemplateParams(contact, req.TemplateParams),
 	}
 
 	opts := DefaultSendOptions()
@@ -617,6 +817,10 @@ func (a *App) SendTemplateMessage(r *fastglue.Request) error {
 	ctx := context.Background()
 	message, err := a.SendOutgoingMessage(ctx, msgReq, opts)
 	if err != nil {
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) {
+			return r.SendErrorEnvelope(fasthttp.StatusForbidden, quotaErr.Error(), nil, "")
+		}
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to send template message", nil, "")
 	}
 
@@ -628,6 +832,40 @@ func (a *App) SendTemplateMessage(r *fastglue.Request) error {
 	})
 }
 
+// findTemplateByName finds a template by name. A name can exist in several
+// languages and accounts, so language and accountName narrow it down when set,
+// and an approved version is preferred.
+func (a *App) findTemplateByName(orgID uuid.UUID, name, language, accountName string) (*models.Template, error) {
+	query := a.DB.Where("name = ? AND organization_id = ?", name, orgID)
+	if language != "" {
+		query = query.Where("language = ?", language)
+	}
+	if accountName != "" {
+		query = query.Where("whats_app_account = ?", accountName)
+	}
+
+	var template models.Template
+	if err := query.Order("status = 'APPROVED' DESC, updated_at DESC").First(&template).Error; err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// missingTemplateParams returns the body parameters of template that have no value in params,
+// along with all parameter names the template expects
+func missingTemplateParams(template *models.Template, params map[string]string) ([]string, []string) {
+	paramNames := ExtractParamNamesFromContent(template.BodyContent)
+	bodyParams := ResolveParams(paramNames, params)
+
+	var missingParams []string
+	for i, name := range paramNames {
+		if i >= len(bodyParams) || bodyParams[i] == "" {
+			missingParams = append(missingParams, name)
+		}
+	}
+	return missingParams, paramNames
+}
+
 // ExtractParamNamesFromContent extracts parameter names from template content
 // Supports both positional ({{1}}, {{2}}) and named ({{name}}, {{order_id}}) parameters
 var templateParamPattern = regexp.MustCompile(`\{\{([^}]+)\}\}`)
@@ -0,0 +1,568 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/messenger"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// Messenger accounts are Facebook Pages with the messenger channel. The account's
+// phone ID and business ID are both the Page ID and its access token is the Page
+// access token. Contacts are Messenger users: their phone number is "fb" and the
+// ID webhooks give them, which is specific to the Page.
+//
+// Messenger and Instagram accounts both go through Meta's Messenger Platform, so
+// they share the sending and webhook processing below.
+const messengerPrefix = "fb"
+
+// Limits of the Messenger Platform send API and persistent menu
+const (
+	maxMessengerQuickReplies = 13
+	maxMessengerButtons      = 3
+	maxPersistentMenuItems   = 20
+	maxPersistentMenuTitle   = 30
+)
+
+// MessengerAccountRequest is the request body for connecting a Facebook Page
+type MessengerAccountRequest struct {
+	Name               string `json:"name"`
+	PageID             string `json:"page_id"`
+	AccessToken        string `json:"access_token"` // Page access token
+	AppSecret          string `json:"app_secret"`
+	WebhookVerifyToken string `json:"webhook_verify_token"`
+	APIVersion         string `json:"api_version"`
+	IsDefaultIncoming  bool   `json:"is_default_incoming"`
+	IsDefaultOutgoing  bool   `json:"is_default_outgoing"`
+}
+
+// PersistentMenuRequest is the request body for setting an account's persistent menu
+type PersistentMenuRequest struct {
+	Items []messenger.MenuItem `json:"items"`
+}
+
+// messengerAttachmentTypes maps media message types to attachment types
+var messengerAttachmentTypes = map[models.MessageType]string{
+	models.MessageTypeImage:    messenger.AttachmentImage,
+	models.MessageTypeVideo:    messenger.AttachmentVideo,
+	models.MessageTypeAudio:    messenger.AttachmentAudio,
+	models.MessageTypeDocument: messenger.AttachmentFile,
+}
+
+// messengerMediaTypes maps attachment types to incoming message types and the MIME
+// type their media is saved with. Webhooks don't report MIME types.
+var messengerMediaTypes = map[string]struct{ messageType, mimeType string }{
+	messenger.AttachmentImage: {"image", "image/jpeg"},
+	messenger.AttachmentVideo: {"video", "video/mp4"},
+	messenger.AttachmentAudio: {"audio", "audio/mp4"},
+	messenger.AttachmentFile:  {"document", "application/octet-stream"},
+}
+
+// messengerClient returns the client for calls to the Messenger Platform
+func (a *App) messengerClient() *messenger.Client {
+	if a.Messenger != nil {
+		return a.Messenger
+	}
+	client := messenger.New(a.Log)
+	client.HTTPClient = a.httpClient(config.OutboundMeta, messenger.DefaultTimeout)
+	return client
+}
+
+// messengerChannelName returns the name users know a Messenger Platform channel by
+func messengerChannelName(channel models.Channel) string {
+	if channel == models.ChannelInstagram {
+		return "Instagram"
+	}
+	return "Messenger"
+}
+
+// messengerContactPrefix returns the prefix of the phone numbers of a Messenger
+// Platform channel's contacts
+func messengerContactPrefix(channel models.Channel) string {
+	if channel == models.ChannelInstagram {
+		return instagramPrefix
+	}
+	return messengerPrefix
+}
+
+// toMessengerAccount converts a Messenger or Instagram account for the Messenger
+// Platform client, resolving its access token if it references a secret
+func (a *App) toMessengerAccount(account *models.WhatsAppAccount) *messenger.Account {
+	token, err := a.resolveCredential(context.Background(), account.OrganizationID, account.AccessToken)
+	if err != nil {
+		a.Log.Error("Failed to resolve Messenger Platform access token", "error", err, "account", account.Name)
+	}
+	platform := messenger.PlatformMessenger
+	if account.IsInstagram() {
+		platform = messenger.PlatformInstagram
+	}
+	return &messenger.Account{
+		ID:          account.PhoneID,
+		PageID:      account.BusinessID,
+		Platform:    platform,
+		APIVersion:  account.APIVersion,
+		AccessToken: token,
+	}
+}
+
+// messengerUserID returns the user of a contact's phone number, if it has the prefix
+func messengerUserID(prefix, phoneNumber string) (string, bool) {
+	userID := strings.TrimPrefix(phoneNumber, prefix)
+	if userID == phoneNumber || userID == "" {
+		return "", false
+	}
+	return userID, true
+}
+
+// sendMessengerMessage sends an outgoing message to a Messenger or Instagram user
+// and returns its message ID. Reply buttons and lists become quick replies, URL
+// buttons a generic template. Media must have a public link Meta can fetch, and
+// templates, flows, catalogs, locations and contact cards can't be sent.
+func (a *App) sendMessengerMessage(ctx context.Context, req OutgoingMessageRequest) (string, error) {
+	channel := req.Account.AccountChannel()
+	name := messengerChannelName(channel)
+	userID, ok := messengerUserID(messengerContactPrefix(channel), req.Contact.PhoneNumber)
+	if !ok {
+		return "", fmt.Errorf("contact %s is not on %s", req.Contact.PhoneNumber, name)
+	}
+	client := a.messengerClient()
+	account := a.toMessengerAccount(req.Account)
+
+	switch req.Type {
+	case models.MessageTypeText:
+		return client.SendText(ctx, account, userID, req.Content)
+
+	case models.MessageTypeImage, models.MessageTypeVideo, models.MessageTypeAudio, models.MessageTypeDocument:
+		if req.MediaLink == "" {
+			return "", fmt.Errorf("media must be sent by link on %s", name)
+		}
+		mid, err := client.SendAttachment(ctx, account, userID, messengerAttachmentTypes[req.Type], req.MediaLink)
+		if err != nil {
+			return "", err
+		}
+		// Attachments have no caption, so it follows as a message of its own
+		if req.Caption != "" {
+			if _, err := client.SendText(ctx, account, userID, req.Caption); err != nil {
+				a.log(ctx).Error("Failed to send caption", "error", err, "channel", channel, "message_id", mid)
+			}
+		}
+		return mid, nil
+
+	case models.MessageTypeInteractive:
+		return a.sendMessengerInteractive(ctx, client, account, userID, name, req)
+
+	default:
+		return "", fmt.Errorf("%s messages are not supported on %s", req.Type, name)
+	}
+}
+
+// sendMessengerInteractive sends buttons and lists as quick replies, or as a generic
+// template when there are URL buttons
+func (a *App) sendMessengerInteractive(ctx context.Context, client *messenger.Client, account *messenger.Account, userID, name string, req OutgoingMessageRequest) (string, error) {
+	switch req.InteractiveType {
+	case "cta_url":
+		return client.SendButtons(ctx, account, userID, req.BodyText, []messenger.TemplateButton{
+			{Type: "web_url", Title: req.ButtonText, URL: req.URL},
+		})
+	case "product", "product_list":
+		return "", fmt.Errorf("%s messages are not supported on %s", req.InteractiveType, name)
+	}
+
+	var replies []messenger.QuickReply
+	if req.InteractiveType == "list" && req.List != nil {
+		for _, section := range req.List.Sections {
+			for _, row := range section.Rows {
+				replies = append(replies, messenger.QuickReply{Title: row.Title, Payload: row.ID})
+			}
+		}
+		if len(replies) > maxMessengerQuickReplies {
+			return "", fmt.Errorf("lists can have at most %d options on %s", maxMessengerQuickReplies, name)
+		}
+		return client.SendQuickReplies(ctx, account, userID, req.BodyText, replies)
+	}
+
+	hasURL := false
+	for _, button := range req.Buttons {
+		if button.Type == "url" {
+			hasURL = true
+		}
+		replies = append(replies, messenger.QuickReply{Title: button.Title, Payload: button.ID})
+	}
+	if len(replies) == 0 {
+		return client.SendText(ctx, account, userID, req.BodyText)
+	}
+	if !hasURL {
+		return client.SendQuickReplies(ctx, account, userID, req.BodyText, replies)
+	}
+
+	if len(req.Buttons) > maxMessengerButtons {
+		return "", fmt.Errorf("messages with URL buttons can have at most %d buttons on %s", maxMessengerButtons, name)
+	}
+	buttons := make([]messenger.TemplateButton, len(req.Buttons))
+	for i, button := range req.Buttons {
+		if button.Type == "url" {
+			buttons[i] = messenger.TemplateButton{Type: "web_url", Title: button.Title, URL: button.URL}
+		} else {
+			buttons[i] = messenger.TemplateButton{Type: "postback", Title: button.Title, Payload: button.ID}
+		}
+	}
+	return client.SendButtons(ctx, account, userID, req.BodyText, buttons)
+}
+
+// sendMessengerSenderAction sends a sender action to the user who sent a message,
+// in the background
+func (a *App) sendMessengerSenderAction(account *models.WhatsAppAccount, messageID, action string) {
+	userID, ok := messengerUserID(messengerContactPrefix(account.AccountChannel()), a.contactPhoneForMessage(messageID))
+	if !ok {
+		return
+	}
+	mAccount := a.toMessengerAccount(account)
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := a.messengerClient().SendSenderAction(ctx, mAccount, userID, action); err != nil {
+			a.Log.Error("Failed to send sender action", "error", err, "channel", account.Channel, "action", action, "message_id", messageID)
+		}
+	}()
+}
+
+// messengerIncomingMessage converts a messaging event into a message as the WhatsApp
+// webhook delivers it, so it goes through the same chatbot, flow and AI processing.
+// The sender's phone number is prefix and their ID. Messages the account sent
+// itself and reads aren't taken.
+func messengerIncomingMessage(prefix string, event messenger.MessagingEvent) (map[string]interface{}, bool) {
+	msg := map[string]interface{}{
+		"from":      prefix + event.Sender.ID,
+		"timestamp": strconv.FormatInt(event.Timestamp/1000, 10),
+	}
+
+	switch {
+	case event.Reaction != nil:
+		emoji := event.Reaction.Emoji
+		if event.Reaction.Action == "unreact" {
+			emoji = ""
+		}
+		msg["type"] = "reaction"
+		msg["reaction"] = map[string]string{"message_id": event.Reaction.MID, "emoji": emoji}
+		return msg, true
+
+	case event.Postback != nil:
+		msg["id"] = event.Postback.MID
+		msg["type"] = "interactive"
+		msg["interactive"] = map[string]interface{}{
+			"type":         "button_reply",
+			"button_reply": map[string]string{"id": event.Postback.Payload, "title": event.Postback.Title},
+		}
+		return msg, true
+
+	case event.Message == nil || event.Message.IsEcho:
+		return nil, false
+	}
+
+	m := event.Message
+	if m.IsDeleted {
+		msg["type"] = "revoke"
+		msg["revoke"] = map[string]string{"original_message_id": m.MID}
+		return msg, true
+	}
+
+	msg["id"] = m.MID
+	if m.ReplyTo != nil && m.ReplyTo.MID != "" {
+		msg["context"] = map[string]string{"id": m.ReplyTo.MID}
+	}
+
+	switch {
+	case m.QuickReply != nil:
+		msg["type"] = "interactive"
+		msg["interactive"] = map[string]interface{}{
+			"type":         "button_reply",
+			"button_reply": map[string]string{"id": m.QuickReply.Payload, "title": m.Text},
+		}
+	case m.Text != "":
+		msg["type"] = "text"
+		msg["text"] = map[string]string{"body": m.Text}
+	case len(m.Attachments) > 0:
+		attachment := m.Attachments[0]
+		if coords := attachment.Payload.Coordinates; coords != nil {
+			msg["type"] = "location"
+			msg["location"] = map[string]float64{"latitude": coords.Lat, "longitude": coords.Long}
+			return msg, true
+		}
+		media, ok := messengerMediaTypes[attachment.Type]
+		if !ok {
+			// Shared posts, reels and story mentions are kept as their link
+			if attachment.Payload.URL == "" {
+				return nil, false
+			}
+			msg["type"] = "text"
+			msg["text"] = map[string]string{"body": attachment.Payload.URL}
+			return msg, true
+		}
+		msg["type"] = media.messageType
+		msg[media.messageType] = map[string]string{"id": attachment.Payload.URL, "mime_type": media.mimeType}
+	default:
+		return nil, false
+	}
+	return msg, true
+}
+
+// processMessengerEvent processes a messaging event of the Messenger or Instagram
+// account with the ID
+func (a *App) processMessengerEvent(ctx context.Context, channel models.Channel, accountID string, event messenger.MessagingEvent) error {
+	prefix := messengerContactPrefix(channel)
+	msg, ok := messengerIncomingMessage(prefix, event)
+	if !ok {
+		return nil
+	}
+
+	account, err := a.getWhatsAppAccountCached(accountID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to find Messenger Platform account: %w", err)
+	}
+	if err != nil || account.AccountChannel() != channel {
+		a.log(ctx).Warn("Messenger Platform account not found", "channel", channel, "account_id", accountID)
+		return nil
+	}
+
+	a.log(ctx).Info("Received Messenger Platform message", "channel", channel, "type", msg["type"], "account_id", accountID)
+	return a.processIncomingMessage(ctx, account.PhoneID, msg, a.messengerProfileName(ctx, account, prefix, event.Sender.ID))
+}
+
+// messengerProfileName returns the name of a Messenger or Instagram user. Webhooks
+// don't carry it, so it's fetched for users who aren't contacts with a name yet.
+func (a *App) messengerProfileName(ctx context.Context, account *models.WhatsAppAccount, prefix, userID string) string {
+	var contact models.Contact
+	if err := a.DB.Select("profile_name").
+		Where("organization_id = ? AND phone_number = ?", account.OrganizationID, prefix+userID).
+		First(&contact).Error; err == nil && contact.ProfileName != "" {
+		return contact.ProfileName
+	}
+
+	profile, err := a.messengerClient().GetProfile(ctx, a.toMessengerAccount(account), userID)
+	if err != nil {
+		a.log(ctx).Warn("Failed to fetch user profile", "error", err, "channel", account.Channel, "account", account.Name)
+		return ""
+	}
+	return profile.DisplayName()
+}
+
+// connectMessengerAccount checks a new Messenger or Instagram account's token,
+// subscribes the app to its Page's messaging webhooks and saves it
+func (a *App) connectMessengerAccount(r *fastglue.Request, account *models.WhatsAppAccount) error {
+	name := messengerChannelName(account.AccountChannel())
+
+	var count int64
+	a.DB.Model(&models.WhatsAppAccount{}).Where("phone_id = ?", account.PhoneID).Count(&count)
+	if count > 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusConflict, "This "+name+" account is already connected", nil, "")
+	}
+
+	if account.WebhookVerifyToken == "" {
+		account.WebhookVerifyToken = generateVerifyToken()
+	}
+	if account.APIVersion == "" {
+		account.APIVersion = defaultAccountAPIVersion
+	}
+	account.Status = "active"
+
+	// Check the token can reach the account, then have Meta send its messages
+	client := a.messengerClient()
+	mAccount := a.toMessengerAccount(account)
+	if _, err := client.GetProfile(r.RequestCtx, mAccount, mAccount.ID); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to reach "+name+" account: "+err.Error(), nil, "")
+	}
+	if err := client.SubscribePage(r.RequestCtx, mAccount); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to subscribe to "+name+" messages: "+err.Error(), nil, "")
+	}
+
+	if account.IsDefaultIncoming {
+		a.DB.Model(&models.WhatsAppAccount{}).
+			Where("organization_id = ? AND is_default_incoming = ?", account.OrganizationID, true).
+			Update("is_default_incoming", false)
+	}
+	if account.IsDefaultOutgoing {
+		a.DB.Model(&models.WhatsAppAccount{}).
+			Where("organization_id = ? AND is_default_outgoing = ?", account.OrganizationID, true).
+			Update("is_default_outgoing", false)
+	}
+
+	if err := a.DB.Create(account).Error; err != nil {
+		a.Log.Error("Failed to create account", "error", err, "channel", account.Channel)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create account", nil, "")
+	}
+
+	return r.SendEnvelope(accountToResponse(*account))
+}
+
+// CreateMessengerAccount connects a Facebook Page to answer its Messenger
+// conversations and subscribes the app to the Page's messaging webhooks
+func (a *App) CreateMessengerAccount(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	if a.accountLimitReached(orgID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureMultipleAccounts), nil, "")
+	}
+
+	var req MessengerAccountRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.PageID == "" || req.AccessToken == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Name, page_id, and access_token are required", nil, "")
+	}
+	if err := a.checkCredential(r.RequestCtx, orgID, req.AccessToken); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "access_token: "+err.Error(), nil, "")
+	}
+	if err := a.checkCredential(r.RequestCtx, orgID, req.AppSecret); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "app_secret: "+err.Error(), nil, "")
+	}
+
+	return a.connectMessengerAccount(r, &models.WhatsAppAccount{
+		OrganizationID:     orgID,
+		Name:               req.Name,
+		Channel:            string(models.ChannelMessenger),
+		PhoneID:            req.PageID,
+		BusinessID:         req.PageID,
+		AccessToken:        req.AccessToken,
+		AppSecret:          req.AppSecret,
+		WebhookVerifyToken: req.WebhookVerifyToken,
+		APIVersion:         req.APIVersion,
+		IsDefaultIncoming:  req.IsDefaultIncoming,
+		IsDefaultOutgoing:  req.IsDefaultOutgoing,
+	})
+}
+
+// messengerAccountFromRequest loads the Messenger or Instagram account of the {id}
+// path parameter. Errors are sent as the response, so a nil account ends the request.
+func (a *App) messengerAccountFromRequest(r *fastglue.Request) (*models.WhatsAppAccount, error) {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return nil, r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	idStr := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid account ID", nil, "")
+	}
+
+	var account models.WhatsAppAccount
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&account).Error; err != nil {
+		return nil, r.SendErrorEnvelope(fasthttp.StatusNotFound, "Account not found", nil, "")
+	}
+	if !account.IsMessenger() && !account.IsInstagram() {
+		return nil, r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Persistent menus are only available for Messenger and Instagram accounts", nil, "")
+	}
+	return &account, nil
+}
+
+// GetPersistentMenu returns the persistent menu of a Messenger or Instagram account
+func (a *App) GetPersistentMenu(r *fastglue.Request) error {
+	account, err := a.messengerAccountFromRequest(r)
+	if account == nil {
+		return err
+	}
+
+	items, err := a.messengerClient().GetPersistentMenu(r.RequestCtx, a.toMessengerAccount(account))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to get persistent menu: "+err.Error(), nil, "")
+	}
+	if items == nil {
+		items = []messenger.MenuItem{}
+	}
+	return r.SendEnvelope(map[string]interface{}{"items": items})
+}
+
+// UpdatePersistentMenu replaces the persistent menu of a Messenger or Instagram
+// account. Postback items reach the chatbot like button replies. An empty menu
+// removes it.
+func (a *App) UpdatePersistentMenu(r *fastglue.Request) error {
+	account, err := a.messengerAccountFromRequest(r)
+	if account == nil {
+		return err
+	}
+
+	var req PersistentMenuRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if err := validatePersistentMenu(req.Items); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	client := a.messengerClient()
+	mAccount := a.toMessengerAccount(account)
+	if len(req.Items) == 0 {
+		err = client.DeletePersistentMenu(r.RequestCtx, mAccount)
+	} else {
+		err = client.SetPersistentMenu(r.RequestCtx, mAccount, req.Items)
+	}
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to update persistent menu: "+err.Error(), nil, "")
+	}
+
+	if req.Items == nil {
+		req.Items = []messenger.MenuItem{}
+	}
+	return r.SendEnvelope(map[string]interface{}{"items": req.Items})
+}
+
+// validatePersistentMenu checks the items of a persistent menu against Meta's limits
+func validatePersistentMenu(items []messenger.MenuItem) error {
+	if len(items) > maxPersistentMenuItems {
+		return fmt.Errorf("persistent menus can have at most %d items", maxPersistentMenuItems)
+	}
+	for i, item := range items {
+		if item.Title == "" || len([]rune(item.Title)) > maxPersistentMenuTitle {
+			return fmt.Errorf("item %d: title must be 1 to %d characters", i+1, maxPersistentMenuTitle)
+		}
+		switch item.Type {
+		case "postback":
+			if item.Payload == "" {
+				return fmt.Errorf("item %d: postback items need a payload", i+1)
+			}
+		case "web_url":
+			if !strings.HasPrefix(item.URL, "https://") && !strings.HasPrefix(item.URL, "http://") {
+				return fmt.Errorf("item %d: web_url items need an http or https URL", i+1)
+			}
+		default:
+			return fmt.Errorf("item %d: type must be postback or web_url", i+1)
+		}
+	}
+	return nil
+}
+
+// testMessengerConnection checks a Messenger or Instagram account's token by
+// fetching the account
+func (a *App) testMessengerConnection(r *fastglue.Request, account *models.WhatsAppAccount) error {
+	mAccount := a.toMessengerAccount(account)
+	profile, err := a.messengerClient().GetProfile(r.RequestCtx, mAccount, mAccount.ID)
+	if err != nil {
+		return r.SendEnvelope(map[string]interface{}{
+			"success": false,
+			"error":   "Failed to connect to " + messengerChannelName(account.AccountChannel()) + ": " + err.Error(),
+		})
+	}
+	return r.SendEnvelope(map[string]interface{}{
+		"success":  true,
+		"username": profile.Username,
+		"name":     profile.Name,
+	})
+}
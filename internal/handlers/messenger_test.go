@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/messenger"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// messagingEvent parses a messaging event as a webhook delivers it
+func messagingEvent(t *testing.T, data string) messenger.MessagingEvent {
+	t.Helper()
+	var event messenger.MessagingEvent
+	require.NoError(t, json.Unmarshal([]byte(data), &event))
+	return event
+}
+
+func TestMessengerIncomingMessage(t *testing.T) {
+	event := messagingEvent(t, `{
+		"sender": {"id": "5551"}, "recipient": {"id": "1784"}, "timestamp": 1700000000123,
+		"message": {"mid": "mid.1", "text": "Hi", "reply_to": {"mid": "mid.0"}}
+	}`)
+	msg, ok := messengerIncomingMessage(instagramPrefix, event)
+	require.True(t, ok)
+	incoming := decodeIncoming(t, msg)
+	assert.Equal(t, "ig5551", incoming.From)
+	assert.Equal(t, "mid.1", incoming.ID)
+	assert.Equal(t, "1700000000", incoming.Timestamp)
+	assert.Equal(t, "text", incoming.Type)
+	assert.Equal(t, "Hi", incoming.Text.Body)
+	assert.Equal(t, "mid.0", incoming.Context.ID)
+
+	event = messagingEvent(t, `{
+		"sender": {"id": "5551"}, "recipient": {"id": "1784"}, "timestamp": 1700000000123,
+		"message": {"mid": "mid.2", "text": "Sales", "quick_reply": {"payload": "sales"}}
+	}`)
+	msg, ok = messengerIncomingMessage(instagramPrefix, event)
+	require.True(t, ok)
+	incoming = decodeIncoming(t, msg)
+	assert.Equal(t, "interactive", incoming.Type)
+	assert.Equal(t, "sales", incoming.Interactive.ButtonReply.ID)
+	assert.Equal(t, "Sales", incoming.Interactive.ButtonReply.Title)
+
+	event = messagingEvent(t, `{
+		"sender": {"id": "5551"}, "recipient": {"id": "1784"}, "timestamp": 1700000000123,
+		"message": {"mid": "mid.3", "attachments": [{"type": "image", "payload": {"url": "https://cdn.example.com/a.jpg"}}]}
+	}`)
+	msg, ok = messengerIncomingMessage(instagramPrefix, event)
+	require.True(t, ok)
+	incoming = decodeIncoming(t, msg)
+	assert.Equal(t, "image", incoming.Type)
+	assert.Equal(t, "https://cdn.example.com/a.jpg", incoming.Image.ID)
+	assert.Equal(t, "image/jpeg", incoming.Image.MimeType)
+}
+
+func TestMessengerIncomingMessage_Events(t *testing.T) {
+	msg, ok := messengerIncomingMessage(instagramPrefix, messagingEvent(t, `{
+		"sender": {"id": "5551"}, "timestamp": 1700000000123,
+		"postback": {"mid": "mid.4", "title": "Support", "payload": "support"}
+	}`))
+	require.True(t, ok)
+	incoming := decodeIncoming(t, msg)
+	assert.Equal(t, "interactive", incoming.Type)
+	assert.Equal(t, "support", incoming.Interactive.ButtonReply.ID)
+
+	msg, ok = messengerIncomingMessage(instagramPrefix, messagingEvent(t, `{
+		"sender": {"id": "5551"}, "timestamp": 1700000000123,
+		"reaction": {"mid": "mid.1", "action": "unreact", "emoji": "❤"}
+	}`))
+	require.True(t, ok)
+	incoming = decodeIncoming(t, msg)
+	assert.Equal(t, "reaction", incoming.Type)
+	assert.Equal(t, "mid.1", incoming.Reaction.MessageID)
+	assert.Empty(t, incoming.Reaction.Emoji)
+
+	msg, ok = messengerIncomingMessage(instagramPrefix, messagingEvent(t, `{
+		"sender": {"id": "5551"}, "timestamp": 1700000000123,
+		"message": {"mid": "mid.1", "is_deleted": true}
+	}`))
+	require.True(t, ok)
+	incoming = decodeIncoming(t, msg)
+	assert.Equal(t, "revoke", incoming.Type)
+	assert.Equal(t, "mid.1", incoming.Revoke.OriginalMessageID)
+
+	// Messages the account sent come back as echoes
+	_, ok = messengerIncomingMessage(instagramPrefix, messagingEvent(t, `{
+		"sender": {"id": "1784"}, "timestamp": 1700000000123,
+		"message": {"mid": "mid.5", "text": "Hello", "is_echo": true}
+	}`))
+	assert.False(t, ok)
+}
+
+func TestSendMessengerMessage(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		_, _ = w.Write([]byte(`{"recipient_id":"5551","message_id":"mid.sent"}`))
+	}))
+	defer server.Close()
+
+	app := &App{Log: testutil.NopLogger(), Messenger: messenger.NewWithBaseURL(testutil.NopLogger(), server.URL)}
+	account := &models.WhatsAppAccount{Channel: string(models.ChannelInstagram), PhoneID: "1784", APIVersion: "v21.0", AccessToken: "token"}
+	contact := &models.Contact{PhoneNumber: "ig5551"}
+
+	mid, err := app.sendMessengerMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: contact, Type: models.MessageTypeInteractive, BodyText: "Pick one",
+		Buttons: []whatsapp.Button{{ID: "yes", Title: "Yes"}, {ID: "no", Title: "No"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "mid.sent", mid)
+	require.Len(t, bodies, 1)
+	message := bodies[0]["message"].(map[string]interface{})
+	assert.Equal(t, "Pick one", message["text"])
+	assert.Len(t, message["quick_replies"], 2)
+
+	// URL buttons need a generic template
+	bodies = nil
+	_, err = app.sendMessengerMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: contact, Type: models.MessageTypeInteractive, BodyText: "Visit us",
+		Buttons: []whatsapp.Button{{ID: "more", Title: "More"}, {Title: "Site", Type: "url", URL: "https://example.com"}},
+	})
+	require.NoError(t, err)
+	attachment := bodies[0]["message"].(map[string]interface{})["attachment"].(map[string]interface{})
+	assert.Equal(t, "template", attachment["type"])
+
+	_, err = app.sendMessengerMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: contact, Type: models.MessageTypeImage, MediaData: []byte("jpeg"),
+	})
+	assert.ErrorContains(t, err, "by link")
+
+	_, err = app.sendMessengerMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: contact, Type: models.MessageTypeTemplate,
+	})
+	assert.ErrorContains(t, err, "not supported on Instagram")
+
+	_, err = app.sendMessengerMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: &models.Contact{PhoneNumber: "tg42"}, Type: models.MessageTypeText, Content: "Hi",
+	})
+	assert.ErrorContains(t, err, "not on Instagram")
+}
+
+func TestMessengerIncomingMessage_Messenger(t *testing.T) {
+	msg, ok := messengerIncomingMessage(messengerPrefix, messagingEvent(t, `{
+		"sender": {"id": "2468"}, "recipient": {"id": "1000"}, "timestamp": 1700000000123,
+		"message": {"mid": "m_1", "text": "Hello"}
+	}`))
+	require.True(t, ok)
+	incoming := decodeIncoming(t, msg)
+	assert.Equal(t, "fb2468", incoming.From)
+	assert.Equal(t, "Hello", incoming.Text.Body)
+
+	// Persistent menu items arrive as postbacks
+	msg, ok = messengerIncomingMessage(messengerPrefix, messagingEvent(t, `{
+		"sender": {"id": "2468"}, "timestamp": 1700000000123,
+		"postback": {"mid": "m_2", "title": "Talk to us", "payload": "talk"}
+	}`))
+	require.True(t, ok)
+	incoming = decodeIncoming(t, msg)
+	assert.Equal(t, "interactive", incoming.Type)
+	assert.Equal(t, "talk", incoming.Interactive.ButtonReply.ID)
+	assert.Equal(t, "Talk to us", incoming.Interactive.ButtonReply.Title)
+
+	msg, ok = messengerIncomingMessage(messengerPrefix, messagingEvent(t, `{
+		"sender": {"id": "2468"}, "timestamp": 1700000000123,
+		"message": {"mid": "m_3", "attachments": [{"type": "location", "payload": {"coordinates": {"lat": 52.52, "long": 13.4}}}]}
+	}`))
+	require.True(t, ok)
+	incoming = decodeIncoming(t, msg)
+	assert.Equal(t, "location", incoming.Type)
+	assert.Equal(t, 52.52, incoming.Location.Latitude)
+	assert.Equal(t, 13.4, incoming.Location.Longitude)
+}
+
+func TestSendMessengerMessage_Messenger(t *testing.T) {
+	var paths []string
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, body)
+		_, _ = w.Write([]byte(`{"recipient_id":"2468","message_id":"m_sent"}`))
+	}))
+	defer server.Close()
+
+	app := &App{Log: testutil.NopLogger(), Messenger: messenger.NewWithBaseURL(testutil.NopLogger(), server.URL)}
+	account := &models.WhatsAppAccount{Channel: string(models.ChannelMessenger), PhoneID: "1000", BusinessID: "1000", APIVersion: "v21.0", AccessToken: "token"}
+
+	mid, err := app.sendMessengerMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: &models.Contact{PhoneNumber: "fb2468"}, Type: models.MessageTypeText, Content: "Hi",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "m_sent", mid)
+	assert.Equal(t, []string{"/v21.0/1000/messages"}, paths)
+	assert.Equal(t, "2468", bodies[0]["recipient"].(map[string]interface{})["id"])
+	assert.Equal(t, "RESPONSE", bodies[0]["messaging_type"])
+
+	// Instagram users can't be reached from a Page's Messenger
+	_, err = app.sendMessengerMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: &models.Contact{PhoneNumber: "ig5551"}, Type: models.MessageTypeText, Content: "Hi",
+	})
+	assert.ErrorContains(t, err, "not on Messenger")
+}
+
+func TestValidatePersistentMenu(t *testing.T) {
+	assert.NoError(t, validatePersistentMenu(nil))
+	assert.NoError(t, validatePersistentMenu([]messenger.MenuItem{
+		{Type: "postback", Title: "Talk to us", Payload: "talk"},
+		{Type: "web_url", Title: "Shop", URL: "https://example.com"},
+	}))
+
+	assert.ErrorContains(t, validatePersistentMenu([]messenger.MenuItem{{Type: "postback", Title: "Talk to us"}}), "payload")
+	assert.ErrorContains(t, validatePersistentMenu([]messenger.MenuItem{{Type: "web_url", Title: "Shop", URL: "example.com"}}), "URL")
+	assert.ErrorContains(t, validatePersistentMenu([]messenger.MenuItem{{Type: "nested", Title: "More"}}), "type")
+	assert.ErrorContains(t, validatePersistentMenu([]messenger.MenuItem{{Type: "postback", Title: strings.Repeat("a", 31), Payload: "a"}}), "title")
+
+	items := make([]messenger.MenuItem, maxPersistentMenuItems+1)
+	for i := range items {
+		items[i] = messenger.MenuItem{Type: "postback", Title: "Item", Payload: "item"}
+	}
+	assert.ErrorContains(t, validatePersistentMenu(items), "at most")
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// notificationEvents are the events organizations can be notified of
+var notificationEvents = []map[string]string{
+	{"value": string(models.NotificationEventHandoffRequested), "label": "Handoff Requested", "description": "When the chatbot hands a conversation over to human agents"},
+	{"value": string(models.NotificationEventSLABreached), "label": "SLA Breached", "description": "When a transfer misses the first response or resolution target of its SLA policy"},
+	{"value": string(models.NotificationEventCampaignFinished), "label": "Campaign Finished", "description": "When a campaign has been sent to all its recipients"},
+	{"value": string(models.NotificationEventAIProviderDown), "label": "AI Provider Down", "description": "When an AI provider keeps failing and is skipped for a while"},
+}
+
+// NotificationChannels are the channels an event is sent to
+type NotificationChannels struct {
+	Slack bool `json:"slack"`
+	Email bool `json:"email"`
+}
+
+// NotificationSettings route key events to a Slack incoming webhook and email
+type NotificationSettings struct {
+	SlackWebhookURL string                                            `json:"-"`
+	EmailRecipients []string                                          `json:"email_recipients"` // The organization's admins when empty
+	Events          map[models.NotificationEvent]NotificationChannels `json:"events"`
+}
+
+// NotificationSettingsRequest updates notification settings. Omitted fields, and
+// omitted events, keep their current value.
+type NotificationSettingsRequest struct {
+	SlackWebhookURL *string                                           `json:"slack_webhook_url"`
+	EmailRecipients *[]string                                         `json:"email_recipients"`
+	Events          map[models.NotificationEvent]NotificationChannels `json:"events"`
+}
+
+// isNotificationEvent reports whether event is one organizations can be notified of
+func isNotificationEvent(event models.NotificationEvent) bool {
+	for _, e := range notificationEvents {
+		if e["value"] == string(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// notificationSettings reads the notification settings from organization settings
+func notificationSettings(settings models.JSONB) NotificationSettings {
+	ns := NotificationSettings{Events: map[models.NotificationEvent]NotificationChannels{}}
+	raw, ok := settings["notifications"].(map[string]interface{})
+	if !ok {
+		return ns
+	}
+	ns.SlackWebhookURL = models.SettingSecret(raw, "slack_webhook_url")
+	if recipients, ok := raw["email_recipients"].([]interface{}); ok {
+		for _, r := range recipients {
+			if email, ok := r.(string); ok {
+				ns.EmailRecipients = append(ns.EmailRecipients, email)
+			}
+		}
+	}
+	if events, ok := raw["events"].(map[string]interface{}); ok {
+		for event, v := range events {
+			channels, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var c NotificationChannels
+			c.Slack, _ = channels["slack"].(bool)
+			c.Email, _ = channels["email"].(bool)
+			ns.Events[models.NotificationEvent(event)] = c
+		}
+	}
+	return ns
+}
+
+// loadNotificationSettings loads an organization's notification settings
+func (a *App) loadNotificationSettings(orgID uuid.UUID) (NotificationSettings, error) {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return NotificationSettings{}, err
+	}
+	return notificationSettings(org.Settings), nil
+}
+
+// notificationSettingsResponse is the settings as returned by the API. The Slack
+// webhook URL holds its credentials, so only whether it's set is returned.
+func (a *App) notificationSettingsResponse(ns NotificationSettings) map[string]interface{} {
+	events := make(map[models.NotificationEvent]NotificationChannels, len(notificationEvents))
+	for _, e := range notificationEvents {
+		event := models.NotificationEvent(e["value"])
+		events[event] = ns.Events[event]
+	}
+	recipients := ns.EmailRecipients
+	if recipients == nil {
+		recipients = []string{}
+	}
+	return map[string]interface{}{
+		"slack_webhook_url_set": ns.SlackWebhookURL != "",
+		"email_recipients":      recipients,
+		"email_available":       a.emailEnabled(),
+		"events":                events,
+		"available_events":      notificationEvents,
+	}
+}
+
+// GetNotificationSettings returns the organization's notification settings
+func (a *App) GetNotificationSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	ns, err := a.loadNotificationSettings(orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	return r.SendEnvelope(a.notificationSettingsResponse(ns))
+}
+
+// UpdateNotificationSettings updates the organization's notification settings
+func (a *App) UpdateNotificationSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req NotificationSettingsRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	before := orgSettingsAuditSnapshot(&org)
+	ns := notificationSettings(org.Settings)
+
+	if req.SlackWebhookURL != nil {
+		webhookURL := strings.TrimSpace(*req.SlackWebhookURL)
+		if webhookURL != "" {
+			u, err := url.Parse(webhookURL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid Slack webhook URL", nil, "")
+			}
+		}
+		ns.SlackWebhookURL = webhookURL
+	}
+	if req.EmailRecipients != nil {
+		recipients := []string{}
+		for _, email := range *req.EmailRecipients {
+			email = strings.TrimSpace(email)
+			if email == "" {
+				continue
+			}
+			if _, err := mail.ParseAddress(email); err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Invalid email recipient: %s", email), nil, "")
+			}
+			recipients = append(recipients, email)
+		}
+		ns.EmailRecipients = recipients
+	}
+	for event, channels := range req.Events {
+		if !isNotificationEvent(event) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Unknown notification event: %s", event), nil, "")
+		}
+		ns.Events[event] = channels
+	}
+
+	for event, channels := range ns.Events {
+		if channels.Slack && ns.SlackWebhookURL == "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("A Slack webhook URL is required to send %s to Slack", event), nil, "")
+		}
+		if channels.Email && !a.emailEnabled() {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Email is not configured on this server", nil, "")
+		}
+	}
+
+	events := map[string]interface{}{}
+	for event, channels := range ns.Events {
+		events[string(event)] = map[string]interface{}{"slack": channels.Slack, "email": channels.Email}
+	}
+	recipients := make([]interface{}, 0, len(ns.EmailRecipients))
+	for _, email := range ns.EmailRecipients {
+		recipients = append(recipients, email)
+	}
+
+	if org.Settings == nil {
+		org.Settings = models.JSONB{}
+	}
+	section := map[string]interface{}{
+		"slack_webhook_url": ns.SlackWebhookURL,
+		"email_recipients":  recipients,
+		"events":            events,
+	}
+	if err := models.EncryptSettingSecrets("notifications", section); err != nil {
+		a.Log.Error("Failed to encrypt the Slack webhook URL", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	org.Settings["notifications"] = section
+	if err := a.DB.Save(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	a.recordOrgSettingsAudit(r, &org, before)
+
+	return r.SendEnvelope(a.notificationSettingsResponse(ns))
+}
+
+// TestNotificationSettings sends a test notification to every configured channel,
+// whichever events are turned on
+func (a *App) TestNotificationSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	ns, err := a.loadNotificationSettings(orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	channels := NotificationChannels{Slack: ns.SlackWebhookURL != "", Email: a.emailEnabled()}
+	if !channels.Slack && !channels.Email {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "No notification channel is configured", nil, "")
+	}
+
+	ctx, cancel := context.WithTimeout(r.RequestCtx, 30*time.Second)
+	defer cancel()
+	if err := a.sendNotification(ctx, orgID, ns, channels, "Test notification",
+		"Notifications from Whatomate are set up correctly."); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, fmt.Sprintf("Failed to send test notification: %v", err), nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"slack": channels.Slack,
+		"email": channels.Email,
+	})
+}
+
+// notify sends an event's notification, in the background, to the channels the
+// organization turned on for the event
+func (a *App) notify(orgID uuid.UUID, event models.NotificationEvent, subject, body string) {
+	// Simulated conversations don't notify anyone
+	if a.simulation != nil || orgID == uuid.Nil {
+		return
+	}
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ns, err := a.loadNotificationSettings(orgID)
+		if err != nil {
+			a.Log.Error("Failed to load notification settings", "error", err, "org_id", orgID)
+			return
+		}
+		channels := ns.Events[event]
+		if !channels.Slack && !channels.Email {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := a.sendNotification(ctx, orgID, ns, channels, subject, body); err != nil {
+			a.Log.Error("Failed to send notification", "error", err, "org_id", orgID, "event", event)
+		}
+	}()
+}
+
+// sendNotification posts a notification to Slack and emails it, on the given channels
+func (a *App) sendNotification(ctx context.Context, orgID uuid.UUID, ns NotificationSettings, channels NotificationChannels, subject, body string) error {
+	var errs []error
+	if channels.Slack && ns.SlackWebhookURL != "" {
+		payload, err := json.Marshal(map[string]string{
+			"text": fmt.Sprintf("*%s*\n%s", subject, body),
+		})
+		if err == nil {
+			_, err = a.sendWebhookRequest(ctx, models.Webhook{URL: ns.SlackWebhookURL}, "notification", uuid.Nil, payload)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("slack: %w", err))
+		}
+	}
+	if channels.Email && a.emailEnabled() {
+		recipients := ns.EmailRecipients
+		if len(recipients) == 0 {
+			recipients = a.orgAdminEmails(orgID)
+		}
+		if err := a.sendEmail(recipients, subject, body); err != nil {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notifyHandoffRequested notifies the organization of a conversation the chatbot
+// handed over to human agents
+func (a *App) notifyHandoffRequested(transfer *models.AgentTransfer, contact *models.Contact) {
+	name := contact.ProfileName
+	if name == "" {
+		name = transfer.PhoneNumber
+	}
+	body := fmt.Sprintf("%s (%s) on %s is waiting for an agent.", name, transfer.PhoneNumber, transfer.WhatsAppAccount)
+	if transfer.Notes != "" {
+		body += "\n\nNotes: " + transfer.Notes
+	}
+	a.notify(transfer.OrganizationID, models.NotificationEventHandoffRequested, "Handoff requested by "+name, body)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationSettings(t *testing.T) {
+	ns := notificationSettings(models.JSONB{})
+	assert.Empty(t, ns.SlackWebhookURL)
+	assert.False(t, ns.Events[models.NotificationEventSLABreached].Slack)
+
+	ns = notificationSettings(models.JSONB{
+		"notifications": map[string]interface{}{
+			"slack_webhook_url": "https://hooks.slack.com/services/T/B/X",
+			"email_recipients":  []interface{}{"ops@example.com"},
+			"events": map[string]interface{}{
+				"sla_breached":      map[string]interface{}{"slack": true, "email": true},
+				"campaign_finished": map[string]interface{}{"email": true},
+			},
+		},
+	})
+	assert.Equal(t, "https://hooks.slack.com/services/T/B/X", ns.SlackWebhookURL)
+	assert.Equal(t, []string{"ops@example.com"}, ns.EmailRecipients)
+	assert.Equal(t, NotificationChannels{Slack: true, Email: true}, ns.Events[models.NotificationEventSLABreached])
+	assert.Equal(t, NotificationChannels{Email: true}, ns.Events[models.NotificationEventCampaignFinished])
+	assert.Equal(t, NotificationChannels{}, ns.Events[models.NotificationEventAIProviderDown])
+
+	assert.True(t, isNotificationEvent(models.NotificationEventHandoffRequested))
+	assert.False(t, isNotificationEvent("message.incoming"))
+}
+
+func TestSendNotification_Slack(t *testing.T) {
+	var received map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	app := &App{Config: &config.Config{}, Log: testutil.NopLogger()}
+	ns := NotificationSettings{SlackWebhookURL: server.URL}
+
+	// Email isn't configured, so only Slack is sent to
+	err := app.sendNotification(context.Background(), uuid.New(), ns, NotificationChannels{Slack: true, Email: true},
+		"Campaign Spring finished", "Sent: 10")
+	require.NoError(t, err)
+	assert.Equal(t, "*Campaign Spring finished*\nSent: 10", received["text"])
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	err = app.sendNotification(context.Background(), uuid.New(), ns, NotificationChannels{Slack: true}, "Test", "Test")
+	assert.ErrorContains(t, err, "slack")
+}
+
+func TestNotificationSettings_Encrypted(t *testing.T) {
+	testutil.EnableEncryption(t)
+
+	section := map[string]interface{}{"slack_webhook_url": "https://hooks.slack.com/services/T000/B000/XXX"}
+	require.NoError(t, models.EncryptSettingSecrets("notifications", section))
+	assert.NotEqual(t, "https://hooks.slack.com/services/T000/B000/XXX", section["slack_webhook_url"])
+	s := notificationSettings(models.JSONB{"notifications": section})
+	assert.Equal(t, "https://hooks.slack.com/services/T000/B000/XXX", s.SlackWebhookURL)
+}
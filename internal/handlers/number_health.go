@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// qualityRanks orders quality ratings from worst to best. UNKNOWN has no rank, so
+// changes from or to it are recorded but never alerted on.
+var qualityRanks = map[string]int{
+	models.TemplateQualityRed:    1,
+	models.TemplateQualityYellow: 2,
+	models.TemplateQualityGreen:  3,
+}
+
+// NumberHealth is the health of a number in the health dashboard
+type NumberHealth struct {
+	ID                 uuid.UUID  `json:"id"`
+	Name               string     `json:"name"`
+	PhoneID            string     `json:"phone_id"`
+	QualityRating      string     `json:"quality_rating"`
+	MessagingLimitTier string     `json:"messaging_limit_tier"`
+	HealthCheckedAt    *time.Time `json:"health_checked_at,omitempty"`
+	FailoverActive     bool       `json:"failover_active"`
+}
+
+// GetNumberHealth returns the quality rating and messaging limit tier of the
+// organization's numbers, with their changes over the last 30 days
+func (a *App) GetNumberHealth(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	var accounts []models.WhatsAppAccount
+	if err := a.DB.Where("organization_id = ?", orgID).Order("name").Find(&accounts).Error; err != nil {
+		a.Log.Error("Failed to load accounts", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load number health", nil, "")
+	}
+
+	numbers := make([]NumberHealth, len(accounts))
+	for i, acc := range accounts {
+		numbers[i] = NumberHealth{
+			ID:                 acc.ID,
+			Name:               acc.Name,
+			PhoneID:            acc.PhoneID,
+			QualityRating:      acc.QualityRating,
+			MessagingLimitTier: acc.MessagingLimitTier,
+			HealthCheckedAt:    acc.HealthCheckedAt,
+			FailoverActive:     acc.FailoverActiveAt != nil,
+		}
+	}
+
+	var events []models.NumberHealthEvent
+	if err := a.DB.Where("organization_id = ? AND created_at >= ?", orgID, time.Now().AddDate(0, 0, -30)).
+		Order("created_at DESC").Limit(100).Find(&events).Error; err != nil {
+		a.Log.Error("Failed to load number health events", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load number health", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"numbers": numbers,
+		"events":  events,
+	})
+}
+
+// numberHealthChanges returns the changes between a number's stored health and what
+// Meta reports. Nothing is recorded for the first check, or for values Meta left out.
+func numberHealthChanges(account *models.WhatsAppAccount, quality, tier string) []models.NumberHealthEvent {
+	var changes []models.NumberHealthEvent
+	if account.QualityRating != "" && quality != "" && quality != account.QualityRating {
+		changes = append(changes, models.NumberHealthEvent{
+			OrganizationID:  account.OrganizationID,
+			WhatsAppAccount: account.Name,
+			Kind:            models.NumberHealthQuality,
+			OldValue:        account.QualityRating,
+			NewValue:        quality,
+		})
+	}
+	if account.MessagingLimitTier != "" && tier != "" && tier != account.MessagingLimitTier {
+		changes = append(changes, models.NumberHealthEvent{
+			OrganizationID:  account.OrganizationID,
+			WhatsAppAccount: account.Name,
+			Kind:            models.NumberHealthLimitTier,
+			OldValue:        account.MessagingLimitTier,
+			NewValue:        tier,
+		})
+	}
+	return changes
+}
+
+// qualityDropped reports whether a quality rating went down
+func qualityDropped(oldRating, newRating string) bool {
+	oldRank, okOld := qualityRanks[oldRating]
+	newRank, okNew := qualityRanks[newRating]
+	return okOld && okNew && newRank < oldRank
+}
+
+// refreshNumberHealth fetches a number's health from Meta, stores it, and alerts the
+// organization when quality drops or the messaging limit tier changes
+func (a *App) refreshNumberHealth(ctx context.Context, account *models.WhatsAppAccount) error {
+	phone, err := a.WhatsApp.GetPhoneNumber(ctx, a.toWhatsAppAccount(account))
+	if err != nil {
+		return err
+	}
+
+	changes := numberHealthChanges(account, phone.QualityRating, phone.MessagingLimitTier)
+	updates := map[string]any{"health_checked_at": time.Now()}
+	if phone.QualityRating != "" {
+		updates["quality_rating"] = phone.QualityRating
+	}
+	if phone.MessagingLimitTier != "" {
+		updates["messaging_limit_tier"] = phone.MessagingLimitTier
+	}
+	if err := a.DB.Model(account).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to store number health: %w", err)
+	}
+
+	for i := range changes {
+		change := &changes[i]
+		if err := a.DB.Create(change).Error; err != nil {
+			a.log(ctx).Error("Failed to record number health change", "error", err, "account", account.Name)
+		}
+		a.log(ctx).Info("Number health changed", "account", account.Name, "kind", change.Kind, "from", change.OldValue, "to", change.NewValue)
+
+		switch {
+		case change.Kind == models.NumberHealthQuality && qualityDropped(change.OldValue, change.NewValue):
+			a.sendNumberHealthAlert(account, models.WebhookEventQualityDropped, change)
+		case change.Kind == models.NumberHealthLimitTier:
+			a.sendNumberHealthAlert(account, models.WebhookEventLimitTierChanged, change)
+		}
+	}
+
+	return nil
+}
+
+// processNumberQualityUpdate refreshes the numbers of a business account after Meta
+// reports a quality or messaging limit change for one of them
+func (a *App) processNumberQualityUpdate(wabaID string) {
+	var accounts []models.WhatsAppAccount
+	if err := a.DB.Where("business_id = ?", wabaID).Find(&accounts).Error; err != nil {
+		a.Log.Error("Failed to load accounts for quality update", "error", err, "waba_id", wabaID)
+		return
+	}
+
+	for i := range accounts {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := a.refreshNumberHealth(ctx, &accounts[i]); err != nil {
+			a.Log.Error("Failed to refresh number health", "error", err, "account", accounts[i].Name)
+		}
+		cancel()
+	}
+}
+
+// sendNumberHealthAlert emits the number health webhook event and emails the
+// organization's admins
+func (a *App) sendNumberHealthAlert(account *models.WhatsAppAccount, event models.WebhookEvent, change *models.NumberHealthEvent) {
+	a.DispatchWebhook(account.OrganizationID, event, map[string]interface{}{
+		"account":   account.Name,
+		"phone_id":  account.PhoneID,
+		"old_value": change.OldValue,
+		"new_value": change.NewValue,
+	})
+
+	if !a.emailEnabled() {
+		return
+	}
+
+	var subject, body string
+	if event == models.WebhookEventQualityDropped {
+		subject = fmt.Sprintf("Quality of WhatsApp number %s dropped to %s", account.Name, change.NewValue)
+		body = fmt.Sprintf("Meta lowered the quality rating of the WhatsApp number %s from %s to %s.\n\n"+
+			"Low quality numbers can have their messaging limit lowered or be restricted. "+
+			"Review recent templates and campaigns for messages customers block or report.\n",
+			account.Name, change.OldValue, change.NewValue)
+	} else {
+		subject = fmt.Sprintf("Messaging limit of WhatsApp number %s changed to %s", account.Name, change.NewValue)
+		body = fmt.Sprintf("Meta changed the messaging limit tier of the WhatsApp number %s from %s to %s.\n",
+			account.Name, change.OldValue, change.NewValue)
+	}
+
+	if err := a.sendEmail(a.orgAdminEmails(account.OrganizationID), subject, body); err != nil {
+		a.Log.Error("Failed to send number health alert email", "error", err, "account", account.Name)
+	}
+}
+
+// NumberHealthProcessor polls the quality rating and messaging limit tier of all numbers
+type NumberHealthProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewNumberHealthProcessor creates a new number health processor
+func NewNumberHealthProcessor(app *App, interval time.Duration) *NumberHealthProcessor {
+	return &NumberHealthProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the number health polling loop
+func (p *NumberHealthProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Number health processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Number health processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Number health processor stopped")
+			return
+		case <-ticker.C:
+			p.checkNumbers()
+		}
+	}
+}
+
+// Stop stops the number health processor
+func (p *NumberHealthProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// checkNumbers refreshes the health of every number
+func (p *NumberHealthProcessor) checkNumbers() {
+	var accounts []models.WhatsAppAccount
+	if err := p.app.DB.Where("channel = ?", models.ChannelWhatsApp).Find(&accounts).Error; err != nil {
+		p.app.Log.Error("Failed to load accounts", "error", err)
+		return
+	}
+
+	for i := range accounts {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := p.app.refreshNumberHealth(ctx, &accounts[i]); err != nil {
+			p.app.Log.Debug("Failed to check number health", "account", accounts[i].Name, "error", err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNumberHealthChanges(t *testing.T) {
+	account := &models.WhatsAppAccount{Name: "support"}
+
+	// The first check has nothing to compare against
+	assert.Empty(t, numberHealthChanges(account, "GREEN", "TIER_1K"))
+
+	account.QualityRating = "GREEN"
+	account.MessagingLimitTier = "TIER_1K"
+	assert.Empty(t, numberHealthChanges(account, "GREEN", "TIER_1K"))
+	assert.Empty(t, numberHealthChanges(account, "", ""))
+
+	changes := numberHealthChanges(account, "YELLOW", "TIER_10K")
+	require.Len(t, changes, 2)
+	assert.Equal(t, models.NumberHealthQuality, changes[0].Kind)
+	assert.Equal(t, "GREEN", changes[0].OldValue)
+	assert.Equal(t, "YELLOW", changes[0].NewValue)
+	assert.Equal(t, models.NumberHealthLimitTier, changes[1].Kind)
+	assert.Equal(t, "TIER_10K", changes[1].NewValue)
+	assert.Equal(t, "support", changes[1].WhatsAppAccount)
+}
+
+func TestQualityDropped(t *testing.T) {
+	assert.True(t, qualityDropped("GREEN", "YELLOW"))
+	assert.True(t, qualityDropped("YELLOW", "RED"))
+	assert.False(t, qualityDropped("RED", "GREEN"))
+	assert.False(t, qualityDropped("GREEN", "UNKNOWN"))
+	assert.False(t, qualityDropped("UNKNOWN", "RED"))
+}
+
+func TestRefreshNumberHealth_FirstCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"quality_rating":       "GREEN",
+			"messaging_limit_tier": "TIER_1K",
+			"status":               "CONNECTED",
+		})
+	}))
+	defer server.Close()
+
+	app := &App{
+		Config:   &config.Config{},
+		DB:       testutil.SetupTestDB(t),
+		Log:      testutil.NopLogger(),
+		WhatsApp: whatsapp.NewWithBaseURL(testutil.NopLogger(), server.URL),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Health Org " + uuid.New().String()[:8],
+		Slug:      "health-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{
+		OrganizationID: org.ID,
+		Name:           "support",
+		PhoneID:        "health-phone",
+		BusinessID:     "business",
+		AccessToken:    "token",
+		APIVersion:     "v21.0",
+	}
+	require.NoError(t, app.DB.Create(account).Error)
+
+	require.NoError(t, app.refreshNumberHealth(testutil.TestContext(t), account))
+
+	var saved models.WhatsAppAccount
+	require.NoError(t, app.DB.First(&saved, "id = ?", account.ID).Error)
+	assert.Equal(t, "GREEN", saved.QualityRating)
+	assert.Equal(t, "TIER_1K", saved.MessagingLimitTier)
+	assert.NotNil(t, saved.HealthCheckedAt)
+
+	var events int64
+	app.DB.Model(&models.NumberHealthEvent{}).Where("organization_id = ?", org.ID).Count(&events)
+	assert.Zero(t, events)
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// IncomingOrder is the cart a contact sends from a catalog, in an order message
+type IncomingOrder struct {
+	CatalogID    string              `json:"catalog_id"`
+	Text         string              `json:"text,omitempty"`
+	ProductItems []IncomingOrderItem `json:"product_items"`
+}
+
+// IncomingOrderItem is a product in an order message
+type IncomingOrderItem struct {
+	ProductRetailerID string  `json:"product_retailer_id"`
+	Quantity          int     `json:"quantity"`
+	ItemPrice         float64 `json:"item_price"` // In the currency's main unit, e.g. 12.5
+	Currency          string  `json:"currency"`
+}
+
+// UpdateOrderRequest changes an order's status
+type UpdateOrderRequest struct {
+	Status models.OrderStatus `json:"status"`
+}
+
+// OrderResponse represents an order in API responses
+type OrderResponse struct {
+	ID                uuid.UUID          `json:"id"`
+	ContactID         uuid.UUID          `json:"contact_id"`
+	ContactName       string             `json:"contact_name,omitempty"`
+	WhatsAppAccount   string             `json:"whatsapp_account"`
+	MessageID         *uuid.UUID         `json:"message_id,omitempty"`
+	WhatsAppMessageID string             `json:"whatsapp_message_id"`
+	MetaCatalogID     string             `json:"meta_catalog_id"`
+	Note              string             `json:"note"`
+	Items             models.JSONBArray  `json:"items"`
+	Total             int64              `json:"total"`
+	Currency          string             `json:"currency"`
+	Status            models.OrderStatus `json:"status"`
+	CreatedAt         time.Time          `json:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at"`
+}
+
+// validOrderStatuses are the statuses an order can be given
+var validOrderStatuses = map[models.OrderStatus]bool{
+	models.OrderStatusReceived:  true,
+	models.OrderStatusConfirmed: true,
+	models.OrderStatusFulfilled: true,
+	models.OrderStatusCancelled: true,
+}
+
+// orderItems converts the products of an order message to order items, named from
+// the catalog products, and returns them with the order's total and currency.
+// Prices are converted to the smallest currency unit, like catalog prices.
+func orderItems(order *IncomingOrder, products map[string]models.CatalogProduct) (models.JSONBArray, int64, string) {
+	items := make(models.JSONBArray, 0, len(order.ProductItems))
+	var total int64
+	currency := ""
+	for _, item := range order.ProductItems {
+		price := int64(math.Round(item.ItemPrice * 100))
+		total += price * int64(item.Quantity)
+		if currency == "" {
+			currency = item.Currency
+		}
+
+		orderItem := map[string]interface{}{
+			"product_retailer_id": item.ProductRetailerID,
+			"quantity":            item.Quantity,
+			"item_price":          price,
+			"currency":            item.Currency,
+		}
+		if product, ok := products[item.ProductRetailerID]; ok {
+			orderItem["name"] = product.Name
+		}
+		items = append(items, orderItem)
+	}
+	return items, total, currency
+}
+
+// orderContent summarizes an order message for the chat, with the contact's note if any
+func orderContent(order *IncomingOrder) string {
+	quantity := 0
+	for _, item := range order.ProductItems {
+		quantity += item.Quantity
+	}
+	content := "[Order: " + strconv.Itoa(quantity) + " items]"
+	if quantity == 1 {
+		content = "[Order: 1 item]"
+	}
+	if order.Text != "" {
+		content += " " + order.Text
+	}
+	return content
+}
+
+// saveIncomingOrder stores the order in an order message, keeps its items on the
+// message for the chat and emits order.received
+func (a *App) saveIncomingOrder(account *models.WhatsAppAccount, contact *models.Contact, message *models.Message, whatsappMsgID string, incoming *IncomingOrder) *models.Order {
+	retailerIDs := make([]string, 0, len(incoming.ProductItems))
+	for _, item := range incoming.ProductItems {
+		retailerIDs = append(retailerIDs, item.ProductRetailerID)
+	}
+	var catalogProducts []models.CatalogProduct
+	if len(retailerIDs) > 0 {
+		a.DB.Joins("Catalog").
+			Where("catalog_products.organization_id = ? AND catalog_products.retailer_id IN ?", account.OrganizationID, retailerIDs).
+			Where(`"Catalog"."meta_catalog_id" = ?`, incoming.CatalogID).
+			Find(&catalogProducts)
+	}
+	products := make(map[string]models.CatalogProduct, len(catalogProducts))
+	for _, p := range catalogProducts {
+		products[p.RetailerID] = p
+	}
+
+	items, total, currency := orderItems(incoming, products)
+	order := models.Order{
+		OrganizationID:    account.OrganizationID,
+		WhatsAppAccount:   account.Name,
+		ContactID:         contact.ID,
+		WhatsAppMessageID: whatsappMsgID,
+		MetaCatalogID:     incoming.CatalogID,
+		Note:              incoming.Text,
+		Items:             items,
+		Total:             total,
+		Currency:          currency,
+		Status:            models.OrderStatusReceived,
+	}
+	if message != nil {
+		order.MessageID = &message.ID
+	}
+	if err := a.DB.Create(&order).Error; err != nil {
+		a.Log.Error("Failed to save order", "error", err, "message_id", whatsappMsgID)
+		return nil
+	}
+
+	if message != nil {
+		interactiveData := models.JSONB{
+			"type":     "order",
+			"order_id": order.ID.String(),
+			"note":     order.Note,
+			"items":    items,
+			"total":    total,
+			"currency": currency,
+		}
+		if err := a.DB.Model(message).Update("interactive_data", interactiveData).Error; err != nil {
+			a.Log.Error("Failed to store order on message", "error", err, "message_id", whatsappMsgID)
+		}
+	}
+
+	data := OrderEventData{
+		OrderID:         order.ID.String(),
+		ContactID:       contact.ID.String(),
+		ContactPhone:    contact.PhoneNumber,
+		ContactName:     contact.ProfileName,
+		MetaCatalogID:   order.MetaCatalogID,
+		Note:            order.Note,
+		Items:           items,
+		Total:           total,
+		Currency:        currency,
+		WhatsAppAccount: account.Name,
+	}
+	if message != nil {
+		data.MessageID = message.ID.String()
+	}
+	a.DispatchWebhook(account.OrganizationID, models.WebhookEventOrderReceived, data)
+
+	a.Log.Info("Order received", "order_id", order.ID, "contact_id", contact.ID, "items", len(items), "total", total, "currency", currency)
+	return &order
+}
+
+// ListOrders returns the organization's orders, newest first, optionally filtered
+// by contact and status
+func (a *App) ListOrders(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	page, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("page")))
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := a.DB.Model(&models.Order{}).Where("organization_id = ?", orgID)
+
+	// Users without contacts:read permission only see orders of contacts assigned to them
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("contact_id IN (?)", a.DB.Model(&models.Contact{}).Select("id").Where("assigned_user_id = ?", userID))
+	}
+
+	args := r.RequestCtx.QueryArgs()
+	if contactID := string(args.Peek("contact_id")); contactID != "" {
+		id, err := uuid.Parse(contactID)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact_id", nil, "")
+		}
+		query = query.Where("contact_id = ?", id)
+	}
+	if status := string(args.Peek("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var orders []models.Order
+	if err := query.Preload("Contact").
+		Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&orders).Error; err != nil {
+		a.Log.Error("Failed to list orders", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list orders", nil, "")
+	}
+
+	shouldMask := a.ShouldMaskPhoneNumbers(orgID)
+	result := make([]OrderResponse, len(orders))
+	for i, order := range orders {
+		result[i] = orderToResponse(order, shouldMask)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"orders": result,
+		"total":  total,
+		"page":   page,
+		"limit":  limit,
+	})
+}
+
+// GetOrder returns an order
+func (a *App) GetOrder(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	order, err := a.findOrder(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Order not found", nil, "")
+	}
+
+	return r.SendEnvelope(orderToResponse(*order, a.ShouldMaskPhoneNumbers(orgID)))
+}
+
+// UpdateOrder changes an order's status
+func (a *App) UpdateOrder(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	order, err := a.findOrder(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Order not found", nil, "")
+	}
+
+	var req UpdateOrderRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if !validOrderStatuses[req.Status] {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid status", nil, "")
+	}
+
+	if err := a.DB.Model(order).Update("status", req.Status).Error; err != nil {
+		a.Log.Error("Failed to update order", "error", err, "order_id", order.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update order", nil, "")
+	}
+	order.Status = req.Status
+
+	return r.SendEnvelope(orderToResponse(*order, a.ShouldMaskPhoneNumbers(orgID)))
+}
+
+// findOrder loads the order in the request path, if the user can see its contact
+func (a *App) findOrder(r *fastglue.Request, orgID uuid.UUID) (*models.Order, error) {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	query := a.DB.Where("id = ? AND organization_id = ?", id, orgID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("contact_id IN (?)", a.DB.Model(&models.Contact{}).Select("id").Where("assigned_user_id = ?", userID))
+	}
+
+	var order models.Order
+	if err := query.Preload("Contact").First(&order).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func orderToResponse(order models.Order, maskPhone bool) OrderResponse {
+	resp := OrderResponse{
+		ID:                order.ID,
+		ContactID:         order.ContactID,
+		WhatsAppAccount:   order.WhatsAppAccount,
+		MessageID:         order.MessageID,
+		WhatsAppMessageID: order.WhatsAppMessageID,
+		MetaCatalogID:     order.MetaCatalogID,
+		Note:              order.Note,
+		Items:             order.Items,
+		Total:             order.Total,
+		Currency:          order.Currency,
+		Status:            order.Status,
+		CreatedAt:         order.CreatedAt,
+		UpdatedAt:         order.UpdatedAt,
+	}
+	if order.Contact != nil {
+		resp.ContactName = order.Contact.ProfileName
+		if maskPhone {
+			resp.ContactName = MaskIfPhoneNumber(resp.ContactName)
+		}
+	}
+	return resp
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderItems(t *testing.T) {
+	order := &IncomingOrder{
+		CatalogID: "meta-catalog",
+		Text:      "Please deliver after 6pm",
+		ProductItems: []IncomingOrderItem{
+			{ProductRetailerID: "BREAD-1", Quantity: 2, ItemPrice: 6.5, Currency: "USD"},
+			{ProductRetailerID: "CAKE-9", Quantity: 1, ItemPrice: 12.99, Currency: "USD"},
+		},
+	}
+	products := map[string]models.CatalogProduct{"BREAD-1": {Name: "Sourdough", RetailerID: "BREAD-1"}}
+
+	items, total, currency := orderItems(order, products)
+	require.Len(t, items, 2)
+	assert.Equal(t, int64(2599), total)
+	assert.Equal(t, "USD", currency)
+
+	// Items are named from the catalog when the product is known
+	bread := items[0].(map[string]interface{})
+	assert.Equal(t, "Sourdough", bread["name"])
+	assert.Equal(t, int64(650), bread["item_price"])
+	assert.Equal(t, 2, bread["quantity"])
+	assert.NotContains(t, items[1].(map[string]interface{}), "name")
+
+	assert.Equal(t, "[Order: 3 items] Please deliver after 6pm", orderContent(order))
+	assert.Equal(t, "[Order: 1 item]", orderContent(&IncomingOrder{
+		ProductItems: []IncomingOrderItem{{ProductRetailerID: "CAKE-9", Quantity: 1}},
+	}))
+}
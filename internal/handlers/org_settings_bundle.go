@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/database"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// orgSettingsBundleResources are the resources of the records in a settings bundle.
+// Exporting and importing one needs permission on each of them, on top of the
+// general settings permission the route needs.
+var orgSettingsBundleResources = []string{
+	models.ResourceSettingsChatbot,
+	models.ResourceTemplates,
+	models.ResourceFlowsChatbot,
+	models.ResourceChatbotKeywords,
+	models.ResourceCannedResponses,
+}
+
+// ExportOrgSettingsBundle returns the organization's configuration as a bundle that
+// can be imported into another organization or environment
+func (a *App) ExportOrgSettingsBundle(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.hasOrgSettingsBundlePermissions(userID, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Permission denied", nil, "")
+	}
+
+	bundle, err := database.ExportOrgSettings(a.DB, orgID)
+	if err != nil {
+		a.Log.Error("Failed to export settings", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to export settings", nil, "")
+	}
+	return r.SendEnvelope(bundle)
+}
+
+// ImportOrgSettingsBundle applies an exported bundle to the organization. With the
+// dry_run query parameter, it reports what the import would do without applying it.
+func (a *App) ImportOrgSettingsBundle(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.hasOrgSettingsBundlePermissions(userID, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Permission denied", nil, "")
+	}
+
+	var bundle database.OrgSettings
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &bundle); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid settings bundle", nil, "")
+	}
+
+	result, err := a.ApplyOrgSettingsBundle(orgID, &bundle, database.OrgSettingsImport{
+		DryRun: string(r.RequestCtx.QueryArgs().Peek("dry_run")) == "true",
+		UserID: userID,
+	})
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	return r.SendEnvelope(result)
+}
+
+// ApplyOrgSettingsBundle validates a settings bundle and imports it into an
+// organization, or works out what importing it would do for a dry run
+func (a *App) ApplyOrgSettingsBundle(orgID uuid.UUID, bundle *database.OrgSettings, opts database.OrgSettingsImport) (*database.OrgSettingsImportResult, error) {
+	if problems := a.validateOrgSettingsBundle(orgID, bundle); len(problems) > 0 {
+		return nil, fmt.Errorf("invalid settings bundle: %s", strings.Join(problems, "; "))
+	}
+
+	result, err := database.ImportOrgSettings(a.DB, orgID, bundle, opts)
+	if err != nil {
+		a.Log.Error("Failed to import settings", "error", err, "org_id", orgID)
+		return nil, fmt.Errorf("failed to import settings: %w", err)
+	}
+	if !opts.DryRun {
+		a.invalidateOrgSettingsBundleCaches(orgID)
+		a.Log.Info("Settings imported", "org_id", orgID, "user_id", opts.UserID, "created", result.Created, "updated", result.Updated)
+	}
+	return result, nil
+}
+
+// invalidateOrgSettingsBundleCaches invalidates the caches of what importing a
+// settings bundle changes
+func (a *App) invalidateOrgSettingsBundleCaches(orgID uuid.UUID) {
+	a.InvalidateChatbotSettingsCache(orgID)
+	a.InvalidateSLASettingsCache()
+	a.InvalidateChatbotFlowsCache(orgID)
+	a.InvalidateKeywordRulesCache(orgID)
+	a.InvalidateOrgAllowedIPsCache(orgID)
+}
+
+// hasOrgSettingsBundlePermissions reports whether a user may export or import the
+// records in settings bundles
+func (a *App) hasOrgSettingsBundlePermissions(userID uuid.UUID, action string) bool {
+	for _, resource := range orgSettingsBundleResources {
+		if !a.HasPermission(userID, resource, action) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateOrgSettingsBundle checks the records of a bundle the way creating them
+// does, returning what's wrong with them. References to other records are checked
+// by the import.
+func (a *App) validateOrgSettingsBundle(orgID uuid.UUID, bundle *database.OrgSettings) []string {
+	var problems []string
+	if bundle.Version != database.OrgSettingsVersion {
+		return []string{fmt.Sprintf("unsupported version %d", bundle.Version)}
+	}
+
+	for _, t := range bundle.Templates {
+		if t.Name == "" || t.Language == "" || t.BodyContent == "" {
+			problems = append(problems, fmt.Sprintf("template %q: name, language and body are required", t.Name))
+		}
+	}
+
+	for _, flow := range bundle.Flows {
+		if flow.Name == "" {
+			problems = append(problems, "flow: name is required")
+			continue
+		}
+		if flow.Language != "" && !isLanguageCode(flow.Language) {
+			problems = append(problems, fmt.Sprintf("flow %q: invalid language", flow.Name))
+		}
+		steps := make([]FlowStepRequest, 0, len(flow.Steps))
+		for _, step := range flow.Steps {
+			req := flowStepRequestFromModel(step)
+			// Flows to jump to can be in the bundle, the import matches them up
+			if req.MessageType == models.FlowStepTypeJump {
+				req.MessageType = models.FlowStepTypeText
+			}
+			steps = append(steps, req)
+		}
+		if err := a.validateFlowSteps(orgID, steps); err != nil {
+			problems = append(problems, fmt.Sprintf("flow %q: %s", flow.Name, err))
+		}
+	}
+
+	for _, rule := range bundle.KeywordRules {
+		if rule.Name == "" {
+			problems = append(problems, "keyword rule: name is required")
+			continue
+		}
+		if err := validateKeywordRule(rule.Keywords, rule.MatchType, rule.ResponseType, rule.ResponseContent); err != nil {
+			problems = append(problems, fmt.Sprintf("keyword rule %q: %s", rule.Name, err))
+		}
+	}
+
+	for _, canned := range bundle.CannedResponses {
+		if canned.Name == "" || canned.Content == "" {
+			problems = append(problems, fmt.Sprintf("canned response %q: name and content are required", canned.Name))
+		}
+	}
+	return problems
+}
+
+// flowStepRequestFromModel returns a flow step as the request creating it
+func flowStepRequestFromModel(step models.ChatbotFlowStep) FlowStepRequest {
+	buttons := make([]map[string]interface{}, 0, len(step.Buttons))
+	for _, b := range step.Buttons {
+		if button, ok := b.(map[string]interface{}); ok {
+			buttons = append(buttons, button)
+		}
+	}
+	return FlowStepRequest{
+		StepName:        step.StepName,
+		StepOrder:       step.StepOrder,
+		Message:         step.Message,
+		MessageType:     step.MessageType,
+		InputType:       step.InputType,
+		InputConfig:     step.InputConfig,
+		ApiConfig:       step.ApiConfig,
+		Buttons:         buttons,
+		TransferConfig:  step.TransferConfig,
+		ValidationRegex: step.ValidationRegex,
+		ValidationError: step.ValidationError,
+		StoreAs:         step.StoreAs,
+		NextStep:        step.NextStep,
+		ConditionalNext: step.ConditionalNext,
+		SkipCondition:   step.SkipCondition,
+		RetryOnInvalid:  step.RetryOnInvalid,
+		MaxRetries:      step.MaxRetries,
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/database"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateOrgSettingsBundle(t *testing.T) {
+	app := &App{Log: testutil.NopLogger()}
+	orgID := uuid.New()
+
+	valid := &database.OrgSettings{
+		Version:   database.OrgSettingsVersion,
+		Templates: []models.Template{{Name: "welcome", Language: "en", BodyContent: "Hi {{1}}"}},
+		Flows: []models.ChatbotFlow{{Name: "Support", Language: "en", Steps: []models.ChatbotFlowStep{
+			{StepName: "ask", Message: "What do you need?", MessageType: models.FlowStepTypeText},
+			{StepName: "route", MessageType: models.FlowStepTypeCondition, InputConfig: models.JSONB{
+				"branches": []interface{}{map[string]interface{}{"condition": "{{ask}} == 'sales'", "next_step": "ask"}},
+			}},
+			// Jumps to flows of the bundle are matched up by the import
+			{StepName: "more", MessageType: models.FlowStepTypeJump, InputConfig: models.JSONB{"flow_id": uuid.New().String()}},
+		}}},
+		KeywordRules: []models.KeywordRule{{
+			Name: "hours", Keywords: models.StringArray{"hours"}, MatchType: models.MatchTypeContains,
+			ResponseType: models.ResponseTypeText, ResponseContent: models.JSONB{"body": "9 to 5"},
+		}},
+		CannedResponses: []models.CannedResponse{{Name: "Thanks", Content: "Thank you!"}},
+	}
+	assert.Empty(t, app.validateOrgSettingsBundle(orgID, valid))
+
+	assert.Equal(t, []string{"unsupported version 2"}, app.validateOrgSettingsBundle(orgID, &database.OrgSettings{Version: 2}))
+
+	invalid := &database.OrgSettings{
+		Version:   database.OrgSettingsVersion,
+		Templates: []models.Template{{Name: "empty", Language: "en"}},
+		Flows: []models.ChatbotFlow{{Name: "Broken", Steps: []models.ChatbotFlowStep{
+			{StepName: "route", MessageType: models.FlowStepTypeCondition},
+		}}},
+		KeywordRules: []models.KeywordRule{{
+			Name: "bad", Keywords: models.StringArray{"("}, MatchType: models.MatchTypeRegex,
+			ResponseType: models.ResponseTypeText, ResponseContent: models.JSONB{"body": "x"},
+		}},
+		CannedResponses: []models.CannedResponse{{Name: "Blank"}},
+	}
+	problems := app.validateOrgSettingsBundle(orgID, invalid)
+	require.Len(t, problems, 4)
+	assert.Contains(t, problems[0], `template "empty"`)
+	assert.Contains(t, problems[1], `flow "Broken"`)
+	assert.Contains(t, problems[2], `keyword rule "bad"`)
+	assert.Contains(t, problems[3], `canned response "Blank"`)
+}
+
+func TestApplyOrgSettingsBundle(t *testing.T) {
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger()}
+
+	source := models.Organization{BaseModel: models.BaseModel{ID: uuid.New()}, Name: "Staging", Slug: "staging-" + uuid.New().String()[:8]}
+	target := models.Organization{BaseModel: models.BaseModel{ID: uuid.New()}, Name: "Production", Slug: "production-" + uuid.New().String()[:8]}
+	require.NoError(t, app.DB.Create(&source).Error)
+	require.NoError(t, app.DB.Create(&target).Error)
+
+	template := models.Template{
+		BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: source.ID, WhatsAppAccount: "main",
+		Name: "welcome", Language: "en", BodyContent: "Hi {{1}}", Status: "APPROVED", MetaTemplateID: "123",
+	}
+	require.NoError(t, app.DB.Create(&template).Error)
+	flow := models.ChatbotFlow{
+		BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: source.ID, Name: "Support",
+		IsEnabled: true, InitialTemplateID: &template.ID,
+	}
+	require.NoError(t, app.DB.Create(&flow).Error)
+	require.NoError(t, app.DB.Create(&models.ChatbotFlowStep{
+		FlowID: flow.ID, StepName: "start", StepOrder: 1, Message: "Hello", MessageType: models.FlowStepTypeText,
+	}).Error)
+	require.NoError(t, app.DB.Create(&models.KeywordRule{
+		OrganizationID: source.ID, WhatsAppAccount: "main", Name: "greeting", IsEnabled: true,
+		Keywords: models.StringArray{"hi"}, MatchType: models.MatchTypeContains,
+		ResponseType: models.ResponseTypeTemplate, ResponseContent: models.JSONB{"template_id": template.ID.String()},
+	}).Error)
+	require.NoError(t, app.DB.Create(&models.CannedResponse{
+		OrganizationID: source.ID, Name: "Thanks", Content: "Thank you!", IsActive: true,
+	}).Error)
+
+	bundle, err := database.ExportOrgSettings(app.DB, source.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Staging", bundle.Organization)
+	require.Len(t, bundle.Flows, 1)
+	require.Len(t, bundle.Flows[0].Steps, 1)
+
+	t.Run("dry run", func(t *testing.T) {
+		result, err := app.ApplyOrgSettingsBundle(target.ID, bundle, database.OrgSettingsImport{DryRun: true})
+		require.NoError(t, err)
+		assert.True(t, result.DryRun)
+		assert.Equal(t, 1, result.Created["templates"])
+		assert.Equal(t, 1, result.Created["flows"])
+		assert.Equal(t, 1, result.Created["canned_responses"])
+		assert.NotEmpty(t, result.Warnings, "the target has no number named main")
+
+		var count int64
+		app.DB.Model(&models.ChatbotFlow{}).Where("organization_id = ?", target.ID).Count(&count)
+		assert.Zero(t, count, "a dry run imports nothing")
+	})
+
+	t.Run("import", func(t *testing.T) {
+		result, err := database.ImportOrgSettings(app.DB, target.ID, bundle, database.OrgSettingsImport{})
+		require.NoError(t, err)
+		assert.False(t, result.DryRun)
+
+		var imported models.Template
+		require.NoError(t, app.DB.Where("organization_id = ? AND name = ?", target.ID, "welcome").First(&imported).Error)
+		assert.NotEqual(t, template.ID, imported.ID)
+		assert.Equal(t, "DRAFT", imported.Status)
+		assert.Empty(t, imported.MetaTemplateID)
+
+		var importedFlow models.ChatbotFlow
+		require.NoError(t, app.DB.Preload("Steps").Where("organization_id = ? AND name = ?", target.ID, "Support").First(&importedFlow).Error)
+		require.NotNil(t, importedFlow.InitialTemplateID)
+		assert.Equal(t, imported.ID, *importedFlow.InitialTemplateID)
+		assert.Len(t, importedFlow.Steps, 1)
+
+		var rule models.KeywordRule
+		require.NoError(t, app.DB.Where("organization_id = ?", target.ID).First(&rule).Error)
+		assert.Equal(t, imported.ID.String(), rule.ResponseContent["template_id"])
+
+		// Importing again updates what the first import created
+		result, err = database.ImportOrgSettings(app.DB, target.ID, bundle, database.OrgSettingsImport{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Updated["flows"])
+		assert.Equal(t, 1, result.Updated["canned_responses"])
+		var count int64
+		app.DB.Model(&models.ChatbotFlow{}).Where("organization_id = ?", target.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+}
@@ -2,8 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/middleware"
 	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
@@ -14,6 +19,20 @@ type OrganizationSettings struct {
 	MaskPhoneNumbers bool   `json:"mask_phone_numbers"`
 	Timezone         string `json:"timezone"`
 	DateFormat       string `json:"date_format"`
+
+	// Template sent in place of free-form messages once the 24-hour customer service window has closed
+	ServiceWindowFallbackTemplateID     string            `json:"service_window_fallback_template_id"`
+	ServiceWindowFallbackTemplateParams map[string]string `json:"service_window_fallback_template_params"`
+
+	// Only allow SSO logins, except for super admins
+	EnforceSSO bool `json:"enforce_sso"`
+	// Members enroll in two-factor authentication on their next password login
+	Require2FA bool `json:"require_2fa"`
+	// IPs and CIDR ranges members and API keys may use the API from, empty allows any
+	AllowedIPs []string `json:"allowed_ips"`
+
+	ConversationCostSettings
+	ConsentSettings
 }
 
 // GetOrganizationSettings returns the organization settings
@@ -45,7 +64,18 @@ func (a *App) GetOrganizationSettings(r *fastglue.Request) error {
 		if v, ok := org.Settings["date_format"].(string); ok && v != "" {
 			settings.DateFormat = v
 		}
+		if v, ok := org.Settings["service_window_fallback_template_id"].(string); ok {
+			settings.ServiceWindowFallbackTemplateID = v
+		}
+		if v, ok := org.Settings["service_window_fallback_template_params"].(map[string]interface{}); ok {
+			settings.ServiceWindowFallbackTemplateParams = jsonbToStringMap(v)
+		}
+		settings.EnforceSSO = ssoEnforced(&org)
+		settings.Require2FA = twoFactorRequired(&org)
 	}
+	settings.AllowedIPs = orgAllowedIPs(&org)
+	settings.ConversationCostSettings = conversationCostSettings(org.Settings)
+	settings.ConsentSettings = consentSettings(org.Settings)
 
 	return r.SendEnvelope(map[string]interface{}{
 		"settings": settings,
@@ -65,6 +95,22 @@ func (a *App) UpdateOrganizationSettings(r *fastglue.Request) error {
 		Timezone         *string `json:"timezone"`
 		DateFormat       *string `json:"date_format"`
 		Name             *string `json:"name"`
+
+		ServiceWindowFallbackTemplateID     *string           `json:"service_window_fallback_template_id"`
+		ServiceWindowFallbackTemplateParams map[string]string `json:"service_window_fallback_template_params"`
+
+		ConversationRates    *ConversationRates `json:"conversation_rates"`
+		ConversationCurrency *string            `json:"conversation_currency"`
+		ConversationBudget   *int64             `json:"conversation_budget"`
+
+		EnforceSSO *bool `json:"enforce_sso"`
+		Require2FA *bool `json:"require_2fa"`
+
+		AllowedIPs *[]string `json:"allowed_ips"`
+
+		// An empty object restores the default keywords
+		OptOutKeywords map[string][]string `json:"opt_out_keywords"`
+		OptInKeywords  map[string][]string `json:"opt_in_keywords"`
 	}
 
 	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
@@ -75,6 +121,7 @@ func (a *App) UpdateOrganizationSettings(r *fastglue.Request) error {
 	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
 	}
+	before := orgSettingsAuditSnapshot(&org)
 
 	// Update settings
 	if org.Settings == nil {
@@ -85,6 +132,9 @@ func (a *App) UpdateOrganizationSettings(r *fastglue.Request) error {
 		org.Settings["mask_phone_numbers"] = *req.MaskPhoneNumbers
 	}
 	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid timezone", nil, "")
+		}
 		org.Settings["timezone"] = *req.Timezone
 	}
 	if req.DateFormat != nil {
@@ -93,16 +143,167 @@ func (a *App) UpdateOrganizationSettings(r *fastglue.Request) error {
 	if req.Name != nil && *req.Name != "" {
 		org.Name = *req.Name
 	}
+	if req.ServiceWindowFallbackTemplateID != nil {
+		if *req.ServiceWindowFallbackTemplateID == "" {
+			delete(org.Settings, "service_window_fallback_template_id")
+			delete(org.Settings, "service_window_fallback_template_params")
+		} else {
+			templateID, err := uuid.Parse(*req.ServiceWindowFallbackTemplateID)
+			if err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid service_window_fallback_template_id", nil, "")
+			}
+			var template models.Template
+			if err := a.DB.Where("id = ? AND organization_id = ?", templateID, orgID).First(&template).Error; err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Fallback template not found", nil, "")
+			}
+			if template.Status != string(models.TemplateStatusApproved) {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Fallback template is not approved (status: %s)", template.Status), nil, "")
+			}
+			if missingParams, paramNames := missingTemplateParams(&template, req.ServiceWindowFallbackTemplateParams); len(missingParams) > 0 {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+					fmt.Sprintf("Missing fallback template parameters: %s. Expected parameters: %v", strings.Join(missingParams, ", "), paramNames),
+					nil, "")
+			}
+			org.Settings["service_window_fallback_template_id"] = template.ID.String()
+			org.Settings["service_window_fallback_template_params"] = stringMapToJSONB(req.ServiceWindowFallbackTemplateParams)
+		}
+	}
+
+	if rates := req.ConversationRates; rates != nil {
+		if rates.Marketing < 0 || rates.Utility < 0 || rates.Authentication < 0 || rates.Service < 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Conversation rates can't be negative", nil, "")
+		}
+		org.Settings["conversation_rates"] = map[string]interface{}{
+			"marketing":      rates.Marketing,
+			"utility":        rates.Utility,
+			"authentication": rates.Authentication,
+			"service":        rates.Service,
+		}
+	}
+	if req.ConversationCurrency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*req.ConversationCurrency))
+		if len(currency) != 3 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Conversation currency must be a 3-letter code", nil, "")
+		}
+		org.Settings["conversation_currency"] = currency
+	}
+	if req.ConversationBudget != nil {
+		if *req.ConversationBudget < 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Conversation budget can't be negative", nil, "")
+		}
+		org.Settings["conversation_budget"] = *req.ConversationBudget
+	}
+	if req.OptOutKeywords != nil || req.OptInKeywords != nil {
+		consent := consentSettings(org.Settings)
+		if consent.OptOutKeywords, err = updatedConsentKeywords(consent.OptOutKeywords, req.OptOutKeywords, defaultOptOutKeywords); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		if consent.OptInKeywords, err = updatedConsentKeywords(consent.OptInKeywords, req.OptInKeywords, defaultOptInKeywords); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		if err := validateConsentSettings(consent); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		org.Settings["opt_out_keywords"] = consentKeywordsToJSONB(consent.OptOutKeywords)
+		org.Settings["opt_in_keywords"] = consentKeywordsToJSONB(consent.OptInKeywords)
+	}
+
+	if req.EnforceSSO != nil {
+		if *req.EnforceSSO {
+			if !a.HasFeature(orgID, models.PlanFeatureSSO) {
+				return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureSSO), nil, "")
+			}
+			var enabled int64
+			a.DB.Model(&models.SSOProvider{}).Where("organization_id = ? AND is_enabled = ?", orgID, true).Count(&enabled)
+			if enabled == 0 {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Enable an SSO provider before enforcing SSO", nil, "")
+			}
+		}
+		org.Settings["enforce_sso"] = *req.EnforceSSO
+	}
+	if req.Require2FA != nil {
+		org.Settings["require_2fa"] = *req.Require2FA
+	}
+	if req.AllowedIPs != nil {
+		var values []string
+		allowed := []interface{}{}
+		for _, value := range *req.AllowedIPs {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+				allowed = append(allowed, value)
+			}
+		}
+		ranges, err := config.ParseIPRanges(values)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "allowed_ips: "+err.Error(), nil, "")
+		}
+		// Saving a list without the admin's own IP would lock them out right away
+		if ip := middleware.GetClientIP(r); !middleware.IsSuperAdmin(r) && !middleware.IPAllowed(ip, ranges) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("allowed_ips must include your current IP address %s", ip), nil, "")
+		}
+		org.Settings["allowed_ips"] = allowed
+	}
 
 	if err := a.DB.Save(&org).Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
 	}
+	a.recordOrgSettingsAudit(r, &org, before)
+	if req.AllowedIPs != nil {
+		a.InvalidateOrgAllowedIPsCache(orgID)
+	}
 
 	return r.SendEnvelope(map[string]interface{}{
 		"message": "Settings updated successfully",
 	})
 }
 
+// orgSettingsAuditSnapshot captures an organization's name and settings for the
+// audit log. Credentials are decrypted, so saving one again with a new data key isn't
+// recorded as a change. They're redacted in the log.
+func orgSettingsAuditSnapshot(org *models.Organization) map[string]interface{} {
+	snapshot := auditSnapshot(org.Settings)
+	if snapshot == nil {
+		snapshot = map[string]interface{}{}
+	}
+	for _, secret := range models.OrgSettingsSecrets {
+		if section, ok := snapshot[secret.Section].(map[string]interface{}); ok {
+			if _, ok := section[secret.Key]; ok {
+				section[secret.Key] = models.SettingSecret(section, secret.Key)
+			}
+		}
+	}
+	snapshot["name"] = org.Name
+	return snapshot
+}
+
+// recordOrgSettingsAudit records a change to an organization's settings
+func (a *App) recordOrgSettingsAudit(r *fastglue.Request, org *models.Organization, before map[string]interface{}) {
+	a.recordAudit(r, models.AuditLog{
+		OrganizationID: org.ID,
+		Action:         models.AuditActionUpdate,
+		ResourceType:   models.AuditResourceOrganizationSettings,
+		ResourceID:     &org.ID,
+		ResourceName:   org.Name,
+	}, before, orgSettingsAuditSnapshot(org))
+}
+
+// getOrgLocation returns the organization's configured timezone, or nil if unset or invalid
+func (a *App) getOrgLocation(orgID uuid.UUID) *time.Location {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return nil
+	}
+	tz, ok := org.Settings["timezone"].(string)
+	if !ok || tz == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
 // MaskPhoneNumber masks a phone number showing only last 4 digits
 func MaskPhoneNumber(phone string) string {
 	if len(phone) <= 4 {
@@ -159,7 +360,12 @@ type OrganizationResponse struct {
 	ID        uuid.UUID `json:"id"`
 	Name      string    `json:"name"`
 	Slug      string    `json:"slug,omitempty"`
+	Plan      string    `json:"plan"`
+	Features  []string  `json:"features,omitempty"`
 	CreatedAt string    `json:"created_at"`
+
+	TrialEndsAt  *time.Time `json:"trial_ends_at,omitempty"`
+	TrialExpired bool       `json:"trial_expired,omitempty"`
 }
 
 // ListOrganizations returns all organizations (super admin only)
@@ -186,7 +392,11 @@ func (a *App) ListOrganizations(r *fastglue.Request) error {
 			ID:        org.ID,
 			Name:      org.Name,
 			Slug:      org.Slug,
+			Plan:      org.Plan,
 			CreatedAt: org.CreatedAt.Format("2006-01-02T15:04:05Z"),
+
+			TrialEndsAt:  org.TrialEndsAt,
+			TrialExpired: trialExpired(org.TrialEndsAt, time.Now()),
 		}
 	}
 
@@ -207,10 +417,21 @@ func (a *App) GetCurrentOrganization(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
 	}
 
+	plan := a.orgPlan(orgID)
+	planName := ""
+	if plan != nil {
+		planName = plan.Name
+	}
+
 	return r.SendEnvelope(OrganizationResponse{
 		ID:        org.ID,
 		Name:      org.Name,
 		Slug:      org.Slug,
+		Plan:      planName,
+		Features:  orgFeatures(plan),
 		CreatedAt: org.CreatedAt.Format("2006-01-02T15:04:05Z"),
+
+		TrialEndsAt:  org.TrialEndsAt,
+		TrialExpired: trialExpired(org.TrialEndsAt, time.Now()),
 	})
 }
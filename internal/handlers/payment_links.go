@@ -0,0 +1,560 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/payments"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// paymentLinkToolName is the built-in tool the AI creates payment links with
+const paymentLinkToolName = "create_payment_link"
+
+// paymentLinkTool lets the AI create a payment link, whose URL it sends the customer
+var paymentLinkTool = AITool{
+	Name:        paymentLinkToolName,
+	Description: "Create a link the customer pays an amount through. Send the returned url to the customer.",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"amount":      map[string]interface{}{"type": "number", "description": "Amount to pay, in the currency's main unit, e.g. 49.99"},
+			"currency":    map[string]interface{}{"type": "string", "description": "ISO 4217 currency code, e.g. USD. Optional, defaults to the business currency."},
+			"description": map[string]interface{}{"type": "string", "description": "What the payment is for, shown to the customer"},
+		},
+		"required": []string{"amount", "description"},
+	},
+}
+
+// errPaymentsNotConfigured is returned when the organization hasn't connected a
+// payment provider
+var errPaymentsNotConfigured = errors.New("payments are not configured")
+
+// PaymentSettings connect the Stripe or Razorpay account payment links are created
+// with
+type PaymentSettings struct {
+	Provider      payments.Provider // Payment links are off when empty
+	KeyID         string            // Razorpay key ID
+	SecretKey     string            // Stripe secret key or Razorpay key secret, may reference a secret
+	WebhookSecret string
+	Currency      string // Used when a link doesn't set one
+	SuccessURL    string // Where customers land after paying
+	PaidMessage   string // Sent when a link is paid, unless the link has its own
+}
+
+// PaymentSettingsRequest updates payment settings. Omitted fields keep their
+// current value.
+type PaymentSettingsRequest struct {
+	Provider      *payments.Provider `json:"provider"`
+	KeyID         *string            `json:"key_id"`
+	SecretKey     *string            `json:"secret_key"`
+	WebhookSecret *string            `json:"webhook_secret"`
+	Currency      *string            `json:"currency"`
+	SuccessURL    *string            `json:"success_url"`
+	PaidMessage   *string            `json:"paid_message"`
+}
+
+// paymentSettings reads the payment settings from organization settings
+func paymentSettings(settings models.JSONB) PaymentSettings {
+	var s PaymentSettings
+	raw, ok := settings["payments"].(map[string]interface{})
+	if !ok {
+		return s
+	}
+	provider, _ := raw["provider"].(string)
+	s.Provider = payments.Provider(provider)
+	s.KeyID, _ = raw["key_id"].(string)
+	s.SecretKey = models.SettingSecret(raw, "secret_key")
+	s.WebhookSecret = models.SettingSecret(raw, "webhook_secret")
+	s.Currency, _ = raw["currency"].(string)
+	s.SuccessURL, _ = raw["success_url"].(string)
+	s.PaidMessage, _ = raw["paid_message"].(string)
+	return s
+}
+
+// loadPaymentSettings loads an organization's payment settings
+func (a *App) loadPaymentSettings(orgID uuid.UUID) (PaymentSettings, error) {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return PaymentSettings{}, err
+	}
+	return paymentSettings(org.Settings), nil
+}
+
+// paymentSettingsResponse is the settings as returned by the API. The secret key and
+// webhook secret are never returned, only whether they're set.
+func (a *App) paymentSettingsResponse(r *fastglue.Request, orgID uuid.UUID, s PaymentSettings) map[string]interface{} {
+	return map[string]interface{}{
+		"provider":           s.Provider,
+		"key_id":             s.KeyID,
+		"secret_key_set":     s.SecretKey != "",
+		"webhook_secret_set": s.WebhookSecret != "",
+		"currency":           s.Currency,
+		"success_url":        s.SuccessURL,
+		"paid_message":       s.PaidMessage,
+		"webhook_url":        fmt.Sprintf("%s/api/integrations/payments/%s/webhook", a.publicBaseURL(r), orgID),
+	}
+}
+
+// validatePaymentSettings checks that settings with a provider can create links and
+// verify the provider's webhooks
+func validatePaymentSettings(s PaymentSettings) string {
+	if s.Currency != "" && len(s.Currency) != 3 {
+		return "currency must be a 3 letter ISO 4217 code"
+	}
+	if s.SuccessURL != "" {
+		if u, err := url.Parse(s.SuccessURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return "success_url must be an http or https URL"
+		}
+	}
+	switch s.Provider {
+	case "":
+		return ""
+	case payments.ProviderStripe:
+		if s.SuccessURL == "" {
+			return "success_url is required for Stripe"
+		}
+	case payments.ProviderRazorpay:
+		if s.KeyID == "" {
+			return "key_id is required for Razorpay"
+		}
+	default:
+		return "provider must be stripe or razorpay"
+	}
+	if s.SecretKey == "" || s.WebhookSecret == "" {
+		return "secret_key and webhook_secret are required"
+	}
+	if s.Currency == "" {
+		return "currency is required"
+	}
+	return ""
+}
+
+// GetPaymentSettings returns the organization's payment settings
+func (a *App) GetPaymentSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	s, err := a.loadPaymentSettings(orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	return r.SendEnvelope(a.paymentSettingsResponse(r, orgID, s))
+}
+
+// UpdatePaymentSettings updates the organization's payment settings
+func (a *App) UpdatePaymentSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req PaymentSettingsRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	before := orgSettingsAuditSnapshot(&org)
+	s := paymentSettings(org.Settings)
+
+	if req.Provider != nil {
+		s.Provider = *req.Provider
+	}
+	if req.KeyID != nil {
+		s.KeyID = strings.TrimSpace(*req.KeyID)
+	}
+	if req.SecretKey != nil {
+		key := strings.TrimSpace(*req.SecretKey)
+		if err := a.checkCredential(r.RequestCtx, orgID, key); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "secret_key: "+err.Error(), nil, "")
+		}
+		s.SecretKey = key
+	}
+	if req.WebhookSecret != nil {
+		s.WebhookSecret = strings.TrimSpace(*req.WebhookSecret)
+	}
+	if req.Currency != nil {
+		s.Currency = strings.ToUpper(strings.TrimSpace(*req.Currency))
+	}
+	if req.SuccessURL != nil {
+		s.SuccessURL = strings.TrimSpace(*req.SuccessURL)
+	}
+	if req.PaidMessage != nil {
+		s.PaidMessage = *req.PaidMessage
+	}
+	if msg := validatePaymentSettings(s); msg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, msg, nil, "")
+	}
+
+	if org.Settings == nil {
+		org.Settings = models.JSONB{}
+	}
+	section := map[string]interface{}{
+		"provider":       string(s.Provider),
+		"key_id":         s.KeyID,
+		"secret_key":     s.SecretKey,
+		"webhook_secret": s.WebhookSecret,
+		"currency":       s.Currency,
+		"success_url":    s.SuccessURL,
+		"paid_message":   s.PaidMessage,
+	}
+	if err := models.EncryptSettingSecrets("payments", section); err != nil {
+		a.Log.Error("Failed to encrypt payment credentials", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	org.Settings["payments"] = section
+	if err := a.DB.Save(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	a.recordOrgSettingsAudit(r, &org, before)
+
+	return r.SendEnvelope(a.paymentSettingsResponse(r, orgID, s))
+}
+
+// paymentsClient returns the client for calls to payment providers
+func (a *App) paymentsClient() *payments.Client {
+	if a.Payments != nil {
+		return a.Payments
+	}
+	client := payments.New(a.Log)
+	client.HTTPClient = a.httpClient(config.OutboundPayments, payments.DefaultTimeout)
+	return client
+}
+
+// createPaymentLink creates a link at the organization's payment provider for the
+// contact to pay the link's amount, and stores it
+func (a *App) createPaymentLink(ctx context.Context, link *models.PaymentLink, contact *models.Contact) error {
+	s, err := a.loadPaymentSettings(link.OrganizationID)
+	if err != nil {
+		return err
+	}
+	if s.Provider == "" {
+		return errPaymentsNotConfigured
+	}
+	if link.Currency == "" {
+		link.Currency = s.Currency
+	}
+	link.Currency = strings.ToUpper(link.Currency)
+	if link.Description == "" {
+		return errors.New("description is required")
+	}
+	secretKey, err := a.resolveCredential(ctx, link.OrganizationID, s.SecretKey)
+	if err != nil {
+		return err
+	}
+
+	link.ID = uuid.New()
+	link.ContactID = contact.ID
+	link.Provider = string(s.Provider)
+	link.Status = models.PaymentLinkStatusCreated
+	if link.PaidMessage == "" {
+		link.PaidMessage = s.PaidMessage
+	}
+
+	var phone string
+	if isPhoneNumber(contact.PhoneNumber) {
+		phone = smsPhoneNumber(contact.PhoneNumber)
+	}
+	created, err := a.paymentsClient().CreateLink(ctx, s.Provider, payments.Credentials{KeyID: s.KeyID, SecretKey: secretKey}, payments.LinkRequest{
+		Amount:      link.Amount,
+		Currency:    link.Currency,
+		Description: link.Description,
+		ReferenceID: link.ID.String(),
+		Phone:       phone,
+		SuccessURL:  s.SuccessURL,
+	})
+	if err != nil {
+		return err
+	}
+	link.ExternalID = created.ID
+	link.URL = created.URL
+
+	if err := a.DB.Create(link).Error; err != nil {
+		return fmt.Errorf("failed to save payment link: %w", err)
+	}
+	a.Log.Info("Payment link created", "payment_link_id", link.ID, "provider", link.Provider, "source", link.Source, "contact_id", contact.ID)
+	return nil
+}
+
+// isPhoneNumber reports whether a contact's phone number is a phone number, and not
+// the ID of a user on another channel
+func isPhoneNumber(phone string) bool {
+	phone = strings.TrimPrefix(phone, "+")
+	if phone == "" {
+		return false
+	}
+	for _, r := range phone {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// paymentLinkVariables are the variables of a payment link available to messages
+func paymentLinkVariables(link *models.PaymentLink) map[string]interface{} {
+	return map[string]interface{}{
+		"payment_link":        link.URL,
+		"payment_link_id":     link.ID.String(),
+		"payment_status":      string(link.Status),
+		"payment_amount":      formatAmount(link.Amount, link.Currency),
+		"payment_description": link.Description,
+	}
+}
+
+// sendFlowPaymentLink creates the payment link of a flow step and sends it with the
+// step message, or sends the unavailable message when it can't be created. It
+// returns the message sent.
+func (a *App) sendFlowPaymentLink(ctx context.Context, account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, step *models.ChatbotFlowStep, stepMessage string) string {
+	cfg := step.InputConfig
+	link := &models.PaymentLink{
+		OrganizationID:  contact.OrganizationID,
+		SessionID:       &session.ID,
+		WhatsAppAccount: account.Name,
+		Source:          models.PaymentLinkSourceFlow,
+		Currency:        processTemplate(getStringFromMap(cfg, "currency"), session.SessionData),
+		Description:     processTemplate(getStringFromMap(cfg, "description"), session.SessionData),
+		PaidMessage:     getStringFromMap(cfg, "paid_message"),
+	}
+	amount, err := parsePrice(processTemplate(fmt.Sprint(cfg["amount"]), session.SessionData))
+	if err == nil {
+		link.Amount = amount
+		err = a.createPaymentLink(ctx, link, contact)
+	}
+
+	var message string
+	if err != nil {
+		a.log(ctx).Error("Failed to create payment link", "error", err, "step", step.StepName)
+		message = processTemplate(getStringFromMap(cfg, "unavailable_message"), session.SessionData)
+	} else {
+		if session.SessionData == nil {
+			session.SessionData = models.JSONB{}
+		}
+		for k, v := range paymentLinkVariables(link) {
+			session.SessionData[k] = v
+		}
+		a.DB.Model(session).Update("session_data", session.SessionData)
+
+		message = processTemplate(stepMessage, session.SessionData)
+		if !strings.Contains(message, link.URL) {
+			message = strings.TrimSpace(message + "\n\n" + link.URL)
+		}
+	}
+
+	if message != "" {
+		if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+			a.log(ctx).Error("Failed to send payment link message", "error", err, "contact", contact.PhoneNumber)
+		}
+	}
+	return message
+}
+
+// runPaymentLinkTool creates a payment link for the customer of a session when the
+// AI calls the built-in payment link tool
+func (a *App) runPaymentLinkTool(ctx context.Context, session *models.ChatbotSession, arguments json.RawMessage) (string, error) {
+	if session == nil {
+		return "", errors.New("payment links need a conversation with a customer")
+	}
+	var args struct {
+		Amount      json.Number `json:"amount"`
+		Currency    string      `json:"currency"`
+		Description string      `json:"description"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	amount, err := parsePrice(args.Amount.String())
+	if err != nil {
+		return "", err
+	}
+
+	var contact models.Contact
+	if err := a.DB.Where("id = ?", session.ContactID).First(&contact).Error; err != nil {
+		return "", errors.New("contact not found")
+	}
+	link := &models.PaymentLink{
+		OrganizationID:  session.OrganizationID,
+		SessionID:       &session.ID,
+		WhatsAppAccount: session.WhatsAppAccount,
+		Source:          models.PaymentLinkSourceAI,
+		Amount:          amount,
+		Currency:        args.Currency,
+		Description:     strings.TrimSpace(args.Description),
+	}
+	if err := a.createPaymentLink(ctx, link, &contact); err != nil {
+		return "", err
+	}
+
+	result, err := json.Marshal(map[string]string{
+		"url":    link.URL,
+		"amount": formatAmount(link.Amount, link.Currency),
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// PaymentWebhook receives payment link events from the organization's payment
+// provider
+func (a *App) PaymentWebhook(r *fastglue.Request) error {
+	orgIDStr, _ := r.RequestCtx.UserValue("org_id").(string)
+	orgID, err := uuid.Parse(orgIDStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Not found", nil, "")
+	}
+
+	s, err := a.loadPaymentSettings(orgID)
+	if err != nil || s.Provider == "" || s.WebhookSecret == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Not found", nil, "")
+	}
+
+	body := r.RequestCtx.PostBody()
+	var event *payments.Event
+	switch s.Provider {
+	case payments.ProviderStripe:
+		if !payments.VerifyStripeSignature(body, string(r.RequestCtx.Request.Header.Peek("Stripe-Signature")), s.WebhookSecret, time.Now()) {
+			return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Invalid signature", nil, "")
+		}
+		event, err = payments.ParseStripeEvent(body)
+	case payments.ProviderRazorpay:
+		if !payments.VerifyRazorpaySignature(body, string(r.RequestCtx.Request.Header.Peek("X-Razorpay-Signature")), s.WebhookSecret) {
+			return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Invalid signature", nil, "")
+		}
+		event, err = payments.ParseRazorpayEvent(body)
+	}
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid event", nil, "")
+	}
+	if event != nil {
+		a.processPaymentEvent(orgID, event)
+	}
+
+	return r.SendEnvelope(map[string]string{"status": "ok"})
+}
+
+// processPaymentEvent records a paid or expired payment link. Providers retry
+// webhooks, so each link is marked paid once.
+func (a *App) processPaymentEvent(orgID uuid.UUID, event *payments.Event) {
+	linkID, err := uuid.Parse(event.ReferenceID)
+	if err != nil {
+		a.Log.Debug("Ignoring payment event without a payment link", "org_id", orgID, "external_id", event.LinkID)
+		return
+	}
+	var link models.PaymentLink
+	if err := a.DB.Where("id = ? AND organization_id = ?", linkID, orgID).First(&link).Error; err != nil {
+		a.Log.Warn("Payment link of event not found", "org_id", orgID, "payment_link_id", linkID)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	switch event.Type {
+	case payments.EventPaid:
+		now := time.Now()
+		link.Status, link.PaymentID, link.PaidAt = models.PaymentLinkStatusPaid, event.PaymentID, &now
+		updates["status"], updates["payment_id"], updates["paid_at"] = link.Status, link.PaymentID, link.PaidAt
+	case payments.EventExpired:
+		link.Status = models.PaymentLinkStatusExpired
+		updates["status"] = link.Status
+	default:
+		return
+	}
+	result := a.DB.Model(&models.PaymentLink{}).
+		Where("id = ? AND status = ?", link.ID, models.PaymentLinkStatusCreated).
+		Updates(updates)
+	if result.Error != nil {
+		a.Log.Error("Failed to update payment link", "error", result.Error, "payment_link_id", link.ID)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	a.Log.Info("Payment link updated", "payment_link_id", link.ID, "status", link.Status)
+
+	vars := a.updatePaymentSession(&link)
+	if link.Status != models.PaymentLinkStatusPaid {
+		return
+	}
+
+	var contact models.Contact
+	if err := a.DB.Where("id = ?", link.ContactID).First(&contact).Error; err != nil {
+		return
+	}
+	a.DispatchWebhook(orgID, models.WebhookEventPaymentReceived, PaymentReceivedEventData{
+		PaymentLinkID:   link.ID.String(),
+		ContactID:       contact.ID.String(),
+		ContactPhone:    contact.PhoneNumber,
+		ContactName:     contact.ProfileName,
+		Provider:        link.Provider,
+		PaymentID:       link.PaymentID,
+		Amount:          link.Amount,
+		Currency:        link.Currency,
+		Description:     link.Description,
+		Source:          link.Source,
+		WhatsAppAccount: link.WhatsAppAccount,
+	})
+
+	if link.PaidMessage == "" {
+		return
+	}
+	account, err := a.resolveWhatsAppAccount(orgID, link.WhatsAppAccount)
+	if err != nil {
+		a.Log.Error("Failed to find account for paid message", "error", err, "payment_link_id", link.ID)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := a.sendAndSaveTextMessage(ctx, account, &contact, processTemplate(link.PaidMessage, vars)); err != nil {
+		a.Log.Error("Failed to send paid message", "error", err, "payment_link_id", link.ID)
+	}
+}
+
+// updatePaymentSession stores the payment link's status in the variables of the
+// chatbot session that created it, so later steps can check it. It returns the
+// session's variables with the link's.
+func (a *App) updatePaymentSession(link *models.PaymentLink) map[string]interface{} {
+	vars := map[string]interface{}{}
+	var session models.ChatbotSession
+	if link.SessionID != nil && a.DB.Where("id = ?", *link.SessionID).First(&session).Error == nil {
+		for k, v := range session.SessionData {
+			vars[k] = v
+		}
+	}
+	for k, v := range paymentLinkVariables(link) {
+		vars[k] = v
+	}
+	if link.PaymentID != "" {
+		vars["payment_id"] = link.PaymentID
+	}
+
+	if session.ID != uuid.Nil {
+		if err := a.DB.Model(&session).Update("session_data", models.JSONB(vars)).Error; err != nil {
+			a.Log.Error("Failed to update session of payment link", "error", err, "session_id", session.ID)
+		}
+	}
+	return vars
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/payments"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaymentSettings(t *testing.T) {
+	s := paymentSettings(models.JSONB{
+		"payments": map[string]interface{}{
+			"provider":       "razorpay",
+			"key_id":         "rzp_test",
+			"secret_key":     "secret",
+			"webhook_secret": "whsec",
+			"currency":       "INR",
+		},
+	})
+	assert.Equal(t, payments.ProviderRazorpay, s.Provider)
+	assert.Equal(t, "rzp_test", s.KeyID)
+	assert.Equal(t, "INR", s.Currency)
+
+	assert.Equal(t, PaymentSettings{}, paymentSettings(models.JSONB{}))
+}
+
+func TestValidatePaymentSettings(t *testing.T) {
+	valid := PaymentSettings{
+		Provider:      payments.ProviderStripe,
+		SecretKey:     "sk_test",
+		WebhookSecret: "whsec",
+		Currency:      "USD",
+		SuccessURL:    "https://shop.example.com/thanks",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(s *PaymentSettings)
+		want   string
+	}{
+		{name: "valid", modify: func(s *PaymentSettings) {}},
+		{name: "off", modify: func(s *PaymentSettings) { *s = PaymentSettings{} }},
+		{name: "razorpay", modify: func(s *PaymentSettings) {
+			s.Provider, s.KeyID, s.SuccessURL = payments.ProviderRazorpay, "rzp_test", ""
+		}},
+		{name: "razorpay without key ID", modify: func(s *PaymentSettings) { s.Provider = payments.ProviderRazorpay }, want: "key_id is required for Razorpay"},
+		{name: "stripe without success URL", modify: func(s *PaymentSettings) { s.SuccessURL = "" }, want: "success_url is required for Stripe"},
+		{name: "unknown provider", modify: func(s *PaymentSettings) { s.Provider = "paypal" }, want: "provider must be stripe or razorpay"},
+		{name: "no secrets", modify: func(s *PaymentSettings) { s.WebhookSecret = "" }, want: "secret_key and webhook_secret are required"},
+		{name: "no currency", modify: func(s *PaymentSettings) { s.Currency = "" }, want: "currency is required"},
+		{name: "bad currency", modify: func(s *PaymentSettings) { s.Currency = "DOLLAR" }, want: "currency must be a 3 letter ISO 4217 code"},
+		{name: "bad success URL", modify: func(s *PaymentSettings) { s.SuccessURL = "shop.example.com" }, want: "success_url must be an http or https URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			tt.modify(&s)
+			assert.Equal(t, tt.want, validatePaymentSettings(s))
+		})
+	}
+}
+
+func TestAvailableAITools_PaymentLinks(t *testing.T) {
+	settings := &models.ChatbotSettings{}
+	assert.Empty(t, availableAITools(settings))
+
+	settings.AI.PaymentLinks = true
+	tools := availableAITools(settings)
+	require.Len(t, tools, 1)
+	assert.Equal(t, paymentLinkToolName, tools[0].Name)
+	// Built-in tools aren't part of the configured tools
+	assert.Empty(t, aiTools(settings))
+
+	_, err := validateAITools([]AITool{{Name: paymentLinkToolName, Description: "Pay", URL: "https://example.com"}})
+	assert.EqualError(t, err, `tool name "create_payment_link" is reserved`)
+}
+
+func TestIsPhoneNumber(t *testing.T) {
+	assert.True(t, isPhoneNumber("15551234567"))
+	assert.True(t, isPhoneNumber("+15551234567"))
+	assert.False(t, isPhoneNumber("tg:12345"))
+	assert.False(t, isPhoneNumber(""))
+}
+
+func TestPaymentLinks_CreateAndPay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		assert.Equal(t, "4999", r.PostForm.Get("line_items[0][price_data][unit_amount]"))
+		_, _ = w.Write([]byte(`{"id":"cs_test_1","url":"https://checkout.stripe.com/c/pay/cs_test_1"}`))
+	}))
+	defer server.Close()
+
+	app := &App{
+		Config:   &config.Config{},
+		DB:       testutil.SetupTestDB(t),
+		Log:      testutil.NopLogger(),
+		Payments: payments.NewWithBaseURLs(testutil.NopLogger(), server.URL, ""),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Payments Org " + uuid.New().String()[:8],
+		Slug:      "payments-org-" + uuid.New().String()[:8],
+		Settings: models.JSONB{
+			"payments": map[string]interface{}{
+				"provider":       "stripe",
+				"secret_key":     "sk_test",
+				"webhook_secret": "whsec",
+				"currency":       "USD",
+				"success_url":    "https://shop.example.com/thanks",
+			},
+		},
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1555" + uuid.New().String()[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	session := &models.ChatbotSession{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: "primary",
+		PhoneNumber:     contact.PhoneNumber,
+		SessionData:     models.JSONB{"name": "Ana"},
+	}
+	require.NoError(t, app.DB.Create(session).Error)
+
+	result, err := app.runPaymentLinkTool(testutil.TestContext(t), session, json.RawMessage(`{"amount": 49.99, "description": "Order 1042"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"url":"https://checkout.stripe.com/c/pay/cs_test_1","amount":"USD 49.99"}`, result)
+
+	var link models.PaymentLink
+	require.NoError(t, app.DB.Where("session_id = ?", session.ID).First(&link).Error)
+	assert.Equal(t, models.PaymentLinkStatusCreated, link.Status)
+	assert.Equal(t, models.PaymentLinkSourceAI, link.Source)
+	assert.Equal(t, "cs_test_1", link.ExternalID)
+	assert.Equal(t, int64(4999), link.Amount)
+
+	app.processPaymentEvent(org.ID, &payments.Event{Type: payments.EventPaid, LinkID: "cs_test_1", ReferenceID: link.ID.String(), PaymentID: "pi_1"})
+
+	require.NoError(t, app.DB.First(&link, "id = ?", link.ID).Error)
+	assert.Equal(t, models.PaymentLinkStatusPaid, link.Status)
+	assert.Equal(t, "pi_1", link.PaymentID)
+	assert.NotNil(t, link.PaidAt)
+
+	var saved models.ChatbotSession
+	require.NoError(t, app.DB.First(&saved, "id = ?", session.ID).Error)
+	assert.Equal(t, "paid", saved.SessionData["payment_status"])
+	assert.Equal(t, "pi_1", saved.SessionData["payment_id"])
+	assert.Equal(t, "Ana", saved.SessionData["name"])
+
+	// Paid links don't expire, and retried events change nothing
+	app.processPaymentEvent(org.ID, &payments.Event{Type: payments.EventExpired, ReferenceID: link.ID.String()})
+	require.NoError(t, app.DB.First(&link, "id = ?", link.ID).Error)
+	assert.Equal(t, models.PaymentLinkStatusPaid, link.Status)
+}
+
+func TestPaymentSettings_Encrypted(t *testing.T) {
+	testutil.EnableEncryption(t)
+
+	section := map[string]interface{}{"secret_key": "sk_test_123", "webhook_secret": "whsec_123"}
+	require.NoError(t, models.EncryptSettingSecrets("payments", section))
+	assert.NotEqual(t, "sk_test_123", section["secret_key"])
+	assert.NotEqual(t, "whsec_123", section["webhook_secret"])
+	s := paymentSettings(models.JSONB{"payments": section})
+	assert.Equal(t, "sk_test_123", s.SecretKey)
+	assert.Equal(t, "whsec_123", s.WebhookSecret)
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"strings"
+
+	// Decoders for the image formats thumbnails are made from
+	_ "image/gif"
+	_ "image/png"
+)
+
+// A4 page layout, in PDF points
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 50
+)
+
+// pdfCell is text at a horizontal offset from the left margin
+type pdfCell struct {
+	X    float64
+	Text string
+}
+
+// pdfRow is a line of text cells, or an image. A row with neither adds vertical space.
+type pdfRow struct {
+	Cells []pdfCell
+	Size  float64
+	Bold  bool
+	Image *pdfImage
+}
+
+// pdfImage is a JPEG drawn at a horizontal offset from the left margin
+type pdfImage struct {
+	X      float64
+	Data   []byte // JPEG in RGB
+	Pixels image.Point
+	Width  float64 // Drawn size in points
+	Height float64
+}
+
+// renderPDF writes rows of text as a PDF document using the standard Helvetica fonts,
+// starting a new page when a page is full. A header, if given, is repeated at the
+// top of every page along with the page number.
+func renderPDF(rows []pdfRow, header string) []byte {
+	top := float64(pdfPageHeight - pdfMargin)
+	if header != "" {
+		top -= 20
+	}
+
+	type page struct {
+		content strings.Builder
+		images  []*pdfImage
+	}
+	pages := []*page{{}}
+	y := top
+	for _, row := range rows {
+		lead := row.Size * 1.5
+		if row.Image != nil {
+			lead = row.Image.Height + 6
+		}
+		if y-lead < pdfMargin {
+			pages = append(pages, &page{})
+			y = top
+		}
+		y -= lead
+		p := pages[len(pages)-1]
+
+		if row.Image != nil {
+			p.images = append(p.images, row.Image)
+			fmt.Fprintf(&p.content, "q %.1f 0 0 %.1f %.1f %.1f cm /Im%d Do Q\n",
+				row.Image.Width, row.Image.Height, pdfMargin+row.Image.X, y+3, len(p.images))
+			continue
+		}
+
+		font := "F1"
+		if row.Bold {
+			font = "F2"
+		}
+		for _, cell := range row.Cells {
+			fmt.Fprintf(&p.content, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n",
+				font, row.Size, pdfMargin+cell.X, y, pdfEscape(cell.Text))
+		}
+	}
+
+	if header != "" {
+		for i, p := range pages {
+			fmt.Fprintf(&p.content, "0.4 g BT /F2 9 Tf %d %d Td (%s) Tj ET\n",
+				pdfMargin, pdfPageHeight-pdfMargin, pdfEscape(header))
+			fmt.Fprintf(&p.content, "BT /F1 9 Tf %d %d Td (Page %d of %d) Tj ET\n",
+				pdfPageWidth-pdfMargin-60, pdfMargin/2, i+1, len(pages))
+		}
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3-4 fonts, then per page its images, the page
+	// and its content stream
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // Page tree, filled in once page object numbers are known
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+	}
+	kids := make([]string, 0, len(pages))
+	for _, p := range pages {
+		xobjects := make([]string, len(p.images))
+		for i, img := range p.images {
+			objects = append(objects, fmt.Sprintf(
+				"<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>\nstream\n%s\nendstream",
+				img.Pixels.X, img.Pixels.Y, len(img.Data), img.Data))
+			xobjects[i] = fmt.Sprintf("/Im%d %d 0 R", i+1, len(objects))
+		}
+		resources := "/Font << /F1 3 0 R /F2 4 0 R >>"
+		if len(xobjects) > 0 {
+			resources += " /XObject << " + strings.Join(xobjects, " ") + " >>"
+		}
+
+		pageNum := len(objects) + 1
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageNum))
+		content := p.content.String()
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << %s >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, resources, pageNum+1),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+// pdfEscape escapes text for a PDF string literal. The standard fonts only cover
+// Latin characters, so others are replaced.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// wrapPDFText splits text into lines that fit a width at a font size. Helvetica
+// averages about half an em per character, which is close enough for chat text.
+func wrapPDFText(text string, size, width float64) []string {
+	maxChars := int(width / (size * 0.5))
+	if maxChars < 1 {
+		maxChars = 1
+	}
+
+	var lines []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for len([]rune(word)) > maxChars {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:maxChars]))
+				word = string(runes[maxChars:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) <= maxChars:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// pdfThumbnail scales a JPEG, PNG or GIF down to fit maxSize points and re-encodes
+// it as an RGB JPEG, so large photos don't bloat the document
+func pdfThumbnail(data []byte, maxSize float64) (*pdfImage, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+
+	// Keep twice the drawn size in pixels so thumbnails stay sharp when printed
+	scale := min(1, 2*maxSize/float64(max(bounds.Dx(), bounds.Dy())))
+	w := max(1, int(float64(bounds.Dx())*scale))
+	h := max(1, int(float64(bounds.Dy())*scale))
+	thumb := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			thumb.Set(x, y, src.At(bounds.Min.X+x*bounds.Dx()/w, bounds.Min.Y+y*bounds.Dy()/h))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+
+	ratio := min(0.5, maxSize/float64(max(w, h)))
+	return &pdfImage{
+		Data:   buf.Bytes(),
+		Pixels: image.Pt(w, h),
+		Width:  float64(w) * ratio,
+		Height: float64(h) * ratio,
+	}, nil
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// PendingKind identifies what queued a pending outbound message
+type PendingKind string
+
+const (
+	PendingKindScheduledMessage    PendingKind = "scheduled_message"
+	PendingKindFollowUp            PendingKind = "follow_up"
+	PendingKindAppointmentReminder PendingKind = "appointment_reminder"
+)
+
+// PendingMessage is an outbound message queued for a conversation, whatever queued it
+type PendingMessage struct {
+	ID                 uuid.UUID   `json:"id"`
+	Kind               PendingKind `json:"kind"`
+	SendAt             time.Time   `json:"send_at"`
+	Content            string      `json:"content,omitempty"`       // Free-form text, for scheduled messages
+	TemplateName       string      `json:"template_name,omitempty"` // Template sent, or the fallback for scheduled messages
+	WillSendAsTemplate bool        `json:"will_send_as_template"`
+	Source             string      `json:"source"`                // agent, flow or api
+	Description        string      `json:"description,omitempty"` // Follow-up note or appointment title
+	CreatedByID        *uuid.UUID  `json:"created_by_id,omitempty"`
+	ContentEditable    bool        `json:"content_editable"`
+}
+
+// UpdatePendingMessageRequest reschedules a pending message or, for scheduled
+// messages, changes its text
+type UpdatePendingMessageRequest struct {
+	SendAt  *time.Time `json:"send_at"`
+	Content *string    `json:"content"`
+}
+
+// ListPendingMessages returns the outbound messages queued for a conversation:
+// scheduled messages, follow-up nudges and appointment reminders, soonest first
+func (a *App) ListPendingMessages(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	pending, err := a.pendingMessages(orgID, contact)
+	if err != nil {
+		a.Log.Error("Failed to list pending messages", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list pending messages", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"pending": pending,
+	})
+}
+
+// UpdatePendingMessage reschedules a pending message, or edits a scheduled
+// message's text
+func (a *App) UpdatePendingMessage(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+	kind := PendingKind(r.RequestCtx.UserValue("kind").(string))
+	itemID, err := uuid.Parse(r.RequestCtx.UserValue("item_id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid pending message ID", nil, "")
+	}
+
+	var req UpdatePendingMessageRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if req.SendAt == nil && req.Content == nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "send_at or content is required", nil, "")
+	}
+	if req.SendAt != nil && !req.SendAt.After(time.Now()) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "send_at must be in the future", nil, "")
+	}
+	if req.Content != nil && kind != PendingKindScheduledMessage {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Only the content of scheduled messages can be edited", nil, "")
+	}
+
+	switch kind {
+	case PendingKindScheduledMessage:
+		var sm models.ScheduledMessage
+		if err := a.DB.Where("id = ? AND organization_id = ? AND contact_id = ?", itemID, orgID, contact.ID).
+			First(&sm).Error; err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Scheduled message not found", nil, "")
+		}
+		if errMsg, status := a.updateScheduledMessage(&sm, contact, req.SendAt, req.Content, ""); errMsg != "" {
+			return r.SendErrorEnvelope(status, errMsg, nil, "")
+		}
+
+	case PendingKindFollowUp:
+		result := a.DB.Model(&models.FollowUp{}).
+			Where("id = ? AND organization_id = ? AND contact_id = ? AND status = ?", itemID, orgID, contact.ID, models.FollowUpStatusPending).
+			Update("due_at", *req.SendAt)
+		if result.Error != nil {
+			a.Log.Error("Failed to update follow-up", "error", result.Error)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update follow-up", nil, "")
+		}
+		if result.RowsAffected == 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Pending follow-up not found", nil, "")
+		}
+
+	case PendingKindAppointmentReminder:
+		reminder, appointment, err := a.pendingReminder(orgID, contact.ID, itemID)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Pending appointment reminder not found", nil, "")
+		}
+		if !req.SendAt.Before(appointment.StartsAt) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "send_at must be before the appointment starts", nil, "")
+		}
+		result := a.DB.Model(reminder).Where("status = ?", models.AppointmentReminderStatusPending).Update("send_at", *req.SendAt)
+		if result.Error != nil {
+			a.Log.Error("Failed to update appointment reminder", "error", result.Error)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update appointment reminder", nil, "")
+		}
+		if result.RowsAffected == 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Appointment reminder has already been sent or cancelled", nil, "")
+		}
+
+	default:
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid pending message kind", nil, "")
+	}
+
+	pending, err := a.pendingMessages(orgID, contact)
+	if err != nil {
+		a.Log.Error("Failed to list pending messages", "error", err, "contact_id", contact.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list pending messages", nil, "")
+	}
+	for _, p := range pending {
+		if p.Kind == kind && p.ID == itemID {
+			return r.SendEnvelope(p)
+		}
+	}
+	return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Pending message not found", nil, "")
+}
+
+// CancelPendingMessage cancels a pending message before it is sent
+func (a *App) CancelPendingMessage(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+	kind := PendingKind(r.RequestCtx.UserValue("kind").(string))
+	itemID, err := uuid.Parse(r.RequestCtx.UserValue("item_id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid pending message ID", nil, "")
+	}
+
+	// Each cancel only applies if the processor has not picked the message up in the meantime
+	var cancelled int64
+	switch kind {
+	case PendingKindScheduledMessage:
+		result := a.DB.Model(&models.ScheduledMessage{}).
+			Where("id = ? AND organization_id = ? AND contact_id = ? AND status = ?", itemID, orgID, contact.ID, models.ScheduledMessageStatusScheduled).
+			Update("status", models.ScheduledMessageStatusCancelled)
+		err, cancelled = result.Error, result.RowsAffected
+
+	case PendingKindFollowUp:
+		result := a.DB.Model(&models.FollowUp{}).
+			Where("id = ? AND organization_id = ? AND contact_id = ? AND status = ?", itemID, orgID, contact.ID, models.FollowUpStatusPending).
+			Update("status", models.FollowUpStatusCancelled)
+		err, cancelled = result.Error, result.RowsAffected
+
+	case PendingKindAppointmentReminder:
+		reminder, _, findErr := a.pendingReminder(orgID, contact.ID, itemID)
+		if findErr != nil {
+			break
+		}
+		result := a.DB.Model(reminder).
+			Where("status = ?", models.AppointmentReminderStatusPending).
+			Update("status", models.AppointmentReminderStatusCancelled)
+		err, cancelled = result.Error, result.RowsAffected
+
+	default:
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid pending message kind", nil, "")
+	}
+
+	if err != nil {
+		a.Log.Error("Failed to cancel pending message", "error", err, "kind", kind, "id", itemID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to cancel pending message", nil, "")
+	}
+	if cancelled == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Pending message not found, or already sent or cancelled", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Pending message cancelled",
+	})
+}
+
+// pendingReminder loads a pending reminder for one of the contact's appointments
+func (a *App) pendingReminder(orgID, contactID, reminderID uuid.UUID) (*models.AppointmentReminder, *models.Appointment, error) {
+	var reminder models.AppointmentReminder
+	if err := a.DB.Where("id = ? AND status = ?", reminderID, models.AppointmentReminderStatusPending).
+		First(&reminder).Error; err != nil {
+		return nil, nil, err
+	}
+	var appointment models.Appointment
+	if err := a.DB.Where("id = ? AND organization_id = ? AND contact_id = ?", reminder.AppointmentID, orgID, contactID).
+		First(&appointment).Error; err != nil {
+		return nil, nil, err
+	}
+	return &reminder, &appointment, nil
+}
+
+// pendingMessages collects the messages queued for a contact
+func (a *App) pendingMessages(orgID uuid.UUID, contact *models.Contact) ([]PendingMessage, error) {
+	var scheduled []models.ScheduledMessage
+	if err := a.DB.Where("organization_id = ? AND contact_id = ? AND status = ?", orgID, contact.ID, models.ScheduledMessageStatusScheduled).
+		Preload("Template").Preload("FallbackTemplate").Find(&scheduled).Error; err != nil {
+		return nil, err
+	}
+
+	// Reopen follow-ups send nothing, only nudges are outbound messages
+	var followUps []models.FollowUp
+	if err := a.DB.Where("organization_id = ? AND contact_id = ? AND status = ? AND action = ?",
+		orgID, contact.ID, models.FollowUpStatusPending, models.FollowUpActionTemplate).
+		Preload("Template").Find(&followUps).Error; err != nil {
+		return nil, err
+	}
+
+	var appointments []models.Appointment
+	if err := a.DB.Where("organization_id = ? AND contact_id = ?", orgID, contact.ID).
+		Preload("ReminderTemplate").
+		Preload("Reminders", "status = ?", models.AppointmentReminderStatusPending).
+		Find(&appointments).Error; err != nil {
+		return nil, err
+	}
+
+	return buildPendingMessages(scheduled, followUps, appointments, a.serviceWindowExpiresAt(contact)), nil
+}
+
+// buildPendingMessages merges queued messages into one list, soonest first
+func buildPendingMessages(scheduled []models.ScheduledMessage, followUps []models.FollowUp, appointments []models.Appointment, windowExpiresAt *time.Time) []PendingMessage {
+	pending := []PendingMessage{}
+
+	for _, sm := range scheduled {
+		createdBy := sm.CreatedByID
+		p := PendingMessage{
+			ID:                 sm.ID,
+			Kind:               PendingKindScheduledMessage,
+			SendAt:             sm.SendAt,
+			Content:            sm.Content,
+			WillSendAsTemplate: !isServiceWindowOpen(windowExpiresAt, sm.SendAt),
+			Source:             string(models.FollowUpSourceAgent),
+			CreatedByID:        &createdBy,
+			ContentEditable:    true,
+		}
+		if sm.FallbackTemplate != nil {
+			p.TemplateName = sm.FallbackTemplate.Name
+		}
+		// Template messages are sent as they are, whatever the window
+		if sm.MessageType == models.MessageTypeTemplate {
+			p.WillSendAsTemplate = true
+			p.ContentEditable = false
+			if sm.Template != nil {
+				p.TemplateName = sm.Template.Name
+			}
+		}
+		pending = append(pending, p)
+	}
+
+	for _, fu := range followUps {
+		p := PendingMessage{
+			ID:                 fu.ID,
+			Kind:               PendingKindFollowUp,
+			SendAt:             fu.DueAt,
+			WillSendAsTemplate: true,
+			Source:             string(fu.Source),
+			Description:        fu.Note,
+			CreatedByID:        fu.CreatedByID,
+		}
+		if fu.Template != nil {
+			p.TemplateName = fu.Template.Name
+		}
+		pending = append(pending, p)
+	}
+
+	for _, appt := range appointments {
+		for _, reminder := range appt.Reminders {
+			if reminder.Status != models.AppointmentReminderStatusPending {
+				continue
+			}
+			p := PendingMessage{
+				ID:                 reminder.ID,
+				Kind:               PendingKindAppointmentReminder,
+				SendAt:             reminder.SendAt,
+				WillSendAsTemplate: true,
+				Source:             string(appt.Source),
+				Description:        appt.Title,
+				CreatedByID:        appt.CreatedByID,
+			}
+			if appt.ReminderTemplate != nil {
+				p.TemplateName = appt.ReminderTemplate.Name
+			}
+			pending = append(pending, p)
+		}
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].SendAt.Before(pending[j].SendAt) })
+	return pending
+}
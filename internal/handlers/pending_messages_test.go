@@ -0,0 +1,165 @@
+package handlers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_ListPendingMessages(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	scheduled := &models.ScheduledMessage{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		Content:         "Later",
+		SendAt:          time.Now().Add(2 * time.Hour),
+		Status:          models.ScheduledMessageStatusScheduled,
+		CreatedByID:     user.ID,
+	}
+	require.NoError(t, app.DB.Create(scheduled).Error)
+
+	nudge := &models.FollowUp{
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		DueAt:           time.Now().Add(time.Hour),
+		Action:          models.FollowUpActionTemplate,
+		TemplateID:      &template.ID,
+		Source:          models.FollowUpSourceFlow,
+		Status:          models.FollowUpStatusPending,
+	}
+	require.NoError(t, app.DB.Create(nudge).Error)
+
+	// Reopen follow-ups send nothing, so they aren't listed
+	reopen := &models.FollowUp{
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		DueAt:           time.Now().Add(time.Hour),
+		Action:          models.FollowUpActionReopen,
+		Source:          models.FollowUpSourceAgent,
+		Status:          models.FollowUpStatusPending,
+		CreatedByID:     &user.ID,
+	}
+	require.NoError(t, app.DB.Create(reopen).Error)
+
+	req := testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.ListPendingMessages(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp struct {
+		Pending []handlers.PendingMessage `json:"pending"`
+	}
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	require.Len(t, resp.Pending, 2)
+	assert.Equal(t, handlers.PendingKindFollowUp, resp.Pending[0].Kind)
+	assert.Equal(t, nudge.ID, resp.Pending[0].ID)
+	assert.Equal(t, template.Name, resp.Pending[0].TemplateName)
+	assert.Equal(t, "flow", resp.Pending[0].Source)
+	assert.Equal(t, handlers.PendingKindScheduledMessage, resp.Pending[1].Kind)
+	assert.Equal(t, "Later", resp.Pending[1].Content)
+	assert.True(t, resp.Pending[1].ContentEditable)
+}
+
+func TestApp_UpdatePendingMessage_ScheduledMessage(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	scheduled := &models.ScheduledMessage{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		Content:         "Later",
+		SendAt:          time.Now().Add(time.Hour),
+		Status:          models.ScheduledMessageStatusScheduled,
+		CreatedByID:     user.ID,
+	}
+	require.NoError(t, app.DB.Create(scheduled).Error)
+
+	// Moving it past the service window without a fallback template is rejected
+	req := testutil.NewJSONRequest(t, map[string]any{"send_at": time.Now().Add(48 * time.Hour)})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	testutil.SetPathParam(req, "kind", string(handlers.PendingKindScheduledMessage))
+	testutil.SetPathParam(req, "item_id", scheduled.ID.String())
+
+	require.NoError(t, app.UpdatePendingMessage(req))
+	assert.Equal(t, fasthttp.StatusBadRequest, testutil.GetResponseStatusCode(req))
+
+	req = testutil.NewJSONRequest(t, map[string]any{"content": "Your order has shipped"})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	testutil.SetPathParam(req, "kind", string(handlers.PendingKindScheduledMessage))
+	testutil.SetPathParam(req, "item_id", scheduled.ID.String())
+
+	require.NoError(t, app.UpdatePendingMessage(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var updated models.ScheduledMessage
+	require.NoError(t, app.DB.Where("id = ?", scheduled.ID).First(&updated).Error)
+	assert.Equal(t, "Your order has shipped", updated.Content)
+}
+
+func TestApp_CancelPendingMessage_FollowUp(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	nudge := &models.FollowUp{
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		DueAt:           time.Now().Add(time.Hour),
+		Action:          models.FollowUpActionTemplate,
+		TemplateID:      &template.ID,
+		Source:          models.FollowUpSourceAgent,
+		Status:          models.FollowUpStatusPending,
+		CreatedByID:     &user.ID,
+	}
+	require.NoError(t, app.DB.Create(nudge).Error)
+
+	req := testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	testutil.SetPathParam(req, "kind", string(handlers.PendingKindFollowUp))
+	testutil.SetPathParam(req, "item_id", nudge.ID.String())
+
+	require.NoError(t, app.CancelPendingMessage(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var updated models.FollowUp
+	require.NoError(t, app.DB.Where("id = ?", nudge.ID).First(&updated).Error)
+	assert.Equal(t, models.FollowUpStatusCancelled, updated.Status)
+
+	// Cancelling twice finds nothing pending
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	testutil.SetPathParam(req, "kind", string(handlers.PendingKindFollowUp))
+	testutil.SetPathParam(req, "item_id", nudge.ID.String())
+
+	require.NoError(t, app.CancelPendingMessage(req))
+	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
+}
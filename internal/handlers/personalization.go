@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// contactTemplateVars returns the attributes of a contact that messages can look up
+// as {{contact.first_name}}, {{contact.language}} or {{contact.<custom field>}}
+func contactTemplateVars(contact *models.Contact) map[string]interface{} {
+	vars := make(map[string]interface{}, len(contact.Metadata)+8)
+	for k, v := range contact.Metadata {
+		vars[k] = v
+	}
+
+	first, last, _ := strings.Cut(strings.TrimSpace(contact.ProfileName), " ")
+	vars["name"] = contact.ProfileName
+	vars["first_name"] = first
+	vars["last_name"] = strings.TrimSpace(last)
+	vars["phone_number"] = contact.PhoneNumber
+	vars["language"] = contact.Language
+	vars["timezone"] = contact.Timezone
+	tags := make([]interface{}, len(contact.Tags))
+	copy(tags, contact.Tags)
+	vars["tags"] = tags
+	return vars
+}
+
+// personalizationData returns a copy of data to render a message for a contact with.
+// It adds the contact's attributes under "contact", the current time in the contact's
+// timezone as "now", and first_name, contact_name, phone_number and custom fields at
+// the top level unless data already has values for them.
+func (a *App) personalizationData(contact *models.Contact, data map[string]interface{}) map[string]interface{} {
+	result := copyMap(data)
+	if contact == nil {
+		return result
+	}
+
+	vars := contactTemplateVars(contact)
+	contactName := contact.ProfileName
+	if contactName == "" {
+		contactName = contact.PhoneNumber
+	}
+	defaults := make(map[string]interface{}, len(contact.Metadata)+5)
+	for k, v := range contact.Metadata {
+		defaults[k] = v
+	}
+	defaults["contact"] = vars
+	defaults["first_name"] = vars["first_name"]
+	defaults["contact_name"] = contactName
+	defaults["phone_number"] = contact.PhoneNumber
+	defaults["now"] = time.Now().In(a.contactLocation(contact))
+	for k, v := range defaults {
+		if _, ok := result[k]; !ok {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// personalizeTemplateParams renders the template parameter values that use
+// expressions, such as {{first_name | "there"}}, for a contact
+func (a *App) personalizeTemplateParams(contact *models.Contact, params map[string]string) map[string]string {
+	if len(params) == 0 {
+		return params
+	}
+	var data map[string]interface{}
+	result := make(map[string]string, len(params))
+	for k, v := range params {
+		if strings.Contains(v, "{{") {
+			if data == nil {
+				data = a.personalizationData(contact, nil)
+			}
+			v = processTemplate(v, data)
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// hasTemplateExpressions reports whether any string value of params uses expressions
+func hasTemplateExpressions(params map[string]interface{}) bool {
+	for _, v := range params {
+		if s, ok := v.(string); ok && strings.Contains(s, "{{") {
+			return true
+		}
+	}
+	return false
+}
+
+// personalizeRecipientParams renders the string values of campaign recipient
+// parameters that use expressions for a contact
+func (a *App) personalizeRecipientParams(contact *models.Contact, params map[string]interface{}) models.JSONB {
+	data := a.personalizationData(contact, nil)
+	result := make(models.JSONB, len(params))
+	for k, v := range params {
+		if s, ok := v.(string); ok && strings.Contains(s, "{{") {
+			v = processTemplate(s, data)
+		}
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessTemplate_Filters(t *testing.T) {
+	data := map[string]interface{}{
+		"first_name": "maria",
+		"empty":      "",
+		"order": map[string]interface{}{
+			"date":    "2024-03-05T14:30:00Z",
+			"created": float64(1709649000),
+		},
+		"when": time.Date(2024, 3, 5, 9, 5, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{name: "plain", template: "Hi {{first_name}}", want: "Hi maria"},
+		{name: "spaces", template: "Hi {{ first_name }}", want: "Hi maria"},
+		{name: "fallback unused", template: `Hi {{first_name | "there"}}`, want: "Hi maria"},
+		{name: "fallback missing", template: `Hi {{last_name | "there"}}`, want: "Hi there"},
+		{name: "fallback empty", template: `Hi {{empty | 'there'}}`, want: "Hi there"},
+		{name: "default filter", template: `Hi {{last_name | default:"friend"}}`, want: "Hi friend"},
+		{name: "title", template: "Hi {{first_name | title}}", want: "Hi Maria"},
+		{name: "upper", template: "{{first_name | upper}}", want: "MARIA"},
+		{name: "chained", template: `{{last_name | "sam" | upper}}`, want: "SAM"},
+		{name: "pipe in fallback", template: `{{last_name | "a | b"}}`, want: "a | b"},
+		{name: "date", template: `{{order.date | date:"DD MMM YYYY"}}`, want: "05 Mar 2024"},
+		{name: "date long", template: `{{order.date | date:"dddd, MMMM DD at HH:mm"}}`, want: "Tuesday, March 05 at 14:30"},
+		{name: "date unix", template: `{{order.created | date:"YYYY-MM-DD"}}`, want: "2024-03-05"},
+		{name: "date time value", template: `{{when | date:"hh:mm"}}`, want: "09:05"},
+		{name: "date default format", template: "{{when | date}}", want: "2024-03-05"},
+		{name: "date not a date", template: `{{first_name | date:"YYYY"}}`, want: "maria"},
+		{name: "unknown filter", template: "{{first_name | shout}}", want: "maria"},
+		{name: "conditional", template: `{{if last_name}}Hi {{last_name}}{{else}}Hi {{first_name | title}}{{endif}}`, want: "Hi Maria"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, processTemplate(tt.template, data))
+		})
+	}
+}
+
+func TestProcessTemplateKeepMissing(t *testing.T) {
+	data := map[string]interface{}{"contact_name": "Maria"}
+	got := processTemplateKeepMissing(`Hi {{contact_name}}, your code is {{code}}. {{city | "See you soon"}}`, data)
+	assert.Equal(t, "Hi Maria, your code is {{code}}. See you soon", got)
+}
+
+func TestPersonalizationData(t *testing.T) {
+	app := &App{Log: testutil.NopLogger()}
+	contact := &models.Contact{
+		PhoneNumber: "919876543210",
+		ProfileName: "Maria Lopez",
+		Timezone:    "Asia/Kolkata",
+		Language:    "es",
+		Tags:        models.JSONBArray{"vip"},
+		Metadata:    models.JSONB{"city": "Pune", "plan": "gold"},
+	}
+
+	session := map[string]interface{}{"city": "Mumbai"}
+	data := app.personalizationData(contact, session)
+
+	// Session values win over the contact's attributes
+	assert.Equal(t, "Mumbai", data["city"])
+	assert.Equal(t, "gold", data["plan"])
+	assert.Equal(t, "Maria", data["first_name"])
+	assert.Equal(t, "Maria Lopez", data["contact_name"])
+	assert.Equal(t, "919876543210", data["phone_number"])
+
+	assert.Equal(t, "Hola Maria de Pune (es)", processTemplate(
+		"{{if contact.language == 'es'}}Hola{{else}}Hi{{endif}} {{contact.first_name}} de {{contact.city}} ({{contact.language}})", data))
+	assert.Equal(t, "Lopez", processTemplate("{{contact.last_name}}", data))
+	assert.Equal(t, "yes", processTemplate("{{for tag in contact.tags}}{{if tag == 'vip'}}yes{{endif}}{{endfor}}", data))
+
+	now, ok := data["now"].(time.Time)
+	assert.True(t, ok)
+	assert.Equal(t, "Asia/Kolkata", now.Location().String())
+	assert.NotContains(t, session, "contact")
+
+	params := app.personalizeTemplateParams(contact, map[string]string{"1": `{{first_name | "there"}}`, "2": "ORD-1"})
+	assert.Equal(t, map[string]string{"1": "Maria", "2": "ORD-1"}, params)
+}
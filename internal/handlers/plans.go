@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// AvailablePlanFeatures returns the features that can be enabled per plan
+var AvailablePlanFeatures = []map[string]string{
+	{"value": string(models.PlanFeatureCampaigns), "label": "Campaigns", "description": "Bulk template campaigns"},
+	{"value": string(models.PlanFeatureMultipleAccounts), "label": "Multiple accounts", "description": "More than one WhatsApp account"},
+	{"value": string(models.PlanFeatureSSO), "label": "SSO", "description": "Single sign-on with OAuth providers"},
+	{"value": string(models.PlanFeatureAI), "label": "AI responses", "description": "Chatbot responses from AI providers"},
+	{"value": string(models.PlanFeatureWebhooks), "label": "Webhooks", "description": "Outgoing event webhooks"},
+	{"value": string(models.PlanFeatureAutomations), "label": "Automations", "description": "Event-driven automation rules"},
+	{"value": string(models.PlanFeatureAPIKeys), "label": "API keys", "description": "API access with API keys"},
+}
+
+// planNamePattern restricts plan names to identifiers usable in config and URLs
+var planNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// currencyPattern matches ISO 4217 currency codes
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// PlanRequest represents the request body for creating/updating a plan
+type PlanRequest struct {
+	Name        *string            `json:"name"`
+	DisplayName *string            `json:"display_name"`
+	Description *string            `json:"description"`
+	Features    []string           `json:"features"`
+	Limits      *models.PlanLimits `json:"limits"`
+	IsDefault   *bool              `json:"is_default"`
+
+	AllowOverage            *bool `json:"allow_overage"`
+	CampaignThrottlePercent *int  `json:"campaign_throttle_percent"`
+
+	Price               *int64  `json:"price"`
+	Currency            *string `json:"currency"`
+	MessageOveragePrice *int64  `json:"message_overage_price"`
+	AICallOveragePrice  *int64  `json:"ai_call_overage_price"`
+
+	WalletRates *models.WalletRates `json:"wallet_rates"`
+}
+
+// PlanResponse represents a plan in API responses
+type PlanResponse struct {
+	models.Plan
+	Organizations int64 `json:"organizations"` // Number of organizations assigned to the plan
+}
+
+// orgPlan returns the plan that applies to an organization, or nil when none does
+func (a *App) orgPlan(orgID uuid.UUID) *models.Plan {
+	plan, err := a.getOrgPlanCached(orgID)
+	if err != nil {
+		a.Log.Error("Failed to load organization plan", "error", err, "org_id", orgID)
+		return nil
+	}
+	return plan
+}
+
+// orgPlanLimits returns the usage limits of an organization. Without a plan usage is unlimited.
+func (a *App) orgPlanLimits(orgID uuid.UUID) models.PlanLimits {
+	if plan := a.orgPlan(orgID); plan != nil {
+		return plan.Limits
+	}
+	return models.PlanLimits{}
+}
+
+// planHasFeature reports whether a plan enables a feature. Without a plan every feature is enabled.
+func planHasFeature(plan *models.Plan, feature models.PlanFeature) bool {
+	if plan == nil {
+		return true
+	}
+	for _, f := range plan.Features {
+		if s, ok := f.(string); ok && s == string(feature) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFeature reports whether the organization's plan enables a feature
+func (a *App) HasFeature(orgID uuid.UUID, feature models.PlanFeature) bool {
+	return planHasFeature(a.orgPlan(orgID), feature)
+}
+
+// APIKeysEnabled reports whether the organization's plan lets its API keys authenticate
+func (a *App) APIKeysEnabled(orgID uuid.UUID) bool {
+	return a.HasFeature(orgID, models.PlanFeatureAPIKeys)
+}
+
+// orgFeatures returns the features enabled by a plan
+func orgFeatures(plan *models.Plan) []string {
+	features := make([]string, 0, len(AvailablePlanFeatures))
+	for _, f := range AvailablePlanFeatures {
+		if planHasFeature(plan, models.PlanFeature(f["value"])) {
+			features = append(features, f["value"])
+		}
+	}
+	return features
+}
+
+// featureUnavailableMessage returns the error shown when a feature is not enabled by the plan
+func featureUnavailableMessage(feature models.PlanFeature) string {
+	label := string(feature)
+	for _, f := range AvailablePlanFeatures {
+		if f["value"] == string(feature) {
+			label = f["label"]
+			break
+		}
+	}
+	return fmt.Sprintf("%s is not available on your plan", label)
+}
+
+// isPlanFeature reports whether s is a known plan feature
+func isPlanFeature(s string) bool {
+	for _, f := range AvailablePlanFeatures {
+		if f["value"] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePlanLimits checks that no limit is negative
+func validatePlanLimits(limits models.PlanLimits) error {
+	if limits.Messages < 0 || limits.CampaignRecipients < 0 || limits.AICalls < 0 || limits.StorageMB < 0 || limits.Agents < 0 {
+		return fmt.Errorf("limits cannot be negative")
+	}
+	return nil
+}
+
+// ListPlans returns all plans
+func (a *App) ListPlans(r *fastglue.Request) error {
+	var plans []models.Plan
+	if err := a.DB.Order("created_at ASC").Find(&plans).Error; err != nil {
+		a.Log.Error("Failed to list plans", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list plans", nil, "")
+	}
+
+	// Count organizations per plan, including those on the default plan
+	type planCount struct {
+		Plan  string
+		Count int64
+	}
+	var counts []planCount
+	a.DB.Model(&models.Organization{}).Select("plan, COUNT(*) AS count").Group("plan").Scan(&counts)
+	orgsByPlan := make(map[string]int64)
+	for _, c := range counts {
+		orgsByPlan[c.Plan] = c.Count
+	}
+
+	response := make([]PlanResponse, len(plans))
+	for i, plan := range plans {
+		response[i] = PlanResponse{Plan: plan, Organizations: orgsByPlan[plan.Name]}
+		if plan.IsDefault {
+			response[i].Organizations += orgsByPlan[""]
+		}
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"plans":              response,
+		"available_features": AvailablePlanFeatures,
+	})
+}
+
+// CreatePlan creates a plan (super admin only)
+func (a *App) CreatePlan(r *fastglue.Request) error {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.IsSuperAdmin(userID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only super admins can manage plans", nil, "")
+	}
+
+	var req PlanRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	if req.Name == nil || !planNamePattern.MatchString(*req.Name) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "name is required and may only contain lowercase letters, digits, - and _", nil, "")
+	}
+
+	var existing int64
+	a.DB.Model(&models.Plan{}).Where("name = ?", *req.Name).Count(&existing)
+	if existing > 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusConflict, "A plan with this name already exists", nil, "")
+	}
+
+	plan := models.Plan{
+		Name:     *req.Name,
+		Features: models.JSONBArray{},
+	}
+	if err := applyPlanRequest(&plan, &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	if err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if plan.IsDefault {
+			if err := tx.Model(&models.Plan{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(&plan).Error
+	}); err != nil {
+		a.Log.Error("Failed to create plan", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create plan", nil, "")
+	}
+
+	a.InvalidateAllOrgPlansCache()
+
+	return r.SendEnvelope(PlanResponse{Plan: plan})
+}
+
+// UpdatePlan updates a plan (super admin only). Renaming a plan moves its organizations with it.
+func (a *App) UpdatePlan(r *fastglue.Request) error {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.IsSuperAdmin(userID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only super admins can manage plans", nil, "")
+	}
+
+	plan, err := a.findPlan(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Plan not found", nil, "")
+	}
+
+	var req PlanRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	oldName := plan.Name
+	if req.Name != nil && *req.Name != plan.Name {
+		if !planNamePattern.MatchString(*req.Name) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "name may only contain lowercase letters, digits, - and _", nil, "")
+		}
+		var existing int64
+		a.DB.Model(&models.Plan{}).Where("name = ? AND id != ?", *req.Name, plan.ID).Count(&existing)
+		if existing > 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusConflict, "A plan with this name already exists", nil, "")
+		}
+		plan.Name = *req.Name
+	}
+	if err := applyPlanRequest(plan, &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	if err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if plan.IsDefault {
+			if err := tx.Model(&models.Plan{}).Where("is_default = ? AND id != ?", true, plan.ID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		if plan.Name != oldName {
+			if err := tx.Model(&models.Organization{}).Where("plan = ?", oldName).Update("plan", plan.Name).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(plan).Error
+	}); err != nil {
+		a.Log.Error("Failed to update plan", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update plan", nil, "")
+	}
+
+	a.InvalidateAllOrgPlansCache()
+
+	return r.SendEnvelope(PlanResponse{Plan: *plan})
+}
+
+// DeletePlan deletes a plan that no organization is assigned to (super admin only)
+func (a *App) DeletePlan(r *fastglue.Request) error {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.IsSuperAdmin(userID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only super admins can manage plans", nil, "")
+	}
+
+	plan, err := a.findPlan(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Plan not found", nil, "")
+	}
+
+	var assigned int64
+	a.DB.Model(&models.Organization{}).Where("plan = ?", plan.Name).Count(&assigned)
+	if assigned > 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusConflict, fmt.Sprintf("Plan is assigned to %d organization(s)", assigned), nil, "")
+	}
+
+	if err := a.DB.Delete(plan).Error; err != nil {
+		a.Log.Error("Failed to delete plan", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete plan", nil, "")
+	}
+
+	a.InvalidateAllOrgPlansCache()
+
+	return r.SendEnvelope(map[string]string{"message": "Plan deleted successfully"})
+}
+
+// SetOrganizationPlan assigns a plan to an organization (super admin only).
+// An empty plan assigns the default plan.
+func (a *App) SetOrganizationPlan(r *fastglue.Request) error {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.IsSuperAdmin(userID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only super admins can change organization plans", nil, "")
+	}
+
+	orgID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid organization ID", nil, "")
+	}
+
+	var req struct {
+		Plan string `json:"plan"`
+	}
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	if req.Plan != "" {
+		var count int64
+		a.DB.Model(&models.Plan{}).Where("name = ?", req.Plan).Count(&count)
+		if count == 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Plan not found", nil, "")
+		}
+	}
+
+	previous := a.orgPlan(orgID)
+	result := a.DB.Model(&models.Organization{}).Where("id = ?", orgID).Update("plan", req.Plan)
+	if result.Error != nil {
+		a.Log.Error("Failed to update organization plan", "error", result.Error)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update organization plan", nil, "")
+	}
+	if result.RowsAffected == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	a.InvalidateOrgPlanCache(orgID)
+	plan := a.orgPlan(orgID)
+	if err := a.recordPlanChange(orgID, previous, plan); err != nil {
+		a.Log.Error("Failed to record plan change", "error", err, "org_id", orgID)
+	}
+
+	// Selecting a plan ends the trial and reactivates an expired organization
+	if req.Plan != "" {
+		if err := a.endTrial(orgID); err != nil {
+			a.Log.Error("Failed to end trial", "error", err, "org_id", orgID)
+		}
+	}
+
+	a.Log.Info("Organization plan changed", "org_id", orgID, "plan", req.Plan, "changed_by", userID)
+
+	return r.SendEnvelope(map[string]interface{}{
+		"organization_id": orgID,
+		"plan":            req.Plan,
+		"features":        orgFeatures(plan),
+	})
+}
+
+// recordPlanChange records that an organization is on a plan from now, for pricing
+// statements. The first change of an organization that was never on a trial also records
+// the plan it had been on since it was created, so earlier months keep their price.
+func (a *App) recordPlanChange(orgID uuid.UUID, previous, plan *models.Plan) error {
+	planID := func(p *models.Plan) *uuid.UUID {
+		if p == nil {
+			return nil
+		}
+		return &p.ID
+	}
+
+	var org models.Organization
+	if err := a.DB.Select("id, created_at, trial_started_at").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return err
+	}
+	var count int64
+	if err := a.DB.Model(&models.PlanChange{}).Where("organization_id = ?", orgID).Count(&count).Error; err != nil {
+		return err
+	}
+
+	changes := []models.PlanChange{}
+	if count == 0 && org.TrialStartedAt == nil {
+		changes = append(changes, models.PlanChange{OrganizationID: orgID, PlanID: planID(previous), StartedAt: org.CreatedAt})
+	}
+	changes = append(changes, models.PlanChange{OrganizationID: orgID, PlanID: planID(plan), StartedAt: time.Now()})
+	return a.DB.Create(&changes).Error
+}
+
+// findPlan loads the plan referenced by the request's id parameter
+func (a *App) findPlan(r *fastglue.Request) (*models.Plan, error) {
+	planID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	var plan models.Plan
+	if err := a.DB.Where("id = ?", planID).First(&plan).Error; err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// applyPlanRequest copies the provided fields of a plan request onto plan
+func applyPlanRequest(plan *models.Plan, req *PlanRequest) error {
+	if req.DisplayName != nil {
+		plan.DisplayName = *req.DisplayName
+	}
+	if req.Description != nil {
+		plan.Description = *req.Description
+	}
+	if req.Features != nil {
+		features := make(models.JSONBArray, 0, len(req.Features))
+		for _, f := range req.Features {
+			if !isPlanFeature(f) {
+				return fmt.Errorf("unknown feature: %s", f)
+			}
+			features = append(features, f)
+		}
+		plan.Features = features
+	}
+	if req.Limits != nil {
+		if err := validatePlanLimits(*req.Limits); err != nil {
+			return err
+		}
+		plan.Limits = *req.Limits
+	}
+	if req.IsDefault != nil {
+		plan.IsDefault = *req.IsDefault
+	}
+	if req.AllowOverage != nil {
+		plan.AllowOverage = *req.AllowOverage
+	}
+	if req.CampaignThrottlePercent != nil {
+		if *req.CampaignThrottlePercent < 0 || *req.CampaignThrottlePercent > 100 {
+			return fmt.Errorf("campaign_throttle_percent must be between 0 and 100")
+		}
+		plan.CampaignThrottlePercent = *req.CampaignThrottlePercent
+	}
+	if req.Currency != nil {
+		currency := strings.ToUpper(strings.TrimSpace(*req.Currency))
+		if !currencyPattern.MatchString(currency) {
+			return fmt.Errorf("currency must be a 3-letter ISO 4217 code")
+		}
+		plan.Currency = currency
+	}
+	for _, price := range []*int64{req.Price, req.MessageOveragePrice, req.AICallOveragePrice} {
+		if price != nil && *price < 0 {
+			return fmt.Errorf("prices cannot be negative")
+		}
+	}
+	if req.Price != nil {
+		plan.Price = *req.Price
+	}
+	if req.MessageOveragePrice != nil {
+		plan.MessageOveragePrice = *req.MessageOveragePrice
+	}
+	if req.AICallOveragePrice != nil {
+		plan.AICallOveragePrice = *req.AICallOveragePrice
+	}
+	if req.WalletRates != nil {
+		r := req.WalletRates
+		if r.Marketing < 0 || r.Utility < 0 || r.Authentication < 0 || r.Service < 0 || r.AICall < 0 {
+			return fmt.Errorf("wallet rates cannot be negative")
+		}
+		plan.WalletRates = *req.WalletRates
+	}
+	return nil
+}
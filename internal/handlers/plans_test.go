@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanHasFeature(t *testing.T) {
+	plan := &models.Plan{Name: "starter", Features: models.JSONBArray{"campaigns", "webhooks"}}
+
+	assert.True(t, planHasFeature(plan, models.PlanFeatureCampaigns))
+	assert.False(t, planHasFeature(plan, models.PlanFeatureSSO))
+	assert.True(t, planHasFeature(nil, models.PlanFeatureSSO), "no plan enables every feature")
+
+	assert.Equal(t, []string{"campaigns", "webhooks"}, orgFeatures(plan))
+	assert.Len(t, orgFeatures(nil), len(AvailablePlanFeatures))
+}
+
+func TestPlanDowngrade_StopsExistingFeatures(t *testing.T) {
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger()}
+	suffix := uuid.New().String()[:8]
+
+	free := models.Plan{Name: "free-" + suffix, Features: models.JSONBArray{}}
+	require.NoError(t, app.DB.Create(&free).Error)
+	org := models.Organization{Name: "Downgraded " + suffix, Slug: "downgraded-" + suffix, Plan: free.Name}
+	require.NoError(t, app.DB.Create(&org).Error)
+
+	assert.False(t, app.APIKeysEnabled(org.ID))
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer server.Close()
+	require.NoError(t, app.DB.Create(&models.Webhook{
+		OrganizationID: org.ID,
+		Name:           "Existing",
+		URL:            server.URL,
+		Events:         models.StringArray{string(models.WebhookEventMessageIncoming)},
+		IsActive:       true,
+	}).Error)
+	app.dispatchWebhookAsync(context.Background(), org.ID, string(models.WebhookEventMessageIncoming), map[string]string{})
+	assert.Zero(t, hits.Load(), "webhooks don't fire without the feature")
+
+	scheduledAt := time.Now().Add(-time.Minute)
+	campaign := models.BulkMessageCampaign{
+		OrganizationID:  org.ID,
+		WhatsAppAccount: "downgraded-account",
+		Name:            "Scheduled",
+		TemplateID:      uuid.New(),
+		Status:          models.CampaignStatusScheduled,
+		ScheduledAt:     &scheduledAt,
+		CreatedBy:       uuid.New(),
+	}
+	require.NoError(t, app.DB.Create(&campaign).Error)
+
+	NewCampaignScheduler(app, time.Minute).launchDueCampaigns(context.Background())
+
+	require.NoError(t, app.DB.First(&campaign, campaign.ID).Error)
+	assert.Equal(t, models.CampaignStatusPaused, campaign.Status)
+	assert.Equal(t, featureUnavailableMessage(models.PlanFeatureCampaigns), campaign.PausedReason)
+}
+
+func TestFeatureUnavailableMessage(t *testing.T) {
+	assert.Equal(t, "SSO is not available on your plan", featureUnavailableMessage(models.PlanFeatureSSO))
+	assert.Equal(t, "Campaigns is not available on your plan", featureUnavailableMessage(models.PlanFeatureCampaigns))
+}
+
+func TestApplyPlanRequest(t *testing.T) {
+	plan := &models.Plan{Name: "pro", DisplayName: "Pro", Features: models.JSONBArray{"campaigns"}}
+
+	displayName := "Professional"
+	err := applyPlanRequest(plan, &PlanRequest{
+		DisplayName: &displayName,
+		Features:    []string{"campaigns", "sso"},
+		Limits:      &models.PlanLimits{Messages: 50000, Agents: 10},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Professional", plan.DisplayName)
+	assert.Equal(t, models.JSONBArray{"campaigns", "sso"}, plan.Features)
+	assert.Equal(t, int64(50000), plan.Limits.Messages)
+
+	assert.Error(t, applyPlanRequest(plan, &PlanRequest{Features: []string{"teleport"}}))
+	assert.Error(t, applyPlanRequest(plan, &PlanRequest{Limits: &models.PlanLimits{Messages: -1}}))
+	assert.Equal(t, models.JSONBArray{"campaigns", "sso"}, plan.Features, "invalid request leaves features unchanged")
+
+	throttle := 120
+	assert.Error(t, applyPlanRequest(plan, &PlanRequest{CampaignThrottlePercent: &throttle}))
+	throttle = 90
+	assert.NoError(t, applyPlanRequest(plan, &PlanRequest{CampaignThrottlePercent: &throttle}))
+	assert.Equal(t, 90, plan.CampaignThrottlePercent)
+
+	currency := "eur"
+	assert.NoError(t, applyPlanRequest(plan, &PlanRequest{Currency: &currency}))
+	assert.Equal(t, "EUR", plan.Currency)
+	currency = "euro"
+	assert.Error(t, applyPlanRequest(plan, &PlanRequest{Currency: &currency}))
+	price := int64(-100)
+	assert.Error(t, applyPlanRequest(plan, &PlanRequest{Price: &price}))
+	assert.Error(t, applyPlanRequest(plan, &PlanRequest{WalletRates: &models.WalletRates{Marketing: -1}}))
+}
+
+func TestPlanNamePattern(t *testing.T) {
+	assert.True(t, planNamePattern.MatchString("pro"))
+	assert.True(t, planNamePattern.MatchString("enterprise-2025"))
+	assert.False(t, planNamePattern.MatchString("Pro Plan"))
+	assert.False(t, planNamePattern.MatchString(""))
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// typingIndicatorRefresh is how often a typing indicator is resent while a reply is
+// prepared, before WhatsApp clears it after 25 seconds
+const typingIndicatorRefresh = 20 * time.Second
+
+// SendTypingIndicator shows the contact that an agent is typing. The agent UI calls
+// it while the composer is in use; WhatsApp clears the indicator after 25 seconds.
+// Nothing is sent unless the number has typing indicators on, or while presence
+// privacy holds read receipts, since the indicator marks the message as read.
+func (a *App) SendTypingIndicator(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var account models.WhatsAppAccount
+	if err := a.DB.Where("organization_id = ? AND name = ?", orgID, contact.WhatsAppAccount).First(&account).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Contact has no WhatsApp account", nil, "")
+	}
+
+	if !account.TypingIndicator || account.PresencePrivacy {
+		return r.SendEnvelope(map[string]interface{}{"sent": false})
+	}
+
+	messageID := a.latestIncomingMessageID(contact.ID)
+	if messageID == "" {
+		return r.SendEnvelope(map[string]interface{}{"sent": false})
+	}
+
+	a.sendTypingIndicator(&account, messageID)
+	return r.SendEnvelope(map[string]interface{}{"sent": true})
+}
+
+// sendTypingIndicator shows a typing indicator in reply to a message in the background
+func (a *App) sendTypingIndicator(account *models.WhatsAppAccount, messageID string) {
+	switch a.sendChannel(account) {
+	case models.ChannelTelegram:
+		a.sendTelegramTyping(account, messageID)
+		return
+	case models.ChannelInstagram, models.ChannelMessenger:
+		a.sendMessengerSenderAction(account, messageID, "typing_on")
+		return
+	case models.ChannelWebChat:
+		a.sendWebChatTyping(account, messageID)
+		return
+	}
+	waAccount := a.toWhatsAppAccount(account)
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := a.WhatsApp.SendTypingIndicator(ctx, waAccount, messageID); err != nil {
+			a.Log.Error("Failed to send typing indicator", "error", err, "message_id", messageID)
+		}
+	}()
+}
+
+// keepTyping shows a typing indicator in reply to a message until stop is called,
+// resending it so it stays up during slow AI provider calls
+func (a *App) keepTyping(account *models.WhatsAppAccount, messageID string) (stop func()) {
+	a.sendTypingIndicator(account, messageID)
+
+	done := make(chan struct{})
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := time.NewTicker(typingIndicatorRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				a.sendTypingIndicator(account, messageID)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// sendReadReceipts sends read receipts for messages in the background
+func (a *App) sendReadReceipts(account *models.WhatsAppAccount, messageIDs []string) {
+	if len(messageIDs) == 0 {
+		return
+	}
+	switch a.sendChannel(account) {
+	case models.ChannelTelegram, models.ChannelWebChat:
+		// Telegram doesn't let bots mark messages read, and the widget doesn't show it
+		return
+	case models.ChannelInstagram, models.ChannelMessenger:
+		// Meta marks the whole conversation seen
+		a.sendMessengerSenderAction(account, messageIDs[len(messageIDs)-1], "mark_seen")
+		return
+	}
+
+	waAccount := a.toWhatsAppAccount(account)
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		// Use timeout context for external API calls
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		for _, messageID := range messageIDs {
+			// Check if context was cancelled
+			if ctx.Err() != nil {
+				a.Log.Warn("Read receipt sending cancelled", "reason", ctx.Err())
+				return
+			}
+			if err := a.WhatsApp.MarkMessageRead(ctx, waAccount, messageID); err != nil {
+				a.Log.Error("Failed to send read receipt", "error", err, "message_id", messageID)
+			}
+		}
+	}()
+}
+
+// releaseReadReceipt sends the read receipt held back by presence privacy once an
+// agent replies. WhatsApp marks earlier messages read along with the latest one.
+func (a *App) releaseReadReceipt(account *models.WhatsAppAccount, contactID uuid.UUID) {
+	if !account.AutoReadReceipt || !account.PresencePrivacy {
+		return
+	}
+	if messageID := a.latestIncomingMessageID(contactID); messageID != "" {
+		a.sendReadReceipts(account, []string{messageID})
+	}
+}
+
+// markReadAfterChatbotReply sends the read receipt for a message once the chatbot
+// has replied to it. A chatbot reply is a response like an agent's, so this also
+// covers numbers with presence privacy.
+func (a *App) markReadAfterChatbotReply(account *models.WhatsAppAccount, contactID uuid.UUID, messageID string) {
+	if !account.AutoReadReceipt {
+		return
+	}
+
+	// Chatbot sends set chatbot_last_message_at, which the incoming message cleared
+	var replied int64
+	if err := a.DB.Model(&models.Contact{}).
+		Where("id = ? AND chatbot_last_message_at IS NOT NULL", contactID).
+		Count(&replied).Error; err != nil || replied == 0 {
+		return
+	}
+	a.sendReadReceipts(account, []string{messageID})
+}
+
+// latestIncomingMessageID returns the WhatsApp ID of the contact's most recent message
+func (a *App) latestIncomingMessageID(contactID uuid.UUID) string {
+	var msg models.Message
+	if err := a.DB.Select("whats_app_message_id").
+		Where("contact_id = ? AND direction = ? AND whats_app_message_id != ''", contactID, models.DirectionIncoming).
+		Order("created_at DESC").
+		First(&msg).Error; err != nil {
+		return ""
+	}
+	return msg.WhatsAppMessageID
+}
@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_SendTypingIndicator(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	require.NoError(t, app.DB.Create(&models.Message{
+		BaseModel:         models.BaseModel{ID: uuid.New()},
+		OrganizationID:    org.ID,
+		WhatsAppAccount:   account.Name,
+		ContactID:         contact.ID,
+		WhatsAppMessageID: "wamid.incoming",
+		Direction:         models.DirectionIncoming,
+		MessageType:       models.MessageTypeText,
+		Content:           "Is my order on the way?",
+		Status:            models.MessageStatusReceived,
+	}).Error)
+
+	typing := func() bool {
+		req := testutil.NewJSONRequest(t, nil)
+		setAuthContext(req, org.ID, user.ID)
+		testutil.SetPathParam(req, "id", contact.ID.String())
+
+		require.NoError(t, app.SendTypingIndicator(req))
+		require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+		var resp struct {
+			Sent bool `json:"sent"`
+		}
+		testutil.ParseEnvelopeResponse(t, req, &resp)
+		return resp.Sent
+	}
+
+	// Off by default
+	assert.False(t, typing())
+
+	require.NoError(t, app.DB.Model(account).Update("typing_indicator", true).Error)
+	assert.True(t, typing())
+
+	// Presence privacy holds typing indicators, since they mark messages read
+	require.NoError(t, app.DB.Model(account).Update("presence_privacy", true).Error)
+	assert.False(t, typing())
+}
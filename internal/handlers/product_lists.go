@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+)
+
+// ProductSectionRequest is a titled group of products, by SKU, in a multi-product message
+type ProductSectionRequest struct {
+	Title string   `json:"title"`
+	SKUs  []string `json:"skus"`
+}
+
+// productSectionsFromConfig reads the sections of a product list step, as
+// {"sections": [{"title", "skus": [...]}]}
+func productSectionsFromConfig(config map[string]interface{}) []ProductSectionRequest {
+	raw, _ := config["sections"].([]interface{})
+	sections := make([]ProductSectionRequest, 0, len(raw))
+	for _, s := range raw {
+		sectionMap, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		section := ProductSectionRequest{Title: strings.TrimSpace(getStringFromMap(sectionMap, "title"))}
+		skus, _ := sectionMap["skus"].([]interface{})
+		for _, sku := range skus {
+			if sku, ok := sku.(string); ok && strings.TrimSpace(sku) != "" {
+				section.SKUs = append(section.SKUs, strings.TrimSpace(sku))
+			}
+		}
+		sections = append(sections, section)
+	}
+	return sections
+}
+
+// productListMessage builds a multi-product message from sections of SKUs, returning
+// it with its products. The products must all be in one catalog, of the number when
+// account is set. With skipUnavailable, products that can't be ordered are left out,
+// and so are the sections left empty.
+func (a *App) productListMessage(orgID uuid.UUID, account, header, body, footer string, sections []ProductSectionRequest, skipUnavailable bool) (*whatsapp.ProductListMessage, []models.CatalogProduct, error) {
+	list := &whatsapp.ProductListMessage{
+		Header: strings.TrimSpace(header),
+		Body:   body,
+		Footer: strings.TrimSpace(footer),
+	}
+	var products []models.CatalogProduct
+	var catalog *models.Catalog
+	for _, section := range sections {
+		listSection := whatsapp.ProductSection{Title: strings.TrimSpace(section.Title)}
+		for _, sku := range section.SKUs {
+			product, err := a.findProductBySKU(orgID, account, sku)
+			if err != nil {
+				return nil, nil, err
+			}
+			if catalog == nil {
+				catalog = product.Catalog
+			} else if product.CatalogID != catalog.ID {
+				return nil, nil, fmt.Errorf("product %q is in another catalog, a product list can only show one catalog", sku)
+			}
+			if skipUnavailable && !productAvailable(product) {
+				continue
+			}
+			listSection.RetailerIDs = append(listSection.RetailerIDs, product.RetailerID)
+			products = append(products, *product)
+		}
+		if len(listSection.RetailerIDs) > 0 || !skipUnavailable {
+			list.Sections = append(list.Sections, listSection)
+		}
+	}
+	if catalog != nil {
+		list.CatalogID = catalog.MetaCatalogID
+	}
+	return list, products, nil
+}
+
+// productListInteractiveData creates the InteractiveData JSONB of a product list
+// message, with the name, price and image of its products for the chat
+func productListInteractiveData(list *whatsapp.ProductListMessage, products []models.CatalogProduct) models.JSONB {
+	byRetailerID := make(map[string]models.CatalogProduct, len(products))
+	for _, p := range products {
+		byRetailerID[p.RetailerID] = p
+	}
+
+	sections := make([]interface{}, 0, len(list.Sections))
+	for _, section := range list.Sections {
+		items := make([]interface{}, 0, len(section.RetailerIDs))
+		for _, retailerID := range section.RetailerIDs {
+			item := map[string]interface{}{"product_retailer_id": retailerID}
+			if p, ok := byRetailerID[retailerID]; ok {
+				item["product_name"] = p.Name
+				item["price"] = p.Price
+				item["currency"] = p.Currency
+				item["image_url"] = p.ImageURL
+			}
+			items = append(items, item)
+		}
+		sections = append(sections, map[string]interface{}{"title": section.Title, "products": items})
+	}
+	return models.JSONB{
+		"type":     "product_list",
+		"header":   list.Header,
+		"body":     list.Body,
+		"footer":   list.Footer,
+		"sections": sections,
+	}
+}
+
+// sendAndSaveProductListMessage sends a multi-product message and saves it to the database
+func (a *App) sendAndSaveProductListMessage(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, list *whatsapp.ProductListMessage, products []models.CatalogProduct) error {
+	_, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account:         account,
+		Contact:         contact,
+		Type:            models.MessageTypeInteractive,
+		InteractiveType: "product_list",
+		BodyText:        list.Body,
+		ProductList:     list,
+		Products:        products,
+	}, ChatbotSendOptions())
+	return err
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProductSectionsFromConfig(t *testing.T) {
+	// Sections as read back from the jsonb input config
+	sections := productSectionsFromConfig(map[string]interface{}{
+		"sections": []interface{}{
+			map[string]interface{}{"title": " Breads ", "skus": []interface{}{"BREAD-1", " ", "BREAD-2 "}},
+			map[string]interface{}{"title": "Cakes"},
+		},
+	})
+	assert.Equal(t, []ProductSectionRequest{
+		{Title: "Breads", SKUs: []string{"BREAD-1", "BREAD-2"}},
+		{Title: "Cakes"},
+	}, sections)
+
+	assert.Empty(t, productSectionsFromConfig(map[string]interface{}{}))
+}
+
+func TestProductListMessage(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Product List Org " + suffix,
+		Slug:      "product-list-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+
+	catalog := &models.Catalog{OrganizationID: org.ID, WhatsAppAccount: "shop", MetaCatalogID: "bakery-" + suffix, Name: "Bakery", IsActive: true}
+	other := &models.Catalog{OrganizationID: org.ID, WhatsAppAccount: "shop", MetaCatalogID: "deli-" + suffix, Name: "Deli", IsActive: true}
+	require.NoError(t, app.DB.Create(catalog).Error)
+	require.NoError(t, app.DB.Create(other).Error)
+	for _, p := range []models.CatalogProduct{
+		{CatalogID: catalog.ID, RetailerID: "BREAD-1", Name: "Sourdough", Price: 650, Currency: "USD", Availability: "in stock"},
+		{CatalogID: catalog.ID, RetailerID: "BREAD-2", Name: "Baguette", Price: 300, Currency: "USD", Availability: "out of stock"},
+		{CatalogID: other.ID, RetailerID: "HAM-1", Name: "Ham", Price: 900, Currency: "USD"},
+	} {
+		p.OrganizationID = org.ID
+		p.MetaProductID = p.RetailerID + "-" + suffix
+		p.IsActive = true
+		require.NoError(t, app.DB.Create(&p).Error)
+	}
+
+	sections := []ProductSectionRequest{{Title: "Breads", SKUs: []string{"BREAD-1", "BREAD-2"}}}
+	list, products, err := app.productListMessage(org.ID, "shop", "Fresh today", "Pick your bread", "", sections, false)
+	require.NoError(t, err)
+	assert.Equal(t, catalog.MetaCatalogID, list.CatalogID)
+	assert.Equal(t, []whatsapp.ProductSection{{Title: "Breads", RetailerIDs: []string{"BREAD-1", "BREAD-2"}}}, list.Sections)
+	assert.Len(t, products, 2)
+	assert.NoError(t, list.Validate())
+
+	// Products that can't be ordered are left out, with the sections left empty
+	sections = append(sections, ProductSectionRequest{Title: "Sold out", SKUs: []string{"BREAD-2"}})
+	list, products, err = app.productListMessage(org.ID, "shop", "Fresh today", "Pick your bread", "", sections, true)
+	require.NoError(t, err)
+	assert.Equal(t, []whatsapp.ProductSection{{Title: "Breads", RetailerIDs: []string{"BREAD-1"}}}, list.Sections)
+	require.Len(t, products, 1)
+
+	data := productListInteractiveData(list, products)
+	assert.Equal(t, "product_list", data["type"])
+	items := data["sections"].([]interface{})[0].(map[string]interface{})["products"].([]interface{})
+	assert.Equal(t, "Sourdough", items[0].(map[string]interface{})["product_name"])
+
+	// A product list shows a single catalog
+	_, _, err = app.productListMessage(org.ID, "shop", "Fresh today", "Pick", "", []ProductSectionRequest{{Title: "Mixed", SKUs: []string{"BREAD-1", "HAM-1"}}}, false)
+	assert.ErrorContains(t, err, "another catalog")
+
+	_, _, err = app.productListMessage(org.ID, "shop", "Fresh today", "Pick", "", []ProductSectionRequest{{Title: "Missing", SKUs: []string{"NOPE"}}}, false)
+	assert.ErrorIs(t, err, errProductNotFound)
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQRLayouts_FillSymbol(t *testing.T) {
+	for version := 1; version <= len(qrLayouts); version++ {
+		l := qrLayouts[version-1]
+		blocks := l.shortBlocks + l.longBlocks
+		assert.Equal(t, qrRawCodewords(version), qrDataCodewords(version)+blocks*l.ecLen, "version %d", version)
+	}
+}
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// "01234567" at version 1-M, from the worked example in ISO/IEC 18004
+	data := []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	want := []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55}
+
+	assert.Equal(t, want, reedSolomonRemainder(data, reedSolomonDivisor(10)))
+}
+
+func TestEncodeQR_VersionInfo(t *testing.T) {
+	qr, err := encodeQR([]byte(strings.Repeat("a", 110)))
+	require.NoError(t, err)
+	require.Equal(t, 7, qr.version)
+
+	// Version 7 is encoded as 000111110010010100, least significant bit first
+	var bits int
+	for i := 0; i < 18; i++ {
+		if qr.modules[i/3][qr.size-11+i%3] {
+			bits |= 1 << i
+		}
+	}
+	assert.Equal(t, 0x07C94, bits)
+}
+
+func TestEncodeQR_RoundTrip(t *testing.T) {
+	for _, text := range []string{
+		"https://wa.me/15551234567",
+		"https://wa.me/15551234567?text=Hi%21%20I%27d%20like%20to%20know%20more%20%28ref%3A%20K7M2QX%29",
+		strings.Repeat("x", 300),
+	} {
+		qr, err := encodeQR([]byte(text))
+		require.NoError(t, err)
+		assert.Equal(t, text, string(readQR(t, qr)))
+	}
+}
+
+func TestEncodeQR_TooLong(t *testing.T) {
+	_, err := encodeQR(make([]byte, 1000))
+	assert.Error(t, err)
+}
+
+func TestRenderQRPNG(t *testing.T) {
+	data, err := renderQRPNG([]byte("https://wa.me/15551234567"), 4)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	// Version 2 is 25 modules wide, plus a 4 module border on each side
+	assert.Equal(t, (25+8)*4, img.Bounds().Dx())
+}
+
+// readQR reads the data back out of a symbol: it decodes the format information,
+// removes the mask, collects the codewords in placement order, checks each block's
+// error correction and parses the byte mode segment
+func readQR(t *testing.T, qr *qrCode) []byte {
+	t.Helper()
+
+	var format int
+	for i := 0; i < 8; i++ {
+		if qr.modules[8][qr.size-1-i] {
+			format |= 1 << i
+		}
+	}
+	for i := 8; i < 15; i++ {
+		if qr.modules[qr.size-15+i][8] {
+			format |= 1 << i
+		}
+	}
+	format ^= 0x5412
+	require.Equal(t, qrFormatLevelM, format>>13, "error correction level")
+	mask := (format >> 10) & 7
+
+	unmasked := newQRCode(qr.version)
+	unmasked.drawFunctionPatterns()
+	for y := range qr.modules {
+		copy(unmasked.modules[y], qr.modules[y])
+	}
+	unmasked.applyMask(mask)
+
+	var codewords []byte
+	var current byte
+	n := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < qr.size; vert++ {
+			y := vert
+			if upward {
+				y = qr.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if unmasked.isFunction[y][x] {
+					continue
+				}
+				current <<= 1
+				if unmasked.modules[y][x] {
+					current |= 1
+				}
+				if n++; n%8 == 0 {
+					codewords = append(codewords, current)
+				}
+			}
+		}
+	}
+	require.Len(t, codewords, qrRawCodewords(qr.version))
+
+	// De-interleave the blocks and check their error correction
+	l := qrLayouts[qr.version-1]
+	blockCount := l.shortBlocks + l.longBlocks
+	blocks := make([][]byte, blockCount)
+	i := 0
+	for k := 0; k <= l.shortLen; k++ {
+		for b := range blocks {
+			if k < l.shortLen || b >= l.shortBlocks {
+				blocks[b] = append(blocks[b], codewords[i])
+				i++
+			}
+		}
+	}
+	divisor := reedSolomonDivisor(l.ecLen)
+	var data []byte
+	for b, block := range blocks {
+		ec := make([]byte, l.ecLen)
+		for k := range ec {
+			ec[k] = codewords[i+k*blockCount+b]
+		}
+		require.Equal(t, reedSolomonRemainder(block, divisor), ec, "block %d", b)
+		data = append(data, block...)
+	}
+
+	// Byte mode segment
+	bitAt := func(pos int) int { return int(data[pos>>3]>>(7-pos&7)) & 1 }
+	read := func(pos, length int) int {
+		v := 0
+		for k := 0; k < length; k++ {
+			v = v<<1 | bitAt(pos+k)
+		}
+		return v
+	}
+	require.Equal(t, 0x4, read(0, 4), "mode")
+	countBits := 8
+	if qr.version >= 10 {
+		countBits = 16
+	}
+	length := read(4, countBits)
+	out := make([]byte, length)
+	for k := range out {
+		out[k] = byte(read(4+countBits+8*k, 8))
+	}
+	return out
+}
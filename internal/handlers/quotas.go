@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// fairUseWarningPercent is the percentage of a fair-use quota at which admins are warned
+const fairUseWarningPercent = 80
+
+// fairUseMetrics are the metrics with fair-use quotas
+var fairUseMetrics = []models.UsageMetric{
+	models.UsageMetricMessages,
+	models.UsageMetricAICalls,
+}
+
+var fairUseQuotaUnits = map[models.UsageMetric]string{
+	models.UsageMetricMessages: "messages",
+	models.UsageMetricAICalls:  "AI calls",
+}
+
+// isFairUseMetric reports whether a metric has fair-use quotas
+func isFairUseMetric(metric models.UsageMetric) bool {
+	return metric == models.UsageMetricMessages || metric == models.UsageMetricAICalls
+}
+
+// usageDay returns the period of daily usage counters at t. Days are UTC.
+func usageDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// defaultQuotas returns the deployment's default fair-use quotas
+func (a *App) defaultQuotas() models.FairUseQuotas {
+	cfg := a.CurrentConfig()
+	if cfg == nil {
+		return models.FairUseQuotas{}
+	}
+	return models.FairUseQuotas(cfg.Quotas)
+}
+
+// orgQuotas returns the fair-use quotas in effect for an organization, its own
+// quotas with the deployment's defaults for the ones it doesn't set
+func (a *App) orgQuotas(orgID uuid.UUID) models.FairUseQuotas {
+	quotas, err := a.getOrgQuotasCached(orgID)
+	if err != nil {
+		a.Log.Error("Failed to load organization quotas", "error", err, "org_id", orgID)
+	}
+	return quotas.WithDefaults(a.defaultQuotas())
+}
+
+// checkFairUseQuota returns a QuotaExceededError if using n more of a metric would
+// exceed one of the organization's fair-use quotas. Unlike plan limits, fair-use
+// quotas hold even when the plan allows overage.
+func (a *App) checkFairUseQuota(orgID uuid.UUID, metric models.UsageMetric, n int64) error {
+	if !isFairUseMetric(metric) {
+		return nil
+	}
+	quotas := a.orgQuotas(orgID)
+	now := time.Now()
+
+	for _, daily := range []bool{true, false} {
+		limit := quotas.Limit(metric, daily)
+		if limit == 0 {
+			continue
+		}
+		period := usagePeriod(metric, now)
+		if daily {
+			period = usageDay(now)
+		}
+		if a.usageIn(orgID, metric, period)+n > limit {
+			return &QuotaExceededError{Metric: metric, Limit: limit, FairUse: true, Daily: daily}
+		}
+	}
+	return nil
+}
+
+// fairUseUsage returns the organization's usage against each of its fair-use quotas
+func (a *App) fairUseUsage(orgID uuid.UUID, now time.Time) []UsageMetricResponse {
+	quotas := a.orgQuotas(orgID)
+	usage := make([]UsageMetricResponse, 0, 2*len(fairUseMetrics))
+	for _, metric := range fairUseMetrics {
+		for _, daily := range []bool{true, false} {
+			limit := quotas.Limit(metric, daily)
+			if limit == 0 {
+				continue
+			}
+			period := usagePeriod(metric, now)
+			if daily {
+				period = usageDay(now)
+			}
+			used := a.usageIn(orgID, metric, period)
+			usage = append(usage, UsageMetricResponse{
+				Metric:  metric,
+				Label:   usageMetricLabels[metric],
+				Period:  period,
+				Used:    used,
+				Limit:   limit,
+				Percent: float64(used) * 100 / float64(limit),
+				Status:  usageStatus(used, limit, fairUseWarningPercent),
+			})
+		}
+	}
+	return usage
+}
+
+// SetOrganizationQuotas sets an organization's fair-use quotas (super admin only).
+// A zero quota uses the deployment's default and -1 makes it unlimited.
+func (a *App) SetOrganizationQuotas(r *fastglue.Request) error {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.IsSuperAdmin(userID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only super admins can change organization quotas", nil, "")
+	}
+
+	orgID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid organization ID", nil, "")
+	}
+
+	var req models.FairUseQuotas
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	for _, quota := range []int64{req.DailyMessages, req.MonthlyMessages, req.DailyAICalls, req.MonthlyAICalls} {
+		if quota < -1 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Quotas must be positive, 0 for the default or -1 for unlimited", nil, "")
+		}
+	}
+
+	result := a.DB.Model(&models.Organization{}).Where("id = ?", orgID).Updates(map[string]interface{}{
+		"quota_daily_messages":   req.DailyMessages,
+		"quota_monthly_messages": req.MonthlyMessages,
+		"quota_daily_ai_calls":   req.DailyAICalls,
+		"quota_monthly_ai_calls": req.MonthlyAICalls,
+	})
+	if result.Error != nil {
+		a.Log.Error("Failed to update organization quotas", "error", result.Error)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update organization quotas", nil, "")
+	}
+	if result.RowsAffected == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	a.InvalidateOrgQuotasCache(orgID)
+	a.Log.Info("Organization quotas changed", "org_id", orgID, "quotas", req, "changed_by", userID)
+
+	return r.SendEnvelope(map[string]interface{}{
+		"organization_id": orgID,
+		"quotas":          req,
+		"effective":       req.WithDefaults(a.defaultQuotas()),
+	})
+}
+
+// processQuotaAlerts compares today's and this month's counters with fair-use quotas
+func (p *UsageAlertProcessor) processQuotaAlerts() {
+	if p.app.defaultQuotas() == (models.FairUseQuotas{}) {
+		var orgCount int64
+		err := p.app.DB.Model(&models.Organization{}).
+			Where("quota_daily_messages > 0 OR quota_monthly_messages > 0 OR quota_daily_ai_calls > 0 OR quota_monthly_ai_calls > 0").
+			Count(&orgCount).Error
+		if err != nil || orgCount == 0 {
+			return
+		}
+	}
+
+	now := time.Now()
+	day := usageDay(now)
+	var counters []models.UsageCounter
+	if err := p.app.DB.Where("period IN ? AND metric IN ?", []string{day, usagePeriod(models.UsageMetricMessages, now)}, fairUseMetrics).
+		Find(&counters).Error; err != nil {
+		p.app.Log.Error("Failed to load usage counters", "error", err)
+		return
+	}
+
+	quotas := make(map[uuid.UUID]models.FairUseQuotas)
+	for i := range counters {
+		counter := &counters[i]
+		orgQuotas, ok := quotas[counter.OrganizationID]
+		if !ok {
+			orgQuotas = p.app.orgQuotas(counter.OrganizationID)
+			quotas[counter.OrganizationID] = orgQuotas
+		}
+		p.processQuotaCounter(counter, orgQuotas.Limit(counter.Metric, counter.Period == day))
+	}
+}
+
+// processQuotaCounter sends the fair-use alert for a counter's usage once, and re-arms
+// alerts when usage drops back below the quota (e.g. after it is raised)
+func (p *UsageAlertProcessor) processQuotaCounter(counter *models.UsageCounter, limit int64) {
+	now := time.Now()
+
+	switch usageStatus(counter.Value, limit, fairUseWarningPercent) {
+	case UsageStatusLimitReached:
+		if counter.QuotaReachedAt == nil && p.claimAlert(counter, "quota_reached_at", now) {
+			if counter.QuotaWarnedAt == nil {
+				p.claimAlert(counter, "quota_warned_at", now)
+			}
+			p.sendQuotaAlert(counter, limit, models.WebhookEventQuotaReached)
+		}
+	case UsageStatusWarning:
+		if counter.QuotaReachedAt != nil {
+			p.app.DB.Model(counter).Update("quota_reached_at", nil)
+		}
+		if counter.QuotaWarnedAt == nil && p.claimAlert(counter, "quota_warned_at", now) {
+			p.sendQuotaAlert(counter, limit, models.WebhookEventQuotaWarning)
+		}
+	default:
+		if counter.QuotaWarnedAt != nil || counter.QuotaReachedAt != nil {
+			p.app.DB.Model(counter).Updates(map[string]interface{}{
+				"quota_warned_at":  nil,
+				"quota_reached_at": nil,
+			})
+		}
+	}
+}
+
+// sendQuotaAlert emits the fair-use quota webhook event and emails the organization's admins
+func (p *UsageAlertProcessor) sendQuotaAlert(counter *models.UsageCounter, limit int64, event models.WebhookEvent) {
+	percent := float64(counter.Value) * 100 / float64(limit)
+	window := "month"
+	if len(counter.Period) == len("2006-01-02") {
+		window = "day"
+	}
+
+	p.app.Log.Info("Fair-use quota alert", "org_id", counter.OrganizationID, "metric", counter.Metric, "period", counter.Period, "used", counter.Value, "limit", limit, "event", event)
+
+	p.app.DispatchWebhook(counter.OrganizationID, event, map[string]interface{}{
+		"metric":  counter.Metric,
+		"window":  window,
+		"period":  counter.Period,
+		"used":    counter.Value,
+		"limit":   limit,
+		"percent": percent,
+	})
+
+	if !p.app.emailEnabled() {
+		return
+	}
+
+	units := fairUseQuotaUnits[counter.Metric]
+	var subject, body string
+	if event == models.WebhookEventQuotaReached {
+		subject = fmt.Sprintf("Fair-use quota reached: %s", units)
+		body = fmt.Sprintf("Your organization has used its fair-use quota of %d %s per %s (%s). "+
+			"Further %s are held until the quota resets.\n", limit, units, window, counter.Period, units)
+	} else {
+		subject = fmt.Sprintf("Fair-use quota at %.0f%%: %s", percent, units)
+		body = fmt.Sprintf("Your organization has used %d of its fair-use quota of %d %s per %s (%s).\n",
+			counter.Value, limit, units, window, counter.Period)
+	}
+
+	if err := p.app.sendEmail(p.app.orgAdminEmails(counter.OrganizationID), subject, body); err != nil {
+		p.app.Log.Error("Failed to send quota alert email", "error", err, "org_id", counter.OrganizationID)
+	}
+}
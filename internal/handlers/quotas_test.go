@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFairUseQuotas(t *testing.T) {
+	defaults := models.FairUseQuotas{DailyMessages: 1000, MonthlyMessages: 20000, DailyAICalls: 100}
+	quotas := models.FairUseQuotas{DailyMessages: 5000, MonthlyMessages: -1}.WithDefaults(defaults)
+
+	assert.Equal(t, int64(5000), quotas.Limit(models.UsageMetricMessages, true))
+	assert.Equal(t, int64(0), quotas.Limit(models.UsageMetricMessages, false), "-1 is unlimited")
+	assert.Equal(t, int64(100), quotas.Limit(models.UsageMetricAICalls, true), "0 uses the default")
+	assert.Equal(t, int64(0), quotas.Limit(models.UsageMetricAICalls, false))
+	assert.Equal(t, int64(0), quotas.Limit(models.UsageMetricStorage, true))
+}
+
+func TestFairUseQuotaError(t *testing.T) {
+	err := &QuotaExceededError{Metric: models.UsageMetricMessages, Limit: 5000, FairUse: true, Daily: true}
+	assert.Equal(t, "The organization's daily fair-use quota of 5000 messages is reached", err.Error())
+
+	err = &QuotaExceededError{Metric: models.UsageMetricAICalls, Limit: 300, FairUse: true}
+	assert.Equal(t, "The organization's monthly fair-use quota of 300 AI calls is reached", err.Error())
+}
+
+func TestUsageDay(t *testing.T) {
+	now := time.Date(2025, 3, 31, 23, 30, 0, 0, time.FixedZone("UTC-5", -5*3600))
+	assert.Equal(t, "2025-04-01", usageDay(now))
+}
+
+func TestCheckFairUseQuota(t *testing.T) {
+	app := &App{
+		Config: &config.Config{Quotas: config.QuotasConfig{DailyMessages: 2, MonthlyAICalls: 1}},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	org := models.Organization{BaseModel: models.BaseModel{ID: uuid.New()}, Name: "Tenant", Slug: "tenant-" + uuid.New().String()[:8]}
+	require.NoError(t, app.DB.Create(&org).Error)
+
+	app.recordUsage(org.ID, models.UsageMetricMessages, 1)
+	assert.NoError(t, app.checkSupportQuota(org.ID, models.UsageMetricMessages, 1))
+	assert.Equal(t, int64(1), app.usageIn(org.ID, models.UsageMetricMessages, usageDay(time.Now())))
+
+	app.recordUsage(org.ID, models.UsageMetricMessages, 1)
+	var quotaErr *QuotaExceededError
+	require.True(t, errors.As(app.checkSupportQuota(org.ID, models.UsageMetricMessages, 1), &quotaErr))
+	assert.True(t, quotaErr.FairUse)
+	assert.True(t, quotaErr.Daily)
+
+	// Monthly quotas hold too
+	app.recordUsage(org.ID, models.UsageMetricAICalls, 1)
+	assert.Error(t, app.checkSupportQuota(org.ID, models.UsageMetricAICalls, 1))
+
+	// An organization's own quota overrides the default
+	require.NoError(t, app.DB.Model(&org).Update("quota_daily_messages", -1).Error)
+	assert.NoError(t, app.checkSupportQuota(org.ID, models.UsageMetricMessages, 1))
+
+	usage := app.fairUseUsage(org.ID, time.Now())
+	require.Len(t, usage, 1)
+	assert.Equal(t, models.UsageMetricAICalls, usage[0].Metric)
+	assert.Equal(t, UsageStatusLimitReached, usage[0].Status)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/websocket"
+)
+
+// reactionsFromMetadata reads the reactions stored in a message's metadata
+func reactionsFromMetadata(metadata models.JSONB) []Reaction {
+	var reactions []Reaction
+	reactionsArray, _ := metadata["reactions"].([]interface{})
+	for _, r := range reactionsArray {
+		if rMap, ok := r.(map[string]interface{}); ok {
+			fromChatbot, _ := rMap["from_chatbot"].(bool)
+			reactions = append(reactions, Reaction{
+				Emoji:       getStringFromMap(rMap, "emoji"),
+				FromPhone:   getStringFromMap(rMap, "from_phone"),
+				FromUser:    getStringFromMap(rMap, "from_user"),
+				FromChatbot: fromChatbot,
+			})
+		}
+	}
+	return reactions
+}
+
+// withReaction replaces the sender's previous reaction, since each sender has at
+// most one per message. An empty emoji only removes it.
+func withReaction(reactions []Reaction, reaction Reaction) []Reaction {
+	var newReactions []Reaction
+	for _, r := range reactions {
+		if r.FromPhone != reaction.FromPhone || r.FromUser != reaction.FromUser || r.FromChatbot != reaction.FromChatbot {
+			newReactions = append(newReactions, r)
+		}
+	}
+	if reaction.Emoji != "" {
+		newReactions = append(newReactions, reaction)
+	}
+	return newReactions
+}
+
+// saveReaction stores a reaction on the message and broadcasts the message's reactions to the chat
+func (a *App) saveReaction(orgID, contactID uuid.UUID, message *models.Message, reaction Reaction) ([]Reaction, error) {
+	metadata := message.Metadata
+	if metadata == nil {
+		metadata = models.JSONB{}
+	}
+	reactions := withReaction(reactionsFromMetadata(metadata), reaction)
+	metadata["reactions"] = reactions
+	if err := a.DB.Model(message).Update("metadata", metadata).Error; err != nil {
+		return nil, err
+	}
+
+	if a.WSHub != nil {
+		a.WSHub.BroadcastToOrg(orgID, websocket.WSMessage{
+			Type: "reaction_update",
+			Payload: map[string]any{
+				"message_id": message.ID.String(),
+				"contact_id": contactID.String(),
+				"reactions":  reactions,
+			},
+		})
+	}
+	return reactions, nil
+}
+
+// reactionEmojiFromConfig reads the emoji a flow reaction step reacts with
+func reactionEmojiFromConfig(config map[string]interface{}) (string, error) {
+	emoji := strings.TrimSpace(getStringFromMap(config, "emoji"))
+	if emoji == "" {
+		return "", errors.New("emoji is required")
+	}
+	return emoji, nil
+}
+
+// reactToLastIncomingMessage reacts to the customer's latest message on behalf of
+// the chatbot, e.g. a 👍 to acknowledge it
+func (a *App) reactToLastIncomingMessage(account *models.WhatsAppAccount, contact *models.Contact, emoji string) error {
+	var message models.Message
+	if err := a.DB.Where("contact_id = ? AND direction = ? AND whats_app_message_id <> ''", contact.ID, models.DirectionIncoming).
+		Order("created_at DESC").First(&message).Error; err != nil {
+		return fmt.Errorf("no message to react to: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := a.WhatsApp.SendReaction(ctx, a.toWhatsAppAccount(account), contact.PhoneNumber, message.WhatsAppMessageID, emoji); err != nil {
+		return err
+	}
+
+	_, err := a.saveReaction(contact.OrganizationID, contact.ID, &message, Reaction{Emoji: emoji, FromChatbot: true})
+	return err
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithReaction(t *testing.T) {
+	// Reactions as read back from the jsonb metadata column
+	metadata := models.JSONB{"reactions": []interface{}{
+		map[string]interface{}{"emoji": "❤️", "from_phone": "15551234567"},
+		map[string]interface{}{"emoji": "👍", "from_user": "agent-1"},
+	}}
+	reactions := reactionsFromMetadata(metadata)
+	assert.Equal(t, []Reaction{
+		{Emoji: "❤️", FromPhone: "15551234567"},
+		{Emoji: "👍", FromUser: "agent-1"},
+	}, reactions)
+
+	// A sender's new reaction replaces their previous one, other senders keep theirs
+	reactions = withReaction(reactions, Reaction{Emoji: "😂", FromPhone: "15551234567"})
+	assert.Equal(t, []Reaction{
+		{Emoji: "👍", FromUser: "agent-1"},
+		{Emoji: "😂", FromPhone: "15551234567"},
+	}, reactions)
+
+	reactions = withReaction(reactions, Reaction{Emoji: "👍", FromChatbot: true})
+	assert.Len(t, reactions, 3)
+
+	// An empty emoji removes the sender's reaction
+	reactions = withReaction(reactions, Reaction{FromUser: "agent-1"})
+	assert.Equal(t, []Reaction{
+		{Emoji: "😂", FromPhone: "15551234567"},
+		{Emoji: "👍", FromChatbot: true},
+	}, reactions)
+
+	assert.Empty(t, reactionsFromMetadata(nil))
+}
+
+func TestReactionEmojiFromConfig(t *testing.T) {
+	emoji, err := reactionEmojiFromConfig(map[string]interface{}{"emoji": " 👍 "})
+	assert.NoError(t, err)
+	assert.Equal(t, "👍", emoji)
+
+	_, err = reactionEmojiFromConfig(map[string]interface{}{})
+	assert.ErrorContains(t, err, "emoji is required")
+}
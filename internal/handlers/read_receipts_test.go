@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkReadAfterChatbotReply(t *testing.T) {
+	var mu sync.Mutex
+	var receipts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["status"] == "read" {
+			mu.Lock()
+			receipts = append(receipts, body["message_id"].(string))
+			mu.Unlock()
+		}
+		_ = json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	}))
+	defer server.Close()
+
+	log := testutil.NopLogger()
+	app := &App{
+		Config:   &config.Config{},
+		DB:       testutil.SetupTestDB(t),
+		Log:      log,
+		WhatsApp: whatsapp.NewWithBaseURL(log, server.URL),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Receipts Org " + uuid.New().String()[:8],
+		Slug:      "receipts-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{OrganizationID: org.ID, Name: "receipts-account", PhoneID: "phone-123", APIVersion: "v18.0"}
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1555" + uuid.New().String()[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+
+	markRead := func() []string {
+		app.markReadAfterChatbotReply(account, contact.ID, "wamid.incoming")
+		app.wg.Wait()
+		mu.Lock()
+		defer mu.Unlock()
+		sent := receipts
+		receipts = nil
+		return sent
+	}
+
+	// Off by default, even after a chatbot reply
+	app.UpdateContactChatbotMessage(contact.ID)
+	assert.Empty(t, markRead())
+
+	// No receipt until the chatbot has replied
+	account.AutoReadReceipt = true
+	app.ClearContactChatbotTracking(contact.ID)
+	assert.Empty(t, markRead())
+
+	app.UpdateContactChatbotMessage(contact.ID)
+	assert.Equal(t, []string{"wamid.incoming"}, markRead())
+}
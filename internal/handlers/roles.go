@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"sort"
+
 	"github.com/google/uuid"
 	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/valyala/fasthttp"
@@ -144,6 +146,7 @@ func (a *App) CreateRole(r *fastglue.Request) error {
 		a.Log.Error("Failed to create role", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create role", nil, "")
 	}
+	a.recordAudit(r, roleAuditEntry(orgID, models.AuditActionCreate, role), nil, roleAuditSnapshot(role))
 
 	return r.SendEnvelope(roleToResponse(role, 0))
 }
@@ -173,6 +176,7 @@ func (a *App) UpdateRole(r *fastglue.Request) error {
 	if err := r.Decode(&req, "json"); err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
 	}
+	before := roleAuditSnapshot(role)
 
 	if role.IsSystem {
 		// Only allow description updates for system roles
@@ -183,6 +187,7 @@ func (a *App) UpdateRole(r *fastglue.Request) error {
 			a.Log.Error("Failed to update role", "error", err)
 			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update role", nil, "")
 		}
+		a.recordAudit(r, roleAuditEntry(orgID, models.AuditActionUpdate, role), before, roleAuditSnapshot(role))
 
 		var userCount int64
 		a.DB.Model(&models.User{}).Where("role_id = ?", role.ID).Count(&userCount)
@@ -235,6 +240,7 @@ func (a *App) UpdateRole(r *fastglue.Request) error {
 
 	// Invalidate permissions cache for all users with this role
 	a.InvalidateRolePermissionsCache(role.ID)
+	a.recordAudit(r, roleAuditEntry(orgID, models.AuditActionUpdate, role), before, roleAuditSnapshot(role))
 
 	var userCount int64
 	a.DB.Model(&models.User{}).Where("role_id = ?", role.ID).Count(&userCount)
@@ -255,7 +261,7 @@ func (a *App) DeleteRole(r *fastglue.Request) error {
 	}
 
 	var role models.CustomRole
-	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&role).Error; err != nil {
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).Preload("Permissions").First(&role).Error; err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Role not found", nil, "")
 	}
 
@@ -276,6 +282,7 @@ func (a *App) DeleteRole(r *fastglue.Request) error {
 		a.Log.Error("Failed to delete role", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete role", nil, "")
 	}
+	a.recordAudit(r, roleAuditEntry(orgID, models.AuditActionDelete, role), roleAuditSnapshot(role), nil)
 
 	return r.SendEnvelope(map[string]string{"message": "Role deleted successfully"})
 }
@@ -373,3 +380,30 @@ func splitPermissionKey(key string) []string {
 	}
 	return nil
 }
+
+// roleAuditEntry returns an audit log entry for a change to a role
+func roleAuditEntry(orgID uuid.UUID, action string, role models.CustomRole) models.AuditLog {
+	return models.AuditLog{
+		OrganizationID: orgID,
+		Action:         action,
+		ResourceType:   models.AuditResourceRole,
+		ResourceID:     &role.ID,
+		ResourceName:   role.Name,
+	}
+}
+
+// roleAuditSnapshot captures a role for the audit log, with its permissions as
+// sorted "resource:action" keys
+func roleAuditSnapshot(role models.CustomRole) map[string]interface{} {
+	keys := make([]string, len(role.Permissions))
+	for i, p := range role.Permissions {
+		keys[i] = p.Resource + ":" + p.Action
+	}
+	sort.Strings(keys)
+	return auditSnapshot(map[string]interface{}{
+		"name":        role.Name,
+		"description": role.Description,
+		"is_default":  role.IsDefault,
+		"permissions": keys,
+	})
+}
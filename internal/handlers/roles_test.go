@@ -448,3 +448,61 @@ func TestApp_ListPermissions_Success(t *testing.T) {
 		assert.Equal(t, perm.Resource+":"+perm.Action, perm.Key)
 	}
 }
+
+func TestApp_AssignUserRole_ByName(t *testing.T) {
+	app := testApp(t)
+	org := createTestOrganization(t, app)
+	permissions := getOrCreateTestPermissions(t, app)
+
+	adminRole := createTestRole(t, app, org.ID, "admin", true, false, permissions)
+	viewerRole := createTestRole(t, app, org.ID, "viewer", true, false, nil)
+	admin := createTestUser(t, app, org.ID, uniqueEmail("assign-admin"), "password123", &adminRole.ID, true)
+	target := createTestUser(t, app, org.ID, uniqueEmail("assign-target"), "password123", nil, true)
+
+	req := testutil.NewJSONRequest(t, handlers.AssignRoleRequest{Role: "viewer"})
+	req.RequestCtx.SetUserValue("user_id", admin.ID)
+	req.RequestCtx.SetUserValue("organization_id", org.ID)
+	req.RequestCtx.SetUserValue("id", target.ID.String())
+
+	require.NoError(t, app.AssignUserRole(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var updated models.User
+	require.NoError(t, app.DB.First(&updated, "id = ?", target.ID).Error)
+	require.NotNil(t, updated.RoleID)
+	assert.Equal(t, viewerRole.ID, *updated.RoleID)
+}
+
+func TestApp_AssignUserRole_LastAdmin(t *testing.T) {
+	app := testApp(t)
+	org := createTestOrganization(t, app)
+	permissions := getOrCreateTestPermissions(t, app)
+
+	adminRole := createTestRole(t, app, org.ID, "admin", true, false, permissions)
+	agentRole := createTestRole(t, app, org.ID, "agent", true, true, nil)
+	admin := createTestUser(t, app, org.ID, uniqueEmail("self-demote"), "password123", &adminRole.ID, true)
+
+	req := testutil.NewJSONRequest(t, handlers.AssignRoleRequest{RoleID: &agentRole.ID})
+	req.RequestCtx.SetUserValue("user_id", admin.ID)
+	req.RequestCtx.SetUserValue("organization_id", org.ID)
+	req.RequestCtx.SetUserValue("id", admin.ID.String())
+
+	require.NoError(t, app.AssignUserRole(req))
+	assert.Equal(t, fasthttp.StatusBadRequest, testutil.GetResponseStatusCode(req))
+}
+
+func TestApp_AssignUserRole_Forbidden(t *testing.T) {
+	app := testApp(t)
+	org := createTestOrganization(t, app)
+
+	viewerRole := createTestRole(t, app, org.ID, "viewer", true, false, nil)
+	viewer := createTestUser(t, app, org.ID, uniqueEmail("assign-viewer"), "password123", &viewerRole.ID, true)
+
+	req := testutil.NewJSONRequest(t, handlers.AssignRoleRequest{Role: "viewer"})
+	req.RequestCtx.SetUserValue("user_id", viewer.ID)
+	req.RequestCtx.SetUserValue("organization_id", org.ID)
+	req.RequestCtx.SetUserValue("id", viewer.ID.String())
+
+	require.NoError(t, app.AssignUserRole(req))
+	assert.Equal(t, fasthttp.StatusForbidden, testutil.GetResponseStatusCode(req))
+}
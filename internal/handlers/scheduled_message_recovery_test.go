@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailStaleScheduledMessages(t *testing.T) {
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger()}
+
+	org := models.Organization{Name: "Scheduled", Slug: "scheduled-" + uuid.New().String()[:8]}
+	require.NoError(t, app.DB.Create(&org).Error)
+	contact := models.Contact{OrganizationID: org.ID, PhoneNumber: "1555" + uuid.New().String()[:7]}
+	require.NoError(t, app.DB.Create(&contact).Error)
+
+	newMessage := func(claimedAt time.Time) *models.ScheduledMessage {
+		sm := &models.ScheduledMessage{
+			OrganizationID: org.ID,
+			ContactID:      contact.ID,
+			Content:        "Hello",
+			SendAt:         claimedAt,
+			Status:         models.ScheduledMessageStatusSending,
+		}
+		require.NoError(t, app.DB.Create(sm).Error)
+		require.NoError(t, app.DB.Model(sm).UpdateColumn("updated_at", claimedAt).Error)
+		return sm
+	}
+	stale := newMessage(time.Now().Add(-time.Hour))
+	inFlight := newMessage(time.Now())
+
+	app.failStaleScheduledMessages(time.Now().Add(-scheduledSendTimeout))
+
+	var got models.ScheduledMessage
+	require.NoError(t, app.DB.First(&got, "id = ?", stale.ID).Error)
+	assert.Equal(t, models.ScheduledMessageStatusFailed, got.Status)
+	assert.Equal(t, errScheduledSendInterrupted.Error(), got.ErrorMessage)
+
+	var letters int64
+	app.DB.Model(&models.DeadLetter{}).Where("reference_id = ?", stale.ID).Count(&letters)
+	assert.Equal(t, int64(1), letters)
+
+	require.NoError(t, app.DB.First(&got, "id = ?", inFlight.ID).Error)
+	assert.Equal(t, models.ScheduledMessageStatusSending, got.Status)
+}
@@ -0,0 +1,847 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// ScheduleMessageRequest is a conversation reply with an optional delivery time.
+// local_send_at is a wall-clock time in timezone, or in the contact's timezone when
+// timezone is omitted, used when send_at is omitted.
+type ScheduleMessageRequest struct {
+	SendMessageRequest
+	SendAt                 *time.Time        `json:"send_at"`
+	LocalSendAt            string            `json:"local_send_at"`
+	Timezone               string            `json:"timezone"`
+	FallbackTemplateID     string            `json:"fallback_template_id"`
+	FallbackTemplateParams map[string]string `json:"fallback_template_params"`
+}
+
+// CreateScheduledMessageRequest schedules a text or template message to a contact
+// or phone number. local_send_at is a wall-clock time in timezone, or in the
+// contact's timezone when timezone is omitted, used when send_at is omitted.
+type CreateScheduledMessageRequest struct {
+	ContactID              string             `json:"contact_id"`
+	PhoneNumber            string             `json:"phone_number"` // Alternative to contact_id, the contact is created if needed
+	AccountName            string             `json:"account_name"` // Optional: specific WhatsApp account
+	Type                   models.MessageType `json:"type"`         // text (default) or template
+	Content                string             `json:"content"`
+	TemplateID             string             `json:"template_id"`
+	TemplateName           string             `json:"template_name"` // Alternative to template_id
+	Language               string             `json:"language"`      // Optional: language of template_name, e.g. en_US
+	TemplateParams         map[string]string  `json:"template_params"`
+	SendAt                 *time.Time         `json:"send_at"`
+	LocalSendAt            string             `json:"local_send_at"`
+	Timezone               string             `json:"timezone"`
+	FallbackTemplateID     string             `json:"fallback_template_id"`
+	FallbackTemplateParams map[string]string  `json:"fallback_template_params"`
+}
+
+// RescheduleMessageRequest moves a scheduled message and, for text messages,
+// changes its content. local_send_at is read in timezone, then in the timezone the
+// message was scheduled in, then in the contact's.
+type RescheduleMessageRequest struct {
+	SendAt      *time.Time `json:"send_at"`
+	LocalSendAt string     `json:"local_send_at"`
+	Timezone    string     `json:"timezone"`
+	Content     *string    `json:"content"`
+}
+
+// ScheduledMessageResponse represents a scheduled message in API responses
+type ScheduledMessageResponse struct {
+	ID                     uuid.UUID                     `json:"id"`
+	ContactID              uuid.UUID                     `json:"contact_id"`
+	WhatsAppAccount        string                        `json:"whatsapp_account"`
+	MessageType            models.MessageType            `json:"message_type"`
+	Content                string                        `json:"content"`
+	TemplateID             *uuid.UUID                    `json:"template_id,omitempty"`
+	TemplateName           string                        `json:"template_name,omitempty"`
+	TemplateParams         models.JSONB                  `json:"template_params,omitempty"`
+	SendAt                 time.Time                     `json:"send_at"`
+	Timezone               string                        `json:"timezone,omitempty"`
+	Status                 models.ScheduledMessageStatus `json:"status"`
+	FallbackTemplateID     *uuid.UUID                    `json:"fallback_template_id,omitempty"`
+	FallbackTemplateName   string                        `json:"fallback_template_name,omitempty"`
+	FallbackTemplateParams models.JSONB                  `json:"fallback_template_params,omitempty"`
+	SentAsTemplate         bool                          `json:"sent_as_template"`
+	MessageID              *uuid.UUID                    `json:"message_id,omitempty"`
+	SentAt                 *time.Time                    `json:"sent_at,omitempty"`
+	ErrorMessage           string                        `json:"error_message,omitempty"`
+	WindowExpiresAt        *time.Time                    `json:"window_expires_at,omitempty"`
+	WillSendAsTemplate     bool                          `json:"will_send_as_template"`
+	CreatedByID            uuid.UUID                     `json:"created_by_id"`
+	CreatedAt              time.Time                     `json:"created_at"`
+}
+
+// SendConversationMessage sends a reply in a conversation, or schedules it when send_at is in the future.
+// If the 24-hour customer service window will have closed by send_at, the fallback template is sent instead.
+func (a *App) SendConversationMessage(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	var req ScheduleMessageRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	// No delivery time, send right away
+	if (req.SendAt == nil && req.LocalSendAt == "") || (req.SendAt != nil && !req.SendAt.After(time.Now())) {
+		return a.SendMessage(r)
+	}
+
+	if req.Type != "" && req.Type != models.MessageTypeText {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Only text messages can be scheduled", nil, "")
+	}
+	content := strings.TrimSpace(req.Content.Body)
+	if content == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Message content is required", nil, "")
+	}
+
+	contactID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact ID", nil, "")
+	}
+
+	// Users without full read permission can only message their assigned contacts
+	var contact models.Contact
+	query := a.DB.Where("id = ? AND organization_id = ?", contactID, orgID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("assigned_user_id = ?", userID)
+	}
+	if err := query.First(&contact).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
+	}
+
+	sendAt, errMsg := a.scheduledSendAt(req.SendAt, req.LocalSendAt, req.Timezone, &contact)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, errMsg, nil, "")
+	}
+
+	account, err := a.resolveWhatsAppAccount(orgID, contact.WhatsAppAccount)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	scheduled := models.ScheduledMessage{
+		OrganizationID:  orgID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		MessageType:     models.MessageTypeText,
+		Content:         content,
+		SendAt:          sendAt,
+		Timezone:        strings.TrimSpace(req.Timezone),
+		Status:          models.ScheduledMessageStatusScheduled,
+		CreatedByID:     userID,
+	}
+	if errMsg, status := a.setScheduledFallback(&scheduled, &contact, req.FallbackTemplateID, req.FallbackTemplateParams); errMsg != "" {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	if err := a.DB.Omit("Template", "FallbackTemplate").Create(&scheduled).Error; err != nil {
+		a.Log.Error("Failed to schedule message", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to schedule message", nil, "")
+	}
+
+	a.Log.Info("Message scheduled", "scheduled_message_id", scheduled.ID, "contact_id", contact.ID, "send_at", scheduled.SendAt)
+
+	return r.SendEnvelope(a.scheduledMessageResponse(scheduled, &contact))
+}
+
+// CreateScheduledMessage schedules a text or template message to a contact at a
+// future time. Text messages fall back to a template if the 24-hour customer service
+// window has closed by then; template messages are sent as they are.
+func (a *App) CreateScheduledMessage(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	var req CreateScheduledMessageRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	if req.ContactID == "" && req.PhoneNumber == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Either contact_id or phone_number is required", nil, "")
+	}
+	if req.Type == "" {
+		req.Type = models.MessageTypeText
+	}
+	if req.Type != models.MessageTypeText && req.Type != models.MessageTypeTemplate {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "type must be text or template", nil, "")
+	}
+	content := strings.TrimSpace(req.Content)
+	if req.Type == models.MessageTypeText && content == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Message content is required", nil, "")
+	}
+	if req.Type == models.MessageTypeTemplate && req.TemplateID == "" && req.TemplateName == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Either template_name or template_id is required", nil, "")
+	}
+
+	contact, errMsg, status := a.scheduleContact(orgID, userID, req.ContactID, req.PhoneNumber)
+	if contact == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	sendAt, errMsg := a.scheduledSendAt(req.SendAt, req.LocalSendAt, req.Timezone, contact)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, errMsg, nil, "")
+	}
+
+	scheduled := models.ScheduledMessage{
+		OrganizationID: orgID,
+		ContactID:      contact.ID,
+		MessageType:    req.Type,
+		SendAt:         sendAt,
+		Timezone:       strings.TrimSpace(req.Timezone),
+		Status:         models.ScheduledMessageStatusScheduled,
+		CreatedByID:    userID,
+	}
+
+	accountName := req.AccountName
+	if req.Type == models.MessageTypeTemplate {
+		template, errMsg, status := a.findScheduledTemplate(orgID, req.TemplateID, req.TemplateName, req.Language, req.AccountName)
+		if template == nil {
+			return r.SendErrorEnvelope(status, errMsg, nil, "")
+		}
+		if missingParams, paramNames := missingTemplateParams(template, req.TemplateParams); len(missingParams) > 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+				fmt.Sprintf("Missing template parameters: %s. Expected parameters: %v", strings.Join(missingParams, ", "), paramNames),
+				nil, "")
+		}
+		scheduled.TemplateID = &template.ID
+		scheduled.TemplateParams = stringMapToJSONB(req.TemplateParams)
+		scheduled.Template = template
+		if accountName == "" {
+			accountName = template.WhatsAppAccount
+		}
+	} else {
+		scheduled.Content = content
+		if errMsg, status := a.setScheduledFallback(&scheduled, contact, req.FallbackTemplateID, req.FallbackTemplateParams); errMsg != "" {
+			return r.SendErrorEnvelope(status, errMsg, nil, "")
+		}
+	}
+
+	if accountName == "" {
+		accountName = contact.WhatsAppAccount
+	}
+	account, err := a.resolveWhatsAppAccount(orgID, accountName)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	scheduled.WhatsAppAccount = account.Name
+
+	if err := a.DB.Omit("Template", "FallbackTemplate").Create(&scheduled).Error; err != nil {
+		a.Log.Error("Failed to schedule message", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to schedule message", nil, "")
+	}
+
+	a.Log.Info("Message scheduled", "scheduled_message_id", scheduled.ID, "contact_id", contact.ID, "type", scheduled.MessageType, "send_at", scheduled.SendAt)
+
+	return r.SendEnvelope(a.scheduledMessageResponse(scheduled, contact))
+}
+
+// RescheduleScheduledMessage moves a message that has not been sent yet to a new
+// time, and can change the text of text messages
+func (a *App) RescheduleScheduledMessage(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	var req RescheduleMessageRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if req.SendAt == nil && req.LocalSendAt == "" && req.Content == nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "send_at, local_send_at or content is required", nil, "")
+	}
+
+	scheduled, contact, errMsg, status := a.accessibleScheduledMessage(r, orgID)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var sendAt *time.Time
+	timezone := strings.TrimSpace(req.Timezone)
+	if req.SendAt != nil || req.LocalSendAt != "" {
+		if timezone == "" {
+			timezone = scheduled.Timezone
+		}
+		t, errMsg := a.scheduledSendAt(req.SendAt, req.LocalSendAt, timezone, contact)
+		if errMsg != "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, errMsg, nil, "")
+		}
+		sendAt = &t
+	}
+
+	if errMsg, status := a.updateScheduledMessage(scheduled, contact, sendAt, req.Content, timezone); errMsg != "" {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	if err := a.DB.Preload("Template").Preload("FallbackTemplate").First(scheduled, "id = ?", scheduled.ID).Error; err != nil {
+		a.Log.Error("Failed to load scheduled message", "error", err, "scheduled_message_id", scheduled.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load scheduled message", nil, "")
+	}
+
+	a.Log.Info("Message rescheduled", "scheduled_message_id", scheduled.ID, "send_at", scheduled.SendAt)
+
+	return r.SendEnvelope(a.scheduledMessageResponse(*scheduled, contact))
+}
+
+// ListScheduledMessages returns the messages scheduled in a conversation
+func (a *App) ListScheduledMessages(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	contact, errMsg, status := a.accessibleContact(r, orgID)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	query := a.DB.Where("organization_id = ? AND contact_id = ?", orgID, contact.ID).
+		Preload("Template").
+		Preload("FallbackTemplate")
+	if status := string(r.RequestCtx.QueryArgs().Peek("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var scheduled []models.ScheduledMessage
+	if err := query.Order("send_at ASC").Find(&scheduled).Error; err != nil {
+		a.Log.Error("Failed to list scheduled messages", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list scheduled messages", nil, "")
+	}
+
+	result := make([]ScheduledMessageResponse, len(scheduled))
+	for i, sm := range scheduled {
+		result[i] = a.scheduledMessageResponse(sm, contact)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"scheduled_messages": result,
+	})
+}
+
+// CancelScheduledMessage cancels a message that has not been sent yet
+func (a *App) CancelScheduledMessage(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	scheduled, _, errMsg, status := a.accessibleScheduledMessage(r, orgID)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	// Only cancel if the processor has not picked it up in the meantime
+	result := a.DB.Model(scheduled).
+		Where("status = ?", models.ScheduledMessageStatusScheduled).
+		Update("status", models.ScheduledMessageStatusCancelled)
+	if result.Error != nil {
+		a.Log.Error("Failed to cancel scheduled message", "error", result.Error)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to cancel scheduled message", nil, "")
+	}
+	if result.RowsAffected == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Scheduled message has already been sent or cancelled", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Scheduled message cancelled",
+		"status":  models.ScheduledMessageStatusCancelled,
+	})
+}
+
+// accessibleScheduledMessage loads the scheduled message in the request path and
+// its contact. Users without full contact read permission can only access messages
+// scheduled to their assigned contacts.
+func (a *App) accessibleScheduledMessage(r *fastglue.Request, orgID uuid.UUID) (*models.ScheduledMessage, *models.Contact, string, int) {
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, nil, "Invalid scheduled message ID", fasthttp.StatusBadRequest
+	}
+
+	var scheduled models.ScheduledMessage
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&scheduled).Error; err != nil {
+		return nil, nil, "Scheduled message not found", fasthttp.StatusNotFound
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	var contact models.Contact
+	query := a.DB.Where("id = ? AND organization_id = ?", scheduled.ContactID, orgID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		query = query.Where("assigned_user_id = ?", userID)
+	}
+	if err := query.First(&contact).Error; err != nil {
+		// Don't reveal messages scheduled to contacts the user can't access
+		return nil, nil, "Scheduled message not found", fasthttp.StatusNotFound
+	}
+	return &scheduled, &contact, "", 0
+}
+
+// scheduledSendAt returns the delivery time of a scheduled message: sendAt, or
+// localSendAt read in timezone, or in the contact's timezone when timezone is empty.
+// The error message is empty when the time is valid and in the future.
+func (a *App) scheduledSendAt(sendAt *time.Time, localSendAt, timezone string, contact *models.Contact) (time.Time, string) {
+	loc := a.contactLocation(contact)
+	if timezone = strings.TrimSpace(timezone); timezone != "" {
+		l, err := time.LoadLocation(timezone)
+		if err != nil {
+			return time.Time{}, "Invalid timezone"
+		}
+		loc = l
+	}
+
+	if sendAt != nil {
+		if !sendAt.After(time.Now()) {
+			return time.Time{}, "send_at must be in the future"
+		}
+		return *sendAt, ""
+	}
+	if localSendAt == "" {
+		return time.Time{}, "send_at or local_send_at is required"
+	}
+	t, err := parseLocalTime(localSendAt, loc)
+	if err != nil {
+		return time.Time{}, "Invalid local_send_at, expected YYYY-MM-DDTHH:MM"
+	}
+	if !t.After(time.Now()) {
+		return time.Time{}, "local_send_at must be in the future"
+	}
+	return t, ""
+}
+
+// scheduleContact finds the contact a message is scheduled to, by ID or phone number.
+// Unknown numbers are saved as contacts, except for users who can only message
+// their assigned contacts.
+func (a *App) scheduleContact(orgID, userID uuid.UUID, contactID, phoneNumber string) (*models.Contact, string, int) {
+	canReadAll := a.HasPermission(userID, models.ResourceContacts, models.ActionRead)
+
+	if contactID != "" {
+		id, err := uuid.Parse(contactID)
+		if err != nil {
+			return nil, "Invalid contact_id", fasthttp.StatusBadRequest
+		}
+		var contact models.Contact
+		query := a.DB.Where("id = ? AND organization_id = ?", id, orgID)
+		if !canReadAll {
+			query = query.Where("assigned_user_id = ?", userID)
+		}
+		if err := query.First(&contact).Error; err != nil {
+			return nil, "Contact not found", fasthttp.StatusNotFound
+		}
+		return &contact, "", 0
+	}
+
+	if !canReadAll {
+		var contact models.Contact
+		if err := a.DB.Where("phone_number = ? AND organization_id = ? AND assigned_user_id = ?", phoneNumber, orgID, userID).
+			First(&contact).Error; err != nil {
+			return nil, "Contact not found", fasthttp.StatusNotFound
+		}
+		return &contact, "", 0
+	}
+
+	contact, _ := a.getOrCreateContact(orgID, phoneNumber, "")
+	if contact.ID == uuid.Nil {
+		return nil, "Failed to create contact", fasthttp.StatusInternalServerError
+	}
+	return contact, "", 0
+}
+
+// findScheduledTemplate finds the approved template a scheduled template message
+// sends, by ID or by name and language
+func (a *App) findScheduledTemplate(orgID uuid.UUID, templateID, templateName, language, accountName string) (*models.Template, string, int) {
+	var template models.Template
+	if templateID != "" {
+		id, err := uuid.Parse(templateID)
+		if err != nil {
+			return nil, "Invalid template_id", fasthttp.StatusBadRequest
+		}
+		if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&template).Error; err != nil {
+			return nil, "Template not found", fasthttp.StatusNotFound
+		}
+	} else {
+		t, err := a.findTemplateByName(orgID, templateName, language, accountName)
+		if err != nil {
+			return nil, "Template not found", fasthttp.StatusNotFound
+		}
+		template = *t
+	}
+
+	if template.Status != string(models.TemplateStatusApproved) {
+		return nil, fmt.Sprintf("Template is not approved (status: %s)", template.Status), fasthttp.StatusBadRequest
+	}
+	return &template, "", 0
+}
+
+// setScheduledFallback sets the template a scheduled text message is sent as when the
+// 24-hour customer service window has closed by its send time. Without a fallback
+// template, the organization's service window template is used if the window will
+// have closed by then.
+func (a *App) setScheduledFallback(sm *models.ScheduledMessage, contact *models.Contact, templateID string, params map[string]string) (string, int) {
+	if templateID != "" {
+		id, err := uuid.Parse(templateID)
+		if err != nil {
+			return "Invalid fallback_template_id", fasthttp.StatusBadRequest
+		}
+		var template models.Template
+		if err := a.DB.Where("id = ? AND organization_id = ?", id, sm.OrganizationID).First(&template).Error; err != nil {
+			return "Fallback template not found", fasthttp.StatusNotFound
+		}
+		if template.Status != string(models.TemplateStatusApproved) {
+			return fmt.Sprintf("Fallback template is not approved (status: %s)", template.Status), fasthttp.StatusBadRequest
+		}
+		if missingParams, paramNames := missingTemplateParams(&template, params); len(missingParams) > 0 {
+			return fmt.Sprintf("Missing fallback template parameters: %s. Expected parameters: %v", strings.Join(missingParams, ", "), paramNames),
+				fasthttp.StatusBadRequest
+		}
+		sm.FallbackTemplateID = &template.ID
+		sm.FallbackTemplateParams = stringMapToJSONB(params)
+		sm.FallbackTemplate = &template
+		return "", 0
+	}
+
+	if isServiceWindowOpen(a.serviceWindowExpiresAt(contact), sm.SendAt) {
+		return "", 0
+	}
+
+	// Fall back to the organization's service window template when one is configured
+	orgTemplate, orgParams := a.serviceWindowFallbackTemplate(sm.OrganizationID)
+	if orgTemplate == nil {
+		return "The 24-hour customer service window will have closed by send_at; a fallback_template_id is required", fasthttp.StatusBadRequest
+	}
+	sm.FallbackTemplateID = &orgTemplate.ID
+	sm.FallbackTemplateParams = stringMapToJSONB(orgParams)
+	sm.FallbackTemplate = orgTemplate
+	return "", 0
+}
+
+// updateScheduledMessage moves a scheduled message to sendAt and changes its text,
+// each when set, as long as it has not been sent or cancelled. timezone, when set,
+// is stored as the timezone the new time was given in.
+func (a *App) updateScheduledMessage(sm *models.ScheduledMessage, contact *models.Contact, sendAt *time.Time, content *string, timezone string) (string, int) {
+	isTemplate := sm.MessageType == models.MessageTypeTemplate
+
+	updates := map[string]interface{}{}
+	if content != nil {
+		if isTemplate {
+			return "The content of template messages can't be edited", fasthttp.StatusBadRequest
+		}
+		text := strings.TrimSpace(*content)
+		if text == "" {
+			return "Message content is required", fasthttp.StatusBadRequest
+		}
+		updates["content"] = text
+	}
+	if sendAt != nil {
+		// The template fallback must still be available if the new time is
+		// after the customer service window closes
+		if !isTemplate && sm.FallbackTemplateID == nil && !isServiceWindowOpen(a.serviceWindowExpiresAt(contact), *sendAt) {
+			return "The 24-hour customer service window will have closed by send_at and the message has no fallback template", fasthttp.StatusBadRequest
+		}
+		updates["send_at"] = *sendAt
+	}
+	if timezone != "" {
+		updates["timezone"] = timezone
+	}
+
+	result := a.DB.Model(sm).Where("status = ?", models.ScheduledMessageStatusScheduled).Updates(updates)
+	if result.Error != nil {
+		a.Log.Error("Failed to update scheduled message", "error", result.Error)
+		return "Failed to update scheduled message", fasthttp.StatusInternalServerError
+	}
+	if result.RowsAffected == 0 {
+		return "Scheduled message has already been sent or cancelled", fasthttp.StatusBadRequest
+	}
+	return "", 0
+}
+
+// ScheduledMessageProcessor delivers scheduled conversation messages when they are due
+type ScheduledMessageProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewScheduledMessageProcessor creates a new scheduled message processor
+func NewScheduledMessageProcessor(app *App, interval time.Duration) *ScheduledMessageProcessor {
+	return &ScheduledMessageProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the scheduled message processing loop
+func (p *ScheduledMessageProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Scheduled message processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Scheduled message processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Scheduled message processor stopped")
+			return
+		case <-ticker.C:
+			p.processDueMessages(ctx)
+		}
+	}
+}
+
+// Stop stops the scheduled message processor
+func (p *ScheduledMessageProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// scheduledSendTimeout is how long a message can stay claimed as sending before
+// it's treated as interrupted, e.g. by a crash or restart
+const scheduledSendTimeout = 10 * time.Minute
+
+// processDueMessages sends scheduled messages whose send time has passed
+func (p *ScheduledMessageProcessor) processDueMessages(ctx context.Context) {
+	p.app.failStaleScheduledMessages(time.Now().Add(-scheduledSendTimeout))
+
+	var due []models.ScheduledMessage
+	if err := p.app.DB.Where("status = ? AND send_at <= ?", models.ScheduledMessageStatusScheduled, time.Now()).
+		Order("send_at ASC").
+		Limit(100).
+		Find(&due).Error; err != nil {
+		p.app.Log.Error("Failed to find due scheduled messages", "error", err)
+		return
+	}
+
+	for i := range due {
+		sm := &due[i]
+
+		// Claim the message so concurrent processors don't send it twice
+		result := p.app.DB.Model(sm).
+			Where("status = ?", models.ScheduledMessageStatusScheduled).
+			Update("status", models.ScheduledMessageStatusSending)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		p.app.deliverScheduledMessage(ctx, sm)
+	}
+}
+
+// errScheduledSendInterrupted is recorded for messages whose delivery didn't finish
+var errScheduledSendInterrupted = errors.New("delivery was interrupted, the message may not have been sent")
+
+// failStaleScheduledMessages marks messages claimed as sending before cutoff as
+// failed. They aren't sent again, as the interrupted delivery may have reached
+// WhatsApp already.
+func (a *App) failStaleScheduledMessages(cutoff time.Time) {
+	var stale []models.ScheduledMessage
+	if err := a.DB.Where("status = ? AND updated_at < ?", models.ScheduledMessageStatusSending, cutoff).
+		Limit(100).
+		Find(&stale).Error; err != nil {
+		a.Log.Error("Failed to find stale scheduled messages", "error", err)
+		return
+	}
+
+	for i := range stale {
+		sm := &stale[i]
+		result := a.DB.Model(sm).
+			Where("status = ? AND updated_at < ?", models.ScheduledMessageStatusSending, cutoff).
+			Updates(map[string]interface{}{
+				"status":        models.ScheduledMessageStatusFailed,
+				"error_message": errScheduledSendInterrupted.Error(),
+			})
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+		a.Log.Warn("Scheduled message delivery was interrupted", "scheduled_message_id", sm.ID)
+		a.recordDeadLetter(models.DeadLetter{
+			OrganizationID: sm.OrganizationID,
+			Kind:           models.DeadLetterKindScheduledMessage,
+			ReferenceID:    &sm.ID,
+		}, errScheduledSendInterrupted)
+	}
+}
+
+// errServiceWindowClosed is returned when a free-form message can no longer be sent
+var errServiceWindowClosed = errors.New("24-hour customer service window is closed and no fallback template is set")
+
+// deliverScheduledMessage sends a claimed scheduled message. Template messages are
+// sent as they are; text is sent free-form while the customer service window is
+// open and as the fallback template otherwise.
+func (a *App) deliverScheduledMessage(ctx context.Context, sm *models.ScheduledMessage) {
+	var contact models.Contact
+	if err := a.DB.Where("id = ? AND organization_id = ?", sm.ContactID, sm.OrganizationID).First(&contact).Error; err != nil {
+		a.failScheduledMessage(sm, fmt.Errorf("contact not found"))
+		return
+	}
+
+	account, err := a.resolveWhatsAppAccount(sm.OrganizationID, sm.WhatsAppAccount)
+	if err != nil {
+		a.failScheduledMessage(sm, err)
+		return
+	}
+
+	msgReq := OutgoingMessageRequest{
+		Account: account,
+		Contact: &contact,
+		Type:    models.MessageTypeText,
+		Content: a.expandOrgShortcodes(sm.OrganizationID, sm.Content),
+	}
+
+	templateID, params, label := sm.FallbackTemplateID, sm.FallbackTemplateParams, "fallback template"
+	if sm.MessageType == models.MessageTypeTemplate {
+		templateID, params, label = sm.TemplateID, sm.TemplateParams, "template"
+		if templateID == nil {
+			a.failScheduledMessage(sm, fmt.Errorf("template not set"))
+			return
+		}
+	} else if isServiceWindowOpen(a.serviceWindowExpiresAt(&contact), time.Now()) {
+		templateID = nil
+	} else if templateID == nil {
+		a.failScheduledMessage(sm, errServiceWindowClosed)
+		return
+	}
+
+	sentAsTemplate := false
+	if templateID != nil {
+		var template models.Template
+		if err := a.DB.Where("id = ? AND organization_id = ?", *templateID, sm.OrganizationID).First(&template).Error; err != nil {
+			a.failScheduledMessage(sm, fmt.Errorf("%s not found", label))
+			return
+		}
+		if template.Status != string(models.TemplateStatusApproved) {
+			a.failScheduledMessage(sm, fmt.Errorf("%s is not approved (status: %s)", label, template.Status))
+			return
+		}
+		msgReq.Type = models.MessageTypeTemplate
+		msgReq.Content = ""
+		msgReq.Template = &template
+		msgReq.BodyParams = jsonbToStringMap(params)
+		sentAsTemplate = true
+	}
+
+	opts := DefaultSendOptions()
+	opts.SentByUserID = &sm.CreatedByID
+	opts.Async = false
+
+	message, err := a.SendOutgoingMessage(ctx, msgReq, opts)
+	if err != nil {
+		a.failScheduledMessage(sm, err)
+		return
+	}
+
+	status := models.ScheduledMessageStatusSent
+	var sent models.Message
+	if err := a.DB.Select("status", "error_message").Where("id = ?", message.ID).First(&sent).Error; err == nil &&
+		sent.Status == models.MessageStatusFailed {
+		status = models.ScheduledMessageStatusFailed
+		a.recordDeadLetter(models.DeadLetter{
+			OrganizationID: sm.OrganizationID,
+			Kind:           models.DeadLetterKindScheduledMessage,
+			ReferenceID:    &sm.ID,
+		}, errors.New(sent.ErrorMessage))
+	}
+
+	now := time.Now()
+	a.DB.Model(sm).Updates(map[string]interface{}{
+		"status":           status,
+		"sent_at":          now,
+		"message_id":       message.ID,
+		"sent_as_template": sentAsTemplate,
+		"error_message":    sent.ErrorMessage,
+	})
+
+	a.log(ctx).Info("Scheduled message delivered", "scheduled_message_id", sm.ID, "status", status, "as_template", sentAsTemplate)
+}
+
+// failScheduledMessage marks a scheduled message as failed, keeping it to be retried
+func (a *App) failScheduledMessage(sm *models.ScheduledMessage, err error) {
+	a.Log.Error("Failed to send scheduled message", "error", err, "scheduled_message_id", sm.ID)
+	a.DB.Model(sm).Updates(map[string]interface{}{
+		"status":        models.ScheduledMessageStatusFailed,
+		"error_message": err.Error(),
+	})
+	a.recordDeadLetter(models.DeadLetter{
+		OrganizationID: sm.OrganizationID,
+		Kind:           models.DeadLetterKindScheduledMessage,
+		ReferenceID:    &sm.ID,
+	}, err)
+}
+
+// stringMapToJSONB converts template parameters for storage
+func stringMapToJSONB(params map[string]string) models.JSONB {
+	result := models.JSONB{}
+	for k, v := range params {
+		result[k] = v
+	}
+	return result
+}
+
+// jsonbToStringMap converts stored template parameters back for sending
+func jsonbToStringMap(params models.JSONB) map[string]string {
+	result := make(map[string]string, len(params))
+	for k, v := range params {
+		result[k] = fmt.Sprint(v)
+	}
+	return result
+}
+
+// scheduledMessageResponse converts a scheduled message for API responses. While it
+// is still scheduled, it includes whether it will be sent as a template.
+func (a *App) scheduledMessageResponse(sm models.ScheduledMessage, contact *models.Contact) ScheduledMessageResponse {
+	resp := scheduledMessageToResponse(sm)
+	if sm.Status == models.ScheduledMessageStatusScheduled {
+		resp.WindowExpiresAt = a.serviceWindowExpiresAt(contact)
+		resp.WillSendAsTemplate = sm.MessageType == models.MessageTypeTemplate || !isServiceWindowOpen(resp.WindowExpiresAt, sm.SendAt)
+	}
+	return resp
+}
+
+func scheduledMessageToResponse(sm models.ScheduledMessage) ScheduledMessageResponse {
+	resp := ScheduledMessageResponse{
+		ID:                     sm.ID,
+		ContactID:              sm.ContactID,
+		WhatsAppAccount:        sm.WhatsAppAccount,
+		MessageType:            sm.MessageType,
+		Content:                sm.Content,
+		TemplateID:             sm.TemplateID,
+		TemplateParams:         sm.TemplateParams,
+		SendAt:                 sm.SendAt,
+		Timezone:               sm.Timezone,
+		Status:                 sm.Status,
+		FallbackTemplateID:     sm.FallbackTemplateID,
+		FallbackTemplateParams: sm.FallbackTemplateParams,
+		SentAsTemplate:         sm.SentAsTemplate,
+		MessageID:              sm.MessageID,
+		SentAt:                 sm.SentAt,
+		ErrorMessage:           sm.ErrorMessage,
+		CreatedByID:            sm.CreatedByID,
+		CreatedAt:              sm.CreatedAt,
+	}
+	if sm.Template != nil {
+		resp.TemplateName = sm.Template.Name
+	}
+	if sm.FallbackTemplate != nil {
+		resp.FallbackTemplateName = sm.FallbackTemplate.Name
+	}
+	return resp
+}
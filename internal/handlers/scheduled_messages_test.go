@@ -0,0 +1,317 @@
+package handlers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+// scheduleTestContact creates a contact assigned to a new user, with its last inbound message at lastInbound.
+func scheduleTestContact(t *testing.T, app *handlers.App, lastInbound time.Time) (*models.Organization, *models.User, *models.WhatsAppAccount, *models.Contact) {
+	t.Helper()
+
+	org := createTestOrg(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("schedule"), "password", nil, true)
+	account := createTestAccount(t, app, org.ID)
+	contact := createMsgTestContact(t, app, org.ID, account.Name)
+	require.NoError(t, app.DB.Model(contact).Update("assigned_user_id", user.ID).Error)
+
+	inbound := &models.Message{
+		BaseModel:       models.BaseModel{ID: uuid.New(), CreatedAt: lastInbound},
+		OrganizationID:  org.ID,
+		WhatsAppAccount: account.Name,
+		ContactID:       contact.ID,
+		Direction:       models.DirectionIncoming,
+		MessageType:     models.MessageTypeText,
+		Content:         "Hi",
+		Status:          models.MessageStatusReceived,
+	}
+	require.NoError(t, app.DB.Create(inbound).Error)
+
+	return org, user, account, contact
+}
+
+func TestApp_SendConversationMessage_SchedulesWithinWindow(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	sendAt := time.Now().Add(2 * time.Hour)
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"type":    "text",
+		"content": map[string]string{"body": "Following up on your order"},
+		"send_at": sendAt,
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.SendConversationMessage(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp handlers.ScheduledMessageResponse
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	assert.Equal(t, models.ScheduledMessageStatusScheduled, resp.Status)
+	assert.False(t, resp.WillSendAsTemplate)
+	assert.NotNil(t, resp.WindowExpiresAt)
+
+	// Nothing is sent until the scheduled time
+	assert.Empty(t, mockServer.sentMessages)
+}
+
+func TestApp_SendConversationMessage_WindowClosedRequiresTemplate(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"type":    "text",
+		"content": map[string]string{"body": "See you next week"},
+		"send_at": time.Now().Add(48 * time.Hour),
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.SendConversationMessage(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "fallback_template_id is required")
+}
+
+func TestApp_SendConversationMessage_WindowClosedUsesTemplate(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"type":                     "text",
+		"content":                  map[string]string{"body": "See you next week"},
+		"send_at":                  time.Now().Add(48 * time.Hour),
+		"fallback_template_id":     template.ID.String(),
+		"fallback_template_params": map[string]string{"1": "Alice"},
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.SendConversationMessage(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp handlers.ScheduledMessageResponse
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	assert.True(t, resp.WillSendAsTemplate)
+	assert.Equal(t, template.Name, resp.FallbackTemplateName)
+}
+
+func TestApp_SendConversationMessage_MissingFallbackParams(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"type":                 "text",
+		"content":              map[string]string{"body": "See you next week"},
+		"send_at":              time.Now().Add(48 * time.Hour),
+		"fallback_template_id": template.ID.String(),
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.SendConversationMessage(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "Missing fallback template parameters")
+}
+
+func TestApp_CancelScheduledMessage(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	scheduled := &models.ScheduledMessage{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		Content:         "Later",
+		SendAt:          time.Now().Add(time.Hour),
+		Status:          models.ScheduledMessageStatusScheduled,
+		CreatedByID:     user.ID,
+	}
+	require.NoError(t, app.DB.Create(scheduled).Error)
+
+	req := testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", scheduled.ID.String())
+
+	require.NoError(t, app.CancelScheduledMessage(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var updated models.ScheduledMessage
+	require.NoError(t, app.DB.Where("id = ?", scheduled.ID).First(&updated).Error)
+	assert.Equal(t, models.ScheduledMessageStatusCancelled, updated.Status)
+
+	// Cancelling twice is rejected
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", scheduled.ID.String())
+
+	require.NoError(t, app.CancelScheduledMessage(req))
+	assert.Equal(t, fasthttp.StatusBadRequest, testutil.GetResponseStatusCode(req))
+}
+
+func TestApp_CreateScheduledMessage_TemplateInTimezone(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	loc, err := time.LoadLocation("Asia/Kolkata")
+	require.NoError(t, err)
+	local := time.Now().In(loc).Add(72 * time.Hour).Truncate(time.Minute)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"contact_id":      contact.ID.String(),
+		"type":            "template",
+		"template_id":     template.ID.String(),
+		"template_params": map[string]string{"1": "Alice"},
+		"local_send_at":   local.Format("2006-01-02T15:04"),
+		"timezone":        "Asia/Kolkata",
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateScheduledMessage(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp handlers.ScheduledMessageResponse
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	assert.Equal(t, models.MessageTypeTemplate, resp.MessageType)
+	assert.Equal(t, template.Name, resp.TemplateName)
+	assert.Equal(t, "Asia/Kolkata", resp.Timezone)
+	assert.True(t, resp.SendAt.Equal(local))
+	// Templates don't need the service window, so no fallback is required
+	assert.True(t, resp.WillSendAsTemplate)
+	assert.Nil(t, resp.FallbackTemplateID)
+}
+
+func TestApp_CreateScheduledMessage_InvalidTimezone(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"contact_id":    contact.ID.String(),
+		"content":       "Reminder",
+		"local_send_at": time.Now().Add(time.Hour).Format("2006-01-02T15:04"),
+		"timezone":      "Mars/Olympus",
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateScheduledMessage(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "Invalid timezone")
+}
+
+func TestApp_RescheduleScheduledMessage(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+
+	scheduled := &models.ScheduledMessage{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		MessageType:     models.MessageTypeText,
+		Content:         "Later",
+		SendAt:          time.Now().Add(time.Hour),
+		Status:          models.ScheduledMessageStatusScheduled,
+		CreatedByID:     user.ID,
+	}
+	require.NoError(t, app.DB.Create(scheduled).Error)
+
+	t.Run("moving past the window needs a fallback template", func(t *testing.T) {
+		req := testutil.NewJSONRequest(t, map[string]any{"send_at": time.Now().Add(48 * time.Hour)})
+		setAuthContext(req, org.ID, user.ID)
+		testutil.SetPathParam(req, "id", scheduled.ID.String())
+
+		require.NoError(t, app.RescheduleScheduledMessage(req))
+		testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "no fallback template")
+	})
+
+	t.Run("within the window", func(t *testing.T) {
+		sendAt := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+		req := testutil.NewJSONRequest(t, map[string]any{"send_at": sendAt, "content": "A bit later"})
+		setAuthContext(req, org.ID, user.ID)
+		testutil.SetPathParam(req, "id", scheduled.ID.String())
+
+		require.NoError(t, app.RescheduleScheduledMessage(req))
+		assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+		var resp handlers.ScheduledMessageResponse
+		testutil.ParseEnvelopeResponse(t, req, &resp)
+		assert.True(t, resp.SendAt.Equal(sendAt))
+		assert.Equal(t, "A bit later", resp.Content)
+	})
+}
+
+func TestApp_ScheduledMessages_UnassignedContact(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	// Without contacts:read, other users can only see their assigned contacts
+	other := createTestUser(t, app, org.ID, uniqueEmail("schedule-other"), "password", nil, true)
+
+	scheduled := &models.ScheduledMessage{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		Content:         "Later",
+		SendAt:          time.Now().Add(time.Hour),
+		Status:          models.ScheduledMessageStatusScheduled,
+		CreatedByID:     user.ID,
+	}
+	require.NoError(t, app.DB.Create(scheduled).Error)
+
+	req := testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, other.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	require.NoError(t, app.ListScheduledMessages(req))
+	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
+
+	req = testutil.NewJSONRequest(t, map[string]any{"content": "Changed"})
+	setAuthContext(req, org.ID, other.ID)
+	testutil.SetPathParam(req, "id", scheduled.ID.String())
+	require.NoError(t, app.RescheduleScheduledMessage(req))
+	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
+
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, other.ID)
+	testutil.SetPathParam(req, "id", scheduled.ID.String())
+	require.NoError(t, app.CancelScheduledMessage(req))
+	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
+
+	var unchanged models.ScheduledMessage
+	require.NoError(t, app.DB.Where("id = ?", scheduled.ID).First(&unchanged).Error)
+	assert.Equal(t, models.ScheduledMessageStatusScheduled, unchanged.Status)
+	assert.Equal(t, "Later", unchanged.Content)
+
+	// The assigned user still sees them
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+	require.NoError(t, app.ListScheduledMessages(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"time"
+)
+
+// SecretRefreshProcessor re-resolves configuration values that reference secrets,
+// so rotated secrets are picked up without a restart
+type SecretRefreshProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewSecretRefreshProcessor creates a new secret refresh processor
+func NewSecretRefreshProcessor(app *App, interval time.Duration) *SecretRefreshProcessor {
+	return &SecretRefreshProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the secret refresh loop
+func (p *SecretRefreshProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Secret refresh processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Secret refresh processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Secret refresh processor stopped")
+			return
+		case <-ticker.C:
+			p.refreshSecrets(ctx)
+		}
+	}
+}
+
+// Stop stops the secret refresh processor
+func (p *SecretRefreshProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// refreshSecrets re-resolves secret references. Secrets that fail to resolve keep
+// their previous value. Rotated secrets are applied to a copy of the configuration,
+// which replaces the current one.
+func (p *SecretRefreshProcessor) refreshSecrets(ctx context.Context) {
+	p.app.configMu.Lock()
+	defer p.app.configMu.Unlock()
+
+	next := p.app.CurrentConfig().Clone()
+	changed, err := next.RefreshSecrets(ctx)
+	if err != nil {
+		p.app.Log.Error("Failed to refresh secrets", "error", err)
+	}
+	if len(changed) > 0 {
+		p.app.liveConfig.Store(next)
+		p.app.Log.Info("Rotated secrets picked up", "fields", changed)
+	}
+}
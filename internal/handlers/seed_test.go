@@ -0,0 +1,64 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/database"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_SeedDemo(t *testing.T) {
+	app := testApp(t)
+	if err := database.SeedDemo(app.DB); err != nil {
+		require.ErrorIs(t, err, database.ErrDemoExists)
+	}
+	assert.ErrorIs(t, database.SeedDemo(app.DB), database.ErrDemoExists, "seeding again doesn't duplicate the demo")
+
+	// The demo login works
+	req := testutil.NewJSONRequest(t, map[string]string{
+		"email":    database.DemoUserEmail,
+		"password": database.DemoUserPassword,
+	})
+	require.NoError(t, app.Login(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var login struct {
+		Data struct {
+			AccessToken string `json:"access_token"`
+			User        struct {
+				ID             uuid.UUID `json:"id"`
+				OrganizationID uuid.UUID `json:"organization_id"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &login))
+	assert.NotEmpty(t, login.Data.AccessToken)
+
+	// The demo admin sees the demo contacts
+	req = testutil.NewGETRequest(t)
+	req.RequestCtx.SetUserValue("user_id", login.Data.User.ID)
+	req.RequestCtx.SetUserValue("organization_id", login.Data.User.OrganizationID)
+	require.NoError(t, app.ListContacts(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var contacts struct {
+		Data struct {
+			Contacts []struct {
+				Name string `json:"name"`
+			} `json:"contacts"`
+			Total int64 `json:"total"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(testutil.GetResponseBody(req), &contacts))
+	assert.Equal(t, int64(4), contacts.Data.Total)
+	var names []string
+	for _, c := range contacts.Data.Contacts {
+		names = append(names, c.Name)
+	}
+	assert.Contains(t, names, "Alice Johnson")
+}
@@ -0,0 +1,455 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// segmentAttributePrefix marks a condition on a contact's custom field, e.g. "attribute.plan"
+const segmentAttributePrefix = "attribute."
+
+// segmentContactColumns maps the contact fields a segment can compare as text to their columns
+var segmentContactColumns = map[string]string{
+	"name":             "profile_name",
+	"phone_number":     "phone_number",
+	"whatsapp_account": "whats_app_account",
+	"language":         "language",
+	"timezone":         "timezone",
+	"opt_in_status":    "opt_in_status",
+}
+
+// segmentEngagementColumns maps the engagement fields, compared in days ago, to their columns
+var segmentEngagementColumns = map[string]string{
+	"last_seen_days":    "last_inbound_at",
+	"last_message_days": "last_message_at",
+	"created_days":      "created_at",
+}
+
+// SegmentCondition is a filter a contact must match to be in a segment
+type SegmentCondition struct {
+	Field    string                 `json:"field"`
+	Operator models.SegmentOperator `json:"operator"`
+	Value    string                 `json:"value"`
+}
+
+// SegmentRequest creates or updates a segment. On update, omitted fields keep their value.
+type SegmentRequest struct {
+	Name        string             `json:"name"`
+	Description *string            `json:"description"`
+	Conditions  []SegmentCondition `json:"conditions"`
+}
+
+// SegmentResponse is a segment with how many contacts it currently matches
+type SegmentResponse struct {
+	ID           uuid.UUID          `json:"id"`
+	Name         string             `json:"name"`
+	Description  string             `json:"description"`
+	Conditions   []SegmentCondition `json:"conditions"`
+	ContactCount int64              `json:"contact_count"`
+	CreatedAt    time.Time          `json:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
+}
+
+// ListSegments returns the organization's segments with their contact counts
+func (a *App) ListSegments(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var segments []models.Segment
+	if err := a.DB.Where("organization_id = ?", orgID).Order("name ASC").Find(&segments).Error; err != nil {
+		a.Log.Error("Failed to list segments", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list segments", nil, "")
+	}
+
+	result := make([]SegmentResponse, len(segments))
+	for i := range segments {
+		result[i] = a.segmentToResponse(&segments[i])
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"segments": result,
+	})
+}
+
+// GetSegment returns a segment with its contact count
+func (a *App) GetSegment(r *fastglue.Request) error {
+	segment, errMsg, status := a.findSegment(r, models.ActionRead)
+	if segment == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+	return r.SendEnvelope(a.segmentToResponse(segment))
+}
+
+// CreateSegment creates a segment
+func (a *App) CreateSegment(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req SegmentRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	segment := models.Segment{
+		OrganizationID: orgID,
+		Name:           strings.TrimSpace(req.Name),
+		CreatedByID:    &userID,
+	}
+	if segment.Name == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "name is required", nil, "")
+	}
+	if req.Description != nil {
+		segment.Description = strings.TrimSpace(*req.Description)
+	}
+	if err := validateSegmentConditions(req.Conditions); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	segment.Conditions = segmentConditionsToJSONB(req.Conditions)
+
+	if err := a.DB.Create(&segment).Error; err != nil {
+		a.Log.Error("Failed to create segment", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create segment", nil, "")
+	}
+
+	return r.SendEnvelope(a.segmentToResponse(&segment))
+}
+
+// UpdateSegment updates a segment
+func (a *App) UpdateSegment(r *fastglue.Request) error {
+	segment, errMsg, status := a.findSegment(r, models.ActionWrite)
+	if segment == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var req SegmentRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		segment.Name = name
+	}
+	if req.Description != nil {
+		segment.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Conditions != nil {
+		if err := validateSegmentConditions(req.Conditions); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		segment.Conditions = segmentConditionsToJSONB(req.Conditions)
+	}
+
+	if err := a.DB.Save(segment).Error; err != nil {
+		a.Log.Error("Failed to update segment", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update segment", nil, "")
+	}
+
+	a.InvalidateSegmentCountCache(segment.ID)
+
+	return r.SendEnvelope(a.segmentToResponse(segment))
+}
+
+// DeleteSegment deletes a segment. Its contacts are not changed.
+func (a *App) DeleteSegment(r *fastglue.Request) error {
+	segment, errMsg, status := a.findSegment(r, models.ActionWrite)
+	if segment == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	if err := a.DB.Delete(segment).Error; err != nil {
+		a.Log.Error("Failed to delete segment", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete segment", nil, "")
+	}
+
+	a.InvalidateSegmentCountCache(segment.ID)
+
+	return r.SendEnvelope(map[string]string{"message": "Segment deleted"})
+}
+
+// ListSegmentContacts returns a page of the contacts a segment currently matches
+func (a *App) ListSegmentContacts(r *fastglue.Request) error {
+	segment, errMsg, status := a.findSegment(r, models.ActionRead)
+	if segment == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	page, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("page")))
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query, err := a.segmentContactsQuery(segment.OrganizationID, decodeSegmentConditions(segment.Conditions))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		a.Log.Error("Failed to count segment contacts", "error", err, "segment_id", segment.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list segment contacts", nil, "")
+	}
+
+	var contacts []models.Contact
+	if err := query.Order("last_message_at DESC NULLS LAST, created_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&contacts).Error; err != nil {
+		a.Log.Error("Failed to list segment contacts", "error", err, "segment_id", segment.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list segment contacts", nil, "")
+	}
+
+	shouldMask := a.ShouldMaskPhoneNumbers(segment.OrganizationID)
+	now := time.Now()
+	response := make([]ContactResponse, len(contacts))
+	for i := range contacts {
+		response[i] = a.contactToResponse(&contacts[i], shouldMask, now)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"contacts": response,
+		"total":    total,
+		"page":     page,
+		"limit":    limit,
+	})
+}
+
+// PreviewSegment counts the contacts that match conditions, without saving a segment
+func (a *App) PreviewSegment(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req SegmentRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	query, err := a.segmentContactsQuery(orgID, req.Conditions)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		a.Log.Error("Failed to preview segment", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to preview segment", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"contact_count": count,
+	})
+}
+
+// findSegment returns the organization's segment named by the id path parameter if
+// the user may access contacts for the action, or an error message and status
+func (a *App) findSegment(r *fastglue.Request, action string) (*models.Segment, string, int) {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return nil, "Unauthorized", fasthttp.StatusUnauthorized
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceContacts, action) {
+		return nil, "Insufficient permissions", fasthttp.StatusForbidden
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, "Invalid segment ID", fasthttp.StatusBadRequest
+	}
+
+	var segment models.Segment
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&segment).Error; err != nil {
+		return nil, "Segment not found", fasthttp.StatusNotFound
+	}
+	return &segment, "", fasthttp.StatusOK
+}
+
+// segmentToResponse converts a segment for API responses. A count that can't be
+// worked out is logged and reported as 0.
+func (a *App) segmentToResponse(segment *models.Segment) SegmentResponse {
+	count, err := a.getSegmentCountCached(segment)
+	if err != nil {
+		a.Log.Error("Failed to count segment contacts", "error", err, "segment_id", segment.ID)
+	}
+	return SegmentResponse{
+		ID:           segment.ID,
+		Name:         segment.Name,
+		Description:  segment.Description,
+		Conditions:   decodeSegmentConditions(segment.Conditions),
+		ContactCount: count,
+		CreatedAt:    segment.CreatedAt,
+		UpdatedAt:    segment.UpdatedAt,
+	}
+}
+
+// segmentContactsQuery returns a query on the organization's contacts matching all the conditions
+func (a *App) segmentContactsQuery(orgID uuid.UUID, conditions []SegmentCondition) (*gorm.DB, error) {
+	query := a.DB.Model(&models.Contact{}).Where("organization_id = ?", orgID)
+	now := time.Now()
+	for i, cond := range conditions {
+		clause, args, err := segmentConditionSQL(cond, now)
+		if err != nil {
+			return nil, fmt.Errorf("condition %d: %w", i+1, err)
+		}
+		query = query.Where(clause, args...)
+	}
+	return query, nil
+}
+
+// segmentContacts returns the contacts a segment currently matches
+func (a *App) segmentContacts(segment *models.Segment) ([]models.Contact, error) {
+	query, err := a.segmentContactsQuery(segment.OrganizationID, decodeSegmentConditions(segment.Conditions))
+	if err != nil {
+		return nil, err
+	}
+	var contacts []models.Contact
+	if err := query.Order("created_at ASC").Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+	return contacts, nil
+}
+
+// findOrgSegment returns an organization's segment by ID
+func (a *App) findOrgSegment(orgID uuid.UUID, segmentID string) (*models.Segment, error) {
+	id, err := uuid.Parse(segmentID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid segment ID")
+	}
+	var segment models.Segment
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&segment).Error; err != nil {
+		return nil, fmt.Errorf("segment not found")
+	}
+	return &segment, nil
+}
+
+// validateSegmentConditions checks that every condition names a known field and an
+// operator that applies to it
+func validateSegmentConditions(conditions []SegmentCondition) error {
+	now := time.Now()
+	for i, cond := range conditions {
+		if _, _, err := segmentConditionSQL(cond, now); err != nil {
+			return fmt.Errorf("condition %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// segmentConditionSQL returns the WHERE clause on contacts for a condition. Tags
+// match whole tags, text fields and custom attributes compare case-insensitively,
+// and engagement fields take a number of days before now.
+func segmentConditionSQL(cond SegmentCondition, now time.Time) (string, []interface{}, error) {
+	field := strings.TrimSpace(cond.Field)
+
+	if field == "tags" {
+		tagJSON, _ := json.Marshal([]string{strings.TrimSpace(cond.Value)})
+		switch cond.Operator {
+		case models.SegmentOperatorContains, models.SegmentOperatorEquals:
+			return "tags @> ?", []interface{}{string(tagJSON)}, nil
+		case models.SegmentOperatorNotContains, models.SegmentOperatorNotEquals:
+			return "NOT (COALESCE(tags, '[]'::jsonb) @> ?)", []interface{}{string(tagJSON)}, nil
+		case models.SegmentOperatorIsEmpty:
+			return "jsonb_array_length(COALESCE(tags, '[]'::jsonb)) = 0", nil, nil
+		case models.SegmentOperatorIsNotEmpty:
+			return "jsonb_array_length(COALESCE(tags, '[]'::jsonb)) > 0", nil, nil
+		}
+		return "", nil, fmt.Errorf("operator %q does not apply to tags", cond.Operator)
+	}
+
+	if column, ok := segmentEngagementColumns[field]; ok {
+		switch cond.Operator {
+		case models.SegmentOperatorIsEmpty:
+			return column + " IS NULL", nil, nil
+		case models.SegmentOperatorIsNotEmpty:
+			return column + " IS NOT NULL", nil, nil
+		case models.SegmentOperatorGreaterThan, models.SegmentOperatorLessThan:
+			days, err := strconv.Atoi(strings.TrimSpace(cond.Value))
+			if err != nil || days < 0 {
+				return "", nil, fmt.Errorf("%s needs a number of days", field)
+			}
+			cutoff := now.AddDate(0, 0, -days)
+			if cond.Operator == models.SegmentOperatorGreaterThan {
+				return column + " < ?", []interface{}{cutoff}, nil
+			}
+			return column + " >= ?", []interface{}{cutoff}, nil
+		}
+		return "", nil, fmt.Errorf("operator %q does not apply to %s", cond.Operator, field)
+	}
+
+	var expr string
+	var args []interface{}
+	if key, ok := strings.CutPrefix(field, segmentAttributePrefix); ok && key != "" {
+		expr = "COALESCE(metadata->>?, '')"
+		args = []interface{}{key}
+	} else if column, ok := segmentContactColumns[field]; ok {
+		expr = "COALESCE(" + column + ", '')"
+	} else {
+		return "", nil, fmt.Errorf("unknown field %q", field)
+	}
+
+	value := strings.ToLower(strings.TrimSpace(cond.Value))
+	switch cond.Operator {
+	case models.SegmentOperatorEquals:
+		return "LOWER(" + expr + ") = ?", append(args, value), nil
+	case models.SegmentOperatorNotEquals:
+		return "LOWER(" + expr + ") <> ?", append(args, value), nil
+	case models.SegmentOperatorContains:
+		return "LOWER(" + expr + ") LIKE ?", append(args, "%"+value+"%"), nil
+	case models.SegmentOperatorNotContains:
+		return "LOWER(" + expr + ") NOT LIKE ?", append(args, "%"+value+"%"), nil
+	case models.SegmentOperatorIsEmpty:
+		return expr + " = ''", args, nil
+	case models.SegmentOperatorIsNotEmpty:
+		return expr + " <> ''", args, nil
+	}
+	return "", nil, fmt.Errorf("operator %q does not apply to %s", cond.Operator, field)
+}
+
+// segmentConditionsToJSONB converts conditions for storage
+func segmentConditionsToJSONB(conditions []SegmentCondition) models.JSONBArray {
+	result := models.JSONBArray{}
+	for _, cond := range conditions {
+		result = append(result, map[string]interface{}{
+			"field":    strings.TrimSpace(cond.Field),
+			"operator": cond.Operator,
+			"value":    cond.Value,
+		})
+	}
+	return result
+}
+
+// decodeSegmentConditions converts stored conditions back for evaluation
+func decodeSegmentConditions(stored models.JSONBArray) []SegmentCondition {
+	conditions := []SegmentCondition{}
+	if raw, err := json.Marshal(stored); err == nil {
+		_ = json.Unmarshal(raw, &conditions)
+	}
+	return conditions
+}
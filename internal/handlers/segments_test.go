@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegmentConditionSQL(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		cond   SegmentCondition
+		clause string
+		args   []interface{}
+	}{
+		{
+			name:   "has tag",
+			cond:   SegmentCondition{Field: "tags", Operator: models.SegmentOperatorContains, Value: " vip "},
+			clause: "tags @> ?",
+			args:   []interface{}{`["vip"]`},
+		},
+		{
+			name:   "no tags",
+			cond:   SegmentCondition{Field: "tags", Operator: models.SegmentOperatorIsEmpty},
+			clause: "jsonb_array_length(COALESCE(tags, '[]'::jsonb)) = 0",
+		},
+		{
+			name:   "custom attribute",
+			cond:   SegmentCondition{Field: "attribute.plan", Operator: models.SegmentOperatorEquals, Value: "Pro"},
+			clause: "LOWER(COALESCE(metadata->>?, '')) = ?",
+			args:   []interface{}{"plan", "pro"},
+		},
+		{
+			name:   "contact column",
+			cond:   SegmentCondition{Field: "name", Operator: models.SegmentOperatorContains, Value: "Ann"},
+			clause: "LOWER(COALESCE(profile_name, '')) LIKE ?",
+			args:   []interface{}{"%ann%"},
+		},
+		{
+			name:   "not seen for a week",
+			cond:   SegmentCondition{Field: "last_seen_days", Operator: models.SegmentOperatorGreaterThan, Value: "7"},
+			clause: "last_inbound_at < ?",
+			args:   []interface{}{now.AddDate(0, 0, -7)},
+		},
+		{
+			name:   "created this month",
+			cond:   SegmentCondition{Field: "created_days", Operator: models.SegmentOperatorLessThan, Value: "30"},
+			clause: "created_at >= ?",
+			args:   []interface{}{now.AddDate(0, 0, -30)},
+		},
+		{
+			name:   "never messaged",
+			cond:   SegmentCondition{Field: "last_seen_days", Operator: models.SegmentOperatorIsEmpty},
+			clause: "last_inbound_at IS NULL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clause, args, err := segmentConditionSQL(tt.cond, now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.clause, clause)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+}
+
+func TestValidateSegmentConditions(t *testing.T) {
+	assert.NoError(t, validateSegmentConditions(nil))
+	assert.NoError(t, validateSegmentConditions([]SegmentCondition{
+		{Field: "opt_in_status", Operator: models.SegmentOperatorNotEquals, Value: "opted_out"},
+	}))
+
+	err := validateSegmentConditions([]SegmentCondition{
+		{Field: "tags", Operator: models.SegmentOperatorContains, Value: "vip"},
+		{Field: "password", Operator: models.SegmentOperatorEquals, Value: "x"},
+	})
+	assert.EqualError(t, err, `condition 2: unknown field "password"`)
+
+	err = validateSegmentConditions([]SegmentCondition{{Field: "tags", Operator: models.SegmentOperatorGreaterThan, Value: "1"}})
+	assert.EqualError(t, err, `condition 1: operator "greater_than" does not apply to tags`)
+
+	err = validateSegmentConditions([]SegmentCondition{{Field: "last_seen_days", Operator: models.SegmentOperatorGreaterThan, Value: "soon"}})
+	assert.EqualError(t, err, "condition 1: last_seen_days needs a number of days")
+}
+
+func TestApplyTagChanges(t *testing.T) {
+	tags := models.JSONBArray{"vip", "trial"}
+
+	result := applyTagChanges(tags, []string{"VIP", "newsletter"}, []string{"Trial"})
+	assert.Equal(t, models.JSONBArray{"vip", "newsletter"}, result)
+	assert.Equal(t, models.JSONBArray{"vip", "trial"}, tags, "the contact's tags are not changed in place")
+
+	assert.True(t, sameTags(applyTagChanges(tags, []string{"vip"}, nil), tags))
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/websocket"
+)
+
+// maxSentimentWindow caps the number of messages averaged for escalation
+const maxSentimentWindow = 20
+
+// sentimentPrompt asks the AI provider for a score instead of a reply
+const sentimentPrompt = "Rate the sentiment of the customer's message from -1 (very negative) to 1 (very positive). Reply with the number only."
+
+// sentimentLexicon scores common words in the supported languages
+var sentimentLexicon = map[string]float64{
+	// English
+	"terrible": -1, "awful": -1, "horrible": -1, "worst": -1, "hate": -1, "angry": -1, "furious": -1,
+	"useless": -1, "ridiculous": -1, "scam": -1, "disgusting": -1, "unacceptable": -1, "stupid": -1, "sucks": -1,
+	"disappointed": -0.75, "disappointing": -0.75, "annoyed": -0.75, "frustrated": -0.75, "frustrating": -0.75,
+	"upset": -0.75, "rude": -0.75, "waste": -0.75,
+	"bad": -0.5, "poor": -0.5, "wrong": -0.5, "broken": -0.5, "late": -0.5, "slow": -0.5, "complaint": -0.5,
+	"problem": -0.25, "issue": -0.25, "refund": -0.25, "cancel": -0.25,
+	"excellent": 1, "amazing": 1, "awesome": 1, "perfect": 1, "wonderful": 1, "fantastic": 1,
+	"great": 0.75, "love": 0.75, "happy": 0.75, "helpful": 0.75, "best": 0.75,
+	"good": 0.5, "thanks": 0.5, "thank": 0.5, "nice": 0.5, "glad": 0.5, "appreciate": 0.5,
+	"fast": 0.25,
+	// Spanish
+	"pésimo": -1, "pésima": -1, "peor": -1, "odio": -1, "inaceptable": -1, "estafa": -1,
+	"enojado": -0.75, "enfadado": -0.75, "molesto": -0.75, "decepcionado": -0.75, "grosero": -0.75,
+	"malo": -0.5, "mala": -0.5, "queja": -0.5, "lento": -0.5, "problema": -0.25,
+	"excelente": 1, "perfecto": 1, "increíble": 1,
+	"genial": 0.75, "encanta": 0.75, "feliz": 0.75,
+	"gracias": 0.5, "bueno": 0.5, "buena": 0.5, "amable": 0.5,
+	// Portuguese
+	"péssimo": -1, "horrível": -1, "pior": -1, "odeio": -1, "inaceitável": -1,
+	"irritado": -0.75, "chateado": -0.75,
+	"ruim": -0.5, "reclamação": -0.5,
+	"perfeito": 1, "incrível": 1, "ótimo": 0.75, "adorei": 0.75,
+	"obrigado": 0.5, "obrigada": 0.5, "bom": 0.5,
+	// French
+	"pire": -1, "déteste": -1, "inacceptable": -1, "arnaque": -1,
+	"nul": -0.75, "énervé": -0.75, "fâché": -0.75, "déçu": -0.75,
+	"mauvais": -0.5, "lent": -0.5, "problème": -0.25,
+	"parfait": 1, "génial": 0.75, "super": 0.75,
+	"merci": 0.5, "content": 0.5, "bien": 0.25,
+	// German
+	"schrecklich": -1, "furchtbar": -1, "schlimmste": -1, "hasse": -1, "wütend": -1, "inakzeptabel": -1, "betrug": -1,
+	"verärgert": -0.75, "enttäuscht": -0.75,
+	"schlecht": -0.5, "langsam": -0.5,
+	"perfekt": 1, "ausgezeichnet": 1, "toll": 0.75,
+	"danke": 0.5, "gut": 0.5, "zufrieden": 0.5,
+}
+
+// sentimentNegators flip the sentiment of the words that follow them
+var sentimentNegators = map[string]bool{
+	"not": true, "no": true, "never": true, "don't": true, "doesn't": true, "didn't": true, "isn't": true,
+	"wasn't": true, "aren't": true, "can't": true, "won't": true, "nunca": true, "não": true, "nao": true,
+	"ni": true, "pas": true, "jamais": true, "nicht": true, "kein": true, "keine": true,
+}
+
+// sentimentEmoji scores emoji, which customers use regardless of language
+var sentimentEmoji = map[rune]float64{
+	'😡': -1, '😠': -1, '🤬': -1, '👎': -0.75, '😤': -0.75, '😞': -0.5, '😢': -0.5, '😭': -0.5,
+	'😍': 0.75, '❤': 0.75, '😊': 0.5, '😀': 0.5, '👍': 0.5, '🙏': 0.5, '🙂': 0.25,
+}
+
+// sentimentNegationWords is how many words a negator applies to
+const sentimentNegationWords = 3
+
+var sentimentScoreRegex = regexp.MustCompile(`-?\d+(?:\.\d+)?`)
+
+// lexiconSentiment scores text from -1 (negative) to 1 (positive) with the
+// built-in word list. Text without known words scores 0.
+func lexiconSentiment(text string) float64 {
+	text = strings.ReplaceAll(strings.ToLower(text), "’", "'")
+
+	var sum float64
+	negated := 0
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && r != '\'' })
+	for _, word := range words {
+		if sentimentNegators[word] {
+			negated = sentimentNegationWords
+			continue
+		}
+		if score, ok := sentimentLexicon[word]; ok {
+			// "not bad" is mildly positive rather than good
+			if negated > 0 {
+				score *= -0.5
+			}
+			sum += score
+		}
+		if negated > 0 {
+			negated--
+		}
+	}
+	for _, r := range text {
+		sum += sentimentEmoji[r]
+	}
+
+	// Squash the sum so a few strong words approach but never pass -1 or 1
+	return roundSentiment(sum / math.Sqrt(sum*sum+1))
+}
+
+// parseSentimentScore reads the score from an AI provider's reply
+func parseSentimentScore(reply string) (float64, error) {
+	match := sentimentScoreRegex.FindString(reply)
+	if match == "" {
+		return 0, errors.New("no score in AI reply")
+	}
+	score, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return 0, err
+	}
+	return roundSentiment(math.Max(-1, math.Min(1, score))), nil
+}
+
+// roundSentiment rounds a score to the precision it's stored with
+func roundSentiment(score float64) float64 {
+	return math.Round(score*1000) / 1000
+}
+
+// averageSentiment returns the mean of the scores
+func averageSentiment(scores []float64) float64 {
+	var sum float64
+	for _, s := range scores {
+		sum += s
+	}
+	return roundSentiment(sum / float64(len(scores)))
+}
+
+// messageSentiment scores an inbound message when sentiment scoring is
+// enabled. Only text is scored: button taps and list picks carry no sentiment.
+func (a *App) messageSentiment(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession, messageType, text string) *float64 {
+	if !settings.Sentiment.Enabled || messageType != "text" {
+		return nil
+	}
+	if settings.Sentiment.Provider == models.SentimentProviderAI {
+		score, err := a.aiSentiment(ctx, settings, session, text)
+		if err == nil {
+			return &score
+		}
+		a.log(ctx).Warn("AI sentiment scoring failed, using the lexicon", "error", err, "session_id", session.ID)
+	}
+	score := lexiconSentiment(text)
+	return &score
+}
+
+// aiSentiment scores a message with the chatbot's AI provider. Webhook
+// providers reply to customers, so they can't score.
+func (a *App) aiSentiment(ctx context.Context, settings *models.ChatbotSettings, session *models.ChatbotSession, text string) (float64, error) {
+	if settings.AI.Provider == models.AIProviderWebhook || !aiConfigured(settings.AI) {
+		return 0, errors.New("AI provider can't score sentiment")
+	}
+	if !a.HasFeature(settings.OrganizationID, models.PlanFeatureAI) {
+		return 0, errors.New(featureUnavailableMessage(models.PlanFeatureAI))
+	}
+	if err := a.checkAITokenQuota(settings); err != nil {
+		return 0, err
+	}
+
+	scoring := *settings
+	scoring.AI.SystemPrompt = sentimentPrompt
+	scoring.AI.IncludeHistory = false
+	scoring.AI.Tools = nil
+	scoring.AI.MaxTokens = 10
+	scoring.AI.Temperature = 0
+
+	completion, err := a.generateProviderResponse(ctx, &scoring, session, text, "")
+	if err != nil {
+		return 0, err
+	}
+	completion.Provider = settings.AI.Provider
+	completion.Model = settings.AI.Model
+	a.recordAIUsage(settings, session, completion)
+	return parseSentimentScore(completion.Text)
+}
+
+// logScoredSessionMessage logs an incoming message to the session with its
+// sentiment score
+func (a *App) logScoredSessionMessage(sessionID uuid.UUID, message, stepName string, sentiment *float64) {
+	msg := models.ChatbotSessionMessage{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		SessionID: sessionID,
+		Direction: models.DirectionIncoming,
+		Message:   message,
+		StepName:  stepName,
+		Sentiment: sentiment,
+	}
+	if err := a.DB.Create(&msg).Error; err != nil {
+		a.Log.Error("Failed to log session message", "error", err)
+	}
+}
+
+// checkSentimentEscalation updates the session's sentiment from its last scored
+// messages and escalates once it drops below the threshold. It reports whether
+// the conversation was handed off, in which case the bot shouldn't answer.
+func (a *App) checkSentimentEscalation(ctx context.Context, account *models.WhatsAppAccount, contact *models.Contact, session *models.ChatbotSession, settings *models.ChatbotSettings) bool {
+	window := settings.Sentiment.Window
+	if window <= 0 {
+		window = 1
+	}
+
+	var scores []float64
+	if err := a.DB.Model(&models.ChatbotSessionMessage{}).
+		Where("session_id = ? AND direction = ? AND sentiment IS NOT NULL", session.ID, models.DirectionIncoming).
+		Order("created_at DESC").Limit(window).
+		Pluck("sentiment", &scores).Error; err != nil {
+		a.log(ctx).Error("Failed to load session sentiment", "error", err, "session_id", session.ID)
+		return false
+	}
+	if len(scores) == 0 {
+		return false
+	}
+
+	previous := session.Sentiment
+	sentiment := averageSentiment(scores)
+	session.Sentiment = &sentiment
+	a.DB.Model(&models.ChatbotSession{}).Where("id = ?", session.ID).Update("sentiment", sentiment)
+
+	// Escalate once, when the average crosses the threshold over a full window
+	threshold := settings.Sentiment.Threshold
+	if len(scores) < window || sentiment >= threshold || (previous != nil && *previous < threshold) {
+		return false
+	}
+
+	a.log(ctx).Info("Conversation sentiment dropped", "contact_id", contact.ID, "session_id", session.ID, "sentiment", sentiment, "threshold", threshold)
+	a.DispatchWebhook(account.OrganizationID, models.WebhookEventSentimentDropped, SentimentEventData{
+		ContactID:       contact.ID.String(),
+		ContactPhone:    contact.PhoneNumber,
+		ContactName:     contact.ProfileName,
+		SessionID:       session.ID.String(),
+		Sentiment:       sentiment,
+		Threshold:       threshold,
+		WhatsAppAccount: account.Name,
+	})
+
+	if settings.Sentiment.Action == models.SentimentActionHandoff {
+		a.createTransferFromBot(ctx, account, contact, models.TransferSourceSentiment)
+		return true
+	}
+
+	if a.WSHub != nil {
+		a.WSHub.BroadcastToOrg(account.OrganizationID, websocket.WSMessage{
+			Type: websocket.TypeSentimentAlert,
+			Payload: map[string]any{
+				"contact_id":   contact.ID.String(),
+				"contact_name": contact.ProfileName,
+				"phone_number": contact.PhoneNumber,
+				"session_id":   session.ID.String(),
+				"sentiment":    sentiment,
+			},
+		})
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLexiconSentiment(t *testing.T) {
+	assert.Equal(t, 0.0, lexiconSentiment("What time do you open tomorrow?"))
+	assert.Greater(t, lexiconSentiment("Thanks, that was really helpful!"), 0.5)
+	assert.Less(t, lexiconSentiment("This is terrible, worst service ever"), -0.8)
+	assert.Less(t, lexiconSentiment("Estoy muy molesto, el pedido llegó tarde y es pésimo"), -0.7)
+	assert.Less(t, lexiconSentiment("😡😡"), -0.8)
+
+	// Negation softens and flips the words after it
+	assert.Greater(t, lexiconSentiment("no problem"), 0.0)
+	assert.Less(t, lexiconSentiment("It's not good"), 0.0)
+	assert.Less(t, lexiconSentiment("I don’t love it"), 0.0)
+
+	for _, text := range []string{"awful awful awful awful awful awful", "great great great great great great"} {
+		score := lexiconSentiment(text)
+		assert.LessOrEqual(t, score, 1.0)
+		assert.GreaterOrEqual(t, score, -1.0)
+	}
+}
+
+func TestParseSentimentScore(t *testing.T) {
+	score, err := parseSentimentScore("-0.75")
+	require.NoError(t, err)
+	assert.Equal(t, -0.75, score)
+
+	score, err = parseSentimentScore("Score: 0.4")
+	require.NoError(t, err)
+	assert.Equal(t, 0.4, score)
+
+	score, err = parseSentimentScore("-3")
+	require.NoError(t, err)
+	assert.Equal(t, -1.0, score, "scores are clamped")
+
+	_, err = parseSentimentScore("negative")
+	assert.Error(t, err)
+}
+
+func TestAverageSentiment(t *testing.T) {
+	assert.Equal(t, -0.5, averageSentiment([]float64{-0.75, -0.25}))
+	assert.Equal(t, 0.333, averageSentiment([]float64{1, 0, 0}))
+}
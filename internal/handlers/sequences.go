@@ -0,0 +1,841 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// defaultSequenceExitKeywords opt contacts out of a sequence unless it sets its own
+var defaultSequenceExitKeywords = models.StringArray{"stop", "unsubscribe"}
+
+// sequenceWindowClosedNote is recorded on an enrollment when a text step is skipped
+const sequenceWindowClosedNote = "text step skipped: the 24-hour customer service window had closed"
+
+// SequenceRequest creates or updates a sequence. On update, omitted fields keep
+// their current value and steps, when given, replace the current ones.
+type SequenceRequest struct {
+	Name            string                `json:"name"`
+	Description     *string               `json:"description"`
+	WhatsAppAccount *string               `json:"whatsapp_account"`
+	IsActive        *bool                 `json:"is_active"`
+	ExitOnReply     *bool                 `json:"exit_on_reply"`
+	ExitKeywords    []string              `json:"exit_keywords"`
+	ExitTag         *string               `json:"exit_tag"`
+	Steps           []SequenceStepRequest `json:"steps"`
+}
+
+// SequenceStepRequest is a step of a sequence request
+type SequenceStepRequest struct {
+	DelayMinutes   int                `json:"delay_minutes"`
+	MessageType    models.MessageType `json:"message_type"`
+	Message        string             `json:"message"`
+	TemplateID     string             `json:"template_id"`
+	TemplateParams map[string]string  `json:"template_params"`
+}
+
+// EnrollSequenceRequest enrolls contacts in a sequence, by ID or all of a segment's contacts
+type EnrollSequenceRequest struct {
+	ContactIDs []string `json:"contact_ids"`
+	SegmentID  string   `json:"segment_id"`
+}
+
+// SequenceResponse is a sequence with how many contacts are in each enrollment status
+type SequenceResponse struct {
+	models.Sequence
+	Enrollments map[models.SequenceEnrollmentStatus]int64 `json:"enrollments"`
+}
+
+// ListSequences returns the organization's sequences with their enrollment counts
+func (a *App) ListSequences(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceCampaigns, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var sequences []models.Sequence
+	if err := a.DB.Where("organization_id = ?", orgID).
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("step_order ASC") }).
+		Order("created_at DESC").
+		Find(&sequences).Error; err != nil {
+		a.Log.Error("Failed to list sequences", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list sequences", nil, "")
+	}
+
+	var stats []struct {
+		SequenceID uuid.UUID
+		Status     models.SequenceEnrollmentStatus
+		Count      int64
+	}
+	if err := a.DB.Model(&models.SequenceEnrollment{}).
+		Select("sequence_id, status, COUNT(*) AS count").
+		Where("organization_id = ?", orgID).
+		Group("sequence_id, status").
+		Scan(&stats).Error; err != nil {
+		a.Log.Error("Failed to load sequence stats", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list sequences", nil, "")
+	}
+
+	result := make([]SequenceResponse, len(sequences))
+	for i, seq := range sequences {
+		result[i] = SequenceResponse{Sequence: seq, Enrollments: map[models.SequenceEnrollmentStatus]int64{}}
+		for _, s := range stats {
+			if s.SequenceID == seq.ID {
+				result[i].Enrollments[s.Status] = s.Count
+			}
+		}
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"sequences": result,
+	})
+}
+
+// GetSequence returns a sequence with its steps
+func (a *App) GetSequence(r *fastglue.Request) error {
+	seq, errMsg, status := a.findSequence(r, models.ActionRead)
+	if seq == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+	return r.SendEnvelope(seq)
+}
+
+// CreateSequence creates a sequence and its steps
+func (a *App) CreateSequence(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceCampaigns, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req SequenceRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "name is required", nil, "")
+	}
+
+	seq := models.Sequence{
+		OrganizationID: orgID,
+		IsActive:       true,
+		ExitOnReply:    true,
+		ExitKeywords:   defaultSequenceExitKeywords,
+		CreatedBy:      &userID,
+	}
+	applySequenceRequest(&seq, &req)
+
+	steps, err := a.buildSequenceSteps(orgID, req.Steps)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&seq).Error; err != nil {
+			return err
+		}
+		return createSequenceSteps(tx, seq.ID, steps)
+	})
+	if err != nil {
+		a.Log.Error("Failed to create sequence", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create sequence", nil, "")
+	}
+	seq.Steps = steps
+
+	return r.SendEnvelope(seq)
+}
+
+// UpdateSequence updates a sequence. Enrolled contacts continue from the step they
+// are on, so replacing the steps applies to the steps they haven't received yet.
+func (a *App) UpdateSequence(r *fastglue.Request) error {
+	seq, errMsg, status := a.findSequence(r, models.ActionWrite)
+	if seq == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var req SequenceRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	applySequenceRequest(seq, &req)
+
+	var steps []models.SequenceStep
+	if req.Steps != nil {
+		var err error
+		if steps, err = a.buildSequenceSteps(seq.OrganizationID, req.Steps); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+	}
+
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Steps").Save(seq).Error; err != nil {
+			return err
+		}
+		if req.Steps == nil {
+			return nil
+		}
+		if err := tx.Where("sequence_id = ?", seq.ID).Delete(&models.SequenceStep{}).Error; err != nil {
+			return err
+		}
+		return createSequenceSteps(tx, seq.ID, steps)
+	})
+	if err != nil {
+		a.Log.Error("Failed to update sequence", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update sequence", nil, "")
+	}
+	if req.Steps != nil {
+		seq.Steps = steps
+	}
+
+	return r.SendEnvelope(seq)
+}
+
+// DeleteSequence deletes a sequence and its steps. Contacts still in it are exited.
+func (a *App) DeleteSequence(r *fastglue.Request) error {
+	seq, errMsg, status := a.findSequence(r, models.ActionWrite)
+	if seq == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SequenceEnrollment{}).
+			Where("sequence_id = ? AND status = ?", seq.ID, models.SequenceEnrollmentStatusActive).
+			Updates(sequenceExitUpdates(models.SequenceExitReasonCancelled, time.Now())).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("sequence_id = ?", seq.ID).Delete(&models.SequenceStep{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(seq).Error
+	})
+	if err != nil {
+		a.Log.Error("Failed to delete sequence", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete sequence", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]string{"message": "Sequence deleted"})
+}
+
+// EnrollSequenceContacts enrolls contacts in a sequence. Contacts already going
+// through it, who opted out of it or of messages altogether, or who lack its exit
+// tag are skipped.
+func (a *App) EnrollSequenceContacts(r *fastglue.Request) error {
+	seq, errMsg, status := a.findSequence(r, models.ActionWrite)
+	if seq == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	var req EnrollSequenceRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if len(req.ContactIDs) == 0 && req.SegmentID == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "contact_ids or segment_id is required", nil, "")
+	}
+	if len(seq.Steps) == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Sequence has no steps", nil, "")
+	}
+
+	var contacts []models.Contact
+	requested := len(req.ContactIDs)
+	if req.SegmentID != "" {
+		segment, err := a.findOrgSegment(seq.OrganizationID, req.SegmentID)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+		if contacts, err = a.segmentContacts(segment); err != nil {
+			a.Log.Error("Failed to load segment contacts", "error", err, "segment_id", segment.ID)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to enroll contacts", nil, "")
+		}
+		requested = len(contacts)
+	} else {
+		contactIDs := make([]uuid.UUID, 0, len(req.ContactIDs))
+		for _, idStr := range req.ContactIDs {
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact ID: "+idStr, nil, "")
+			}
+			contactIDs = append(contactIDs, id)
+		}
+		if err := a.DB.Where("id IN ? AND organization_id = ?", contactIDs, seq.OrganizationID).Find(&contacts).Error; err != nil {
+			a.Log.Error("Failed to load contacts to enroll", "error", err)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to enroll contacts", nil, "")
+		}
+	}
+	contactIDs := make([]uuid.UUID, len(contacts))
+	for i, contact := range contacts {
+		contactIDs[i] = contact.ID
+	}
+
+	// Contacts already going through the sequence, or who opted out of it
+	var excluded []uuid.UUID
+	a.DB.Model(&models.SequenceEnrollment{}).
+		Where("sequence_id = ? AND contact_id IN ?", seq.ID, contactIDs).
+		Where("status = ? OR exit_reason = ?", models.SequenceEnrollmentStatusActive, models.SequenceExitReasonOptedOut).
+		Pluck("contact_id", &excluded)
+	excludedSet := make(map[uuid.UUID]bool, len(excluded))
+	for _, id := range excluded {
+		excludedSet[id] = true
+	}
+
+	nextRunAt := time.Now().Add(time.Duration(seq.Steps[0].DelayMinutes) * time.Minute)
+	enrollments := make([]models.SequenceEnrollment, 0, len(contacts))
+	for _, contact := range contacts {
+		if excludedSet[contact.ID] || contact.OptInStatus == models.ContactOptInStatusOptedOut ||
+			(seq.ExitTag != "" && !contactHasTag(contact.Tags, seq.ExitTag)) {
+			continue
+		}
+		enrollments = append(enrollments, models.SequenceEnrollment{
+			OrganizationID: seq.OrganizationID,
+			SequenceID:     seq.ID,
+			ContactID:      contact.ID,
+			Status:         models.SequenceEnrollmentStatusActive,
+			NextRunAt:      &nextRunAt,
+			EnrolledByID:   &userID,
+		})
+	}
+	if len(enrollments) > 0 {
+		if err := a.DB.Create(&enrollments).Error; err != nil {
+			a.Log.Error("Failed to enroll contacts", "error", err, "sequence_id", seq.ID)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to enroll contacts", nil, "")
+		}
+	}
+
+	a.Log.Info("Contacts enrolled in sequence", "sequence_id", seq.ID, "enrolled", len(enrollments))
+
+	return r.SendEnvelope(map[string]interface{}{
+		"enrolled": len(enrollments),
+		"skipped":  requested - len(enrollments),
+	})
+}
+
+// ListSequenceEnrollments returns the contacts enrolled in a sequence, newest first
+func (a *App) ListSequenceEnrollments(r *fastglue.Request) error {
+	seq, errMsg, status := a.findSequence(r, models.ActionRead)
+	if seq == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	query := a.DB.Where("sequence_id = ?", seq.ID)
+	if s := string(r.RequestCtx.QueryArgs().Peek("status")); s != "" {
+		query = query.Where("status = ?", s)
+	}
+
+	var enrollments []models.SequenceEnrollment
+	if err := query.Preload("Contact").
+		Order("created_at DESC").
+		Limit(200).
+		Find(&enrollments).Error; err != nil {
+		a.Log.Error("Failed to list sequence enrollments", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list enrollments", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"enrollments": enrollments,
+	})
+}
+
+// CancelSequenceEnrollment takes a contact out of a sequence
+func (a *App) CancelSequenceEnrollment(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceCampaigns, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid enrollment ID", nil, "")
+	}
+
+	var enrollment models.SequenceEnrollment
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&enrollment).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Enrollment not found", nil, "")
+	}
+
+	if !a.exitSequenceEnrollment(&enrollment, models.SequenceExitReasonCancelled) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Enrollment is no longer active", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Enrollment cancelled",
+		"status":  models.SequenceEnrollmentStatusExited,
+	})
+}
+
+// findSequence returns the organization's sequence named by the id path parameter,
+// with its steps, if the user may access it for the action, or an error message and status
+func (a *App) findSequence(r *fastglue.Request, action string) (*models.Sequence, string, int) {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return nil, "Unauthorized", fasthttp.StatusUnauthorized
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceCampaigns, action) {
+		return nil, "Insufficient permissions", fasthttp.StatusForbidden
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, "Invalid sequence ID", fasthttp.StatusBadRequest
+	}
+
+	var seq models.Sequence
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("step_order ASC") }).
+		First(&seq).Error; err != nil {
+		return nil, "Sequence not found", fasthttp.StatusNotFound
+	}
+	return &seq, "", fasthttp.StatusOK
+}
+
+// applySequenceRequest copies the fields a request sets
+func applySequenceRequest(seq *models.Sequence, req *SequenceRequest) {
+	if name := strings.TrimSpace(req.Name); name != "" {
+		seq.Name = name
+	}
+	if req.Description != nil {
+		seq.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.WhatsAppAccount != nil {
+		seq.WhatsAppAccount = *req.WhatsAppAccount
+	}
+	if req.IsActive != nil {
+		seq.IsActive = *req.IsActive
+	}
+	if req.ExitOnReply != nil {
+		seq.ExitOnReply = *req.ExitOnReply
+	}
+	if req.ExitKeywords != nil {
+		keywords := models.StringArray{}
+		for _, k := range req.ExitKeywords {
+			if k = strings.TrimSpace(k); k != "" {
+				keywords = append(keywords, k)
+			}
+		}
+		seq.ExitKeywords = keywords
+	}
+	if req.ExitTag != nil {
+		seq.ExitTag = strings.TrimSpace(*req.ExitTag)
+	}
+}
+
+// buildSequenceSteps validates the steps of a request and returns them in order.
+// Template steps need an approved template with all its parameters.
+func (a *App) buildSequenceSteps(orgID uuid.UUID, reqs []SequenceStepRequest) ([]models.SequenceStep, error) {
+	if len(reqs) == 0 {
+		return nil, errors.New("at least one step is required")
+	}
+
+	steps := make([]models.SequenceStep, 0, len(reqs))
+	for i, req := range reqs {
+		step, err := a.buildSequenceStep(orgID, req)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		step.StepOrder = i + 1
+		steps = append(steps, *step)
+	}
+	return steps, nil
+}
+
+func (a *App) buildSequenceStep(orgID uuid.UUID, req SequenceStepRequest) (*models.SequenceStep, error) {
+	if req.DelayMinutes < 0 {
+		return nil, errors.New("delay_minutes can't be negative")
+	}
+	step := &models.SequenceStep{
+		DelayMinutes: req.DelayMinutes,
+		MessageType:  req.MessageType,
+	}
+
+	switch req.MessageType {
+	case models.MessageTypeText:
+		step.Message = strings.TrimSpace(req.Message)
+		if step.Message == "" {
+			return nil, errors.New("message is required for text steps")
+		}
+	case models.MessageTypeTemplate:
+		templateID, err := uuid.Parse(req.TemplateID)
+		if err != nil {
+			return nil, errors.New("template_id is required for template steps")
+		}
+		var template models.Template
+		if err := a.DB.Where("id = ? AND organization_id = ?", templateID, orgID).First(&template).Error; err != nil {
+			return nil, errors.New("template not found")
+		}
+		if template.Status != string(models.TemplateStatusApproved) {
+			return nil, fmt.Errorf("template is not approved (status: %s)", template.Status)
+		}
+		if missingParams, paramNames := missingTemplateParams(&template, req.TemplateParams); len(missingParams) > 0 {
+			return nil, fmt.Errorf("missing template parameters: %s. Expected parameters: %v", strings.Join(missingParams, ", "), paramNames)
+		}
+		step.TemplateID = &template.ID
+		step.TemplateParams = stringMapToJSONB(req.TemplateParams)
+	default:
+		return nil, fmt.Errorf("message_type must be text or template")
+	}
+	return step, nil
+}
+
+func createSequenceSteps(tx *gorm.DB, sequenceID uuid.UUID, steps []models.SequenceStep) error {
+	for i := range steps {
+		steps[i].SequenceID = sequenceID
+		if err := tx.Create(&steps[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isSequenceExitKeyword reports whether a reply is one of the exit keywords, ignoring
+// case and surrounding punctuation, so "Stop!" opts out but "don't stop" doesn't
+func isSequenceExitKeyword(keywords []string, text string) bool {
+	return matchConsentKeyword(keywords, text) != ""
+}
+
+// contactHasTag reports whether a contact's tags include tag, ignoring case
+func contactHasTag(tags models.JSONBArray, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(fmt.Sprint(t), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// sequenceExitUpdates returns the changes that take an enrollment out of its sequence
+func sequenceExitUpdates(reason models.SequenceExitReason, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"status":      models.SequenceEnrollmentStatusExited,
+		"exit_reason": reason,
+		"next_run_at": nil,
+		"finished_at": now,
+	}
+}
+
+// exitSequenceEnrollment takes an active enrollment out of its sequence. Returns
+// false if it was no longer active.
+func (a *App) exitSequenceEnrollment(e *models.SequenceEnrollment, reason models.SequenceExitReason) bool {
+	result := a.DB.Model(e).
+		Where("status = ?", models.SequenceEnrollmentStatusActive).
+		Updates(sequenceExitUpdates(reason, time.Now()))
+	if result.Error != nil {
+		a.Log.Error("Failed to exit sequence enrollment", "error", result.Error, "enrollment_id", e.ID)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+	a.Log.Info("Contact left sequence", "enrollment_id", e.ID, "sequence_id", e.SequenceID, "contact_id", e.ContactID, "reason", reason)
+	return true
+}
+
+// exitSequencesOnReply takes a contact who replied out of their sequences: with an
+// exit keyword they opt out, otherwise they leave sequences that exit on reply
+func (a *App) exitSequencesOnReply(contact *models.Contact, text string) {
+	var enrollments []models.SequenceEnrollment
+	if err := a.DB.Where("contact_id = ? AND status = ?", contact.ID, models.SequenceEnrollmentStatusActive).
+		Preload("Sequence").
+		Find(&enrollments).Error; err != nil {
+		a.Log.Error("Failed to load sequence enrollments", "error", err, "contact_id", contact.ID)
+		return
+	}
+
+	optOutKeyword := ""
+	for i := range enrollments {
+		e := &enrollments[i]
+		if e.Sequence == nil {
+			continue
+		}
+		if keyword := matchConsentKeyword(e.Sequence.ExitKeywords, text); keyword != "" {
+			a.exitSequenceEnrollment(e, models.SequenceExitReasonOptedOut)
+			optOutKeyword = keyword
+		} else if e.Sequence.ExitOnReply {
+			a.exitSequenceEnrollment(e, models.SequenceExitReasonReplied)
+		}
+	}
+
+	// An opt-out keyword opts the contact out of messages altogether
+	if optOutKeyword != "" {
+		a.setContactOptIn(contact, models.ContactOptInStatusOptedOut, models.ContactConsentSourceKeyword, optOutKeyword)
+	}
+}
+
+// exitSequencesOnOptOut takes a contact who opted out out of every sequence they are in
+func (a *App) exitSequencesOnOptOut(contactID uuid.UUID) {
+	var enrollments []models.SequenceEnrollment
+	if err := a.DB.Where("contact_id = ? AND status = ?", contactID, models.SequenceEnrollmentStatusActive).
+		Find(&enrollments).Error; err != nil {
+		a.Log.Error("Failed to load sequence enrollments", "error", err, "contact_id", contactID)
+		return
+	}
+	for i := range enrollments {
+		a.exitSequenceEnrollment(&enrollments[i], models.SequenceExitReasonOptedOut)
+	}
+}
+
+// enrollContactInSequence enrolls a contact in a sequence because of something they
+// did, e.g. abandoning a cart. Step messages can use the variables. Contacts the
+// sequence would skip when enrolled by an agent are skipped too; returns whether the
+// contact was enrolled.
+func (a *App) enrollContactInSequence(orgID, sequenceID uuid.UUID, contact *models.Contact, variables models.JSONB) (bool, error) {
+	var seq models.Sequence
+	if err := a.DB.Where("id = ? AND organization_id = ?", sequenceID, orgID).
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("step_order ASC") }).
+		First(&seq).Error; err != nil {
+		return false, fmt.Errorf("sequence not found")
+	}
+	if !seq.IsActive || len(seq.Steps) == 0 || contact.OptInStatus == models.ContactOptInStatusOptedOut ||
+		(seq.ExitTag != "" && !contactHasTag(contact.Tags, seq.ExitTag)) {
+		return false, nil
+	}
+
+	var excluded int64
+	a.DB.Model(&models.SequenceEnrollment{}).
+		Where("sequence_id = ? AND contact_id = ?", seq.ID, contact.ID).
+		Where("status = ? OR exit_reason = ?", models.SequenceEnrollmentStatusActive, models.SequenceExitReasonOptedOut).
+		Count(&excluded)
+	if excluded > 0 {
+		return false, nil
+	}
+
+	nextRunAt := time.Now().Add(time.Duration(seq.Steps[0].DelayMinutes) * time.Minute)
+	enrollment := models.SequenceEnrollment{
+		OrganizationID: orgID,
+		SequenceID:     seq.ID,
+		ContactID:      contact.ID,
+		Status:         models.SequenceEnrollmentStatusActive,
+		NextRunAt:      &nextRunAt,
+		Variables:      variables,
+	}
+	if err := a.DB.Create(&enrollment).Error; err != nil {
+		return false, err
+	}
+	a.Log.Info("Contact enrolled in sequence", "sequence_id", seq.ID, "contact_id", contact.ID, "enrollment_id", enrollment.ID)
+	return true, nil
+}
+
+// SequenceProcessor sends the sequence steps that are due
+type SequenceProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewSequenceProcessor creates a new sequence processor
+func NewSequenceProcessor(app *App, interval time.Duration) *SequenceProcessor {
+	return &SequenceProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the sequence processing loop
+func (p *SequenceProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Sequence processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Sequence processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Sequence processor stopped")
+			return
+		case <-ticker.C:
+			p.processDueEnrollments(ctx)
+		}
+	}
+}
+
+// Stop stops the sequence processor
+func (p *SequenceProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// processDueEnrollments sends the next step of active enrollments whose step is due.
+// Enrollments of inactive sequences wait until the sequence is turned back on.
+func (p *SequenceProcessor) processDueEnrollments(ctx context.Context) {
+	var due []models.SequenceEnrollment
+	if err := p.app.DB.
+		Joins("JOIN sequences ON sequences.id = sequence_enrollments.sequence_id AND sequences.is_active AND sequences.deleted_at IS NULL").
+		Where("sequence_enrollments.status = ? AND sequence_enrollments.next_run_at <= ?", models.SequenceEnrollmentStatusActive, time.Now()).
+		Order("sequence_enrollments.next_run_at ASC").
+		Limit(100).
+		Find(&due).Error; err != nil {
+		p.app.Log.Error("Failed to find due sequence steps", "error", err)
+		return
+	}
+
+	for i := range due {
+		e := &due[i]
+
+		// Claim the enrollment so a reply or a concurrent processor can't race it
+		result := p.app.DB.Model(e).
+			Where("status = ? AND next_run_at IS NOT NULL", models.SequenceEnrollmentStatusActive).
+			Update("next_run_at", nil)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		p.app.runSequenceStep(ctx, e)
+	}
+}
+
+// runSequenceStep sends the next step of a claimed enrollment and schedules the one
+// after it. Outside the 24-hour service window only template steps are sent; text
+// steps are skipped.
+func (a *App) runSequenceStep(ctx context.Context, e *models.SequenceEnrollment) {
+	var seq models.Sequence
+	if err := a.DB.Where("id = ?", e.SequenceID).
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("step_order ASC") }).
+		First(&seq).Error; err != nil {
+		a.failSequenceEnrollment(e, fmt.Errorf("sequence not found"))
+		return
+	}
+	if e.NextStep >= len(seq.Steps) {
+		a.advanceSequenceEnrollment(e, &seq, nil, "")
+		return
+	}
+
+	var contact models.Contact
+	if err := a.DB.Where("id = ? AND organization_id = ?", e.ContactID, e.OrganizationID).First(&contact).Error; err != nil {
+		a.failSequenceEnrollment(e, fmt.Errorf("contact not found"))
+		return
+	}
+	if contact.OptInStatus == models.ContactOptInStatusOptedOut {
+		a.exitSequenceEnrollment(e, models.SequenceExitReasonOptedOut)
+		return
+	}
+	if seq.ExitTag != "" && !contactHasTag(contact.Tags, seq.ExitTag) {
+		a.exitSequenceEnrollment(e, models.SequenceExitReasonTagRemoved)
+		return
+	}
+
+	accountName := seq.WhatsAppAccount
+	if accountName == "" {
+		accountName = contact.WhatsAppAccount
+	}
+	account, err := a.resolveWhatsAppAccount(e.OrganizationID, accountName)
+	if err != nil {
+		a.failSequenceEnrollment(e, err)
+		return
+	}
+
+	step := seq.Steps[e.NextStep]
+	// Custom attributes, such as fields pulled from the CRM, personalize steps too
+	vars := make(map[string]interface{}, len(contact.Metadata)+len(e.Variables)+2)
+	for k, v := range contact.Metadata {
+		vars[k] = v
+	}
+	vars["name"] = contact.ProfileName
+	vars["phone"] = contact.PhoneNumber
+	for k, v := range e.Variables {
+		vars[k] = v
+	}
+	data := a.personalizationData(&contact, vars)
+	req := OutgoingMessageRequest{
+		Account: account,
+		Contact: &contact,
+		Type:    step.MessageType,
+	}
+
+	switch step.MessageType {
+	case models.MessageTypeTemplate:
+		if step.TemplateID == nil {
+			a.failSequenceEnrollment(e, fmt.Errorf("step %d has no template", step.StepOrder))
+			return
+		}
+		var template models.Template
+		if err := a.DB.Where("id = ? AND organization_id = ?", *step.TemplateID, e.OrganizationID).First(&template).Error; err != nil {
+			a.failSequenceEnrollment(e, fmt.Errorf("step %d template not found", step.StepOrder))
+			return
+		}
+		if template.Status != string(models.TemplateStatusApproved) {
+			a.failSequenceEnrollment(e, fmt.Errorf("step %d template is not approved (status: %s)", step.StepOrder, template.Status))
+			return
+		}
+		params := jsonbToStringMap(step.TemplateParams)
+		for k, v := range params {
+			params[k] = processTemplate(v, data)
+		}
+		req.Template = &template
+		req.BodyParams = params
+	default:
+		if !isServiceWindowOpen(a.serviceWindowExpiresAt(&contact), time.Now()) {
+			a.log(ctx).Info("Sequence text step skipped, service window closed", "enrollment_id", e.ID, "step", step.StepOrder)
+			a.advanceSequenceEnrollment(e, &seq, nil, sequenceWindowClosedNote)
+			return
+		}
+		req.Content = processTemplate(step.Message, data)
+	}
+
+	opts := DefaultSendOptions()
+	opts.SentByUserID = e.EnrolledByID
+	opts.Async = false
+
+	message, err := a.SendOutgoingMessage(ctx, req, opts)
+	if err != nil {
+		a.failSequenceEnrollment(e, err)
+		return
+	}
+
+	a.log(ctx).Info("Sequence step sent", "enrollment_id", e.ID, "sequence_id", seq.ID, "contact_id", contact.ID, "step", step.StepOrder, "message_id", message.ID)
+	now := time.Now()
+	a.advanceSequenceEnrollment(e, &seq, &now, "")
+}
+
+// advanceSequenceEnrollment moves an enrollment past its current step, scheduling the
+// next step or completing it after the last one
+func (a *App) advanceSequenceEnrollment(e *models.SequenceEnrollment, seq *models.Sequence, sentAt *time.Time, note string) {
+	next := e.NextStep + 1
+	updates := map[string]interface{}{
+		"next_step":     next,
+		"error_message": note,
+	}
+	if sentAt != nil {
+		updates["last_sent_at"] = *sentAt
+	}
+	if next >= len(seq.Steps) {
+		updates["status"] = models.SequenceEnrollmentStatusCompleted
+		updates["finished_at"] = time.Now()
+	} else {
+		updates["next_run_at"] = time.Now().Add(time.Duration(seq.Steps[next].DelayMinutes) * time.Minute)
+	}
+
+	// A reply may have taken the contact out while the step was being sent
+	a.DB.Model(e).Where("status = ?", models.SequenceEnrollmentStatusActive).Updates(updates)
+}
+
+// failSequenceEnrollment marks an enrollment as failed
+func (a *App) failSequenceEnrollment(e *models.SequenceEnrollment, err error) {
+	a.Log.Error("Failed to send sequence step", "error", err, "enrollment_id", e.ID)
+	a.DB.Model(e).Where("status = ?", models.SequenceEnrollmentStatusActive).Updates(map[string]interface{}{
+		"status":        models.SequenceEnrollmentStatusFailed,
+		"error_message": err.Error(),
+		"finished_at":   time.Now(),
+	})
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSequenceExitKeyword(t *testing.T) {
+	keywords := []string{"stop", "unsubscribe"}
+
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{name: "exact", text: "stop", want: true},
+		{name: "any case with punctuation", text: " STOP! ", want: true},
+		{name: "other keyword", text: "Unsubscribe.", want: true},
+		{name: "keyword inside a sentence", text: "don't stop sending these"},
+		{name: "other reply", text: "Thanks!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isSequenceExitKeyword(keywords, tt.text))
+		})
+	}
+}
+
+func TestApplySequenceRequest(t *testing.T) {
+	str := func(s string) *string { return &s }
+	no := false
+
+	seq := models.Sequence{ExitOnReply: true, ExitKeywords: defaultSequenceExitKeywords}
+	applySequenceRequest(&seq, &SequenceRequest{
+		Name:         " Onboarding ",
+		ExitOnReply:  &no,
+		ExitKeywords: []string{" STOP ", "", "cancel"},
+		ExitTag:      str(" trial "),
+	})
+	assert.Equal(t, "Onboarding", seq.Name)
+	assert.False(t, seq.ExitOnReply)
+	assert.Equal(t, models.StringArray{"STOP", "cancel"}, seq.ExitKeywords)
+	assert.Equal(t, "trial", seq.ExitTag)
+
+	// Omitted fields keep their value
+	applySequenceRequest(&seq, &SequenceRequest{})
+	assert.Equal(t, "Onboarding", seq.Name)
+	assert.Equal(t, models.StringArray{"STOP", "cancel"}, seq.ExitKeywords)
+}
+
+func TestBuildSequenceSteps(t *testing.T) {
+	app := &App{Log: testutil.NopLogger()}
+
+	steps, err := app.buildSequenceSteps(uuid.New(), []SequenceStepRequest{
+		{MessageType: models.MessageTypeText, Message: " Welcome {{name}}! "},
+		{DelayMinutes: 24 * 60, MessageType: models.MessageTypeText, Message: "How's it going?"},
+	})
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+	assert.Equal(t, 1, steps[0].StepOrder)
+	assert.Equal(t, "Welcome {{name}}!", steps[0].Message)
+	assert.Equal(t, 2, steps[1].StepOrder)
+	assert.Equal(t, 24*60, steps[1].DelayMinutes)
+
+	_, err = app.buildSequenceSteps(uuid.New(), nil)
+	assert.EqualError(t, err, "at least one step is required")
+
+	_, err = app.buildSequenceSteps(uuid.New(), []SequenceStepRequest{
+		{MessageType: models.MessageTypeText, Message: "Hi"},
+		{DelayMinutes: -5, MessageType: models.MessageTypeText, Message: "Hi again"},
+	})
+	assert.EqualError(t, err, "step 2: delay_minutes can't be negative")
+
+	_, err = app.buildSequenceSteps(uuid.New(), []SequenceStepRequest{{MessageType: models.MessageTypeImage}})
+	assert.EqualError(t, err, "step 1: message_type must be text or template")
+}
+
+// sequenceTestContact creates an organization, account and contact, with the contact
+// enrolled in a two-step text sequence whose first step is due
+func sequenceTestContact(t *testing.T, app *App, lastInbound *time.Time) (*models.Sequence, *models.Contact, *models.SequenceEnrollment) {
+	t.Helper()
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Sequence Org " + suffix,
+		Slug:      "sequence-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{
+		OrganizationID: org.ID,
+		Name:           "sequence-account-" + suffix,
+		PhoneID:        "phone-" + suffix,
+		BusinessID:     "business-" + suffix,
+		AccessToken:    "test-token",
+	}
+	require.NoError(t, app.DB.Create(account).Error)
+	contact := &models.Contact{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		PhoneNumber:     "1555" + uuid.New().String()[:7],
+		WhatsAppAccount: account.Name,
+		LastInboundAt:   lastInbound,
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+
+	seq := &models.Sequence{
+		OrganizationID: org.ID,
+		Name:           "Onboarding",
+		IsActive:       true,
+		ExitOnReply:    true,
+		ExitKeywords:   defaultSequenceExitKeywords,
+	}
+	require.NoError(t, app.DB.Create(seq).Error)
+	steps := []models.SequenceStep{
+		{StepOrder: 1, MessageType: models.MessageTypeText, Message: "Welcome!"},
+		{StepOrder: 2, DelayMinutes: 60, MessageType: models.MessageTypeText, Message: "Any questions?"},
+	}
+	require.NoError(t, createSequenceSteps(app.DB, seq.ID, steps))
+	seq.Steps = steps
+
+	due := time.Now().Add(-time.Minute)
+	enrollment := &models.SequenceEnrollment{
+		OrganizationID: org.ID,
+		SequenceID:     seq.ID,
+		ContactID:      contact.ID,
+		Status:         models.SequenceEnrollmentStatusActive,
+		NextRunAt:      &due,
+	}
+	require.NoError(t, app.DB.Create(enrollment).Error)
+
+	return seq, contact, enrollment
+}
+
+func TestExitSequencesOnReply(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	t.Run("opt out keyword", func(t *testing.T) {
+		_, contact, enrollment := sequenceTestContact(t, app, nil)
+
+		app.exitSequencesOnReply(contact, "STOP")
+
+		require.NoError(t, app.DB.First(enrollment, "id = ?", enrollment.ID).Error)
+		assert.Equal(t, models.SequenceEnrollmentStatusExited, enrollment.Status)
+		assert.Equal(t, models.SequenceExitReasonOptedOut, enrollment.ExitReason)
+		assert.Nil(t, enrollment.NextRunAt)
+
+		require.NoError(t, app.DB.First(contact, "id = ?", contact.ID).Error)
+		assert.Equal(t, models.ContactOptInStatusOptedOut, contact.OptInStatus)
+	})
+
+	t.Run("reply keeps contact when exit on reply is off", func(t *testing.T) {
+		seq, contact, enrollment := sequenceTestContact(t, app, nil)
+		require.NoError(t, app.DB.Model(seq).Update("exit_on_reply", false).Error)
+
+		app.exitSequencesOnReply(contact, "Thanks!")
+
+		require.NoError(t, app.DB.First(enrollment, "id = ?", enrollment.ID).Error)
+		assert.Equal(t, models.SequenceEnrollmentStatusActive, enrollment.Status)
+	})
+}
+
+func TestProcessDueEnrollments_SkipsTextOutsideServiceWindow(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	lastInbound := time.Now().Add(-48 * time.Hour)
+	_, _, enrollment := sequenceTestContact(t, app, &lastInbound)
+
+	NewSequenceProcessor(app, time.Minute).processDueEnrollments(context.Background())
+
+	require.NoError(t, app.DB.First(enrollment, "id = ?", enrollment.ID).Error)
+	assert.Equal(t, models.SequenceEnrollmentStatusActive, enrollment.Status)
+	assert.Equal(t, 1, enrollment.NextStep)
+	assert.Equal(t, sequenceWindowClosedNote, enrollment.ErrorMessage)
+	assert.Nil(t, enrollment.LastSentAt)
+	require.NotNil(t, enrollment.NextRunAt)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *enrollment.NextRunAt, time.Minute)
+}
+
+func TestProcessDueEnrollments_ExitsWhenTagRemoved(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	seq, _, enrollment := sequenceTestContact(t, app, nil)
+	require.NoError(t, app.DB.Model(seq).Update("exit_tag", "trial").Error)
+
+	NewSequenceProcessor(app, time.Minute).processDueEnrollments(context.Background())
+
+	require.NoError(t, app.DB.First(enrollment, "id = ?", enrollment.ID).Error)
+	assert.Equal(t, models.SequenceEnrollmentStatusExited, enrollment.Status)
+	assert.Equal(t, models.SequenceExitReasonTagRemoved, enrollment.ExitReason)
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// customerServiceWindow is how long after the customer's last message free-form
+// replies are allowed by Meta. Outside it only templates can be sent.
+const customerServiceWindow = 24 * time.Hour
+
+// serviceWindowClosedMessage is returned when a free-form send is rejected
+const serviceWindowClosedMessage = "The 24-hour customer service window has closed. Only approved templates can be sent until the customer replies"
+
+// ServiceWindow describes the customer service window of a conversation
+type ServiceWindow struct {
+	Open             bool       `json:"open"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	RemainingSeconds int64      `json:"remaining_seconds"`
+}
+
+// newServiceWindow builds the service window state at now for a window closing at expiresAt
+func newServiceWindow(expiresAt *time.Time, now time.Time) ServiceWindow {
+	window := ServiceWindow{ExpiresAt: expiresAt}
+	if isServiceWindowOpen(expiresAt, now) {
+		window.Open = true
+		window.RemainingSeconds = int64(expiresAt.Sub(now) / time.Second)
+	}
+	return window
+}
+
+// serviceWindowExpiresAt returns when the 24-hour customer service window of the contact
+// closes, based on their last inbound message. Returns nil if they never messaged.
+func (a *App) serviceWindowExpiresAt(contact *models.Contact) *time.Time {
+	// Telegram bots and web chat widgets can message a chat at any time, so their
+	// window never closes
+	if _, ok := telegramChatID(contact.PhoneNumber); ok || isWebChatContact(contact.PhoneNumber) {
+		expiresAt := time.Now().Add(customerServiceWindow)
+		return &expiresAt
+	}
+
+	if contact.LastInboundAt != nil {
+		expiresAt := contact.LastInboundAt.Add(customerServiceWindow)
+		return &expiresAt
+	}
+
+	// Contacts whose last message predates last_inbound_at tracking
+	var last models.Message
+	if err := a.DB.Select("created_at").
+		Where("contact_id = ? AND direction = ?", contact.ID, models.DirectionIncoming).
+		Order("created_at DESC").
+		First(&last).Error; err != nil {
+		return nil
+	}
+	expiresAt := last.CreatedAt.Add(customerServiceWindow)
+	return &expiresAt
+}
+
+// isServiceWindowOpen reports whether a window closing at expiresAt is still open at t
+func isServiceWindowOpen(expiresAt *time.Time, t time.Time) bool {
+	return expiresAt != nil && t.Before(*expiresAt)
+}
+
+// serviceWindowFallbackTemplate returns the template the organization sends in place of
+// free-form messages once the service window has closed, along with its parameters.
+// Returns nil if none is configured or the template is no longer approved.
+func (a *App) serviceWindowFallbackTemplate(orgID uuid.UUID) (*models.Template, map[string]string) {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return nil, nil
+	}
+	templateIDStr, _ := org.Settings["service_window_fallback_template_id"].(string)
+	templateID, err := uuid.Parse(templateIDStr)
+	if err != nil {
+		return nil, nil
+	}
+
+	var template models.Template
+	if err := a.DB.Where("id = ? AND organization_id = ? AND status = ?", templateID, orgID, models.TemplateStatusApproved).
+		First(&template).Error; err != nil {
+		return nil, nil
+	}
+
+	params := map[string]string{}
+	if stored, ok := org.Settings["service_window_fallback_template_params"].(map[string]interface{}); ok {
+		for k, v := range stored {
+			params[k] = fmt.Sprint(v)
+		}
+	}
+	return &template, params
+}
+
+// sendServiceWindowFallback handles a free-form send outside the customer service window.
+// The organization's fallback template is sent instead when configured, otherwise the
+// send is rejected.
+func (a *App) sendServiceWindowFallback(r *fastglue.Request, account *models.WhatsAppAccount, contact *models.Contact, userID uuid.UUID) error {
+	template, params := a.serviceWindowFallbackTemplate(contact.OrganizationID)
+	if template == nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, serviceWindowClosedMessage, nil, "")
+	}
+
+	opts := DefaultSendOptions()
+	opts.SentByUserID = &userID
+
+	message, err := a.SendOutgoingMessage(context.Background(), OutgoingMessageRequest{
+		Account:    account,
+		Contact:    contact,
+		Type:       models.MessageTypeTemplate,
+		Template:   template,
+		BodyParams: params,
+	}, opts)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to send message", nil, "")
+	}
+
+	a.Log.Info("Service window closed, sent fallback template", "contact_id", contact.ID, "template", template.Name)
+
+	return r.SendEnvelope(MessageResponse{
+		ID:                    message.ID,
+		ContactID:             message.ContactID,
+		Direction:             message.Direction,
+		MessageType:           message.MessageType,
+		Content:               map[string]string{"body": message.Content},
+		Status:                message.Status,
+		ServiceWindowFallback: true,
+		CreatedAt:             message.CreatedAt,
+		UpdatedAt:             message.UpdatedAt,
+	})
+}
@@ -0,0 +1,102 @@
+package handlers_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_SendMessage_WithinServiceWindow(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-time.Hour))
+	require.NoError(t, app.DB.Model(contact).Update("last_inbound_at", time.Now().Add(-time.Hour)).Error)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"type":    "text",
+		"content": map[string]string{"body": "Thanks for reaching out"},
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.SendMessage(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp handlers.MessageResponse
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	assert.Equal(t, models.MessageTypeText, resp.MessageType)
+	assert.False(t, resp.ServiceWindowFallback)
+}
+
+func TestApp_SendMessage_ServiceWindowClosed(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-25*time.Hour))
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"type":    "text",
+		"content": map[string]string{"body": "Are you still there?"},
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.SendMessage(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "customer service window has closed")
+	assert.Empty(t, mockServer.sentMessages)
+}
+
+func TestApp_SendMessage_ServiceWindowClosedUsesOrgFallback(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, account, contact := scheduleTestContact(t, app, time.Now().Add(-25*time.Hour))
+	template := createTestTemplate(t, app, org.ID, account.Name)
+
+	require.NoError(t, app.DB.Model(org).Update("settings", models.JSONB{
+		"service_window_fallback_template_id":     template.ID.String(),
+		"service_window_fallback_template_params": map[string]any{"1": "there"},
+	}).Error)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"type":    "text",
+		"content": map[string]string{"body": "Are you still there?"},
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.SendMessage(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp handlers.MessageResponse
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	assert.Equal(t, models.MessageTypeTemplate, resp.MessageType)
+	assert.True(t, resp.ServiceWindowFallback)
+}
+
+func TestApp_GetContact_ServiceWindow(t *testing.T) {
+	mockServer := newMockWhatsAppServer()
+	defer mockServer.close()
+	app := messageTestApp(t, mockServer)
+	org, user, _, contact := scheduleTestContact(t, app, time.Now().Add(-23*time.Hour))
+
+	req := testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", contact.ID.String())
+
+	require.NoError(t, app.GetContact(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var resp handlers.ContactResponse
+	testutil.ParseEnvelopeResponse(t, req, &resp)
+	assert.True(t, resp.ServiceWindow.Open)
+	require.NotNil(t, resp.ServiceWindow.ExpiresAt)
+	assert.InDelta(t, time.Hour.Seconds(), float64(resp.ServiceWindow.RemainingSeconds), 60)
+}
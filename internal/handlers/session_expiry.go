@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// defaultSessionTimeout applies to settings saved without a session timeout
+const defaultSessionTimeout = 30 * time.Minute
+
+// staleSessionBatch limits the sessions timed out per settings on each run
+const staleSessionBatch = 500
+
+// sessionTimeout returns how long a bot session can go without activity
+func sessionTimeout(settings *models.ChatbotSettings) time.Duration {
+	if settings.SessionTimeoutMins <= 0 {
+		return defaultSessionTimeout
+	}
+	return time.Duration(settings.SessionTimeoutMins) * time.Minute
+}
+
+// expireStaleSessions times out bot sessions that have been inactive for longer
+// than the session timeout of their account, so their flow state and AI history
+// aren't picked up again days later
+func (p *SLAProcessor) expireStaleSessions(now time.Time) {
+	var settings []models.ChatbotSettings
+	if err := p.app.DB.Find(&settings).Error; err != nil {
+		p.app.Log.Error("Failed to load chatbot settings for session timeouts", "error", err)
+		return
+	}
+
+	// Accounts with their own settings don't use the organization defaults
+	ownSettings := make(map[uuid.UUID][]string)
+	for _, s := range settings {
+		if s.WhatsAppAccount != "" {
+			ownSettings[s.OrganizationID] = append(ownSettings[s.OrganizationID], s.WhatsAppAccount)
+		}
+	}
+
+	for i := range settings {
+		p.expireAccountSessions(&settings[i], ownSettings[settings[i].OrganizationID], now)
+	}
+}
+
+// expireAccountSessions times out the stale sessions covered by one settings row
+func (p *SLAProcessor) expireAccountSessions(settings *models.ChatbotSettings, ownSettings []string, now time.Time) {
+	cutoff := now.Add(-sessionTimeout(settings))
+	query := p.app.DB.Where("organization_id = ? AND status = ? AND mode = ? AND last_activity_at < ?",
+		settings.OrganizationID, models.SessionStatusActive, models.SessionModeBot, cutoff)
+	if settings.WhatsAppAccount != "" {
+		query = query.Where("whats_app_account = ?", settings.WhatsAppAccount)
+	} else if len(ownSettings) > 0 {
+		query = query.Where("whats_app_account NOT IN ?", ownSettings)
+	}
+
+	var sessions []models.ChatbotSession
+	if err := query.Limit(staleSessionBatch).Find(&sessions).Error; err != nil {
+		p.app.Log.Error("Failed to find stale sessions", "error", err, "org_id", settings.OrganizationID)
+		return
+	}
+	for i := range sessions {
+		if p.app.expireSession(&sessions[i], cutoff, now) && settings.SessionClosedMessage != "" {
+			p.app.sendSessionClosedMessage(&sessions[i], settings, now)
+		}
+	}
+}
+
+// expireSession times out a session that's still inactive since cutoff,
+// reporting whether it did
+func (a *App) expireSession(session *models.ChatbotSession, cutoff, now time.Time) bool {
+	// The contact may have written since the session was loaded
+	result := a.DB.Model(&models.ChatbotSession{}).
+		Where("id = ? AND status = ? AND last_activity_at < ?", session.ID, models.SessionStatusActive, cutoff).
+		Updates(map[string]any{
+			"status":       models.SessionStatusTimeout,
+			"completed_at": now,
+			"mode":         models.SessionModeClosed,
+		})
+	if result.Error != nil {
+		a.Log.Error("Failed to time out session", "error", result.Error, "session_id", session.ID)
+		return false
+	}
+	if result.RowsAffected == 0 {
+		return false
+	}
+
+	a.Log.Info("Chatbot session timed out", "session_id", session.ID, "contact_id", session.ContactID, "last_activity_at", session.LastActivityAt)
+	a.broadcastSessionUpdate(session.OrganizationID, session.ContactID, session.ID, models.SessionModeClosed)
+	a.ClearContactChatbotTracking(session.ContactID)
+	return true
+}
+
+// sendSessionClosedMessage tells the contact their conversation was closed, in
+// the conversation language, as long as the service window still allows a
+// free-form message
+func (a *App) sendSessionClosedMessage(session *models.ChatbotSession, settings *models.ChatbotSettings, now time.Time) {
+	var contact models.Contact
+	if err := a.DB.Where("id = ?", session.ContactID).First(&contact).Error; err != nil {
+		a.Log.Error("Failed to load contact for session closed message", "error", err, "session_id", session.ID)
+		return
+	}
+	if !isServiceWindowOpen(a.serviceWindowExpiresAt(&contact), now) {
+		return
+	}
+
+	var account models.WhatsAppAccount
+	if err := a.DB.Where("name = ? AND organization_id = ?", session.WhatsAppAccount, session.OrganizationID).First(&account).Error; err != nil {
+		a.Log.Error("Failed to load WhatsApp account for session closed message", "error", err, "session_id", session.ID)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	message := localizedMessage(settings, conversationLanguage(settings, session, &contact), translationSessionClosed, settings.SessionClosedMessage)
+	message = a.expandOrgShortcodes(session.OrganizationID, message)
+	if _, err := a.SendOutgoingMessage(ctx, OutgoingMessageRequest{
+		Account: &account,
+		Contact: &contact,
+		Type:    models.MessageTypeText,
+		Content: message,
+	}, SLASendOptions()); err != nil {
+		a.Log.Error("Failed to send session closed message", "error", err, "phone", contact.PhoneNumber)
+		return
+	}
+	a.logSessionMessage(session.ID, models.DirectionOutgoing, message, "session_closed")
+}
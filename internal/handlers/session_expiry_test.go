@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionTimeout(t *testing.T) {
+	assert.Equal(t, defaultSessionTimeout, sessionTimeout(&models.ChatbotSettings{}))
+	assert.Equal(t, 2*time.Hour, sessionTimeout(&models.ChatbotSettings{SessionTimeoutMins: 120}))
+}
+
+func TestExpireStaleSessions(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	processor := NewSLAProcessor(app, time.Minute)
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Timeout Org " + suffix,
+		Slug:      "timeout-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1777" + suffix[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	require.NoError(t, app.DB.Create(&models.ChatbotSettings{
+		BaseModel:          models.BaseModel{ID: uuid.New()},
+		OrganizationID:     org.ID,
+		SessionTimeoutMins: 60,
+	}).Error)
+	require.NoError(t, app.DB.Create(&models.ChatbotSettings{
+		BaseModel:          models.BaseModel{ID: uuid.New()},
+		OrganizationID:     org.ID,
+		WhatsAppAccount:    "slow",
+		SessionTimeoutMins: 24 * 60,
+	}).Error)
+
+	now := time.Now()
+	newSession := func(account string, mode models.SessionMode, idle time.Duration) *models.ChatbotSession {
+		session := &models.ChatbotSession{
+			BaseModel:       models.BaseModel{ID: uuid.New()},
+			OrganizationID:  org.ID,
+			ContactID:       contact.ID,
+			WhatsAppAccount: account,
+			PhoneNumber:     contact.PhoneNumber,
+			Status:          models.SessionStatusActive,
+			Mode:            mode,
+			StartedAt:       now.Add(-idle),
+			LastActivityAt:  now.Add(-idle),
+		}
+		require.NoError(t, app.DB.Create(session).Error)
+		return session
+	}
+	stale := newSession("shop", models.SessionModeBot, 2*time.Hour)
+	fresh := newSession("shop", models.SessionModeBot, 10*time.Minute)
+	handedOff := newSession("shop", models.SessionModeAgent, 2*time.Hour)
+	ownTimeout := newSession("slow", models.SessionModeBot, 2*time.Hour)
+
+	processor.expireStaleSessions(now)
+
+	status := func(session *models.ChatbotSession) models.SessionStatus {
+		var s models.ChatbotSession
+		require.NoError(t, app.DB.Where("id = ?", session.ID).First(&s).Error)
+		return s.Status
+	}
+	assert.Equal(t, models.SessionStatusTimeout, status(stale))
+	assert.Equal(t, models.SessionStatusActive, status(fresh))
+	assert.Equal(t, models.SessionStatusActive, status(handedOff), "agents close handed off sessions")
+	assert.Equal(t, models.SessionStatusActive, status(ownTimeout), "the account has a longer timeout")
+}
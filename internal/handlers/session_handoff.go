@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// aiHandoffMarker ends AI answers that hand the conversation off to an agent
+const aiHandoffMarker = "[HANDOFF]"
+
+// maxHandoffFallbacks limits the fallback messages in a row before a handoff
+const maxHandoffFallbacks = 10
+
+// aiHandoffInstruction tells the AI when to hand off, when AI handoffs are on
+const aiHandoffInstruction = "If the customer asks to talk to a person, or you can't help them, " +
+	"tell them an agent will follow up and end your reply with " + aiHandoffMarker + "."
+
+var (
+	errSessionNotActive  = errors.New("session is not active")
+	errSessionClaimed    = errors.New("session is already handled by another agent")
+	errSessionNotInQueue = errors.New("session is waiting in another team's queue")
+)
+
+// transferSessionMode returns the mode of a session handed off with a transfer
+func transferSessionMode(transfer *models.AgentTransfer) models.SessionMode {
+	switch {
+	case transfer.Status != models.TransferStatusActive:
+		return models.SessionModeClosed
+	case transfer.AgentID != nil:
+		return models.SessionModeAgent
+	default:
+		return models.SessionModePendingAgent
+	}
+}
+
+// handOffSessions ends the contact's active chatbot session when a new transfer
+// hands the conversation off to the agent queue
+func (a *App) handOffSessions(transfer *models.AgentTransfer) {
+	a.syncSessionMode(transfer)
+	a.DB.Model(&models.ChatbotSession{}).
+		Where("organization_id = ? AND contact_id = ? AND status = ?", transfer.OrganizationID, transfer.ContactID, models.SessionStatusActive).
+		Updates(map[string]any{
+			"status":       models.SessionStatusCancelled,
+			"completed_at": time.Now(),
+		})
+}
+
+// syncSessionMode moves the contact's sessions to the state of their transfer: the
+// active session when it's handed off, then the handed off sessions as agents
+// claim them and hand them back
+func (a *App) syncSessionMode(transfer *models.AgentTransfer) {
+	handedOff := []models.SessionMode{models.SessionModePendingAgent, models.SessionModeAgent}
+	query := a.DB.Model(&models.ChatbotSession{}).
+		Where("organization_id = ? AND contact_id = ?", transfer.OrganizationID, transfer.ContactID)
+	if transfer.Status == models.TransferStatusActive {
+		query = query.Where("(status = ? OR mode IN ?)", models.SessionStatusActive, handedOff)
+	} else {
+		query = query.Where("mode IN ?", handedOff)
+	}
+
+	// Sessions the bot is still answering are the ones being handed off now
+	var handoffIDs []uuid.UUID
+	if transfer.Status == models.TransferStatusActive {
+		a.DB.Model(&models.ChatbotSession{}).
+			Where("organization_id = ? AND contact_id = ? AND status = ? AND mode NOT IN ?",
+				transfer.OrganizationID, transfer.ContactID, models.SessionStatusActive, handedOff).
+			Pluck("id", &handoffIDs)
+	}
+
+	mode := transferSessionMode(transfer)
+	result := query.Update("mode", mode)
+	if result.Error != nil {
+		a.Log.Error("Failed to update session mode", "error", result.Error, "transfer_id", transfer.ID)
+		return
+	}
+	if result.RowsAffected > 0 {
+		a.broadcastSessionUpdate(transfer.OrganizationID, transfer.ContactID, uuid.Nil, mode)
+	}
+
+	for _, sessionID := range handoffIDs {
+		a.dispatchSessionHandoffWebhook(sessionID, transfer)
+	}
+}
+
+// dispatchSessionHandoffWebhook emits session.handoff for a chatbot session handed
+// off to an agent with a transfer
+func (a *App) dispatchSessionHandoffWebhook(sessionID uuid.UUID, transfer *models.AgentTransfer) {
+	var contact models.Contact
+	a.DB.Where("id = ?", transfer.ContactID).First(&contact)
+
+	data := SessionHandoffEventData{
+		SessionID:       sessionID.String(),
+		TransferID:      transfer.ID.String(),
+		ContactID:       transfer.ContactID.String(),
+		ContactPhone:    transfer.PhoneNumber,
+		ContactName:     contact.ProfileName,
+		Source:          transfer.Source,
+		Reason:          transfer.Notes,
+		WhatsAppAccount: transfer.WhatsAppAccount,
+	}
+	if transfer.AgentID != nil {
+		agentID := transfer.AgentID.String()
+		data.AgentID = &agentID
+	}
+	if transfer.TeamID != nil {
+		teamID := transfer.TeamID.String()
+		data.TeamID = &teamID
+	}
+	a.DispatchWebhook(transfer.OrganizationID, models.WebhookEventSessionHandoff, data)
+}
+
+// broadcastSessionUpdate tells the organization's agents who is answering a
+// contact now. sessionID is left out when several sessions changed.
+func (a *App) broadcastSessionUpdate(orgID, contactID, sessionID uuid.UUID, mode models.SessionMode) {
+	if a.WSHub == nil {
+		return
+	}
+
+	payload := map[string]any{
+		"contact_id": contactID.String(),
+		"mode":       mode,
+	}
+	if sessionID != uuid.Nil {
+		payload["session_id"] = sessionID.String()
+	}
+
+	a.WSHub.BroadcastToOrg(orgID, websocket.WSMessage{
+		Type:    websocket.TypeSessionUpdate,
+		Payload: payload,
+	})
+}
+
+// splitAIHandoff removes the handoff marker from an AI answer, reporting whether
+// it was there
+func splitAIHandoff(text string) (string, bool) {
+	if !strings.Contains(text, aiHandoffMarker) {
+		return text, false
+	}
+	return strings.TrimSpace(strings.ReplaceAll(text, aiHandoffMarker, "")), true
+}
+
+// fallbacksInARow reports whether the last n answers of a session were all the
+// fallback message
+func (a *App) fallbacksInARow(sessionID uuid.UUID, n int) bool {
+	if n <= 0 {
+		return false
+	}
+	var steps []string
+	a.DB.Model(&models.ChatbotSessionMessage{}).
+		Where("session_id = ? AND direction = ?", sessionID, models.DirectionOutgoing).
+		Order("created_at DESC").
+		Limit(n).
+		Pluck("step_name", &steps)
+	if len(steps) < n {
+		return false
+	}
+	for _, step := range steps {
+		if step != "fallback_response" {
+			return false
+		}
+	}
+	return true
+}
+
+// ClaimChatbotSession lets an agent take over a conversation: a session waiting
+// in the agent queue is assigned to them, and an active bot session is handed
+// off to them so the bot stops answering
+func (a *App) ClaimChatbotSession(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	// Same rules as picking transfers from the queue
+	hasFullAccess := a.HasPermission(userID, models.ResourceTransfers, models.ActionWrite)
+	if !hasFullAccess {
+		if !a.HasPermission(userID, models.ResourceTransfers, models.ActionPickup) {
+			return r.SendErrorEnvelope(fasthttp.StatusForbidden, "You don't have permission to claim sessions", nil, "")
+		}
+		if settings, _ := a.getChatbotSettingsCached(orgID, ""); settings != nil && !settings.AgentAssignment.AllowQueuePickup {
+			return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Queue pickup is not allowed", nil, "")
+		}
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid session ID", nil, "")
+	}
+
+	var session models.ChatbotSession
+	var transfer models.AgentTransfer
+	created := false
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the session so agents claiming it at once don't both get it
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND organization_id = ?", id, orgID).First(&session).Error; err != nil {
+			return err
+		}
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("organization_id = ? AND contact_id = ? AND status = ?", orgID, session.ContactID, models.TransferStatusActive).
+			First(&transfer).Error
+		switch {
+		case err == nil:
+			if transfer.AgentID != nil && *transfer.AgentID != userID {
+				return errSessionClaimed
+			}
+			if !hasFullAccess && transfer.TeamID != nil && !a.isTeamMember(userID, *transfer.TeamID) {
+				return errSessionNotInQueue
+			}
+			transfer.AgentID = &userID
+			if transfer.TransferredByUserID == nil {
+				transfer.TransferredByUserID = &userID
+			}
+			if transfer.SLA.PickedUpAt == nil {
+				a.UpdateSLAOnPickup(&transfer)
+			}
+			if err := tx.Save(&transfer).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound) && session.Status == models.SessionStatusActive && session.Mode != models.SessionModeClosed:
+			transfer = models.AgentTransfer{
+				BaseModel:           models.BaseModel{ID: uuid.New()},
+				OrganizationID:      orgID,
+				ContactID:           session.ContactID,
+				WhatsAppAccount:     session.WhatsAppAccount,
+				PhoneNumber:         session.PhoneNumber,
+				Status:              models.TransferStatusActive,
+				Source:              models.TransferSourceManual,
+				AgentID:             &userID,
+				TransferredByUserID: &userID,
+				TransferredAt:       time.Now(),
+			}
+			if settings, _ := a.getChatbotSettingsCached(orgID, session.WhatsAppAccount); settings != nil {
+				a.SetSLADeadlines(&transfer, settings)
+			}
+			a.UpdateSLAOnPickup(&transfer)
+			if err := tx.Create(&transfer).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&session).Updates(map[string]any{
+				"status":       models.SessionStatusCancelled,
+				"completed_at": time.Now(),
+				"mode":         models.SessionModeAgent,
+			}).Error; err != nil {
+				return err
+			}
+			created = true
+		case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		default:
+			return errSessionNotActive
+		}
+
+		return tx.Model(&models.Contact{}).Where("id = ?", session.ContactID).Update("assigned_user_id", userID).Error
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Session not found", nil, "")
+	case errors.Is(err, errSessionClaimed):
+		return r.SendErrorEnvelope(fasthttp.StatusConflict, "Session is already handled by another agent", nil, "")
+	case errors.Is(err, errSessionNotInQueue):
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "You are not a member of this team", nil, "")
+	case errors.Is(err, errSessionNotActive):
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Session is not active", nil, "")
+	case err != nil:
+		a.Log.Error("Failed to claim session", "error", err, "session_id", id)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to claim session", nil, "")
+	}
+
+	a.syncSessionMode(&transfer)
+	if created {
+		var contact models.Contact
+		a.DB.Where("id = ?", session.ContactID).First(&contact)
+		a.broadcastTransferCreated(&transfer, &contact)
+		a.dispatchSessionHandoffWebhook(session.ID, &transfer)
+
+		agentID := userID.String()
+		a.DispatchWebhook(orgID, models.WebhookEventTransferCreated, TransferEventData{
+			TransferID:      transfer.ID.String(),
+			ContactID:       contact.ID.String(),
+			ContactPhone:    contact.PhoneNumber,
+			ContactName:     contact.ProfileName,
+			Source:          transfer.Source,
+			AgentID:         &agentID,
+			WhatsAppAccount: transfer.WhatsAppAccount,
+		})
+	} else {
+		a.broadcastTransferAssigned(&transfer)
+	}
+
+	return r.SendEnvelope(map[string]any{
+		"message":     "Session claimed",
+		"session_id":  session.ID,
+		"transfer_id": transfer.ID,
+		"mode":        models.SessionModeAgent,
+	})
+}
+
+// isTeamMember reports whether a user belongs to a team
+func (a *App) isTeamMember(userID, teamID uuid.UUID) bool {
+	var count int64
+	a.DB.Model(&models.TeamMember{}).Where("user_id = ? AND team_id = ?", userID, teamID).Count(&count)
+	return count > 0
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	ws "github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferSessionMode(t *testing.T) {
+	agentID := uuid.New()
+
+	assert.Equal(t, models.SessionModePendingAgent, transferSessionMode(&models.AgentTransfer{Status: models.TransferStatusActive}))
+	assert.Equal(t, models.SessionModeAgent, transferSessionMode(&models.AgentTransfer{Status: models.TransferStatusActive, AgentID: &agentID}))
+	assert.Equal(t, models.SessionModeClosed, transferSessionMode(&models.AgentTransfer{Status: models.TransferStatusResumed, AgentID: &agentID}))
+	assert.Equal(t, models.SessionModeClosed, transferSessionMode(&models.AgentTransfer{Status: models.TransferStatusExpired}))
+}
+
+func TestSplitAIHandoff(t *testing.T) {
+	text, handoff := splitAIHandoff("We're open 9-5.")
+	assert.False(t, handoff)
+	assert.Equal(t, "We're open 9-5.", text)
+
+	text, handoff = splitAIHandoff("Sure, an agent will follow up shortly. [HANDOFF]")
+	assert.True(t, handoff)
+	assert.Equal(t, "Sure, an agent will follow up shortly.", text)
+
+	text, handoff = splitAIHandoff(" [HANDOFF] ")
+	assert.True(t, handoff)
+	assert.Empty(t, text)
+}
+
+// connectTestAgent connects an agent of the organization to the hub, and returns a
+// function that reads the next message the agent gets, or fails after a while
+func connectTestAgent(t *testing.T, hub *ws.Hub, orgID uuid.UUID) func() (ws.WSMessage, bool) {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		client := ws.NewClient(hub, conn, uuid.New(), orgID)
+		hub.Register(client)
+		go client.WritePump()
+		client.ReadPump()
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	require.Eventually(t, func() bool { return hub.GetClientCount() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	return func() (ws.WSMessage, bool) {
+		var msg ws.WSMessage
+		_ = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return msg, false
+		}
+		require.NoError(t, json.Unmarshal(data, &msg))
+		return msg, true
+	}
+}
+
+func TestBroadcastSessionUpdate(t *testing.T) {
+	// Without a hub nothing is sent
+	(&App{}).broadcastSessionUpdate(uuid.New(), uuid.New(), uuid.New(), models.SessionModeBot)
+
+	hub := ws.NewHub(testutil.NopLogger())
+	go hub.Run()
+	orgID, contactID, sessionID := uuid.New(), uuid.New(), uuid.New()
+	next := connectTestAgent(t, hub, orgID)
+	app := &App{WSHub: hub}
+
+	app.broadcastSessionUpdate(orgID, contactID, sessionID, models.SessionModeBot)
+	msg, ok := next()
+	require.True(t, ok)
+	assert.Equal(t, ws.TypeSessionUpdate, msg.Type)
+	assert.Equal(t, map[string]any{
+		"contact_id": contactID.String(),
+		"session_id": sessionID.String(),
+		"mode":       string(models.SessionModeBot),
+	}, msg.Payload)
+
+	// A change to several sessions leaves the session out
+	app.broadcastSessionUpdate(orgID, contactID, uuid.Nil, models.SessionModeClosed)
+	msg, ok = next()
+	require.True(t, ok)
+	assert.Equal(t, map[string]any{"contact_id": contactID.String(), "mode": string(models.SessionModeClosed)}, msg.Payload)
+
+	// Other organizations' agents aren't told
+	app.broadcastSessionUpdate(uuid.New(), contactID, sessionID, models.SessionModeAgent)
+	_, ok = next()
+	assert.False(t, ok)
+}
+
+func TestSyncSessionMode_BroadcastsSessionUpdate(t *testing.T) {
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger()}
+	app.WSHub = ws.NewHub(app.Log)
+	go app.WSHub.Run()
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{Name: "Handoff Org " + suffix, Slug: "handoff-org-" + suffix}
+	require.NoError(t, app.DB.Create(org).Error)
+	contact := &models.Contact{OrganizationID: org.ID, PhoneNumber: "1558" + suffix[:7]}
+	require.NoError(t, app.DB.Create(contact).Error)
+	session := &models.ChatbotSession{
+		OrganizationID: org.ID,
+		ContactID:      contact.ID,
+		PhoneNumber:    contact.PhoneNumber,
+		Status:         models.SessionStatusActive,
+		Mode:           models.SessionModeAgent,
+	}
+	require.NoError(t, app.DB.Create(session).Error)
+	next := connectTestAgent(t, app.WSHub, org.ID)
+
+	// Handing the contact back closes the handed off session
+	transfer := &models.AgentTransfer{OrganizationID: org.ID, ContactID: contact.ID, Status: models.TransferStatusResumed}
+	app.syncSessionMode(transfer)
+	msg, ok := next()
+	require.True(t, ok)
+	assert.Equal(t, ws.TypeSessionUpdate, msg.Type)
+	assert.Equal(t, map[string]any{"contact_id": contact.ID.String(), "mode": string(models.SessionModeClosed)}, msg.Payload)
+
+	// Nothing changed, nothing is sent
+	app.syncSessionMode(transfer)
+	_, ok = next()
+	assert.False(t, ok)
+}
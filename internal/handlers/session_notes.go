@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// SessionNoteRequest adds a private note to a chatbot session
+type SessionNoteRequest struct {
+	Content  string   `json:"content"`
+	Mentions []string `json:"mentions"` // IDs of the teammates mentioned with @, who are notified
+}
+
+// SessionNoteResponse represents a session note in API responses
+type SessionNoteResponse struct {
+	ID            uuid.UUID       `json:"id"`
+	SessionID     uuid.UUID       `json:"session_id"`
+	ContactID     uuid.UUID       `json:"contact_id"`
+	Content       string          `json:"content"`
+	CreatedByID   uuid.UUID       `json:"created_by_id"`
+	CreatedByName string          `json:"created_by_name,omitempty"`
+	Mentions      []MentionedUser `json:"mentions"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// MentionedUser is a teammate mentioned in a session note
+type MentionedUser struct {
+	UserID   uuid.UUID `json:"user_id"`
+	FullName string    `json:"full_name"`
+}
+
+// MentionResponse is a mention of the user in a session note
+type MentionResponse struct {
+	ID          uuid.UUID           `json:"id"`
+	Note        SessionNoteResponse `json:"note"`
+	ContactName string              `json:"contact_name"`
+	ReadAt      *time.Time          `json:"read_at,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
+
+// ListSessionNotes returns the private notes on a chatbot session, oldest first
+func (a *App) ListSessionNotes(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	session, errMsg, status := a.accessibleSession(r, orgID)
+	if session == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var notes []models.SessionNote
+	if err := a.DB.Where("session_id = ? AND organization_id = ?", session.ID, orgID).
+		Preload("CreatedBy").
+		Preload("Mentions.User").
+		Order("created_at ASC").
+		Find(&notes).Error; err != nil {
+		a.Log.Error("Failed to list session notes", "error", err, "session_id", session.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list notes", nil, "")
+	}
+
+	result := make([]SessionNoteResponse, len(notes))
+	for i, n := range notes {
+		result[i] = sessionNoteToResponse(n)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"notes": result,
+	})
+}
+
+// CreateSessionNote adds a private note to a chatbot session. It's shown to the
+// agents viewing the conversation, and the mentioned teammates are notified.
+func (a *App) CreateSessionNote(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	session, errMsg, status := a.accessibleSession(r, orgID)
+	if session == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var req SessionNoteRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	content := strings.TrimSpace(req.Content)
+	if content == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Note content is required", nil, "")
+	}
+
+	mentioned, errMsg := a.mentionedUsers(orgID, req.Mentions)
+	if errMsg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, errMsg, nil, "")
+	}
+
+	note := models.SessionNote{
+		OrganizationID: orgID,
+		SessionID:      session.ID,
+		ContactID:      session.ContactID,
+		Content:        content,
+		CreatedByID:    userID,
+	}
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&note).Error; err != nil {
+			return err
+		}
+		for _, user := range mentioned {
+			// Authors who mention themselves aren't notified
+			if user.ID == userID {
+				continue
+			}
+			mention := models.SessionNoteMention{
+				OrganizationID: orgID,
+				NoteID:         note.ID,
+				UserID:         user.ID,
+			}
+			if err := tx.Create(&mention).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		a.Log.Error("Failed to create session note", "error", err, "session_id", session.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create note", nil, "")
+	}
+
+	if err := a.DB.Preload("CreatedBy").Preload("Mentions.User").First(&note, note.ID).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Note not found", nil, "")
+	}
+	resp := sessionNoteToResponse(note)
+	a.broadcastSessionNote(session, resp, note.Mentions)
+
+	return r.SendEnvelope(resp)
+}
+
+// DeleteSessionNote removes a note from a chatbot session. Only its author can.
+func (a *App) DeleteSessionNote(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	session, errMsg, status := a.accessibleSession(r, orgID)
+	if session == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	noteID, err := uuid.Parse(r.RequestCtx.UserValue("note_id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid note ID", nil, "")
+	}
+
+	var note models.SessionNote
+	if err := a.DB.Where("id = ? AND session_id = ? AND organization_id = ?", noteID, session.ID, orgID).
+		First(&note).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Note not found", nil, "")
+	}
+	if note.CreatedByID != userID {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only the author can delete a note", nil, "")
+	}
+
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("note_id = ?", note.ID).Delete(&models.SessionNoteMention{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&note).Error
+	})
+	if err != nil {
+		a.Log.Error("Failed to delete session note", "error", err, "note_id", note.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete note", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Note deleted",
+	})
+}
+
+// ListMentions returns the session notes the user was mentioned in, newest first.
+// With unread_only=true, only those not marked as read.
+func (a *App) ListMentions(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	query := a.DB.Where("organization_id = ? AND user_id = ?", orgID, userID)
+	if string(r.RequestCtx.QueryArgs().Peek("unread_only")) == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var mentions []models.SessionNoteMention
+	if err := query.
+		Preload("Note.CreatedBy").
+		Preload("Note.Mentions.User").
+		Order("created_at DESC").
+		Limit(100).
+		Find(&mentions).Error; err != nil {
+		a.Log.Error("Failed to list mentions", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list mentions", nil, "")
+	}
+
+	contactIDs := make([]uuid.UUID, 0, len(mentions))
+	for _, m := range mentions {
+		if m.Note != nil {
+			contactIDs = append(contactIDs, m.Note.ContactID)
+		}
+	}
+	var contacts []models.Contact
+	if len(contactIDs) > 0 {
+		a.DB.Select("id, profile_name, phone_number").Where("id IN ?", contactIDs).Find(&contacts)
+	}
+	contactNames := make(map[uuid.UUID]string, len(contacts))
+	for _, c := range contacts {
+		contactNames[c.ID] = c.ProfileName
+		if c.ProfileName == "" {
+			contactNames[c.ID] = c.PhoneNumber
+		}
+	}
+
+	result := make([]MentionResponse, 0, len(mentions))
+	for _, m := range mentions {
+		// The note was deleted
+		if m.Note == nil {
+			continue
+		}
+		result = append(result, MentionResponse{
+			ID:          m.ID,
+			Note:        sessionNoteToResponse(*m.Note),
+			ContactName: contactNames[m.Note.ContactID],
+			ReadAt:      m.ReadAt,
+			CreatedAt:   m.CreatedAt,
+		})
+	}
+
+	var unread int64
+	a.DB.Model(&models.SessionNoteMention{}).
+		Where("organization_id = ? AND user_id = ? AND read_at IS NULL", orgID, userID).
+		Count(&unread)
+
+	return r.SendEnvelope(map[string]interface{}{
+		"mentions":     result,
+		"unread_count": unread,
+	})
+}
+
+// MarkMentionRead marks a mention of the user as read
+func (a *App) MarkMentionRead(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid mention ID", nil, "")
+	}
+
+	result := a.DB.Model(&models.SessionNoteMention{}).
+		Where("id = ? AND organization_id = ? AND user_id = ?", id, orgID, userID).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", time.Now()))
+	if result.Error != nil {
+		a.Log.Error("Failed to mark mention as read", "error", result.Error, "mention_id", id)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update mention", nil, "")
+	}
+	if result.RowsAffected == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Mention not found", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message": "Mention marked as read",
+	})
+}
+
+// accessibleSession loads the chatbot session in the request path. Users without
+// full contact read permission can only see the sessions of their assigned contacts.
+func (a *App) accessibleSession(r *fastglue.Request, orgID uuid.UUID) (*models.ChatbotSession, string, int) {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	sessionID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, "Invalid session ID", fasthttp.StatusBadRequest
+	}
+
+	var session models.ChatbotSession
+	if err := a.DB.Where("id = ? AND organization_id = ?", sessionID, orgID).First(&session).Error; err != nil {
+		return nil, "Session not found", fasthttp.StatusNotFound
+	}
+	if _, err := a.findReplyContact(orgID, userID, session.ContactID); err != nil {
+		return nil, "Session not found", fasthttp.StatusNotFound
+	}
+	return &session, "", 0
+}
+
+// mentionedUsers returns the active users of the organization with the given IDs
+func (a *App) mentionedUsers(orgID uuid.UUID, ids []string) ([]models.User, string) {
+	if len(ids) == 0 {
+		return nil, ""
+	}
+
+	seen := make(map[uuid.UUID]bool, len(ids))
+	userIDs := make([]uuid.UUID, 0, len(ids))
+	for _, s := range ids {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, "Invalid mentioned user ID"
+		}
+		if !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+
+	var users []models.User
+	if err := a.DB.Where("id IN ? AND organization_id = ? AND is_active = ?", userIDs, orgID, true).
+		Find(&users).Error; err != nil || len(users) != len(userIDs) {
+		return nil, "Mentioned user not found"
+	}
+	return users, ""
+}
+
+// broadcastSessionNote shows a new note to the agents viewing the conversation,
+// and notifies the mentioned teammates wherever they are in the app
+func (a *App) broadcastSessionNote(session *models.ChatbotSession, note SessionNoteResponse, mentions []models.SessionNoteMention) {
+	if a.WSHub == nil {
+		return
+	}
+
+	a.WSHub.BroadcastToContact(session.OrganizationID, session.ContactID, websocket.WSMessage{
+		Type:    websocket.TypeSessionNote,
+		Payload: note,
+	})
+
+	var contact models.Contact
+	a.DB.Select("id, profile_name, phone_number").Where("id = ?", session.ContactID).First(&contact)
+	for _, m := range mentions {
+		a.WSHub.BroadcastToUser(session.OrganizationID, m.UserID, websocket.WSMessage{
+			Type: websocket.TypeNoteMention,
+			Payload: map[string]any{
+				"id":           m.ID.String(),
+				"note_id":      note.ID.String(),
+				"session_id":   session.ID.String(),
+				"contact_id":   contact.ID.String(),
+				"contact_name": contact.ProfileName,
+				"phone_number": contact.PhoneNumber,
+				"author_name":  note.CreatedByName,
+				"content":      note.Content,
+			},
+		})
+	}
+}
+
+func sessionNoteToResponse(n models.SessionNote) SessionNoteResponse {
+	resp := SessionNoteResponse{
+		ID:          n.ID,
+		SessionID:   n.SessionID,
+		ContactID:   n.ContactID,
+		Content:     n.Content,
+		CreatedByID: n.CreatedByID,
+		Mentions:    make([]MentionedUser, 0, len(n.Mentions)),
+		CreatedAt:   n.CreatedAt,
+	}
+	if n.CreatedBy != nil {
+		resp.CreatedByName = n.CreatedBy.FullName
+	}
+	for _, m := range n.Mentions {
+		mentioned := MentionedUser{UserID: m.UserID}
+		if m.User != nil {
+			mentioned.FullName = m.User.FullName
+		}
+		resp.Mentions = append(resp.Mentions, mentioned)
+	}
+	return resp
+}
@@ -0,0 +1,108 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestApp_SessionNotes(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	author := createTestUser(t, app, org.ID, uniqueEmail("note-author"), "password", nil, true)
+	teammate := createTestUser(t, app, org.ID, uniqueEmail("note-teammate"), "password", nil, true)
+	account := createTestAccount(t, app, org.ID)
+	contact := createMsgTestContact(t, app, org.ID, account.Name)
+	require.NoError(t, app.DB.Model(contact).Update("assigned_user_id", author.ID).Error)
+
+	session := &models.ChatbotSession{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		PhoneNumber:     contact.PhoneNumber,
+		Mode:            models.SessionModeAgent,
+	}
+	require.NoError(t, app.DB.Create(session).Error)
+
+	req := testutil.NewJSONRequest(t, map[string]any{
+		"content":  "Customer is asking for a refund, can you check?",
+		"mentions": []string{teammate.ID.String(), author.ID.String()},
+	})
+	setAuthContext(req, org.ID, author.ID)
+	testutil.SetPathParam(req, "id", session.ID.String())
+	require.NoError(t, app.CreateSessionNote(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var note handlers.SessionNoteResponse
+	testutil.ParseEnvelopeResponse(t, req, &note)
+	assert.Equal(t, contact.ID, note.ContactID)
+	require.Len(t, note.Mentions, 1, "authors aren't mentioned by themselves")
+	assert.Equal(t, teammate.ID, note.Mentions[0].UserID)
+
+	// Notes are never sent to the customer
+	var messages int64
+	app.DB.Model(&models.Message{}).Where("contact_id = ?", contact.ID).Count(&messages)
+	assert.Zero(t, messages)
+
+	// The teammate has an unread mention
+	req = testutil.NewGETRequest(t)
+	setAuthContext(req, org.ID, teammate.ID)
+	testutil.SetQueryParam(req, "unread_only", "true")
+	require.NoError(t, app.ListMentions(req))
+	var mentions struct {
+		Mentions    []handlers.MentionResponse `json:"mentions"`
+		UnreadCount int64                      `json:"unread_count"`
+	}
+	testutil.ParseEnvelopeResponse(t, req, &mentions)
+	require.Len(t, mentions.Mentions, 1)
+	assert.EqualValues(t, 1, mentions.UnreadCount)
+	assert.Equal(t, note.ID, mentions.Mentions[0].Note.ID)
+	assert.Equal(t, "Test Contact", mentions.Mentions[0].ContactName)
+
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, teammate.ID)
+	testutil.SetPathParam(req, "id", mentions.Mentions[0].ID.String())
+	require.NoError(t, app.MarkMentionRead(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	var unread int64
+	app.DB.Model(&models.SessionNoteMention{}).Where("user_id = ? AND read_at IS NULL", teammate.ID).Count(&unread)
+	assert.Zero(t, unread)
+
+	// The teammate isn't assigned the contact, so can't see its session
+	req = testutil.NewGETRequest(t)
+	setAuthContext(req, org.ID, teammate.ID)
+	testutil.SetPathParam(req, "id", session.ID.String())
+	require.NoError(t, app.ListSessionNotes(req))
+	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
+
+	req = testutil.NewGETRequest(t)
+	setAuthContext(req, org.ID, author.ID)
+	testutil.SetPathParam(req, "id", session.ID.String())
+	require.NoError(t, app.ListSessionNotes(req))
+	var list struct {
+		Notes []handlers.SessionNoteResponse `json:"notes"`
+	}
+	testutil.ParseEnvelopeResponse(t, req, &list)
+	require.Len(t, list.Notes, 1)
+
+	req = testutil.NewJSONRequest(t, map[string]any{"content": "Hi", "mentions": []string{uuid.NewString()}})
+	setAuthContext(req, org.ID, author.ID)
+	testutil.SetPathParam(req, "id", session.ID.String())
+	require.NoError(t, app.CreateSessionNote(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusBadRequest, "Mentioned user not found")
+
+	req = testutil.NewJSONRequest(t, nil)
+	setAuthContext(req, org.ID, author.ID)
+	testutil.SetPathParam(req, "id", session.ID.String())
+	testutil.SetPathParam(req, "note_id", note.ID.String())
+	require.NoError(t, app.DeleteSessionNote(req))
+	require.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+}
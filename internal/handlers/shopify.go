@@ -0,0 +1,519 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/shopify"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+const (
+	// orderLookupToolName is the built-in tool the AI looks up Shopify orders with
+	orderLookupToolName = "get_order_status"
+	// maxShopifyOrders is how many of a customer's latest orders a lookup by phone returns
+	maxShopifyOrders = 3
+)
+
+// orderLookupTool lets the AI tell customers where their orders are
+var orderLookupTool = AITool{
+	Name:        orderLookupToolName,
+	Description: "Look up the status, total and tracking of the customer's orders. Without an order number it returns their latest orders.",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"order_number": map[string]interface{}{"type": "string", "description": "Order number the customer gave, e.g. 1001. Optional."},
+		},
+	},
+}
+
+// errShopifyNotConnected is returned when the organization hasn't connected a
+// Shopify store
+var errShopifyNotConnected = errors.New("shopify is not connected")
+
+// shopDomainPattern matches the myshopify.com domain the Admin API is served on
+var shopDomainPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*\.myshopify\.com$`)
+
+// ShopifySettings connect the Shopify store orders are looked up in, and the
+// sequences its events enroll contacts in
+type ShopifySettings struct {
+	ShopDomain              string // e.g. acme.myshopify.com
+	AccessToken             string // Admin API access token of a custom app, may reference a secret
+	ShopName                string
+	AbandonedCartSequenceID string // Enrolls customers whose checkout was abandoned
+	ShippingSequenceID      string // Enrolls customers when an order ships
+}
+
+// ShopifySettingsRequest updates Shopify settings. Omitted fields keep their
+// current value.
+type ShopifySettingsRequest struct {
+	ShopDomain              *string `json:"shop_domain"`
+	AccessToken             *string `json:"access_token"`
+	AbandonedCartSequenceID *string `json:"abandoned_cart_sequence_id"`
+	ShippingSequenceID      *string `json:"shipping_sequence_id"`
+}
+
+// shopifySettings reads the Shopify settings from organization settings
+func shopifySettings(settings models.JSONB) ShopifySettings {
+	var s ShopifySettings
+	raw, ok := settings["shopify"].(map[string]interface{})
+	if !ok {
+		return s
+	}
+	s.ShopDomain, _ = raw["shop_domain"].(string)
+	s.AccessToken = models.SettingSecret(raw, "access_token")
+	s.ShopName, _ = raw["shop_name"].(string)
+	s.AbandonedCartSequenceID, _ = raw["abandoned_cart_sequence_id"].(string)
+	s.ShippingSequenceID, _ = raw["shipping_sequence_id"].(string)
+	return s
+}
+
+// loadShopifySettings loads an organization's Shopify settings
+func (a *App) loadShopifySettings(orgID uuid.UUID) (ShopifySettings, error) {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return ShopifySettings{}, err
+	}
+	return shopifySettings(org.Settings), nil
+}
+
+// shopifySettingsResponse is the settings as returned by the API. The access token
+// is never returned, only whether it's set.
+func shopifySettingsResponse(s ShopifySettings) map[string]interface{} {
+	return map[string]interface{}{
+		"shop_domain":                s.ShopDomain,
+		"access_token_set":           s.AccessToken != "",
+		"shop_name":                  s.ShopName,
+		"connected":                  s.ShopDomain != "" && s.AccessToken != "",
+		"abandoned_cart_sequence_id": s.AbandonedCartSequenceID,
+		"shipping_sequence_id":       s.ShippingSequenceID,
+	}
+}
+
+// normalizeShopDomain turns a store URL into its myshopify.com domain
+func normalizeShopDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "https://"), "http://")
+	domain = strings.TrimSuffix(domain, "/")
+	if domain != "" && !shopDomainPattern.MatchString(domain) {
+		return "", errors.New("shop_domain must be the store's myshopify.com domain, e.g. acme.myshopify.com")
+	}
+	return domain, nil
+}
+
+// GetShopifySettings returns the organization's Shopify settings
+func (a *App) GetShopifySettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	s, err := a.loadShopifySettings(orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	return r.SendEnvelope(shopifySettingsResponse(s))
+}
+
+// UpdateShopifySettings connects or disconnects the organization's Shopify store and
+// sets the sequences its events enroll contacts in. A store is only saved once it
+// can be read with the access token.
+func (a *App) UpdateShopifySettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req ShopifySettingsRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	before := orgSettingsAuditSnapshot(&org)
+	s := shopifySettings(org.Settings)
+
+	if req.ShopDomain != nil {
+		if s.ShopDomain, err = normalizeShopDomain(*req.ShopDomain); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+		}
+	}
+	if req.AccessToken != nil {
+		s.AccessToken = strings.TrimSpace(*req.AccessToken)
+	}
+	if req.AbandonedCartSequenceID != nil {
+		s.AbandonedCartSequenceID = strings.TrimSpace(*req.AbandonedCartSequenceID)
+	}
+	if req.ShippingSequenceID != nil {
+		s.ShippingSequenceID = strings.TrimSpace(*req.ShippingSequenceID)
+	}
+
+	if (s.ShopDomain == "") != (s.AccessToken == "") {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "shop_domain and access_token are both required", nil, "")
+	}
+	s.ShopName = ""
+	if s.ShopDomain != "" {
+		token, err := a.resolveCredential(r.RequestCtx, orgID, s.AccessToken)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "access_token: "+err.Error(), nil, "")
+		}
+		shop, err := a.shopifyClient().GetShop(r.RequestCtx, shopify.Credentials{ShopDomain: s.ShopDomain, AccessToken: token})
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Can't connect to the store: "+err.Error(), nil, "")
+		}
+		s.ShopName = shop.Name
+	}
+	for _, seq := range []struct{ field, id string }{
+		{"abandoned_cart_sequence_id", s.AbandonedCartSequenceID},
+		{"shipping_sequence_id", s.ShippingSequenceID},
+	} {
+		if seq.id == "" {
+			continue
+		}
+		sequenceID, err := uuid.Parse(seq.id)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid "+seq.field, nil, "")
+		}
+		var count int64
+		a.DB.Model(&models.Sequence{}).Where("id = ? AND organization_id = ?", sequenceID, orgID).Count(&count)
+		if count == 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Sequence not found: "+seq.field, nil, "")
+		}
+	}
+
+	if org.Settings == nil {
+		org.Settings = models.JSONB{}
+	}
+	section := map[string]interface{}{
+		"shop_domain":                s.ShopDomain,
+		"access_token":               s.AccessToken,
+		"shop_name":                  s.ShopName,
+		"abandoned_cart_sequence_id": s.AbandonedCartSequenceID,
+		"shipping_sequence_id":       s.ShippingSequenceID,
+	}
+	if err := models.EncryptSettingSecrets("shopify", section); err != nil {
+		a.Log.Error("Failed to encrypt Shopify credentials", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	org.Settings["shopify"] = section
+	if err := a.DB.Save(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	a.recordOrgSettingsAudit(r, &org, before)
+
+	return r.SendEnvelope(shopifySettingsResponse(s))
+}
+
+// shopifyClient returns the client for calls to Shopify
+func (a *App) shopifyClient() *shopify.Client {
+	if a.Shopify != nil {
+		return a.Shopify
+	}
+	client := shopify.New(a.Log)
+	client.HTTPClient = a.httpClient(config.OutboundShopify, shopify.DefaultTimeout)
+	return client
+}
+
+// shopifyCredentials returns the credentials of an organization's connected store
+func (a *App) shopifyCredentials(ctx context.Context, orgID uuid.UUID) (shopify.Credentials, error) {
+	s, err := a.loadShopifySettings(orgID)
+	if err != nil {
+		return shopify.Credentials{}, err
+	}
+	if s.ShopDomain == "" || s.AccessToken == "" {
+		return shopify.Credentials{}, errShopifyNotConnected
+	}
+	token, err := a.resolveCredential(ctx, orgID, s.AccessToken)
+	if err != nil {
+		return shopify.Credentials{}, err
+	}
+	return shopify.Credentials{ShopDomain: s.ShopDomain, AccessToken: token}, nil
+}
+
+// samePhoneNumber reports whether two phone numbers are the same, ignoring
+// formatting and a country code only one of them has
+func samePhoneNumber(a, b string) bool {
+	a, b = searchPhoneDigits(a), searchPhoneDigits(b)
+	if len(a) < 7 || len(b) < 7 {
+		return false
+	}
+	return strings.HasSuffix(a, b) || strings.HasSuffix(b, a)
+}
+
+// lookupShopifyOrders returns a contact's order by its number, or their latest
+// orders without one. Orders of another phone number aren't returned, so customers
+// can't look up each other's orders.
+func (a *App) lookupShopifyOrders(ctx context.Context, orgID uuid.UUID, contact *models.Contact, orderNumber string) ([]shopify.Order, error) {
+	creds, err := a.shopifyCredentials(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if orderNumber == "" {
+		if !isPhoneNumber(contact.PhoneNumber) {
+			return nil, shopify.ErrOrderNotFound
+		}
+		return a.shopifyClient().OrdersByPhone(ctx, creds, contact.PhoneNumber, maxShopifyOrders)
+	}
+
+	order, err := a.shopifyClient().OrderByName(ctx, creds, orderNumber)
+	if err != nil {
+		return nil, err
+	}
+	for _, phone := range order.Phones() {
+		if samePhoneNumber(phone, contact.PhoneNumber) {
+			return []shopify.Order{*order}, nil
+		}
+	}
+	return nil, shopify.ErrOrderNotFound
+}
+
+// orderStatus summarizes where an order is: cancelled, refunded, the carrier's
+// status of its latest shipment, shipped, partially_shipped, awaiting_payment or
+// processing
+func orderStatus(o *shopify.Order) string {
+	switch {
+	case o.CancelledAt != nil:
+		return "cancelled"
+	case o.FinancialStatus == "refunded":
+		return "refunded"
+	}
+	if n := len(o.Fulfillments); n > 0 && o.Fulfillments[n-1].ShipmentStatus != "" {
+		return o.Fulfillments[n-1].ShipmentStatus
+	}
+	switch o.FulfillmentStatus {
+	case "fulfilled":
+		return "shipped"
+	case "partial":
+		return "partially_shipped"
+	}
+	if o.FinancialStatus == "pending" {
+		return "awaiting_payment"
+	}
+	return "processing"
+}
+
+// orderVariables are the values of an order flow messages and the AI can use
+func orderVariables(o *shopify.Order) map[string]interface{} {
+	items := make([]string, 0, len(o.LineItems))
+	for _, item := range o.LineItems {
+		if item.Quantity > 1 {
+			items = append(items, fmt.Sprintf("%dx %s", item.Quantity, item.Title))
+		} else {
+			items = append(items, item.Title)
+		}
+	}
+	total, _ := parsePrice(o.TotalPrice)
+
+	vars := map[string]interface{}{
+		"order_number":           o.Name,
+		"order_status":           orderStatus(o),
+		"order_placed_at":        o.CreatedAt.Format("Jan 2, 2006"),
+		"order_total":            formatAmount(total, o.Currency),
+		"order_items":            strings.Join(items, ", "),
+		"order_status_url":       o.OrderStatusURL,
+		"order_tracking_company": "",
+		"order_tracking_number":  "",
+		"order_tracking_url":     "",
+	}
+	if n := len(o.Fulfillments); n > 0 {
+		f := o.Fulfillments[n-1]
+		vars["order_tracking_company"] = f.TrackingCompany
+		vars["order_tracking_number"] = f.TrackingNumber
+		vars["order_tracking_url"] = f.TrackingURL
+	}
+	return vars
+}
+
+// runOrderLookupTool looks up the orders of the customer of a session when the AI
+// calls the built-in order lookup tool
+func (a *App) runOrderLookupTool(ctx context.Context, session *models.ChatbotSession, arguments json.RawMessage) (string, error) {
+	if session == nil {
+		return "", errors.New("order lookups need a conversation with a customer")
+	}
+	var args struct {
+		OrderNumber string `json:"order_number"`
+	}
+	if len(arguments) > 0 {
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+
+	var contact models.Contact
+	if err := a.DB.Where("id = ?", session.ContactID).First(&contact).Error; err != nil {
+		return "", errors.New("contact not found")
+	}
+	orders, err := a.lookupShopifyOrders(ctx, session.OrganizationID, &contact, strings.TrimSpace(args.OrderNumber))
+	if err != nil {
+		return "", err
+	}
+
+	results := make([]map[string]interface{}, len(orders))
+	for i := range orders {
+		results[i] = orderVariables(&orders[i])
+	}
+	result, err := json.Marshal(map[string]interface{}{"orders": results})
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// sendFlowOrderStatus looks up the order of a flow step, by the step's order number
+// or the contact's latest order, and sends the step message with its variables. The
+// not found message is sent when there's no such order. It returns the message sent.
+func (a *App) sendFlowOrderStatus(ctx context.Context, account *models.WhatsAppAccount, session *models.ChatbotSession, contact *models.Contact, step *models.ChatbotFlowStep, stepMessage string) string {
+	cfg := step.InputConfig
+	orderNumber := strings.TrimSpace(processTemplate(getStringFromMap(cfg, "order_number"), session.SessionData))
+	orders, err := a.lookupShopifyOrders(ctx, contact.OrganizationID, contact, orderNumber)
+
+	if session.SessionData == nil {
+		session.SessionData = models.JSONB{}
+	}
+	var message string
+	if err != nil {
+		if !errors.Is(err, shopify.ErrOrderNotFound) {
+			a.log(ctx).Error("Failed to look up order", "error", err, "step", step.StepName)
+		}
+		session.SessionData["order_status"] = "not_found"
+		message = processTemplate(getStringFromMap(cfg, "not_found_message"), session.SessionData)
+	} else {
+		for k, v := range orderVariables(&orders[0]) {
+			session.SessionData[k] = v
+		}
+		message = processTemplate(stepMessage, session.SessionData)
+	}
+	a.DB.Model(session).Update("session_data", session.SessionData)
+
+	if message != "" {
+		if err := a.sendAndSaveTextMessage(ctx, account, contact, message); err != nil {
+			a.log(ctx).Error("Failed to send order status message", "error", err, "contact", contact.PhoneNumber)
+		}
+	}
+	return message
+}
+
+// enrollAbandonedCartSequence enrolls the customer of an abandoned checkout in the
+// organization's abandoned cart sequence, if it has one
+func (a *App) enrollAbandonedCartSequence(c *models.Checkout) {
+	s, err := a.loadShopifySettings(c.OrganizationID)
+	if err != nil || s.AbandonedCartSequenceID == "" || c.PhoneNumber == "" {
+		return
+	}
+	sequenceID, err := uuid.Parse(s.AbandonedCartSequenceID)
+	if err != nil {
+		return
+	}
+	contact, _ := a.getOrCreateContact(c.OrganizationID, c.PhoneNumber, c.CustomerName)
+	if contact == nil {
+		return
+	}
+
+	enrolled, err := a.enrollContactInSequence(c.OrganizationID, sequenceID, contact, models.JSONB(checkoutVariables(c)))
+	if err != nil {
+		a.Log.Error("Failed to enroll contact in abandoned cart sequence", "error", err, "checkout_id", c.ID)
+		return
+	}
+	if enrolled {
+		a.DB.Model(c).Update("contact_id", contact.ID)
+	}
+}
+
+// exitAbandonedCartSequence takes the customer of a checkout that was ordered out of
+// the organization's abandoned cart sequence
+func (a *App) exitAbandonedCartSequence(c *models.Checkout) {
+	if c.ContactID == nil {
+		return
+	}
+	s, err := a.loadShopifySettings(c.OrganizationID)
+	if err != nil || s.AbandonedCartSequenceID == "" {
+		return
+	}
+
+	var enrollments []models.SequenceEnrollment
+	if err := a.DB.Where("organization_id = ? AND sequence_id = ? AND contact_id = ? AND status = ?",
+		c.OrganizationID, s.AbandonedCartSequenceID, *c.ContactID, models.SequenceEnrollmentStatusActive).
+		Find(&enrollments).Error; err != nil {
+		a.Log.Error("Failed to load sequence enrollments", "error", err, "contact_id", *c.ContactID)
+		return
+	}
+	for i := range enrollments {
+		a.exitSequenceEnrollment(&enrollments[i], models.SequenceExitReasonOrdered)
+	}
+}
+
+// enrollShippingSequence enrolls the customer of a shipped order in the
+// organization's shipping sequence, if it has one
+func (a *App) enrollShippingSequence(ctx context.Context, orgID uuid.UUID, f *shopify.Fulfillment) {
+	s, err := a.loadShopifySettings(orgID)
+	if err != nil || s.ShippingSequenceID == "" {
+		return
+	}
+	sequenceID, err := uuid.Parse(s.ShippingSequenceID)
+	if err != nil {
+		return
+	}
+
+	// Fulfillments are named after their order, e.g. #1001.1
+	orderNumber := f.Name
+	if i := strings.LastIndex(orderNumber, "."); i > 0 {
+		orderNumber = orderNumber[:i]
+	}
+	var phone, name string
+	if f.Destination != nil {
+		phone, name = f.Destination.Phone, f.Destination.FirstName
+	}
+	if phone == "" {
+		// The order has the customer's phone when the shipping address doesn't
+		if creds, err := a.shopifyCredentials(ctx, orgID); err == nil {
+			if order, err := a.shopifyClient().GetOrder(ctx, creds, f.OrderID); err == nil {
+				if phones := order.Phones(); len(phones) > 0 {
+					phone = phones[0]
+				}
+			}
+		}
+	}
+	phone = searchPhoneDigits(phone)
+	if phone == "" {
+		a.Log.Debug("Shipped order has no phone number", "org_id", orgID, "order_id", f.OrderID)
+		return
+	}
+
+	contact, _ := a.getOrCreateContact(orgID, phone, name)
+	if contact == nil {
+		return
+	}
+	if name == "" {
+		name = "there"
+	}
+	vars := models.JSONB{
+		"name":                   name,
+		"order_number":           orderNumber,
+		"order_tracking_company": f.TrackingCompany,
+		"order_tracking_number":  f.TrackingNumber,
+		"order_tracking_url":     f.TrackingURL,
+	}
+	if _, err := a.enrollContactInSequence(orgID, sequenceID, contact, vars); err != nil {
+		a.Log.Error("Failed to enroll contact in shipping sequence", "error", err, "org_id", orgID, "order_id", f.OrderID)
+	}
+}
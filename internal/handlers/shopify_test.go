@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/shopify"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeShopDomain(t *testing.T) {
+	domain, err := normalizeShopDomain(" https://Acme-Bakery.myshopify.com/ ")
+	require.NoError(t, err)
+	assert.Equal(t, "acme-bakery.myshopify.com", domain)
+
+	domain, err = normalizeShopDomain("")
+	require.NoError(t, err)
+	assert.Empty(t, domain)
+
+	_, err = normalizeShopDomain("shop.acme.com")
+	assert.Error(t, err)
+}
+
+func TestSamePhoneNumber(t *testing.T) {
+	assert.True(t, samePhoneNumber("+1 (555) 123-4567", "15551234567"))
+	assert.True(t, samePhoneNumber("5551234567", "15551234567"))
+	assert.False(t, samePhoneNumber("15551234568", "15551234567"))
+	assert.False(t, samePhoneNumber("", "15551234567"))
+}
+
+func TestOrderStatus(t *testing.T) {
+	cancelled := time.Now()
+	tests := []struct {
+		name  string
+		order shopify.Order
+		want  string
+	}{
+		{name: "cancelled", order: shopify.Order{CancelledAt: &cancelled, FulfillmentStatus: "fulfilled"}, want: "cancelled"},
+		{name: "refunded", order: shopify.Order{FinancialStatus: "refunded"}, want: "refunded"},
+		{name: "carrier status", order: shopify.Order{FulfillmentStatus: "fulfilled", Fulfillments: []shopify.Fulfillment{{ShipmentStatus: "out_for_delivery"}}}, want: "out_for_delivery"},
+		{name: "shipped", order: shopify.Order{FulfillmentStatus: "fulfilled", Fulfillments: []shopify.Fulfillment{{}}}, want: "shipped"},
+		{name: "partially shipped", order: shopify.Order{FulfillmentStatus: "partial"}, want: "partially_shipped"},
+		{name: "awaiting payment", order: shopify.Order{FinancialStatus: "pending"}, want: "awaiting_payment"},
+		{name: "processing", order: shopify.Order{FinancialStatus: "paid"}, want: "processing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, orderStatus(&tt.order))
+		})
+	}
+}
+
+func TestAvailableAITools_OrderLookup(t *testing.T) {
+	settings := &models.ChatbotSettings{}
+	settings.AI.OrderLookup = true
+	tools := availableAITools(settings)
+	require.Len(t, tools, 1)
+	assert.Equal(t, orderLookupToolName, tools[0].Name)
+
+	_, err := validateAITools([]AITool{{Name: orderLookupToolName, Description: "Orders", URL: "https://example.com"}})
+	assert.EqualError(t, err, `tool name "get_order_status" is reserved`)
+}
+
+func TestShopify_OrderLookupAndShippingSequence(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "shpat_test", r.Header.Get("X-Shopify-Access-Token"))
+		_, _ = w.Write([]byte(`{"orders":[{"id":7,"name":"#1001","phone":"+15550001111","fulfillment_status":"fulfilled","total_price":"49.99","currency":"USD",
+			"line_items":[{"title":"Sourdough","quantity":2}],
+			"fulfillments":[{"tracking_company":"UPS","tracking_number":"1Z999","tracking_url":"https://ups.example.com/1Z999","shipment_status":"in_transit"}]}]}`))
+	}))
+	defer server.Close()
+
+	app := &App{
+		Config:  &config.Config{},
+		DB:      testutil.SetupTestDB(t),
+		Log:     testutil.NopLogger(),
+		Shopify: shopify.NewWithBaseURL(testutil.NopLogger(), server.URL),
+	}
+	seq, contact, enrollment := sequenceTestContact(t, app, nil)
+	require.NoError(t, app.DB.Model(enrollment).Update("status", models.SequenceEnrollmentStatusCompleted).Error)
+	require.NoError(t, app.DB.Model(&models.Organization{}).Where("id = ?", seq.OrganizationID).Update("settings", models.JSONB{
+		"shopify": map[string]interface{}{
+			"shop_domain":          "acme.myshopify.com",
+			"access_token":         "shpat_test",
+			"shipping_sequence_id": seq.ID.String(),
+		},
+	}).Error)
+	session := &models.ChatbotSession{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: seq.OrganizationID,
+		ContactID:      contact.ID,
+		PhoneNumber:    contact.PhoneNumber,
+	}
+
+	// The order was placed with another phone number
+	_, err := app.runOrderLookupTool(testutil.TestContext(t), session, json.RawMessage(`{"order_number":"1001"}`))
+	assert.ErrorIs(t, err, shopify.ErrOrderNotFound)
+
+	require.NoError(t, app.DB.Model(contact).Update("phone_number", "15550001111").Error)
+	result, err := app.runOrderLookupTool(testutil.TestContext(t), session, json.RawMessage(`{"order_number":"1001"}`))
+	require.NoError(t, err)
+	var orders struct {
+		Orders []map[string]string `json:"orders"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(result), &orders))
+	require.Len(t, orders.Orders, 1)
+	assert.Equal(t, "in_transit", orders.Orders[0]["order_status"])
+	assert.Equal(t, "2x Sourdough", orders.Orders[0]["order_items"])
+	assert.Equal(t, "1Z999", orders.Orders[0]["order_tracking_number"])
+
+	app.enrollShippingSequence(testutil.TestContext(t), seq.OrganizationID, &shopify.Fulfillment{
+		OrderID:        7,
+		Name:           "#1001.1",
+		TrackingNumber: "1Z999",
+		Destination:    &shopify.Address{FirstName: "Ana", Phone: "+1 555 000 1111"},
+	})
+
+	var enrolled models.SequenceEnrollment
+	require.NoError(t, app.DB.Where("contact_id = ? AND status = ?", contact.ID, models.SequenceEnrollmentStatusActive).First(&enrolled).Error)
+	assert.Equal(t, seq.ID, enrolled.SequenceID)
+	assert.Equal(t, "#1001", enrolled.Variables["order_number"])
+	assert.Equal(t, "1Z999", enrolled.Variables["order_tracking_number"])
+
+	// Contacts already in the sequence aren't enrolled again
+	ok, err := app.enrollContactInSequence(seq.OrganizationID, seq.ID, contact, nil)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestShopifySettings_Encrypted(t *testing.T) {
+	testutil.EnableEncryption(t)
+
+	section := map[string]interface{}{"access_token": "shpat_123"}
+	require.NoError(t, models.EncryptSettingSecrets("shopify", section))
+	assert.NotEqual(t, "shpat_123", section["access_token"])
+	s := shopifySettings(models.JSONB{"shopify": section})
+	assert.Equal(t, "shpat_123", s.AccessToken)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandShortcodes(t *testing.T) {
+	codes := map[string]string{
+		"hours":   "Mon-Fri 9am-6pm",
+		"address": "221B Baker Street",
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"single code", "/hours", "Mon-Fri 9am-6pm"},
+		{"inline code", "We are open /hours, visit us at /address.", "We are open Mon-Fri 9am-6pm, visit us at 221B Baker Street."},
+		{"unknown code untouched", "Try /unknown please", "Try /unknown please"},
+		{"url untouched", "See https://example.com/hours", "See https://example.com/hours"},
+		{"date untouched", "Due 12/05/2025", "Due 12/05/2025"},
+		{"newline separated", "Hi\n/hours", "Hi\nMon-Fri 9am-6pm"},
+		{"no codes", "Hello there", "Hello there"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, expandShortcodes(tt.text, codes))
+		})
+	}
+}
+
+func TestExpandShortcodes_EmptyMap(t *testing.T) {
+	assert.Equal(t, "/hours", expandShortcodes("/hours", nil))
+}
+
+func TestNormalizeShortcode(t *testing.T) {
+	assert.Equal(t, "hours", normalizeShortcode(" /hours "))
+	assert.Equal(t, "hours", normalizeShortcode("hours"))
+}
+
+func TestSendStepMessage_ExpandsShortcodes(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+
+	var mu sync.Mutex
+	var sentBodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text struct {
+				Body string `json:"body"`
+			} `json:"text"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		sentBodies = append(sentBodies, body.Text.Body)
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages": []map[string]string{{"id": "wamid.test-" + uuid.New().String()[:8]}},
+		})
+	}))
+	defer server.Close()
+
+	app := &App{
+		Config:   &config.Config{},
+		DB:       db,
+		Log:      testutil.NopLogger(),
+		WhatsApp: whatsapp.NewWithBaseURL(testutil.NopLogger(), server.URL),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Shortcode Org " + uuid.New().String()[:8],
+		Slug:      "shortcode-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, db.Create(org).Error)
+
+	account := &models.WhatsAppAccount{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		Name:           "shortcode-account-" + uuid.New().String()[:8],
+		PhoneID:        "phone-" + uuid.New().String()[:8],
+		BusinessID:     "business-123",
+		AccessToken:    "test-token",
+		APIVersion:     "v18.0",
+		Status:         "active",
+	}
+	require.NoError(t, db.Create(account).Error)
+
+	contact := &models.Contact{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		WhatsAppAccount: account.Name,
+		PhoneNumber:     "+1555" + uuid.New().String()[:6],
+		ProfileName:     "Shortcode Contact",
+	}
+	require.NoError(t, db.Create(contact).Error)
+
+	require.NoError(t, db.Create(&models.Shortcode{
+		OrganizationID: org.ID,
+		Code:           "hours",
+		Content:        "Mon-Fri 9am-6pm",
+		IsActive:       true,
+	}).Error)
+
+	session := &models.ChatbotSession{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		ContactID:       contact.ID,
+		WhatsAppAccount: account.Name,
+		PhoneNumber:     contact.PhoneNumber,
+		Status:          models.SessionStatusActive,
+		SessionData:     models.JSONB{"name": "Alice"},
+	}
+	require.NoError(t, db.Create(session).Error)
+
+	step := &models.ChatbotFlowStep{
+		StepName:    "hours_step",
+		MessageType: models.FlowStepTypeText,
+		Message:     "Hi {{name}}, we are open /hours",
+	}
+
+	app.sendStepMessage(context.Background(), account, session, contact, step)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, sentBodies, 1)
+	assert.Equal(t, "Hi Alice, we are open Mon-Fri 9am-6pm", sentBodies[0])
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// shortcodePattern matches /code tokens at the start of the text or after whitespace
+var shortcodePattern = regexp.MustCompile(`(^|\s)/([A-Za-z0-9_-]+)`)
+
+// shortcodeNamePattern validates shortcode names
+var shortcodeNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,50}$`)
+
+// ShortcodeRequest represents the request body for creating/updating a shortcode
+type ShortcodeRequest struct {
+	Code        string  `json:"code"`
+	Content     string  `json:"content"`
+	Description *string `json:"description"`
+	IsActive    *bool   `json:"is_active"`
+}
+
+// ShortcodeResponse represents the API response for a shortcode
+type ShortcodeResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Code        string    `json:"code"`
+	Content     string    `json:"content"`
+	Description string    `json:"description"`
+	IsActive    bool      `json:"is_active"`
+	CreatedAt   string    `json:"created_at"`
+	UpdatedAt   string    `json:"updated_at"`
+}
+
+// ListShortcodes returns all shortcodes for the organization
+func (a *App) ListShortcodes(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	search := string(r.RequestCtx.QueryArgs().Peek("search"))
+	activeOnly := string(r.RequestCtx.QueryArgs().Peek("active_only"))
+
+	query := a.DB.Where("organization_id = ?", orgID)
+	if activeOnly == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+	if search != "" {
+		searchPattern := "%" + search + "%"
+		query = query.Where("code ILIKE ? OR content ILIKE ? OR description ILIKE ?",
+			searchPattern, searchPattern, searchPattern)
+	}
+
+	var shortcodes []models.Shortcode
+	if err := query.Order("code ASC").Find(&shortcodes).Error; err != nil {
+		a.Log.Error("Failed to list shortcodes", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to list shortcodes", nil, "")
+	}
+
+	result := make([]ShortcodeResponse, len(shortcodes))
+	for i, sc := range shortcodes {
+		result[i] = shortcodeToResponse(sc)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"shortcodes": result,
+	})
+}
+
+// CreateShortcode creates a new shortcode
+func (a *App) CreateShortcode(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	var req ShortcodeRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	req.Code = normalizeShortcode(req.Code)
+	if req.Code == "" || req.Content == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+			"code and content are required", nil, "")
+	}
+	if !shortcodeNamePattern.MatchString(req.Code) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+			"code may only contain letters, numbers, '-' and '_'", nil, "")
+	}
+
+	if msg := a.checkShortcodeConflict(orgID, req.Code, uuid.Nil); msg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusConflict, msg, nil, "")
+	}
+
+	shortcode := models.Shortcode{
+		OrganizationID: orgID,
+		Code:           req.Code,
+		Content:        req.Content,
+		IsActive:       true,
+		CreatedByID:    userID,
+	}
+	if req.Description != nil {
+		shortcode.Description = *req.Description
+	}
+	if req.IsActive != nil {
+		shortcode.IsActive = *req.IsActive
+	}
+
+	if err := a.DB.Create(&shortcode).Error; err != nil {
+		if isUniqueViolation(err) {
+			return r.SendErrorEnvelope(fasthttp.StatusConflict,
+				"Shortcode with this code already exists", nil, "")
+		}
+		a.Log.Error("Failed to create shortcode", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to create shortcode", nil, "")
+	}
+
+	a.InvalidateShortcodesCache(orgID)
+
+	return r.SendEnvelope(shortcodeToResponse(shortcode))
+}
+
+// GetShortcode returns a single shortcode
+func (a *App) GetShortcode(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	idStr, _ := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
+	}
+
+	var shortcode models.Shortcode
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).
+		First(&shortcode).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Shortcode not found", nil, "")
+	}
+
+	return r.SendEnvelope(shortcodeToResponse(shortcode))
+}
+
+// UpdateShortcode updates an existing shortcode
+func (a *App) UpdateShortcode(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	idStr, _ := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
+	}
+
+	var shortcode models.Shortcode
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).
+		First(&shortcode).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Shortcode not found", nil, "")
+	}
+
+	var req ShortcodeRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	if code := normalizeShortcode(req.Code); code != "" && code != shortcode.Code {
+		if !shortcodeNamePattern.MatchString(code) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest,
+				"code may only contain letters, numbers, '-' and '_'", nil, "")
+		}
+		if msg := a.checkShortcodeConflict(orgID, code, id); msg != "" {
+			return r.SendErrorEnvelope(fasthttp.StatusConflict, msg, nil, "")
+		}
+		shortcode.Code = code
+	}
+	if req.Content != "" {
+		shortcode.Content = req.Content
+	}
+	if req.Description != nil {
+		shortcode.Description = *req.Description
+	}
+	if req.IsActive != nil {
+		shortcode.IsActive = *req.IsActive
+	}
+
+	if err := a.DB.Save(&shortcode).Error; err != nil {
+		if isUniqueViolation(err) {
+			return r.SendErrorEnvelope(fasthttp.StatusConflict,
+				"Shortcode with this code already exists", nil, "")
+		}
+		a.Log.Error("Failed to update shortcode", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to update shortcode", nil, "")
+	}
+
+	a.InvalidateShortcodesCache(orgID)
+
+	return r.SendEnvelope(shortcodeToResponse(shortcode))
+}
+
+// DeleteShortcode deletes a shortcode
+func (a *App) DeleteShortcode(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	idStr, _ := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
+	}
+
+	var shortcode models.Shortcode
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).
+		First(&shortcode).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Shortcode not found", nil, "")
+	}
+
+	if err := a.DB.Delete(&shortcode).Error; err != nil {
+		a.Log.Error("Failed to delete shortcode", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError,
+			"Failed to delete shortcode", nil, "")
+	}
+
+	a.InvalidateShortcodesCache(orgID)
+
+	return r.SendEnvelope(map[string]string{"message": "Shortcode deleted"})
+}
+
+// checkShortcodeConflict returns a conflict message if code is already used by another
+// shortcode or by an active canned response shortcut in the organization.
+// Both share the /xyz syntax in the composer, so they must not overlap.
+func (a *App) checkShortcodeConflict(orgID uuid.UUID, code string, excludeID uuid.UUID) string {
+	var count int64
+	a.DB.Model(&models.Shortcode{}).
+		Where("organization_id = ? AND code = ? AND id != ?", orgID, code, excludeID).
+		Count(&count)
+	if count > 0 {
+		return "Shortcode with this code already exists"
+	}
+
+	a.DB.Model(&models.CannedResponse{}).
+		Where("organization_id = ? AND shortcut = ? AND is_active = ?", orgID, code, true).
+		Count(&count)
+	if count > 0 {
+		return "Code is already used as a canned response shortcut"
+	}
+	return ""
+}
+
+// isShortcodeInUse reports whether code is taken by a shortcode in the organization
+func (a *App) isShortcodeInUse(orgID uuid.UUID, code string) bool {
+	var count int64
+	a.DB.Model(&models.Shortcode{}).
+		Where("organization_id = ? AND code = ?", orgID, normalizeShortcode(code)).
+		Count(&count)
+	return count > 0
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// expandOrgShortcodes expands the organization's active shortcodes in text
+func (a *App) expandOrgShortcodes(orgID uuid.UUID, text string) string {
+	if !strings.Contains(text, "/") {
+		return text
+	}
+	codes, err := a.getShortcodesCached(orgID)
+	if err != nil {
+		a.Log.Error("Failed to load shortcodes", "error", err, "org_id", orgID)
+		return text
+	}
+	return expandShortcodes(text, codes)
+}
+
+// expandShortcodes replaces known /code tokens with their content.
+// Unknown codes are left untouched so regular slashes (URLs, dates) survive.
+func expandShortcodes(text string, codes map[string]string) string {
+	if len(codes) == 0 {
+		return text
+	}
+	return shortcodePattern.ReplaceAllStringFunc(text, func(match string) string {
+		sub := shortcodePattern.FindStringSubmatch(match)
+		content, ok := codes[sub[2]]
+		if !ok {
+			return match
+		}
+		return sub[1] + content
+	})
+}
+
+// normalizeShortcode trims whitespace and the optional leading slash
+func normalizeShortcode(code string) string {
+	return strings.TrimPrefix(strings.TrimSpace(code), "/")
+}
+
+func shortcodeToResponse(sc models.Shortcode) ShortcodeResponse {
+	return ShortcodeResponse{
+		ID:          sc.ID,
+		Code:        sc.Code,
+		Content:     sc.Content,
+		Description: sc.Description,
+		IsActive:    sc.IsActive,
+		CreatedAt:   sc.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:   sc.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
@@ -0,0 +1,263 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/handlers"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+// shortcodeTestApp creates an App instance for shortcode testing.
+func shortcodeTestApp(t *testing.T) *handlers.App {
+	t.Helper()
+
+	return &handlers.App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Redis:  testutil.SetupTestRedis(t),
+		Log:    testutil.NopLogger(),
+	}
+}
+
+// createTestShortcode creates a test shortcode in the database.
+func createTestShortcode(t *testing.T, app *handlers.App, orgID uuid.UUID, code, content string) *models.Shortcode {
+	t.Helper()
+
+	shortcode := &models.Shortcode{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: orgID,
+		Code:           code,
+		Content:        content,
+		IsActive:       true,
+	}
+	require.NoError(t, app.DB.Create(shortcode).Error)
+	return shortcode
+}
+
+func parseShortcodeResponse(t *testing.T, body []byte) handlers.ShortcodeResponse {
+	t.Helper()
+
+	var resp struct {
+		Data handlers.ShortcodeResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(body, &resp))
+	return resp.Data
+}
+
+// --- CreateShortcode Tests ---
+
+func TestApp_CreateShortcode_Success(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("create-shortcode"), "password", nil, true)
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"code":        "/hours",
+		"content":     "Mon-Fri 9am-6pm",
+		"description": "Opening hours",
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateShortcode(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	sc := parseShortcodeResponse(t, testutil.GetResponseBody(req))
+	assert.Equal(t, "hours", sc.Code, "leading slash should be stripped")
+	assert.Equal(t, "Mon-Fri 9am-6pm", sc.Content)
+	assert.Equal(t, "Opening hours", sc.Description)
+	assert.True(t, sc.IsActive)
+}
+
+func TestApp_CreateShortcode_Inactive(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("create-inactive"), "password", nil, true)
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"code":      "draft",
+		"content":   "Not yet",
+		"is_active": false,
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateShortcode(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	sc := parseShortcodeResponse(t, testutil.GetResponseBody(req))
+	assert.False(t, sc.IsActive)
+
+	// Must be persisted as inactive, not overridden by a column default
+	var stored models.Shortcode
+	require.NoError(t, app.DB.Where("id = ?", sc.ID).First(&stored).Error)
+	assert.False(t, stored.IsActive)
+}
+
+func TestApp_CreateShortcode_DuplicateCode(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("dup-shortcode"), "password", nil, true)
+	createTestShortcode(t, app, org.ID, "hours", "Mon-Fri")
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"code":    "hours",
+		"content": "Other",
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateShortcode(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusConflict, "already exists")
+}
+
+func TestApp_CreateShortcode_ConflictsWithCannedShortcut(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("canned-conflict"), "password", nil, true)
+
+	require.NoError(t, app.DB.Create(&models.CannedResponse{
+		OrganizationID: org.ID,
+		Name:           "Welcome",
+		Shortcut:       "welcome",
+		Content:        "Hello!",
+		IsActive:       true,
+	}).Error)
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"code":    "welcome",
+		"content": "Hi",
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateShortcode(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusConflict, "canned response shortcut")
+}
+
+func TestApp_CreateShortcode_InvalidCode(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("invalid-shortcode"), "password", nil, true)
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"code":    "has space",
+		"content": "x",
+	})
+	setAuthContext(req, org.ID, user.ID)
+
+	require.NoError(t, app.CreateShortcode(req))
+	assert.Equal(t, fasthttp.StatusBadRequest, testutil.GetResponseStatusCode(req))
+}
+
+// --- UpdateShortcode Tests ---
+
+func TestApp_UpdateShortcode_PartialKeepsDescription(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("update-shortcode"), "password", nil, true)
+	sc := createTestShortcode(t, app, org.ID, "hours", "Mon-Fri")
+	require.NoError(t, app.DB.Model(sc).Update("description", "Opening hours").Error)
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"content": "Mon-Sat",
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", sc.ID.String())
+
+	require.NoError(t, app.UpdateShortcode(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	updated := parseShortcodeResponse(t, testutil.GetResponseBody(req))
+	assert.Equal(t, "Mon-Sat", updated.Content)
+	assert.Equal(t, "Opening hours", updated.Description)
+	assert.True(t, updated.IsActive)
+}
+
+func TestApp_UpdateShortcode_RenameToExisting(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("rename-shortcode"), "password", nil, true)
+	createTestShortcode(t, app, org.ID, "hours", "Mon-Fri")
+	sc := createTestShortcode(t, app, org.ID, "address", "Baker Street")
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"code": "hours",
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", sc.ID.String())
+
+	require.NoError(t, app.UpdateShortcode(req))
+	testutil.AssertErrorResponse(t, req, fasthttp.StatusConflict, "already exists")
+}
+
+func TestApp_UpdateShortcode_InvalidatesCache(t *testing.T) {
+	app := shortcodeTestApp(t)
+	if app.Redis == nil {
+		t.Skip("TEST_REDIS_URL not set, skipping cache test")
+	}
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("cache-shortcode"), "password", nil, true)
+	sc := createTestShortcode(t, app, org.ID, "hours", "Mon-Fri")
+
+	cacheKey := "shortcodes:" + org.ID.String()
+	require.NoError(t, app.Redis.Set(context.Background(), cacheKey, `{"hours":"stale"}`, 0).Err())
+
+	req := testutil.NewJSONRequest(t, map[string]interface{}{
+		"content": "Mon-Sat",
+	})
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", sc.ID.String())
+
+	require.NoError(t, app.UpdateShortcode(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	exists, err := app.Redis.Exists(context.Background(), cacheKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), exists)
+}
+
+// --- DeleteShortcode Tests ---
+
+func TestApp_DeleteShortcode_AllowsRecreate(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("delete-shortcode"), "password", nil, true)
+	sc := createTestShortcode(t, app, org.ID, "hours", "Mon-Fri")
+
+	req := testutil.NewRequest(t)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", sc.ID.String())
+
+	require.NoError(t, app.DeleteShortcode(req))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(req))
+
+	// Deleted codes can be reused
+	createReq := testutil.NewJSONRequest(t, map[string]interface{}{
+		"code":    "hours",
+		"content": "Mon-Sat",
+	})
+	setAuthContext(createReq, org.ID, user.ID)
+
+	require.NoError(t, app.CreateShortcode(createReq))
+	assert.Equal(t, fasthttp.StatusOK, testutil.GetResponseStatusCode(createReq))
+}
+
+func TestApp_DeleteShortcode_CrossOrg(t *testing.T) {
+	app := shortcodeTestApp(t)
+	org := createTestOrganization(t, app)
+	otherOrg := createTestOrganization(t, app)
+	user := createTestUser(t, app, org.ID, uniqueEmail("xorg-shortcode"), "password", nil, true)
+	sc := createTestShortcode(t, app, otherOrg.ID, "hours", "Mon-Fri")
+
+	req := testutil.NewRequest(t)
+	setAuthContext(req, org.ID, user.ID)
+	testutil.SetPathParam(req, "id", sc.ID.String())
+
+	require.NoError(t, app.DeleteShortcode(req))
+	assert.Equal(t, fasthttp.StatusNotFound, testutil.GetResponseStatusCode(req))
+}
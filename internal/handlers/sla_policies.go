@@ -0,0 +1,549 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// defaultSLAAtRiskPercent is the share of a target's time after which it's at risk
+const defaultSLAAtRiskPercent = 80
+
+// SLAPolicyRequest represents the request body for creating/updating an SLA policy
+type SLAPolicyRequest struct {
+	Name                 string                   `json:"name"`
+	Priority             *models.TransferPriority `json:"priority"`
+	Tags                 *[]string                `json:"tags"`
+	FirstResponseMinutes *int                     `json:"first_response_minutes"`
+	ResolutionMinutes    *int                     `json:"resolution_minutes"`
+	AtRiskPercent        *int                     `json:"at_risk_percent"`
+	Position             *int                     `json:"position"`
+	IsActive             *bool                    `json:"is_active"`
+}
+
+// SLAPolicyResponse represents the API response for an SLA policy
+type SLAPolicyResponse struct {
+	ID                   uuid.UUID               `json:"id"`
+	Name                 string                  `json:"name"`
+	Priority             models.TransferPriority `json:"priority"`
+	Tags                 []string                `json:"tags"`
+	FirstResponseMinutes int                     `json:"first_response_minutes"`
+	ResolutionMinutes    int                     `json:"resolution_minutes"`
+	AtRiskPercent        int                     `json:"at_risk_percent"`
+	Position             int                     `json:"position"`
+	IsActive             bool                    `json:"is_active"`
+	CreatedAt            string                  `json:"created_at"`
+	UpdatedAt            string                  `json:"updated_at"`
+}
+
+// TransferPriorityRequest represents the request body for changing a transfer's priority
+type TransferPriorityRequest struct {
+	Priority models.TransferPriority `json:"priority"`
+}
+
+// ListSLAPolicies returns the organization's SLA policies in matching order
+func (a *App) ListSLAPolicies(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	var policies []models.SLAPolicy
+	if err := a.DB.Where("organization_id = ?", orgID).
+		Order("position ASC, created_at ASC").Find(&policies).Error; err != nil {
+		a.Log.Error("Failed to list SLA policies", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list SLA policies", nil, "")
+	}
+
+	result := make([]SLAPolicyResponse, len(policies))
+	for i, p := range policies {
+		result[i] = slaPolicyToResponse(p)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"policies": result,
+	})
+}
+
+// CreateSLAPolicy creates a new SLA policy
+func (a *App) CreateSLAPolicy(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	var req SLAPolicyRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	policy := models.SLAPolicy{
+		OrganizationID: orgID,
+		Tags:           models.StringArray{},
+		AtRiskPercent:  defaultSLAAtRiskPercent,
+		IsActive:       true,
+	}
+	if req.FirstResponseMinutes == nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "first_response_minutes is required", nil, "")
+	}
+	if msg := applySLAPolicyRequest(&policy, &req); msg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, msg, nil, "")
+	}
+	if policy.Name == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "name is required", nil, "")
+	}
+
+	if err := a.DB.Create(&policy).Error; err != nil {
+		a.Log.Error("Failed to create SLA policy", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create SLA policy", nil, "")
+	}
+
+	return r.SendEnvelope(slaPolicyToResponse(policy))
+}
+
+// UpdateSLAPolicy updates an SLA policy. Transfers already tracked keep their deadlines.
+func (a *App) UpdateSLAPolicy(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	idStr, _ := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
+	}
+
+	var policy models.SLAPolicy
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&policy).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "SLA policy not found", nil, "")
+	}
+
+	var req SLAPolicyRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if msg := applySLAPolicyRequest(&policy, &req); msg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, msg, nil, "")
+	}
+
+	if err := a.DB.Save(&policy).Error; err != nil {
+		a.Log.Error("Failed to update SLA policy", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update SLA policy", nil, "")
+	}
+
+	return r.SendEnvelope(slaPolicyToResponse(policy))
+}
+
+// DeleteSLAPolicy deletes an SLA policy
+func (a *App) DeleteSLAPolicy(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	idStr, _ := r.RequestCtx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid ID", nil, "")
+	}
+
+	result := a.DB.Where("id = ? AND organization_id = ?", id, orgID).Delete(&models.SLAPolicy{})
+	if result.Error != nil {
+		a.Log.Error("Failed to delete SLA policy", "error", result.Error)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete SLA policy", nil, "")
+	}
+	if result.RowsAffected == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "SLA policy not found", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]string{"message": "SLA policy deleted"})
+}
+
+// SetTransferPriority changes a transfer's priority and re-applies the SLA policy
+// matching it, with deadlines counted from when the transfer was created
+func (a *App) SetTransferPriority(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	transferID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid transfer ID", nil, "")
+	}
+
+	var req TransferPriorityRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if !isTransferPriority(req.Priority) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid priority. Must be 'low', 'normal', 'high' or 'urgent'", nil, "")
+	}
+
+	var transfer models.AgentTransfer
+	if err := a.DB.Where("id = ? AND organization_id = ?", transferID, orgID).First(&transfer).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Transfer not found", nil, "")
+	}
+	if transfer.Status != models.TransferStatusActive {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Transfer is not active", nil, "")
+	}
+
+	// Users with write permission can change any transfer, agents only their own
+	isAssignedAgent := transfer.AgentID != nil && *transfer.AgentID == userID
+	if !isAssignedAgent && !a.HasPermission(userID, models.ResourceTransfers, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "You don't have permission to change this transfer", nil, "")
+	}
+
+	transfer.Priority = req.Priority
+	updates := map[string]interface{}{"priority": transfer.Priority}
+	if policy := a.matchSLAPolicy(&transfer); policy != nil {
+		setSLAPolicyDeadlines(&transfer, policy, transfer.TransferredAt)
+		updates["sla_policy_id"] = transfer.SLA.PolicyID
+		updates["sla_status"] = transfer.SLA.Status
+		updates["sla_response_deadline"] = transfer.SLA.ResponseDeadline
+		updates["sla_resolution_deadline"] = transfer.SLA.ResolutionDeadline
+	} else if transfer.SLA.PolicyID != nil {
+		// No policy matches anymore, so the transfer keeps its deadlines untracked
+		transfer.SLA.PolicyID = nil
+		transfer.SLA.Status = ""
+		updates["sla_policy_id"] = nil
+		updates["sla_status"] = ""
+	}
+
+	if err := a.DB.Model(&transfer).Updates(updates).Error; err != nil {
+		a.Log.Error("Failed to update transfer priority", "error", err, "transfer_id", transfer.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update priority", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message":                 "Transfer priority updated",
+		"priority":                transfer.Priority,
+		"sla_policy_id":           transfer.SLA.PolicyID,
+		"sla_status":              transfer.SLA.Status,
+		"sla_response_deadline":   transfer.SLA.ResponseDeadline,
+		"sla_resolution_deadline": transfer.SLA.ResolutionDeadline,
+	})
+}
+
+// applySLAPolicyRequest copies the set fields of req to the policy, returning an
+// error message if one is invalid
+func applySLAPolicyRequest(policy *models.SLAPolicy, req *SLAPolicyRequest) string {
+	if name := strings.TrimSpace(req.Name); name != "" {
+		policy.Name = name
+	}
+	if req.Priority != nil {
+		if *req.Priority != "" && !isTransferPriority(*req.Priority) {
+			return "Invalid priority. Must be 'low', 'normal', 'high' or 'urgent'"
+		}
+		policy.Priority = *req.Priority
+	}
+	if req.Tags != nil {
+		policy.Tags = normalizeSkills(*req.Tags)
+	}
+	if req.FirstResponseMinutes != nil {
+		if *req.FirstResponseMinutes <= 0 {
+			return "first_response_minutes must be greater than 0"
+		}
+		policy.FirstResponseMinutes = *req.FirstResponseMinutes
+	}
+	if req.ResolutionMinutes != nil {
+		if *req.ResolutionMinutes < 0 {
+			return "resolution_minutes can't be negative"
+		}
+		policy.ResolutionMinutes = *req.ResolutionMinutes
+	}
+	if req.AtRiskPercent != nil {
+		if *req.AtRiskPercent < 1 || *req.AtRiskPercent > 99 {
+			return "at_risk_percent must be between 1 and 99"
+		}
+		policy.AtRiskPercent = *req.AtRiskPercent
+	}
+	if req.Position != nil {
+		policy.Position = *req.Position
+	}
+	if req.IsActive != nil {
+		policy.IsActive = *req.IsActive
+	}
+	return ""
+}
+
+// isTransferPriority reports whether p is a supported transfer priority
+func isTransferPriority(p models.TransferPriority) bool {
+	switch p {
+	case models.TransferPriorityLow, models.TransferPriorityNormal,
+		models.TransferPriorityHigh, models.TransferPriorityUrgent:
+		return true
+	}
+	return false
+}
+
+func slaPolicyToResponse(p models.SLAPolicy) SLAPolicyResponse {
+	return SLAPolicyResponse{
+		ID:                   p.ID,
+		Name:                 p.Name,
+		Priority:             p.Priority,
+		Tags:                 skillsOrEmpty(p.Tags),
+		FirstResponseMinutes: p.FirstResponseMinutes,
+		ResolutionMinutes:    p.ResolutionMinutes,
+		AtRiskPercent:        p.AtRiskPercent,
+		Position:             p.Position,
+		IsActive:             p.IsActive,
+		CreatedAt:            p.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:            p.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// matchSLAPolicy returns the first active SLA policy matching the transfer's
+// priority and its contact's tags, or nil if none does
+func (a *App) matchSLAPolicy(transfer *models.AgentTransfer) *models.SLAPolicy {
+	var policies []models.SLAPolicy
+	if err := a.DB.Where("organization_id = ? AND is_active = ?", transfer.OrganizationID, true).
+		Order("position ASC, created_at ASC").Find(&policies).Error; err != nil {
+		a.Log.Error("Failed to load SLA policies", "error", err, "org_id", transfer.OrganizationID)
+		return nil
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	var contact models.Contact
+	a.DB.Select("id", "tags").Where("id = ?", transfer.ContactID).First(&contact)
+	tags := contactTagSet(&contact)
+
+	priority := transfer.Priority
+	if priority == "" {
+		priority = models.TransferPriorityNormal
+	}
+
+	for i := range policies {
+		if slaPolicyMatches(&policies[i], priority, tags) {
+			return &policies[i]
+		}
+	}
+	return nil
+}
+
+// slaPolicyMatches reports whether a policy applies to a transfer with the given
+// priority whose contact has the given (lowercased) tags
+func slaPolicyMatches(policy *models.SLAPolicy, priority models.TransferPriority, tags map[string]bool) bool {
+	if policy.Priority != "" && policy.Priority != priority {
+		return false
+	}
+	if len(policy.Tags) == 0 {
+		return true
+	}
+	for _, tag := range policy.Tags {
+		if tags[strings.ToLower(tag)] {
+			return true
+		}
+	}
+	return false
+}
+
+// setSLAPolicyDeadlines sets the policy's response and resolution deadlines on the
+// transfer, counted from start
+func setSLAPolicyDeadlines(transfer *models.AgentTransfer, policy *models.SLAPolicy, start time.Time) {
+	responseDeadline := start.Add(time.Duration(policy.FirstResponseMinutes) * time.Minute)
+	transfer.SLA.ResponseDeadline = &responseDeadline
+	transfer.SLA.ResolutionDeadline = nil
+	if policy.ResolutionMinutes > 0 {
+		resolutionDeadline := start.Add(time.Duration(policy.ResolutionMinutes) * time.Minute)
+		transfer.SLA.ResolutionDeadline = &resolutionDeadline
+	}
+	policyID := policy.ID
+	transfer.SLA.PolicyID = &policyID
+	transfer.SLA.Status = models.SLAStatusOnTrack
+}
+
+// slaStatusAt evaluates a policy-tracked transfer against its policy at the given time.
+// The first-response target counts until an agent replies, the resolution target
+// until the transfer is closed.
+func slaStatusAt(transfer *models.AgentTransfer, policy *models.SLAPolicy, now time.Time) models.SLAStatus {
+	atRiskPercent := policy.AtRiskPercent
+	if atRiskPercent <= 0 || atRiskPercent >= 100 {
+		atRiskPercent = defaultSLAAtRiskPercent
+	}
+
+	status := models.SLAStatusOnTrack
+	check := func(deadline *time.Time, minutes int, doneAt *time.Time) {
+		if deadline == nil || minutes <= 0 {
+			return
+		}
+		if doneAt != nil {
+			if doneAt.After(*deadline) {
+				status = models.SLAStatusBreached
+			}
+			return
+		}
+		if now.After(*deadline) {
+			status = models.SLAStatusBreached
+			return
+		}
+		riskWindow := time.Duration(minutes) * time.Minute * time.Duration(100-atRiskPercent) / 100
+		if status == models.SLAStatusOnTrack && now.After(deadline.Add(-riskWindow)) {
+			status = models.SLAStatusAtRisk
+		}
+	}
+	check(transfer.SLA.ResponseDeadline, policy.FirstResponseMinutes, transfer.SLA.FirstResponseAt)
+	check(transfer.SLA.ResolutionDeadline, policy.ResolutionMinutes, nil)
+	return status
+}
+
+// transferSLAStatus returns the SLA status shown for a transfer: closed transfers
+// that weren't breached met their SLA
+func transferSLAStatus(status models.TransferStatus, sla models.SLATracking) models.SLAStatus {
+	if sla.PolicyID == nil {
+		return ""
+	}
+	if status != models.TransferStatusActive && sla.Status != models.SLAStatusBreached {
+		return models.SLAStatusMet
+	}
+	return sla.Status
+}
+
+// recordSLAFirstResponse marks the contact's active transfer as answered by an agent
+func (a *App) recordSLAFirstResponse(orgID, contactID uuid.UUID) {
+	a.DB.Model(&models.AgentTransfer{}).
+		Where("organization_id = ? AND contact_id = ? AND status = ? AND first_response_at IS NULL",
+			orgID, contactID, models.TransferStatusActive).
+		Update("first_response_at", time.Now())
+}
+
+// evaluateSLAPolicies flags policy-tracked transfers that are at risk of breaching
+// their SLA or have breached it, notifying agents and firing the breach webhook
+func (p *SLAProcessor) evaluateSLAPolicies(now time.Time) {
+	var transfers []models.AgentTransfer
+	if err := p.app.DB.Where("status = ? AND sla_policy_id IS NOT NULL AND sla_status IN ?",
+		models.TransferStatusActive, []models.SLAStatus{models.SLAStatusOnTrack, models.SLAStatusAtRisk}).
+		Find(&transfers).Error; err != nil {
+		p.app.Log.Error("Failed to find SLA tracked transfers", "error", err)
+		return
+	}
+	if len(transfers) == 0 {
+		return
+	}
+
+	// Deleted policies still apply to the transfers they set deadlines on
+	policyIDs := make([]uuid.UUID, 0, len(transfers))
+	for _, t := range transfers {
+		policyIDs = append(policyIDs, *t.SLA.PolicyID)
+	}
+	var policies []models.SLAPolicy
+	p.app.DB.Unscoped().Where("id IN ?", policyIDs).Find(&policies)
+	policyMap := make(map[uuid.UUID]*models.SLAPolicy, len(policies))
+	for i := range policies {
+		policyMap[policies[i].ID] = &policies[i]
+	}
+
+	for i := range transfers {
+		transfer := &transfers[i]
+		policy := policyMap[*transfer.SLA.PolicyID]
+		if policy == nil {
+			continue
+		}
+
+		status := slaStatusAt(transfer, policy, now)
+		if status == transfer.SLA.Status {
+			continue
+		}
+
+		updates := map[string]interface{}{"sla_status": status}
+		if status == models.SLAStatusBreached && !transfer.SLA.Breached {
+			updates["sla_breached"] = true
+			updates["sla_breached_at"] = now
+			transfer.SLA.Breached = true
+			transfer.SLA.BreachedAt = &now
+		}
+		if err := p.app.DB.Model(transfer).Updates(updates).Error; err != nil {
+			p.app.Log.Error("Failed to update SLA status", "error", err, "transfer_id", transfer.ID)
+			continue
+		}
+		transfer.SLA.Status = status
+
+		p.app.Log.Info("Transfer SLA status changed", "transfer_id", transfer.ID, "sla_status", status, "policy", policy.Name)
+		p.notifySLAStatus(transfer, policy)
+	}
+}
+
+// notifySLAStatus tells agents a transfer is at risk or breached its SLA, and fires
+// the breach webhook
+func (p *SLAProcessor) notifySLAStatus(transfer *models.AgentTransfer, policy *models.SLAPolicy) {
+	var contact models.Contact
+	p.app.DB.Where("id = ?", transfer.ContactID).First(&contact)
+
+	msgType := websocket.TypeSLAAtRisk
+	if transfer.SLA.Status == models.SLAStatusBreached {
+		msgType = websocket.TypeSLABreached
+	}
+
+	var responseDeadline, resolutionDeadline string
+	if transfer.SLA.ResponseDeadline != nil {
+		responseDeadline = transfer.SLA.ResponseDeadline.Format(time.RFC3339)
+	}
+	if transfer.SLA.ResolutionDeadline != nil {
+		resolutionDeadline = transfer.SLA.ResolutionDeadline.Format(time.RFC3339)
+	}
+
+	if p.app.WSHub != nil {
+		p.app.WSHub.BroadcastToOrg(transfer.OrganizationID, websocket.WSMessage{
+			Type: msgType,
+			Payload: map[string]interface{}{
+				"transfer_id":             transfer.ID.String(),
+				"contact_id":              transfer.ContactID.String(),
+				"contact_name":            contact.ProfileName,
+				"agent_id":                transfer.AgentID,
+				"team_id":                 transfer.TeamID,
+				"priority":                transfer.Priority,
+				"sla_status":              transfer.SLA.Status,
+				"sla_policy":              policy.Name,
+				"sla_response_deadline":   responseDeadline,
+				"sla_resolution_deadline": resolutionDeadline,
+			},
+		})
+	}
+
+	if transfer.SLA.Status != models.SLAStatusBreached {
+		return
+	}
+
+	var agentID *string
+	if transfer.AgentID != nil {
+		id := transfer.AgentID.String()
+		agentID = &id
+	}
+	p.app.DispatchWebhook(transfer.OrganizationID, models.WebhookEventSLABreached, SLABreachEventData{
+		TransferID:         transfer.ID.String(),
+		ContactID:          transfer.ContactID.String(),
+		ContactPhone:       contact.PhoneNumber,
+		ContactName:        contact.ProfileName,
+		AgentID:            agentID,
+		Priority:           transfer.Priority,
+		PolicyID:           policy.ID.String(),
+		PolicyName:         policy.Name,
+		ResponseDeadline:   responseDeadline,
+		ResolutionDeadline: resolutionDeadline,
+		Responded:          transfer.SLA.FirstResponseAt != nil,
+		WhatsAppAccount:    transfer.WhatsAppAccount,
+	})
+
+	name := contact.ProfileName
+	if name == "" {
+		name = contact.PhoneNumber
+	}
+	missed := "first response"
+	if transfer.SLA.FirstResponseAt != nil {
+		missed = "resolution"
+	}
+	p.app.notify(transfer.OrganizationID, models.NotificationEventSLABreached,
+		fmt.Sprintf("SLA breached for %s", name),
+		fmt.Sprintf("The transfer of %s (%s, %s priority) missed the %s target of the SLA policy %q.",
+			name, contact.PhoneNumber, transfer.Priority, missed, policy.Name))
+}
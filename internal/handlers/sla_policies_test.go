@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSLAPolicyMatches(t *testing.T) {
+	vip := &models.SLAPolicy{Priority: models.TransferPriorityUrgent, Tags: models.StringArray{"VIP", "enterprise"}}
+	anyUrgent := &models.SLAPolicy{Priority: models.TransferPriorityUrgent}
+	catchAll := &models.SLAPolicy{}
+
+	assert.True(t, slaPolicyMatches(vip, models.TransferPriorityUrgent, map[string]bool{"vip": true}))
+	assert.False(t, slaPolicyMatches(vip, models.TransferPriorityUrgent, map[string]bool{"trial": true}))
+	assert.False(t, slaPolicyMatches(vip, models.TransferPriorityNormal, map[string]bool{"vip": true}))
+	assert.True(t, slaPolicyMatches(anyUrgent, models.TransferPriorityUrgent, nil))
+	assert.True(t, slaPolicyMatches(catchAll, models.TransferPriorityLow, nil))
+}
+
+func TestSLAStatusAt(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	policy := &models.SLAPolicy{BaseModel: models.BaseModel{ID: uuid.New()}, FirstResponseMinutes: 10, ResolutionMinutes: 60, AtRiskPercent: 80}
+
+	transfer := &models.AgentTransfer{}
+	setSLAPolicyDeadlines(transfer, policy, start)
+	assert.Equal(t, models.SLAStatusOnTrack, transfer.SLA.Status)
+	assert.Equal(t, policy.ID, *transfer.SLA.PolicyID)
+
+	tests := []struct {
+		name      string
+		elapsed   time.Duration
+		responded time.Duration // After start; 0 hasn't responded
+		want      models.SLAStatus
+	}{
+		{"fresh", time.Minute, 0, models.SLAStatusOnTrack},
+		{"first response at risk", 9 * time.Minute, 0, models.SLAStatusAtRisk},
+		{"first response missed", 11 * time.Minute, 0, models.SLAStatusBreached},
+		{"responded in time", 30 * time.Minute, 5 * time.Minute, models.SLAStatusOnTrack},
+		{"responded late", 30 * time.Minute, 12 * time.Minute, models.SLAStatusBreached},
+		{"resolution at risk", 50 * time.Minute, 5 * time.Minute, models.SLAStatusAtRisk},
+		{"resolution missed", 61 * time.Minute, 5 * time.Minute, models.SLAStatusBreached},
+	}
+	for _, tt := range tests {
+		transfer.SLA.FirstResponseAt = nil
+		if tt.responded > 0 {
+			respondedAt := start.Add(tt.responded)
+			transfer.SLA.FirstResponseAt = &respondedAt
+		}
+		assert.Equal(t, tt.want, slaStatusAt(transfer, policy, start.Add(tt.elapsed)), tt.name)
+	}
+}
+
+func TestTransferSLAStatus(t *testing.T) {
+	policyID := uuid.New()
+	tracked := models.SLATracking{PolicyID: &policyID, Status: models.SLAStatusAtRisk}
+
+	assert.Equal(t, models.SLAStatusAtRisk, transferSLAStatus(models.TransferStatusActive, tracked))
+	assert.Equal(t, models.SLAStatusMet, transferSLAStatus(models.TransferStatusResumed, tracked))
+
+	tracked.Status = models.SLAStatusBreached
+	assert.Equal(t, models.SLAStatusBreached, transferSLAStatus(models.TransferStatusResumed, tracked))
+
+	assert.Empty(t, transferSLAStatus(models.TransferStatusActive, models.SLATracking{}))
+}
@@ -41,7 +41,10 @@ func (p *SLAProcessor) Start(ctx context.Context) {
 			p.app.Log.Info("SLA processor stopped")
 			return
 		case <-ticker.C:
+			p.assignDeferredTransfers()
 			p.processStaleTransfers()
+			p.evaluateSLAPolicies(time.Now())
+			p.expireStaleSessions(time.Now())
 		}
 	}
 }
@@ -118,6 +121,8 @@ func (p *SLAProcessor) autoCloseExpiredTransfers(orgID uuid.UUID, settings model
 			p.app.Log.Error("Failed to expire transfer", "error", err, "transfer_id", transfer.ID)
 			continue
 		}
+		transfer.Status = models.TransferStatusExpired
+		p.app.syncSessionMode(&transfer)
 
 		p.app.Log.Info("Transfer auto-closed due to expiry",
 			"transfer_id", transfer.ID,
@@ -342,22 +347,32 @@ func (p *SLAProcessor) broadcastTransferUpdate(transfer models.AgentTransfer, ev
 	})
 }
 
-// SetSLADeadlines sets SLA deadlines on a new transfer based on settings
+// SetSLADeadlines sets SLA deadlines on a new transfer based on settings. An SLA
+// policy matching the transfer overrides the response and resolution targets.
 func (a *App) SetSLADeadlines(transfer *models.AgentTransfer, settings *models.ChatbotSettings) {
-	if !settings.SLA.Enabled {
+	policy := a.matchSLAPolicy(transfer)
+	if !settings.SLA.Enabled && policy == nil {
 		return
 	}
 
-	now := time.Now()
+	// Timers start on the next working day when the transfer arrives on a holiday
+	now := a.nextWorkingTime(transfer.OrganizationID, transfer.WhatsAppAccount, time.Now().In(a.businessHoursLocation(settings)))
+
+	if policy != nil {
+		setSLAPolicyDeadlines(transfer, policy, now)
+	}
+	if !settings.SLA.Enabled {
+		return
+	}
 
 	// Response deadline (time to pick up)
-	if settings.SLA.ResponseMinutes > 0 {
+	if policy == nil && settings.SLA.ResponseMinutes > 0 {
 		deadline := now.Add(time.Duration(settings.SLA.ResponseMinutes) * time.Minute)
 		transfer.SLA.ResponseDeadline = &deadline
 	}
 
 	// Resolution deadline
-	if settings.SLA.ResolutionMinutes > 0 {
+	if policy == nil && settings.SLA.ResolutionMinutes > 0 {
 		deadline := now.Add(time.Duration(settings.SLA.ResolutionMinutes) * time.Minute)
 		transfer.SLA.ResolutionDeadline = &deadline
 	}
@@ -465,7 +480,7 @@ func (p *SLAProcessor) sendChatbotReminder(contact models.Contact, settings mode
 		Account: &account,
 		Contact: &contact,
 		Type:    models.MessageTypeText,
-		Content: settings.ClientInactivity.ReminderMessage,
+		Content: localizedMessage(&settings, conversationLanguage(&settings, nil, &contact), translationClientReminder, settings.ClientInactivity.ReminderMessage),
 	}, SLASendOptions())
 
 	if err != nil {
@@ -504,7 +519,7 @@ func (p *SLAProcessor) autoCloseChatbotSession(contact models.Contact, settings
 				Account: &account,
 				Contact: &contact,
 				Type:    models.MessageTypeText,
-				Content: settings.ClientInactivity.AutoCloseMessage,
+				Content: localizedMessage(&settings, conversationLanguage(&settings, nil, &contact), translationClientAutoClose, settings.ClientInactivity.AutoCloseMessage),
 			}, SLASendOptions())
 
 			if err != nil {
@@ -522,6 +537,15 @@ func (p *SLAProcessor) autoCloseChatbotSession(contact models.Contact, settings
 		return
 	}
 
+	// End the bot session too, so the contact's next message starts afresh
+	var sessions []models.ChatbotSession
+	p.app.DB.Where("organization_id = ? AND contact_id = ? AND status = ? AND mode = ?",
+		contact.OrganizationID, contact.ID, models.SessionStatusActive, models.SessionModeBot).Find(&sessions)
+	now := time.Now()
+	for i := range sessions {
+		p.app.expireSession(&sessions[i], now, now)
+	}
+
 	p.app.Log.Info("Chatbot session closed due to client inactivity",
 		"contact_id", contact.ID,
 		"phone", contact.PhoneNumber,
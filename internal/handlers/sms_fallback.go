@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/shridarpatil/whatomate/pkg/twilio"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// Reasons a template was sent as SMS, recorded in the message's metadata
+const (
+	smsFallbackUndeliverable = "undeliverable"
+	smsFallbackNotDelivered  = "not_delivered"
+)
+
+const (
+	// maxSMSFallbackTimeoutHours is the longest delivery timeout that can be set
+	maxSMSFallbackTimeoutHours = 72
+	// smsFallbackWindow is how long after the delivery timeout an undelivered
+	// template is still sent as SMS, so turning the fallback on doesn't text
+	// every old undelivered message
+	smsFallbackWindow = 24 * time.Hour
+	// smsFallbackBatchSize is how many undelivered templates are sent as SMS per
+	// organization each run
+	smsFallbackBatchSize = 100
+)
+
+// undeliverableErrorCodes are Meta error codes meaning WhatsApp can't deliver to the
+// recipient, such as numbers that aren't on WhatsApp
+var undeliverableErrorCodes = map[int]bool{
+	131026: true, // Message undeliverable
+}
+
+// isUndeliverableError reports whether a send error means the recipient can't be
+// reached on WhatsApp
+func isUndeliverableError(err error) bool {
+	var apiErr *whatsapp.APIError
+	return errors.As(err, &apiErr) && undeliverableErrorCodes[apiErr.Code]
+}
+
+// SMSFallbackSettings send template messages WhatsApp can't deliver as SMS through
+// a Twilio account
+type SMSFallbackSettings struct {
+	Enabled             bool
+	AccountSID          string
+	AuthToken           string // May reference a secret
+	FromNumber          string
+	MessagingServiceSID string
+	// OnUndeliverable sends the SMS when Meta reports the recipient can't be reached
+	OnUndeliverable bool
+	// DeliveryTimeoutHours sends the SMS when a template isn't delivered within
+	// this many hours, never when 0
+	DeliveryTimeoutHours int
+}
+
+// SMSFallbackSettingsRequest updates SMS fallback settings. Omitted fields keep
+// their current value.
+type SMSFallbackSettingsRequest struct {
+	Enabled              *bool   `json:"enabled"`
+	AccountSID           *string `json:"account_sid"`
+	AuthToken            *string `json:"auth_token"`
+	FromNumber           *string `json:"from_number"`
+	MessagingServiceSID  *string `json:"messaging_service_sid"`
+	OnUndeliverable      *bool   `json:"on_undeliverable"`
+	DeliveryTimeoutHours *int    `json:"delivery_timeout_hours"`
+}
+
+// smsFallbackSettings reads the SMS fallback settings from organization settings
+func smsFallbackSettings(settings models.JSONB) SMSFallbackSettings {
+	var s SMSFallbackSettings
+	raw, ok := settings["sms_fallback"].(map[string]interface{})
+	if !ok {
+		return s
+	}
+	s.Enabled, _ = raw["enabled"].(bool)
+	s.AccountSID, _ = raw["account_sid"].(string)
+	s.AuthToken = models.SettingSecret(raw, "auth_token")
+	s.FromNumber, _ = raw["from_number"].(string)
+	s.MessagingServiceSID, _ = raw["messaging_service_sid"].(string)
+	s.OnUndeliverable, _ = raw["on_undeliverable"].(bool)
+	if hours, ok := raw["delivery_timeout_hours"].(float64); ok {
+		s.DeliveryTimeoutHours = int(hours)
+	}
+	return s
+}
+
+// loadSMSFallbackSettings loads an organization's SMS fallback settings
+func (a *App) loadSMSFallbackSettings(orgID uuid.UUID) (SMSFallbackSettings, error) {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return SMSFallbackSettings{}, err
+	}
+	return smsFallbackSettings(org.Settings), nil
+}
+
+// smsFallbackSettingsResponse is the settings as returned by the API, without the
+// auth token
+func smsFallbackSettingsResponse(s SMSFallbackSettings) map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":                s.Enabled,
+		"account_sid":            s.AccountSID,
+		"auth_token_set":         s.AuthToken != "",
+		"from_number":            s.FromNumber,
+		"messaging_service_sid":  s.MessagingServiceSID,
+		"on_undeliverable":       s.OnUndeliverable,
+		"delivery_timeout_hours": s.DeliveryTimeoutHours,
+	}
+}
+
+// validateSMSFallbackSettings checks that enabled settings can send an SMS
+func validateSMSFallbackSettings(s SMSFallbackSettings) string {
+	if s.DeliveryTimeoutHours < 0 || s.DeliveryTimeoutHours > maxSMSFallbackTimeoutHours {
+		return "delivery_timeout_hours must be between 0 and 72"
+	}
+	if s.FromNumber != "" && !strings.HasPrefix(s.FromNumber, "+") {
+		return "from_number must be in E.164 format, e.g. +15551234567"
+	}
+	if !s.Enabled {
+		return ""
+	}
+	if s.AccountSID == "" || s.AuthToken == "" {
+		return "account_sid and auth_token are required"
+	}
+	if s.FromNumber == "" && s.MessagingServiceSID == "" {
+		return "A from_number or messaging_service_sid is required"
+	}
+	if !s.OnUndeliverable && s.DeliveryTimeoutHours == 0 {
+		return "Turn on on_undeliverable or set delivery_timeout_hours"
+	}
+	return ""
+}
+
+// GetSMSFallbackSettings returns the organization's SMS fallback settings
+func (a *App) GetSMSFallbackSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	s, err := a.loadSMSFallbackSettings(orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	return r.SendEnvelope(smsFallbackSettingsResponse(s))
+}
+
+// UpdateSMSFallbackSettings updates the organization's SMS fallback settings
+func (a *App) UpdateSMSFallbackSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req SMSFallbackSettingsRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	before := orgSettingsAuditSnapshot(&org)
+	s := smsFallbackSettings(org.Settings)
+
+	if req.Enabled != nil {
+		s.Enabled = *req.Enabled
+	}
+	if req.AccountSID != nil {
+		s.AccountSID = strings.TrimSpace(*req.AccountSID)
+	}
+	if req.AuthToken != nil {
+		token := strings.TrimSpace(*req.AuthToken)
+		if err := a.checkCredential(r.RequestCtx, orgID, token); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "auth_token: "+err.Error(), nil, "")
+		}
+		s.AuthToken = token
+	}
+	if req.FromNumber != nil {
+		s.FromNumber = strings.TrimSpace(*req.FromNumber)
+	}
+	if req.MessagingServiceSID != nil {
+		s.MessagingServiceSID = strings.TrimSpace(*req.MessagingServiceSID)
+	}
+	if req.OnUndeliverable != nil {
+		s.OnUndeliverable = *req.OnUndeliverable
+	}
+	if req.DeliveryTimeoutHours != nil {
+		s.DeliveryTimeoutHours = *req.DeliveryTimeoutHours
+	}
+	if msg := validateSMSFallbackSettings(s); msg != "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, msg, nil, "")
+	}
+
+	if org.Settings == nil {
+		org.Settings = models.JSONB{}
+	}
+	section := map[string]interface{}{
+		"enabled":                s.Enabled,
+		"account_sid":            s.AccountSID,
+		"auth_token":             s.AuthToken,
+		"from_number":            s.FromNumber,
+		"messaging_service_sid":  s.MessagingServiceSID,
+		"on_undeliverable":       s.OnUndeliverable,
+		"delivery_timeout_hours": s.DeliveryTimeoutHours,
+	}
+	if err := models.EncryptSettingSecrets("sms_fallback", section); err != nil {
+		a.Log.Error("Failed to encrypt SMS fallback credentials", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	org.Settings["sms_fallback"] = section
+	if err := a.DB.Save(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	a.recordOrgSettingsAudit(r, &org, before)
+
+	return r.SendEnvelope(smsFallbackSettingsResponse(s))
+}
+
+// twilioClient returns the client for calls to the Twilio API
+func (a *App) twilioClient() *twilio.Client {
+	if a.Twilio != nil {
+		return a.Twilio
+	}
+	client := twilio.New(a.Log)
+	client.HTTPClient = a.httpClient(config.OutboundTwilio, twilio.DefaultTimeout)
+	return client
+}
+
+// smsPhoneNumber returns a contact's phone number in E.164 format
+func smsPhoneNumber(phone string) string {
+	if strings.HasPrefix(phone, "+") {
+		return phone
+	}
+	return "+" + phone
+}
+
+// smsFallbackBody returns the text of a template message to send as SMS. Templates
+// without body text have nothing worth texting.
+func smsFallbackBody(msg *models.Message) string {
+	content := strings.TrimSpace(msg.Content)
+	if strings.HasPrefix(content, "[Template: ") {
+		return ""
+	}
+	return content
+}
+
+// sendSMSFallback sends a template message WhatsApp couldn't deliver as SMS, when
+// the organization has the fallback on for the reason. It reports whether the SMS
+// was sent, and records it on the message.
+func (a *App) sendSMSFallback(ctx context.Context, msg *models.Message, contact *models.Contact, reason string) bool {
+	if a.simulation != nil || msg.MessageType != models.MessageTypeTemplate || msg.Channel != "" {
+		return false
+	}
+	s, err := a.loadSMSFallbackSettings(msg.OrganizationID)
+	if err != nil || !s.Enabled {
+		return false
+	}
+	if reason == smsFallbackUndeliverable && !s.OnUndeliverable {
+		return false
+	}
+	if reason == smsFallbackNotDelivered && s.DeliveryTimeoutHours == 0 {
+		return false
+	}
+	body := smsFallbackBody(msg)
+	if body == "" {
+		return false
+	}
+
+	// Claim the message, so a concurrent status webhook or run of the processor
+	// doesn't text the contact twice
+	result := a.DB.Model(&models.Message{}).
+		Where("id = ? AND (channel IS NULL OR channel = '')", msg.ID).
+		Update("channel", models.ChannelSMS)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+
+	authToken, err := a.resolveCredential(ctx, msg.OrganizationID, s.AuthToken)
+	var sms *twilio.Message
+	if err == nil {
+		sms, err = a.twilioClient().SendSMS(ctx, twilio.Account{
+			SID:                 s.AccountSID,
+			AuthToken:           authToken,
+			From:                s.FromNumber,
+			MessagingServiceSID: s.MessagingServiceSID,
+		}, smsPhoneNumber(contact.PhoneNumber), body)
+	}
+	if err != nil {
+		a.Log.Error("Failed to send SMS fallback", "error", err, "message_id", msg.ID)
+		a.DB.Model(&models.Message{}).Where("id = ?", msg.ID).Update("channel", "")
+		return false
+	}
+
+	metadata := msg.Metadata
+	if metadata == nil {
+		metadata = models.JSONB{}
+	}
+	metadata["sms_sid"] = sms.SID
+	metadata["sms_fallback_reason"] = reason
+	if err := a.DB.Model(msg).Update("metadata", metadata).Error; err != nil {
+		a.Log.Error("Failed to record SMS fallback on message", "error", err, "message_id", msg.ID)
+	}
+	msg.Channel = models.ChannelSMS
+
+	a.Log.Info("Template sent as SMS", "message_id", msg.ID, "reason", reason, "sms_sid", sms.SID)
+	return true
+}
+
+// fallBackFailedTemplate sends a template Meta reported as undeliverable as SMS,
+// marking it sent again when the SMS goes out
+func (a *App) fallBackFailedTemplate(message models.Message) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		var contact models.Contact
+		if err := a.DB.Where("id = ?", message.ContactID).First(&contact).Error; err != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if !a.sendSMSFallback(ctx, &message, &contact, smsFallbackUndeliverable) {
+			return
+		}
+
+		if err := a.DB.Model(&message).Updates(map[string]any{
+			"status":        models.MessageStatusSent,
+			"error_code":    0,
+			"error_message": "",
+		}).Error; err != nil {
+			a.Log.Error("Failed to mark SMS fallback sent", "error", err, "message_id", message.ID)
+			return
+		}
+		a.broadcastSMSFallback(&message, models.MessageStatusSent)
+	}()
+}
+
+// broadcastSMSFallback tells the inbox that a message was sent as SMS
+func (a *App) broadcastSMSFallback(message *models.Message, status models.MessageStatus) {
+	if a.WSHub == nil {
+		return
+	}
+	a.WSHub.BroadcastToOrg(message.OrganizationID, websocket.WSMessage{
+		Type: websocket.TypeStatusUpdate,
+		Payload: map[string]any{
+			"message_id": message.ID.String(),
+			"status":     status,
+			"channel":    models.ChannelSMS,
+		},
+	})
+}
+
+// SMSFallbackProcessor sends template messages that weren't delivered within an
+// organization's delivery timeout as SMS
+type SMSFallbackProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewSMSFallbackProcessor creates a new SMS fallback processor
+func NewSMSFallbackProcessor(app *App, interval time.Duration) *SMSFallbackProcessor {
+	return &SMSFallbackProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the SMS fallback loop
+func (p *SMSFallbackProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("SMS fallback processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("SMS fallback processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("SMS fallback processor stopped")
+			return
+		case <-ticker.C:
+			p.processUndelivered(ctx)
+		}
+	}
+}
+
+// Stop stops the SMS fallback processor
+func (p *SMSFallbackProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// processUndelivered sends the templates of organizations with a delivery timeout
+// that are still undelivered past it
+func (p *SMSFallbackProcessor) processUndelivered(ctx context.Context) {
+	var orgs []models.Organization
+	if err := p.app.DB.Select("id", "settings").
+		Where("settings->'sms_fallback'->>'enabled' = ?", "true").
+		Find(&orgs).Error; err != nil {
+		p.app.Log.Error("Failed to load organizations with SMS fallback", "error", err)
+		return
+	}
+
+	for _, org := range orgs {
+		s := smsFallbackSettings(org.Settings)
+		if s.DeliveryTimeoutHours == 0 {
+			continue
+		}
+		cutoff := time.Now().Add(-time.Duration(s.DeliveryTimeoutHours) * time.Hour)
+
+		var messages []models.Message
+		if err := p.app.DB.Where("organization_id = ? AND direction = ? AND message_type = ? AND status = ?",
+			org.ID, models.DirectionOutgoing, models.MessageTypeTemplate, models.MessageStatusSent).
+			Where("(channel IS NULL OR channel = '') AND created_at <= ? AND created_at > ?", cutoff, cutoff.Add(-smsFallbackWindow)).
+			Order("created_at ASC").
+			Limit(smsFallbackBatchSize).
+			Find(&messages).Error; err != nil {
+			p.app.Log.Error("Failed to load undelivered templates", "error", err, "org_id", org.ID)
+			continue
+		}
+
+		for i := range messages {
+			p.fallBack(ctx, &messages[i])
+		}
+	}
+}
+
+// fallBack sends an undelivered template as SMS
+func (p *SMSFallbackProcessor) fallBack(ctx context.Context, message *models.Message) {
+	var contact models.Contact
+	if err := p.app.DB.Where("id = ?", message.ContactID).First(&contact).Error; err != nil {
+		return
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if p.app.sendSMSFallback(sendCtx, message, &contact, smsFallbackNotDelivered) {
+		p.app.broadcastSMSFallback(message, message.Status)
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/twilio"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsUndeliverableError(t *testing.T) {
+	assert.True(t, isUndeliverableError(&whatsapp.APIError{StatusCode: 400, Code: 131026}))
+	assert.True(t, isUndeliverableError(fmt.Errorf("failed to send template: %w", &whatsapp.APIError{StatusCode: 400, Code: 131026})))
+	assert.False(t, isUndeliverableError(&whatsapp.APIError{StatusCode: 400, Code: 130429}))
+	assert.False(t, isUndeliverableError(errors.New("template is required for template messages")))
+}
+
+func TestSMSFallbackSettings(t *testing.T) {
+	s := smsFallbackSettings(models.JSONB{
+		"sms_fallback": map[string]interface{}{
+			"enabled":                true,
+			"account_sid":            "AC123",
+			"auth_token":             "secret",
+			"from_number":            "+15557654321",
+			"on_undeliverable":       true,
+			"delivery_timeout_hours": float64(6),
+		},
+	})
+	assert.True(t, s.Enabled)
+	assert.Equal(t, "AC123", s.AccountSID)
+	assert.Equal(t, "+15557654321", s.FromNumber)
+	assert.True(t, s.OnUndeliverable)
+	assert.Equal(t, 6, s.DeliveryTimeoutHours)
+
+	resp := smsFallbackSettingsResponse(s)
+	assert.Equal(t, true, resp["auth_token_set"])
+	assert.NotContains(t, resp, "auth_token")
+
+	assert.Equal(t, SMSFallbackSettings{}, smsFallbackSettings(models.JSONB{}))
+
+	// The auth token is stored encrypted
+	testutil.EnableEncryption(t)
+	section := map[string]interface{}{"enabled": true, "auth_token": "secret"}
+	require.NoError(t, models.EncryptSettingSecrets("sms_fallback", section))
+	assert.NotEqual(t, "secret", section["auth_token"])
+	assert.Equal(t, "secret", smsFallbackSettings(models.JSONB{"sms_fallback": section}).AuthToken)
+}
+
+func TestValidateSMSFallbackSettings(t *testing.T) {
+	valid := SMSFallbackSettings{
+		Enabled:         true,
+		AccountSID:      "AC123",
+		AuthToken:       "secret",
+		FromNumber:      "+15557654321",
+		OnUndeliverable: true,
+	}
+
+	tests := []struct {
+		name   string
+		modify func(s *SMSFallbackSettings)
+		want   string
+	}{
+		{name: "valid", modify: func(s *SMSFallbackSettings) {}},
+		{name: "disabled without credentials", modify: func(s *SMSFallbackSettings) { *s = SMSFallbackSettings{} }},
+		{name: "messaging service instead of number", modify: func(s *SMSFallbackSettings) { s.FromNumber, s.MessagingServiceSID = "", "MG1" }},
+		{name: "no credentials", modify: func(s *SMSFallbackSettings) { s.AuthToken = "" }, want: "account_sid and auth_token are required"},
+		{name: "no sender", modify: func(s *SMSFallbackSettings) { s.FromNumber = "" }, want: "A from_number or messaging_service_sid is required"},
+		{name: "number not E.164", modify: func(s *SMSFallbackSettings) { s.FromNumber = "15557654321" }, want: "from_number must be in E.164 format, e.g. +15551234567"},
+		{name: "no trigger", modify: func(s *SMSFallbackSettings) { s.OnUndeliverable = false }, want: "Turn on on_undeliverable or set delivery_timeout_hours"},
+		{name: "timeout too long", modify: func(s *SMSFallbackSettings) { s.DeliveryTimeoutHours = 100 }, want: "delivery_timeout_hours must be between 0 and 72"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			tt.modify(&s)
+			assert.Equal(t, tt.want, validateSMSFallbackSettings(s))
+		})
+	}
+}
+
+func TestSMSFallbackBody(t *testing.T) {
+	assert.Equal(t, "Your order has shipped", smsFallbackBody(&models.Message{Content: "Your order has shipped"}))
+	assert.Empty(t, smsFallbackBody(&models.Message{Content: "[Template: Order Update]"}))
+	assert.Equal(t, "+15551234567", smsPhoneNumber("15551234567"))
+	assert.Equal(t, "+15551234567", smsPhoneNumber("+15551234567"))
+}
+
+func TestSendSMSFallback(t *testing.T) {
+	var sent []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		sent = append(sent, r.PostForm.Get("To")+" "+r.PostForm.Get("Body"))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"sid":"SM1","status":"queued"}`))
+	}))
+	defer server.Close()
+
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+		Twilio: twilio.NewWithBaseURL(testutil.NopLogger(), server.URL),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "SMS Org " + uuid.New().String()[:8],
+		Slug:      "sms-org-" + uuid.New().String()[:8],
+		Settings: models.JSONB{
+			"sms_fallback": map[string]interface{}{
+				"enabled":          true,
+				"account_sid":      "AC123",
+				"auth_token":       "secret",
+				"from_number":      "+15557654321",
+				"on_undeliverable": true,
+			},
+		},
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1555" + uuid.New().String()[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	msg := &models.Message{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		WhatsAppAccount: "primary",
+		ContactID:       contact.ID,
+		Direction:       models.DirectionOutgoing,
+		MessageType:     models.MessageTypeTemplate,
+		Content:         "Your order has shipped",
+		Status:          models.MessageStatusSent,
+	}
+	require.NoError(t, app.DB.Create(msg).Error)
+
+	// Delivery timeouts are off, so only undeliverable templates are texted
+	assert.False(t, app.sendSMSFallback(testutil.TestContext(t), msg, contact, smsFallbackNotDelivered))
+	assert.Empty(t, sent)
+
+	require.True(t, app.sendSMSFallback(testutil.TestContext(t), msg, contact, smsFallbackUndeliverable))
+	assert.Equal(t, []string{"+" + contact.PhoneNumber + " Your order has shipped"}, sent)
+
+	var saved models.Message
+	require.NoError(t, app.DB.First(&saved, "id = ?", msg.ID).Error)
+	assert.Equal(t, models.ChannelSMS, saved.Channel)
+	assert.Equal(t, "SM1", saved.Metadata["sms_sid"])
+	assert.Equal(t, smsFallbackUndeliverable, saved.Metadata["sms_fallback_reason"])
+
+	// A message is texted once
+	saved.Channel = ""
+	assert.False(t, app.sendSMSFallback(testutil.TestContext(t), &saved, contact, smsFallbackUndeliverable))
+	assert.Len(t, sent, 1)
+}
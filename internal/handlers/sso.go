@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
 	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
@@ -35,10 +36,15 @@ var oauthProviders = map[string]struct {
 		UserInfoURL: "https://www.googleapis.com/oauth2/v2/userinfo",
 	},
 	"microsoft": {
-		Endpoint:    microsoft.AzureADEndpoint("common"),
+		Endpoint:    microsoft.AzureADEndpoint("common"), // Replaced by the tenant's endpoint when TenantID is set
 		Scopes:      []string{"openid", "email", "profile", "User.Read"},
 		UserInfoURL: "https://graph.microsoft.com/v1.0/me",
 	},
+	"okta": {
+		// Endpoints and user info URL come from the configured issuer. Groups are read
+		// from the groups claim configured on the authorization server.
+		Scopes: []string{"openid", "email", "profile"},
+	},
 	"github": {
 		Endpoint:    github.Endpoint,
 		Scopes:      []string{"user:email", "read:user"},
@@ -77,26 +83,40 @@ type SSOProviderRequest struct {
 	AuthURL     string `json:"auth_url"`
 	TokenURL    string `json:"token_url"`
 	UserInfoURL string `json:"user_info_url"`
+	// Okta authorization server and Microsoft tenant
+	Issuer   string `json:"issuer"`
+	TenantID string `json:"tenant_id"`
+	// Just-in-time role mapping from the user's groups
+	GroupsClaim string            `json:"groups_claim"`
+	RoleMapping map[string]string `json:"role_mapping"`
 }
 
 // SSOProviderResponse represents SSO provider config response (masked secret)
 type SSOProviderResponse struct {
-	Provider        string `json:"provider"`
-	ClientID        string `json:"client_id"`
-	HasSecret       bool   `json:"has_secret"`
-	IsEnabled       bool   `json:"is_enabled"`
-	AllowAutoCreate bool   `json:"allow_auto_create"`
-	DefaultRole     string `json:"default_role"`
-	AllowedDomains  string `json:"allowed_domains"`
-	AuthURL         string `json:"auth_url,omitempty"`
-	TokenURL        string `json:"token_url,omitempty"`
-	UserInfoURL     string `json:"user_info_url,omitempty"`
+	Provider        string            `json:"provider"`
+	ClientID        string            `json:"client_id"`
+	HasSecret       bool              `json:"has_secret"`
+	IsEnabled       bool              `json:"is_enabled"`
+	AllowAutoCreate bool              `json:"allow_auto_create"`
+	DefaultRole     string            `json:"default_role"`
+	AllowedDomains  string            `json:"allowed_domains"`
+	AuthURL         string            `json:"auth_url,omitempty"`
+	TokenURL        string            `json:"token_url,omitempty"`
+	UserInfoURL     string            `json:"user_info_url,omitempty"`
+	Issuer          string            `json:"issuer,omitempty"`
+	TenantID        string            `json:"tenant_id,omitempty"`
+	GroupsClaim     string            `json:"groups_claim,omitempty"`
+	RoleMapping     map[string]string `json:"role_mapping"`
 }
 
+// defaultGroupsClaim is the ID token or user info claim listing the user's groups
+const defaultGroupsClaim = "groups"
+
 // providerDisplayNames maps provider keys to display names
 var providerDisplayNames = map[string]string{
 	"google":    "Google",
 	"microsoft": "Microsoft",
+	"okta":      "Okta",
 	"github":    "GitHub",
 	"facebook":  "Facebook",
 	"custom":    "Custom SSO",
@@ -149,6 +169,10 @@ func (a *App) InitSSO(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "SSO provider not configured or disabled", nil, "")
 	}
 
+	if !a.HasFeature(ssoConfig.OrganizationID, models.PlanFeatureSSO) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureSSO), nil, "")
+	}
+
 	// Generate state token
 	nonce := generateRandomString(32)
 	state := SSOState{
@@ -234,7 +258,8 @@ func (a *App) CallbackSSO(r *fastglue.Request) error {
 
 	// Build OAuth config and exchange code for token
 	oauthConfig := a.buildOAuthConfig(provider, &ssoConfig, r)
-	token, err := oauthConfig.Exchange(context.Background(), code)
+	exchangeCtx := context.WithValue(context.Background(), oauth2.HTTPClient, a.httpClient(config.OutboundSSO, 10*time.Second))
+	token, err := oauthConfig.Exchange(exchangeCtx, code)
 	if err != nil {
 		a.Log.Error("Failed to exchange OAuth code", "error", err, "provider", provider)
 		a.redirectWithError(r, "Failed to authenticate with provider")
@@ -281,10 +306,7 @@ func (a *App) CallbackSSO(r *fastglue.Request) error {
 		}
 
 		// Auto-create user in the SSO config's organization
-		roleName := ssoConfig.DefaultRoleName
-		if roleName == "" {
-			roleName = "agent"
-		}
+		roleName, _ := ssoRoleName(&ssoConfig, userInfo.Groups, a.ssoRolePrivilege(orgID))
 
 		// Look up the CustomRole by name for this organization
 		var customRole models.CustomRole
@@ -294,6 +316,12 @@ func (a *App) CallbackSSO(r *fastglue.Request) error {
 			return nil
 		}
 
+		// Enforce the plan's agent limit
+		if err := a.checkQuota(orgID, models.UsageMetricAgents, 1); err != nil {
+			a.redirectWithError(r, err.Error())
+			return nil
+		}
+
 		user = models.User{
 			OrganizationID: orgID,
 			Email:          userInfo.Email,
@@ -312,6 +340,7 @@ func (a *App) CallbackSSO(r *fastglue.Request) error {
 		}
 
 		a.Log.Info("Created SSO user", "user_id", user.ID, "email", user.Email, "provider", provider)
+		a.syncAgentUsage(orgID)
 	} else {
 		// User exists - update SSO info if not set
 		if user.SSOProvider == "" {
@@ -325,6 +354,8 @@ func (a *App) CallbackSSO(r *fastglue.Request) error {
 			a.redirectWithError(r, "Account is disabled")
 			return nil
 		}
+
+		a.syncSSOUserGroups(&ssoConfig, &user, userInfo.Groups)
 	}
 
 	// Generate JWT tokens
@@ -343,14 +374,14 @@ func (a *App) CallbackSSO(r *fastglue.Request) error {
 	}
 
 	// Redirect to frontend with tokens in URL fragment
-	basePath := a.Config.Server.BasePath
+	basePath := a.CurrentConfig().Server.BasePath
 	if basePath == "" {
 		basePath = ""
 	} else if basePath[0] != '/' {
 		basePath = "/" + basePath
 	}
 	redirectURL := fmt.Sprintf("%s/auth/sso/callback#access_token=%s&refresh_token=%s&expires_in=%d",
-		basePath, accessToken, refreshToken, a.Config.JWT.AccessExpiryMins*60)
+		basePath, accessToken, refreshToken, a.CurrentConfig().JWT.AccessExpiryMins*60)
 
 	r.RequestCtx.Redirect(redirectURL, fasthttp.StatusTemporaryRedirect)
 	return nil
@@ -371,19 +402,8 @@ func (a *App) GetSSOSettings(r *fastglue.Request) error {
 
 	// Map to response (hide secrets)
 	result := make([]SSOProviderResponse, 0, len(providers))
-	for _, p := range providers {
-		result = append(result, SSOProviderResponse{
-			Provider:        p.Provider,
-			ClientID:        p.ClientID,
-			HasSecret:       p.ClientSecret != "",
-			IsEnabled:       p.IsEnabled,
-			AllowAutoCreate: p.AllowAutoCreate,
-			DefaultRole:     p.DefaultRoleName,
-			AllowedDomains:  p.AllowedDomains,
-			AuthURL:         p.AuthURL,
-			TokenURL:        p.TokenURL,
-			UserInfoURL:     p.UserInfoURL,
-		})
+	for i := range providers {
+		result = append(result, toSSOProviderResponse(&providers[i]))
 	}
 
 	return r.SendEnvelope(result)
@@ -396,10 +416,14 @@ func (a *App) UpdateSSOProvider(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
 	}
 
+	if !a.HasFeature(orgID, models.PlanFeatureSSO) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureSSO), nil, "")
+	}
+
 	provider := r.RequestCtx.UserValue("provider").(string)
 
 	// Validate provider
-	validProviders := []string{"google", "microsoft", "github", "facebook", "custom"}
+	validProviders := []string{"google", "microsoft", "okta", "github", "facebook", "custom"}
 	isValid := false
 	for _, p := range validProviders {
 		if p == provider {
@@ -422,6 +446,24 @@ func (a *App) UpdateSSOProvider(r *fastglue.Request) error {
 			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Custom provider requires auth_url, token_url, and user_info_url", nil, "")
 		}
 	}
+	if provider == "okta" {
+		issuer, err := url.Parse(req.Issuer)
+		if err != nil || issuer.Scheme != "https" || issuer.Host == "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Okta provider requires an https issuer URL", nil, "")
+		}
+	}
+
+	// Mapped roles must exist, or users in those groups couldn't log in
+	for group, roleName := range req.RoleMapping {
+		if strings.TrimSpace(group) == "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Role mapping group names can't be empty", nil, "")
+		}
+		var count int64
+		a.DB.Model(&models.CustomRole{}).Where("organization_id = ? AND name = ?", orgID, roleName).Count(&count)
+		if count == 0 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Role %q in role mapping not found", roleName), nil, "")
+		}
+	}
 
 	// Find or create SSO provider config
 	var ssoConfig models.SSOProvider
@@ -433,6 +475,8 @@ func (a *App) UpdateSSOProvider(r *fastglue.Request) error {
 			OrganizationID: orgID,
 			Provider:       provider,
 		}
+	} else if ssoConfig.IsEnabled && !req.IsEnabled && !a.canDisableSSOProvider(orgID, provider) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "SSO is enforced for this organization. Enable another provider or turn off enforced SSO first", nil, "")
 	}
 
 	// Update fields
@@ -450,24 +494,20 @@ func (a *App) UpdateSSOProvider(r *fastglue.Request) error {
 	ssoConfig.AuthURL = req.AuthURL
 	ssoConfig.TokenURL = req.TokenURL
 	ssoConfig.UserInfoURL = req.UserInfoURL
+	ssoConfig.Issuer = strings.TrimRight(req.Issuer, "/")
+	ssoConfig.TenantID = strings.TrimSpace(req.TenantID)
+	ssoConfig.GroupsClaim = strings.TrimSpace(req.GroupsClaim)
+	ssoConfig.RoleMapping = models.JSONB{}
+	for group, roleName := range req.RoleMapping {
+		ssoConfig.RoleMapping[strings.TrimSpace(group)] = roleName
+	}
 
 	if err := a.DB.Save(&ssoConfig).Error; err != nil {
 		a.Log.Error("Failed to save SSO provider", "error", err, "provider", provider)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to save SSO settings", nil, "")
 	}
 
-	return r.SendEnvelope(SSOProviderResponse{
-		Provider:        ssoConfig.Provider,
-		ClientID:        ssoConfig.ClientID,
-		HasSecret:       ssoConfig.ClientSecret != "",
-		IsEnabled:       ssoConfig.IsEnabled,
-		AllowAutoCreate: ssoConfig.AllowAutoCreate,
-		DefaultRole:     ssoConfig.DefaultRoleName,
-		AllowedDomains:  ssoConfig.AllowedDomains,
-		AuthURL:         ssoConfig.AuthURL,
-		TokenURL:        ssoConfig.TokenURL,
-		UserInfoURL:     ssoConfig.UserInfoURL,
-	})
+	return r.SendEnvelope(toSSOProviderResponse(&ssoConfig))
 }
 
 // DeleteSSOProvider removes an SSO provider config (admin only)
@@ -479,6 +519,10 @@ func (a *App) DeleteSSOProvider(r *fastglue.Request) error {
 
 	provider := r.RequestCtx.UserValue("provider").(string)
 
+	if !a.canDisableSSOProvider(orgID, provider) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "SSO is enforced for this organization. Enable another provider or turn off enforced SSO first", nil, "")
+	}
+
 	result := a.DB.Where("organization_id = ? AND provider = ?", orgID, provider).Delete(&models.SSOProvider{})
 	if result.Error != nil {
 		a.Log.Error("Failed to delete SSO provider", "error", result.Error, "provider", provider)
@@ -494,33 +538,203 @@ func (a *App) DeleteSSOProvider(r *fastglue.Request) error {
 
 // Helper functions
 
+func toSSOProviderResponse(p *models.SSOProvider) SSOProviderResponse {
+	roleMapping := make(map[string]string, len(p.RoleMapping))
+	for group, roleName := range p.RoleMapping {
+		if name, ok := roleName.(string); ok {
+			roleMapping[group] = name
+		}
+	}
+	return SSOProviderResponse{
+		Provider:        p.Provider,
+		ClientID:        p.ClientID,
+		HasSecret:       p.ClientSecret != "",
+		IsEnabled:       p.IsEnabled,
+		AllowAutoCreate: p.AllowAutoCreate,
+		DefaultRole:     p.DefaultRoleName,
+		AllowedDomains:  p.AllowedDomains,
+		AuthURL:         p.AuthURL,
+		TokenURL:        p.TokenURL,
+		UserInfoURL:     p.UserInfoURL,
+		Issuer:          p.Issuer,
+		TenantID:        p.TenantID,
+		GroupsClaim:     p.GroupsClaim,
+		RoleMapping:     roleMapping,
+	}
+}
+
+// ssoEnforced reports whether the organization only allows SSO logins
+func ssoEnforced(org *models.Organization) bool {
+	enforced, _ := org.Settings["enforce_sso"].(bool)
+	return enforced
+}
+
+// canDisableSSOProvider reports whether disabling or removing the provider still leaves
+// the organization a way to log in
+func (a *App) canDisableSSOProvider(orgID uuid.UUID, provider string) bool {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil || !ssoEnforced(&org) {
+		return true
+	}
+	var others int64
+	a.DB.Model(&models.SSOProvider{}).
+		Where("organization_id = ? AND provider <> ? AND is_enabled = ?", orgID, provider, true).
+		Count(&others)
+	return others > 0
+}
+
+// ssoRoleName returns the role for a user with the given groups, and whether it came
+// from the provider's role mapping rather than the default role. When several of the
+// groups are mapped, the role with the highest privilege wins, then the first by name.
+func ssoRoleName(ssoConfig *models.SSOProvider, groups []string, privilege map[string]int) (string, bool) {
+	best := ""
+	for _, group := range groups {
+		roleName, ok := ssoConfig.RoleMapping[group].(string)
+		if !ok || roleName == "" {
+			continue
+		}
+		if best == "" || privilege[roleName] > privilege[best] ||
+			(privilege[roleName] == privilege[best] && roleName < best) {
+			best = roleName
+		}
+	}
+	if best != "" {
+		return best, true
+	}
+	if ssoConfig.DefaultRoleName != "" {
+		return ssoConfig.DefaultRoleName, false
+	}
+	return "agent", false
+}
+
+// ssoRolePrivilege returns the number of permissions of each of the organization's
+// roles, which ranks the roles SSO groups are mapped to
+func (a *App) ssoRolePrivilege(orgID uuid.UUID) map[string]int {
+	var rows []struct {
+		Name        string
+		Permissions int
+	}
+	if err := a.DB.Table("custom_roles").
+		Select("custom_roles.name, COUNT(role_permissions.permission_id) AS permissions").
+		Joins("LEFT JOIN role_permissions ON role_permissions.custom_role_id = custom_roles.id").
+		Where("custom_roles.organization_id = ? AND custom_roles.deleted_at IS NULL", orgID).
+		Group("custom_roles.name").
+		Scan(&rows).Error; err != nil {
+		a.Log.Error("Failed to rank SSO roles", "error", err, "org_id", orgID)
+	}
+	privilege := make(map[string]int, len(rows))
+	for _, row := range rows {
+		privilege[row.Name] = row.Permissions
+	}
+	return privilege
+}
+
+// syncSSOUserGroups keeps the role of a user provisioned by the provider in step with
+// their groups when the provider maps groups to roles. Leaving every mapped group moves
+// them back to the default role. Users who signed up with a password keep their role.
+func (a *App) syncSSOUserGroups(ssoConfig *models.SSOProvider, user *models.User, groups []string) {
+	if len(ssoConfig.RoleMapping) == 0 || user.OrganizationID != ssoConfig.OrganizationID ||
+		user.SSOProvider != ssoConfig.Provider || user.PasswordHash != "" {
+		return
+	}
+	roleName, _ := ssoRoleName(ssoConfig, groups, a.ssoRolePrivilege(ssoConfig.OrganizationID))
+	a.syncSSOUserRole(user, roleName)
+}
+
+// syncSSOUserRole moves the user to the named role if they aren't in it already
+func (a *App) syncSSOUserRole(user *models.User, roleName string) {
+	var role models.CustomRole
+	if err := a.DB.Where("organization_id = ? AND name = ?", user.OrganizationID, roleName).First(&role).Error; err != nil {
+		a.Log.Warn("Mapped SSO role not found", "role_name", roleName, "user_id", user.ID)
+		return
+	}
+	if user.RoleID != nil && *user.RoleID == role.ID {
+		return
+	}
+	if err := a.DB.Model(user).Update("role_id", role.ID).Error; err != nil {
+		a.Log.Error("Failed to update SSO user role", "error", err, "user_id", user.ID)
+		return
+	}
+	a.InvalidateUserPermissionsCache(user.ID)
+	a.Log.Info("Updated SSO user role from groups", "user_id", user.ID, "role_name", roleName)
+}
+
+// oktaURL returns an endpoint of the Okta authorization server. Issuers without a path
+// are the org authorization server, whose endpoints live under /oauth2.
+func oktaURL(issuer, endpoint string) string {
+	issuer = strings.TrimRight(issuer, "/")
+	if !strings.Contains(issuer, "/oauth2") {
+		issuer += "/oauth2"
+	}
+	return issuer + "/v1/" + endpoint
+}
+
+// idTokenClaims returns the claims of the ID token in an OAuth token response, if any.
+// The token comes straight from the provider's token endpoint over TLS, so its
+// signature isn't checked (OpenID Connect Core 3.1.3.7).
+func idTokenClaims(token *oauth2.Token) map[string]interface{} {
+	raw, _ := token.Extra("id_token").(string)
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+// claimStrings reads a claim holding a string or a list of strings
+func claimStrings(claims map[string]interface{}, key string) []string {
+	switch v := claims[key].(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
 func (a *App) buildOAuthConfig(provider string, ssoConfig *models.SSOProvider, r *fastglue.Request) *oauth2.Config {
 	var endpoint oauth2.Endpoint
 	var scopes []string
 
-	if provider == "custom" {
+	switch provider {
+	case "custom":
 		endpoint = oauth2.Endpoint{
 			AuthURL:  ssoConfig.AuthURL,
 			TokenURL: ssoConfig.TokenURL,
 		}
 		scopes = []string{"openid", "email", "profile"}
-	} else {
+	case "okta":
+		endpoint = oauth2.Endpoint{
+			AuthURL:  oktaURL(ssoConfig.Issuer, "authorize"),
+			TokenURL: oktaURL(ssoConfig.Issuer, "token"),
+		}
+		scopes = oauthProviders[provider].Scopes
+	default:
 		providerCfg := oauthProviders[provider]
 		endpoint = providerCfg.Endpoint
 		scopes = providerCfg.Scopes
+		if provider == "microsoft" && ssoConfig.TenantID != "" {
+			endpoint = microsoft.AzureADEndpoint(ssoConfig.TenantID)
+		}
 	}
 
-	// Build callback URL from request
-	scheme := "https"
-	if !r.RequestCtx.IsTLS() && a.Config.App.Environment == "development" {
-		scheme = "http"
-	}
-	host := string(r.RequestCtx.Host())
-	basePath := a.Config.Server.BasePath
-	if basePath != "" && basePath[0] != '/' {
-		basePath = "/" + basePath
-	}
-	callbackURL := fmt.Sprintf("%s://%s%s/api/auth/sso/%s/callback", scheme, host, basePath, provider)
+	callbackURL := fmt.Sprintf("%s/api/auth/sso/%s/callback", a.requestBaseURL(r), provider)
 
 	return &oauth2.Config{
 		ClientID:     ssoConfig.ClientID,
@@ -533,21 +747,25 @@ func (a *App) buildOAuthConfig(provider string, ssoConfig *models.SSOProvider, r
 
 // UserInfo represents normalized user info from OAuth providers
 type UserInfo struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
+	ID     string   `json:"id"`
+	Email  string   `json:"email"`
+	Name   string   `json:"name"`
+	Groups []string `json:"groups,omitempty"`
 }
 
 func (a *App) fetchUserInfo(provider string, ssoConfig *models.SSOProvider, token *oauth2.Token) (*UserInfo, error) {
 	var userInfoURL string
 
-	if provider == "custom" {
+	switch provider {
+	case "custom":
 		userInfoURL = ssoConfig.UserInfoURL
-	} else {
+	case "okta":
+		userInfoURL = oktaURL(ssoConfig.Issuer, "userinfo")
+	default:
 		userInfoURL = oauthProviders[provider].UserInfoURL
 	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := a.httpClient(config.OutboundSSO, 10*time.Second)
 	req, err := http.NewRequest("GET", userInfoURL, nil)
 	if err != nil {
 		return nil, err
@@ -611,7 +829,7 @@ func (a *App) fetchUserInfo(provider string, ssoConfig *models.SSOProvider, toke
 		userInfo.ID = getString(rawData, "id")
 		userInfo.Email = getString(rawData, "email")
 		userInfo.Name = getString(rawData, "name")
-	default: // custom
+	default: // okta, custom
 		userInfo.ID = getString(rawData, "sub")
 		if userInfo.ID == "" {
 			userInfo.ID = getString(rawData, "id")
@@ -627,11 +845,21 @@ func (a *App) fetchUserInfo(provider string, ssoConfig *models.SSOProvider, toke
 		return nil, fmt.Errorf("email not provided by SSO provider")
 	}
 
+	// Groups may be in the user info or only in the ID token, as with Microsoft
+	groupsClaim := ssoConfig.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = defaultGroupsClaim
+	}
+	userInfo.Groups = claimStrings(rawData, groupsClaim)
+	if len(userInfo.Groups) == 0 {
+		userInfo.Groups = claimStrings(idTokenClaims(token), groupsClaim)
+	}
+
 	return &userInfo, nil
 }
 
 func (a *App) fetchGitHubEmail(token *oauth2.Token) (string, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := a.httpClient(config.OutboundSSO, 10*time.Second)
 	req, err := http.NewRequest("GET", "https://api.github.com/user/emails", nil)
 	if err != nil {
 		return "", err
@@ -673,8 +901,22 @@ func (a *App) fetchGitHubEmail(token *oauth2.Token) (string, error) {
 	return "", fmt.Errorf("no verified email found")
 }
 
+// requestBaseURL returns the URL the app is served from, as seen by the request
+func (a *App) requestBaseURL(r *fastglue.Request) string {
+	scheme := "https"
+	if !r.RequestCtx.IsTLS() && a.CurrentConfig().App.Environment == "development" {
+		scheme = "http"
+	}
+	host := string(r.RequestCtx.Host())
+	basePath := a.CurrentConfig().Server.BasePath
+	if basePath != "" && basePath[0] != '/' {
+		basePath = "/" + basePath
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, host, basePath)
+}
+
 func (a *App) redirectWithError(r *fastglue.Request, message string) {
-	basePath := a.Config.Server.BasePath
+	basePath := a.CurrentConfig().Server.BasePath
 	if basePath != "" && basePath[0] != '/' {
 		basePath = "/" + basePath
 	}
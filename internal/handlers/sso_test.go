@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/database"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestOktaURL(t *testing.T) {
+	assert.Equal(t, "https://example.okta.com/oauth2/default/v1/authorize", oktaURL("https://example.okta.com/oauth2/default", "authorize"))
+	assert.Equal(t, "https://example.okta.com/oauth2/v1/token", oktaURL("https://example.okta.com/", "token"))
+}
+
+func TestSSORoleName(t *testing.T) {
+	ssoConfig := &models.SSOProvider{
+		DefaultRoleName: "viewer",
+		RoleMapping:     models.JSONB{"support-leads": "manager", "it-admins": "admin", "support": "agent", "qa": "auditor"},
+	}
+	privilege := map[string]int{"admin": 50, "manager": 30, "agent": 6, "auditor": 6, "viewer": 16}
+
+	// The most privileged mapped role wins, whatever order the IdP lists groups in
+	for _, groups := range [][]string{
+		{"everyone", "support-leads", "it-admins"},
+		{"it-admins", "everyone", "support-leads"},
+	} {
+		role, mapped := ssoRoleName(ssoConfig, groups, privilege)
+		assert.Equal(t, "admin", role, groups)
+		assert.True(t, mapped)
+	}
+
+	// Equal privilege is decided by name
+	role, _ := ssoRoleName(ssoConfig, []string{"support", "qa"}, privilege)
+	assert.Equal(t, "agent", role)
+	role, _ = ssoRoleName(ssoConfig, []string{"qa", "support"}, privilege)
+	assert.Equal(t, "agent", role)
+
+	role, mapped := ssoRoleName(ssoConfig, []string{"everyone"}, privilege)
+	assert.Equal(t, "viewer", role)
+	assert.False(t, mapped)
+
+	role, _ = ssoRoleName(&models.SSOProvider{}, nil, nil)
+	assert.Equal(t, "agent", role)
+}
+
+func TestSyncSSOUserGroups(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Redis:  testutil.SetupTestRedis(t),
+		Log:    testutil.NopLogger(),
+	}
+	suffix := uuid.New().String()[:8]
+
+	org := models.Organization{Name: "SSO " + suffix, Slug: "sso-" + suffix}
+	require.NoError(t, app.DB.Create(&org).Error)
+	require.NoError(t, database.SeedSystemRolesForOrg(app.DB, org.ID))
+	roleID := func(name string) uuid.UUID {
+		var role models.CustomRole
+		require.NoError(t, app.DB.Where("organization_id = ? AND name = ?", org.ID, name).First(&role).Error)
+		return role.ID
+	}
+
+	ssoConfig := &models.SSOProvider{
+		OrganizationID:  org.ID,
+		Provider:        "okta",
+		DefaultRoleName: "agent",
+		RoleMapping:     models.JSONB{"it-admins": "admin", "support-leads": "manager"},
+	}
+	adminID := roleID("admin")
+	user := models.User{
+		OrganizationID: org.ID,
+		Email:          "sso-" + suffix + "@example.com",
+		FullName:       "SSO User",
+		RoleID:         &adminID,
+		SSOProvider:    "okta",
+	}
+	require.NoError(t, app.DB.Create(&user).Error)
+
+	// Removed from the admin group but still a support lead
+	app.syncSSOUserGroups(ssoConfig, &user, []string{"support-leads"})
+	require.NoError(t, app.DB.First(&user, user.ID).Error)
+	assert.Equal(t, roleID("manager"), *user.RoleID)
+
+	// Removed from every mapped group
+	app.syncSSOUserGroups(ssoConfig, &user, []string{"everyone"})
+	require.NoError(t, app.DB.First(&user, user.ID).Error)
+	assert.Equal(t, roleID("agent"), *user.RoleID)
+
+	// In both groups
+	app.syncSSOUserGroups(ssoConfig, &user, []string{"support-leads", "it-admins"})
+	require.NoError(t, app.DB.First(&user, user.ID).Error)
+	assert.Equal(t, adminID, *user.RoleID)
+
+	// Users with a password weren't provisioned by the provider and keep their role
+	require.NoError(t, app.DB.Model(&user).Update("password_hash", "hashed").Error)
+	app.syncSSOUserGroups(ssoConfig, &user, nil)
+	require.NoError(t, app.DB.First(&user, user.ID).Error)
+	assert.Equal(t, adminID, *user.RoleID)
+}
+
+func TestIDTokenGroups(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"123","groups":["support-leads","everyone"],"role":"admin"}`))
+	token := (&oauth2.Token{AccessToken: "access"}).WithExtra(map[string]interface{}{
+		"id_token": "header." + payload + ".signature",
+	})
+
+	claims := idTokenClaims(token)
+	assert.Equal(t, []string{"support-leads", "everyone"}, claimStrings(claims, "groups"))
+	assert.Equal(t, []string{"admin"}, claimStrings(claims, "role"))
+	assert.Nil(t, claimStrings(claims, "missing"))
+
+	assert.Nil(t, idTokenClaims(&oauth2.Token{AccessToken: "access"}))
+}
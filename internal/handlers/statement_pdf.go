@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// renderStatementPDF renders a statement as a printable PDF
+func renderStatementPDF(statement *models.Statement, orgName string) []byte {
+	title := "Statement " + statement.Period
+	if statement.Preview {
+		title += " (preview)"
+	}
+
+	rows := []pdfRow{
+		{Cells: []pdfCell{{0, title}}, Size: 18, Bold: true},
+		{Cells: []pdfCell{{0, orgName}}, Size: 11},
+	}
+	if statement.PlanName != "" {
+		rows = append(rows, pdfRow{Cells: []pdfCell{{0, "Plan: " + statement.PlanName}}, Size: 11})
+	}
+
+	rows = append(rows,
+		pdfRow{Size: 11},
+		pdfRow{Cells: []pdfCell{{0, "Messages by category"}}, Size: 13, Bold: true},
+		pdfRow{Cells: []pdfCell{{0, "Category"}, {200, "Messages"}, {320, "Conversations"}}, Size: 10, Bold: true},
+	)
+	if len(statement.Categories) == 0 {
+		rows = append(rows, pdfRow{Cells: []pdfCell{{0, "No messages sent"}}, Size: 10})
+	}
+	for _, c := range statement.Categories {
+		rows = append(rows, pdfRow{Cells: []pdfCell{
+			{0, c.Category},
+			{200, fmt.Sprintf("%d", c.Messages)},
+			{320, fmt.Sprintf("%d", c.Conversations)},
+		}, Size: 10})
+	}
+
+	rows = append(rows,
+		pdfRow{Size: 11},
+		pdfRow{Cells: []pdfCell{{0, "Usage"}}, Size: 13, Bold: true},
+		pdfRow{Cells: []pdfCell{{0, "Metric"}, {200, "Used"}, {320, "Limit"}}, Size: 10, Bold: true},
+	)
+	for _, u := range statement.Usage {
+		limit := "Unlimited"
+		if u.Limit > 0 {
+			limit = fmt.Sprintf("%d", u.Limit)
+		}
+		rows = append(rows, pdfRow{Cells: []pdfCell{
+			{0, usageMetricLabels[u.Metric]},
+			{200, fmt.Sprintf("%d", u.Used)},
+			{320, limit},
+		}, Size: 10})
+	}
+
+	rows = append(rows,
+		pdfRow{Size: 11},
+		pdfRow{Cells: []pdfCell{{0, "Charges"}}, Size: 13, Bold: true},
+		pdfRow{Cells: []pdfCell{{0, "Description"}, {200, "Quantity"}, {280, "Unit price"}, {390, "Amount"}}, Size: 10, Bold: true},
+	)
+	for _, item := range statement.LineItems {
+		rows = append(rows, pdfRow{Cells: []pdfCell{
+			{0, item.Description},
+			{200, fmt.Sprintf("%d", item.Quantity)},
+			{280, formatAmount(item.UnitPrice, statement.Currency)},
+			{390, formatAmount(item.Amount, statement.Currency)},
+		}, Size: 10})
+	}
+	rows = append(rows, pdfRow{Cells: []pdfCell{
+		{0, "Total"},
+		{390, formatAmount(statement.Total, statement.Currency)},
+	}, Size: 11, Bold: true})
+
+	return renderPDF(rows, "")
+}
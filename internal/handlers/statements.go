@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+)
+
+// statementCategoryUnknown groups messages Meta hasn't reported a pricing category for
+const statementCategoryUnknown = "unknown"
+
+// statementMetrics are the monthly metrics reported on statements
+var statementMetrics = []models.UsageMetric{
+	models.UsageMetricMessages,
+	models.UsageMetricCampaignRecipients,
+	models.UsageMetricAICalls,
+}
+
+// statementPeriodRange returns the UTC bounds of a YYYY-MM statement period
+func statementPeriodRange(period string) (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01", period)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid period %q, expected YYYY-MM", period)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// statementLineItems returns the charges for a month of usage on a plan: the plan price,
+// plus message and AI call overage when the plan allows it
+func statementLineItems(plan *models.Plan, usage []models.StatementUsage) []models.StatementLineItem {
+	items := []models.StatementLineItem{}
+	if plan == nil {
+		return items
+	}
+
+	if plan.Price > 0 {
+		name := plan.DisplayName
+		if name == "" {
+			name = plan.Name
+		}
+		items = append(items, models.StatementLineItem{
+			Description: name + " plan",
+			Quantity:    1,
+			UnitPrice:   plan.Price,
+			Amount:      plan.Price,
+		})
+	}
+
+	if !plan.AllowOverage {
+		return items
+	}
+	for _, u := range usage {
+		var unitPrice int64
+		switch u.Metric {
+		case models.UsageMetricMessages:
+			unitPrice = plan.MessageOveragePrice
+		case models.UsageMetricAICalls:
+			unitPrice = plan.AICallOveragePrice
+		}
+		if unitPrice == 0 || u.Limit == 0 || u.Used <= u.Limit {
+			continue
+		}
+		over := u.Used - u.Limit
+		items = append(items, models.StatementLineItem{
+			Description: usageMetricLabels[u.Metric] + " over plan limit",
+			Quantity:    over,
+			UnitPrice:   unitPrice,
+			Amount:      over * unitPrice,
+		})
+	}
+	return items
+}
+
+// formatAmount formats an amount in the smallest currency unit, e.g. "USD 49.00"
+func formatAmount(amount int64, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s %s%d.%02d", currency, sign, amount/100, amount%100)
+}
+
+// errNotBilled is returned for periods that ended before an organization's billing started
+var errNotBilled = errors.New("billing had not started")
+
+// billingStart returns when an organization's billing started: its first plan change, or
+// its creation if it was never on a trial. ok is false until a trial organization selects a plan.
+func (a *App) billingStart(org *models.Organization) (start time.Time, ok bool, err error) {
+	var first models.PlanChange
+	err = a.DB.Where("organization_id = ?", org.ID).Order("started_at").First(&first).Error
+	switch {
+	case err == nil:
+		return first.StartedAt, true, nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return time.Time{}, false, err
+	case org.TrialStartedAt != nil:
+		return time.Time{}, false, nil
+	}
+	return org.CreatedAt, true, nil
+}
+
+// statementPlan returns the plan in effect at the end of a period. Organizations whose
+// plan never changed have been on their current plan since they were created.
+func (a *App) statementPlan(orgID uuid.UUID, end time.Time) (*models.Plan, error) {
+	var change models.PlanChange
+	err := a.DB.Where("organization_id = ? AND started_at < ?", orgID, end).
+		Order("started_at DESC").
+		First(&change).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return a.orgPlan(orgID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if change.PlanID == nil {
+		return nil, nil
+	}
+
+	// The plan may have been deleted since
+	var plan models.Plan
+	if err := a.DB.Unscoped().Where("id = ?", *change.PlanID).First(&plan).Error; err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// buildStatement computes an organization's statement for a period from its messages,
+// usage counters and the plan it was on
+func (a *App) buildStatement(orgID uuid.UUID, period string, plan *models.Plan) (*models.Statement, error) {
+	start, end, err := statementPeriodRange(period)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := []models.StatementCategory{}
+	if err := a.DB.Model(&models.Message{}).
+		Select("COALESCE(NULLIF(pricing_category, ''), ?) AS category, COUNT(*) AS messages, COUNT(DISTINCT NULLIF(conversation_id, '')) AS conversations", statementCategoryUnknown).
+		Where("organization_id = ? AND direction = ? AND status <> ? AND created_at >= ? AND created_at < ?",
+			orgID, models.DirectionOutgoing, models.MessageStatusFailed, start, end).
+		Group("category").
+		Order("category").
+		Scan(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	var counters []models.UsageCounter
+	if err := a.DB.Where("organization_id = ? AND period = ?", orgID, period).Find(&counters).Error; err != nil {
+		return nil, err
+	}
+	used := make(map[models.UsageMetric]int64, len(counters))
+	for _, c := range counters {
+		used[c.Metric] = c.Value
+	}
+
+	var limits models.PlanLimits
+	statement := &models.Statement{
+		OrganizationID: orgID,
+		Period:         period,
+		Currency:       "USD",
+		Categories:     categories,
+	}
+	if plan != nil {
+		limits = plan.Limits
+		statement.PlanName = plan.Name
+		if plan.Currency != "" {
+			statement.Currency = plan.Currency
+		}
+	}
+
+	for _, metric := range statementMetrics {
+		statement.Usage = append(statement.Usage, models.StatementUsage{
+			Metric: metric,
+			Used:   used[metric],
+			Limit:  quotaLimit(limits, metric),
+		})
+	}
+
+	statement.LineItems = statementLineItems(plan, statement.Usage)
+	for _, item := range statement.LineItems {
+		statement.Total += item.Amount
+	}
+	return statement, nil
+}
+
+// findOrCreateStatement returns the stored statement for a closed period, generating it if
+// needed. Periods that ended before billing started return errNotBilled.
+func (a *App) findOrCreateStatement(orgID uuid.UUID, period string) (*models.Statement, error) {
+	var statement models.Statement
+	err := a.DB.Where("organization_id = ? AND period = ?", orgID, period).First(&statement).Error
+	if err == nil {
+		return &statement, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	_, end, err := statementPeriodRange(period)
+	if err != nil {
+		return nil, err
+	}
+	var org models.Organization
+	if err := a.DB.Select("id, created_at, trial_started_at").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return nil, err
+	}
+	start, billed, err := a.billingStart(&org)
+	if err != nil {
+		return nil, err
+	}
+	if !billed || !start.Before(end) {
+		return nil, errNotBilled
+	}
+
+	plan, err := a.statementPlan(orgID, end)
+	if err != nil {
+		return nil, err
+	}
+	generated, err := a.buildStatement(orgID, period, plan)
+	if err != nil {
+		return nil, err
+	}
+	// Another instance may have generated it concurrently; the unique index keeps one
+	if err := a.DB.Create(generated).Error; err != nil {
+		if err := a.DB.Where("organization_id = ? AND period = ?", orgID, period).First(&statement).Error; err == nil {
+			return &statement, nil
+		}
+		return nil, err
+	}
+	return generated, nil
+}
+
+// getStatement returns the statement for a period. The current month is a preview
+// computed on each request; closed months are generated once and stored.
+func (a *App) getStatement(orgID uuid.UUID, period string) (*models.Statement, error) {
+	start, end, err := statementPeriodRange(period)
+	if err != nil {
+		return nil, err
+	}
+	var org models.Organization
+	if err := a.DB.Select("created_at").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return nil, err
+	}
+	if !org.CreatedAt.Before(end) {
+		return nil, fmt.Errorf("organization did not exist in %s", period)
+	}
+	current := usagePeriod(models.UsageMetricMessages, time.Now())
+	switch {
+	case period == current:
+		statement, err := a.buildStatement(orgID, period, a.orgPlan(orgID))
+		if err != nil {
+			return nil, err
+		}
+		statement.Preview = true
+		return statement, nil
+	case start.After(time.Now()):
+		return nil, fmt.Errorf("no statement for future period %s", period)
+	}
+	return a.findOrCreateStatement(orgID, period)
+}
+
+// ListStatements returns the organization's stored statements, newest first
+func (a *App) ListStatements(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var statements []models.Statement
+	if err := a.DB.Where("organization_id = ?", orgID).Order("period DESC").Find(&statements).Error; err != nil {
+		a.Log.Error("Failed to list statements", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list statements", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"statements": statements,
+	})
+}
+
+// GetStatement returns the organization's statement for a period (YYYY-MM)
+func (a *App) GetStatement(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	statement, err := a.findStatement(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Statement not found", nil, "")
+	}
+
+	return r.SendEnvelope(statement)
+}
+
+// GetStatementPDF returns the organization's statement for a period as a PDF
+func (a *App) GetStatementPDF(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	statement, err := a.findStatement(r, orgID)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Statement not found", nil, "")
+	}
+
+	var org models.Organization
+	a.DB.Select("name").Where("id = ?", orgID).First(&org)
+
+	r.RequestCtx.Response.Header.Set("Content-Type", "application/pdf")
+	r.RequestCtx.Response.Header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s.pdf"`, statement.Period))
+	r.RequestCtx.SetBody(renderStatementPDF(statement, org.Name))
+	return nil
+}
+
+// findStatement loads the statement for the {period} path parameter
+func (a *App) findStatement(r *fastglue.Request, orgID uuid.UUID) (*models.Statement, error) {
+	period, _ := r.RequestCtx.UserValue("period").(string)
+	statement, err := a.getStatement(orgID, period)
+	if err != nil {
+		a.Log.Debug("Statement not available", "error", err, "period", period)
+		return nil, err
+	}
+	return statement, nil
+}
+
+// pushStatement sends a statement to the configured billing provider and records the result
+func (a *App) pushStatement(ctx context.Context, statement *models.Statement) {
+	externalID, err := a.sendStatementToProvider(ctx, statement)
+	if err != nil {
+		a.log(ctx).Warn("Failed to push statement to billing provider", "error", err, "statement_id", statement.ID)
+		a.DB.Model(statement).Update("push_error", err.Error())
+		return
+	}
+
+	now := time.Now()
+	a.DB.Model(statement).Updates(map[string]interface{}{
+		"external_id": externalID,
+		"pushed_at":   now,
+		"push_error":  "",
+	})
+	a.log(ctx).Info("Statement pushed to billing provider", "statement_id", statement.ID, "external_id", externalID)
+}
+
+// sendStatementToProvider POSTs a statement to the billing provider. The provider may
+// return {"id": "..."} to link the statement to its invoice.
+func (a *App) sendStatementToProvider(ctx context.Context, statement *models.Statement) (string, error) {
+	body, err := json.Marshal(statement)
+	if err != nil {
+		return "", err
+	}
+
+	billing := a.CurrentConfig().Billing
+	req, err := http.NewRequestWithContext(ctx, "POST", billing.ProviderURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Whatomate-Billing/1.0")
+	if billing.ProviderAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+billing.ProviderAPIKey)
+	}
+
+	client := a.httpClient(config.OutboundIntegrations, 30*time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("billing provider returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	_ = json.Unmarshal(respBody, &result)
+	return result.ID, nil
+}
+
+// StatementProcessor generates statements for the previous month once it closes and
+// pushes them to the billing provider when one is configured. It also samples seats
+// for usage metering.
+type StatementProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewStatementProcessor creates a new statement processor
+func NewStatementProcessor(app *App, interval time.Duration) *StatementProcessor {
+	return &StatementProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the statement processing loop
+func (p *StatementProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Statement processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	// Catch up on statements missed while the server was down
+	p.processStatements(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Statement processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Statement processor stopped")
+			return
+		case <-ticker.C:
+			p.processStatements(ctx)
+		}
+	}
+}
+
+// Stop stops the statement processor
+func (p *StatementProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// processStatements samples seats, generates missing statements for last month and pushes unpushed ones
+func (p *StatementProcessor) processStatements(ctx context.Context) {
+	p.app.meterSeats()
+
+	now := time.Now().UTC()
+	period := now.AddDate(0, 0, -now.Day()).Format("2006-01") // Last day of the previous month
+	_, end, _ := statementPeriodRange(period)
+
+	// Organizations billed by the end of the period: on a plan by then, or never on a trial
+	var orgIDs []uuid.UUID
+	if err := p.app.DB.Model(&models.Organization{}).
+		Where("created_at < ? AND (trial_started_at IS NULL OR id IN (?)) AND id NOT IN (?)", end,
+			p.app.DB.Model(&models.PlanChange{}).Select("organization_id").Where("started_at < ?", end),
+			p.app.DB.Model(&models.Statement{}).Select("organization_id").Where("period = ?", period)).
+		Pluck("id", &orgIDs).Error; err != nil {
+		p.app.Log.Error("Failed to find organizations without statements", "error", err)
+		return
+	}
+
+	generated := 0
+	for _, orgID := range orgIDs {
+		if ctx.Err() != nil {
+			return
+		}
+		_, err := p.app.findOrCreateStatement(orgID, period)
+		switch {
+		case err == nil:
+			generated++
+		case !errors.Is(err, errNotBilled):
+			p.app.Log.Error("Failed to generate statement", "error", err, "org_id", orgID, "period", period)
+		}
+	}
+	if generated > 0 {
+		p.app.Log.Info("Generated statements", "period", period, "count", generated)
+	}
+
+	if cfg := p.app.CurrentConfig(); cfg == nil || cfg.Billing.ProviderURL == "" {
+		return
+	}
+
+	var unpushed []models.Statement
+	if err := p.app.DB.Where("pushed_at IS NULL").Order("created_at").Limit(100).Find(&unpushed).Error; err != nil {
+		p.app.Log.Error("Failed to load unpushed statements", "error", err)
+		return
+	}
+	for i := range unpushed {
+		if ctx.Err() != nil {
+			return
+		}
+		p.app.pushStatement(ctx, &unpushed[i])
+	}
+}
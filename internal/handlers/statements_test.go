@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementPeriodRange(t *testing.T) {
+	start, end, err := statementPeriodRange("2024-12")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), end)
+
+	_, _, err = statementPeriodRange("2024-13")
+	assert.Error(t, err)
+	_, _, err = statementPeriodRange("latest")
+	assert.Error(t, err)
+}
+
+func TestStatementLineItems(t *testing.T) {
+	usage := []models.StatementUsage{
+		{Metric: models.UsageMetricMessages, Used: 1200, Limit: 1000},
+		{Metric: models.UsageMetricCampaignRecipients, Used: 900, Limit: 500},
+		{Metric: models.UsageMetricAICalls, Used: 40, Limit: 50},
+	}
+	plan := &models.Plan{
+		Name:                "pro",
+		DisplayName:         "Pro",
+		Price:               4900,
+		AllowOverage:        true,
+		MessageOveragePrice: 2,
+		AICallOveragePrice:  5,
+	}
+
+	items := statementLineItems(plan, usage)
+	assert.Equal(t, []models.StatementLineItem{
+		{Description: "Pro plan", Quantity: 1, UnitPrice: 4900, Amount: 4900},
+		{Description: "Messages over plan limit", Quantity: 200, UnitPrice: 2, Amount: 400},
+	}, items)
+
+	plan.AllowOverage = false
+	assert.Len(t, statementLineItems(plan, usage), 1, "overage is only charged when the plan allows it")
+
+	assert.Empty(t, statementLineItems(nil, usage))
+}
+
+func TestFindOrCreateStatement_PlanHistory(t *testing.T) {
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger()}
+	suffix := uuid.New().String()[:8]
+
+	basic := models.Plan{Name: "basic-" + suffix, Price: 1000, Currency: "USD"}
+	pro := models.Plan{Name: "pro-" + suffix, Price: 5000, Currency: "USD"}
+	require.NoError(t, app.DB.Create(&basic).Error)
+	require.NoError(t, app.DB.Create(&pro).Error)
+
+	created := time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)
+	trialOrg := models.Organization{
+		BaseModel:      models.BaseModel{CreatedAt: created},
+		Name:           "Trial " + suffix,
+		Slug:           "trial-" + suffix,
+		Plan:           pro.Name,
+		TrialStartedAt: &created,
+	}
+	require.NoError(t, app.DB.Create(&trialOrg).Error)
+
+	// Nothing is billed while the trial organization hasn't selected a plan
+	_, err := app.findOrCreateStatement(trialOrg.ID, "2024-02")
+	assert.ErrorIs(t, err, errNotBilled)
+
+	require.NoError(t, app.DB.Create(&[]models.PlanChange{
+		{OrganizationID: trialOrg.ID, PlanID: &basic.ID, StartedAt: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{OrganizationID: trialOrg.ID, PlanID: &pro.ID, StartedAt: time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)},
+	}).Error)
+
+	_, err = app.findOrCreateStatement(trialOrg.ID, "2024-02")
+	assert.ErrorIs(t, err, errNotBilled, "months before billing started")
+
+	for period, want := range map[string]int64{"2024-03": 1000, "2024-04": 1000, "2024-05": 5000} {
+		statement, err := app.findOrCreateStatement(trialOrg.ID, period)
+		require.NoError(t, err, period)
+		assert.Equal(t, want, statement.Total, period)
+	}
+
+	// Without a trial, billing starts at creation and the first change keeps the
+	// earlier months on the previous plan
+	org := models.Organization{
+		BaseModel: models.BaseModel{CreatedAt: created},
+		Name:      "Direct " + suffix,
+		Slug:      "direct-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(&org).Error)
+	require.NoError(t, app.recordPlanChange(org.ID, &basic, &pro))
+
+	statement, err := app.findOrCreateStatement(org.ID, "2024-01")
+	require.NoError(t, err)
+	assert.Equal(t, basic.Name, statement.PlanName)
+	assert.Equal(t, int64(1000), statement.Total)
+}
+
+func TestFormatAmount(t *testing.T) {
+	assert.Equal(t, "USD 49.00", formatAmount(4900, "USD"))
+	assert.Equal(t, "EUR 0.05", formatAmount(5, "EUR"))
+	assert.Equal(t, "USD -1.50", formatAmount(-150, "USD"))
+}
+
+func TestRenderStatementPDF(t *testing.T) {
+	statement := &models.Statement{
+		Period:     "2025-01",
+		PlanName:   "pro",
+		Currency:   "USD",
+		Categories: []models.StatementCategory{{Category: "marketing", Messages: 120, Conversations: 80}},
+		Usage:      []models.StatementUsage{{Metric: models.UsageMetricMessages, Used: 120, Limit: 1000}},
+		LineItems:  []models.StatementLineItem{{Description: "Pro plan", Quantity: 1, UnitPrice: 4900, Amount: 4900}},
+		Total:      4900,
+	}
+
+	pdf := renderStatementPDF(statement, "Acme (India)")
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	assert.Contains(t, string(pdf), `(Acme \(India\)) Tj`)
+	assert.Contains(t, string(pdf), "(USD 49.00) Tj")
+
+	// startxref points at the xref table, whose entries point at the objects
+	idx := bytes.LastIndex(pdf, []byte("startxref\n"))
+	require.Greater(t, idx, 0)
+	var xref int
+	_, err := fmt.Sscanf(string(pdf[idx+len("startxref\n"):]), "%d", &xref)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(pdf[xref:], []byte("xref\n")))
+
+	entry := pdf[xref+len("xref\n0 7\n0000000000 65535 f \n"):]
+	offset, err := strconv.Atoi(string(entry[:10]))
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(pdf[offset:], []byte("1 0 obj\n")))
+}
+
+func TestRenderPDFPaginates(t *testing.T) {
+	rows := make([]pdfRow, 100)
+	for i := range rows {
+		rows[i] = pdfRow{Cells: []pdfCell{{0, fmt.Sprintf("Row %d", i)}}, Size: 10}
+	}
+
+	pdf := string(renderPDF(rows, ""))
+	assert.Contains(t, pdf, "/Count 3") // 49 rows per page
+}
+
+func TestPDFEscape(t *testing.T) {
+	assert.Equal(t, `a\(b\)\\c`, pdfEscape(`a(b)\c`))
+	assert.Equal(t, `caf\351`, pdfEscape("café"))
+	assert.Equal(t, "?", pdfEscape("日"))
+}
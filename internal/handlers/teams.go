@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,14 +14,21 @@ import (
 type TeamRequest struct {
 	Name               string                   `json:"name" validate:"required"`
 	Description        string                   `json:"description"`
-	AssignmentStrategy models.AssignmentStrategy `json:"assignment_strategy"` // round_robin, load_balanced, manual
+	AssignmentStrategy models.AssignmentStrategy `json:"assignment_strategy"` // round_robin, load_balanced, skill_based, manual
 	IsActive           bool                     `json:"is_active"`
 }
 
 // TeamMemberRequest represents add member request
 type TeamMemberRequest struct {
 	UserID string          `json:"user_id" validate:"required"`
-	Role   models.TeamRole `json:"role"` // manager, agent
+	Role   models.TeamRole `json:"role"`   // manager, agent
+	Skills []string        `json:"skills"` // matched against contact tags by skill-based assignment
+}
+
+// UpdateTeamMemberRequest represents update member request
+type UpdateTeamMemberRequest struct {
+	Role   *models.TeamRole `json:"role"`
+	Skills *[]string        `json:"skills"`
 }
 
 // TeamResponse represents team in API response
@@ -44,6 +52,7 @@ type TeamMemberResponse struct {
 	Email          string          `json:"email"`
 	Role           models.TeamRole `json:"role"` // manager, agent
 	IsAvailable    bool            `json:"is_available"`
+	Skills         []string        `json:"skills"`
 	LastAssignedAt *time.Time      `json:"last_assigned_at,omitempty"`
 }
 
@@ -138,7 +147,7 @@ func (a *App) CreateTeam(r *fastglue.Request) error {
 	if strategy == "" {
 		strategy = models.AssignmentStrategyRoundRobin
 	}
-	if strategy != models.AssignmentStrategyRoundRobin && strategy != models.AssignmentStrategyLoadBalanced && strategy != models.AssignmentStrategyManual {
+	if !isAssignmentStrategy(strategy) {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid assignment strategy", nil, "")
 	}
 
@@ -202,7 +211,7 @@ func (a *App) UpdateTeam(r *fastglue.Request) error {
 	team.IsActive = req.IsActive
 
 	if req.AssignmentStrategy != "" {
-		if req.AssignmentStrategy != models.AssignmentStrategyRoundRobin && req.AssignmentStrategy != models.AssignmentStrategyLoadBalanced && req.AssignmentStrategy != models.AssignmentStrategyManual {
+		if !isAssignmentStrategy(req.AssignmentStrategy) {
 			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid assignment strategy", nil, "")
 		}
 		team.AssignmentStrategy = req.AssignmentStrategy
@@ -293,6 +302,7 @@ func (a *App) ListTeamMembers(r *fastglue.Request) error {
 			Email:          m.User.Email,
 			Role:           m.Role,
 			IsAvailable:    m.User.IsAvailable,
+			Skills:         skillsOrEmpty(m.Skills),
 			LastAssignedAt: m.LastAssignedAt,
 		}
 	}
@@ -374,6 +384,7 @@ func (a *App) AddTeamMember(r *fastglue.Request) error {
 		TeamID: teamID,
 		UserID: memberUserID,
 		Role:   role,
+		Skills: normalizeSkills(req.Skills),
 	}
 
 	if err := a.DB.Create(&member).Error; err != nil {
@@ -388,6 +399,90 @@ func (a *App) AddTeamMember(r *fastglue.Request) error {
 		Email:       user.Email,
 		Role:        member.Role,
 		IsAvailable: user.IsAvailable,
+		Skills:      skillsOrEmpty(member.Skills),
+	}})
+}
+
+// UpdateTeamMember updates a member's role or skills
+func (a *App) UpdateTeamMember(r *fastglue.Request) error {
+	orgID := r.RequestCtx.UserValue("organization_id").(uuid.UUID)
+	userID := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	teamID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid team ID", nil, "")
+	}
+	memberUserID, err := uuid.Parse(r.RequestCtx.UserValue("member_id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid user ID", nil, "")
+	}
+
+	// Verify team exists
+	var team models.Team
+	if err := a.DB.Where("id = ? AND organization_id = ?", teamID, orgID).
+		Preload("Members").First(&team).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Team not found", nil, "")
+	}
+
+	var member *models.TeamMember
+	isManager := false
+	for i, m := range team.Members {
+		if m.UserID == memberUserID {
+			member = &team.Members[i]
+		}
+		if m.UserID == userID && m.Role == models.TeamRoleManager {
+			isManager = true
+		}
+	}
+	if member == nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Member not found in team", nil, "")
+	}
+
+	// Check access: users with teams:write permission OR team managers can update members
+	hasWritePermission := a.HasPermission(userID, models.ResourceTeams, models.ActionWrite)
+	if !hasWritePermission && !isManager {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req UpdateTeamMemberRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	if req.Role != nil && *req.Role != member.Role {
+		if *req.Role != models.TeamRoleManager && *req.Role != models.TeamRoleAgent {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid role. Must be 'manager' or 'agent'", nil, "")
+		}
+		// Only users with teams:write permission can promote or demote managers
+		if !hasWritePermission {
+			return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions to change roles", nil, "")
+		}
+		member.Role = *req.Role
+	}
+	if req.Skills != nil {
+		member.Skills = normalizeSkills(*req.Skills)
+	}
+
+	if err := a.DB.Model(member).Updates(map[string]interface{}{
+		"role":   member.Role,
+		"skills": member.Skills,
+	}).Error; err != nil {
+		a.Log.Error("Failed to update team member", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update member", nil, "")
+	}
+
+	var user models.User
+	a.DB.Where("id = ?", member.UserID).First(&user)
+
+	return r.SendEnvelope(map[string]interface{}{"member": TeamMemberResponse{
+		ID:             member.ID,
+		UserID:         member.UserID,
+		FullName:       user.FullName,
+		Email:          user.Email,
+		Role:           member.Role,
+		IsAvailable:    user.IsAvailable,
+		Skills:         skillsOrEmpty(member.Skills),
+		LastAssignedAt: member.LastAssignedAt,
 	}})
 }
 
@@ -471,6 +566,7 @@ func buildTeamResponse(team *models.Team, includeMembers bool) TeamResponse {
 				ID:             m.ID,
 				UserID:         m.UserID,
 				Role:           m.Role,
+				Skills:         skillsOrEmpty(m.Skills),
 				LastAssignedAt: m.LastAssignedAt,
 			}
 			if m.User != nil {
@@ -483,3 +579,37 @@ func buildTeamResponse(team *models.Team, includeMembers bool) TeamResponse {
 
 	return resp
 }
+
+// isAssignmentStrategy reports whether s is a supported team assignment strategy
+func isAssignmentStrategy(s models.AssignmentStrategy) bool {
+	switch s {
+	case models.AssignmentStrategyRoundRobin, models.AssignmentStrategyLoadBalanced,
+		models.AssignmentStrategySkillBased, models.AssignmentStrategyManual:
+		return true
+	}
+	return false
+}
+
+// normalizeSkills trims skills and drops empty and duplicate (case-insensitive) ones
+func normalizeSkills(skills []string) models.StringArray {
+	seen := make(map[string]bool, len(skills))
+	normalized := models.StringArray{}
+	for _, skill := range skills {
+		skill = strings.TrimSpace(skill)
+		key := strings.ToLower(skill)
+		if skill == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, skill)
+	}
+	return normalized
+}
+
+// skillsOrEmpty returns skills as a slice that's never nil, so it's rendered as []
+func skillsOrEmpty(skills models.StringArray) []string {
+	if skills == nil {
+		return []string{}
+	}
+	return skills
+}
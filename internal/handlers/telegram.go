@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/tracing"
+	"github.com/shridarpatil/whatomate/pkg/telegram"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// Telegram bots are accounts with the telegram channel. The bot token is the
+// account's access token, its phone ID is "tg" and the bot's ID, and its webhook
+// verify token is the secret Telegram sends with every update. Contacts are private
+// chats with the bot: their phone number is "tg" and the chat ID.
+const telegramPrefix = "tg"
+
+// TelegramAccountRequest is the request body for connecting a Telegram bot
+type TelegramAccountRequest struct {
+	Name              string `json:"name"`
+	BotToken          string `json:"bot_token"`
+	IsDefaultIncoming bool   `json:"is_default_incoming"`
+	IsDefaultOutgoing bool   `json:"is_default_outgoing"`
+}
+
+// telegramMediaTypes maps media message types to the media Telegram sends them as
+var telegramMediaTypes = map[models.MessageType]telegram.MediaType{
+	models.MessageTypeImage:    telegram.MediaPhoto,
+	models.MessageTypeDocument: telegram.MediaDocument,
+	models.MessageTypeVideo:    telegram.MediaVideo,
+	models.MessageTypeAudio:    telegram.MediaAudio,
+}
+
+// telegramClient returns the client for calls to the Telegram Bot API
+func (a *App) telegramClient() *telegram.Client {
+	if a.Telegram != nil {
+		return a.Telegram
+	}
+	client := telegram.New(a.Log)
+	client.HTTPClient = a.httpClient(config.OutboundTelegram, telegram.DefaultTimeout)
+	return client
+}
+
+// telegramToken returns the bot token of a Telegram account, resolving it if it
+// references a secret
+func (a *App) telegramToken(account *models.WhatsAppAccount) string {
+	token, err := a.resolveCredential(context.Background(), account.OrganizationID, account.AccessToken)
+	if err != nil {
+		a.Log.Error("Failed to resolve Telegram bot token", "error", err, "account", account.Name)
+	}
+	return token
+}
+
+// telegramContactNumber returns the phone number of the contact for a Telegram chat
+func telegramContactNumber(chatID int64) string {
+	return telegramPrefix + strconv.FormatInt(chatID, 10)
+}
+
+// telegramChatID returns the Telegram chat of a contact's phone number
+func telegramChatID(phoneNumber string) (int64, bool) {
+	if !strings.HasPrefix(phoneNumber, telegramPrefix) {
+		return 0, false
+	}
+	chatID, err := strconv.ParseInt(strings.TrimPrefix(phoneNumber, telegramPrefix), 10, 64)
+	return chatID, err == nil
+}
+
+// telegramMessageID returns the message ID stored for a Telegram message. Telegram
+// numbers messages per chat, so the chat is part of it.
+func telegramMessageID(chatID, messageID int64) string {
+	return fmt.Sprintf("%s:%d:%d", telegramPrefix, chatID, messageID)
+}
+
+// parseTelegramMessageID returns the chat and message of a stored Telegram message ID
+func parseTelegramMessageID(id string) (chatID, messageID int64, ok bool) {
+	parts := strings.Split(id, ":")
+	if len(parts) != 3 || parts[0] != telegramPrefix {
+		return 0, 0, false
+	}
+	chatID, err1 := strconv.ParseInt(parts[1], 10, 64)
+	messageID, err2 := strconv.ParseInt(parts[2], 10, 64)
+	return chatID, messageID, err1 == nil && err2 == nil
+}
+
+// sendTelegramMessage sends an outgoing message through a Telegram bot and returns
+// its message ID. Buttons and lists become inline keyboards; templates, flows,
+// catalogs and contact cards have no Telegram equivalent.
+func (a *App) sendTelegramMessage(ctx context.Context, req OutgoingMessageRequest) (string, error) {
+	chatID, ok := telegramChatID(req.Contact.PhoneNumber)
+	if !ok {
+		return "", fmt.Errorf("contact %s is not a Telegram chat", req.Contact.PhoneNumber)
+	}
+	client := a.telegramClient()
+	token := a.telegramToken(req.Account)
+
+	var messageID int64
+	var err error
+	switch req.Type {
+	case models.MessageTypeText:
+		messageID, err = client.SendMessage(ctx, token, chatID, req.Content, nil)
+
+	case models.MessageTypeImage, models.MessageTypeVideo, models.MessageTypeAudio, models.MessageTypeDocument:
+		mediaType := telegramMediaTypes[req.Type]
+		switch {
+		case len(req.MediaData) > 0:
+			messageID, err = client.SendMediaData(ctx, token, chatID, mediaType, req.MediaData, req.MediaFilename, req.Caption)
+		case req.MediaLink != "":
+			messageID, err = client.SendMediaURL(ctx, token, chatID, mediaType, req.MediaLink, req.Caption)
+		default:
+			return "", fmt.Errorf("media data or link is required for Telegram media messages")
+		}
+
+	case models.MessageTypeInteractive:
+		keyboard, kbErr := telegramKeyboard(req)
+		if kbErr != nil {
+			return "", kbErr
+		}
+		messageID, err = client.SendMessage(ctx, token, chatID, req.BodyText, keyboard)
+
+	case models.MessageTypeLocation:
+		if req.Location == nil {
+			return "", fmt.Errorf("location is required for location messages")
+		}
+		messageID, err = client.SendLocation(ctx, token, chatID, req.Location.Latitude, req.Location.Longitude)
+
+	default:
+		return "", fmt.Errorf("%s messages are not supported on Telegram", req.Type)
+	}
+	if err != nil {
+		return "", err
+	}
+	return telegramMessageID(chatID, messageID), nil
+}
+
+// telegramKeyboard returns the inline keyboard of an interactive message, one button
+// per row. Tapping a button sends its ID back to the bot, like a WhatsApp reply button.
+func telegramKeyboard(req OutgoingMessageRequest) (*telegram.InlineKeyboardMarkup, error) {
+	var rows [][]telegram.InlineKeyboardButton
+	addButton := func(button telegram.InlineKeyboardButton) {
+		rows = append(rows, []telegram.InlineKeyboardButton{button})
+	}
+
+	switch req.InteractiveType {
+	case "cta_url":
+		addButton(telegram.InlineKeyboardButton{Text: req.ButtonText, URL: req.URL})
+	case "product", "product_list":
+		return nil, fmt.Errorf("%s messages are not supported on Telegram", req.InteractiveType)
+	case "list":
+		if req.List != nil {
+			for _, section := range req.List.Sections {
+				for _, row := range section.Rows {
+					addButton(telegram.InlineKeyboardButton{Text: row.Title, CallbackData: row.ID})
+				}
+			}
+			break
+		}
+		fallthrough
+	default: // "button"
+		for _, button := range req.Buttons {
+			if button.Type == "url" {
+				addButton(telegram.InlineKeyboardButton{Text: button.Title, URL: button.URL})
+				continue
+			}
+			addButton(telegram.InlineKeyboardButton{Text: button.Title, CallbackData: button.ID})
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: rows}, nil
+}
+
+// sendTelegramTyping shows that the bot is typing in the chat of a message, in the
+// background. Telegram clears it after 5 seconds or when the bot replies.
+func (a *App) sendTelegramTyping(account *models.WhatsAppAccount, messageID string) {
+	chatID, _, ok := parseTelegramMessageID(messageID)
+	if !ok {
+		return
+	}
+	token := a.telegramToken(account)
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := a.telegramClient().SendChatAction(ctx, token, chatID, "typing"); err != nil {
+			a.Log.Error("Failed to send typing indicator", "error", err, "message_id", messageID)
+		}
+	}()
+}
+
+// telegramIncomingMessage converts a Telegram update into a message as the WhatsApp
+// webhook delivers it, so it goes through the same chatbot, flow and AI processing.
+// Only messages in private chats with the bot are taken. It also returns the sender's
+// name and the ID of the callback query to answer, for button taps.
+func telegramIncomingMessage(update *telegram.Update) (msg map[string]interface{}, profileName, callbackID string, ok bool) {
+	if cq := update.CallbackQuery; cq != nil {
+		if cq.Message == nil || cq.Message.Chat.Type != "private" || cq.Data == "" {
+			return nil, "", "", false
+		}
+		title := cq.Message.ReplyMarkup.ButtonText(cq.Data)
+		if title == "" {
+			title = cq.Data
+		}
+		msg = map[string]interface{}{
+			"from":      telegramContactNumber(cq.Message.Chat.ID),
+			"id":        telegramPrefix + ":cb:" + cq.ID,
+			"timestamp": strconv.FormatInt(time.Now().Unix(), 10),
+			"type":      "interactive",
+			"interactive": map[string]interface{}{
+				"type":         "button_reply",
+				"button_reply": map[string]string{"id": cq.Data, "title": title},
+			},
+			"context": map[string]string{"id": telegramMessageID(cq.Message.Chat.ID, cq.Message.MessageID)},
+		}
+		return msg, cq.From.Name(), cq.ID, true
+	}
+
+	if m := update.EditedMessage; m != nil {
+		if m.Chat.Type != "private" || m.Text == "" {
+			return nil, "", "", false
+		}
+		msg = map[string]interface{}{
+			"from":      telegramContactNumber(m.Chat.ID),
+			"timestamp": strconv.FormatInt(time.Now().Unix(), 10),
+			"type":      "edit",
+			"edit": map[string]interface{}{
+				"original_message_id": telegramMessageID(m.Chat.ID, m.MessageID),
+				"message": map[string]interface{}{
+					"type": "text",
+					"text": map[string]string{"body": m.Text},
+				},
+			},
+		}
+		return msg, senderName(m), "", true
+	}
+
+	m := update.Message
+	if m == nil || m.Chat.Type != "private" {
+		return nil, "", "", false
+	}
+	msg = map[string]interface{}{
+		"from":      telegramContactNumber(m.Chat.ID),
+		"id":        telegramMessageID(m.Chat.ID, m.MessageID),
+		"timestamp": strconv.FormatInt(m.Date, 10),
+	}
+	if m.ReplyToMessage != nil {
+		msg["context"] = map[string]string{"id": telegramMessageID(m.Chat.ID, m.ReplyToMessage.MessageID)}
+	}
+
+	switch {
+	case m.Text != "":
+		msg["type"] = "text"
+		msg["text"] = map[string]string{"body": m.Text}
+	case len(m.Photo) > 0:
+		// Sizes are ordered from smallest to largest
+		msg["type"] = "image"
+		msg["image"] = map[string]string{"id": m.Photo[len(m.Photo)-1].FileID, "mime_type": "image/jpeg", "caption": m.Caption}
+	case m.Document != nil:
+		msg["type"] = "document"
+		msg["document"] = map[string]string{
+			"id":        m.Document.FileID,
+			"mime_type": mimeTypeOr(m.Document.MimeType, "application/octet-stream"),
+			"filename":  m.Document.FileName,
+			"caption":   m.Caption,
+		}
+	case m.Video != nil:
+		msg["type"] = "video"
+		msg["video"] = map[string]string{"id": m.Video.FileID, "mime_type": mimeTypeOr(m.Video.MimeType, "video/mp4"), "caption": m.Caption}
+	case m.Audio != nil:
+		msg["type"] = "audio"
+		msg["audio"] = map[string]string{"id": m.Audio.FileID, "mime_type": mimeTypeOr(m.Audio.MimeType, "audio/mpeg")}
+	case m.Voice != nil:
+		msg["type"] = "audio"
+		msg["audio"] = map[string]string{"id": m.Voice.FileID, "mime_type": mimeTypeOr(m.Voice.MimeType, "audio/ogg")}
+	case m.Sticker != nil:
+		msg["type"] = "sticker"
+		msg["sticker"] = map[string]string{"id": m.Sticker.FileID, "mime_type": "image/webp"}
+	case m.Location != nil:
+		msg["type"] = "location"
+		msg["location"] = map[string]float64{"latitude": m.Location.Latitude, "longitude": m.Location.Longitude}
+	default:
+		return nil, "", "", false
+	}
+	return msg, senderName(m), "", true
+}
+
+// senderName returns the name of who sent a Telegram message
+func senderName(m *telegram.Message) string {
+	if m.From == nil {
+		return ""
+	}
+	return m.From.Name()
+}
+
+// mimeTypeOr returns mimeType, or fallback when Telegram didn't report one
+func mimeTypeOr(mimeType, fallback string) string {
+	if mimeType == "" {
+		return fallback
+	}
+	return mimeType
+}
+
+// TelegramWebhook receives the updates of a Telegram bot. Updates are authenticated
+// by the secret the webhook was registered with, which Telegram sends in a header.
+func (a *App) TelegramWebhook(r *fastglue.Request) error {
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Account not found", nil, "")
+	}
+
+	var account models.WhatsAppAccount
+	if err := a.DB.Where("id = ? AND channel = ?", id, models.ChannelTelegram).First(&account).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Account not found", nil, "")
+	}
+
+	ctx := tracing.FromContext(r.RequestCtx)
+	secret := r.RequestCtx.Request.Header.Peek("X-Telegram-Bot-Api-Secret-Token")
+	if account.WebhookVerifyToken == "" || subtle.ConstantTimeCompare(secret, []byte(account.WebhookVerifyToken)) != 1 {
+		a.log(ctx).Warn("Telegram update rejected - invalid secret", "account", account.Name)
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Invalid secret", nil, "")
+	}
+
+	var update telegram.Update
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &update); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid payload", nil, "")
+	}
+
+	msg, profileName, callbackID, ok := telegramIncomingMessage(&update)
+	if !ok {
+		return r.SendEnvelope(map[string]string{"status": "ignored"})
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		// Button taps show a loading indicator until they are answered
+		if callbackID != "" {
+			answerCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := a.telegramClient().AnswerCallbackQuery(answerCtx, a.telegramToken(&account), callbackID); err != nil {
+				a.log(ctx).Error("Failed to answer Telegram callback query", "error", err)
+			}
+			cancel()
+		}
+		if err := a.processIncomingMessage(ctx, account.PhoneID, msg, profileName); err != nil {
+			a.log(ctx).Error("Failed to process Telegram message", "error", err)
+		}
+	}()
+
+	return r.SendEnvelope(map[string]string{"status": "ok"})
+}
+
+// CreateTelegramAccount connects a Telegram bot by its token, from @BotFather, and
+// registers the webhook Telegram sends the bot's updates to
+func (a *App) CreateTelegramAccount(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	if a.accountLimitReached(orgID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureMultipleAccounts), nil, "")
+	}
+
+	var req TelegramAccountRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.BotToken == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Name and bot_token are required", nil, "")
+	}
+	if err := a.checkCredential(r.RequestCtx, orgID, req.BotToken); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "bot_token: "+err.Error(), nil, "")
+	}
+
+	account := models.WhatsAppAccount{
+		OrganizationID:     orgID,
+		Name:               req.Name,
+		Channel:            string(models.ChannelTelegram),
+		AccessToken:        req.BotToken,
+		WebhookVerifyToken: generateVerifyToken(),
+		APIVersion:         defaultAccountAPIVersion,
+		IsDefaultIncoming:  req.IsDefaultIncoming,
+		IsDefaultOutgoing:  req.IsDefaultOutgoing,
+		Status:             "active",
+	}
+
+	client := a.telegramClient()
+	token := a.telegramToken(&account)
+	bot, err := client.GetMe(r.RequestCtx, token)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid bot token: "+err.Error(), nil, "")
+	}
+	account.PhoneID = telegramPrefix + strconv.FormatInt(bot.ID, 10)
+	account.BusinessID = bot.Username
+
+	// A bot has one webhook, so it can only be connected once
+	var count int64
+	a.DB.Model(&models.WhatsAppAccount{}).Where("phone_id = ?", account.PhoneID).Count(&count)
+	if count > 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusConflict, "This bot is already connected", nil, "")
+	}
+
+	if req.IsDefaultIncoming {
+		a.DB.Model(&models.WhatsAppAccount{}).
+			Where("organization_id = ? AND is_default_incoming = ?", orgID, true).
+			Update("is_default_incoming", false)
+	}
+	if req.IsDefaultOutgoing {
+		a.DB.Model(&models.WhatsAppAccount{}).
+			Where("organization_id = ? AND is_default_outgoing = ?", orgID, true).
+			Update("is_default_outgoing", false)
+	}
+
+	if err := a.DB.Create(&account).Error; err != nil {
+		a.Log.Error("Failed to create Telegram account", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create account", nil, "")
+	}
+
+	webhookURL := a.publicBaseURL(r) + "/api/webhook/telegram/" + account.ID.String()
+	if err := client.SetWebhook(r.RequestCtx, token, webhookURL, account.WebhookVerifyToken); err != nil {
+		a.DB.Unscoped().Delete(&account)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to register Telegram webhook: "+err.Error(), nil, "")
+	}
+
+	return r.SendEnvelope(accountToResponse(account))
+}
+
+// deleteTelegramWebhook stops Telegram sending updates of a bot being disconnected
+func (a *App) deleteTelegramWebhook(ctx context.Context, account *models.WhatsAppAccount) {
+	if err := a.telegramClient().DeleteWebhook(ctx, a.telegramToken(account)); err != nil {
+		a.Log.Warn("Failed to delete Telegram webhook", "error", err, "account", account.Name)
+	}
+}
+
+// testTelegramConnection checks a Telegram bot's token by fetching the bot
+func (a *App) testTelegramConnection(r *fastglue.Request, account *models.WhatsAppAccount) error {
+	bot, err := a.telegramClient().GetMe(r.RequestCtx, a.telegramToken(account))
+	if err != nil {
+		return r.SendEnvelope(map[string]interface{}{
+			"success": false,
+			"error":   "Failed to connect to Telegram: " + err.Error(),
+		})
+	}
+	return r.SendEnvelope(map[string]interface{}{
+		"success":      true,
+		"bot_username": bot.Username,
+		"bot_name":     bot.Name(),
+	})
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/telegram"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeIncoming converts a message built from a Telegram update the way the
+// webhook processing does
+func decodeIncoming(t *testing.T, msg map[string]interface{}) IncomingTextMessage {
+	t.Helper()
+	data, err := json.Marshal(msg)
+	require.NoError(t, err)
+	var incoming IncomingTextMessage
+	require.NoError(t, json.Unmarshal(data, &incoming))
+	return incoming
+}
+
+func TestTelegramIncomingMessage_Text(t *testing.T) {
+	update := &telegram.Update{Message: &telegram.Message{
+		MessageID:      10,
+		From:           &telegram.User{ID: 42, FirstName: "Ada", LastName: "Lovelace"},
+		Chat:           telegram.Chat{ID: 42, Type: "private"},
+		Date:           1700000000,
+		Text:           "Hello",
+		ReplyToMessage: &telegram.Message{MessageID: 9},
+	}}
+
+	msg, name, callbackID, ok := telegramIncomingMessage(update)
+	require.True(t, ok)
+	assert.Equal(t, "Ada Lovelace", name)
+	assert.Empty(t, callbackID)
+
+	incoming := decodeIncoming(t, msg)
+	assert.Equal(t, "tg42", incoming.From)
+	assert.Equal(t, "tg:42:10", incoming.ID)
+	assert.Equal(t, "1700000000", incoming.Timestamp)
+	assert.Equal(t, "text", incoming.Type)
+	assert.Equal(t, "Hello", incoming.Text.Body)
+	assert.Equal(t, "tg:42:9", incoming.Context.ID)
+}
+
+func TestTelegramIncomingMessage_Media(t *testing.T) {
+	update := &telegram.Update{Message: &telegram.Message{
+		MessageID: 11,
+		Chat:      telegram.Chat{ID: 42, Type: "private"},
+		Caption:   "Receipt",
+		Photo:     []telegram.PhotoSize{{FileID: "small"}, {FileID: "large"}},
+	}}
+	msg, _, _, ok := telegramIncomingMessage(update)
+	require.True(t, ok)
+	incoming := decodeIncoming(t, msg)
+	assert.Equal(t, "image", incoming.Type)
+	assert.Equal(t, "large", incoming.Image.ID)
+	assert.Equal(t, "image/jpeg", incoming.Image.MimeType)
+	assert.Equal(t, "Receipt", incoming.Image.Caption)
+
+	update = &telegram.Update{Message: &telegram.Message{
+		MessageID: 12,
+		Chat:      telegram.Chat{ID: 42, Type: "private"},
+		Voice:     &telegram.FileInfo{FileID: "voice-1"},
+	}}
+	msg, _, _, ok = telegramIncomingMessage(update)
+	require.True(t, ok)
+	incoming = decodeIncoming(t, msg)
+	assert.Equal(t, "audio", incoming.Type)
+	assert.Equal(t, "voice-1", incoming.Audio.ID)
+	assert.Equal(t, "audio/ogg", incoming.Audio.MimeType)
+}
+
+func TestTelegramIncomingMessage_CallbackQuery(t *testing.T) {
+	update := &telegram.Update{CallbackQuery: &telegram.CallbackQuery{
+		ID:   "cb-1",
+		From: telegram.User{ID: 42, FirstName: "Ada"},
+		Data: "support",
+		Message: &telegram.Message{
+			MessageID: 20,
+			Chat:      telegram.Chat{ID: 42, Type: "private"},
+			ReplyMarkup: &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{
+				{{Text: "Sales", CallbackData: "sales"}},
+				{{Text: "Support", CallbackData: "support"}},
+			}},
+		},
+	}}
+
+	msg, name, callbackID, ok := telegramIncomingMessage(update)
+	require.True(t, ok)
+	assert.Equal(t, "Ada", name)
+	assert.Equal(t, "cb-1", callbackID)
+
+	incoming := decodeIncoming(t, msg)
+	assert.Equal(t, "interactive", incoming.Type)
+	assert.Equal(t, "tg:cb:cb-1", incoming.ID)
+	assert.Equal(t, "support", incoming.Interactive.ButtonReply.ID)
+	assert.Equal(t, "Support", incoming.Interactive.ButtonReply.Title)
+	assert.Equal(t, "tg:42:20", incoming.Context.ID)
+}
+
+func TestTelegramIncomingMessage_Ignored(t *testing.T) {
+	// Group chats aren't conversations with a contact
+	_, _, _, ok := telegramIncomingMessage(&telegram.Update{Message: &telegram.Message{
+		Chat: telegram.Chat{ID: -100, Type: "group"},
+		Text: "Hi all",
+	}})
+	assert.False(t, ok)
+
+	_, _, _, ok = telegramIncomingMessage(&telegram.Update{})
+	assert.False(t, ok)
+}
+
+func TestTelegramKeyboard(t *testing.T) {
+	keyboard, err := telegramKeyboard(OutgoingMessageRequest{
+		InteractiveType: "button",
+		Buttons: []whatsapp.Button{
+			{ID: "yes", Title: "Yes"},
+			{Title: "Website", Type: "url", URL: "https://example.com"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]telegram.InlineKeyboardButton{
+		{{Text: "Yes", CallbackData: "yes"}},
+		{{Text: "Website", URL: "https://example.com"}},
+	}, keyboard.InlineKeyboard)
+
+	keyboard, err = telegramKeyboard(OutgoingMessageRequest{
+		InteractiveType: "list",
+		List: &whatsapp.ListMessage{Sections: []whatsapp.ListSection{
+			{Rows: []whatsapp.ListRow{{ID: "a", Title: "A"}, {ID: "b", Title: "B"}}},
+		}},
+	})
+	require.NoError(t, err)
+	assert.Len(t, keyboard.InlineKeyboard, 2)
+
+	_, err = telegramKeyboard(OutgoingMessageRequest{InteractiveType: "product"})
+	assert.ErrorContains(t, err, "not supported on Telegram")
+}
+
+func TestSendTelegramMessage(t *testing.T) {
+	var method string
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":5,"chat":{"id":42,"type":"private"}}}`))
+	}))
+	defer server.Close()
+
+	app := &App{Log: testutil.NopLogger(), Telegram: telegram.NewWithBaseURL(testutil.NopLogger(), server.URL)}
+	account := &models.WhatsAppAccount{Channel: string(models.ChannelTelegram), AccessToken: "token"}
+	contact := &models.Contact{PhoneNumber: "tg42"}
+
+	id, err := app.sendTelegramMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: contact, Type: models.MessageTypeText, Content: "Hi",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tg:42:5", id)
+	assert.Equal(t, "/bottoken/sendMessage", method)
+	assert.Equal(t, "Hi", body["text"])
+
+	_, err = app.sendTelegramMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: contact, Type: models.MessageTypeTemplate,
+	})
+	assert.ErrorContains(t, err, "not supported on Telegram")
+
+	_, err = app.sendTelegramMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: &models.Contact{PhoneNumber: "15550001111"}, Type: models.MessageTypeText, Content: "Hi",
+	})
+	assert.ErrorContains(t, err, "not a Telegram chat")
+}
+
+func TestParseTelegramMessageID(t *testing.T) {
+	chatID, messageID, ok := parseTelegramMessageID(telegramMessageID(-42, 7))
+	require.True(t, ok)
+	assert.Equal(t, int64(-42), chatID)
+	assert.Equal(t, int64(7), messageID)
+
+	_, _, ok = parseTelegramMessageID("wamid.abc")
+	assert.False(t, ok)
+}
@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 // Template syntax patterns
@@ -15,8 +17,9 @@ var (
 	// {{if condition}}...{{else}}...{{endif}} or {{if condition}}...{{endif}}
 	ifElsePattern = regexp.MustCompile(`\{\{if\s+([^}]+)\}\}([\s\S]*?)\{\{endif\}\}`)
 
-	// {{variable}} or {{object.nested.path}} or {{array[0].field}}
-	variablePattern = regexp.MustCompile(`\{\{([a-zA-Z_][a-zA-Z0-9_]*(?:\.[a-zA-Z_][a-zA-Z0-9_]*|\[\d+\])*)\}\}`)
+	// {{variable}} or {{object.nested.path}} or {{array[0].field}}, optionally followed
+	// by filters: {{first_name | "there"}} or {{order.date | date:"DD MMM YYYY"}}
+	variablePattern = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*(?:\.[a-zA-Z_][a-zA-Z0-9_]*|\[\d+\])*)\s*((?:\|[^}]*)?)\}\}`)
 
 	// Condition parsing: variable, variable == 'value', variable > 100, etc.
 	conditionPattern = regexp.MustCompile(`^(\w+(?:\.\w+)*)\s*(==|!=|>|<|>=|<=)?\s*(.*)$`)
@@ -24,8 +27,30 @@ var (
 
 const maxLoopIterations = 50
 
+// dateLayoutReplacer turns date filter formats such as "DD MMM YYYY" into Go layouts.
+// Longer tokens come first so MMMM isn't read as MM twice.
+var dateLayoutReplacer = strings.NewReplacer(
+	"YYYY", "2006", "YY", "06",
+	"MMMM", "January", "MMM", "Jan", "MM", "01",
+	"dddd", "Monday", "ddd", "Mon", "DD", "02",
+	"HH", "15", "hh", "03", "mm", "04", "ss", "05",
+)
+
+// dateValueLayouts are the layouts string values are parsed with by the date filter
+var dateValueLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
 // processTemplate processes a template string with variables, conditionals, and loops
 func processTemplate(template string, data map[string]interface{}) string {
+	return renderTemplate(template, data, false)
+}
+
+// processTemplateKeepMissing is processTemplate, except variables without a value
+// and without a fallback are left as they are, for content an agent fills in later
+func processTemplateKeepMissing(template string, data map[string]interface{}) string {
+	return renderTemplate(template, data, true)
+}
+
+func renderTemplate(template string, data map[string]interface{}, keepMissing bool) string {
 	if data == nil {
 		data = make(map[string]interface{})
 	}
@@ -39,7 +64,11 @@ func processTemplate(template string, data map[string]interface{}) string {
 	result = processConditionals(result, data)
 
 	// 3. Process remaining variable replacements
-	result = processVariables(result, data)
+	if keepMissing {
+		result = processVariablesKeepMissing(result, data)
+	} else {
+		result = processVariables(result, data)
+	}
 
 	return result
 }
@@ -151,15 +180,167 @@ func processConditionals(template string, data map[string]interface{}) string {
 
 // processVariables replaces {{variable}} and {{object.path}} with values
 func processVariables(template string, data map[string]interface{}) string {
+	return replaceVariableExpressions(template, data, false)
+}
+
+// processVariablesKeepMissing replaces variables like processVariables, leaving
+// the ones that have no value as they are
+func processVariablesKeepMissing(template string, data map[string]interface{}) string {
+	return replaceVariableExpressions(template, data, true)
+}
+
+func replaceVariableExpressions(template string, data map[string]interface{}, keepMissing bool) string {
 	return variablePattern.ReplaceAllStringFunc(template, func(match string) string {
-		// Remove {{ and }}
-		path := match[2 : len(match)-2]
+		parts := variablePattern.FindStringSubmatch(match)
+		path, filters := parts[1], splitFilters(parts[2])
 
 		value := getNestedValue(data, path)
+		if keepMissing && value == nil && !hasFallback(filters) {
+			return match
+		}
+		for _, filter := range filters {
+			value = applyFilter(value, filter)
+		}
 		return formatValue(value)
 	})
 }
 
+// splitFilters splits the "| filter | filter" part of a variable expression,
+// ignoring pipes inside quoted arguments
+func splitFilters(expr string) []string {
+	var filters []string
+	var current strings.Builder
+	var quote byte
+
+	for i := 0; i < len(expr); i++ {
+		ch := expr[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '|':
+			if f := strings.TrimSpace(current.String()); f != "" {
+				filters = append(filters, f)
+			}
+			current.Reset()
+			continue
+		}
+		current.WriteByte(ch)
+	}
+	if f := strings.TrimSpace(current.String()); f != "" {
+		filters = append(filters, f)
+	}
+	return filters
+}
+
+// hasFallback reports whether filters give a value to use when the variable has none
+func hasFallback(filters []string) bool {
+	for _, filter := range filters {
+		if isQuoted(filter) || strings.HasPrefix(filter, "default:") {
+			return true
+		}
+	}
+	return false
+}
+
+// applyFilter applies one filter of a variable expression to its value:
+// a quoted fallback ("there") or default:"there" for empty values, upper, lower,
+// title, trim, and date:"DD MMM YYYY". Unknown filters leave the value unchanged.
+func applyFilter(value interface{}, filter string) interface{} {
+	if isQuoted(filter) {
+		return fallbackValue(value, unquote(filter))
+	}
+
+	name, arg, _ := strings.Cut(filter, ":")
+	name = strings.TrimSpace(name)
+	arg = unquote(strings.TrimSpace(arg))
+
+	switch name {
+	case "default":
+		return fallbackValue(value, arg)
+	case "upper":
+		return strings.ToUpper(formatValue(value))
+	case "lower":
+		return strings.ToLower(formatValue(value))
+	case "title":
+		return titleCase(formatValue(value))
+	case "trim":
+		return strings.TrimSpace(formatValue(value))
+	case "date":
+		t, ok := dateValue(value)
+		if !ok {
+			return value
+		}
+		if arg == "" {
+			return t.Format("2006-01-02")
+		}
+		return t.Format(dateLayoutReplacer.Replace(arg))
+	}
+	return value
+}
+
+// fallbackValue returns fallback when value is empty
+func fallbackValue(value interface{}, fallback string) interface{} {
+	if strings.TrimSpace(formatValue(value)) == "" {
+		return fallback
+	}
+	return value
+}
+
+// dateValue reads a time from a time value, a date string or a unix timestamp
+func dateValue(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case *time.Time:
+		if v != nil {
+			return *v, true
+		}
+	case int64:
+		return time.Unix(v, 0).UTC(), true
+	case int:
+		return time.Unix(int64(v), 0).UTC(), true
+	case float64:
+		return time.Unix(int64(v), 0).UTC(), true
+	case string:
+		v = strings.TrimSpace(v)
+		for _, layout := range dateValueLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(n, 0).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// titleCase upper-cases the first letter of each word
+func titleCase(s string) string {
+	runes := []rune(strings.ToLower(s))
+	for i, r := range runes {
+		if i == 0 || unicode.IsSpace(runes[i-1]) {
+			runes[i] = unicode.ToUpper(r)
+		}
+	}
+	return string(runes)
+}
+
+func isQuoted(s string) bool {
+	return len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0]
+}
+
+func unquote(s string) string {
+	if isQuoted(s) {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
 // getNestedValue extracts a value from nested maps/arrays using dot notation
 // Supports: "name", "user.profile.name", "items[0].name", "data.items[2].value"
 func getNestedValue(data map[string]interface{}, path string) interface{} {
@@ -428,6 +609,8 @@ func formatValue(value interface{}) string {
 			return "true"
 		}
 		return "false"
+	case time.Time:
+		return v.Format("2006-01-02 15:04")
 	default:
 		return fmt.Sprintf("%v", v)
 	}
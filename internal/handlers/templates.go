@@ -47,6 +47,8 @@ type TemplateResponse struct {
 	FooterContent   string        `json:"footer_content"`
 	Buttons         []interface{} `json:"buttons"`
 	SampleValues    []interface{} `json:"sample_values"`
+	QualityScore    string        `json:"quality_score"`
+	StatusReason    string        `json:"status_reason,omitempty"`
 	CreatedAt       string        `json:"created_at"`
 	UpdatedAt       string        `json:"updated_at"`
 }
@@ -148,6 +150,13 @@ func (a *App) CreateTemplate(r *fastglue.Request) error {
 		a.Log.Error("Failed to create template", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create template", nil, "")
 	}
+	a.recordAudit(r, models.AuditLog{
+		OrganizationID: orgID,
+		Action:         models.AuditActionCreate,
+		ResourceType:   models.AuditResourceTemplate,
+		ResourceID:     &template.ID,
+		ResourceName:   template.Name,
+	}, nil, auditSnapshot(template))
 
 	return r.SendEnvelope(templateToResponse(template))
 }
@@ -206,6 +215,7 @@ func (a *App) UpdateTemplate(r *fastglue.Request) error {
 	if err := r.Decode(&req, "json"); err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
 	}
+	before := auditSnapshot(template)
 
 	// Update fields
 	if req.DisplayName != "" {
@@ -236,6 +246,13 @@ func (a *App) UpdateTemplate(r *fastglue.Request) error {
 		a.Log.Error("Failed to update template", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update template", nil, "")
 	}
+	a.recordAudit(r, models.AuditLog{
+		OrganizationID: orgID,
+		Action:         models.AuditActionUpdate,
+		ResourceType:   models.AuditResourceTemplate,
+		ResourceID:     &template.ID,
+		ResourceName:   template.Name,
+	}, before, auditSnapshot(template))
 
 	return r.SendEnvelope(templateToResponse(template))
 }
@@ -274,6 +291,13 @@ func (a *App) DeleteTemplate(r *fastglue.Request) error {
 		a.Log.Error("Failed to delete template", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete template", nil, "")
 	}
+	a.recordAudit(r, models.AuditLog{
+		OrganizationID: orgID,
+		Action:         models.AuditActionDelete,
+		ResourceType:   models.AuditResourceTemplate,
+		ResourceID:     &template.ID,
+		ResourceName:   template.Name,
+	}, auditSnapshot(template), nil)
 
 	return r.SendEnvelope(map[string]string{"message": "Template deleted successfully"})
 }
@@ -407,6 +431,9 @@ func (a *App) SyncTemplates(r *fastglue.Request) error {
 			Category:        metaTemplate.Category,
 			Status:          metaTemplate.Status,
 		}
+		if metaTemplate.QualityScore != nil {
+			template.QualityScore = metaTemplate.QualityScore.Score
+		}
 
 		// Parse components
 		for _, comp := range metaTemplate.Components {
@@ -446,6 +473,7 @@ func (a *App) SyncTemplates(r *fastglue.Request) error {
 				"body_content":     template.BodyContent,
 				"footer_content":   template.FooterContent,
 				"buttons":          template.Buttons,
+				"quality_score":    template.QualityScore,
 				"deleted_at":       nil, // Restore soft-deleted template
 			})
 		} else {
@@ -495,6 +523,8 @@ func templateToResponse(t models.Template) TemplateResponse {
 		FooterContent:   t.FooterContent,
 		Buttons:         convertFromJSONBArray(t.Buttons),
 		SampleValues:    convertFromJSONBArray(t.SampleValues),
+		QualityScore:    t.QualityScore,
+		StatusReason:    t.StatusReason,
 		CreatedAt:       t.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		UpdatedAt:       t.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 	}
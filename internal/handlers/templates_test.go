@@ -3,7 +3,11 @@ package handlers
 import (
 	"testing"
 
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestExtractParameterNames_PositionalParams(t *testing.T) {
@@ -42,3 +46,40 @@ func TestExtractParameterNames_UnderscoreParams(t *testing.T) {
 	result := extractParameterNames(content)
 	assert.Equal(t, []string{"customer_name", "order_number", "total_amount"}, result)
 }
+
+func TestFindTemplateByName(t *testing.T) {
+	app := &App{DB: testutil.SetupTestDB(t), Log: testutil.NopLogger()}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Template Org " + uuid.New().String()[:8],
+		Slug:      "template-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+
+	for _, tmpl := range []models.Template{
+		{WhatsAppAccount: "main", Language: "es", Status: string(models.TemplateStatusApproved)},
+		{WhatsAppAccount: "main", Language: "en", Status: string(models.TemplateStatusRejected)},
+		{WhatsAppAccount: "support", Language: "en", Status: string(models.TemplateStatusApproved)},
+	} {
+		tmpl.OrganizationID = org.ID
+		tmpl.Name = "order_update"
+		tmpl.BodyContent = "Your order has shipped"
+		require.NoError(t, app.DB.Create(&tmpl).Error)
+	}
+
+	found, err := app.findTemplateByName(org.ID, "order_update", "es", "")
+	require.NoError(t, err)
+	assert.Equal(t, "es", found.Language)
+
+	found, err = app.findTemplateByName(org.ID, "order_update", "en", "")
+	require.NoError(t, err)
+	assert.Equal(t, "support", found.WhatsAppAccount, "approved versions are preferred")
+
+	found, err = app.findTemplateByName(org.ID, "order_update", "en", "main")
+	require.NoError(t, err)
+	assert.Equal(t, string(models.TemplateStatusRejected), found.Status)
+
+	_, err = app.findTemplateByName(org.ID, "order_update", "fr", "")
+	assert.Error(t, err)
+}
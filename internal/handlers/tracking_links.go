@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// trackingCodeAlphabet leaves out characters easily mistaken for one another
+	trackingCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	trackingCodeLength   = 6
+
+	// Size of a QR code module in pixels, by default and at most
+	defaultQRScale = 8
+	maxQRScale     = 32
+)
+
+// trackingCodePattern finds the tracking code appended to a link's pre-filled message
+var trackingCodePattern = regexp.MustCompile(`(?i)\(ref:\s*([A-Z0-9]{6})\)`)
+
+var trackingSources = []string{
+	models.TrackingSourceCampaign,
+	models.TrackingSourcePoster,
+	models.TrackingSourceWebsite,
+	models.TrackingSourceOther,
+}
+
+// TrackingLinkRequest creates or updates a tracking link. On update, omitted fields
+// keep their current value.
+type TrackingLinkRequest struct {
+	Name        string  `json:"name"`
+	PhoneNumber string  `json:"phone_number"`
+	Message     *string `json:"message"`
+	Source      string  `json:"source"`
+	SourceRef   *string `json:"source_ref"`
+	IsActive    *bool   `json:"is_active"`
+}
+
+// TrackingLinkResponse is a tracking link with its URLs and performance
+type TrackingLinkResponse struct {
+	models.TrackingLink
+	WaMeURL       string `json:"wa_me_url"`     // Opens the chat directly, clicks aren't counted
+	ShortURL      string `json:"short_url"`     // Counts the click, then redirects to the wa.me link
+	Conversations int64  `json:"conversations"` // Contacts who sent the tracking code
+	NewContacts   int64  `json:"new_contacts"`  // Of those, contacts who first wrote through the link
+}
+
+// ListTrackingLinks returns the organization's tracking links with how each performed
+func (a *App) ListTrackingLinks(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceCampaigns, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	query := a.DB.Where("organization_id = ?", orgID)
+	if source := string(r.RequestCtx.QueryArgs().Peek("source")); source != "" {
+		query = query.Where("source = ?", source)
+	}
+
+	var links []models.TrackingLink
+	if err := query.Order("created_at DESC").Find(&links).Error; err != nil {
+		a.Log.Error("Failed to list tracking links", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list tracking links", nil, "")
+	}
+
+	var stats []struct {
+		LinkID        uuid.UUID
+		Conversations int64
+		NewContacts   int64
+	}
+	if err := a.DB.Model(&models.TrackingLinkAttribution{}).
+		Select("link_id, COUNT(*) AS conversations, COUNT(*) FILTER (WHERE is_new_contact) AS new_contacts").
+		Where("organization_id = ?", orgID).
+		Group("link_id").
+		Scan(&stats).Error; err != nil {
+		a.Log.Error("Failed to load tracking link stats", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list tracking links", nil, "")
+	}
+
+	baseURL := a.publicBaseURL(r)
+	result := make([]TrackingLinkResponse, len(links))
+	for i, link := range links {
+		result[i] = trackingLinkToResponse(link, baseURL)
+		for _, s := range stats {
+			if s.LinkID == link.ID {
+				result[i].Conversations = s.Conversations
+				result[i].NewContacts = s.NewContacts
+			}
+		}
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"links": result,
+	})
+}
+
+// CreateTrackingLink creates a tracking link with a new tracking code
+func (a *App) CreateTrackingLink(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceCampaigns, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req TrackingLinkRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	link := models.TrackingLink{
+		OrganizationID: orgID,
+		Source:         models.TrackingSourceOther,
+		IsActive:       true,
+		CreatedBy:      &userID,
+	}
+	if err := applyTrackingLinkRequest(&link, &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+	if link.Name == "" || link.PhoneNumber == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "name and phone_number are required", nil, "")
+	}
+
+	// Codes are random, so a clash is unlikely; deleted links keep theirs, since their
+	// short links may still be out there
+	for attempt := 0; attempt < 5; attempt++ {
+		link.Code = generateTrackingCode()
+		var count int64
+		a.DB.Unscoped().Model(&models.TrackingLink{}).Where("code = ?", link.Code).Count(&count)
+		if count == 0 {
+			break
+		}
+	}
+	if err := a.DB.Create(&link).Error; err != nil {
+		a.Log.Error("Failed to create tracking link", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create tracking link", nil, "")
+	}
+
+	return r.SendEnvelope(trackingLinkToResponse(link, a.publicBaseURL(r)))
+}
+
+// UpdateTrackingLink updates a tracking link. The tracking code never changes, so
+// links already shared keep working.
+func (a *App) UpdateTrackingLink(r *fastglue.Request) error {
+	link, errMsg, status := a.findTrackingLink(r, models.ActionWrite)
+	if link == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	var req TrackingLinkRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if err := applyTrackingLinkRequest(link, &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, err.Error(), nil, "")
+	}
+
+	if err := a.DB.Save(link).Error; err != nil {
+		a.Log.Error("Failed to update tracking link", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update tracking link", nil, "")
+	}
+
+	return r.SendEnvelope(trackingLinkToResponse(*link, a.publicBaseURL(r)))
+}
+
+// DeleteTrackingLink deletes a tracking link and its attributions
+func (a *App) DeleteTrackingLink(r *fastglue.Request) error {
+	link, errMsg, status := a.findTrackingLink(r, models.ActionWrite)
+	if link == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("link_id = ?", link.ID).Delete(&models.TrackingLinkAttribution{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(link).Error
+	})
+	if err != nil {
+		a.Log.Error("Failed to delete tracking link", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete tracking link", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]string{"message": "Tracking link deleted"})
+}
+
+// ListTrackingLinkContacts returns the contacts attributed to a tracking link, newest
+// first
+func (a *App) ListTrackingLinkContacts(r *fastglue.Request) error {
+	link, errMsg, status := a.findTrackingLink(r, models.ActionRead)
+	if link == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	var attributions []models.TrackingLinkAttribution
+	if err := a.DB.Where("link_id = ?", link.ID).
+		Preload("Contact").
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&attributions).Error; err != nil {
+		a.Log.Error("Failed to list tracking link contacts", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list contacts", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"attributions": attributions,
+	})
+}
+
+// GetTrackingLinkQR returns a PNG QR code for a tracking link. It encodes the short
+// link so scans are counted as clicks, or the wa.me link with ?direct=true.
+func (a *App) GetTrackingLinkQR(r *fastglue.Request) error {
+	link, errMsg, status := a.findTrackingLink(r, models.ActionRead)
+	if link == nil {
+		return r.SendErrorEnvelope(status, errMsg, nil, "")
+	}
+
+	scale, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("scale")))
+	if scale < 1 || scale > maxQRScale {
+		scale = defaultQRScale
+	}
+
+	target := trackingShortURL(a.publicBaseURL(r), link.Code)
+	if string(r.RequestCtx.QueryArgs().Peek("direct")) == "true" {
+		target = trackingWaMeURL(*link)
+	}
+
+	img, err := renderQRPNG([]byte(target), scale)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Pre-filled message is too long for a QR code", nil, "")
+	}
+
+	r.RequestCtx.Response.Header.Set("Content-Type", "image/png")
+	r.RequestCtx.Response.Header.Set("Content-Disposition",
+		fmt.Sprintf(`inline; filename="qr-%s.png"`, link.Code))
+	r.RequestCtx.SetBody(img)
+	return nil
+}
+
+// FollowTrackingLink counts a click on a short link and redirects to its wa.me link.
+// It is public, as customers open it from posters and websites.
+func (a *App) FollowTrackingLink(r *fastglue.Request) error {
+	code := strings.ToUpper(r.RequestCtx.UserValue("code").(string))
+
+	var link models.TrackingLink
+	if err := a.DB.Where("code = ? AND is_active = ?", code, true).First(&link).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Link not found", nil, "")
+	}
+
+	if err := a.DB.Model(&link).UpdateColumn("clicks", gorm.Expr("clicks + 1")).Error; err != nil {
+		a.Log.Error("Failed to count tracking link click", "error", err, "code", code)
+	}
+
+	r.RequestCtx.Redirect(trackingWaMeURL(link), fasthttp.StatusFound)
+	return nil
+}
+
+// attributeTrackingLink attributes a contact to the tracking link whose code their
+// message carries, if it does
+func (a *App) attributeTrackingLink(account *models.WhatsAppAccount, contact *models.Contact, isNewContact bool, text string) {
+	code := parseTrackingCode(text)
+	if code == "" {
+		return
+	}
+
+	var link models.TrackingLink
+	if err := a.DB.Where("organization_id = ? AND code = ? AND is_active = ?", account.OrganizationID, code, true).
+		First(&link).Error; err != nil {
+		return
+	}
+
+	attribution := models.TrackingLinkAttribution{
+		OrganizationID: account.OrganizationID,
+		LinkID:         link.ID,
+		ContactID:      contact.ID,
+		IsNewContact:   isNewContact,
+	}
+	result := a.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&attribution)
+	if result.Error != nil {
+		a.Log.Error("Failed to attribute contact to tracking link", "error", result.Error, "link", link.Code)
+		return
+	}
+	if result.RowsAffected > 0 {
+		a.Log.Info("Contact attributed to tracking link", "contact_id", contact.ID, "link", link.Code, "source", link.Source)
+	}
+}
+
+// findTrackingLink returns the organization's tracking link named by the id path
+// parameter, if the user may access it for the action, or an error message and status
+func (a *App) findTrackingLink(r *fastglue.Request, action string) (*models.TrackingLink, string, int) {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return nil, "Unauthorized", fasthttp.StatusUnauthorized
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceCampaigns, action) {
+		return nil, "Insufficient permissions", fasthttp.StatusForbidden
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return nil, "Invalid tracking link ID", fasthttp.StatusBadRequest
+	}
+
+	var link models.TrackingLink
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).First(&link).Error; err != nil {
+		return nil, "Tracking link not found", fasthttp.StatusNotFound
+	}
+	return &link, "", fasthttp.StatusOK
+}
+
+// publicBaseURL returns the URL this server is reached at, for links used outside
+// the app such as short links and webhook callbacks
+func (a *App) publicBaseURL(r *fastglue.Request) string {
+	scheme := "https"
+	if !r.RequestCtx.IsTLS() && a.CurrentConfig().App.Environment == "development" {
+		scheme = "http"
+	}
+	basePath := a.CurrentConfig().Server.BasePath
+	if basePath != "" && basePath[0] != '/' {
+		basePath = "/" + basePath
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.RequestCtx.Host(), basePath)
+}
+
+// applyTrackingLinkRequest validates a request and copies the fields it sets
+func applyTrackingLinkRequest(link *models.TrackingLink, req *TrackingLinkRequest) error {
+	if name := strings.TrimSpace(req.Name); name != "" {
+		link.Name = name
+	}
+	if req.PhoneNumber != "" {
+		phone := searchPhoneDigits(req.PhoneNumber)
+		if len(phone) < 8 || len(phone) > 15 {
+			return fmt.Errorf("phone_number must be a full international number")
+		}
+		link.PhoneNumber = phone
+	}
+	if req.Message != nil {
+		link.Message = strings.TrimSpace(*req.Message)
+	}
+	if req.Source != "" {
+		if !slices.Contains(trackingSources, req.Source) {
+			return fmt.Errorf("source must be one of: %s", strings.Join(trackingSources, ", "))
+		}
+		link.Source = req.Source
+	}
+	if req.SourceRef != nil {
+		link.SourceRef = strings.TrimSpace(*req.SourceRef)
+	}
+	if req.IsActive != nil {
+		link.IsActive = *req.IsActive
+	}
+	return nil
+}
+
+func trackingLinkToResponse(link models.TrackingLink, baseURL string) TrackingLinkResponse {
+	return TrackingLinkResponse{
+		TrackingLink: link,
+		WaMeURL:      trackingWaMeURL(link),
+		ShortURL:     trackingShortURL(baseURL, link.Code),
+	}
+}
+
+// trackingMessage returns a link's pre-filled message with its tracking code appended
+func trackingMessage(link models.TrackingLink) string {
+	ref := fmt.Sprintf("(ref: %s)", link.Code)
+	if link.Message == "" {
+		return ref
+	}
+	return link.Message + " " + ref
+}
+
+// trackingWaMeURL returns the wa.me link that opens a chat with the pre-filled message
+func trackingWaMeURL(link models.TrackingLink) string {
+	// wa.me reads + literally, so spaces are escaped as %20
+	text := strings.ReplaceAll(url.QueryEscape(trackingMessage(link)), "+", "%20")
+	return fmt.Sprintf("https://wa.me/%s?text=%s", link.PhoneNumber, text)
+}
+
+func trackingShortURL(baseURL, code string) string {
+	return baseURL + "/api/l/" + code
+}
+
+// parseTrackingCode returns the tracking code in a message, if it has one
+func parseTrackingCode(text string) string {
+	match := trackingCodePattern.FindStringSubmatch(text)
+	if match == nil {
+		return ""
+	}
+	return strings.ToUpper(match[1])
+}
+
+func generateTrackingCode() string {
+	b := make([]byte, trackingCodeLength)
+	_, _ = rand.Read(b)
+	for i := range b {
+		b[i] = trackingCodeAlphabet[int(b[i])%len(trackingCodeAlphabet)]
+	}
+	return string(b)
+}
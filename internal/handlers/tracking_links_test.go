@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrackingCode(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "appended to message", text: "Hi, I'd like to know more (ref: K7M2QX)", want: "K7M2QX"},
+		{name: "message without text", text: "(ref: K7M2QX)", want: "K7M2QX"},
+		{name: "lowercased by the customer", text: "hello (REF:k7m2qx)", want: "K7M2QX"},
+		{name: "no code", text: "Hi, I'd like to know more"},
+		{name: "code too short", text: "Hi (ref: K7M2)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseTrackingCode(tt.text))
+		})
+	}
+}
+
+func TestTrackingWaMeURL(t *testing.T) {
+	link := models.TrackingLink{PhoneNumber: "15551234567", Code: "K7M2QX", Message: "Hi & hello"}
+	assert.Equal(t, "https://wa.me/15551234567?text=Hi%20%26%20hello%20%28ref%3A%20K7M2QX%29", trackingWaMeURL(link))
+
+	link.Message = ""
+	assert.Equal(t, "https://wa.me/15551234567?text=%28ref%3A%20K7M2QX%29", trackingWaMeURL(link))
+}
+
+func TestApplyTrackingLinkRequest(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	link := models.TrackingLink{Source: models.TrackingSourceOther}
+	require.NoError(t, applyTrackingLinkRequest(&link, &TrackingLinkRequest{
+		Name:        "  Spring poster ",
+		PhoneNumber: "+1 (555) 123-4567",
+		Message:     str(" Hi! "),
+		Source:      models.TrackingSourcePoster,
+		SourceRef:   str("Main Street store"),
+	}))
+	assert.Equal(t, "Spring poster", link.Name)
+	assert.Equal(t, "15551234567", link.PhoneNumber)
+	assert.Equal(t, "Hi!", link.Message)
+	assert.Equal(t, models.TrackingSourcePoster, link.Source)
+	assert.Equal(t, "Main Street store", link.SourceRef)
+
+	err := applyTrackingLinkRequest(&link, &TrackingLinkRequest{PhoneNumber: "5551234"})
+	assert.EqualError(t, err, "phone_number must be a full international number")
+
+	err = applyTrackingLinkRequest(&link, &TrackingLinkRequest{Source: "billboard"})
+	assert.EqualError(t, err, "source must be one of: campaign, poster, website, other")
+}
+
+func TestGenerateTrackingCode(t *testing.T) {
+	code := generateTrackingCode()
+	require.Len(t, code, trackingCodeLength)
+	for _, c := range code {
+		assert.True(t, strings.ContainsRune(trackingCodeAlphabet, c), "unexpected character %q", c)
+	}
+
+	// The code survives the round trip through a pre-filled message
+	assert.Equal(t, code, parseTrackingCode(trackingMessage(models.TrackingLink{Code: code, Message: "Hi"})))
+}
+
+func TestAttributeTrackingLink(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Tracking Org " + uuid.New().String()[:8],
+		Slug:      "tracking-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{OrganizationID: org.ID, Name: "tracking-account"}
+	contact := &models.Contact{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		PhoneNumber:    "1555" + uuid.New().String()[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	link := &models.TrackingLink{
+		OrganizationID: org.ID,
+		Name:           "Spring poster",
+		Code:           generateTrackingCode(),
+		PhoneNumber:    "15551234567",
+		Source:         models.TrackingSourcePoster,
+		IsActive:       true,
+	}
+	require.NoError(t, app.DB.Create(link).Error)
+
+	app.attributeTrackingLink(account, contact, true, "Hi (ref: "+link.Code+")")
+	// Later messages with the code don't attribute the contact again
+	app.attributeTrackingLink(account, contact, false, "(ref: "+link.Code+")")
+
+	var attributions []models.TrackingLinkAttribution
+	require.NoError(t, app.DB.Where("link_id = ?", link.ID).Find(&attributions).Error)
+	require.Len(t, attributions, 1)
+	assert.Equal(t, contact.ID, attributions[0].ContactID)
+	assert.True(t, attributions[0].IsNewContact)
+}
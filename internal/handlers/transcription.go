@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+// openAITranscriptionsURL is the OpenAI transcription endpoint, overridden in tests
+var openAITranscriptionsURL = "https://api.openai.com/v1/audio/transcriptions"
+
+const (
+	// defaultTranscriptionModel is the OpenAI model used when none is set
+	defaultTranscriptionModel = "whisper-1"
+	// transcriptionTimeout bounds a transcription call; voice notes can be minutes long
+	transcriptionTimeout = 60 * time.Second
+)
+
+// transcribeVoiceNote transcribes an inbound voice note so the bot can answer it
+// like text. The transcript is saved as the message content for agents to read.
+// It returns "" when transcription is off or fails.
+func (a *App) transcribeVoiceNote(settings *models.ChatbotSettings, message *models.Message) string {
+	if !settings.Transcription.Enabled || message == nil || message.MediaURL == "" {
+		return ""
+	}
+	if !a.HasFeature(settings.OrganizationID, models.PlanFeatureAI) {
+		a.Log.Debug("Voice note not transcribed", "reason", featureUnavailableMessage(models.PlanFeatureAI), "message_id", message.ID)
+		return ""
+	}
+
+	audio, err := a.mediaStore().Get(context.Background(), message.MediaURL)
+	if err != nil {
+		a.Log.Error("Failed to read voice note", "error", err, "message_id", message.ID)
+		return ""
+	}
+
+	transcript, err := a.transcribeAudio(settings, audio, message.MediaMimeType)
+	if err != nil {
+		a.Log.Error("Voice note transcription failed", "error", err, "message_id", message.ID, "provider", settings.Transcription.Provider)
+		return ""
+	}
+	if transcript == "" {
+		return ""
+	}
+
+	message.Content = transcript
+	if err := a.DB.Model(message).Update("content", transcript).Error; err != nil {
+		a.Log.Error("Failed to save voice note transcript", "error", err, "message_id", message.ID)
+	}
+	a.broadcastMessageUpdate(message)
+	a.Log.Info("Voice note transcribed", "message_id", message.ID, "length", len(transcript))
+	return transcript
+}
+
+// transcribeAudio sends audio to the transcription provider and returns the text
+func (a *App) transcribeAudio(settings *models.ChatbotSettings, audio []byte, mimeType string) (string, error) {
+	cfg := settings.Transcription
+	apiKey := cfg.APIKey
+	if apiKey == "" && cfg.Provider != models.TranscriptionProviderWebhook && settings.AI.Provider == models.AIProviderOpenAI {
+		apiKey = settings.AI.APIKey
+	}
+	apiKey, err := a.resolveCredential(context.Background(), settings.OrganizationID, apiKey)
+	if err != nil {
+		return "", fmt.Errorf("transcription API key: %w", err)
+	}
+	if mimeType == "" {
+		mimeType = "audio/ogg"
+	}
+
+	var req *http.Request
+	if cfg.Provider == models.TranscriptionProviderWebhook {
+		req, err = transcriptionWebhookRequest(cfg.URL, audio, mimeType)
+	} else {
+		if apiKey == "" {
+			return "", errors.New("no OpenAI API key for transcription")
+		}
+		req, err = openAITranscriptionRequest(cfg, audio, mimeType)
+	}
+	if err != nil {
+		return "", err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := a.httpClient(config.OutboundAI, transcriptionTimeout).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("transcription failed with status %d: %s", resp.StatusCode, truncateString(string(body), 200))
+	}
+	return parseTranscript(body), nil
+}
+
+// openAITranscriptionRequest builds a multipart request for the OpenAI
+// transcription API, or a server compatible with it
+func openAITranscriptionRequest(cfg models.TranscriptionConfig, audio []byte, mimeType string) (*http.Request, error) {
+	endpoint := cfg.URL
+	if endpoint == "" {
+		endpoint = openAITranscriptionsURL
+	}
+	model := cfg.Model
+	if model == "" {
+		model = defaultTranscriptionModel
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("model", model); err != nil {
+		return nil, err
+	}
+	ext := getExtensionFromMimeType(mimeType)
+	if ext == "" {
+		ext = ".ogg"
+	}
+	part, err := writer.CreateFormFile("file", "voice"+ext)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(audio); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req, nil
+}
+
+// transcriptionWebhookRequest builds a request that posts the raw audio to a
+// custom speech-to-text endpoint
+func transcriptionWebhookRequest(endpoint string, audio []byte, mimeType string) (*http.Request, error) {
+	if endpoint == "" {
+		return nil, errors.New("no transcription URL")
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(audio))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mimeType)
+	return req, nil
+}
+
+// parseTranscript reads the text of a transcription response, {"text": "..."}
+// or plain text
+func parseTranscript(body []byte) string {
+	var resp struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil {
+		return strings.TrimSpace(resp.Text)
+	}
+	return strings.TrimSpace(string(body))
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscribeAudioOpenAI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "whisper-1", r.FormValue("model"))
+		file, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		defer file.Close()
+		assert.Equal(t, "voice.ogg", header.Filename)
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, "OggS", string(data))
+		_, _ = w.Write([]byte(`{"text": " Where is my order? "}`))
+	}))
+	defer server.Close()
+	orig := openAITranscriptionsURL
+	openAITranscriptionsURL = server.URL
+	defer func() { openAITranscriptionsURL = orig }()
+
+	// The AI provider's key is used when it's OpenAI
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{
+		AI:            models.AIConfig{Provider: models.AIProviderOpenAI, APIKey: "key"},
+		Transcription: models.TranscriptionConfig{Enabled: true, Provider: models.TranscriptionProviderOpenAI},
+	}
+	text, err := app.transcribeAudio(settings, []byte("OggS"), "audio/ogg; codecs=opus")
+	require.NoError(t, err)
+	assert.Equal(t, "Where is my order?", text)
+
+	settings.AI.Provider = models.AIProviderAnthropic
+	_, err = app.transcribeAudio(settings, []byte("OggS"), "audio/ogg")
+	assert.ErrorContains(t, err, "no OpenAI API key")
+}
+
+func TestTranscribeAudioWebhook(t *testing.T) {
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "audio/mpeg", r.Header.Get("Content-Type"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		data, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "ID3", string(data))
+		if status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte(`{"text": "Cancel my booking"}`))
+	}))
+	defer server.Close()
+
+	app := &App{Log: testutil.NopLogger()}
+	settings := &models.ChatbotSettings{
+		// The AI key isn't sent to custom endpoints
+		AI:            models.AIConfig{Provider: models.AIProviderOpenAI, APIKey: "key"},
+		Transcription: models.TranscriptionConfig{Enabled: true, Provider: models.TranscriptionProviderWebhook, URL: server.URL},
+	}
+	text, err := app.transcribeAudio(settings, []byte("ID3"), "audio/mpeg")
+	require.NoError(t, err)
+	assert.Equal(t, "Cancel my booking", text)
+
+	status = http.StatusBadGateway
+	_, err = app.transcribeAudio(settings, []byte("ID3"), "audio/mpeg")
+	assert.ErrorContains(t, err, "status 502")
+}
+
+func TestParseTranscript(t *testing.T) {
+	assert.Equal(t, "hello", parseTranscript([]byte(`{"text": "hello"}`)))
+	assert.Equal(t, "hello there", parseTranscript([]byte("hello there\n")))
+}
+
+func TestTranscribeVoiceNoteDisabled(t *testing.T) {
+	app := &App{Log: testutil.NopLogger()}
+	message := &models.Message{MediaURL: "audio/voice.ogg", Content: ""}
+	assert.Empty(t, app.transcribeVoiceNote(&models.ChatbotSettings{}, message))
+	assert.Empty(t, app.transcribeVoiceNote(&models.ChatbotSettings{Transcription: models.TranscriptionConfig{Enabled: true}}, nil))
+}
@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/translate"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// Message metadata keys of translations. Translations are cached by language, and
+// a translated reply keeps the agent's text as its translation.
+const (
+	metadataTranslations   = "translations"    // Language -> text
+	metadataSourceLanguage = "source_language" // Language the message was written or sent in
+	metadataTranslatedFrom = "translated_from" // Language an agent wrote a translated reply in
+)
+
+// userLanguageSetting is the user setting with the language an agent reads and
+// writes messages in
+const userLanguageSetting = "language"
+
+// TranslationSettings connect the machine translation service that translates
+// conversations between agents and customers who speak other languages
+type TranslationSettings struct {
+	Provider          string // deepl or google, empty when not connected
+	APIKey            string // May reference a secret
+	TranslateIncoming bool   // Show customers' messages in the agent's language
+	TranslateReplies  bool   // Send agents' replies in the customer's language
+}
+
+// TranslationSettingsRequest updates translation settings. Omitted fields keep
+// their current value.
+type TranslationSettingsRequest struct {
+	Provider          *string `json:"provider"`
+	APIKey            *string `json:"api_key"`
+	TranslateIncoming *bool   `json:"translate_incoming"`
+	TranslateReplies  *bool   `json:"translate_replies"`
+}
+
+// MessageTranslation is a message's text in another language
+type MessageTranslation struct {
+	Text           string `json:"text"`
+	Language       string `json:"language"`                  // Language of Text, the agent's
+	SourceLanguage string `json:"source_language,omitempty"` // Language the message was written or sent in
+}
+
+// TranslateMessageRequest translates a message. The language defaults to the agent's.
+type TranslateMessageRequest struct {
+	Language string `json:"language"`
+}
+
+// translationSettings reads the translation settings from organization settings
+func translationSettings(settings models.JSONB) TranslationSettings {
+	var s TranslationSettings
+	raw, ok := settings["translation"].(map[string]interface{})
+	if !ok {
+		return s
+	}
+	s.Provider, _ = raw["provider"].(string)
+	s.APIKey = models.SettingSecret(raw, "api_key")
+	s.TranslateIncoming, _ = raw["translate_incoming"].(bool)
+	s.TranslateReplies, _ = raw["translate_replies"].(bool)
+	return s
+}
+
+// connected reports whether the settings have a provider and its API key
+func (s TranslationSettings) connected() bool {
+	switch translate.Provider(s.Provider) {
+	case translate.ProviderDeepL, translate.ProviderGoogle:
+		return s.APIKey != ""
+	}
+	return false
+}
+
+// translationSettingsResponse is the settings as returned by the API. The API key
+// is never returned, only whether it's set.
+func translationSettingsResponse(s TranslationSettings) map[string]interface{} {
+	return map[string]interface{}{
+		"provider":           s.Provider,
+		"api_key_set":        s.APIKey != "",
+		"connected":          s.connected(),
+		"translate_incoming": s.TranslateIncoming,
+		"translate_replies":  s.TranslateReplies,
+	}
+}
+
+// GetTranslationSettings returns the organization's translation settings
+func (a *App) GetTranslationSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	return r.SendEnvelope(translationSettingsResponse(translationSettings(org.Settings)))
+}
+
+// UpdateTranslationSettings connects or disconnects the organization's translation
+// provider. A provider is only saved once it translates with the API key.
+func (a *App) UpdateTranslationSettings(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req TranslationSettingsRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+	before := orgSettingsAuditSnapshot(&org)
+	s := translationSettings(org.Settings)
+
+	if req.Provider != nil {
+		s.Provider = strings.ToLower(strings.TrimSpace(*req.Provider))
+	}
+	if req.APIKey != nil {
+		s.APIKey = strings.TrimSpace(*req.APIKey)
+	}
+	if req.TranslateIncoming != nil {
+		s.TranslateIncoming = *req.TranslateIncoming
+	}
+	if req.TranslateReplies != nil {
+		s.TranslateReplies = *req.TranslateReplies
+	}
+
+	switch translate.Provider(s.Provider) {
+	case "":
+		s.TranslateIncoming = false
+		s.TranslateReplies = false
+	case translate.ProviderDeepL, translate.ProviderGoogle:
+		if s.APIKey == "" {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "api_key is required", nil, "")
+		}
+		key, err := a.resolveCredential(r.RequestCtx, orgID, s.APIKey)
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "api_key: "+err.Error(), nil, "")
+		}
+		if err := a.translateClient().Check(r.RequestCtx, translate.Provider(s.Provider), key); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Can't translate with the provider: "+err.Error(), nil, "")
+		}
+	default:
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "provider must be deepl or google", nil, "")
+	}
+
+	if org.Settings == nil {
+		org.Settings = models.JSONB{}
+	}
+	section := map[string]interface{}{
+		"provider":           s.Provider,
+		"api_key":            s.APIKey,
+		"translate_incoming": s.TranslateIncoming,
+		"translate_replies":  s.TranslateReplies,
+	}
+	if err := models.EncryptSettingSecrets("translation", section); err != nil {
+		a.Log.Error("Failed to encrypt translation credentials", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	org.Settings["translation"] = section
+	if err := a.DB.Save(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update settings", nil, "")
+	}
+	a.recordOrgSettingsAudit(r, &org, before)
+
+	return r.SendEnvelope(translationSettingsResponse(s))
+}
+
+// TranslateMessage translates a message of a conversation into the agent's
+// language, or the requested one. Translations are cached on the message.
+func (a *App) TranslateMessage(r *fastglue.Request) error {
+	orgID, err := a.getOrgIDFromContext(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+
+	contactID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid contact ID", nil, "")
+	}
+	messageID, err := uuid.Parse(r.RequestCtx.UserValue("message_id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid message ID", nil, "")
+	}
+
+	var req TranslateMessageRequest
+	if body := r.RequestCtx.PostBody(); len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+		}
+	}
+	lang := strings.ToLower(strings.TrimSpace(req.Language))
+	if lang == "" {
+		lang = a.userLanguage(userID)
+	}
+	if !languageCodeRegex.MatchString(lang) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "language must be an ISO 639-1 code, or set in your profile", nil, "")
+	}
+
+	if _, err := a.findReplyContact(orgID, userID, contactID); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Contact not found", nil, "")
+	}
+	var message models.Message
+	if err := a.DB.Where("id = ? AND contact_id = ? AND organization_id = ?", messageID, contactID, orgID).
+		First(&message).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Message not found", nil, "")
+	}
+	if strings.TrimSpace(message.Content) == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Message has no text to translate", nil, "")
+	}
+
+	s, err := a.orgTranslationSettings(orgID)
+	if err != nil || !s.connected() {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Translation is not configured", nil, "")
+	}
+	if t := cachedTranslation(&message, lang); t != nil {
+		return r.SendEnvelope(t)
+	}
+
+	translations, err := a.translateTexts(r.RequestCtx, orgID, s, []string{message.Content}, lang)
+	if err != nil {
+		a.Log.Error("Failed to translate message", "error", err, "message_id", message.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Failed to translate message", nil, "")
+	}
+	a.cacheTranslation(&message, lang, translations[0])
+
+	return r.SendEnvelope(cachedTranslation(&message, lang))
+}
+
+// translateClient returns the client for calls to translation providers
+func (a *App) translateClient() *translate.Client {
+	if a.Translator != nil {
+		return a.Translator
+	}
+	client := translate.New(a.Log)
+	client.HTTPClient = a.httpClient(config.OutboundTranslation, translate.DefaultTimeout)
+	return client
+}
+
+// orgTranslationSettings reads an organization's translation settings
+func (a *App) orgTranslationSettings(orgID uuid.UUID) (TranslationSettings, error) {
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", orgID).First(&org).Error; err != nil {
+		return TranslationSettings{}, err
+	}
+	return translationSettings(org.Settings), nil
+}
+
+// translateTexts translates texts with the settings' provider, the API key's secret
+// reference resolved
+func (a *App) translateTexts(ctx context.Context, orgID uuid.UUID, s TranslationSettings, texts []string, lang string) ([]translate.Translation, error) {
+	key, err := a.resolveCredential(ctx, orgID, s.APIKey)
+	if err != nil {
+		return nil, err
+	}
+	return a.translateClient().Translate(ctx, translate.Provider(s.Provider), key, texts, lang)
+}
+
+// userLanguage returns the language a user reads and writes messages in, empty
+// when not set
+func (a *App) userLanguage(userID uuid.UUID) string {
+	var user models.User
+	if err := a.DB.Select("id", "settings").Where("id = ?", userID).First(&user).Error; err != nil {
+		return ""
+	}
+	lang, _ := user.Settings[userLanguageSetting].(string)
+	return lang
+}
+
+// cachedTranslation returns a message's translation into lang, nil when it has none
+func cachedTranslation(m *models.Message, lang string) *MessageTranslation {
+	translations, _ := m.Metadata[metadataTranslations].(map[string]interface{})
+	text, ok := translations[lang].(string)
+	if !ok {
+		return nil
+	}
+	t := &MessageTranslation{Text: text, Language: lang}
+	t.SourceLanguage, _ = m.Metadata[metadataSourceLanguage].(string)
+	return t
+}
+
+// cacheTranslation stores a message's translation into lang on the message
+func (a *App) cacheTranslation(m *models.Message, lang string, t translate.Translation) {
+	if m.Metadata == nil {
+		m.Metadata = models.JSONB{}
+	}
+	translations, _ := m.Metadata[metadataTranslations].(map[string]interface{})
+	if translations == nil {
+		translations = map[string]interface{}{}
+	}
+	translations[lang] = t.Text
+	m.Metadata[metadataTranslations] = translations
+	if t.SourceLanguage != "" {
+		m.Metadata[metadataSourceLanguage] = t.SourceLanguage
+	}
+	if err := a.DB.Model(m).Update("metadata", m.Metadata).Error; err != nil {
+		a.Log.Error("Failed to cache message translation", "error", err, "message_id", m.ID)
+	}
+}
+
+// needsTranslation reports whether an incoming message is in another language than
+// lang. The language is detected from the text, or taken to be the contact's.
+func needsTranslation(m *models.Message, contactLanguage, lang string) bool {
+	if m.Direction != models.DirectionIncoming || strings.TrimSpace(m.Content) == "" {
+		return false
+	}
+	switch m.MessageType {
+	case models.MessageTypeText, models.MessageTypeImage, models.MessageTypeVideo, models.MessageTypeDocument:
+	default:
+		return false
+	}
+	source := detectLanguage(m.Content)
+	if source == "" {
+		source = contactLanguage
+	}
+	return source != "" && source != lang
+}
+
+// attachMessageTranslations adds the translations of messages into the agent's
+// language to their responses. Incoming messages not translated yet are translated
+// when the organization translates them; failures only leave them untranslated.
+func (a *App) attachMessageTranslations(ctx context.Context, orgID, userID uuid.UUID, contact *models.Contact, messages []models.Message, response []MessageResponse) {
+	lang := a.userLanguage(userID)
+	if lang == "" {
+		return
+	}
+
+	var pending []int
+	for i := range messages {
+		if t := cachedTranslation(&messages[i], lang); t != nil {
+			response[i].Translation = t
+		} else if needsTranslation(&messages[i], contact.Language, lang) {
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	s, err := a.orgTranslationSettings(orgID)
+	if err != nil || !s.connected() || !s.TranslateIncoming {
+		return
+	}
+	if len(pending) > translate.MaxTexts {
+		pending = pending[len(pending)-translate.MaxTexts:]
+	}
+	texts := make([]string, len(pending))
+	for j, i := range pending {
+		texts[j] = messages[i].Content
+	}
+	translations, err := a.translateTexts(ctx, orgID, s, texts, lang)
+	if err != nil {
+		a.Log.Error("Failed to translate messages", "error", err, "contact_id", contact.ID)
+		return
+	}
+	for j, i := range pending {
+		a.cacheTranslation(&messages[i], lang, translations[j])
+		response[i].Translation = cachedTranslation(&messages[i], lang)
+	}
+}
+
+// translateReply translates an agent's reply into the contact's language. It
+// returns the text to send and the metadata that keeps the agent's text, or the
+// reply unchanged when it needn't be translated.
+func (a *App) translateReply(ctx context.Context, orgID, userID uuid.UUID, contact *models.Contact, text string, requested *bool) (string, models.JSONB, error) {
+	if strings.TrimSpace(text) == "" || contact.Language == "" || (requested != nil && !*requested) {
+		return text, nil, nil
+	}
+	s, err := a.orgTranslationSettings(orgID)
+	if err != nil || !s.connected() {
+		if requested != nil {
+			return "", nil, fmt.Errorf("translation is not configured")
+		}
+		return text, nil, nil
+	}
+	if requested == nil && !s.TranslateReplies {
+		return text, nil, nil
+	}
+	lang := a.userLanguage(userID)
+	if lang == contact.Language {
+		return text, nil, nil
+	}
+
+	translations, err := a.translateTexts(ctx, orgID, s, []string{text}, contact.Language)
+	if err != nil {
+		return "", nil, err
+	}
+	t := translations[0]
+	if lang == "" {
+		lang = t.SourceLanguage
+	}
+	if lang == "" || lang == contact.Language {
+		return text, nil, nil
+	}
+	return t.Text, models.JSONB{
+		metadataTranslations:   map[string]interface{}{lang: text},
+		metadataSourceLanguage: contact.Language,
+		metadataTranslatedFrom: lang,
+	}, nil
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/translate"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslationSettings_Connected(t *testing.T) {
+	assert.False(t, TranslationSettings{}.connected())
+	assert.False(t, TranslationSettings{Provider: "deepl"}.connected())
+	assert.True(t, TranslationSettings{Provider: "deepl", APIKey: "key"}.connected())
+	assert.True(t, TranslationSettings{Provider: "google", APIKey: "key"}.connected())
+	assert.False(t, TranslationSettings{Provider: "bing", APIKey: "key"}.connected())
+
+	s := translationSettings(models.JSONB{"translation": map[string]interface{}{
+		"provider": "google", "api_key": "key", "translate_incoming": true,
+	}})
+	resp := translationSettingsResponse(s)
+	assert.Equal(t, true, resp["api_key_set"])
+	assert.Equal(t, true, resp["translate_incoming"])
+	assert.Equal(t, false, resp["translate_replies"])
+	assert.NotContains(t, resp, "api_key")
+}
+
+func TestNeedsTranslation(t *testing.T) {
+	incoming := func(content string) *models.Message {
+		return &models.Message{Direction: models.DirectionIncoming, MessageType: models.MessageTypeText, Content: content}
+	}
+	assert.True(t, needsTranslation(incoming("Hola, ¿dónde está mi pedido?"), "", "en"))
+	assert.False(t, needsTranslation(incoming("Hello, where is my order?"), "es", "en"))
+	// Too short to detect, so the contact's language is used
+	assert.True(t, needsTranslation(incoming("ok"), "es", "en"))
+	assert.False(t, needsTranslation(incoming("ok"), "", "en"))
+	assert.False(t, needsTranslation(incoming(""), "es", "en"))
+
+	outgoing := incoming("Hola, ¿dónde está mi pedido?")
+	outgoing.Direction = models.DirectionOutgoing
+	assert.False(t, needsTranslation(outgoing, "es", "en"))
+}
+
+func TestMessageTranslations(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var body struct {
+			Text       []string `json:"text"`
+			TargetLang string   `json:"target_lang"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		switch body.TargetLang {
+		case "EN-US":
+			assert.Equal(t, []string{"Hola, ¿dónde está mi pedido?"}, body.Text)
+			_, _ = w.Write([]byte(`{"translations":[{"detected_source_language":"ES","text":"Hi, where is my order?"}]}`))
+		case "ES":
+			assert.Equal(t, []string{"It ships today"}, body.Text)
+			_, _ = w.Write([]byte(`{"translations":[{"detected_source_language":"EN","text":"Se envía hoy"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	app := &App{
+		Config:     &config.Config{},
+		DB:         testutil.SetupTestDB(t),
+		Log:        testutil.NopLogger(),
+		Translator: translate.NewWithBaseURL(testutil.NopLogger(), server.URL),
+	}
+	seq, contact, _ := sequenceTestContact(t, app, nil)
+	orgID := seq.OrganizationID
+	require.NoError(t, app.DB.Model(&models.Organization{}).Where("id = ?", orgID).Update("settings", models.JSONB{
+		"translation": map[string]interface{}{
+			"provider": "deepl", "api_key": "dl-key", "translate_incoming": true, "translate_replies": true,
+		},
+	}).Error)
+	contact.Language = "es"
+	agent := &models.User{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: orgID,
+		Email:          "agent-" + uuid.New().String()[:8] + "@example.com",
+		Settings:       models.JSONB{"language": "en"},
+	}
+	require.NoError(t, app.DB.Create(agent).Error)
+
+	messages := []models.Message{
+		{BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: orgID, ContactID: contact.ID, WhatsAppAccount: contact.WhatsAppAccount,
+			Direction: models.DirectionIncoming, MessageType: models.MessageTypeText, Content: "Hola, ¿dónde está mi pedido?"},
+		{BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: orgID, ContactID: contact.ID, WhatsAppAccount: contact.WhatsAppAccount,
+			Direction: models.DirectionIncoming, MessageType: models.MessageTypeText, Content: "Thanks, bye"},
+	}
+	require.NoError(t, app.DB.Create(&messages).Error)
+
+	response := app.buildMessagesResponse(messages)
+	app.attachMessageTranslations(testutil.TestContext(t), orgID, agent.ID, contact, messages, response)
+	require.NotNil(t, response[0].Translation)
+	assert.Equal(t, MessageTranslation{Text: "Hi, where is my order?", Language: "en", SourceLanguage: "es"}, *response[0].Translation)
+	assert.Nil(t, response[1].Translation)
+
+	// The translation is cached on the message
+	var stored models.Message
+	require.NoError(t, app.DB.Where("id = ?", messages[0].ID).First(&stored).Error)
+	assert.Equal(t, "Hi, where is my order?", cachedTranslation(&stored, "en").Text)
+	app.attachMessageTranslations(testutil.TestContext(t), orgID, agent.ID, contact, []models.Message{stored}, response[:1])
+	assert.Equal(t, 1, requests)
+
+	// Replies are sent in the contact's language, keeping the agent's text
+	text, metadata, err := app.translateReply(testutil.TestContext(t), orgID, agent.ID, contact, "It ships today", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Se envía hoy", text)
+	assert.Equal(t, "en", metadata[metadataTranslatedFrom])
+	assert.Equal(t, "It ships today", cachedTranslation(&models.Message{Metadata: metadata}, "en").Text)
+
+	// Agents can send a reply as written
+	skip := false
+	text, metadata, err = app.translateReply(testutil.TestContext(t), orgID, agent.ID, contact, "Gracias", &skip)
+	require.NoError(t, err)
+	assert.Equal(t, "Gracias", text)
+	assert.Nil(t, metadata)
+	assert.Equal(t, 2, requests)
+}
+
+func TestTranslationSettings_Encrypted(t *testing.T) {
+	testutil.EnableEncryption(t)
+
+	section := map[string]interface{}{"api_key": "deepl-key-123"}
+	require.NoError(t, models.EncryptSettingSecrets("translation", section))
+	assert.NotEqual(t, "deepl-key-123", section["api_key"])
+	s := translationSettings(models.JSONB{"translation": section})
+	assert.Equal(t, "deepl-key-123", s.APIKey)
+}
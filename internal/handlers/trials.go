@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// errTrialExpired is returned for sends by organizations whose trial has ended
+var errTrialExpired = errors.New("Your trial has ended. Select a plan to continue.")
+
+// trialExpired reports whether a trial ending at endsAt is over at now
+func trialExpired(endsAt *time.Time, now time.Time) bool {
+	return endsAt != nil && !now.Before(*endsAt)
+}
+
+// trialDaysLeft returns the number of started days until a trial ends
+func trialDaysLeft(endsAt, now time.Time) int {
+	return int(math.Ceil(endsAt.Sub(now).Hours() / 24))
+}
+
+// dueTrialReminder returns the reminder to send with daysLeft days left: the smallest
+// reminder day that has been reached and is earlier than the last one sent. 0 means none.
+func dueTrialReminder(daysLeft int, schedule []int, lastSent int) int {
+	due := 0
+	for _, days := range schedule {
+		if days <= 0 || daysLeft > days || (lastSent > 0 && days >= lastSent) {
+			continue
+		}
+		if due == 0 || days < due {
+			due = days
+		}
+	}
+	return due
+}
+
+// IsTrialExpired reports whether an organization's trial has ended without a plan being
+// selected. Such organizations are read-only.
+func (a *App) IsTrialExpired(orgID uuid.UUID) bool {
+	endsAt, err := a.getOrgTrialEndsCached(orgID)
+	if err != nil {
+		a.Log.Error("Failed to load organization trial", "error", err, "org_id", orgID)
+		return false
+	}
+	return trialExpired(endsAt, time.Now())
+}
+
+// checkTrialActive returns errTrialExpired when the organization's trial has ended. API
+// requests are refused by middleware; this covers sends from the chatbot, automations
+// and schedulers.
+func (a *App) checkTrialActive(orgID uuid.UUID) error {
+	if a.IsTrialExpired(orgID) {
+		return errTrialExpired
+	}
+	return nil
+}
+
+// startTrial puts a new organization on a trial when trials are configured
+func (a *App) startTrial(org *models.Organization, now time.Time) {
+	cfg := a.CurrentConfig()
+	if cfg == nil || cfg.Billing.TrialDays <= 0 {
+		return
+	}
+	endsAt := now.AddDate(0, 0, cfg.Billing.TrialDays)
+	org.TrialStartedAt = &now
+	org.TrialEndsAt = &endsAt
+}
+
+// endTrial takes an organization off its trial, reactivating it if the trial had expired
+func (a *App) endTrial(orgID uuid.UUID) error {
+	if err := a.DB.Model(&models.Organization{}).Where("id = ?", orgID).Updates(map[string]interface{}{
+		"trial_ends_at":            nil,
+		"trial_reminder_days":      0,
+		"trial_expiry_notified_at": nil,
+	}).Error; err != nil {
+		return err
+	}
+	a.InvalidateOrgTrialCache(orgID)
+	return nil
+}
+
+// SetOrganizationTrial starts, extends or ends an organization's trial (super admin only)
+func (a *App) SetOrganizationTrial(r *fastglue.Request) error {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.IsSuperAdmin(userID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only super admins can change organization trials", nil, "")
+	}
+
+	orgID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid organization ID", nil, "")
+	}
+
+	var req struct {
+		EndsAt *time.Time `json:"ends_at"` // null ends the trial
+	}
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Where("id = ?", orgID).First(&org).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	if req.EndsAt == nil {
+		if err := a.endTrial(orgID); err != nil {
+			a.Log.Error("Failed to end trial", "error", err)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update trial", nil, "")
+		}
+		a.Log.Info("Organization trial ended", "org_id", orgID, "changed_by", userID)
+		return r.SendEnvelope(map[string]interface{}{
+			"organization_id": orgID,
+			"trial_ends_at":   nil,
+		})
+	}
+
+	updates := map[string]interface{}{
+		"trial_ends_at":            *req.EndsAt,
+		"trial_reminder_days":      0,
+		"trial_expiry_notified_at": nil,
+	}
+	if org.TrialStartedAt == nil {
+		updates["trial_started_at"] = time.Now()
+	}
+	if err := a.DB.Model(&org).Updates(updates).Error; err != nil {
+		a.Log.Error("Failed to update trial", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update trial", nil, "")
+	}
+	a.InvalidateOrgTrialCache(orgID)
+
+	a.Log.Info("Organization trial changed", "org_id", orgID, "ends_at", req.EndsAt, "changed_by", userID)
+
+	return r.SendEnvelope(map[string]interface{}{
+		"organization_id": orgID,
+		"trial_ends_at":   req.EndsAt,
+	})
+}
+
+// TrialProcessor emails reminders before trials end, and pauses campaigns and notifies
+// admins when they expire
+type TrialProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewTrialProcessor creates a new trial processor
+func NewTrialProcessor(app *App, interval time.Duration) *TrialProcessor {
+	return &TrialProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the trial processing loop
+func (p *TrialProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Trial processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Trial processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Trial processor stopped")
+			return
+		case <-ticker.C:
+			p.processTrials()
+		}
+	}
+}
+
+// Stop stops the trial processor
+func (p *TrialProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// processTrials sends due reminders and handles newly expired trials
+func (p *TrialProcessor) processTrials() {
+	var orgs []models.Organization
+	if err := p.app.DB.Where("trial_ends_at IS NOT NULL AND trial_expiry_notified_at IS NULL").Find(&orgs).Error; err != nil {
+		p.app.Log.Error("Failed to load organizations on trial", "error", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range orgs {
+		org := &orgs[i]
+		if trialExpired(org.TrialEndsAt, now) {
+			p.expireTrial(org, now)
+			continue
+		}
+
+		due := dueTrialReminder(trialDaysLeft(*org.TrialEndsAt, now), p.app.CurrentConfig().Billing.TrialReminderDays, org.TrialReminderDays)
+		if due == 0 {
+			continue
+		}
+		// Claim the reminder so concurrent instances send it once
+		result := p.app.DB.Model(&models.Organization{}).
+			Where("id = ? AND trial_reminder_days = ?", org.ID, org.TrialReminderDays).
+			Update("trial_reminder_days", due)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		subject := fmt.Sprintf("Your trial ends in %d days", due)
+		if due == 1 {
+			subject = "Your trial ends tomorrow"
+		}
+		body := fmt.Sprintf("The trial of %s ends on %s. Select a plan to keep sending messages "+
+			"and running campaigns. After the trial, your data stays available but sending is disabled.\n",
+			org.Name, org.TrialEndsAt.UTC().Format("January 2, 2006"))
+		p.sendTrialEmail(org, subject, body)
+	}
+}
+
+// expireTrial pauses the organization's campaigns and tells its admins the trial ended
+func (p *TrialProcessor) expireTrial(org *models.Organization, now time.Time) {
+	result := p.app.DB.Model(&models.Organization{}).
+		Where("id = ? AND trial_expiry_notified_at IS NULL", org.ID).
+		Update("trial_expiry_notified_at", now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	p.app.Log.Info("Organization trial expired", "org_id", org.ID)
+	p.app.InvalidateOrgTrialCache(org.ID)
+	p.app.pauseRunningCampaigns(org.ID, errTrialExpired.Error())
+
+	body := fmt.Sprintf("The trial of %s has ended. Your data is still available, but sending messages "+
+		"and other changes are disabled until a plan is selected.\n", org.Name)
+	p.sendTrialEmail(org, "Your trial has ended", body)
+}
+
+// sendTrialEmail emails the organization's admins
+func (p *TrialProcessor) sendTrialEmail(org *models.Organization, subject, body string) {
+	if !p.app.emailEnabled() {
+		return
+	}
+	if err := p.app.sendEmail(p.app.orgAdminEmails(org.ID), subject, body); err != nil {
+		p.app.Log.Error("Failed to send trial email", "error", err, "org_id", org.ID)
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrialExpired(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	assert.False(t, trialExpired(nil, now), "organizations without a trial never expire")
+	assert.False(t, trialExpired(&future, now))
+	assert.True(t, trialExpired(&past, now))
+	assert.True(t, trialExpired(&now, now))
+}
+
+func TestTrialDaysLeft(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 7, trialDaysLeft(now.AddDate(0, 0, 7), now))
+	assert.Equal(t, 1, trialDaysLeft(now.Add(time.Hour), now))
+	assert.Equal(t, 2, trialDaysLeft(now.Add(25*time.Hour), now))
+}
+
+func TestDueTrialReminder(t *testing.T) {
+	schedule := []int{7, 3, 1}
+
+	tests := []struct {
+		name     string
+		daysLeft int
+		lastSent int
+		want     int
+	}{
+		{name: "before first reminder", daysLeft: 10, want: 0},
+		{name: "first reminder", daysLeft: 7, want: 7},
+		{name: "first reminder already sent", daysLeft: 6, lastSent: 7, want: 0},
+		{name: "second reminder", daysLeft: 3, lastSent: 7, want: 3},
+		{name: "missed reminders send only the latest", daysLeft: 1, lastSent: 7, want: 1},
+		{name: "trial started with few days left", daysLeft: 2, want: 3},
+		{name: "last reminder sent", daysLeft: 1, lastSent: 1, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, dueTrialReminder(tt.daysLeft, schedule, tt.lastSent))
+		})
+	}
+}
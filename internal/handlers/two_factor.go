@@ -0,0 +1,530 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/middleware"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpPeriod = 30 // seconds
+	totpDigits = 6
+	totpSkew   = 1 // Steps accepted either side of now, for clock drift
+
+	twoFactorChallengeTTL      = 5 * time.Minute
+	twoFactorSetupTTL          = 10 * time.Minute
+	twoFactorMaxAttempts       = 5
+	twoFactorBackupCodeCount   = 10
+	twoFactorBackupCodeLetters = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// TwoFactorChallenge is stored in Redis between a password login and its second factor
+type TwoFactorChallenge struct {
+	UserID uuid.UUID `json:"user_id"`
+	Setup  bool      `json:"setup"` // The organization requires 2FA and the user hasn't enrolled yet
+}
+
+// TwoFactorChallengeResponse is returned by login in place of tokens when a second factor is needed
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	SetupRequired     bool   `json:"setup_required"`
+	TwoFactorToken    string `json:"two_factor_token"`
+}
+
+// TwoFactorSetupResponse holds a new TOTP secret for the user's authenticator app
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"` // Encode as a QR code for authenticator apps to scan
+}
+
+// TwoFactorAuthResponse is the login response after the second factor, with backup codes
+// when the user enrolled during login
+type TwoFactorAuthResponse struct {
+	AuthResponse
+	BackupCodes []string `json:"backup_codes,omitempty"`
+}
+
+// TwoFactorVerifyRequest completes a login with a TOTP or backup code
+type TwoFactorVerifyRequest struct {
+	TwoFactorToken string `json:"two_factor_token"`
+	Code           string `json:"code"`
+}
+
+// TwoFactorCodeRequest confirms a change to the current user's 2FA with a code
+type TwoFactorCodeRequest struct {
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+// twoFactorRequired reports whether the organization requires 2FA for all members
+func twoFactorRequired(org *models.Organization) bool {
+	required, _ := org.Settings["require_2fa"].(bool)
+	return required
+}
+
+// generateTOTPSecret returns a random 160-bit base32 secret, as RFC 4226 recommends
+func generateTOTPSecret() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+}
+
+// totpCode returns the RFC 6238 code of a secret for a time step
+func totpCode(secret string, step int64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// validateTOTP checks a code against the secret at now, allowing for clock drift. Steps
+// at or before lastStep were already used. It returns the code's step when valid.
+func validateTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURL returns the otpauth:// URL authenticator apps read from a QR code
+func (a *App) totpURL(email, secret string) string {
+	issuer := a.CurrentConfig().App.Name
+	if issuer == "" {
+		issuer = "Whatomate"
+	}
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return fmt.Sprintf("otpauth://totp/%s:%s?%s", url.PathEscape(issuer), url.PathEscape(email), params.Encode())
+}
+
+// generateBackupCodes returns new backup codes and their hashes for storage
+func generateBackupCodes() ([]string, models.StringArray) {
+	codes := make([]string, twoFactorBackupCodeCount)
+	hashes := make(models.StringArray, twoFactorBackupCodeCount)
+	for i := range codes {
+		b := make([]byte, 8)
+		_, _ = rand.Read(b)
+		for j := range b {
+			b[j] = twoFactorBackupCodeLetters[int(b[j])%len(twoFactorBackupCodeLetters)]
+		}
+		codes[i] = string(b[:4]) + "-" + string(b[4:])
+		hashes[i] = hashBackupCode(codes[i])
+	}
+	return codes, hashes
+}
+
+func hashBackupCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyTwoFactorCode checks a TOTP or backup code for a user with 2FA enabled. Accepted
+// TOTP steps and backup codes can't be used again.
+func (a *App) verifyTwoFactorCode(user *models.User, code string) bool {
+	if step, ok := validateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		// The condition stops two requests from both using the same code
+		result := a.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return false
+		}
+		user.TOTPLastStep = step
+		return true
+	}
+
+	hash := hashBackupCode(code)
+	for i, stored := range user.TwoFactorBackupCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) != 1 {
+			continue
+		}
+		remaining := append(models.StringArray{}, user.TwoFactorBackupCodes[:i]...)
+		remaining = append(remaining, user.TwoFactorBackupCodes[i+1:]...)
+		// The condition stops two requests from both using the same code
+		result := a.DB.Model(&models.User{}).
+			Where("id = ? AND two_factor_backup_codes = ?", user.ID, user.TwoFactorBackupCodes).
+			Update("two_factor_backup_codes", remaining)
+		if result.Error != nil {
+			a.Log.Error("Failed to consume backup code", "error", result.Error, "user_id", user.ID)
+			return false
+		}
+		if result.RowsAffected != 1 {
+			return false
+		}
+		user.TwoFactorBackupCodes = remaining
+		a.Log.Info("Backup code used", "user_id", user.ID, "remaining", len(remaining))
+		return true
+	}
+	return false
+}
+
+// enableTwoFactor turns on 2FA with the secret and returns the user's backup codes
+func (a *App) enableTwoFactor(user *models.User, secret string, step int64) ([]string, error) {
+	codes, hashes := generateBackupCodes()
+	// Map updates skip the field's serializer, so the secret is encrypted here
+	encrypted, err := models.EncryptSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.DB.Model(user).Updates(map[string]interface{}{
+		"two_factor_enabled":      true,
+		"totp_secret":             encrypted,
+		"totp_last_step":          step,
+		"two_factor_backup_codes": hashes,
+	}).Error; err != nil {
+		return nil, err
+	}
+	user.TwoFactorEnabled = true
+	user.TOTPSecret = secret
+	user.TOTPLastStep = step
+	user.TwoFactorBackupCodes = hashes
+	return codes, nil
+}
+
+// sendTwoFactorChallenge responds to a password login that still needs a second factor
+func (a *App) sendTwoFactorChallenge(r *fastglue.Request, user *models.User, setup bool) error {
+	token := generateRandomString(43)
+	challenge, _ := json.Marshal(TwoFactorChallenge{UserID: user.ID, Setup: setup})
+	if err := a.Redis.Set(r.RequestCtx, "2fa:challenge:"+token, challenge, twoFactorChallengeTTL).Err(); err != nil {
+		a.Log.Error("Failed to store 2FA challenge", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to start two-factor authentication", nil, "")
+	}
+	return r.SendEnvelope(TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		SetupRequired:     setup,
+		TwoFactorToken:    token,
+	})
+}
+
+// loadTwoFactorChallenge returns the challenge for a token, counting the attempt. Once
+// the attempts run out the challenge is dropped and the user has to log in again.
+func (a *App) loadTwoFactorChallenge(r *fastglue.Request, token string) (*TwoFactorChallenge, error) {
+	if token == "" {
+		return nil, fmt.Errorf("two_factor_token is required")
+	}
+	key := "2fa:challenge:" + token
+	data, err := a.Redis.Get(r.RequestCtx, key).Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("Two-factor session expired. Please log in again")
+	}
+
+	attemptsKey := "2fa:attempts:" + token
+	attempts, _ := a.Redis.Incr(r.RequestCtx, attemptsKey).Result()
+	a.Redis.Expire(r.RequestCtx, attemptsKey, twoFactorChallengeTTL)
+	if attempts > twoFactorMaxAttempts {
+		a.Redis.Del(r.RequestCtx, key, attemptsKey)
+		return nil, fmt.Errorf("Too many attempts. Please log in again")
+	}
+
+	var challenge TwoFactorChallenge
+	if err := json.Unmarshal(data, &challenge); err != nil {
+		return nil, fmt.Errorf("Two-factor session expired. Please log in again")
+	}
+	return &challenge, nil
+}
+
+// SetupTwoFactorLogin creates a TOTP secret for a user who has to enroll before logging in
+func (a *App) SetupTwoFactorLogin(r *fastglue.Request) error {
+	var req TwoFactorVerifyRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	challenge, err := a.loadTwoFactorChallenge(r, req.TwoFactorToken)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, err.Error(), nil, "")
+	}
+	if !challenge.Setup {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Two-factor authentication is already set up", nil, "")
+	}
+
+	var user models.User
+	if err := a.DB.Where("id = ?", challenge.UserID).First(&user).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "User not found", nil, "")
+	}
+	return a.sendTwoFactorSetup(r, &user)
+}
+
+// VerifyTwoFactorLogin completes a login with a TOTP or backup code, enrolling users
+// who had to set up 2FA first
+func (a *App) VerifyTwoFactorLogin(r *fastglue.Request) error {
+	var req TwoFactorVerifyRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	challenge, err := a.loadTwoFactorChallenge(r, req.TwoFactorToken)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, err.Error(), nil, "")
+	}
+
+	var user models.User
+	if err := a.DB.Preload("Role").Where("id = ?", challenge.UserID).First(&user).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "User not found", nil, "")
+	}
+	if !user.IsActive {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Account is disabled", nil, "")
+	}
+	clientIP := middleware.GetClientIP(r).String()
+	if lockedFor := a.loginLockedFor(r.RequestCtx, user.Email, clientIP); lockedFor > 0 {
+		return sendLoginLocked(r, lockedFor)
+	}
+
+	var backupCodes []string
+	if challenge.Setup && !user.TwoFactorEnabled {
+		secret, err := a.Redis.Get(r.RequestCtx, "2fa:setup:"+user.ID.String()).Result()
+		if err != nil {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Set up your authenticator app first", nil, "")
+		}
+		step, ok := validateTOTP(secret, req.Code, time.Now(), 0)
+		if !ok {
+			a.recordLoginFailure(r.RequestCtx, user.Email, clientIP)
+			return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Invalid code", nil, "")
+		}
+		if backupCodes, err = a.enableTwoFactor(&user, secret, step); err != nil {
+			a.Log.Error("Failed to enable 2FA", "error", err, "user_id", user.ID)
+			return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to enable two-factor authentication", nil, "")
+		}
+		a.Redis.Del(r.RequestCtx, "2fa:setup:"+user.ID.String())
+	} else if !a.verifyTwoFactorCode(&user, req.Code) {
+		a.recordLoginFailure(r.RequestCtx, user.Email, clientIP)
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Invalid code", nil, "")
+	}
+
+	a.Redis.Del(r.RequestCtx, "2fa:challenge:"+req.TwoFactorToken, "2fa:attempts:"+req.TwoFactorToken)
+	a.clearLoginFailures(r.RequestCtx, user.Email)
+
+	a.loadUserPermissions(&user)
+	accessToken, refreshToken, err := a.generateTokenPair(&user)
+	if err != nil {
+		a.Log.Error("Failed to generate tokens", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to generate token", nil, "")
+	}
+
+	return r.SendEnvelope(TwoFactorAuthResponse{
+		AuthResponse: AuthResponse{
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			ExpiresIn:    a.CurrentConfig().JWT.AccessExpiryMins * 60,
+			User:         user,
+		},
+		BackupCodes: backupCodes,
+	})
+}
+
+// sendTwoFactorSetup stores a pending TOTP secret for the user and returns it
+func (a *App) sendTwoFactorSetup(r *fastglue.Request, user *models.User) error {
+	secret := generateTOTPSecret()
+	if err := a.Redis.Set(r.RequestCtx, "2fa:setup:"+user.ID.String(), secret, twoFactorSetupTTL).Err(); err != nil {
+		a.Log.Error("Failed to store 2FA setup", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to set up two-factor authentication", nil, "")
+	}
+	return r.SendEnvelope(TwoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURL: a.totpURL(user.Email, secret),
+	})
+}
+
+// currentUser loads the user making the request
+func (a *App) currentUser(r *fastglue.Request) (*models.User, error) {
+	userID, ok := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !ok {
+		return nil, fmt.Errorf("unauthorized")
+	}
+	var user models.User
+	if err := a.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetupTwoFactor starts 2FA enrollment for the current user
+func (a *App) SetupTwoFactor(r *fastglue.Request) error {
+	user, err := a.currentUser(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	if user.TwoFactorEnabled {
+		return r.SendErrorEnvelope(fasthttp.StatusConflict, "Two-factor authentication is already enabled", nil, "")
+	}
+	return a.sendTwoFactorSetup(r, user)
+}
+
+// EnableTwoFactor confirms enrollment with a code from the authenticator app and returns backup codes
+func (a *App) EnableTwoFactor(r *fastglue.Request) error {
+	user, err := a.currentUser(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	if user.TwoFactorEnabled {
+		return r.SendErrorEnvelope(fasthttp.StatusConflict, "Two-factor authentication is already enabled", nil, "")
+	}
+
+	var req TwoFactorCodeRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	secret, err := a.Redis.Get(r.RequestCtx, "2fa:setup:"+user.ID.String()).Result()
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Setup expired. Start two-factor setup again", nil, "")
+	}
+	step, ok := validateTOTP(secret, req.Code, time.Now(), 0)
+	if !ok {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid code", nil, "")
+	}
+
+	codes, err := a.enableTwoFactor(user, secret, step)
+	if err != nil {
+		a.Log.Error("Failed to enable 2FA", "error", err, "user_id", user.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to enable two-factor authentication", nil, "")
+	}
+	a.Redis.Del(r.RequestCtx, "2fa:setup:"+user.ID.String())
+
+	return r.SendEnvelope(map[string]interface{}{
+		"message":      "Two-factor authentication enabled",
+		"backup_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns off 2FA for the current user. It needs their password and a code.
+func (a *App) DisableTwoFactor(r *fastglue.Request) error {
+	user, err := a.currentUser(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	if !user.TwoFactorEnabled {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Two-factor authentication isn't enabled", nil, "")
+	}
+
+	var org models.Organization
+	if err := a.DB.Select("id", "settings").Where("id = ?", user.OrganizationID).First(&org).Error; err == nil && twoFactorRequired(&org) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Your organization requires two-factor authentication", nil, "")
+	}
+
+	var req TwoFactorCodeRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Password is incorrect", nil, "")
+	}
+	if !a.verifyTwoFactorCode(user, req.Code) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid code", nil, "")
+	}
+
+	if err := a.DB.Model(user).Updates(map[string]interface{}{
+		"two_factor_enabled":      false,
+		"totp_secret":             "",
+		"totp_last_step":          0,
+		"two_factor_backup_codes": models.StringArray{},
+	}).Error; err != nil {
+		a.Log.Error("Failed to disable 2FA", "error", err, "user_id", user.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to disable two-factor authentication", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateBackupCodes replaces the current user's backup codes. It needs a code from
+// the authenticator app.
+func (a *App) RegenerateBackupCodes(r *fastglue.Request) error {
+	user, err := a.currentUser(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+	if !user.TwoFactorEnabled {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Two-factor authentication isn't enabled", nil, "")
+	}
+
+	var req TwoFactorCodeRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	step, ok := validateTOTP(user.TOTPSecret, req.Code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid code", nil, "")
+	}
+
+	codes, err := a.replaceBackupCodes(user, step)
+	if errors.Is(err, errTOTPStepUsed) {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid code", nil, "")
+	}
+	if err != nil {
+		a.Log.Error("Failed to regenerate backup codes", "error", err, "user_id", user.ID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to regenerate backup codes", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{"backup_codes": codes})
+}
+
+// errTOTPStepUsed is returned when a TOTP code was used by another request first
+var errTOTPStepUsed = errors.New("code already used")
+
+// replaceBackupCodes gives a user new backup codes, using up the TOTP step of the
+// code that authorized it
+func (a *App) replaceBackupCodes(user *models.User, step int64) ([]string, error) {
+	codes, hashes := generateBackupCodes()
+	// The condition stops two requests from both using the same code
+	result := a.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Updates(map[string]interface{}{
+			"totp_last_step":          step,
+			"two_factor_backup_codes": hashes,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errTOTPStepUsed
+	}
+	user.TOTPLastStep = step
+	user.TwoFactorBackupCodes = hashes
+	return codes, nil
+}
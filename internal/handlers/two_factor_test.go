@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Secret of the RFC 6238 SHA-1 test vectors, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to 6 digits
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		code, err := totpCode(rfc6238Secret, unix/totpPeriod)
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "time %d", unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step := now.Unix() / totpPeriod
+
+	got, ok := validateTOTP(rfc6238Secret, "081804", now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, step, got)
+
+	_, ok = validateTOTP(rfc6238Secret, "081 804", now.Add(totpPeriod*time.Second), 0)
+	assert.True(t, ok, "previous step allowed for clock drift")
+
+	_, ok = validateTOTP(rfc6238Secret, "081804", now.Add(3*totpPeriod*time.Second), 0)
+	assert.False(t, ok, "code too old")
+
+	_, ok = validateTOTP(rfc6238Secret, "081804", now, step)
+	assert.False(t, ok, "code already used")
+
+	_, ok = validateTOTP(rfc6238Secret, "123456", now, 0)
+	assert.False(t, ok)
+}
+
+func TestGenerateBackupCodes(t *testing.T) {
+	codes, hashes := generateBackupCodes()
+	require.Len(t, codes, twoFactorBackupCodeCount)
+	require.Len(t, hashes, twoFactorBackupCodeCount)
+
+	assert.Regexp(t, `^[a-z2-9]{4}-[a-z2-9]{4}$`, codes[0])
+	assert.Equal(t, hashes[0], hashBackupCode(codes[0]))
+	assert.Equal(t, hashes[0], hashBackupCode(" "+codes[0][:4]+codes[0][5:]+" "), "dash and whitespace are optional")
+	assert.NotEqual(t, codes[0], codes[1])
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret := generateTOTPSecret()
+	assert.Len(t, secret, 32)
+	_, err := totpCode(secret, 1)
+	assert.NoError(t, err)
+}
+
+func TestEnableTwoFactor(t *testing.T) {
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger()}
+	testutil.EnableEncryption(t)
+
+	org := &models.Organization{Name: "2FA Test Org", Slug: "2fa-test-" + uuid.New().String()}
+	require.NoError(t, app.DB.Create(org).Error)
+	user := &models.User{
+		OrganizationID: org.ID,
+		Email:          "2fa-test-" + uuid.New().String() + "@example.com",
+		PasswordHash:   "hashed",
+		FullName:       "2FA Test User",
+		IsActive:       true,
+	}
+	require.NoError(t, app.DB.Create(user).Error)
+
+	codes, err := app.enableTwoFactor(user, rfc6238Secret, 0)
+	require.NoError(t, err)
+	require.NotEmpty(t, codes)
+
+	// The secret is stored encrypted and loaded decrypted
+	var stored string
+	require.NoError(t, app.DB.Model(&models.User{}).Where("id = ?", user.ID).Pluck("totp_secret", &stored).Error)
+	assert.True(t, models.IsEncryptedSecret(stored))
+	var loaded models.User
+	require.NoError(t, app.DB.First(&loaded, "id = ?", user.ID).Error)
+	assert.Equal(t, rfc6238Secret, loaded.TOTPSecret)
+
+	// A backup code works once, also for a request that loaded the user before
+	// another used it
+	stale := loaded
+	assert.True(t, app.verifyTwoFactorCode(&loaded, codes[0]))
+	assert.False(t, app.verifyTwoFactorCode(&loaded, codes[0]))
+	assert.False(t, app.verifyTwoFactorCode(&stale, codes[0]))
+	assert.True(t, app.verifyTwoFactorCode(&loaded, codes[1]))
+}
+
+func TestReplaceBackupCodes(t *testing.T) {
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger()}
+	testutil.EnableEncryption(t)
+
+	org := &models.Organization{Name: "2FA Test Org", Slug: "2fa-test-" + uuid.New().String()}
+	require.NoError(t, app.DB.Create(org).Error)
+	user := &models.User{
+		OrganizationID: org.ID,
+		Email:          "2fa-test-" + uuid.New().String() + "@example.com",
+		PasswordHash:   "hashed",
+		FullName:       "2FA Test User",
+		IsActive:       true,
+	}
+	require.NoError(t, app.DB.Create(user).Error)
+	_, err := app.enableTwoFactor(user, rfc6238Secret, 0)
+	require.NoError(t, err)
+
+	// Two requests that loaded the user before either used the code
+	step := time.Now().Unix() / totpPeriod
+	first, second := *user, *user
+
+	codes, err := app.replaceBackupCodes(&first, step)
+	require.NoError(t, err)
+	assert.NotEmpty(t, codes)
+
+	_, err = app.replaceBackupCodes(&second, step)
+	assert.ErrorIs(t, err, errTOTPStepUsed, "the code can't be used twice")
+
+	var stored models.User
+	require.NoError(t, app.DB.First(&stored, "id = ?", user.ID).Error)
+	assert.Equal(t, first.TwoFactorBackupCodes, stored.TwoFactorBackupCodes)
+}
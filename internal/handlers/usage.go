@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// usageMetrics lists the metered resources in display order
+var usageMetrics = []models.UsageMetric{
+	models.UsageMetricMessages,
+	models.UsageMetricCampaignRecipients,
+	models.UsageMetricAICalls,
+	models.UsageMetricStorage,
+	models.UsageMetricAgents,
+}
+
+var usageMetricLabels = map[models.UsageMetric]string{
+	models.UsageMetricMessages:           "Messages",
+	models.UsageMetricCampaignRecipients: "Campaign recipients",
+	models.UsageMetricAICalls:            "AI calls",
+	models.UsageMetricStorage:            "Storage",
+	models.UsageMetricAgents:             "Agents",
+}
+
+// Usage statuses relative to a plan limit
+const (
+	UsageStatusOK           = "ok"
+	UsageStatusWarning      = "warning"
+	UsageStatusLimitReached = "limit_reached"
+)
+
+// UsageMetricResponse represents an organization's usage of one metric
+type UsageMetricResponse struct {
+	Metric  models.UsageMetric `json:"metric"`
+	Label   string             `json:"label"`
+	Period  string             `json:"period"`
+	Used    int64              `json:"used"`
+	Limit   int64              `json:"limit"` // 0 = unlimited
+	Percent float64            `json:"percent"`
+	Status  string             `json:"status"`
+}
+
+// QuotaExceededError is returned when an action would exceed a hard limit of the
+// organization's plan, or one of its fair-use quotas
+type QuotaExceededError struct {
+	Metric    models.UsageMetric
+	Limit     int64
+	Campaigns bool // Limit is the plan's campaign throttle, below the message limit
+	FairUse   bool // Limit is a fair-use quota rather than a plan limit
+	Daily     bool // The fair-use quota is daily rather than monthly
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.FairUse {
+		window := "monthly"
+		if e.Daily {
+			window = "daily"
+		}
+		return fmt.Sprintf("The organization's %s fair-use quota of %d %s is reached", window, e.Limit, fairUseQuotaUnits[e.Metric])
+	}
+	if e.Campaigns {
+		return fmt.Sprintf("Campaign message limit of %s reached for your plan", formatUsageValue(e.Metric, e.Limit))
+	}
+	return fmt.Sprintf("%s limit of %s reached for your plan", usageMetricLabels[e.Metric], formatUsageValue(e.Metric, e.Limit))
+}
+
+// usagePeriod returns the period a metric is counted in at t.
+// Messages, campaign recipients and AI calls reset every calendar month (UTC).
+func usagePeriod(metric models.UsageMetric, t time.Time) string {
+	switch metric {
+	case models.UsageMetricStorage, models.UsageMetricAgents:
+		return models.UsagePeriodTotal
+	}
+	return t.UTC().Format("2006-01")
+}
+
+// quotaLimit returns the limit of a metric in a plan, in the metric's unit. 0 means unlimited.
+func quotaLimit(limits models.PlanLimits, metric models.UsageMetric) int64 {
+	switch metric {
+	case models.UsageMetricMessages:
+		return limits.Messages
+	case models.UsageMetricCampaignRecipients:
+		return limits.CampaignRecipients
+	case models.UsageMetricAICalls:
+		return limits.AICalls
+	case models.UsageMetricStorage:
+		return limits.StorageMB * 1024 * 1024
+	case models.UsageMetricAgents:
+		return limits.Agents
+	}
+	return 0
+}
+
+// usageStatus classifies usage against a limit and the soft limit percentage
+func usageStatus(used, limit int64, softPercent int) string {
+	if limit <= 0 {
+		return UsageStatusOK
+	}
+	if used >= limit {
+		return UsageStatusLimitReached
+	}
+	if softPercent > 0 && used*100 >= limit*int64(softPercent) {
+		return UsageStatusWarning
+	}
+	return UsageStatusOK
+}
+
+// formatUsageValue formats a usage value in the metric's display unit
+func formatUsageValue(metric models.UsageMetric, v int64) string {
+	if metric == models.UsageMetricStorage {
+		return fmt.Sprintf("%.1f MB", float64(v)/(1024*1024))
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+// softLimitPercent returns the usage percentage at which near-limit alerts are sent
+func (a *App) softLimitPercent() int {
+	cfg := a.CurrentConfig()
+	if cfg == nil {
+		return 0
+	}
+	return cfg.Billing.SoftLimitPercent
+}
+
+// currentUsage returns the organization's usage of a metric in the current period.
+// Agents are counted live from active users.
+func (a *App) currentUsage(orgID uuid.UUID, metric models.UsageMetric) int64 {
+	var used int64
+	if metric == models.UsageMetricAgents {
+		a.DB.Model(&models.User{}).Where("organization_id = ? AND is_active = ?", orgID, true).Count(&used)
+		return used
+	}
+	return a.usageIn(orgID, metric, usagePeriod(metric, time.Now()))
+}
+
+// usageIn returns the organization's usage of a metric in a period
+func (a *App) usageIn(orgID uuid.UUID, metric models.UsageMetric, period string) int64 {
+	var used int64
+	a.DB.Model(&models.UsageCounter{}).
+		Where("organization_id = ? AND period = ? AND metric = ?", orgID, period, metric).
+		Pluck("value", &used)
+	return used
+}
+
+// checkQuota returns a QuotaExceededError if using n more of a metric would exceed
+// the hard limit of the organization's plan
+func (a *App) checkQuota(orgID uuid.UUID, metric models.UsageMetric, n int64) error {
+	limit := quotaLimit(a.orgPlanLimits(orgID), metric)
+	if limit == 0 {
+		return nil
+	}
+	if a.currentUsage(orgID, metric)+n > limit {
+		return &QuotaExceededError{Metric: metric, Limit: limit}
+	}
+	return nil
+}
+
+// checkSupportQuota is checkQuota for support and transactional usage: messages sent by
+// agents, the chatbot and the API, and AI calls. Plans that allow overage let it continue
+// past the limit, but not past the organization's fair-use quotas.
+func (a *App) checkSupportQuota(orgID uuid.UUID, metric models.UsageMetric, n int64) error {
+	if err := a.checkFairUseQuota(orgID, metric, n); err != nil {
+		return err
+	}
+	if plan := a.orgPlan(orgID); plan != nil && plan.AllowOverage {
+		return nil
+	}
+	return a.checkQuota(orgID, metric, n)
+}
+
+// campaignMessageLimit returns the message usage at which campaigns are throttled. Plans
+// can throttle campaigns below the message limit to keep headroom for support messages.
+// 0 means unlimited.
+func campaignMessageLimit(plan *models.Plan) int64 {
+	if plan == nil || plan.Limits.Messages == 0 {
+		return 0
+	}
+	if plan.CampaignThrottlePercent > 0 && plan.CampaignThrottlePercent < 100 {
+		return plan.Limits.Messages * int64(plan.CampaignThrottlePercent) / 100
+	}
+	return plan.Limits.Messages
+}
+
+// checkCampaignMessageQuota checks that sending n campaign messages stays within the
+// plan's campaign message limit
+func (a *App) checkCampaignMessageQuota(orgID uuid.UUID, n int64) error {
+	limit := campaignMessageLimit(a.orgPlan(orgID))
+	if limit == 0 {
+		return nil
+	}
+	if a.currentUsage(orgID, models.UsageMetricMessages)+n > limit {
+		return &QuotaExceededError{Metric: models.UsageMetricMessages, Limit: limit, Campaigns: true}
+	}
+	return nil
+}
+
+// recordUsage adds n to the organization's usage of a metric in the current period, and
+// in the current day for metrics with fair-use quotas. Near-limit alerts are sent by the
+// usage alert processor.
+func (a *App) recordUsage(orgID uuid.UUID, metric models.UsageMetric, n int64) {
+	if n == 0 {
+		return
+	}
+	now := time.Now()
+	a.addUsage(orgID, usagePeriod(metric, now), metric, n, now)
+	if isFairUseMetric(metric) {
+		a.addUsage(orgID, usageDay(now), metric, n, now)
+	}
+}
+
+// addUsage adds n to the organization's usage of a metric in a period
+func (a *App) addUsage(orgID uuid.UUID, period string, metric models.UsageMetric, n int64, now time.Time) {
+	counter := models.UsageCounter{
+		OrganizationID: orgID,
+		Period:         period,
+		Metric:         metric,
+		Value:          n,
+	}
+	if err := a.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "organization_id"}, {Name: "period"}, {Name: "metric"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"value":      gorm.Expr("usage_counters.value + ?", n),
+			"updated_at": now,
+		}),
+	}).Create(&counter).Error; err != nil {
+		a.Log.Error("Failed to record usage", "error", err, "org_id", orgID, "metric", metric, "period", period)
+	}
+}
+
+// releaseStorageUsage subtracts n bytes of deleted or archived media from the
+// organization's storage usage. It doesn't go below zero, as media saved before
+// storage was metered was never counted.
+func (a *App) releaseStorageUsage(orgID uuid.UUID, n int64) {
+	if n <= 0 {
+		return
+	}
+	if err := a.DB.Model(&models.UsageCounter{}).
+		Where("organization_id = ? AND period = ? AND metric = ?", orgID, models.UsagePeriodTotal, models.UsageMetricStorage).
+		Updates(map[string]interface{}{
+			"value":      gorm.Expr("GREATEST(value - ?, 0)", n),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		a.Log.Error("Failed to release storage usage", "error", err, "org_id", orgID)
+	}
+}
+
+// syncAgentUsage stores the organization's number of active users so agent
+// usage is covered by near-limit alerts, and meters the month's peak seats
+func (a *App) syncAgentUsage(orgID uuid.UUID) {
+	var count int64
+	a.DB.Model(&models.User{}).Where("organization_id = ? AND is_active = ?", orgID, true).Count(&count)
+	a.meterPeak(orgID, models.MeterUnitSeats, count)
+
+	counter := models.UsageCounter{
+		OrganizationID: orgID,
+		Period:         models.UsagePeriodTotal,
+		Metric:         models.UsageMetricAgents,
+		Value:          count,
+	}
+	if err := a.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "organization_id"}, {Name: "period"}, {Name: "metric"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&counter).Error; err != nil {
+		a.Log.Error("Failed to sync agent usage", "error", err, "org_id", orgID)
+	}
+}
+
+// GetUsage returns the organization's plan, its usage of each metered resource and
+// its fair-use quotas
+func (a *App) GetUsage(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	plan := a.orgPlan(orgID)
+	var limits models.PlanLimits
+	var planName string
+	if plan != nil {
+		limits = plan.Limits
+		planName = plan.Name
+	}
+	softPercent := a.softLimitPercent()
+	now := time.Now()
+
+	metrics := make([]UsageMetricResponse, 0, len(usageMetrics))
+	for _, metric := range usageMetrics {
+		used := a.currentUsage(orgID, metric)
+		limit := quotaLimit(limits, metric)
+
+		resp := UsageMetricResponse{
+			Metric: metric,
+			Label:  usageMetricLabels[metric],
+			Period: usagePeriod(metric, now),
+			Used:   used,
+			Limit:  limit,
+			Status: usageStatus(used, limit, softPercent),
+		}
+		if limit > 0 {
+			resp.Percent = float64(used) * 100 / float64(limit)
+		}
+		metrics = append(metrics, resp)
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"plan":               planName,
+		"features":           orgFeatures(plan),
+		"period":             usagePeriod(models.UsageMetricMessages, now),
+		"soft_limit_percent": softPercent,
+		"metrics":            metrics,
+		"quotas":             a.fairUseUsage(orgID, now),
+	})
+}
+
+// UsageAlertProcessor sends near-limit and limit-reached alerts for usage counters.
+// Usage is recorded by the API and by campaign workers, so alerts are evaluated
+// periodically rather than at the point of use.
+type UsageAlertProcessor struct {
+	app      *App
+	interval time.Duration
+	stopCh   chan struct{}
+}
+
+// NewUsageAlertProcessor creates a new usage alert processor
+func NewUsageAlertProcessor(app *App, interval time.Duration) *UsageAlertProcessor {
+	return &UsageAlertProcessor{
+		app:      app,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start begins the usage alert processing loop
+func (p *UsageAlertProcessor) Start(ctx context.Context) {
+	p.app.Log.Info("Usage alert processor started", "interval", p.interval)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.app.Log.Info("Usage alert processor stopped by context")
+			return
+		case <-p.stopCh:
+			p.app.Log.Info("Usage alert processor stopped")
+			return
+		case <-ticker.C:
+			p.processUsageAlerts()
+		}
+	}
+}
+
+// Stop stops the usage alert processor
+func (p *UsageAlertProcessor) Stop() {
+	close(p.stopCh)
+}
+
+// processUsageAlerts compares the current period's counters with plan limits and
+// fair-use quotas
+func (p *UsageAlertProcessor) processUsageAlerts() {
+	p.processPlanAlerts()
+	p.processQuotaAlerts()
+}
+
+// processPlanAlerts compares the current period's counters with plan limits
+func (p *UsageAlertProcessor) processPlanAlerts() {
+	var planCount int64
+	if err := p.app.DB.Model(&models.Plan{}).Count(&planCount).Error; err != nil || planCount == 0 {
+		return
+	}
+
+	var counters []models.UsageCounter
+	if err := p.app.DB.Where("period IN ?", []string{usagePeriod(models.UsageMetricMessages, time.Now()), models.UsagePeriodTotal}).
+		Find(&counters).Error; err != nil {
+		p.app.Log.Error("Failed to load usage counters", "error", err)
+		return
+	}
+
+	plans := make(map[uuid.UUID]*models.Plan)
+	for i := range counters {
+		counter := &counters[i]
+		plan, ok := plans[counter.OrganizationID]
+		if !ok {
+			plan = p.app.orgPlan(counter.OrganizationID)
+			plans[counter.OrganizationID] = plan
+		}
+
+		var limits models.PlanLimits
+		if plan != nil {
+			limits = plan.Limits
+		}
+		p.processCounter(counter, plan, quotaLimit(limits, counter.Metric))
+		if counter.Metric == models.UsageMetricMessages {
+			p.processCampaignThrottle(counter, plan)
+		}
+	}
+}
+
+// processCounter sends the alert for a counter's usage status once, and re-arms
+// alerts when usage drops back (e.g. after a plan upgrade or removing agents)
+func (p *UsageAlertProcessor) processCounter(counter *models.UsageCounter, plan *models.Plan, limit int64) {
+	status := usageStatus(counter.Value, limit, p.app.softLimitPercent())
+	now := time.Now()
+
+	switch status {
+	case UsageStatusLimitReached:
+		if counter.LimitReachedAt == nil && p.claimAlert(counter, "limit_reached_at", now) {
+			if counter.WarnedAt == nil {
+				p.claimAlert(counter, "warned_at", now)
+			}
+			p.sendUsageAlert(counter, plan, limit, models.WebhookEventUsageLimit)
+		}
+	case UsageStatusWarning:
+		if counter.LimitReachedAt != nil {
+			p.app.DB.Model(counter).Update("limit_reached_at", nil)
+		}
+		if counter.WarnedAt == nil && p.claimAlert(counter, "warned_at", now) {
+			p.sendUsageAlert(counter, plan, limit, models.WebhookEventUsageWarning)
+		}
+	default:
+		if counter.WarnedAt != nil || counter.LimitReachedAt != nil {
+			p.app.DB.Model(counter).Updates(map[string]interface{}{
+				"warned_at":        nil,
+				"limit_reached_at": nil,
+			})
+		}
+	}
+}
+
+// processCampaignThrottle pauses the organization's running campaigns once message usage
+// reaches the plan's campaign limit. Campaigns are checked on every run so ones started
+// since (e.g. by another API instance) are paused too.
+func (p *UsageAlertProcessor) processCampaignThrottle(counter *models.UsageCounter, plan *models.Plan) {
+	limit := campaignMessageLimit(plan)
+	if limit == 0 || counter.Value < limit {
+		if counter.ThrottledAt != nil {
+			p.app.DB.Model(counter).Update("throttled_at", nil)
+		}
+		return
+	}
+
+	reason := (&QuotaExceededError{Metric: models.UsageMetricMessages, Limit: limit, Campaigns: true}).Error()
+	p.app.pauseRunningCampaigns(counter.OrganizationID, reason)
+
+	if counter.ThrottledAt == nil && p.claimAlert(counter, "throttled_at", time.Now()) {
+		p.sendUsageAlert(counter, plan, limit, models.WebhookEventUsageThrottled)
+	}
+}
+
+// claimAlert marks an alert as sent. The update is conditional so concurrent
+// processors send each alert once.
+func (p *UsageAlertProcessor) claimAlert(counter *models.UsageCounter, column string, now time.Time) bool {
+	result := p.app.DB.Model(&models.UsageCounter{}).
+		Where("id = ? AND "+column+" IS NULL", counter.ID).
+		Update(column, now)
+	if result.Error != nil {
+		p.app.Log.Error("Failed to claim usage alert", "error", result.Error, "counter_id", counter.ID)
+		return false
+	}
+	return result.RowsAffected > 0
+}
+
+// sendUsageAlert emits the usage webhook event and emails the organization's admins
+func (p *UsageAlertProcessor) sendUsageAlert(counter *models.UsageCounter, plan *models.Plan, limit int64, event models.WebhookEvent) {
+	percent := float64(counter.Value) * 100 / float64(limit)
+	var planName string
+	allowOverage := false
+	if plan != nil {
+		planName = plan.Name
+		allowOverage = plan.AllowOverage
+	}
+
+	p.app.Log.Info("Usage alert", "org_id", counter.OrganizationID, "metric", counter.Metric, "used", counter.Value, "limit", limit, "event", event)
+
+	p.app.DispatchWebhook(counter.OrganizationID, event, map[string]interface{}{
+		"plan":    planName,
+		"metric":  counter.Metric,
+		"period":  counter.Period,
+		"used":    counter.Value,
+		"limit":   limit,
+		"percent": percent,
+	})
+
+	if !p.app.emailEnabled() {
+		return
+	}
+
+	label := usageMetricLabels[counter.Metric]
+	used := formatUsageValue(counter.Metric, counter.Value)
+	allowed := formatUsageValue(counter.Metric, limit)
+	var subject, body string
+	switch event {
+	case models.WebhookEventUsageThrottled:
+		subject = "Campaigns paused"
+		body = fmt.Sprintf("Your organization has sent %s messages, the campaign limit of the %s plan. "+
+			"Running campaigns have been paused so support messages can continue. "+
+			"Campaigns can be resumed once the limit resets or the plan is upgraded.\n", used, planName)
+	case models.WebhookEventUsageLimit:
+		subject = fmt.Sprintf("%s limit reached", label)
+		body = fmt.Sprintf("Your organization has used %s of %s included in the %s plan (%s). ", used, allowed, planName, label)
+		if allowOverage && (counter.Metric == models.UsageMetricMessages || counter.Metric == models.UsageMetricAICalls) {
+			body += "Support messages and AI responses continue and further usage is billed as overage.\n"
+		} else {
+			body += "Further usage is blocked until the limit resets or the plan is upgraded.\n"
+		}
+	default:
+		subject = fmt.Sprintf("%s usage at %.0f%%", label, percent)
+		body = fmt.Sprintf("Your organization has used %s of %s included in the %s plan (%s).\n", used, allowed, planName, label)
+	}
+
+	if err := p.app.sendEmail(p.app.orgAdminEmails(counter.OrganizationID), subject, body); err != nil {
+		p.app.Log.Error("Failed to send usage alert email", "error", err, "org_id", counter.OrganizationID)
+	}
+}
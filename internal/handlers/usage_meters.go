@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// meterSeatsSQL raises every organization's seat meter for a period to its number
+// of active users
+const meterSeatsSQL = `INSERT INTO usage_meters (id, organization_id, period, unit, quantity, created_at, updated_at)
+	SELECT gen_random_uuid(), organization_id, ?, ?, COUNT(*), NOW(), NOW()
+	FROM users
+	WHERE is_active = true AND deleted_at IS NULL
+	GROUP BY organization_id
+	ON CONFLICT (organization_id, period, unit) DO UPDATE
+	SET quantity = GREATEST(usage_meters.quantity, EXCLUDED.quantity), updated_at = NOW()`
+
+// UsageReportLine is an organization's billable usage of one unit in a month
+type UsageReportLine struct {
+	Unit     string `json:"unit"`
+	Label    string `json:"label"`
+	Quantity int64  `json:"quantity"`
+}
+
+// conversationMeterUnit returns the meter of a billable conversation, or of a billable
+// message on per-message pricing
+func conversationMeterUnit(pricingModel, category string) string {
+	if category == "" {
+		category = "unknown"
+	}
+	if strings.EqualFold(pricingModel, "PMP") {
+		return models.MeterUnitMessagePrefix + category
+	}
+	return models.MeterUnitConversationPrefix + category
+}
+
+// meterUnitLabel returns the display name of a metered unit
+func meterUnitLabel(unit string) string {
+	switch {
+	case unit == models.MeterUnitAIPromptTokens:
+		return "AI prompt tokens"
+	case unit == models.MeterUnitAICompletionTokens:
+		return "AI completion tokens"
+	case unit == models.MeterUnitSeats:
+		return "Seats (peak active users)"
+	case strings.HasPrefix(unit, models.MeterUnitConversationPrefix):
+		return "WhatsApp " + strings.TrimPrefix(unit, models.MeterUnitConversationPrefix) + " conversations"
+	case strings.HasPrefix(unit, models.MeterUnitMessagePrefix):
+		return "WhatsApp " + strings.TrimPrefix(unit, models.MeterUnitMessagePrefix) + " messages"
+	}
+	return unit
+}
+
+// meterUsage adds n units to the organization's meter for the current month
+func (a *App) meterUsage(orgID uuid.UUID, unit string, n int64) {
+	if n <= 0 {
+		return
+	}
+	now := time.Now()
+	meter := models.UsageMeter{
+		OrganizationID: orgID,
+		Period:         now.UTC().Format("2006-01"),
+		Unit:           unit,
+		Quantity:       n,
+	}
+	if err := a.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "organization_id"}, {Name: "period"}, {Name: "unit"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quantity":   gorm.Expr("usage_meters.quantity + ?", n),
+			"updated_at": now,
+		}),
+	}).Create(&meter).Error; err != nil {
+		a.Log.Error("Failed to meter usage", "error", err, "org_id", orgID, "unit", unit)
+	}
+}
+
+// meterPeak raises the organization's meter for the current month to value, keeping
+// the month's highest value
+func (a *App) meterPeak(orgID uuid.UUID, unit string, value int64) {
+	now := time.Now()
+	meter := models.UsageMeter{
+		OrganizationID: orgID,
+		Period:         now.UTC().Format("2006-01"),
+		Unit:           unit,
+		Quantity:       value,
+	}
+	if err := a.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "organization_id"}, {Name: "period"}, {Name: "unit"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quantity":   gorm.Expr("GREATEST(usage_meters.quantity, ?)", value),
+			"updated_at": now,
+		}),
+	}).Create(&meter).Error; err != nil {
+		a.Log.Error("Failed to meter usage", "error", err, "org_id", orgID, "unit", unit)
+	}
+}
+
+// meterSeats samples every organization's active users, so each month's seat meter
+// holds its peak even when no user changes that month
+func (a *App) meterSeats() {
+	period := time.Now().UTC().Format("2006-01")
+	if err := a.DB.Exec(meterSeatsSQL, period, models.MeterUnitSeats).Error; err != nil {
+		a.Log.Error("Failed to meter seats", "error", err)
+	}
+}
+
+// usageReport returns the organization's metered units in a period, by unit
+func (a *App) usageReport(orgID uuid.UUID, period string) ([]UsageReportLine, error) {
+	var meters []models.UsageMeter
+	if err := a.DB.Where("organization_id = ? AND period = ?", orgID, period).
+		Order("unit ASC").
+		Find(&meters).Error; err != nil {
+		return nil, err
+	}
+	lines := make([]UsageReportLine, 0, len(meters))
+	for _, m := range meters {
+		lines = append(lines, UsageReportLine{Unit: m.Unit, Label: meterUnitLabel(m.Unit), Quantity: m.Quantity})
+	}
+	return lines, nil
+}
+
+// usageReportPeriod returns the YYYY-MM period query parameter, defaulting to the current month
+func usageReportPeriod(r *fastglue.Request) (string, error) {
+	period := string(r.RequestCtx.QueryArgs().Peek("period"))
+	if period == "" {
+		return time.Now().UTC().Format("2006-01"), nil
+	}
+	if _, _, err := statementPeriodRange(period); err != nil {
+		return "", err
+	}
+	return period, nil
+}
+
+// GetUsageReport returns the organization's billable units in a month (YYYY-MM)
+func (a *App) GetUsageReport(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	period, err := usageReportPeriod(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid period. Use YYYY-MM", nil, "")
+	}
+
+	lines, err := a.usageReport(orgID, period)
+	if err != nil {
+		a.Log.Error("Failed to load usage report", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load usage report", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"period": period,
+		"units":  lines,
+	})
+}
+
+// ExportUsageReport returns the organization's billable units in a month as CSV
+func (a *App) ExportUsageReport(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	period, err := usageReportPeriod(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid period. Use YYYY-MM", nil, "")
+	}
+
+	lines, err := a.usageReport(orgID, period)
+	if err != nil {
+		a.Log.Error("Failed to load usage report", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load usage report", nil, "")
+	}
+
+	rows := [][]string{{"period", "unit", "label", "quantity"}}
+	for _, line := range lines {
+		rows = append(rows, []string{period, line.Unit, line.Label, strconv.FormatInt(line.Quantity, 10)})
+	}
+	sendCSV(r, fmt.Sprintf("usage-%s.csv", period), rows)
+	return nil
+}
+
+// ExportAllUsage returns every organization's billable units in a month as CSV, for
+// charging customers of a hosted instance. Super admins only.
+func (a *App) ExportAllUsage(r *fastglue.Request) error {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.IsSuperAdmin(userID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only super admins can export usage", nil, "")
+	}
+
+	period, err := usageReportPeriod(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid period. Use YYYY-MM", nil, "")
+	}
+
+	var meters []struct {
+		OrganizationID   uuid.UUID
+		OrganizationName string
+		Unit             string
+		Quantity         int64
+	}
+	if err := a.DB.Table("usage_meters").
+		Select("usage_meters.organization_id, organizations.name AS organization_name, usage_meters.unit, usage_meters.quantity").
+		Joins("JOIN organizations ON organizations.id = usage_meters.organization_id").
+		Where("usage_meters.period = ? AND usage_meters.deleted_at IS NULL", period).
+		Order("organizations.name ASC, usage_meters.organization_id ASC, usage_meters.unit ASC").
+		Scan(&meters).Error; err != nil {
+		a.Log.Error("Failed to load usage export", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to export usage", nil, "")
+	}
+
+	rows := [][]string{{"organization_id", "organization", "period", "unit", "quantity"}}
+	for _, m := range meters {
+		rows = append(rows, []string{m.OrganizationID.String(), m.OrganizationName, period, m.Unit, strconv.FormatInt(m.Quantity, 10)})
+	}
+
+	a.Log.Info("Usage exported", "user_id", userID, "period", period, "rows", len(meters))
+	sendCSV(r, fmt.Sprintf("usage-all-%s.csv", period), rows)
+	return nil
+}
+
+// sendCSV sends rows as a CSV attachment
+func sendCSV(r *fastglue.Request, fileName string, rows [][]string) {
+	r.RequestCtx.SetContentType("text/csv; charset=utf-8")
+	r.RequestCtx.Response.Header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	var buf bytes.Buffer
+	_ = csv.NewWriter(&buf).WriteAll(rows)
+	r.RequestCtx.SetBody(buf.Bytes())
+}
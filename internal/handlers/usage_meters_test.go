@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversationMeterUnit(t *testing.T) {
+	assert.Equal(t, "conversation.marketing", conversationMeterUnit("CBP", "marketing"))
+	assert.Equal(t, "message.utility", conversationMeterUnit("pmp", "utility"))
+	assert.Equal(t, "conversation.unknown", conversationMeterUnit("", ""))
+}
+
+func TestMeterUnitLabel(t *testing.T) {
+	assert.Equal(t, "WhatsApp marketing conversations", meterUnitLabel("conversation.marketing"))
+	assert.Equal(t, "WhatsApp utility messages", meterUnitLabel("message.utility"))
+	assert.Equal(t, "AI prompt tokens", meterUnitLabel(models.MeterUnitAIPromptTokens))
+	assert.Equal(t, "Seats (peak active users)", meterUnitLabel(models.MeterUnitSeats))
+	assert.Equal(t, "custom", meterUnitLabel("custom"))
+}
+
+func TestUsageMeters(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	suffix := uuid.New().String()[:8]
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Metered Org " + suffix,
+		Slug:      "metered-org-" + suffix,
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+
+	settings := &models.ChatbotSettings{OrganizationID: org.ID, WhatsAppAccount: "metered"}
+	app.recordAIUsage(settings, nil, &aiCompletion{Provider: models.AIProviderOpenAI, Model: "gpt-4o-mini", PromptTokens: 600, CompletionTokens: 150})
+	app.recordAIUsage(settings, nil, &aiCompletion{Provider: models.AIProviderOpenAI, Model: "gpt-4o-mini", PromptTokens: 400, CompletionTokens: 50})
+	app.meterUsage(org.ID, conversationMeterUnit("CBP", "marketing"), 1)
+
+	// Seats keep the month's peak
+	app.meterPeak(org.ID, models.MeterUnitSeats, 3)
+	app.meterPeak(org.ID, models.MeterUnitSeats, 5)
+	app.meterPeak(org.ID, models.MeterUnitSeats, 2)
+
+	lines, err := app.usageReport(org.ID, time.Now().UTC().Format("2006-01"))
+	require.NoError(t, err)
+	quantities := map[string]int64{}
+	for _, line := range lines {
+		quantities[line.Unit] = line.Quantity
+	}
+	assert.Equal(t, map[string]int64{
+		models.MeterUnitAIPromptTokens:     1000,
+		models.MeterUnitAICompletionTokens: 200,
+		"conversation.marketing":           1,
+		models.MeterUnitSeats:              5,
+	}, quantities)
+
+	lines, err = app.usageReport(org.ID, "2000-01")
+	require.NoError(t, err)
+	assert.Empty(t, lines)
+}
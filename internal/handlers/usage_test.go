@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/storage"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsagePeriod(t *testing.T) {
+	now := time.Date(2025, 3, 31, 23, 30, 0, 0, time.FixedZone("UTC-5", -5*3600))
+
+	assert.Equal(t, "2025-04", usagePeriod(models.UsageMetricMessages, now))
+	assert.Equal(t, "2025-04", usagePeriod(models.UsageMetricAICalls, now))
+	assert.Equal(t, models.UsagePeriodTotal, usagePeriod(models.UsageMetricStorage, now))
+	assert.Equal(t, models.UsagePeriodTotal, usagePeriod(models.UsageMetricAgents, now))
+}
+
+func TestQuotaLimit(t *testing.T) {
+	limits := models.PlanLimits{Messages: 1000, AICalls: 50, StorageMB: 2, Agents: 3}
+
+	assert.Equal(t, int64(1000), quotaLimit(limits, models.UsageMetricMessages))
+	assert.Equal(t, int64(0), quotaLimit(limits, models.UsageMetricCampaignRecipients))
+	assert.Equal(t, int64(2*1024*1024), quotaLimit(limits, models.UsageMetricStorage))
+	assert.Equal(t, int64(3), quotaLimit(limits, models.UsageMetricAgents))
+}
+
+func TestUsageStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		used  int64
+		limit int64
+		want  string
+	}{
+		{"unlimited", 5000, 0, UsageStatusOK},
+		{"below soft limit", 799, 1000, UsageStatusOK},
+		{"at soft limit", 800, 1000, UsageStatusWarning},
+		{"at hard limit", 1000, 1000, UsageStatusLimitReached},
+		{"over hard limit", 1200, 1000, UsageStatusLimitReached},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, usageStatus(tt.used, tt.limit, 80))
+		})
+	}
+}
+
+func TestQuotaExceededError(t *testing.T) {
+	err := &QuotaExceededError{Metric: models.UsageMetricMessages, Limit: 1000}
+	assert.Equal(t, "Messages limit of 1000 reached for your plan", err.Error())
+
+	err = &QuotaExceededError{Metric: models.UsageMetricStorage, Limit: 500 * 1024 * 1024}
+	assert.Equal(t, "Storage limit of 500.0 MB reached for your plan", err.Error())
+
+	err = &QuotaExceededError{Metric: models.UsageMetricMessages, Limit: 900, Campaigns: true}
+	assert.Equal(t, "Campaign message limit of 900 reached for your plan", err.Error())
+}
+
+func TestCampaignMessageLimit(t *testing.T) {
+	assert.Equal(t, int64(0), campaignMessageLimit(nil))
+	assert.Equal(t, int64(0), campaignMessageLimit(&models.Plan{CampaignThrottlePercent: 90}), "unlimited messages")
+	assert.Equal(t, int64(1000), campaignMessageLimit(&models.Plan{Limits: models.PlanLimits{Messages: 1000}}))
+	assert.Equal(t, int64(900), campaignMessageLimit(&models.Plan{Limits: models.PlanLimits{Messages: 1000}, CampaignThrottlePercent: 90}))
+	assert.Equal(t, int64(1000), campaignMessageLimit(&models.Plan{Limits: models.PlanLimits{Messages: 1000}, CampaignThrottlePercent: 100}))
+}
+
+func TestEmailAddress(t *testing.T) {
+	assert.Equal(t, "noreply@example.com", emailAddress("Whatomate <noreply@example.com>"))
+	assert.Equal(t, "noreply@example.com", emailAddress(" noreply@example.com "))
+}
+
+func TestDeleteMedia_ReleasesStorage(t *testing.T) {
+	media := storage.NewLocal(t.TempDir())
+	app := &App{Config: &config.Config{}, DB: testutil.SetupTestDB(t), Log: testutil.NopLogger(), Media: media}
+	org := models.Organization{Name: "Storage", Slug: "storage-" + uuid.New().String()[:8]}
+	require.NoError(t, app.DB.Create(&org).Error)
+	ctx := context.Background()
+
+	path, err := app.saveMedia(org.ID, []byte("a photo"), "image/jpeg", "photo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), app.currentUsage(org.ID, models.UsageMetricStorage))
+
+	require.NoError(t, app.deleteMedia(ctx, org.ID, path))
+	assert.Zero(t, app.currentUsage(org.ID, models.UsageMetricStorage))
+
+	// Media saved before storage was metered doesn't make usage negative
+	require.NoError(t, media.Put(ctx, "images/unmetered.jpg", []byte("older"), "image/jpeg"))
+	require.NoError(t, app.deleteMedia(ctx, org.ID, "images/unmetered.jpg"))
+	assert.Zero(t, app.currentUsage(org.ID, models.UsageMetricStorage))
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,6 +21,13 @@ type UserRequest struct {
 	IsSuperAdmin *bool      `json:"is_super_admin"`
 }
 
+// AssignRoleRequest represents the request body for assigning a role to a user.
+// The role is given by ID or by name, e.g. "viewer".
+type AssignRoleRequest struct {
+	RoleID *uuid.UUID `json:"role_id"`
+	Role   string     `json:"role"`
+}
+
 // UserResponse represents the response for a user (without sensitive data)
 type UserResponse struct {
 	ID             uuid.UUID    `json:"id"`
@@ -30,6 +38,7 @@ type UserResponse struct {
 	IsActive       bool         `json:"is_active"`
 	IsAvailable    bool         `json:"is_available"`
 	IsSuperAdmin   bool         `json:"is_super_admin"`
+	TwoFactor      bool         `json:"two_factor_enabled"`
 	OrganizationID uuid.UUID    `json:"organization_id"`
 	Settings       models.JSONB `json:"settings,omitempty"`
 	CreatedAt      string       `json:"created_at"`
@@ -58,6 +67,10 @@ type UserSettingsRequest struct {
 	EmailNotifications bool `json:"email_notifications"`
 	NewMessageAlerts   bool `json:"new_message_alerts"`
 	CampaignUpdates    bool `json:"campaign_updates"`
+
+	// Language messages are translated into for the user, an ISO 639-1 code. Omitted
+	// keeps the current one, empty turns translation off.
+	Language *string `json:"language,omitempty"`
 }
 
 // ChangePasswordRequest represents the request body for changing password
@@ -190,10 +203,16 @@ func (a *App) CreateUser(r *fastglue.Request) error {
 		user.IsSuperAdmin = true
 	}
 
+	// Enforce the plan's agent limit
+	if err := a.checkQuota(orgID, models.UsageMetricAgents, 1); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, err.Error(), nil, "")
+	}
+
 	if err := a.DB.Create(&user).Error; err != nil {
 		a.Log.Error("Failed to create user", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create user", nil, "")
 	}
+	a.syncAgentUsage(orgID)
 
 	// Load role for response
 	a.DB.Preload("Role").First(&user, user.ID)
@@ -262,6 +281,7 @@ func (a *App) UpdateUser(r *fastglue.Request) error {
 
 	// Handle role update
 	roleChanged := false
+	oldRole := user.Role
 	if req.RoleID != nil {
 		// Validate role exists and belongs to org
 		var newRole models.CustomRole
@@ -284,6 +304,12 @@ func (a *App) UpdateUser(r *fastglue.Request) error {
 		if currentUserID == id && !*req.IsActive {
 			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Cannot deactivate yourself", nil, "")
 		}
+		// Reactivating a user counts against the plan's agent limit
+		if *req.IsActive && !user.IsActive {
+			if err := a.checkQuota(orgID, models.UsageMetricAgents, 1); err != nil {
+				return r.SendErrorEnvelope(fasthttp.StatusForbidden, err.Error(), nil, "")
+			}
+		}
 		user.IsActive = *req.IsActive
 	}
 
@@ -307,6 +333,18 @@ func (a *App) UpdateUser(r *fastglue.Request) error {
 	// Invalidate permissions cache if role changed
 	if roleChanged {
 		a.InvalidateUserPermissionsCache(user.ID)
+		var newRole models.CustomRole
+		a.DB.Where("id = ?", user.RoleID).First(&newRole)
+		a.recordAudit(r, models.AuditLog{
+			OrganizationID: orgID,
+			Action:         models.AuditActionAssignRole,
+			ResourceType:   models.AuditResourceUser,
+			ResourceID:     &user.ID,
+			ResourceName:   user.Email,
+		}, userRoleAuditSnapshot(oldRole), userRoleAuditSnapshot(&newRole))
+	}
+	if req.IsActive != nil {
+		a.syncAgentUsage(orgID)
 	}
 
 	// Load role for response
@@ -315,6 +353,86 @@ func (a *App) UpdateUser(r *fastglue.Request) error {
 	return r.SendEnvelope(userToResponse(user))
 }
 
+// AssignUserRole changes the role of a user in the organization
+func (a *App) AssignUserRole(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	currentUserID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(currentUserID, models.ResourceUsers, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions to change roles", nil, "")
+	}
+
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid user ID", nil, "")
+	}
+
+	var req AssignRoleRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+
+	var newRole models.CustomRole
+	query := a.DB.Where("organization_id = ?", orgID)
+	switch {
+	case req.RoleID != nil:
+		query = query.Where("id = ?", *req.RoleID)
+	case req.Role != "":
+		query = query.Where("name = ?", req.Role)
+	default:
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "role_id or role is required", nil, "")
+	}
+	if err := query.First(&newRole).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid role", nil, "")
+	}
+
+	var user models.User
+	if err := a.DB.Where("id = ? AND organization_id = ?", id, orgID).Preload("Role").First(&user).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "User not found", nil, "")
+	}
+
+	if user.Role != nil && user.Role.Name == "admin" && user.Role.IsSystem && newRole.ID != user.Role.ID {
+		// Prevent self-demotion from admin
+		if currentUserID == id {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Cannot demote yourself", nil, "")
+		}
+		var adminCount int64
+		a.DB.Model(&models.User{}).Where("organization_id = ? AND role_id = ?", orgID, user.Role.ID).Count(&adminCount)
+		if adminCount <= 1 {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Cannot demote the last admin", nil, "")
+		}
+	}
+
+	before := userRoleAuditSnapshot(user.Role)
+	if err := a.DB.Model(&user).Update("role_id", newRole.ID).Error; err != nil {
+		a.Log.Error("Failed to assign role", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to assign role", nil, "")
+	}
+	a.InvalidateUserPermissionsCache(user.ID)
+	a.recordAudit(r, models.AuditLog{
+		OrganizationID: orgID,
+		Action:         models.AuditActionAssignRole,
+		ResourceType:   models.AuditResourceUser,
+		ResourceID:     &user.ID,
+		ResourceName:   user.Email,
+	}, before, userRoleAuditSnapshot(&newRole))
+
+	a.DB.Preload("Role").First(&user, user.ID)
+
+	return r.SendEnvelope(userToResponse(user))
+}
+
+// userRoleAuditSnapshot captures a user's role for the audit log
+func userRoleAuditSnapshot(role *models.CustomRole) map[string]interface{} {
+	if role == nil {
+		return map[string]interface{}{"role": nil}
+	}
+	return map[string]interface{}{"role": role.Name}
+}
+
 // DeleteUser deletes a user
 func (a *App) DeleteUser(r *fastglue.Request) error {
 	orgID, err := getOrganizationID(r)
@@ -364,6 +482,7 @@ func (a *App) DeleteUser(r *fastglue.Request) error {
 	if result.RowsAffected == 0 {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "User not found", nil, "")
 	}
+	a.syncAgentUsage(orgID)
 
 	return r.SendEnvelope(map[string]string{"message": "User deleted successfully"})
 }
@@ -440,6 +559,13 @@ func (a *App) UpdateCurrentUserSettings(r *fastglue.Request) error {
 	user.Settings["email_notifications"] = req.EmailNotifications
 	user.Settings["new_message_alerts"] = req.NewMessageAlerts
 	user.Settings["campaign_updates"] = req.CampaignUpdates
+	if req.Language != nil {
+		lang := strings.ToLower(strings.TrimSpace(*req.Language))
+		if lang != "" && !languageCodeRegex.MatchString(lang) {
+			return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "language must be an ISO 639-1 code, e.g. en", nil, "")
+		}
+		user.Settings[userLanguageSetting] = lang
+	}
 
 	if err := a.DB.Save(&user).Error; err != nil {
 		a.Log.Error("Failed to update user settings", "error", err)
@@ -510,6 +636,7 @@ func userToResponse(user models.User) UserResponse {
 		IsActive:       user.IsActive,
 		IsAvailable:    user.IsAvailable,
 		IsSuperAdmin:   user.IsSuperAdmin,
+		TwoFactor:      user.TwoFactorEnabled,
 		OrganizationID: user.OrganizationID,
 		Settings:       user.Settings,
 		CreatedAt:      user.CreatedAt.Format("2006-01-02T15:04:05Z"),
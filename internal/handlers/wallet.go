@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errWalletDepleted is returned when a prepaid organization has no credit left for campaigns
+var errWalletDepleted = errors.New("Wallet balance is depleted; add credits to send campaigns")
+
+// WalletCreditRequest represents a request to load credits into a wallet
+type WalletCreditRequest struct {
+	Amount      int64  `json:"amount"`
+	Description string `json:"description"`
+}
+
+// walletConversationRate returns the wallet rate for a Meta pricing category
+func walletConversationRate(rates models.WalletRates, category string) int64 {
+	switch {
+	case strings.HasPrefix(category, "marketing"): // marketing, marketing_lite
+		return rates.Marketing
+	case category == "utility":
+		return rates.Utility
+	case strings.HasPrefix(category, "authentication"): // authentication, authentication_international
+		return rates.Authentication
+	case category == "service":
+		return rates.Service
+	}
+	return 0
+}
+
+// walletChargeReference identifies what a status update bills for, so it is debited once.
+// Conversation-based pricing bills per conversation, per-message pricing per message.
+func walletChargeReference(whatsappMsgID string, status WebhookStatus) string {
+	if status.Pricing != nil && strings.EqualFold(status.Pricing.PricingModel, "CBP") &&
+		status.Conversation != nil && status.Conversation.ID != "" {
+		return "conversation:" + status.Conversation.ID
+	}
+	return "message:" + whatsappMsgID
+}
+
+// orgWallet returns the organization's wallet, or nil when it isn't prepaid
+func (a *App) orgWallet(orgID uuid.UUID) (*models.Wallet, error) {
+	var wallet models.Wallet
+	if err := a.DB.Where("organization_id = ?", orgID).First(&wallet).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+// checkWalletBalance returns errWalletDepleted when the organization is prepaid and out of credit
+func (a *App) checkWalletBalance(orgID uuid.UUID) error {
+	wallet, err := a.orgWallet(orgID)
+	if err != nil {
+		a.Log.Error("Failed to load wallet", "error", err, "org_id", orgID)
+		return nil
+	}
+	if wallet != nil && wallet.Balance <= 0 {
+		return errWalletDepleted
+	}
+	return nil
+}
+
+// chargeConversation debits the wallet for a conversation or message Meta bills for,
+// at the plan's rate for its pricing category
+func (a *App) chargeConversation(orgID uuid.UUID, category, reference string) {
+	plan := a.orgPlan(orgID)
+	if plan == nil {
+		return
+	}
+	unit := "message"
+	if strings.HasPrefix(reference, "conversation:") {
+		unit = "conversation"
+	}
+	amount := walletConversationRate(plan.WalletRates, category)
+	a.debitWallet(orgID, amount, category+" "+unit, reference)
+}
+
+// chargeAICall debits the wallet for an AI response
+func (a *App) chargeAICall(orgID uuid.UUID) {
+	plan := a.orgPlan(orgID)
+	if plan == nil {
+		return
+	}
+	a.debitWallet(orgID, plan.WalletRates.AICall, "AI call", "")
+}
+
+// debitWallet subtracts amount from the organization's wallet, if it has one. Debits with a
+// reference are applied once. The balance may go negative since Meta has already billed.
+func (a *App) debitWallet(orgID uuid.UUID, amount int64, description, reference string) {
+	if amount <= 0 {
+		return
+	}
+
+	var wallet models.Wallet
+	debited := false
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("organization_id = ?", orgID).First(&wallet).Error; err != nil {
+			return err
+		}
+
+		if reference != "" {
+			var count int64
+			tx.Model(&models.WalletTransaction{}).Where("organization_id = ? AND reference = ?", orgID, reference).Count(&count)
+			if count > 0 {
+				return nil
+			}
+		}
+
+		wallet.Balance -= amount
+		if err := tx.Model(&wallet).Update("balance", wallet.Balance).Error; err != nil {
+			return err
+		}
+		debited = true
+		return tx.Create(&models.WalletTransaction{
+			OrganizationID: orgID,
+			Type:           models.WalletTransactionDebit,
+			Amount:         amount,
+			BalanceAfter:   wallet.Balance,
+			Description:    description,
+			Reference:      reference,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return // Not prepaid
+	}
+	if err != nil {
+		a.Log.Error("Failed to debit wallet", "error", err, "org_id", orgID, "amount", amount)
+		return
+	}
+	if debited {
+		a.checkWalletAlerts(&wallet)
+	}
+}
+
+// checkWalletAlerts sends the low balance alert, and pauses campaigns when the balance
+// reaches zero. Each is sent once until credits are added.
+func (a *App) checkWalletAlerts(wallet *models.Wallet) {
+	now := time.Now()
+
+	if wallet.LowBalanceThreshold > 0 && wallet.Balance < wallet.LowBalanceThreshold && wallet.LowBalanceAlertedAt == nil &&
+		a.claimWalletAlert(wallet, "low_balance_alerted_at", now) {
+		a.sendWalletAlert(wallet, models.WebhookEventWalletLow)
+	}
+
+	if wallet.Balance <= 0 && wallet.DepletedAt == nil && a.claimWalletAlert(wallet, "depleted_at", now) {
+		a.pauseRunningCampaigns(wallet.OrganizationID, errWalletDepleted.Error())
+		a.sendWalletAlert(wallet, models.WebhookEventWalletDepleted)
+	}
+}
+
+// claimWalletAlert sets an alert timestamp if it is still unset, so concurrent debits
+// send an alert once
+func (a *App) claimWalletAlert(wallet *models.Wallet, column string, now time.Time) bool {
+	result := a.DB.Model(&models.Wallet{}).
+		Where("id = ? AND "+column+" IS NULL", wallet.ID).
+		Update(column, now)
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// sendWalletAlert emits the wallet webhook event and emails the organization's admins
+func (a *App) sendWalletAlert(wallet *models.Wallet, event models.WebhookEvent) {
+	a.Log.Info("Wallet alert", "org_id", wallet.OrganizationID, "balance", wallet.Balance, "event", event)
+
+	a.DispatchWebhook(wallet.OrganizationID, event, map[string]interface{}{
+		"balance":               wallet.Balance,
+		"currency":              wallet.Currency,
+		"low_balance_threshold": wallet.LowBalanceThreshold,
+	})
+
+	if !a.emailEnabled() {
+		return
+	}
+
+	balance := formatAmount(wallet.Balance, wallet.Currency)
+	var subject, body string
+	if event == models.WebhookEventWalletDepleted {
+		subject = "Wallet balance depleted"
+		body = fmt.Sprintf("Your organization's wallet balance is %s. Running campaigns have been paused "+
+			"and can be resumed after adding credits.\n", balance)
+	} else {
+		subject = "Wallet balance low"
+		body = fmt.Sprintf("Your organization's wallet balance is %s, below the alert threshold of %s. "+
+			"Add credits to keep campaigns running.\n", balance, formatAmount(wallet.LowBalanceThreshold, wallet.Currency))
+	}
+
+	if err := a.sendEmail(a.orgAdminEmails(wallet.OrganizationID), subject, body); err != nil {
+		a.Log.Error("Failed to send wallet alert email", "error", err, "org_id", wallet.OrganizationID)
+	}
+}
+
+// creditWallet adds credits to an organization's wallet, creating it on the first credit,
+// and re-arms alerts the new balance clears
+func (a *App) creditWallet(orgID uuid.UUID, amount int64, description string, createdBy uuid.UUID) (*models.Wallet, error) {
+	var wallet models.Wallet
+	err := a.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("organization_id = ?", orgID).First(&wallet).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			wallet = models.Wallet{OrganizationID: orgID, Currency: "USD"}
+			if plan := a.orgPlan(orgID); plan != nil && plan.Currency != "" {
+				wallet.Currency = plan.Currency
+			}
+			err = tx.Create(&wallet).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		wallet.Balance += amount
+		updates := map[string]interface{}{"balance": wallet.Balance}
+		if wallet.Balance >= wallet.LowBalanceThreshold {
+			updates["low_balance_alerted_at"] = nil
+			wallet.LowBalanceAlertedAt = nil
+		}
+		if wallet.Balance > 0 {
+			updates["depleted_at"] = nil
+			wallet.DepletedAt = nil
+		}
+		if err := tx.Model(&wallet).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.WalletTransaction{
+			OrganizationID: orgID,
+			Type:           models.WalletTransactionCredit,
+			Amount:         amount,
+			BalanceAfter:   wallet.Balance,
+			Description:    description,
+			CreatedByID:    &createdBy,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &wallet, nil
+}
+
+// GetWallet returns the organization's wallet and the rates it is debited at
+func (a *App) GetWallet(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	wallet, err := a.orgWallet(orgID)
+	if err != nil {
+		a.Log.Error("Failed to load wallet", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load wallet", nil, "")
+	}
+
+	var rates models.WalletRates
+	if plan := a.orgPlan(orgID); plan != nil {
+		rates = plan.WalletRates
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"prepaid": wallet != nil,
+		"wallet":  wallet,
+		"rates":   rates,
+	})
+}
+
+// UpdateWallet updates the organization's low balance alert threshold
+func (a *App) UpdateWallet(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionWrite) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	var req struct {
+		LowBalanceThreshold int64 `json:"low_balance_threshold"`
+	}
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if req.LowBalanceThreshold < 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "low_balance_threshold cannot be negative", nil, "")
+	}
+
+	wallet, err := a.orgWallet(orgID)
+	if err != nil || wallet == nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Wallet not found", nil, "")
+	}
+
+	updates := map[string]interface{}{"low_balance_threshold": req.LowBalanceThreshold}
+	if wallet.Balance >= req.LowBalanceThreshold {
+		updates["low_balance_alerted_at"] = nil
+	}
+	if err := a.DB.Model(wallet).Updates(updates).Error; err != nil {
+		a.Log.Error("Failed to update wallet", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to update wallet", nil, "")
+	}
+
+	return r.SendEnvelope(wallet)
+}
+
+// ListWalletTransactions returns the organization's wallet transactions, newest first
+func (a *App) ListWalletTransactions(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.HasPermission(userID, models.ResourceSettingsGeneral, models.ActionRead) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+	}
+
+	page, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("page")))
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := a.DB.Model(&models.WalletTransaction{}).Where("organization_id = ?", orgID)
+	if txType := string(r.RequestCtx.QueryArgs().Peek("type")); txType != "" {
+		query = query.Where("type = ?", txType)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var transactions []models.WalletTransaction
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&transactions).Error; err != nil {
+		a.Log.Error("Failed to list wallet transactions", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list wallet transactions", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"transactions": transactions,
+		"total":        total,
+		"page":         page,
+		"limit":        limit,
+	})
+}
+
+// AddWalletCredits loads credits into an organization's wallet (super admin only).
+// The first credit makes the organization prepaid.
+func (a *App) AddWalletCredits(r *fastglue.Request) error {
+	userID, _ := r.RequestCtx.UserValue("user_id").(uuid.UUID)
+	if !a.IsSuperAdmin(userID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Only super admins can add wallet credits", nil, "")
+	}
+
+	orgID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid organization ID", nil, "")
+	}
+
+	var req WalletCreditRequest
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &req); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if req.Amount <= 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "amount must be positive", nil, "")
+	}
+	if req.Description == "" {
+		req.Description = "Credits added"
+	}
+
+	var count int64
+	a.DB.Model(&models.Organization{}).Where("id = ?", orgID).Count(&count)
+	if count == 0 {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Organization not found", nil, "")
+	}
+
+	wallet, err := a.creditWallet(orgID, req.Amount, req.Description, userID)
+	if err != nil {
+		a.Log.Error("Failed to add wallet credits", "error", err, "org_id", orgID)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to add wallet credits", nil, "")
+	}
+
+	a.Log.Info("Wallet credits added", "org_id", orgID, "amount", req.Amount, "balance", wallet.Balance, "by", userID)
+
+	return r.SendEnvelope(wallet)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalletConversationRate(t *testing.T) {
+	rates := models.WalletRates{Marketing: 50, Utility: 20, Authentication: 15, Service: 5}
+
+	assert.Equal(t, int64(50), walletConversationRate(rates, "marketing"))
+	assert.Equal(t, int64(50), walletConversationRate(rates, "marketing_lite"))
+	assert.Equal(t, int64(20), walletConversationRate(rates, "utility"))
+	assert.Equal(t, int64(15), walletConversationRate(rates, "authentication_international"))
+	assert.Equal(t, int64(5), walletConversationRate(rates, "service"))
+	assert.Equal(t, int64(0), walletConversationRate(rates, "referral_conversion"))
+}
+
+func TestWalletChargeReference(t *testing.T) {
+	status := WebhookStatus{}
+	status.Conversation = &struct {
+		ID string `json:"id"`
+	}{ID: "conv-1"}
+	status.Pricing = &struct {
+		Billable     bool   `json:"billable"`
+		PricingModel string `json:"pricing_model"`
+		Category     string `json:"category"`
+	}{Billable: true, PricingModel: "CBP", Category: "marketing"}
+
+	assert.Equal(t, "conversation:conv-1", walletChargeReference("wamid.1", status))
+
+	status.Pricing.PricingModel = "PMP"
+	assert.Equal(t, "message:wamid.1", walletChargeReference("wamid.1", status), "per-message pricing bills each message")
+}
@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/tracing"
+	ws "github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// Web chat accounts are widgets websites embed to chat with the same chatbot, flows
+// and agents as WhatsApp. The account's phone ID is the widget token, which is
+// public: it is embedded in the website. Visitors are anonymous and identified by a
+// random ID their browser keeps. Contacts are visitors: their phone number is "wc"
+// and a hash of the account and browser ID, so a browser always chats as the same
+// contact.
+const webChatPrefix = "wc"
+
+const (
+	// webChatSessionTTL is how long a visitor session token is valid
+	webChatSessionTTL = 30 * 24 * time.Hour
+	// webChatHistoryLimit is how many recent messages a visitor gets on load
+	webChatHistoryLimit = 50
+	// webChatRateLimit is how many messages a visitor can send per minute
+	webChatRateLimit = 30
+	// maxWebChatTextLength is the longest message a visitor can send
+	maxWebChatTextLength = 4096
+)
+
+// WebChatAccountRequest is the request body for creating a web chat widget
+type WebChatAccountRequest struct {
+	Name              string `json:"name"`
+	IsDefaultIncoming bool   `json:"is_default_incoming"`
+	IsDefaultOutgoing bool   `json:"is_default_outgoing"`
+}
+
+// WebChatSessionRequest is the request body for starting a visitor session
+type WebChatSessionRequest struct {
+	BrowserID string `json:"browser_id"` // Random ID the browser keeps, at least 16 characters
+	Name      string `json:"name"`       // Optional visitor name
+}
+
+// WebChatSendRequest is a message from a visitor: text, or a tap on a button of a
+// message the bot sent
+type WebChatSendRequest struct {
+	Text        string `json:"text"`
+	ButtonID    string `json:"button_id"`
+	ButtonTitle string `json:"button_title"`
+}
+
+// WebChatMessage is a message as the widget shows it
+type WebChatMessage struct {
+	ID          string       `json:"id"`
+	Direction   string       `json:"direction"` // incoming is from the visitor
+	Type        string       `json:"type"`
+	Content     string       `json:"content"`
+	Interactive models.JSONB `json:"interactive,omitempty"` // Buttons, list rows or CTA URL
+	MediaLink   string       `json:"media_link,omitempty"`
+	Latitude    *float64     `json:"latitude,omitempty"`
+	Longitude   *float64     `json:"longitude,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// webChatClaims are the claims of a visitor session token. The subject is the
+// visitor's contact phone number and the audience the account ID.
+type webChatClaims struct {
+	Name string `json:"name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// webChatContactNumber returns the phone number of the contact for a browser
+func webChatContactNumber(accountID uuid.UUID, browserID string) string {
+	sum := sha256.Sum256([]byte(accountID.String() + ":" + browserID))
+	return webChatPrefix + hex.EncodeToString(sum[:8])
+}
+
+// isWebChatContact reports whether a phone number is a web chat visitor's
+func isWebChatContact(phoneNumber string) bool {
+	return strings.HasPrefix(phoneNumber, webChatPrefix) && len(phoneNumber) > len(webChatPrefix)
+}
+
+// webChatSigningKey returns the key visitor session tokens are signed with. It is
+// derived from the JWT secret, so session tokens can't pass as user tokens.
+func (a *App) webChatSigningKey() []byte {
+	mac := hmac.New(sha256.New, []byte(a.CurrentConfig().JWT.Secret))
+	mac.Write([]byte("webchat-session"))
+	return mac.Sum(nil)
+}
+
+// newWebChatSessionToken signs a session token for a visitor of the account
+func (a *App) newWebChatSessionToken(account *models.WhatsAppAccount, phoneNumber, name string, expiresAt time.Time) (string, error) {
+	claims := webChatClaims{
+		Name: name,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   phoneNumber,
+			Audience:  jwt.ClaimStrings{account.ID.String()},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    "whatomate",
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.webChatSigningKey())
+}
+
+// parseWebChatSessionToken validates a session token for the account and returns
+// its claims
+func (a *App) parseWebChatSessionToken(account *models.WhatsAppAccount, tokenString string) (*webChatClaims, error) {
+	claims := &webChatClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return a.webChatSigningKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(account.ID.String()))
+	if err != nil {
+		return nil, err
+	}
+	if !isWebChatContact(claims.Subject) {
+		return nil, jwt.ErrTokenInvalidSubject
+	}
+	return claims, nil
+}
+
+// webChatAccountFromRequest loads the web chat account of the {token} path
+// parameter. Errors are sent as the response, so a nil account ends the request.
+func (a *App) webChatAccountFromRequest(r *fastglue.Request) (*models.WhatsAppAccount, error) {
+	token, _ := r.RequestCtx.UserValue("token").(string)
+	if !strings.HasPrefix(token, webChatPrefix) {
+		return nil, r.SendErrorEnvelope(fasthttp.StatusNotFound, "Chat not found", nil, "")
+	}
+	account, err := a.getWhatsAppAccountCached(token)
+	if err != nil || !account.IsWebChat() || account.Status != "active" {
+		return nil, r.SendErrorEnvelope(fasthttp.StatusNotFound, "Chat not found", nil, "")
+	}
+	return account, nil
+}
+
+// webChatVisitorFromRequest loads the web chat account of the request and the
+// visitor of the session token in its Authorization header. Errors are sent as the
+// response, so a nil account ends the request.
+func (a *App) webChatVisitorFromRequest(r *fastglue.Request) (*models.WhatsAppAccount, *webChatClaims, error) {
+	account, err := a.webChatAccountFromRequest(r)
+	if account == nil {
+		return nil, nil, err
+	}
+	token := strings.TrimPrefix(string(r.RequestCtx.Request.Header.Peek("Authorization")), "Bearer ")
+	claims, err := a.parseWebChatSessionToken(account, token)
+	if err != nil {
+		return nil, nil, r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Invalid session", nil, "")
+	}
+	return account, claims, nil
+}
+
+// CreateWebChatSession starts a session for the visitor using a browser. The same
+// browser ID always gets the same contact, so visitors continue where they left off.
+func (a *App) CreateWebChatSession(r *fastglue.Request) error {
+	account, err := a.webChatAccountFromRequest(r)
+	if account == nil {
+		return err
+	}
+
+	var req WebChatSessionRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	if len(req.BrowserID) < 16 || len(req.BrowserID) > 128 {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "browser_id must be 16 to 128 characters", nil, "")
+	}
+	name := strings.TrimSpace(req.Name)
+	if len([]rune(name)) > 100 {
+		name = string([]rune(name)[:100])
+	}
+
+	phoneNumber := webChatContactNumber(account.ID, req.BrowserID)
+	expiresAt := time.Now().Add(webChatSessionTTL)
+	token, err := a.newWebChatSessionToken(account, phoneNumber, name, expiresAt)
+	if err != nil {
+		a.Log.Error("Failed to sign web chat session", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to start session", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"session_token": token,
+		"expires_at":    expiresAt,
+		"name":          account.Name,
+	})
+}
+
+// ListWebChatMessages returns the visitor's recent messages, oldest first
+func (a *App) ListWebChatMessages(r *fastglue.Request) error {
+	account, claims, err := a.webChatVisitorFromRequest(r)
+	if account == nil {
+		return err
+	}
+
+	messages := []WebChatMessage{}
+	var contact models.Contact
+	if err := a.DB.Where("organization_id = ? AND phone_number = ?", account.OrganizationID, claims.Subject).
+		First(&contact).Error; err != nil {
+		// Visitors who haven't written yet have no contact
+		return r.SendEnvelope(map[string]interface{}{"messages": messages})
+	}
+
+	var stored []models.Message
+	if err := a.DB.Where("contact_id = ? AND whats_app_account = ? AND revoked_at IS NULL", contact.ID, account.Name).
+		Order("created_at DESC").
+		Limit(webChatHistoryLimit).
+		Find(&stored).Error; err != nil {
+		a.Log.Error("Failed to load web chat messages", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to load messages", nil, "")
+	}
+	for i := len(stored) - 1; i >= 0; i-- {
+		messages = append(messages, webChatMessageFromModel(&stored[i]))
+	}
+	return r.SendEnvelope(map[string]interface{}{"messages": messages})
+}
+
+// SendWebChatMessage takes a message from a visitor and processes it like an
+// incoming WhatsApp message, through the chatbot, flows, AI and agent inbox
+func (a *App) SendWebChatMessage(r *fastglue.Request) error {
+	account, claims, err := a.webChatVisitorFromRequest(r)
+	if account == nil {
+		return err
+	}
+
+	var req WebChatSendRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	msg, ok := webChatIncomingMessage(claims.Subject, req, time.Now())
+	if !ok {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, fmt.Sprintf("Send text of at most %d characters, or a button_id", maxWebChatTextLength), nil, "")
+	}
+
+	ctx := tracing.FromContext(r.RequestCtx)
+	if a.webChatRateLimited(ctx, account, claims.Subject) {
+		return r.SendErrorEnvelope(fasthttp.StatusTooManyRequests, "Too many messages, slow down", nil, "")
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		if err := a.processIncomingMessage(ctx, account.PhoneID, msg, claims.Name); err != nil {
+			a.log(ctx).Error("Failed to process web chat message", "error", err)
+		}
+	}()
+
+	return r.SendEnvelope(map[string]string{"message_id": msg["id"].(string)})
+}
+
+// webChatIncomingMessage converts a visitor's message into a message as the
+// WhatsApp webhook delivers it
+func webChatIncomingMessage(phoneNumber string, req WebChatSendRequest, now time.Time) (map[string]interface{}, bool) {
+	msg := map[string]interface{}{
+		"from":      phoneNumber,
+		"id":        webChatPrefix + ":" + uuid.NewString(),
+		"timestamp": strconv.FormatInt(now.Unix(), 10),
+	}
+
+	text := strings.TrimSpace(req.Text)
+	switch {
+	case req.ButtonID != "":
+		title := req.ButtonTitle
+		if title == "" {
+			title = text
+		}
+		msg["type"] = "interactive"
+		msg["interactive"] = map[string]interface{}{
+			"type":         "button_reply",
+			"button_reply": map[string]string{"id": req.ButtonID, "title": title},
+		}
+	case text != "" && len([]rune(text)) <= maxWebChatTextLength:
+		msg["type"] = "text"
+		msg["text"] = map[string]string{"body": text}
+	default:
+		return nil, false
+	}
+	return msg, true
+}
+
+// webChatRateLimited counts a message from a visitor and reports whether they went
+// over the per-minute limit
+func (a *App) webChatRateLimited(ctx context.Context, account *models.WhatsAppAccount, phoneNumber string) bool {
+	if a.Redis == nil {
+		return false
+	}
+	key := fmt.Sprintf("ratelimit:webchat:%s:%s:%d", account.ID, phoneNumber, time.Now().Unix()/60)
+	count, err := a.Redis.Incr(ctx, key).Result()
+	if err != nil {
+		return false
+	}
+	if count == 1 {
+		a.Redis.Expire(ctx, key, 2*time.Minute)
+	}
+	return count > webChatRateLimit
+}
+
+// WebChatSocket upgrades a visitor's connection to a WebSocket that receives the
+// bot's and agents' replies as they are sent. The session token is passed in the
+// session query parameter, since browsers can't set headers on WebSockets.
+func (a *App) WebChatSocket(r *fastglue.Request) error {
+	account, err := a.webChatAccountFromRequest(r)
+	if account == nil {
+		return err
+	}
+	claims, err := a.parseWebChatSessionToken(account, string(r.RequestCtx.QueryArgs().Peek("session")))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Invalid session", nil, "")
+	}
+
+	err = upgrader.Upgrade(r.RequestCtx, func(conn *websocket.Conn) {
+		client := ws.NewVisitorClient(a.WSHub, conn, account.OrganizationID, claims.Subject)
+		a.WSHub.Register(client)
+
+		go client.WritePump()
+		client.ReadPump() // Blocking - runs until connection closes
+	})
+	if err != nil {
+		a.Log.Error("Web chat WebSocket upgrade failed", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "WebSocket upgrade failed", nil, "")
+	}
+	return nil
+}
+
+// sendWebChatMessage pushes an outgoing message to the visitor's open widgets and
+// returns its message ID. Visitors who aren't connected see it in their history.
+// Media must be sent by link, and templates, flows, catalogs and contact cards
+// can't be sent.
+func (a *App) sendWebChatMessage(ctx context.Context, req OutgoingMessageRequest) (string, error) {
+	if !isWebChatContact(req.Contact.PhoneNumber) {
+		return "", fmt.Errorf("contact %s is not a web chat visitor", req.Contact.PhoneNumber)
+	}
+
+	switch req.Type {
+	case models.MessageTypeText, models.MessageTypeLocation:
+	case models.MessageTypeImage, models.MessageTypeVideo, models.MessageTypeAudio, models.MessageTypeDocument:
+		if req.MediaLink == "" {
+			return "", fmt.Errorf("media must be sent by link on web chat")
+		}
+	case models.MessageTypeInteractive:
+		if req.InteractiveType == "product" || req.InteractiveType == "product_list" {
+			return "", fmt.Errorf("%s messages are not supported on web chat", req.InteractiveType)
+		}
+	default:
+		return "", fmt.Errorf("%s messages are not supported on web chat", req.Type)
+	}
+
+	msg := a.createOutgoingMessage(req, MessageSendOptions{})
+	msg.WhatsAppMessageID = webChatPrefix + ":" + uuid.NewString()
+	msg.CreatedAt = time.Now()
+	if a.WSHub != nil {
+		a.WSHub.BroadcastToVisitor(req.Account.OrganizationID, req.Contact.PhoneNumber, ws.WSMessage{
+			Type:    ws.TypeWebChatMessage,
+			Payload: webChatMessageFromModel(msg),
+		})
+	}
+	return msg.WhatsAppMessageID, nil
+}
+
+// sendWebChatTyping shows the typing indicator in the widgets of the visitor who
+// sent a message
+func (a *App) sendWebChatTyping(account *models.WhatsAppAccount, messageID string) {
+	phoneNumber := a.contactPhoneForMessage(messageID)
+	if a.WSHub == nil || !isWebChatContact(phoneNumber) {
+		return
+	}
+	a.WSHub.BroadcastToVisitor(account.OrganizationID, phoneNumber, ws.WSMessage{
+		Type:    ws.TypeWebChatTyping,
+		Payload: map[string]bool{"typing": true},
+	})
+}
+
+// webChatMessageFromModel converts a stored message for the widget
+func webChatMessageFromModel(msg *models.Message) WebChatMessage {
+	m := WebChatMessage{
+		ID:          msg.WhatsAppMessageID,
+		Direction:   string(msg.Direction),
+		Type:        string(msg.MessageType),
+		Content:     msg.Content,
+		Interactive: msg.InteractiveData,
+		Latitude:    msg.Latitude,
+		Longitude:   msg.Longitude,
+		CreatedAt:   msg.CreatedAt,
+	}
+	if link, ok := msg.Metadata["media_link"].(string); ok {
+		m.MediaLink = link
+	}
+	return m
+}
+
+// CreateWebChatAccount creates a web chat widget. Its phone ID is the widget token
+// websites embed.
+func (a *App) CreateWebChatAccount(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	if a.accountLimitReached(orgID) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureMultipleAccounts), nil, "")
+	}
+
+	var req WebChatAccountRequest
+	if err := r.Decode(&req, "json"); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Name is required", nil, "")
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to generate widget token", nil, "")
+	}
+
+	account := models.WhatsAppAccount{
+		OrganizationID:    orgID,
+		Name:              req.Name,
+		Channel:           string(models.ChannelWebChat),
+		PhoneID:           webChatPrefix + hex.EncodeToString(token),
+		IsDefaultIncoming: req.IsDefaultIncoming,
+		IsDefaultOutgoing: req.IsDefaultOutgoing,
+		Status:            "active",
+	}
+
+	if req.IsDefaultIncoming {
+		a.DB.Model(&models.WhatsAppAccount{}).
+			Where("organization_id = ? AND is_default_incoming = ?", orgID, true).
+			Update("is_default_incoming", false)
+	}
+	if req.IsDefaultOutgoing {
+		a.DB.Model(&models.WhatsAppAccount{}).
+			Where("organization_id = ? AND is_default_outgoing = ?", orgID, true).
+			Update("is_default_outgoing", false)
+	}
+
+	if err := a.DB.Create(&account).Error; err != nil {
+		a.Log.Error("Failed to create web chat account", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to create account", nil, "")
+	}
+
+	return r.SendEnvelope(accountToResponse(account))
+}
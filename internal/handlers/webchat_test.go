@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebChatContactNumber(t *testing.T) {
+	accountID := uuid.New()
+	phone := webChatContactNumber(accountID, "browser-1234567890")
+	assert.Len(t, phone, 18)
+	assert.True(t, isWebChatContact(phone))
+	assert.Equal(t, phone, webChatContactNumber(accountID, "browser-1234567890"))
+	assert.NotEqual(t, phone, webChatContactNumber(accountID, "browser-0987654321"))
+	assert.NotEqual(t, phone, webChatContactNumber(uuid.New(), "browser-1234567890"))
+
+	assert.False(t, isWebChatContact("15551234567"))
+	assert.False(t, isWebChatContact("tg42"))
+}
+
+func TestWebChatSessionToken(t *testing.T) {
+	app := &App{Config: &config.Config{JWT: config.JWTConfig{Secret: "test-secret"}}}
+	account := &models.WhatsAppAccount{BaseModel: models.BaseModel{ID: uuid.New()}}
+	phone := webChatContactNumber(account.ID, "browser-1234567890")
+
+	token, err := app.newWebChatSessionToken(account, phone, "Ada", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	claims, err := app.parseWebChatSessionToken(account, token)
+	require.NoError(t, err)
+	assert.Equal(t, phone, claims.Subject)
+	assert.Equal(t, "Ada", claims.Name)
+
+	// Sessions are only valid for the widget they were started on
+	other := &models.WhatsAppAccount{BaseModel: models.BaseModel{ID: uuid.New()}}
+	_, err = app.parseWebChatSessionToken(other, token)
+	assert.Error(t, err)
+
+	expired, err := app.newWebChatSessionToken(account, phone, "", time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	_, err = app.parseWebChatSessionToken(account, expired)
+	assert.Error(t, err)
+
+	// User tokens are signed with the JWT secret itself and aren't sessions
+	user := &models.User{BaseModel: models.BaseModel{ID: uuid.New()}, OrganizationID: uuid.New()}
+	userToken, err := app.generateAccessToken(user)
+	require.NoError(t, err)
+	_, err = app.parseWebChatSessionToken(account, userToken)
+	assert.Error(t, err)
+}
+
+func TestWebChatIncomingMessage(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	msg, ok := webChatIncomingMessage("wc0011223344556677", WebChatSendRequest{Text: "  Hello  "}, now)
+	require.True(t, ok)
+	incoming := decodeIncoming(t, msg)
+	assert.Equal(t, "wc0011223344556677", incoming.From)
+	assert.Equal(t, "1700000000", incoming.Timestamp)
+	assert.Equal(t, "text", incoming.Type)
+	assert.Equal(t, "Hello", incoming.Text.Body)
+	assert.Contains(t, incoming.ID, "wc:")
+
+	msg, ok = webChatIncomingMessage("wc0011223344556677", WebChatSendRequest{ButtonID: "sales", ButtonTitle: "Sales"}, now)
+	require.True(t, ok)
+	incoming = decodeIncoming(t, msg)
+	assert.Equal(t, "interactive", incoming.Type)
+	assert.Equal(t, "sales", incoming.Interactive.ButtonReply.ID)
+	assert.Equal(t, "Sales", incoming.Interactive.ButtonReply.Title)
+
+	_, ok = webChatIncomingMessage("wc0011223344556677", WebChatSendRequest{Text: "   "}, now)
+	assert.False(t, ok)
+}
+
+func TestSendWebChatMessage(t *testing.T) {
+	app := &App{Log: testutil.NopLogger()}
+	account := &models.WhatsAppAccount{Channel: string(models.ChannelWebChat), Name: "Website"}
+	contact := &models.Contact{PhoneNumber: "wc0011223344556677"}
+
+	mid, err := app.sendWebChatMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: contact, Type: models.MessageTypeInteractive, InteractiveType: "button", BodyText: "Pick one",
+		Buttons: []whatsapp.Button{{ID: "yes", Title: "Yes"}},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, mid, "wc:")
+
+	_, err = app.sendWebChatMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: contact, Type: models.MessageTypeImage, MediaData: []byte("jpeg"),
+	})
+	assert.ErrorContains(t, err, "by link")
+
+	_, err = app.sendWebChatMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: contact, Type: models.MessageTypeTemplate,
+	})
+	assert.ErrorContains(t, err, "not supported on web chat")
+
+	_, err = app.sendWebChatMessage(context.Background(), OutgoingMessageRequest{
+		Account: account, Contact: &models.Contact{PhoneNumber: "15551234567"}, Type: models.MessageTypeText, Content: "Hi",
+	})
+	assert.ErrorContains(t, err, "not a web chat visitor")
+}
+
+func TestWebChatMessageFromModel(t *testing.T) {
+	msg := &models.Message{
+		WhatsAppMessageID: "wc:1",
+		Direction:         models.DirectionOutgoing,
+		MessageType:       models.MessageTypeImage,
+		Content:           "Our menu",
+		Metadata:          models.JSONB{"media_link": "https://example.com/menu.jpg"},
+	}
+	m := webChatMessageFromModel(msg)
+	assert.Equal(t, "wc:1", m.ID)
+	assert.Equal(t, "outgoing", m.Direction)
+	assert.Equal(t, "image", m.Type)
+	assert.Equal(t, "https://example.com/menu.jpg", m.MediaLink)
+}
@@ -1,15 +1,76 @@
 package handlers
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/tracing"
 	"github.com/shridarpatil/whatomate/internal/websocket"
+	"github.com/shridarpatil/whatomate/pkg/messenger"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
 )
 
+const (
+	// inboundMessagePrefix keys the IDs of inbound messages being processed
+	inboundMessagePrefix = "webhook:inbound:"
+	// inboundClaimTTL bounds how long a message is claimed while it's processed, so
+	// a worker that dies mid-message doesn't keep redeliveries from processing it
+	inboundClaimTTL = 10 * time.Minute
+	// inboundMessageTTL is how long inbound message IDs are remembered. Meta
+	// redelivers webhooks it couldn't deliver for up to 7 days.
+	inboundMessageTTL = 7 * 24 * time.Hour
+)
+
+// claimInboundMessage records that an inbound message is being processed. It reports
+// false for a message already claimed, so redeliveries of a webhook, and copies of it
+// processed at the same time by other workers, are skipped. Messages are processed
+// if Redis is unavailable; the stored message then catches redeliveries. A claimed
+// message must be released with releaseInboundMessage once it's processed.
+func (a *App) claimInboundMessage(ctx context.Context, messageID string) bool {
+	if messageID == "" || a.Redis == nil {
+		return true
+	}
+	claimed, err := a.Redis.SetNX(ctx, inboundMessagePrefix+messageID, 1, inboundClaimTTL).Result()
+	if err != nil {
+		a.log(ctx).Warn("Failed to claim inbound message, processing it anyway", "error", err, "message_id", messageID)
+		return true
+	}
+	return claimed
+}
+
+// releaseInboundMessage ends the claim on a processed inbound message. The ID of a
+// stored message is remembered for inboundMessageTTL so redeliveries are skipped;
+// otherwise the claim is dropped, so a redelivery processes the message again.
+func (a *App) releaseInboundMessage(ctx context.Context, messageID string, stored bool) {
+	if messageID == "" || a.Redis == nil {
+		return
+	}
+	var err error
+	if stored {
+		err = a.Redis.Expire(ctx, inboundMessagePrefix+messageID, inboundMessageTTL).Err()
+	} else {
+		err = a.Redis.Del(ctx, inboundMessagePrefix+messageID).Err()
+	}
+	if err != nil {
+		a.log(ctx).Warn("Failed to release inbound message", "error", err, "message_id", messageID)
+	}
+}
+
 // WebhookVerify handles Meta's webhook verification challenge
 func (a *App) WebhookVerify(r *fastglue.Request) error {
 	mode := string(r.RequestCtx.QueryArgs().Peek("hub.mode"))
@@ -22,7 +83,7 @@ func (a *App) WebhookVerify(r *fastglue.Request) error {
 	}
 
 	// First check against global config token
-	if token == a.Config.WhatsApp.WebhookVerifyToken && token != "" {
+	if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.CurrentConfig().WhatsApp.WebhookVerifyToken)) == 1 {
 		a.Log.Info("Webhook verified successfully (global token)")
 		r.RequestCtx.SetStatusCode(fasthttp.StatusOK)
 		r.RequestCtx.SetBodyString(challenge)
@@ -39,15 +100,18 @@ func (a *App) WebhookVerify(r *fastglue.Request) error {
 		return nil
 	}
 
-	a.Log.Warn("Webhook verification failed - token not found", "token", token)
+	a.Log.Warn("Webhook verification failed - token not found")
 	return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Verification failed", nil, "")
 }
 
 // WebhookStatusError represents an error in a status update
 type WebhookStatusError struct {
-	Code    int    `json:"code"`
-	Title   string `json:"title"`
-	Message string `json:"message"`
+	Code      int    `json:"code"`
+	Title     string `json:"title"`
+	Message   string `json:"message"`
+	ErrorData *struct {
+		Details string `json:"details"`
+	} `json:"error_data,omitempty"`
 }
 
 // TemplateStatusUpdate represents a template status update from Meta webhook
@@ -80,8 +144,11 @@ type WebhookStatus struct {
 type WebhookPayload struct {
 	Object string `json:"object"`
 	Entry  []struct {
-		ID      string `json:"id"`
-		Changes []struct {
+		ID string `json:"id"`
+		// Instagram DMs (when object == "instagram") or Messenger conversations (when
+		// object == "page"), for the Instagram account or Page in ID
+		Messaging []messenger.MessagingEvent `json:"messaging,omitempty"`
+		Changes   []struct {
 			Value struct {
 				MessagingProduct string `json:"messaging_product"`
 				Metadata         struct {
@@ -94,7 +161,17 @@ type WebhookPayload struct {
 				MessageTemplateName     string `json:"message_template_name,omitempty"`
 				MessageTemplateLanguage string `json:"message_template_language,omitempty"`
 				Reason                  string `json:"reason,omitempty"`
-				Contacts                []struct {
+				OtherInfo               *struct {
+					Title       string `json:"title"`
+					Description string `json:"description"`
+				} `json:"other_info,omitempty"`
+				// Template quality update fields (when field == "message_template_quality_update")
+				PreviousQualityScore string `json:"previous_quality_score,omitempty"`
+				NewQualityScore      string `json:"new_quality_score,omitempty"`
+				// Number quality update fields (when field == "phone_number_quality_update")
+				DisplayPhoneNumber string `json:"display_phone_number,omitempty"`
+				CurrentLimit       string `json:"current_limit,omitempty"`
+				Contacts           []struct {
 					Profile struct {
 						Name string `json:"name"`
 					} `json:"profile"`
@@ -148,6 +225,10 @@ type WebhookPayload struct {
 							Name         string `json:"name"`
 						} `json:"nfm_reply,omitempty"`
 					} `json:"interactive,omitempty"`
+					Button *struct {
+						Payload string `json:"payload"`
+						Text    string `json:"text"`
+					} `json:"button,omitempty"`
 					Reaction *struct {
 						MessageID string `json:"message_id"`
 						Emoji     string `json:"emoji"`
@@ -158,49 +239,243 @@ type WebhookPayload struct {
 						Name      string  `json:"name,omitempty"`
 						Address   string  `json:"address,omitempty"`
 					} `json:"location,omitempty"`
-					Contacts []struct {
-						Name struct {
-							FormattedName string `json:"formatted_name"`
-							FirstName     string `json:"first_name,omitempty"`
-							LastName      string `json:"last_name,omitempty"`
-						} `json:"name"`
-						Phones []struct {
-							Phone string `json:"phone"`
-							Type  string `json:"type,omitempty"`
-						} `json:"phones,omitempty"`
-					} `json:"contacts,omitempty"`
-					Context *struct {
+					Contacts []whatsapp.ContactCard `json:"contacts,omitempty"`
+					Context  *struct {
 						From string `json:"from"`
 						ID   string `json:"id"`
 					} `json:"context,omitempty"`
+					Edit     *IncomingMessageEdit   `json:"edit,omitempty"`
+					Revoke   *IncomingMessageRevoke `json:"revoke,omitempty"`
+					GroupID  string                 `json:"group_id,omitempty"`
+					Referral *IncomingReferral      `json:"referral,omitempty"`
+					Order    *IncomingOrder         `json:"order,omitempty"`
 				} `json:"messages,omitempty"`
 				Statuses []WebhookStatus `json:"statuses,omitempty"`
+				// Group membership changes (when field == "group_participants_update")
+				Groups []GroupParticipantsUpdate `json:"groups,omitempty"`
 			} `json:"value"`
 			Field string `json:"field"`
 		} `json:"changes"`
 	} `json:"entry"`
 }
 
-// WebhookHandler processes incoming webhook events from Meta
+// WebhookHandler acknowledges webhook events from Meta right away. Payloads are put
+// on the webhook stream for the webhook workers, so slow processing never makes Meta
+// time out and payloads survive restarts. Without workers they're processed here.
 func (a *App) WebhookHandler(r *fastglue.Request) error {
+	body := r.RequestCtx.PostBody()
 	var payload WebhookPayload
-	if err := json.Unmarshal(r.RequestCtx.PostBody(), &payload); err != nil {
-		a.Log.Error("Failed to parse webhook payload", "error", err)
+	if err := json.Unmarshal(body, &payload); err != nil {
+		a.log(r.RequestCtx).Error("Failed to parse webhook payload", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid payload", nil, "")
 	}
 
-	// Process each entry
+	ctx := tracing.FromContext(r.RequestCtx)
+	if !a.validWebhookSignature(ctx, body, string(r.RequestCtx.Request.Header.Peek("X-Hub-Signature-256")), payload) {
+		a.log(ctx).Warn("Webhook rejected - invalid signature")
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Invalid signature", nil, "")
+	}
+	return a.queueWebhook(ctx, r, body, payload)
+}
+
+// queueWebhook puts a verified webhook payload on the webhook stream, or processes
+// it when there are no webhook workers, and acknowledges it
+func (a *App) queueWebhook(ctx context.Context, r *fastglue.Request, body []byte, payload WebhookPayload) error {
+	if a.Webhooks != nil {
+		err := a.Webhooks.Enqueue(ctx, body)
+		if err == nil {
+			return r.SendEnvelope(map[string]string{"status": "ok"})
+		}
+		a.log(ctx).Error("Failed to enqueue webhook, processing it now", "error", err)
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		// Without the webhook stream nothing tries again, so failures are kept as dead letters
+		if err := a.processWebhookPayload(ctx, payload); err != nil {
+			a.DeadLetterWebhook(body, err)
+		}
+	}()
+
+	// Always respond with 200 to acknowledge receipt
+	return r.SendEnvelope(map[string]string{"status": "ok"})
+}
+
+// validWebhookSignature checks a webhook's X-Hub-Signature-256. Meta signs webhooks
+// with the secret of the app the number is subscribed through: whatsapp.app_secret,
+// or the app secret of the account an entry is for. A payload signed with
+// whatsapp.app_secret is valid; otherwise every entry must be signed with the secret
+// of each account it is for, so one tenant can't sign entries for another tenant's
+// numbers. Entries for accounts without an app secret aren't checked unless
+// whatsapp.app_secret is set, so deployments without one keep working.
+func (a *App) validWebhookSignature(ctx context.Context, body []byte, signature string, payload WebhookPayload) bool {
+	globalSecret := a.CurrentConfig().WhatsApp.AppSecret
+	if globalSecret != "" && validHubSignature(body, signature, globalSecret) {
+		return true
+	}
+	if len(payload.Entry) == 0 {
+		return globalSecret == ""
+	}
+
+	// The business and phone IDs each entry is for
+	entryBusinessIDs := make([]string, len(payload.Entry))
+	entryPhoneIDs := make([][]string, len(payload.Entry))
+	var businessIDs, phoneIDs []string
+	for i, entry := range payload.Entry {
+		if entry.ID != "" {
+			entryBusinessIDs[i] = entry.ID
+			businessIDs = append(businessIDs, entry.ID)
+		}
+		// Instagram and Page entries are for the Instagram account or Page, stored
+		// as the phone ID
+		if (payload.Object == "instagram" || payload.Object == "page") && entry.ID != "" {
+			entryPhoneIDs[i] = append(entryPhoneIDs[i], entry.ID)
+		}
+		for _, change := range entry.Changes {
+			if change.Value.Metadata.PhoneNumberID != "" {
+				entryPhoneIDs[i] = append(entryPhoneIDs[i], change.Value.Metadata.PhoneNumberID)
+			}
+		}
+		phoneIDs = append(phoneIDs, entryPhoneIDs[i]...)
+	}
+
+	var accounts []models.WhatsAppAccount
+	if len(businessIDs) > 0 || len(phoneIDs) > 0 {
+		if err := a.DB.Select("organization_id", "business_id", "phone_id", "app_secret").
+			Where("(business_id IN ? OR phone_id IN ?) AND app_secret <> ''", businessIDs, phoneIDs).
+			Find(&accounts).Error; err != nil {
+			// Without the accounts' secrets a forged webhook can't be told apart
+			a.log(ctx).Error("Failed to load app secrets to verify webhook", "error", err)
+			return false
+		}
+	}
+
+	// Whether the signature is valid for each account's secret
+	signed := make([]bool, len(accounts))
+	for i, account := range accounts {
+		secret, err := a.resolveCredential(ctx, account.OrganizationID, account.AppSecret)
+		if err != nil {
+			a.log(ctx).Error("Failed to resolve account app secret", "error", err, "organization_id", account.OrganizationID)
+			continue
+		}
+		signed[i] = validHubSignature(body, signature, secret)
+	}
+
+	for i := range payload.Entry {
+		checked := false
+		for j, account := range accounts {
+			if (entryBusinessIDs[i] != "" && account.BusinessID == entryBusinessIDs[i]) || slices.Contains(entryPhoneIDs[i], account.PhoneID) {
+				if !signed[j] {
+					return false
+				}
+				checked = true
+			}
+		}
+		if !checked && globalSecret != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// validHubSignature checks an X-Hub-Signature-256 header, the hex HMAC-SHA256 of the
+// body keyed with an app secret
+func validHubSignature(body []byte, signature, secret string) bool {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// ProcessWebhook processes a webhook payload taken off the webhook stream. Errors
+// leave the payload on the stream to be tried again.
+func (a *App) ProcessWebhook(ctx context.Context, body []byte) error {
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		// Retrying won't help a payload that can't be parsed
+		a.log(ctx).Error("Failed to parse queued webhook payload", "error", err)
+		return nil
+	}
+	return a.processWebhookPayload(ctx, payload)
+}
+
+// processWebhookPayload processes the events of a webhook payload in order. Events
+// that fail for a reason that may pass, such as the database being unavailable,
+// don't stop the rest; their errors are returned so the payload is tried again.
+// Events already processed are skipped or have no effect the second time.
+func (a *App) processWebhookPayload(ctx context.Context, payload WebhookPayload) error {
+	ctx, span := tracing.Start(ctx, "webhook.process")
+	defer span.End()
+
+	var errs []error
 	for _, entry := range payload.Entry {
+		switch payload.Object {
+		case "instagram":
+			for _, event := range entry.Messaging {
+				errs = append(errs, a.processMessengerEvent(ctx, models.ChannelInstagram, entry.ID, event))
+			}
+			continue
+		case "page":
+			for _, event := range entry.Messaging {
+				errs = append(errs, a.processMessengerEvent(ctx, models.ChannelMessenger, entry.ID, event))
+			}
+			continue
+		}
+
 		for _, change := range entry.Changes {
 			// Handle template status updates
 			if change.Field == "message_template_status_update" {
-				a.Log.Info("Received template status update",
+				a.log(ctx).Info("Received template status update",
 					"event", change.Value.Event,
 					"template_name", change.Value.MessageTemplateName,
 					"template_language", change.Value.MessageTemplateLanguage,
 					"waba_id", entry.ID,
 				)
-				go a.processTemplateStatusUpdate(entry.ID, change.Value.Event, change.Value.MessageTemplateName, change.Value.MessageTemplateLanguage, change.Value.Reason)
+				reason := change.Value.Reason
+				if change.Value.OtherInfo != nil && change.Value.OtherInfo.Description != "" {
+					// Paused templates carry the pause details in other_info instead of reason
+					reason = change.Value.OtherInfo.Title + ": " + change.Value.OtherInfo.Description
+				}
+				a.processTemplateStatusUpdate(entry.ID, change.Value.Event, change.Value.MessageTemplateName, change.Value.MessageTemplateLanguage, reason)
+				continue
+			}
+
+			// Handle template quality score changes
+			if change.Field == "message_template_quality_update" {
+				a.log(ctx).Info("Received template quality update",
+					"previous_quality_score", change.Value.PreviousQualityScore,
+					"new_quality_score", change.Value.NewQualityScore,
+					"template_name", change.Value.MessageTemplateName,
+					"template_language", change.Value.MessageTemplateLanguage,
+					"waba_id", entry.ID,
+				)
+				a.processTemplateQualityUpdate(entry.ID, change.Value.NewQualityScore, change.Value.MessageTemplateName, change.Value.MessageTemplateLanguage)
+				continue
+			}
+
+			// Handle number quality rating and messaging limit changes
+			if change.Field == "phone_number_quality_update" {
+				a.log(ctx).Info("Received phone number quality update",
+					"event", change.Value.Event,
+					"current_limit", change.Value.CurrentLimit,
+					"display_phone_number", change.Value.DisplayPhoneNumber,
+					"waba_id", entry.ID,
+				)
+				a.processNumberQualityUpdate(entry.ID)
+				continue
+			}
+
+			// Handle group membership changes
+			if change.Field == "group_participants_update" {
+				for _, update := range change.Value.Groups {
+					a.log(ctx).Info("Received group participants update",
+						"group_id", update.GroupID,
+						"added", len(update.AddedParticipants),
+						"removed", len(update.RemovedParticipants),
+					)
+					a.processGroupParticipantsUpdate(change.Value.Metadata.PhoneNumberID, update)
+				}
 				continue
 			}
 
@@ -212,7 +487,7 @@ func (a *App) WebhookHandler(r *fastglue.Request) error {
 
 			// Process messages
 			for _, msg := range change.Value.Messages {
-				a.Log.Info("Received message",
+				a.log(ctx).Info("Received message",
 					"from", msg.From,
 					"type", msg.Type,
 					"phone_number_id", phoneNumberID,
@@ -227,116 +502,283 @@ func (a *App) WebhookHandler(r *fastglue.Request) error {
 					}
 				}
 
-				// Process message asynchronously
-				go a.processIncomingMessage(phoneNumberID, msg, profileName)
+				// Group messages are kept apart from contact conversations
+				if msg.GroupID != "" {
+					a.processGroupMessage(phoneNumberID, change.Value.Metadata.DisplayPhoneNumber, msg, profileName)
+					continue
+				}
+
+				errs = append(errs, a.processIncomingMessage(ctx, phoneNumberID, msg, profileName))
 			}
 
 			// Process status updates
 			for _, status := range change.Value.Statuses {
-				a.Log.Info("Received status update",
+				a.log(ctx).Info("Received status update",
 					"message_id", status.ID,
 					"status", status.Status,
 				)
 
-				go a.processStatusUpdate(phoneNumberID, status)
+				errs = append(errs, a.processStatusUpdate(phoneNumberID, status))
 			}
 		}
 	}
-
-	// Always respond with 200 to acknowledge receipt
-	return r.SendEnvelope(map[string]string{"status": "ok"})
+	return errors.Join(errs...)
 }
 
-func (a *App) processIncomingMessage(phoneNumberID string, msg interface{}, profileName string) {
+// processIncomingMessage processes an incoming message once. It returns an error
+// when the message couldn't be processed but may be on a later try.
+func (a *App) processIncomingMessage(ctx context.Context, phoneNumberID string, msg interface{}, profileName string) error {
+	ctx, span := tracing.Start(ctx, "webhook.message", attribute.String("whatsapp.phone_number_id", phoneNumberID))
+	defer span.End()
+
 	// Convert msg interface to the message struct
 	msgBytes, err := json.Marshal(msg)
 	if err != nil {
-		a.Log.Error("Failed to marshal message", "error", err)
-		return
+		a.log(ctx).Error("Failed to marshal message", "error", err)
+		return nil
 	}
 
 	var textMsg IncomingTextMessage
 	if err := json.Unmarshal(msgBytes, &textMsg); err != nil {
-		a.Log.Error("Failed to unmarshal message", "error", err)
-		return
+		a.log(ctx).Error("Failed to unmarshal message", "error", err)
+		return nil
 	}
 
-	// Check for duplicate message - Meta sometimes sends the same message multiple times
+	// Check for duplicate message - Meta redelivers webhooks it thinks weren't received,
+	// so each message is processed once: stored messages, and messages claimed by an
+	// earlier delivery that may still be processing, are skipped
 	if textMsg.ID != "" {
 		var existingMsg models.Message
-		if err := a.DB.Where("whats_app_message_id = ?", textMsg.ID).First(&existingMsg).Error; err == nil {
-			a.Log.Debug("Duplicate message detected, skipping", "message_id", textMsg.ID)
-			return
+		if err := a.DB.WithContext(ctx).Where("whats_app_message_id = ?", textMsg.ID).First(&existingMsg).Error; err == nil ||
+			!a.claimInboundMessage(ctx, textMsg.ID) {
+			a.log(ctx).Debug("Duplicate message detected, skipping", "message_id", textMsg.ID)
+			span.SetAttributes(attribute.Bool("whatsapp.duplicate", true))
+			return nil
 		}
 	}
 
+	span.SetAttributes(
+		attribute.String("whatsapp.message_id", textMsg.ID),
+		attribute.String("whatsapp.message_type", textMsg.Type),
+	)
+
 	// Process the message with chatbot logic
-	a.processIncomingMessageFull(phoneNumberID, textMsg, profileName)
+	err = a.processIncomingMessageFull(ctx, phoneNumberID, textMsg, profileName)
+
+	if textMsg.ID != "" {
+		var stored int64
+		a.DB.WithContext(ctx).Model(&models.Message{}).Where("whats_app_message_id = ?", textMsg.ID).Count(&stored)
+		a.releaseInboundMessage(ctx, textMsg.ID, stored > 0)
+	}
+	return err
 }
 
-func (a *App) processStatusUpdate(phoneNumberID string, status WebhookStatus) {
+// processStatusUpdate applies a message status update. It returns an error when the
+// update couldn't be stored but may be on a later try.
+func (a *App) processStatusUpdate(phoneNumberID string, status WebhookStatus) error {
 	messageID := status.ID
 	statusValue := status.Status
 
 	a.Log.Info("Processing status update", "message_id", messageID, "status", statusValue, "phone_number_id", phoneNumberID)
 
-	// Update messages table - this also handles campaign stats via incrementCampaignStat
-	a.updateMessageStatus(messageID, statusValue, status.Errors)
+	// Update messages table - this also handles campaign recipients and stats
+	if err := a.updateMessageStatus(status); err != nil {
+		return err
+	}
+
+	// Meta reports the conversation and pricing category with the sent status; statements count by category
+	if status.Pricing != nil && status.Pricing.Category != "" {
+		a.updateMessagePricing(messageID, status)
+	}
+	return nil
 }
 
-// updateMessageStatus updates the status of a regular message in the messages table
-func (a *App) updateMessageStatus(whatsappMsgID, statusValue string, errors []WebhookStatusError) {
-	// Find the message by WhatsApp message ID
+// updateMessagePricing stores the pricing category and conversation Meta reported for a
+// message, records the conversation for cost reporting, and debits prepaid wallets for
+// what Meta bills
+func (a *App) updateMessagePricing(whatsappMsgID string, status WebhookStatus) {
 	var message models.Message
-	result := a.DB.Where("whats_app_message_id = ?", whatsappMsgID).First(&message)
-	if result.Error != nil {
-		a.Log.Debug("No message found for status update", "whats_app_message_id", whatsappMsgID)
+	if err := a.DB.Select("id", "organization_id", "whats_app_account", "contact_id", "pricing_category").
+		Where("whats_app_message_id = ?", whatsappMsgID).First(&message).Error; err != nil {
 		return
 	}
 
-	updates := map[string]interface{}{}
+	category := strings.ToLower(status.Pricing.Category)
+	if message.PricingCategory == "" {
+		updates := map[string]interface{}{
+			"pricing_category": category,
+		}
+		if status.Conversation != nil && status.Conversation.ID != "" {
+			updates["conversation_id"] = status.Conversation.ID
+		}
+		if err := a.DB.Model(&message).Updates(updates).Error; err != nil {
+			a.Log.Error("Failed to update message pricing", "error", err, "message_id", message.ID)
+		}
+	}
+
+	a.recordConversationCharge(&message, whatsappMsgID, status)
+
+	if status.Pricing.Billable {
+		a.chargeConversation(message.OrganizationID, category, walletChargeReference(whatsappMsgID, status))
+	}
+}
+
+// messageStatusRank orders the states an outgoing message moves through
+var messageStatusRank = map[models.MessageStatus]int{
+	models.MessageStatusPending:   0,
+	models.MessageStatusSent:      1,
+	models.MessageStatusDelivered: 2,
+	models.MessageStatusRead:      3,
+}
+
+// isMessageStatusAdvance reports whether a status update moves a message forward.
+// Meta doesn't guarantee the order of status webhooks, so a late "delivered" must
+// not overwrite "read". Only pending or sent messages can fail, and failed is final.
+func isMessageStatusAdvance(current, next models.MessageStatus) bool {
+	if current == "" {
+		current = models.MessageStatusPending
+	}
+	currentRank, ok := messageStatusRank[current]
+	if !ok {
+		return false
+	}
+	if next == models.MessageStatusFailed {
+		return currentRank <= messageStatusRank[models.MessageStatusSent]
+	}
+	nextRank, ok := messageStatusRank[next]
+	return ok && nextRank > currentRank
+}
+
+// webhookStatusError returns the Meta error code and reason of a failed status,
+// preferring the detailed reason Meta gives over the error's title
+func webhookStatusError(errors []WebhookStatusError) (int, string) {
+	if len(errors) == 0 {
+		return 0, ""
+	}
+	e := errors[0]
+	reason := e.Message
+	if e.ErrorData != nil && e.ErrorData.Details != "" {
+		reason = e.ErrorData.Details
+	}
+	if reason == "" {
+		reason = e.Title
+	}
+	return e.Code, reason
+}
+
+// webhookStatusTime returns when Meta says a status happened, in Unix seconds
+func webhookStatusTime(timestamp string) time.Time {
+	if secs, err := strconv.ParseInt(timestamp, 10, 64); err == nil && secs > 0 {
+		return time.Unix(secs, 0)
+	}
+	return time.Now()
+}
 
-	switch models.MessageStatus(statusValue) {
-	case models.MessageStatusSent:
-		updates["status"] = models.MessageStatusSent
+// messageStatusUpdates returns the columns a status update sets on a message or a
+// campaign recipient. Read messages were delivered too, if Meta skipped saying so.
+func messageStatusUpdates(status WebhookStatus, deliveredAt *time.Time) map[string]interface{} {
+	next := models.MessageStatus(status.Status)
+	at := webhookStatusTime(status.Timestamp)
+	updates := map[string]interface{}{
+		"status": next,
+	}
+	switch next {
 	case models.MessageStatusDelivered:
-		updates["status"] = models.MessageStatusDelivered
+		updates["delivered_at"] = at
 	case models.MessageStatusRead:
-		updates["status"] = models.MessageStatusRead
+		updates["read_at"] = at
+		if deliveredAt == nil {
+			updates["delivered_at"] = at
+		}
 	case models.MessageStatusFailed:
-		updates["status"] = models.MessageStatusFailed
-		if len(errors) > 0 {
-			updates["error_message"] = errors[0].Message
+		code, reason := webhookStatusError(status.Errors)
+		updates["error_code"] = code
+		updates["error_message"] = reason
+	}
+	return updates
+}
+
+// updateMessageStatus updates the status of a regular message in the messages table,
+// and of its campaign recipient for campaign messages. It returns an error when the
+// message couldn't be read or updated.
+func (a *App) updateMessageStatus(status WebhookStatus) error {
+	whatsappMsgID := status.ID
+	next := models.MessageStatus(status.Status)
+
+	// Find the message by WhatsApp message ID
+	var message models.Message
+	result := a.DB.Where("whats_app_message_id = ?", whatsappMsgID).First(&message)
+	if result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to find message for status update: %w", result.Error)
+		}
+		if a.updateGroupMessageStatus(status) {
+			return nil
 		}
+		a.Log.Debug("No message found for status update", "whats_app_message_id", whatsappMsgID)
+		return nil
+	}
+
+	switch next {
+	case models.MessageStatusSent, models.MessageStatusDelivered, models.MessageStatusRead, models.MessageStatusFailed:
 	default:
-		a.Log.Debug("Ignoring message status update", "status", statusValue)
-		return
+		a.Log.Debug("Ignoring message status update", "status", status.Status)
+		return nil
+	}
+	if !isMessageStatusAdvance(message.Status, next) {
+		a.Log.Debug("Ignoring out of order status update", "message_id", message.ID, "current", message.Status, "status", next)
+		return nil
 	}
 
-	if err := a.DB.Model(&message).Updates(updates).Error; err != nil {
-		a.Log.Error("Failed to update message status", "error", err, "message_id", message.ID)
-		return
+	updates := messageStatusUpdates(status, message.DeliveredAt)
+	// A concurrent update for the same message may have moved it on already
+	result = a.DB.Model(&message).Where("status = ?", message.Status).Updates(updates)
+	if result.Error != nil {
+		a.Log.Error("Failed to update message status", "error", result.Error, "message_id", message.ID)
+		return fmt.Errorf("failed to update message status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
 	}
 
-	a.Log.Info("Updated message status", "message_id", message.ID, "status", statusValue)
+	a.Log.Info("Updated message status", "message_id", message.ID, "status", next)
 
-	// Update campaign stats if this is a campaign message
+	// Update the recipient and stats if this is a campaign message
 	if message.Metadata != nil {
 		if campaignID, ok := message.Metadata["campaign_id"].(string); ok && campaignID != "" {
-			a.incrementCampaignStat(campaignID, statusValue)
+			a.updateCampaignRecipientStatus(campaignID, whatsappMsgID, status)
+			a.updateCampaignStats(campaignID, message.Status, next)
+		}
+	}
+
+	if next == models.MessageStatusFailed {
+		var contact models.Contact
+		if err := a.DB.Where("id = ?", message.ContactID).First(&contact).Error; err == nil {
+			code, _ := updates["error_code"].(int)
+			reason, _ := updates["error_message"].(string)
+			a.dispatchMessageFailedWebhook(message.OrganizationID, &contact, &message, code, reason)
+		}
+		if code, _ := updates["error_code"].(int); undeliverableErrorCodes[code] && message.MessageType == models.MessageTypeTemplate {
+			a.fallBackFailedTemplate(message)
 		}
 	}
 
 	// Broadcast status update via WebSocket
 	if a.WSHub != nil {
+		payload := map[string]any{
+			"message_id": message.ID.String(),
+			"status":     next,
+		}
+		if next == models.MessageStatusFailed {
+			payload["error_code"] = updates["error_code"]
+			payload["error_message"] = updates["error_message"]
+		}
 		a.WSHub.BroadcastToOrg(message.OrganizationID, websocket.WSMessage{
-			Type: websocket.TypeStatusUpdate,
-			Payload: map[string]any{
-				"message_id": message.ID.String(),
-				"status":     statusValue,
-			},
+			Type:    websocket.TypeStatusUpdate,
+			Payload: payload,
 		})
 	}
+	return nil
 }
 
 // processTemplateStatusUpdate updates template status when Meta sends a status update webhook
@@ -347,7 +789,7 @@ func (a *App) processTemplateStatusUpdate(wabaID, event, templateName, templateL
 	}
 
 	// Keep status uppercase to match existing template status format
-	// Events: APPROVED, REJECTED, PENDING, DISABLED, PENDING_DELETION, DELETED, REINSTATED, FLAGGED
+	// Events: APPROVED, REJECTED, PENDING, DISABLED, PENDING_DELETION, DELETED, REINSTATED, FLAGGED, PAUSED
 	status := strings.ToUpper(event)
 
 	// Find WhatsApp accounts that use this WABA ID (business_id field)
@@ -367,7 +809,10 @@ func (a *App) processTemplateStatusUpdate(wabaID, event, templateName, templateL
 		// Find and update the template
 		result := a.DB.Model(&models.Template{}).
 			Where("whats_app_account = ? AND name = ? AND language = ?", account.Name, templateName, templateLanguage).
-			Update("status", status)
+			Updates(map[string]interface{}{
+				"status":        status,
+				"status_reason": reason,
+			})
 
 		if result.Error != nil {
 			a.Log.Error("Failed to update template status",
@@ -387,6 +832,74 @@ func (a *App) processTemplateStatusUpdate(wabaID, event, templateName, templateL
 				"status", status,
 				"reason", reason,
 			)
+
+			// Meta paces or pauses templates whose quality is dropping; stop campaigns
+			// before further sends hurt the number's health
+			if isTemplateStatusUnsafe(status) {
+				a.pauseCampaignsForTemplate(account, templateName, templateLanguage, "Template "+strings.ToLower(status)+" by Meta")
+			}
 		}
 	}
 }
+
+// processTemplateQualityUpdate stores the quality score reported by Meta for a template
+// and pauses campaigns using it when the score drops to RED
+func (a *App) processTemplateQualityUpdate(wabaID, qualityScore, templateName, templateLanguage string) {
+	if templateName == "" {
+		a.Log.Warn("Template quality update missing template name")
+		return
+	}
+
+	qualityScore = strings.ToUpper(qualityScore)
+	if qualityScore == "" {
+		qualityScore = models.TemplateQualityUnknown
+	}
+
+	var accounts []models.WhatsAppAccount
+	if err := a.DB.Where("business_id = ?", wabaID).Find(&accounts).Error; err != nil {
+		a.Log.Error("Failed to find WhatsApp accounts for WABA", "error", err, "waba_id", wabaID)
+		return
+	}
+
+	now := time.Now()
+	for _, account := range accounts {
+		result := a.DB.Model(&models.Template{}).
+			Where("whats_app_account = ? AND name = ? AND language = ?", account.Name, templateName, templateLanguage).
+			Updates(map[string]interface{}{
+				"quality_score":      qualityScore,
+				"quality_updated_at": now,
+			})
+
+		if result.Error != nil {
+			a.Log.Error("Failed to update template quality",
+				"error", result.Error,
+				"account", account.Name,
+				"template", templateName,
+				"language", templateLanguage,
+			)
+			continue
+		}
+
+		if result.RowsAffected > 0 {
+			a.Log.Info("Updated template quality from webhook",
+				"account", account.Name,
+				"template", templateName,
+				"language", templateLanguage,
+				"quality_score", qualityScore,
+			)
+
+			if qualityScore == models.TemplateQualityRed {
+				a.pauseCampaignsForTemplate(account, templateName, templateLanguage, "Template quality dropped to low")
+			}
+		}
+	}
+}
+
+// isTemplateStatusUnsafe reports whether campaigns should stop sending a template with this status
+func isTemplateStatusUnsafe(status string) bool {
+	switch status {
+	case "PAUSED", "DISABLED", "FLAGGED":
+		return true
+	}
+	return false
+}
@@ -7,11 +7,14 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
 	"github.com/shridarpatil/whatomate/internal/models"
 )
 
@@ -36,6 +39,79 @@ type MessageEventData struct {
 	SentByUserID    string             `json:"sent_by_user_id,omitempty"`
 }
 
+// MessageFailedEventData represents data for message failed events
+type MessageFailedEventData struct {
+	MessageID       string             `json:"message_id"`
+	ContactID       string             `json:"contact_id"`
+	ContactPhone    string             `json:"contact_phone"`
+	ContactName     string             `json:"contact_name"`
+	MessageType     models.MessageType `json:"message_type"`
+	Content         string             `json:"content"`
+	TemplateName    string             `json:"template_name,omitempty"`
+	CampaignID      string             `json:"campaign_id,omitempty"`
+	ErrorCode       int                `json:"error_code,omitempty"`
+	ErrorMessage    string             `json:"error_message"`
+	WhatsAppAccount string             `json:"whatsapp_account"`
+}
+
+// ReferencedMessageData describes the message a reaction or button reply refers to
+type ReferencedMessageData struct {
+	MessageID    string             `json:"message_id"`
+	MessageType  models.MessageType `json:"message_type"`
+	Content      string             `json:"content"`
+	TemplateName string             `json:"template_name,omitempty"`
+	Direction    models.Direction   `json:"direction"`
+}
+
+// ReactionEventData represents data for message reaction events
+type ReactionEventData struct {
+	ContactID       string                `json:"contact_id"`
+	ContactPhone    string                `json:"contact_phone"`
+	ContactName     string                `json:"contact_name"`
+	Emoji           string                `json:"emoji"`
+	Message         ReferencedMessageData `json:"message"`
+	WhatsAppAccount string                `json:"whatsapp_account"`
+}
+
+// ButtonReplyEventData represents data for button tap and list selection events
+type ButtonReplyEventData struct {
+	MessageID       string                 `json:"message_id"`
+	ContactID       string                 `json:"contact_id"`
+	ContactPhone    string                 `json:"contact_phone"`
+	ContactName     string                 `json:"contact_name"`
+	ReplyType       string                 `json:"reply_type"` // button, list or template_button
+	ButtonID        string                 `json:"button_id"`
+	ButtonTitle     string                 `json:"button_title"`
+	ReplyTo         *ReferencedMessageData `json:"reply_to,omitempty"`
+	WhatsAppAccount string                 `json:"whatsapp_account"`
+}
+
+// OrderEventData represents data for order events
+type OrderEventData struct {
+	OrderID         string            `json:"order_id"`
+	MessageID       string            `json:"message_id,omitempty"`
+	ContactID       string            `json:"contact_id"`
+	ContactPhone    string            `json:"contact_phone"`
+	ContactName     string            `json:"contact_name"`
+	MetaCatalogID   string            `json:"meta_catalog_id"`
+	Note            string            `json:"note,omitempty"`
+	Items           models.JSONBArray `json:"items"`
+	Total           int64             `json:"total"`
+	Currency        string            `json:"currency"`
+	WhatsAppAccount string            `json:"whatsapp_account"`
+}
+
+// referencedMessageData describes a stored message for event data
+func referencedMessageData(m *models.Message) ReferencedMessageData {
+	return ReferencedMessageData{
+		MessageID:    m.ID.String(),
+		MessageType:  m.MessageType,
+		Content:      m.Content,
+		TemplateName: m.TemplateName,
+		Direction:    m.Direction,
+	}
+}
+
 // ContactEventData represents data for contact events
 type ContactEventData struct {
 	ContactID       string `json:"contact_id"`
@@ -44,6 +120,19 @@ type ContactEventData struct {
 	WhatsAppAccount string `json:"whatsapp_account"`
 }
 
+// CampaignEventData represents data for campaign events
+type CampaignEventData struct {
+	CampaignID      string                `json:"campaign_id"`
+	CampaignName    string                `json:"campaign_name"`
+	Status          models.CampaignStatus `json:"status"`
+	Reason          string                `json:"reason,omitempty"`
+	SentCount       int                   `json:"sent_count,omitempty"`
+	DeliveredCount  int                   `json:"delivered_count,omitempty"`
+	ReadCount       int                   `json:"read_count,omitempty"`
+	FailedCount     int                   `json:"failed_count,omitempty"`
+	WhatsAppAccount string                `json:"whatsapp_account"`
+}
+
 // TransferEventData represents data for transfer events
 type TransferEventData struct {
 	TransferID      string                `json:"transfer_id"`
@@ -57,12 +146,73 @@ type TransferEventData struct {
 	WhatsAppAccount string                `json:"whatsapp_account"`
 }
 
+// SLABreachEventData represents data for SLA breach events
+type SLABreachEventData struct {
+	TransferID         string                  `json:"transfer_id"`
+	ContactID          string                  `json:"contact_id"`
+	ContactPhone       string                  `json:"contact_phone"`
+	ContactName        string                  `json:"contact_name"`
+	AgentID            *string                 `json:"agent_id,omitempty"`
+	Priority           models.TransferPriority `json:"priority"`
+	PolicyID           string                  `json:"sla_policy_id"`
+	PolicyName         string                  `json:"sla_policy_name"`
+	ResponseDeadline   string                  `json:"sla_response_deadline,omitempty"`
+	ResolutionDeadline string                  `json:"sla_resolution_deadline,omitempty"`
+	Responded          bool                    `json:"responded"` // Whether an agent had replied
+	WhatsAppAccount    string                  `json:"whatsapp_account"`
+}
+
+// SessionHandoffEventData represents data for session handoff events
+type SessionHandoffEventData struct {
+	SessionID       string                `json:"session_id"`
+	TransferID      string                `json:"transfer_id"`
+	ContactID       string                `json:"contact_id"`
+	ContactPhone    string                `json:"contact_phone"`
+	ContactName     string                `json:"contact_name"`
+	Source          models.TransferSource `json:"source"`
+	Reason          string                `json:"reason,omitempty"`
+	AgentID         *string               `json:"agent_id,omitempty"`
+	TeamID          *string               `json:"team_id,omitempty"`
+	WhatsAppAccount string                `json:"whatsapp_account"`
+}
+
+// SentimentEventData represents data for sentiment events
+type SentimentEventData struct {
+	ContactID       string  `json:"contact_id"`
+	ContactPhone    string  `json:"contact_phone"`
+	ContactName     string  `json:"contact_name"`
+	SessionID       string  `json:"session_id"`
+	Sentiment       float64 `json:"sentiment"`
+	Threshold       float64 `json:"threshold"`
+	WhatsAppAccount string  `json:"whatsapp_account"`
+}
+
+// PaymentReceivedEventData represents data for payment received events
+type PaymentReceivedEventData struct {
+	PaymentLinkID   string                   `json:"payment_link_id"`
+	ContactID       string                   `json:"contact_id"`
+	ContactPhone    string                   `json:"contact_phone"`
+	ContactName     string                   `json:"contact_name"`
+	Provider        string                   `json:"provider"`
+	PaymentID       string                   `json:"payment_id"`
+	Amount          int64                    `json:"amount"` // In the currency's minor unit
+	Currency        string                   `json:"currency"`
+	Description     string                   `json:"description"`
+	Source          models.PaymentLinkSource `json:"source"`
+	WhatsAppAccount string                   `json:"whatsapp_account"`
+}
+
 // maxConcurrentWebhooks limits the number of concurrent webhook deliveries per dispatch
 const maxConcurrentWebhooks = 10
 
 // DispatchWebhook sends an event to all matching webhooks for the organization
+// and runs the organization's automations subscribed to it
 func (a *App) DispatchWebhook(orgID uuid.UUID, eventType models.WebhookEvent, data interface{}) {
-	a.wg.Add(1)
+	// Events of simulated conversations aren't delivered
+	if a.simulation != nil {
+		return
+	}
+	a.wg.Add(2)
 	go func() {
 		defer a.wg.Done()
 		// Use detached context with timeout for webhook delivery
@@ -70,13 +220,24 @@ func (a *App) DispatchWebhook(orgID uuid.UUID, eventType models.WebhookEvent, da
 		defer cancel()
 		a.dispatchWebhookAsync(ctx, orgID, string(eventType), data)
 	}()
+	go func() {
+		defer a.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		a.runAutomations(ctx, orgID, eventType, data)
+	}()
 }
 
 func (a *App) dispatchWebhookAsync(ctx context.Context, orgID uuid.UUID, eventType string, data interface{}) {
+	// Webhooks stop firing when the plan no longer includes them
+	if !a.HasFeature(orgID, models.PlanFeatureWebhooks) {
+		return
+	}
+
 	// Find all active webhooks for this org that subscribe to this event (use cache)
 	webhooks, err := a.getWebhooksCached(orgID)
 	if err != nil {
-		a.Log.Error("failed to fetch webhooks", "error", err)
+		a.log(ctx).Error("failed to fetch webhooks", "error", err)
 		return
 	}
 
@@ -92,7 +253,7 @@ func (a *App) dispatchWebhookAsync(ctx context.Context, orgID uuid.UUID, eventTy
 
 		// Check if context was cancelled
 		if ctx.Err() != nil {
-			a.Log.Warn("webhook dispatch cancelled", "reason", ctx.Err())
+			a.log(ctx).Warn("webhook dispatch cancelled", "reason", ctx.Err())
 			break
 		}
 
@@ -118,6 +279,18 @@ func containsEvent(events models.StringArray, event string) bool {
 	return false
 }
 
+// webhookMaxAttempts is how many times an event is sent to a webhook before its delivery fails
+const webhookMaxAttempts = 3
+
+// maxWebhookResponseBody limits how much of an endpoint's response a delivery keeps
+const maxWebhookResponseBody = 2048
+
+// webhookAttempt is the response of a webhook endpoint to one delivery attempt
+type webhookAttempt struct {
+	StatusCode int
+	Body       string
+}
+
 func (a *App) sendWebhook(ctx context.Context, webhook models.Webhook, eventType string, data interface{}) {
 	payload := OutboundWebhookPayload{
 		Event:     eventType,
@@ -127,41 +300,61 @@ func (a *App) sendWebhook(ctx context.Context, webhook models.Webhook, eventType
 
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		a.Log.Error("failed to marshal webhook payload", "error", err, "webhook_id", webhook.ID)
+		a.log(ctx).Error("failed to marshal webhook payload", "error", err, "webhook_id", webhook.ID)
 		return
 	}
 
+	// Record the delivery up front so it shows in the log while it's retried
+	var stored models.JSONB
+	_ = json.Unmarshal(jsonData, &stored)
+	delivery := models.WebhookDelivery{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		WebhookID:      webhook.ID,
+		OrganizationID: webhook.OrganizationID,
+		Event:          eventType,
+		Payload:        stored,
+		Status:         models.WebhookDeliveryStatusPending,
+	}
+	if err := a.DB.Create(&delivery).Error; err != nil {
+		a.log(ctx).Error("failed to save webhook delivery", "error", err, "webhook_id", webhook.ID)
+	}
+
 	// Retry logic with exponential backoff
-	maxRetries := 3
-	for attempt := 0; attempt < maxRetries; attempt++ {
+	for attempt := 0; attempt < webhookMaxAttempts; attempt++ {
 		// Check if context was cancelled before retry
 		if ctx.Err() != nil {
-			a.Log.Warn("webhook delivery cancelled", "reason", ctx.Err(), "webhook_id", webhook.ID)
+			a.log(ctx).Warn("webhook delivery cancelled", "reason", ctx.Err(), "webhook_id", webhook.ID)
+			a.finishWebhookDelivery(&delivery, models.WebhookDeliveryStatusFailed, "delivery cancelled: "+ctx.Err().Error())
 			return
 		}
 
 		if attempt > 0 {
-			// Exponential backoff: 1s, 2s, 4s
+			// Exponential backoff: 2s, 4s
 			select {
 			case <-ctx.Done():
-				a.Log.Warn("webhook delivery cancelled during backoff", "reason", ctx.Err(), "webhook_id", webhook.ID)
+				a.log(ctx).Warn("webhook delivery cancelled during backoff", "reason", ctx.Err(), "webhook_id", webhook.ID)
+				a.finishWebhookDelivery(&delivery, models.WebhookDeliveryStatusFailed, "delivery cancelled: "+ctx.Err().Error())
 				return
 			case <-time.After(time.Duration(1<<attempt) * time.Second):
 			}
 		}
 
-		if err := a.sendWebhookRequest(ctx, webhook, jsonData); err != nil {
-			a.Log.Warn("webhook delivery failed",
+		start := time.Now()
+		resp, err := a.sendWebhookRequest(ctx, webhook, eventType, delivery.ID, jsonData)
+		a.recordWebhookAttempt(&delivery, attempt+1, resp, err, time.Since(start))
+		if err != nil {
+			a.log(ctx).Warn("webhook delivery failed",
 				"error", err,
 				"webhook_id", webhook.ID,
 				"attempt", attempt+1,
-				"max_retries", maxRetries,
+				"max_retries", webhookMaxAttempts,
 			)
 			continue
 		}
 
 		// Success
-		a.Log.Debug("webhook delivered",
+		a.finishWebhookDelivery(&delivery, models.WebhookDeliveryStatusDelivered, "")
+		a.log(ctx).Debug("webhook delivered",
 			"webhook_id", webhook.ID,
 			"event", eventType,
 			"url", webhook.URL,
@@ -169,22 +362,70 @@ func (a *App) sendWebhook(ctx context.Context, webhook models.Webhook, eventType
 		return
 	}
 
-	a.Log.Error("webhook delivery failed after all retries",
+	a.finishWebhookDelivery(&delivery, models.WebhookDeliveryStatusFailed, delivery.ErrorMessage)
+	a.log(ctx).Error("webhook delivery failed after all retries",
 		"webhook_id", webhook.ID,
 		"event", eventType,
 		"url", webhook.URL,
 	)
 }
 
-func (a *App) sendWebhookRequest(ctx context.Context, webhook models.Webhook, jsonData []byte) error {
+// recordWebhookAttempt saves the outcome of the latest attempt on a delivery
+func (a *App) recordWebhookAttempt(delivery *models.WebhookDelivery, attempt int, resp webhookAttempt, err error, took time.Duration) {
+	delivery.Attempts = attempt
+	delivery.ResponseStatus = resp.StatusCode
+	delivery.ResponseBody = resp.Body
+	delivery.ErrorMessage = ""
+	if err != nil {
+		delivery.ErrorMessage = err.Error()
+	}
+	delivery.DurationMs = took.Milliseconds()
+
+	if err := a.DB.Model(delivery).Updates(map[string]interface{}{
+		"attempts":        delivery.Attempts,
+		"response_status": delivery.ResponseStatus,
+		"response_body":   delivery.ResponseBody,
+		"error_message":   delivery.ErrorMessage,
+		"duration_ms":     delivery.DurationMs,
+	}).Error; err != nil {
+		a.Log.Error("failed to update webhook delivery", "error", err, "delivery_id", delivery.ID)
+	}
+}
+
+// finishWebhookDelivery marks a delivery delivered or failed
+func (a *App) finishWebhookDelivery(delivery *models.WebhookDelivery, status models.WebhookDeliveryStatus, reason string) {
+	updates := map[string]interface{}{
+		"status":        status,
+		"error_message": reason,
+	}
+	if status == models.WebhookDeliveryStatusDelivered {
+		now := time.Now()
+		delivery.DeliveredAt = &now
+		updates["delivered_at"] = now
+	}
+	delivery.Status = status
+	delivery.ErrorMessage = reason
+
+	if err := a.DB.Model(delivery).Updates(updates).Error; err != nil {
+		a.Log.Error("failed to update webhook delivery", "error", err, "delivery_id", delivery.ID)
+	}
+}
+
+// sendWebhookRequest posts a payload to a webhook endpoint, signed with the webhook's
+// secret. deliveryID is left out of the headers for test events.
+func (a *App) sendWebhookRequest(ctx context.Context, webhook models.Webhook, eventType string, deliveryID uuid.UUID, jsonData []byte) (webhookAttempt, error) {
 	req, err := http.NewRequestWithContext(ctx, "POST", webhook.URL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return err
+		return webhookAttempt{}, err
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "Whatomate-Webhook/1.0")
+	req.Header.Set("X-Webhook-Event", eventType)
+	if deliveryID != uuid.Nil {
+		req.Header.Set("X-Webhook-Delivery", deliveryID.String())
+	}
 
 	// Add custom headers from webhook config
 	if webhook.Headers != nil {
@@ -202,19 +443,22 @@ func (a *App) sendWebhookRequest(ctx context.Context, webhook models.Webhook, js
 	}
 
 	// Send request (context handles timeout)
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := a.httpClient(config.OutboundWebhooks, 10*time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return webhookAttempt{}, err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBody))
+	attempt := webhookAttempt{StatusCode: resp.StatusCode, Body: strings.ToValidUTF8(string(body), "")}
+
 	// Check for successful status code (2xx)
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return &WebhookError{StatusCode: resp.StatusCode}
+		return attempt, &WebhookError{StatusCode: resp.StatusCode}
 	}
 
-	return nil
+	return attempt, nil
 }
 
 func computeHMACSignature(data []byte, secret string) string {
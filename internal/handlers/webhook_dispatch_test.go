@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeHMACSignature(t *testing.T) {
+	sig := computeHMACSignature([]byte(`{"event":"message.failed"}`), "secret")
+	assert.Equal(t, "sha256=", sig[:7])
+	assert.Len(t, sig, 7+64)
+	assert.Equal(t, sig, computeHMACSignature([]byte(`{"event":"message.failed"}`), "secret"))
+	assert.NotEqual(t, sig, computeHMACSignature([]byte(`{"event":"message.failed"}`), "other"))
+}
+
+// webhookTestFixture creates an organization with a webhook pointing at url
+func webhookTestFixture(t *testing.T, app *App, url string) models.Webhook {
+	t.Helper()
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Webhook Org " + uuid.New().String()[:8],
+		Slug:      "webhook-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+
+	webhook := models.Webhook{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		Name:           "CRM",
+		URL:            url,
+		Events:         models.StringArray{string(models.WebhookEventMessageFailed)},
+		Secret:         "secret",
+		IsActive:       true,
+	}
+	require.NoError(t, app.DB.Create(&webhook).Error)
+	return webhook
+}
+
+func TestSendWebhook_RecordsRetriedDelivery(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	var calls atomic.Int32
+	var signature, deliveryHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		signature = r.Header.Get("X-Webhook-Signature")
+		deliveryHeader = r.Header.Get("X-Webhook-Delivery")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	webhook := webhookTestFixture(t, app, server.URL)
+	app.sendWebhook(context.Background(), webhook, string(models.WebhookEventMessageFailed), map[string]string{"message_id": "m1"})
+
+	var delivery models.WebhookDelivery
+	require.NoError(t, app.DB.Where("webhook_id = ?", webhook.ID).First(&delivery).Error)
+	assert.Equal(t, models.WebhookDeliveryStatusDelivered, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.Equal(t, http.StatusOK, delivery.ResponseStatus)
+	assert.Equal(t, "ok", delivery.ResponseBody)
+	assert.Empty(t, delivery.ErrorMessage)
+	assert.NotNil(t, delivery.DeliveredAt)
+	assert.Equal(t, "message.failed", delivery.Payload["event"])
+	assert.Equal(t, delivery.ID.String(), deliveryHeader)
+	assert.NotEmpty(t, signature)
+}
+
+func TestSendWebhook_RecordsFailedDelivery(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("unknown event"))
+	}))
+	defer server.Close()
+
+	webhook := webhookTestFixture(t, app, server.URL)
+	app.sendWebhook(context.Background(), webhook, string(models.WebhookEventMessageFailed), map[string]string{"message_id": "m1"})
+
+	var delivery models.WebhookDelivery
+	require.NoError(t, app.DB.Where("webhook_id = ?", webhook.ID).First(&delivery).Error)
+	assert.Equal(t, models.WebhookDeliveryStatusFailed, delivery.Status)
+	assert.Equal(t, webhookMaxAttempts, delivery.Attempts)
+	assert.Equal(t, http.StatusBadRequest, delivery.ResponseStatus)
+	assert.Equal(t, "unknown event", delivery.ResponseBody)
+	assert.NotEmpty(t, delivery.ErrorMessage)
+	assert.Nil(t, delivery.DeliveredAt)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/tracing"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/valyala/fasthttp"
+	"github.com/zerodha/fastglue"
+)
+
+// onPremiseWebhook is a webhook from an On-Premise API server. It has the contacts,
+// messages and statuses of a Cloud API webhook's value, without the entries around them.
+type onPremiseWebhook struct {
+	Contacts json.RawMessage `json:"contacts,omitempty"`
+	Messages json.RawMessage `json:"messages,omitempty"`
+	Statuses json.RawMessage `json:"statuses,omitempty"`
+}
+
+// cloudWebhookBody wraps an On-Premise API webhook as the Cloud API webhook of the
+// account's number, so it's processed like webhooks from Meta
+func cloudWebhookBody(account *models.WhatsAppAccount, webhook onPremiseWebhook) ([]byte, error) {
+	value := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"metadata":          map[string]string{"phone_number_id": account.PhoneID},
+	}
+	if len(webhook.Contacts) > 0 {
+		value["contacts"] = webhook.Contacts
+	}
+	if len(webhook.Messages) > 0 {
+		value["messages"] = webhook.Messages
+	}
+	if len(webhook.Statuses) > 0 {
+		value["statuses"] = webhook.Statuses
+	}
+	return json.Marshal(map[string]interface{}{
+		"object": "whatsapp_business_account",
+		"entry": []map[string]interface{}{{
+			"id":      account.BusinessID,
+			"changes": []map[string]interface{}{{"field": "messages", "value": value}},
+		}},
+	})
+}
+
+// OnPremiseWebhook receives webhooks from the On-Premise API server of a number.
+// The server's webhook URL is this endpoint with the account's webhook verify token
+// as the token query parameter, as the On-Premise API doesn't sign webhooks.
+func (a *App) OnPremiseWebhook(r *fastglue.Request) error {
+	id, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Account not found", nil, "")
+	}
+
+	var account models.WhatsAppAccount
+	if err := a.DB.Where("id = ? AND api_type = ?", id, whatsapp.APITypeOnPremise).First(&account).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Account not found", nil, "")
+	}
+
+	ctx := tracing.FromContext(r.RequestCtx)
+	token := r.RequestCtx.QueryArgs().Peek("token")
+	if account.WebhookVerifyToken == "" || subtle.ConstantTimeCompare(token, []byte(account.WebhookVerifyToken)) != 1 {
+		a.log(ctx).Warn("On-Premise webhook rejected - invalid token", "account", account.Name)
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Invalid token", nil, "")
+	}
+
+	var webhook onPremiseWebhook
+	if err := json.Unmarshal(r.RequestCtx.PostBody(), &webhook); err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid payload", nil, "")
+	}
+	body, err := cloudWebhookBody(&account, webhook)
+	if err != nil {
+		a.log(ctx).Error("Failed to convert On-Premise webhook", "error", err, "account", account.Name)
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid payload", nil, "")
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		a.log(ctx).Error("Failed to parse On-Premise webhook", "error", err, "account", account.Name)
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid payload", nil, "")
+	}
+
+	return a.queueWebhook(ctx, r, body, payload)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudWebhookBody(t *testing.T) {
+	account := &models.WhatsAppAccount{PhoneID: "phone-1", BusinessID: "waba-1"}
+	var webhook onPremiseWebhook
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"contacts": [{"profile": {"name": "Kerry"}, "wa_id": "16315551234"}],
+		"messages": [{"from": "16315551234", "id": "ABGGFlA5FpafAgo6EHaSEg6q3Cgd", "timestamp": "1518694235", "type": "text", "text": {"body": "Hello"}}]
+	}`), &webhook))
+
+	body, err := cloudWebhookBody(account, webhook)
+	require.NoError(t, err)
+
+	var payload WebhookPayload
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, "whatsapp_business_account", payload.Object)
+	require.Len(t, payload.Entry, 1)
+	assert.Equal(t, "waba-1", payload.Entry[0].ID)
+	require.Len(t, payload.Entry[0].Changes, 1)
+	change := payload.Entry[0].Changes[0]
+	assert.Equal(t, "messages", change.Field)
+	assert.Equal(t, "phone-1", change.Value.Metadata.PhoneNumberID)
+	require.Len(t, change.Value.Contacts, 1)
+	assert.Equal(t, "Kerry", change.Value.Contacts[0].Profile.Name)
+	require.Len(t, change.Value.Messages, 1)
+	assert.Equal(t, "16315551234", change.Value.Messages[0].From)
+	assert.Empty(t, change.Value.Statuses)
+}
+
+func TestValidateAccountAPI(t *testing.T) {
+	assert.NoError(t, validateAccountAPI("", "", ""))
+	assert.NoError(t, validateAccountAPI(whatsapp.APITypeCloud, "", ""))
+	assert.NoError(t, validateAccountAPI(whatsapp.APITypeOnPremise, "https://waba.example.com", "token"))
+	assert.Error(t, validateAccountAPI("bsp", "", ""))
+	assert.Error(t, validateAccountAPI(whatsapp.APITypeOnPremise, "waba.example.com", "token"))
+	assert.Error(t, validateAccountAPI(whatsapp.APITypeOnPremise, "https://waba.example.com", ""))
+}
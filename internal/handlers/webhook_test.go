@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestIsTemplateStatusUnsafe(t *testing.T) {
+	assert.True(t, isTemplateStatusUnsafe("PAUSED"))
+	assert.True(t, isTemplateStatusUnsafe("DISABLED"))
+	assert.True(t, isTemplateStatusUnsafe("FLAGGED"))
+	assert.False(t, isTemplateStatusUnsafe("APPROVED"))
+	assert.False(t, isTemplateStatusUnsafe("REINSTATED"))
+}
+
+// qualityTestFixture creates an account, template and running campaign sharing a unique WABA ID.
+func qualityTestFixture(t *testing.T, app *App) (string, *models.Template, *models.BulkMessageCampaign) {
+	t.Helper()
+
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Quality Org " + uuid.New().String()[:8],
+		Slug:      "quality-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+
+	wabaID := "waba-" + uuid.New().String()[:8]
+	account := &models.WhatsAppAccount{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		Name:           "quality-account-" + uuid.New().String()[:8],
+		PhoneID:        "phone-" + uuid.New().String()[:8],
+		BusinessID:     wabaID,
+		AccessToken:    "test-token",
+		APIVersion:     "v18.0",
+		Status:         "active",
+	}
+	require.NoError(t, app.DB.Create(account).Error)
+
+	template := &models.Template{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		WhatsAppAccount: account.Name,
+		Name:            "promo_offer",
+		Language:        "en",
+		Category:        "MARKETING",
+		Status:          "APPROVED",
+		BodyContent:     "Hello {{1}}",
+	}
+	require.NoError(t, app.DB.Create(template).Error)
+
+	campaign := &models.BulkMessageCampaign{
+		BaseModel:       models.BaseModel{ID: uuid.New()},
+		OrganizationID:  org.ID,
+		WhatsAppAccount: account.Name,
+		Name:            "Promo",
+		TemplateID:      template.ID,
+		Status:          models.CampaignStatusProcessing,
+		CreatedBy:       uuid.New(),
+	}
+	require.NoError(t, app.DB.Create(campaign).Error)
+
+	return wabaID, template, campaign
+}
+
+func TestAutoPauseCampaign_OnlyPausesActiveCampaigns(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Redis:  testutil.SetupTestRedis(t),
+		Log:    testutil.NopLogger(),
+	}
+	_, _, campaign := qualityTestFixture(t, app)
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer server.Close()
+	require.NoError(t, app.DB.Create(&models.Webhook{
+		OrganizationID: campaign.OrganizationID,
+		Name:           "Campaigns",
+		URL:            server.URL,
+		Events:         models.StringArray{string(models.WebhookEventCampaignPaused)},
+		IsActive:       true,
+	}).Error)
+
+	// A campaign cancelled since it was loaded stays cancelled
+	require.NoError(t, app.DB.Model(&models.BulkMessageCampaign{}).Where("id = ?", campaign.ID).
+		Update("status", models.CampaignStatusCancelled).Error)
+	require.NoError(t, app.autoPauseCampaign(campaign, "Wallet balance is too low"))
+	app.WaitForBackgroundTasks()
+
+	var got models.BulkMessageCampaign
+	require.NoError(t, app.DB.First(&got, "id = ?", campaign.ID).Error)
+	assert.Equal(t, models.CampaignStatusCancelled, got.Status)
+	assert.Empty(t, got.PausedReason)
+	assert.Zero(t, hits.Load(), "campaign.paused isn't sent when nothing was paused")
+
+	require.NoError(t, app.DB.Model(&models.BulkMessageCampaign{}).Where("id = ?", campaign.ID).
+		Update("status", models.CampaignStatusProcessing).Error)
+	require.NoError(t, app.autoPauseCampaign(campaign, "Wallet balance is too low"))
+	app.WaitForBackgroundTasks()
+
+	require.NoError(t, app.DB.First(&got, "id = ?", campaign.ID).Error)
+	assert.Equal(t, models.CampaignStatusPaused, got.Status)
+	assert.Equal(t, "Wallet balance is too low", got.PausedReason)
+	assert.Equal(t, int32(1), hits.Load())
+}
+
+func TestProcessTemplateQualityUpdate_RedPausesCampaigns(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	wabaID, template, campaign := qualityTestFixture(t, app)
+
+	app.processTemplateQualityUpdate(wabaID, "red", template.Name, template.Language)
+	app.WaitForBackgroundTasks()
+
+	var updated models.Template
+	require.NoError(t, app.DB.Where("id = ?", template.ID).First(&updated).Error)
+	assert.Equal(t, models.TemplateQualityRed, updated.QualityScore)
+	assert.NotNil(t, updated.QualityUpdatedAt)
+
+	var paused models.BulkMessageCampaign
+	require.NoError(t, app.DB.Where("id = ?", campaign.ID).First(&paused).Error)
+	assert.Equal(t, models.CampaignStatusPaused, paused.Status)
+	assert.NotEmpty(t, paused.PausedReason)
+}
+
+func TestProcessTemplateQualityUpdate_YellowKeepsCampaignsRunning(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	wabaID, template, campaign := qualityTestFixture(t, app)
+
+	app.processTemplateQualityUpdate(wabaID, "YELLOW", template.Name, template.Language)
+
+	var running models.BulkMessageCampaign
+	require.NoError(t, app.DB.Where("id = ?", campaign.ID).First(&running).Error)
+	assert.Equal(t, models.CampaignStatusProcessing, running.Status)
+}
+
+func TestProcessTemplateStatusUpdate_PausedPausesCampaigns(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	wabaID, template, campaign := qualityTestFixture(t, app)
+
+	app.processTemplateStatusUpdate(wabaID, "PAUSED", template.Name, template.Language, "FIRST_PAUSE: low quality")
+	app.WaitForBackgroundTasks()
+
+	var updated models.Template
+	require.NoError(t, app.DB.Where("id = ?", template.ID).First(&updated).Error)
+	assert.Equal(t, "PAUSED", updated.Status)
+	assert.Equal(t, "FIRST_PAUSE: low quality", updated.StatusReason)
+
+	var paused models.BulkMessageCampaign
+	require.NoError(t, app.DB.Where("id = ?", campaign.ID).First(&paused).Error)
+	assert.Equal(t, models.CampaignStatusPaused, paused.Status)
+}
+
+func TestIsMessageStatusAdvance(t *testing.T) {
+	assert.True(t, isMessageStatusAdvance(models.MessageStatusSent, models.MessageStatusDelivered))
+	assert.True(t, isMessageStatusAdvance(models.MessageStatusSent, models.MessageStatusRead))
+	assert.True(t, isMessageStatusAdvance("", models.MessageStatusSent))
+	assert.True(t, isMessageStatusAdvance(models.MessageStatusSent, models.MessageStatusFailed))
+
+	assert.False(t, isMessageStatusAdvance(models.MessageStatusRead, models.MessageStatusDelivered), "late delivered after read")
+	assert.False(t, isMessageStatusAdvance(models.MessageStatusDelivered, models.MessageStatusDelivered), "duplicate webhook")
+	assert.False(t, isMessageStatusAdvance(models.MessageStatusDelivered, models.MessageStatusFailed))
+	assert.False(t, isMessageStatusAdvance(models.MessageStatusFailed, models.MessageStatusDelivered))
+	assert.False(t, isMessageStatusAdvance(models.MessageStatusReceived, models.MessageStatusRead))
+}
+
+func TestWebhookStatusError(t *testing.T) {
+	code, reason := webhookStatusError(nil)
+	assert.Zero(t, code)
+	assert.Empty(t, reason)
+
+	code, reason = webhookStatusError([]WebhookStatusError{{Code: 131026, Title: "Message undeliverable"}})
+	assert.Equal(t, 131026, code)
+	assert.Equal(t, "Message undeliverable", reason)
+
+	statusErr := WebhookStatusError{Code: 131047, Title: "Re-engagement message", Message: "Re-engagement message"}
+	statusErr.ErrorData = &struct {
+		Details string `json:"details"`
+	}{Details: "More than 24 hours have passed since the recipient last replied"}
+	_, reason = webhookStatusError([]WebhookStatusError{statusErr})
+	assert.Equal(t, "More than 24 hours have passed since the recipient last replied", reason)
+}
+
+func TestUpdateMessageStatus_CampaignOutOfOrder(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	_, _, campaign := qualityTestFixture(t, app)
+	require.NoError(t, app.DB.Model(campaign).Update("sent_count", 1).Error)
+
+	contact := &models.Contact{
+		OrganizationID: campaign.OrganizationID,
+		PhoneNumber:    "1555" + uuid.New().String()[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	wamid := "wamid." + uuid.New().String()
+	message := &models.Message{
+		OrganizationID:    campaign.OrganizationID,
+		WhatsAppAccount:   campaign.WhatsAppAccount,
+		ContactID:         contact.ID,
+		WhatsAppMessageID: wamid,
+		Direction:         models.DirectionOutgoing,
+		MessageType:       models.MessageTypeTemplate,
+		Status:            models.MessageStatusSent,
+		Metadata:          models.JSONB{"campaign_id": campaign.ID.String()},
+	}
+	require.NoError(t, app.DB.Create(message).Error)
+	recipient := &models.BulkMessageRecipient{
+		CampaignID:        campaign.ID,
+		PhoneNumber:       contact.PhoneNumber,
+		Status:            models.MessageStatusSent,
+		WhatsAppMessageID: wamid,
+	}
+	require.NoError(t, app.DB.Create(recipient).Error)
+
+	// Read arrives before delivered
+	app.updateMessageStatus(WebhookStatus{ID: wamid, Status: "read", Timestamp: "1767225600"})
+	app.updateMessageStatus(WebhookStatus{ID: wamid, Status: "delivered", Timestamp: "1767225500"})
+	app.updateMessageStatus(WebhookStatus{ID: wamid, Status: "failed", Errors: []WebhookStatusError{{Code: 131026, Title: "Message undeliverable"}}})
+
+	require.NoError(t, app.DB.First(message, "id = ?", message.ID).Error)
+	assert.Equal(t, models.MessageStatusRead, message.Status)
+	require.NotNil(t, message.ReadAt)
+	assert.Equal(t, int64(1767225600), message.ReadAt.Unix())
+	assert.NotNil(t, message.DeliveredAt)
+	assert.Zero(t, message.ErrorCode)
+
+	require.NoError(t, app.DB.First(recipient, "id = ?", recipient.ID).Error)
+	assert.Equal(t, models.MessageStatusRead, recipient.Status)
+	assert.NotNil(t, recipient.ReadAt)
+	assert.NotNil(t, recipient.DeliveredAt)
+
+	require.NoError(t, app.DB.First(campaign, "id = ?", campaign.ID).Error)
+	assert.Equal(t, 1, campaign.SentCount)
+	assert.Equal(t, 1, campaign.DeliveredCount)
+	assert.Equal(t, 1, campaign.ReadCount)
+	assert.Equal(t, 0, campaign.FailedCount)
+}
+
+func TestUpdateMessageStatus_FailedStoresMetaError(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+		Redis:  testutil.SetupTestRedis(t),
+	}
+	_, _, campaign := qualityTestFixture(t, app)
+
+	contact := &models.Contact{
+		OrganizationID: campaign.OrganizationID,
+		PhoneNumber:    "1555" + uuid.New().String()[:7],
+	}
+	require.NoError(t, app.DB.Create(contact).Error)
+	message := &models.Message{
+		OrganizationID:    campaign.OrganizationID,
+		WhatsAppAccount:   campaign.WhatsAppAccount,
+		ContactID:         contact.ID,
+		WhatsAppMessageID: "wamid." + uuid.New().String(),
+		Direction:         models.DirectionOutgoing,
+		MessageType:       models.MessageTypeText,
+		Status:            models.MessageStatusSent,
+	}
+	require.NoError(t, app.DB.Create(message).Error)
+
+	app.updateMessageStatus(WebhookStatus{ID: message.WhatsAppMessageID, Status: "failed", Errors: []WebhookStatusError{
+		{Code: 131026, Title: "Message undeliverable", Message: "Message undeliverable"},
+	}})
+	app.WaitForBackgroundTasks()
+
+	require.NoError(t, app.DB.First(message, "id = ?", message.ID).Error)
+	assert.Equal(t, models.MessageStatusFailed, message.Status)
+	assert.Equal(t, 131026, message.ErrorCode)
+	assert.Equal(t, "Message undeliverable", message.ErrorMessage)
+}
+
+func TestValidWebhookSignature(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	org := &models.Organization{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Name:      "Signature Org " + uuid.New().String()[:8],
+		Slug:      "signature-org-" + uuid.New().String()[:8],
+	}
+	require.NoError(t, app.DB.Create(org).Error)
+	account := &models.WhatsAppAccount{
+		BaseModel:      models.BaseModel{ID: uuid.New()},
+		OrganizationID: org.ID,
+		Name:           "signature-account-" + uuid.New().String()[:8],
+		PhoneID:        "phone-" + uuid.New().String()[:8],
+		BusinessID:     "waba-" + uuid.New().String()[:8],
+		AccessToken:    "test-token",
+		AppSecret:      "account-secret",
+		APIVersion:     "v18.0",
+		Status:         "active",
+	}
+	require.NoError(t, app.DB.Create(account).Error)
+
+	sign := func(body []byte, secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	parse := func(body []byte) WebhookPayload {
+		var payload WebhookPayload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		return payload
+	}
+	ctx := context.Background()
+
+	body := []byte(`{"object":"whatsapp_business_account","entry":[{"id":"` + account.BusinessID + `","changes":[]}]}`)
+	assert.True(t, app.validWebhookSignature(ctx, body, sign(body, "account-secret"), parse(body)))
+	assert.False(t, app.validWebhookSignature(ctx, body, sign(body, "other-secret"), parse(body)))
+	assert.False(t, app.validWebhookSignature(ctx, body, "", parse(body)))
+
+	// A forged entry ID doesn't skip the check for the number the messages are for
+	forged := []byte(`{"entry":[{"id":"waba-unknown","changes":[{"value":{"metadata":{"phone_number_id":"` + account.PhoneID + `"}}}]}]}`)
+	assert.False(t, app.validWebhookSignature(ctx, forged, "", parse(forged)))
+
+	// Not checked for accounts without an app secret, unless whatsapp.app_secret is set
+	other := []byte(`{"entry":[{"id":"waba-unknown","changes":[]}]}`)
+	assert.True(t, app.validWebhookSignature(ctx, other, "", parse(other)))
+	app.Config.WhatsApp.AppSecret = "global-secret"
+	assert.False(t, app.validWebhookSignature(ctx, other, "", parse(other)))
+	assert.True(t, app.validWebhookSignature(ctx, other, sign(other, "global-secret"), parse(other)))
+	assert.True(t, app.validWebhookSignature(ctx, body, sign(body, "account-secret"), parse(body)))
+}
+
+func TestValidWebhookSignatureMixedTenants(t *testing.T) {
+	app := &App{
+		Config: &config.Config{},
+		DB:     testutil.SetupTestDB(t),
+		Log:    testutil.NopLogger(),
+	}
+	newAccount := func(secret string) *models.WhatsAppAccount {
+		org := &models.Organization{
+			BaseModel: models.BaseModel{ID: uuid.New()},
+			Name:      "Tenant " + uuid.New().String()[:8],
+			Slug:      "tenant-" + uuid.New().String()[:8],
+		}
+		require.NoError(t, app.DB.Create(org).Error)
+		account := &models.WhatsAppAccount{
+			BaseModel:      models.BaseModel{ID: uuid.New()},
+			OrganizationID: org.ID,
+			Name:           "tenant-account-" + uuid.New().String()[:8],
+			PhoneID:        "phone-" + uuid.New().String()[:8],
+			BusinessID:     "waba-" + uuid.New().String()[:8],
+			AccessToken:    "test-token",
+			AppSecret:      secret,
+			APIVersion:     "v18.0",
+			Status:         "active",
+		}
+		require.NoError(t, app.DB.Create(account).Error)
+		return account
+	}
+	attacker := newAccount("attacker-secret")
+	victim := newAccount("victim-secret")
+
+	sign := func(body []byte, secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	parse := func(body []byte) WebhookPayload {
+		var payload WebhookPayload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		return payload
+	}
+	entry := func(account *models.WhatsAppAccount) string {
+		return `{"id":"` + account.BusinessID + `","changes":[{"value":{"metadata":{"phone_number_id":"` + account.PhoneID + `"}}}]}`
+	}
+	ctx := context.Background()
+
+	// A tenant can't sign entries for another tenant's number with its own secret
+	mixed := []byte(`{"object":"whatsapp_business_account","entry":[` + entry(attacker) + `,` + entry(victim) + `]}`)
+	assert.False(t, app.validWebhookSignature(ctx, mixed, sign(mixed, "attacker-secret"), parse(mixed)))
+	assert.False(t, app.validWebhookSignature(ctx, mixed, sign(mixed, "victim-secret"), parse(mixed)))
+
+	// Nor inside an entry for its own business ID
+	smuggled := []byte(`{"entry":[{"id":"` + attacker.BusinessID + `","changes":[{"value":{"metadata":{"phone_number_id":"` + victim.PhoneID + `"}}}]}]}`)
+	assert.False(t, app.validWebhookSignature(ctx, smuggled, sign(smuggled, "attacker-secret"), parse(smuggled)))
+
+	own := []byte(`{"entry":[` + entry(attacker) + `]}`)
+	assert.True(t, app.validWebhookSignature(ctx, own, sign(own, "attacker-secret"), parse(own)))
+
+	// whatsapp.app_secret signs for every number subscribed through the shared app
+	app.Config.WhatsApp.AppSecret = "global-secret"
+	assert.True(t, app.validWebhookSignature(ctx, mixed, sign(mixed, "global-secret"), parse(mixed)))
+	assert.False(t, app.validWebhookSignature(ctx, mixed, sign(mixed, "attacker-secret"), parse(mixed)))
+}
+
+func TestClaimInboundMessage(t *testing.T) {
+	// Without Redis, messages are always processed
+	assert.True(t, (&App{Log: testutil.NopLogger()}).claimInboundMessage(context.Background(), "wamid.any"))
+
+	redis := testutil.SetupTestRedis(t)
+	if redis == nil {
+		t.Skip("TEST_REDIS_URL not set, skipping Redis test")
+	}
+	app := &App{Log: testutil.NopLogger(), Redis: redis}
+	ctx := context.Background()
+	messageID := "wamid.claim-" + uuid.New().String()
+	defer redis.Del(ctx, inboundMessagePrefix+messageID)
+
+	assert.True(t, app.claimInboundMessage(ctx, messageID))
+	assert.False(t, app.claimInboundMessage(ctx, messageID), "a redelivery is skipped")
+	assert.True(t, app.claimInboundMessage(ctx, ""))
+	ttl := redis.TTL(ctx, inboundMessagePrefix+messageID).Val()
+	assert.LessOrEqual(t, ttl, inboundClaimTTL, "a claim only lasts while the message is processed")
+
+	// A message that failed to be stored can be processed again
+	app.releaseInboundMessage(ctx, messageID, false)
+	assert.True(t, app.claimInboundMessage(ctx, messageID))
+
+	// A stored message's ID is remembered
+	app.releaseInboundMessage(ctx, messageID, true)
+	assert.Greater(t, redis.TTL(ctx, inboundMessagePrefix+messageID).Val(), inboundClaimTTL)
+	assert.False(t, app.claimInboundMessage(ctx, messageID))
+}
+
+func TestProcessWebhook_ReturnsTransientErrors(t *testing.T) {
+	// A database that can't be reached fails every query
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1"}),
+		&gorm.Config{DisableAutomaticPing: true, Logger: logger.Discard})
+	require.NoError(t, err)
+	app := &App{Config: &config.Config{}, DB: db, Log: testutil.NopLogger()}
+
+	status := `{"object":"whatsapp_business_account","entry":[{"id":"waba","changes":[{"field":"messages",
+		"value":{"metadata":{"phone_number_id":"123"},"statuses":[{"id":"wamid.1","status":"delivered"}]}}]}]}`
+	assert.Error(t, app.ProcessWebhook(context.Background(), []byte(status)), "the payload is left on the stream to be tried again")
+
+	// Payloads that can't be parsed won't process on a later try either
+	assert.NoError(t, app.ProcessWebhook(context.Background(), []byte("not json")))
+}
@@ -3,12 +3,14 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
+	"gorm.io/gorm"
 )
 
 // WebhookRequest represents the request body for creating/updating a webhook
@@ -38,10 +40,35 @@ type WebhookResponse struct {
 var AvailableWebhookEvents = []map[string]string{
 	{"value": string(models.WebhookEventMessageIncoming), "label": "Message Incoming", "description": "When a new message is received from a contact"},
 	{"value": string(models.WebhookEventMessageSent), "label": "Message Sent", "description": "When an agent sends a message"},
+	{"value": string(models.WebhookEventMessageFailed), "label": "Message Failed", "description": "When an outgoing message fails to send or Meta reports it undelivered"},
+	{"value": string(models.WebhookEventMessageEdited), "label": "Message Edited", "description": "When a contact edits a message they sent"},
+	{"value": string(models.WebhookEventMessageDeleted), "label": "Message Deleted", "description": "When a contact deletes a message they sent"},
+	{"value": string(models.WebhookEventMessageReaction), "label": "Message Reaction", "description": "When a contact reacts to a message with an emoji"},
+	{"value": string(models.WebhookEventButtonReply), "label": "Button Reply", "description": "When a contact taps a reply button or picks a list option"},
+	{"value": string(models.WebhookEventOrderReceived), "label": "Order Received", "description": "When a contact sends a cart from a catalog"},
 	{"value": string(models.WebhookEventContactCreated), "label": "Contact Created", "description": "When a new contact is created"},
 	{"value": string(models.WebhookEventTransferCreated), "label": "Transfer Created", "description": "When a transfer to human agent is requested"},
 	{"value": string(models.WebhookEventTransferAssigned), "label": "Transfer Assigned", "description": "When a transfer is assigned to an agent"},
 	{"value": string(models.WebhookEventTransferResumed), "label": "Transfer Resumed", "description": "When chatbot is resumed (transfer closed)"},
+	{"value": string(models.WebhookEventSessionHandoff), "label": "Session Handoff", "description": "When a chatbot session is handed off to a human agent"},
+	{"value": string(models.WebhookEventSLABreached), "label": "SLA Breached", "description": "When a transfer misses the first-response or resolution target of its SLA policy"},
+	{"value": string(models.WebhookEventSentimentDropped), "label": "Sentiment Dropped", "description": "When the sentiment of a contact's recent messages drops below the chatbot threshold"},
+	{"value": string(models.WebhookEventPaymentReceived), "label": "Payment Received", "description": "When a contact pays a payment link sent by a flow or the AI"},
+	{"value": string(models.WebhookEventCampaignDone), "label": "Campaign Completed", "description": "When a campaign has sent to all its recipients"},
+	{"value": string(models.WebhookEventCampaignPaused), "label": "Campaign Paused", "description": "When a campaign is paused automatically due to template quality or plan limits"},
+	{"value": string(models.WebhookEventUsageWarning), "label": "Usage Limit Warning", "description": "When usage of a plan limit crosses the warning threshold"},
+	{"value": string(models.WebhookEventUsageLimit), "label": "Usage Limit Reached", "description": "When a plan limit is reached"},
+	{"value": string(models.WebhookEventUsageThrottled), "label": "Campaigns Throttled", "description": "When campaigns are paused to keep message usage within the plan"},
+	{"value": string(models.WebhookEventQuotaWarning), "label": "Fair-Use Quota Warning", "description": "When daily or monthly usage reaches 80% of a fair-use quota"},
+	{"value": string(models.WebhookEventQuotaReached), "label": "Fair-Use Quota Reached", "description": "When a daily or monthly fair-use quota is reached and sending is held"},
+	{"value": string(models.WebhookEventWalletLow), "label": "Wallet Low Balance", "description": "When the prepaid wallet balance drops below the alert threshold"},
+	{"value": string(models.WebhookEventWalletDepleted), "label": "Wallet Depleted", "description": "When the prepaid wallet runs out of credit and campaigns are paused"},
+	{"value": string(models.WebhookEventFailoverStarted), "label": "Failover Started", "description": "When template sends move to a backup number because a number is unavailable"},
+	{"value": string(models.WebhookEventFailoverEnded), "label": "Failover Ended", "description": "When a number recovers and template sends move back to it"},
+	{"value": string(models.WebhookEventQualityDropped), "label": "Quality Dropped", "description": "When Meta lowers the quality rating of a number"},
+	{"value": string(models.WebhookEventLimitTierChanged), "label": "Messaging Limit Changed", "description": "When the messaging limit tier of a number goes up or down"},
+	{"value": string(models.WebhookEventBudgetWarning), "label": "Conversation Budget Warning", "description": "When this month's estimated conversation costs cross the warning threshold of the budget"},
+	{"value": string(models.WebhookEventBudgetReached), "label": "Conversation Budget Reached", "description": "When this month's estimated conversation costs reach the budget"},
 }
 
 // ListWebhooks returns all webhooks for the organization
@@ -95,6 +122,10 @@ func (a *App) CreateWebhook(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
 	}
 
+	if !a.HasFeature(orgID, models.PlanFeatureWebhooks) {
+		return r.SendErrorEnvelope(fasthttp.StatusForbidden, featureUnavailableMessage(models.PlanFeatureWebhooks), nil, "")
+	}
+
 	var req WebhookRequest
 	if err := r.Decode(&req, "json"); err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid request body", nil, "")
@@ -194,7 +225,7 @@ func (a *App) UpdateWebhook(r *fastglue.Request) error {
 	return r.SendEnvelope(webhookToResponse(webhook))
 }
 
-// DeleteWebhook deletes a webhook
+// DeleteWebhook deletes a webhook and its delivery log
 func (a *App) DeleteWebhook(r *fastglue.Request) error {
 	orgID, err := getOrganizationID(r)
 	if err != nil {
@@ -206,12 +237,20 @@ func (a *App) DeleteWebhook(r *fastglue.Request) error {
 		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid webhook ID", nil, "")
 	}
 
-	result := a.DB.Where("id = ? AND organization_id = ?", webhookID, orgID).Delete(&models.Webhook{})
-	if result.Error != nil {
-		a.Log.Error("Failed to delete webhook", "error", result.Error)
+	var deleted int64
+	err = a.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND organization_id = ?", webhookID, orgID).Delete(&models.Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return tx.Where("webhook_id = ?", webhookID).Delete(&models.WebhookDelivery{}).Error
+	})
+	if err != nil {
+		a.Log.Error("Failed to delete webhook", "error", err)
 		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to delete webhook", nil, "")
 	}
-	if result.RowsAffected == 0 {
+	if deleted == 0 {
 		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Webhook not found", nil, "")
 	}
 
@@ -260,13 +299,66 @@ func (a *App) TestWebhook(r *fastglue.Request) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	if err := a.sendWebhookRequest(ctx, webhook, jsonData); err != nil {
+	if _, err := a.sendWebhookRequest(ctx, webhook, "test", uuid.Nil, jsonData); err != nil {
 		return r.SendErrorEnvelope(fasthttp.StatusBadGateway, "Webhook test failed: "+err.Error(), nil, "")
 	}
 
 	return r.SendEnvelope(map[string]string{"message": "Test webhook sent successfully"})
 }
 
+// ListWebhookDeliveries returns the deliveries of a webhook, newest first
+func (a *App) ListWebhookDeliveries(r *fastglue.Request) error {
+	orgID, err := getOrganizationID(r)
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "Unauthorized", nil, "")
+	}
+
+	webhookID, err := uuid.Parse(r.RequestCtx.UserValue("id").(string))
+	if err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusBadRequest, "Invalid webhook ID", nil, "")
+	}
+
+	var webhook models.Webhook
+	if err := a.DB.Where("id = ? AND organization_id = ?", webhookID, orgID).First(&webhook).Error; err != nil {
+		return r.SendErrorEnvelope(fasthttp.StatusNotFound, "Webhook not found", nil, "")
+	}
+
+	page, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("page")))
+	limit, _ := strconv.Atoi(string(r.RequestCtx.QueryArgs().Peek("limit")))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := a.DB.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhook.ID)
+	if status := string(r.RequestCtx.QueryArgs().Peek("status")); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if event := string(r.RequestCtx.QueryArgs().Peek("event")); event != "" {
+		query = query.Where("event = ?", event)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("created_at DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&deliveries).Error; err != nil {
+		a.Log.Error("Failed to list webhook deliveries", "error", err)
+		return r.SendErrorEnvelope(fasthttp.StatusInternalServerError, "Failed to list webhook deliveries", nil, "")
+	}
+
+	return r.SendEnvelope(map[string]interface{}{
+		"deliveries": deliveries,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+	})
+}
+
 func webhookToResponse(wh models.Webhook) WebhookResponse {
 	// Convert events
 	events := make([]string, len(wh.Events))
@@ -56,7 +56,7 @@ func (a *App) WebSocketHandler(r *fastglue.Request) error {
 // validateWSToken validates a JWT token and returns user ID and organization ID
 func (a *App) validateWSToken(tokenString string) (uuid.UUID, uuid.UUID, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &middleware.JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(a.Config.JWT.Secret), nil
+		return []byte(a.CurrentConfig().JWT.Secret), nil
 	})
 
 	if err != nil || !token.Valid {
@@ -2,12 +2,18 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/tracing"
 	"github.com/valyala/fasthttp"
 	"github.com/zerodha/fastglue"
 	"github.com/zerodha/logf"
@@ -24,6 +30,8 @@ const (
 	ContextKeyIsSuperAdmin   = "is_super_admin"
 	ContextKeyUser           = "user"
 	ContextKeyOrganization   = "organization"
+	ContextKeyAPIKey         = "api_key"   // *models.APIKey the request was authenticated with
+	ContextKeyClientIP       = "client_ip" // netip.Addr of the client, see ClientIP
 )
 
 // JWTClaims represents JWT claims
@@ -48,6 +56,146 @@ func RequestLogger(log logf.Logger) fastglue.FastMiddleware {
 	}
 }
 
+// RequestID gives every request a correlation ID, taken from the caller's
+// X-Request-ID header or generated, and returns it in the X-Request-ID response
+// header and in error envelopes. API requests are logged with the ID once handled.
+// It wraps the server's handler, so requests rejected by other middleware are
+// covered too.
+func RequestID(log logf.Logger, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		id := string(ctx.Request.Header.Peek(tracing.RequestIDHeader))
+		if !tracing.ValidRequestID(id) {
+			id = tracing.NewRequestID()
+		}
+		tracing.SetRequestID(ctx, id)
+
+		next(ctx)
+
+		ctx.Response.Header.Set(tracing.RequestIDHeader, id)
+		status := ctx.Response.StatusCode()
+		if status >= fasthttp.StatusBadRequest {
+			addRequestIDToError(ctx, id)
+		}
+
+		path := string(ctx.Path())
+		if !strings.HasPrefix(path, "/api/") {
+			return
+		}
+		fields := []any{
+			"method", string(ctx.Method()),
+			"path", path,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"request_id", id,
+		}
+		if status >= fasthttp.StatusInternalServerError {
+			log.Error("Request failed", fields...)
+		} else {
+			log.Info("Request", fields...)
+		}
+	}
+}
+
+// addRequestIDToError adds the request ID to an error envelope, so it's at hand when
+// an error is reported
+func addRequestIDToError(ctx *fasthttp.RequestCtx, id string) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(ctx.Response.Body(), &envelope); err != nil {
+		return
+	}
+	if string(envelope["status"]) != `"error"` {
+		return
+	}
+	envelope["request_id"], _ = json.Marshal(id)
+	if body, err := json.Marshal(envelope); err == nil {
+		ctx.Response.SetBody(body)
+	}
+}
+
+// ClientIP resolves the IP address of the client a request is from: the peer's
+// address, or for requests through trusted proxies, the last X-Forwarded-For address
+// that isn't one of them. Addresses in X-Forwarded-For from untrusted peers are
+// ignored, since clients can set them to anything.
+func ClientIP(trustedProxies []netip.Prefix) fastglue.FastMiddleware {
+	return func(r *fastglue.Request) *fastglue.Request {
+		r.RequestCtx.SetUserValue(ContextKeyClientIP, clientIP(r.RequestCtx, trustedProxies))
+		return r
+	}
+}
+
+func clientIP(ctx *fasthttp.RequestCtx, trustedProxies []netip.Prefix) netip.Addr {
+	addr, _ := netip.AddrFromSlice(ctx.RemoteIP())
+	addr = addr.Unmap()
+	if len(trustedProxies) == 0 || !IPAllowed(addr, trustedProxies) {
+		return addr
+	}
+	hops := strings.Split(string(ctx.Request.Header.Peek("X-Forwarded-For")), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !IPAllowed(addr, trustedProxies) {
+			break
+		}
+	}
+	return addr
+}
+
+// IPAllowed reports whether an address is in one of the allowed ranges. Any
+// address is allowed when there are no ranges.
+func IPAllowed(addr netip.Addr, allowed []netip.Prefix) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, prefix := range allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IPAllowlist only accepts API requests from the allowed ranges. Requests exempt
+// returns true for, e.g. webhooks from Meta, aren't restricted.
+func IPAllowlist(allowed []netip.Prefix, exempt func(path string) bool) fastglue.FastMiddleware {
+	return func(r *fastglue.Request) *fastglue.Request {
+		if len(allowed) == 0 || exempt(string(r.RequestCtx.Path())) {
+			return r
+		}
+		if addr := GetClientIP(r); !IPAllowed(addr, allowed) {
+			_ = SendIPNotAllowed(r, addr)
+			return nil
+		}
+		return r
+	}
+}
+
+// OrganizationIPAllowlist only accepts requests of an organization's members and
+// API keys from the ranges the organization allows. Super admins aren't restricted,
+// so they can fix a list that locks everyone else out.
+func OrganizationIPAllowlist(allowedFor func(orgID uuid.UUID) []netip.Prefix) fastglue.FastMiddleware {
+	return func(r *fastglue.Request) *fastglue.Request {
+		orgID, ok := GetOrganizationID(r)
+		if !ok || orgID == uuid.Nil || IsSuperAdmin(r) {
+			return r
+		}
+		if addr := GetClientIP(r); !IPAllowed(addr, allowedFor(orgID)) {
+			_ = SendIPNotAllowed(r, addr)
+			return nil
+		}
+		return r
+	}
+}
+
+// SendIPNotAllowed refuses a request from an IP address that isn't allowed
+func SendIPNotAllowed(r *fastglue.Request, addr netip.Addr) error {
+	return r.SendErrorEnvelope(fasthttp.StatusForbidden, "Access from your IP address is not allowed",
+		map[string]string{"reason": "ip_not_allowed", "ip": addr.String()}, "")
+}
+
 // CORS handles Cross-Origin Resource Sharing
 func CORS() fastglue.FastMiddleware {
 	return func(r *fastglue.Request) *fastglue.Request {
@@ -179,6 +327,8 @@ func validateAPIKey(r *fastglue.Request, key string, db *gorm.DB) bool {
 
 			// Set context values from the user who created the key
 			if apiKey.User != nil {
+				key := apiKey
+				r.RequestCtx.SetUserValue(ContextKeyAPIKey, &key)
 				r.RequestCtx.SetUserValue(ContextKeyUserID, apiKey.UserID)
 				r.RequestCtx.SetUserValue(ContextKeyOrganizationID, apiKey.OrganizationID)
 				r.RequestCtx.SetUserValue(ContextKeyEmail, apiKey.User.Email)
@@ -194,6 +344,113 @@ func validateAPIKey(r *fastglue.Request, key string, db *gorm.DB) bool {
 	return false
 }
 
+// apiKeySendPaths are the resources under which POST and PUT requests send messages,
+// e.g. /api/messages/template or /api/contacts/{id}/messages
+var apiKeySendPaths = map[string]bool{"messages": true, "scheduled-messages": true, "bulk-sends": true}
+
+// apiKeySendSubPaths are the sub-resources of a contact, conversation or group that send messages
+var apiKeySendSubPaths = map[string]bool{"messages": true, "typing": true}
+
+// APIKeyScopeFor returns the scope an API key needs for a request. Managing API
+// keys, and requests no other scope covers, need the admin scope.
+func APIKeyScopeFor(method, path string) models.APIKeyScope {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "api" || parts[1] == "api-keys" {
+		return models.APIKeyScopeAdmin
+	}
+
+	switch method {
+	case "GET", "HEAD":
+		return models.APIKeyScopeRead
+	case "POST", "PUT":
+		if apiKeySendPaths[parts[1]] {
+			return models.APIKeyScopeSend
+		}
+		switch parts[1] {
+		case "contacts", "conversations", "groups":
+			if len(parts) >= 4 && apiKeySendSubPaths[parts[3]] {
+				return models.APIKeyScopeSend
+			}
+		}
+	}
+
+	switch parts[1] {
+	case "contacts", "segments":
+		return models.APIKeyScopeContacts
+	}
+	return models.APIKeyScopeAdmin
+}
+
+// APIKeyAccess limits requests authenticated with an API key to the key's scopes
+// and rate limit. The limit is counted per minute in Redis and isn't enforced if
+// Redis is unavailable.
+func APIKeyAccess(rdb *redis.Client) fastglue.FastMiddleware {
+	return func(r *fastglue.Request) *fastglue.Request {
+		apiKey, ok := r.RequestCtx.UserValue(ContextKeyAPIKey).(*models.APIKey)
+		if !ok {
+			return r
+		}
+
+		scope := APIKeyScopeFor(string(r.RequestCtx.Method()), string(r.RequestCtx.Path()))
+		if !apiKey.HasScope(scope) {
+			_ = r.SendErrorEnvelope(fasthttp.StatusForbidden, fmt.Sprintf("API key does not have the %s scope", scope), nil, "")
+			return nil
+		}
+
+		if rdb == nil {
+			return r
+		}
+		limit := apiKey.RateLimit
+		if limit <= 0 {
+			limit = models.DefaultAPIKeyRateLimit
+		}
+
+		now := time.Now()
+		window := now.Unix() / 60
+		counterKey := fmt.Sprintf("ratelimit:apikey:%s:%d", apiKey.ID, window)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		count, err := rdb.Incr(ctx, counterKey).Result()
+		if err != nil {
+			return r
+		}
+		if count == 1 {
+			rdb.Expire(ctx, counterKey, 2*time.Minute)
+		}
+
+		remaining := int64(limit) - count
+		if remaining < 0 {
+			remaining = 0
+		}
+		r.RequestCtx.Response.Header.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+		r.RequestCtx.Response.Header.Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+		if count > int64(limit) {
+			r.RequestCtx.Response.Header.Set("Retry-After", strconv.FormatInt((window+1)*60-now.Unix(), 10))
+			_ = r.SendErrorEnvelope(fasthttp.StatusTooManyRequests, "API key rate limit exceeded", nil, "")
+			return nil
+		}
+
+		return r
+	}
+}
+
+// APIKeysAllowed refuses requests authenticated with an API key when the organization's
+// plan no longer includes API keys, e.g. after a downgrade
+func APIKeysAllowed(allowed func(orgID uuid.UUID) bool) fastglue.FastMiddleware {
+	return func(r *fastglue.Request) *fastglue.Request {
+		if _, ok := r.RequestCtx.UserValue(ContextKeyAPIKey).(*models.APIKey); !ok {
+			return r
+		}
+		orgID, ok := GetOrganizationID(r)
+		if !ok || allowed(orgID) {
+			return r
+		}
+
+		_ = r.SendErrorEnvelope(fasthttp.StatusUnauthorized, "API keys are not available on your plan", nil, "")
+		return nil
+	}
+}
+
 // OrganizationContext loads organization and user from database
 func OrganizationContext(db *gorm.DB) fastglue.FastMiddleware {
 	return func(r *fastglue.Request) *fastglue.Request {
@@ -278,6 +535,112 @@ func RequireAnyPermission(checker PermissionChecker, permissions ...string) fast
 	}
 }
 
+// PermissionRule maps requests under a path prefix to the permission they need.
+// Without an explicit Action, DELETE needs delete, other writes need write and GET
+// only needs read when Reads is set.
+type PermissionRule struct {
+	Prefix   string
+	Suffix   string // Only match paths ending with this, e.g. "/start"
+	Resource string
+	Action   string
+	Reads    bool
+}
+
+// PermissionMatrix lists the route permissions enforced by RBAC. Rules are matched
+// in order, so specific paths come before their prefix. Handlers that narrow results
+// by permission, like contacts and messages, check permissions themselves.
+var PermissionMatrix = []PermissionRule{
+	{Prefix: "/api/roles", Resource: models.ResourceRoles, Reads: true},
+	{Prefix: "/api/permissions", Resource: models.ResourceRoles, Reads: true},
+	{Prefix: "/api/webhooks", Resource: models.ResourceWebhooks, Reads: true},
+	{Prefix: "/api/message-hooks", Resource: models.ResourceWebhooks, Reads: true},
+	{Prefix: "/api/automations", Resource: models.ResourceWebhooks, Reads: true},
+	{Prefix: "/api/dead-letters", Resource: models.ResourceDeadLetters, Reads: true},
+	{Prefix: "/api/data-subjects/export", Resource: models.ResourceDataSubjects, Action: models.ActionRead},
+	{Prefix: "/api/data-subjects/erase", Resource: models.ResourceDataSubjects, Action: models.ActionDelete},
+	{Prefix: "/api/settings/sso", Resource: models.ResourceSettingsSSO, Reads: true},
+	{Prefix: "/api/chatbot/settings", Resource: models.ResourceSettingsChatbot},
+	{Prefix: "/api/sla-policies", Resource: models.ResourceSettingsChatbot},
+	{Prefix: "/api/shortcodes", Resource: models.ResourceSettingsChatbot},
+	{Prefix: "/api/holidays", Resource: models.ResourceSettingsChatbot},
+	{Prefix: "/api/org/settings/export", Resource: models.ResourceSettingsGeneral, Action: models.ActionWrite},
+	{Prefix: "/api/org/settings", Resource: models.ResourceSettingsGeneral},
+	{Prefix: "/api/accounts", Resource: models.ResourceAccounts},
+	{Prefix: "/api/templates/sync", Resource: models.ResourceTemplates, Action: models.ActionSync},
+	{Prefix: "/api/templates", Resource: models.ResourceTemplates},
+	{Prefix: "/api/catalogs", Suffix: "/sync", Resource: models.ResourceTemplates, Action: models.ActionSync},
+	{Prefix: "/api/catalogs", Resource: models.ResourceTemplates},
+	{Prefix: "/api/products", Resource: models.ResourceTemplates},
+	{Prefix: "/api/flows/sync", Resource: models.ResourceFlowsWhatsApp, Action: models.ActionSync},
+	{Prefix: "/api/flows", Resource: models.ResourceFlowsWhatsApp},
+	{Prefix: "/api/chatbot/flows", Resource: models.ResourceFlowsChatbot},
+	{Prefix: "/api/chatbot/simulate", Resource: models.ResourceFlowsChatbot},
+	{Prefix: "/api/chatbot/keywords", Resource: models.ResourceChatbotKeywords},
+	{Prefix: "/api/chatbot/ai-contexts", Resource: models.ResourceChatbotAI},
+	{Prefix: "/api/campaigns", Suffix: "/start", Resource: models.ResourceCampaigns, Action: models.ActionExecute},
+	{Prefix: "/api/campaigns", Suffix: "/pause", Resource: models.ResourceCampaigns, Action: models.ActionExecute},
+	{Prefix: "/api/campaigns", Suffix: "/cancel", Resource: models.ResourceCampaigns, Action: models.ActionExecute},
+	{Prefix: "/api/campaigns", Suffix: "/retry-failed", Resource: models.ResourceCampaigns, Action: models.ActionExecute},
+	{Prefix: "/api/campaigns", Suffix: "/dry-run", Resource: models.ResourceCampaigns, Action: models.ActionRead},
+	{Prefix: "/api/campaigns", Resource: models.ResourceCampaigns},
+	{Prefix: "/api/bulk-sends", Suffix: "/cancel", Resource: models.ResourceCampaigns, Action: models.ActionExecute},
+	{Prefix: "/api/bulk-sends", Resource: models.ResourceCampaigns, Reads: true},
+	{Prefix: "/api/canned-responses", Suffix: "/use", Resource: models.ResourceCannedResponses, Action: models.ActionRead},
+	{Prefix: "/api/canned-responses", Suffix: "/favorite", Resource: models.ResourceCannedResponses, Action: models.ActionRead},
+	{Prefix: "/api/canned-responses", Resource: models.ResourceCannedResponses},
+	{Prefix: "/api/custom-actions", Suffix: "/execute", Resource: models.ResourceChat, Action: models.ActionWrite},
+	{Prefix: "/api/custom-actions", Resource: models.ResourceCustomActions},
+}
+
+// RoutePermission returns the permission a request needs under the permission
+// matrix. ok is false if the matrix doesn't restrict the request.
+func RoutePermission(method, path string) (resource, action string, ok bool) {
+	for _, rule := range PermissionMatrix {
+		if path != rule.Prefix && !strings.HasPrefix(path, rule.Prefix+"/") {
+			continue
+		}
+		if rule.Suffix != "" && !strings.HasSuffix(path, rule.Suffix) {
+			continue
+		}
+		if rule.Action != "" {
+			return rule.Resource, rule.Action, true
+		}
+		switch method {
+		case "GET", "HEAD":
+			if !rule.Reads {
+				return "", "", false
+			}
+			return rule.Resource, models.ActionRead, true
+		case "DELETE":
+			return rule.Resource, models.ActionDelete, true
+		default:
+			return rule.Resource, models.ActionWrite, true
+		}
+	}
+	return "", "", false
+}
+
+// RBAC enforces the permission matrix for authenticated requests
+func RBAC(checker PermissionChecker) fastglue.FastMiddleware {
+	return func(r *fastglue.Request) *fastglue.Request {
+		if string(r.RequestCtx.Method()) == "OPTIONS" {
+			return r
+		}
+		userID, ok := r.RequestCtx.UserValue(ContextKeyUserID).(uuid.UUID)
+		if !ok {
+			return r // Public route
+		}
+
+		resource, action, ok := RoutePermission(string(r.RequestCtx.Method()), string(r.RequestCtx.Path()))
+		if ok && !checker(userID, resource, action) {
+			_ = r.SendErrorEnvelope(fasthttp.StatusForbidden, "Insufficient permissions", nil, "")
+			return nil
+		}
+
+		return r
+	}
+}
+
 // GetUserID extracts user ID from request context
 func GetUserID(r *fastglue.Request) (uuid.UUID, bool) {
 	userID, ok := r.RequestCtx.UserValue(ContextKeyUserID).(uuid.UUID)
@@ -290,6 +653,15 @@ func GetOrganizationID(r *fastglue.Request) (uuid.UUID, bool) {
 	return orgID, ok
 }
 
+// GetClientIP returns the IP address of the client a request is from, see ClientIP
+func GetClientIP(r *fastglue.Request) netip.Addr {
+	if addr, ok := r.RequestCtx.UserValue(ContextKeyClientIP).(netip.Addr); ok {
+		return addr
+	}
+	addr, _ := netip.AddrFromSlice(r.RequestCtx.RemoteIP())
+	return addr.Unmap()
+}
+
 // GetUser extracts user from request context
 func GetUser(r *fastglue.Request) (*models.User, bool) {
 	user, ok := r.RequestCtx.UserValue(ContextKeyUser).(*models.User)
@@ -307,3 +679,32 @@ func IsSuperAdmin(r *fastglue.Request) bool {
 	isSuperAdmin, ok := r.RequestCtx.UserValue(ContextKeyIsSuperAdmin).(bool)
 	return ok && isSuperAdmin
 }
+
+// TrialExpired makes organizations whose trial has ended read-only: requests that
+// change data are refused until a plan is selected. Sign-in and the user's own
+// settings stay available, and super admins are not restricted.
+func TrialExpired(isExpired func(orgID uuid.UUID) bool) fastglue.FastMiddleware {
+	return func(r *fastglue.Request) *fastglue.Request {
+		switch string(r.RequestCtx.Method()) {
+		case "GET", "HEAD", "OPTIONS":
+			return r
+		}
+
+		path := string(r.RequestCtx.Path())
+		if !strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/api/auth/") ||
+			path == "/api/me" || strings.HasPrefix(path, "/api/me/") {
+			return r
+		}
+
+		if IsSuperAdmin(r) {
+			return r
+		}
+		orgID, ok := GetOrganizationID(r)
+		if !ok || orgID == uuid.Nil || !isExpired(orgID) {
+			return r
+		}
+
+		_ = r.SendErrorEnvelope(fasthttp.StatusPaymentRequired, "Your trial has ended. Select a plan to continue.", nil, "")
+		return nil
+	}
+}
@@ -1,12 +1,17 @@
 package middleware_test
 
 import (
+	"encoding/json"
+	"net"
+	"net/netip"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/shridarpatil/whatomate/internal/middleware"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/tracing"
 	"github.com/shridarpatil/whatomate/test/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -386,6 +391,295 @@ func TestRequireAnyPermission(t *testing.T) {
 	}
 }
 
+func TestAPIKeysAllowed(t *testing.T) {
+	t.Parallel()
+
+	orgID := uuid.New()
+	notAllowed := func(id uuid.UUID) bool { return id != orgID }
+
+	req := newTestRequest()
+	req.RequestCtx.SetUserValue(middleware.ContextKeyOrganizationID, orgID)
+	assert.NotNil(t, middleware.APIKeysAllowed(notAllowed)(req), "requests without an API key are allowed")
+
+	req = newTestRequest()
+	req.RequestCtx.SetUserValue(middleware.ContextKeyOrganizationID, orgID)
+	req.RequestCtx.SetUserValue(middleware.ContextKeyAPIKey, &models.APIKey{OrganizationID: orgID})
+	assert.Nil(t, middleware.APIKeysAllowed(notAllowed)(req))
+	assert.Equal(t, fasthttp.StatusUnauthorized, req.RequestCtx.Response.StatusCode())
+
+	req = newTestRequest()
+	req.RequestCtx.SetUserValue(middleware.ContextKeyOrganizationID, uuid.New())
+	req.RequestCtx.SetUserValue(middleware.ContextKeyAPIKey, &models.APIKey{})
+	assert.NotNil(t, middleware.APIKeysAllowed(notAllowed)(req))
+}
+
+func TestTrialExpired(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		superAdmin  bool
+		expired     bool
+		wantAllowed bool
+	}{
+		{name: "active trial allowed", method: "POST", path: "/api/messages", wantAllowed: true},
+		{name: "expired trial write denied", method: "POST", path: "/api/messages", expired: true, wantAllowed: false},
+		{name: "expired trial delete denied", method: "DELETE", path: "/api/contacts/1", expired: true, wantAllowed: false},
+		{name: "expired trial read allowed", method: "GET", path: "/api/contacts", expired: true, wantAllowed: true},
+		{name: "expired trial auth allowed", method: "POST", path: "/api/auth/logout", expired: true, wantAllowed: true},
+		{name: "expired trial own settings allowed", method: "PUT", path: "/api/me/settings", expired: true, wantAllowed: true},
+		{name: "super admin allowed", method: "POST", path: "/api/messages", superAdmin: true, expired: true, wantAllowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			orgID := uuid.New()
+			req := newTestRequest()
+			req.RequestCtx.Request.Header.SetMethod(tt.method)
+			req.RequestCtx.Request.SetRequestURI(tt.path)
+			req.RequestCtx.SetUserValue(middleware.ContextKeyOrganizationID, orgID)
+			req.RequestCtx.SetUserValue(middleware.ContextKeyIsSuperAdmin, tt.superAdmin)
+
+			isExpired := func(id uuid.UUID) bool {
+				return id == orgID && tt.expired
+			}
+
+			result := middleware.TrialExpired(isExpired)(req)
+
+			if tt.wantAllowed {
+				assert.NotNil(t, result, "should allow access")
+			} else {
+				assert.Nil(t, result, "should deny access")
+				assert.Equal(t, fasthttp.StatusPaymentRequired, req.RequestCtx.Response.StatusCode())
+			}
+		})
+	}
+}
+
+func TestAPIKeyScopeFor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		method string
+		path   string
+		want   models.APIKeyScope
+	}{
+		{"GET", "/api/contacts", models.APIKeyScopeRead},
+		{"GET", "/api/messages/123", models.APIKeyScopeRead},
+		{"POST", "/api/messages/template", models.APIKeyScopeSend},
+		{"POST", "/api/contacts/123/messages", models.APIKeyScopeSend},
+		{"POST", "/api/conversations/123/typing", models.APIKeyScopeSend},
+		{"POST", "/api/contacts", models.APIKeyScopeContacts},
+		{"DELETE", "/api/contacts/123", models.APIKeyScopeContacts},
+		{"PUT", "/api/segments/123", models.APIKeyScopeContacts},
+		{"POST", "/api/bulk-sends", models.APIKeyScopeSend},
+		{"GET", "/api/bulk-sends/123", models.APIKeyScopeRead},
+		{"POST", "/api/campaigns", models.APIKeyScopeAdmin},
+		{"GET", "/api/api-keys", models.APIKeyScopeAdmin},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, middleware.APIKeyScopeFor(tt.method, tt.path), "%s %s", tt.method, tt.path)
+	}
+}
+
+func TestAPIKeyAccess_Scopes(t *testing.T) {
+	t.Parallel()
+
+	apiKey := &models.APIKey{Scopes: models.StringArray{"read", "send"}}
+
+	newKeyRequest := func(method, path string) *fastglue.Request {
+		req := newTestRequest()
+		req.RequestCtx.Request.Header.SetMethod(method)
+		req.RequestCtx.Request.SetRequestURI(path)
+		req.RequestCtx.SetUserValue(middleware.ContextKeyAPIKey, apiKey)
+		return req
+	}
+
+	assert.NotNil(t, middleware.APIKeyAccess(nil)(newKeyRequest("GET", "/api/contacts")))
+	assert.NotNil(t, middleware.APIKeyAccess(nil)(newKeyRequest("POST", "/api/messages/template")))
+
+	req := newKeyRequest("POST", "/api/contacts")
+	assert.Nil(t, middleware.APIKeyAccess(nil)(req))
+	assert.Equal(t, fasthttp.StatusForbidden, req.RequestCtx.Response.StatusCode())
+
+	// Requests authenticated with a JWT are not restricted
+	jwtReq := newTestRequest()
+	jwtReq.RequestCtx.Request.Header.SetMethod("DELETE")
+	jwtReq.RequestCtx.Request.SetRequestURI("/api/campaigns/1")
+	assert.NotNil(t, middleware.APIKeyAccess(nil)(jwtReq))
+}
+
+func TestAPIKeyAccess_RateLimit(t *testing.T) {
+	rdb := testutil.SetupTestRedis(t)
+	if rdb == nil {
+		t.Skip("TEST_REDIS_URL not set")
+	}
+
+	apiKey := &models.APIKey{
+		BaseModel: models.BaseModel{ID: uuid.New()},
+		Scopes:    models.StringArray{"read"},
+		RateLimit: 2,
+	}
+
+	var last *fastglue.Request
+	for i := 0; i < 3; i++ {
+		last = newTestRequest()
+		last.RequestCtx.Request.Header.SetMethod("GET")
+		last.RequestCtx.Request.SetRequestURI("/api/contacts")
+		last.RequestCtx.SetUserValue(middleware.ContextKeyAPIKey, apiKey)
+		result := middleware.APIKeyAccess(rdb)(last)
+		if i < 2 {
+			require.NotNil(t, result, "request %d should be allowed", i+1)
+		} else {
+			assert.Nil(t, result, "request over the limit should be denied")
+		}
+	}
+
+	assert.Equal(t, fasthttp.StatusTooManyRequests, last.RequestCtx.Response.StatusCode())
+	assert.Equal(t, "2", string(last.RequestCtx.Response.Header.Peek("X-RateLimit-Limit")))
+	assert.Equal(t, "0", string(last.RequestCtx.Response.Header.Peek("X-RateLimit-Remaining")))
+	assert.NotEmpty(t, last.RequestCtx.Response.Header.Peek("Retry-After"))
+}
+
+func TestRoutePermission(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		method       string
+		path         string
+		wantResource string
+		wantAction   string
+		wantOK       bool
+	}{
+		{"PUT", "/api/chatbot/settings", models.ResourceSettingsChatbot, models.ActionWrite, true},
+		{"GET", "/api/chatbot/settings", "", "", false},
+		{"DELETE", "/api/sla-policies/123", models.ResourceSettingsChatbot, models.ActionDelete, true},
+		{"POST", "/api/org/settings/notifications/test", models.ResourceSettingsGeneral, models.ActionWrite, true},
+		{"GET", "/api/org/settings/export", models.ResourceSettingsGeneral, models.ActionWrite, true},
+		{"POST", "/api/org/settings/import", models.ResourceSettingsGeneral, models.ActionWrite, true},
+		{"POST", "/api/chatbot/simulate", models.ResourceFlowsChatbot, models.ActionWrite, true},
+		{"GET", "/api/roles", models.ResourceRoles, models.ActionRead, true},
+		{"DELETE", "/api/webhooks/123", models.ResourceWebhooks, models.ActionDelete, true},
+		{"GET", "/api/message-hooks", models.ResourceWebhooks, models.ActionRead, true},
+		{"PUT", "/api/message-hooks/123", models.ResourceWebhooks, models.ActionWrite, true},
+		{"POST", "/api/dead-letters/retry", models.ResourceDeadLetters, models.ActionWrite, true},
+		{"POST", "/api/data-subjects/export", models.ResourceDataSubjects, models.ActionRead, true},
+		{"POST", "/api/data-subjects/erase", models.ResourceDataSubjects, models.ActionDelete, true},
+		{"POST", "/api/campaigns/123/start", models.ResourceCampaigns, models.ActionExecute, true},
+		{"POST", "/api/campaigns", models.ResourceCampaigns, models.ActionWrite, true},
+		{"POST", "/api/campaigns/123/dry-run", models.ResourceCampaigns, models.ActionRead, true},
+		{"POST", "/api/bulk-sends/123/cancel", models.ResourceCampaigns, models.ActionExecute, true},
+		{"GET", "/api/bulk-sends/123", models.ResourceCampaigns, models.ActionRead, true},
+		{"POST", "/api/templates/sync", models.ResourceTemplates, models.ActionSync, true},
+		{"POST", "/api/canned-responses/123/use", models.ResourceCannedResponses, models.ActionRead, true},
+		{"DELETE", "/api/canned-responses/123/favorite", models.ResourceCannedResponses, models.ActionRead, true},
+		{"POST", "/api/custom-actions/123/execute", models.ResourceChat, models.ActionWrite, true},
+		{"POST", "/api/shortcodes", models.ResourceSettingsChatbot, models.ActionWrite, true},
+		{"GET", "/api/shortcodes", "", "", false},
+		{"POST", "/api/holidays/import", models.ResourceSettingsChatbot, models.ActionWrite, true},
+		{"DELETE", "/api/holidays/123", models.ResourceSettingsChatbot, models.ActionDelete, true},
+		{"GET", "/api/automations/123/logs", models.ResourceWebhooks, models.ActionRead, true},
+		{"PUT", "/api/automations/123", models.ResourceWebhooks, models.ActionWrite, true},
+		{"POST", "/api/catalogs/sync", models.ResourceTemplates, models.ActionSync, true},
+		{"POST", "/api/catalogs/123/sync", models.ResourceTemplates, models.ActionSync, true},
+		{"POST", "/api/catalogs/123/products", models.ResourceTemplates, models.ActionWrite, true},
+		{"DELETE", "/api/products/123", models.ResourceTemplates, models.ActionDelete, true},
+		{"POST", "/api/contacts", "", "", false},
+		{"POST", "/api/rolesets", "", "", false},
+	}
+
+	for _, tt := range tests {
+		resource, action, ok := middleware.RoutePermission(tt.method, tt.path)
+		assert.Equal(t, tt.wantOK, ok, "%s %s", tt.method, tt.path)
+		assert.Equal(t, tt.wantResource, resource, "%s %s", tt.method, tt.path)
+		if ok {
+			assert.Equal(t, tt.wantAction, action, "%s %s", tt.method, tt.path)
+		}
+	}
+}
+
+func TestRBAC(t *testing.T) {
+	t.Parallel()
+
+	// A manager can edit templates but not chatbot settings
+	checker := func(userID uuid.UUID, resource, action string) bool {
+		return resource == models.ResourceTemplates
+	}
+
+	newUserRequest := func(method, path string) *fastglue.Request {
+		req := newTestRequest()
+		req.RequestCtx.Request.Header.SetMethod(method)
+		req.RequestCtx.Request.SetRequestURI(path)
+		req.RequestCtx.SetUserValue(middleware.ContextKeyUserID, uuid.New())
+		return req
+	}
+
+	assert.NotNil(t, middleware.RBAC(checker)(newUserRequest("PUT", "/api/templates/1")))
+	assert.NotNil(t, middleware.RBAC(checker)(newUserRequest("GET", "/api/chatbot/settings")))
+
+	req := newUserRequest("PUT", "/api/chatbot/settings")
+	assert.Nil(t, middleware.RBAC(checker)(req))
+	assert.Equal(t, fasthttp.StatusForbidden, req.RequestCtx.Response.StatusCode())
+}
+
+func TestRBAC_ViewerCannotWrite(t *testing.T) {
+	t.Parallel()
+
+	viewer := map[string]bool{}
+	for _, perm := range models.SystemRolePermissions()["viewer"] {
+		viewer[perm] = true
+	}
+	checker := func(userID uuid.UUID, resource, action string) bool {
+		return viewer[resource+":"+action]
+	}
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{"POST", "/api/shortcodes"},
+		{"PUT", "/api/shortcodes/123"},
+		{"DELETE", "/api/shortcodes/123"},
+		{"POST", "/api/holidays"},
+		{"POST", "/api/holidays/import"},
+		{"DELETE", "/api/holidays/123"},
+		{"POST", "/api/automations"},
+		{"PUT", "/api/automations/123"},
+		{"DELETE", "/api/automations/123"},
+		{"POST", "/api/catalogs"},
+		{"DELETE", "/api/catalogs/123"},
+		{"POST", "/api/catalogs/sync"},
+		{"POST", "/api/catalogs/123/sync"},
+		{"POST", "/api/catalogs/123/products"},
+		{"PUT", "/api/products/123"},
+		{"DELETE", "/api/products/123"},
+	}
+
+	for _, tt := range tests {
+		req := newTestRequest()
+		req.RequestCtx.Request.Header.SetMethod(tt.method)
+		req.RequestCtx.Request.SetRequestURI(tt.path)
+		req.RequestCtx.SetUserValue(middleware.ContextKeyUserID, uuid.New())
+
+		assert.Nil(t, middleware.RBAC(checker)(req), "%s %s", tt.method, tt.path)
+		assert.Equal(t, fasthttp.StatusForbidden, req.RequestCtx.Response.StatusCode(), "%s %s", tt.method, tt.path)
+	}
+
+	// Viewers can still read catalogs and products
+	for _, path := range []string{"/api/catalogs", "/api/catalogs/123/products", "/api/products/123"} {
+		req := newTestRequest()
+		req.RequestCtx.Request.Header.SetMethod("GET")
+		req.RequestCtx.Request.SetRequestURI(path)
+		req.RequestCtx.SetUserValue(middleware.ContextKeyUserID, uuid.New())
+		assert.NotNil(t, middleware.RBAC(checker)(req), path)
+	}
+}
+
 func TestGetUserID(t *testing.T) {
 	t.Parallel()
 
@@ -468,6 +762,51 @@ func TestRequestLogger(t *testing.T) {
 	assert.WithinDuration(t, time.Now(), startTime, time.Second)
 }
 
+func TestRequestID(t *testing.T) {
+	t.Parallel()
+
+	var handlerID string
+	handler := middleware.RequestID(testutil.NopLogger(), func(ctx *fasthttp.RequestCtx) {
+		handlerID = tracing.RequestID(ctx)
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		ctx.SetContentType("application/json")
+		ctx.SetBodyString(`{"status":"error","message":"Contact not found","data":null}`)
+	})
+
+	t.Run("generates an ID", func(t *testing.T) {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/api/contacts/1")
+		handler(ctx)
+
+		id := string(ctx.Response.Header.Peek(tracing.RequestIDHeader))
+		require.NotEmpty(t, id)
+		assert.Equal(t, id, handlerID)
+
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(ctx.Response.Body(), &body))
+		assert.Equal(t, id, body["request_id"])
+		assert.Equal(t, "Contact not found", body["message"])
+	})
+
+	t.Run("keeps the caller's ID", func(t *testing.T) {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/api/contacts/1")
+		ctx.Request.Header.Set(tracing.RequestIDHeader, "lb-7f3a9c")
+		handler(ctx)
+		assert.Equal(t, "lb-7f3a9c", string(ctx.Response.Header.Peek(tracing.RequestIDHeader)))
+	})
+
+	t.Run("replaces unsafe IDs", func(t *testing.T) {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/api/contacts/1")
+		ctx.Request.Header.Set(tracing.RequestIDHeader, "id\" injected")
+		handler(ctx)
+		id := string(ctx.Response.Header.Peek(tracing.RequestIDHeader))
+		assert.NotEqual(t, "id\" injected", id)
+		assert.True(t, tracing.ValidRequestID(id))
+	})
+}
+
 func TestJWTClaims(t *testing.T) {
 	t.Parallel()
 
@@ -570,3 +909,86 @@ func generateTokenWithSecret(t *testing.T, secret string) string {
 	require.NoError(t, err)
 	return tokenString
 }
+
+// newRequestFrom creates a request for a path from a peer address.
+func newRequestFrom(path, peer string) *fastglue.Request {
+	req := newTestRequest()
+	req.RequestCtx.Request.SetRequestURI(path)
+	req.RequestCtx.SetRemoteAddr(&net.TCPAddr{IP: net.ParseIP(peer), Port: 40000})
+	return req
+}
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name    string
+		peer    string
+		xff     string
+		proxies []netip.Prefix
+		want    string
+	}{
+		{name: "no proxies", peer: "203.0.113.7", xff: "198.51.100.1", want: "203.0.113.7"},
+		{name: "untrusted peer", peer: "203.0.113.7", xff: "198.51.100.1", proxies: proxies, want: "203.0.113.7"},
+		{name: "trusted proxy", peer: "10.0.0.2", xff: "198.51.100.1", proxies: proxies, want: "198.51.100.1"},
+		{name: "spoofed hop before the client", peer: "10.0.0.2", xff: "192.0.2.1, 198.51.100.1, 10.0.0.3", proxies: proxies, want: "198.51.100.1"},
+		{name: "proxy without header", peer: "10.0.0.2", proxies: proxies, want: "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req := newRequestFrom("/api/me", tt.peer)
+			if tt.xff != "" {
+				req.RequestCtx.Request.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			require.NotNil(t, middleware.ClientIP(tt.proxies)(req))
+			assert.Equal(t, tt.want, middleware.GetClientIP(req).String())
+		})
+	}
+}
+
+func TestIPAllowlist(t *testing.T) {
+	t.Parallel()
+
+	allowed := []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")}
+	exempt := func(path string) bool { return path == "/api/webhook" }
+
+	assert.NotNil(t, middleware.IPAllowlist(allowed, exempt)(newRequestFrom("/api/me", "203.0.113.7")))
+	assert.NotNil(t, middleware.IPAllowlist(allowed, exempt)(newRequestFrom("/api/webhook", "198.51.100.1")))
+	assert.NotNil(t, middleware.IPAllowlist(nil, exempt)(newRequestFrom("/api/me", "198.51.100.1")))
+
+	denied := newRequestFrom("/api/me", "198.51.100.1")
+	assert.Nil(t, middleware.IPAllowlist(allowed, exempt)(denied))
+	assert.Equal(t, fasthttp.StatusForbidden, denied.RequestCtx.Response.StatusCode())
+	var body struct {
+		Data map[string]string `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(denied.RequestCtx.Response.Body(), &body))
+	assert.Equal(t, map[string]string{"reason": "ip_not_allowed", "ip": "198.51.100.1"}, body.Data)
+}
+
+func TestOrganizationIPAllowlist(t *testing.T) {
+	t.Parallel()
+
+	orgID := uuid.New()
+	allowedFor := func(id uuid.UUID) []netip.Prefix {
+		if id == orgID {
+			return []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")}
+		}
+		return nil
+	}
+	request := func(peer string, org uuid.UUID, superAdmin bool) *fastglue.Request {
+		req := newRequestFrom("/api/contacts", peer)
+		req.RequestCtx.SetUserValue(middleware.ContextKeyOrganizationID, org)
+		req.RequestCtx.SetUserValue(middleware.ContextKeyIsSuperAdmin, superAdmin)
+		return req
+	}
+
+	assert.NotNil(t, middleware.OrganizationIPAllowlist(allowedFor)(request("203.0.113.7", orgID, false)))
+	assert.Nil(t, middleware.OrganizationIPAllowlist(allowedFor)(request("198.51.100.1", orgID, false)))
+	assert.NotNil(t, middleware.OrganizationIPAllowlist(allowedFor)(request("198.51.100.1", orgID, true)), "super admins aren't restricted")
+	assert.NotNil(t, middleware.OrganizationIPAllowlist(allowedFor)(request("198.51.100.1", uuid.New(), false)), "organizations without a list allow any IP")
+	assert.NotNil(t, middleware.OrganizationIPAllowlist(allowedFor)(newRequestFrom("/api/auth/login", "198.51.100.1")), "public routes aren't restricted")
+}
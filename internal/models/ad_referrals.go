@@ -0,0 +1,32 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// AdReferral is the ad or post a contact clicked to start a conversation, from the
+// referral on a click-to-WhatsApp message
+type AdReferral struct {
+	BaseModel
+	OrganizationID    uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
+	WhatsAppAccount   string    `gorm:"size:100;index" json:"whatsapp_account"` // References WhatsAppAccount.Name
+	ContactID         uuid.UUID `gorm:"type:uuid;index;not null" json:"contact_id"`
+	WhatsAppMessageID string    `gorm:"column:whats_app_message_id;size:255;index" json:"whatsapp_message_id"` // The message that carried the referral
+	SourceID          string    `gorm:"size:255;index" json:"source_id"`                                       // Ad or post ID
+	SourceType        string    `gorm:"size:20" json:"source_type"`                                            // ad, post
+	SourceURL         string    `gorm:"type:text" json:"source_url"`
+	Headline          string    `gorm:"type:text" json:"headline"`
+	Body              string    `gorm:"type:text" json:"body"`
+	MediaType         string    `gorm:"size:20" json:"media_type"` // image, video
+	MediaURL          string    `gorm:"type:text" json:"media_url"`
+	ThumbnailURL      string    `gorm:"type:text" json:"thumbnail_url"`
+	CtwaClid          string    `gorm:"size:255" json:"ctwa_clid"`           // Click ID for the Conversions API
+	IsNewContact      bool      `gorm:"default:false" json:"is_new_contact"` // The contact first wrote through this ad
+
+	// Relations
+	Contact *Contact `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+}
+
+func (AdReferral) TableName() string {
+	return "ad_referrals"
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// AIModerationLog records an AI response that was blocked by moderation, for review
+type AIModerationLog struct {
+	BaseModel
+	OrganizationID  uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
+	WhatsAppAccount string     `gorm:"size:100" json:"whatsapp_account"` // References WhatsAppAccount.Name
+	SessionID       *uuid.UUID `gorm:"type:uuid" json:"session_id,omitempty"`
+	ContactID       *uuid.UUID `gorm:"type:uuid" json:"contact_id,omitempty"`
+	PhoneNumber     string     `gorm:"size:50" json:"phone_number"`
+	Provider        AIProvider `gorm:"size:20" json:"provider"` // Provider and model that generated the response
+	Model           string     `gorm:"size:100" json:"model"`
+	UserMessage     string     `gorm:"type:text" json:"user_message"`
+	Response        string     `gorm:"type:text" json:"response"` // The blocked response
+	Reason          string     `gorm:"type:text" json:"reason"`   // e.g. blocklist "refund guaranteed" or openai: harassment
+}
+
+func (AIModerationLog) TableName() string {
+	return "ai_moderation_logs"
+}
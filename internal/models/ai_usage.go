@@ -0,0 +1,22 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// AIUsage records the tokens used by an AI call
+type AIUsage struct {
+	BaseModel
+	OrganizationID   uuid.UUID  `gorm:"type:uuid;not null;index:idx_ai_usage_org_period" json:"organization_id"`
+	Period           string     `gorm:"size:7;not null;index:idx_ai_usage_org_period" json:"period"` // YYYY-MM, UTC
+	WhatsAppAccount  string     `gorm:"size:100" json:"whatsapp_account"`                            // References WhatsAppAccount.Name
+	SessionID        *uuid.UUID `gorm:"type:uuid" json:"session_id,omitempty"`
+	Provider         AIProvider `gorm:"size:20;not null" json:"provider"`
+	Model            string     `gorm:"size:100" json:"model"`
+	PromptTokens     int        `gorm:"default:0" json:"prompt_tokens"`
+	CompletionTokens int        `gorm:"default:0" json:"completion_tokens"`
+}
+
+func (AIUsage) TableName() string {
+	return "ai_usage"
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AnalyticsDaily is an organization's activity on one UTC day, rolled up from
+// messages, chatbot sessions, agent transfers and campaign recipients so analytics
+// don't scan them on every request. The row with a nil UserID holds the
+// organization's totals; the others hold what each agent did.
+type AnalyticsDaily struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_analytics_daily_org_day_user" json:"organization_id"`
+	Day            time.Time `gorm:"type:date;not null;uniqueIndex:idx_analytics_daily_org_day_user" json:"day"`
+	UserID         uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_analytics_daily_org_day_user" json:"user_id"` // uuid.Nil for the organization's totals
+
+	// Messages
+	MessagesReceived  int64 `gorm:"default:0" json:"messages_received"`
+	MessagesSent      int64 `gorm:"default:0" json:"messages_sent"`
+	BotMessagesSent   int64 `gorm:"default:0" json:"bot_messages_sent"` // Sent without a user, excluding campaigns
+	AgentMessagesSent int64 `gorm:"default:0" json:"agent_messages_sent"`
+
+	// Contacts who wrote that day, for the first time or having written before
+	NewContacts       int64 `gorm:"default:0" json:"new_contacts"`
+	ReturningContacts int64 `gorm:"default:0" json:"returning_contacts"`
+
+	// Replies to contacts, and the median time from their first unanswered message
+	BotReplies              int64   `gorm:"default:0" json:"bot_replies"`
+	BotResponseMedianSecs   float64 `gorm:"default:0" json:"bot_response_median_secs"`
+	AgentReplies            int64   `gorm:"default:0" json:"agent_replies"`
+	AgentResponseMedianSecs float64 `gorm:"default:0" json:"agent_response_median_secs"`
+
+	// Chatbot
+	ChatbotSessions   int64 `gorm:"default:0" json:"chatbot_sessions"`
+	AIResponses       int64 `gorm:"default:0" json:"ai_responses"`
+	FallbackResponses int64 `gorm:"default:0" json:"fallback_responses"` // The bot had no answer
+	Handoffs          int64 `gorm:"default:0" json:"handoffs"`           // Transfers to agents not made by a user; for an agent, the transfers assigned to them
+
+	// Campaigns, by the day messages were sent
+	CampaignSent      int64 `gorm:"default:0" json:"campaign_sent"`
+	CampaignDelivered int64 `gorm:"default:0" json:"campaign_delivered"`
+	CampaignRead      int64 `gorm:"default:0" json:"campaign_read"`
+	CampaignFailed    int64 `gorm:"default:0" json:"campaign_failed"`
+}
+
+func (AnalyticsDaily) TableName() string {
+	return "analytics_daily"
+}
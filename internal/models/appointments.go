@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Appointment is a booking with a contact. Reminder templates are sent ahead of
+// StartsAt according to ReminderOffsets, and the customer can cancel or ask to
+// reschedule through the reminder's quick reply buttons.
+type Appointment struct {
+	BaseModel
+	OrganizationID         uuid.UUID         `gorm:"type:uuid;index;not null" json:"organization_id"`
+	ContactID              uuid.UUID         `gorm:"type:uuid;index;not null" json:"contact_id"`
+	WhatsAppAccount        string            `gorm:"size:100" json:"whatsapp_account"` // References WhatsAppAccount.Name
+	Title                  string            `gorm:"size:255;not null" json:"title"`
+	StartsAt               time.Time         `gorm:"index;not null" json:"starts_at"`
+	DurationMinutes        int               `gorm:"default:30" json:"duration_minutes"`
+	Notes                  string            `gorm:"type:text" json:"notes"`
+	Status                 AppointmentStatus `gorm:"size:30;index;not null" json:"status"`
+	Source                 AppointmentSource `gorm:"size:20;not null" json:"source"`
+	ReminderTemplateID     *uuid.UUID        `gorm:"type:uuid" json:"reminder_template_id,omitempty"`
+	ReminderTemplateParams JSONB             `gorm:"type:jsonb;default:'{}'" json:"reminder_template_params"` // May use {{appointment_*}} variables
+	ReminderOffsets        JSONBArray        `gorm:"type:jsonb;default:'[]'" json:"reminder_offsets"`         // Minutes before StartsAt, e.g. [1440, 60]
+	CreatedByID            *uuid.UUID        `gorm:"type:uuid" json:"created_by_id,omitempty"`                // Nil when booked by a flow
+	CancelledAt            *time.Time        `json:"cancelled_at,omitempty"`
+	CalendarEventID        string            `gorm:"size:255" json:"calendar_event_id,omitempty"` // Event on the organization's Google Calendar
+
+	// Relations
+	Organization     *Organization         `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Contact          *Contact              `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+	ReminderTemplate *Template             `gorm:"foreignKey:ReminderTemplateID" json:"reminder_template,omitempty"`
+	CreatedBy        *User                 `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
+	Reminders        []AppointmentReminder `gorm:"foreignKey:AppointmentID" json:"reminders,omitempty"`
+}
+
+func (Appointment) TableName() string {
+	return "appointments"
+}
+
+// AppointmentReminder is a single reminder send of an appointment
+type AppointmentReminder struct {
+	BaseModel
+	AppointmentID uuid.UUID                 `gorm:"type:uuid;index;not null" json:"appointment_id"`
+	OffsetMinutes int                       `gorm:"not null" json:"offset_minutes"`
+	SendAt        time.Time                 `gorm:"index;not null" json:"send_at"`
+	Status        AppointmentReminderStatus `gorm:"size:20;index;not null" json:"status"`
+	MessageID     *uuid.UUID                `gorm:"type:uuid;index" json:"message_id,omitempty"` // Reminder message, used to match button replies
+	SentAt        *time.Time                `json:"sent_at,omitempty"`
+	ErrorMessage  string                    `gorm:"type:text" json:"error_message,omitempty"`
+
+	// Relations
+	Appointment *Appointment `gorm:"foreignKey:AppointmentID" json:"appointment,omitempty"`
+}
+
+func (AppointmentReminder) TableName() string {
+	return "appointment_reminders"
+}
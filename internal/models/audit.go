@@ -0,0 +1,45 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// AdminAuditLog records a super admin's access to data across organizations. An
+// entry is written before the data is read, so every access is recorded.
+type AdminAuditLog struct {
+	BaseModel
+	UserID          uuid.UUID   `gorm:"type:uuid;not null" json:"user_id"`
+	UserEmail       string      `gorm:"size:255" json:"user_email"`
+	Action          string      `gorm:"size:50;not null" json:"action"`
+	Reason          string      `gorm:"type:text;not null" json:"reason"` // Why the data was accessed, e.g. a support ticket
+	Query           JSONB       `gorm:"type:jsonb;default:'{}'" json:"query"`
+	ResultCount     int         `gorm:"default:0" json:"result_count"`
+	OrganizationIDs StringArray `gorm:"type:jsonb;default:'[]'" json:"organization_ids"` // Organizations whose data was returned
+	IPAddress       string      `gorm:"size:45" json:"ip_address"`
+	UserAgent       string      `gorm:"type:text" json:"user_agent"`
+}
+
+func (AdminAuditLog) TableName() string {
+	return "admin_audit_logs"
+}
+
+// AuditLog records a change to an organization's settings or administrative data,
+// such as chatbot settings, templates, roles and API keys. The table is
+// append-only: the database rejects updates and deletes.
+type AuditLog struct {
+	BaseModel
+	OrganizationID uuid.UUID  `gorm:"type:uuid;not null" json:"organization_id"`
+	UserID         *uuid.UUID `gorm:"type:uuid" json:"user_id,omitempty"`
+	UserEmail      string     `gorm:"size:255" json:"user_email"`
+	Action         string     `gorm:"size:50;not null" json:"action"`
+	ResourceType   string     `gorm:"size:50;not null" json:"resource_type"`
+	ResourceID     *uuid.UUID `gorm:"type:uuid" json:"resource_id,omitempty"`
+	ResourceName   string     `gorm:"size:255" json:"resource_name"`
+	Changes        JSONB      `gorm:"type:jsonb;default:'{}'" json:"changes"` // {"field": {"from": old, "to": new}}
+	IPAddress      string     `gorm:"size:45" json:"ip_address"`
+	UserAgent      string     `gorm:"type:text" json:"user_agent"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Automation is a "when <event> and <conditions> then <actions>" rule. Rules are
+// evaluated whenever the organization emits the event; all conditions must match
+// for the actions to run.
+type Automation struct {
+	BaseModel
+	OrganizationID  uuid.UUID    `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Name            string       `gorm:"size:255;not null" json:"name"`
+	Description     string       `gorm:"type:text" json:"description"`
+	Event           WebhookEvent `gorm:"size:50;not null" json:"event"`
+	Conditions      JSONBArray   `gorm:"type:jsonb;default:'[]'" json:"conditions"` // [{"field": "contact.tags", "operator": "contains", "value": "complaint"}]
+	Actions         JSONBArray   `gorm:"type:jsonb;default:'[]'" json:"actions"`    // [{"type": "send_template", "config": {...}}]
+	IsActive        bool         `gorm:"default:true" json:"is_active"`
+	TriggerCount    int          `gorm:"default:0" json:"trigger_count"`
+	LastTriggeredAt *time.Time   `json:"last_triggered_at,omitempty"`
+	CreatedByID     *uuid.UUID   `gorm:"type:uuid" json:"created_by_id,omitempty"`
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+}
+
+func (Automation) TableName() string {
+	return "automations"
+}
+
+// AutomationLog records one execution of an automation, with the outcome of each action
+type AutomationLog struct {
+	BaseModel
+	AutomationID   uuid.UUID           `gorm:"type:uuid;index;not null" json:"automation_id"`
+	OrganizationID uuid.UUID           `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Event          WebhookEvent        `gorm:"size:50;not null" json:"event"`
+	ContactID      *uuid.UUID          `gorm:"type:uuid;index" json:"contact_id,omitempty"`
+	Status         AutomationLogStatus `gorm:"size:20;not null" json:"status"`
+	EventData      JSONB               `gorm:"type:jsonb;default:'{}'" json:"event_data"`
+	ActionResults  JSONBArray          `gorm:"type:jsonb;default:'[]'" json:"action_results"` // [{"type": "send_template", "status": "success"}]
+	ErrorMessage   string              `gorm:"type:text" json:"error_message,omitempty"`
+	DurationMs     int64               `json:"duration_ms"`
+
+	// Relations
+	Automation *Automation `gorm:"foreignKey:AutomationID" json:"automation,omitempty"`
+}
+
+func (AutomationLog) TableName() string {
+	return "automation_logs"
+}
@@ -26,13 +26,23 @@ type BulkMessageCampaign struct {
 	ScheduledAt     *time.Time `json:"scheduled_at,omitempty"`
 	StartedAt       *time.Time `json:"started_at,omitempty"`
 	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	PausedReason    string     `gorm:"type:text" json:"paused_reason,omitempty"` // Set when paused automatically
 	CreatedBy       uuid.UUID  `gorm:"type:uuid;not null" json:"created_by"`
 
+	// A/B testing, when the campaign has variants
+	AutoPromote       bool                 `gorm:"default:false" json:"auto_promote"`             // Send the winning variant to the rest of the audience
+	TestPercent       int                  `gorm:"default:0" json:"test_percent"`                 // Share of the audience the variants are tested on
+	TestDurationHours int                  `gorm:"default:0" json:"test_duration_hours"`          // How long the test runs before the winner is picked
+	WinnerMetric      CampaignWinnerMetric `gorm:"size:20" json:"winner_metric,omitempty"`
+	TestEndsAt        *time.Time           `json:"test_ends_at,omitempty"`
+	WinnerVariantID   *uuid.UUID           `gorm:"type:uuid" json:"winner_variant_id,omitempty"`
+
 	// Relations
 	Organization *Organization          `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
 	Template     *Template              `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
 	Creator      *User                  `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
 	Recipients   []BulkMessageRecipient `gorm:"foreignKey:CampaignID" json:"recipients,omitempty"`
+	Variants     []CampaignVariant      `gorm:"foreignKey:CampaignID" json:"variants,omitempty"`
 }
 
 func (BulkMessageCampaign) TableName() string {
@@ -50,9 +60,13 @@ type BulkMessageRecipient struct {
 	WhatsAppMessageID  string     `gorm:"column:whats_app_message_id;size:100;index" json:"whatsapp_message_id,omitempty"`
 	MessageID          *uuid.UUID `gorm:"type:uuid" json:"message_id,omitempty"`
 	ErrorMessage       string     `gorm:"type:text" json:"error_message"`
+	ErrorCode          int        `gorm:"default:0" json:"error_code,omitempty"` // Meta error code of a failed send
 	SentAt             *time.Time `json:"sent_at,omitempty"`
 	DeliveredAt        *time.Time `json:"delivered_at,omitempty"`
 	ReadAt             *time.Time `json:"read_at,omitempty"`
+	RepliedAt          *time.Time `json:"replied_at,omitempty"`                           // First reply after the message was sent
+	VariantID          *uuid.UUID `gorm:"type:uuid;index" json:"variant_id,omitempty"` // Variant sent to the recipient, in A/B tested campaigns
+	Batch              int        `gorm:"default:0" json:"batch,omitempty"`          // Batch of a bulk send the recipient is in, counted from 1
 
 	// Relations
 	Campaign *BulkMessageCampaign `gorm:"foreignKey:CampaignID" json:"campaign,omitempty"`
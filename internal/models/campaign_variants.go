@@ -0,0 +1,24 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// CampaignVariant is one of the templates an A/B tested campaign sends, to a share
+// of its recipients
+type CampaignVariant struct {
+	BaseModel
+	CampaignID    uuid.UUID `gorm:"type:uuid;index;not null" json:"campaign_id"`
+	Name          string    `gorm:"size:50;not null" json:"name"` // A, B, ...
+	TemplateID    uuid.UUID `gorm:"type:uuid;not null" json:"template_id"`
+	HeaderMediaID string    `gorm:"type:text" json:"header_media_id,omitempty"` // Meta media ID, for media header templates
+	Percent       int       `gorm:"not null" json:"percent"`                    // Share of the recipients; a campaign's variants add up to 100
+
+	// Relations
+	Campaign *BulkMessageCampaign `gorm:"foreignKey:CampaignID" json:"campaign,omitempty"`
+	Template *Template            `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
+}
+
+func (CampaignVariant) TableName() string {
+	return "campaign_variants"
+}
@@ -1,20 +1,23 @@
 package models
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
 // CannedResponse represents a pre-defined response text for quick insertion in chat
 type CannedResponse struct {
 	BaseModel
-	OrganizationID uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
-	Name           string    `gorm:"size:100;not null" json:"name"`
-	Shortcut       string    `gorm:"size:50;index" json:"shortcut"`
-	Content        string    `gorm:"type:text;not null" json:"content"`
-	Category       string    `gorm:"size:50" json:"category"`
-	IsActive       bool      `gorm:"default:true" json:"is_active"`
-	UsageCount     int       `gorm:"default:0" json:"usage_count"`
-	CreatedByID    uuid.UUID `gorm:"type:uuid" json:"created_by_id"`
+	OrganizationID uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Name           string     `gorm:"size:100;not null" json:"name"`
+	Shortcut       string     `gorm:"size:50;index" json:"shortcut"`
+	Content        string     `gorm:"type:text;not null" json:"content"`
+	Category       string     `gorm:"size:50" json:"category"`
+	IsActive       bool       `gorm:"default:true" json:"is_active"`
+	UsageCount     int        `gorm:"default:0" json:"usage_count"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	CreatedByID    uuid.UUID  `gorm:"type:uuid" json:"created_by_id"`
 
 	// Relations
 	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
@@ -24,3 +27,28 @@ type CannedResponse struct {
 func (CannedResponse) TableName() string {
 	return "canned_responses"
 }
+
+// CannedResponseFavorite is a canned response a user pinned to the top of their list
+type CannedResponseFavorite struct {
+	BaseModel
+	OrganizationID   uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
+	UserID           uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_canned_response_favorites_user" json:"user_id"`
+	CannedResponseID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_canned_response_favorites_user" json:"canned_response_id"`
+}
+
+func (CannedResponseFavorite) TableName() string {
+	return "canned_response_favorites"
+}
+
+// CannedResponseUse records an agent using a canned response, for usage stats
+type CannedResponseUse struct {
+	BaseModel
+	OrganizationID   uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
+	CannedResponseID uuid.UUID  `gorm:"type:uuid;index;not null" json:"canned_response_id"`
+	UserID           uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+	ContactID        *uuid.UUID `gorm:"type:uuid" json:"contact_id,omitempty"` // Set when it was sent through the agent reply API
+}
+
+func (CannedResponseUse) TableName() string {
+	return "canned_response_uses"
+}
@@ -1,6 +1,10 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 // Catalog represents a WhatsApp product catalog
 type Catalog struct {
@@ -11,6 +15,10 @@ type Catalog struct {
 	Name            string    `gorm:"size:255;not null" json:"name"`
 	IsActive        bool      `gorm:"default:true" json:"is_active"`
 
+	// Product sync
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	SyncError    string     `gorm:"type:text" json:"sync_error,omitempty"` // Error from the last sync, empty when it succeeded
+
 	// Relations
 	Organization *Organization    `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
 	Products     []CatalogProduct `gorm:"foreignKey:CatalogID" json:"products,omitempty"`
@@ -28,12 +36,13 @@ type CatalogProduct struct {
 	MetaProductID  string    `gorm:"size:100;uniqueIndex" json:"meta_product_id"`
 	Name           string    `gorm:"size:255;not null" json:"name"`
 	Description    string    `gorm:"type:text" json:"description"`
-	Price          int64     `gorm:"not null" json:"price"`            // Price in cents
+	Price          int64     `gorm:"not null" json:"price"` // Price in cents
 	Currency       string    `gorm:"size:3;default:'USD'" json:"currency"`
 	URL            string    `gorm:"size:500" json:"url"`
 	ImageURL       string    `gorm:"size:500" json:"image_url"`
-	RetailerID     string    `gorm:"size:100" json:"retailer_id"` // SKU
-	IsActive       bool      `gorm:"default:true" json:"is_active"`
+	RetailerID     string    `gorm:"size:100;index" json:"retailer_id"` // SKU
+	Availability   string    `gorm:"size:50" json:"availability"`       // Meta availability, e.g. "in stock"
+	IsActive       bool      `gorm:"default:true" json:"is_active"`     // False once the product is gone from the Meta catalog
 
 	// Relations
 	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
@@ -12,6 +12,9 @@ type BusinessHoursConfig struct {
 	Hours                JSONBArray `gorm:"column:business_hours;type:jsonb;default:'[]'" json:"business_hours"` // [{day, enabled, start_time, end_time}]
 	OutOfHoursMessage    string     `gorm:"column:out_of_hours_message;type:text" json:"out_of_hours_message"`
 	AllowAutomatedOutside bool      `gorm:"column:allow_automated_outside_hours;default:true" json:"allow_automated_outside_hours"` // Allow flows/keywords/AI outside business hours
+	Timezone             string     `gorm:"column:business_hours_timezone;size:50" json:"business_hours_timezone"`          // IANA name, falls back to the organization timezone
+	OutOfHoursFlowID     *uuid.UUID `gorm:"column:out_of_hours_flow_id;type:uuid" json:"out_of_hours_flow_id,omitempty"`    // Away flow started instead of the out of hours message
+	QueueOutsideHours    bool       `gorm:"column:queue_outside_hours;default:false" json:"queue_outside_hours"`            // Queue conversations for agents until hours reopen
 }
 
 // AgentAssignmentConfig holds agent assignment and queue settings
@@ -19,6 +22,13 @@ type AgentAssignmentConfig struct {
 	AllowQueuePickup        bool `gorm:"column:allow_agent_queue_pickup;default:true" json:"allow_agent_queue_pickup"`           // Allow agents to pick transfers from queue
 	AssignToSameAgent       bool `gorm:"column:assign_to_same_agent;default:true" json:"assign_to_same_agent"`                   // Auto-assign transfers to contact's existing agent
 	CurrentConversationOnly bool `gorm:"column:agent_current_conversation_only;default:false" json:"agent_current_conversation_only"` // Agents see only current session messages
+
+	// Handoffs from the bot to the agent queue
+	HandoffOnAIIntent     bool `gorm:"column:handoff_on_ai_intent;default:false" json:"handoff_on_ai_intent"`      // The AI hands off when the contact asks for a person or it can't help
+	HandoffAfterFallbacks int  `gorm:"column:handoff_after_fallbacks;default:0" json:"handoff_after_fallbacks"` // Hand off after this many fallback messages in a row; 0 never does
+
+	// Team bot handoffs are routed to, assigned with the team's strategy; nil leaves them in the general queue
+	HandoffTeamID *uuid.UUID `gorm:"column:handoff_team_id;type:uuid" json:"handoff_team_id,omitempty"`
 }
 
 // SLAConfig holds SLA tracking settings
@@ -42,17 +52,99 @@ type ClientInactivityConfig struct {
 	AutoCloseMessage string `gorm:"column:client_auto_close_message;type:text" json:"client_auto_close_message"`   // Message when closing due to client inactivity
 }
 
+// LanguageConfig holds multi-language settings
+type LanguageConfig struct {
+	DetectionEnabled    bool        `gorm:"column:language_detection_enabled;default:false" json:"language_detection_enabled"` // Detect the language of inbound messages
+	DefaultLanguage     string      `gorm:"column:default_language;size:10" json:"default_language"`                         // ISO 639-1 code used until a language is detected, or when it isn't supported
+	SupportedLanguages  StringArray `gorm:"column:supported_languages;type:jsonb;default:'[]'" json:"supported_languages"`   // Empty allows any detected language
+	MessageTranslations JSONB       `gorm:"column:message_translations;type:jsonb;default:'{}'" json:"message_translations"` // {lang: {greeting_message, fallback_message, out_of_hours_message, ai_system_prompt}}
+}
+
+// SentimentConfig holds sentiment scoring and escalation settings
+type SentimentConfig struct {
+	Enabled   bool              `gorm:"column:sentiment_enabled;default:false" json:"sentiment_enabled"`                 // Score inbound text messages from -1 (negative) to 1 (positive)
+	Provider  SentimentProvider `gorm:"column:sentiment_provider;size:20;default:'lexicon'" json:"sentiment_provider"`   // lexicon, or ai to score with the AI provider
+	Threshold float64           `gorm:"column:sentiment_threshold;type:decimal(3,2);default:-0.4" json:"sentiment_threshold"` // Escalate when the average drops below this
+	Window    int               `gorm:"column:sentiment_window;default:3" json:"sentiment_window"`                      // Average over the last N scored messages of the session
+	Action    SentimentAction   `gorm:"column:sentiment_action;size:20;default:'notify'" json:"sentiment_action"`       // notify agents, or handoff to the agent queue
+}
+
+// CSATConfig holds the satisfaction survey sent after conversations
+type CSATConfig struct {
+	Enabled     bool   `gorm:"column:csat_enabled;default:false" json:"csat_enabled"`         // Survey contacts when an agent ends their handoff
+	BotSessions bool   `gorm:"column:csat_bot_sessions;default:false" json:"csat_bot_sessions"` // Also survey sessions the bot completes or closes
+	Question    string `gorm:"column:csat_question;type:text" json:"csat_question"`           // Empty asks the default question
+	FollowUp    string `gorm:"column:csat_follow_up;type:text" json:"csat_follow_up"`         // Asks for a comment after the rating, empty doesn't
+	ThankYou    string `gorm:"column:csat_thank_you;type:text" json:"csat_thank_you"`         // Sent once the survey is answered
+}
+
+// AbuseConfig holds the detection of contacts flooding or abusing the chatbot
+type AbuseConfig struct {
+	Enabled      bool        `gorm:"column:abuse_enabled;default:false" json:"abuse_enabled"`
+	MaxMessages  int         `gorm:"column:abuse_max_messages;default:20" json:"abuse_max_messages"`         // Messages a contact may send within the window
+	WindowSecs   int         `gorm:"column:abuse_window_secs;default:60" json:"abuse_window_secs"`
+	Blocklist    StringArray `gorm:"column:abuse_blocklist;type:jsonb;default:'[]'" json:"abuse_blocklist"` // Words, or /regular expressions/, of abusive messages
+	Action       AbuseAction `gorm:"column:abuse_action;size:20;default:'pause_bot'" json:"abuse_action"`   // pause_bot, or block the contact
+	CooldownMins int         `gorm:"column:abuse_cooldown_mins;default:60" json:"abuse_cooldown_mins"`      // How long the pause or block lasts
+}
+
+// TranscriptionConfig holds speech-to-text settings for inbound voice notes
+type TranscriptionConfig struct {
+	Enabled  bool                  `gorm:"column:transcription_enabled;default:false" json:"transcription_enabled"` // Answer voice notes from their transcript
+	Provider TranscriptionProvider `gorm:"column:transcription_provider;size:20;default:'openai'" json:"transcription_provider"`
+	URL      string                `gorm:"column:transcription_url;size:500" json:"transcription_url"`     // Endpoint; empty is the OpenAI transcription API
+	APIKey   string                `gorm:"column:transcription_api_key;type:text;serializer:encrypted" json:"-"`                // Empty uses the AI provider's key when it's OpenAI
+	Model    string                `gorm:"column:transcription_model;size:100" json:"transcription_model"` // Empty is whisper-1
+}
+
 // AIConfig holds AI provider settings
 type AIConfig struct {
 	Enabled        bool    `gorm:"column:ai_enabled;default:false" json:"ai_enabled"`
-	Provider       AIProvider `gorm:"column:ai_provider;size:20" json:"ai_provider"`                     // openai, anthropic, google
-	APIKey         string  `gorm:"column:ai_api_key;type:text" json:"-"`                                 // encrypted
+	Provider       AIProvider `gorm:"column:ai_provider;size:20" json:"ai_provider"`                     // openai, anthropic, google, ollama, webhook
+	BaseURL        string  `gorm:"column:ai_base_url;size:500" json:"ai_base_url"`                       // Server of self-hosted providers, e.g. http://localhost:11434, or the webhook URL
+	APIKey         string  `gorm:"column:ai_api_key;type:text;serializer:encrypted" json:"-"`                                 // encrypted
 	Model          string  `gorm:"column:ai_model;size:100" json:"ai_model"`
 	MaxTokens      int     `gorm:"column:ai_max_tokens;default:500" json:"ai_max_tokens"`
 	Temperature    float64 `gorm:"column:ai_temperature;type:decimal(3,2);default:0.7" json:"ai_temperature"`
 	SystemPrompt   string  `gorm:"column:ai_system_prompt;type:text" json:"ai_system_prompt"`
 	IncludeHistory bool    `gorm:"column:ai_include_history;default:true" json:"ai_include_history"`
 	HistoryLimit   int     `gorm:"column:ai_history_limit;default:4" json:"ai_history_limit"`
+	HistoryTTLMinutes int  `gorm:"column:ai_history_ttl_minutes;default:0" json:"ai_history_ttl_minutes"` // Older messages aren't sent as history; 0 keeps the whole session
+	SummarizeHistory   bool `gorm:"column:ai_summarize_history;default:false" json:"ai_summarize_history"`       // Summarize older turns once the history outgrows the token budget
+	HistoryTokenBudget int  `gorm:"column:ai_history_token_budget;default:2000" json:"ai_history_token_budget"` // Estimated tokens of summary and history sent with each request
+	CacheTTLMinutes   int  `gorm:"column:ai_cache_ttl_minutes;default:0" json:"ai_cache_ttl_minutes"`     // Repeated questions are answered from a cache for this long; 0 turns caching off
+	QuickReplies   JSONBArray `gorm:"column:ai_quick_replies;type:jsonb;default:'[]'" json:"ai_quick_replies"` // [{id, title, action, flow_id}] - max 3 buttons appended to AI answers
+	Personas       JSONBArray `gorm:"column:ai_personas;type:jsonb;default:'[]'" json:"ai_personas"` // [{id, name, prompt}] - named system prompts
+	PersonaID      string  `gorm:"column:ai_persona_id;size:50" json:"ai_persona_id"`                      // Persona used instead of the system prompt, if set
+	FallbackProviders JSONBArray `gorm:"column:ai_fallback_providers;type:jsonb;default:'[]'" json:"ai_fallback_providers"` // [{provider, model, base_url, api_key}] - tried in order when the provider fails
+	MonthlyTokenLimit int64  `gorm:"column:ai_monthly_token_limit;default:0" json:"ai_monthly_token_limit"` // Prompt + completion tokens per calendar month (UTC); 0 is unlimited
+	QuotaMessage      string `gorm:"column:ai_quota_message;type:text" json:"ai_quota_message"`          // Sent instead of the fallback message once the token limit is reached
+	Tools             JSONBArray `gorm:"column:ai_tools;type:jsonb;default:'[]'" json:"ai_tools"` // [{name, description, url, headers, parameters}] - HTTP callbacks the AI can call
+	Experiments       JSONBArray `gorm:"column:ai_experiments;type:jsonb;default:'[]'" json:"ai_experiments"` // [{id, name, provider, model, base_url, api_key, percent}] - share of new sessions answered by another provider
+	PaymentLinks      bool       `gorm:"column:ai_payment_links;default:false" json:"ai_payment_links"` // Let the AI create payment links with the organization's payment provider
+	OrderLookup       bool       `gorm:"column:ai_order_lookup;default:false" json:"ai_order_lookup"`   // Let the AI look up the customer's orders in the connected Shopify store
+	Streaming         bool          `gorm:"column:ai_streaming;default:false" json:"ai_streaming"`                    // Send answers in parts as they're generated, with providers that stream
+	StreamSplit       AIStreamSplit `gorm:"column:ai_stream_split;size:20;default:'paragraph'" json:"ai_stream_split"` // Where streamed answers are split into messages
+	StreamIntervalMs  int           `gorm:"column:ai_stream_interval_ms;default:1000" json:"ai_stream_interval_ms"`   // Minimum time between the parts of a streamed answer
+
+	// Knowledge base, configured on the organization-level settings
+	EmbeddingProvider AIProvider `gorm:"column:ai_embedding_provider;size:20" json:"ai_embedding_provider"` // openai, google or ollama; the knowledge base is off without one
+	EmbeddingModel    string     `gorm:"column:ai_embedding_model;size:100" json:"ai_embedding_model"`
+	EmbeddingBaseURL  string     `gorm:"column:ai_embedding_base_url;size:500" json:"ai_embedding_base_url"`
+	EmbeddingAPIKey   string     `gorm:"column:ai_embedding_api_key;type:text;serializer:encrypted" json:"-"`                  // Empty uses the AI provider's key when it's the same provider
+	KnowledgeTopK     int        `gorm:"column:ai_knowledge_top_k;default:3" json:"ai_knowledge_top_k"` // Passages added to the prompt; 0 turns retrieval off
+
+	// Moderation of AI responses before they are sent
+	ModerationEnabled   bool        `gorm:"column:ai_moderation_enabled;default:false" json:"ai_moderation_enabled"`
+	ModerationBlocklist StringArray `gorm:"column:ai_moderation_blocklist;type:jsonb;default:'[]'" json:"ai_moderation_blocklist"` // Keywords, or /regular expressions/
+	ModerationProvider  AIProvider  `gorm:"column:ai_moderation_provider;size:20" json:"ai_moderation_provider"`                   // openai to also check with the OpenAI moderation API
+	ModerationAPIKey    string      `gorm:"column:ai_moderation_api_key;type:text;serializer:encrypted" json:"-"`                                       // Empty uses the AI provider's key when it's OpenAI
+	ModerationMessage   string      `gorm:"column:ai_moderation_message;type:text" json:"ai_moderation_message"`                   // Sent instead of a blocked response; empty sends the fallback message
+
+	// Custom webhook provider
+	WebhookHeaders      JSONB  `gorm:"column:ai_webhook_headers;type:jsonb;default:'{}'" json:"ai_webhook_headers"`
+	WebhookBody         string `gorm:"column:ai_webhook_body;type:text" json:"ai_webhook_body"`                  // JSON with {{sender}}, {{message}}, {{session_id}}... placeholders
+	WebhookResponsePath string `gorm:"column:ai_webhook_response_path;size:200" json:"ai_webhook_response_path"` // Where the reply is in the response, e.g. $.responses[0].text
 }
 
 // PanelFieldConfig defines a field to display in the contact info panel
@@ -100,10 +192,19 @@ type ChatbotSettings struct {
 	SLA              SLAConfig              `gorm:"embedded"`
 	ClientInactivity ClientInactivityConfig `gorm:"embedded"`
 	AI               AIConfig               `gorm:"embedded"`
+	Language         LanguageConfig         `gorm:"embedded"`
+	Sentiment        SentimentConfig        `gorm:"embedded"`
+	Transcription    TranscriptionConfig    `gorm:"embedded"`
+	CSAT             CSATConfig             `gorm:"embedded"`
+	Abuse            AbuseConfig            `gorm:"embedded"`
+
+	// Flow started for conversations from click-to-WhatsApp ads
+	AdsFlowID *uuid.UUID `gorm:"type:uuid" json:"ads_flow_id,omitempty"`
 
 	// Session settings
-	SessionTimeoutMins int        `gorm:"default:30" json:"session_timeout_minutes"`
-	ExcludedNumbers    JSONBArray `gorm:"type:jsonb;default:'[]'" json:"excluded_numbers"`
+	SessionTimeoutMins   int        `gorm:"default:30" json:"session_timeout_minutes"`
+	SessionClosedMessage string     `gorm:"type:text" json:"session_closed_message"` // Sent when an inactive session times out
+	ExcludedNumbers      JSONBArray `gorm:"type:jsonb;default:'[]'" json:"excluded_numbers"`
 
 	// Relations
 	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
@@ -124,7 +225,7 @@ type KeywordRule struct {
 	Keywords        StringArray `gorm:"type:jsonb;not null" json:"keywords"`
 	MatchType       MatchType    `gorm:"size:20;default:'contains'" json:"match_type"` // exact, contains, starts_with, regex
 	CaseSensitive   bool         `gorm:"default:false" json:"case_sensitive"`
-	ResponseType    ResponseType `gorm:"size:20;not null" json:"response_type"` // text, template, media, flow, script
+	ResponseType    ResponseType `gorm:"size:20;not null" json:"response_type"` // text, template, tag, transfer
 	ResponseContent JSONB       `gorm:"type:jsonb;not null" json:"response_content"`
 	Conditions      string      `gorm:"type:text" json:"conditions"`
 	ActiveFrom      *time.Time  `json:"active_from,omitempty"`
@@ -142,12 +243,13 @@ func (KeywordRule) TableName() string {
 type ChatbotFlow struct {
 	BaseModel
 	OrganizationID     uuid.UUID   `gorm:"type:uuid;index;not null" json:"organization_id"`
-	WhatsAppAccount    string      `gorm:"size:100;index;not null" json:"whatsapp_account"` // References WhatsAppAccount.Name
+	WhatsAppAccount    string      `gorm:"size:100;index;not null" json:"whatsapp_account"` // References WhatsAppAccount.Name, empty serves every number
 	Name               string      `gorm:"size:255;not null" json:"name"`
 	IsEnabled          bool        `gorm:"default:true" json:"is_enabled"`
 	Description        string      `gorm:"type:text" json:"description"`
 	TriggerKeywords    StringArray `gorm:"type:jsonb" json:"trigger_keywords"`
 	TriggerButtonID    string      `gorm:"size:100" json:"trigger_button_id"`
+	Language           string      `gorm:"size:10" json:"language"` // ISO 639-1 code; empty serves every language
 	InitialMessage     string       `gorm:"type:text" json:"initial_message"`
 	InitialMessageType FlowStepType `gorm:"size:20;default:'text'" json:"initial_message_type"`
 	InitialTemplateID  *uuid.UUID  `gorm:"type:uuid" json:"initial_template_id,omitempty"`
@@ -208,19 +310,27 @@ type ChatbotSession struct {
 	WhatsAppAccount string     `gorm:"size:100;index;not null" json:"whatsapp_account"` // References WhatsAppAccount.Name
 	PhoneNumber     string     `gorm:"size:20;not null" json:"phone_number"`
 	Status          SessionStatus `gorm:"size:20;default:'active'" json:"status"` // active, completed, cancelled, timeout
+	Mode            SessionMode   `gorm:"size:20;default:'bot';index" json:"mode"` // bot, pending_agent, agent, closed
 	CurrentFlowID   *uuid.UUID `gorm:"type:uuid" json:"current_flow_id,omitempty"`
 	CurrentStep     string     `gorm:"size:100" json:"current_step"`
 	StepRetries     int        `gorm:"default:0" json:"step_retries"`
+	Language        string     `gorm:"size:10" json:"language"` // ISO 639-1 code detected from the customer's messages
+	AIVariant       string     `gorm:"size:50;index" json:"ai_variant,omitempty"` // AI experiment the session was routed to, or "control"
+	Sentiment       *float64   `gorm:"type:decimal(4,3)" json:"sentiment,omitempty"` // Average sentiment of the customer's last messages
 	SessionData     JSONB      `gorm:"type:jsonb;default:'{}'" json:"session_data"`
 	StartedAt       time.Time  `gorm:"autoCreateTime" json:"started_at"`
 	LastActivityAt  time.Time  `json:"last_activity_at"`
 	CompletedAt     *time.Time `json:"completed_at,omitempty"`
+	CRMSyncedAt     *time.Time `json:"crm_synced_at,omitempty"` // When its summary was logged in the organization's CRM
+	HistorySummary  string     `gorm:"type:text" json:"history_summary,omitempty"` // Summary of the turns before SummarizedUntil, sent to the AI instead of them
+	SummarizedUntil *time.Time `json:"summarized_until,omitempty"`
 
 	// Relations
 	Organization *Organization           `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
 	Contact      *Contact                `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
 	CurrentFlow  *ChatbotFlow            `gorm:"foreignKey:CurrentFlowID" json:"current_flow,omitempty"`
 	Messages     []ChatbotSessionMessage `gorm:"foreignKey:SessionID" json:"messages,omitempty"`
+	Notes        []SessionNote           `gorm:"foreignKey:SessionID" json:"notes,omitempty"` // Private notes of the agents
 }
 
 func (ChatbotSession) TableName() string {
@@ -230,10 +340,12 @@ func (ChatbotSession) TableName() string {
 // ChatbotSessionMessage stores message history within a session
 type ChatbotSessionMessage struct {
 	BaseModel
-	SessionID uuid.UUID `gorm:"type:uuid;index;not null" json:"session_id"`
-	Direction Direction `gorm:"size:10;not null" json:"direction"` // incoming, outgoing
-	Message   string    `gorm:"type:text" json:"message"`
-	StepName  string    `gorm:"size:100" json:"step_name"`
+	SessionID  uuid.UUID  `gorm:"type:uuid;index;not null" json:"session_id"`
+	Direction  Direction  `gorm:"size:10;not null" json:"direction"` // incoming, outgoing
+	Message    string     `gorm:"type:text" json:"message"`
+	StepName   string     `gorm:"size:100" json:"step_name"`
+	AIProvider AIProvider `gorm:"column:ai_provider;size:20" json:"ai_provider,omitempty"` // Provider that gave an AI response
+	Sentiment  *float64   `gorm:"type:decimal(4,3)" json:"sentiment,omitempty"`           // Score of an incoming message, from -1 to 1
 
 	// Relations
 	Session *ChatbotSession `gorm:"foreignKey:SessionID" json:"session,omitempty"`
@@ -276,6 +388,8 @@ type SLATracking struct {
 	EscalatedAt        *time.Time `gorm:"column:escalated_at" json:"escalated_at,omitempty"`                            // When escalation occurred
 	Breached           bool       `gorm:"column:sla_breached;default:false" json:"sla_breached"`                        // Whether SLA was breached
 	BreachedAt         *time.Time `gorm:"column:sla_breached_at" json:"sla_breached_at,omitempty"`                      // When SLA was breached
+	PolicyID           *uuid.UUID `gorm:"column:sla_policy_id;type:uuid" json:"sla_policy_id,omitempty"`                // SLA policy that set the deadlines
+	Status             SLAStatus  `gorm:"column:sla_status;size:20;index" json:"sla_status,omitempty"`                  // on_track, at_risk, breached; set for policy-tracked transfers
 }
 
 // AgentTransfer tracks when conversations are transferred to human agents
@@ -294,6 +408,8 @@ type AgentTransfer struct {
 	TransferredAt       time.Time  `gorm:"autoCreateTime" json:"transferred_at"`
 	ResumedAt           *time.Time `json:"resumed_at,omitempty"`
 	ResumedBy           *uuid.UUID `gorm:"type:uuid" json:"resumed_by,omitempty"`
+	AssignmentDeferred  bool       `gorm:"default:false" json:"assignment_deferred"` // Created outside business hours, assigned once they reopen
+	Priority            TransferPriority `gorm:"size:20;default:'normal'" json:"priority"` // low, normal, high, urgent
 
 	// SLA Tracking (embedded - all fields stored in same table)
 	SLA SLATracking `gorm:"embedded"`
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Checkout is a checkout started in a connected store. Checkouts that aren't
+// ordered within the organization's recovery delay get a recovery template.
+type Checkout struct {
+	BaseModel
+	OrganizationID uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_checkout_external" json:"organization_id"`
+	Source         string         `gorm:"size:20;not null;uniqueIndex:idx_checkout_external" json:"source"`
+	ExternalID     string         `gorm:"size:100;not null;uniqueIndex:idx_checkout_external" json:"external_id"` // Checkout token in the store
+	ContactID      *uuid.UUID     `gorm:"type:uuid;index" json:"contact_id,omitempty"`
+	PhoneNumber    string         `gorm:"size:50" json:"phone_number"`
+	CustomerName   string         `gorm:"size:255" json:"customer_name"`
+	Items          JSONBArray     `gorm:"type:jsonb;default:'[]'" json:"items"` // [{title, quantity, price}]
+	Total          int64          `json:"total"`                                // In the smallest currency unit
+	Currency       string         `gorm:"size:3" json:"currency"`
+	CheckoutURL    string         `gorm:"size:1000" json:"checkout_url"`
+	Status         CheckoutStatus `gorm:"size:20;index;not null" json:"status"`
+	RecoverAt      time.Time      `gorm:"index;not null" json:"recover_at"` // When the recovery message is due
+	RecoverySentAt *time.Time     `json:"recovery_sent_at,omitempty"`
+	MessageID      *uuid.UUID     `gorm:"type:uuid" json:"message_id,omitempty"` // Recovery message
+	OrderID        string         `gorm:"size:100" json:"order_id,omitempty"`
+	OrderTotal     int64          `json:"order_total"`
+	OrderedAt      *time.Time     `json:"ordered_at,omitempty"`
+	ErrorMessage   string         `gorm:"type:text" json:"error_message,omitempty"`
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Contact      *Contact      `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+}
+
+func (Checkout) TableName() string {
+	return "checkouts"
+}
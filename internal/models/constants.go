@@ -16,6 +16,20 @@ const (
 	DirectionOutgoing Direction = "outgoing"
 )
 
+// Channel is the messaging platform an account is connected to
+type Channel string
+
+const (
+	ChannelWhatsApp  Channel = "whatsapp"
+	ChannelTelegram  Channel = "telegram"
+	ChannelInstagram Channel = "instagram"
+	ChannelMessenger Channel = "messenger"
+	ChannelWebChat   Channel = "webchat"
+	// ChannelSMS is only used on messages, for templates sent as SMS because
+	// WhatsApp couldn't deliver them
+	ChannelSMS Channel = "sms"
+)
+
 // MessageType represents the type of WhatsApp message
 type MessageType string
 
@@ -30,7 +44,8 @@ const (
 	MessageTypeFlow        MessageType = "flow"
 	MessageTypeReaction    MessageType = "reaction"
 	MessageTypeLocation    MessageType = "location"
-	MessageTypeContact     MessageType = "contact"
+	MessageTypeContacts    MessageType = "contacts"
+	MessageTypeOrder       MessageType = "order"
 )
 
 // MessageStatus represents the delivery status of a message
@@ -52,6 +67,8 @@ const (
 	AIProviderOpenAI    AIProvider = "openai"
 	AIProviderAnthropic AIProvider = "anthropic"
 	AIProviderGoogle    AIProvider = "google"
+	AIProviderOllama    AIProvider = "ollama"  // Ollama-compatible /api/chat endpoint, e.g. self-hosted
+	AIProviderWebhook   AIProvider = "webhook" // Any HTTP bot, with a templated request body and reply path
 )
 
 // MatchType represents keyword matching strategies
@@ -74,19 +91,67 @@ const (
 	ResponseTypeFlow     ResponseType = "flow"
 	ResponseTypeScript   ResponseType = "script"
 	ResponseTypeTransfer ResponseType = "transfer"
+	ResponseTypeTag      ResponseType = "tag"
+	ResponseTypeList     ResponseType = "list"
 )
 
 // FlowStepType represents chatbot flow step message types
 type FlowStepType string
 
 const (
-	FlowStepTypeText         FlowStepType = "text"
-	FlowStepTypeTemplate     FlowStepType = "template"
-	FlowStepTypeScript       FlowStepType = "script"
-	FlowStepTypeAPIFetch     FlowStepType = "api_fetch"
-	FlowStepTypeButtons      FlowStepType = "buttons"
-	FlowStepTypeTransfer     FlowStepType = "transfer"
-	FlowStepTypeWhatsAppFlow FlowStepType = "whatsapp_flow"
+	FlowStepTypeText          FlowStepType = "text"
+	FlowStepTypeTemplate      FlowStepType = "template"
+	FlowStepTypeScript        FlowStepType = "script"
+	FlowStepTypeAPIFetch      FlowStepType = "api_fetch"
+	FlowStepTypeButtons       FlowStepType = "buttons"
+	FlowStepTypeList          FlowStepType = "list"
+	FlowStepTypeMedia         FlowStepType = "media"
+	FlowStepTypeLocation      FlowStepType = "location"
+	FlowStepTypeReaction      FlowStepType = "reaction"
+	FlowStepTypeContacts      FlowStepType = "contacts"
+	FlowStepTypeTransfer      FlowStepType = "transfer"
+	FlowStepTypeWhatsAppFlow  FlowStepType = "whatsapp_flow"
+	FlowStepTypeFollowUp      FlowStepType = "follow_up"
+	FlowStepTypeAppointment   FlowStepType = "appointment"
+	FlowStepTypeProduct       FlowStepType = "product"
+	FlowStepTypeProductList   FlowStepType = "product_list"
+	FlowStepTypeCondition     FlowStepType = "condition"
+	FlowStepTypeJump          FlowStepType = "jump"
+	FlowStepTypePaymentLink   FlowStepType = "payment_link"
+	FlowStepTypeCalendarSlots FlowStepType = "calendar_slots"
+	FlowStepTypeOrderStatus   FlowStepType = "order_status"
+)
+
+// SentimentProvider represents how inbound messages are scored for sentiment
+type SentimentProvider string
+
+const (
+	SentimentProviderLexicon SentimentProvider = "lexicon"
+	SentimentProviderAI      SentimentProvider = "ai"
+)
+
+// SentimentAction represents what happens when a conversation turns negative
+type SentimentAction string
+
+const (
+	SentimentActionNotify  SentimentAction = "notify"
+	SentimentActionHandoff SentimentAction = "handoff"
+)
+
+// AbuseAction represents what happens when a contact floods or abuses the chatbot
+type AbuseAction string
+
+const (
+	AbuseActionPauseBot AbuseAction = "pause_bot"
+	AbuseActionBlock    AbuseAction = "block"
+)
+
+// TranscriptionProvider represents the speech-to-text service for voice notes
+type TranscriptionProvider string
+
+const (
+	TranscriptionProviderOpenAI  TranscriptionProvider = "openai"  // Whisper, or an OpenAI compatible server
+	TranscriptionProviderWebhook TranscriptionProvider = "webhook" // Custom endpoint that gets the audio and returns {"text": ...}
 )
 
 // SessionStatus represents chatbot session states
@@ -99,6 +164,17 @@ const (
 	SessionStatusTimeout   SessionStatus = "timeout"
 )
 
+// SessionMode represents who answers a chatbot session: the bot, or an agent once
+// it's handed off
+type SessionMode string
+
+const (
+	SessionModeBot          SessionMode = "bot"
+	SessionModePendingAgent SessionMode = "pending_agent" // Handed off, waiting in the agent queue
+	SessionModeAgent        SessionMode = "agent"         // Claimed by or assigned to an agent
+	SessionModeClosed       SessionMode = "closed"        // Closed, or its handoff ended
+)
+
 // TransferStatus represents agent transfer states
 type TransferStatus string
 
@@ -116,6 +192,30 @@ const (
 	TransferSourceFlow            TransferSource = "flow"
 	TransferSourceKeyword         TransferSource = "keyword"
 	TransferSourceChatbotDisabled TransferSource = "chatbot_disabled"
+	TransferSourceAI              TransferSource = "ai"           // The AI, or a bot, handed off to an agent
+	TransferSourceFallback        TransferSource = "fallback"     // The bot sent the fallback message too many times in a row
+	TransferSourceOutOfHours      TransferSource = "out_of_hours" // Received outside business hours, waiting for them to reopen
+	TransferSourceSentiment       TransferSource = "sentiment"    // The customer's messages turned negative
+)
+
+// TransferPriority represents how urgent an agent transfer is
+type TransferPriority string
+
+const (
+	TransferPriorityLow    TransferPriority = "low"
+	TransferPriorityNormal TransferPriority = "normal"
+	TransferPriorityHigh   TransferPriority = "high"
+	TransferPriorityUrgent TransferPriority = "urgent"
+)
+
+// SLAStatus represents where an agent transfer stands against its SLA policy
+type SLAStatus string
+
+const (
+	SLAStatusOnTrack  SLAStatus = "on_track"
+	SLAStatusAtRisk   SLAStatus = "at_risk"
+	SLAStatusBreached SLAStatus = "breached"
+	SLAStatusMet      SLAStatus = "met"
 )
 
 // CampaignStatus represents bulk message campaign states
@@ -132,6 +232,270 @@ const (
 	CampaignStatusFailed     CampaignStatus = "failed"
 )
 
+// CampaignWinnerMetric is the rate that decides the winning variant of a campaign
+type CampaignWinnerMetric string
+
+const (
+	CampaignWinnerMetricDeliveryRate CampaignWinnerMetric = "delivery_rate"
+	CampaignWinnerMetricReadRate     CampaignWinnerMetric = "read_rate"
+	CampaignWinnerMetricReplyRate    CampaignWinnerMetric = "reply_rate"
+)
+
+// ScheduledMessageStatus represents the state of a message scheduled from a conversation
+type ScheduledMessageStatus string
+
+const (
+	ScheduledMessageStatusScheduled ScheduledMessageStatus = "scheduled"
+	ScheduledMessageStatusSending   ScheduledMessageStatus = "sending"
+	ScheduledMessageStatusSent      ScheduledMessageStatus = "sent"
+	ScheduledMessageStatusFailed    ScheduledMessageStatus = "failed"
+	ScheduledMessageStatusCancelled ScheduledMessageStatus = "cancelled"
+)
+
+// FollowUpStatus represents the state of a follow-up reminder
+type FollowUpStatus string
+
+const (
+	FollowUpStatusPending   FollowUpStatus = "pending"
+	FollowUpStatusTriggered FollowUpStatus = "triggered"
+	FollowUpStatusResolved  FollowUpStatus = "resolved" // Customer replied before it was due
+	FollowUpStatusCancelled FollowUpStatus = "cancelled"
+	FollowUpStatusFailed    FollowUpStatus = "failed"
+)
+
+// InvitationStatus represents the state of an organization invitation
+type InvitationStatus string
+
+const (
+	InvitationStatusPending  InvitationStatus = "pending"
+	InvitationStatusAccepted InvitationStatus = "accepted"
+	InvitationStatusRevoked  InvitationStatus = "revoked"
+	InvitationStatusExpired  InvitationStatus = "expired"
+)
+
+// FollowUpAction represents what happens when a follow-up is due
+type FollowUpAction string
+
+const (
+	FollowUpActionReopen   FollowUpAction = "reopen"
+	FollowUpActionTemplate FollowUpAction = "template"
+)
+
+// FollowUpSource represents who set a follow-up
+type FollowUpSource string
+
+const (
+	FollowUpSourceAgent FollowUpSource = "agent"
+	FollowUpSourceFlow  FollowUpSource = "flow"
+)
+
+// CheckoutStatus represents the state of a commerce checkout's cart recovery
+type CheckoutStatus string
+
+const (
+	CheckoutStatusOpen      CheckoutStatus = "open"      // Waiting to be recovered
+	CheckoutStatusSending   CheckoutStatus = "sending"   // Recovery message being sent
+	CheckoutStatusSent      CheckoutStatus = "sent"      // Recovery message sent, no order yet
+	CheckoutStatusRecovered CheckoutStatus = "recovered" // Ordered after the recovery message
+	CheckoutStatusCompleted CheckoutStatus = "completed" // Ordered before a recovery message was due
+	CheckoutStatusSkipped   CheckoutStatus = "skipped"   // Not sent, e.g. no phone number, recovery turned off or the contact opted out
+	CheckoutStatusFailed    CheckoutStatus = "failed"
+)
+
+// CSATStatus represents the state of a satisfaction survey
+type CSATStatus string
+
+const (
+	CSATStatusSent      CSATStatus = "sent"      // Waiting for the rating
+	CSATStatusRated     CSATStatus = "rated"     // Rated, waiting for the comment
+	CSATStatusCompleted CSATStatus = "completed" // Rated, and commented if a comment was asked for
+)
+
+// Commerce platforms checkouts are received from
+const (
+	CheckoutSourceShopify = "shopify"
+)
+
+// PaymentLinkStatus represents the state of a payment link
+type PaymentLinkStatus string
+
+const (
+	PaymentLinkStatusCreated PaymentLinkStatus = "created" // Sent, waiting to be paid
+	PaymentLinkStatusPaid    PaymentLinkStatus = "paid"
+	PaymentLinkStatusExpired PaymentLinkStatus = "expired" // Expired or cancelled at the provider
+)
+
+// PaymentLinkSource is what created a payment link
+type PaymentLinkSource string
+
+const (
+	PaymentLinkSourceFlow PaymentLinkSource = "flow"
+	PaymentLinkSourceAI   PaymentLinkSource = "ai"
+)
+
+// OrderStatus represents the state of an order placed from a WhatsApp cart
+type OrderStatus string
+
+const (
+	OrderStatusReceived  OrderStatus = "received"
+	OrderStatusConfirmed OrderStatus = "confirmed"
+	OrderStatusFulfilled OrderStatus = "fulfilled"
+	OrderStatusCancelled OrderStatus = "cancelled"
+)
+
+// ContactOptInStatus represents whether a contact agreed to receive messages
+type ContactOptInStatus string
+
+const (
+	ContactOptInStatusUnknown  ContactOptInStatus = "unknown"
+	ContactOptInStatusOptedIn  ContactOptInStatus = "opted_in"
+	ContactOptInStatusOptedOut ContactOptInStatus = "opted_out" // Excluded from sequences and other marketing sends
+)
+
+// SequenceEnrollmentStatus represents the state of a contact in a drip sequence
+type SequenceEnrollmentStatus string
+
+const (
+	SequenceEnrollmentStatusActive    SequenceEnrollmentStatus = "active"
+	SequenceEnrollmentStatusCompleted SequenceEnrollmentStatus = "completed" // Every step was sent
+	SequenceEnrollmentStatusExited    SequenceEnrollmentStatus = "exited"    // Left early, see SequenceExitReason
+	SequenceEnrollmentStatusFailed    SequenceEnrollmentStatus = "failed"
+)
+
+// SequenceExitReason represents why a contact left a drip sequence early
+type SequenceExitReason string
+
+const (
+	SequenceExitReasonReplied    SequenceExitReason = "replied"
+	SequenceExitReasonOptedOut   SequenceExitReason = "opted_out"   // Opted out, e.g. replied with one of the sequence's exit keywords
+	SequenceExitReasonTagRemoved SequenceExitReason = "tag_removed" // No longer has the sequence's exit tag
+	SequenceExitReasonCancelled  SequenceExitReason = "cancelled"   // Removed by an agent, or the sequence was deleted
+	SequenceExitReasonOrdered    SequenceExitReason = "ordered"     // Placed the order an abandoned cart sequence was recovering
+)
+
+// AIQuickReplyAction represents what tapping a quick reply on an AI answer does
+type AIQuickReplyAction string
+
+const (
+	AIQuickReplyActionTransfer AIQuickReplyAction = "transfer"  // Hand the conversation to an agent
+	AIQuickReplyActionMainMenu AIQuickReplyAction = "main_menu" // Send the greeting and its buttons again
+	AIQuickReplyActionFlow     AIQuickReplyAction = "flow"      // Start a chatbot flow
+)
+
+// AIStreamSplit represents where streamed AI answers are split into messages
+type AIStreamSplit string
+
+const (
+	AIStreamSplitParagraph AIStreamSplit = "paragraph"
+	AIStreamSplitSentence  AIStreamSplit = "sentence"
+)
+
+// AppointmentStatus represents the state of an appointment
+type AppointmentStatus string
+
+const (
+	AppointmentStatusScheduled           AppointmentStatus = "scheduled"
+	AppointmentStatusRescheduleRequested AppointmentStatus = "reschedule_requested" // Customer asked for a new time
+	AppointmentStatusCancelled           AppointmentStatus = "cancelled"
+	AppointmentStatusCompleted           AppointmentStatus = "completed"
+)
+
+// AppointmentSource represents how an appointment was booked
+type AppointmentSource string
+
+const (
+	AppointmentSourceAPI  AppointmentSource = "api"
+	AppointmentSourceFlow AppointmentSource = "flow"
+)
+
+// AppointmentReminderStatus represents the state of an appointment reminder
+type AppointmentReminderStatus string
+
+const (
+	AppointmentReminderStatusPending   AppointmentReminderStatus = "pending"
+	AppointmentReminderStatusSent      AppointmentReminderStatus = "sent"
+	AppointmentReminderStatusFailed    AppointmentReminderStatus = "failed"
+	AppointmentReminderStatusCancelled AppointmentReminderStatus = "cancelled"
+)
+
+// AutomationActionType represents what an automation does when its rule matches
+type AutomationActionType string
+
+const (
+	AutomationActionSendTemplate AutomationActionType = "send_template"
+	AutomationActionSendText     AutomationActionType = "send_text"
+	AutomationActionAddTag       AutomationActionType = "add_tag"
+	AutomationActionRemoveTag    AutomationActionType = "remove_tag"
+	AutomationActionWebhook      AutomationActionType = "webhook"
+	AutomationActionSlack        AutomationActionType = "slack_notify"
+)
+
+// AutomationOperator represents how an automation condition compares a field
+type AutomationOperator string
+
+const (
+	AutomationOperatorEquals      AutomationOperator = "equals"
+	AutomationOperatorNotEquals   AutomationOperator = "not_equals"
+	AutomationOperatorContains    AutomationOperator = "contains"
+	AutomationOperatorNotContains AutomationOperator = "not_contains"
+	AutomationOperatorIsEmpty     AutomationOperator = "is_empty"
+	AutomationOperatorIsNotEmpty  AutomationOperator = "is_not_empty"
+)
+
+// SegmentOperator represents how a segment condition compares a contact field
+type SegmentOperator string
+
+const (
+	SegmentOperatorEquals      SegmentOperator = "equals"
+	SegmentOperatorNotEquals   SegmentOperator = "not_equals"
+	SegmentOperatorContains    SegmentOperator = "contains"
+	SegmentOperatorNotContains SegmentOperator = "not_contains"
+	SegmentOperatorIsEmpty     SegmentOperator = "is_empty"
+	SegmentOperatorIsNotEmpty  SegmentOperator = "is_not_empty"
+	SegmentOperatorGreaterThan SegmentOperator = "greater_than" // Engagement fields, in days
+	SegmentOperatorLessThan    SegmentOperator = "less_than"
+)
+
+// AutomationLogStatus represents the outcome of an automation execution
+type AutomationLogStatus string
+
+const (
+	AutomationLogStatusSuccess AutomationLogStatus = "success"
+	AutomationLogStatusFailed  AutomationLogStatus = "failed"
+)
+
+// UsageMetric represents a metered organization resource
+type UsageMetric string
+
+const (
+	UsageMetricMessages           UsageMetric = "messages"
+	UsageMetricCampaignRecipients UsageMetric = "campaign_recipients"
+	UsageMetricAICalls            UsageMetric = "ai_calls"
+	UsageMetricStorage            UsageMetric = "storage_bytes"
+	UsageMetricAgents             UsageMetric = "agents"
+)
+
+// PlanFeature represents a feature that is enabled per plan
+type PlanFeature string
+
+const (
+	PlanFeatureCampaigns        PlanFeature = "campaigns"
+	PlanFeatureMultipleAccounts PlanFeature = "multiple_accounts"
+	PlanFeatureSSO              PlanFeature = "sso"
+	PlanFeatureAI               PlanFeature = "ai"
+	PlanFeatureWebhooks         PlanFeature = "webhooks"
+	PlanFeatureAutomations      PlanFeature = "automations"
+	PlanFeatureAPIKeys          PlanFeature = "api_keys"
+)
+
+// WalletTransactionType represents the direction of a wallet transaction
+type WalletTransactionType string
+
+const (
+	WalletTransactionCredit WalletTransactionType = "credit"
+	WalletTransactionDebit  WalletTransactionType = "debit"
+)
+
 // TemplateStatus represents WhatsApp template approval states
 type TemplateStatus string
 
@@ -180,6 +544,7 @@ const (
 	AssignmentStrategyRoundRobin   AssignmentStrategy = "round_robin"
 	AssignmentStrategyLoadBalanced AssignmentStrategy = "load_balanced"
 	AssignmentStrategyManual       AssignmentStrategy = "manual"
+	AssignmentStrategySkillBased   AssignmentStrategy = "skill_based"
 )
 
 // SSOProviderType represents supported SSO providers
@@ -188,11 +553,28 @@ type SSOProviderType string
 const (
 	SSOProviderGoogle    SSOProviderType = "google"
 	SSOProviderMicrosoft SSOProviderType = "microsoft"
+	SSOProviderOkta      SSOProviderType = "okta"
 	SSOProviderGitHub    SSOProviderType = "github"
 	SSOProviderFacebook  SSOProviderType = "facebook"
 	SSOProviderCustom    SSOProviderType = "custom"
 )
 
+// APIKeyScope limits what an API key can be used for
+type APIKeyScope string
+
+const (
+	APIKeyScopeSend     APIKeyScope = "send"     // Send messages
+	APIKeyScopeRead     APIKeyScope = "read"     // Any GET request
+	APIKeyScopeContacts APIKeyScope = "contacts" // Manage contacts, tags and segments
+	APIKeyScopeAdmin    APIKeyScope = "admin"    // Everything the key's creator can do
+)
+
+// DefaultAPIKeyRateLimit is the requests per minute allowed for an API key without its own limit
+const DefaultAPIKeyRateLimit = 600
+
+// MaxAPIKeyRateLimit is the highest requests per minute an API key can be given
+const MaxAPIKeyRateLimit = 10000
+
 // WebhookEvent represents webhook event types
 type WebhookEvent string
 
@@ -200,10 +582,86 @@ const (
 	WebhookEventMessageIncoming  WebhookEvent = "message.incoming"
 	WebhookEventMessageOutgoing  WebhookEvent = "message.outgoing"
 	WebhookEventMessageSent      WebhookEvent = "message.sent"
+	WebhookEventMessageEdited    WebhookEvent = "message.edited"
+	WebhookEventMessageDeleted   WebhookEvent = "message.deleted"
+	WebhookEventMessageReaction  WebhookEvent = "message.reaction"
+	WebhookEventButtonReply      WebhookEvent = "message.button_reply"
+	WebhookEventOrderReceived    WebhookEvent = "order.received"
 	WebhookEventContactCreated   WebhookEvent = "contact.created"
 	WebhookEventTransferCreated  WebhookEvent = "transfer.created"
 	WebhookEventTransferResumed  WebhookEvent = "transfer.resumed"
 	WebhookEventTransferAssigned WebhookEvent = "transfer.assigned"
+	WebhookEventCampaignPaused   WebhookEvent = "campaign.paused"
+	WebhookEventUsageWarning     WebhookEvent = "usage.limit_warning"
+	WebhookEventUsageLimit       WebhookEvent = "usage.limit_reached"
+	WebhookEventUsageThrottled   WebhookEvent = "usage.campaigns_throttled"
+	WebhookEventQuotaWarning     WebhookEvent = "usage.quota_warning"
+	WebhookEventQuotaReached     WebhookEvent = "usage.quota_reached"
+	WebhookEventWalletLow        WebhookEvent = "wallet.low_balance"
+	WebhookEventWalletDepleted   WebhookEvent = "wallet.depleted"
+	WebhookEventFailoverStarted  WebhookEvent = "account.failover_started"
+	WebhookEventFailoverEnded    WebhookEvent = "account.failover_ended"
+	WebhookEventQualityDropped   WebhookEvent = "account.quality_dropped"
+	WebhookEventLimitTierChanged WebhookEvent = "account.limit_tier_changed"
+	WebhookEventBudgetWarning    WebhookEvent = "conversations.budget_warning"
+	WebhookEventBudgetReached    WebhookEvent = "conversations.budget_reached"
+	WebhookEventSentimentDropped WebhookEvent = "conversation.sentiment_dropped"
+	WebhookEventMessageFailed    WebhookEvent = "message.failed"
+	WebhookEventCampaignDone     WebhookEvent = "campaign.completed"
+	WebhookEventSessionHandoff   WebhookEvent = "session.handoff"
+	WebhookEventSLABreached      WebhookEvent = "transfer.sla_breached"
+	WebhookEventPaymentReceived  WebhookEvent = "payment.received"
+)
+
+// NotificationEvent is an event an organization can be notified of on Slack or by email
+type NotificationEvent string
+
+const (
+	NotificationEventHandoffRequested NotificationEvent = "handoff_requested"
+	NotificationEventSLABreached      NotificationEvent = "sla_breached"
+	NotificationEventCampaignFinished NotificationEvent = "campaign_finished"
+	NotificationEventAIProviderDown   NotificationEvent = "ai_provider_down"
+)
+
+// WebhookDeliveryStatus represents the outcome of delivering an event to a webhook
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryStatusFailed    WebhookDeliveryStatus = "failed"
+)
+
+// DeadLetterKind is what failed: a campaign send, a scheduled message or an inbound webhook
+type DeadLetterKind string
+
+const (
+	DeadLetterKindCampaignMessage  DeadLetterKind = "campaign_message"
+	DeadLetterKindScheduledMessage DeadLetterKind = "scheduled_message"
+	DeadLetterKindWebhook          DeadLetterKind = "webhook"
+)
+
+// DeadLetterStatus represents whether a dead letter is still waiting for an admin
+type DeadLetterStatus string
+
+const (
+	DeadLetterStatusPending   DeadLetterStatus = "pending"
+	DeadLetterStatusRetried   DeadLetterStatus = "retried"
+	DeadLetterStatusDiscarded DeadLetterStatus = "discarded"
+)
+
+// Template quality scores reported by Meta
+const (
+	TemplateQualityGreen   = "GREEN"
+	TemplateQualityYellow  = "YELLOW"
+	TemplateQualityRed     = "RED"
+	TemplateQualityUnknown = "UNKNOWN"
+)
+
+// What a NumberHealthEvent records a change of
+const (
+	NumberHealthQuality   = "quality"
+	NumberHealthLimitTier = "limit_tier"
 )
 
 // ActionType represents custom action types
@@ -214,3 +672,32 @@ const (
 	ActionTypeURL        ActionType = "url"
 	ActionTypeJavascript ActionType = "javascript"
 )
+
+// Admin audit log actions
+const (
+	AuditActionSearch = "search"
+)
+
+// Audit log actions
+const (
+	AuditActionCreate     = "create"
+	AuditActionUpdate     = "update"
+	AuditActionDelete     = "delete"
+	AuditActionRotate     = "rotate"
+	AuditActionRevoke     = "revoke"
+	AuditActionAssignRole = "assign_role"
+	AuditActionErase      = "erase"
+	AuditActionExport     = "export"
+)
+
+// Audit log resource types
+const (
+	AuditResourceChatbotSettings      = "chatbot_settings"
+	AuditResourceOrganizationSettings = "organization_settings"
+	AuditResourceTemplate             = "template"
+	AuditResourceRole                 = "role"
+	AuditResourceAPIKey               = "api_key"
+	AuditResourceUser                 = "user"
+	AuditResourceInvitation           = "invitation"
+	AuditResourceDataSubject          = "data_subject"
+)
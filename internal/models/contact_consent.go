@@ -0,0 +1,34 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// ContactConsentSource is what changed a contact's opt-in status
+type ContactConsentSource string
+
+const (
+	ContactConsentSourceKeyword ContactConsentSource = "keyword" // The contact sent an opt-out or opt-in keyword
+	ContactConsentSourceUser    ContactConsentSource = "user"    // Changed by an agent or through the API
+	ContactConsentSourceImport  ContactConsentSource = "import"  // Set by a contact import
+)
+
+// ContactConsentEvent records a change to a contact's opt-in status, so the
+// organization can show when and how a contact agreed to or refused messages
+type ContactConsentEvent struct {
+	BaseModel
+	OrganizationID uuid.UUID            `gorm:"type:uuid;index;not null" json:"organization_id"`
+	ContactID      uuid.UUID            `gorm:"type:uuid;index;not null" json:"contact_id"`
+	FromStatus     ContactOptInStatus   `gorm:"size:20" json:"from_status"`
+	ToStatus       ContactOptInStatus   `gorm:"size:20;not null" json:"to_status"`
+	Source         ContactConsentSource `gorm:"size:20;not null" json:"source"`
+	Keyword        string               `gorm:"size:100" json:"keyword,omitempty"` // The keyword the contact sent, for keyword changes
+	UserID         *uuid.UUID           `gorm:"type:uuid" json:"user_id,omitempty"`
+
+	// Relations
+	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+func (ContactConsentEvent) TableName() string {
+	return "contact_consent_events"
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ContactImportStatus is the processing state of a contact import
+type ContactImportStatus string
+
+const (
+	ContactImportStatusPending    ContactImportStatus = "pending"
+	ContactImportStatusProcessing ContactImportStatus = "processing"
+	ContactImportStatusCompleted  ContactImportStatus = "completed"
+)
+
+// ContactImport is a CSV file of contacts being added to an organization, with
+// the outcome of each row once processed
+type ContactImport struct {
+	BaseModel
+	OrganizationID uuid.UUID           `gorm:"type:uuid;index;not null" json:"organization_id"`
+	FileName       string              `gorm:"size:255" json:"file_name"`
+	Status         ContactImportStatus `gorm:"size:20;not null;default:'pending'" json:"status"`
+	ColumnMapping  JSONB               `gorm:"type:jsonb;default:'{}'" json:"column_mapping"` // CSV column -> contact field
+	UpdateExisting bool                `gorm:"default:true" json:"update_existing"`           // Merge rows into contacts that already have the number
+	TotalRows      int                 `gorm:"default:0" json:"total_rows"`
+	CreatedCount   int                 `gorm:"default:0" json:"created_count"`
+	UpdatedCount   int                 `gorm:"default:0" json:"updated_count"`
+	SkippedCount   int                 `gorm:"default:0" json:"skipped_count"` // Duplicate numbers in the file, or existing contacts left as they were
+	FailedCount    int                 `gorm:"default:0" json:"failed_count"`
+	Errors         JSONBArray          `gorm:"type:jsonb;default:'[]'" json:"errors"` // [{"row": 3, "phone_number": "...", "error": "..."}]
+	CreatedByID    *uuid.UUID          `gorm:"type:uuid" json:"created_by_id,omitempty"`
+	FinishedAt     *time.Time          `json:"finished_at,omitempty"`
+}
+
+func (ContactImport) TableName() string {
+	return "contact_imports"
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ContactNote is free-form information agents keep about a contact, such as
+// preferences or account details. Unlike chat messages it isn't tied to a
+// conversation, and pinned notes are shown first in the agent sidebar.
+type ContactNote struct {
+	BaseModel
+	OrganizationID uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
+	ContactID      uuid.UUID  `gorm:"type:uuid;index;not null" json:"contact_id"`
+	Content        string     `gorm:"type:text;not null" json:"content"`
+	IsPinned       bool       `gorm:"default:false" json:"is_pinned"`
+	CreatedByID    uuid.UUID  `gorm:"type:uuid;not null" json:"created_by_id"`
+	UpdatedByID    *uuid.UUID `gorm:"type:uuid" json:"updated_by_id,omitempty"`
+	EditedAt       *time.Time `json:"edited_at,omitempty"` // Last change to the content
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Contact      *Contact      `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+	CreatedBy    *User         `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
+	UpdatedBy    *User         `gorm:"foreignKey:UpdatedByID" json:"updated_by,omitempty"`
+}
+
+func (ContactNote) TableName() string {
+	return "contact_notes"
+}
+
+// ContactNoteRevision is the content of a contact note before an edit
+type ContactNoteRevision struct {
+	BaseModel
+	NoteID     uuid.UUID `gorm:"type:uuid;index;not null" json:"note_id"`
+	Content    string    `gorm:"type:text;not null" json:"content"`
+	EditedByID uuid.UUID `gorm:"type:uuid;not null" json:"edited_by_id"` // Who replaced this content
+
+	// Relations
+	Note     *ContactNote `gorm:"foreignKey:NoteID" json:"note,omitempty"`
+	EditedBy *User        `gorm:"foreignKey:EditedByID" json:"edited_by,omitempty"`
+}
+
+func (ContactNoteRevision) TableName() string {
+	return "contact_note_revisions"
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// ConversationCharge is a conversation, or a message on per-message pricing, that Meta
+// reported pricing for. Costs are estimated from the organization's conversation rates.
+type ConversationCharge struct {
+	BaseModel
+	OrganizationID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_conversation_charges_org_ref;index:idx_conversation_charges_org_period" json:"organization_id"`
+	Reference       string    `gorm:"size:300;not null;uniqueIndex:idx_conversation_charges_org_ref" json:"reference"` // conversation:<id> or message:<wamid>
+	Period          string    `gorm:"size:7;not null;index:idx_conversation_charges_org_period" json:"period"`         // YYYY-MM, UTC
+	WhatsAppAccount string    `gorm:"size:100" json:"whatsapp_account"`                                                // References WhatsAppAccount.Name
+	ContactID       uuid.UUID `gorm:"type:uuid" json:"contact_id"`
+	ConversationID  string    `gorm:"size:255" json:"conversation_id"`
+	Category        string    `gorm:"size:50" json:"category"`      // marketing, utility, authentication, service, ...
+	PricingModel    string    `gorm:"size:20" json:"pricing_model"` // CBP (per conversation), PMP (per message)
+	Billable        bool      `gorm:"default:false" json:"billable"`
+	Cost            int64     `gorm:"default:0" json:"cost"` // In the smallest unit of the organization's conversation currency
+}
+
+func (ConversationCharge) TableName() string {
+	return "conversation_charges"
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CRMContact links a contact to its record in the organization's CRM. Contacts are
+// pushed when their synced fields change, and mapped CRM fields are pulled back
+// into their custom attributes.
+type CRMContact struct {
+	BaseModel
+	OrganizationID uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
+	ContactID      uuid.UUID  `gorm:"type:uuid;uniqueIndex;not null" json:"contact_id"`
+	Provider       string     `gorm:"size:20;not null" json:"provider"`  // hubspot or salesforce
+	ExternalID     string     `gorm:"size:100;index" json:"external_id"` // ID of the contact in the CRM
+	PushedHash     string     `gorm:"size:64" json:"-"`                  // Hash of the fields last pushed
+	PushedAt       *time.Time `json:"pushed_at,omitempty"`
+	PulledAt       *time.Time `gorm:"index" json:"pulled_at,omitempty"`
+	ErrorMessage   string     `gorm:"type:text" json:"error_message,omitempty"` // Why the last sync failed
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Contact      *Contact      `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+}
+
+func (CRMContact) TableName() string {
+	return "crm_contacts"
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CSATResponse is a satisfaction survey sent to a contact after a conversation,
+// with their 1 to 5 rating and comment once they answer it
+type CSATResponse struct {
+	BaseModel
+	OrganizationID  uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
+	ContactID       uuid.UUID  `gorm:"type:uuid;index;not null" json:"contact_id"`      // Nil once the contact's personal data is erased
+	WhatsAppAccount string     `gorm:"size:100;index;not null" json:"whatsapp_account"` // References WhatsAppAccount.Name
+	SessionID       *uuid.UUID `gorm:"type:uuid;index" json:"session_id,omitempty"`     // Chatbot session the survey is about
+	TransferID      *uuid.UUID `gorm:"type:uuid;index" json:"transfer_id,omitempty"`    // Handoff the survey is about, if an agent handled it
+	AgentID         *uuid.UUID `gorm:"type:uuid;index" json:"agent_id,omitempty"`       // Agent who handled the conversation
+	Status          CSATStatus `gorm:"size:20;default:'sent';index" json:"status"`
+	Rating          *int       `json:"rating,omitempty"` // 1 to 5
+	Comment         string     `gorm:"type:text" json:"comment"`
+	SentAt          time.Time  `gorm:"index;not null" json:"sent_at"`
+	RatedAt         *time.Time `json:"rated_at,omitempty"`
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Agent        *User         `gorm:"foreignKey:AgentID" json:"agent,omitempty"`
+}
+
+func (CSATResponse) TableName() string {
+	return "csat_responses"
+}
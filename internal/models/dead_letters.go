@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeadLetter is a send or job that failed for good once its retries ran out. It keeps
+// what's needed to run it again, so admins can retry it after fixing the cause.
+type DeadLetter struct {
+	BaseModel
+	OrganizationID uuid.UUID        `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Kind           DeadLetterKind   `gorm:"size:30;not null" json:"kind"`
+	ReferenceID    *uuid.UUID       `gorm:"type:uuid;index" json:"reference_id,omitempty"` // Campaign recipient or scheduled message
+	Payload        JSONB            `gorm:"type:jsonb;default:'{}'" json:"payload"`        // Job or webhook payload to run again
+	Error          string           `gorm:"type:text" json:"error"`
+	ErrorCode      int              `gorm:"default:0" json:"error_code,omitempty"`
+	Attempts       int              `gorm:"default:1" json:"attempts"`
+	Status         DeadLetterStatus `gorm:"size:20;not null" json:"status"`
+	RetryCount     int              `gorm:"default:0" json:"retry_count"`
+	RetriedAt      *time.Time       `json:"retried_at,omitempty"`
+	ResolvedByID   *uuid.UUID       `gorm:"type:uuid" json:"resolved_by_id,omitempty"` // Who retried or discarded it
+}
+
+func (DeadLetter) TableName() string {
+	return "dead_letters"
+}
@@ -0,0 +1,241 @@
+package models
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm/schema"
+)
+
+// EncryptionKeySize is the size of master keys and data keys, for AES-256
+const EncryptionKeySize = 32
+
+// encryptedPrefix marks a value encrypted by EncryptSecret. The format is
+// enc:v1:<master key id>:<data key sealed by the master key>:<value sealed by the data key>
+const encryptedPrefix = "enc:v1:"
+
+// ErrEncryptionKeyUnknown is returned for a value encrypted with a master key that
+// isn't configured
+var ErrEncryptionKeyUnknown = errors.New("value is encrypted with an unknown master key")
+
+// encryptionKeys are the configured master keys, see SetEncryptionKeys
+var encryptionKeys struct {
+	sync.RWMutex
+	current string                 // ID of the key new values are encrypted with, empty when encryption is off
+	aeads   map[string]cipher.AEAD // Master keys by ID
+}
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// SetEncryptionKeys sets the master keys of fields tagged serializer:encrypted.
+// Values are encrypted with current; previous keys still decrypt values written
+// before a rotation. A nil current key stores new values in plaintext.
+func SetEncryptionKeys(current []byte, previous ...[]byte) error {
+	aeads := map[string]cipher.AEAD{}
+	currentID := ""
+	for i, key := range append([][]byte{current}, previous...) {
+		if key == nil {
+			continue
+		}
+		aead, err := newKeyAEAD(key)
+		if err != nil {
+			return err
+		}
+		id := EncryptionKeyID(key)
+		aeads[id] = aead
+		if i == 0 {
+			currentID = id
+		}
+	}
+
+	encryptionKeys.Lock()
+	defer encryptionKeys.Unlock()
+	encryptionKeys.current = currentID
+	encryptionKeys.aeads = aeads
+	return nil
+}
+
+// EncryptionEnabled reports whether new values are encrypted
+func EncryptionEnabled() bool {
+	encryptionKeys.RLock()
+	defer encryptionKeys.RUnlock()
+	return encryptionKeys.current != ""
+}
+
+// EncryptionKeyID identifies a master key in encrypted values without revealing it
+func EncryptionKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// IsEncryptedSecret reports whether a stored value is encrypted
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// NeedsReencryption reports whether a stored value is in plaintext or encrypted with
+// a master key other than the current one, so a key rotation should rewrite it
+func NeedsReencryption(value string) bool {
+	encryptionKeys.RLock()
+	defer encryptionKeys.RUnlock()
+	if value == "" || encryptionKeys.current == "" {
+		return false
+	}
+	keyID, _, _, err := splitEncrypted(value)
+	return err != nil || keyID != encryptionKeys.current
+}
+
+// EncryptSecret encrypts a value with a new data key, sealed in turn by the current
+// master key. Values are returned unchanged when encryption is off.
+func EncryptSecret(plaintext string) (string, error) {
+	encryptionKeys.RLock()
+	defer encryptionKeys.RUnlock()
+	if plaintext == "" || encryptionKeys.current == "" {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, EncryptionKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	sealedKey, err := seal(encryptionKeys.aeads[encryptionKeys.current], dataKey)
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newKeyAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealedValue, err := seal(dataAEAD, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + encryptionKeys.current + ":" +
+		base64.RawStdEncoding.EncodeToString(sealedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealedValue), nil
+}
+
+// DecryptSecret decrypts a value encrypted by EncryptSecret. Values stored before
+// encryption was turned on are returned unchanged.
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	keyID, sealedKey, sealedValue, err := splitEncrypted(value)
+	if err != nil {
+		return "", err
+	}
+
+	encryptionKeys.RLock()
+	masterAEAD, ok := encryptionKeys.aeads[keyID]
+	encryptionKeys.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w %s", ErrEncryptionKeyUnknown, keyID)
+	}
+
+	dataKey, err := open(masterAEAD, sealedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	dataAEAD, err := newKeyAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataAEAD, sealedValue)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// splitEncrypted returns the master key ID, sealed data key and sealed value of an
+// encrypted value
+func splitEncrypted(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if !IsEncryptedSecret(value) || len(parts) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	sealedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted data key: %w", err)
+	}
+	sealedValue, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	return parts[0], sealedKey, sealedValue, nil
+}
+
+func newKeyAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption keys must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts with AES-GCM under a random nonce, which is prepended to the result
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+// EncryptedSerializer stores string fields tagged serializer:encrypted encrypted at
+// rest, and decrypts them when they're loaded
+type EncryptedSerializer struct{}
+
+// Scan decrypts a stored value into the field
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("unsupported data type %T for encrypted field %s", dbValue, field.Name)
+	}
+
+	plaintext, err := DecryptSecret(stored)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %w", field.Name, err)
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+// Value encrypts the field's value to be stored
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("encrypted field %s must be a string, got %T", field.Name, fieldValue)
+	}
+	return EncryptSecret(plaintext)
+}
@@ -0,0 +1,90 @@
+package models_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, models.EncryptionKeySize)
+	newKey := bytes.Repeat([]byte{2}, models.EncryptionKeySize)
+	t.Cleanup(func() { _ = models.SetEncryptionKeys(nil) })
+
+	// Encryption off: values are stored as they are
+	require.NoError(t, models.SetEncryptionKeys(nil))
+	plain, err := models.EncryptSecret("EAAB-token")
+	require.NoError(t, err)
+	assert.Equal(t, "EAAB-token", plain)
+	assert.False(t, models.NeedsReencryption(plain))
+
+	require.NoError(t, models.SetEncryptionKeys(oldKey))
+	encrypted, err := models.EncryptSecret("EAAB-token")
+	require.NoError(t, err)
+	assert.True(t, models.IsEncryptedSecret(encrypted))
+	assert.NotContains(t, encrypted, "EAAB-token")
+	assert.Contains(t, encrypted, models.EncryptionKeyID(oldKey))
+	again, _ := models.EncryptSecret("EAAB-token")
+	assert.NotEqual(t, encrypted, again, "each value has its own data key and nonce")
+
+	decrypted, err := models.DecryptSecret(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "EAAB-token", decrypted)
+	decrypted, err = models.DecryptSecret(plain)
+	require.NoError(t, err)
+	assert.Equal(t, "EAAB-token", decrypted, "plaintext stored before encryption still loads")
+	assert.True(t, models.NeedsReencryption(plain))
+	assert.False(t, models.NeedsReencryption(encrypted))
+
+	empty, err := models.EncryptSecret("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	// Rotation: the previous key still decrypts, and its values need re-encryption
+	require.NoError(t, models.SetEncryptionKeys(newKey, oldKey))
+	decrypted, err = models.DecryptSecret(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "EAAB-token", decrypted)
+	assert.True(t, models.NeedsReencryption(encrypted))
+
+	require.NoError(t, models.SetEncryptionKeys(newKey))
+	_, err = models.DecryptSecret(encrypted)
+	assert.ErrorIs(t, err, models.ErrEncryptionKeyUnknown)
+
+	// A modified value fails authentication
+	i, c := len(encrypted)-10, "A"
+	if encrypted[i] == 'A' {
+		c = "B"
+	}
+	require.NoError(t, models.SetEncryptionKeys(oldKey))
+	_, err = models.DecryptSecret(encrypted[:i] + c + encrypted[i+1:])
+	assert.Error(t, err)
+
+	assert.Error(t, models.SetEncryptionKeys([]byte("short")))
+}
+
+func TestSettingSecrets(t *testing.T) {
+	t.Cleanup(func() { _ = models.SetEncryptionKeys(nil) })
+	require.NoError(t, models.SetEncryptionKeys(bytes.Repeat([]byte{1}, models.EncryptionKeySize)))
+
+	section := map[string]interface{}{"account_sid": "AC123", "auth_token": "secret"}
+	require.NoError(t, models.EncryptSettingSecrets("sms_fallback", section))
+	encrypted := section["auth_token"].(string)
+	assert.True(t, models.IsEncryptedSecret(encrypted))
+	assert.Equal(t, "AC123", section["account_sid"], "only credentials are encrypted")
+	assert.Equal(t, "secret", models.SettingSecret(section, "auth_token"))
+
+	// Encrypted values aren't encrypted again
+	require.NoError(t, models.EncryptSettingSecrets("sms_fallback", section))
+	assert.Equal(t, encrypted, section["auth_token"])
+
+	// Plaintext stored before encryption still reads, and credentials whose key is
+	// gone read as unset
+	assert.Equal(t, "secret", models.SettingSecret(map[string]interface{}{"auth_token": "secret"}, "auth_token"))
+	require.NoError(t, models.SetEncryptionKeys(bytes.Repeat([]byte{2}, models.EncryptionKeySize)))
+	assert.Empty(t, models.SettingSecret(section, "auth_token"))
+	assert.Empty(t, models.SettingSecret(section, "missing"))
+}
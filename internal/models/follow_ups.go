@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FollowUp is a reminder on a conversation that fires if the customer has not
+// replied by DueAt. It either reopens the conversation for the agent or sends
+// a nudge template. A reply from the customer resolves it.
+type FollowUp struct {
+	BaseModel
+	OrganizationID  uuid.UUID      `gorm:"type:uuid;index;not null" json:"organization_id"`
+	ContactID       uuid.UUID      `gorm:"type:uuid;index;not null" json:"contact_id"`
+	WhatsAppAccount string         `gorm:"size:100" json:"whatsapp_account"` // References WhatsAppAccount.Name
+	DueAt           time.Time      `gorm:"index;not null" json:"due_at"`
+	Action          FollowUpAction `gorm:"size:20;not null" json:"action"`
+	TemplateID      *uuid.UUID     `gorm:"type:uuid" json:"template_id,omitempty"` // Nudge template for the template action
+	TemplateParams  JSONB          `gorm:"type:jsonb;default:'{}'" json:"template_params"`
+	Note            string         `gorm:"type:text" json:"note"`
+	Source          FollowUpSource `gorm:"size:20;not null" json:"source"`
+	Status          FollowUpStatus `gorm:"size:20;index;not null" json:"status"`
+	AssignedUserID  *uuid.UUID     `gorm:"type:uuid" json:"assigned_user_id,omitempty"` // Agent the conversation is reopened for
+	CreatedByID     *uuid.UUID     `gorm:"type:uuid" json:"created_by_id,omitempty"`    // Nil when set by a flow
+	TriggeredAt     *time.Time     `json:"triggered_at,omitempty"`
+	ResolvedAt      *time.Time     `json:"resolved_at,omitempty"`
+	MessageID       *uuid.UUID     `gorm:"type:uuid" json:"message_id,omitempty"` // Nudge message when sent
+	ErrorMessage    string         `gorm:"type:text" json:"error_message,omitempty"`
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Contact      *Contact      `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+	Template     *Template     `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
+	AssignedUser *User         `gorm:"foreignKey:AssignedUserID" json:"assigned_user,omitempty"`
+	CreatedBy    *User         `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
+}
+
+func (FollowUp) TableName() string {
+	return "follow_ups"
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WhatsAppGroup is a WhatsApp group the business phone number belongs to. Group
+// conversations are kept apart from contact chats, since a group has many senders.
+type WhatsAppGroup struct {
+	BaseModel
+	OrganizationID  uuid.UUID  `gorm:"type:uuid;uniqueIndex:idx_wa_group_org_meta;not null" json:"organization_id"`
+	WhatsAppAccount string     `gorm:"size:100;index;not null" json:"whatsapp_account"` // References WhatsAppAccount.Name
+	MetaGroupID     string     `gorm:"size:255;uniqueIndex:idx_wa_group_org_meta;not null" json:"meta_group_id"`
+	Subject         string     `gorm:"size:255" json:"subject"`
+	Description     string     `gorm:"type:text" json:"description"`
+	InviteLink      string     `gorm:"type:text" json:"invite_link"`
+	ChatbotEnabled  bool       `gorm:"default:false" json:"chatbot_enabled"` // Reply to keyword rules when the business number is mentioned
+	LastMessageAt   *time.Time `json:"last_message_at,omitempty"`
+
+	// Relations
+	Organization *Organization              `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Participants []WhatsAppGroupParticipant `gorm:"foreignKey:GroupID" json:"participants,omitempty"`
+}
+
+func (WhatsAppGroup) TableName() string {
+	return "whatsapp_groups"
+}
+
+// WhatsAppGroupParticipant is a member of a group, past or present
+type WhatsAppGroupParticipant struct {
+	BaseModel
+	GroupID     uuid.UUID  `gorm:"type:uuid;uniqueIndex:idx_wa_group_participant;not null" json:"group_id"`
+	PhoneNumber string     `gorm:"size:20;uniqueIndex:idx_wa_group_participant;not null" json:"phone_number"`
+	ProfileName string     `gorm:"size:255" json:"profile_name"`
+	ContactID   *uuid.UUID `gorm:"type:uuid;index" json:"contact_id,omitempty"` // Set when the participant is also a contact
+	JoinedAt    time.Time  `json:"joined_at"`
+	LeftAt      *time.Time `json:"left_at,omitempty"`
+
+	// Relations
+	Group   *WhatsAppGroup `gorm:"foreignKey:GroupID" json:"group,omitempty"`
+	Contact *Contact       `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+}
+
+func (WhatsAppGroupParticipant) TableName() string {
+	return "whatsapp_group_participants"
+}
+
+// GroupMessage is a message sent or received in a group
+type GroupMessage struct {
+	BaseModel
+	OrganizationID    uuid.UUID     `gorm:"type:uuid;index;not null" json:"organization_id"`
+	GroupID           uuid.UUID     `gorm:"type:uuid;index;not null" json:"group_id"`
+	WhatsAppMessageID string        `gorm:"column:whats_app_message_id;size:255;index" json:"whatsapp_message_id"`
+	Direction         Direction     `gorm:"size:10;not null" json:"direction"`
+	SenderPhone       string        `gorm:"size:20" json:"sender_phone"` // Empty for outgoing messages
+	SenderName        string        `gorm:"size:255" json:"sender_name"`
+	MessageType       MessageType   `gorm:"size:20;not null" json:"message_type"`
+	Content           string        `gorm:"type:text" json:"content"`
+	Mentions          JSONBArray    `gorm:"type:jsonb;default:'[]'" json:"mentions"` // Phone numbers mentioned with @
+	Status            MessageStatus `gorm:"size:20;default:'pending'" json:"status"`
+	ErrorMessage      string        `gorm:"type:text" json:"error_message"`
+	SentByUserID      *uuid.UUID    `gorm:"type:uuid" json:"sent_by_user_id,omitempty"`
+
+	// Relations
+	Group      *WhatsAppGroup `gorm:"foreignKey:GroupID" json:"group,omitempty"`
+	SentByUser *User          `gorm:"foreignKey:SentByUserID" json:"sent_by_user,omitempty"`
+}
+
+func (GroupMessage) TableName() string {
+	return "group_messages"
+}
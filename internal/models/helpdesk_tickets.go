@@ -0,0 +1,28 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// HelpdeskTicket is a ticket created in the organization's helpdesk when a
+// conversation was handed off and no agent was available. The customer's messages
+// are added to it as comments while the transfer is active.
+type HelpdeskTicket struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
+	ContactID      uuid.UUID `gorm:"type:uuid;index;not null" json:"contact_id"`
+	TransferID     uuid.UUID `gorm:"type:uuid;uniqueIndex;not null" json:"transfer_id"` // Agent transfer the ticket was created for
+	Provider       string    `gorm:"size:20;not null" json:"provider"`                  // zendesk or freshdesk
+	ExternalID     string    `gorm:"size:100" json:"external_id"`                       // ID of the ticket in the helpdesk
+	RequesterID    string    `gorm:"size:100" json:"requester_id"`                      // Helpdesk user comments are added as
+	URL            string    `gorm:"size:500" json:"url"`
+
+	// Relations
+	Organization *Organization  `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Contact      *Contact       `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+	Transfer     *AgentTransfer `gorm:"foreignKey:TransferID" json:"transfer,omitempty"`
+}
+
+func (HelpdeskTicket) TableName() string {
+	return "helpdesk_tickets"
+}
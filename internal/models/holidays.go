@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Holiday is a closed day that overrides business hours, delays SLA timers
+// and holds back scheduled campaign sends
+type Holiday struct {
+	BaseModel
+	OrganizationID  uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
+	WhatsAppAccount string    `gorm:"size:100;index" json:"whatsapp_account"` // Empty applies to all numbers
+	Calendar        string    `gorm:"size:100;index" json:"calendar"`         // Region calendar name, e.g. "US" or "India"
+	Name            string    `gorm:"size:255;not null" json:"name"`
+	Date            time.Time `gorm:"type:date;not null" json:"date"`
+	Recurring       bool      `json:"recurring"`                              // Repeats yearly on the same month and day
+	Source          string    `gorm:"size:20;default:'manual'" json:"source"` // manual, ical
+	ExternalUID     string    `gorm:"size:255" json:"external_uid,omitempty"` // iCal UID, used to dedupe re-imports
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+}
+
+func (Holiday) TableName() string {
+	return "holidays"
+}
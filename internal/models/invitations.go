@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InvitationExpiry is how long an invitation can be accepted for
+const InvitationExpiry = 7 * 24 * time.Hour
+
+// Invitation invites someone by email to join an organization with a role. The
+// token is only sent to the invitee; the invitation keeps its hash.
+type Invitation struct {
+	BaseModel
+	OrganizationID uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Email          string     `gorm:"size:255;index;not null" json:"email"`
+	RoleID         *uuid.UUID `gorm:"type:uuid" json:"role_id,omitempty"`
+	TokenHash      string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	InvitedByID    *uuid.UUID `gorm:"type:uuid" json:"invited_by_id,omitempty"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	UserID         *uuid.UUID `gorm:"type:uuid" json:"user_id,omitempty"` // User created on acceptance
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Role         *CustomRole   `gorm:"foreignKey:RoleID" json:"role,omitempty"`
+	InvitedBy    *User         `gorm:"foreignKey:InvitedByID" json:"invited_by,omitempty"`
+}
+
+func (Invitation) TableName() string {
+	return "invitations"
+}
+
+// Status returns pending, accepted, revoked or expired
+func (i *Invitation) Status(now time.Time) InvitationStatus {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationStatusAccepted
+	case i.RevokedAt != nil:
+		return InvitationStatusRevoked
+	case now.After(i.ExpiresAt):
+		return InvitationStatusExpired
+	}
+	return InvitationStatusPending
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// KnowledgeSource is how a knowledge base entry was added
+type KnowledgeSource string
+
+const (
+	KnowledgeSourceDocument KnowledgeSource = "document"
+	KnowledgeSourceFAQ      KnowledgeSource = "faq"
+)
+
+// KnowledgeStatus is the indexing state of a knowledge base entry
+type KnowledgeStatus string
+
+const (
+	KnowledgeStatusPending KnowledgeStatus = "pending"
+	KnowledgeStatusReady   KnowledgeStatus = "ready"
+	KnowledgeStatusFailed  KnowledgeStatus = "failed"
+)
+
+// KnowledgeDocument is a document or FAQ entry the AI answers from
+type KnowledgeDocument struct {
+	BaseModel
+	OrganizationID uuid.UUID       `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Source         KnowledgeSource `gorm:"size:20;not null" json:"source"`
+	Title          string          `gorm:"size:255;not null" json:"title"`    // The question of FAQ entries
+	Content        string          `gorm:"type:text;not null" json:"content"` // The answer of FAQ entries
+	FileName       string          `gorm:"size:255" json:"file_name,omitempty"`
+	Status         KnowledgeStatus `gorm:"size:20;not null;default:'pending'" json:"status"`
+	Error          string          `gorm:"type:text" json:"error,omitempty"`
+	ChunkCount     int             `gorm:"default:0" json:"chunk_count"`
+	EmbeddingModel string          `gorm:"size:150" json:"embedding_model"` // provider/model the chunks were embedded with
+	CreatedByID    *uuid.UUID      `gorm:"type:uuid" json:"created_by_id,omitempty"`
+}
+
+func (KnowledgeDocument) TableName() string {
+	return "knowledge_documents"
+}
+
+// KnowledgeChunk is a passage of a knowledge base entry with its embedding
+type KnowledgeChunk struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
+	DocumentID     uuid.UUID `gorm:"type:uuid;index;not null" json:"document_id"`
+	Position       int       `gorm:"default:0" json:"position"`
+	Content        string    `gorm:"type:text;not null" json:"content"`
+	Embedding      Embedding `gorm:"type:jsonb" json:"-"`
+}
+
+func (KnowledgeChunk) TableName() string {
+	return "knowledge_chunks"
+}
+
+// Embedding is a vector stored as a JSONB array
+type Embedding []float32
+
+func (e Embedding) Value() (driver.Value, error) {
+	if e == nil {
+		return nil, nil
+	}
+	return json.Marshal(e)
+}
+
+func (e *Embedding) Scan(value interface{}) error {
+	if value == nil {
+		*e = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return errors.New("type assertion to []byte failed")
+	}
+	return json.Unmarshal(bytes, e)
+}
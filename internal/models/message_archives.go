@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageArchive is a batch of a contact's messages moved out of the database once
+// they were older than the organization's retention period. The messages are kept
+// in archive storage as gzipped JSON lines, and their media under MediaPrefix.
+type MessageArchive struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
+	ContactID      uuid.UUID `gorm:"type:uuid;index:idx_message_archives_contact;not null" json:"contact_id"`
+	FirstMessageAt time.Time `gorm:"index:idx_message_archives_contact;not null" json:"first_message_at"`
+	LastMessageAt  time.Time `gorm:"not null" json:"last_message_at"`
+	MessageCount   int       `gorm:"not null" json:"message_count"`
+	MediaCount     int       `gorm:"default:0" json:"media_count"`
+	StorageKey     string    `gorm:"size:500;not null" json:"storage_key"`
+	SizeBytes      int64     `gorm:"default:0" json:"size_bytes"` // Of the compressed file
+}
+
+func (MessageArchive) TableName() string {
+	return "message_archives"
+}
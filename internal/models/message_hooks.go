@@ -0,0 +1,34 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// Message hook stages
+const (
+	MessageHookStageInbound  = "inbound"  // Before an incoming message is saved and answered
+	MessageHookStageOutbound = "outbound" // Before an outgoing message is sent
+)
+
+// MessageHook is an organization's HTTP endpoint that sees messages as they're
+// processed, and can rewrite, enrich or stop them
+type MessageHook struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Name           string    `gorm:"size:255;not null" json:"name"`
+	Stage          string    `gorm:"size:20;not null" json:"stage"` // inbound or outbound
+	URL            string    `gorm:"type:text;not null" json:"url"`
+	Headers        JSONB     `gorm:"type:jsonb;default:'{}'" json:"headers"`
+	Secret         string    `gorm:"size:255" json:"-"`                  // For HMAC signature
+	TimeoutSecs    int       `gorm:"default:5" json:"timeout_secs"`      // How long a message waits for the hook
+	Position       int       `gorm:"default:0" json:"position"`          // Hooks of a stage run in position order
+	StopOnError    bool      `gorm:"default:false" json:"stop_on_error"` // Stop the message when the hook fails, instead of skipping the hook
+	IsActive       bool      `gorm:"default:true" json:"is_active"`
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+}
+
+func (MessageHook) TableName() string {
+	return "message_hooks"
+}
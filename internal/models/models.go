@@ -90,6 +90,16 @@ type Organization struct {
 	Name     string `gorm:"size:255;not null" json:"name"`
 	Slug     string `gorm:"size:100;uniqueIndex;not null" json:"slug"`
 	Settings JSONB  `gorm:"type:jsonb;default:'{}'" json:"settings"`
+	Plan     string `gorm:"size:50" json:"plan"` // Plan name, empty for the default plan
+
+	// Trial. The organization is read-only once TrialEndsAt passes, until a plan is selected.
+	TrialStartedAt        *time.Time `json:"trial_started_at,omitempty"`
+	TrialEndsAt           *time.Time `gorm:"index" json:"trial_ends_at,omitempty"`
+	TrialReminderDays     int        `gorm:"default:0" json:"-"` // Days before the end of the last reminder sent
+	TrialExpiryNotifiedAt *time.Time `json:"-"`
+
+	// Fair-use quotas on outbound messages and AI calls, on top of the plan's limits
+	Quotas FairUseQuotas `gorm:"embedded;embeddedPrefix:quota_" json:"quotas"`
 
 	// Relations
 	Users            []User            `gorm:"foreignKey:OrganizationID" json:"users,omitempty"`
@@ -117,6 +127,12 @@ type User struct {
 	SSOProvider   string `gorm:"size:50" json:"sso_provider,omitempty"`     // google, microsoft, github, facebook, custom
 	SSOProviderID string `gorm:"size:255" json:"sso_provider_id,omitempty"` // External user ID from provider
 
+	// Two-factor authentication
+	TwoFactorEnabled     bool        `gorm:"default:false" json:"two_factor_enabled"`
+	TOTPSecret           string      `gorm:"type:text;serializer:encrypted" json:"-"` // Base32 TOTP secret, encrypted at rest when encryption.key is set
+	TOTPLastStep         int64       `gorm:"default:0" json:"-"`                      // Time step of the last accepted code, to reject replays
+	TwoFactorBackupCodes StringArray `gorm:"type:jsonb;default:'[]'" json:"-"`        // SHA-256 hashes of unused backup codes
+
 	// Relations
 	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
 	Role         *CustomRole   `gorm:"foreignKey:RoleID" json:"role,omitempty"`
@@ -164,10 +180,11 @@ func (Team) TableName() string {
 // TeamMember represents a user's membership in a team
 type TeamMember struct {
 	BaseModel
-	TeamID         uuid.UUID  `gorm:"type:uuid;index;not null" json:"team_id"`
-	UserID         uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
-	Role           TeamRole   `gorm:"size:50;default:'agent'" json:"role"` // manager, agent
-	LastAssignedAt *time.Time `json:"last_assigned_at,omitempty"`          // For round-robin tracking
+	TeamID         uuid.UUID   `gorm:"type:uuid;index;not null" json:"team_id"`
+	UserID         uuid.UUID   `gorm:"type:uuid;index;not null" json:"user_id"`
+	Role           TeamRole    `gorm:"size:50;default:'agent'" json:"role"`   // manager, agent
+	LastAssignedAt *time.Time  `json:"last_assigned_at,omitempty"`            // For round-robin tracking
+	Skills         StringArray `gorm:"type:jsonb;default:'[]'" json:"skills"` // Matched against contact tags by skill-based assignment
 
 	// Relations
 	Team *Team `gorm:"foreignKey:TeamID" json:"team,omitempty"`
@@ -181,14 +198,18 @@ func (TeamMember) TableName() string {
 // APIKey represents an API key for programmatic access
 type APIKey struct {
 	BaseModel
-	OrganizationID uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
-	UserID         uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"` // Creator
-	Name           string     `gorm:"size:255;not null" json:"name"`
-	KeyPrefix      string     `gorm:"size:8;index" json:"key_prefix"` // First 8 chars for identification
-	KeyHash        string     `gorm:"size:255;not null" json:"-"`     // bcrypt hash of full key
-	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
-	ExpiresAt      *time.Time `json:"expires_at,omitempty"` // null = never expires
-	IsActive       bool       `gorm:"default:true" json:"is_active"`
+	OrganizationID uuid.UUID   `gorm:"type:uuid;index;not null" json:"organization_id"`
+	UserID         uuid.UUID   `gorm:"type:uuid;index;not null" json:"user_id"` // Creator
+	Name           string      `gorm:"size:255;not null" json:"name"`
+	KeyPrefix      string      `gorm:"size:8;index" json:"key_prefix"` // First 8 chars for identification
+	KeyHash        string      `gorm:"size:255;not null" json:"-"`     // bcrypt hash of full key
+	LastUsedAt     *time.Time  `json:"last_used_at,omitempty"`
+	ExpiresAt      *time.Time  `json:"expires_at,omitempty"` // null = never expires
+	IsActive       bool        `gorm:"default:true" json:"is_active"`
+	Scopes         StringArray `gorm:"type:jsonb;default:'[]'" json:"scopes"` // ["send", "read"], see APIKeyScope
+	RateLimit      int         `gorm:"default:0" json:"rate_limit"`           // Requests per minute
+	RotatedAt      *time.Time  `json:"rotated_at,omitempty"`
+	RevokedAt      *time.Time  `json:"revoked_at,omitempty"`
 
 	// Relations
 	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
@@ -199,11 +220,21 @@ func (APIKey) TableName() string {
 	return "api_keys"
 }
 
+// HasScope reports whether the key was issued with a scope. Admin keys have every scope.
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.Scopes {
+		if APIKeyScope(s) == APIKeyScopeAdmin || APIKeyScope(s) == scope {
+			return true
+		}
+	}
+	return false
+}
+
 // SSOProvider represents an SSO/OAuth provider configuration for an organization
 type SSOProvider struct {
 	BaseModel
 	OrganizationID  uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
-	Provider        string    `gorm:"size:50;not null" json:"provider"` // google, microsoft, github, facebook, custom
+	Provider        string    `gorm:"size:50;not null" json:"provider"` // google, microsoft, okta, github, facebook, custom
 	ClientID        string    `gorm:"size:500;not null" json:"client_id"`
 	ClientSecret    string    `gorm:"size:500;not null" json:"-"` // Never exposed in JSON
 	IsEnabled       bool   `gorm:"default:false" json:"is_enabled"`
@@ -216,6 +247,16 @@ type SSOProvider struct {
 	TokenURL    string `gorm:"size:500" json:"token_url,omitempty"`
 	UserInfoURL string `gorm:"size:500" json:"user_info_url,omitempty"`
 
+	// Issuer is the Okta authorization server URL, e.g. https://example.okta.com/oauth2/default
+	Issuer string `gorm:"size:500" json:"issuer,omitempty"`
+	// TenantID restricts Microsoft logins to one Entra ID tenant. Empty allows any tenant.
+	TenantID string `gorm:"size:100" json:"tenant_id,omitempty"`
+
+	// Just-in-time role mapping: the most privileged role the user's groups map to in
+	// RoleMapping, falling back to DefaultRoleName
+	GroupsClaim string `gorm:"size:100" json:"groups_claim,omitempty"` // Claim listing the user's groups, defaults to "groups"
+	RoleMapping JSONB  `gorm:"type:jsonb;default:'{}'" json:"role_mapping"` // Group name -> role name
+
 	// Relations
 	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
 }
@@ -243,6 +284,29 @@ func (Webhook) TableName() string {
 	return "webhooks"
 }
 
+// WebhookDelivery records the delivery of an event to a webhook, with the outcome of its last attempt
+type WebhookDelivery struct {
+	BaseModel
+	WebhookID      uuid.UUID             `gorm:"type:uuid;index;not null" json:"webhook_id"`
+	OrganizationID uuid.UUID             `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Event          string                `gorm:"size:50;not null" json:"event"`
+	Payload        JSONB                 `gorm:"type:jsonb;default:'{}'" json:"payload"`
+	Status         WebhookDeliveryStatus `gorm:"size:20;not null" json:"status"`
+	Attempts       int                   `gorm:"default:0" json:"attempts"`
+	ResponseStatus int                   `json:"response_status,omitempty"`
+	ResponseBody   string                `gorm:"type:text" json:"response_body,omitempty"`
+	ErrorMessage   string                `gorm:"type:text" json:"error_message,omitempty"`
+	DurationMs     int64                 `json:"duration_ms"`
+	DeliveredAt    *time.Time            `json:"delivered_at,omitempty"`
+
+	// Relations
+	Webhook *Webhook `gorm:"foreignKey:WebhookID" json:"webhook,omitempty"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
 // CustomAction represents a custom action button for chat integrations
 type CustomAction struct {
 	BaseModel
@@ -267,17 +331,43 @@ type WhatsAppAccount struct {
 	BaseModel
 	OrganizationID     uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
 	Name               string    `gorm:"size:100;uniqueIndex:idx_wa_org_name;not null" json:"name"` // Unique per org, used as reference
+	Channel            string    `gorm:"size:20;default:'whatsapp'" json:"channel"`                 // whatsapp, telegram, instagram, messenger or webchat
 	AppID              string    `gorm:"size:100" json:"app_id"`                                    // Meta App ID
+	AppSecret          string    `gorm:"type:text;serializer:encrypted" json:"-"`                   // Meta app secret webhooks are signed with, when the app isn't whatsapp.app_secret's
 	PhoneID            string    `gorm:"size:100;not null" json:"phone_id"`
 	BusinessID         string    `gorm:"size:100;not null" json:"business_id"`
-	AccessToken        string    `gorm:"type:text;not null" json:"-"` // encrypted
+	AccessToken        string    `gorm:"type:text;not null;serializer:encrypted" json:"-"` // Encrypted at rest when encryption.key is set
 	WebhookVerifyToken string    `gorm:"size:255" json:"webhook_verify_token"`
 	APIVersion         string    `gorm:"size:20;default:'v21.0'" json:"api_version"`
 	IsDefaultIncoming  bool      `gorm:"default:false" json:"is_default_incoming"`
 	IsDefaultOutgoing  bool      `gorm:"default:false" json:"is_default_outgoing"`
 	AutoReadReceipt    bool      `gorm:"default:false" json:"auto_read_receipt"`
+	TypingIndicator    bool      `gorm:"default:false" json:"typing_indicator"`
+	PresencePrivacy    bool      `gorm:"default:false" json:"presence_privacy"` // Hold read receipts until an agent replies
 	Status             string    `gorm:"size:20;default:'active'" json:"status"`
 
+	// Failover of template sends to a backup number while this one is unavailable
+	FailoverAccount   string     `gorm:"size:100" json:"failover_account"`                  // Backup WhatsAppAccount.Name
+	FailoverTemplates JSONB      `gorm:"type:jsonb;default:'{}'" json:"failover_templates"` // Template name -> backup template name
+	FailoverActiveAt  *time.Time `json:"failover_active_at,omitempty"`                      // Set while sends go through the backup
+	FailoverReason    string     `gorm:"type:text" json:"failover_reason"`                  // Error that started the failover
+
+	// Number health as last reported by Meta
+	QualityRating      string     `gorm:"size:20" json:"quality_rating"`       // GREEN, YELLOW, RED, UNKNOWN
+	MessagingLimitTier string     `gorm:"size:30" json:"messaging_limit_tier"` // TIER_250, TIER_1K, ...
+	HealthCheckedAt    *time.Time `json:"health_checked_at,omitempty"`
+
+	// Sends per second, within the number's Cloud API throughput. 0 uses the default of 80.
+	MessagesPerSecond int `gorm:"default:0" json:"messages_per_second"`
+
+	// The API the number sends through: cloud, or on_premise for an On-Premise API
+	// server run by the business or a BSP. Templates and the rest of the account are
+	// still managed through the Graph API with AccessToken.
+	APIType       string `gorm:"size:20;default:'cloud'" json:"api_type"`
+	APIURL        string `gorm:"size:500" json:"api_url"`                 // On-Premise API server
+	APIToken      string `gorm:"type:text;serializer:encrypted" json:"-"` // On-Premise API auth token, or a BSP's API key
+	APIAuthHeader string `gorm:"size:100" json:"api_auth_header"`         // Header APIToken is sent in, when not as a bearer token
+
 	// Relations
 	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
 }
@@ -286,19 +376,57 @@ func (WhatsAppAccount) TableName() string {
 	return "whatsapp_accounts"
 }
 
+// AccountChannel returns the channel the account is connected to
+func (a *WhatsAppAccount) AccountChannel() Channel {
+	if a.Channel == "" {
+		return ChannelWhatsApp
+	}
+	return Channel(a.Channel)
+}
+
+// IsTelegram reports whether the account is a Telegram bot rather than a WhatsApp number
+func (a *WhatsAppAccount) IsTelegram() bool {
+	return a.Channel == string(ChannelTelegram)
+}
+
+// IsInstagram reports whether the account is an Instagram professional account
+func (a *WhatsAppAccount) IsInstagram() bool {
+	return a.Channel == string(ChannelInstagram)
+}
+
+// IsMessenger reports whether the account is a Facebook Page answering Messenger
+func (a *WhatsAppAccount) IsMessenger() bool {
+	return a.Channel == string(ChannelMessenger)
+}
+
+// IsWebChat reports whether the account is a web chat widget embedded in websites
+func (a *WhatsAppAccount) IsWebChat() bool {
+	return a.Channel == string(ChannelWebChat)
+}
+
 // Contact represents a WhatsApp contact/profile
 type Contact struct {
 	BaseModel
-	OrganizationID     uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
-	PhoneNumber        string     `gorm:"size:20;not null" json:"phone_number"`
-	ProfileName        string     `gorm:"size:255" json:"profile_name"`
-	WhatsAppAccount    string     `gorm:"size:100;index" json:"whatsapp_account"` // References WhatsAppAccount.Name
-	AssignedUserID     *uuid.UUID `gorm:"type:uuid;index" json:"assigned_user_id,omitempty"`
-	LastMessageAt      *time.Time `json:"last_message_at,omitempty"`
-	LastMessagePreview string     `gorm:"type:text" json:"last_message_preview"`
-	IsRead             bool       `gorm:"default:true" json:"is_read"`
-	Tags               JSONBArray `gorm:"type:jsonb;default:'[]'" json:"tags"`
-	Metadata           JSONB      `gorm:"type:jsonb;default:'{}'" json:"metadata"`
+	OrganizationID     uuid.UUID          `gorm:"type:uuid;index;not null" json:"organization_id"`
+	PhoneNumber        string             `gorm:"size:20;not null" json:"phone_number"`
+	ProfileName        string             `gorm:"size:255" json:"profile_name"`
+	WhatsAppAccount    string             `gorm:"size:100;index" json:"whatsapp_account"` // References WhatsAppAccount.Name
+	AssignedUserID     *uuid.UUID         `gorm:"type:uuid;index" json:"assigned_user_id,omitempty"`
+	LastMessageAt      *time.Time         `json:"last_message_at,omitempty"`
+	LastMessagePreview string             `gorm:"type:text" json:"last_message_preview"`
+	LastInboundAt      *time.Time         `json:"last_inbound_at,omitempty"`        // Opens the 24-hour customer service window
+	Timezone           string             `gorm:"size:50" json:"timezone"`          // IANA name, inferred from the calling code unless overridden
+	Language           string             `gorm:"size:10" json:"language"`          // ISO 639-1 code, detected from the customer's messages
+	AIDisabled         bool               `gorm:"default:false" json:"ai_disabled"` // Silences AI responses in this conversation, whatever the chatbot's AI setting
+	BlockedAt          *time.Time         `gorm:"index" json:"blocked_at,omitempty"`          // Messages from blocked contacts are dropped
+	BlockedUntil       *time.Time         `json:"blocked_until,omitempty"`                    // Empty blocks until the contact is unblocked
+	BlockReason        string             `gorm:"size:255" json:"block_reason,omitempty"`
+	BotPausedUntil     *time.Time         `json:"bot_paused_until,omitempty"` // The chatbot doesn't answer until then
+	IsRead             bool               `gorm:"default:true" json:"is_read"`
+	Tags               JSONBArray         `gorm:"type:jsonb;default:'[]'" json:"tags"`
+	Metadata           JSONB              `gorm:"type:jsonb;default:'{}'" json:"metadata"` // Custom attributes, shown as custom_fields
+	OptInStatus        ContactOptInStatus `gorm:"size:20;default:'unknown'" json:"opt_in_status"`
+	OptInUpdatedAt     *time.Time         `json:"opt_in_updated_at,omitempty"`
 
 	// Chatbot SLA tracking
 	ChatbotLastMessageAt *time.Time `json:"chatbot_last_message_at,omitempty"` // When chatbot last sent a message
@@ -314,6 +442,16 @@ func (Contact) TableName() string {
 	return "contacts"
 }
 
+// IsBlocked reports whether messages from the contact are dropped at now
+func (c *Contact) IsBlocked(now time.Time) bool {
+	return c.BlockedAt != nil && (c.BlockedUntil == nil || c.BlockedUntil.After(now))
+}
+
+// IsBotPaused reports whether the chatbot leaves the contact's messages unanswered at now
+func (c *Contact) IsBotPaused(now time.Time) bool {
+	return c.BotPausedUntil != nil && c.BotPausedUntil.After(now)
+}
+
 // Message represents a WhatsApp message
 type Message struct {
 	BaseModel
@@ -328,15 +466,24 @@ type Message struct {
 	MediaURL          string     `gorm:"type:text" json:"media_url"`
 	MediaMimeType     string     `gorm:"size:100" json:"media_mime_type"`
 	MediaFilename     string     `gorm:"size:255" json:"media_filename"`
+	Latitude          *float64   `json:"latitude,omitempty"` // Location messages
+	Longitude         *float64   `json:"longitude,omitempty"`
 	TemplateName      string     `gorm:"size:255" json:"template_name"`
 	TemplateParams    JSONB      `gorm:"type:jsonb" json:"template_params"`
 	InteractiveData   JSONB      `gorm:"type:jsonb" json:"interactive_data"`
 	FlowResponse      JSONB      `gorm:"type:jsonb" json:"flow_response"`
 	Status            MessageStatus `gorm:"size:20;default:'pending'" json:"status"`
 	ErrorMessage      string     `gorm:"type:text" json:"error_message"`
+	ErrorCode         int        `gorm:"default:0" json:"error_code,omitempty"` // Meta error code of a failed message
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty"`                // From Meta's status webhooks
+	ReadAt            *time.Time `json:"read_at,omitempty"`
 	IsReply           bool       `gorm:"default:false" json:"is_reply"`
 	ReplyToMessageID  *uuid.UUID `gorm:"type:uuid" json:"reply_to_message_id,omitempty"`
 	SentByUserID      *uuid.UUID `gorm:"type:uuid;index" json:"sent_by_user_id,omitempty"` // User who sent outgoing message
+	PricingCategory   string     `gorm:"size:50" json:"pricing_category,omitempty"`                // Reported by Meta: marketing, utility, authentication, service
+	Channel           Channel    `gorm:"size:20" json:"channel,omitempty"`                         // Set when sent on another channel than the account's, e.g. SMS fallback
+	EditedAt          *time.Time `json:"edited_at,omitempty"`  // Set when the contact edits the message
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"` // Set when the contact deletes the message for everyone
 	Metadata          JSONB      `gorm:"type:jsonb;default:'{}'" json:"metadata"`
 
 	// Relations
@@ -368,6 +515,11 @@ type Template struct {
 	Buttons         JSONBArray  `gorm:"type:jsonb;default:'[]'" json:"buttons"`
 	SampleValues    JSONBArray  `gorm:"type:jsonb;default:'[]'" json:"sample_values"`
 
+	// Quality and pacing signals reported by Meta webhooks
+	QualityScore     string     `gorm:"size:20" json:"quality_score"`   // GREEN, YELLOW, RED, UNKNOWN
+	QualityUpdatedAt *time.Time `json:"quality_updated_at,omitempty"`
+	StatusReason     string     `gorm:"type:text" json:"status_reason"` // Reason or pause details from the last status update
+
 	// Relations
 	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
 }
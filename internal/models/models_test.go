@@ -318,3 +318,27 @@ func TestJSONBArray_Scan(t *testing.T) {
 		})
 	}
 }
+
+func TestTimezoneForPhoneNumber(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		phone string
+		want  string
+	}{
+		{name: "India", phone: "919876543210", want: "Asia/Kolkata"},
+		{name: "North America with plus", phone: "+14155550100", want: "America/New_York"},
+		{name: "three digit calling code", phone: "971501234567", want: "Asia/Dubai"},
+		{name: "two digit code not shadowed", phone: "447700900123", want: "Europe/London"},
+		{name: "unknown calling code", phone: "8881234567", want: ""},
+		{name: "empty", phone: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, models.TimezoneForPhoneNumber(tt.phone))
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// NumberHealthEvent is a change of a number's quality rating or messaging limit tier
+type NumberHealthEvent struct {
+	BaseModel
+	OrganizationID  uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
+	WhatsAppAccount string    `gorm:"size:100;index" json:"whatsapp_account"` // References WhatsAppAccount.Name
+	Kind            string    `gorm:"size:20;not null" json:"kind"`           // quality, limit_tier
+	OldValue        string    `gorm:"size:30" json:"old_value"`
+	NewValue        string    `gorm:"size:30" json:"new_value"`
+}
+
+func (NumberHealthEvent) TableName() string {
+	return "number_health_events"
+}
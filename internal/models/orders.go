@@ -0,0 +1,29 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// Order is a cart a contact sent from a catalog in WhatsApp
+type Order struct {
+	BaseModel
+	OrganizationID    uuid.UUID   `gorm:"type:uuid;index;not null" json:"organization_id"`
+	WhatsAppAccount   string      `gorm:"size:100;index" json:"whatsapp_account"` // References WhatsAppAccount.Name
+	ContactID         uuid.UUID   `gorm:"type:uuid;index;not null" json:"contact_id"`
+	MessageID         *uuid.UUID  `gorm:"type:uuid" json:"message_id,omitempty"`           // The order message
+	WhatsAppMessageID string      `gorm:"size:255;uniqueIndex" json:"whatsapp_message_id"` // Meta message ID of the order message
+	MetaCatalogID     string      `gorm:"size:100" json:"meta_catalog_id"`                 // Catalog the products were ordered from
+	Note              string      `gorm:"type:text" json:"note"`                           // Text the contact sent with the cart
+	Items             JSONBArray  `gorm:"type:jsonb;default:'[]'" json:"items"`            // [{product_retailer_id, name, quantity, item_price, currency}]
+	Total             int64       `json:"total"`                                           // In the smallest currency unit, like catalog prices
+	Currency          string      `gorm:"size:3" json:"currency"`
+	Status            OrderStatus `gorm:"size:20;index;not null" json:"status"`
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Contact      *Contact      `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+}
+
+func (Order) TableName() string {
+	return "orders"
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PaymentLink is a link a chatbot flow or the AI sent a contact to pay an amount
+// through the organization's payment provider. The provider's webhook marks it
+// paid, which updates the chatbot session and sends the paid message.
+type PaymentLink struct {
+	BaseModel
+	OrganizationID  uuid.UUID         `gorm:"type:uuid;index;not null" json:"organization_id"`
+	ContactID       uuid.UUID         `gorm:"type:uuid;index;not null" json:"contact_id"`
+	SessionID       *uuid.UUID        `gorm:"type:uuid;index" json:"session_id,omitempty"` // Chatbot session that created the link
+	WhatsAppAccount string            `gorm:"size:100" json:"whatsapp_account"`            // References WhatsAppAccount.Name
+	Source          PaymentLinkSource `gorm:"size:20;not null" json:"source"`
+	Provider        string            `gorm:"size:20;not null" json:"provider"`  // stripe or razorpay
+	ExternalID      string            `gorm:"size:100;index" json:"external_id"` // ID of the link at the provider
+	URL             string            `gorm:"size:1000" json:"url"`
+	Amount          int64             `json:"amount"` // In the smallest currency unit
+	Currency        string            `gorm:"size:3" json:"currency"`
+	Description     string            `gorm:"size:255" json:"description"`
+	Status          PaymentLinkStatus `gorm:"size:20;index;not null" json:"status"`
+	PaidMessage     string            `gorm:"type:text" json:"paid_message,omitempty"` // Sent once paid, with the session's variables
+	PaymentID       string            `gorm:"size:100" json:"payment_id,omitempty"`    // ID of the payment at the provider
+	PaidAt          *time.Time        `json:"paid_at,omitempty"`
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Contact      *Contact      `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+}
+
+func (PaymentLink) TableName() string {
+	return "payment_links"
+}
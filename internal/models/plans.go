@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Plan is a subscription tier. It enables features and sets the usage limits of
+// the organizations assigned to it.
+type Plan struct {
+	BaseModel
+	Name        string     `gorm:"size:50;not null" json:"name"`
+	DisplayName string     `gorm:"size:100" json:"display_name"`
+	Description string     `gorm:"type:text" json:"description"`
+	Features    JSONBArray `gorm:"type:jsonb;default:'[]'" json:"features"` // ["campaigns", "sso"]
+	Limits      PlanLimits `gorm:"embedded;embeddedPrefix:limit_" json:"limits"`
+	IsDefault   bool       `gorm:"default:false" json:"is_default"` // Used by organizations without a plan
+
+	// Overage handling. Campaigns never go over the message limit; with AllowOverage,
+	// support and transactional messages and AI calls continue past their limits.
+	AllowOverage            bool `gorm:"default:false" json:"allow_overage"`
+	CampaignThrottlePercent int  `gorm:"default:0" json:"campaign_throttle_percent"` // Pause campaigns at this percentage of the message limit, 0 = at the limit
+
+	// Pricing used for statements, in the smallest unit of Currency (e.g. cents)
+	Price               int64  `gorm:"default:0" json:"price"` // Per month
+	Currency            string `gorm:"size:3;default:'USD'" json:"currency"`
+	MessageOveragePrice int64  `gorm:"default:0" json:"message_overage_price"` // Per message over the limit, with AllowOverage
+	AICallOveragePrice  int64  `gorm:"default:0" json:"ai_call_overage_price"` // Per AI call over the limit, with AllowOverage
+
+	// Debited from prepaid wallets, in the smallest unit of the wallet's currency
+	WalletRates WalletRates `gorm:"embedded;embeddedPrefix:rate_" json:"wallet_rates"`
+}
+
+func (Plan) TableName() string {
+	return "plans"
+}
+
+// PlanLimits are the quotas of a plan. Message, campaign recipient and AI call
+// limits are per calendar month. A zero limit means unlimited.
+type PlanLimits struct {
+	Messages           int64 `gorm:"default:0" json:"messages"`
+	CampaignRecipients int64 `gorm:"default:0" json:"campaign_recipients"`
+	AICalls            int64 `gorm:"default:0" json:"ai_calls"`
+	StorageMB          int64 `gorm:"default:0" json:"storage_mb"`
+	Agents             int64 `gorm:"default:0" json:"agents"`
+}
+
+// WalletRates are the prices debited from an organization's prepaid wallet. Conversation
+// rates are per conversation Meta bills for, by pricing category (per message for
+// accounts on per-message pricing).
+type WalletRates struct {
+	Marketing      int64 `gorm:"default:0" json:"marketing"`
+	Utility        int64 `gorm:"default:0" json:"utility"`
+	Authentication int64 `gorm:"default:0" json:"authentication"`
+	Service        int64 `gorm:"default:0" json:"service"`
+	AICall         int64 `gorm:"default:0" json:"ai_call"`
+}
+
+// PlanChange records the plan an organization is on from StartedAt. Statements are
+// priced by the plan in effect at the end of each month, and the first change marks
+// when billing started.
+type PlanChange struct {
+	BaseModel
+	OrganizationID uuid.UUID  `gorm:"type:uuid;index:idx_plan_changes_org_started;not null" json:"organization_id"`
+	PlanID         *uuid.UUID `gorm:"type:uuid" json:"plan_id,omitempty"` // Nil when there was no plan
+	StartedAt      time.Time  `gorm:"index:idx_plan_changes_org_started;not null" json:"started_at"`
+}
+
+func (PlanChange) TableName() string {
+	return "plan_changes"
+}
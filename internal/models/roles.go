@@ -69,6 +69,9 @@ const (
 	ResourceAPIKeys         = "api_keys"
 	ResourceCannedResponses = "canned_responses"
 	ResourceCustomActions   = "custom_actions"
+	ResourceAuditLogs       = "audit_logs"
+	ResourceDeadLetters     = "dead_letters"
+	ResourceDataSubjects    = "data_subjects"
 )
 
 // PermissionAction constants for available actions
@@ -185,6 +188,18 @@ func DefaultPermissions() []Permission {
 		{Resource: ResourceCustomActions, Action: ActionRead, Description: "View custom actions"},
 		{Resource: ResourceCustomActions, Action: ActionWrite, Description: "Create and edit custom actions"},
 		{Resource: ResourceCustomActions, Action: ActionDelete, Description: "Delete custom actions"},
+
+		// Audit Log
+		{Resource: ResourceAuditLogs, Action: ActionRead, Description: "View the audit log"},
+
+		// Dead Letters
+		{Resource: ResourceDeadLetters, Action: ActionRead, Description: "View failed sends and jobs"},
+		{Resource: ResourceDeadLetters, Action: ActionWrite, Description: "Retry failed sends and jobs"},
+		{Resource: ResourceDeadLetters, Action: ActionDelete, Description: "Discard failed sends and jobs"},
+
+		// Data Subjects
+		{Resource: ResourceDataSubjects, Action: ActionRead, Description: "Export all data stored about a contact"},
+		{Resource: ResourceDataSubjects, Action: ActionDelete, Description: "Erase all data stored about a contact"},
 	}
 }
 
@@ -199,9 +214,9 @@ func SystemRolePermissions() map[string][]string {
 	managerPermissions := []string{
 		// Teams (read only)
 		"teams:read",
-		// Settings
+		// Settings (chatbot settings are admin only)
 		"settings.general:read", "settings.general:write",
-		"settings.chatbot:read", "settings.chatbot:write",
+		"settings.chatbot:read",
 		// Accounts
 		"accounts:read", "accounts:write", "accounts:delete",
 		// Templates
@@ -231,10 +246,8 @@ func SystemRolePermissions() map[string][]string {
 	}
 
 	agentPermissions := []string{
-		// Chat
+		// Chat (agents without contacts:read only see conversations assigned to them)
 		"chat:read", "chat:write",
-		// Contacts (read only)
-		"contacts:read",
 		// Analytics (own)
 		"analytics.agents:read",
 		// Transfers
@@ -243,9 +256,25 @@ func SystemRolePermissions() map[string][]string {
 		"canned_responses:read",
 	}
 
+	viewerPermissions := []string{
+		"teams:read",
+		"settings.general:read", "settings.chatbot:read",
+		"accounts:read",
+		"templates:read",
+		"flows.whatsapp:read", "flows.chatbot:read",
+		"campaigns:read",
+		"chatbot.keywords:read", "chatbot.ai:read",
+		"chat:read",
+		"contacts:read",
+		"analytics:read", "analytics.agents:read",
+		"transfers:read",
+		"canned_responses:read",
+	}
+
 	return map[string][]string{
 		"admin":   allPermissions,
 		"manager": managerPermissions,
 		"agent":   agentPermissions,
+		"viewer":  viewerPermissions,
 	}
 }
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScheduledMessage is a text or template message written now and delivered later.
+// If the 24-hour customer service window has closed by SendAt, the fallback
+// template is sent instead of the free-form text.
+type ScheduledMessage struct {
+	BaseModel
+	OrganizationID         uuid.UUID              `gorm:"type:uuid;index;not null" json:"organization_id"`
+	ContactID              uuid.UUID              `gorm:"type:uuid;index;not null" json:"contact_id"`
+	WhatsAppAccount        string                 `gorm:"size:100" json:"whatsapp_account"`           // References WhatsAppAccount.Name
+	MessageType            MessageType            `gorm:"size:20;default:'text'" json:"message_type"` // text or template
+	Content                string                 `gorm:"type:text;not null" json:"content"`          // Empty for template messages
+	TemplateID             *uuid.UUID             `gorm:"type:uuid" json:"template_id,omitempty"`
+	TemplateParams         JSONB                  `gorm:"type:jsonb;default:'{}'" json:"template_params"`
+	SendAt                 time.Time              `gorm:"index;not null" json:"send_at"`
+	Timezone               string                 `gorm:"size:64" json:"timezone,omitempty"` // IANA timezone the send time was given in
+	Status                 ScheduledMessageStatus `gorm:"size:20;index;not null" json:"status"`
+	FallbackTemplateID     *uuid.UUID             `gorm:"type:uuid" json:"fallback_template_id,omitempty"`
+	FallbackTemplateParams JSONB                  `gorm:"type:jsonb;default:'{}'" json:"fallback_template_params"`
+	SentAsTemplate         bool                   `json:"sent_as_template"`
+	MessageID              *uuid.UUID             `gorm:"type:uuid" json:"message_id,omitempty"` // Message created when sent
+	SentAt                 *time.Time             `json:"sent_at,omitempty"`
+	ErrorMessage           string                 `gorm:"type:text" json:"error_message,omitempty"`
+	CreatedByID            uuid.UUID              `gorm:"type:uuid" json:"created_by_id"`
+
+	// Relations
+	Organization     *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Contact          *Contact      `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+	Template         *Template     `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
+	FallbackTemplate *Template     `gorm:"foreignKey:FallbackTemplateID" json:"fallback_template,omitempty"`
+	CreatedBy        *User         `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
+}
+
+func (ScheduledMessage) TableName() string {
+	return "scheduled_messages"
+}
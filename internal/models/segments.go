@@ -0,0 +1,24 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// Segment is a saved set of contact filters, evaluated when it is used, so its
+// contacts change as their tags, attributes and activity do. A contact is in the
+// segment when it matches all of the conditions.
+type Segment struct {
+	BaseModel
+	OrganizationID uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Name           string     `gorm:"size:255;not null" json:"name"`
+	Description    string     `gorm:"type:text" json:"description"`
+	Conditions     JSONBArray `gorm:"type:jsonb;default:'[]'" json:"conditions"` // [{"field": "tags", "operator": "contains", "value": "vip"}]
+	CreatedByID    *uuid.UUID `gorm:"type:uuid" json:"created_by_id,omitempty"`
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+}
+
+func (Segment) TableName() string {
+	return "segments"
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sequence is a drip sequence: an ordered set of messages sent to each enrolled
+// contact, each after a delay from the one before. Contacts leave the sequence
+// when they reply, opt out or lose its tag.
+type Sequence struct {
+	BaseModel
+	OrganizationID  uuid.UUID   `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Name            string      `gorm:"size:255;not null" json:"name"`
+	Description     string      `gorm:"type:text" json:"description"`
+	WhatsAppAccount string      `gorm:"size:100" json:"whatsapp_account"` // References WhatsAppAccount.Name, the contact's account when empty
+	IsActive        bool        `gorm:"default:true" json:"is_active"`    // Inactive sequences keep their enrollments but send nothing
+	ExitOnReply     bool        `gorm:"default:true" json:"exit_on_reply"`
+	ExitKeywords    StringArray `gorm:"type:jsonb;default:'[]'" json:"exit_keywords"` // Replies that opt the contact out, e.g. STOP
+	ExitTag         string      `gorm:"size:100" json:"exit_tag"`                     // Contacts need the tag to enroll and leave when it's removed
+	CreatedBy       *uuid.UUID  `gorm:"type:uuid" json:"created_by,omitempty"`
+
+	// Relations
+	Organization *Organization  `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Steps        []SequenceStep `gorm:"foreignKey:SequenceID" json:"steps,omitempty"`
+}
+
+func (Sequence) TableName() string {
+	return "sequences"
+}
+
+// SequenceStep is a message of a sequence, sent DelayMinutes after the previous
+// step, or after enrollment for the first one
+type SequenceStep struct {
+	BaseModel
+	SequenceID     uuid.UUID   `gorm:"type:uuid;index;not null" json:"sequence_id"`
+	StepOrder      int         `gorm:"not null" json:"step_order"`
+	DelayMinutes   int         `gorm:"not null" json:"delay_minutes"`
+	MessageType    MessageType `gorm:"size:20;not null" json:"message_type"` // text or template
+	Message        string      `gorm:"type:text" json:"message"`             // Text steps, may use {{name}} and {{phone}}
+	TemplateID     *uuid.UUID  `gorm:"type:uuid" json:"template_id,omitempty"`
+	TemplateParams JSONB       `gorm:"type:jsonb;default:'{}'" json:"template_params"`
+
+	// Relations
+	Template *Template `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
+}
+
+func (SequenceStep) TableName() string {
+	return "sequence_steps"
+}
+
+// SequenceEnrollment is a contact going through a sequence. NextStep is the index
+// of the step sent at NextRunAt.
+type SequenceEnrollment struct {
+	BaseModel
+	OrganizationID uuid.UUID                `gorm:"type:uuid;index;not null" json:"organization_id"`
+	SequenceID     uuid.UUID                `gorm:"type:uuid;index;not null" json:"sequence_id"`
+	ContactID      uuid.UUID                `gorm:"type:uuid;index;not null" json:"contact_id"`
+	Status         SequenceEnrollmentStatus `gorm:"size:20;index;not null" json:"status"`
+	NextStep       int                      `gorm:"default:0" json:"next_step"`
+	NextRunAt      *time.Time               `gorm:"index" json:"next_run_at,omitempty"` // Nil while a step is being sent and once finished
+	LastSentAt     *time.Time               `json:"last_sent_at,omitempty"`
+	FinishedAt     *time.Time               `json:"finished_at,omitempty"`
+	ExitReason     SequenceExitReason       `gorm:"size:20" json:"exit_reason,omitempty"`
+	ErrorMessage   string                   `gorm:"type:text" json:"error_message,omitempty"` // Last send error or skipped step
+	EnrolledByID   *uuid.UUID               `gorm:"type:uuid" json:"enrolled_by_id,omitempty"`
+	Variables      JSONB                    `gorm:"type:jsonb;default:'{}'" json:"variables,omitempty"` // Values from what enrolled the contact, e.g. a Shopify order, for step messages
+
+	// Relations
+	Sequence *Sequence `gorm:"foreignKey:SequenceID" json:"sequence,omitempty"`
+	Contact  *Contact  `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+}
+
+func (SequenceEnrollment) TableName() string {
+	return "sequence_enrollments"
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SessionNote is a private note agents leave on a chatbot session for each other.
+// It's never sent to the customer.
+type SessionNote struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
+	SessionID      uuid.UUID `gorm:"type:uuid;index;not null" json:"session_id"`
+	ContactID      uuid.UUID `gorm:"type:uuid;index;not null" json:"contact_id"`
+	Content        string    `gorm:"type:text;not null" json:"content"`
+	CreatedByID    uuid.UUID `gorm:"type:uuid;not null" json:"created_by_id"`
+
+	// Relations
+	Organization *Organization        `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Session      *ChatbotSession      `gorm:"foreignKey:SessionID" json:"session,omitempty"`
+	CreatedBy    *User                `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
+	Mentions     []SessionNoteMention `gorm:"foreignKey:NoteID" json:"mentions,omitempty"`
+}
+
+func (SessionNote) TableName() string {
+	return "session_notes"
+}
+
+// SessionNoteMention notifies a teammate mentioned with @ in a session note
+type SessionNoteMention struct {
+	BaseModel
+	OrganizationID uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
+	NoteID         uuid.UUID  `gorm:"type:uuid;index;not null" json:"note_id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+
+	// Relations
+	Note *SessionNote `gorm:"foreignKey:NoteID" json:"note,omitempty"`
+	User *User        `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+func (SessionNoteMention) TableName() string {
+	return "session_note_mentions"
+}
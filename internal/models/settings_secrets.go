@@ -0,0 +1,83 @@
+package models
+
+import "fmt"
+
+// OrgSettingSecret is a credential kept in a section of organization settings
+type OrgSettingSecret struct {
+	Section string // Key of the section in the settings, e.g. payments
+	Key     string // Key of the credential in the section, e.g. secret_key
+}
+
+// OrgSettingsSecrets are the credentials kept in organization settings. They're
+// encrypted at rest, see EncryptSettingSecrets, and left out of settings bundles, so
+// a bundle can be shared without them.
+var OrgSettingsSecrets = []OrgSettingSecret{
+	{Section: "payments", Key: "secret_key"},
+	{Section: "payments", Key: "webhook_secret"},
+	{Section: "sms_fallback", Key: "auth_token"},
+	{Section: "crm", Key: "access_token"},
+	{Section: "crm", Key: "client_secret"},
+	{Section: "google_calendar", Key: "service_account_key"},
+	{Section: "helpdesk", Key: "api_key"},
+	{Section: "shopify", Key: "access_token"},
+	{Section: "translation", Key: "api_key"},
+	{Section: "notifications", Key: "slack_webhook_url"},
+}
+
+// AIProviderSecretKey is the key of the API key of each AI fallback provider and
+// experiment in chatbot settings. The keys are encrypted at rest, see
+// EncryptAIProviderKeys.
+const AIProviderSecretKey = "api_key"
+
+// EncryptAIProviderKeys encrypts the API keys of AI fallback providers or
+// experiments before they're saved. Keys already encrypted are kept.
+func EncryptAIProviderKeys(items []interface{}) error {
+	for i, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		value, _ := m[AIProviderSecretKey].(string)
+		if value == "" || IsEncryptedSecret(value) {
+			continue
+		}
+		encrypted, err := EncryptSecret(value)
+		if err != nil {
+			return fmt.Errorf("item %d: %w", i, err)
+		}
+		m[AIProviderSecretKey] = encrypted
+	}
+	return nil
+}
+
+// EncryptSettingSecrets encrypts the credentials of a section of organization
+// settings before it's saved. Values already encrypted are kept.
+func EncryptSettingSecrets(name string, section map[string]interface{}) error {
+	for _, secret := range OrgSettingsSecrets {
+		if secret.Section != name {
+			continue
+		}
+		value, _ := section[secret.Key].(string)
+		if value == "" || IsEncryptedSecret(value) {
+			continue
+		}
+		encrypted, err := EncryptSecret(value)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", name, secret.Key, err)
+		}
+		section[secret.Key] = encrypted
+	}
+	return nil
+}
+
+// SettingSecret returns a credential of a section of organization settings,
+// decrypted. A credential that can't be decrypted, e.g. because its master key is
+// no longer configured, reads as unset.
+func SettingSecret(section map[string]interface{}, key string) string {
+	value, _ := section[key].(string)
+	plaintext, err := DecryptSecret(value)
+	if err != nil {
+		return ""
+	}
+	return plaintext
+}
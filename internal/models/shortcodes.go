@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// Shortcode represents an org-defined inline text fragment (e.g. /hours) that is
+// expanded server-side inside agent replies and flow messages
+type Shortcode struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Code           string    `gorm:"size:50;not null" json:"code"` // without the leading slash
+	Content        string    `gorm:"type:text;not null" json:"content"`
+	Description    string    `gorm:"size:255" json:"description"`
+	IsActive       bool      `json:"is_active"`
+	CreatedByID    uuid.UUID `gorm:"type:uuid" json:"created_by_id"`
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	CreatedBy    *User         `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
+}
+
+func (Shortcode) TableName() string {
+	return "shortcodes"
+}
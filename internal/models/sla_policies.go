@@ -0,0 +1,27 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// SLAPolicy sets first-response and resolution targets for the agent transfers
+// it matches by priority and contact tags
+type SLAPolicy struct {
+	BaseModel
+	OrganizationID       uuid.UUID        `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Name                 string           `gorm:"size:255;not null" json:"name"`
+	Priority             TransferPriority `gorm:"size:20" json:"priority"`             // Empty matches any priority
+	Tags                 StringArray      `gorm:"type:jsonb;default:'[]'" json:"tags"` // Matches contacts with any of these tags; empty matches all
+	FirstResponseMinutes int              `gorm:"not null" json:"first_response_minutes"`
+	ResolutionMinutes    int              `gorm:"default:0" json:"resolution_minutes"` // 0 has no resolution target
+	AtRiskPercent        int              `gorm:"default:80" json:"at_risk_percent"`   // Share of a target's time after which it's at risk
+	Position             int              `gorm:"default:0;index" json:"position"`     // Policies are matched in ascending order
+	IsActive             bool             `gorm:"default:true" json:"is_active"`
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+}
+
+func (SLAPolicy) TableName() string {
+	return "sla_policies"
+}
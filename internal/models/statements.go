@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statement is an organization's usage and charges for a calendar month
+type Statement struct {
+	BaseModel
+	OrganizationID uuid.UUID           `gorm:"type:uuid;not null;uniqueIndex:idx_statements_org_period" json:"organization_id"`
+	Period         string              `gorm:"size:7;not null;uniqueIndex:idx_statements_org_period" json:"period"` // YYYY-MM
+	PlanName       string              `gorm:"size:50" json:"plan"`
+	Currency       string              `gorm:"size:3" json:"currency"`
+	Categories     []StatementCategory `gorm:"type:jsonb;serializer:json" json:"categories"`
+	Usage          []StatementUsage    `gorm:"type:jsonb;serializer:json" json:"usage"`
+	LineItems      []StatementLineItem `gorm:"type:jsonb;serializer:json" json:"line_items"`
+	Total          int64               `gorm:"default:0" json:"total"` // In the smallest unit of Currency
+
+	// Billing provider sync
+	ExternalID string     `gorm:"size:255" json:"external_id,omitempty"`
+	PushedAt   *time.Time `json:"pushed_at,omitempty"`
+	PushError  string     `gorm:"type:text" json:"push_error,omitempty"`
+
+	Preview bool `gorm:"-" json:"preview,omitempty"` // Computed for the current month, not stored
+}
+
+func (Statement) TableName() string {
+	return "statements"
+}
+
+// StatementCategory counts outgoing messages of a pricing category
+type StatementCategory struct {
+	Category      string `json:"category"`
+	Messages      int64  `json:"messages"`
+	Conversations int64  `json:"conversations"`
+}
+
+// StatementUsage is the usage of a monthly metric against the plan limit
+type StatementUsage struct {
+	Metric UsageMetric `json:"metric"`
+	Used   int64       `json:"used"`
+	Limit  int64       `json:"limit"` // 0 = unlimited
+}
+
+// StatementLineItem is a charge on a statement
+type StatementLineItem struct {
+	Description string `json:"description"`
+	Quantity    int64  `json:"quantity"`
+	UnitPrice   int64  `json:"unit_price"`
+	Amount      int64  `json:"amount"`
+}
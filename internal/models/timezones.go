@@ -0,0 +1,140 @@
+package models
+
+import "strings"
+
+// callingCodeTimezones maps international calling codes to the default IANA
+// timezone of the country. Countries spanning several zones use the zone of
+// their capital or largest population centre.
+var callingCodeTimezones = map[string]string{
+	// North America (NANP)
+	"1": "America/New_York",
+
+	// Russia, Kazakhstan
+	"7": "Europe/Moscow",
+
+	// Africa
+	"20":  "Africa/Cairo",
+	"27":  "Africa/Johannesburg",
+	"212": "Africa/Casablanca",
+	"213": "Africa/Algiers",
+	"216": "Africa/Tunis",
+	"218": "Africa/Tripoli",
+	"221": "Africa/Dakar",
+	"225": "Africa/Abidjan",
+	"233": "Africa/Accra",
+	"234": "Africa/Lagos",
+	"237": "Africa/Douala",
+	"243": "Africa/Kinshasa",
+	"244": "Africa/Luanda",
+	"249": "Africa/Khartoum",
+	"251": "Africa/Addis_Ababa",
+	"254": "Africa/Nairobi",
+	"255": "Africa/Dar_es_Salaam",
+	"256": "Africa/Kampala",
+	"260": "Africa/Lusaka",
+	"263": "Africa/Harare",
+
+	// Europe
+	"30":  "Europe/Athens",
+	"31":  "Europe/Amsterdam",
+	"32":  "Europe/Brussels",
+	"33":  "Europe/Paris",
+	"34":  "Europe/Madrid",
+	"36":  "Europe/Budapest",
+	"39":  "Europe/Rome",
+	"40":  "Europe/Bucharest",
+	"41":  "Europe/Zurich",
+	"43":  "Europe/Vienna",
+	"44":  "Europe/London",
+	"45":  "Europe/Copenhagen",
+	"46":  "Europe/Stockholm",
+	"47":  "Europe/Oslo",
+	"48":  "Europe/Warsaw",
+	"49":  "Europe/Berlin",
+	"351": "Europe/Lisbon",
+	"353": "Europe/Dublin",
+	"358": "Europe/Helsinki",
+	"359": "Europe/Sofia",
+	"380": "Europe/Kyiv",
+	"381": "Europe/Belgrade",
+	"385": "Europe/Zagreb",
+	"420": "Europe/Prague",
+	"421": "Europe/Bratislava",
+
+	// Latin America
+	"51":  "America/Lima",
+	"52":  "America/Mexico_City",
+	"53":  "America/Havana",
+	"54":  "America/Argentina/Buenos_Aires",
+	"55":  "America/Sao_Paulo",
+	"56":  "America/Santiago",
+	"57":  "America/Bogota",
+	"58":  "America/Caracas",
+	"502": "America/Guatemala",
+	"503": "America/El_Salvador",
+	"504": "America/Tegucigalpa",
+	"505": "America/Managua",
+	"506": "America/Costa_Rica",
+	"507": "America/Panama",
+	"591": "America/La_Paz",
+	"593": "America/Guayaquil",
+	"595": "America/Asuncion",
+	"598": "America/Montevideo",
+
+	// Asia and Oceania
+	"60":  "Asia/Kuala_Lumpur",
+	"61":  "Australia/Sydney",
+	"62":  "Asia/Jakarta",
+	"63":  "Asia/Manila",
+	"64":  "Pacific/Auckland",
+	"65":  "Asia/Singapore",
+	"66":  "Asia/Bangkok",
+	"81":  "Asia/Tokyo",
+	"82":  "Asia/Seoul",
+	"84":  "Asia/Ho_Chi_Minh",
+	"86":  "Asia/Shanghai",
+	"90":  "Europe/Istanbul",
+	"91":  "Asia/Kolkata",
+	"92":  "Asia/Karachi",
+	"93":  "Asia/Kabul",
+	"94":  "Asia/Colombo",
+	"95":  "Asia/Yangon",
+	"98":  "Asia/Tehran",
+	"852": "Asia/Hong_Kong",
+	"855": "Asia/Phnom_Penh",
+	"880": "Asia/Dhaka",
+	"886": "Asia/Taipei",
+	"960": "Indian/Maldives",
+	"961": "Asia/Beirut",
+	"962": "Asia/Amman",
+	"963": "Asia/Damascus",
+	"964": "Asia/Baghdad",
+	"965": "Asia/Kuwait",
+	"966": "Asia/Riyadh",
+	"967": "Asia/Aden",
+	"968": "Asia/Muscat",
+	"970": "Asia/Gaza",
+	"971": "Asia/Dubai",
+	"972": "Asia/Jerusalem",
+	"973": "Asia/Bahrain",
+	"974": "Asia/Qatar",
+	"977": "Asia/Kathmandu",
+	"992": "Asia/Dushanbe",
+	"994": "Asia/Baku",
+	"995": "Asia/Tbilisi",
+	"998": "Asia/Tashkent",
+}
+
+// TimezoneForPhoneNumber infers a default IANA timezone from the country calling
+// code of an international phone number. Returns an empty string if the calling
+// code is unknown.
+func TimezoneForPhoneNumber(phone string) string {
+	digits := strings.TrimLeft(strings.TrimSpace(phone), "+")
+	// Calling codes are at most 3 digits and prefix-free, so the first match is the only one
+	for n := 1; n <= 3 && n <= len(digits); n++ {
+		if tz, ok := callingCodeTimezones[digits[:n]]; ok {
+			return tz
+		}
+	}
+	return ""
+}
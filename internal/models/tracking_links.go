@@ -0,0 +1,55 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// Tracking link sources
+const (
+	TrackingSourceCampaign = "campaign"
+	TrackingSourcePoster   = "poster"
+	TrackingSourceWebsite  = "website"
+	TrackingSourceOther    = "other"
+)
+
+// TrackingLink is a wa.me link whose pre-filled message carries a tracking code, so
+// conversations started from it can be attributed to where the link was shared
+type TrackingLink struct {
+	BaseModel
+	OrganizationID uuid.UUID  `gorm:"type:uuid;index;not null" json:"organization_id"`
+	Name           string     `gorm:"size:255;not null" json:"name"`
+	Code           string     `gorm:"size:20;uniqueIndex;not null" json:"code"` // Also the short link path, so unique across organizations
+	PhoneNumber    string     `gorm:"size:20;not null" json:"phone_number"`     // The number customers message
+	Message        string     `gorm:"type:text" json:"message"`                 // Pre-filled text, the tracking code is appended
+	Source         string     `gorm:"size:20;not null" json:"source"`           // campaign, poster, website, other
+	SourceRef      string     `gorm:"size:255" json:"source_ref"`               // Campaign name, poster location, page URL...
+	IsActive       bool       `gorm:"default:true" json:"is_active"`
+	Clicks         int        `gorm:"default:0" json:"clicks"`
+	CreatedBy      *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+
+	// Relations
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+}
+
+func (TrackingLink) TableName() string {
+	return "tracking_links"
+}
+
+// TrackingLinkAttribution records a contact whose conversation started from a
+// tracking link. A contact is attributed to a link once, on the first message
+// carrying its code.
+type TrackingLinkAttribution struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"type:uuid;index;not null" json:"organization_id"`
+	LinkID         uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_tracking_attribution_link_contact;not null" json:"link_id"`
+	ContactID      uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_tracking_attribution_link_contact;not null" json:"contact_id"`
+	IsNewContact   bool      `gorm:"default:false" json:"is_new_contact"` // The contact first wrote through this link
+
+	// Relations
+	Link    *TrackingLink `gorm:"foreignKey:LinkID" json:"link,omitempty"`
+	Contact *Contact      `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+}
+
+func (TrackingLinkAttribution) TableName() string {
+	return "tracking_link_attributions"
+}
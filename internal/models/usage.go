@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UsagePeriodTotal is the period of metrics that are not reset monthly (storage, agents)
+const UsagePeriodTotal = "total"
+
+// UsageCounter holds an organization's usage of a metric in a billing period
+type UsageCounter struct {
+	BaseModel
+	OrganizationID uuid.UUID   `gorm:"type:uuid;not null;uniqueIndex:idx_usage_counters_org_period_metric" json:"organization_id"`
+	Period         string      `gorm:"size:20;not null;uniqueIndex:idx_usage_counters_org_period_metric" json:"period"` // YYYY-MM, YYYY-MM-DD for daily fair-use counters, or "total"
+	Metric         UsageMetric `gorm:"size:50;not null;uniqueIndex:idx_usage_counters_org_period_metric" json:"metric"`
+	Value          int64       `gorm:"default:0" json:"value"`
+	WarnedAt       *time.Time  `json:"warned_at,omitempty"`        // Soft limit alert sent
+	LimitReachedAt *time.Time  `json:"limit_reached_at,omitempty"` // Hard limit alert sent
+	ThrottledAt    *time.Time  `json:"throttled_at,omitempty"`     // Campaigns throttled alert sent (messages only)
+	QuotaWarnedAt  *time.Time  `json:"quota_warned_at,omitempty"`  // Fair-use quota warning sent
+	QuotaReachedAt *time.Time  `json:"quota_reached_at,omitempty"` // Fair-use quota reached alert sent
+}
+
+func (UsageCounter) TableName() string {
+	return "usage_counters"
+}
+
+// FairUseQuotas cap an organization's outbound messages and AI calls per UTC day and
+// per calendar month, so one tenant can't use up the capacity of a shared deployment.
+// A zero quota uses the deployment's default and -1 means unlimited.
+type FairUseQuotas struct {
+	DailyMessages   int64 `gorm:"default:0" json:"daily_messages"`
+	MonthlyMessages int64 `gorm:"default:0" json:"monthly_messages"`
+	DailyAICalls    int64 `gorm:"default:0" json:"daily_ai_calls"`
+	MonthlyAICalls  int64 `gorm:"default:0" json:"monthly_ai_calls"`
+}
+
+// WithDefaults returns the quotas in effect, with zero quotas taken from the defaults.
+// Unlimited quotas are returned as 0.
+func (q FairUseQuotas) WithDefaults(defaults FairUseQuotas) FairUseQuotas {
+	resolve := func(quota, def int64) int64 {
+		if quota == 0 {
+			quota = def
+		}
+		return max(quota, 0)
+	}
+	return FairUseQuotas{
+		DailyMessages:   resolve(q.DailyMessages, defaults.DailyMessages),
+		MonthlyMessages: resolve(q.MonthlyMessages, defaults.MonthlyMessages),
+		DailyAICalls:    resolve(q.DailyAICalls, defaults.DailyAICalls),
+		MonthlyAICalls:  resolve(q.MonthlyAICalls, defaults.MonthlyAICalls),
+	}
+}
+
+// Limit returns the daily or monthly quota of a metric, 0 meaning unlimited. Only
+// messages and AI calls have fair-use quotas.
+func (q FairUseQuotas) Limit(metric UsageMetric, daily bool) int64 {
+	switch {
+	case metric == UsageMetricMessages && daily:
+		return q.DailyMessages
+	case metric == UsageMetricMessages:
+		return q.MonthlyMessages
+	case metric == UsageMetricAICalls && daily:
+		return q.DailyAICalls
+	case metric == UsageMetricAICalls:
+		return q.MonthlyAICalls
+	}
+	return 0
+}
+
+// Units of billable usage metered per organization
+const (
+	MeterUnitConversationPrefix = "conversation." // Followed by Meta's pricing category, e.g. conversation.marketing
+	MeterUnitMessagePrefix      = "message."      // Billable messages on per-message pricing, by category
+	MeterUnitAIPromptTokens     = "ai_prompt_tokens"
+	MeterUnitAICompletionTokens = "ai_completion_tokens"
+	MeterUnitSeats              = "seats" // Peak active users in the month
+)
+
+// UsageMeter holds an organization's billable units of one kind in a month, so
+// customers can be charged for them: billable conversations by category, AI tokens
+// and seats
+type UsageMeter struct {
+	BaseModel
+	OrganizationID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_usage_meters_org_period_unit" json:"organization_id"`
+	Period         string    `gorm:"size:7;not null;uniqueIndex:idx_usage_meters_org_period_unit;index" json:"period"` // YYYY-MM, UTC
+	Unit           string    `gorm:"size:100;not null;uniqueIndex:idx_usage_meters_org_period_unit" json:"unit"`
+	Quantity       int64     `gorm:"default:0" json:"quantity"`
+}
+
+func (UsageMeter) TableName() string {
+	return "usage_meters"
+}
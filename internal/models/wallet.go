@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Wallet holds an organization's prepaid credit. Organizations with a wallet are
+// debited for conversations and AI calls at their plan's wallet rates.
+type Wallet struct {
+	BaseModel
+	OrganizationID      uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"organization_id"`
+	Balance             int64      `gorm:"default:0" json:"balance"` // In the smallest unit of Currency, can go negative
+	Currency            string     `gorm:"size:3;default:'USD'" json:"currency"`
+	LowBalanceThreshold int64      `gorm:"default:0" json:"low_balance_threshold"` // Alert when the balance drops below this, 0 = no alert
+	LowBalanceAlertedAt *time.Time `json:"low_balance_alerted_at,omitempty"`
+	DepletedAt          *time.Time `json:"depleted_at,omitempty"` // Balance reached zero and campaigns were paused
+}
+
+func (Wallet) TableName() string {
+	return "wallets"
+}
+
+// WalletTransaction is a credit or debit of a wallet
+type WalletTransaction struct {
+	BaseModel
+	OrganizationID uuid.UUID             `gorm:"type:uuid;not null" json:"organization_id"`
+	Type           WalletTransactionType `gorm:"size:10;not null" json:"type"`
+	Amount         int64                 `gorm:"not null" json:"amount"` // Always positive
+	BalanceAfter   int64                 `json:"balance_after"`
+	Description    string                `gorm:"size:255" json:"description"`
+	Reference      string                `gorm:"size:255" json:"reference,omitempty"` // What was charged, e.g. conversation:<id>; debits are idempotent per reference
+	CreatedByID    *uuid.UUID            `gorm:"type:uuid" json:"created_by_id,omitempty"`
+}
+
+func (WalletTransaction) TableName() string {
+	return "wallet_transactions"
+}
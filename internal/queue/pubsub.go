@@ -13,6 +13,10 @@ import (
 const (
 	// CampaignStatsChannel is the Redis pub/sub channel for campaign stats updates
 	CampaignStatsChannel = "whatomate:campaign_stats"
+
+	// ConfigReloadChannel is the Redis pub/sub channel that tells servers to reload
+	// their configuration
+	ConfigReloadChannel = "whatomate:config_reload"
 )
 
 // CampaignStatsUpdate represents a campaign stats update message
@@ -56,6 +60,15 @@ func (p *Publisher) PublishCampaignStats(ctx context.Context, update *CampaignSt
 	return nil
 }
 
+// PublishConfigReload tells every server to reload its configuration
+func (p *Publisher) PublishConfigReload(ctx context.Context) error {
+	if err := p.client.Publish(ctx, ConfigReloadChannel, "reload").Err(); err != nil {
+		p.log.Error("Failed to publish config reload", "error", err)
+		return err
+	}
+	return nil
+}
+
 // Subscriber subscribes to Redis pub/sub channels
 type Subscriber struct {
 	client *redis.Client
@@ -112,6 +125,34 @@ func (s *Subscriber) SubscribeCampaignStats(ctx context.Context, handler func(up
 	return nil
 }
 
+// SubscribeConfigReload subscribes to config reload requests. The handler is called
+// for each request, until ctx is done.
+func (s *Subscriber) SubscribeConfigReload(ctx context.Context, handler func()) error {
+	pubsub := s.client.Subscribe(ctx, ConfigReloadChannel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return err
+	}
+
+	ch := pubsub.Channel()
+	go func() {
+		defer func() { _ = pubsub.Close() }()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-ch:
+				if !ok {
+					return
+				}
+				handler()
+			}
+		}
+	}()
+
+	return nil
+}
+
 // Close closes the subscriber
 func (s *Subscriber) Close() error {
 	if s.pubsub != nil {
@@ -24,7 +24,9 @@ type RecipientJob struct {
 	PhoneNumber    string        `json:"phone_number"`
 	RecipientName  string        `json:"recipient_name"`
 	TemplateParams models.JSONB  `json:"template_params"`
+	VariantID      *uuid.UUID    `json:"variant_id,omitempty"` // Variant of an A/B tested campaign to send
 	EnqueuedAt     time.Time     `json:"enqueued_at"`
+	Attempts       int           `json:"attempts,omitempty"` // Sends already tried and failed
 }
 
 // Queue defines the interface for job queue operations
@@ -0,0 +1,148 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/shridarpatil/whatomate/internal/models"
+)
+
+const (
+	// DefaultMessagesPerSecond is the Cloud API's default throughput per number
+	DefaultMessagesPerSecond = 80
+
+	// ConversationWindow is the rolling window messaging limit tiers are counted over
+	ConversationWindow = 24 * time.Hour
+)
+
+// tierConversationLimits are the business-initiated conversations per 24 hours
+// allowed by each messaging limit tier Meta reports. 0 is unlimited.
+var tierConversationLimits = map[string]int{
+	"TIER_50":        50,
+	"TIER_250":       250,
+	"TIER_1K":        1000,
+	"TIER_2K":        2000,
+	"TIER_10K":       10000,
+	"TIER_100K":      100000,
+	"TIER_UNLIMITED": 0,
+}
+
+// ConversationLimit returns the conversations per 24 hours of a messaging limit tier.
+// Unknown tiers aren't limited, since Meta hasn't reported them yet.
+func ConversationLimit(tier string) int {
+	return tierConversationLimits[tier]
+}
+
+// SendLimits are the limits of a phone number
+type SendLimits struct {
+	MessagesPerSecond int // Throughput, 0 isn't limited
+	Conversations     int // Business-initiated conversations per 24 hours, 0 isn't limited
+}
+
+// AccountSendLimits returns the limits of a number: its configured throughput and
+// the messaging limit tier Meta last reported
+func AccountSendLimits(account *models.WhatsAppAccount) SendLimits {
+	perSecond := account.MessagesPerSecond
+	if perSecond == 0 {
+		perSecond = DefaultMessagesPerSecond
+	}
+	return SendLimits{
+		MessagesPerSecond: perSecond,
+		Conversations:     ConversationLimit(account.MessagingLimitTier),
+	}
+}
+
+// sendLimitScript reserves a send for a number. Throughput is a token bucket refilled
+// at the per-second rate. Conversations are the recipients of business-initiated
+// messages in the rolling window, and messaging someone already in it is free.
+// Returns 0 when the send can go now, or the milliseconds to wait.
+var sendLimitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local recipient = ARGV[4]
+local window = tonumber(ARGV[5])
+
+local newConversation = false
+if limit > 0 and recipient ~= '' then
+	redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', now - window)
+	if not redis.call('ZSCORE', KEYS[2], recipient) then
+		if redis.call('ZCARD', KEYS[2]) >= limit then
+			local oldest = redis.call('ZRANGE', KEYS[2], 0, 0, 'WITHSCORES')
+			return math.max(1, tonumber(oldest[2]) + window - now)
+		end
+		newConversation = true
+	end
+end
+
+if rate > 0 then
+	local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens') or rate)
+	local ts = tonumber(redis.call('HGET', KEYS[1], 'ts') or now)
+	tokens = math.min(rate, tokens + math.max(0, now - ts) * rate / 1000)
+	if tokens < 1 then
+		return math.ceil((1 - tokens) * 1000 / rate)
+	end
+	redis.call('HSET', KEYS[1], 'tokens', tostring(tokens - 1), 'ts', now)
+	redis.call('PEXPIRE', KEYS[1], 60000)
+end
+
+if newConversation then
+	redis.call('ZADD', KEYS[2], now, recipient)
+	redis.call('PEXPIRE', KEYS[2], window)
+end
+return 0
+`)
+
+// SendLimiter enforces the send limits of phone numbers across all app and worker
+// instances. A nil limiter, or one without Redis, doesn't limit.
+type SendLimiter struct {
+	client *redis.Client
+}
+
+// NewSendLimiter creates a send limiter
+func NewSendLimiter(client *redis.Client) *SendLimiter {
+	return &SendLimiter{client: client}
+}
+
+// Reserve takes a send slot for a number. Pass the recipient for messages that open
+// a business-initiated conversation, so they count against the tier. It returns 0
+// when the message can be sent now, or how long to wait before trying again.
+func (l *SendLimiter) Reserve(ctx context.Context, phoneID, recipient string, limits SendLimits) (time.Duration, error) {
+	if l == nil || l.client == nil {
+		return 0, nil
+	}
+	keys := []string{
+		fmt.Sprintf("sendlimit:{%s}:rate", phoneID),
+		fmt.Sprintf("sendlimit:{%s}:conversations", phoneID),
+	}
+	wait, err := sendLimitScript.Run(ctx, l.client, keys,
+		time.Now().UnixMilli(), limits.MessagesPerSecond, limits.Conversations, recipient, ConversationWindow.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check send limit: %w", err)
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// Wait blocks until a send slot is free, for sends that can't be deferred. It fails
+// if that takes longer than maxWait or the context ends first. A failed limit check
+// doesn't hold up the send, since Meta enforces the limits too.
+func (l *SendLimiter) Wait(ctx context.Context, phoneID, recipient string, limits SendLimits, maxWait time.Duration) error {
+	deadline := time.Now().Add(maxWait)
+	for {
+		wait, err := l.Reserve(ctx, phoneID, recipient, limits)
+		if err != nil || wait == 0 {
+			return nil
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("number has reached its sending limit, retry in %s", wait.Round(time.Second))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
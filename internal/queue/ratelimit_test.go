@@ -0,0 +1,74 @@
+package queue_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/models"
+	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountSendLimits(t *testing.T) {
+	limits := queue.AccountSendLimits(&models.WhatsAppAccount{MessagingLimitTier: "TIER_1K"})
+	assert.Equal(t, queue.DefaultMessagesPerSecond, limits.MessagesPerSecond)
+	assert.Equal(t, 1000, limits.Conversations)
+
+	limits = queue.AccountSendLimits(&models.WhatsAppAccount{MessagesPerSecond: 20, MessagingLimitTier: "TIER_UNLIMITED"})
+	assert.Equal(t, 20, limits.MessagesPerSecond)
+	assert.Equal(t, 0, limits.Conversations)
+
+	assert.Equal(t, 0, queue.ConversationLimit(""), "unknown tiers aren't limited")
+}
+
+func TestSendLimiter_Reserve(t *testing.T) {
+	rdb := testutil.SetupTestRedis(t)
+	if rdb == nil {
+		t.Skip("TEST_REDIS_URL not set")
+	}
+	ctx := context.Background()
+	limiter := queue.NewSendLimiter(rdb)
+
+	t.Run("throughput", func(t *testing.T) {
+		phoneID := uuid.NewString()
+		limits := queue.SendLimits{MessagesPerSecond: 2}
+		for i := 0; i < 2; i++ {
+			wait, err := limiter.Reserve(ctx, phoneID, "", limits)
+			require.NoError(t, err)
+			assert.Zero(t, wait)
+		}
+		wait, err := limiter.Reserve(ctx, phoneID, "", limits)
+		require.NoError(t, err)
+		assert.Greater(t, wait, time.Duration(0))
+		assert.LessOrEqual(t, wait, 500*time.Millisecond)
+	})
+
+	t.Run("conversations", func(t *testing.T) {
+		phoneID := uuid.NewString()
+		limits := queue.SendLimits{Conversations: 1}
+
+		wait, err := limiter.Reserve(ctx, phoneID, "911234567890", limits)
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+
+		// Messaging the same customer again doesn't open another conversation
+		wait, err = limiter.Reserve(ctx, phoneID, "911234567890", limits)
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+
+		wait, err = limiter.Reserve(ctx, phoneID, "919876543210", limits)
+		require.NoError(t, err)
+		assert.Greater(t, wait, 23*time.Hour)
+	})
+
+	t.Run("nil limiter", func(t *testing.T) {
+		var none *queue.SendLimiter
+		wait, err := none.Reserve(ctx, uuid.NewString(), "", queue.SendLimits{MessagesPerSecond: 1})
+		require.NoError(t, err)
+		assert.Zero(t, wait)
+	})
+}
@@ -15,6 +15,9 @@ const (
 	// StreamName is the Redis stream for campaign jobs
 	StreamName = "whatomate:campaigns"
 
+	// DelayedSetName holds jobs deferred to a later time, scored by when they're due
+	DelayedSetName = "whatomate:campaigns:delayed"
+
 	// ConsumerGroup is the consumer group name for workers
 	ConsumerGroup = "campaign-workers"
 
@@ -102,11 +105,39 @@ func (q *RedisQueue) EnqueueRecipients(ctx context.Context, jobs []*RecipientJob
 	return nil
 }
 
+// EnqueueRecipientAt defers a recipient job until the given time, when a consumer
+// moves it onto the stream
+func (q *RedisQueue) EnqueueRecipientAt(ctx context.Context, job *RecipientJob, at time.Time) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recipient job: %w", err)
+	}
+
+	if err := q.client.ZAdd(ctx, DelayedSetName, redis.Z{
+		Score:  float64(at.UnixMilli()),
+		Member: string(payload),
+	}).Err(); err != nil {
+		return fmt.Errorf("failed to defer recipient job: %w", err)
+	}
+	return nil
+}
+
 // Close closes the queue connection
 func (q *RedisQueue) Close() error {
 	return nil // Redis client is managed externally
 }
 
+// promoteDelayedScript moves due deferred jobs onto the stream. It runs atomically,
+// so consumers promoting at the same time don't enqueue a job twice.
+var promoteDelayedScript = redis.NewScript(`
+local jobs = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, job in ipairs(jobs) do
+	redis.call('XADD', KEYS[2], '*', 'type', ARGV[2], 'payload', job)
+	redis.call('ZREM', KEYS[1], job)
+end
+return #jobs
+`)
+
 // RedisConsumer implements the Consumer interface using Redis Streams
 type RedisConsumer struct {
 	client     *redis.Client
@@ -154,6 +185,11 @@ func (c *RedisConsumer) Consume(ctx context.Context, handler JobHandler) error {
 		default:
 		}
 
+		// Enqueue deferred jobs that are due
+		if err := c.promoteDelayed(ctx); err != nil {
+			c.log.Warn("Failed to enqueue deferred jobs", "error", err)
+		}
+
 		// Read new messages from the stream
 		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
 			Group:    ConsumerGroup,
@@ -193,6 +229,19 @@ func (c *RedisConsumer) Consume(ctx context.Context, handler JobHandler) error {
 	}
 }
 
+// promoteDelayed moves deferred jobs that are due onto the stream
+func (c *RedisConsumer) promoteDelayed(ctx context.Context) error {
+	moved, err := promoteDelayedScript.Run(ctx, c.client, []string{DelayedSetName, StreamName},
+		time.Now().UnixMilli(), string(JobTypeRecipient)).Int()
+	if err != nil {
+		return err
+	}
+	if moved > 0 {
+		c.log.Debug("Deferred jobs enqueued", "count", moved)
+	}
+	return nil
+}
+
 // claimPendingMessages claims stale pending messages from crashed workers
 func (c *RedisConsumer) claimPendingMessages(ctx context.Context, handler JobHandler) error {
 	// Get pending messages that have been idle for too long
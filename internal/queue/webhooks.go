@@ -0,0 +1,233 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/shridarpatil/whatomate/internal/tracing"
+	"github.com/zerodha/logf"
+)
+
+const (
+	// WebhookStreamName is the Redis stream for inbound webhook payloads
+	WebhookStreamName = "whatomate:webhooks"
+
+	// WebhookConsumerGroup is the consumer group name for webhook workers
+	WebhookConsumerGroup = "webhook-workers"
+
+	// WebhookStreamMaxLen caps the stream, trimming the oldest processed payloads
+	WebhookStreamMaxLen = 100000
+
+	// WebhookMaxDeliveries is how many times a payload is tried before it's dropped
+	WebhookMaxDeliveries = 5
+
+	// webhookClaimInterval is how often stale pending payloads are looked for
+	webhookClaimInterval = time.Minute
+)
+
+// WebhookHandlerFunc processes a webhook payload. Payloads it returns an error for
+// are tried again.
+type WebhookHandlerFunc func(ctx context.Context, payload []byte) error
+
+// WebhookQueue stores inbound webhook payloads until a webhook worker processes them
+type WebhookQueue struct {
+	client *redis.Client
+}
+
+// NewWebhookQueue creates a webhook queue
+func NewWebhookQueue(client *redis.Client) *WebhookQueue {
+	return &WebhookQueue{client: client}
+}
+
+// Enqueue adds a webhook payload to the stream, along with the trace context of ctx
+// so processing continues the request's trace
+func (q *WebhookQueue) Enqueue(ctx context.Context, payload []byte) error {
+	values := map[string]interface{}{
+		"payload": string(payload),
+	}
+	carrier := map[string]string{}
+	tracing.Inject(ctx, carrier)
+	for k, v := range carrier {
+		values[k] = v
+	}
+
+	err := q.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: WebhookStreamName,
+		MaxLen: WebhookStreamMaxLen,
+		Approx: true,
+		Values: values,
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to enqueue webhook: %w", err)
+	}
+	return nil
+}
+
+// WebhookConsumer processes webhook payloads from the stream. Payloads are ACKed once
+// processed, so payloads of a worker that stops midway are claimed by another.
+type WebhookConsumer struct {
+	client     *redis.Client
+	log        logf.Logger
+	consumerID string
+
+	// OnDrop, when set, is given payloads dropped after WebhookMaxDeliveries tries
+	OnDrop func(payload []byte, cause error)
+}
+
+// NewWebhookConsumer creates a webhook consumer. Each consumer in a process needs its
+// own number.
+func NewWebhookConsumer(client *redis.Client, log logf.Logger, num int) (*WebhookConsumer, error) {
+	hostname, _ := os.Hostname()
+	consumerID := fmt.Sprintf("webhook-%s-%d-%d", hostname, os.Getpid(), num)
+
+	err := client.XGroupCreateMkStream(context.Background(), WebhookStreamName, WebhookConsumerGroup, "0").Err()
+	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+		return nil, fmt.Errorf("failed to create webhook consumer group: %w", err)
+	}
+
+	return &WebhookConsumer{
+		client:     client,
+		log:        log,
+		consumerID: consumerID,
+	}, nil
+}
+
+// Consume processes webhook payloads until the context is cancelled
+func (c *WebhookConsumer) Consume(ctx context.Context, handle WebhookHandlerFunc) error {
+	var lastClaim time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		// Take over payloads of workers that stopped before finishing them
+		if time.Since(lastClaim) >= webhookClaimInterval {
+			lastClaim = time.Now()
+			if err := c.claimPending(ctx, handle); err != nil {
+				c.log.Warn("Failed to claim pending webhooks", "error", err)
+			}
+		}
+
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    WebhookConsumerGroup,
+			Consumer: c.consumerID,
+			Streams:  []string{WebhookStreamName, ">"},
+			Count:    1,
+			Block:    BlockTimeout,
+		}).Result()
+		if err != nil {
+			if err == redis.Nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.log.Error("Failed to read webhooks", "error", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				c.process(ctx, msg, handle)
+			}
+		}
+	}
+}
+
+// claimPending claims payloads that have been pending too long, dropping ones that
+// have failed too many times
+func (c *WebhookConsumer) claimPending(ctx context.Context, handle WebhookHandlerFunc) error {
+	pending, err := c.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: WebhookStreamName,
+		Group:  WebhookConsumerGroup,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+		Idle:   ClaimMinIdleTime,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get pending webhooks: %w", err)
+	}
+
+	for _, p := range pending {
+		if p.RetryCount >= WebhookMaxDeliveries {
+			c.log.Error("Dropping webhook after repeated failures", "message_id", p.ID, "deliveries", p.RetryCount)
+			c.drop(ctx, p.ID, p.RetryCount)
+			continue
+		}
+
+		messages, err := c.client.XClaim(ctx, &redis.XClaimArgs{
+			Stream:   WebhookStreamName,
+			Group:    WebhookConsumerGroup,
+			Consumer: c.consumerID,
+			MinIdle:  ClaimMinIdleTime,
+			Messages: []string{p.ID},
+		}).Result()
+		if err != nil {
+			c.log.Error("Failed to claim webhook", "error", err, "message_id", p.ID)
+			continue
+		}
+		for _, msg := range messages {
+			c.process(ctx, msg, handle)
+		}
+	}
+	return nil
+}
+
+// process handles a payload and ACKs it when done
+func (c *WebhookConsumer) process(ctx context.Context, msg redis.XMessage, handle WebhookHandlerFunc) {
+	payload, ok := msg.Values["payload"].(string)
+	if !ok {
+		c.log.Error("Dropping webhook without payload", "message_id", msg.ID)
+		c.ack(msg.ID)
+		return
+	}
+	if err := handle(tracing.Extract(ctx, traceCarrier(msg)), []byte(payload)); err != nil {
+		// Not ACKed, so it's claimed and tried again later
+		c.log.Error("Failed to process webhook", "error", err, "message_id", msg.ID)
+		return
+	}
+	c.ack(msg.ID)
+}
+
+// traceCarrier returns the trace context fields stored with a payload
+func traceCarrier(msg redis.XMessage) map[string]string {
+	carrier := make(map[string]string, len(msg.Values))
+	for k, v := range msg.Values {
+		if s, ok := v.(string); ok && k != "payload" {
+			carrier[k] = s
+		}
+	}
+	return carrier
+}
+
+// drop gives up on a payload, handing it to OnDrop first
+func (c *WebhookConsumer) drop(ctx context.Context, id string, deliveries int64) {
+	if c.OnDrop != nil {
+		messages, err := c.client.XRangeN(ctx, WebhookStreamName, id, id, 1).Result()
+		if err != nil {
+			c.log.Error("Failed to read dropped webhook", "error", err, "message_id", id)
+			return // Left pending, so it's dropped on the next claim
+		}
+		for _, msg := range messages {
+			if payload, ok := msg.Values["payload"].(string); ok {
+				c.OnDrop([]byte(payload), fmt.Errorf("webhook processing didn't finish after %d tries", deliveries))
+			}
+		}
+	}
+	c.ack(id)
+}
+
+// ack marks a payload as processed. It isn't tied to the consumer's context, so a
+// payload finished during shutdown isn't processed again.
+func (c *WebhookConsumer) ack(id string) {
+	if err := c.client.XAck(context.Background(), WebhookStreamName, WebhookConsumerGroup, id).Err(); err != nil {
+		c.log.Error("Failed to ACK webhook", "error", err, "message_id", id)
+	}
+}
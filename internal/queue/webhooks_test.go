@@ -0,0 +1,44 @@
+package queue_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookQueue_EnqueueAndConsume(t *testing.T) {
+	rdb := testutil.SetupTestRedis(t)
+	if rdb == nil {
+		t.Skip("TEST_REDIS_URL not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	consumer, err := queue.NewWebhookConsumer(rdb, testutil.NopLogger(), 1)
+	require.NoError(t, err)
+
+	payload := `{"object":"whatsapp_business_account","id":"` + uuid.NewString() + `"}`
+	require.NoError(t, queue.NewWebhookQueue(rdb).Enqueue(ctx, []byte(payload)))
+
+	var received string
+	err = consumer.Consume(ctx, func(_ context.Context, body []byte) error {
+		if string(body) == payload {
+			received = string(body)
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, payload, received)
+
+	// Processed payloads are ACKed
+	pending, err := rdb.XPending(context.Background(), queue.WebhookStreamName, queue.WebhookConsumerGroup).Result()
+	require.NoError(t, err)
+	assert.Zero(t, pending.Count)
+}
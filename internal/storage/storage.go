@@ -0,0 +1,40 @@
+// Package storage keeps media files on local disk or in an S3 bucket
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+)
+
+// ErrNotFound is returned when a file doesn't exist
+var ErrNotFound = errors.New("file not found")
+
+// Store saves and reads media files by key, a relative path such as
+// "images/<uuid>.jpg"
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Size returns the size of a file in bytes
+	Size(ctx context.Context, key string) (int64, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New creates the store for the storage config. client is used for S3 calls.
+func New(cfg config.StorageConfig, client *http.Client) Store {
+	if cfg.Type == "s3" {
+		return NewS3(cfg, client)
+	}
+	return NewLocal(cfg.LocalPath)
+}
+
+// validKey rejects keys that could escape the storage root
+func validKey(key string) error {
+	if key == "" || strings.Contains(key, "..") || strings.HasPrefix(key, "/") {
+		return errors.New("invalid file path")
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocal(t.TempDir())
+
+	require.NoError(t, store.Put(ctx, "images/photo.jpg", []byte("jpeg"), "image/jpeg"))
+	data, err := store.Get(ctx, "images/photo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", string(data))
+
+	size, err := store.Size(ctx, "images/photo.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), size)
+
+	require.NoError(t, store.Delete(ctx, "images/photo.jpg"))
+	_, err = store.Get(ctx, "images/photo.jpg")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, store.Delete(ctx, "images/photo.jpg"))
+
+	assert.Error(t, store.Put(ctx, "../outside.txt", []byte("x"), ""))
+	_, err = store.Get(ctx, "/etc/passwd")
+	assert.Error(t, err)
+}
+
+func TestS3(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/20240105/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = data
+		case http.MethodGet, http.MethodHead:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			_, _ = w.Write(data)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	store := NewS3(config.StorageConfig{
+		S3Bucket:   "media",
+		S3Region:   "us-east-1",
+		S3Key:      "AKID",
+		S3Secret:   "secret",
+		S3Endpoint: server.URL + "/",
+	}, nil)
+	store.now = func() time.Time { return time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC) }
+
+	ctx := context.Background()
+	require.NoError(t, store.Put(ctx, "documents/invoice.pdf", []byte("%PDF"), "application/pdf"))
+	assert.Contains(t, objects, "/media/documents/invoice.pdf")
+
+	data, err := store.Get(ctx, "documents/invoice.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, "%PDF", string(data))
+
+	size, err := store.Size(ctx, "documents/invoice.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), size)
+
+	require.NoError(t, store.Delete(ctx, "documents/invoice.pdf"))
+	_, err = store.Get(ctx, "documents/invoice.pdf")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	store.key = "OTHER"
+	assert.ErrorContains(t, store.Put(ctx, "images/photo.jpg", []byte("jpeg"), "image/jpeg"), "status 403")
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	store := NewS3(config.StorageConfig{S3Bucket: "media", S3Region: "eu-west-1"}, nil)
+	assert.Equal(t, "https://media.s3.eu-west-1.amazonaws.com/images/a%20b%2Bc.jpg", store.objectURL("images/a b+c.jpg"))
+}
+
+func TestSigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	assert.Equal(t, "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d", hex.EncodeToString(key))
+}
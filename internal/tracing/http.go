@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Handler traces API requests, continuing the trace of callers that send a
+// traceparent header. Spans are named after the matched route, so the router needs
+// SaveMatchedRoutePath set.
+func Handler(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(rc *fasthttp.RequestCtx) {
+		path := string(rc.Path())
+		if !strings.HasPrefix(path, "/api/") {
+			next(rc)
+			return
+		}
+
+		method := string(rc.Method())
+		parent := otel.GetTextMapPropagator().Extract(context.Background(), requestHeaderCarrier{&rc.Request.Header})
+		ctx, span := otel.Tracer(instrumentationName).Start(parent, method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(method),
+				semconv.URLPath(path),
+			),
+		)
+		defer span.End()
+		if id := RequestID(rc); id != "" {
+			ctx = WithRequestID(ctx, id)
+			span.SetAttributes(attribute.String("request.id", id))
+		}
+		rc.SetUserValue(traceContextKey, ctx)
+
+		next(rc)
+
+		if route, ok := rc.UserValue(router.MatchedRoutePathParam).(string); ok {
+			span.SetName(method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		status := rc.Response.StatusCode()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= fasthttp.StatusInternalServerError {
+			span.SetStatus(codes.Error, fasthttp.StatusMessage(status))
+		}
+	}
+}
+
+// requestHeaderCarrier reads trace context from fasthttp request headers
+type requestHeaderCarrier struct {
+	header *fasthttp.RequestHeader
+}
+
+func (c requestHeaderCarrier) Get(key string) string {
+	return string(c.header.Peek(key))
+}
+
+func (c requestHeaderCarrier) Set(key, value string) {
+	c.header.Set(key, value)
+}
+
+func (c requestHeaderCarrier) Keys() []string {
+	var keys []string
+	c.header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// Transport traces outbound HTTP calls made as part of a traced operation and sends
+// the trace context along in a traceparent header, and the correlation ID in an
+// X-Request-ID header. A nil base uses http.DefaultTransport.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := FromContext(req.Context())
+	id := RequestID(ctx)
+	if id != "" && req.Header.Get(RequestIDHeader) == "" {
+		// RoundTrippers mustn't modify the request they're given
+		req = req.Clone(ctx)
+		req.Header.Set(RequestIDHeader, id)
+	}
+	if !hasParent(ctx) {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, req.Method+" "+req.URL.Host,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			// The path only, query strings can carry access tokens
+			semconv.URLPath(req.URL.Path),
+		),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", resp.StatusCode))
+	}
+	return resp, nil
+}
@@ -0,0 +1,63 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisHook traces Redis commands run as part of a traced operation. Add it with
+// client.AddHook.
+type RedisHook struct{}
+
+var _ redis.Hook = RedisHook{}
+
+func (RedisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (RedisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx = FromContext(ctx)
+		if !hasParent(ctx) {
+			return next(ctx, cmd)
+		}
+		ctx, span := startRedisSpan(ctx, cmd.FullName())
+		err := next(ctx, cmd)
+		End(span, redisError(err))
+		return err
+	}
+}
+
+func (RedisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx = FromContext(ctx)
+		if !hasParent(ctx) {
+			return next(ctx, cmds)
+		}
+		ctx, span := startRedisSpan(ctx, "pipeline", attribute.Int("db.redis.pipeline_length", len(cmds)))
+		err := next(ctx, cmds)
+		End(span, redisError(err))
+		return err
+	}
+}
+
+func startRedisSpan(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, semconv.DBSystemRedis, semconv.DBOperationName(operation))
+	return otel.Tracer(instrumentationName).Start(ctx, "redis "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// redisError drops redis.Nil, which means a key wasn't found rather than a failure
+func redisError(err error) error {
+	if err == redis.Nil {
+		return nil
+	}
+	return err
+}
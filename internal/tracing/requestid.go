@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+)
+
+// RequestIDHeader carries a request's correlation ID, both on responses and on the
+// outbound calls made for the request
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the user value and carrier key a request's correlation ID is
+// stored under
+const requestIDKey = "request_id"
+
+type requestIDContextKey struct{}
+
+// NewRequestID returns a new correlation ID
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// SetRequestID sets the correlation ID of a request
+func SetRequestID(rc *fasthttp.RequestCtx, id string) {
+	rc.SetUserValue(requestIDKey, id)
+}
+
+// WithRequestID returns ctx with a correlation ID, so logs and outbound calls for
+// work done in ctx can be tied together
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestID returns the correlation ID of ctx, or of the request for a
+// *fasthttp.RequestCtx, and "" if it has none
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if rc, ok := ctx.(*fasthttp.RequestCtx); ok {
+		id, _ := rc.UserValue(requestIDKey).(string)
+		return id
+	}
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// ValidRequestID reports whether a correlation ID sent by a caller can be used. IDs
+// are echoed in headers and logs, so they're limited to a safe set of characters.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+// Package tracing sets up OpenTelemetry tracing and instruments the HTTP server,
+// outbound HTTP calls, the database and Redis. Spans are exported over OTLP/HTTP
+// when tracing is enabled in the config, and are no-ops otherwise.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer all spans are created with
+const instrumentationName = "github.com/shridarpatil/whatomate"
+
+// traceContextKey is the user value a request's traced context is stored under
+const traceContextKey = "trace_ctx"
+
+// Init sets up the global tracer provider from the config, returning a function that
+// flushes pending spans on shutdown. Trace context is propagated in W3C traceparent
+// headers whether or not tracing is enabled, so traces from other services pass
+// through.
+func Init(cfg config.TracingConfig, version string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(cfg.Endpoint)}
+	if len(cfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span as a child of the span in ctx, if any. A *fasthttp.RequestCtx
+// continues the request's server span.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(FromContext(ctx), name, trace.WithAttributes(attrs...))
+}
+
+// End records err on the span, if not nil, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// FromContext returns the traced context of a request, carrying its span and
+// correlation ID, for a *fasthttp.RequestCtx, which handlers pass as their context.
+// It returns ctx itself otherwise.
+func FromContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	if rc, ok := ctx.(*fasthttp.RequestCtx); ok {
+		if traced, ok := rc.UserValue(traceContextKey).(context.Context); ok {
+			return traced
+		}
+		if id := RequestID(rc); id != "" {
+			return WithRequestID(context.Background(), id)
+		}
+		return context.Background()
+	}
+	return ctx
+}
+
+// Detach returns a context carrying only the span and correlation ID of ctx, for
+// work that continues after ctx is cancelled or its request is done
+func Detach(ctx context.Context) context.Context {
+	ctx = FromContext(ctx)
+	detached := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+	if id := RequestID(ctx); id != "" {
+		detached = WithRequestID(detached, id)
+	}
+	return detached
+}
+
+// Inject adds the trace context and correlation ID of ctx to carrier, for passing
+// them through a queue
+func Inject(ctx context.Context, carrier map[string]string) {
+	ctx = FromContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(carrier))
+	if id := RequestID(ctx); id != "" {
+		carrier[requestIDKey] = id
+	}
+}
+
+// Extract returns ctx with the trace context and correlation ID that Inject added to
+// carrier
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	if id := carrier[requestIDKey]; id != "" {
+		ctx = WithRequestID(ctx, id)
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// hasParent reports whether ctx has a span to add child spans to. Database and Redis
+// calls are only traced as part of a larger operation, so background polling doesn't
+// flood the exporter with single-span traces.
+func hasParent(ctx context.Context) bool {
+	return trace.SpanFromContext(ctx).SpanContext().IsValid()
+}
@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans sets up a tracer provider that keeps finished spans in memory
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	_, err := Init(config.TracingConfig{}, "test")
+	require.NoError(t, err)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func TestTransport_PropagatesTraceContext(t *testing.T) {
+	exporter := recordSpans(t)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: Transport(nil)}
+
+	// Calls outside a traced operation aren't traced
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Empty(t, traceparent)
+	assert.Empty(t, exporter.GetSpans())
+
+	ctx, parent := Start(context.Background(), "parent")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/path?token=secret", nil)
+	require.NoError(t, err)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	call := spans[0]
+	assert.Equal(t, trace.SpanKindClient, call.SpanKind)
+	assert.Equal(t, parent.SpanContext().SpanID(), call.Parent.SpanID())
+	assert.Contains(t, traceparent, call.SpanContext.TraceID().String())
+	assert.Contains(t, traceparent, call.SpanContext.SpanID().String())
+	for _, attr := range call.Attributes {
+		assert.NotContains(t, attr.Value.Emit(), "secret")
+	}
+}
+
+func TestHandler_ContinuesCallerTrace(t *testing.T) {
+	exporter := recordSpans(t)
+
+	var handlerCtx context.Context
+	handler := Handler(func(rc *fasthttp.RequestCtx) {
+		handlerCtx = FromContext(rc)
+		rc.SetStatusCode(fasthttp.StatusAccepted)
+	})
+
+	rc := &fasthttp.RequestCtx{}
+	rc.Request.Header.SetMethod(fasthttp.MethodPost)
+	rc.Request.SetRequestURI("/api/webhook")
+	rc.Request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler(rc)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+	assert.Equal(t, spans[0].SpanContext.SpanID(), trace.SpanFromContext(handlerCtx).SpanContext().SpanID())
+
+	// Non-API paths, like the frontend's assets, aren't traced
+	rc = &fasthttp.RequestCtx{}
+	rc.Request.SetRequestURI("/assets/app.js")
+	handler(rc)
+	assert.Len(t, exporter.GetSpans(), 1)
+}
+
+func TestInjectExtract(t *testing.T) {
+	recordSpans(t)
+
+	ctx, span := Start(WithRequestID(context.Background(), "req-1"), "enqueue")
+	defer span.End()
+
+	carrier := map[string]string{}
+	Inject(ctx, carrier)
+	require.Contains(t, carrier, "traceparent")
+
+	extracted := Extract(context.Background(), carrier)
+	assert.Equal(t, "req-1", RequestID(extracted))
+	spanContext := trace.SpanContextFromContext(extracted)
+	assert.Equal(t, span.SpanContext().TraceID(), spanContext.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), spanContext.SpanID())
+}
+
+func TestTransport_SendsRequestID(t *testing.T) {
+	recordSpans(t)
+
+	var requestID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = r.Header.Get(RequestIDHeader)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequestWithContext(WithRequestID(context.Background(), "req-2"), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, "req-2", requestID)
+	assert.Empty(t, req.Header.Get(RequestIDHeader), "the caller's request isn't modified")
+}
@@ -38,6 +38,9 @@ type Client struct {
 
 	// Current contact being viewed (nil if none)
 	currentContact *uuid.UUID
+
+	// Phone number of the contact a web chat visitor chats as ("" for users)
+	visitor string
 }
 
 // NewClient creates a new Client instance
@@ -51,6 +54,18 @@ func NewClient(hub *Hub, conn *websocket.Conn, userID, orgID uuid.UUID) *Client
 	}
 }
 
+// NewVisitorClient creates a new Client instance for a web chat visitor. Visitors
+// only receive what is sent to them with BroadcastToVisitor.
+func NewVisitorClient(hub *Hub, conn *websocket.Conn, orgID uuid.UUID, phoneNumber string) *Client {
+	return &Client{
+		hub:            hub,
+		conn:           conn,
+		send:           make(chan []byte, 256),
+		organizationID: orgID,
+		visitor:        phoneNumber,
+	}
+}
+
 // ReadPump pumps messages from the websocket connection to the hub
 func (c *Client) ReadPump() {
 	defer func() {
@@ -143,6 +158,10 @@ func (c *Client) handleMessage(data []byte) {
 
 	switch msg.Type {
 	case TypeSetContact:
+		// Visitors chat as one contact and can't view others
+		if c.visitor != "" {
+			return
+		}
 		c.handleSetContact(msg.Payload)
 	case TypePing:
 		c.sendPong()
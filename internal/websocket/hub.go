@@ -13,6 +13,9 @@ type Hub struct {
 	// clients maps organization ID -> user ID -> set of clients (supports multiple tabs)
 	clients map[uuid.UUID]map[uuid.UUID]map[*Client]struct{}
 
+	// visitors maps organization ID -> contact phone number -> set of web chat visitor clients
+	visitors map[uuid.UUID]map[string]map[*Client]struct{}
+
 	// broadcast channel for messages
 	broadcast chan BroadcastMessage
 
@@ -33,6 +36,7 @@ type Hub struct {
 func NewHub(log logf.Logger) *Hub {
 	return &Hub{
 		clients:    make(map[uuid.UUID]map[uuid.UUID]map[*Client]struct{}),
+		visitors:   make(map[uuid.UUID]map[string]map[*Client]struct{}),
 		broadcast:  make(chan BroadcastMessage, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
@@ -61,6 +65,11 @@ func (h *Hub) registerClient(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	if client.visitor != "" {
+		h.registerVisitor(client)
+		return
+	}
+
 	orgClients, ok := h.clients[client.organizationID]
 	if !ok {
 		orgClients = make(map[uuid.UUID]map[*Client]struct{})
@@ -88,6 +97,11 @@ func (h *Hub) unregisterClient(client *Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	if client.visitor != "" {
+		h.unregisterVisitor(client)
+		return
+	}
+
 	if orgClients, ok := h.clients[client.organizationID]; ok {
 		if userClients, ok := orgClients[client.userID]; ok {
 			if _, exists := userClients[client]; exists {
@@ -113,11 +127,62 @@ func (h *Hub) unregisterClient(client *Client) {
 		"total_clients", h.countClients())
 }
 
+// registerVisitor adds a web chat visitor client to the hub. Must be called with mu held.
+func (h *Hub) registerVisitor(client *Client) {
+	orgVisitors, ok := h.visitors[client.organizationID]
+	if !ok {
+		orgVisitors = make(map[string]map[*Client]struct{})
+		h.visitors[client.organizationID] = orgVisitors
+	}
+
+	visitorClients, ok := orgVisitors[client.visitor]
+	if !ok {
+		visitorClients = make(map[*Client]struct{})
+		orgVisitors[client.visitor] = visitorClients
+	}
+	visitorClients[client] = struct{}{}
+
+	h.log.Debug("Web chat visitor registered",
+		"org_id", client.organizationID,
+		"visitor_connections", len(visitorClients))
+}
+
+// unregisterVisitor removes a web chat visitor client. Must be called with mu held.
+func (h *Hub) unregisterVisitor(client *Client) {
+	orgVisitors, ok := h.visitors[client.organizationID]
+	if !ok {
+		return
+	}
+	visitorClients, ok := orgVisitors[client.visitor]
+	if !ok {
+		return
+	}
+	if _, exists := visitorClients[client]; exists {
+		delete(visitorClients, client)
+		close(client.send)
+
+		if len(visitorClients) == 0 {
+			delete(orgVisitors, client.visitor)
+		}
+		if len(orgVisitors) == 0 {
+			delete(h.visitors, client.organizationID)
+		}
+	}
+
+	h.log.Debug("Web chat visitor unregistered", "org_id", client.organizationID)
+}
+
 // broadcastMessage sends a message to all relevant clients
 func (h *Hub) broadcastMessage(msg BroadcastMessage) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
+	// Web chat visitors only get what is addressed to them
+	if msg.Visitor != "" {
+		h.broadcastToVisitor(msg)
+		return
+	}
+
 	orgClients, ok := h.clients[msg.OrgID]
 	if !ok {
 		return
@@ -168,6 +233,28 @@ func (h *Hub) broadcastMessage(msg BroadcastMessage) {
 	}
 }
 
+// broadcastToVisitor sends a message to the clients of a web chat visitor. Must be
+// called with mu held.
+func (h *Hub) broadcastToVisitor(msg BroadcastMessage) {
+	visitorClients, ok := h.visitors[msg.OrgID][msg.Visitor]
+	if !ok {
+		return
+	}
+
+	data, err := json.Marshal(msg.Message)
+	if err != nil {
+		h.log.Error("Failed to marshal broadcast message", "error", err)
+		return
+	}
+	for client := range visitorClients {
+		select {
+		case client.send <- data:
+		default:
+			h.log.Warn("Visitor send buffer full, skipping", "org_id", client.organizationID)
+		}
+	}
+}
+
 // Broadcast sends a message to the broadcast channel
 func (h *Hub) Broadcast(msg BroadcastMessage) {
 	select {
@@ -203,6 +290,16 @@ func (h *Hub) BroadcastToUser(orgID, userID uuid.UUID, msg WSMessage) {
 	})
 }
 
+// BroadcastToVisitor sends a message to the web chat visitor chatting as the contact
+// with the phone number
+func (h *Hub) BroadcastToVisitor(orgID uuid.UUID, phoneNumber string, msg WSMessage) {
+	h.Broadcast(BroadcastMessage{
+		OrgID:   orgID,
+		Visitor: phoneNumber,
+		Message: msg,
+	})
+}
+
 // BroadcastToUsers sends a message to multiple users
 func (h *Hub) BroadcastToUsers(orgID uuid.UUID, userIDs []uuid.UUID, msg WSMessage) {
 	for _, userID := range userIDs {
@@ -13,6 +13,7 @@ const (
 	TypeNewMessage    = "new_message"
 	TypeStatusUpdate  = "status_update"
 	TypeContactUpdate = "contact_update"
+	TypeMessageUpdate = "message_update"
 	TypeSetContact    = "set_contact"
 	TypePing          = "ping"
 	TypePong          = "pong"
@@ -21,12 +22,33 @@ const (
 	TypeAgentTransfer       = "agent_transfer"
 	TypeAgentTransferResume = "agent_transfer_resume"
 	TypeAgentTransferAssign = "agent_transfer_assign"
+	TypeSLAAtRisk           = "sla_at_risk"
+	TypeSLABreached         = "sla_breached"
+
+	// Chatbot session types
+	TypeSessionUpdate  = "session_update"
+	TypeSentimentAlert = "sentiment_alert"
+	TypeSessionNote    = "session_note"
+	TypeNoteMention    = "note_mention"
 
 	// Campaign types
 	TypeCampaignStatsUpdate = "campaign_stats_update"
 
+	// Follow-up types
+	TypeFollowUpDue = "follow_up_due"
+
+	// Appointment types
+	TypeAppointmentUpdate = "appointment_update"
+
+	// Group types
+	TypeGroupMessage = "group_message"
+
 	// Permission types
 	TypePermissionsUpdated = "permissions_updated"
+
+	// Web chat visitor types
+	TypeWebChatMessage = "webchat_message"
+	TypeWebChatTyping  = "webchat_typing"
 )
 
 // BroadcastMessage represents a message to be broadcast to clients
@@ -34,6 +56,7 @@ type BroadcastMessage struct {
 	OrgID     uuid.UUID
 	UserID    uuid.UUID // Optional: only send to specific user
 	ContactID uuid.UUID // Optional: only send to users viewing this contact
+	Visitor   string    // Optional: only send to the web chat visitor with this contact phone number
 	Message   WSMessage
 }
 
@@ -2,8 +2,11 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,9 +15,12 @@ import (
 	"github.com/shridarpatil/whatomate/internal/config"
 	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/shridarpatil/whatomate/internal/queue"
+	"github.com/shridarpatil/whatomate/internal/tracing"
 	"github.com/shridarpatil/whatomate/pkg/whatsapp"
 	"github.com/zerodha/logf"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // parameterPattern matches template parameters like {{1}}, {{name}}, {{order_id}}
@@ -52,6 +58,10 @@ type Worker struct {
 	WhatsApp  *whatsapp.Client
 	Consumer  *queue.RedisConsumer
 	Publisher *queue.Publisher
+	Queue     *queue.RedisQueue  // Defers recipients held back by send limits
+	Limiter   *queue.SendLimiter // Per-number send limits, not enforced when nil
+
+	Credentials *config.CredentialSecrets // Resolves access tokens that reference secrets
 }
 
 // Ensure Worker implements JobHandler interface
@@ -66,14 +76,25 @@ func New(cfg *config.Config, db *gorm.DB, rdb *redis.Client, log logf.Logger) (*
 
 	publisher := queue.NewPublisher(rdb, log)
 
+	transport, err := cfg.Outbound.Transport(config.OutboundMeta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure outbound HTTP: %w", err)
+	}
+	waClient := whatsapp.New(log)
+	waClient.HTTPClient.Transport = tracing.Transport(transport)
+
 	return &Worker{
 		Config:    cfg,
 		DB:        db,
 		Redis:     rdb,
 		Log:       log,
-		WhatsApp:  whatsapp.New(log),
+		WhatsApp:  waClient,
 		Consumer:  consumer,
 		Publisher: publisher,
+		Queue:     queue.NewRedisQueue(rdb, log),
+		Limiter:   queue.NewSendLimiter(rdb),
+
+		Credentials: config.NewCredentialSecrets(cfg),
 	}, nil
 }
 
@@ -154,6 +175,12 @@ func (w *Worker) Run(ctx context.Context) error {
 
 // HandleRecipientJob processes a single recipient message job
 func (w *Worker) HandleRecipientJob(ctx context.Context, job *queue.RecipientJob) error {
+	ctx, span := tracing.Start(ctx, "campaign.send",
+		attribute.String("campaign.id", job.CampaignID.String()),
+		attribute.Int("campaign.attempt", max(job.Attempts, 1)),
+	)
+	defer span.End()
+
 	// Check if campaign is still active before sending
 	var campaign models.BulkMessageCampaign
 	if err := w.DB.Where("id = ?", job.CampaignID).Preload("Template").First(&campaign).Error; err != nil {
@@ -167,12 +194,24 @@ func (w *Worker) HandleRecipientJob(ctx context.Context, job *queue.RecipientJob
 		return nil // Not an error, just skip
 	}
 
+	// A/B tested campaigns send the recipient's variant
+	template, headerMediaID := campaign.Template, campaign.HeaderMediaID
+	if job.VariantID != nil {
+		var variant models.CampaignVariant
+		if err := w.DB.Where("id = ? AND campaign_id = ?", *job.VariantID, job.CampaignID).Preload("Template").First(&variant).Error; err != nil {
+			w.Log.Error("Failed to load campaign variant", "error", err, "variant_id", *job.VariantID)
+			return fmt.Errorf("failed to load campaign variant: %w", err)
+		}
+		template, headerMediaID = variant.Template, variant.HeaderMediaID
+	}
+
 	// Get WhatsApp account
 	var account models.WhatsAppAccount
 	if err := w.DB.Where("name = ? AND organization_id = ?", campaign.WhatsAppAccount, job.OrganizationID).First(&account).Error; err != nil {
 		w.Log.Error("Failed to load WhatsApp account", "error", err, "account_name", campaign.WhatsAppAccount)
 		w.updateRecipientStatus(job.RecipientID, models.MessageStatusFailed, "", "WhatsApp account not found")
 		w.incrementCampaignCount(job.CampaignID, "failed_count")
+		w.recordDeadLetter(job, errors.New("WhatsApp account not found"))
 		return nil // Don't retry, mark as failed
 	}
 
@@ -182,9 +221,33 @@ func (w *Worker) HandleRecipientJob(ctx context.Context, job *queue.RecipientJob
 		w.Log.Error("Failed to get or create contact", "error", err, "phone", job.PhoneNumber)
 		w.updateRecipientStatus(job.RecipientID, models.MessageStatusFailed, "", "Failed to create contact")
 		w.incrementCampaignCount(job.CampaignID, "failed_count")
+		w.recordDeadLetter(job, errors.New("failed to create contact"))
 		return nil // Don't retry
 	}
 
+	// Contacts who opted out after being added to the campaign aren't sent to
+	if contact.OptInStatus == models.ContactOptInStatusOptedOut {
+		w.Log.Info("Contact opted out, skipping recipient", "campaign_id", job.CampaignID, "recipient_id", job.RecipientID)
+		w.updateRecipientStatus(job.RecipientID, models.MessageStatusFailed, "", "Contact has opted out")
+		w.incrementCampaignCount(job.CampaignID, "failed_count")
+		w.checkCampaignCompletion(ctx, job.CampaignID, job.OrganizationID)
+		return nil
+	}
+
+	// Hold the send until the organization's fair-use quotas reset
+	if held, err := w.holdForFairUseQuota(ctx, job); err != nil || held {
+		return err
+	}
+
+	// Hold the send to the number's throughput and messaging limit tier
+	deferred, err := w.waitForSendSlot(ctx, &account, job)
+	if err != nil {
+		return err
+	}
+	if deferred {
+		return nil
+	}
+
 	// Build recipient for sending
 	recipient := &models.BulkMessageRecipient{
 		PhoneNumber:    job.PhoneNumber,
@@ -193,7 +256,10 @@ func (w *Worker) HandleRecipientJob(ctx context.Context, job *queue.RecipientJob
 	}
 
 	// Send template message
-	waMessageID, err := w.sendTemplateMessage(ctx, &account, campaign.Template, recipient, campaign.HeaderMediaID)
+	waMessageID, err := w.sendTemplateMessage(ctx, &account, template, recipient, headerMediaID)
+	if err != nil && w.retrySend(ctx, job, err) {
+		return nil
+	}
 
 	// Create Message record
 	message := models.Message{
@@ -209,9 +275,12 @@ func (w *Worker) HandleRecipientJob(ctx context.Context, job *queue.RecipientJob
 			"recipient_name": job.RecipientName,
 		},
 	}
-	if campaign.Template != nil {
-		message.TemplateName = campaign.Template.Name
-		content := replaceTemplateContent(campaign.Template, campaign.Template.BodyContent, job.TemplateParams)
+	if job.VariantID != nil {
+		message.Metadata["variant_id"] = job.VariantID.String()
+	}
+	if template != nil {
+		message.TemplateName = template.Name
+		content := replaceTemplateContent(template, template.BodyContent, job.TemplateParams)
 		message.Content = content
 	}
 
@@ -220,12 +289,19 @@ func (w *Worker) HandleRecipientJob(ctx context.Context, job *queue.RecipientJob
 		message.Status = models.MessageStatusFailed
 		message.ErrorMessage = err.Error()
 		w.updateRecipientStatus(job.RecipientID, models.MessageStatusFailed, "", err.Error())
+		var apiErr *whatsapp.APIError
+		if errors.As(err, &apiErr) && apiErr.Code != 0 {
+			message.ErrorCode = apiErr.Code
+			w.DB.Model(&models.BulkMessageRecipient{}).Where("id = ?", job.RecipientID).Update("error_code", apiErr.Code)
+		}
 		w.incrementCampaignCount(job.CampaignID, "failed_count")
+		w.recordDeadLetter(job, err)
 	} else {
 		w.Log.Info("Message sent", "recipient", job.PhoneNumber, "message_id", waMessageID)
 		message.Status = models.MessageStatusSent
 		w.updateRecipientStatus(job.RecipientID, models.MessageStatusSent, waMessageID, "")
 		w.incrementCampaignCount(job.CampaignID, "sent_count")
+		w.recordMessageUsage(job.OrganizationID)
 	}
 
 	// Save message record
@@ -239,6 +315,178 @@ func (w *Worker) HandleRecipientJob(ctx context.Context, job *queue.RecipientJob
 	return nil
 }
 
+// maxSendSlotSleep is the longest a worker sleeps for a send slot. Longer waits, like a
+// number at its messaging limit tier, defer the recipient so the worker moves on.
+const maxSendSlotSleep = 2 * time.Second
+
+// waitForSendSlot waits until the number's limits allow sending to the recipient. It
+// reports whether the job was deferred to be retried later instead.
+func (w *Worker) waitForSendSlot(ctx context.Context, account *models.WhatsAppAccount, job *queue.RecipientJob) (bool, error) {
+	limits := queue.AccountSendLimits(account)
+	for {
+		wait, err := w.Limiter.Reserve(ctx, account.PhoneID, job.PhoneNumber, limits)
+		if err != nil {
+			// Meta enforces the limits too, so a failed check doesn't hold up the campaign
+			w.Log.Warn("Failed to check send limit", "error", err, "account", account.Name)
+			return false, nil
+		}
+		if wait == 0 {
+			return false, nil
+		}
+
+		if wait > maxSendSlotSleep && w.Queue != nil {
+			err := w.Queue.EnqueueRecipientAt(ctx, job, time.Now().Add(wait))
+			if err == nil {
+				w.Log.Info("Number at its send limit, deferring recipient",
+					"account", account.Name, "campaign_id", job.CampaignID, "recipient_id", job.RecipientID, "retry_in", wait.Round(time.Second))
+				return true, nil
+			}
+			w.Log.Error("Failed to defer recipient", "error", err, "recipient_id", job.RecipientID)
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(min(wait, maxSendSlotSleep)):
+		}
+	}
+}
+
+// holdForFairUseQuota defers a recipient while the organization is at its daily or
+// monthly fair-use message quota, until the quota resets. It reports whether the
+// recipient was held.
+func (w *Worker) holdForFairUseQuota(ctx context.Context, job *queue.RecipientJob) (bool, error) {
+	resumeAt, limit := w.fairUseQuotaReset(job.OrganizationID, time.Now())
+	if resumeAt.IsZero() {
+		return false, nil
+	}
+
+	reason := fmt.Sprintf("Fair-use quota of %d messages reached", limit)
+	if w.Queue != nil {
+		err := w.Queue.EnqueueRecipientAt(ctx, job, resumeAt)
+		if err == nil {
+			w.Log.Info("Organization at its fair-use quota, deferring recipient",
+				"org_id", job.OrganizationID, "campaign_id", job.CampaignID, "recipient_id", job.RecipientID, "resume_at", resumeAt)
+			return true, nil
+		}
+		w.Log.Error("Failed to defer recipient", "error", err, "recipient_id", job.RecipientID)
+	}
+
+	w.updateRecipientStatus(job.RecipientID, models.MessageStatusFailed, "", reason)
+	w.incrementCampaignCount(job.CampaignID, "failed_count")
+	w.recordDeadLetter(job, errors.New(reason))
+	w.checkCampaignCompletion(ctx, job.CampaignID, job.OrganizationID)
+	return true, nil
+}
+
+// fairUseQuotaReset returns when the organization's fair-use message quotas allow
+// sending again and the quota that was reached, or the zero time if sending is allowed now
+func (w *Worker) fairUseQuotaReset(orgID uuid.UUID, now time.Time) (time.Time, int64) {
+	var org models.Organization
+	if err := w.DB.Select("quota_daily_messages", "quota_monthly_messages").Where("id = ?", orgID).First(&org).Error; err != nil {
+		w.Log.Error("Failed to load organization quotas", "error", err, "org_id", orgID)
+		return time.Time{}, 0
+	}
+	var defaults models.FairUseQuotas
+	if w.Config != nil {
+		defaults = models.FairUseQuotas(w.Config.Quotas)
+	}
+	quotas := org.Quotas.WithDefaults(defaults)
+	if quotas.DailyMessages == 0 && quotas.MonthlyMessages == 0 {
+		return time.Time{}, 0
+	}
+
+	day, month := now.UTC().Format("2006-01-02"), now.UTC().Format("2006-01")
+	var counters []models.UsageCounter
+	w.DB.Where("organization_id = ? AND metric = ? AND period IN ?", orgID, models.UsageMetricMessages, []string{day, month}).
+		Find(&counters)
+
+	var resumeAt time.Time
+	var limit int64
+	for _, counter := range counters {
+		year, mon, d := now.UTC().Date()
+		switch {
+		case counter.Period == month && quotas.MonthlyMessages > 0 && counter.Value >= quotas.MonthlyMessages:
+			// The monthly quota outlasts the daily one
+			return time.Date(year, mon+1, 1, 0, 0, 0, 0, time.UTC), quotas.MonthlyMessages
+		case counter.Period == day && quotas.DailyMessages > 0 && counter.Value >= quotas.DailyMessages:
+			resumeAt, limit = time.Date(year, mon, d+1, 0, 0, 0, 0, time.UTC), quotas.DailyMessages
+		}
+	}
+	return resumeAt, limit
+}
+
+// maxSendAttempts is how many times a campaign message is sent before it fails
+const maxSendAttempts = 3
+
+// sendRetryDelay is how long the first retry of a failed send waits. Each later retry
+// waits four times longer.
+const sendRetryDelay = 30 * time.Second
+
+// transientErrorCodes are Meta error codes for failures that go away on their own,
+// as opposed to a problem with the message or the recipient
+var transientErrorCodes = map[int]bool{
+	1:      true, // API unknown error
+	2:      true, // API service temporarily unavailable
+	4:      true, // Application request limit reached
+	80007:  true, // Business account rate limit reached
+	130429: true, // Cloud API throughput reached
+	131016: true, // Service overloaded
+}
+
+// isTransientSendError reports whether a failed send is worth retrying. Errors that
+// aren't from the API, like timeouts, are retried too.
+func isTransientSendError(err error) bool {
+	var apiErr *whatsapp.APIError
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	return transientErrorCodes[apiErr.Code] || apiErr.StatusCode >= 500
+}
+
+// retrySend defers a job whose send failed for a transient reason, reporting whether
+// it will be tried again
+func (w *Worker) retrySend(ctx context.Context, job *queue.RecipientJob, sendErr error) bool {
+	if w.Queue == nil || job.Attempts+1 >= maxSendAttempts || !isTransientSendError(sendErr) {
+		return false
+	}
+
+	retry := *job
+	retry.Attempts++
+	delay := sendRetryDelay << (2 * (retry.Attempts - 1))
+	if err := w.Queue.EnqueueRecipientAt(ctx, &retry, time.Now().Add(delay)); err != nil {
+		w.Log.Error("Failed to defer recipient for retry", "error", err, "recipient_id", job.RecipientID)
+		return false
+	}
+	w.Log.Warn("Send failed, retrying later", "error", sendErr, "recipient_id", job.RecipientID,
+		"attempt", retry.Attempts, "retry_in", delay)
+	return true
+}
+
+// recordDeadLetter keeps a recipient whose send failed for good, so admins can retry it
+func (w *Worker) recordDeadLetter(job *queue.RecipientJob, sendErr error) {
+	var payload models.JSONB
+	data, _ := json.Marshal(job)
+	_ = json.Unmarshal(data, &payload)
+
+	letter := models.DeadLetter{
+		OrganizationID: job.OrganizationID,
+		Kind:           models.DeadLetterKindCampaignMessage,
+		ReferenceID:    &job.RecipientID,
+		Payload:        payload,
+		Error:          sendErr.Error(),
+		Attempts:       job.Attempts + 1,
+		Status:         models.DeadLetterStatusPending,
+	}
+	var apiErr *whatsapp.APIError
+	if errors.As(sendErr, &apiErr) {
+		letter.ErrorCode = apiErr.Code
+	}
+	if err := w.DB.Create(&letter).Error; err != nil {
+		w.Log.Error("Failed to record dead letter", "error", err, "recipient_id", job.RecipientID)
+	}
+}
+
 // updateRecipientStatus updates the recipient's status in the database
 func (w *Worker) updateRecipientStatus(recipientID uuid.UUID, status models.MessageStatus, waMessageID, errorMsg string) {
 	updates := map[string]interface{}{
@@ -261,6 +509,29 @@ func (w *Worker) incrementCampaignCount(campaignID uuid.UUID, column string) {
 		Update(column, gorm.Expr(column+" + 1"))
 }
 
+// recordMessageUsage adds a sent message to the organization's monthly usage, and to
+// its daily usage for fair-use quotas. Plan limits are checked when the campaign is started.
+func (w *Worker) recordMessageUsage(orgID uuid.UUID) {
+	now := time.Now()
+	for _, period := range []string{now.UTC().Format("2006-01"), now.UTC().Format("2006-01-02")} {
+		counter := models.UsageCounter{
+			OrganizationID: orgID,
+			Period:         period,
+			Metric:         models.UsageMetricMessages,
+			Value:          1,
+		}
+		if err := w.DB.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "organization_id"}, {Name: "period"}, {Name: "metric"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"value":      gorm.Expr("usage_counters.value + 1"),
+				"updated_at": now,
+			}),
+		}).Create(&counter).Error; err != nil {
+			w.Log.Error("Failed to record message usage", "error", err, "org_id", orgID, "period", period)
+		}
+	}
+}
+
 // publishCampaignStats publishes campaign stats for real-time updates
 func (w *Worker) publishCampaignStats(ctx context.Context, campaignID, organizationID uuid.UUID) {
 	var campaign models.BulkMessageCampaign
@@ -323,13 +594,33 @@ func (w *Worker) checkCampaignCompletion(ctx context.Context, campaignID, organi
 	}
 }
 
-// sendTemplateMessage sends a template message via WhatsApp Cloud API
+// sendTemplateMessage sends a template message through the number's WhatsApp API
 func (w *Worker) sendTemplateMessage(ctx context.Context, account *models.WhatsAppAccount, template *models.Template, recipient *models.BulkMessageRecipient, campaignHeaderMediaID string) (string, error) {
+	accessToken := account.AccessToken
+	if config.IsSecretReference(accessToken) && w.Credentials != nil {
+		token, err := w.Credentials.Resolve(ctx, account.OrganizationID.String(), accessToken)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve access token: %w", err)
+		}
+		accessToken = token
+	}
+	apiToken := account.APIToken
+	if config.IsSecretReference(apiToken) && w.Credentials != nil {
+		token, err := w.Credentials.Resolve(ctx, account.OrganizationID.String(), apiToken)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve API token: %w", err)
+		}
+		apiToken = token
+	}
 	waAccount := &whatsapp.Account{
-		PhoneID:     account.PhoneID,
-		BusinessID:  account.BusinessID,
-		APIVersion:  account.APIVersion,
-		AccessToken: account.AccessToken,
+		PhoneID:       account.PhoneID,
+		BusinessID:    account.BusinessID,
+		APIVersion:    account.APIVersion,
+		AccessToken:   accessToken,
+		APIType:       account.APIType,
+		APIURL:        account.APIURL,
+		APIToken:      apiToken,
+		APIAuthHeader: account.APIAuthHeader,
 	}
 
 	// Build template components with parameters
@@ -374,9 +665,39 @@ func (w *Worker) sendTemplateMessage(ctx context.Context, account *models.WhatsA
 		})
 	}
 
+	// Flow buttons carry a token, so the flow's reply can be traced to the campaign
+	components = append(components, flowButtonComponents(template, recipient.ID)...)
+
 	return w.WhatsApp.SendTemplateMessageWithComponents(ctx, waAccount, recipient.PhoneNumber, template.Name, template.Language, components)
 }
 
+// flowButtonComponents returns the button components of a template's flow buttons,
+// with the recipient's flow token
+func flowButtonComponents(template *models.Template, recipientID uuid.UUID) []map[string]interface{} {
+	var components []map[string]interface{}
+	for i, btn := range template.Buttons {
+		btnMap, ok := btn.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if btnType, _ := btnMap["type"].(string); !strings.EqualFold(btnType, "FLOW") {
+			continue
+		}
+		components = append(components, map[string]interface{}{
+			"type":     "button",
+			"sub_type": "flow",
+			"index":    strconv.Itoa(i),
+			"parameters": []map[string]interface{}{{
+				"type": "action",
+				"action": map[string]interface{}{
+					"flow_token": "campaign_" + recipientID.String(),
+				},
+			}},
+		})
+	}
+	return components
+}
+
 // buildMediaParameterWithID creates a media parameter using Meta's media ID
 func buildMediaParameterWithID(headerType, mediaID string) map[string]interface{} {
 	switch headerType {
@@ -469,6 +790,7 @@ func (w *Worker) getOrCreateContact(orgID uuid.UUID, phoneNumber, name string) (
 		OrganizationID: orgID,
 		PhoneNumber:    normalizedPhone,
 		ProfileName:    name,
+		Timezone:       models.TimezoneForPhoneNumber(normalizedPhone),
 	}
 	if err := w.DB.Create(&contact).Error; err != nil {
 		return nil, fmt.Errorf("failed to create contact: %w", err)
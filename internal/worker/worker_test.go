@@ -1013,3 +1013,29 @@ func TestReplaceTemplateContent_NoParams(t *testing.T) {
 
 	assert.Equal(t, "Hello, your order is ready!", result)
 }
+
+func TestFlowButtonComponents(t *testing.T) {
+	recipientID := uuid.New()
+	template := &models.Template{
+		Buttons: models.JSONBArray{
+			map[string]interface{}{"type": "QUICK_REPLY", "text": "Not now"},
+			map[string]interface{}{"type": "FLOW", "text": "Book a visit", "flow_id": "1234567890"},
+		},
+	}
+
+	components := flowButtonComponents(template, recipientID)
+	require.Len(t, components, 1)
+	assert.Equal(t, "flow", components[0]["sub_type"])
+	assert.Equal(t, "1", components[0]["index"])
+	params := components[0]["parameters"].([]map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"flow_token": "campaign_" + recipientID.String()}, params[0]["action"])
+
+	assert.Empty(t, flowButtonComponents(&models.Template{}, recipientID))
+}
+
+func TestIsTransientSendError(t *testing.T) {
+	assert.True(t, isTransientSendError(&whatsapp.APIError{Code: 130429}), "throughput reached")
+	assert.True(t, isTransientSendError(&whatsapp.APIError{StatusCode: 503}), "server error")
+	assert.True(t, isTransientSendError(context.DeadlineExceeded), "timeout")
+	assert.False(t, isTransientSendError(&whatsapp.APIError{StatusCode: 400, Code: 131026}), "undeliverable")
+}
@@ -0,0 +1,239 @@
+package crm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zerodha/logf"
+)
+
+const (
+	// DefaultTimeout for HTTP requests
+	DefaultTimeout = 30 * time.Second
+	// HubSpotBaseURL for the HubSpot API
+	HubSpotBaseURL = "https://api.hubapi.com"
+	// SalesforceAPIVersion of the Salesforce REST API
+	SalesforceAPIVersion = "v59.0"
+)
+
+// Provider is a CRM contacts are synced with
+type Provider string
+
+const (
+	ProviderHubSpot    Provider = "hubspot"
+	ProviderSalesforce Provider = "salesforce"
+)
+
+// ErrContactNotFound is returned when a contact isn't in the CRM
+var ErrContactNotFound = errors.New("contact not found")
+
+// Credentials authorize calls to a CRM. HubSpot uses the access token of a private
+// app, Salesforce the consumer key and secret of a connected app with the client
+// credentials flow enabled.
+type Credentials struct {
+	AccessToken  string
+	InstanceURL  string // Salesforce My Domain URL, e.g. https://acme.my.salesforce.com
+	ClientID     string
+	ClientSecret string
+}
+
+// Contact is a contact to push to a CRM
+type Contact struct {
+	Name   string            // Only set on contacts created
+	Phone  string            // E.164 format, contacts are matched by it
+	Fields map[string]string // Values by CRM field name
+}
+
+// Note is a note logged on a CRM contact, such as a conversation summary
+type Note struct {
+	Subject string
+	Body    string
+	At      time.Time
+}
+
+// APIError is an error answered by a CRM's API
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("API error %s: %s", e.Code, e.Message)
+}
+
+// Client syncs contacts with the supported CRMs
+type Client struct {
+	HTTPClient *http.Client
+	Log        logf.Logger
+	hubspotURL string // For testing with mock servers
+
+	mu     sync.Mutex
+	tokens map[string]salesforceToken // Salesforce access tokens by instance and client ID
+}
+
+// New creates a new CRM client
+func New(log logf.Logger) *Client {
+	return NewWithBaseURL(log, HubSpotBaseURL)
+}
+
+// NewWithBaseURL creates a new CRM client with a custom HubSpot base URL (for
+// testing). Salesforce calls go to the credentials' instance URL.
+func NewWithBaseURL(log logf.Logger, hubspotURL string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:        log,
+		hubspotURL: hubspotURL,
+		tokens:     make(map[string]salesforceToken),
+	}
+}
+
+// Check verifies the credentials can read the CRM's contacts
+func (c *Client) Check(ctx context.Context, provider Provider, creds Credentials) error {
+	var err error
+	switch provider {
+	case ProviderHubSpot:
+		err = c.checkHubSpot(ctx, creds)
+	case ProviderSalesforce:
+		err = c.checkSalesforce(ctx, creds)
+	default:
+		return fmt.Errorf("unsupported CRM: %s", provider)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read contacts: %w", err)
+	}
+	return nil
+}
+
+// PushContact creates or updates a contact and returns its ID in the CRM. With an
+// ID, that contact is updated. Without one, or if it was deleted, the contact with
+// the same phone number is, or a new one is created.
+func (c *Client) PushContact(ctx context.Context, provider Provider, creds Credentials, id string, contact Contact) (string, error) {
+	var p pusher
+	switch provider {
+	case ProviderHubSpot:
+		p = hubspotPusher{c, creds}
+	case ProviderSalesforce:
+		p = salesforcePusher{c, creds}
+	default:
+		return "", fmt.Errorf("unsupported CRM: %s", provider)
+	}
+
+	if id != "" {
+		err := p.update(ctx, id, contact.Fields)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, ErrContactNotFound) {
+			return "", fmt.Errorf("failed to update contact: %w", err)
+		}
+	}
+
+	id, err := p.find(ctx, contact.Phone)
+	switch {
+	case err == nil:
+		if err := p.update(ctx, id, contact.Fields); err != nil {
+			return "", fmt.Errorf("failed to update contact: %w", err)
+		}
+		return id, nil
+	case !errors.Is(err, ErrContactNotFound):
+		return "", fmt.Errorf("failed to find contact: %w", err)
+	}
+
+	if id, err = p.create(ctx, contact); err != nil {
+		return "", fmt.Errorf("failed to create contact: %w", err)
+	}
+	return id, nil
+}
+
+// GetContact returns fields of a contact, by CRM field name. Empty fields are left
+// out.
+func (c *Client) GetContact(ctx context.Context, provider Provider, creds Credentials, id string, fields []string) (map[string]string, error) {
+	var values map[string]string
+	var err error
+	switch provider {
+	case ProviderHubSpot:
+		values, err = c.getHubSpotContact(ctx, creds, id, fields)
+	case ProviderSalesforce:
+		values, err = c.getSalesforceContact(ctx, creds, id, fields)
+	default:
+		return nil, fmt.Errorf("unsupported CRM: %s", provider)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contact: %w", err)
+	}
+	return values, nil
+}
+
+// AddNote logs a note on a contact: a note in HubSpot, a completed task in
+// Salesforce
+func (c *Client) AddNote(ctx context.Context, provider Provider, creds Credentials, id string, note Note) error {
+	var err error
+	switch provider {
+	case ProviderHubSpot:
+		err = c.addHubSpotNote(ctx, creds, id, note)
+	case ProviderSalesforce:
+		err = c.addSalesforceTask(ctx, creds, id, note)
+	default:
+		return fmt.Errorf("unsupported CRM: %s", provider)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add note: %w", err)
+	}
+	return nil
+}
+
+// pusher finds, creates and updates a CRM's contacts
+type pusher interface {
+	find(ctx context.Context, phone string) (string, error)
+	create(ctx context.Context, contact Contact) (string, error)
+	update(ctx context.Context, id string, fields map[string]string) error
+}
+
+// splitName splits a full name into first and last names
+func splitName(name string) (string, string) {
+	name = strings.TrimSpace(name)
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return "", name
+	}
+	return strings.TrimSpace(name[:i]), name[i+1:]
+}
+
+// do performs an API request and decodes the response into result, if any.
+// errorOf extracts the error of a failed response.
+func (c *Client) do(req *http.Request, result interface{}, errorOf func(status int, body []byte) *APIError) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return errorOf(resp.StatusCode, respBody)
+	}
+	if result == nil || len(respBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
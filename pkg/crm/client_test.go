@@ -0,0 +1,166 @@
+package crm_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/pkg/crm"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_PushContact_HubSpot(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /crm/v3/objects/contacts/search", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer pat-test", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"results":[]}`))
+	})
+	mux.HandleFunc("POST /crm/v3/objects/contacts", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Properties map[string]string `json:"properties"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]string{
+			"firstname": "Ana Maria",
+			"lastname":  "Lopez",
+			"phone":     "+15551234567",
+			"plan":      "gold",
+		}, body.Properties)
+		_, _ = w.Write([]byte(`{"id":"101"}`))
+	})
+	mux.HandleFunc("PATCH /crm/v3/objects/contacts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "gone" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"status":"error","message":"resource not found","category":"OBJECT_NOT_FOUND"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"` + r.PathValue("id") + `"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := crm.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	creds := crm.Credentials{AccessToken: "pat-test"}
+	contact := crm.Contact{Name: "Ana Maria Lopez", Phone: "+15551234567", Fields: map[string]string{"plan": "gold"}}
+
+	id, err := client.PushContact(context.Background(), crm.ProviderHubSpot, creds, "", contact)
+	require.NoError(t, err)
+	assert.Equal(t, "101", id)
+
+	id, err = client.PushContact(context.Background(), crm.ProviderHubSpot, creds, "101", contact)
+	require.NoError(t, err)
+	assert.Equal(t, "101", id)
+
+	// Contacts deleted in the CRM are created again
+	id, err = client.PushContact(context.Background(), crm.ProviderHubSpot, creds, "gone", contact)
+	require.NoError(t, err)
+	assert.Equal(t, "101", id)
+}
+
+func TestClient_GetContact_HubSpot(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/crm/v3/objects/contacts/101", r.URL.Path)
+		assert.Equal(t, "lifecyclestage,plan", r.URL.Query().Get("properties"))
+		_, _ = w.Write([]byte(`{"id":"101","properties":{"lifecyclestage":"customer","plan":null}}`))
+	}))
+	defer server.Close()
+
+	client := crm.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	values, err := client.GetContact(context.Background(), crm.ProviderHubSpot, crm.Credentials{AccessToken: "pat-test"}, "101", []string{"lifecyclestage", "plan"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"lifecyclestage": "customer"}, values)
+}
+
+func TestClient_Salesforce(t *testing.T) {
+	t.Parallel()
+
+	var tokens atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /services/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "key", r.PostForm.Get("client_id"))
+		n := tokens.Add(1)
+		_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","instance_url":"http://%s"}`, n, r.Host)
+	})
+	mux.HandleFunc("GET /services/data/"+crm.SalesforceAPIVersion+"/query", func(w http.ResponseWriter, r *http.Request) {
+		// The first token has expired
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`[{"message":"Session expired or invalid","errorCode":"INVALID_SESSION_ID"}]`))
+			return
+		}
+		assert.Contains(t, r.URL.Query().Get("q"), "MobilePhone = '+15551234567'")
+		_, _ = w.Write([]byte(`{"records":[{"Id":"003A"}]}`))
+	})
+	mux.HandleFunc("PATCH /services/data/"+crm.SalesforceAPIVersion+"/sobjects/Contact/003A", func(w http.ResponseWriter, r *http.Request) {
+		var fields map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&fields))
+		assert.Equal(t, map[string]string{"Plan__c": "gold"}, fields)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /services/data/"+crm.SalesforceAPIVersion+"/sobjects/Contact/003A", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Id":"003A","Score__c":42.5,"VIP__c":true,"Region__c":null}`))
+	})
+	mux.HandleFunc("POST /services/data/"+crm.SalesforceAPIVersion+"/sobjects/Task", func(w http.ResponseWriter, r *http.Request) {
+		var task map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&task))
+		assert.Equal(t, "003A", task["WhoId"])
+		assert.Equal(t, "Completed", task["Status"])
+		assert.Equal(t, "2025-03-04", task["ActivityDate"])
+		_, _ = w.Write([]byte(`{"id":"00T1","success":true}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := crm.New(testutil.NopLogger())
+	creds := crm.Credentials{InstanceURL: server.URL, ClientID: "key", ClientSecret: "secret"}
+	ctx := context.Background()
+
+	id, err := client.PushContact(ctx, crm.ProviderSalesforce, creds, "", crm.Contact{Phone: "+15551234567", Fields: map[string]string{"Plan__c": "gold"}})
+	require.NoError(t, err)
+	assert.Equal(t, "003A", id)
+
+	values, err := client.GetContact(ctx, crm.ProviderSalesforce, creds, id, []string{"Score__c", "VIP__c", "Region__c"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Score__c": "42.5", "VIP__c": "true"}, values)
+
+	require.NoError(t, client.AddNote(ctx, crm.ProviderSalesforce, creds, id, crm.Note{
+		Subject: "WhatsApp conversation",
+		Body:    "Asked about delivery",
+		At:      time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC),
+	}))
+	// The token is renewed once, then reused
+	assert.Equal(t, int32(2), tokens.Load())
+}
+
+func TestClient_APIError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"status":"error","message":"Authentication credentials not found.","category":"INVALID_AUTHENTICATION"}`))
+	}))
+	defer server.Close()
+
+	client := crm.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	err := client.Check(context.Background(), crm.ProviderHubSpot, crm.Credentials{AccessToken: "pat-test"})
+	var apiErr *crm.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, "INVALID_AUTHENTICATION", apiErr.Code)
+
+	err = client.Check(context.Background(), "pipedrive", crm.Credentials{})
+	assert.EqualError(t, err, "unsupported CRM: pipedrive")
+}
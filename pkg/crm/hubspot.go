@@ -0,0 +1,150 @@
+package crm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// hubspotNoteToContact is the HubSpot-defined association of a note to a contact
+const hubspotNoteToContact = 202
+
+// hubspotPusher pushes contacts to HubSpot
+type hubspotPusher struct {
+	c     *Client
+	creds Credentials
+}
+
+// find returns the ID of the contact with a phone or mobile phone number
+func (p hubspotPusher) find(ctx context.Context, phone string) (string, error) {
+	filterGroups := make([]interface{}, 0, 2)
+	for _, property := range []string{"phone", "mobilephone"} {
+		filterGroups = append(filterGroups, map[string]interface{}{
+			"filters": []map[string]string{{"propertyName": property, "operator": "EQ", "value": phone}},
+		})
+	}
+	var resp struct {
+		Results []struct {
+			ID string `json:"id"`
+		} `json:"results"`
+	}
+	body := map[string]interface{}{"filterGroups": filterGroups, "properties": []string{"phone"}, "limit": 1}
+	if err := p.c.hubspot(ctx, p.creds, http.MethodPost, "/crm/v3/objects/contacts/search", body, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Results) == 0 {
+		return "", ErrContactNotFound
+	}
+	return resp.Results[0].ID, nil
+}
+
+func (p hubspotPusher) create(ctx context.Context, contact Contact) (string, error) {
+	properties := make(map[string]string, len(contact.Fields)+3)
+	properties["firstname"], properties["lastname"] = splitName(contact.Name)
+	properties["phone"] = contact.Phone
+	for field, value := range contact.Fields {
+		properties[field] = value
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	body := map[string]interface{}{"properties": properties}
+	if err := p.c.hubspot(ctx, p.creds, http.MethodPost, "/crm/v3/objects/contacts", body, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (p hubspotPusher) update(ctx context.Context, id string, fields map[string]string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	body := map[string]interface{}{"properties": fields}
+	return p.c.hubspot(ctx, p.creds, http.MethodPatch, "/crm/v3/objects/contacts/"+url.PathEscape(id), body, nil)
+}
+
+func (c *Client) checkHubSpot(ctx context.Context, creds Credentials) error {
+	var resp map[string]interface{}
+	return c.hubspot(ctx, creds, http.MethodGet, "/crm/v3/objects/contacts?limit=1", nil, &resp)
+}
+
+func (c *Client) getHubSpotContact(ctx context.Context, creds Credentials, id string, fields []string) (map[string]string, error) {
+	var resp struct {
+		Properties map[string]*string `json:"properties"`
+	}
+	path := "/crm/v3/objects/contacts/" + url.PathEscape(id) + "?" + url.Values{"properties": {strings.Join(fields, ",")}}.Encode()
+	if err := c.hubspot(ctx, creds, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		if v := resp.Properties[field]; v != nil && *v != "" {
+			values[field] = *v
+		}
+	}
+	return values, nil
+}
+
+func (c *Client) addHubSpotNote(ctx context.Context, creds Credentials, id string, note Note) error {
+	body := map[string]interface{}{
+		"properties": map[string]string{
+			"hs_timestamp": note.At.UTC().Format(time.RFC3339),
+			"hs_note_body": note.Subject + "\n\n" + note.Body,
+		},
+		"associations": []interface{}{
+			map[string]interface{}{
+				"to": map[string]string{"id": id},
+				"types": []map[string]interface{}{
+					{"associationCategory": "HUBSPOT_DEFINED", "associationTypeId": hubspotNoteToContact},
+				},
+			},
+		},
+	}
+	var resp map[string]interface{}
+	return c.hubspot(ctx, creds, http.MethodPost, "/crm/v3/objects/notes", body, &resp)
+}
+
+// hubspot performs a HubSpot API request. Contacts that don't exist return
+// ErrContactNotFound.
+func (c *Client) hubspot(ctx context.Context, creds Credentials, method, path string, body, result interface{}) error {
+	if creds.AccessToken == "" {
+		return fmt.Errorf("access token is required")
+	}
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.hubspotURL+path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+creds.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	err = c.do(req, result, hubspotError)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		return ErrContactNotFound
+	}
+	return err
+}
+
+// hubspotError extracts the error of a failed HubSpot response
+func hubspotError(status int, body []byte) *APIError {
+	var resp struct {
+		Category string `json:"category"`
+		Message  string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Message == "" {
+		return &APIError{StatusCode: status, Message: string(body)}
+	}
+	return &APIError{StatusCode: status, Code: resp.Category, Message: resp.Message}
+}
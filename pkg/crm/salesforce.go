@@ -0,0 +1,231 @@
+package crm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// salesforceTokenTTL is how long an access token is reused. Salesforce sessions
+// last at least this long, and a token that expired earlier is renewed.
+const salesforceTokenTTL = 30 * time.Minute
+
+// salesforceToken is an access token of the client credentials flow
+type salesforceToken struct {
+	accessToken string
+	instanceURL string
+	expiresAt   time.Time
+}
+
+// salesforcePusher pushes contacts to Salesforce
+type salesforcePusher struct {
+	c     *Client
+	creds Credentials
+}
+
+// find returns the ID of the contact with a phone or mobile phone number
+func (p salesforcePusher) find(ctx context.Context, phone string) (string, error) {
+	phone = strings.ReplaceAll(strings.ReplaceAll(phone, `\`, `\\`), `'`, `\'`)
+	soql := fmt.Sprintf("SELECT Id FROM Contact WHERE Phone = '%s' OR MobilePhone = '%s' LIMIT 1", phone, phone)
+	var resp struct {
+		Records []struct {
+			ID string `json:"Id"`
+		} `json:"records"`
+	}
+	if err := p.c.salesforce(ctx, p.creds, http.MethodGet, "/query?"+url.Values{"q": {soql}}.Encode(), nil, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Records) == 0 {
+		return "", ErrContactNotFound
+	}
+	return resp.Records[0].ID, nil
+}
+
+func (p salesforcePusher) create(ctx context.Context, contact Contact) (string, error) {
+	fields := make(map[string]string, len(contact.Fields)+3)
+	fields["FirstName"], fields["LastName"] = splitName(contact.Name)
+	if fields["LastName"] == "" {
+		// Required by Salesforce
+		fields["LastName"] = contact.Phone
+	}
+	fields["MobilePhone"] = contact.Phone
+	for field, value := range contact.Fields {
+		fields[field] = value
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := p.c.salesforce(ctx, p.creds, http.MethodPost, "/sobjects/Contact", fields, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (p salesforcePusher) update(ctx context.Context, id string, fields map[string]string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return p.c.salesforce(ctx, p.creds, http.MethodPatch, "/sobjects/Contact/"+url.PathEscape(id), fields, nil)
+}
+
+func (c *Client) checkSalesforce(ctx context.Context, creds Credentials) error {
+	var resp map[string]interface{}
+	soql := "SELECT Id FROM Contact LIMIT 1"
+	return c.salesforce(ctx, creds, http.MethodGet, "/query?"+url.Values{"q": {soql}}.Encode(), nil, &resp)
+}
+
+func (c *Client) getSalesforceContact(ctx context.Context, creds Credentials, id string, fields []string) (map[string]string, error) {
+	var resp map[string]interface{}
+	path := "/sobjects/Contact/" + url.PathEscape(id) + "?" + url.Values{"fields": {strings.Join(fields, ",")}}.Encode()
+	if err := c.salesforce(ctx, creds, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(fields))
+	for _, field := range fields {
+		var value string
+		switch v := resp[field].(type) {
+		case string:
+			value = v
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			value = strconv.FormatBool(v)
+		}
+		if value != "" {
+			values[field] = value
+		}
+	}
+	return values, nil
+}
+
+func (c *Client) addSalesforceTask(ctx context.Context, creds Credentials, id string, note Note) error {
+	task := map[string]string{
+		"WhoId":        id,
+		"Subject":      note.Subject,
+		"Description":  note.Body,
+		"Status":       "Completed",
+		"ActivityDate": note.At.UTC().Format("2006-01-02"),
+	}
+	var resp map[string]interface{}
+	return c.salesforce(ctx, creds, http.MethodPost, "/sobjects/Task", task, &resp)
+}
+
+// salesforce performs a Salesforce REST API request, relative to the API version's
+// path. Records that don't exist return ErrContactNotFound, and an expired access
+// token is renewed once.
+func (c *Client) salesforce(ctx context.Context, creds Credentials, method, path string, body, result interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := c.salesforceToken(ctx, creds)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, token.instanceURL+"/services/data/"+SalesforceAPIVersion+path, bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token.accessToken)
+		req.Header.Set("Content-Type", "application/json")
+
+		err = c.do(req, result, salesforceError)
+		apiErr, ok := err.(*APIError)
+		switch {
+		case ok && apiErr.StatusCode == http.StatusUnauthorized && attempt == 0:
+			c.forgetSalesforceToken(creds)
+			continue
+		case ok && apiErr.StatusCode == http.StatusNotFound:
+			return ErrContactNotFound
+		}
+		return err
+	}
+}
+
+// salesforceToken returns an access token for the credentials, requesting a new one
+// when none is cached
+func (c *Client) salesforceToken(ctx context.Context, creds Credentials) (salesforceToken, error) {
+	if creds.InstanceURL == "" || creds.ClientID == "" || creds.ClientSecret == "" {
+		return salesforceToken{}, fmt.Errorf("instance URL, client ID and client secret are required")
+	}
+	key := creds.InstanceURL + "|" + creds.ClientID
+	c.mu.Lock()
+	token, ok := c.tokens[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(token.expiresAt) {
+		return token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {creds.ClientID},
+		"client_secret": {creds.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(creds.InstanceURL, "/")+"/services/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return salesforceToken{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		InstanceURL string `json:"instance_url"`
+	}
+	if err := c.do(req, &resp, salesforceAuthError); err != nil {
+		return salesforceToken{}, fmt.Errorf("failed to get access token: %w", err)
+	}
+	token = salesforceToken{
+		accessToken: resp.AccessToken,
+		instanceURL: strings.TrimSuffix(resp.InstanceURL, "/"),
+		expiresAt:   time.Now().Add(salesforceTokenTTL),
+	}
+	if token.instanceURL == "" {
+		token.instanceURL = strings.TrimSuffix(creds.InstanceURL, "/")
+	}
+	c.mu.Lock()
+	c.tokens[key] = token
+	c.mu.Unlock()
+	return token, nil
+}
+
+// forgetSalesforceToken drops the cached access token of the credentials
+func (c *Client) forgetSalesforceToken(creds Credentials) {
+	c.mu.Lock()
+	delete(c.tokens, creds.InstanceURL+"|"+creds.ClientID)
+	c.mu.Unlock()
+}
+
+// salesforceError extracts the error of a failed Salesforce response
+func salesforceError(status int, body []byte) *APIError {
+	var errs []struct {
+		ErrorCode string `json:"errorCode"`
+		Message   string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &errs); err != nil || len(errs) == 0 {
+		return &APIError{StatusCode: status, Message: string(body)}
+	}
+	return &APIError{StatusCode: status, Code: errs[0].ErrorCode, Message: errs[0].Message}
+}
+
+// salesforceAuthError extracts the error of a failed Salesforce token request
+func salesforceAuthError(status int, body []byte) *APIError {
+	var resp struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Error == "" {
+		return &APIError{StatusCode: status, Message: string(body)}
+	}
+	return &APIError{StatusCode: status, Code: resp.Error, Message: resp.ErrorDescription}
+}
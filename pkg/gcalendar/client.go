@@ -0,0 +1,241 @@
+package gcalendar
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/zerodha/logf"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// DefaultTimeout for HTTP requests
+	DefaultTimeout = 30 * time.Second
+	// BaseURL for the Google Calendar API
+	BaseURL = "https://www.googleapis.com/calendar/v3"
+	// Scope the service account is authorized with
+	Scope = "https://www.googleapis.com/auth/calendar"
+)
+
+// Client is the Google Calendar API client. Calls are authorized as a service
+// account, which the calendar has to be shared with.
+type Client struct {
+	HTTPClient *http.Client
+	Log        logf.Logger
+	baseURL    string   // For testing with mock servers
+	tokens     sync.Map // Token sources by hash of the service account key
+}
+
+// Period is a span of time on a calendar
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Event is a calendar event
+type Event struct {
+	ID          string
+	Summary     string
+	Description string
+	Start       time.Time
+	End         time.Time
+}
+
+// APIError is an error answered by the Google Calendar API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// New creates a new Google Calendar client
+func New(log logf.Logger) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:     log,
+		baseURL: BaseURL,
+	}
+}
+
+// NewWithBaseURL creates a new Google Calendar client with a custom base URL (for testing)
+func NewWithBaseURL(log logf.Logger, baseURL string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:     log,
+		baseURL: baseURL,
+	}
+}
+
+// ServiceAccountEmail returns the email of a service account key, the address a
+// calendar is shared with
+func ServiceAccountEmail(key []byte) (string, error) {
+	cfg, err := google.JWTConfigFromJSON(key, Scope)
+	if err != nil {
+		return "", fmt.Errorf("invalid service account key: %w", err)
+	}
+	return cfg.Email, nil
+}
+
+// FreeBusy returns the busy periods of a calendar between from and to
+func (c *Client) FreeBusy(ctx context.Context, key []byte, calendarID string, from, to time.Time) ([]Period, error) {
+	body := map[string]interface{}{
+		"timeMin": from.UTC().Format(time.RFC3339),
+		"timeMax": to.UTC().Format(time.RFC3339),
+		"items":   []map[string]string{{"id": calendarID}},
+	}
+	var resp struct {
+		Calendars map[string]struct {
+			Busy   []Period `json:"busy"`
+			Errors []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		} `json:"calendars"`
+	}
+	if err := c.do(ctx, key, http.MethodPost, "/freeBusy", body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to get free/busy: %w", err)
+	}
+	cal, ok := resp.Calendars[calendarID]
+	if !ok {
+		return nil, fmt.Errorf("calendar %s not in free/busy response", calendarID)
+	}
+	if len(cal.Errors) > 0 {
+		// notFound is also returned for calendars not shared with the service account
+		return nil, fmt.Errorf("failed to get free/busy: %s", cal.Errors[0].Reason)
+	}
+	return cal.Busy, nil
+}
+
+// InsertEvent creates an event on a calendar and returns its ID
+func (c *Client) InsertEvent(ctx context.Context, key []byte, calendarID string, event Event) (string, error) {
+	var created struct {
+		ID string `json:"id"`
+	}
+	path := "/calendars/" + url.PathEscape(calendarID) + "/events"
+	if err := c.do(ctx, key, http.MethodPost, path, eventBody(event), &created); err != nil {
+		return "", fmt.Errorf("failed to create event: %w", err)
+	}
+	return created.ID, nil
+}
+
+// UpdateEvent changes the summary, description and times of an event
+func (c *Client) UpdateEvent(ctx context.Context, key []byte, calendarID string, event Event) error {
+	path := "/calendars/" + url.PathEscape(calendarID) + "/events/" + url.PathEscape(event.ID)
+	if err := c.do(ctx, key, http.MethodPatch, path, eventBody(event), nil); err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
+	return nil
+}
+
+// DeleteEvent removes an event from a calendar. Events already deleted are ignored.
+func (c *Client) DeleteEvent(ctx context.Context, key []byte, calendarID, eventID string) error {
+	path := "/calendars/" + url.PathEscape(calendarID) + "/events/" + url.PathEscape(eventID)
+	err := c.do(ctx, key, http.MethodDelete, path, nil, nil)
+	if apiErr, ok := err.(*APIError); ok && (apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusGone) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	return nil
+}
+
+func eventBody(event Event) map[string]interface{} {
+	return map[string]interface{}{
+		"summary":     event.Summary,
+		"description": event.Description,
+		"start":       map[string]string{"dateTime": event.Start.Format(time.RFC3339)},
+		"end":         map[string]string{"dateTime": event.End.Format(time.RFC3339)},
+	}
+}
+
+// tokenSource returns the cached token source of a service account key
+func (c *Client) tokenSource(key []byte) (oauth2.TokenSource, error) {
+	sum := sha256.Sum256(key)
+	hash := hex.EncodeToString(sum[:])
+	if ts, ok := c.tokens.Load(hash); ok {
+		return ts.(oauth2.TokenSource), nil
+	}
+	cfg, err := google.JWTConfigFromJSON(key, Scope)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	// Tokens outlive the request that fetched them, so they're refreshed without its context
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, c.HTTPClient)
+	ts, _ := c.tokens.LoadOrStore(hash, oauth2.ReuseTokenSource(nil, cfg.TokenSource(ctx)))
+	return ts.(oauth2.TokenSource), nil
+}
+
+func (c *Client) do(ctx context.Context, key []byte, method, path string, body, result interface{}) error {
+	ts, err := c.tokenSource(key)
+	if err != nil {
+		return err
+	}
+	token, err := ts.Token()
+	if err != nil {
+		return fmt.Errorf("failed to authorize service account: %w", err)
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		reqBody = bytes.NewReader(jsonBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	token.SetAuthHeader(req)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		msg := string(respBody)
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Message != "" {
+			msg = apiErr.Error.Message
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if result == nil || len(respBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
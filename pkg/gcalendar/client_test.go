@@ -0,0 +1,126 @@
+package gcalendar_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/pkg/gcalendar"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serviceAccountKey returns a service account key whose tokens are issued by tokenURL
+func serviceAccountKey(t *testing.T, tokenURL string) []byte {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	key, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "booking@project.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      tokenURL,
+	})
+	require.NoError(t, err)
+	return key
+}
+
+func TestServiceAccountEmail(t *testing.T) {
+	t.Parallel()
+
+	email, err := gcalendar.ServiceAccountEmail(serviceAccountKey(t, "https://oauth2.googleapis.com/token"))
+	require.NoError(t, err)
+	assert.Equal(t, "booking@project.iam.gserviceaccount.com", email)
+
+	_, err = gcalendar.ServiceAccountEmail([]byte(`{"type":"authorized_user"}`))
+	assert.Error(t, err)
+}
+
+func TestClient_FreeBusyAndEvents(t *testing.T) {
+	t.Parallel()
+
+	tokenRequests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token-1","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/freeBusy", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token-1", r.Header.Get("Authorization"))
+		var body struct {
+			TimeMin string              `json:"timeMin"`
+			Items   []map[string]string `json:"items"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "2025-03-03T09:00:00Z", body.TimeMin)
+		assert.Equal(t, "clinic@example.com", body.Items[0]["id"])
+		_, _ = w.Write([]byte(`{"calendars":{"clinic@example.com":{"busy":[{"start":"2025-03-03T10:00:00Z","end":"2025-03-03T11:00:00Z"}]}}}`))
+	})
+	mux.HandleFunc("/calendars/clinic@example.com/events", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "Consultation", body["summary"])
+		assert.Equal(t, map[string]interface{}{"dateTime": "2025-03-03T09:00:00Z"}, body["start"])
+		_, _ = w.Write([]byte(`{"id":"evt1"}`))
+	})
+	mux.HandleFunc("/calendars/clinic@example.com/events/evt1", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		w.WriteHeader(http.StatusGone)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := gcalendar.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	key := serviceAccountKey(t, server.URL+"/token")
+	from := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+
+	busy, err := client.FreeBusy(context.Background(), key, "clinic@example.com", from, from.Add(8*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, busy, 1)
+	assert.Equal(t, time.Date(2025, 3, 3, 10, 0, 0, 0, time.UTC), busy[0].Start.UTC())
+
+	id, err := client.InsertEvent(context.Background(), key, "clinic@example.com", gcalendar.Event{
+		Summary: "Consultation",
+		Start:   from,
+		End:     from.Add(30 * time.Minute),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "evt1", id)
+
+	// Deleting an event that's already gone succeeds
+	require.NoError(t, client.DeleteEvent(context.Background(), key, "clinic@example.com", "evt1"))
+	// Tokens are reused until they expire
+	assert.Equal(t, 1, tokenRequests)
+}
+
+func TestClient_FreeBusy_CalendarNotShared(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"token-1","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/freeBusy", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"calendars":{"clinic@example.com":{"errors":[{"domain":"global","reason":"notFound"}]}}}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := gcalendar.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	_, err := client.FreeBusy(context.Background(), serviceAccountKey(t, server.URL+"/token"), "clinic@example.com", time.Now(), time.Now().Add(time.Hour))
+	assert.EqualError(t, err, "failed to get free/busy: notFound")
+}
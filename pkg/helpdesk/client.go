@@ -0,0 +1,204 @@
+package helpdesk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zerodha/logf"
+)
+
+// DefaultTimeout for HTTP requests
+const DefaultTimeout = 30 * time.Second
+
+// Provider is a helpdesk tickets are created in
+type Provider string
+
+const (
+	ProviderZendesk   Provider = "zendesk"
+	ProviderFreshdesk Provider = "freshdesk"
+)
+
+// Credentials authorize calls to a helpdesk. Zendesk uses an agent's email and an
+// API token, Freshdesk an agent's API key.
+type Credentials struct {
+	Domain string // e.g. acme.zendesk.com or acme.freshdesk.com
+	Email  string
+	APIKey string
+}
+
+// Priority of a ticket
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent"
+)
+
+// Attachment is a file attached to a ticket
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// TicketRequest is a ticket to create for a customer
+type TicketRequest struct {
+	Subject        string
+	Description    string // Plain text
+	RequesterName  string
+	RequesterPhone string // E.164 format, the requester is found or created by it
+	Priority       Priority
+	Attachment     *Attachment
+}
+
+// Ticket is a created ticket
+type Ticket struct {
+	ID          string
+	RequesterID string // Customer comments are added as this user
+	URL         string // Where agents open the ticket
+}
+
+// APIError is an error answered by a helpdesk's API
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("API error %s: %s", e.Code, e.Message)
+}
+
+// Client creates tickets in the supported helpdesks
+type Client struct {
+	HTTPClient *http.Client
+	Log        logf.Logger
+	baseURL    string // For testing with mock servers, used instead of the helpdesk's URL
+}
+
+// New creates a new helpdesk client
+func New(log logf.Logger) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log: log,
+	}
+}
+
+// NewWithBaseURL creates a new helpdesk client with a custom base URL (for testing)
+func NewWithBaseURL(log logf.Logger, baseURL string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:     log,
+		baseURL: baseURL,
+	}
+}
+
+// Check verifies the credentials can read the helpdesk's tickets
+func (c *Client) Check(ctx context.Context, provider Provider, creds Credentials) error {
+	var err error
+	switch provider {
+	case ProviderZendesk:
+		err = c.checkZendesk(ctx, creds)
+	case ProviderFreshdesk:
+		err = c.checkFreshdesk(ctx, creds)
+	default:
+		return fmt.Errorf("unsupported helpdesk: %s", provider)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read tickets: %w", err)
+	}
+	return nil
+}
+
+// CreateTicket creates a ticket for a customer, found or created by phone number
+func (c *Client) CreateTicket(ctx context.Context, provider Provider, creds Credentials, req TicketRequest) (*Ticket, error) {
+	if req.Subject == "" {
+		return nil, fmt.Errorf("subject is required")
+	}
+	if req.RequesterPhone == "" {
+		return nil, fmt.Errorf("requester phone is required")
+	}
+	if req.RequesterName == "" {
+		req.RequesterName = req.RequesterPhone
+	}
+
+	var ticket *Ticket
+	var err error
+	switch provider {
+	case ProviderZendesk:
+		ticket, err = c.createZendeskTicket(ctx, creds, req)
+	case ProviderFreshdesk:
+		ticket, err = c.createFreshdeskTicket(ctx, creds, req)
+	default:
+		return nil, fmt.Errorf("unsupported helpdesk: %s", provider)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// AddComment adds a public comment to a ticket, as its requester
+func (c *Client) AddComment(ctx context.Context, provider Provider, creds Credentials, ticket *Ticket, body string) error {
+	var err error
+	switch provider {
+	case ProviderZendesk:
+		err = c.addZendeskComment(ctx, creds, ticket, body)
+	case ProviderFreshdesk:
+		err = c.addFreshdeskNote(ctx, creds, ticket, body)
+	default:
+		return fmt.Errorf("unsupported helpdesk: %s", provider)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add comment: %w", err)
+	}
+	return nil
+}
+
+// url returns the URL of an API path of the helpdesk
+func (c *Client) url(creds Credentials, path string) string {
+	if c.baseURL != "" {
+		return c.baseURL + path
+	}
+	return "https://" + strings.TrimSuffix(creds.Domain, "/") + path
+}
+
+// do performs an API request and decodes the response into result. errorOf
+// extracts the error of a failed response.
+func (c *Client) do(req *http.Request, result interface{}, errorOf func(status int, body []byte) *APIError) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return errorOf(resp.StatusCode, respBody)
+	}
+	if result == nil || len(respBody) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
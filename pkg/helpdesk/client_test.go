@@ -0,0 +1,156 @@
+package helpdesk_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/pkg/helpdesk"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ticketRequest = helpdesk.TicketRequest{
+	Subject:        "WhatsApp conversation with Ana",
+	Description:    "Ana is waiting for an agent.\nNotes: <refund>",
+	RequesterName:  "Ana",
+	RequesterPhone: "+15551234567",
+	Priority:       helpdesk.PriorityHigh,
+	Attachment:     &helpdesk.Attachment{Filename: "transcript.txt", ContentType: "text/plain", Content: []byte("[10:00] Ana: hi")},
+}
+
+func TestClient_Zendesk(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v2/users/create_or_update.json", func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "agent@acme.com/token", user)
+		assert.Equal(t, "zd-token", pass)
+		var body struct {
+			User map[string]string `json:"user"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "whatsapp:+15551234567", body.User["external_id"])
+		_, _ = w.Write([]byte(`{"user":{"id":77}}`))
+	})
+	mux.HandleFunc("POST /api/v2/uploads.json", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "transcript.txt", r.URL.Query().Get("filename"))
+		content, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "[10:00] Ana: hi", string(content))
+		_, _ = w.Write([]byte(`{"upload":{"token":"tok_1"}}`))
+	})
+	mux.HandleFunc("POST /api/v2/tickets.json", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Ticket struct {
+				Subject     string `json:"subject"`
+				Priority    string `json:"priority"`
+				RequesterID int64  `json:"requester_id"`
+				Comment     struct {
+					Uploads []string `json:"uploads"`
+				} `json:"comment"`
+			} `json:"ticket"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "high", body.Ticket.Priority)
+		assert.Equal(t, int64(77), body.Ticket.RequesterID)
+		assert.Equal(t, []string{"tok_1"}, body.Ticket.Comment.Uploads)
+		_, _ = w.Write([]byte(`{"ticket":{"id":501}}`))
+	})
+	mux.HandleFunc("PUT /api/v2/tickets/501.json", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Ticket struct {
+				Comment struct {
+					Body     string `json:"body"`
+					AuthorID int64  `json:"author_id"`
+					Public   bool   `json:"public"`
+				} `json:"comment"`
+			} `json:"ticket"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "Any update?", body.Ticket.Comment.Body)
+		assert.Equal(t, int64(77), body.Ticket.Comment.AuthorID)
+		assert.True(t, body.Ticket.Comment.Public)
+		_, _ = w.Write([]byte(`{"ticket":{"id":501}}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := helpdesk.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	creds := helpdesk.Credentials{Domain: "acme.zendesk.com", Email: "agent@acme.com", APIKey: "zd-token"}
+
+	ticket, err := client.CreateTicket(context.Background(), helpdesk.ProviderZendesk, creds, ticketRequest)
+	require.NoError(t, err)
+	assert.Equal(t, &helpdesk.Ticket{ID: "501", RequesterID: "77", URL: "https://acme.zendesk.com/agent/tickets/501"}, ticket)
+
+	require.NoError(t, client.AddComment(context.Background(), helpdesk.ProviderZendesk, creds, ticket, "Any update?"))
+}
+
+func TestClient_Freshdesk(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v2/tickets", func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		assert.Equal(t, "fd-key", user)
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "+15551234567", r.FormValue("phone"))
+		assert.Equal(t, "3", r.FormValue("priority"))
+		assert.Equal(t, "7", r.FormValue("source"))
+		assert.Equal(t, "Ana is waiting for an agent.<br>Notes: &lt;refund&gt;", r.FormValue("description"))
+		files := r.MultipartForm.File["attachments[]"]
+		require.Len(t, files, 1)
+		assert.Equal(t, "transcript.txt", files[0].Filename)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":42,"requester_id":9001}`))
+	})
+	mux.HandleFunc("POST /api/v2/tickets/42/notes", func(w http.ResponseWriter, r *http.Request) {
+		var note map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&note))
+		assert.Equal(t, "Any update?", note["body"])
+		assert.Equal(t, float64(9001), note["user_id"])
+		assert.Equal(t, false, note["private"])
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":1}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := helpdesk.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	creds := helpdesk.Credentials{Domain: "acme.freshdesk.com", APIKey: "fd-key"}
+
+	ticket, err := client.CreateTicket(context.Background(), helpdesk.ProviderFreshdesk, creds, ticketRequest)
+	require.NoError(t, err)
+	assert.Equal(t, &helpdesk.Ticket{ID: "42", RequesterID: "9001", URL: "https://acme.freshdesk.com/a/tickets/42"}, ticket)
+
+	require.NoError(t, client.AddComment(context.Background(), helpdesk.ProviderFreshdesk, creds, ticket, "Any update?"))
+}
+
+func TestClient_APIError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		if r.URL.Path == "/api/v2/tickets.json" {
+			_, _ = w.Write([]byte(`{"error":"Couldn't authenticate you"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":"invalid_credentials","message":"You have to be logged in to perform this action."}`))
+	}))
+	defer server.Close()
+
+	client := helpdesk.NewWithBaseURL(testutil.NopLogger(), server.URL)
+
+	err := client.Check(context.Background(), helpdesk.ProviderZendesk, helpdesk.Credentials{Email: "agent@acme.com", APIKey: "bad"})
+	var apiErr *helpdesk.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "Couldn't authenticate you", apiErr.Message)
+
+	err = client.Check(context.Background(), helpdesk.ProviderFreshdesk, helpdesk.Credentials{APIKey: "bad"})
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "invalid_credentials", apiErr.Code)
+}
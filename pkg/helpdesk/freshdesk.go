@@ -0,0 +1,163 @@
+package helpdesk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Freshdesk ticket values
+const (
+	freshdeskStatusOpen = 2
+	freshdeskSourceChat = 7
+)
+
+// freshdeskPriorities are Freshdesk's priority values
+var freshdeskPriorities = map[Priority]int{
+	PriorityLow:    1,
+	PriorityNormal: 2,
+	PriorityHigh:   3,
+	PriorityUrgent: 4,
+}
+
+// freshdeskHTML turns plain text into the HTML Freshdesk descriptions and notes take
+func freshdeskHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+}
+
+// createFreshdeskTicket creates a Freshdesk ticket. Freshdesk finds or creates the
+// requester by phone number. Attachments are sent as a multipart form.
+func (c *Client) createFreshdeskTicket(ctx context.Context, creds Credentials, req TicketRequest) (*Ticket, error) {
+	priority, ok := freshdeskPriorities[req.Priority]
+	if !ok {
+		priority = freshdeskPriorities[PriorityNormal]
+	}
+	fields := map[string]string{
+		"name":        req.RequesterName,
+		"phone":       req.RequesterPhone,
+		"subject":     req.Subject,
+		"description": freshdeskHTML(req.Description),
+		"status":      strconv.Itoa(freshdeskStatusOpen),
+		"priority":    strconv.Itoa(priority),
+		"source":      strconv.Itoa(freshdeskSourceChat),
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for _, name := range []string{"name", "phone", "subject", "description", "status", "priority", "source"} {
+		if err := form.WriteField(name, fields[name]); err != nil {
+			return nil, fmt.Errorf("failed to write form: %w", err)
+		}
+	}
+	if a := req.Attachment; a != nil {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="attachments[]"; filename=%q`, a.Filename))
+		header.Set("Content-Type", a.ContentType)
+		part, err := form.CreatePart(header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write form: %w", err)
+		}
+		if _, err := part.Write(a.Content); err != nil {
+			return nil, fmt.Errorf("failed to write form: %w", err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write form: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(creds, "/api/v2/tickets"), &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", form.FormDataContentType())
+	httpReq.SetBasicAuth(creds.APIKey, "X")
+
+	var resp struct {
+		ID          int64 `json:"id"`
+		RequesterID int64 `json:"requester_id"`
+	}
+	if err := c.do(httpReq, &resp, freshdeskError); err != nil {
+		return nil, err
+	}
+	id := strconv.FormatInt(resp.ID, 10)
+	return &Ticket{
+		ID:          id,
+		RequesterID: strconv.FormatInt(resp.RequesterID, 10),
+		URL:         "https://" + creds.Domain + "/a/tickets/" + id,
+	}, nil
+}
+
+// addFreshdeskNote adds a public note to a ticket, as its requester
+func (c *Client) addFreshdeskNote(ctx context.Context, creds Credentials, ticket *Ticket, body string) error {
+	note := map[string]interface{}{"body": freshdeskHTML(body), "private": false}
+	if id, err := strconv.ParseInt(ticket.RequesterID, 10, 64); err == nil {
+		note["user_id"] = id
+	}
+	var resp map[string]interface{}
+	return c.freshdesk(ctx, creds, http.MethodPost, "/api/v2/tickets/"+url.PathEscape(ticket.ID)+"/notes", note, &resp)
+}
+
+func (c *Client) checkFreshdesk(ctx context.Context, creds Credentials) error {
+	var resp []map[string]interface{}
+	return c.freshdesk(ctx, creds, http.MethodGet, "/api/v2/tickets?per_page=1", nil, &resp)
+}
+
+// freshdesk performs a Freshdesk API request, authenticated with an API key
+func (c *Client) freshdesk(ctx context.Context, creds Credentials, method, path string, body, result interface{}) error {
+	if creds.APIKey == "" {
+		return fmt.Errorf("API key is required")
+	}
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url(creds, path), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(creds.APIKey, "X")
+	return c.do(req, result, freshdeskError)
+}
+
+// freshdeskError extracts the error of a failed Freshdesk response: a code and
+// message, or validation errors by field
+func freshdeskError(status int, body []byte) *APIError {
+	var resp struct {
+		Code        string `json:"code"`
+		Message     string `json:"message"`
+		Description string `json:"description"`
+		Errors      []struct {
+			Field   string `json:"field"`
+			Message string `json:"message"`
+			Code    string `json:"code"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return &APIError{StatusCode: status, Message: string(body)}
+	}
+	if len(resp.Errors) > 0 {
+		e := resp.Errors[0]
+		msg := e.Message
+		if e.Field != "" {
+			msg = e.Field + ": " + msg
+		}
+		return &APIError{StatusCode: status, Code: e.Code, Message: msg}
+	}
+	if resp.Message != "" {
+		return &APIError{StatusCode: status, Code: resp.Code, Message: resp.Message}
+	}
+	return &APIError{StatusCode: status, Message: string(body)}
+}
@@ -0,0 +1,148 @@
+package helpdesk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// createZendeskTicket finds or creates the requester, uploads the attachment and
+// creates a Zendesk ticket
+func (c *Client) createZendeskTicket(ctx context.Context, creds Credentials, req TicketRequest) (*Ticket, error) {
+	var user struct {
+		User struct {
+			ID int64 `json:"id"`
+		} `json:"user"`
+	}
+	// Requesters are matched by external ID, as they may have no email
+	body := map[string]interface{}{"user": map[string]string{
+		"name":        req.RequesterName,
+		"phone":       req.RequesterPhone,
+		"external_id": "whatsapp:" + req.RequesterPhone,
+		"role":        "end-user",
+	}}
+	if err := c.zendesk(ctx, creds, http.MethodPost, "/api/v2/users/create_or_update.json", body, &user); err != nil {
+		return nil, fmt.Errorf("failed to create requester: %w", err)
+	}
+
+	comment := map[string]interface{}{"body": req.Description, "public": false}
+	if req.Attachment != nil {
+		token, err := c.uploadZendeskAttachment(ctx, creds, req.Attachment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload attachment: %w", err)
+		}
+		comment["uploads"] = []string{token}
+	}
+	ticket := map[string]interface{}{
+		"subject":      req.Subject,
+		"comment":      comment,
+		"requester_id": user.User.ID,
+	}
+	if req.Priority != "" {
+		ticket["priority"] = string(req.Priority)
+	}
+
+	var resp struct {
+		Ticket struct {
+			ID int64 `json:"id"`
+		} `json:"ticket"`
+	}
+	if err := c.zendesk(ctx, creds, http.MethodPost, "/api/v2/tickets.json", map[string]interface{}{"ticket": ticket}, &resp); err != nil {
+		return nil, err
+	}
+	id := strconv.FormatInt(resp.Ticket.ID, 10)
+	return &Ticket{
+		ID:          id,
+		RequesterID: strconv.FormatInt(user.User.ID, 10),
+		URL:         "https://" + creds.Domain + "/agent/tickets/" + id,
+	}, nil
+}
+
+// uploadZendeskAttachment uploads a file and returns the token comments attach it with
+func (c *Client) uploadZendeskAttachment(ctx context.Context, creds Credentials, a *Attachment) (string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.url(creds, "/api/v2/uploads.json?"+url.Values{"filename": {a.Filename}}.Encode()), bytes.NewReader(a.Content))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", a.ContentType)
+	httpReq.SetBasicAuth(creds.Email+"/token", creds.APIKey)
+
+	var resp struct {
+		Upload struct {
+			Token string `json:"token"`
+		} `json:"upload"`
+	}
+	if err := c.do(httpReq, &resp, zendeskError); err != nil {
+		return "", err
+	}
+	return resp.Upload.Token, nil
+}
+
+func (c *Client) addZendeskComment(ctx context.Context, creds Credentials, ticket *Ticket, body string) error {
+	comment := map[string]interface{}{"body": body, "public": true}
+	if id, err := strconv.ParseInt(ticket.RequesterID, 10, 64); err == nil {
+		comment["author_id"] = id
+	}
+	req := map[string]interface{}{"ticket": map[string]interface{}{"comment": comment}}
+	var resp map[string]interface{}
+	return c.zendesk(ctx, creds, http.MethodPut, "/api/v2/tickets/"+url.PathEscape(ticket.ID)+".json", req, &resp)
+}
+
+func (c *Client) checkZendesk(ctx context.Context, creds Credentials) error {
+	var resp map[string]interface{}
+	return c.zendesk(ctx, creds, http.MethodGet, "/api/v2/tickets.json?per_page=1", nil, &resp)
+}
+
+// zendesk performs a Zendesk API request, authenticated with an API token
+func (c *Client) zendesk(ctx context.Context, creds Credentials, method, path string, body, result interface{}) error {
+	if creds.Email == "" || creds.APIKey == "" {
+		return fmt.Errorf("email and API token are required")
+	}
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url(creds, path), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(creds.Email+"/token", creds.APIKey)
+	return c.do(req, result, zendeskError)
+}
+
+// zendeskError extracts the error of a failed Zendesk response. The error is a
+// code with a description, or an object with a title and message.
+func zendeskError(status int, body []byte) *APIError {
+	var resp struct {
+		Error       json.RawMessage `json:"error"`
+		Description string          `json:"description"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || len(resp.Error) == 0 {
+		return &APIError{StatusCode: status, Message: string(body)}
+	}
+	var code string
+	if json.Unmarshal(resp.Error, &code) == nil {
+		if resp.Description == "" {
+			resp.Description = code
+		}
+		return &APIError{StatusCode: status, Code: code, Message: resp.Description}
+	}
+	var obj struct {
+		Title   string `json:"title"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(resp.Error, &obj) == nil && obj.Message != "" {
+		return &APIError{StatusCode: status, Code: obj.Title, Message: obj.Message}
+	}
+	return &APIError{StatusCode: status, Message: string(body)}
+}
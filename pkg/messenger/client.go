@@ -0,0 +1,185 @@
+package messenger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zerodha/logf"
+)
+
+const (
+	// DefaultTimeout for HTTP requests
+	DefaultTimeout = 30 * time.Second
+	// BaseURL for Meta Graph API
+	BaseURL = "https://graph.facebook.com"
+	// MaxDownloadSize is the largest attachment downloaded from a conversation
+	MaxDownloadSize = 25 << 20
+)
+
+// Platform is the app a Messenger Platform account receives messages in
+type Platform string
+
+const (
+	PlatformMessenger Platform = "messenger"
+	PlatformInstagram Platform = "instagram"
+)
+
+// Account is a Facebook Page, or an Instagram professional account connected
+// through its Facebook Page
+type Account struct {
+	ID          string // Page ID, or Instagram account ID
+	PageID      string // ID of the Facebook Page
+	Platform    Platform
+	APIVersion  string
+	AccessToken string // Page access token
+}
+
+// Client is the Messenger Platform API client. It sends and receives Facebook
+// Messenger and Instagram direct messages.
+type Client struct {
+	HTTPClient *http.Client
+	Log        logf.Logger
+	baseURL    string // For testing with mock servers
+}
+
+// New creates a new Messenger Platform client
+func New(log logf.Logger) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:     log,
+		baseURL: BaseURL,
+	}
+}
+
+// NewWithBaseURL creates a new Messenger Platform client with a custom base URL (for testing)
+func NewWithBaseURL(log logf.Logger, baseURL string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:     log,
+		baseURL: baseURL,
+	}
+}
+
+// getBaseURL returns the base URL for API requests
+func (c *Client) getBaseURL() string {
+	if c.baseURL != "" {
+		return c.baseURL
+	}
+	return BaseURL
+}
+
+// buildURL builds the URL of a Graph API path
+func (c *Client) buildURL(account *Account, path string) string {
+	return fmt.Sprintf("%s/%s/%s", c.getBaseURL(), account.APIVersion, path)
+}
+
+// doRequest performs an HTTP request to the Meta API
+func (c *Client) doRequest(ctx context.Context, method, url string, body interface{}, accessToken string) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		reqBody = bytes.NewBuffer(jsonBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr metaAPIError
+		if err := json.Unmarshal(respBody, &apiErr); err == nil && apiErr.Error.Message != "" {
+			return nil, &APIError{
+				StatusCode: resp.StatusCode,
+				Code:       apiErr.Error.Code,
+				Subcode:    apiErr.Error.ErrorSubcode,
+				Message:    apiErr.Error.Message,
+			}
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: string(respBody)}
+	}
+
+	return respBody, nil
+}
+
+// GetProfile returns the name of a user, and their username on Instagram, by the
+// ID webhooks identify them with. The account itself can be fetched by its ID too.
+func (c *Client) GetProfile(ctx context.Context, account *Account, userID string) (*Profile, error) {
+	fields := "name"
+	if account.Platform == PlatformInstagram {
+		fields = "name,username"
+	}
+	url := c.buildURL(account, userID) + "?fields=" + fields
+	body, err := c.doRequest(ctx, http.MethodGet, url, nil, account.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get profile: %w", err)
+	}
+
+	var profile Profile
+	if err := json.Unmarshal(body, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &profile, nil
+}
+
+// SubscribePage subscribes the app to the messaging webhooks of the account's Page
+func (c *Client) SubscribePage(ctx context.Context, account *Account) error {
+	url := c.buildURL(account, account.PageID) + "/subscribed_apps?subscribed_fields=messages,messaging_postbacks,message_reactions"
+	if _, err := c.doRequest(ctx, http.MethodPost, url, nil, account.AccessToken); err != nil {
+		return fmt.Errorf("failed to subscribe page: %w", err)
+	}
+	return nil
+}
+
+// Download downloads an attachment from the URL a webhook gave for it
+func (c *Client) Download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download attachment: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: "attachment download failed"}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	if len(data) > MaxDownloadSize {
+		return nil, fmt.Errorf("attachment is larger than %d bytes", MaxDownloadSize)
+	}
+	return data, nil
+}
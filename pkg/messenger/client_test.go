@@ -0,0 +1,201 @@
+package messenger_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/pkg/messenger"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAccount() *messenger.Account {
+	return &messenger.Account{
+		ID:          "17841400000000000",
+		PageID:      "100000000000000",
+		Platform:    messenger.PlatformInstagram,
+		APIVersion:  "v21.0",
+		AccessToken: "page-token",
+	}
+}
+
+func testPage() *messenger.Account {
+	return &messenger.Account{
+		ID:          "100000000000000",
+		PageID:      "100000000000000",
+		Platform:    messenger.PlatformMessenger,
+		APIVersion:  "v21.0",
+		AccessToken: "page-token",
+	}
+}
+
+func TestClient_SendText(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v21.0/17841400000000000/messages", r.URL.Path)
+		assert.Equal(t, "Bearer page-token", r.Header.Get("Authorization"))
+
+		var body map[string]map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "1234", body["recipient"]["id"])
+		assert.Equal(t, "Hello", body["message"]["text"])
+
+		_, _ = w.Write([]byte(`{"recipient_id":"1234","message_id":"mid.1"}`))
+	}))
+	defer server.Close()
+
+	client := messenger.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	mid, err := client.SendText(context.Background(), testAccount(), "1234", "Hello")
+	require.NoError(t, err)
+	assert.Equal(t, "mid.1", mid)
+}
+
+func TestClient_SendText_Messenger(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v21.0/100000000000000/messages", r.URL.Path)
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "RESPONSE", body["messaging_type"])
+
+		_, _ = w.Write([]byte(`{"recipient_id":"1234","message_id":"m_1"}`))
+	}))
+	defer server.Close()
+
+	client := messenger.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	mid, err := client.SendText(context.Background(), testPage(), "1234", "Hello")
+	require.NoError(t, err)
+	assert.Equal(t, "m_1", mid)
+}
+
+func TestClient_SendQuickReplies(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Message struct {
+				Text         string              `json:"text"`
+				QuickReplies []map[string]string `json:"quick_replies"`
+			} `json:"message"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "Pick one", body.Message.Text)
+		require.Len(t, body.Message.QuickReplies, 2)
+		assert.Equal(t, map[string]string{"content_type": "text", "title": "Yes", "payload": "yes"}, body.Message.QuickReplies[0])
+
+		_, _ = w.Write([]byte(`{"recipient_id":"1234","message_id":"mid.2"}`))
+	}))
+	defer server.Close()
+
+	client := messenger.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	mid, err := client.SendQuickReplies(context.Background(), testAccount(), "1234", "Pick one",
+		[]messenger.QuickReply{{Title: "Yes", Payload: "yes"}, {Title: "No", Payload: "no"}})
+	require.NoError(t, err)
+	assert.Equal(t, "mid.2", mid)
+}
+
+func TestClient_APIError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"Outside of allowed window","type":"OAuthException","code":10,"error_subcode":2534022}}`))
+	}))
+	defer server.Close()
+
+	client := messenger.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	_, err := client.SendText(context.Background(), testAccount(), "1234", "Hello")
+	require.Error(t, err)
+
+	var apiErr *messenger.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 10, apiErr.Code)
+	assert.Equal(t, 2534022, apiErr.Subcode)
+}
+
+func TestClient_GetProfile(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v21.0/1234", r.URL.Path)
+		assert.Equal(t, "name,username", r.URL.Query().Get("fields"))
+		_, _ = w.Write([]byte(`{"id":"1234","username":"ada"}`))
+	}))
+	defer server.Close()
+
+	client := messenger.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	profile, err := client.GetProfile(context.Background(), testAccount(), "1234")
+	require.NoError(t, err)
+	assert.Equal(t, "ada", profile.DisplayName())
+}
+
+func TestClient_SubscribePage(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v21.0/100000000000000/subscribed_apps", r.URL.Path)
+		assert.Equal(t, "messages,messaging_postbacks,message_reactions", r.URL.Query().Get("subscribed_fields"))
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}))
+	defer server.Close()
+
+	client := messenger.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	require.NoError(t, client.SubscribePage(context.Background(), testAccount()))
+}
+
+func TestClient_SetPersistentMenu(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v21.0/me/messenger_profile", r.URL.Path)
+		assert.Equal(t, "messenger", r.URL.Query().Get("platform"))
+
+		var body struct {
+			GetStarted     map[string]string `json:"get_started"`
+			PersistentMenu []struct {
+				Locale        string               `json:"locale"`
+				CallToActions []messenger.MenuItem `json:"call_to_actions"`
+			} `json:"persistent_menu"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, messenger.GetStartedPayload, body.GetStarted["payload"])
+		require.Len(t, body.PersistentMenu, 1)
+		assert.Equal(t, "default", body.PersistentMenu[0].Locale)
+		assert.Equal(t, []messenger.MenuItem{{Type: "postback", Title: "Talk to us", Payload: "talk"}}, body.PersistentMenu[0].CallToActions)
+
+		_, _ = w.Write([]byte(`{"result":"success"}`))
+	}))
+	defer server.Close()
+
+	client := messenger.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	err := client.SetPersistentMenu(context.Background(), testPage(),
+		[]messenger.MenuItem{{Type: "postback", Title: "Talk to us", Payload: "talk"}})
+	require.NoError(t, err)
+}
+
+func TestClient_GetPersistentMenu(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "instagram", r.URL.Query().Get("platform"))
+		assert.Equal(t, "persistent_menu", r.URL.Query().Get("fields"))
+		_, _ = w.Write([]byte(`{"data":[{"persistent_menu":[{"locale":"default","composer_input_disabled":false,"call_to_actions":[{"type":"web_url","title":"Shop","url":"https://example.com"}]}]}]}`))
+	}))
+	defer server.Close()
+
+	client := messenger.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	items, err := client.GetPersistentMenu(context.Background(), testAccount())
+	require.NoError(t, err)
+	assert.Equal(t, []messenger.MenuItem{{Type: "web_url", Title: "Shop", URL: "https://example.com"}}, items)
+}
@@ -0,0 +1,131 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Attachment types that can be sent
+const (
+	AttachmentImage = "image"
+	AttachmentVideo = "video"
+	AttachmentAudio = "audio"
+	AttachmentFile  = "file"
+)
+
+// QuickReply is a button shown above the composer until the user answers
+type QuickReply struct {
+	Title   string `json:"title"`
+	Payload string `json:"payload"`
+}
+
+// TemplateButton is a button of a generic template. URL buttons open the URL,
+// postback buttons send Payload back in a postback.
+type TemplateButton struct {
+	Type    string `json:"type"` // web_url or postback
+	Title   string `json:"title"`
+	URL     string `json:"url,omitempty"`
+	Payload string `json:"payload,omitempty"`
+}
+
+// sendResponse is the response of the send API
+type sendResponse struct {
+	RecipientID string `json:"recipient_id"`
+	MessageID   string `json:"message_id"`
+}
+
+// send posts a message to a user and returns its message ID
+func (c *Client) send(ctx context.Context, account *Account, recipientID string, message map[string]interface{}) (string, error) {
+	payload := map[string]interface{}{
+		"recipient": map[string]string{"id": recipientID},
+		"message":   message,
+	}
+	if account.Platform == PlatformMessenger {
+		// Messenger requires a messaging type; replies within the standard
+		// messaging window are responses
+		payload["messaging_type"] = "RESPONSE"
+	}
+	body, err := c.doRequest(ctx, http.MethodPost, c.buildURL(account, account.ID)+"/messages", payload, account.AccessToken)
+	if err != nil {
+		return "", err
+	}
+
+	var resp sendResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	return resp.MessageID, nil
+}
+
+// SendText sends a text message
+func (c *Client) SendText(ctx context.Context, account *Account, recipientID, text string) (string, error) {
+	mid, err := c.send(ctx, account, recipientID, map[string]interface{}{"text": text})
+	if err != nil {
+		return "", fmt.Errorf("failed to send message: %w", err)
+	}
+	return mid, nil
+}
+
+// SendQuickReplies sends a text message with quick reply buttons
+func (c *Client) SendQuickReplies(ctx context.Context, account *Account, recipientID, text string, replies []QuickReply) (string, error) {
+	quickReplies := make([]map[string]string, len(replies))
+	for i, r := range replies {
+		quickReplies[i] = map[string]string{"content_type": "text", "title": r.Title, "payload": r.Payload}
+	}
+	mid, err := c.send(ctx, account, recipientID, map[string]interface{}{
+		"text":          text,
+		"quick_replies": quickReplies,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send quick replies: %w", err)
+	}
+	return mid, nil
+}
+
+// SendButtons sends a generic template with a title and buttons
+func (c *Client) SendButtons(ctx context.Context, account *Account, recipientID, title string, buttons []TemplateButton) (string, error) {
+	mid, err := c.send(ctx, account, recipientID, map[string]interface{}{
+		"attachment": map[string]interface{}{
+			"type": "template",
+			"payload": map[string]interface{}{
+				"template_type": "generic",
+				"elements": []map[string]interface{}{
+					{"title": title, "buttons": buttons},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send buttons: %w", err)
+	}
+	return mid, nil
+}
+
+// SendAttachment sends media Meta fetches from a public URL
+func (c *Client) SendAttachment(ctx context.Context, account *Account, recipientID, attachmentType, url string) (string, error) {
+	mid, err := c.send(ctx, account, recipientID, map[string]interface{}{
+		"attachment": map[string]interface{}{
+			"type":    attachmentType,
+			"payload": map[string]string{"url": url},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send %s: %w", attachmentType, err)
+	}
+	return mid, nil
+}
+
+// SendSenderAction shows typing_on or typing_off, or marks the conversation seen
+// with mark_seen
+func (c *Client) SendSenderAction(ctx context.Context, account *Account, recipientID, action string) error {
+	payload := map[string]interface{}{
+		"recipient":     map[string]string{"id": recipientID},
+		"sender_action": action,
+	}
+	if _, err := c.doRequest(ctx, http.MethodPost, c.buildURL(account, account.ID)+"/messages", payload, account.AccessToken); err != nil {
+		return fmt.Errorf("failed to send sender action: %w", err)
+	}
+	return nil
+}
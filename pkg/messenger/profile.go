@@ -0,0 +1,92 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// GetStartedPayload is the postback payload of the Get Started button. Messenger
+// only shows the persistent menu once a Page has the button.
+const GetStartedPayload = "GET_STARTED"
+
+// MenuItem is an entry of the persistent menu. URL items open the URL, postback
+// items send Payload back in a postback.
+type MenuItem struct {
+	Type    string `json:"type"` // web_url or postback
+	Title   string `json:"title"`
+	URL     string `json:"url,omitempty"`
+	Payload string `json:"payload,omitempty"`
+}
+
+// persistentMenu is the persistent menu of one locale
+type persistentMenu struct {
+	Locale                string     `json:"locale"`
+	ComposerInputDisabled bool       `json:"composer_input_disabled"`
+	CallToActions         []MenuItem `json:"call_to_actions"`
+}
+
+// profileURL builds the URL of the account's messenger profile, which holds the
+// persistent menu and Get Started button
+func (c *Client) profileURL(account *Account) string {
+	url := c.buildURL(account, "me/messenger_profile")
+	if account.Platform == PlatformInstagram {
+		return url + "?platform=instagram"
+	}
+	return url + "?platform=messenger"
+}
+
+// GetPersistentMenu returns the default persistent menu, or nil if the account
+// has none
+func (c *Client) GetPersistentMenu(ctx context.Context, account *Account) ([]MenuItem, error) {
+	body, err := c.doRequest(ctx, http.MethodGet, c.profileURL(account)+"&fields=persistent_menu", nil, account.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get persistent menu: %w", err)
+	}
+
+	var resp struct {
+		Data []struct {
+			PersistentMenu []persistentMenu `json:"persistent_menu"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	for _, data := range resp.Data {
+		for _, menu := range data.PersistentMenu {
+			if menu.Locale == "default" {
+				return menu.CallToActions, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// SetPersistentMenu replaces the persistent menu. On Messenger it also sets the
+// Get Started button the menu requires.
+func (c *Client) SetPersistentMenu(ctx context.Context, account *Account, items []MenuItem) error {
+	payload := map[string]interface{}{
+		"persistent_menu": []persistentMenu{
+			{Locale: "default", CallToActions: items},
+		},
+	}
+	if account.Platform != PlatformInstagram {
+		payload["get_started"] = map[string]string{"payload": GetStartedPayload}
+	}
+	if _, err := c.doRequest(ctx, http.MethodPost, c.profileURL(account), payload, account.AccessToken); err != nil {
+		return fmt.Errorf("failed to set persistent menu: %w", err)
+	}
+	return nil
+}
+
+// DeletePersistentMenu removes the persistent menu
+func (c *Client) DeletePersistentMenu(ctx context.Context, account *Account) error {
+	payload := map[string]interface{}{
+		"fields": []string{"persistent_menu"},
+	}
+	if _, err := c.doRequest(ctx, http.MethodDelete, c.profileURL(account), payload, account.AccessToken); err != nil {
+		return fmt.Errorf("failed to delete persistent menu: %w", err)
+	}
+	return nil
+}
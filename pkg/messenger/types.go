@@ -0,0 +1,104 @@
+package messenger
+
+import "fmt"
+
+// metaAPIError is the error body of a failed Meta API request
+type metaAPIError struct {
+	Error struct {
+		Message      string `json:"message"`
+		Type         string `json:"type"`
+		Code         int    `json:"code"`
+		ErrorSubcode int    `json:"error_subcode"`
+	} `json:"error"`
+}
+
+// APIError is a failed Meta API request. Code is Meta's error code, or zero when
+// the response wasn't a Meta error.
+type APIError struct {
+	StatusCode int
+	Code       int
+	Subcode    int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("API error %d: %s", e.Code, e.Message)
+}
+
+// Profile is a user, Page or Instagram account
+type Profile struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+// DisplayName returns the profile's name, or its username when it has none
+func (p *Profile) DisplayName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.Username
+}
+
+// MessagingEvent is an event of a conversation, as delivered in the messaging
+// field of a webhook entry
+type MessagingEvent struct {
+	Sender    Participant   `json:"sender"`
+	Recipient Participant   `json:"recipient"`
+	Timestamp int64         `json:"timestamp"` // Milliseconds
+	Message   *EventMessage `json:"message,omitempty"`
+	Postback  *Postback     `json:"postback,omitempty"`
+	Reaction  *Reaction     `json:"reaction,omitempty"`
+}
+
+// Participant is the sender or recipient of an event
+type Participant struct {
+	ID string `json:"id"`
+}
+
+// EventMessage is a message sent in a conversation
+type EventMessage struct {
+	MID         string       `json:"mid"`
+	Text        string       `json:"text,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	QuickReply  *struct {
+		Payload string `json:"payload"`
+	} `json:"quick_reply,omitempty"`
+	ReplyTo *struct {
+		MID string `json:"mid"`
+	} `json:"reply_to,omitempty"`
+	IsEcho    bool `json:"is_echo,omitempty"`    // Sent by the account
+	IsDeleted bool `json:"is_deleted,omitempty"` // Unsent by the user
+}
+
+// Attachment is media or a shared post in a message
+type Attachment struct {
+	Type    string `json:"type"` // image, video, audio, file, location, share, story_mention, ig_reel, ...
+	Payload struct {
+		URL         string       `json:"url"`
+		Coordinates *Coordinates `json:"coordinates,omitempty"` // Shared locations on Messenger
+	} `json:"payload"`
+}
+
+// Coordinates is a point on the map
+type Coordinates struct {
+	Lat  float64 `json:"lat"`
+	Long float64 `json:"long"`
+}
+
+// Postback is a tap on a button of a generic template or the persistent menu
+type Postback struct {
+	MID     string `json:"mid"`
+	Title   string `json:"title"`
+	Payload string `json:"payload"`
+}
+
+// Reaction is a reaction added to or removed from a message
+type Reaction struct {
+	MID    string `json:"mid"`
+	Action string `json:"action"` // react or unreact
+	Emoji  string `json:"emoji,omitempty"`
+}
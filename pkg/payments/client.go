@@ -0,0 +1,139 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zerodha/logf"
+)
+
+const (
+	// DefaultTimeout for HTTP requests
+	DefaultTimeout = 30 * time.Second
+	// StripeBaseURL for the Stripe API
+	StripeBaseURL = "https://api.stripe.com"
+	// RazorpayBaseURL for the Razorpay API
+	RazorpayBaseURL = "https://api.razorpay.com"
+)
+
+// Provider is a payment provider links are created with
+type Provider string
+
+const (
+	ProviderStripe   Provider = "stripe"
+	ProviderRazorpay Provider = "razorpay"
+)
+
+// Credentials are the API keys of a provider account. Stripe uses the secret key
+// only, Razorpay the key ID and its secret.
+type Credentials struct {
+	KeyID     string
+	SecretKey string
+}
+
+// LinkRequest is a payment link to create
+type LinkRequest struct {
+	Amount      int64 // In the smallest currency unit
+	Currency    string
+	Description string
+	ReferenceID string // Returned with the provider's events for the link
+	Phone       string // Customer phone number in E.164 format, optional
+	SuccessURL  string // Where customers land after paying
+}
+
+// Link is a created payment link
+type Link struct {
+	ID  string
+	URL string
+}
+
+// APIError is an error answered by a provider's API
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("API error %s: %s", e.Code, e.Message)
+}
+
+// Client creates payment links with the supported providers
+type Client struct {
+	HTTPClient  *http.Client
+	Log         logf.Logger
+	stripeURL   string // For testing with mock servers
+	razorpayURL string
+}
+
+// New creates a new payments client
+func New(log logf.Logger) *Client {
+	return NewWithBaseURLs(log, StripeBaseURL, RazorpayBaseURL)
+}
+
+// NewWithBaseURLs creates a new payments client with custom provider base URLs (for testing)
+func NewWithBaseURLs(log logf.Logger, stripeURL, razorpayURL string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:         log,
+		stripeURL:   stripeURL,
+		razorpayURL: razorpayURL,
+	}
+}
+
+// CreateLink creates a link customers pay an amount through
+func (c *Client) CreateLink(ctx context.Context, provider Provider, creds Credentials, req LinkRequest) (*Link, error) {
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+	if req.Currency == "" {
+		return nil, fmt.Errorf("currency is required")
+	}
+
+	var link *Link
+	var err error
+	switch provider {
+	case ProviderStripe:
+		link, err = c.createStripeLink(ctx, creds, req)
+	case ProviderRazorpay:
+		link, err = c.createRazorpayLink(ctx, creds, req)
+	default:
+		return nil, fmt.Errorf("unsupported payment provider: %s", provider)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment link: %w", err)
+	}
+	return link, nil
+}
+
+// do performs an API request and decodes the response into result. errorOf
+// extracts the error of a failed response.
+func (c *Client) do(req *http.Request, result interface{}, errorOf func(status int, body []byte) *APIError) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return errorOf(resp.StatusCode, respBody)
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package payments_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shridarpatil/whatomate/pkg/payments"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_CreateLink_Stripe(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/checkout/sessions", r.URL.Path)
+		user, _, _ := r.BasicAuth()
+		assert.Equal(t, "sk_test", user)
+
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "payment", r.PostForm.Get("mode"))
+		assert.Equal(t, "usd", r.PostForm.Get("line_items[0][price_data][currency]"))
+		assert.Equal(t, "4900", r.PostForm.Get("line_items[0][price_data][unit_amount]"))
+		assert.Equal(t, "Order #1001", r.PostForm.Get("line_items[0][price_data][product_data][name]"))
+		assert.Equal(t, "ref-1", r.PostForm.Get("client_reference_id"))
+		assert.Equal(t, "https://example.com/thanks", r.PostForm.Get("success_url"))
+
+		_, _ = w.Write([]byte(`{"id":"cs_test_1","url":"https://checkout.stripe.com/c/pay/cs_test_1"}`))
+	}))
+	defer server.Close()
+
+	client := payments.NewWithBaseURLs(testutil.NopLogger(), server.URL, "")
+	link, err := client.CreateLink(context.Background(), payments.ProviderStripe, payments.Credentials{SecretKey: "sk_test"}, payments.LinkRequest{
+		Amount:      4900,
+		Currency:    "USD",
+		Description: "Order #1001",
+		ReferenceID: "ref-1",
+		SuccessURL:  "https://example.com/thanks",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "cs_test_1", link.ID)
+	assert.Equal(t, "https://checkout.stripe.com/c/pay/cs_test_1", link.URL)
+}
+
+func TestClient_CreateLink_Razorpay(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/payment_links", r.URL.Path)
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "rzp_test", user)
+		assert.Equal(t, "secret", pass)
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, float64(50000), body["amount"])
+		assert.Equal(t, "INR", body["currency"])
+		assert.Equal(t, "ref-2", body["reference_id"])
+		assert.Equal(t, map[string]interface{}{"contact": "+919876543210"}, body["customer"])
+
+		_, _ = w.Write([]byte(`{"id":"plink_1","short_url":"https://rzp.io/i/abc","status":"created"}`))
+	}))
+	defer server.Close()
+
+	client := payments.NewWithBaseURLs(testutil.NopLogger(), "", server.URL)
+	link, err := client.CreateLink(context.Background(), payments.ProviderRazorpay, payments.Credentials{KeyID: "rzp_test", SecretKey: "secret"}, payments.LinkRequest{
+		Amount:      50000,
+		Currency:    "inr",
+		Description: "Consultation",
+		ReferenceID: "ref-2",
+		Phone:       "+919876543210",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "plink_1", link.ID)
+	assert.Equal(t, "https://rzp.io/i/abc", link.URL)
+}
+
+func TestClient_CreateLink_APIError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"Invalid API Key provided"}}`))
+	}))
+	defer server.Close()
+
+	client := payments.NewWithBaseURLs(testutil.NopLogger(), server.URL, "")
+	_, err := client.CreateLink(context.Background(), payments.ProviderStripe, payments.Credentials{SecretKey: "bad"}, payments.LinkRequest{
+		Amount:   100,
+		Currency: "usd",
+	})
+	require.Error(t, err)
+
+	var apiErr *payments.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "invalid_request_error", apiErr.Code)
+	assert.Contains(t, err.Error(), "Invalid API Key provided")
+}
+
+func TestClient_CreateLink_Validation(t *testing.T) {
+	t.Parallel()
+
+	client := payments.New(testutil.NopLogger())
+	_, err := client.CreateLink(context.Background(), payments.ProviderStripe, payments.Credentials{SecretKey: "sk"}, payments.LinkRequest{Currency: "usd"})
+	assert.EqualError(t, err, "amount must be positive")
+	_, err = client.CreateLink(context.Background(), "paypal", payments.Credentials{}, payments.LinkRequest{Amount: 100, Currency: "usd"})
+	assert.EqualError(t, err, "unsupported payment provider: paypal")
+}
+
+func TestVerifyStripeSignature(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"type":"checkout.session.completed"}`)
+	now := time.Unix(1700000000, 0)
+	sign := func(ts int64, secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(fmt.Sprintf("%d.%s", ts, body)))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	header := fmt.Sprintf("t=%d,v1=%s", now.Unix(), sign(now.Unix(), "whsec"))
+	assert.True(t, payments.VerifyStripeSignature(body, header, "whsec", now))
+	assert.False(t, payments.VerifyStripeSignature(body, header, "other", now))
+	assert.False(t, payments.VerifyStripeSignature([]byte(`{}`), header, "whsec", now))
+	// Old events can't be replayed
+	assert.False(t, payments.VerifyStripeSignature(body, header, "whsec", now.Add(time.Hour)))
+	assert.False(t, payments.VerifyStripeSignature(body, "", "whsec", now))
+}
+
+func TestVerifyRazorpaySignature(t *testing.T) {
+	t.Parallel()
+
+	body := []byte(`{"event":"payment_link.paid"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	assert.True(t, payments.VerifyRazorpaySignature(body, signature, "secret"))
+	assert.False(t, payments.VerifyRazorpaySignature(body, signature, "other"))
+	assert.False(t, payments.VerifyRazorpaySignature(body, "", "secret"))
+}
+
+func TestParseStripeEvent(t *testing.T) {
+	t.Parallel()
+
+	event, err := payments.ParseStripeEvent([]byte(`{"type":"checkout.session.completed","data":{"object":{"id":"cs_1","client_reference_id":"ref-1","payment_status":"paid","payment_intent":"pi_1"}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, &payments.Event{Type: payments.EventPaid, LinkID: "cs_1", ReferenceID: "ref-1", PaymentID: "pi_1"}, event)
+
+	// Sessions completed with a payment still processing aren't paid yet
+	event, err = payments.ParseStripeEvent([]byte(`{"type":"checkout.session.completed","data":{"object":{"id":"cs_1","payment_status":"unpaid"}}}`))
+	require.NoError(t, err)
+	assert.Nil(t, event)
+
+	event, err = payments.ParseStripeEvent([]byte(`{"type":"checkout.session.expired","data":{"object":{"id":"cs_1","client_reference_id":"ref-1"}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, payments.EventExpired, event.Type)
+
+	event, err = payments.ParseStripeEvent([]byte(`{"type":"customer.created","data":{"object":{}}}`))
+	require.NoError(t, err)
+	assert.Nil(t, event)
+}
+
+func TestParseRazorpayEvent(t *testing.T) {
+	t.Parallel()
+
+	event, err := payments.ParseRazorpayEvent([]byte(`{"event":"payment_link.paid","payload":{"payment_link":{"entity":{"id":"plink_1","reference_id":"ref-2","status":"paid"}},"payment":{"entity":{"id":"pay_1"}}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, &payments.Event{Type: payments.EventPaid, LinkID: "plink_1", ReferenceID: "ref-2", PaymentID: "pay_1"}, event)
+
+	event, err = payments.ParseRazorpayEvent([]byte(`{"event":"payment_link.cancelled","payload":{"payment_link":{"entity":{"id":"plink_1","reference_id":"ref-2"}}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, payments.EventExpired, event.Type)
+
+	event, err = payments.ParseRazorpayEvent([]byte(`{"event":"payment.captured","payload":{}}`))
+	require.NoError(t, err)
+	assert.Nil(t, event)
+}
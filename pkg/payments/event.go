@@ -0,0 +1,17 @@
+package payments
+
+// EventType is what happened to a payment link
+type EventType string
+
+const (
+	EventPaid    EventType = "paid"
+	EventExpired EventType = "expired" // Expired or cancelled without being paid
+)
+
+// Event is a change of a payment link reported by a provider's webhook
+type Event struct {
+	Type        EventType
+	LinkID      string // The provider's ID of the link
+	ReferenceID string // The reference ID the link was created with
+	PaymentID   string // The provider's ID of the payment, for paid links
+}
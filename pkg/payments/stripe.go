@@ -0,0 +1,147 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stripeSignatureTolerance is how old a signed Stripe event can be, so captured
+// events can't be replayed later
+const stripeSignatureTolerance = 5 * time.Minute
+
+// createStripeLink creates a Stripe Checkout session, whose URL customers pay through
+func (c *Client) createStripeLink(ctx context.Context, creds Credentials, req LinkRequest) (*Link, error) {
+	if creds.SecretKey == "" {
+		return nil, fmt.Errorf("secret key is required")
+	}
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", strings.ToLower(req.Currency))
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(req.Amount, 10))
+	form.Set("line_items[0][price_data][product_data][name]", req.Description)
+	form.Set("client_reference_id", req.ReferenceID)
+	form.Set("metadata[reference_id]", req.ReferenceID)
+	if req.SuccessURL != "" {
+		form.Set("success_url", req.SuccessURL)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.stripeURL+"/v1/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.SetBasicAuth(creds.SecretKey, "")
+
+	var session struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := c.do(httpReq, &session, stripeError); err != nil {
+		return nil, err
+	}
+	return &Link{ID: session.ID, URL: session.URL}, nil
+}
+
+// stripeError extracts the error of a failed Stripe response
+func stripeError(status int, body []byte) *APIError {
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Error.Message == "" {
+		return &APIError{StatusCode: status, Message: string(body)}
+	}
+	code := resp.Error.Code
+	if code == "" {
+		code = resp.Error.Type
+	}
+	return &APIError{StatusCode: status, Code: code, Message: resp.Error.Message}
+}
+
+// VerifyStripeSignature checks the Stripe-Signature header of a webhook: an HMAC of
+// the timestamp and body, signed no longer than the tolerance before now
+func VerifyStripeSignature(body []byte, header, secret string, now time.Time) bool {
+	if header == "" || secret == "" {
+		return false
+	}
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(secs, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStripeEvent reads the payment link event of a Stripe webhook, or nil for
+// events that aren't about payment links
+func ParseStripeEvent(body []byte) (*Event, error) {
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID                string `json:"id"`
+				ClientReferenceID string `json:"client_reference_id"`
+				PaymentStatus     string `json:"payment_status"`
+				PaymentIntent     string `json:"payment_intent"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("invalid event: %w", err)
+	}
+
+	session := event.Data.Object
+	e := &Event{LinkID: session.ID, ReferenceID: session.ClientReferenceID, PaymentID: session.PaymentIntent}
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+		// Delayed payment methods complete the session before the payment succeeds
+		if session.PaymentStatus != "paid" {
+			return nil, nil
+		}
+		e.Type = EventPaid
+	case "checkout.session.expired":
+		e.Type = EventExpired
+	default:
+		return nil, nil
+	}
+	return e, nil
+}
@@ -0,0 +1,286 @@
+package shopify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zerodha/logf"
+)
+
+const (
+	// DefaultTimeout for HTTP requests
+	DefaultTimeout = 30 * time.Second
+	// APIVersion of the Shopify Admin API
+	APIVersion = "2024-10"
+)
+
+// ErrOrderNotFound is returned when no order matches a lookup
+var ErrOrderNotFound = errors.New("order not found")
+
+// Client is the Shopify Admin REST API client
+type Client struct {
+	HTTPClient *http.Client
+	Log        logf.Logger
+	baseURL    string // For testing with mock servers, used instead of the shop's URL
+}
+
+// Credentials authorize calls to a store, with the Admin API access token of a
+// custom app installed on it
+type Credentials struct {
+	ShopDomain  string // e.g. acme.myshopify.com
+	AccessToken string
+}
+
+// Shop is a Shopify store
+type Shop struct {
+	Name     string `json:"name"`
+	Domain   string `json:"myshopify_domain"`
+	Currency string `json:"currency"`
+}
+
+// Address is a shipping or billing address
+type Address struct {
+	FirstName string `json:"first_name"`
+	Phone     string `json:"phone"`
+}
+
+// Fulfillment is a shipment of some or all of an order's items
+type Fulfillment struct {
+	ID              int64     `json:"id"`
+	OrderID         int64     `json:"order_id"`
+	Name            string    `json:"name"` // e.g. #1001.1
+	Status          string    `json:"status"`
+	ShipmentStatus  string    `json:"shipment_status"` // e.g. in_transit, out_for_delivery, delivered
+	TrackingCompany string    `json:"tracking_company"`
+	TrackingNumber  string    `json:"tracking_number"`
+	TrackingURL     string    `json:"tracking_url"`
+	Destination     *Address  `json:"destination"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// LineItem is an item of an order
+type LineItem struct {
+	Title    string `json:"title"`
+	Quantity int    `json:"quantity"`
+}
+
+// Order is a Shopify order
+type Order struct {
+	ID                int64      `json:"id"`
+	Name              string     `json:"name"` // Order number shown to customers, e.g. #1001
+	Phone             string     `json:"phone"`
+	CreatedAt         time.Time  `json:"created_at"`
+	CancelledAt       *time.Time `json:"cancelled_at"`
+	FinancialStatus   string     `json:"financial_status"`
+	FulfillmentStatus string     `json:"fulfillment_status"` // Empty until something ships, then partial or fulfilled
+	TotalPrice        string     `json:"total_price"`
+	Currency          string     `json:"currency"`
+	OrderStatusURL    string     `json:"order_status_url"`
+	Customer          *struct {
+		FirstName string `json:"first_name"`
+		Phone     string `json:"phone"`
+	} `json:"customer"`
+	ShippingAddress *Address      `json:"shipping_address"`
+	BillingAddress  *Address      `json:"billing_address"`
+	Fulfillments    []Fulfillment `json:"fulfillments"`
+	LineItems       []LineItem    `json:"line_items"`
+}
+
+// Phones returns the phone numbers of an order: its own, its customer's and its
+// addresses'
+func (o *Order) Phones() []string {
+	var phones []string
+	if o.Phone != "" {
+		phones = append(phones, o.Phone)
+	}
+	if o.Customer != nil && o.Customer.Phone != "" {
+		phones = append(phones, o.Customer.Phone)
+	}
+	for _, addr := range []*Address{o.ShippingAddress, o.BillingAddress} {
+		if addr != nil && addr.Phone != "" {
+			phones = append(phones, addr.Phone)
+		}
+	}
+	return phones
+}
+
+// APIError is an error answered by the Shopify API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// New creates a new Shopify client
+func New(log logf.Logger) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log: log,
+	}
+}
+
+// NewWithBaseURL creates a new Shopify client with a custom base URL (for testing)
+func NewWithBaseURL(log logf.Logger, baseURL string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:     log,
+		baseURL: baseURL,
+	}
+}
+
+// GetShop returns the store the credentials belong to
+func (c *Client) GetShop(ctx context.Context, creds Credentials) (*Shop, error) {
+	var resp struct {
+		Shop Shop `json:"shop"`
+	}
+	if err := c.get(ctx, creds, "/shop.json", nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to get shop: %w", err)
+	}
+	return &resp.Shop, nil
+}
+
+// GetOrder returns an order by its ID
+func (c *Client) GetOrder(ctx context.Context, creds Credentials, id int64) (*Order, error) {
+	var resp struct {
+		Order Order `json:"order"`
+	}
+	err := c.get(ctx, creds, "/orders/"+strconv.FormatInt(id, 10)+".json", nil, &resp)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+	return &resp.Order, nil
+}
+
+// OrderByName returns an order by the number customers see, with or without its #
+func (c *Client) OrderByName(ctx context.Context, creds Credentials, name string) (*Order, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrOrderNotFound
+	}
+	if !strings.HasPrefix(name, "#") {
+		name = "#" + name
+	}
+	var resp struct {
+		Orders []Order `json:"orders"`
+	}
+	query := url.Values{"name": {name}, "status": {"any"}, "limit": {"1"}}
+	if err := c.get(ctx, creds, "/orders.json", query, &resp); err != nil {
+		return nil, fmt.Errorf("failed to find order: %w", err)
+	}
+	if len(resp.Orders) == 0 {
+		return nil, ErrOrderNotFound
+	}
+	return &resp.Orders[0], nil
+}
+
+// OrdersByPhone returns the latest orders of the customer with a phone number,
+// newest first
+func (c *Client) OrdersByPhone(ctx context.Context, creds Credentials, phone string, limit int) ([]Order, error) {
+	phone = strings.TrimSpace(phone)
+	if phone == "" {
+		return nil, ErrOrderNotFound
+	}
+	if !strings.HasPrefix(phone, "+") {
+		phone = "+" + phone
+	}
+
+	var customers struct {
+		Customers []struct {
+			ID int64 `json:"id"`
+		} `json:"customers"`
+	}
+	query := url.Values{"query": {"phone:" + phone}, "limit": {"1"}, "fields": {"id"}}
+	if err := c.get(ctx, creds, "/customers/search.json", query, &customers); err != nil {
+		return nil, fmt.Errorf("failed to find customer: %w", err)
+	}
+	if len(customers.Customers) == 0 {
+		return nil, ErrOrderNotFound
+	}
+
+	var resp struct {
+		Orders []Order `json:"orders"`
+	}
+	query = url.Values{
+		"customer_id": {strconv.FormatInt(customers.Customers[0].ID, 10)},
+		"status":      {"any"},
+		"limit":       {strconv.Itoa(limit)},
+	}
+	if err := c.get(ctx, creds, "/orders.json", query, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	if len(resp.Orders) == 0 {
+		return nil, ErrOrderNotFound
+	}
+	sort.SliceStable(resp.Orders, func(i, j int) bool {
+		return resp.Orders[i].CreatedAt.After(resp.Orders[j].CreatedAt)
+	})
+	return resp.Orders, nil
+}
+
+func (c *Client) get(ctx context.Context, creds Credentials, path string, query url.Values, result interface{}) error {
+	baseURL := c.baseURL
+	if baseURL == "" {
+		baseURL = "https://" + creds.ShopDomain
+	}
+	reqURL := baseURL + "/admin/api/" + APIVersion + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Shopify-Access-Token", creds.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		// Errors are a message, or messages by field
+		var apiErr struct {
+			Errors json.RawMessage `json:"errors"`
+		}
+		msg := string(respBody)
+		if json.Unmarshal(respBody, &apiErr) == nil && len(apiErr.Errors) > 0 {
+			var s string
+			if json.Unmarshal(apiErr.Errors, &s) == nil {
+				msg = s
+			} else {
+				msg = string(apiErr.Errors)
+			}
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: msg}
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
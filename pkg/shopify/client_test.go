@@ -0,0 +1,87 @@
+package shopify_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/pkg/shopify"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var creds = shopify.Credentials{ShopDomain: "acme.myshopify.com", AccessToken: "shpat_test"}
+
+func TestClient_OrderByName(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/admin/api/"+shopify.APIVersion+"/orders.json", r.URL.Path)
+		assert.Equal(t, "shpat_test", r.Header.Get("X-Shopify-Access-Token"))
+		assert.Equal(t, "any", r.URL.Query().Get("status"))
+		if r.URL.Query().Get("name") != "#1001" {
+			_, _ = w.Write([]byte(`{"orders":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"orders":[{"id":1,"name":"#1001","phone":null,"fulfillment_status":"fulfilled","total_price":"49.99","currency":"USD",
+			"customer":{"phone":"+15551234567"},"fulfillments":[{"tracking_number":"1Z999","shipment_status":"in_transit"}]}]}`))
+	}))
+	defer server.Close()
+
+	client := shopify.NewWithBaseURL(testutil.NopLogger(), server.URL)
+
+	order, err := client.OrderByName(context.Background(), creds, "1001")
+	require.NoError(t, err)
+	assert.Equal(t, "#1001", order.Name)
+	assert.Equal(t, "fulfilled", order.FulfillmentStatus)
+	assert.Equal(t, []string{"+15551234567"}, order.Phones())
+	require.Len(t, order.Fulfillments, 1)
+	assert.Equal(t, "1Z999", order.Fulfillments[0].TrackingNumber)
+
+	_, err = client.OrderByName(context.Background(), creds, "#2002")
+	assert.ErrorIs(t, err, shopify.ErrOrderNotFound)
+}
+
+func TestClient_OrdersByPhone(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/api/"+shopify.APIVersion+"/customers/search.json", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "phone:+15551234567", r.URL.Query().Get("query"))
+		_, _ = w.Write([]byte(`{"customers":[{"id":42}]}`))
+	})
+	mux.HandleFunc("/admin/api/"+shopify.APIVersion+"/orders.json", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "42", r.URL.Query().Get("customer_id"))
+		_, _ = w.Write([]byte(`{"orders":[
+			{"id":1,"name":"#1001","created_at":"2025-01-01T10:00:00Z"},
+			{"id":2,"name":"#1002","created_at":"2025-02-01T10:00:00Z"}]}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := shopify.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	orders, err := client.OrdersByPhone(context.Background(), creds, "15551234567", 3)
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	// Newest first
+	assert.Equal(t, "#1002", orders[0].Name)
+}
+
+func TestClient_APIError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"errors":"[API] Invalid API key or access token (unrecognized login or wrong password)"}`))
+	}))
+	defer server.Close()
+
+	client := shopify.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	_, err := client.GetShop(context.Background(), creds)
+	var apiErr *shopify.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Contains(t, apiErr.Message, "Invalid API key")
+}
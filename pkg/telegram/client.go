@@ -0,0 +1,193 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/zerodha/logf"
+)
+
+const (
+	// DefaultTimeout for HTTP requests
+	DefaultTimeout = 30 * time.Second
+	// BaseURL for the Telegram Bot API
+	BaseURL = "https://api.telegram.org"
+	// MaxDownloadSize is the largest file the Bot API lets bots download
+	MaxDownloadSize = 20 << 20
+)
+
+// Client is the Telegram Bot API client
+type Client struct {
+	HTTPClient *http.Client
+	Log        logf.Logger
+	baseURL    string // For testing with mock servers
+}
+
+// New creates a new Telegram client
+func New(log logf.Logger) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:     log,
+		baseURL: BaseURL,
+	}
+}
+
+// NewWithBaseURL creates a new Telegram client with a custom base URL (for testing)
+func NewWithBaseURL(log logf.Logger, baseURL string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:     log,
+		baseURL: baseURL,
+	}
+}
+
+// getBaseURL returns the base URL for API requests
+func (c *Client) getBaseURL() string {
+	if c.baseURL != "" {
+		return c.baseURL
+	}
+	return BaseURL
+}
+
+// buildMethodURL builds the URL of a Bot API method
+func (c *Client) buildMethodURL(token, method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", c.getBaseURL(), token, method)
+}
+
+// call posts params as JSON to a Bot API method and decodes its result into result
+func (c *Client) call(ctx context.Context, token, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	return c.do(ctx, token, method, "application/json", bytes.NewReader(body), result)
+}
+
+// upload posts a file with params as multipart form data to a Bot API method
+func (c *Client) upload(ctx context.Context, token, method string, params map[string]string, field, filename string, data []byte, result interface{}) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for key, value := range params {
+		if err := w.WriteField(key, value); err != nil {
+			return fmt.Errorf("failed to write form field: %w", err)
+		}
+	}
+	part, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		return fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to close form: %w", err)
+	}
+	return c.do(ctx, token, method, w.FormDataContentType(), &body, result)
+}
+
+// do performs a Bot API request. Every method answers with an envelope whose ok
+// field tells whether it succeeded.
+func (c *Client) do(ctx context.Context, token, method, contentType string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.buildMethodURL(token, method), body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var envelope apiResponse
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		return &APIError{StatusCode: resp.StatusCode, Description: string(respBody)}
+	}
+	if !envelope.OK {
+		return &APIError{StatusCode: resp.StatusCode, Code: envelope.ErrorCode, Description: envelope.Description}
+	}
+	if result != nil {
+		if err := json.Unmarshal(envelope.Result, result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetMe returns the bot the token belongs to
+func (c *Client) GetMe(ctx context.Context, token string) (*User, error) {
+	var bot User
+	if err := c.call(ctx, token, "getMe", struct{}{}, &bot); err != nil {
+		return nil, fmt.Errorf("failed to get bot: %w", err)
+	}
+	return &bot, nil
+}
+
+// SetWebhook has Telegram post the bot's updates to url. Telegram sends secret in
+// the X-Telegram-Bot-Api-Secret-Token header of every update.
+func (c *Client) SetWebhook(ctx context.Context, token, url, secret string) error {
+	params := map[string]interface{}{
+		"url":             url,
+		"secret_token":    secret,
+		"allowed_updates": []string{"message", "edited_message", "callback_query"},
+	}
+	if err := c.call(ctx, token, "setWebhook", params, nil); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebhook stops Telegram posting the bot's updates
+func (c *Client) DeleteWebhook(ctx context.Context, token string) error {
+	if err := c.call(ctx, token, "deleteWebhook", struct{}{}, nil); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
+
+// DownloadFile downloads a file a user sent the bot, by its file ID
+func (c *Client) DownloadFile(ctx context.Context, token, fileID string) ([]byte, error) {
+	var file File
+	if err := c.call(ctx, token, "getFile", map[string]string{"file_id": fileID}, &file); err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+	if file.FileSize > MaxDownloadSize {
+		return nil, fmt.Errorf("file of %d bytes is larger than bots can download", file.FileSize)
+	}
+
+	url := fmt.Sprintf("%s/file/bot%s/%s", c.getBaseURL(), token, file.FilePath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: resp.StatusCode, Description: "file download failed"}
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return data, nil
+}
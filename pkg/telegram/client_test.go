@@ -0,0 +1,151 @@
+package telegram_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/pkg/telegram"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_GetMe(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/bot123:abc/getMe", r.URL.Path)
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"id":123,"is_bot":true,"first_name":"Support","username":"support_bot"}}`))
+	}))
+	defer server.Close()
+
+	client := telegram.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	bot, err := client.GetMe(context.Background(), "123:abc")
+	require.NoError(t, err)
+	assert.Equal(t, int64(123), bot.ID)
+	assert.Equal(t, "support_bot", bot.Username)
+}
+
+func TestClient_APIError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"ok":false,"error_code":401,"description":"Unauthorized"}`))
+	}))
+	defer server.Close()
+
+	client := telegram.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	_, err := client.GetMe(context.Background(), "bad")
+	require.Error(t, err)
+
+	var apiErr *telegram.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 401, apiErr.Code)
+	assert.Contains(t, err.Error(), "Unauthorized")
+}
+
+func TestClient_SendMessage(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bottoken/sendMessage", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, float64(42), body["chat_id"])
+		assert.Equal(t, "Pick one", body["text"])
+		markup := body["reply_markup"].(map[string]interface{})
+		rows := markup["inline_keyboard"].([]interface{})
+		require.Len(t, rows, 1)
+		button := rows[0].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, "Yes", button["text"])
+		assert.Equal(t, "yes", button["callback_data"])
+
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":7,"chat":{"id":42,"type":"private"}}}`))
+	}))
+	defer server.Close()
+
+	client := telegram.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	keyboard := &telegram.InlineKeyboardMarkup{
+		InlineKeyboard: [][]telegram.InlineKeyboardButton{{{Text: "Yes", CallbackData: "yes"}}},
+	}
+	id, err := client.SendMessage(context.Background(), "token", 42, "Pick one", keyboard)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), id)
+}
+
+func TestClient_SendMediaData(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/bottoken/sendPhoto", r.URL.Path)
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		assert.Equal(t, "42", r.FormValue("chat_id"))
+		assert.Equal(t, "A cat", r.FormValue("caption"))
+
+		file, header, err := r.FormFile("photo")
+		require.NoError(t, err)
+		defer func() { _ = file.Close() }()
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, "cat.jpg", header.Filename)
+		assert.Equal(t, []byte("jpeg"), data)
+
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"message_id":8,"chat":{"id":42,"type":"private"}}}`))
+	}))
+	defer server.Close()
+
+	client := telegram.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	id, err := client.SendMediaData(context.Background(), "token", 42, telegram.MediaPhoto, []byte("jpeg"), "cat.jpg", "A cat")
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), id)
+
+	_, err = client.SendMediaData(context.Background(), "token", 42, "sticker", []byte("x"), "", "")
+	assert.ErrorContains(t, err, "unsupported media type")
+}
+
+func TestClient_DownloadFile(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bottoken/getFile":
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, "file-1", body["file_id"])
+			_, _ = w.Write([]byte(`{"ok":true,"result":{"file_id":"file-1","file_size":5,"file_path":"photos/file_1.jpg"}}`))
+		case "/file/bottoken/photos/file_1.jpg":
+			_, _ = w.Write([]byte("hello"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := telegram.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	data, err := client.DownloadFile(context.Background(), "token", "file-1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+}
+
+func TestInlineKeyboardMarkup_ButtonText(t *testing.T) {
+	t.Parallel()
+
+	keyboard := &telegram.InlineKeyboardMarkup{
+		InlineKeyboard: [][]telegram.InlineKeyboardButton{
+			{{Text: "Sales", CallbackData: "sales"}},
+			{{Text: "Support", CallbackData: "support"}, {Text: "Site", URL: "https://example.com"}},
+		},
+	}
+	assert.Equal(t, "Support", keyboard.ButtonText("support"))
+	assert.Equal(t, "", keyboard.ButtonText("billing"))
+
+	var none *telegram.InlineKeyboardMarkup
+	assert.Equal(t, "", none.ButtonText("sales"))
+}
@@ -0,0 +1,126 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// MediaType is a kind of media a bot can send
+type MediaType string
+
+const (
+	MediaPhoto    MediaType = "photo"
+	MediaDocument MediaType = "document"
+	MediaVideo    MediaType = "video"
+	MediaAudio    MediaType = "audio"
+)
+
+// mediaMethods maps media types to the Bot API methods that send them
+var mediaMethods = map[MediaType]string{
+	MediaPhoto:    "sendPhoto",
+	MediaDocument: "sendDocument",
+	MediaVideo:    "sendVideo",
+	MediaAudio:    "sendAudio",
+}
+
+// SendMessage sends a text message, optionally with an inline keyboard, and
+// returns the ID of the sent message
+func (c *Client) SendMessage(ctx context.Context, token string, chatID int64, text string, keyboard *InlineKeyboardMarkup) (int64, error) {
+	params := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	if keyboard != nil {
+		params["reply_markup"] = keyboard
+	}
+
+	var msg Message
+	if err := c.call(ctx, token, "sendMessage", params, &msg); err != nil {
+		return 0, fmt.Errorf("failed to send message: %w", err)
+	}
+	return msg.MessageID, nil
+}
+
+// SendMediaURL sends media Telegram fetches from a public URL
+func (c *Client) SendMediaURL(ctx context.Context, token string, chatID int64, mediaType MediaType, url, caption string) (int64, error) {
+	method, ok := mediaMethods[mediaType]
+	if !ok {
+		return 0, fmt.Errorf("unsupported media type: %s", mediaType)
+	}
+	params := map[string]interface{}{
+		"chat_id":         chatID,
+		string(mediaType): url,
+	}
+	if caption != "" {
+		params["caption"] = caption
+	}
+
+	var msg Message
+	if err := c.call(ctx, token, method, params, &msg); err != nil {
+		return 0, fmt.Errorf("failed to send %s: %w", mediaType, err)
+	}
+	return msg.MessageID, nil
+}
+
+// SendMediaData uploads and sends media
+func (c *Client) SendMediaData(ctx context.Context, token string, chatID int64, mediaType MediaType, data []byte, filename, caption string) (int64, error) {
+	method, ok := mediaMethods[mediaType]
+	if !ok {
+		return 0, fmt.Errorf("unsupported media type: %s", mediaType)
+	}
+	params := map[string]string{
+		"chat_id": strconv.FormatInt(chatID, 10),
+	}
+	if caption != "" {
+		params["caption"] = caption
+	}
+	if filename == "" {
+		filename = string(mediaType)
+	}
+
+	var msg Message
+	if err := c.upload(ctx, token, method, params, string(mediaType), filename, data, &msg); err != nil {
+		return 0, fmt.Errorf("failed to send %s: %w", mediaType, err)
+	}
+	return msg.MessageID, nil
+}
+
+// SendLocation sends a point on the map
+func (c *Client) SendLocation(ctx context.Context, token string, chatID int64, latitude, longitude float64) (int64, error) {
+	params := map[string]interface{}{
+		"chat_id":   chatID,
+		"latitude":  latitude,
+		"longitude": longitude,
+	}
+
+	var msg Message
+	if err := c.call(ctx, token, "sendLocation", params, &msg); err != nil {
+		return 0, fmt.Errorf("failed to send location: %w", err)
+	}
+	return msg.MessageID, nil
+}
+
+// SendChatAction shows an action such as "typing" in the chat for a few seconds
+func (c *Client) SendChatAction(ctx context.Context, token string, chatID int64, action string) error {
+	params := map[string]interface{}{
+		"chat_id": chatID,
+		"action":  action,
+	}
+	if err := c.call(ctx, token, "sendChatAction", params, nil); err != nil {
+		return fmt.Errorf("failed to send chat action: %w", err)
+	}
+	return nil
+}
+
+// AnswerCallbackQuery acknowledges a button tap so the client stops its loading
+// indicator
+func (c *Client) AnswerCallbackQuery(ctx context.Context, token, callbackQueryID string) error {
+	params := map[string]interface{}{
+		"callback_query_id": callbackQueryID,
+	}
+	if err := c.call(ctx, token, "answerCallbackQuery", params, nil); err != nil {
+		return fmt.Errorf("failed to answer callback query: %w", err)
+	}
+	return nil
+}
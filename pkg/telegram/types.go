@@ -0,0 +1,144 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// apiResponse is the envelope every Bot API method answers with
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+}
+
+// APIError is an error answered by the Bot API
+type APIError struct {
+	StatusCode  int
+	Code        int
+	Description string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Description)
+	}
+	return fmt.Sprintf("API error %d: %s", e.Code, e.Description)
+}
+
+// Update is an event the bot receives on its webhook
+type Update struct {
+	UpdateID      int64          `json:"update_id"`
+	Message       *Message       `json:"message,omitempty"`
+	EditedMessage *Message       `json:"edited_message,omitempty"`
+	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+}
+
+// User is a Telegram user or bot
+type User struct {
+	ID        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name,omitempty"`
+	Username  string `json:"username,omitempty"`
+}
+
+// Name returns the user's full name
+func (u *User) Name() string {
+	if u.LastName == "" {
+		return u.FirstName
+	}
+	return u.FirstName + " " + u.LastName
+}
+
+// Chat is a conversation with the bot
+type Chat struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"` // private, group, supergroup or channel
+}
+
+// Message is a message in a chat
+type Message struct {
+	MessageID      int64                 `json:"message_id"`
+	From           *User                 `json:"from,omitempty"`
+	Chat           Chat                  `json:"chat"`
+	Date           int64                 `json:"date"`
+	Text           string                `json:"text,omitempty"`
+	Caption        string                `json:"caption,omitempty"`
+	Photo          []PhotoSize           `json:"photo,omitempty"` // Sizes of the photo, the largest last
+	Document       *FileInfo             `json:"document,omitempty"`
+	Video          *FileInfo             `json:"video,omitempty"`
+	Audio          *FileInfo             `json:"audio,omitempty"`
+	Voice          *FileInfo             `json:"voice,omitempty"`
+	Sticker        *FileInfo             `json:"sticker,omitempty"`
+	Location       *Location             `json:"location,omitempty"`
+	ReplyToMessage *Message              `json:"reply_to_message,omitempty"`
+	ReplyMarkup    *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+// PhotoSize is one size of a photo
+type PhotoSize struct {
+	FileID   string `json:"file_id"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	FileSize int64  `json:"file_size,omitempty"`
+}
+
+// FileInfo is a document, video, audio, voice note or sticker
+type FileInfo struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	FileSize int64  `json:"file_size,omitempty"`
+}
+
+// File is a file ready to be downloaded
+type File struct {
+	FileID   string `json:"file_id"`
+	FileSize int64  `json:"file_size,omitempty"`
+	FilePath string `json:"file_path"`
+}
+
+// Location is a point on the map
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// CallbackQuery is a tap on an inline keyboard button
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	From    User     `json:"from"`
+	Message *Message `json:"message,omitempty"` // The message with the keyboard
+	Data    string   `json:"data,omitempty"`    // The button's callback data
+}
+
+// InlineKeyboardMarkup is a keyboard shown below a message
+type InlineKeyboardMarkup struct {
+	InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+}
+
+// InlineKeyboardButton is a button of an inline keyboard. Tapping it opens URL
+// when set, otherwise it sends CallbackData to the bot.
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"`
+	URL          string `json:"url,omitempty"`
+}
+
+// ButtonText returns the text of the button with the callback data, or "" if the
+// keyboard has none
+func (m *InlineKeyboardMarkup) ButtonText(data string) string {
+	if m == nil {
+		return ""
+	}
+	for _, row := range m.InlineKeyboard {
+		for _, button := range row {
+			if button.CallbackData == data {
+				return button.Text
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package translate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zerodha/logf"
+)
+
+// DefaultTimeout for HTTP requests
+const DefaultTimeout = 15 * time.Second
+
+// MaxTexts is how many texts are translated in one request
+const MaxTexts = 50
+
+// Provider is a machine translation service
+type Provider string
+
+const (
+	ProviderDeepL  Provider = "deepl"
+	ProviderGoogle Provider = "google"
+)
+
+// Translation is a text translated into the target language
+type Translation struct {
+	Text           string
+	SourceLanguage string // ISO 639-1 code detected by the provider, e.g. es
+}
+
+// APIError is an error answered by a provider's API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// Client translates texts with the supported providers
+type Client struct {
+	HTTPClient *http.Client
+	Log        logf.Logger
+	baseURL    string // For testing with mock servers, used instead of the provider's URL
+}
+
+// New creates a new translation client
+func New(log logf.Logger) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log: log,
+	}
+}
+
+// NewWithBaseURL creates a new translation client with a custom base URL (for testing)
+func NewWithBaseURL(log logf.Logger, baseURL string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:     log,
+		baseURL: baseURL,
+	}
+}
+
+// Check verifies the API key can translate
+func (c *Client) Check(ctx context.Context, provider Provider, apiKey string) error {
+	if _, err := c.Translate(ctx, provider, apiKey, []string{"Hello"}, "es"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Translate translates texts into the target ISO 639-1 language, detecting the
+// language they're written in. Translations are in the order of texts.
+func (c *Client) Translate(ctx context.Context, provider Provider, apiKey string, texts []string, target string) ([]Translation, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if len(texts) > MaxTexts {
+		return nil, fmt.Errorf("at most %d texts can be translated at once", MaxTexts)
+	}
+	target = strings.ToLower(strings.TrimSpace(target))
+	if target == "" {
+		return nil, fmt.Errorf("target language is required")
+	}
+
+	var translations []Translation
+	var err error
+	switch provider {
+	case ProviderDeepL:
+		translations, err = c.translateDeepL(ctx, apiKey, texts, target)
+	case ProviderGoogle:
+		translations, err = c.translateGoogle(ctx, apiKey, texts, target)
+	default:
+		return nil, fmt.Errorf("unsupported translation provider: %s", provider)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to translate: %w", err)
+	}
+	if len(translations) != len(texts) {
+		return nil, fmt.Errorf("failed to translate: got %d translations for %d texts", len(translations), len(texts))
+	}
+	return translations, nil
+}
+
+// do performs an API request and decodes the response into result. errorOf
+// extracts the message of a failed response.
+func (c *Client) do(req *http.Request, result interface{}, errorOf func(body []byte) string) error {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		message := errorOf(respBody)
+		if message == "" {
+			message = strings.TrimSpace(string(respBody))
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: message}
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
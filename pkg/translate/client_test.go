@@ -0,0 +1,92 @@
+package translate_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/pkg/translate"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_DeepL(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/translate", r.URL.Path)
+		assert.Equal(t, "DeepL-Auth-Key dl-key:fx", r.Header.Get("Authorization"))
+		var body struct {
+			Text       []string `json:"text"`
+			TargetLang string   `json:"target_lang"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, []string{"¿Dónde está mi pedido?", "Gracias"}, body.Text)
+		assert.Equal(t, "EN-US", body.TargetLang)
+		_, _ = w.Write([]byte(`{"translations":[{"detected_source_language":"ES","text":"Where is my order?"},{"detected_source_language":"ES","text":"Thanks"}]}`))
+	}))
+	defer server.Close()
+
+	client := translate.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	got, err := client.Translate(context.Background(), translate.ProviderDeepL, "dl-key:fx", []string{"¿Dónde está mi pedido?", "Gracias"}, "en")
+	require.NoError(t, err)
+	assert.Equal(t, []translate.Translation{
+		{Text: "Where is my order?", SourceLanguage: "es"},
+		{Text: "Thanks", SourceLanguage: "es"},
+	}, got)
+}
+
+func TestClient_Google(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/language/translate/v2", r.URL.Path)
+		assert.Equal(t, "g-key", r.URL.Query().Get("key"))
+		var body struct {
+			Q      []string `json:"q"`
+			Target string   `json:"target"`
+			Format string   `json:"format"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, []string{"Your order ships today"}, body.Q)
+		assert.Equal(t, "pt", body.Target)
+		assert.Equal(t, "text", body.Format)
+		_, _ = w.Write([]byte(`{"data":{"translations":[{"translatedText":"Seu pedido é enviado hoje","detectedSourceLanguage":"en-US"}]}}`))
+	}))
+	defer server.Close()
+
+	client := translate.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	got, err := client.Translate(context.Background(), translate.ProviderGoogle, "g-key", []string{"Your order ships today"}, "PT")
+	require.NoError(t, err)
+	assert.Equal(t, []translate.Translation{{Text: "Seu pedido é enviado hoje", SourceLanguage: "en"}}, got)
+}
+
+func TestClient_Errors(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"message":"Wrong endpoint. Use https://api.deepl.com"}`))
+	}))
+	defer server.Close()
+
+	client := translate.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	_, err := client.Translate(context.Background(), translate.ProviderDeepL, "dl-key", []string{"hi"}, "es")
+	var apiErr *translate.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.Contains(t, apiErr.Message, "Wrong endpoint")
+
+	_, err = client.Translate(context.Background(), "bing", "key", []string{"hi"}, "es")
+	assert.ErrorContains(t, err, "unsupported translation provider")
+
+	_, err = client.Translate(context.Background(), translate.ProviderDeepL, "key", []string{"hi"}, "")
+	assert.ErrorContains(t, err, "target language is required")
+
+	got, err := client.Translate(context.Background(), translate.ProviderDeepL, "key", nil, "es")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
@@ -0,0 +1,80 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DeepL API URLs. Keys of the free plan end in ":fx" and only work on its own URL.
+const (
+	deeplURL     = "https://api.deepl.com"
+	deeplFreeURL = "https://api-free.deepl.com"
+)
+
+// deeplTargets are the target languages DeepL names with a regional variant
+var deeplTargets = map[string]string{
+	"en": "EN-US",
+	"pt": "PT-BR",
+}
+
+// deeplTarget returns DeepL's code of an ISO 639-1 target language
+func deeplTarget(lang string) string {
+	if code, ok := deeplTargets[lang]; ok {
+		return code
+	}
+	return strings.ToUpper(lang)
+}
+
+// translateDeepL translates texts with DeepL
+func (c *Client) translateDeepL(ctx context.Context, apiKey string, texts []string, target string) ([]Translation, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"text":        texts,
+		"target_lang": deeplTarget(target),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	baseURL := deeplURL
+	if strings.HasSuffix(apiKey, ":fx") {
+		baseURL = deeplFreeURL
+	}
+	if c.baseURL != "" {
+		baseURL = c.baseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/v2/translate", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	var result struct {
+		Translations []struct {
+			DetectedSourceLanguage string `json:"detected_source_language"`
+			Text                   string `json:"text"`
+		} `json:"translations"`
+	}
+	if err := c.do(req, &result, deeplError); err != nil {
+		return nil, err
+	}
+
+	translations := make([]Translation, len(result.Translations))
+	for i, t := range result.Translations {
+		translations[i] = Translation{Text: t.Text, SourceLanguage: strings.ToLower(t.DetectedSourceLanguage)}
+	}
+	return translations, nil
+}
+
+// deeplError extracts the message of a DeepL error response
+func deeplError(body []byte) string {
+	var resp struct {
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	return resp.Message
+}
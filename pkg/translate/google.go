@@ -0,0 +1,68 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// googleURL is the Cloud Translation API's URL
+const googleURL = "https://translation.googleapis.com"
+
+// translateGoogle translates texts with Google Cloud Translation
+func (c *Client) translateGoogle(ctx context.Context, apiKey string, texts []string, target string) ([]Translation, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"q":      texts,
+		"target": target,
+		"format": "text",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	baseURL := googleURL
+	if c.baseURL != "" {
+		baseURL = c.baseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		baseURL+"/language/translate/v2?key="+url.QueryEscape(apiKey), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var result struct {
+		Data struct {
+			Translations []struct {
+				TranslatedText         string `json:"translatedText"`
+				DetectedSourceLanguage string `json:"detectedSourceLanguage"`
+			} `json:"translations"`
+		} `json:"data"`
+	}
+	if err := c.do(req, &result, googleError); err != nil {
+		return nil, err
+	}
+
+	translations := make([]Translation, len(result.Data.Translations))
+	for i, t := range result.Data.Translations {
+		// Detected languages may have a region, e.g. zh-CN
+		source, _, _ := strings.Cut(strings.ToLower(t.DetectedSourceLanguage), "-")
+		translations[i] = Translation{Text: t.TranslatedText, SourceLanguage: source}
+	}
+	return translations, nil
+}
+
+// googleError extracts the message of a Google API error response
+func googleError(body []byte) string {
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	return resp.Error.Message
+}
@@ -0,0 +1,154 @@
+package twilio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zerodha/logf"
+)
+
+const (
+	// DefaultTimeout for HTTP requests
+	DefaultTimeout = 30 * time.Second
+	// BaseURL for the Twilio REST API
+	BaseURL = "https://api.twilio.com"
+	// APIVersion of the Twilio REST API
+	APIVersion = "2010-04-01"
+)
+
+// Client is the Twilio REST API client
+type Client struct {
+	HTTPClient *http.Client
+	Log        logf.Logger
+	baseURL    string // For testing with mock servers
+}
+
+// Account is the Twilio account messages are sent from. Messages are sent from
+// MessagingServiceSID when it's set, and from From otherwise.
+type Account struct {
+	SID                 string
+	AuthToken           string
+	From                string
+	MessagingServiceSID string
+}
+
+// Message is a message as the Messages resource returns it
+type Message struct {
+	SID          string `json:"sid"`
+	Status       string `json:"status"`
+	To           string `json:"to"`
+	From         string `json:"from"`
+	ErrorCode    *int   `json:"error_code"`
+	ErrorMessage string `json:"error_message"`
+}
+
+// APIError is an error answered by the Twilio API
+type APIError struct {
+	StatusCode int
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("API error %d: %s", e.Code, e.Message)
+}
+
+// New creates a new Twilio client
+func New(log logf.Logger) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:     log,
+		baseURL: BaseURL,
+	}
+}
+
+// NewWithBaseURL creates a new Twilio client with a custom base URL (for testing)
+func NewWithBaseURL(log logf.Logger, baseURL string) *Client {
+	return &Client{
+		HTTPClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		Log:     log,
+		baseURL: baseURL,
+	}
+}
+
+// getBaseURL returns the base URL for API requests
+func (c *Client) getBaseURL() string {
+	if c.baseURL != "" {
+		return c.baseURL
+	}
+	return BaseURL
+}
+
+// SendSMS sends an SMS to a phone number in E.164 format and returns the sent
+// message
+func (c *Client) SendSMS(ctx context.Context, account Account, to, body string) (*Message, error) {
+	if account.SID == "" || account.AuthToken == "" {
+		return nil, fmt.Errorf("account SID and auth token are required")
+	}
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("Body", body)
+	switch {
+	case account.MessagingServiceSID != "":
+		form.Set("MessagingServiceSid", account.MessagingServiceSID)
+	case account.From != "":
+		form.Set("From", account.From)
+	default:
+		return nil, fmt.Errorf("a from number or messaging service SID is required")
+	}
+
+	var msg Message
+	path := fmt.Sprintf("/%s/Accounts/%s/Messages.json", APIVersion, url.PathEscape(account.SID))
+	if err := c.post(ctx, account, path, form, &msg); err != nil {
+		return nil, fmt.Errorf("failed to send SMS: %w", err)
+	}
+	return &msg, nil
+}
+
+// post posts form data to an API resource and decodes the response into result
+func (c *Client) post(ctx context.Context, account Account, path string, form url.Values, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.getBaseURL()+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(account.SID, account.AuthToken)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if err := json.Unmarshal(respBody, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = string(respBody)
+		}
+		return apiErr
+	}
+	if result != nil {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package twilio_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/pkg/twilio"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_SendSMS(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/2010-04-01/Accounts/AC123/Messages.json", r.URL.Path)
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "AC123", user)
+		assert.Equal(t, "secret", pass)
+
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "+15551234567", r.PostForm.Get("To"))
+		assert.Equal(t, "+15557654321", r.PostForm.Get("From"))
+		assert.Equal(t, "Your order shipped", r.PostForm.Get("Body"))
+		assert.Empty(t, r.PostForm.Get("MessagingServiceSid"))
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"sid":"SM1","status":"queued","to":"+15551234567","from":"+15557654321"}`))
+	}))
+	defer server.Close()
+
+	client := twilio.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	msg, err := client.SendSMS(context.Background(), twilio.Account{
+		SID:       "AC123",
+		AuthToken: "secret",
+		From:      "+15557654321",
+	}, "+15551234567", "Your order shipped")
+	require.NoError(t, err)
+	assert.Equal(t, "SM1", msg.SID)
+	assert.Equal(t, "queued", msg.Status)
+}
+
+func TestClient_SendSMS_MessagingService(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "MG1", r.PostForm.Get("MessagingServiceSid"))
+		assert.Empty(t, r.PostForm.Get("From"))
+		_, _ = w.Write([]byte(`{"sid":"SM2","status":"accepted"}`))
+	}))
+	defer server.Close()
+
+	client := twilio.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	msg, err := client.SendSMS(context.Background(), twilio.Account{
+		SID:                 "AC123",
+		AuthToken:           "secret",
+		From:                "+15557654321",
+		MessagingServiceSID: "MG1",
+	}, "+15551234567", "Hi")
+	require.NoError(t, err)
+	assert.Equal(t, "SM2", msg.SID)
+}
+
+func TestClient_SendSMS_APIError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"code":21211,"message":"The 'To' number is not a valid phone number.","status":400}`))
+	}))
+	defer server.Close()
+
+	client := twilio.NewWithBaseURL(testutil.NopLogger(), server.URL)
+	_, err := client.SendSMS(context.Background(), twilio.Account{SID: "AC123", AuthToken: "secret", From: "+1555"}, "bad", "Hi")
+	require.Error(t, err)
+
+	var apiErr *twilio.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 21211, apiErr.Code)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+}
+
+func TestClient_SendSMS_RequiresSender(t *testing.T) {
+	t.Parallel()
+
+	client := twilio.New(testutil.NopLogger())
+	_, err := client.SendSMS(context.Background(), twilio.Account{SID: "AC123", AuthToken: "secret"}, "+15551234567", "Hi")
+	require.Error(t, err)
+}
@@ -0,0 +1,74 @@
+package whatsapp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// API types a number can be connected through
+const (
+	// APITypeCloud is Meta's Cloud API, the default
+	APITypeCloud = "cloud"
+	// APITypeOnPremise is the On-Premise API, run by the business or a BSP
+	APITypeOnPremise = "on_premise"
+)
+
+// API is the WhatsApp Business API a number sends messages and media through.
+// Numbers are on the Cloud API unless their account's APIType says otherwise.
+// Templates, flows, catalogs and the rest of the WhatsApp Business Account are
+// managed through the Graph API whichever API a number is on.
+type API interface {
+	// PostMessage posts a message payload in the Cloud API's format, including read
+	// receipts, and returns the response body: a MetaAPIResponse for messages
+	PostMessage(ctx context.Context, account *Account, payload map[string]interface{}) ([]byte, error)
+	// UploadMedia uploads media for the number to send and returns its media ID
+	UploadMedia(ctx context.Context, account *Account, data []byte, mimeType, filename string) (string, error)
+	// FetchMedia downloads media the number received
+	FetchMedia(ctx context.Context, account *Account, mediaID string) ([]byte, error)
+}
+
+// API returns the API an account's number is connected through
+func (c *Client) API(account *Account) API {
+	if account.APIType == APITypeOnPremise {
+		return onPremiseAPI{c}
+	}
+	return cloudAPI{c}
+}
+
+// ValidAPIType reports whether apiType is an API numbers can be connected through.
+// Empty is the Cloud API.
+func ValidAPIType(apiType string) bool {
+	return apiType == "" || apiType == APITypeCloud || apiType == APITypeOnPremise
+}
+
+// postMessage posts a message payload through the number's API
+func (c *Client) postMessage(ctx context.Context, account *Account, payload map[string]interface{}) ([]byte, error) {
+	return c.API(account).PostMessage(ctx, account, payload)
+}
+
+// FetchMedia downloads media the number received, through the number's API
+func (c *Client) FetchMedia(ctx context.Context, account *Account, mediaID string) ([]byte, error) {
+	return c.API(account).FetchMedia(ctx, account, mediaID)
+}
+
+// cloudAPI sends through Meta's Cloud API
+type cloudAPI struct {
+	c *Client
+}
+
+func (api cloudAPI) PostMessage(ctx context.Context, account *Account, payload map[string]interface{}) ([]byte, error) {
+	return api.c.doRequest(ctx, http.MethodPost, api.c.buildMessagesURL(account), payload, account.AccessToken)
+}
+
+func (api cloudAPI) UploadMedia(ctx context.Context, account *Account, data []byte, mimeType, filename string) (string, error) {
+	return api.c.uploadCloudMedia(ctx, account, data, mimeType, filename)
+}
+
+func (api cloudAPI) FetchMedia(ctx context.Context, account *Account, mediaID string) ([]byte, error) {
+	mediaURL, err := api.c.GetMediaURL(ctx, mediaID, account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media URL: %w", err)
+	}
+	return api.c.DownloadMedia(ctx, mediaURL, account.AccessToken)
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
 // buildCatalogsURL builds the catalogs endpoint URL for a business
@@ -72,26 +73,37 @@ func (c *Client) DeleteCatalog(ctx context.Context, account *Account, catalogID
 	return err
 }
 
-// ListCatalogProducts lists all products in a catalog
+// ListCatalogProducts lists all products in a catalog, following pagination
 func (c *Client) ListCatalogProducts(ctx context.Context, account *Account, catalogID string) ([]ProductInfo, error) {
-	apiURL := c.buildCatalogProductsURL(account, catalogID)
-
-	// Add fields parameter to get all product details
-	params := url.Values{}
-	params.Add("fields", "id,name,price,currency,url,image_url,retailer_id,description")
-	apiURL = apiURL + "?" + params.Encode()
-
-	respBody, err := c.doRequest(ctx, http.MethodGet, apiURL, nil, account.AccessToken)
-	if err != nil {
-		return nil, err
-	}
-
-	var resp ProductListResponse
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	var products []ProductInfo
+	after := ""
+	for {
+		// Add fields parameter to get all product details
+		params := url.Values{}
+		params.Add("fields", "id,name,price,currency,url,image_url,retailer_id,description,availability")
+		params.Add("limit", "100")
+		if after != "" {
+			params.Add("after", after)
+		}
+		apiURL := c.buildCatalogProductsURL(account, catalogID) + "?" + params.Encode()
+
+		respBody, err := c.doRequest(ctx, http.MethodGet, apiURL, nil, account.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+
+		var resp ProductListResponse
+		if err := json.Unmarshal(respBody, &resp); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		products = append(products, resp.Data...)
+
+		// Meta only returns a next link when there are more pages
+		if resp.Paging.Next == "" || resp.Paging.Cursors.After == "" {
+			return products, nil
+		}
+		after = resp.Paging.Cursors.After
 	}
-
-	return resp.Data, nil
 }
 
 // CreateProduct adds a product to a catalog
@@ -163,3 +175,178 @@ func (c *Client) DeleteProduct(ctx context.Context, account *Account, productID
 	_, err := c.doRequest(ctx, http.MethodDelete, apiURL, nil, account.AccessToken)
 	return err
 }
+
+// SendProductMessage sends an interactive single product message for the product
+// with the given retailer ID (SKU) in a catalog
+func (c *Client) SendProductMessage(ctx context.Context, account *Account, phoneNumber, catalogID, retailerID, bodyText, footerText string) (string, error) {
+	if catalogID == "" || retailerID == "" {
+		return "", fmt.Errorf("catalog ID and product retailer ID are required")
+	}
+
+	interactive := map[string]interface{}{
+		"type": "product",
+		"action": map[string]interface{}{
+			"catalog_id":          catalogID,
+			"product_retailer_id": retailerID,
+		},
+	}
+	if bodyText != "" {
+		interactive["body"] = map[string]interface{}{"text": bodyText}
+	}
+	if footerText != "" {
+		interactive["footer"] = map[string]interface{}{"text": footerText}
+	}
+
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                phoneNumber,
+		"type":              "interactive",
+		"interactive":       interactive,
+	}
+
+	c.Log.Debug("Sending product message", "phone", phoneNumber, "catalog_id", catalogID, "retailer_id", retailerID)
+
+	respBody, err := c.postMessage(ctx, account, payload)
+	if err != nil {
+		c.Log.Error("Failed to send product message", "error", err, "phone", phoneNumber)
+		return "", fmt.Errorf("failed to send product message: %w", err)
+	}
+
+	var resp MetaAPIResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(resp.Messages) == 0 {
+		return "", fmt.Errorf("no message ID in response")
+	}
+
+	messageID := resp.Messages[0].ID
+	c.Log.Info("Product message sent", "message_id", messageID, "phone", phoneNumber, "retailer_id", retailerID)
+	return messageID, nil
+}
+
+// WhatsApp's limits on multi-product messages
+const (
+	MaxProductListItems        = 30 // Products across all sections
+	MaxProductListSections     = 10
+	MaxProductListHeader       = 60
+	MaxProductListBody         = 1024
+	MaxProductListFooter       = 60
+	MaxProductListSectionTitle = 24
+)
+
+// Validate checks a multi-product message against WhatsApp's limits, so it's
+// rejected before it's sent rather than by the API
+func (p ProductListMessage) Validate() error {
+	if p.CatalogID == "" {
+		return fmt.Errorf("catalog ID is required")
+	}
+	if strings.TrimSpace(p.Header) == "" {
+		return fmt.Errorf("product list header is required")
+	}
+	if err := checkLength("product list header", p.Header, MaxProductListHeader); err != nil {
+		return err
+	}
+	if strings.TrimSpace(p.Body) == "" {
+		return fmt.Errorf("product list body is required")
+	}
+	if err := checkLength("product list body", p.Body, MaxProductListBody); err != nil {
+		return err
+	}
+	if err := checkLength("product list footer", p.Footer, MaxProductListFooter); err != nil {
+		return err
+	}
+	if len(p.Sections) == 0 {
+		return fmt.Errorf("at least one product section is required")
+	}
+	if len(p.Sections) > MaxProductListSections {
+		return fmt.Errorf("maximum %d product sections allowed", MaxProductListSections)
+	}
+
+	items := 0
+	for _, section := range p.Sections {
+		if strings.TrimSpace(section.Title) == "" {
+			return fmt.Errorf("every product section needs a title")
+		}
+		if err := checkLength("section title", section.Title, MaxProductListSectionTitle); err != nil {
+			return err
+		}
+		if len(section.RetailerIDs) == 0 {
+			return fmt.Errorf("section %q has no products", section.Title)
+		}
+		items += len(section.RetailerIDs)
+	}
+	if items > MaxProductListItems {
+		return fmt.Errorf("maximum %d products allowed", MaxProductListItems)
+	}
+	return nil
+}
+
+// SendProductListMessage sends an interactive multi-product message with sections
+// of products, by retailer ID (SKU), from a catalog
+func (c *Client) SendProductListMessage(ctx context.Context, account *Account, phoneNumber string, list ProductListMessage) (string, error) {
+	if err := list.Validate(); err != nil {
+		return "", err
+	}
+
+	sections := make([]map[string]interface{}, 0, len(list.Sections))
+	for _, section := range list.Sections {
+		items := make([]map[string]interface{}, 0, len(section.RetailerIDs))
+		for _, retailerID := range section.RetailerIDs {
+			items = append(items, map[string]interface{}{"product_retailer_id": retailerID})
+		}
+		sections = append(sections, map[string]interface{}{
+			"title":         section.Title,
+			"product_items": items,
+		})
+	}
+
+	interactive := map[string]interface{}{
+		"type": "product_list",
+		"header": map[string]interface{}{
+			"type": "text",
+			"text": list.Header,
+		},
+		"body": map[string]interface{}{
+			"text": list.Body,
+		},
+		"action": map[string]interface{}{
+			"catalog_id": list.CatalogID,
+			"sections":   sections,
+		},
+	}
+	if list.Footer != "" {
+		interactive["footer"] = map[string]interface{}{"text": list.Footer}
+	}
+
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                phoneNumber,
+		"type":              "interactive",
+		"interactive":       interactive,
+	}
+
+	c.Log.Debug("Sending product list message", "phone", phoneNumber, "catalog_id", list.CatalogID, "sections", len(sections))
+
+	respBody, err := c.postMessage(ctx, account, payload)
+	if err != nil {
+		c.Log.Error("Failed to send product list message", "error", err, "phone", phoneNumber)
+		return "", fmt.Errorf("failed to send product list message: %w", err)
+	}
+
+	var resp MetaAPIResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(resp.Messages) == 0 {
+		return "", fmt.Errorf("no message ID in response")
+	}
+
+	messageID := resp.Messages[0].ID
+	c.Log.Info("Product list message sent", "message_id", messageID, "phone", phoneNumber)
+	return messageID, nil
+}
@@ -83,7 +83,9 @@ func (c *Client) doRequest(ctx context.Context, method, url string, body interfa
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.HTTPClient.Do(req)
@@ -100,16 +102,16 @@ func (c *Client) doRequest(ctx context.Context, method, url string, body interfa
 	if resp.StatusCode != http.StatusOK {
 		var apiErr MetaAPIError
 		if err := json.Unmarshal(respBody, &apiErr); err == nil && apiErr.Error.Message != "" {
-			errMsg := fmt.Sprintf("API error %d: %s", apiErr.Error.Code, apiErr.Error.Message)
-			if apiErr.Error.ErrorData.Details != "" {
-				errMsg += " - Details: " + apiErr.Error.ErrorData.Details
-			}
-			if apiErr.Error.ErrorUserMsg != "" {
-				errMsg += " - " + apiErr.Error.ErrorUserMsg
+			return nil, &APIError{
+				StatusCode: resp.StatusCode,
+				Code:       apiErr.Error.Code,
+				Subcode:    apiErr.Error.ErrorSubcode,
+				Message:    apiErr.Error.Message,
+				Details:    apiErr.Error.ErrorData.Details,
+				UserMsg:    apiErr.Error.ErrorUserMsg,
 			}
-			return nil, fmt.Errorf("%s", errMsg)
 		}
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(respBody))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: string(respBody)}
 	}
 
 	return respBody, nil
@@ -134,7 +136,8 @@ type MediaURLResponse struct {
 	MessagingProduct string `json:"messaging_product"`
 }
 
-// GetMediaURL retrieves the download URL for a media file from Meta's API
+// GetMediaURL retrieves the download URL for a media file from Meta's API. Media of
+// numbers on the On-Premise API is fetched with FetchMedia.
 func (c *Client) GetMediaURL(ctx context.Context, mediaID string, account *Account) (string, error) {
 	url := fmt.Sprintf("%s/%s/%s", c.getBaseURL(), account.APIVersion, mediaID)
 
@@ -188,8 +191,13 @@ type UploadMediaResponse struct {
 	ID string `json:"id"`
 }
 
-// UploadMedia uploads media to WhatsApp's servers and returns the media ID
+// UploadMedia uploads media to the number's API and returns the media ID
 func (c *Client) UploadMedia(ctx context.Context, account *Account, data []byte, mimeType, filename string) (string, error) {
+	return c.API(account).UploadMedia(ctx, account, data, mimeType, filename)
+}
+
+// uploadCloudMedia uploads media to the Cloud API and returns the media ID
+func (c *Client) uploadCloudMedia(ctx context.Context, account *Account, data []byte, mimeType, filename string) (string, error) {
 	url := fmt.Sprintf("%s/%s/%s/media", c.getBaseURL(), account.APIVersion, account.PhoneID)
 
 	// Create multipart form body
@@ -247,161 +255,62 @@ func (c *Client) UploadMedia(ctx context.Context, account *Account, data []byte,
 
 // SendImageMessage sends an image message using a media ID
 func (c *Client) SendImageMessage(ctx context.Context, account *Account, phoneNumber, mediaID, caption string) (string, error) {
-	payload := map[string]interface{}{
-		"messaging_product": "whatsapp",
-		"recipient_type":    "individual",
-		"to":                phoneNumber,
-		"type":              "image",
-		"image": map[string]interface{}{
-			"id":      mediaID,
-			"caption": caption,
-		},
-	}
-
-	url := c.buildMessagesURL(account)
-	c.Log.Debug("Sending image message", "phone", phoneNumber, "media_id", mediaID)
-
-	respBody, err := c.doRequest(ctx, "POST", url, payload, account.AccessToken)
-	if err != nil {
-		return "", fmt.Errorf("failed to send image message: %w", err)
-	}
-
-	var resp MetaAPIResponse
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	if len(resp.Messages) == 0 {
-		return "", fmt.Errorf("no message ID in response")
-	}
-
-	messageID := resp.Messages[0].ID
-	c.Log.Info("Image message sent", "message_id", messageID, "phone", phoneNumber)
-	return messageID, nil
+	return c.SendMediaMessage(ctx, account, phoneNumber, MediaMessage{Type: MediaTypeImage, ID: mediaID, Caption: caption})
 }
 
 // SendDocumentMessage sends a document message using a media ID
 func (c *Client) SendDocumentMessage(ctx context.Context, account *Account, phoneNumber, mediaID, filename, caption string) (string, error) {
-	payload := map[string]interface{}{
-		"messaging_product": "whatsapp",
-		"recipient_type":    "individual",
-		"to":                phoneNumber,
-		"type":              "document",
-		"document": map[string]interface{}{
-			"id":       mediaID,
-			"filename": filename,
-			"caption":  caption,
-		},
-	}
-
-	url := c.buildMessagesURL(account)
-	c.Log.Debug("Sending document message", "phone", phoneNumber, "media_id", mediaID)
-
-	respBody, err := c.doRequest(ctx, "POST", url, payload, account.AccessToken)
-	if err != nil {
-		return "", fmt.Errorf("failed to send document message: %w", err)
-	}
-
-	var resp MetaAPIResponse
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	if len(resp.Messages) == 0 {
-		return "", fmt.Errorf("no message ID in response")
-	}
-
-	messageID := resp.Messages[0].ID
-	c.Log.Info("Document message sent", "message_id", messageID, "phone", phoneNumber)
-	return messageID, nil
+	return c.SendMediaMessage(ctx, account, phoneNumber, MediaMessage{Type: MediaTypeDocument, ID: mediaID, Filename: filename, Caption: caption})
 }
 
 // SendVideoMessage sends a video message using a media ID
 func (c *Client) SendVideoMessage(ctx context.Context, account *Account, phoneNumber, mediaID, caption string) (string, error) {
-	payload := map[string]interface{}{
-		"messaging_product": "whatsapp",
-		"recipient_type":    "individual",
-		"to":                phoneNumber,
-		"type":              "video",
-		"video": map[string]interface{}{
-			"id":      mediaID,
-			"caption": caption,
-		},
-	}
-
-	url := c.buildMessagesURL(account)
-	c.Log.Debug("Sending video message", "phone", phoneNumber, "media_id", mediaID)
-
-	respBody, err := c.doRequest(ctx, "POST", url, payload, account.AccessToken)
-	if err != nil {
-		return "", fmt.Errorf("failed to send video message: %w", err)
-	}
-
-	var resp MetaAPIResponse
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	if len(resp.Messages) == 0 {
-		return "", fmt.Errorf("no message ID in response")
-	}
-
-	messageID := resp.Messages[0].ID
-	c.Log.Info("Video message sent", "message_id", messageID, "phone", phoneNumber)
-	return messageID, nil
+	return c.SendMediaMessage(ctx, account, phoneNumber, MediaMessage{Type: MediaTypeVideo, ID: mediaID, Caption: caption})
 }
 
 // SendAudioMessage sends an audio message using a media ID
 func (c *Client) SendAudioMessage(ctx context.Context, account *Account, phoneNumber, mediaID string) (string, error) {
+	return c.SendMediaMessage(ctx, account, phoneNumber, MediaMessage{Type: MediaTypeAudio, ID: mediaID})
+}
+
+// MarkMessageRead sends a read receipt for a message
+func (c *Client) MarkMessageRead(ctx context.Context, account *Account, messageID string) error {
 	payload := map[string]interface{}{
 		"messaging_product": "whatsapp",
-		"recipient_type":    "individual",
-		"to":                phoneNumber,
-		"type":              "audio",
-		"audio": map[string]interface{}{
-			"id": mediaID,
-		},
+		"status":            "read",
+		"message_id":        messageID,
 	}
 
-	url := c.buildMessagesURL(account)
-	c.Log.Debug("Sending audio message", "phone", phoneNumber, "media_id", mediaID)
+	c.Log.Debug("Sending read receipt", "message_id", messageID)
 
-	respBody, err := c.doRequest(ctx, "POST", url, payload, account.AccessToken)
+	_, err := c.postMessage(ctx, account, payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to send audio message: %w", err)
-	}
-
-	var resp MetaAPIResponse
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	if len(resp.Messages) == 0 {
-		return "", fmt.Errorf("no message ID in response")
+		return fmt.Errorf("failed to send read receipt: %w", err)
 	}
 
-	messageID := resp.Messages[0].ID
-	c.Log.Info("Audio message sent", "message_id", messageID, "phone", phoneNumber)
-	return messageID, nil
+	c.Log.Debug("Read receipt sent", "message_id", messageID)
+	return nil
 }
 
-// MarkMessageRead sends a read receipt for a message
-func (c *Client) MarkMessageRead(ctx context.Context, account *Account, messageID string) error {
+// SendTypingIndicator shows the customer a typing indicator in reply to a message.
+// WhatsApp marks the message as read too, and clears the indicator when a reply is
+// sent or after 25 seconds.
+func (c *Client) SendTypingIndicator(ctx context.Context, account *Account, messageID string) error {
 	payload := map[string]interface{}{
 		"messaging_product": "whatsapp",
 		"status":            "read",
 		"message_id":        messageID,
+		"typing_indicator": map[string]string{
+			"type": "text",
+		},
 	}
 
-	url := c.buildMessagesURL(account)
-	c.Log.Debug("Sending read receipt", "message_id", messageID)
+	c.Log.Debug("Sending typing indicator", "message_id", messageID)
 
-	_, err := c.doRequest(ctx, "POST", url, payload, account.AccessToken)
+	_, err := c.postMessage(ctx, account, payload)
 	if err != nil {
-		return fmt.Errorf("failed to send read receipt: %w", err)
+		return fmt.Errorf("failed to send typing indicator: %w", err)
 	}
-
-	c.Log.Debug("Read receipt sent", "message_id", messageID)
 	return nil
 }
 
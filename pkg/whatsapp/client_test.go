@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -395,6 +397,32 @@ func TestClient_MarkMessageRead(t *testing.T) {
 	}
 }
 
+func TestClient_SendTypingIndicator(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, "read", body["status"])
+		assert.Equal(t, "wamid.test123", body["message_id"])
+		assert.Equal(t, map[string]interface{}{"type": "text"}, body["typing_indicator"])
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	err := client.SendTypingIndicator(testutil.TestContext(t), testAccount(server.URL), "wamid.test123")
+	require.NoError(t, err)
+}
+
 func TestClient_SendImageMessage(t *testing.T) {
 	t.Parallel()
 
@@ -464,6 +492,201 @@ func TestClient_SendDocumentMessage(t *testing.T) {
 	assert.Equal(t, "wamid.doc123", msgID)
 }
 
+func TestClient_SendMediaMessage_Link(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		assert.Equal(t, "audio", body["type"])
+		audio := body["audio"].(map[string]interface{})
+		assert.Equal(t, "https://example.com/note.ogg", audio["link"])
+		assert.NotContains(t, audio, "id")
+		assert.NotContains(t, audio, "caption", "audio messages have no caption")
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages": []map[string]string{{"id": "wamid.audio123"}},
+		})
+	}))
+	defer server.Close()
+
+	log := testutil.NopLogger()
+	client := whatsapp.NewWithTimeout(log, 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	msgID, err := client.SendMediaMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", whatsapp.MediaMessage{
+		Type:    whatsapp.MediaTypeAudio,
+		Link:    "https://example.com/note.ogg",
+		Caption: "ignored",
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "wamid.audio123", msgID)
+}
+
+func TestMediaMessage_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		media   whatsapp.MediaMessage
+		wantErr string
+	}{
+		{"by ID", whatsapp.MediaMessage{Type: "image", ID: "media123"}, ""},
+		{"by link", whatsapp.MediaMessage{Type: "document", Link: "https://example.com/a.pdf"}, ""},
+		{"unknown type", whatsapp.MediaMessage{Type: "sticker", ID: "media123"}, "unsupported media type"},
+		{"no media", whatsapp.MediaMessage{Type: "image"}, "either a media ID or a link"},
+		{"ID and link", whatsapp.MediaMessage{Type: "image", ID: "media123", Link: "https://example.com/a.jpg"}, "either a media ID or a link"},
+		{"bad link", whatsapp.MediaMessage{Type: "image", Link: "ftp://example.com/a.jpg"}, "http or https URL"},
+		{"long caption", whatsapp.MediaMessage{Type: "image", ID: "media123", Caption: strings.Repeat("a", 1025)}, "caption is 1025 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.media.Validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateMedia(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, whatsapp.ValidateMedia("image", "image/jpeg", 1<<20))
+	assert.NoError(t, whatsapp.ValidateMedia("audio", "audio/ogg; codecs=opus", 1<<20))
+	assert.NoError(t, whatsapp.ValidateMedia("document", "application/pdf", 100<<20))
+	assert.ErrorContains(t, whatsapp.ValidateMedia("image", "image/webp", 1<<20), "supported types are image/jpeg, image/png")
+	assert.ErrorContains(t, whatsapp.ValidateMedia("image", "image/png", 6<<20), "image is 6 MB, the maximum is 5 MB")
+	assert.ErrorContains(t, whatsapp.ValidateMedia("video", "video/mp4", 16<<20+1), "the maximum is 16 MB")
+	assert.ErrorContains(t, whatsapp.ValidateMedia("location", "text/plain", 1), "unsupported media type")
+	assert.Equal(t, int64(5<<20), whatsapp.MaxMediaSize("image"))
+}
+
+func TestClient_SendLocationMessage(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		assert.Equal(t, "location", body["type"])
+		location := body["location"].(map[string]interface{})
+		assert.Equal(t, 40.7128, location["latitude"])
+		assert.Equal(t, -74.006, location["longitude"])
+		assert.Equal(t, "Downtown Store", location["name"])
+		assert.NotContains(t, location, "address")
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages": []map[string]string{{"id": "wamid.loc123"}},
+		})
+	}))
+	defer server.Close()
+
+	log := testutil.NopLogger()
+	client := whatsapp.NewWithTimeout(log, 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	msgID, err := client.SendLocationMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", whatsapp.Location{
+		Latitude:  40.7128,
+		Longitude: -74.006,
+		Name:      "Downtown Store",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "wamid.loc123", msgID)
+
+	_, err = client.SendLocationMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", whatsapp.Location{Latitude: 91})
+	assert.ErrorContains(t, err, "latitude must be between -90 and 90")
+}
+
+func TestClient_SendReaction(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		assert.Equal(t, "reaction", body["type"])
+		reaction := body["reaction"].(map[string]interface{})
+		assert.Equal(t, "wamid.customer1", reaction["message_id"])
+		assert.Equal(t, "👍", reaction["emoji"])
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages": []map[string]string{{"id": "wamid.react123"}},
+		})
+	}))
+	defer server.Close()
+
+	log := testutil.NopLogger()
+	client := whatsapp.NewWithTimeout(log, 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	reactionID, err := client.SendReaction(testutil.TestContext(t), testAccount(server.URL), "1234567890", "wamid.customer1", "👍")
+	require.NoError(t, err)
+	assert.Equal(t, "wamid.react123", reactionID)
+
+	_, err = client.SendReaction(testutil.TestContext(t), testAccount(server.URL), "1234567890", "", "👍")
+	assert.ErrorContains(t, err, "message ID is required")
+}
+
+func TestClient_SendContactsMessage(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		assert.Equal(t, "contacts", body["type"])
+		contacts := body["contacts"].([]interface{})
+		require.Len(t, contacts, 1)
+		contact := contacts[0].(map[string]interface{})
+		assert.Equal(t, map[string]interface{}{"formatted_name": "Ana Ruiz", "first_name": "Ana Ruiz"}, contact["name"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"phone": "+34 600 000 000", "type": "WORK"}}, contact["phones"])
+		assert.Equal(t, map[string]interface{}{"company": "Acme"}, contact["org"])
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages": []map[string]string{{"id": "wamid.vcard123"}},
+		})
+	}))
+	defer server.Close()
+
+	log := testutil.NopLogger()
+	client := whatsapp.NewWithTimeout(log, 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	msgID, err := client.SendContactsMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", []whatsapp.ContactCard{{
+		Name:   whatsapp.ContactCardName{FormattedName: "Ana Ruiz"},
+		Phones: []whatsapp.ContactCardPhone{{Phone: "+34 600 000 000", Type: "WORK"}},
+		Org:    &whatsapp.ContactCardOrg{Company: "Acme"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "wamid.vcard123", msgID)
+
+	_, err = client.SendContactsMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", []whatsapp.ContactCard{{
+		Name: whatsapp.ContactCardName{FormattedName: "Ana Ruiz"},
+	}})
+	assert.ErrorContains(t, err, `contact "Ana Ruiz" needs a phone number`)
+
+	_, err = client.SendContactsMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", nil)
+	assert.ErrorContains(t, err, "at least one contact is required")
+}
+
 // testServerTransport redirects all requests to the test server
 type testServerTransport struct {
 	serverURL string
@@ -476,3 +699,394 @@ func (t *testServerTransport) RoundTrip(req *http.Request) (*http.Response, erro
 	testReq.URL.Host = t.serverURL[7:] // Remove "http://"
 	return http.DefaultTransport.RoundTrip(testReq)
 }
+
+func TestClient_CreateGroup(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v21.0/123456789/groups", r.URL.Path)
+
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, "Order updates", body["subject"])
+		assert.Equal(t, "Delivery notices for regulars", body["description"])
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": "group123"})
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	groupID, err := client.CreateGroup(testutil.TestContext(t), testAccount(server.URL), "Order updates", "Delivery notices for regulars")
+	require.NoError(t, err)
+	assert.Equal(t, "group123", groupID)
+}
+
+func TestClient_SendGroupTextMessage(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, "group", body["recipient_type"])
+		assert.Equal(t, "group123", body["to"])
+		assert.Equal(t, "Store opens at 9", body["text"].(map[string]interface{})["body"])
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages": []map[string]string{{"id": "wamid.group123"}},
+		})
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	messageID, err := client.SendGroupTextMessage(testutil.TestContext(t), testAccount(server.URL), "group123", "Store opens at 9")
+	require.NoError(t, err)
+	assert.Equal(t, "wamid.group123", messageID)
+}
+
+func TestClient_GetBusinessProfile(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/v21.0/123456789/whatsapp_business_profile", r.URL.Path)
+		assert.Contains(t, r.URL.Query().Get("fields"), "profile_picture_url")
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]interface{}{{
+				"about":    "Fresh bread daily",
+				"email":    "hello@example.com",
+				"websites": []string{"https://example.com"},
+				"vertical": "GROCERY",
+			}},
+		})
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	profile, err := client.GetBusinessProfile(testutil.TestContext(t), testAccount(server.URL))
+	require.NoError(t, err)
+	assert.Equal(t, "Fresh bread daily", profile.About)
+	assert.Equal(t, "hello@example.com", profile.Email)
+	assert.Equal(t, []string{"https://example.com"}, profile.Websites)
+	assert.Equal(t, "GROCERY", profile.Vertical)
+}
+
+func TestClient_UpdateBusinessProfile(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, "whatsapp", body["messaging_product"])
+		assert.Equal(t, "Open 7am to 7pm", body["about"])
+		assert.Equal(t, "4::aW1hZ2U", body["profile_picture_handle"])
+		// Fields not being changed are left out
+		assert.NotContains(t, body, "email")
+		assert.NotContains(t, body, "websites")
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	about := "Open 7am to 7pm"
+	err := client.UpdateBusinessProfile(testutil.TestContext(t), testAccount(server.URL), whatsapp.BusinessProfileUpdate{
+		About:                &about,
+		ProfilePictureHandle: "4::aW1hZ2U",
+	})
+	require.NoError(t, err)
+}
+
+func TestClient_GetPhoneNumber(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/v21.0/123456789", r.URL.Path)
+		assert.Contains(t, r.URL.Query().Get("fields"), "quality_rating")
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"display_phone_number": "+1 555-123-4567",
+			"quality_rating":       "YELLOW",
+			"messaging_limit_tier": "TIER_1K",
+			"status":               "CONNECTED",
+		})
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	phone, err := client.GetPhoneNumber(testutil.TestContext(t), testAccount(server.URL))
+	require.NoError(t, err)
+	assert.Equal(t, "+1 555-123-4567", phone.DisplayPhoneNumber)
+	assert.Equal(t, "YELLOW", phone.QualityRating)
+	assert.Equal(t, "TIER_1K", phone.MessagingLimitTier)
+	assert.Equal(t, "CONNECTED", phone.Status)
+}
+
+func TestClient_APIError(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]interface{}{
+				"message":    "(#130429) Rate limit hit",
+				"code":       130429,
+				"error_data": map[string]string{"details": "Cloud API message throughput has been reached."},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	_, err := client.SendTextMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", "Hello")
+	require.Error(t, err)
+
+	var apiErr *whatsapp.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, 130429, apiErr.Code)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Contains(t, err.Error(), "API error 130429: (#130429) Rate limit hit - Details: Cloud API message throughput has been reached.")
+}
+
+func TestClient_ExchangeCode(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/v21.0/oauth/access_token", r.URL.Path)
+		assert.Equal(t, "app-id", r.URL.Query().Get("client_id"))
+		assert.Equal(t, "app-secret", r.URL.Query().Get("client_secret"))
+		assert.Equal(t, "signup-code", r.URL.Query().Get("code"))
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "business-token",
+			"token_type":   "bearer",
+		})
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	token, err := client.ExchangeCode(testutil.TestContext(t), "app-id", "app-secret", "v21.0", "signup-code")
+	require.NoError(t, err)
+	assert.Equal(t, "business-token", token)
+}
+
+func TestClient_SubscribeApp(t *testing.T) {
+	t.Parallel()
+
+	var body map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v21.0/987654321/subscribed_apps", r.URL.Path)
+		assert.Equal(t, "Bearer test-access-token", r.Header.Get("Authorization"))
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	err := client.SubscribeApp(testutil.TestContext(t), testAccount(server.URL), "https://chat.example.com/api/webhook", "verify-token")
+	require.NoError(t, err)
+	assert.Equal(t, "https://chat.example.com/api/webhook", body["override_callback_uri"])
+	assert.Equal(t, "verify-token", body["verify_token"])
+}
+
+func TestClient_RegisterPhoneNumber(t *testing.T) {
+	t.Parallel()
+
+	var body map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v21.0/123456789/register", r.URL.Path)
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	err := client.RegisterPhoneNumber(testutil.TestContext(t), testAccount(server.URL), "123456")
+	require.NoError(t, err)
+	assert.Equal(t, "whatsapp", body["messaging_product"])
+	assert.Equal(t, "123456", body["pin"])
+}
+
+func TestClient_ListCatalogProducts_FollowsPages(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/v21.0/555/products", r.URL.Path)
+		assert.Contains(t, r.URL.Query().Get("fields"), "availability")
+
+		w.WriteHeader(http.StatusOK)
+		if r.URL.Query().Get("after") == "" {
+			_, _ = w.Write([]byte(`{"data":[{"id":"p1","retailer_id":"SKU-1","price":"$10.00","availability":"in stock"}],"paging":{"cursors":{"after":"c1"},"next":"https://graph.facebook.com/next"}}`))
+			return
+		}
+		assert.Equal(t, "c1", r.URL.Query().Get("after"))
+		_, _ = w.Write([]byte(`{"data":[{"id":"p2","retailer_id":"SKU-2","price":"$5.50","availability":"out of stock"}],"paging":{"cursors":{"after":"c2"}}}`))
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	products, err := client.ListCatalogProducts(testutil.TestContext(t), testAccount(server.URL), "555")
+	require.NoError(t, err)
+	require.Len(t, products, 2)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, "SKU-1", products[0].RetailerID)
+	assert.Equal(t, "out of stock", products[1].Availability)
+}
+
+func TestClient_SendProductMessage(t *testing.T) {
+	t.Parallel()
+
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v21.0/123456789/messages", r.URL.Path)
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"messages":[{"id":"wamid.product"}]}`))
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	msgID, err := client.SendProductMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", "555", "SKU-1", "Our bestseller", "")
+	require.NoError(t, err)
+	assert.Equal(t, "wamid.product", msgID)
+
+	interactive := body["interactive"].(map[string]interface{})
+	assert.Equal(t, "product", interactive["type"])
+	action := interactive["action"].(map[string]interface{})
+	assert.Equal(t, "555", action["catalog_id"])
+	assert.Equal(t, "SKU-1", action["product_retailer_id"])
+	assert.Nil(t, interactive["footer"])
+}
+
+func TestClient_SendProductMessage_RequiresProduct(t *testing.T) {
+	t.Parallel()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	_, err := client.SendProductMessage(testutil.TestContext(t), testAccount("http://unused"), "1234567890", "555", "", "", "")
+	require.Error(t, err)
+}
+
+func TestClient_SendProductListMessage(t *testing.T) {
+	t.Parallel()
+
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"messages":[{"id":"wamid.product_list"}]}`))
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithTimeout(testutil.NopLogger(), 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	list := whatsapp.ProductListMessage{
+		CatalogID: "555",
+		Header:    "Summer sale",
+		Body:      "Pick your favourites",
+		Sections: []whatsapp.ProductSection{
+			{Title: "Shirts", RetailerIDs: []string{"SKU-1", "SKU-2"}},
+			{Title: "Shoes", RetailerIDs: []string{"SKU-3"}},
+		},
+	}
+	msgID, err := client.SendProductListMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", list)
+	require.NoError(t, err)
+	assert.Equal(t, "wamid.product_list", msgID)
+
+	interactive := body["interactive"].(map[string]interface{})
+	assert.Equal(t, "product_list", interactive["type"])
+	assert.Equal(t, "Summer sale", interactive["header"].(map[string]interface{})["text"])
+	assert.Nil(t, interactive["footer"])
+	action := interactive["action"].(map[string]interface{})
+	assert.Equal(t, "555", action["catalog_id"])
+	sections := action["sections"].([]interface{})
+	require.Len(t, sections, 2)
+	items := sections[0].(map[string]interface{})["product_items"].([]interface{})
+	require.Len(t, items, 2)
+	assert.Equal(t, "SKU-2", items[1].(map[string]interface{})["product_retailer_id"])
+
+	// Invalid lists are rejected before calling the API
+	list.Header = ""
+	_, err = client.SendProductListMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", list)
+	assert.ErrorContains(t, err, "header is required")
+
+	list.Header = "Summer sale"
+	list.Sections[1].Title = ""
+	_, err = client.SendProductListMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", list)
+	assert.ErrorContains(t, err, "needs a title")
+
+	skus := make([]string, whatsapp.MaxProductListItems)
+	for i := range skus {
+		skus[i] = "SKU-" + strconv.Itoa(i)
+	}
+	list.Sections[1] = whatsapp.ProductSection{Title: "Shoes", RetailerIDs: skus}
+	_, err = client.SendProductListMessage(testutil.TestContext(t), testAccount(server.URL), "1234567890", list)
+	assert.ErrorContains(t, err, "maximum 30 products")
+}
@@ -0,0 +1,111 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ContactCard is a contact shared in a contacts message, in Meta's format. Incoming
+// contacts messages carry the same fields.
+type ContactCard struct {
+	Name   ContactCardName    `json:"name"`
+	Phones []ContactCardPhone `json:"phones,omitempty"`
+	Emails []ContactCardEmail `json:"emails,omitempty"`
+	Org    *ContactCardOrg    `json:"org,omitempty"`
+}
+
+// ContactCardName is the name on a contact card
+type ContactCardName struct {
+	FormattedName string `json:"formatted_name"`
+	FirstName     string `json:"first_name,omitempty"`
+	LastName      string `json:"last_name,omitempty"`
+}
+
+// ContactCardPhone is a phone number on a contact card
+type ContactCardPhone struct {
+	Phone string `json:"phone"`
+	Type  string `json:"type,omitempty"`  // e.g. "CELL", "WORK"
+	WaID  string `json:"wa_id,omitempty"` // Set when the number is on WhatsApp
+}
+
+// ContactCardEmail is an email address on a contact card
+type ContactCardEmail struct {
+	Email string `json:"email"`
+	Type  string `json:"type,omitempty"`
+}
+
+// ContactCardOrg is the company on a contact card
+type ContactCardOrg struct {
+	Company    string `json:"company,omitempty"`
+	Department string `json:"department,omitempty"`
+	Title      string `json:"title,omitempty"`
+}
+
+// MaxContactCards is the most contact cards a contacts message can share
+const MaxContactCards = 20
+
+// ValidateContactCards checks that contact cards can be sent: each needs a name
+// and a phone number
+func ValidateContactCards(cards []ContactCard) error {
+	if len(cards) == 0 {
+		return fmt.Errorf("at least one contact is required")
+	}
+	if len(cards) > MaxContactCards {
+		return fmt.Errorf("maximum %d contacts allowed", MaxContactCards)
+	}
+	for _, card := range cards {
+		if strings.TrimSpace(card.Name.FormattedName) == "" {
+			return fmt.Errorf("every contact needs a name")
+		}
+		if len(card.Phones) == 0 || strings.TrimSpace(card.Phones[0].Phone) == "" {
+			return fmt.Errorf("contact %q needs a phone number", card.Name.FormattedName)
+		}
+	}
+	return nil
+}
+
+// SendContactsMessage sends contact cards
+func (c *Client) SendContactsMessage(ctx context.Context, account *Account, phoneNumber string, cards []ContactCard) (string, error) {
+	if err := ValidateContactCards(cards); err != nil {
+		return "", err
+	}
+
+	// Meta requires a name part besides the formatted name
+	contacts := make([]ContactCard, len(cards))
+	for i, card := range cards {
+		if card.Name.FirstName == "" && card.Name.LastName == "" {
+			card.Name.FirstName = card.Name.FormattedName
+		}
+		contacts[i] = card
+	}
+
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                phoneNumber,
+		"type":              "contacts",
+		"contacts":          contacts,
+	}
+
+	c.Log.Debug("Sending contacts message", "phone", phoneNumber, "contacts", len(contacts))
+
+	respBody, err := c.postMessage(ctx, account, payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to send contacts message: %w", err)
+	}
+
+	var resp MetaAPIResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(resp.Messages) == 0 {
+		return "", fmt.Errorf("no message ID in response")
+	}
+
+	messageID := resp.Messages[0].ID
+	c.Log.Info("Contacts message sent", "message_id", messageID, "phone", phoneNumber)
+	return messageID, nil
+}
@@ -175,6 +175,22 @@ func (c *Client) UpdateFlowJSON(ctx context.Context, account *Account, flowID st
 	return nil
 }
 
+// SetFlowEndpoint sets the data endpoint a flow exchanges data with
+func (c *Client) SetFlowEndpoint(ctx context.Context, account *Account, flowID, endpointURI string) error {
+	url := fmt.Sprintf("%s/%s/%s", c.getBaseURL(), account.APIVersion, flowID)
+	payload := map[string]interface{}{
+		"endpoint_uri": endpointURI,
+	}
+
+	c.Log.Info("Setting flow endpoint", "flow_id", flowID, "endpoint_uri", endpointURI)
+
+	if _, err := c.doRequest(ctx, http.MethodPost, url, payload, account.AccessToken); err != nil {
+		c.Log.Error("Failed to set flow endpoint", "error", err, "flow_id", flowID)
+		return err
+	}
+	return nil
+}
+
 // PublishFlow publishes a draft flow
 func (c *Client) PublishFlow(ctx context.Context, account *Account, flowID string) error {
 	url := fmt.Sprintf("%s/%s/%s/publish", c.getBaseURL(), account.APIVersion, flowID)
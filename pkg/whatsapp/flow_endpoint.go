@@ -0,0 +1,164 @@
+package whatsapp
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Actions of a flow data endpoint request
+const (
+	FlowActionPing         = "ping"
+	FlowActionInit         = "INIT"
+	FlowActionBack         = "BACK"
+	FlowActionDataExchange = "data_exchange"
+)
+
+// FlowEndpointRequest is the encrypted body WhatsApp posts to a flow's data endpoint
+type FlowEndpointRequest struct {
+	EncryptedFlowData string `json:"encrypted_flow_data"`
+	EncryptedAESKey   string `json:"encrypted_aes_key"`
+	InitialVector     string `json:"initial_vector"`
+}
+
+// FlowDataRequest is a decrypted flow data endpoint request
+type FlowDataRequest struct {
+	Version   string                 `json:"version"`
+	Action    string                 `json:"action"`
+	Screen    string                 `json:"screen,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	FlowToken string                 `json:"flow_token,omitempty"`
+}
+
+// FlowCipher encrypts the response to a flow data endpoint request, with the
+// request's AES key
+type FlowCipher struct {
+	aesKey []byte
+	iv     []byte
+}
+
+// ParseFlowPrivateKey parses the PEM encoded RSA private key, PKCS#1 or PKCS#8,
+// whose public key is registered with WhatsApp for flow data endpoints
+func ParseFlowPrivateKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("flow private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse flow private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("flow private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// FlowPublicKeyPEM returns the PEM encoded public key of a flow private key
+func FlowPublicKeyPEM(key *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode flow public key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// DecryptFlowRequest decrypts a flow data endpoint request. The AES key is
+// encrypted with RSA-OAEP, and the flow data with AES-GCM.
+func DecryptFlowRequest(key *rsa.PrivateKey, req FlowEndpointRequest) (*FlowDataRequest, *FlowCipher, error) {
+	encryptedKey, err := base64.StdEncoding.DecodeString(req.EncryptedAESKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid encrypted AES key: %w", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(req.InitialVector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid initial vector: %w", err)
+	}
+	encryptedData, err := base64.StdEncoding.DecodeString(req.EncryptedFlowData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid encrypted flow data: %w", err)
+	}
+
+	aesKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, encryptedKey, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt AES key: %w", err)
+	}
+
+	gcm, err := newFlowGCM(aesKey, len(iv))
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := gcm.Open(nil, iv, encryptedData, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt flow data: %w", err)
+	}
+
+	var data FlowDataRequest
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse flow data: %w", err)
+	}
+	return &data, &FlowCipher{aesKey: aesKey, iv: iv}, nil
+}
+
+// Encrypt encrypts a response as the base64 body WhatsApp expects, with the
+// request's AES key and its initial vector's bits flipped
+func (c *FlowCipher) Encrypt(response interface{}) (string, error) {
+	plaintext, err := json.Marshal(response)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal flow response: %w", err)
+	}
+
+	flipped := make([]byte, len(c.iv))
+	for i, b := range c.iv {
+		flipped[i] = ^b
+	}
+
+	gcm, err := newFlowGCM(c.aesKey, len(flipped))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nil, flipped, plaintext, nil)), nil
+}
+
+// newFlowGCM returns the AES-GCM cipher of a flow request, whose initial vector
+// is longer than the standard nonce
+func newFlowGCM(aesKey []byte, ivSize int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AES key: %w", err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, ivSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid initial vector: %w", err)
+	}
+	return gcm, nil
+}
+
+// SetBusinessPublicKey registers the public key WhatsApp encrypts the phone
+// number's flow data endpoint requests with
+func (c *Client) SetBusinessPublicKey(ctx context.Context, account *Account, publicKeyPEM string) error {
+	url := fmt.Sprintf("%s/%s/%s/whatsapp_business_encryption", c.getBaseURL(), account.APIVersion, account.PhoneID)
+	payload := map[string]interface{}{
+		"business_public_key": publicKeyPEM,
+	}
+
+	c.Log.Info("Registering flow encryption key", "phone_id", account.PhoneID)
+	if _, err := c.doRequest(ctx, http.MethodPost, url, payload, account.AccessToken); err != nil {
+		return fmt.Errorf("failed to register flow encryption key: %w", err)
+	}
+	return nil
+}
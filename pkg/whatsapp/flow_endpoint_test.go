@@ -0,0 +1,94 @@
+package whatsapp_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encryptFlowRequest encrypts flow data the way WhatsApp does for a data endpoint
+func encryptFlowRequest(t *testing.T, key *rsa.PublicKey, aesKey, iv []byte, data string) whatsapp.FlowEndpointRequest {
+	t.Helper()
+
+	block, err := aes.NewCipher(aesKey)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	require.NoError(t, err)
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key, aesKey, nil)
+	require.NoError(t, err)
+
+	return whatsapp.FlowEndpointRequest{
+		EncryptedFlowData: base64.StdEncoding.EncodeToString(gcm.Seal(nil, iv, []byte(data), nil)),
+		EncryptedAESKey:   base64.StdEncoding.EncodeToString(encryptedKey),
+		InitialVector:     base64.StdEncoding.EncodeToString(iv),
+	}
+}
+
+func TestDecryptFlowRequest(t *testing.T) {
+	t.Parallel()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := whatsapp.ParseFlowPrivateKey(string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+	})))
+	require.NoError(t, err)
+
+	publicKey, err := whatsapp.FlowPublicKeyPEM(key)
+	require.NoError(t, err)
+	assert.Contains(t, publicKey, "-----BEGIN PUBLIC KEY-----")
+
+	aesKey := []byte("0123456789abcdef")
+	iv := []byte("fedcba9876543210")
+	req := encryptFlowRequest(t, &rsaKey.PublicKey, aesKey, iv,
+		`{"version":"3.0","action":"data_exchange","screen":"LEAD","data":{"email":"jane@example.com"},"flow_token":"chatbot_abc"}`)
+
+	data, flowCipher, err := whatsapp.DecryptFlowRequest(key, req)
+	require.NoError(t, err)
+	assert.Equal(t, whatsapp.FlowActionDataExchange, data.Action)
+	assert.Equal(t, "LEAD", data.Screen)
+	assert.Equal(t, "chatbot_abc", data.FlowToken)
+	assert.Equal(t, "jane@example.com", data.Data["email"])
+
+	// The response is encrypted with the same key and the initial vector's bits flipped
+	body, err := flowCipher.Encrypt(map[string]interface{}{"screen": "SUCCESS"})
+	require.NoError(t, err)
+	encrypted, err := base64.StdEncoding.DecodeString(body)
+	require.NoError(t, err)
+
+	flipped := make([]byte, len(iv))
+	for i, b := range iv {
+		flipped[i] = ^b
+	}
+	block, err := aes.NewCipher(aesKey)
+	require.NoError(t, err)
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(flipped))
+	require.NoError(t, err)
+	plaintext, err := gcm.Open(nil, flipped, encrypted, nil)
+	require.NoError(t, err)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(plaintext, &response))
+	assert.Equal(t, "SUCCESS", response["screen"])
+
+	// A request encrypted for another key can't be read
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, _, err = whatsapp.DecryptFlowRequest(otherKey, req)
+	assert.ErrorContains(t, err, "failed to decrypt AES key")
+
+	_, err = whatsapp.ParseFlowPrivateKey("not a key")
+	assert.ErrorContains(t, err, "not PEM encoded")
+}
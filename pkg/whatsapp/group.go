@@ -0,0 +1,98 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// buildGroupsURL builds the groups endpoint URL for a phone number
+func (c *Client) buildGroupsURL(account *Account) string {
+	return fmt.Sprintf("%s/%s/%s/groups", c.getBaseURL(), account.APIVersion, account.PhoneID)
+}
+
+// buildGroupURL builds the URL for a specific group
+func (c *Client) buildGroupURL(account *Account, groupID string) string {
+	return fmt.Sprintf("%s/%s/%s", c.getBaseURL(), account.APIVersion, groupID)
+}
+
+// CreateGroup creates a group owned by the business phone number. Participants
+// join through the group's invite link.
+func (c *Client) CreateGroup(ctx context.Context, account *Account, subject, description string) (string, error) {
+	body := map[string]string{
+		"messaging_product": "whatsapp",
+		"subject":           subject,
+	}
+	if description != "" {
+		body["description"] = description
+	}
+
+	respBody, err := c.doRequest(ctx, http.MethodPost, c.buildGroupsURL(account), body, account.AccessToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to create group: %w", err)
+	}
+
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return resp.ID, nil
+}
+
+// GetGroupInviteLink returns the link contacts use to join a group
+func (c *Client) GetGroupInviteLink(ctx context.Context, account *Account, groupID string) (string, error) {
+	apiURL := c.buildGroupURL(account, groupID) + "/invite_link"
+
+	respBody, err := c.doRequest(ctx, http.MethodGet, apiURL, nil, account.AccessToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to get group invite link: %w", err)
+	}
+
+	var resp struct {
+		InviteLink string `json:"invite_link"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return resp.InviteLink, nil
+}
+
+// SendGroupTextMessage sends a text message to a group
+func (c *Client) SendGroupTextMessage(ctx context.Context, account *Account, groupID, text string) (string, error) {
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "group",
+		"to":                groupID,
+		"type":              "text",
+		"text": map[string]interface{}{
+			"preview_url": false,
+			"body":        text,
+		},
+	}
+
+	c.Log.Debug("Sending group text message", "group_id", groupID)
+
+	respBody, err := c.postMessage(ctx, account, payload)
+	if err != nil {
+		c.Log.Error("Failed to send group text message", "error", err, "group_id", groupID)
+		return "", fmt.Errorf("failed to send group text message: %w", err)
+	}
+
+	var resp MetaAPIResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(resp.Messages) == 0 {
+		return "", fmt.Errorf("no message ID in response")
+	}
+
+	messageID := resp.Messages[0].ID
+	c.Log.Info("Group text message sent", "message_id", messageID, "group_id", groupID)
+	return messageID, nil
+}
@@ -0,0 +1,72 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Location is a point on the map sent as a location message
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	Name      string // Optional, e.g. the store's name
+	Address   string // Optional, shown under the name
+}
+
+// Validate checks that the coordinates are on the map
+func (l Location) Validate() error {
+	if l.Latitude < -90 || l.Latitude > 90 {
+		return fmt.Errorf("latitude must be between -90 and 90")
+	}
+	if l.Longitude < -180 || l.Longitude > 180 {
+		return fmt.Errorf("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// SendLocationMessage sends a location message
+func (c *Client) SendLocationMessage(ctx context.Context, account *Account, phoneNumber string, location Location) (string, error) {
+	if err := location.Validate(); err != nil {
+		return "", err
+	}
+
+	object := map[string]interface{}{
+		"latitude":  location.Latitude,
+		"longitude": location.Longitude,
+	}
+	if location.Name != "" {
+		object["name"] = location.Name
+	}
+	if location.Address != "" {
+		object["address"] = location.Address
+	}
+
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                phoneNumber,
+		"type":              "location",
+		"location":          object,
+	}
+
+	c.Log.Debug("Sending location message", "phone", phoneNumber)
+
+	respBody, err := c.postMessage(ctx, account, payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to send location message: %w", err)
+	}
+
+	var resp MetaAPIResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(resp.Messages) == 0 {
+		return "", fmt.Errorf("no message ID in response")
+	}
+
+	messageID := resp.Messages[0].ID
+	c.Log.Info("Location message sent", "message_id", messageID, "phone", phoneNumber)
+	return messageID, nil
+}
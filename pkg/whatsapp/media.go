@@ -0,0 +1,149 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Media message types
+const (
+	MediaTypeImage    = "image"
+	MediaTypeVideo    = "video"
+	MediaTypeAudio    = "audio"
+	MediaTypeDocument = "document"
+)
+
+// MaxMediaCaption is the longest caption WhatsApp accepts
+const MaxMediaCaption = 1024
+
+// mediaLimit is the size limit and the MIME types WhatsApp accepts for a media type
+type mediaLimit struct {
+	maxSize   int64
+	mimeTypes []string
+}
+
+// mediaLimits are WhatsApp's limits on media sent in messages
+var mediaLimits = map[string]mediaLimit{
+	MediaTypeImage: {5 << 20, []string{"image/jpeg", "image/png"}},
+	MediaTypeVideo: {16 << 20, []string{"video/mp4", "video/3gpp"}},
+	MediaTypeAudio: {16 << 20, []string{"audio/aac", "audio/amr", "audio/mpeg", "audio/mp4", "audio/ogg"}},
+	MediaTypeDocument: {100 << 20, []string{
+		"text/plain",
+		"application/pdf",
+		"application/msword",
+		"application/vnd.ms-excel",
+		"application/vnd.ms-powerpoint",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	}},
+}
+
+// MaxMediaSize returns the largest file WhatsApp accepts for a media type, 0
+// for unknown types
+func MaxMediaSize(mediaType string) int64 {
+	return mediaLimits[mediaType].maxSize
+}
+
+// ValidateMedia checks a file against WhatsApp's type and size limits for the
+// media type. mimeType may carry parameters, e.g. "audio/ogg; codecs=opus".
+func ValidateMedia(mediaType, mimeType string, size int64) error {
+	limit, ok := mediaLimits[mediaType]
+	if !ok {
+		return fmt.Errorf("unsupported media type %q", mediaType)
+	}
+	base := strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	supported := false
+	for _, t := range limit.mimeTypes {
+		if base == t {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("%s files can't be sent as %s, supported types are %s", mimeType, mediaType, strings.Join(limit.mimeTypes, ", "))
+	}
+	if size > limit.maxSize {
+		return fmt.Errorf("%s is %d MB, the maximum is %d MB", mediaType, (size+(1<<20)-1)>>20, limit.maxSize>>20)
+	}
+	return nil
+}
+
+// MediaMessage is an image, video, audio or document message. The media is
+// either uploaded to WhatsApp first (ID) or fetched by WhatsApp from a public
+// URL (Link).
+type MediaMessage struct {
+	Type     string
+	ID       string
+	Link     string
+	Caption  string // Not sent for audio
+	Filename string // Documents only
+}
+
+// Validate checks the message against WhatsApp's rules
+func (m MediaMessage) Validate() error {
+	if _, ok := mediaLimits[m.Type]; !ok {
+		return fmt.Errorf("unsupported media type %q", m.Type)
+	}
+	if (m.ID == "") == (m.Link == "") {
+		return fmt.Errorf("either a media ID or a link is required")
+	}
+	if m.Link != "" {
+		u, err := url.Parse(m.Link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("media link must be an http or https URL")
+		}
+	}
+	return checkLength("caption", m.Caption, MaxMediaCaption)
+}
+
+// SendMediaMessage sends an image, video, audio or document message
+func (c *Client) SendMediaMessage(ctx context.Context, account *Account, phoneNumber string, media MediaMessage) (string, error) {
+	if err := media.Validate(); err != nil {
+		return "", err
+	}
+
+	object := map[string]interface{}{}
+	if media.ID != "" {
+		object["id"] = media.ID
+	} else {
+		object["link"] = media.Link
+	}
+	if media.Caption != "" && media.Type != MediaTypeAudio {
+		object["caption"] = media.Caption
+	}
+	if media.Filename != "" && media.Type == MediaTypeDocument {
+		object["filename"] = media.Filename
+	}
+
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                phoneNumber,
+		"type":              media.Type,
+		media.Type:          object,
+	}
+
+	c.Log.Debug("Sending media message", "phone", phoneNumber, "type", media.Type, "media_id", media.ID, "link", media.Link)
+
+	respBody, err := c.postMessage(ctx, account, payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to send %s message: %w", media.Type, err)
+	}
+
+	var resp MetaAPIResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(resp.Messages) == 0 {
+		return "", fmt.Errorf("no message ID in response")
+	}
+
+	messageID := resp.Messages[0].ID
+	c.Log.Info("Media message sent", "message_id", messageID, "type", media.Type, "phone", phoneNumber)
+	return messageID, nil
+}
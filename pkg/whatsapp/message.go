@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // SendTextMessage sends a text message to a phone number
@@ -22,10 +24,9 @@ func (c *Client) SendTextMessage(ctx context.Context, account *Account, phoneNum
 		},
 	}
 
-	url := c.buildMessagesURL(account)
-	c.Log.Debug("Sending text message", "phone", phoneNumber, "url", url)
+	c.Log.Debug("Sending text message", "phone", phoneNumber)
 
-	respBody, err := c.doRequest(ctx, "POST", url, payload, account.AccessToken)
+	respBody, err := c.postMessage(ctx, account, payload)
 	if err != nil {
 		c.Log.Error("Failed to send text message", "error", err, "phone", phoneNumber)
 		return "", fmt.Errorf("failed to send text message: %w", err)
@@ -103,7 +104,7 @@ func (c *Client) SendInteractiveButtons(ctx context.Context, account *Account, p
 				"text": bodyText,
 			},
 			"action": map[string]interface{}{
-				"button": "Select an option",
+				"button": DefaultListButtonText,
 				"sections": []map[string]interface{}{
 					{
 						"title": "Options",
@@ -122,10 +123,9 @@ func (c *Client) SendInteractiveButtons(ctx context.Context, account *Account, p
 		"interactive":       interactive,
 	}
 
-	url := c.buildMessagesURL(account)
 	c.Log.Debug("Sending interactive message", "phone", phoneNumber, "button_count", len(buttons))
 
-	respBody, err := c.doRequest(ctx, "POST", url, payload, account.AccessToken)
+	respBody, err := c.postMessage(ctx, account, payload)
 	if err != nil {
 		c.Log.Error("Failed to send interactive message", "error", err, "phone", phoneNumber)
 		return "", fmt.Errorf("failed to send interactive message: %w", err)
@@ -145,6 +145,174 @@ func (c *Client) SendInteractiveButtons(ctx context.Context, account *Account, p
 	return messageID, nil
 }
 
+// WhatsApp's limits on list messages
+const (
+	MaxListRows           = 10 // Rows across all sections
+	MaxListSections       = 10
+	MaxListBody           = 4096
+	MaxListHeader         = 60
+	MaxListFooter         = 60
+	MaxListButtonText     = 20
+	MaxListSectionTitle   = 24
+	MaxListRowID          = 200
+	MaxListRowTitle       = 24
+	MaxListRowDescription = 72
+	DefaultListButtonText = "Select an option"
+)
+
+// Validate checks a list message against WhatsApp's limits, so it's rejected
+// before it's sent rather than by the API
+func (l ListMessage) Validate() error {
+	if strings.TrimSpace(l.Body) == "" {
+		return fmt.Errorf("list body is required")
+	}
+	if err := checkLength("list body", l.Body, MaxListBody); err != nil {
+		return err
+	}
+	if err := checkLength("list header", l.Header, MaxListHeader); err != nil {
+		return err
+	}
+	if err := checkLength("list footer", l.Footer, MaxListFooter); err != nil {
+		return err
+	}
+	if strings.TrimSpace(l.ButtonText) == "" {
+		return fmt.Errorf("list button text is required")
+	}
+	if err := checkLength("list button text", l.ButtonText, MaxListButtonText); err != nil {
+		return err
+	}
+	if len(l.Sections) == 0 {
+		return fmt.Errorf("at least one list section is required")
+	}
+	if len(l.Sections) > MaxListSections {
+		return fmt.Errorf("maximum %d list sections allowed", MaxListSections)
+	}
+
+	rows := 0
+	ids := make(map[string]bool)
+	for _, section := range l.Sections {
+		// Sections need titles once there's more than one
+		if len(l.Sections) > 1 && strings.TrimSpace(section.Title) == "" {
+			return fmt.Errorf("every section needs a title when there are several")
+		}
+		if err := checkLength("section title", section.Title, MaxListSectionTitle); err != nil {
+			return err
+		}
+		if len(section.Rows) == 0 {
+			return fmt.Errorf("section %q has no rows", section.Title)
+		}
+		for _, row := range section.Rows {
+			rows++
+			if strings.TrimSpace(row.ID) == "" || strings.TrimSpace(row.Title) == "" {
+				return fmt.Errorf("every row needs an ID and a title")
+			}
+			if ids[row.ID] {
+				return fmt.Errorf("row ID %q is used more than once", row.ID)
+			}
+			ids[row.ID] = true
+			if err := checkLength("row ID", row.ID, MaxListRowID); err != nil {
+				return err
+			}
+			if err := checkLength("row title", row.Title, MaxListRowTitle); err != nil {
+				return err
+			}
+			if err := checkLength("row description", row.Description, MaxListRowDescription); err != nil {
+				return err
+			}
+		}
+	}
+	if rows > MaxListRows {
+		return fmt.Errorf("maximum %d list rows allowed", MaxListRows)
+	}
+	return nil
+}
+
+// checkLength checks that a text is at most limit characters
+func checkLength(name, text string, limit int) error {
+	if n := utf8.RuneCountInString(text); n > limit {
+		return fmt.Errorf("%s is %d characters, the maximum is %d", name, n, limit)
+	}
+	return nil
+}
+
+// SendListMessage sends an interactive list message
+func (c *Client) SendListMessage(ctx context.Context, account *Account, phoneNumber string, list ListMessage) (string, error) {
+	if err := list.Validate(); err != nil {
+		return "", err
+	}
+
+	sections := make([]map[string]interface{}, 0, len(list.Sections))
+	for _, section := range list.Sections {
+		rows := make([]map[string]interface{}, 0, len(section.Rows))
+		for _, row := range section.Rows {
+			r := map[string]interface{}{
+				"id":    row.ID,
+				"title": row.Title,
+			}
+			if row.Description != "" {
+				r["description"] = row.Description
+			}
+			rows = append(rows, r)
+		}
+		s := map[string]interface{}{"rows": rows}
+		if section.Title != "" {
+			s["title"] = section.Title
+		}
+		sections = append(sections, s)
+	}
+
+	interactive := map[string]interface{}{
+		"type": "list",
+		"body": map[string]interface{}{
+			"text": list.Body,
+		},
+		"action": map[string]interface{}{
+			"button":   list.ButtonText,
+			"sections": sections,
+		},
+	}
+	if list.Header != "" {
+		interactive["header"] = map[string]interface{}{
+			"type": "text",
+			"text": list.Header,
+		}
+	}
+	if list.Footer != "" {
+		interactive["footer"] = map[string]interface{}{
+			"text": list.Footer,
+		}
+	}
+
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                phoneNumber,
+		"type":              "interactive",
+		"interactive":       interactive,
+	}
+
+	c.Log.Debug("Sending list message", "phone", phoneNumber, "sections", len(list.Sections))
+
+	respBody, err := c.postMessage(ctx, account, payload)
+	if err != nil {
+		c.Log.Error("Failed to send list message", "error", err, "phone", phoneNumber)
+		return "", fmt.Errorf("failed to send list message: %w", err)
+	}
+
+	var resp MetaAPIResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(resp.Messages) == 0 {
+		return "", fmt.Errorf("no message ID in response")
+	}
+
+	messageID := resp.Messages[0].ID
+	c.Log.Info("List message sent", "message_id", messageID, "phone", phoneNumber)
+	return messageID, nil
+}
+
 // SendCTAURLButton sends an interactive message with a CTA URL button
 // This opens a URL when clicked instead of sending a reply
 func (c *Client) SendCTAURLButton(ctx context.Context, account *Account, phoneNumber, bodyText, buttonText, url string) (string, error) {
@@ -179,10 +347,9 @@ func (c *Client) SendCTAURLButton(ctx context.Context, account *Account, phoneNu
 		"interactive":       interactive,
 	}
 
-	apiURL := c.buildMessagesURL(account)
 	c.Log.Debug("Sending CTA URL button message", "phone", phoneNumber, "url", url)
 
-	respBody, err := c.doRequest(ctx, "POST", apiURL, payload, account.AccessToken)
+	respBody, err := c.postMessage(ctx, account, payload)
 	if err != nil {
 		c.Log.Error("Failed to send CTA URL button message", "error", err, "phone", phoneNumber)
 		return "", fmt.Errorf("failed to send CTA URL button message: %w", err)
@@ -272,10 +439,9 @@ func (c *Client) SendTemplateMessage(ctx context.Context, account *Account, phon
 		"template":          template,
 	}
 
-	url := c.buildMessagesURL(account)
 	c.Log.Debug("Sending template message", "phone", phoneNumber, "template", templateName)
 
-	respBody, err := c.doRequest(ctx, "POST", url, payload, account.AccessToken)
+	respBody, err := c.postMessage(ctx, account, payload)
 	if err != nil {
 		c.Log.Error("Failed to send template message", "error", err, "phone", phoneNumber, "template", templateName)
 		return "", fmt.Errorf("failed to send template message: %w", err)
@@ -357,10 +523,9 @@ func (c *Client) SendFlowMessage(ctx context.Context, account *Account, phoneNum
 		"interactive":       interactive,
 	}
 
-	url := c.buildMessagesURL(account)
 	c.Log.Debug("Sending flow message", "phone", phoneNumber, "flow_id", flowID)
 
-	respBody, err := c.doRequest(ctx, "POST", url, payload, account.AccessToken)
+	respBody, err := c.postMessage(ctx, account, payload)
 	if err != nil {
 		c.Log.Error("Failed to send flow message", "error", err, "phone", phoneNumber, "flow_id", flowID)
 		return "", fmt.Errorf("failed to send flow message: %w", err)
@@ -400,10 +565,9 @@ func (c *Client) SendTemplateMessageWithComponents(ctx context.Context, account
 		"template":          template,
 	}
 
-	url := c.buildMessagesURL(account)
 	c.Log.Debug("Sending template message with components", "phone", phoneNumber, "template", templateName)
 
-	respBody, err := c.doRequest(ctx, "POST", url, payload, account.AccessToken)
+	respBody, err := c.postMessage(ctx, account, payload)
 	if err != nil {
 		c.Log.Error("Failed to send template message", "error", err, "phone", phoneNumber, "template", templateName)
 		return "", fmt.Errorf("failed to send template message: %w", err)
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -196,6 +197,144 @@ func TestClient_SendInteractiveButtons_ButtonTruncation(t *testing.T) {
 	assert.Len(t, reply["title"], 20)
 }
 
+func TestClient_SendListMessage(t *testing.T) {
+	t.Parallel()
+
+	var capturedBody map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&capturedBody)
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"messages": []map[string]string{{"id": "wamid.list123"}},
+		})
+	}))
+	defer server.Close()
+
+	log := testutil.NopLogger()
+	client := whatsapp.NewWithTimeout(log, 5*time.Second)
+	client.HTTPClient = &http.Client{
+		Transport: &testServerTransport{serverURL: server.URL},
+	}
+
+	account := &whatsapp.Account{
+		PhoneID:     "123456789",
+		BusinessID:  "987654321",
+		APIVersion:  "v21.0",
+		AccessToken: "test-token",
+	}
+	ctx := testutil.TestContext(t)
+
+	msgID, err := client.SendListMessage(ctx, account, "1234567890", whatsapp.ListMessage{
+		Header:     "Support",
+		Body:       "How can we help?",
+		ButtonText: "View topics",
+		Sections: []whatsapp.ListSection{
+			{Title: "Orders", Rows: []whatsapp.ListRow{
+				{ID: "track", Title: "Track my order", Description: "See where your parcel is"},
+				{ID: "return", Title: "Return an item"},
+			}},
+			{Title: "Account", Rows: []whatsapp.ListRow{{ID: "password", Title: "Reset password"}}},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "wamid.list123", msgID)
+
+	interactive := capturedBody["interactive"].(map[string]interface{})
+	assert.Equal(t, "list", interactive["type"])
+	assert.Equal(t, "Support", interactive["header"].(map[string]interface{})["text"])
+	assert.Nil(t, interactive["footer"])
+
+	action := interactive["action"].(map[string]interface{})
+	assert.Equal(t, "View topics", action["button"])
+	sections := action["sections"].([]interface{})
+	require.Len(t, sections, 2)
+	rows := sections[0].(map[string]interface{})["rows"].([]interface{})
+	require.Len(t, rows, 2)
+	assert.Equal(t, "See where your parcel is", rows[0].(map[string]interface{})["description"])
+	assert.Nil(t, rows[1].(map[string]interface{})["description"])
+
+	// Invalid lists are rejected before calling the API
+	_, err = client.SendListMessage(ctx, account, "1234567890", whatsapp.ListMessage{Body: "Choose", ButtonText: "Options"})
+	assert.ErrorContains(t, err, "at least one list section")
+}
+
+func TestListMessage_Validate(t *testing.T) {
+	t.Parallel()
+
+	valid := func() whatsapp.ListMessage {
+		return whatsapp.ListMessage{
+			Body:       "Choose a topic",
+			ButtonText: "Topics",
+			Sections:   []whatsapp.ListSection{{Rows: []whatsapp.ListRow{{ID: "a", Title: "Billing"}}}},
+		}
+	}
+	rows := func(n int) []whatsapp.ListRow {
+		r := make([]whatsapp.ListRow, n)
+		for i := range r {
+			r[i] = whatsapp.ListRow{ID: string(rune('a' + i)), Title: "Option"}
+		}
+		return r
+	}
+
+	tests := []struct {
+		name            string
+		modify          func(l *whatsapp.ListMessage)
+		wantErrContains string
+	}{
+		{name: "valid", modify: func(l *whatsapp.ListMessage) {}},
+		{name: "ten rows", modify: func(l *whatsapp.ListMessage) { l.Sections[0].Rows = rows(10) }},
+		{name: "missing body", modify: func(l *whatsapp.ListMessage) { l.Body = " " }, wantErrContains: "body is required"},
+		{name: "missing button text", modify: func(l *whatsapp.ListMessage) { l.ButtonText = "" }, wantErrContains: "button text is required"},
+		{name: "long button text", modify: func(l *whatsapp.ListMessage) { l.ButtonText = strings.Repeat("x", 21) }, wantErrContains: "list button text is 21 characters"},
+		{name: "long header", modify: func(l *whatsapp.ListMessage) { l.Header = strings.Repeat("x", 61) }, wantErrContains: "list header"},
+		{name: "eleven rows", modify: func(l *whatsapp.ListMessage) { l.Sections[0].Rows = rows(11) }, wantErrContains: "maximum 10 list rows"},
+		{name: "empty section", modify: func(l *whatsapp.ListMessage) { l.Sections[0].Rows = nil }, wantErrContains: "has no rows"},
+		{
+			name: "untitled sections",
+			modify: func(l *whatsapp.ListMessage) {
+				l.Sections = append(l.Sections, whatsapp.ListSection{Title: "More", Rows: []whatsapp.ListRow{{ID: "b", Title: "Refunds"}}})
+			},
+			wantErrContains: "needs a title",
+		},
+		{name: "row without ID", modify: func(l *whatsapp.ListMessage) { l.Sections[0].Rows[0].ID = "" }, wantErrContains: "needs an ID and a title"},
+		{
+			name:            "duplicate row IDs",
+			modify:          func(l *whatsapp.ListMessage) { l.Sections[0].Rows = append(l.Sections[0].Rows, l.Sections[0].Rows[0]) },
+			wantErrContains: "used more than once",
+		},
+		{
+			name:            "long row title counts characters",
+			modify:          func(l *whatsapp.ListMessage) { l.Sections[0].Rows[0].Title = strings.Repeat("é", 25) },
+			wantErrContains: "row title is 25 characters",
+		},
+		{
+			name:   "row title at the limit",
+			modify: func(l *whatsapp.ListMessage) { l.Sections[0].Rows[0].Title = strings.Repeat("é", 24) },
+		},
+		{
+			name:            "long row description",
+			modify:          func(l *whatsapp.ListMessage) { l.Sections[0].Rows[0].Description = strings.Repeat("x", 73) },
+			wantErrContains: "row description",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			list := valid()
+			tt.modify(&list)
+			err := list.Validate()
+			if tt.wantErrContains == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErrContains)
+		})
+	}
+}
+
 func TestClient_SendTemplateMessage(t *testing.T) {
 	t.Parallel()
 
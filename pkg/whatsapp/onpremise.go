@@ -0,0 +1,131 @@
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// onPremiseAPI sends through an On-Premise API server, whether run by the business
+// or by a BSP that exposes the same API. Payloads are the Cloud API's, which the
+// On-Premise API shares apart from the messaging_product field.
+type onPremiseAPI struct {
+	c *Client
+}
+
+// OnPremiseAPIError represents an error response from the On-Premise API
+type OnPremiseAPIError struct {
+	Errors []struct {
+		Code    int    `json:"code"`
+		Title   string `json:"title"`
+		Details string `json:"details"`
+	} `json:"errors"`
+}
+
+// onPremiseMediaResponse represents the response from uploading media
+type onPremiseMediaResponse struct {
+	Media []struct {
+		ID string `json:"id"`
+	} `json:"media"`
+}
+
+func (api onPremiseAPI) PostMessage(ctx context.Context, account *Account, payload map[string]interface{}) ([]byte, error) {
+	// Read receipts are a status update of the message. There's no typing indicator,
+	// so it's sent as just a read receipt.
+	if payload["status"] == "read" {
+		messageID, _ := payload["message_id"].(string)
+		body, _ := json.Marshal(map[string]string{"status": "read"})
+		return api.do(ctx, account, http.MethodPut, "/v1/messages/"+url.PathEscape(messageID), bytes.NewReader(body), "application/json")
+	}
+
+	message := make(map[string]interface{}, len(payload))
+	for k, v := range payload {
+		if k != "messaging_product" {
+			message[k] = v
+		}
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+	return api.do(ctx, account, http.MethodPost, "/v1/messages", bytes.NewReader(body), "application/json")
+}
+
+func (api onPremiseAPI) UploadMedia(ctx context.Context, account *Account, data []byte, mimeType, filename string) (string, error) {
+	respBody, err := api.do(ctx, account, http.MethodPost, "/v1/media", bytes.NewReader(data), mimeType)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload media: %w", err)
+	}
+
+	var uploadResp onPremiseMediaResponse
+	if err := json.Unmarshal(respBody, &uploadResp); err != nil {
+		return "", fmt.Errorf("failed to parse upload response: %w", err)
+	}
+	if len(uploadResp.Media) == 0 || uploadResp.Media[0].ID == "" {
+		return "", fmt.Errorf("no media ID in upload response")
+	}
+
+	api.c.Log.Info("Media uploaded", "media_id", uploadResp.Media[0].ID, "filename", filename)
+	return uploadResp.Media[0].ID, nil
+}
+
+func (api onPremiseAPI) FetchMedia(ctx context.Context, account *Account, mediaID string) ([]byte, error) {
+	data, err := api.do(ctx, account, http.MethodGet, "/v1/media/"+url.PathEscape(mediaID), nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download media: %w", err)
+	}
+	return data, nil
+}
+
+// do performs an HTTP request to the account's On-Premise API server
+func (api onPremiseAPI) do(ctx context.Context, account *Account, method, path string, body io.Reader, contentType string) ([]byte, error) {
+	if account.APIURL == "" {
+		return nil, errors.New("the number's On-Premise API URL isn't set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(account.APIURL, "/")+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if account.APIAuthHeader != "" {
+		req.Header.Set(account.APIAuthHeader, account.APIToken)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+account.APIToken)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := api.c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Messages are created with 201
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr OnPremiseAPIError
+		if err := json.Unmarshal(respBody, &apiErr); err == nil && len(apiErr.Errors) > 0 {
+			return nil, &APIError{
+				StatusCode: resp.StatusCode,
+				Code:       apiErr.Errors[0].Code,
+				Message:    apiErr.Errors[0].Title,
+				Details:    apiErr.Errors[0].Details,
+			}
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: string(respBody)}
+	}
+
+	return respBody, nil
+}
@@ -0,0 +1,121 @@
+package whatsapp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shridarpatil/whatomate/pkg/whatsapp"
+	"github.com/shridarpatil/whatomate/test/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// onPremiseAccount returns an account whose number is on the On-Premise API server
+func onPremiseAccount(serverURL string) *whatsapp.Account {
+	account := testAccount(serverURL)
+	account.APIType = whatsapp.APITypeOnPremise
+	account.APIURL = serverURL + "/"
+	account.APIToken = "on-prem-token"
+	return account
+}
+
+func TestOnPremiseAPI_SendTextMessage(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "Bearer on-prem-token", r.Header.Get("Authorization"))
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.NotContains(t, body, "messaging_product")
+		assert.Equal(t, "1234567890", body["to"])
+		assert.Equal(t, "text", body["type"])
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"messages":[{"id":"gBEGkYiEB1VXAglK1ZEqA1YKPrU"}]}`))
+	}))
+	defer server.Close()
+
+	client := whatsapp.NewWithBaseURL(testutil.NopLogger(), "http://graph.invalid")
+	id, err := client.SendTextMessage(context.Background(), onPremiseAccount(server.URL), "1234567890", "Hello")
+	require.NoError(t, err)
+	assert.Equal(t, "gBEGkYiEB1VXAglK1ZEqA1YKPrU", id)
+}
+
+func TestOnPremiseAPI_MarkMessageRead(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/v1/messages/wamid.abc", r.URL.Path)
+		// BSPs can take the token in their own header
+		assert.Equal(t, "on-prem-token", r.Header.Get("D360-API-KEY"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		assert.JSONEq(t, `{"status":"read"}`, string(body))
+	}))
+	defer server.Close()
+
+	account := onPremiseAccount(server.URL)
+	account.APIAuthHeader = "D360-API-KEY"
+	client := whatsapp.New(testutil.NopLogger())
+	require.NoError(t, client.MarkMessageRead(context.Background(), account, "wamid.abc"))
+}
+
+func TestOnPremiseAPI_Media(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/media":
+			assert.Equal(t, "image/png", r.Header.Get("Content-Type"))
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, "png", string(body))
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"media":[{"id":"f043afd0-f0ae-4b9c-ab3d-696fb4c8cd68"}]}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/media/f043afd0-f0ae-4b9c-ab3d-696fb4c8cd68":
+			_, _ = w.Write([]byte("png"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[{"code":1006,"title":"Resource not found","details":"Unknown media"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	client := whatsapp.New(testutil.NopLogger())
+	account := onPremiseAccount(server.URL)
+	ctx := context.Background()
+
+	id, err := client.UploadMedia(ctx, account, []byte("png"), "image/png", "a.png")
+	require.NoError(t, err)
+	assert.Equal(t, "f043afd0-f0ae-4b9c-ab3d-696fb4c8cd68", id)
+
+	data, err := client.FetchMedia(ctx, account, id)
+	require.NoError(t, err)
+	assert.Equal(t, "png", string(data))
+
+	_, err = client.FetchMedia(ctx, account, "missing")
+	var apiErr *whatsapp.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, 1006, apiErr.Code)
+	assert.Equal(t, "Unknown media", apiErr.Details)
+}
+
+func TestClient_API(t *testing.T) {
+	t.Parallel()
+
+	client := whatsapp.New(testutil.NopLogger())
+	cloud := testAccount("")
+	onPremise := onPremiseAccount("https://waba.example.com")
+	assert.NotEqual(t, client.API(cloud), client.API(onPremise))
+	assert.True(t, whatsapp.ValidAPIType(""))
+	assert.True(t, whatsapp.ValidAPIType(whatsapp.APITypeOnPremise))
+	assert.False(t, whatsapp.ValidAPIType("bsp"))
+}
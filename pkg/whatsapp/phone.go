@@ -0,0 +1,38 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// phoneNumberFields are the phone number fields requested from the Cloud API
+const phoneNumberFields = "display_phone_number,verified_name,quality_rating,messaging_limit_tier,status,name_status"
+
+// PhoneNumber is the status of a business phone number
+type PhoneNumber struct {
+	DisplayPhoneNumber string `json:"display_phone_number"`
+	VerifiedName       string `json:"verified_name"`
+	QualityRating      string `json:"quality_rating"`       // GREEN, YELLOW, RED, UNKNOWN
+	MessagingLimitTier string `json:"messaging_limit_tier"` // TIER_250, TIER_1K, TIER_10K, TIER_100K, TIER_UNLIMITED
+	Status             string `json:"status"`               // CONNECTED, FLAGGED, RESTRICTED, ...
+	NameStatus         string `json:"name_status"`
+}
+
+// GetPhoneNumber returns the status of the account's phone number
+func (c *Client) GetPhoneNumber(ctx context.Context, account *Account) (*PhoneNumber, error) {
+	apiURL := fmt.Sprintf("%s/%s/%s?fields=%s", c.getBaseURL(), account.APIVersion, account.PhoneID, phoneNumberFields)
+
+	respBody, err := c.doRequest(ctx, http.MethodGet, apiURL, nil, account.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get phone number: %w", err)
+	}
+
+	var phone PhoneNumber
+	if err := json.Unmarshal(respBody, &phone); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &phone, nil
+}
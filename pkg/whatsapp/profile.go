@@ -0,0 +1,97 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// businessProfileFields are the profile fields requested from the Cloud API
+const businessProfileFields = "about,address,description,email,profile_picture_url,websites,vertical"
+
+// BusinessVerticals are the industries a business profile can be listed under
+var BusinessVerticals = []string{
+	"UNDEFINED", "OTHER", "AUTO", "BEAUTY", "APPAREL", "EDU", "ENTERTAIN", "EVENT_PLAN",
+	"FINANCE", "GROCERY", "GOVT", "HOTEL", "HEALTH", "NONPROFIT", "PROF_SERVICES",
+	"RETAIL", "TRAVEL", "RESTAURANT", "ALCOHOL", "ONLINE_GAMBLING", "PHYSICAL_GAMBLING",
+	"OTC_DRUGS",
+}
+
+// BusinessProfile is the profile customers see for a business phone number
+type BusinessProfile struct {
+	About             string   `json:"about"`
+	Address           string   `json:"address"`
+	Description       string   `json:"description"`
+	Email             string   `json:"email"`
+	ProfilePictureURL string   `json:"profile_picture_url"`
+	Websites          []string `json:"websites"`
+	Vertical          string   `json:"vertical"`
+}
+
+// BusinessProfileUpdate changes a business profile. Nil fields are left unchanged.
+type BusinessProfileUpdate struct {
+	About                *string  `json:"about,omitempty"`
+	Address              *string  `json:"address,omitempty"`
+	Description          *string  `json:"description,omitempty"`
+	Email                *string  `json:"email,omitempty"`
+	Websites             []string `json:"websites,omitempty"` // Replaces all websites, up to 2
+	Vertical             *string  `json:"vertical,omitempty"`
+	ProfilePictureHandle string   `json:"profile_picture_handle,omitempty"` // From ResumableUpload
+}
+
+// buildBusinessProfileURL builds the business profile endpoint URL for a phone number
+func (c *Client) buildBusinessProfileURL(account *Account) string {
+	return fmt.Sprintf("%s/%s/%s/whatsapp_business_profile", c.getBaseURL(), account.APIVersion, account.PhoneID)
+}
+
+// GetBusinessProfile returns the business profile of a phone number
+func (c *Client) GetBusinessProfile(ctx context.Context, account *Account) (*BusinessProfile, error) {
+	apiURL := c.buildBusinessProfileURL(account) + "?fields=" + businessProfileFields
+
+	respBody, err := c.doRequest(ctx, http.MethodGet, apiURL, nil, account.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get business profile: %w", err)
+	}
+
+	var resp struct {
+		Data []BusinessProfile `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(resp.Data) == 0 {
+		return &BusinessProfile{}, nil
+	}
+
+	return &resp.Data[0], nil
+}
+
+// UpdateBusinessProfile updates the business profile of a phone number
+func (c *Client) UpdateBusinessProfile(ctx context.Context, account *Account, update BusinessProfileUpdate) error {
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+	}
+	for field, value := range map[string]*string{
+		"about":       update.About,
+		"address":     update.Address,
+		"description": update.Description,
+		"email":       update.Email,
+		"vertical":    update.Vertical,
+	} {
+		if value != nil {
+			payload[field] = *value
+		}
+	}
+	if update.Websites != nil {
+		payload["websites"] = update.Websites
+	}
+	if update.ProfilePictureHandle != "" {
+		payload["profile_picture_handle"] = update.ProfilePictureHandle
+	}
+
+	if _, err := c.doRequest(ctx, http.MethodPost, c.buildBusinessProfileURL(account), payload, account.AccessToken); err != nil {
+		return fmt.Errorf("failed to update business profile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// SendReaction reacts to a message with an emoji. An empty emoji removes the reaction.
+func (c *Client) SendReaction(ctx context.Context, account *Account, phoneNumber, messageID, emoji string) (string, error) {
+	if messageID == "" {
+		return "", fmt.Errorf("message ID is required")
+	}
+
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                phoneNumber,
+		"type":              "reaction",
+		"reaction": map[string]interface{}{
+			"message_id": messageID,
+			"emoji":      emoji,
+		},
+	}
+
+	c.Log.Debug("Sending reaction", "phone", phoneNumber, "message_id", messageID)
+
+	respBody, err := c.postMessage(ctx, account, payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to send reaction: %w", err)
+	}
+
+	var resp MetaAPIResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(resp.Messages) == 0 {
+		return "", fmt.Errorf("no message ID in response")
+	}
+
+	reactionID := resp.Messages[0].ID
+	c.Log.Info("Reaction sent", "reaction_id", reactionID, "message_id", messageID, "emoji", emoji)
+	return reactionID, nil
+}
@@ -0,0 +1,72 @@
+package whatsapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ExchangeCode exchanges the code from Meta's embedded signup for a business
+// integration access token
+func (c *Client) ExchangeCode(ctx context.Context, appID, appSecret, apiVersion, code string) (string, error) {
+	params := url.Values{}
+	params.Set("client_id", appID)
+	params.Set("client_secret", appSecret)
+	params.Set("code", code)
+	apiURL := fmt.Sprintf("%s/%s/oauth/access_token?%s", c.getBaseURL(), apiVersion, params.Encode())
+
+	respBody, err := c.doRequest(ctx, http.MethodGet, apiURL, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return "", fmt.Errorf("no access token in response")
+	}
+
+	return resp.AccessToken, nil
+}
+
+// SubscribeApp subscribes the app to the business account's webhooks. With a
+// callbackURL, the business account's webhooks go there instead of the app's
+// callback URL, verified with verifyToken.
+func (c *Client) SubscribeApp(ctx context.Context, account *Account, callbackURL, verifyToken string) error {
+	apiURL := fmt.Sprintf("%s/%s/%s/subscribed_apps", c.getBaseURL(), account.APIVersion, account.BusinessID)
+
+	var payload interface{}
+	if callbackURL != "" {
+		payload = map[string]string{
+			"override_callback_uri": callbackURL,
+			"verify_token":          verifyToken,
+		}
+	}
+
+	if _, err := c.doRequest(ctx, http.MethodPost, apiURL, payload, account.AccessToken); err != nil {
+		return fmt.Errorf("failed to subscribe app: %w", err)
+	}
+	return nil
+}
+
+// RegisterPhoneNumber registers the phone number for the Cloud API, setting its
+// two-step verification PIN
+func (c *Client) RegisterPhoneNumber(ctx context.Context, account *Account, pin string) error {
+	apiURL := fmt.Sprintf("%s/%s/%s/register", c.getBaseURL(), account.APIVersion, account.PhoneID)
+
+	payload := map[string]string{
+		"messaging_product": "whatsapp",
+		"pin":               pin,
+	}
+
+	if _, err := c.doRequest(ctx, http.MethodPost, apiURL, payload, account.AccessToken); err != nil {
+		return fmt.Errorf("failed to register phone number: %w", err)
+	}
+	return nil
+}
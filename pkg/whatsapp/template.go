@@ -158,6 +158,18 @@ func (c *Client) SubmitTemplate(ctx context.Context, account *Account, template
 					button["type"] = "PHONE_NUMBER"
 					button["text"] = btnText
 					button["phone_number"] = phoneNum
+				case "FLOW":
+					flowID, _ := btnMap["flow_id"].(string)
+					if flowID == "" {
+						continue
+					}
+					button["type"] = "FLOW"
+					button["text"] = btnText
+					button["flow_id"] = flowID
+					button["flow_action"] = "navigate"
+					if screen, ok := btnMap["navigate_screen"].(string); ok && screen != "" {
+						button["navigate_screen"] = screen
+					}
 				case "COPY_CODE":
 					button["type"] = "COPY_CODE"
 					button["text"] = btnText
@@ -216,7 +228,7 @@ func (c *Client) SubmitTemplate(ctx context.Context, account *Account, template
 
 // FetchTemplates fetches all templates from Meta's API
 func (c *Client) FetchTemplates(ctx context.Context, account *Account) ([]MetaTemplate, error) {
-	url := fmt.Sprintf("%s?limit=100", c.buildTemplatesURL(account))
+	url := fmt.Sprintf("%s?limit=100&fields=id,name,language,category,status,components,quality_score", c.buildTemplatesURL(account))
 
 	respBody, err := c.doRequest(ctx, http.MethodGet, url, nil, account.AccessToken)
 	if err != nil {
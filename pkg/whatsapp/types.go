@@ -1,6 +1,9 @@
 package whatsapp
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Account represents WhatsApp Business Account credentials
 type Account struct {
@@ -9,6 +12,13 @@ type Account struct {
 	AppID       string
 	APIVersion  string
 	AccessToken string
+
+	// The API the number sends through, and for the On-Premise API, its server and
+	// credentials. AccessToken stays the Graph API token the account is managed with.
+	APIType       string // APITypeCloud or APITypeOnPremise
+	APIURL        string // On-Premise API server, e.g. https://waba.example.com
+	APIToken      string // On-Premise API auth token, or a BSP's API key
+	APIAuthHeader string // Header APIToken is sent in; empty sends it as a bearer token
 }
 
 // Button represents an interactive button
@@ -19,6 +29,29 @@ type Button struct {
 	URL   string `json:"url,omitempty"`  // URL for type="url" buttons
 }
 
+// ListMessage represents an interactive list message: a button that opens
+// sections of rows the contact picks one from
+type ListMessage struct {
+	Header     string        `json:"header,omitempty"`
+	Body       string        `json:"body"`
+	Footer     string        `json:"footer,omitempty"`
+	ButtonText string        `json:"button_text"`
+	Sections   []ListSection `json:"sections"`
+}
+
+// ListSection represents a titled group of rows in a list message
+type ListSection struct {
+	Title string    `json:"title,omitempty"`
+	Rows  []ListRow `json:"rows"`
+}
+
+// ListRow represents an option of a list message
+type ListRow struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
 // MetaAPIResponse represents a successful API response from Meta
 type MetaAPIResponse struct {
 	Messages []struct {
@@ -41,6 +74,31 @@ type MetaAPIError struct {
 	} `json:"error"`
 }
 
+// APIError is a failed Meta API request. Code is Meta's error code, or zero when
+// the response wasn't a Meta error.
+type APIError struct {
+	StatusCode int
+	Code       int
+	Subcode    int
+	Message    string
+	Details    string
+	UserMsg    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Message)
+	}
+	errMsg := fmt.Sprintf("API error %d: %s", e.Code, e.Message)
+	if e.Details != "" {
+		errMsg += " - Details: " + e.Details
+	}
+	if e.UserMsg != "" {
+		errMsg += " - " + e.UserMsg
+	}
+	return errMsg
+}
+
 // TemplateResponse represents response from template submission
 type TemplateResponse struct {
 	ID string `json:"id"`
@@ -48,12 +106,15 @@ type TemplateResponse struct {
 
 // MetaTemplate represents a template fetched from Meta
 type MetaTemplate struct {
-	ID         string              `json:"id"`
-	Name       string              `json:"name"`
-	Language   string              `json:"language"`
-	Category   string              `json:"category"`
-	Status     string              `json:"status"`
-	Components []TemplateComponent `json:"components"`
+	ID           string              `json:"id"`
+	Name         string              `json:"name"`
+	Language     string              `json:"language"`
+	Category     string              `json:"category"`
+	Status       string              `json:"status"`
+	Components   []TemplateComponent `json:"components"`
+	QualityScore *struct {
+		Score string `json:"score"`
+	} `json:"quality_score,omitempty"`
 }
 
 // TemplateComponent represents a component of a template
@@ -263,16 +324,39 @@ type ProductInfo struct {
 	Currency    string `json:"currency"`
 	URL         string `json:"url"`
 	ImageURL    string `json:"image_url"`
-	RetailerID  string `json:"retailer_id"`
-	Description string `json:"description"`
+	RetailerID   string `json:"retailer_id"`
+	Description  string `json:"description"`
+	Availability string `json:"availability"`
 }
 
 // ProductListResponse represents response from listing products
 type ProductListResponse struct {
-	Data []ProductInfo `json:"data"`
+	Data   []ProductInfo `json:"data"`
+	Paging struct {
+		Cursors struct {
+			After string `json:"after"`
+		} `json:"cursors"`
+		Next string `json:"next"`
+	} `json:"paging"`
 }
 
 // ProductCreateResponse represents response from creating a product
 type ProductCreateResponse struct {
 	ID string `json:"id"`
 }
+
+// ProductListMessage represents a multi-product message: sections of products
+// from a catalog the contact can browse and add to a cart
+type ProductListMessage struct {
+	CatalogID string           `json:"catalog_id"`
+	Header    string           `json:"header"`
+	Body      string           `json:"body"`
+	Footer    string           `json:"footer,omitempty"`
+	Sections  []ProductSection `json:"sections"`
+}
+
+// ProductSection represents a titled group of products in a multi-product message
+type ProductSection struct {
+	Title       string   `json:"title"`
+	RetailerIDs []string `json:"product_retailer_ids"` // SKUs
+}
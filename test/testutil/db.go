@@ -88,13 +88,58 @@ func runMigrations(db *gorm.DB) error {
 		&models.TeamMember{},
 		&models.APIKey{},
 		&models.SSOProvider{},
+		&models.Invitation{},
 		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.AuditLog{},
+		&models.DeadLetter{},
 		&models.CustomAction{},
+		&models.Automation{},
+		&models.AutomationLog{},
+		&models.UsageCounter{},
+		&models.Plan{},
+		&models.Statement{},
+		&models.Wallet{},
+		&models.WalletTransaction{},
+		&models.ConversationCharge{},
+		&models.Checkout{},
+		&models.Order{},
+		&models.AIUsage{},
+		&models.AnalyticsDaily{},
+		&models.UsageMeter{},
+		&models.KnowledgeDocument{},
+		&models.KnowledgeChunk{},
+		&models.AIModerationLog{},
+		&models.AdminAuditLog{},
 		&models.UserAvailabilityLog{},
+		&models.CannedResponse{},
+		&models.CannedResponseFavorite{},
+		&models.CannedResponseUse{},
+		&models.Shortcode{},
+		&models.Holiday{},
+		&models.SLAPolicy{},
 		// WhatsApp models
 		&models.WhatsAppAccount{},
+		&models.NumberHealthEvent{},
 		&models.Contact{},
+		&models.ContactNote{},
+		&models.ContactNoteRevision{},
+		&models.AdReferral{},
 		&models.Message{},
+		&models.MessageArchive{},
+		&models.WhatsAppGroup{},
+		&models.WhatsAppGroupParticipant{},
+		&models.GroupMessage{},
+		&models.ScheduledMessage{},
+		&models.FollowUp{},
+		&models.Sequence{},
+		&models.SequenceStep{},
+		&models.SequenceEnrollment{},
+		&models.Segment{},
+		&models.ContactImport{},
+		&models.ContactConsentEvent{},
+		&models.Appointment{},
+		&models.AppointmentReminder{},
 		&models.Template{},
 		&models.WhatsAppFlow{},
 		// Chatbot models
@@ -106,10 +151,19 @@ func runMigrations(db *gorm.DB) error {
 		&models.ChatbotSessionMessage{},
 		&models.AIContext{},
 		&models.AgentTransfer{},
+		&models.SessionNote{},
+		&models.SessionNoteMention{},
+		&models.PaymentLink{},
+		&models.CRMContact{},
+		&models.HelpdeskTicket{},
+		&models.CSATResponse{},
 		// Bulk message models
 		&models.BulkMessageCampaign{},
 		&models.BulkMessageRecipient{},
+		&models.CampaignVariant{},
 		&models.NotificationRule{},
+		&models.TrackingLink{},
+		&models.TrackingLinkAttribution{},
 	)
 }
 
@@ -121,7 +175,11 @@ func cleanupTables(db *gorm.DB) {
 		"bulk_message_recipients",
 		"bulk_message_campaigns",
 		"notification_rules",
+		"tracking_link_attributions",
+		"tracking_links",
 		// Chatbot tables
+		"session_note_mentions",
+		"session_notes",
 		"chatbot_session_messages",
 		"chatbot_sessions",
 		"chatbot_flow_steps",
@@ -131,10 +189,27 @@ func cleanupTables(db *gorm.DB) {
 		"ai_contexts",
 		"agent_transfers",
 		// WhatsApp tables
+		"appointment_reminders",
+		"appointments",
+		"contact_consent_events",
+		"contact_imports",
+		"segments",
+		"sequence_enrollments",
+		"sequence_steps",
+		"sequences",
+		"follow_ups",
+		"scheduled_messages",
 		"messages",
+		"group_messages",
+		"whatsapp_group_participants",
+		"whatsapp_groups",
+		"ad_referrals",
+		"contact_note_revisions",
+		"contact_notes",
 		"contacts",
 		"templates",
 		"whatsapp_flows",
+		"number_health_events",
 		"whatsapp_accounts",
 		// Roles and permissions
 		"role_permissions",
@@ -145,9 +220,35 @@ func cleanupTables(db *gorm.DB) {
 		"teams",
 		"api_keys",
 		"sso_providers",
+		"invitations",
+		"webhook_deliveries",
 		"webhooks",
 		"custom_actions",
+		"automation_logs",
+		"automations",
+		"usage_counters",
+		"plans",
+		"statements",
+		"admin_audit_logs",
+		"audit_logs",
+		"dead_letters",
+		"conversation_charges",
+		"checkouts",
+		"ai_usage",
+		"analytics_daily",
+		"usage_meters",
+		"knowledge_chunks",
+		"knowledge_documents",
+		"ai_moderation_logs",
+		"wallet_transactions",
+		"wallets",
 		"user_availability_logs",
+		"canned_response_uses",
+		"canned_response_favorites",
+		"canned_responses",
+		"shortcodes",
+		"holidays",
+		"sla_policies",
 		"users",
 		"organizations",
 	}
@@ -163,6 +264,8 @@ func TruncateTables(db *gorm.DB) {
 		"bulk_message_recipients",
 		"bulk_message_campaigns",
 		"notification_rules",
+		"session_note_mentions",
+		"session_notes",
 		"chatbot_session_messages",
 		"chatbot_sessions",
 		"chatbot_flow_steps",
@@ -171,6 +274,7 @@ func TruncateTables(db *gorm.DB) {
 		"chatbot_settings",
 		"ai_contexts",
 		"agent_transfers",
+		"sla_policies",
 		"messages",
 		"contacts",
 		"templates",
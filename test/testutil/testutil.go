@@ -2,6 +2,7 @@
 package testutil
 
 import (
+	"bytes"
 	"context"
 	"os"
 	"sync"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/shridarpatil/whatomate/internal/models"
 	"github.com/stretchr/testify/require"
 	"github.com/zerodha/logf"
 )
@@ -149,3 +151,11 @@ func SetupTestRedis(t *testing.T) *redis.Client {
 
 	return testRedis
 }
+
+// EnableEncryption encrypts secrets at rest with a test master key until the test
+// completes.
+func EnableEncryption(t *testing.T) {
+	t.Helper()
+	require.NoError(t, models.SetEncryptionKeys(bytes.Repeat([]byte{7}, models.EncryptionKeySize)))
+	t.Cleanup(func() { _ = models.SetEncryptionKeys(nil) })
+}